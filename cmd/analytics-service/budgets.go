@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/analytics"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/fx"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/ims-erp/system/pkg/timezone"
+	"github.com/shopspring/decimal"
+)
+
+const budgetsPath = "/api/v1/budgets/"
+
+// handleBudgets lists the tenant's budgets for the months ?from= to ?to=,
+// by default those of the current year.
+func (s *AnalyticsServer) handleBudgets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenantID := middleware.GetTenantID(r.Context())
+	tenantUUID, err := uuid.Parse(tenantID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	year := time.Now().In(s.locales.LocationFor(tenantID)).Format("2006")
+	from, to := year+"-01", year+"-12"
+	if value := r.URL.Query().Get("from"); value != "" {
+		from = value
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to = value
+	}
+	for _, period := range []string{from, to} {
+		if _, err := time.Parse(domain.BudgetPeriodLayout, period); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "from and to must be months formatted YYYY-MM")
+			return
+		}
+	}
+
+	budgets, err := s.budgets.List(r.Context(), tenantUUID, from, to)
+	if err != nil {
+		s.logger.Error("Failed to list budgets", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"budgets": budgets})
+}
+
+// handleBudgetByPeriod returns, defines or deletes the tenant's budget for
+// the month in the path, formatted YYYY-MM.
+func (s *AnalyticsServer) handleBudgetByPeriod(w http.ResponseWriter, r *http.Request) {
+	period := strings.TrimPrefix(r.URL.Path, budgetsPath)
+	if _, err := time.Parse(domain.BudgetPeriodLayout, period); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	tenantUUID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	budget, err := s.budgets.FindByPeriod(r.Context(), tenantUUID, period)
+	if err != nil {
+		s.logger.Error("Failed to load budget", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if budget == nil {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Budget not found")
+			return
+		}
+		httpresponse.SetETag(w, budget.Version)
+		httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"budget": budget})
+	case http.MethodPut:
+		s.putBudget(w, r, tenantUUID, period, budget)
+	case http.MethodDelete:
+		if budget == nil {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Budget not found")
+			return
+		}
+		if expected := commands.ParseIfMatch(r.Header.Get("If-Match")); expected > 0 && expected != budget.Version {
+			httpresponse.Error(w, r, errors.VersionConflict("budget", expected, budget.Version))
+			return
+		}
+		if err := s.budgets.Delete(r.Context(), budget); err != nil {
+			s.logger.Error("Failed to delete budget", "error", err)
+			httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// putBudget defines the month's budget, replacing the lines of an existing
+// one; its currency cannot change.
+func (s *AnalyticsServer) putBudget(w http.ResponseWriter, r *http.Request, tenantID uuid.UUID, period string, budget *domain.Budget) {
+	var req struct {
+		Currency string `json:"currency"`
+		Lines    []struct {
+			Type        string      `json:"type"`
+			Category    string      `json:"category"`
+			Department  string      `json:"department"`
+			Amount      json.Number `json:"amount"`
+			AmountMinor json.Number `json:"amountMinor"`
+		} `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	userID, err := uuid.Parse(middleware.GetUserID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	if budget != nil && currency == "" {
+		currency = budget.Currency
+	}
+	lines := make([]domain.BudgetLine, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		data := map[string]interface{}{}
+		if line.Amount != "" {
+			data["amount"] = line.Amount.String()
+		}
+		if line.AmountMinor != "" {
+			data["amountMinor"] = line.AmountMinor.String()
+		}
+		amount, ok, err := money.Parse(data, "amount", currency)
+		if err != nil {
+			httpresponse.Error(w, r, err)
+			return
+		}
+		if !ok {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "amount is required")
+			return
+		}
+		lines = append(lines, domain.BudgetLine{
+			Type:       domain.BudgetLineType(line.Type),
+			Category:   line.Category,
+			Department: line.Department,
+			Amount:     amount,
+		})
+	}
+
+	status := http.StatusOK
+	if budget == nil {
+		status = http.StatusCreated
+		if budget, err = domain.NewBudget(tenantID, period, currency, lines, userID); err != nil {
+			httpresponse.Error(w, r, budgetError(err))
+			return
+		}
+		if err = s.budgets.Create(r.Context(), budget); stderrors.Is(err, repository.ErrConcurrencyConflict) {
+			httpresponse.Error(w, r, errors.Conflict("budget for %s already exists", period))
+			return
+		}
+	} else {
+		if expected := commands.ParseIfMatch(r.Header.Get("If-Match")); expected > 0 && expected != budget.Version {
+			httpresponse.Error(w, r, errors.VersionConflict("budget", expected, budget.Version))
+			return
+		}
+		if currency != budget.Currency {
+			httpresponse.Error(w, r, errors.Newf(errors.CodeUnprocessable, "budget for %s is in %s", period, budget.Currency))
+			return
+		}
+		if err := budget.SetLines(lines, userID); err != nil {
+			httpresponse.Error(w, r, budgetError(err))
+			return
+		}
+		err = s.budgets.Update(r.Context(), budget)
+	}
+	if stderrors.Is(err, repository.ErrConcurrencyConflict) {
+		httpresponse.Error(w, r, errors.Conflict("budget for %s was changed concurrently", period))
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to save budget", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	httpresponse.SetETag(w, budget.Version)
+	httpresponse.JSON(w, status, map[string]interface{}{"budget": budget})
+}
+
+// handleBudgetVsActual compares the tenant's budget for ?period=, by
+// default the current month, with its actual revenue and expenses.
+func (s *AnalyticsServer) handleBudgetVsActual(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	ctx := r.Context()
+	tenantID := middleware.GetTenantID(ctx)
+	tenantUUID, err := uuid.Parse(tenantID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	loc, err := timezone.FromRequest(r, s.locales.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = time.Now().In(loc).Format(domain.BudgetPeriodLayout)
+	}
+	if _, err := time.Parse(domain.BudgetPeriodLayout, period); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "period must be a month formatted YYYY-MM")
+		return
+	}
+
+	budget, err := s.budgets.FindByPeriod(ctx, tenantUUID, period)
+	if err == nil && budget == nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Budget not found")
+		return
+	}
+	var report *analytics.BudgetReport
+	if err == nil {
+		report, err = s.budgetReport(ctx, budget, loc)
+	}
+	if err != nil {
+		s.logger.Error("Failed to compare budget with actuals", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, report)
+}
+
+// handleBudgetAlerts lists the tenant's budget alerts, of ?period= only
+// when given.
+func (s *AnalyticsServer) handleBudgetAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenantUUID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	alerts, err := s.budgets.OpenAlerts(r.Context(), tenantUUID, r.URL.Query().Get("period"))
+	if err != nil {
+		s.logger.Error("Failed to load budget alerts", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, map[string]interface{}{
+		"threshold": s.budgetsConfig.AlertThreshold,
+		"alerts":    alerts,
+	})
+}
+
+// budgetReport tallies the actuals of the budget's month in loc.
+func (s *AnalyticsServer) budgetReport(ctx context.Context, budget *domain.Budget, loc *time.Location) (*analytics.BudgetReport, error) {
+	from, err := time.ParseInLocation(domain.BudgetPeriodLayout, budget.Period, loc)
+	if err != nil {
+		return nil, err
+	}
+	to := from.AddDate(0, 1, 0)
+
+	categories, err := s.budgets.FindCategories(ctx, budget.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	tally := analytics.NewBudgetTally(budget.Currency, from, to, categories).
+		WithRates(s.budgetRates(ctx, budget))
+	err = s.budgets.EachInvoice(ctx, budget.TenantID, from, to, func(invoice *domain.Invoice) error {
+		tally.AddInvoice(invoice)
+		return nil
+	})
+	if err == nil {
+		err = s.budgets.EachPayment(ctx, budget.TenantID, from, to, func(payment *domain.Payment) error {
+			tally.AddPayment(payment)
+			return nil
+		})
+	}
+	if err == nil {
+		err = s.budgets.EachCashSession(ctx, budget.TenantID, from, to, func(session *domain.CashSession) error {
+			tally.AddCashSession(session)
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tally.Report(budget), nil
+}
+
+// budgetRates looks up exchange rates into the budget's currency, once per
+// currency and day.
+func (s *AnalyticsServer) budgetRates(ctx context.Context, budget *domain.Budget) analytics.RateFunc {
+	type rateKey struct {
+		currency string
+		day      time.Time
+	}
+	cached := make(map[rateKey]*fx.Rate)
+	return func(currency string, at time.Time) (decimal.Decimal, bool) {
+		key := rateKey{currency: currency, day: domain.RateDay(at)}
+		rate, ok := cached[key]
+		if !ok {
+			var err error
+			rate, err = s.rates.Rate(ctx, budget.TenantID, currency, budget.Currency, at)
+			if err != nil && !stderrors.Is(err, fx.ErrNoRate) {
+				s.logger.Warn("Failed to look up exchange rate", "currency", currency, "error", err)
+			}
+			cached[key] = rate
+		}
+		if rate == nil {
+			return decimal.Zero, false
+		}
+		return rate.Rate, true
+	}
+}
+
+// startBudgetChecks checks the current month's budgets every check
+// interval until ctx is cancelled.
+func (s *AnalyticsServer) startBudgetChecks(ctx context.Context) {
+	ticker := time.NewTicker(s.budgetsConfig.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkBudgets(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkBudgets raises an alert for each expense category over its budget
+// for the current month, in each tenant's time zone, and clears the alerts
+// of categories no longer over it. Alerts of past months are kept as they
+// were at the month's last check.
+func (s *AnalyticsServer) checkBudgets(ctx context.Context) {
+	now := time.Now().UTC()
+	// Time zones are at most 14 hours off UTC, so every tenant's current
+	// month is one of these.
+	periods := []string{
+		now.Add(-14 * time.Hour).Format(domain.BudgetPeriodLayout),
+		now.Add(14 * time.Hour).Format(domain.BudgetPeriodLayout),
+	}
+	budgets, err := s.budgets.FindForPeriods(ctx, periods)
+	if err != nil {
+		s.logger.Warn("Failed to load budgets for budget alerts", "error", err)
+		return
+	}
+
+	for _, budget := range budgets {
+		loc := s.locales.LocationFor(budget.TenantID.String())
+		if now.In(loc).Format(domain.BudgetPeriodLayout) != budget.Period {
+			continue
+		}
+		report, err := s.budgetReport(ctx, budget, loc)
+		if err != nil {
+			s.logger.Warn("Failed to compare budget with actuals", "tenant_id", budget.TenantID, "period", budget.Period, "error", err)
+			continue
+		}
+		raised, err := s.budgets.SaveAlerts(ctx, budget, analytics.BudgetAlerts(budget, report, s.budgetsConfig.AlertThreshold, now))
+		if err != nil {
+			s.logger.Warn("Failed to save budget alerts", "tenant_id", budget.TenantID, "period", budget.Period, "error", err)
+			continue
+		}
+		for _, alert := range raised {
+			s.logger.Error("Budget category over budget",
+				"tenant_id", alert.TenantID,
+				"period", alert.Period,
+				"category", alert.Category,
+				"department", alert.Department,
+				"budget", alert.Budget.String(),
+				"actual", alert.Actual.String(),
+				"currency", alert.Currency,
+			)
+		}
+	}
+}
+
+// budgetError reports a budget rule a request broke as unprocessable.
+func budgetError(err error) error {
+	var paymentErr *domain.PaymentError
+	if stderrors.As(err, &paymentErr) {
+		return errors.Newf(errors.CodeUnprocessable, "%s", paymentErr.Message)
+	}
+	return err
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/analytics"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+const purchaseSuggestionsPath = "/api/v1/purchase-suggestions/"
+
+// handlePurchaseSuggestions lists the tenant's purchase suggestions, the
+// open ones unless ?status= asks for accepted, dismissed or all.
+func (s *AnalyticsServer) handlePurchaseSuggestions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenantUUID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	status := domain.PurchaseSuggestionOpen
+	switch value := domain.PurchaseSuggestionStatus(r.URL.Query().Get("status")); value {
+	case "":
+	case "all":
+		status = ""
+	case domain.PurchaseSuggestionOpen, domain.PurchaseSuggestionAccepted, domain.PurchaseSuggestionDismissed:
+		status = value
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "status must be open, accepted, dismissed or all")
+		return
+	}
+
+	suggestions, err := s.suggestions.List(r.Context(), tenantUUID, status)
+	if err != nil {
+		s.logger.Error("Failed to list purchase suggestions", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"suggestions": suggestions})
+}
+
+// handlePurchaseSuggestion returns a purchase suggestion, or accepts or
+// dismisses it on POST to /{id}/accept or /{id}/dismiss.
+func (s *AnalyticsServer) handlePurchaseSuggestion(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, purchaseSuggestionsPath), "/")
+	id, err := uuid.Parse(parts[0])
+	if err != nil || len(parts) > 2 {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	tenantUUID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+	case (action == "accept" || action == "dismiss") && r.Method == http.MethodPost:
+	case action == "" || action == "accept" || action == "dismiss":
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+
+	suggestion, err := s.suggestions.Get(r.Context(), tenantUUID, id)
+	if err != nil {
+		s.logger.Error("Failed to load purchase suggestion", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if suggestion == nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Purchase suggestion not found")
+		return
+	}
+	if action == "" {
+		httpresponse.SetETag(w, suggestion.Version)
+		httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"suggestion": suggestion})
+		return
+	}
+	s.decidePurchaseSuggestion(w, r, suggestion, action)
+}
+
+// decidePurchaseSuggestion accepts the suggestion, for the quantity in the
+// body if one is given, or dismisses it, for the reason in the body.
+func (s *AnalyticsServer) decidePurchaseSuggestion(w http.ResponseWriter, r *http.Request, suggestion *domain.PurchaseSuggestion, action string) {
+	var req struct {
+		Quantity int    `json:"quantity"`
+		Reason   string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	userID, err := uuid.Parse(middleware.GetUserID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if expected := commands.ParseIfMatch(r.Header.Get("If-Match")); expected > 0 && expected != suggestion.Version {
+		httpresponse.Error(w, r, errors.VersionConflict("purchase suggestion", expected, suggestion.Version))
+		return
+	}
+
+	if action == "accept" {
+		err = suggestion.Accept(userID, req.Quantity)
+	} else {
+		err = suggestion.Dismiss(userID, strings.TrimSpace(req.Reason))
+	}
+	if err != nil {
+		httpresponse.Error(w, r, suggestionError(err))
+		return
+	}
+	err = s.suggestions.Update(r.Context(), suggestion)
+	if stderrors.Is(err, repository.ErrConcurrencyConflict) {
+		httpresponse.Error(w, r, errors.Conflict("purchase suggestion %s was changed concurrently", suggestion.ID))
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to save purchase suggestion", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	httpresponse.SetETag(w, suggestion.Version)
+	httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"suggestion": suggestion})
+}
+
+// startForecasting refreshes the purchase suggestions every check interval
+// until ctx is cancelled.
+func (s *AnalyticsServer) startForecasting(ctx context.Context) {
+	ticker := time.NewTicker(s.forecastConfig.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.suggestPurchases(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// suggestPurchases forecasts the demand of each product from the orders of
+// the history window, up to the current month, and suggests purchases of
+// those running low. Only tenants with orders in the window are forecast;
+// the others have no demand to forecast from.
+func (s *AnalyticsServer) suggestPurchases(ctx context.Context) {
+	cfg := s.forecastConfig
+	now := time.Now().UTC()
+	// Whole months only: the first is read from its start, the current one
+	// not at all.
+	months := analytics.NewDemandHistory(now.AddDate(0, -cfg.HistoryMonths, 0), now)
+
+	histories := make(map[uuid.UUID]*analytics.DemandHistory)
+	err := s.suggestions.EachOrder(ctx, uuid.Nil, months.From, months.To, func(order *domain.Order) error {
+		history, ok := histories[order.TenantID]
+		if !ok {
+			history = analytics.NewDemandHistory(months.From, months.To)
+			histories[order.TenantID] = history
+		}
+		history.AddOrder(order)
+		return nil
+	})
+	if err != nil {
+		s.logger.Warn("Failed to load orders for purchase suggestions", "error", err)
+		return
+	}
+
+	for tenantID, history := range histories {
+		suggested, err := s.suggestTenantPurchases(ctx, tenantID, history, now)
+		if err != nil {
+			s.logger.Warn("Failed to suggest purchases", "tenant_id", tenantID, "error", err)
+			continue
+		}
+		for _, suggestion := range suggested {
+			s.logger.Info("Purchase suggested",
+				"tenant_id", tenantID,
+				"product_id", suggestion.ProductID,
+				"sku", suggestion.SKU,
+				"quantity", suggestion.Quantity,
+				"order_by", suggestion.OrderBy.Format(time.DateOnly),
+			)
+		}
+	}
+}
+
+// suggestTenantPurchases plans the next purchase of each of the tenant's
+// stocked products, except those a buyer recently decided on, and saves
+// the plans due within the horizon as its open suggestions. It returns the
+// suggestions that are new.
+func (s *AnalyticsServer) suggestTenantPurchases(ctx context.Context, tenantID uuid.UUID, history *analytics.DemandHistory, now time.Time) ([]domain.PurchaseSuggestion, error) {
+	cfg := s.forecastConfig
+	suppressed, err := s.suggestions.Suppressed(ctx, tenantID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var suggestions []domain.PurchaseSuggestion
+	err = s.suggestions.EachStockedProduct(ctx, tenantID, func(product *domain.Product) error {
+		if suppressed[product.ID] {
+			return nil
+		}
+		position, err := s.stockPosition(ctx, tenantID, product.ID)
+		if err != nil {
+			return err
+		}
+
+		forecast := history.Forecast(product.ID, cfg.Window)
+		policy := analytics.ReorderPolicy{
+			LeadTimeDays:  cfg.LeadTimeDays,
+			SafetyStock:   product.Inventory.MinStockLevel,
+			CoverDays:     cfg.CoverDays,
+			OrderMultiple: product.Inventory.ReorderQuantity,
+			HorizonDays:   cfg.HorizonDays,
+		}
+		if product.Inventory.LeadTime > 0 {
+			policy.LeadTimeDays = product.Inventory.LeadTime
+		}
+		if policy.SafetyStock <= 0 {
+			safety := forecast.Between(now, now.AddDate(0, 0, cfg.SafetyDays))
+			policy.SafetyStock = int(math.Ceil(safety))
+		}
+
+		plan, ok := analytics.PlanPurchase(forecast, position, policy, now)
+		if !ok {
+			return nil
+		}
+		suggestions = append(suggestions, domain.PurchaseSuggestion{
+			ProductID:       product.ID,
+			SKU:             product.SKU,
+			Name:            product.Name,
+			SupplierID:      product.SupplierID,
+			DailyDemand:     plan.DailyDemand,
+			LeadTimeDays:    policy.LeadTimeDays,
+			SafetyStock:     policy.SafetyStock,
+			ReorderPoint:    plan.ReorderPoint,
+			StockPosition:   position,
+			Quantity:        plan.Quantity,
+			OrderBy:         plan.OrderBy,
+			ExpectedArrival: plan.ExpectedArrival,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.suggestions.SaveSuggestions(ctx, tenantID, suggestions, now)
+}
+
+// stockPosition is the product's stock that is not promised to anyone yet:
+// on hand and in transit between warehouses, less what is reserved. It is
+// negative when more is reserved than there is.
+func (s *AnalyticsServer) stockPosition(ctx context.Context, tenantID, productID uuid.UUID) (int, error) {
+	position := queries.NewStockPosition()
+	err := s.transactions.Each(ctx, repository.InventoryTransactionFilter{
+		TenantID:  tenantID.String(),
+		ProductID: productID.String(),
+	}, func(record repository.InventoryTransactionRecord) error {
+		position.Post(record)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	stock := position.Stock(productID.String(), "")
+	return stock.OnHand + stock.InTransit - stock.Reserved, nil
+}
+
+// suggestionError reports a purchase suggestion rule a request broke as
+// unprocessable.
+func suggestionError(err error) error {
+	var inventoryErr *domain.InventoryError
+	if stderrors.As(err, &inventoryErr) {
+		return errors.Newf(errors.CodeUnprocessable, "%s", inventoryErr.Message)
+	}
+	return err
+}
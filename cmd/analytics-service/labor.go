@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/analytics"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/timezone"
+)
+
+// maxLeaderboard caps the operators a labor report lists.
+const maxLeaderboard = 100
+
+// handleLaborMetrics returns pick rates, receipt times and the operator
+// leaderboard over the warehouse operations completed in a period.
+func (s *AnalyticsServer) handleLaborMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	tenantID := middleware.GetTenantID(ctx)
+	tenantUUID, err := uuid.Parse(tenantID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	loc, err := timezone.FromRequest(r, s.locales.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
+		return
+	}
+
+	filter := repository.WarehouseOperationFilter{
+		TenantID: tenantUUID,
+		From:     time.Now().AddDate(0, -1, 0),
+		To:       time.Now(),
+	}
+	if start := params.Get("start"); start != "" {
+		if filter.From, err = timezone.ParseBound(start, loc, false); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid start format")
+			return
+		}
+	}
+	if end := params.Get("end"); end != "" {
+		if filter.To, err = timezone.ParseBound(end, loc, true); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid end format")
+			return
+		}
+	}
+	if warehouseID := params.Get("warehouseId"); warehouseID != "" {
+		if filter.WarehouseID, err = uuid.Parse(warehouseID); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid warehouse ID")
+			return
+		}
+	}
+
+	sortBy := params.Get("sort")
+	switch sortBy {
+	case "", analytics.SortByPicksPerHour, analytics.SortByPicks, analytics.SortByUnits, analytics.SortByHours:
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "sort must be picksPerHour, picks, units or hours")
+		return
+	}
+	limit := 10
+	if value := params.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		if limit > maxLeaderboard {
+			limit = maxLeaderboard
+		}
+	}
+
+	tally := analytics.NewLaborTally()
+	err = s.operations.EachCompleted(ctx, filter, func(operation *domain.WarehouseOperation) error {
+		tally.Add(operation)
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to load warehouse operations", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	report := tally.Report(filter.From, filter.To, sortBy, limit)
+	if filter.WarehouseID != uuid.Nil {
+		report.WarehouseID = filter.WarehouseID.String()
+	}
+	httpresponse.JSON(w, http.StatusOK, report)
+}
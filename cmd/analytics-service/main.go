@@ -6,28 +6,43 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/ims-erp/system/internal/analytics"
+	"github.com/ims-erp/system/internal/auth"
 	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/fx"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/middleware"
 	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/ims-erp/system/pkg/timezone"
 )
 
 // AnalyticsServer provides real-time analytics dashboard
 type AnalyticsServer struct {
-	service    *analytics.ReportingService
-	cache      *repository.Cache
-	logger     *logger.Logger
-	clients    map[string]*DashboardClient
-	mu         sync.RWMutex
-	aggregated *DashboardData
+	service        *analytics.ReportingService
+	operations     *repository.WarehouseOperationStore
+	returns        *repository.ReturnRateStore
+	returnsConfig  config.ReturnsConfig
+	budgets        *repository.BudgetStore
+	budgetsConfig  config.BudgetsConfig
+	suggestions    *repository.PurchaseSuggestionStore
+	transactions   *repository.InventoryTransactionStore
+	forecastConfig config.ForecastingConfig
+	rates          *fx.Service
+	cache          *repository.Cache
+	locales        config.I18nConfig
+	logger         *logger.Logger
+	clients        map[string]*DashboardClient
+	mu             sync.RWMutex
+	aggregated     *DashboardData
 }
 
 // DashboardClient represents a connected WebSocket client
@@ -50,7 +65,7 @@ type DashboardData struct {
 
 func main() {
 	// Load configuration
-	cfg, err := config.Load("analytics-service", "./configs")
+	cfg, err := config.Load("", "analytics-service")
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
@@ -66,6 +81,8 @@ func main() {
 		log.Fatalf("Failed to create logger: %v", err)
 	}
 
+	metrics.Initialize("analytics-service")
+
 	// Initialize repositories
 	mongoDB, err := repository.NewMongoDB(cfg.MongoDB, logr)
 	if err != nil {
@@ -80,35 +97,92 @@ func main() {
 	cache := repository.NewCache(redisClient, "analytics", logr)
 
 	// Initialize reporting service
-	service := analytics.NewReportingService(readModelStore, cache, logr)
+	service := analytics.NewReportingService(
+		readModelStore,
+		repository.NewReadModelStore(mongoDB, events.InvoiceDaySummaryCollection, logr),
+		repository.NewReadModelStore(mongoDB, events.InvoiceClientSummaryCollection, logr),
+		cache,
+		logr,
+	)
+
+	operations := repository.NewWarehouseOperationStore(mongoDB)
+	if err := operations.EnsureIndexes(context.Background()); err != nil {
+		logr.Warn("Failed to create warehouse operation indexes", "error", err)
+	}
+	returns := repository.NewReturnRateStore(mongoDB)
+	if err := returns.EnsureIndexes(context.Background()); err != nil {
+		logr.Warn("Failed to create return rate indexes", "error", err)
+	}
+
+	budgets := repository.NewBudgetStore(mongoDB)
+	if err := budgets.EnsureIndexes(context.Background()); err != nil {
+		logr.Warn("Failed to create budget indexes", "error", err)
+	}
+	suggestions := repository.NewPurchaseSuggestionStore(mongoDB)
+	if err := suggestions.EnsureIndexes(context.Background()); err != nil {
+		logr.Warn("Failed to create purchase suggestion indexes", "error", err)
+	}
+	transactions := repository.NewInventoryTransactionStore(mongoDB)
+	// Rates are synced by the invoice service; budgets only look them up.
+	rates := fx.NewService(cfg.FX, repository.NewExchangeRateStore(mongoDB), nil, logr)
 
 	// Create server
-	server := NewAnalyticsServer(service, cache, logr)
+	server := NewAnalyticsServer(service, operations, returns, budgets, suggestions, transactions, rates, cache, cfg, logr)
 
 	// Start background aggregation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	go server.startAggregation(ctx)
-	go server.startCacheWarming(ctx)
+	group := lifecycle.New(logr)
+	group.Go("dashboard aggregation", server.startAggregation)
+	group.Go("cache warming", server.startCacheWarming)
+	group.Go("return rate alerts", server.startReturnRateChecks)
+	group.Go("budget alerts", server.startBudgetChecks)
+	group.Go("purchase suggestions", server.startForecasting)
 
 	// Setup HTTP server
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/v1/dashboard", server.handleDashboard)
 	mux.HandleFunc("/api/v1/dashboard/ws", server.handleWebSocket)
 	mux.HandleFunc("/api/v1/health", server.handleHealth)
-	mux.HandleFunc("/api/v1/metrics/revenue", server.handleRevenueMetrics)
-	mux.HandleFunc("/api/v1/metrics/aging", server.handleAgingMetrics)
-	mux.HandleFunc("/api/v1/metrics/payments", server.handlePaymentMetrics)
+	// The metrics endpoints aggregate over a tenant's history on request.
+	throttle := middleware.NewThrottle(repository.NewRateLimiter(redisClient, logr), cfg.Security.Throttle, logr)
+	report := func(handler http.HandlerFunc) http.Handler {
+		return throttle.Limit(middleware.ThrottleReport, handler)
+	}
+	mux.Handle("/api/v1/metrics/revenue", report(server.handleRevenueMetrics))
+	mux.Handle("/api/v1/metrics/aging", report(server.handleAgingMetrics))
+	mux.Handle("/api/v1/metrics/payments", report(server.handlePaymentMetrics))
+	mux.Handle("/api/v1/metrics/labor", report(server.handleLaborMetrics))
+	mux.Handle("/api/v1/metrics/returns", report(server.handleReturnMetrics))
+	mux.HandleFunc("/api/v1/metrics/returns/alerts", server.handleReturnAlerts)
+	mux.Handle("/api/v1/metrics/budget-vs-actual", report(server.handleBudgetVsActual))
+	mux.HandleFunc("/api/v1/metrics/budget-vs-actual/alerts", server.handleBudgetAlerts)
+	mux.HandleFunc("/api/v1/budgets", server.handleBudgets)
+	mux.HandleFunc(budgetsPath, server.handleBudgetByPeriod)
+	mux.HandleFunc("/api/v1/purchase-suggestions", server.handlePurchaseSuggestions)
+	mux.HandleFunc(purchaseSuggestionsPath, server.handlePurchaseSuggestion)
+	mux.Handle("/metrics", metrics.Handler())
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, logr)
+	if err != nil {
+		log.Fatalf("Failed to configure token validation: %v", err)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator, "/api/v1/health")
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
-		Handler:      mux,
+		Handler:      metrics.HTTPMiddleware(middleware.Instrument(logr, tenants.Handler(mux))),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Hooks run last-registered first: stop accepting connections, then
+	// close the open dashboards.
+	group.OnShutdown("dashboard websockets", func(ctx context.Context) error {
+		server.closeAllClients()
+		return nil
+	})
+	group.OnShutdown("http server", srv.Shutdown)
+
 	// Start server in goroutine
 	go func() {
 		logr.Info("Starting analytics service", "port", cfg.App.Port)
@@ -118,33 +192,30 @@ func main() {
 	}()
 
 	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	logr.Info("Shutting down analytics service...")
-
-	// Graceful shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
-
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		logr.Error("Server shutdown error", "error", err)
+	sig := group.WaitForSignal()
+	logr.Info("Shutting down analytics service...", "signal", sig)
+	if err := group.Shutdown(cfg.App.ShutdownTimeout); err != nil {
+		logr.Error("Shutdown incomplete", "error", err)
 	}
-
-	// Close all WebSocket connections
-	server.closeAllClients()
-
-	logr.Info("Analytics service stopped")
 }
 
 // NewAnalyticsServer creates a new analytics server
-func NewAnalyticsServer(service *analytics.ReportingService, cache *repository.Cache, log *logger.Logger) *AnalyticsServer {
+func NewAnalyticsServer(service *analytics.ReportingService, operations *repository.WarehouseOperationStore, returns *repository.ReturnRateStore, budgets *repository.BudgetStore, suggestions *repository.PurchaseSuggestionStore, transactions *repository.InventoryTransactionStore, rates *fx.Service, cache *repository.Cache, cfg *config.Config, log *logger.Logger) *AnalyticsServer {
 	return &AnalyticsServer{
-		service: service,
-		cache:   cache,
-		logger:  log,
-		clients: make(map[string]*DashboardClient),
+		service:        service,
+		operations:     operations,
+		returns:        returns,
+		returnsConfig:  cfg.Returns,
+		budgets:        budgets,
+		budgetsConfig:  cfg.Budgets,
+		suggestions:    suggestions,
+		transactions:   transactions,
+		forecastConfig: cfg.Forecasting,
+		rates:          rates,
+		cache:          cache,
+		locales:        cfg.I18n,
+		logger:         log,
+		clients:        make(map[string]*DashboardClient),
 	}
 }
 
@@ -153,23 +224,26 @@ func (s *AnalyticsServer) handleDashboard(w http.ResponseWriter, r *http.Request
 	ctx := r.Context()
 
 	// Get tenant ID from request
-	tenantID := r.Header.Get("X-Tenant-ID")
-	if tenantID == "" {
-		tenantID = "default"
-	}
+	tenantID := middleware.GetTenantID(ctx)
 
 	// Parse tenant UUID
 	tenantUUID, err := uuid.Parse(tenantID)
 	if err != nil {
-		http.Error(w, "Invalid tenant ID", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	loc, err := timezone.FromRequest(r, s.locales.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
 		return
 	}
 
 	// Get dashboard data
-	data, err := s.service.GetDashboardData(ctx, tenantUUID)
+	data, err := s.service.GetDashboardData(ctx, tenantUUID, loc)
 	if err != nil {
 		s.logger.Error("Failed to get dashboard data", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -187,10 +261,7 @@ func (s *AnalyticsServer) handleWebSocket(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get tenant ID from request
-	tenantID := r.Header.Get("X-Tenant-ID")
-	if tenantID == "" {
-		tenantID = "default"
-	}
+	tenantID := middleware.GetTenantID(r.Context())
 
 	// Upgrade connection
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -239,14 +310,17 @@ func (s *AnalyticsServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 func (s *AnalyticsServer) handleRevenueMetrics(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	tenantID := r.Header.Get("X-Tenant-ID")
-	if tenantID == "" {
-		tenantID = "default"
-	}
+	tenantID := middleware.GetTenantID(ctx)
 
 	tenantUUID, err := uuid.Parse(tenantID)
 	if err != nil {
-		http.Error(w, "Invalid tenant ID", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	loc, err := timezone.FromRequest(r, s.locales.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
 		return
 	}
 
@@ -255,13 +329,13 @@ func (s *AnalyticsServer) handleRevenueMetrics(w http.ResponseWriter, r *http.Re
 	endDate := time.Now()
 
 	if start := r.URL.Query().Get("start"); start != "" {
-		if parsed, err := time.Parse(time.RFC3339, start); err == nil {
+		if parsed, err := timezone.ParseBound(start, loc, false); err == nil {
 			startDate = parsed
 		}
 	}
 
 	if end := r.URL.Query().Get("end"); end != "" {
-		if parsed, err := time.Parse(time.RFC3339, end); err == nil {
+		if parsed, err := timezone.ParseBound(end, loc, true); err == nil {
 			endDate = parsed
 		}
 	}
@@ -269,7 +343,7 @@ func (s *AnalyticsServer) handleRevenueMetrics(w http.ResponseWriter, r *http.Re
 	summary, err := s.service.GetRevenueSummary(ctx, tenantUUID, startDate, endDate)
 	if err != nil {
 		s.logger.Error("Failed to get revenue summary", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -281,28 +355,31 @@ func (s *AnalyticsServer) handleRevenueMetrics(w http.ResponseWriter, r *http.Re
 func (s *AnalyticsServer) handleAgingMetrics(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	tenantID := r.Header.Get("X-Tenant-ID")
-	if tenantID == "" {
-		tenantID = "default"
-	}
+	tenantID := middleware.GetTenantID(ctx)
 
 	tenantUUID, err := uuid.Parse(tenantID)
 	if err != nil {
-		http.Error(w, "Invalid tenant ID", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	loc, err := timezone.FromRequest(r, s.locales.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
 		return
 	}
 
 	asOfDate := time.Now()
 	if date := r.URL.Query().Get("as_of"); date != "" {
-		if parsed, err := time.Parse(time.RFC3339, date); err == nil {
+		if parsed, err := timezone.ParseBound(date, loc, false); err == nil {
 			asOfDate = parsed
 		}
 	}
 
-	report, err := s.service.GetAgingReport(ctx, tenantUUID, asOfDate)
+	report, err := s.service.GetAgingReport(ctx, tenantUUID, asOfDate, loc)
 	if err != nil {
 		s.logger.Error("Failed to get aging report", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -314,14 +391,17 @@ func (s *AnalyticsServer) handleAgingMetrics(w http.ResponseWriter, r *http.Requ
 func (s *AnalyticsServer) handlePaymentMetrics(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	tenantID := r.Header.Get("X-Tenant-ID")
-	if tenantID == "" {
-		tenantID = "default"
-	}
+	tenantID := middleware.GetTenantID(ctx)
 
 	tenantUUID, err := uuid.Parse(tenantID)
 	if err != nil {
-		http.Error(w, "Invalid tenant ID", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	loc, err := timezone.FromRequest(r, s.locales.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
 		return
 	}
 
@@ -330,13 +410,13 @@ func (s *AnalyticsServer) handlePaymentMetrics(w http.ResponseWriter, r *http.Re
 	endDate := time.Now()
 
 	if start := r.URL.Query().Get("start"); start != "" {
-		if parsed, err := time.Parse(time.RFC3339, start); err == nil {
+		if parsed, err := timezone.ParseBound(start, loc, false); err == nil {
 			startDate = parsed
 		}
 	}
 
 	if end := r.URL.Query().Get("end"); end != "" {
-		if parsed, err := time.Parse(time.RFC3339, end); err == nil {
+		if parsed, err := timezone.ParseBound(end, loc, true); err == nil {
 			endDate = parsed
 		}
 	}
@@ -344,7 +424,7 @@ func (s *AnalyticsServer) handlePaymentMetrics(w http.ResponseWriter, r *http.Re
 	summary, err := s.service.GetPaymentSummary(ctx, tenantUUID, startDate, endDate)
 	if err != nil {
 		s.logger.Error("Failed to get payment summary", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -372,7 +452,7 @@ func (s *AnalyticsServer) aggregateMetrics(ctx context.Context) {
 	// Get aggregated metrics for default tenant
 	tenantUUID := uuid.MustParse("default")
 
-	dashboard, err := s.service.GetDashboardData(ctx, tenantUUID)
+	dashboard, err := s.service.GetDashboardData(ctx, tenantUUID, s.locales.LocationFor(tenantUUID.String()))
 	if err != nil {
 		s.logger.Error("Failed to aggregate metrics", "error", err)
 		return
@@ -422,7 +502,7 @@ func (s *AnalyticsServer) warmCache(ctx context.Context) {
 			continue
 		}
 
-		_, err = s.service.GetDashboardData(ctx, tenantUUID)
+		_, err = s.service.GetDashboardData(ctx, tenantUUID, s.locales.LocationFor(tenantID))
 		if err != nil {
 			s.logger.Error("Failed to warm cache", "tenant", tenantID, "error", err)
 		}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/analytics"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/timezone"
+)
+
+// handleReturnMetrics returns the units shipped and returned in a period
+// and the return rates, reasons and dispositions per product, supplier or
+// lot, highest rate first.
+func (s *AnalyticsServer) handleReturnMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	tenantID := middleware.GetTenantID(ctx)
+	tenantUUID, err := uuid.Parse(tenantID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	loc, err := timezone.FromRequest(r, s.locales.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-s.returnsConfig.AlertWindow)
+	if start := params.Get("start"); start != "" {
+		if from, err = timezone.ParseBound(start, loc, false); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid start format")
+			return
+		}
+	}
+	if end := params.Get("end"); end != "" {
+		if to, err = timezone.ParseBound(end, loc, true); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid end format")
+			return
+		}
+	}
+
+	groupBy := params.Get("groupBy")
+	switch groupBy {
+	case "", analytics.ReturnsByProduct, analytics.ReturnsBySupplier, analytics.ReturnsByLot:
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "groupBy must be product, supplier or lot")
+		return
+	}
+	limit := 50
+	if value := params.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	tally := analytics.NewReturnTally(groupBy)
+	err = s.returns.EachReturn(ctx, tenantUUID, from, to, func(rma *domain.ReturnAuthorization) error {
+		tally.AddReturn(rma)
+		return nil
+	})
+	if err == nil {
+		err = s.addShipments(ctx, tally, tenantUUID, from, to, groupBy == analytics.ReturnsBySupplier)
+	}
+	if err != nil {
+		s.logger.Error("Failed to load returns", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	httpresponse.JSON(w, http.StatusOK, tally.Report(from, to, limit))
+}
+
+// handleReturnAlerts lists the tenant's products whose return rate is above
+// its threshold as of the last check.
+func (s *AnalyticsServer) handleReturnAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	tenantUUID, err := uuid.Parse(tenantID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	alerts, err := s.returns.OpenAlerts(r.Context(), tenantUUID)
+	if err != nil {
+		s.logger.Error("Failed to load return rate alerts", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, map[string]interface{}{
+		"threshold": s.returnsConfig.ThresholdFor(tenantID),
+		"window":    s.returnsConfig.AlertWindow.String(),
+		"alerts":    alerts,
+	})
+}
+
+// addShipments counts the tenant's shipments in [from, to), looking up the
+// supplier of each product shipped when bySupplier is set. Shipments are
+// summed per product and lot first, so that only as many products are
+// looked up as were shipped.
+func (s *AnalyticsServer) addShipments(ctx context.Context, tally *analytics.ReturnTally, tenantID uuid.UUID, from, to time.Time, bySupplier bool) error {
+	type productLot struct {
+		product string
+		lot     string
+	}
+	shipped := make(map[productLot]int)
+	err := s.returns.EachShipment(ctx, tenantID, from, to, func(record repository.InventoryTransactionRecord) error {
+		shipped[productLot{record.ProductID, record.LotNumber}] += record.Quantity
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	suppliers := map[uuid.UUID]uuid.UUID{}
+	if bySupplier && len(shipped) > 0 {
+		var productIDs []uuid.UUID
+		seen := make(map[string]bool)
+		for key := range shipped {
+			if id, err := uuid.Parse(key.product); err == nil && !seen[key.product] {
+				seen[key.product] = true
+				productIDs = append(productIDs, id)
+			}
+		}
+		if suppliers, err = s.returns.FindSuppliers(ctx, tenantID, productIDs); err != nil {
+			return err
+		}
+	}
+
+	for key, quantity := range shipped {
+		supplierID := ""
+		if id, err := uuid.Parse(key.product); err == nil {
+			if supplier, ok := suppliers[id]; ok {
+				supplierID = supplier.String()
+			}
+		}
+		tally.AddShipment(key.product, supplierID, key.lot, quantity)
+	}
+	return nil
+}
+
+// startReturnRateChecks checks return rates every check interval until ctx
+// is cancelled.
+func (s *AnalyticsServer) startReturnRateChecks(ctx context.Context) {
+	ticker := time.NewTicker(s.returnsConfig.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkReturnRates(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkReturnRates raises an alert for each product returned more than its
+// tenant's threshold over the alert window, and clears the alerts of
+// products no longer above it. Only tenants with returns in the window are
+// checked; the others have nothing to alert on. Alerts are only cleared
+// once every tenant was checked.
+func (s *AnalyticsServer) checkReturnRates(ctx context.Context) {
+	cfg := s.returnsConfig
+	to := time.Now().UTC()
+	from := to.Add(-cfg.AlertWindow)
+
+	tallies := make(map[uuid.UUID]*analytics.ReturnTally)
+	err := s.returns.EachReturn(ctx, uuid.Nil, from, to, func(rma *domain.ReturnAuthorization) error {
+		tally, ok := tallies[rma.TenantID]
+		if !ok {
+			tally = analytics.NewReturnTally(analytics.ReturnsByProduct)
+			tallies[rma.TenantID] = tally
+		}
+		tally.AddReturn(rma)
+		return nil
+	})
+	if err != nil {
+		s.logger.Warn("Failed to load returns for return rate alerts", "error", err)
+		return
+	}
+
+	checked := true
+	for tenantID, tally := range tallies {
+		if err := s.addShipments(ctx, tally, tenantID, from, to, false); err != nil {
+			s.logger.Warn("Failed to load shipments for return rate alerts", "tenant_id", tenantID, "error", err)
+			checked = false
+			continue
+		}
+		policy := analytics.ReturnAlertPolicy{
+			Threshold:   cfg.ThresholdFor(tenantID.String()),
+			MinShipped:  cfg.MinShipped,
+			QualityOnly: cfg.QualityOnly,
+		}
+		raised, err := s.returns.SaveAlerts(ctx, tenantID, tally.Alerts(tenantID, from, to, policy))
+		if err != nil {
+			s.logger.Warn("Failed to save return rate alerts", "tenant_id", tenantID, "error", err)
+			checked = false
+			continue
+		}
+		for _, alert := range raised {
+			s.logger.Error("Product return rate above threshold",
+				"tenant_id", tenantID,
+				"product_id", alert.ProductID,
+				"return_rate", alert.ReturnRate,
+				"threshold", alert.Threshold,
+				"units_shipped", alert.UnitsShipped,
+				"units_returned", alert.UnitsReturned,
+			)
+		}
+	}
+
+	if !checked {
+		return
+	}
+	if _, err := s.returns.ClearAlerts(ctx, to); err != nil {
+		s.logger.Warn("Failed to clear return rate alerts", "error", err)
+	}
+}
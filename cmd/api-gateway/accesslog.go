@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"math"
+	mrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+type accessRecordKey struct{}
+
+// accessRecord is filled in by the authentication middleware and the proxy
+// path so the access log knows the tenant and which upstream actually served
+// the request.
+type accessRecord struct {
+	route    string
+	upstream string
+	tenantID string
+}
+
+func accessRecordFrom(ctx context.Context) *accessRecord {
+	if rec, ok := ctx.Value(accessRecordKey{}).(*accessRecord); ok {
+		return rec
+	}
+	return nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// accessLogMiddleware assigns a request ID, makes sure a W3C traceparent is
+// forwarded downstream and emits one structured log line per request.
+func (g *APIGateway) accessLogMiddleware(next http.Handler) http.Handler {
+	propagator := propagation.TraceContext{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		method, path := r.Method, r.URL.Path
+
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = generateRequestID()
+		}
+		r.Header.Set("X-Request-ID", requestID)
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, newSpanContext())
+		}
+		propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+		traceID := trace.SpanContextFromContext(ctx).TraceID().String()
+
+		ctx = logger.WithRequestID(ctx, requestID)
+		ctx = logger.WithTraceID(ctx, traceID)
+
+		rec := &accessRecord{route: routeName(path)}
+		ctx = context.WithValue(ctx, accessRecordKey{}, rec)
+
+		sw := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		cfg := g.tunables.Load().accessLog
+		if cfg.Disabled {
+			return
+		}
+		if rec.tenantID != "" {
+			ctx = logger.WithTenantID(ctx, rec.tenantID)
+		}
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		latency := time.Since(start)
+		if !shouldLogAccess(status, latency, cfg.SlowThreshold, cfg.SampleRate) {
+			return
+		}
+
+		g.logger.New(ctx).Infow("Gateway access",
+			"method", method,
+			"path", path,
+			"route", rec.route,
+			"upstream", rec.upstream,
+			"status", status,
+			"bytes", sw.bytes,
+			"latency_ms", float64(latency.Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+func shouldLogAccess(status int, latency, slowThreshold time.Duration, sampleRate float64) bool {
+	if status >= http.StatusBadRequest {
+		return true
+	}
+	if slowThreshold > 0 && latency >= slowThreshold {
+		return true
+	}
+	if sampleRate >= 1 {
+		return true
+	}
+	return mrand.Float64() < math.Max(sampleRate, 0)
+}
+
+// routeName returns the resource segment of /api/vN/<route>/..., or the path
+// itself for non-API endpoints such as /health.
+func routeName(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) >= 3 && parts[0] == "api" {
+		return parts[1] + "/" + parts[2]
+	}
+	return path
+}
+
+func newSpanContext() trace.SpanContext {
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	rand.Read(traceID[:])
+	rand.Read(spanID[:])
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+}
+
+func generateRequestID() string {
+	return uuid.New().String()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// newAccessLogGateway returns a gateway logging to a file, and a function
+// reading back the lines it has written.
+func newAccessLogGateway(t *testing.T, cfg config.AccessLogConfig) (*APIGateway, func() []map[string]interface{}) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	log, err := logger.New(logger.Config{Level: "info", Format: "json", OutputPath: path, ServiceName: "test"})
+	require.NoError(t, err)
+
+	g := &APIGateway{logger: log}
+	g.tunables.Store(&tunables{accessLog: cfg})
+
+	return g, func() []map[string]interface{} {
+		_ = log.Sync()
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			if line["msg"] == "Gateway access" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	g, accessLines := newAccessLogGateway(t, config.AccessLogConfig{SampleRate: 1})
+
+	var forwarded http.Header
+	handler := g.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+		rec := accessRecordFrom(r.Context())
+		require.NotNil(t, rec)
+		rec.tenantID = "tenant-a"
+		rec.upstream = "http://localhost:8083"
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"inv-1"}`))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/invoices/inv-1/send", nil))
+
+	requestID := rec.Header().Get("X-Request-ID")
+	require.NotEmpty(t, requestID, "a request ID is assigned")
+	assert.Equal(t, requestID, forwarded.Get("X-Request-ID"))
+	traceparent := forwarded.Get("traceparent")
+	require.Len(t, traceparent, 55, "a traceparent is started for requests without one")
+
+	lines := accessLines()
+	require.Len(t, lines, 1)
+	line := lines[0]
+	assert.Equal(t, requestID, line["request_id"])
+	assert.Equal(t, traceparent[3:35], line["trace_id"])
+	assert.Equal(t, "tenant-a", line["tenant_id"])
+	assert.Equal(t, "v1/invoices", line["route"])
+	assert.Equal(t, "http://localhost:8083", line["upstream"])
+	assert.Equal(t, float64(http.StatusCreated), line["status"])
+	assert.Equal(t, float64(len(`{"id":"inv-1"}`)), line["bytes"])
+}
+
+func TestAccessLogMiddleware_KeepsIncomingIDs(t *testing.T) {
+	g, accessLines := newAccessLogGateway(t, config.AccessLogConfig{SampleRate: 1})
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var forwarded http.Header
+	handler := g.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("traceparent", traceparent)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, "req-1", rec.Header().Get("X-Request-ID"))
+	assert.Equal(t, traceparent, forwarded.Get("traceparent"))
+
+	lines := accessLines()
+	require.Len(t, lines, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", lines[0]["trace_id"])
+	assert.Equal(t, "/health", lines[0]["route"])
+	assert.Equal(t, float64(http.StatusOK), lines[0]["status"], "a handler that writes nothing answers 200")
+}
+
+func TestAccessLogMiddleware_Disabled(t *testing.T) {
+	g, accessLines := newAccessLogGateway(t, config.AccessLogConfig{Disabled: true, SampleRate: 1})
+	handler := g.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil))
+
+	assert.NotEmpty(t, rec.Header().Get("X-Request-ID"), "request IDs are assigned with logging off")
+	assert.Empty(t, accessLines())
+}
+
+func TestShouldLogAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		latency    time.Duration
+		sampleRate float64
+		want       bool
+	}{
+		{"sampled out", http.StatusOK, time.Millisecond, 0, false},
+		{"every request", http.StatusOK, time.Millisecond, 1, true},
+		{"client error", http.StatusNotFound, time.Millisecond, 0, true},
+		{"server error", http.StatusBadGateway, time.Millisecond, 0, true},
+		{"slow", http.StatusOK, 2 * time.Second, 0, true},
+		{"negative rate", http.StatusOK, time.Millisecond, -1, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, shouldLogAccess(tt.status, tt.latency, time.Second, tt.sampleRate), tt.name)
+	}
+	assert.False(t, shouldLogAccess(http.StatusOK, time.Hour, 0, 0), "a zero threshold logs no request as slow")
+}
+
+func TestRouteName(t *testing.T) {
+	assert.Equal(t, "v1/clients", routeName("/api/v1/clients/42/contacts"))
+	assert.Equal(t, "v2/invoices", routeName("/api/v2/invoices"))
+	assert.Equal(t, "/health", routeName("/health"))
+	assert.Equal(t, "/api/v1", routeName("/api/v1"))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/jsonschema"
+)
+
+type bodyLimit struct {
+	prefix   string
+	maxBytes int64
+}
+
+type routeSchema struct {
+	method string
+	prefix string
+	schema *jsonschema.Schema
+}
+
+// BodyPolicy enforces per-route body size limits and optional JSON schema
+// validation before a request is proxied.
+type BodyPolicy struct {
+	defaultMax int64
+	limits     []bodyLimit
+	schemas    []routeSchema
+}
+
+func NewBodyPolicy(cfg config.GatewayConfig) (*BodyPolicy, error) {
+	p := &BodyPolicy{defaultMax: cfg.BodyLimits.DefaultMaxBytes}
+
+	for _, rl := range cfg.BodyLimits.Routes {
+		if rl.Prefix == "" || rl.MaxBytes <= 0 {
+			continue
+		}
+		p.limits = append(p.limits, bodyLimit{prefix: rl.Prefix, maxBytes: rl.MaxBytes})
+	}
+	sort.SliceStable(p.limits, func(i, j int) bool {
+		return len(p.limits[i].prefix) > len(p.limits[j].prefix)
+	})
+
+	for _, sc := range cfg.Schemas {
+		schema, err := jsonschema.LoadFile(sc.File)
+		if err != nil {
+			return nil, err
+		}
+		p.schemas = append(p.schemas, routeSchema{
+			method: strings.ToUpper(sc.Method),
+			prefix: sc.Prefix,
+			schema: schema,
+		})
+	}
+	sort.SliceStable(p.schemas, func(i, j int) bool {
+		return len(p.schemas[i].prefix) > len(p.schemas[j].prefix)
+	})
+
+	return p, nil
+}
+
+func (p *BodyPolicy) MaxBytes(path string) int64 {
+	for _, l := range p.limits {
+		if strings.HasPrefix(path, l.prefix) {
+			return l.maxBytes
+		}
+	}
+	return p.defaultMax
+}
+
+func (p *BodyPolicy) Schema(method, path string) *jsonschema.Schema {
+	for _, s := range p.schemas {
+		if (s.method == "" || s.method == method) && strings.HasPrefix(path, s.prefix) {
+			return s.schema
+		}
+	}
+	return nil
+}
+
+func (g *APIGateway) bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		maxBytes := g.bodies.MaxBytes(r.URL.Path)
+		if maxBytes > 0 {
+			if r.ContentLength > maxBytes {
+				httpresponse.WriteError(w, r, http.StatusRequestEntityTooLarge, errors.Newf(errors.CodePayloadTooLarge, "request body exceeds %d bytes", maxBytes))
+				return
+			}
+			// Chunked bodies are capped while streaming; the proxy error
+			// handler turns the resulting read error into a 413.
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		}
+
+		schema := g.bodies.Schema(r.Method, r.URL.Path)
+		if schema == nil || !isJSON(r.Header.Get("Content-Type")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if stderrors.As(err, &maxErr) {
+				httpresponse.WriteError(w, r, http.StatusRequestEntityTooLarge, errors.Newf(errors.CodePayloadTooLarge, "request body exceeds %d bytes", maxErr.Limit))
+				return
+			}
+			httpresponse.WriteError(w, r, http.StatusBadRequest, errors.InvalidArgument("failed to read request body"))
+			return
+		}
+
+		violations, err := schema.ValidateJSON(body)
+		if err != nil {
+			httpresponse.WriteError(w, r, http.StatusBadRequest, errors.InvalidArgument("request body is not valid JSON"))
+			return
+		}
+		if len(violations) > 0 {
+			appErr := errors.InvalidArgument("request body failed schema validation")
+			appErr.Details = violations
+			httpresponse.WriteError(w, r, http.StatusUnprocessableEntity, appErr)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// proxyErrorHandler distinguishes oversize bodies detected mid-stream from
+// genuine upstream failures.
+func (g *APIGateway) proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	var maxErr *http.MaxBytesError
+	if stderrors.As(err, &maxErr) {
+		httpresponse.WriteError(w, r, http.StatusRequestEntityTooLarge, errors.Newf(errors.CodePayloadTooLarge, "request body exceeds %d bytes", maxErr.Limit))
+		return
+	}
+
+	g.logger.New(r.Context()).Errorw("Upstream request failed", "error", err, "path", r.URL.Path)
+	httpresponse.WriteError(w, r, http.StatusBadGateway, errors.ServiceUnavailable("upstream service unavailable"))
+}
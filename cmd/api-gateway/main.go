@@ -13,9 +13,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ims-erp/system/internal/auth"
 	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/middleware"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 	"github.com/ims-erp/system/pkg/tracer"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"sync/atomic"
 )
 
 type ServiceConfig struct {
@@ -30,24 +36,46 @@ type APIGateway struct {
 	logger   *logger.Logger
 	services map[string]ServiceConfig
 	routes   map[string]string
+	versions *VersionRouter
+	bodies   *BodyPolicy
+	tunables atomic.Pointer[tunables]
+	limiter  *rateLimiter
 }
 
-func NewAPIGateway(cfg *config.Config, log *logger.Logger) *APIGateway {
-	return &APIGateway{
+func NewAPIGateway(cfg *config.Config, log *logger.Logger) (*APIGateway, error) {
+	bodies, err := NewBodyPolicy(cfg.Gateway)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load body policy: %w", err)
+	}
+
+	g := &APIGateway{
 		config:   cfg,
 		logger:   log,
 		services: make(map[string]ServiceConfig),
 		routes: map[string]string{
-			"auth":      "http://localhost:8081",
-			"clients":   "http://localhost:8082",
-			"invoices":  "http://localhost:8083",
-			"payments":  "http://localhost:8084",
-			"products":  "http://localhost:8085",
-			"orders":    "http://localhost:8086",
-			"users":     "http://localhost:8081",
-			"inventory": "http://localhost:8084",
+			"auth":          "http://localhost:8081",
+			"clients":       "http://localhost:8082",
+			"invoices":      "http://localhost:8083",
+			"payments":      "http://localhost:8084",
+			"products":      "http://localhost:8085",
+			"orders":        "http://localhost:8086",
+			"users":         "http://localhost:8081",
+			"feature-flags": "http://localhost:8081",
+			"preferences":   "http://localhost:8081",
+			"comments":      "http://localhost:8081",
+			"inventory":     "http://localhost:8084",
+			"webhooks":      "http://localhost:8089",
+			"notifications": "http://localhost:8090",
+			"audit":         "http://localhost:8091",
+			"search":        "http://localhost:8092",
+			"approvals":     "http://localhost:8093",
 		},
+		versions: NewVersionRouter(cfg.Gateway.Versioning.Routes),
+		bodies:   bodies,
+		limiter:  newRateLimiter(),
 	}
+	g.tunables.Store(newTunables(cfg))
+	return g, nil
 }
 
 func (g *APIGateway) SetRouteTarget(route, target string) {
@@ -74,30 +102,50 @@ func (g *APIGateway) AddService(name string, svcURL string, paths map[string]str
 	}
 }
 
-func (g *APIGateway) buildRouter() http.Handler {
+func (g *APIGateway) buildRouter(reload http.Handler) http.Handler {
 	mux := http.NewServeMux()
 
+	mux.Handle("/config/reload", reload)
 	mux.HandleFunc("/health", g.healthHandler)
 	mux.HandleFunc("/ready", g.readinessHandler)
 	mux.HandleFunc("/live", g.livenessHandler)
+	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/api/v1/auth/", g.authHandler)
 	mux.HandleFunc("/api/v1/auth", g.authHandler)
 	mux.HandleFunc("/api/v1/clients/", g.clientsHandler)
 	mux.HandleFunc("/api/v1/clients", g.clientsHandler)
+	mux.HandleFunc("/api/v1/graphql", g.clientsHandler)
 	mux.HandleFunc("/api/v1/invoices/", g.invoicesHandler)
 	mux.HandleFunc("/api/v1/payments/", g.paymentsHandler)
+	mux.HandleFunc("/api/v1/fx/", g.fxHandler)
 	mux.HandleFunc("/api/v1/products/", g.productsHandler)
 	mux.HandleFunc("/api/v1/products", g.productsHandler)
 	mux.HandleFunc("/api/v1/orders/", g.ordersHandler)
 	mux.HandleFunc("/api/v1/orders", g.ordersHandler)
 	mux.HandleFunc("/api/v1/users", g.usersHandler)
+	mux.HandleFunc("/api/v1/feature-flags/", g.featureFlagsHandler)
+	mux.HandleFunc("/api/v1/feature-flags", g.featureFlagsHandler)
+	mux.HandleFunc("/api/v1/preferences/", g.preferencesHandler)
+	mux.HandleFunc("/api/v1/preferences", g.preferencesHandler)
+	mux.HandleFunc("/api/v1/comments/", g.commentsHandler)
 	mux.HandleFunc("/api/v1/inventory/", g.inventoryHandler)
 	mux.HandleFunc("/api/v1/inventory", g.inventoryHandler)
+	mux.HandleFunc("/api/v1/webhooks/", g.webhooksHandler)
+	mux.HandleFunc("/api/v1/notifications/", g.notificationsHandler)
+	mux.HandleFunc("/api/v1/notifications", g.notificationsHandler)
+	mux.HandleFunc("/api/v1/audit/", g.auditHandler)
+	mux.HandleFunc("/api/v1/backups/", g.auditHandler)
+	mux.HandleFunc("/api/v1/backups", g.auditHandler)
+	mux.HandleFunc("/api/v1/search", g.searchHandler)
+	mux.HandleFunc("/api/v1/approvals/", g.approvalsHandler)
+	mux.HandleFunc("/api/v1/approvals", g.approvalsHandler)
+	mux.HandleFunc("/api/v1/overview/client/", g.clientOverviewHandler)
+	mux.HandleFunc("/api/v2/", g.versionedHandler)
 
 	return mux
 }
 
-func (g *APIGateway) createProxy(targetURL string) http.Handler {
+func (g *APIGateway) createProxy(targetURL string) *httputil.ReverseProxy {
 	target, _ := url.Parse(targetURL)
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
@@ -106,8 +154,9 @@ func (g *APIGateway) createProxy(targetURL string) http.Handler {
 		originalDirector(req)
 		req.Host = target.Host
 		req.Header.Set("X-Forwarded-For", req.RemoteAddr)
-		req.Header.Set("X-Request-ID", generateRequestID())
+		otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
 	}
+	proxy.ErrorHandler = g.proxyErrorHandler
 
 	return proxy
 }
@@ -190,6 +239,11 @@ func (g *APIGateway) paymentsHandler(w http.ResponseWriter, r *http.Request) {
 	g.proxyRequest(w, r, g.routeTarget("payments"))
 }
 
+// fxHandler proxies exchange rates, which the invoice service keeps.
+func (g *APIGateway) fxHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("invoices"))
+}
+
 func (g *APIGateway) productsHandler(w http.ResponseWriter, r *http.Request) {
 	g.proxyRequest(w, r, g.routeTarget("products"))
 }
@@ -202,17 +256,55 @@ func (g *APIGateway) usersHandler(w http.ResponseWriter, r *http.Request) {
 	g.proxyRequest(w, r, g.routeTarget("users"))
 }
 
+func (g *APIGateway) featureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("feature-flags"))
+}
+
+func (g *APIGateway) preferencesHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("preferences"))
+}
+
+func (g *APIGateway) commentsHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("comments"))
+}
+
 func (g *APIGateway) inventoryHandler(w http.ResponseWriter, r *http.Request) {
 	g.proxyRequest(w, r, g.routeTarget("inventory"))
 }
 
+func (g *APIGateway) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("webhooks"))
+}
+
+func (g *APIGateway) notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("notifications"))
+}
+
+func (g *APIGateway) auditHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("audit"))
+}
+
+func (g *APIGateway) searchHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("search"))
+}
+
+func (g *APIGateway) approvalsHandler(w http.ResponseWriter, r *http.Request) {
+	g.proxyRequest(w, r, g.routeTarget("approvals"))
+}
+
 func (g *APIGateway) proxyRequest(w http.ResponseWriter, r *http.Request, target string) {
+	g.proxyRequestWith(w, r, target, nil)
+}
+
+func (g *APIGateway) proxyRequestWith(w http.ResponseWriter, r *http.Request, target string, modifyResponse func(*http.Response) error) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	r = r.WithContext(ctx)
 	r.Header.Set("X-Forwarded-Host", r.Host)
-	r.Header.Set("X-Request-ID", generateRequestID())
+	if rec := accessRecordFrom(ctx); rec != nil {
+		rec.upstream = target
+	}
 
 	authHeader := r.Header.Get("Authorization")
 	if authHeader != "" {
@@ -220,69 +312,35 @@ func (g *APIGateway) proxyRequest(w http.ResponseWriter, r *http.Request, target
 	}
 
 	proxy := g.createProxy(target)
+	proxy.ModifyResponse = modifyResponse
 	proxy.ServeHTTP(w, r)
 }
 
-func (g *APIGateway) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		allowedOrigins := []string{
-			"http://localhost:5173",
-			"http://localhost:5178",
-			"http://localhost:5174",
-			"http://localhost:5175",
-			"http://localhost:5176",
-			"http://localhost:5177",
-		}
-
-		isAllowed := false
-		for _, o := range allowedOrigins {
-			if origin == o {
-				isAllowed = true
-				break
+// authenticationMiddleware validates the access token and forwards the
+// tenant and user from its claims, replacing any X-Tenant-ID or X-User-ID
+// the client sent.
+func (g *APIGateway) authenticationMiddleware(tenants *middleware.TenantMiddleware, next http.Handler) http.Handler {
+	return tenants.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("X-Tenant-ID")
+		r.Header.Del("X-User-ID")
+		if tenantID := middleware.GetTenantID(r.Context()); tenantID != "" {
+			r.Header.Set("X-Tenant-ID", tenantID)
+			r.Header.Set("X-User-ID", middleware.GetUserID(r.Context()))
+			if rec := accessRecordFrom(r.Context()); rec != nil {
+				rec.tenantID = tenantID
 			}
 		}
-
-		if isAllowed {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Max-Age", "86400")
-		}
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-func (g *APIGateway) authenticationMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "OPTIONS" || strings.HasPrefix(r.URL.Path, "/api/v1/auth/") || r.URL.Path == "/health" || r.URL.Path == "/ready" || r.URL.Path == "/live" {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization required", http.StatusUnauthorized)
-			return
-		}
-
 		next.ServeHTTP(w, r)
-	})
+	}))
 }
 
 func main() {
-	cfg, err := config.Load("", "api-gateway")
+	configs, err := config.NewManager("", "api-gateway")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
 		os.Exit(1)
 	}
+	cfg := configs.Current()
 
 	log, err := logger.New(logger.Config{
 		Level:       cfg.Logging.Level,
@@ -295,6 +353,8 @@ func main() {
 	}
 	defer log.Sync()
 
+	metrics.Initialize(cfg.App.Name)
+
 	tr, err := tracer.New(tracer.Config{
 		Enabled:      cfg.Tracing.Enabled,
 		ServiceName:  cfg.App.Name,
@@ -309,7 +369,11 @@ func main() {
 	}
 	defer tr.Shutdown(context.Background())
 
-	gateway := NewAPIGateway(cfg, log)
+	gateway, err := NewAPIGateway(cfg, log)
+	if err != nil {
+		log.Error("Failed to create API gateway", "error", err)
+		os.Exit(1)
+	}
 	gateway.SetRouteTarget("auth", envOrDefault("ERP_GATEWAY_AUTH_URL", "http://localhost:8081"))
 	gateway.SetRouteTarget("clients", envOrDefault("ERP_GATEWAY_CLIENTS_URL", "http://localhost:8082"))
 	gateway.SetRouteTarget("invoices", envOrDefault("ERP_GATEWAY_INVOICES_URL", "http://localhost:8083"))
@@ -317,11 +381,35 @@ func main() {
 	gateway.SetRouteTarget("products", envOrDefault("ERP_GATEWAY_PRODUCTS_URL", "http://localhost:8085"))
 	gateway.SetRouteTarget("orders", envOrDefault("ERP_GATEWAY_ORDERS_URL", "http://localhost:8086"))
 	gateway.SetRouteTarget("users", envOrDefault("ERP_GATEWAY_USERS_URL", "http://localhost:8081"))
+	gateway.SetRouteTarget("feature-flags", envOrDefault("ERP_GATEWAY_FEATURE_FLAGS_URL", "http://localhost:8081"))
+	gateway.SetRouteTarget("preferences", envOrDefault("ERP_GATEWAY_PREFERENCES_URL", "http://localhost:8081"))
+	gateway.SetRouteTarget("comments", envOrDefault("ERP_GATEWAY_COMMENTS_URL", "http://localhost:8081"))
 	gateway.SetRouteTarget("inventory", envOrDefault("ERP_GATEWAY_INVENTORY_URL", "http://localhost:8084"))
+	gateway.SetRouteTarget("webhooks", envOrDefault("ERP_GATEWAY_WEBHOOKS_URL", "http://localhost:8089"))
+	gateway.SetRouteTarget("notifications", envOrDefault("ERP_GATEWAY_NOTIFICATIONS_URL", "http://localhost:8090"))
+	gateway.SetRouteTarget("audit", envOrDefault("ERP_GATEWAY_AUDIT_URL", "http://localhost:8091"))
+	gateway.SetRouteTarget("search", envOrDefault("ERP_GATEWAY_SEARCH_URL", "http://localhost:8092"))
+	gateway.SetRouteTarget("approvals", envOrDefault("ERP_GATEWAY_APPROVALS_URL", "http://localhost:8093"))
 
-	mux := gateway.buildRouter()
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		log.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator, "/api/v1/auth/", "/config/reload")
+
+	configs.OnChange(gateway.ApplyConfig)
+	configs.Watch(log)
+
+	mux := gateway.buildRouter(configs.ReloadHandler(log))
+	mux = gateway.bodyLimitMiddleware(mux)
 	mux = gateway.corsMiddleware(mux)
-	mux = gateway.authenticationMiddleware(mux)
+	mux = gateway.rateLimitMiddleware(mux)
+	mux = gateway.authenticationMiddleware(tenants, mux)
+	mux = middleware.NewRecoveryMiddleware(log).Handler(mux)
+	mux = gateway.accessLogMiddleware(mux)
+	mux = middleware.NewTracingMiddleware().Handler(mux)
+	mux = metrics.HTTPMiddleware(mux)
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
@@ -354,10 +442,6 @@ func main() {
 	log.Info("Server stopped")
 }
 
-func generateRequestID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
-}
-
 func envOrDefault(key, defaultValue string) string {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+const overviewCallTimeout = 5 * time.Second
+
+// forwardedHeaders are copied from the incoming request onto every fan-out call.
+var forwardedHeaders = []string{
+	"Authorization",
+	"X-Tenant-ID",
+	"X-User-ID",
+	"X-Request-ID",
+	"traceparent",
+	"tracestate",
+}
+
+type overviewCall struct {
+	name     string
+	route    string
+	path     string
+	query    url.Values
+	required bool
+}
+
+// OverviewSection is one upstream result within a composite response.
+type OverviewSection struct {
+	Status     string          `json:"status"`
+	HTTPStatus int             `json:"httpStatus,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	LatencyMs  int64           `json:"latencyMs"`
+}
+
+type OverviewResponse struct {
+	Partial  bool                       `json:"partial"`
+	Sections map[string]OverviewSection `json:"sections"`
+}
+
+var overviewHTTPClient = &http.Client{Timeout: overviewCallTimeout}
+
+// clientOverviewHandler serves GET /api/v1/overview/client/{id}, fanning out to
+// the client, invoice, payment and order services concurrently. Only the
+// client section is required; failures elsewhere mark the response partial.
+func (g *APIGateway) clientOverviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.WriteError(w, r, http.StatusMethodNotAllowed, errors.InvalidArgument("method not allowed"))
+		return
+	}
+
+	clientID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/overview/client/"), "/")
+	if clientID == "" || strings.Contains(clientID, "/") {
+		httpresponse.WriteError(w, r, http.StatusBadRequest, errors.InvalidArgument("client id is required"))
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		limit = "10"
+	}
+
+	calls := []overviewCall{
+		{
+			name:     "client",
+			route:    "clients",
+			path:     "/api/v1/clients/detail/",
+			query:    url.Values{"tenantId": {tenantID}, "clientId": {clientID}},
+			required: true,
+		},
+		{
+			name:  "credit",
+			route: "clients",
+			path:  "/api/v1/clients/credit/",
+			query: url.Values{"tenantId": {tenantID}, "clientId": {clientID}},
+		},
+		{
+			name:  "invoices",
+			route: "invoices",
+			path:  "/api/v1/invoices",
+			query: url.Values{"tenantId": {tenantID}, "clientId": {clientID}, "pageSize": {limit}},
+		},
+		{
+			name:  "payments",
+			route: "payments",
+			path:  "/api/v1/payments",
+			query: url.Values{"tenantId": {tenantID}, "clientId": {clientID}, "pageSize": {limit}, "sortBy": {"createdAt"}, "sortOrder": {"desc"}},
+		},
+		{
+			name:  "orders",
+			route: "orders",
+			path:  "/api/v1/orders",
+			query: url.Values{"tenantId": {tenantID}, "clientId": {clientID}, "pageSize": {limit}},
+		},
+	}
+
+	sections := make(map[string]OverviewSection, len(calls))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, call := range calls {
+		wg.Add(1)
+		go func(call overviewCall) {
+			defer wg.Done()
+			section := g.fetchSection(r, call)
+			mu.Lock()
+			sections[call.name] = section
+			mu.Unlock()
+		}(call)
+	}
+	wg.Wait()
+
+	resp := OverviewResponse{Sections: sections}
+	status := http.StatusOK
+	for _, call := range calls {
+		section := sections[call.name]
+		if section.Status == "ok" {
+			continue
+		}
+		resp.Partial = true
+		if call.required {
+			status = http.StatusBadGateway
+			if section.HTTPStatus == http.StatusNotFound {
+				status = http.StatusNotFound
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (g *APIGateway) fetchSection(r *http.Request, call overviewCall) OverviewSection {
+	start := time.Now()
+	section := func(s OverviewSection) OverviewSection {
+		s.LatencyMs = time.Since(start).Milliseconds()
+		return s
+	}
+
+	target := g.routeTarget(call.route)
+	if target == "" {
+		return section(OverviewSection{Status: "error", Error: "no upstream configured for " + call.route})
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), overviewCallTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target+call.path+"?"+call.query.Encode(), nil)
+	if err != nil {
+		return section(OverviewSection{Status: "error", Error: err.Error()})
+	}
+	for _, h := range forwardedHeaders {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := overviewHTTPClient.Do(req)
+	if err != nil {
+		g.logger.New(r.Context()).Warnw("Overview upstream call failed", "section", call.name, "error", err)
+		return section(OverviewSection{Status: "error", Error: "upstream unavailable"})
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return section(OverviewSection{Status: "error", HTTPStatus: resp.StatusCode, Error: err.Error()})
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return section(OverviewSection{
+			Status:     "error",
+			HTTPStatus: resp.StatusCode,
+			Error:      fmt.Sprintf("upstream returned %d", resp.StatusCode),
+		})
+	}
+	if !json.Valid(body) {
+		return section(OverviewSection{Status: "error", HTTPStatus: resp.StatusCode, Error: "upstream returned non-JSON body"})
+	}
+
+	return section(OverviewSection{Status: "ok", HTTPStatus: resp.StatusCode, Data: body})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// overviewUpstream answers the overview fan-out calls, replying to each path
+// with the status and body in replies, or 200 with {"path": ...} otherwise.
+type overviewUpstream struct {
+	mu      sync.Mutex
+	queries map[string]url.Values
+	headers map[string]http.Header
+	replies map[string]struct {
+		status int
+		body   string
+	}
+}
+
+func newOverviewGateway(t *testing.T, upstream *overviewUpstream) *APIGateway {
+	upstream.queries = make(map[string]url.Values)
+	upstream.headers = make(map[string]http.Header)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream.mu.Lock()
+		upstream.queries[r.URL.Path] = r.URL.Query()
+		upstream.headers[r.URL.Path] = r.Header.Clone()
+		reply, ok := upstream.replies[r.URL.Path]
+		upstream.mu.Unlock()
+		if !ok {
+			_ = json.NewEncoder(w).Encode(map[string]string{"path": r.URL.Path})
+			return
+		}
+		w.WriteHeader(reply.status)
+		_, _ = w.Write([]byte(reply.body))
+	}))
+	t.Cleanup(server.Close)
+
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	return &APIGateway{
+		logger: log,
+		routes: map[string]string{
+			"clients":  server.URL,
+			"invoices": server.URL,
+			"payments": server.URL,
+			"orders":   server.URL,
+		},
+	}
+}
+
+func requestOverview(g *APIGateway, method, path string) (*httptest.ResponseRecorder, OverviewResponse) {
+	ctx := middleware.WithIdentity(context.Background(), "tenant-a", "user-1", nil)
+	req := httptest.NewRequest(method, path, nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("Cookie", "session=1")
+
+	rec := httptest.NewRecorder()
+	g.clientOverviewHandler(rec, req)
+	var resp OverviewResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestClientOverviewHandler(t *testing.T) {
+	upstream := &overviewUpstream{}
+	g := newOverviewGateway(t, upstream)
+
+	rec, resp := requestOverview(g, http.MethodGet, "/api/v1/overview/client/client-1?limit=5")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, resp.Partial)
+	require.Len(t, resp.Sections, 5)
+	for name, section := range resp.Sections {
+		assert.Equal(t, "ok", section.Status, name)
+	}
+	assert.JSONEq(t, `{"path":"/api/v1/invoices"}`, string(resp.Sections["invoices"].Data))
+
+	query := upstream.queries["/api/v1/payments"]
+	assert.Equal(t, "tenant-a", query.Get("tenantId"), "the tenant comes from the caller's identity")
+	assert.Equal(t, "client-1", query.Get("clientId"))
+	assert.Equal(t, "5", query.Get("pageSize"))
+	assert.Equal(t, "5", upstream.queries["/api/v1/orders"].Get("pageSize"))
+
+	headers := upstream.headers["/api/v1/clients/detail/"]
+	assert.Equal(t, "Bearer token", headers.Get("Authorization"))
+	assert.Equal(t, "req-1", headers.Get("X-Request-ID"))
+	assert.Empty(t, headers.Get("Cookie"), "only the listed headers are forwarded")
+}
+
+func TestClientOverviewHandler_PartialResults(t *testing.T) {
+	upstream := &overviewUpstream{replies: map[string]struct {
+		status int
+		body   string
+	}{
+		"/api/v1/payments": {http.StatusInternalServerError, `{"error":"down"}`},
+		"/api/v1/orders":   {http.StatusOK, "<html>"},
+	}}
+	g := newOverviewGateway(t, upstream)
+
+	rec, resp := requestOverview(g, http.MethodGet, "/api/v1/overview/client/client-1")
+	require.Equal(t, http.StatusOK, rec.Code, "optional sections failing do not fail the overview")
+	assert.True(t, resp.Partial)
+	assert.Equal(t, "ok", resp.Sections["client"].Status)
+
+	payments := resp.Sections["payments"]
+	assert.Equal(t, "error", payments.Status)
+	assert.Equal(t, http.StatusInternalServerError, payments.HTTPStatus)
+	assert.Empty(t, payments.Data)
+	assert.Equal(t, "upstream returned non-JSON body", resp.Sections["orders"].Error)
+	assert.Equal(t, "10", upstream.queries["/api/v1/invoices"].Get("pageSize"), "lists default to ten entries")
+}
+
+func TestClientOverviewHandler_RequiredClient(t *testing.T) {
+	upstream := &overviewUpstream{replies: map[string]struct {
+		status int
+		body   string
+	}{
+		"/api/v1/clients/detail/": {http.StatusNotFound, `{"error":"not found"}`},
+	}}
+	g := newOverviewGateway(t, upstream)
+
+	rec, resp := requestOverview(g, http.MethodGet, "/api/v1/overview/client/missing")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.True(t, resp.Partial)
+
+	delete(g.routes, "clients")
+	rec, resp = requestOverview(g, http.MethodGet, "/api/v1/overview/client/client-1")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "no upstream configured for clients", resp.Sections["client"].Error)
+	assert.Equal(t, "ok", resp.Sections["invoices"].Status)
+}
+
+func TestClientOverviewHandler_RejectsBadRequests(t *testing.T) {
+	g := newOverviewGateway(t, &overviewUpstream{})
+
+	rec, _ := requestOverview(g, http.MethodPost, "/api/v1/overview/client/client-1")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	rec, _ = requestOverview(g, http.MethodGet, "/api/v1/overview/client/")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec, _ = requestOverview(g, http.MethodGet, "/api/v1/overview/client/client-1/invoices")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
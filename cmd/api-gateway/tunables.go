@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// tunables are the gateway settings that take effect on a config reload
+// without a restart. A reload swaps in a new value; requests read whichever
+// one is current when they arrive.
+type tunables struct {
+	cors       *middleware.CORSPolicy
+	rateLimit  int
+	rateWindow time.Duration
+	accessLog  config.AccessLogConfig
+}
+
+func newTunables(cfg *config.Config) *tunables {
+	return &tunables{
+		cors:       middleware.NewCORSPolicy(&cfg.Security),
+		rateLimit:  cfg.Security.RateLimitRequests,
+		rateWindow: cfg.Security.RateLimitWindow,
+		accessLog:  cfg.Gateway.AccessLog,
+	}
+}
+
+// ApplyConfig makes the tunables in cfg current. It is registered with the
+// config manager so reloads reach the gateway.
+func (g *APIGateway) ApplyConfig(cfg *config.Config) {
+	g.tunables.Store(newTunables(cfg))
+	g.logger.Info("Gateway tunables applied",
+		"cors_origins", g.tunables.Load().cors.Origins(),
+		"rate_limit", cfg.Security.RateLimitRequests,
+		"rate_window", cfg.Security.RateLimitWindow,
+		"access_log_sample_rate", cfg.Gateway.AccessLog.SampleRate,
+	)
+}
+
+func (g *APIGateway) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.tunables.Load().cors.Apply(w, r)
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateWindow counts one client's requests in the current fixed window.
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter allows security.rate_limit_requests API requests per
+// security.rate_limit_window for each tenant, or each client IP before
+// login. Counters are per gateway replica. A negative limit disables it.
+type rateLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{windows: make(map[string]*rateWindow)}
+}
+
+// allow records a request for key and reports whether it is within limit,
+// how many requests remain and when the window resets.
+func (l *rateLimiter) allow(key string, limit int, window time.Duration, now time.Time) (bool, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= window {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+	w.count++
+	reset := w.start.Add(window)
+	if w.count > limit {
+		return false, 0, reset
+	}
+	return true, limit - w.count, reset
+}
+
+func (g *APIGateway) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := g.tunables.Load()
+		if t.rateLimit < 0 || t.rateWindow <= 0 || !strings.HasPrefix(r.URL.Path, "/api/") || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "tenant:" + middleware.GetTenantID(r.Context())
+		if key == "tenant:" {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			key = "ip:" + host
+		}
+
+		now := time.Now()
+		allowed, remaining, reset := g.limiter.allow(key, t.rateLimit, t.rateWindow, now)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(t.rateLimit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			httpresponse.ErrorStatus(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
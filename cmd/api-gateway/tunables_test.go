@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	allowed, remaining, reset := limiter.allow("tenant:a", 2, time.Minute, now)
+	assert.True(t, allowed)
+	assert.Equal(t, 1, remaining)
+	assert.Equal(t, now.Add(time.Minute), reset)
+
+	allowed, remaining, _ = limiter.allow("tenant:a", 2, time.Minute, now.Add(time.Second))
+	assert.True(t, allowed)
+	assert.Equal(t, 0, remaining)
+
+	allowed, _, reset = limiter.allow("tenant:a", 2, time.Minute, now.Add(2*time.Second))
+	assert.False(t, allowed)
+	assert.Equal(t, now.Add(time.Minute), reset, "the window does not slide")
+
+	allowed, _, _ = limiter.allow("tenant:b", 2, time.Minute, now.Add(2*time.Second))
+	assert.True(t, allowed, "each key has its own window")
+
+	allowed, remaining, _ = limiter.allow("tenant:a", 2, time.Minute, now.Add(time.Minute))
+	assert.True(t, allowed, "a new window starts once the old one ends")
+	assert.Equal(t, 1, remaining)
+	assert.Contains(t, limiter.windows, "tenant:b", "windows that have not ended are kept")
+
+	limiter.allow("tenant:c", 2, time.Minute, now.Add(2*time.Minute+time.Second))
+	assert.NotContains(t, limiter.windows, "tenant:b", "ended windows are swept")
+}
+
+func TestAPIGateway_ApplyConfig(t *testing.T) {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	g := &APIGateway{logger: log, limiter: newRateLimiter()}
+	g.ApplyConfig(&config.Config{Security: config.SecurityConfig{RateLimitRequests: 1, RateLimitWindow: time.Minute}})
+
+	handler := g.rateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(tenantID string) *httptest.ResponseRecorder {
+		ctx := middleware.WithIdentity(context.Background(), tenantID, "user-1", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil).WithContext(ctx))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, request("tenant-a").Code)
+	rec := request("tenant-a")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Limit"))
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	g.ApplyConfig(&config.Config{Security: config.SecurityConfig{RateLimitRequests: 3, RateLimitWindow: time.Minute}})
+	rec = request("tenant-a")
+	assert.Equal(t, http.StatusOK, rec.Code, "a reloaded limit applies to the next request")
+	assert.Equal(t, "3", rec.Header().Get("X-RateLimit-Limit"))
+
+	g.ApplyConfig(&config.Config{Security: config.SecurityConfig{RateLimitRequests: -1, RateLimitWindow: time.Minute}})
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, request("tenant-a").Code, "a negative limit disables rate limiting")
+	}
+}
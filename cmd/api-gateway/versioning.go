@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// VersionRule describes how a versioned path prefix is served by an existing
+// service route. Renames are applied to JSON object keys at every nesting
+// level; defaults are injected into the top-level request object only.
+type VersionRule struct {
+	Version         string
+	Prefix          string
+	Route           string
+	Rewrite         string
+	RequestRenames  map[string]string
+	RequestDefaults map[string]interface{}
+	ResponseRenames map[string]string
+}
+
+type VersionRouter struct {
+	rules []VersionRule
+}
+
+func NewVersionRouter(routes []config.VersionRouteConfig) *VersionRouter {
+	rules := make([]VersionRule, 0, len(routes))
+	for _, rc := range routes {
+		if rc.Prefix == "" || rc.Route == "" {
+			continue
+		}
+		rule := VersionRule{
+			Version:         versionFromPrefix(rc.Prefix),
+			Prefix:          strings.TrimSuffix(rc.Prefix, "/"),
+			Route:           rc.Route,
+			Rewrite:         strings.TrimSuffix(rc.Rewrite, "/"),
+			RequestRenames:  make(map[string]string),
+			RequestDefaults: make(map[string]interface{}),
+			ResponseRenames: make(map[string]string),
+		}
+		for _, r := range rc.RequestRenames {
+			rule.RequestRenames[r.From] = r.To
+		}
+		for _, d := range rc.RequestDefaults {
+			rule.RequestDefaults[d.Field] = d.Value
+		}
+		for _, r := range rc.ResponseRenames {
+			rule.ResponseRenames[r.From] = r.To
+		}
+		rules = append(rules, rule)
+	}
+
+	// Longest prefix first so /api/v2/clients/search wins over /api/v2/clients.
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Prefix) > len(rules[j].Prefix)
+	})
+
+	return &VersionRouter{rules: rules}
+}
+
+func (vr *VersionRouter) Match(path string) (*VersionRule, bool) {
+	for i := range vr.rules {
+		rule := &vr.rules[i]
+		if path == rule.Prefix || strings.HasPrefix(path, rule.Prefix+"/") {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// versionFromPrefix extracts "v2" from a prefix such as /api/v2/clients.
+func versionFromPrefix(prefix string) string {
+	for _, segment := range strings.Split(prefix, "/") {
+		if len(segment) > 1 && segment[0] == 'v' {
+			if _, err := strconv.Atoi(segment[1:]); err == nil {
+				return segment
+			}
+		}
+	}
+	return ""
+}
+
+func (rule *VersionRule) RewritePath(path string) string {
+	if rule.Rewrite == "" {
+		return path
+	}
+	return rule.Rewrite + strings.TrimPrefix(path, rule.Prefix)
+}
+
+func (rule *VersionRule) TransformRequest(body []byte) ([]byte, error) {
+	if len(rule.RequestRenames) == 0 && len(rule.RequestDefaults) == 0 {
+		return body, nil
+	}
+
+	payload, err := decodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	payload = renameFields(payload, rule.RequestRenames)
+	if obj, ok := payload.(map[string]interface{}); ok {
+		for field, value := range rule.RequestDefaults {
+			if _, exists := obj[field]; !exists {
+				obj[field] = value
+			}
+		}
+	}
+
+	return json.Marshal(payload)
+}
+
+func (rule *VersionRule) TransformResponse(body []byte) ([]byte, error) {
+	if len(rule.ResponseRenames) == 0 {
+		return body, nil
+	}
+
+	payload, err := decodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(renameFields(payload, rule.ResponseRenames))
+}
+
+// decodeJSON decodes a single JSON value, keeping numbers as json.Number
+// so amounts and IDs beyond float64's precision pass through unchanged.
+func decodeJSON(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var payload interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: data after the top-level value")
+	}
+	return payload, nil
+}
+
+// readDecodedBody reads resp's body, decompressing a gzip-encoded one.
+// Fields cannot be renamed in other encodings, so those are refused.
+func readDecodedBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	var body io.Reader = resp.Body
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress response: %w", err)
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("cannot rename fields in a response with Content-Encoding %q", encoding)
+	}
+	return io.ReadAll(body)
+}
+
+func renameFields(value interface{}, renames map[string]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			if renamed, ok := renames[key]; ok {
+				key = renamed
+			}
+			out[key] = renameFields(child, renames)
+		}
+		return out
+	case []interface{}:
+		for i, child := range v {
+			v[i] = renameFields(child, renames)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isJSON(contentType string) bool {
+	return strings.Contains(contentType, "application/json")
+}
+
+func (g *APIGateway) versionedHandler(w http.ResponseWriter, r *http.Request) {
+	rule, ok := g.versions.Match(r.URL.Path)
+	if !ok {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Unsupported API version or route")
+		return
+	}
+
+	target := g.routeTarget(rule.Route)
+	if target == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadGateway, "Unknown upstream route")
+		return
+	}
+
+	if r.Body != nil && isJSON(r.Header.Get("Content-Type")) {
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		if len(body) > 0 {
+			body, err = rule.TransformRequest(body)
+			if err != nil {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid JSON body")
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	r.URL.Path = rule.RewritePath(r.URL.Path)
+	r.URL.RawPath = ""
+	r.Header.Set("X-API-Version", rule.Version)
+	if len(rule.ResponseRenames) > 0 {
+		// Responses are renamed in, so only encodings the gateway can
+		// decode are accepted; the client gets the result unencoded.
+		r.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	g.proxyRequestWith(w, r, target, func(resp *http.Response) error {
+		resp.Header.Set("X-API-Version", rule.Version)
+		if len(rule.ResponseRenames) == 0 || !isJSON(resp.Header.Get("Content-Type")) {
+			return nil
+		}
+
+		body, err := readDecodedBody(resp)
+		if err != nil {
+			return err
+		}
+		resp.Header.Del("Content-Encoding")
+		if transformed, err := rule.TransformResponse(body); err == nil {
+			body = transformed
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return nil
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// testVersionRoutes serve /api/v2 and /api/v3 clients from the v1 clients
+// route, each renaming fields its own way.
+var testVersionRoutes = []config.VersionRouteConfig{
+	{
+		Prefix:          "/api/v2/clients",
+		Route:           "clients",
+		Rewrite:         "/api/v1/clients",
+		RequestRenames:  []config.FieldRename{{From: "displayName", To: "name"}},
+		RequestDefaults: []config.FieldDefault{{Field: "currency", Value: "EUR"}},
+		ResponseRenames: []config.FieldRename{{From: "name", To: "displayName"}},
+	},
+	{
+		Prefix:          "/api/v3/clients",
+		Route:           "clients",
+		Rewrite:         "/api/v1/clients",
+		RequestRenames:  []config.FieldRename{{From: "legalName", To: "name"}, {From: "vat", To: "taxId"}},
+		ResponseRenames: []config.FieldRename{{From: "name", To: "legalName"}, {From: "taxId", To: "vat"}},
+	},
+}
+
+func TestVersionRule_TransformRequest(t *testing.T) {
+	router := NewVersionRouter(testVersionRoutes)
+	tests := []struct {
+		path string
+		body string
+		want string
+	}{
+		{"/api/v2/clients", `{"displayName":"Acme","contacts":[{"displayName":"Jo"}]}`, `{"contacts":[{"name":"Jo"}],"currency":"EUR","name":"Acme"}`},
+		{"/api/v2/clients", `{"displayName":"Acme","currency":"USD"}`, `{"currency":"USD","name":"Acme"}`},
+		{"/api/v2/clients", `{"creditLimit":9007199254740993,"rate":0.1}`, `{"creditLimit":9007199254740993,"currency":"EUR","rate":0.1}`},
+		{"/api/v3/clients/search", `{"legalName":"Acme GmbH","vat":"DE123"}`, `{"name":"Acme GmbH","taxId":"DE123"}`},
+		{"/api/v3/clients", `[{"legalName":"A"},{"legalName":"B"}]`, `[{"name":"A"},{"name":"B"}]`},
+	}
+	for _, tt := range tests {
+		rule, ok := router.Match(tt.path)
+		require.True(t, ok, tt.path)
+		got, err := rule.TransformRequest([]byte(tt.body))
+		require.NoError(t, err, tt.body)
+		assert.JSONEq(t, tt.want, string(got), tt.body)
+	}
+}
+
+func TestVersionRule_TransformResponse(t *testing.T) {
+	router := NewVersionRouter(testVersionRoutes)
+	tests := []struct {
+		path string
+		body string
+		want string
+	}{
+		{"/api/v2/clients/1", `{"id":"1","name":"Acme"}`, `{"id":"1","displayName":"Acme"}`},
+		{"/api/v2/clients", `{"data":[{"name":"A","balance":12345678901234567890}]}`, `{"data":[{"displayName":"A","balance":12345678901234567890}]}`},
+		{"/api/v3/clients/1", `{"name":"Acme GmbH","taxId":"DE123"}`, `{"legalName":"Acme GmbH","vat":"DE123"}`},
+	}
+	for _, tt := range tests {
+		rule, ok := router.Match(tt.path)
+		require.True(t, ok, tt.path)
+		got, err := rule.TransformResponse([]byte(tt.body))
+		require.NoError(t, err, tt.body)
+		assert.JSONEq(t, tt.want, string(got), tt.body)
+	}
+}
+
+func TestVersionRule_TransformRejectsTrailingData(t *testing.T) {
+	rule, ok := NewVersionRouter(testVersionRoutes).Match("/api/v2/clients")
+	require.True(t, ok)
+	_, err := rule.TransformRequest([]byte(`{"displayName":"A"} {"x":1}`))
+	assert.Error(t, err)
+	_, err = rule.TransformResponse([]byte(`{"name":"A"}garbage`))
+	assert.Error(t, err)
+}
+
+// newVersionedGateway returns a gateway whose clients route is upstream.
+func newVersionedGateway(t *testing.T, upstream string) *APIGateway {
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	return &APIGateway{
+		logger:   log,
+		routes:   map[string]string{"clients": upstream},
+		versions: NewVersionRouter(testVersionRoutes),
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestVersionedHandler_RenamesEncodedResponses(t *testing.T) {
+	tests := []struct {
+		encoding string
+		status   int
+		want     string
+	}{
+		{"", http.StatusOK, `{"displayName":"Acme"}`},
+		{"gzip", http.StatusOK, `{"displayName":"Acme"}`},
+		{"br", http.StatusBadGateway, ""},
+	}
+	for _, tt := range tests {
+		var gotPath, gotAccept string
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath, gotAccept = r.URL.Path, r.Header.Get("Accept-Encoding")
+			w.Header().Set("Content-Type", "application/json")
+			body := []byte(`{"name":"Acme"}`)
+			switch tt.encoding {
+			case "gzip":
+				body = gzipped(t, string(body))
+			case "br":
+				body = []byte("not really brotli")
+			}
+			if tt.encoding != "" {
+				w.Header().Set("Content-Encoding", tt.encoding)
+			}
+			w.Write(body)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/clients/1", nil)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		rec := httptest.NewRecorder()
+		newVersionedGateway(t, upstream.URL).versionedHandler(rec, req)
+		upstream.Close()
+
+		assert.Equal(t, "/api/v1/clients/1", gotPath, tt.encoding)
+		assert.Equal(t, "gzip", gotAccept, tt.encoding)
+		require.Equal(t, tt.status, rec.Code, tt.encoding)
+		if tt.status != http.StatusOK {
+			continue
+		}
+		assert.Empty(t, rec.Header().Get("Content-Encoding"), tt.encoding)
+		assert.Equal(t, "v2", rec.Header().Get("X-API-Version"), tt.encoding)
+		body, err := io.ReadAll(rec.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, tt.want, string(body), tt.encoding)
+	}
+}
+
+func TestVersionRule_TransformKeepsNumbers(t *testing.T) {
+	rule, ok := NewVersionRouter(testVersionRoutes).Match("/api/v2/clients")
+	require.True(t, ok)
+
+	got, err := rule.TransformRequest([]byte(`{"displayName":"A","creditLimit":9007199254740993}`))
+	require.NoError(t, err)
+	assert.Contains(t, string(got), `"creditLimit":9007199254740993`)
+
+	got, err = rule.TransformResponse([]byte(`{"name":"A","balance":12345678901234567890,"rate":1e-7}`))
+	require.NoError(t, err)
+	assert.Contains(t, string(got), `"balance":12345678901234567890`)
+	assert.Contains(t, string(got), `"rate":1e-7`)
+}
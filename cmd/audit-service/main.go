@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ims-erp/system/internal/audit"
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/backup"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/export"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/internal/scheduler"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/ims-erp/system/pkg/tracer"
+)
+
+func main() {
+	cfg, err := config.Load("", "audit-service")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, err := logger.New(logger.Config{
+		Level:       cfg.Logging.Level,
+		Format:      cfg.Logging.Format,
+		ServiceName: cfg.App.Name,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	group := lifecycle.New(log)
+
+	metrics.Initialize(cfg.App.Name)
+
+	tr, err := tracer.New(tracer.Config{
+		Enabled:      cfg.Tracing.Enabled,
+		ServiceName:  cfg.App.Name,
+		ExporterType: cfg.Tracing.ExporterType,
+		Endpoint:     cfg.Tracing.Endpoint,
+		SamplerType:  cfg.Tracing.SamplerType,
+		SamplerRatio: cfg.Tracing.SamplerRatio,
+	})
+	if err != nil {
+		log.Error("Failed to create tracer", "error", err)
+		os.Exit(1)
+	}
+	defer tr.Shutdown(context.Background())
+
+	messaging.SetupTracePropagation()
+
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		log.Error("Failed to connect to MongoDB", "error", err)
+		os.Exit(1)
+	}
+	defer mongodb.Close(context.Background())
+	log.Info("Connected to MongoDB")
+
+	subscriber, err := messaging.NewEventSubscriber(cfg, log)
+	if err != nil {
+		log.Error("Failed to create event subscriber", "error", err, "transport", cfg.Messaging.Transport)
+		os.Exit(1)
+	}
+	defer subscriber.Close()
+	group.OnShutdown("subscriber", subscriber.Drain)
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
+
+	recorder := audit.NewRecorder(mongodb, log)
+	if err := recorder.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create audit log indexes", "error", err)
+	}
+
+	// Events and command outcomes arrive through a consumer group, like
+	// webhook-service: replicas share the work. On NATS this is a core queue
+	// subscription, so messages published while no replica runs are not
+	// audited; on Kafka the group resumes from its committed offsets.
+	eventSubject := "evt.>"
+	if err := subscriber.SubscribeGroup(group.Context(), eventSubject, "audit-service", createEventHandler(recorder)); err != nil {
+		log.Error("Failed to subscribe", "error", err, "subject", eventSubject)
+		os.Exit(1)
+	}
+	outcomeSubject := "cmdresult.>"
+	if err := subscriber.SubscribeGroup(group.Context(), outcomeSubject, "audit-service", createOutcomeHandler(recorder)); err != nil {
+		log.Error("Failed to subscribe", "error", err, "subject", outcomeSubject)
+		os.Exit(1)
+	}
+
+	files, err := export.NewStorage(cfg.MinIO)
+	if err != nil {
+		log.Error("Failed to configure MinIO", "error", err)
+		os.Exit(1)
+	}
+	backups := backup.New(mongodb, files, cfg.Backups, cfg.App.Environment, log)
+	if err := backups.Setup(context.Background()); err != nil {
+		log.Warn("Failed to set up tenant backups", "error", err)
+	}
+
+	// Scheduled backups are off unless backups.schedule is set; the lock
+	// keeps replicas from backing up the same tenants twice.
+	if cfg.Backups.Schedule != "" {
+		jobRuns := repository.NewJobRunStore(mongodb)
+		if err := jobRuns.EnsureIndexes(context.Background(), cfg.Scheduler.HistoryRetention); err != nil {
+			log.Warn("Failed to create job run indexes", "error", err)
+		}
+		jobLocks, err := scheduler.NewLocker(cfg.Scheduler, mongodb, nil)
+		if err != nil {
+			log.Error("Failed to configure job locks", "error", err)
+			os.Exit(1)
+		}
+		jobs := scheduler.New(cfg.Scheduler, jobLocks, jobRuns, log)
+		if err := jobs.Register(scheduler.Job{
+			Name:     "backups.run",
+			Schedule: cfg.Backups.Schedule,
+			Run:      backups.BackupOnce,
+			Timeout:  6 * time.Hour,
+		}); err != nil {
+			log.Error("Failed to register job", "error", err)
+			os.Exit(1)
+		}
+		group.Go("job scheduler", jobs.Run)
+	}
+
+	healthChecker := health.NewHealthChecker(cfg, mongodb, nil, log)
+	healthChecker.AddComponent("messaging", health.MessagingCheck(subscriber))
+	readinessChecker := healthChecker.Readiness()
+	livenessChecker := health.NewLivenessChecker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", healthChecker.Handler())
+	mux.Handle("/ready", readinessChecker.Handler())
+	mux.Handle("/live", livenessChecker.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/api/v1/audit/", recorder.Handler())
+	backupHandler := backups.Handler("/api/v1/backups")
+	mux.Handle("/api/v1/backups", backupHandler)
+	mux.Handle("/api/v1/backups/", backupHandler)
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		log.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
+		Handler:      metrics.HTTPMiddleware(middleware.Instrument(log, tenants.Handler(mux))),
+		ReadTimeout:  cfg.App.ReadTimeout,
+		WriteTimeout: cfg.App.WriteTimeout,
+	}
+	group.OnShutdown("http server", srv.Shutdown)
+
+	go func() {
+		log.Info("Starting audit-service", "port", cfg.App.Port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("Server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	sig := group.WaitForSignal()
+	log.Info("Shutting down", "signal", sig)
+	if err := group.Shutdown(cfg.App.ShutdownTimeout); err != nil {
+		log.Error("Shutdown incomplete", "error", err)
+	}
+}
+
+func createEventHandler(recorder *audit.Recorder) messaging.DeliveryHandler {
+	return func(ctx context.Context, msg *messaging.Delivery) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		if err := recorder.HandleEvent(ctx, &event); err != nil {
+			return fmt.Errorf("failed to record audit entry for event %s: %w", event.ID, err)
+		}
+		return nil
+	}
+}
+
+func createOutcomeHandler(recorder *audit.Recorder) messaging.DeliveryHandler {
+	return func(ctx context.Context, msg *messaging.Delivery) error {
+		var outcome commands.CommandOutcome
+		if err := json.Unmarshal(msg.Data, &outcome); err != nil {
+			return fmt.Errorf("failed to unmarshal command outcome: %w", err)
+		}
+		if err := recorder.HandleCommandOutcome(ctx, &outcome); err != nil {
+			return fmt.Errorf("failed to record audit entry for command %s: %w", outcome.CommandID, err)
+		}
+		return nil
+	}
+}
@@ -11,54 +11,21 @@ import (
 	"time"
 
 	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/comments"
 	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/featureflag"
 	"github.com/ims-erp/system/internal/health"
 	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/migrations"
+	"github.com/ims-erp/system/internal/preferences"
 	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 	"github.com/ims-erp/system/pkg/tracer"
 )
 
-var allowedOrigins = []string{
-	"http://localhost:5173",
-	"http://localhost:5178",
-	"http://localhost:5174",
-	"http://localhost:5175",
-	"http://localhost:5176",
-	"http://localhost:5177",
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		isAllowed := false
-		for _, o := range allowedOrigins {
-			if origin == o {
-				isAllowed = true
-				break
-			}
-		}
-
-		if isAllowed {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Max-Age", "86400")
-		}
-
-		if r.Method == "OPTIONS" {
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 type RedisClientAdapter struct {
 	cache *repository.Cache
 }
@@ -93,6 +60,8 @@ func main() {
 	}
 	defer log.Sync()
 
+	metrics.Initialize(cfg.App.Name)
+
 	tr, err := tracer.New(tracer.Config{
 		Enabled:      cfg.Tracing.Enabled,
 		ServiceName:  cfg.App.Name,
@@ -117,6 +86,11 @@ func main() {
 	defer mongodb.Close(context.Background())
 	log.Info("Connected to MongoDB")
 
+	if err := migrations.New(mongodb, log).Startup(context.Background(), cfg.Migrations, "users"); err != nil {
+		log.Error("Schema check failed; run `migrate up`", "error", err)
+		os.Exit(1)
+	}
+
 	redis, err := repository.NewRedis(cfg.Redis, log)
 	if err != nil {
 		log.Error("Failed to connect to Redis", "error", err)
@@ -125,25 +99,13 @@ func main() {
 	defer redis.Close()
 	log.Info("Connected to Redis")
 
-	natsConfig := messaging.NATSConfig{
-		URLs:           cfg.NATS.URLs,
-		Username:       cfg.NATS.Username,
-		Password:       cfg.NATS.Password,
-		Token:          cfg.NATS.Token,
-		MaxReconnect:   cfg.NATS.MaxReconnect,
-		ReconnectWait:  cfg.NATS.ReconnectWait,
-		ConnectTimeout: cfg.NATS.ConnectTimeout,
-		JetStream:      cfg.NATS.JetStream.Enabled,
-		StreamPrefix:   cfg.NATS.JetStream.StreamPrefix,
-	}
-
-	publisher, err := messaging.NewPublisher(natsConfig, log)
+	publisher, err := messaging.NewEventPublisher(cfg, log)
 	if err != nil {
-		log.Error("Failed to create NATS publisher", "error", err)
+		log.Error("Failed to create event publisher", "error", err, "transport", cfg.Messaging.Transport)
 		os.Exit(1)
 	}
 	defer publisher.Close()
-	log.Info("Connected to NATS")
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
 
 	userStore := auth.NewUserRepository(repository.NewReadModelStore(mongodb, "users", log))
 	cache := repository.NewCache(redis, "t:"+cfg.MongoDB.Database, log)
@@ -152,23 +114,45 @@ func main() {
 	sessionService := auth.NewSessionService(redisClient, log, cfg.Auth.SessionTTL)
 	rateLimiter := repository.NewRateLimiter(redis, log)
 
+	flags := featureflag.New(repository.NewFeatureFlagStore(redis), cfg.FeatureFlags, publisher, log)
+	flagsCtx, stopFlags := context.WithCancel(context.Background())
+	defer stopFlags()
+	go flags.Run(flagsCtx)
+
+	preferenceStore := repository.NewPreferenceStore(mongodb)
+	if err := preferenceStore.EnsureIndexes(context.Background()); err != nil {
+		log.Error("Failed to create preference indexes", "error", err)
+		os.Exit(1)
+	}
+	prefs := preferences.New(preferenceStore, repository.NewNotificationPreferenceStore(mongodb), log)
+
+	commentStore := repository.NewCommentStore(mongodb)
+	if err := commentStore.EnsureIndexes(context.Background()); err != nil {
+		log.Error("Failed to create comment indexes", "error", err)
+		os.Exit(1)
+	}
+	discussions := comments.New(commentStore, userStore, publisher, log)
+
 	authService := auth.NewAuthService(
 		userStore,
 		tokenService,
 		sessionService,
 		rateLimiter,
+		flags,
 		&cfg.Auth,
 		log,
 	)
 
 	healthChecker := health.NewHealthChecker(cfg, mongodb, redis, log)
-	readinessChecker := health.NewReadinessChecker(log)
+	healthChecker.AddComponent("messaging", health.MessagingCheck(publisher))
+	readinessChecker := healthChecker.Readiness()
 	livenessChecker := health.NewLivenessChecker()
 
 	mux := http.NewServeMux()
 	mux.Handle("/health", healthChecker.Handler())
 	mux.Handle("/ready", readinessChecker.Handler())
 	mux.Handle("/live", livenessChecker.Handler())
+	mux.Handle("/metrics", metrics.Handler())
 
 	mux.HandleFunc("/api/v1/auth/register", handleRegister(authService, log))
 	mux.HandleFunc("/api/v1/auth/login", handleLogin(authService, log))
@@ -176,8 +160,19 @@ func main() {
 	mux.HandleFunc("/api/v1/auth/refresh", handleRefresh(tokenService, log))
 	mux.HandleFunc("/api/v1/auth/change-password", handleChangePassword(authService, log))
 	mux.HandleFunc("/api/v1/auth/me", handleMe(authService, log))
-
-	handler := corsMiddleware(mux)
+	mux.Handle("/api/v1/feature-flags", flags.Handler("/api/v1/feature-flags"))
+	mux.Handle("/api/v1/feature-flags/", flags.Handler("/api/v1/feature-flags"))
+	mux.Handle("/api/v1/preferences", prefs.Handler("/api/v1/preferences"))
+	mux.Handle("/api/v1/preferences/", prefs.Handler("/api/v1/preferences"))
+	mux.Handle("/api/v1/comments/", discussions.Handler("/api/v1/comments"))
+
+	tenants := middleware.NewTenantMiddleware(
+		auth.NewJWTService(&cfg.Auth, log),
+		"/api/v1/auth/register",
+		"/api/v1/auth/login",
+		"/api/v1/auth/refresh",
+	)
+	handler := metrics.HTTPMiddleware(middleware.Instrument(log, middleware.NewCORSMiddleware(&cfg.Security).Handler(tenants.Handler(mux))))
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
@@ -213,26 +208,26 @@ func main() {
 func handleRegister(authService *auth.AuthService, log *logger.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 
 		var req auth.RegisterRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
 			return
 		}
 
 		tenantID := r.URL.Query().Get("tenantId")
 		if tenantID == "" {
-			http.Error(w, "tenantId is required", http.StatusBadRequest)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "tenantId is required")
 			return
 		}
 
 		user, err := authService.Register(r.Context(), tenantID, "", &req)
 		if err != nil {
 			log.Error("Registration failed", "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpresponse.Error(w, r, err)
 			return
 		}
 
@@ -244,19 +239,19 @@ func handleRegister(authService *auth.AuthService, log *logger.Logger) http.Hand
 func handleLogin(authService *auth.AuthService, log *logger.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 
 		var req auth.LoginRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
 			return
 		}
 
 		tenantID := r.URL.Query().Get("tenantId")
 		if tenantID == "" {
-			http.Error(w, "tenantId is required", http.StatusBadRequest)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "tenantId is required")
 			return
 		}
 
@@ -266,7 +261,7 @@ func handleLogin(authService *auth.AuthService, log *logger.Logger) http.Handler
 		response, err := authService.Login(r.Context(), tenantID, "", &req)
 		if err != nil {
 			log.Error("Login failed", "error", err)
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			httpresponse.Error(w, r, err)
 			return
 		}
 
@@ -278,11 +273,11 @@ func handleLogin(authService *auth.AuthService, log *logger.Logger) http.Handler
 func handleLogout(authService *auth.AuthService, log *logger.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 
-		userID := r.URL.Query().Get("userId")
+		userID := middleware.GetUserID(r.Context())
 		sessionID := r.URL.Query().Get("sessionId")
 
 		if err := authService.Logout(r.Context(), userID, sessionID); err != nil {
@@ -296,7 +291,7 @@ func handleLogout(authService *auth.AuthService, log *logger.Logger) http.Handle
 func handleRefresh(tokenService *auth.TokenService, log *logger.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 
@@ -304,14 +299,14 @@ func handleRefresh(tokenService *auth.TokenService, log *logger.Logger) http.Han
 			RefreshToken string `json:"refreshToken"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
 			return
 		}
 
 		tokens, err := tokenService.RefreshTokens(r.Context(), req.RefreshToken)
 		if err != nil {
 			log.Error("Token refresh failed", "error", err)
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			httpresponse.ErrorStatus(w, r, http.StatusUnauthorized, "invalid or expired refresh token")
 			return
 		}
 
@@ -323,23 +318,22 @@ func handleRefresh(tokenService *auth.TokenService, log *logger.Logger) http.Han
 func handleChangePassword(authService *auth.AuthService, log *logger.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 
 		var req struct {
-			UserID          string `json:"userId"`
 			CurrentPassword string `json:"currentPassword"`
 			NewPassword     string `json:"newPassword"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
 			return
 		}
 
-		if err := authService.ChangePassword(r.Context(), req.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+		if err := authService.ChangePassword(r.Context(), middleware.GetUserID(r.Context()), req.CurrentPassword, req.NewPassword); err != nil {
 			log.Error("Password change failed", "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpresponse.Error(w, r, err)
 			return
 		}
 
@@ -350,20 +344,14 @@ func handleChangePassword(authService *auth.AuthService, log *logger.Logger) htt
 func handleMe(authService *auth.AuthService, log *logger.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		userID := r.URL.Query().Get("userId")
-		if userID == "" {
-			http.Error(w, "userId is required", http.StatusBadRequest)
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 
-		user, err := authService.GetUser(r.Context(), userID)
+		user, err := authService.GetUser(r.Context(), middleware.GetUserID(r.Context()))
 		if err != nil {
 			log.Error("Get user failed", "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpresponse.Error(w, r, err)
 			return
 		}
 
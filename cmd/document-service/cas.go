@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/domain"
+)
+
+// blobCollectLease is how long the collector holds a claimed blob while it
+// deletes its object.
+const blobCollectLease = 5 * time.Minute
+
+// parseCASTenants parses the comma-separated CAS_TENANTS setting.
+func parseCASTenants(value string) []string {
+	var tenants []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			tenants = append(tenants, id)
+		}
+	}
+	return tenants
+}
+
+// contentAddressed reports whether the tenant's documents are stored by
+// content, each distinct content once.
+func (c *Config) contentAddressed(tenantID uuid.UUID) bool {
+	for _, id := range c.CASTenants {
+		if id == "*" || id == tenantID.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// storeContent uploads a document's content and sets its checksum and
+// size. In content-addressed tenants the content is stored once under its
+// SHA-256 and doc.ObjectKey is set to the blob's key, counting a reference
+// to it; otherwise it is uploaded to doc.ObjectKey.
+func (s *Service) storeContent(ctx context.Context, doc *domain.Document, data []byte, mimeType string) error {
+	doc.Checksum = calculateChecksum(data)
+	doc.Size = int64(len(data))
+	if !s.config.contentAddressed(doc.TenantID) {
+		return s.storage.Upload(ctx, doc.Bucket, doc.ObjectKey, data, mimeType)
+	}
+
+	key := domain.BlobKey(doc.TenantID, doc.Checksum)
+	blob, err := s.blobs.Acquire(ctx, &domain.Blob{
+		ID:       key,
+		TenantID: doc.TenantID,
+		Bucket:   doc.Bucket,
+		Checksum: doc.Checksum,
+		Size:     doc.Size,
+	})
+	if err != nil {
+		return err
+	}
+	// Wait out the collector if it is deleting the blob's object, so the
+	// content is uploaded again after it rather than deleted with it.
+	for blob.CollectingUntil != nil && time.Now().Before(*blob.CollectingUntil) {
+		select {
+		case <-ctx.Done():
+			s.releaseContent(context.Background(), doc.TenantID, doc.Bucket, key)
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+		if blob, err = s.blobs.Get(ctx, key); err != nil {
+			return err
+		}
+	}
+	if !blob.Stored {
+		if err := s.storage.Upload(ctx, doc.Bucket, key, data, mimeType); err != nil {
+			s.releaseContent(ctx, doc.TenantID, doc.Bucket, key)
+			return err
+		}
+		if err := s.blobs.MarkStored(ctx, key); err != nil {
+			return err
+		}
+	} else {
+		s.logger.Debug("Document content deduplicated", "document_id", doc.ID, "checksum", doc.Checksum)
+	}
+	doc.ObjectKey = key
+	return nil
+}
+
+// releaseContent drops a document's reference to its content: a blob is
+// left to the collector once nothing references it, any other object is
+// deleted.
+func (s *Service) releaseContent(ctx context.Context, tenantID uuid.UUID, bucket, key string) error {
+	if !domain.IsBlobKey(key) {
+		return s.storage.Delete(ctx, bucket, key)
+	}
+	if err := s.blobs.Release(ctx, key, time.Now()); err != nil {
+		s.logger.Error("Failed to release blob", "tenant_id", tenantID, "key", key, "error", err)
+		return err
+	}
+	return nil
+}
+
+// adoptContent moves the content of a document uploaded with a presigned
+// URL into its blob, for content-addressed tenants. Content that has not
+// been uploaded yet is left where it is.
+func (s *Service) adoptContent(ctx context.Context, doc *domain.Document) {
+	if !s.config.contentAddressed(doc.TenantID) || doc.ObjectKey == "" {
+		return
+	}
+	uploaded := doc.ObjectKey
+	data, err := s.storage.Download(ctx, doc.Bucket, uploaded)
+	if err != nil {
+		s.logger.Warn("Document content not uploaded yet; not deduplicated", "document_id", doc.ID, "error", err)
+		return
+	}
+	if err := s.storeContent(ctx, doc, data, doc.MimeType); err != nil {
+		s.logger.Error("Failed to deduplicate document content", "document_id", doc.ID, "error", err)
+		doc.ObjectKey = uploaded
+		return
+	}
+	if err := s.storage.Delete(ctx, doc.Bucket, uploaded); err != nil {
+		s.logger.Warn("Failed to delete uploaded object", "document_id", doc.ID, "key", uploaded, "error", err)
+	}
+}
+
+// runBlobCollector deletes unreferenced blobs until ctx is cancelled.
+func (s *Service) runBlobCollector(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CASCollectInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Blob collector started", "interval", s.config.CASCollectInterval, "grace_period", s.config.CASGracePeriod)
+
+	for {
+		if collected, err := s.collectBlobs(ctx, time.Now()); err != nil {
+			s.logger.Error("Failed to collect blobs", "collected", collected, "error", err)
+		} else if collected > 0 {
+			s.logger.Info("Collected unreferenced blobs", "collected", collected)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Blob collector stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectBlobs deletes the blobs nothing has referenced since the grace
+// period before now, and returns how many it deleted.
+func (s *Service) collectBlobs(ctx context.Context, now time.Time) (int, error) {
+	collected := 0
+	for {
+		blob, err := s.blobs.Claim(ctx, now.Add(-s.config.CASGracePeriod), now, blobCollectLease)
+		if err != nil || blob == nil {
+			return collected, err
+		}
+		// A failed delete is retried once the claim's lease has run out.
+		if err := s.storage.Delete(ctx, blob.Bucket, blob.ID); err != nil {
+			return collected, fmt.Errorf("blob %s: %w", blob.ID, err)
+		}
+		deleted, err := s.blobs.Finish(ctx, blob.ID)
+		if err != nil {
+			return collected, err
+		}
+		if deleted {
+			collected++
+		}
+	}
+}
+
+// BlobStore keeps the reference counts of content-addressed blobs.
+type BlobStore struct {
+	collection *mongo.Collection
+}
+
+func NewBlobStore(db *mongo.Database) *BlobStore {
+	return &BlobStore{collection: db.Collection("document_blobs")}
+}
+
+func (r *BlobStore) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "refs", Value: 1}, {Key: "unreferencedAt", Value: 1}},
+		Options: options.Index().SetName("unreferenced"),
+	})
+	return err
+}
+
+// Acquire counts a reference to blob, recording it if it is new, and
+// returns it as it is stored.
+func (r *BlobStore) Acquire(ctx context.Context, blob *domain.Blob) (*domain.Blob, error) {
+	var acquired domain.Blob
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": blob.ID}, bson.M{
+		"$inc":   bson.M{"refs": 1},
+		"$unset": bson.M{"unreferencedAt": ""},
+		"$setOnInsert": bson.M{
+			"tenantId":  blob.TenantID,
+			"bucket":    blob.Bucket,
+			"checksum":  blob.Checksum,
+			"size":      blob.Size,
+			"stored":    false,
+			"createdAt": time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&acquired)
+	if err != nil {
+		return nil, err
+	}
+	return &acquired, nil
+}
+
+func (r *BlobStore) Get(ctx context.Context, id string) (*domain.Blob, error) {
+	var blob domain.Blob
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&blob); err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *BlobStore) MarkStored(ctx context.Context, id string) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"stored": true}})
+	return err
+}
+
+// Release drops a reference to a blob, starting its grace period when it
+// was the last.
+func (r *BlobStore) Release(ctx context.Context, id string, at time.Time) error {
+	var released domain.Blob
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "refs": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"refs": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&released)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil || released.Refs > 0 {
+		return err
+	}
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": id, "refs": 0}, bson.M{"$set": bson.M{"unreferencedAt": at}})
+	return err
+}
+
+// Claim hands the collector a blob unreferenced since before cutoff, for
+// lease, or returns nil when there is none. The blob is marked as not
+// stored, so whoever references it meanwhile uploads it again once the
+// collector is done.
+func (r *BlobStore) Claim(ctx context.Context, cutoff, now time.Time, lease time.Duration) (*domain.Blob, error) {
+	var blob domain.Blob
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{
+		"refs":           0,
+		"unreferencedAt": bson.M{"$lte": cutoff},
+		"$or": bson.A{
+			bson.M{"collectingUntil": nil},
+			bson.M{"collectingUntil": bson.M{"$lt": now}},
+		},
+	}, bson.M{
+		"$set": bson.M{"stored": false, "collectingUntil": now.Add(lease)},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&blob)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// Finish removes a collected blob, unless it was referenced again while
+// its object was deleted; it is then released to the writers waiting for
+// it, and Finish reports false.
+func (r *BlobStore) Finish(ctx context.Context, id string) (bool, error) {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "refs": 0})
+	if err != nil {
+		return false, err
+	}
+	if result.DeletedCount == 1 {
+		return true, nil
+	}
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"collectingUntil": ""}})
+	return false, err
+}
+
+// TenantBytes returns the size of the tenant's stored blobs.
+func (r *BlobStore) TenantBytes(ctx context.Context, tenantID uuid.UUID) (int64, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenantId": tenantID, "stored": true}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "bytes": bson.M{"$sum": "$size"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var totals []struct {
+		Bytes int64 `bson:"bytes"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil || len(totals) == 0 {
+		return 0, err
+	}
+	return totals[0].Bytes, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/numbering"
+	apperr "github.com/ims-erp/system/pkg/errors"
+)
+
+// findShipment reads the tenant's order with the shipment id from the ERP
+// database.
+func (s *Service) findShipment(ctx context.Context, tenantID uuid.UUID, id string) (*domain.Order, *domain.OrderFulfillment, error) {
+	shipmentID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil, apperr.NotFound("shipment %s not found", id)
+	}
+	var order domain.Order
+	err = s.erpDb.Collection("orders").FindOne(ctx, bson.M{"tenantId": tenantID, "fulfillments._id": shipmentID}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, apperr.NotFound("shipment %s not found", id)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	shipment := order.FindFulfillment(shipmentID)
+	if shipment == nil {
+		return nil, nil, apperr.NotFound("shipment %s not found", id)
+	}
+	return &order, shipment, nil
+}
+
+// numberDeliveryNote gives the shipment its delivery note number, the next
+// of the tenant's delivery_note sequence for the order's channel, unless
+// it has one already. The number is copied to the delivery route stop the
+// shipment is assigned to, so that it is on the driver's manifest.
+func (s *Service) numberDeliveryNote(ctx context.Context, tenantID uuid.UUID, id string) error {
+	order, shipment, err := s.findShipment(ctx, tenantID, id)
+	if err != nil || shipment.DeliveryNoteNumber != "" {
+		return err
+	}
+	number, err := s.numbers.Next(ctx, tenantID, numbering.DocumentDeliveryNote, order.Channel)
+	if err != nil {
+		return fmt.Errorf("failed to number delivery note: %w", err)
+	}
+
+	// Only the first of concurrent requests numbers the shipment; the
+	// others use its number.
+	result, err := s.erpDb.Collection("orders").UpdateOne(ctx,
+		bson.M{"_id": order.ID, "tenantId": tenantID, "fulfillments": bson.M{"$elemMatch": bson.M{
+			"_id": shipment.ID, "deliveryNoteNumber": bson.M{"$exists": false},
+		}}},
+		bson.M{"$set": bson.M{"fulfillments.$.deliveryNoteNumber": number}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return fmt.Errorf("failed to record delivery note number: %w", err)
+	}
+	if result.ModifiedCount == 0 {
+		return nil
+	}
+
+	_, err = s.erpDb.Collection("delivery_routes").UpdateMany(ctx,
+		bson.M{"tenantId": tenantID, "stops.shipmentId": shipment.ID},
+		bson.M{"$set": bson.M{"stops.$[stop].deliveryNoteNumber": number}, "$inc": bson.M{"version": 1}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"stop.shipmentId": shipment.ID}}}))
+	if err != nil {
+		s.logger.Error("Failed to add delivery note number to route stop", "shipment_id", shipment.ID, "error", err)
+	}
+	return nil
+}
+
+// recordDeliveryNote links the generated delivery note or packing slip to
+// its shipment and adds it to the order's timeline.
+func (s *Service) recordDeliveryNote(ctx context.Context, doc *domain.Document, userID string) {
+	order, shipment, err := s.findShipment(ctx, doc.TenantID, doc.EntityID)
+	if err != nil {
+		s.logger.Error("Failed to read shipment of delivery note", "document_id", doc.ID, "error", err)
+		return
+	}
+	field := "fulfillments.$.deliveryNoteId"
+	if doc.Type == domain.DocTypePackingSlip {
+		field = "fulfillments.$.packingSlipId"
+	}
+	_, err = s.erpDb.Collection("orders").UpdateOne(ctx,
+		bson.M{"_id": order.ID, "tenantId": doc.TenantID, "fulfillments._id": shipment.ID},
+		bson.M{"$set": bson.M{field: doc.ID}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		s.logger.Error("Failed to link delivery note to shipment", "document_id", doc.ID, "shipment_id", shipment.ID, "error", err)
+	}
+	s.publish(ctx, &events.NewDeliveryNoteGeneratedEvent(order, shipment, doc, userID).EventEnvelope)
+}
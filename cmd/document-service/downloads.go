@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// downloadPath is where download links are redeemed. It is public: the
+// token in the path is the credential, and it works until the whole file
+// has been delivered once.
+const downloadPath = "/api/v1/downloads/"
+
+// downloadTokenPrefix prefixes the Redis keys download tokens are kept
+// under, by their hash.
+const downloadTokenPrefix = "document-download:"
+
+// downloadGrant is what a download token allows: one download of a
+// document, or of its Rendition when set, on behalf of the user who asked
+// for the link.
+type downloadGrant struct {
+	TenantID   uuid.UUID `json:"tenantId"`
+	DocumentID uuid.UUID `json:"documentId"`
+	UserID     string    `json:"userId"`
+	Rendition  string    `json:"rendition,omitempty"`
+}
+
+// getPresignedURLHandler returns a single-use link to download a document
+// through the service, valid for the tenant's download expiry. Unlike a
+// storage URL, the link stops working once used or once the document is
+// deleted. Links to images serve their watermarked rendition when their use
+// case has one.
+func (s *Service) getPresignedURLHandler(w http.ResponseWriter, r *http.Request) {
+	tenantID := getTenantID(r)
+	docID := getIDParam(r)
+
+	if !rbac.Allows(middleware.GetPermissions(r.Context()), permissionDocumentRead) {
+		httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+permissionDocumentRead)
+		return
+	}
+	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+		return
+	}
+
+	expiry := s.config.Presign.DownloadExpiryFor(tenantID.String())
+	token, err := s.issueDownloadToken(r.Context(), downloadGrant{
+		TenantID:   tenantID,
+		DocumentID: doc.ID,
+		UserID:     middleware.GetUserID(r.Context()),
+		Rendition:  s.sharedRendition(doc),
+	}, expiry)
+	if err != nil {
+		s.logger.Error("Failed to issue download token", "document_id", doc.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to generate URL")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":       strings.TrimRight(s.config.DownloadURL, "/") + "/" + token,
+		"expiresAt": time.Now().Add(expiry).UTC(),
+	})
+}
+
+// redeemDownloadHandler serves the document or rendition a download token
+// was issued for. The token is spent once a response has delivered the file
+// through its last byte, so an interrupted download can be resumed with
+// Range requests until then; HEAD requests never spend it. A token for an
+// archived document, or a rendition still being rendered, is kept until it
+// can be served.
+func (s *Service) redeemDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	grant, err := s.lookupDownloadToken(r.Context(), token)
+	if err == redis.Nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Download link is invalid, expired or already used")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to redeem download token", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to download document")
+		return
+	}
+
+	doc, err := s.repo.GetByID(r.Context(), grant.TenantID, grant.DocumentID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+			return
+		}
+		s.logger.Error("Failed to get document", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
+		return
+	}
+	var rendition *domain.Rendition
+	if grant.Rendition != "" {
+		if rendition = doc.Rendition(grant.Rendition); rendition == nil {
+			writeRenditionMissing(w, r, doc)
+			return
+		}
+	} else if doc.Archived() {
+		if err := s.requestRestore(r.Context(), doc); err != nil {
+			s.logger.Error("Failed to request document restore", "document_id", doc.ID, "error", err)
+		}
+		writeRestoring(w, doc)
+		return
+	}
+	key, contentType, fileName := doc.ObjectKey, doc.MimeType, doc.FileName
+	if rendition != nil {
+		key, contentType = rendition.ObjectKey, rendition.ContentType
+		fileName = strings.TrimSuffix(doc.FileName, path.Ext(doc.FileName)) + path.Ext(rendition.ObjectKey)
+	}
+	content, err := s.storage.DownloadStream(r.Context(), doc.Bucket, key)
+	if err != nil {
+		s.logger.Error("Failed to download document", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to download document")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", attachment(fileName))
+	w.Header().Set("Cache-Control", "no-store")
+	size := doc.Size
+	if rendition == nil {
+		w.Header().Set("X-Checksum-SHA256", doc.Checksum)
+	} else {
+		size = rendition.Size
+	}
+	delivery := &deliveryWriter{ResponseWriter: w}
+	serveContent(delivery, r, doc.UpdatedAt, size, content)
+	if r.Method == http.MethodHead || !delivery.complete() {
+		return
+	}
+	if _, err := s.spendDownloadToken(r.Context(), token); err != nil {
+		s.logger.Error("Failed to spend download token", "error", err)
+	}
+	s.logger.Info("Document downloaded by link", "document_id", doc.ID, "tenant_id", grant.TenantID,
+		"user_id", grant.UserID, "rendition", grant.Rendition)
+}
+
+// attachment returns a Content-Disposition header offering fileName for
+// download, quoted or encoded as needed.
+func attachment(fileName string) string {
+	if header := mime.FormatMediaType("attachment", map[string]string{"filename": fileName}); header != "" {
+		return header
+	}
+	return "attachment"
+}
+
+// deliveryWriter records the status and body size of a response, so a
+// handler can tell whether the file reached the client in full.
+type deliveryWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *deliveryWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *deliveryWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// complete reports whether the response delivered the file through its
+// last byte: all of it, or a single range running to its end. A response
+// of unknown length counts as complete once it is sent.
+func (w *deliveryWriter) complete() bool {
+	switch w.status {
+	case http.StatusOK:
+		length := w.Header().Get("Content-Length")
+		if length == "" {
+			return true
+		}
+		n, err := strconv.ParseInt(length, 10, 64)
+		return err == nil && w.written == n
+	case http.StatusPartialContent:
+		var first, last, size int64
+		if _, err := fmt.Sscanf(w.Header().Get("Content-Range"), "bytes %d-%d/%d", &first, &last, &size); err != nil {
+			return false
+		}
+		return last == size-1 && w.written == last-first+1
+	default:
+		return false
+	}
+}
+
+// serveContent streams content, which it closes, as the response body.
+// When content seeks, Range requests are answered with the ranges asked
+// for, so an interrupted download can be resumed; If-Range is checked
+// against modified and the ETag header, when set. Otherwise the whole
+// content is sent, with its size as Content-Length when it is known,
+// above zero.
+func serveContent(w http.ResponseWriter, r *http.Request, modified time.Time, size int64, content io.ReadCloser) {
+	defer content.Close()
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", modified, seeker)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "none")
+	if size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if r.Method != http.MethodHead {
+		io.Copy(w, content)
+	}
+}
+
+// issueDownloadToken keeps grant for expiry and returns the token that
+// redeems it. Only the token's hash is stored.
+func (s *Service) issueDownloadToken(ctx context.Context, grant downloadGrant, expiry time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	data, err := json.Marshal(grant)
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.Set(ctx, downloadTokenPrefix+calculateChecksum([]byte(token)), data, expiry).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// lookupDownloadToken returns the grant of token, or redis.Nil for an
+// unknown, expired or spent token.
+func (s *Service) lookupDownloadToken(ctx context.Context, token string) (*downloadGrant, error) {
+	data, err := s.redis.Get(ctx, downloadTokenPrefix+calculateChecksum([]byte(token))).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var grant downloadGrant
+	if err := json.Unmarshal(data, &grant); err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// spendDownloadToken removes token, so it stops working, and reports
+// whether it was still there to spend.
+func (s *Service) spendDownloadToken(ctx context.Context, token string) (bool, error) {
+	removed, err := s.redis.Del(ctx, downloadTokenPrefix+calculateChecksum([]byte(token))).Result()
+	return removed == 1, err
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+)
+
+const downloadContent = "0123456789abcdef"
+
+// seekingContent is content storage can read from an offset.
+type seekingContent struct {
+	*strings.Reader
+	closed bool
+}
+
+func (c *seekingContent) Close() error {
+	c.closed = true
+	return nil
+}
+
+// streamingContent is content storage can only read from the start.
+type streamingContent struct {
+	io.Reader
+	closed bool
+}
+
+func (c *streamingContent) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestServeContent_Seekable(t *testing.T) {
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		header       map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"full", nil, http.StatusOK, downloadContent, ""},
+		{"partial", map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, "2345", "bytes 2-5/16"},
+		{"resumed", map[string]string{"Range": "bytes=10-"}, http.StatusPartialContent, "abcdef", "bytes 10-15/16"},
+		{"unsatisfiable", map[string]string{"Range": "bytes=100-"}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */16"},
+		{"If-Range matching the ETag", map[string]string{"Range": "bytes=0-3", "If-Range": `"v1"`}, http.StatusPartialContent, "0123", "bytes 0-3/16"},
+		{"If-Range matching the modification time", map[string]string{"Range": "bytes=0-3", "If-Range": modified.Format(http.TimeFormat)}, http.StatusPartialContent, "0123", "bytes 0-3/16"},
+		{"If-Range of another ETag", map[string]string{"Range": "bytes=0-3", "If-Range": `"v0"`}, http.StatusOK, downloadContent, ""},
+		{"If-Range of an earlier time", map[string]string{"Range": "bytes=0-3", "If-Range": modified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK, downloadContent, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/download", nil)
+		for name, value := range tt.header {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		rec.Header().Set("ETag", `"v1"`)
+		content := &seekingContent{Reader: strings.NewReader(downloadContent)}
+
+		serveContent(rec, req, modified, int64(len(downloadContent)), content)
+
+		assert.Equal(t, tt.status, rec.Code, tt.name)
+		assert.Equal(t, tt.contentRange, rec.Header().Get("Content-Range"), tt.name)
+		if tt.status != http.StatusRequestedRangeNotSatisfiable {
+			assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"), tt.name)
+			assert.Equal(t, tt.body, rec.Body.String(), tt.name)
+		}
+		assert.True(t, content.closed, tt.name)
+	}
+}
+
+func TestServeContent_Streaming(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		rangeHeader   string
+		size          int64
+		body          string
+		contentLength string
+	}{
+		{"full", http.MethodGet, "", int64(len(downloadContent)), downloadContent, "16"},
+		{"range ignored", http.MethodGet, "bytes=2-5", int64(len(downloadContent)), downloadContent, "16"},
+		{"head", http.MethodHead, "", int64(len(downloadContent)), "", "16"},
+		{"unknown size", http.MethodGet, "", 0, downloadContent, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/download", nil)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		content := &streamingContent{Reader: strings.NewReader(downloadContent)}
+
+		serveContent(rec, req, time.Now(), tt.size, content)
+
+		assert.Equal(t, http.StatusOK, rec.Code, tt.name)
+		assert.Equal(t, "none", rec.Header().Get("Accept-Ranges"), tt.name)
+		assert.Empty(t, rec.Header().Get("Content-Range"), tt.name)
+		assert.Equal(t, tt.contentLength, rec.Header().Get("Content-Length"), tt.name)
+		assert.Equal(t, tt.body, rec.Body.String(), tt.name)
+		assert.True(t, content.closed, tt.name)
+	}
+}
+
+// memoryKeys answers GET, SET and DEL from memory instead of a Redis server.
+type memoryKeys struct {
+	values map[string]string
+}
+
+func (m *memoryKeys) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (m *memoryKeys) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (m *memoryKeys) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		args := cmd.Args()
+		switch cmd := cmd.(type) {
+		case *redis.StatusCmd:
+			m.values[args[1].(string)] = string(args[2].([]byte))
+			cmd.SetVal("OK")
+		case *redis.StringCmd:
+			value, ok := m.values[args[1].(string)]
+			if !ok {
+				cmd.SetErr(redis.Nil)
+				return redis.Nil
+			}
+			cmd.SetVal(value)
+		case *redis.IntCmd:
+			var deleted int64
+			for _, arg := range args[1:] {
+				if _, ok := m.values[arg.(string)]; ok {
+					delete(m.values, arg.(string))
+					deleted++
+				}
+			}
+			cmd.SetVal(deleted)
+		}
+		return nil
+	}
+}
+
+// newDownloadTest returns a service with a stored document and a download
+// token for it.
+func newDownloadTest(t *testing.T) (*Service, *domain.Document, string) {
+	d := newDAVTest(t)
+	client := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	client.AddHook(&memoryKeys{values: make(map[string]string)})
+	t.Cleanup(func() { client.Close() })
+	d.svc.redis = client
+
+	doc := d.addDocument(t, uuid.New(), domain.DocTypeInvoice, "invoice.txt", downloadContent)
+	token, err := d.svc.issueDownloadToken(context.Background(), downloadGrant{TenantID: doc.TenantID, DocumentID: doc.ID}, time.Hour)
+	require.NoError(t, err)
+	return d.svc, doc, token
+}
+
+func redeem(svc *Service, token, method, rangeHeader string) *httptest.ResponseRecorder {
+	req := mux.SetURLVars(httptest.NewRequest(method, downloadPath+token, nil), map[string]string{"token": token})
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	rec := httptest.NewRecorder()
+	svc.redeemDownloadHandler(rec, req)
+	return rec
+}
+
+func TestRedeemDownload_ResumesWithRanges(t *testing.T) {
+	svc, _, token := newDownloadTest(t)
+
+	rec := redeem(svc, token, http.MethodGet, "bytes=0-9")
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "0123456789", rec.Body.String())
+
+	rec = redeem(svc, token, http.MethodGet, "bytes=4-7")
+	require.Equal(t, http.StatusPartialContent, rec.Code, "the link works until the file has been delivered")
+
+	rec = redeem(svc, token, http.MethodGet, "bytes=10-")
+	require.Equal(t, http.StatusPartialContent, rec.Code, "an interrupted download is resumed")
+	assert.Equal(t, "abcdef", rec.Body.String())
+
+	rec = redeem(svc, token, http.MethodGet, "bytes=10-")
+	assert.Equal(t, http.StatusNotFound, rec.Code, "the link is spent once the last byte is delivered")
+}
+
+func TestRedeemDownload_HeadDoesNotSpend(t *testing.T) {
+	svc, doc, token := newDownloadTest(t)
+
+	rec := redeem(svc, token, http.MethodHead, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "16", rec.Header().Get("Content-Length"))
+	assert.Equal(t, doc.Checksum, rec.Header().Get("X-Checksum-SHA256"))
+
+	rec = redeem(svc, token, http.MethodGet, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, downloadContent, rec.Body.String())
+	assert.Equal(t, `attachment; filename=invoice.txt`, rec.Header().Get("Content-Disposition"))
+
+	assert.Equal(t, http.StatusNotFound, redeem(svc, token, http.MethodGet, "").Code, "a full download spends the link")
+	assert.Equal(t, http.StatusNotFound, redeem(svc, token, http.MethodHead, "").Code)
+}
+
+func TestDeliveryWriter_Complete(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		written int64
+		want    bool
+	}{
+		{"whole file", http.StatusOK, map[string]string{"Content-Length": "16"}, 16, true},
+		{"interrupted", http.StatusOK, map[string]string{"Content-Length": "16"}, 10, false},
+		{"unknown length", http.StatusOK, nil, 16, true},
+		{"range to the end", http.StatusPartialContent, map[string]string{"Content-Range": "bytes 10-15/16"}, 6, true},
+		{"interrupted range", http.StatusPartialContent, map[string]string{"Content-Range": "bytes 10-15/16"}, 3, false},
+		{"range in the middle", http.StatusPartialContent, map[string]string{"Content-Range": "bytes 2-5/16"}, 4, false},
+		{"several ranges", http.StatusPartialContent, map[string]string{"Content-Type": "multipart/byteranges; boundary=x"}, 100, false},
+		{"not modified", http.StatusNotModified, nil, 0, false},
+		{"unsatisfiable", http.StatusRequestedRangeNotSatisfiable, map[string]string{"Content-Range": "bytes */16"}, 0, false},
+	}
+	for _, tt := range tests {
+		w := &deliveryWriter{ResponseWriter: httptest.NewRecorder(), status: tt.status, written: tt.written}
+		for name, value := range tt.header {
+			w.Header().Set(name, value)
+		}
+		assert.Equal(t, tt.want, w.complete(), tt.name)
+	}
+}
+
+func TestDownloadDocument(t *testing.T) {
+	d := newDAVTest(t)
+	tenantID := uuid.New()
+	doc := d.addDocument(t, tenantID, domain.DocTypeInvoice, `Q3 "final"; report.txt`, downloadContent)
+
+	download := func(permissions ...string) *httptest.ResponseRecorder {
+		ctx := middleware.WithIdentity(context.Background(), tenantID.String(), "user-1", permissions)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/documents/"+doc.ID.String()+"/download", nil).WithContext(ctx)
+		req = mux.SetURLVars(req, map[string]string{"id": doc.ID.String()})
+		rec := httptest.NewRecorder()
+		d.svc.downloadDocumentHandler(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, download().Code)
+	assert.Equal(t, http.StatusForbidden, download(permissionDocumentWrite).Code)
+
+	rec := download(permissionDocumentRead)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, downloadContent, rec.Body.String())
+	disposition, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+	require.NoError(t, err, "the file name is quoted")
+	assert.Equal(t, "attachment", disposition)
+	assert.Equal(t, `Q3 "final"; report.txt`, params["filename"])
+}
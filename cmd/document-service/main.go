@@ -1,16 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -19,12 +24,31 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/config"
 	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/extraction"
+	"github.com/ims-erp/system/internal/imaging"
+	"github.com/ims-erp/system/internal/infrastructure/processing"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/notification"
+	"github.com/ims-erp/system/internal/numbering"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/internal/trash"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/fieldcrypt"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/ims-erp/system/pkg/pagination"
 )
 
 var (
@@ -33,20 +57,81 @@ var (
 )
 
 type Config struct {
-	ServiceName      string        `mapstructure:"SERVICE_NAME"`
-	ServicePort      int           `mapstructure:"SERVICE_PORT"`
-	MongoURI         string        `mapstructure:"MONGO_URI"`
-	MongoDatabase    string        `mapstructure:"MONGO_DATABASE"`
-	RedisAddr        string        `mapstructure:"REDIS_ADDR"`
-	RedisPassword    string        `mapstructure:"REDIS_PASSWORD"`
-	MinIOEndpoint    string        `mapstructure:"MINIO_ENDPOINT"`
-	MinIOAccessKey   string        `mapstructure:"MINIO_ACCESS_KEY"`
-	MinIOSecretKey   string        `mapstructure:"MINIO_SECRET_KEY"`
-	MinIOUseSSL      bool          `mapstructure:"MINIO_USE_SSL"`
-	ElasticsearchURL string        `mapstructure:"ELASTICSEARCH_URL"`
-	MaxFileSize      int64         `mapstructure:"MAX_FILE_SIZE"`
-	PresignedExpiry  time.Duration `mapstructure:"PRESIGNED_EXPIRY"`
-	LogLevel         string        `mapstructure:"LOG_LEVEL"`
+	ServiceName      string `mapstructure:"SERVICE_NAME"`
+	ServicePort      int    `mapstructure:"SERVICE_PORT"`
+	MongoURI         string `mapstructure:"MONGO_URI"`
+	MongoDatabase    string `mapstructure:"MONGO_DATABASE"`
+	RedisAddr        string `mapstructure:"REDIS_ADDR"`
+	RedisPassword    string `mapstructure:"REDIS_PASSWORD"`
+	MinIOEndpoint    string `mapstructure:"MINIO_ENDPOINT"`
+	MinIOAccessKey   string `mapstructure:"MINIO_ACCESS_KEY"`
+	MinIOSecretKey   string `mapstructure:"MINIO_SECRET_KEY"`
+	MinIOUseSSL      bool   `mapstructure:"MINIO_USE_SSL"`
+	ElasticsearchURL string `mapstructure:"ELASTICSEARCH_URL"`
+	MaxFileSize      int64  `mapstructure:"MAX_FILE_SIZE"`
+	LogLevel         string `mapstructure:"LOG_LEVEL"`
+	JWTSecret        string `mapstructure:"JWT_SECRET"`
+	OCRLanguages     string `mapstructure:"OCR_LANGUAGES"`
+	// TikaURL is the Apache Tika server the text of office files is read
+	// with; without one only PDFs, images, text and DOCX files are read.
+	TikaURL string `mapstructure:"TIKA_URL"`
+	// ProcessInterval is how often documents waiting for their text to be
+	// extracted are looked for, besides whenever one is uploaded.
+	ProcessInterval time.Duration `mapstructure:"PROCESS_INTERVAL"`
+	// SigningURL is the signing page invitation links open, with the
+	// signer's token appended.
+	SigningURL           string        `mapstructure:"SIGNING_URL"`
+	SigningInvitationTTL time.Duration `mapstructure:"SIGNING_INVITATION_TTL"`
+	SigningTrustedCAs    string        `mapstructure:"SIGNING_TRUSTED_CAS"`
+	// ERPDatabase is the database of the other services, whose clients,
+	// orders and invoices documents are generated from.
+	ERPDatabase string `mapstructure:"ERP_DATABASE"`
+	// DownloadURL is where download links are redeemed, with the token
+	// appended.
+	DownloadURL string `mapstructure:"DOWNLOAD_URL"`
+	// CASTenants are the tenants, or "*" for all, whose documents are
+	// stored content-addressed: each distinct content once, referenced by
+	// every document with it. Blobs nothing references for CASGracePeriod
+	// are collected every CASCollectInterval.
+	CASTenants         []string      `mapstructure:"CAS_TENANTS"`
+	CASGracePeriod     time.Duration `mapstructure:"CAS_GRACE_PERIOD"`
+	CASCollectInterval time.Duration `mapstructure:"CAS_GC_INTERVAL"`
+	// Documents are archived to their bucket's ArchiveBucketSuffix bucket,
+	// in ArchiveStorageClass, such as GLACIER, or the bucket's default when
+	// empty, by a job running every TieringInterval. Usage is priced per
+	// GiB and month at StorageCostHot and StorageCostArchive.
+	ArchiveBucketSuffix string          `mapstructure:"ARCHIVE_BUCKET_SUFFIX"`
+	ArchiveStorageClass string          `mapstructure:"ARCHIVE_STORAGE_CLASS"`
+	TieringInterval     time.Duration   `mapstructure:"TIERING_INTERVAL"`
+	StorageCostHot      decimal.Decimal `mapstructure:"STORAGE_COST_HOT"`
+	StorageCostArchive  decimal.Decimal `mapstructure:"STORAGE_COST_ARCHIVE"`
+	StorageCostCurrency string          `mapstructure:"STORAGE_COST_CURRENCY"`
+	// StorageUsageInterval is how often each tenant's storage usage is
+	// recorded and published for billing.
+	StorageUsageInterval time.Duration `mapstructure:"STORAGE_USAGE_INTERVAL"`
+	// RenderInterval is how often images waiting for their renditions
+	// are looked for, besides whenever one is uploaded.
+	RenderInterval time.Duration `mapstructure:"RENDER_INTERVAL"`
+	// Resumable uploads not completed within TusUploadExpiry of their last
+	// part are removed by a job running every TusCleanupInterval.
+	TusUploadExpiry    time.Duration `mapstructure:"TUS_UPLOAD_EXPIRY"`
+	TusCleanupInterval time.Duration `mapstructure:"TUS_CLEANUP_INTERVAL"`
+	// Multipart uploads, of files up to MultipartMaxSize in parts of up to
+	// MaxFileSize, not completed within MultipartUploadExpiry of their last
+	// part are aborted by a job running every MultipartCleanupInterval.
+	MultipartMaxSize         int64         `mapstructure:"MULTIPART_MAX_SIZE"`
+	MultipartUploadExpiry    time.Duration `mapstructure:"MULTIPART_UPLOAD_EXPIRY"`
+	MultipartCleanupInterval time.Duration `mapstructure:"MULTIPART_CLEANUP_INTERVAL"`
+	Images                   config.ImageConfig
+	Presign                  config.PresignConfig
+	StorageQuotas            config.StorageQuotaConfig
+	NATS                     config.NATSConfig
+	Messaging                config.MessagingConfig
+	Trash                    config.TrashConfig
+	Security                 config.SecurityConfig
+	Notifications            config.NotificationConfig
+	Numbering                config.NumberingConfig
+	I18n                     config.I18nConfig
 }
 
 type Service struct {
@@ -58,14 +143,60 @@ type Service struct {
 	minio    *minio.Client
 	esClient *http.Client
 	repo     domain.DocumentRepository
+	docs     *MongoDocumentRepository
 	storage  domain.StorageService
 	search   domain.SearchService
+	ocr      *extraction.OCR
+
+	processing domain.ProcessingService
+	processNow chan struct{}
+
+	supplierInvoices  *SupplierInvoiceStore
+	supplierTemplates *SupplierTemplateStore
+
+	envelopes  *EnvelopeStore
+	mailer     notification.Provider
+	trustedCAs *x509.CertPool
+
+	templates *DocumentTemplateStore
+	erpDb     *mongo.Database
+	// numbers numbers delivery notes in the ERP database.
+	numbers *numbering.Generator
+	// pii opens the client contact details of the ERP database.
+	pii *fieldcrypt.Keyring
+
+	tokens     middleware.TokenValidator
+	webdavKeys *WebDAVKeyStore
+	davLocks   *webdavLocks
+	davDocs    davDocuments
+
+	blobs *BlobStore
+
+	tiers           tieredStorage
+	storagePolicies *StoragePolicyStore
+	restoreNow      chan struct{}
+
+	usage  *StorageUsageStore
+	events events.Publisher
+
+	images     *imaging.Pipeline
+	renditions map[string][]imaging.Rendition
+	renderNow  chan struct{}
+
+	uploads *ResumableUploadStore
+
+	multipart        multipartStorage
+	multipartUploads *MultipartUploadStore
 }
 
+// UploadRequest asks for a URL to upload a file of ContentType and Size
+// to. The URL is signed for both, so storage refuses any other file.
 type UploadRequest struct {
-	Type       string    `json:"type"`
-	Tags       []string  `json:"tags"`
-	UploadedBy uuid.UUID `json:"uploadedBy"`
+	Type        string    `json:"type"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Tags        []string  `json:"tags"`
+	UploadedBy  uuid.UUID `json:"uploadedBy"`
 }
 
 type UploadResponse struct {
@@ -73,6 +204,7 @@ type UploadResponse struct {
 	PresignedURL    string            `json:"presignedUrl"`
 	ObjectKey       string            `json:"objectKey"`
 	RequiredHeaders map[string]string `json:"requiredHeaders"`
+	ExpiresAt       time.Time         `json:"expiresAt"`
 }
 
 type SearchRequest struct {
@@ -86,16 +218,54 @@ type SearchRequest struct {
 }
 
 func NewConfig() *Config {
+	signingURL := os.Getenv("SIGNING_URL")
+	if signingURL == "" {
+		signingURL = "http://localhost:3000/sign"
+	}
+	downloadURL := os.Getenv("DOWNLOAD_URL")
+	if downloadURL == "" {
+		downloadURL = "http://localhost:8086" + downloadPath
+	}
 	return &Config{
-		ServiceName:     "document-service",
-		ServicePort:     8080,
-		MongoURI:        "mongodb://localhost:27017",
-		MongoDatabase:   "erp_documents",
-		RedisAddr:       "localhost:6379",
-		MinIOEndpoint:   "localhost:9000",
-		MaxFileSize:     50 * 1024 * 1024,
-		PresignedExpiry: 1 * time.Hour,
-		LogLevel:        "info",
+		ServiceName:   "document-service",
+		ServicePort:   8080,
+		MongoURI:      "mongodb://localhost:27017",
+		MongoDatabase: "erp_documents",
+		RedisAddr:     "localhost:6379",
+		MinIOEndpoint: "localhost:9000",
+		MaxFileSize:   50 * 1024 * 1024,
+		LogLevel:      "info",
+		JWTSecret:     os.Getenv("ERP_AUTH_JWT_SECRET"),
+		OCRLanguages:  os.Getenv("OCR_LANGUAGES"),
+		TikaURL:       os.Getenv("TIKA_URL"),
+
+		SigningURL:           signingURL,
+		SigningInvitationTTL: 30 * 24 * time.Hour,
+		SigningTrustedCAs:    os.Getenv("SIGNING_TRUSTED_CAS"),
+
+		ERPDatabase: "erp_system",
+		DownloadURL: downloadURL,
+
+		CASTenants:         parseCASTenants(os.Getenv("CAS_TENANTS")),
+		CASGracePeriod:     24 * time.Hour,
+		CASCollectInterval: time.Hour,
+
+		ArchiveBucketSuffix: "-archive",
+		ArchiveStorageClass: os.Getenv("ARCHIVE_STORAGE_CLASS"),
+		TieringInterval:     time.Hour,
+		StorageCostHot:      decimal.RequireFromString("0.023"),
+		StorageCostArchive:  decimal.RequireFromString("0.004"),
+		StorageCostCurrency: "USD",
+
+		StorageUsageInterval: time.Hour,
+		RenderInterval:       5 * time.Minute,
+		ProcessInterval:      time.Minute,
+		TusUploadExpiry:      24 * time.Hour,
+		TusCleanupInterval:   time.Hour,
+
+		MultipartMaxSize:         5 * 1024 * 1024 * 1024,
+		MultipartUploadExpiry:    24 * time.Hour,
+		MultipartCleanupInterval: time.Hour,
 	}
 }
 
@@ -108,6 +278,7 @@ func NewService(cfg *Config) (*Service, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
+	metrics.Initialize(cfg.ServiceName)
 
 	svc := &Service{
 		config:   cfg,
@@ -127,9 +298,103 @@ func NewService(cfg *Config) (*Service, error) {
 		return nil, fmt.Errorf("failed to connect to MinIO: %w", err)
 	}
 
-	svc.repo = NewMongoDocumentRepository(svc.mongoDb)
-	svc.storage = NewMinIOStorageService(svc.minio)
+	svc.docs = NewMongoDocumentRepository(svc.mongoDb)
+	svc.repo = svc.docs
+	svc.davDocs = svc.docs
+	minioStorage := NewMinIOStorageService(svc.minio)
+	svc.storage = minioStorage
+	svc.tiers = minioStorage
+	svc.multipart = minioStorage
 	svc.search = NewElasticsearchService(svc.esClient, cfg.ElasticsearchURL)
+	svc.ocr = extraction.NewOCR(cfg.OCRLanguages)
+	var tika *extraction.Tika
+	if cfg.TikaURL != "" {
+		tika = extraction.NewTika(cfg.TikaURL)
+	}
+	// The processor stores a JPEG thumbnail of images and of the first
+	// page of PDFs. An image's thumbnail rendition, where configured, is
+	// served in its place.
+	svc.processing = processing.NewDocumentProcessingService(svc.storage, svc.ocr, tika)
+	svc.processNow = make(chan struct{}, 1)
+
+	svc.supplierInvoices = NewSupplierInvoiceStore(svc.mongoDb)
+	if err := svc.supplierInvoices.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create supplier invoice indexes", "error", err)
+	}
+	svc.supplierTemplates = NewSupplierTemplateStore(svc.mongoDb)
+	if err := svc.supplierTemplates.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create supplier template indexes", "error", err)
+	}
+
+	svc.envelopes = NewEnvelopeStore(svc.mongoDb)
+	if err := svc.envelopes.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create envelope indexes", "error", err)
+	}
+	providers, err := notification.NewProviders(cfg.Notifications)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure email: %w", err)
+	}
+	// Without an email provider, invitation links are only returned.
+	svc.mailer = providers[domain.ChannelEmail]
+	if svc.trustedCAs, err = loadTrustedCAs(cfg.SigningTrustedCAs); err != nil {
+		return nil, fmt.Errorf("failed to load trusted signing CAs: %w", err)
+	}
+
+	if svc.pii, err = cfg.Security.PII.Keyring(); err != nil {
+		return nil, fmt.Errorf("failed to configure PII encryption: %w", err)
+	}
+	svc.templates = NewDocumentTemplateStore(svc.mongoDb)
+	svc.numbers = numbering.NewGenerator(cfg.Numbering, cfg.I18n, repository.NewDocumentCounterStoreIn(svc.erpDb))
+	if err := svc.templates.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create document template indexes", "error", err)
+	}
+
+	svc.webdavKeys = NewWebDAVKeyStore(svc.mongoDb)
+	if err := svc.webdavKeys.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create WebDAV key indexes", "error", err)
+	}
+	svc.davLocks = newWebDAVLocks()
+
+	svc.blobs = NewBlobStore(svc.mongoDb)
+	if err := svc.blobs.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create blob indexes", "error", err)
+	}
+
+	svc.storagePolicies = NewStoragePolicyStore(svc.mongoDb)
+	svc.restoreNow = make(chan struct{}, 1)
+
+	svc.usage = NewStorageUsageStore(svc.mongoDb)
+	// Storage usage and quota events are published for billing; without a
+	// transport the service runs without them.
+	if cfg.Messaging.Transport == "kafka" || len(cfg.NATS.URLs) > 0 {
+		publisher, err := messaging.NewEventPublisher(&config.Config{NATS: cfg.NATS, Messaging: cfg.Messaging}, log)
+		if err != nil {
+			log.Warn("Failed to create event publisher; storage usage events are not published", "error", err)
+		} else {
+			svc.events = publisher
+		}
+	}
+
+	if svc.renditions, err = parseRenditions(cfg.Images); err != nil {
+		return nil, fmt.Errorf("invalid image renditions: %w", err)
+	}
+	svc.images = imaging.NewPipeline()
+	svc.images.WatermarkOpacity = cfg.Images.WatermarkOpacity
+	if cfg.Images.Watermark != "" {
+		if svc.images.Watermark, err = imaging.LoadWatermark(cfg.Images.Watermark); err != nil {
+			return nil, fmt.Errorf("failed to load watermark: %w", err)
+		}
+	}
+	svc.renderNow = make(chan struct{}, 1)
+
+	svc.uploads = NewResumableUploadStore(svc.mongoDb)
+	if err := svc.uploads.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create resumable upload indexes", "error", err)
+	}
+	svc.multipartUploads = NewMultipartUploadStore(svc.mongoDb)
+	if err := svc.multipartUploads.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create multipart upload indexes", "error", err)
+	}
 
 	return svc, nil
 }
@@ -150,6 +415,7 @@ func (s *Service) connectMongo() error {
 
 	s.mongo = client
 	s.mongoDb = client.Database(s.config.MongoDatabase)
+	s.erpDb = client.Database(s.config.ERPDatabase)
 	s.logger.Info("Connected to MongoDB")
 	return nil
 }
@@ -187,7 +453,12 @@ func (s *Service) connectMinIO() error {
 func (s *Service) Start() error {
 	router := mux.NewRouter()
 
-	s.setupMiddleware(router)
+	tokenValidator, err := auth.NewTokenValidator(&config.AuthConfig{JWT_SECRET: s.config.JWTSecret}, s.logger)
+	if err != nil {
+		return err
+	}
+	s.tokens = tokenValidator
+	s.setupMiddleware(router, middleware.NewTenantMiddleware(tokenValidator, signingPath, webdavPath, downloadPath))
 	s.setupRoutes(router)
 
 	srv := &http.Server{
@@ -198,6 +469,26 @@ func (s *Service) Start() error {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go trash.NewPurger(s.config.Trash, s.logger, trash.Target{
+		Name:  "documents",
+		Purge: s.purgeDocuments,
+		TenantValue: func(tenantID string) interface{} {
+			id, _ := uuid.Parse(tenantID)
+			return id
+		},
+	}).Run(purgeCtx)
+	if len(s.config.CASTenants) > 0 {
+		go s.runBlobCollector(purgeCtx)
+	}
+	go s.runTiering(purgeCtx)
+	go s.runUsageRecorder(purgeCtx)
+	go s.runRenderer(purgeCtx)
+	go s.runProcessor(purgeCtx)
+	go s.runUploadExpiry(purgeCtx)
+	go s.runMultipartExpiry(purgeCtx)
+
 	go func() {
 		s.logger.Info("Starting document-service", "port", s.config.ServicePort)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -222,36 +513,85 @@ func (s *Service) Start() error {
 	return nil
 }
 
-func (s *Service) setupMiddleware(router *mux.Router) {
-	router.Use(loggerMiddleware)
-	router.Use(corsMiddleware)
-	router.Use(requestIDMiddleware)
+func (s *Service) setupMiddleware(router *mux.Router, tenants *middleware.TenantMiddleware) {
+	router.Use(metrics.HTTPMiddleware)
+	router.Use(func(next http.Handler) http.Handler { return middleware.Instrument(s.logger, next) })
+	router.Use(middleware.NewCORSMiddleware(&s.config.Security).Handler)
+	router.Use(tenants.Handler)
 }
 
 func (s *Service) setupRoutes(router *mux.Router) {
 	router.HandleFunc("/health", s.healthHandler).Methods("GET")
 	router.HandleFunc("/ready", s.readyHandler).Methods("GET")
-	router.HandleFunc("/metrics", s.metricsHandler).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
 
 	api := router.PathPrefix("/api/v1/documents").Subrouter()
 
 	api.HandleFunc("/upload", s.initiateUploadHandler).Methods("POST")
+	api.HandleFunc("/tus", s.createResumableUploadHandler).Methods("POST")
+	api.HandleFunc("/tus/{uploadId}", s.headResumableUploadHandler).Methods("HEAD")
+	api.HandleFunc("/tus/{uploadId}", s.patchResumableUploadHandler).Methods("PATCH")
+	api.HandleFunc("/tus/{uploadId}", s.deleteResumableUploadHandler).Methods("DELETE")
 	api.HandleFunc("/multipart/start", s.startMultipartUploadHandler).Methods("POST")
 	api.HandleFunc("/multipart/{uploadId}/part", s.uploadPartHandler).Methods("PUT")
+	api.HandleFunc("/multipart/{uploadId}", s.getMultipartUploadHandler).Methods("GET")
+	api.HandleFunc("/multipart/{uploadId}", s.abortMultipartUploadHandler).Methods("DELETE")
 	api.HandleFunc("/multipart/{uploadId}/complete", s.completeMultipartUploadHandler).Methods("POST")
 	api.HandleFunc("", s.createDocumentHandler).Methods("POST")
 	api.HandleFunc("", s.listDocumentsHandler).Methods("GET")
+	api.HandleFunc("/trash", s.listTrashHandler).Methods("GET")
+	api.HandleFunc("/supplier-invoices", s.listSupplierInvoicesHandler).Methods("GET")
+	api.HandleFunc("/supplier-invoices/{id}", s.getSupplierInvoiceHandler).Methods("GET")
+	api.Handle("/supplier-invoices/{id}", middleware.RequireIfMatch(http.HandlerFunc(s.correctSupplierInvoiceHandler))).Methods("PUT")
+	api.HandleFunc("/supplier-invoices/{id}/approve", s.approveSupplierInvoiceHandler).Methods("POST")
+	api.HandleFunc("/supplier-invoices/{id}/reject", s.rejectSupplierInvoiceHandler).Methods("POST")
+	api.HandleFunc("/supplier-templates", s.listSupplierTemplatesHandler).Methods("GET")
+	api.HandleFunc("/envelopes", s.listEnvelopesHandler).Methods("GET")
+	api.HandleFunc("/envelopes/{id}", s.getEnvelopeHandler).Methods("GET")
+	api.HandleFunc("/envelopes/{id}/send", s.sendEnvelopeHandler).Methods("POST")
+	api.HandleFunc("/envelopes/{id}/void", s.voidEnvelopeHandler).Methods("POST")
+	api.HandleFunc("/envelopes/{id}/signed", s.signedDocumentHandler).Methods("GET")
+	api.HandleFunc("/templates", s.listTemplatesHandler).Methods("GET")
+	api.HandleFunc("/templates", s.createTemplateHandler).Methods("POST")
+	api.HandleFunc("/templates/fields", s.templateFieldsHandler).Methods("GET")
+	api.HandleFunc("/templates/{id}", s.getTemplateHandler).Methods("GET")
+	api.Handle("/templates/{id}", middleware.RequireIfMatch(http.HandlerFunc(s.updateTemplateHandler))).Methods("PUT")
+	api.HandleFunc("/templates/{id}", s.deleteTemplateHandler).Methods("DELETE")
+	api.HandleFunc("/generate", s.generateDocumentHandler).Methods("POST")
+	api.HandleFunc("/webdav-keys", s.listWebDAVKeysHandler).Methods("GET")
+	api.HandleFunc("/webdav-keys", s.createWebDAVKeyHandler).Methods("POST")
+	api.HandleFunc("/webdav-keys/{id}", s.revokeWebDAVKeyHandler).Methods("DELETE")
+	api.HandleFunc("/storage/policy", s.getStoragePolicyHandler).Methods("GET")
+	api.HandleFunc("/storage/policy", s.putStoragePolicyHandler).Methods("PUT")
+	api.HandleFunc("/storage/usage", s.storageUsageHandler).Methods("GET")
 	api.HandleFunc("/{id}", s.getDocumentHandler).Methods("GET")
-	api.HandleFunc("/{id}", s.updateDocumentHandler).Methods("PUT")
-	api.HandleFunc("/{id}", s.deleteDocumentHandler).Methods("DELETE")
+	api.Handle("/{id}", middleware.RequireIfMatch(http.HandlerFunc(s.updateDocumentHandler))).Methods("PUT")
+	api.Handle("/{id}", middleware.RequireIfMatch(http.HandlerFunc(s.deleteDocumentHandler))).Methods("DELETE")
 	api.HandleFunc("/{id}/download", s.downloadDocumentHandler).Methods("GET")
 	api.HandleFunc("/{id}/thumbnail", s.getThumbnailHandler).Methods("GET")
+	api.HandleFunc("/{id}/renditions/{name}", s.getRenditionHandler).Methods("GET")
 	api.HandleFunc("/{id}/presigned-url", s.getPresignedURLHandler).Methods("GET")
-	api.HandleFunc("/{id}/tags", s.updateTagsHandler).Methods("PUT")
+	api.Handle("/{id}/tags", middleware.RequireIfMatch(http.HandlerFunc(s.updateTagsHandler))).Methods("PUT")
 	api.HandleFunc("/{id}/reprocess", s.reprocessHandler).Methods("POST")
+	api.HandleFunc("/{id}/restore", s.restoreDocumentHandler).Methods("POST")
+	api.HandleFunc("/{id}/retrieve", s.retrieveDocumentHandler).Methods("POST")
+	api.HandleFunc("/{id}/extract", s.extractSupplierInvoiceHandler).Methods("POST")
+	api.HandleFunc("/{id}/envelopes", s.createEnvelopeHandler).Methods("POST")
+	api.HandleFunc("/{id}/envelopes", s.listDocumentEnvelopesHandler).Methods("GET")
+
+	// Searches are counted per replica.
+	throttle := middleware.NewThrottle(middleware.NewLocalLimiter(), s.config.Security.Throttle, s.logger)
+	api.Handle("/search", throttle.Limit(middleware.ThrottleSearch, http.HandlerFunc(s.searchDocumentsHandler))).Methods("POST")
+	api.Handle("/search/suggest", throttle.Limit(middleware.ThrottleSearch, http.HandlerFunc(s.suggestHandler))).Methods("GET")
+
+	router.PathPrefix(webdavPath).HandlerFunc(s.webdavHandler)
+	router.HandleFunc(downloadPath+"{token}", s.redeemDownloadHandler).Methods("GET", "HEAD")
 
-	api.HandleFunc("/search", s.searchDocumentsHandler).Methods("POST")
-	api.HandleFunc("/search/suggest", s.suggestHandler).Methods("GET")
+	sign := router.PathPrefix(signingPath).Subrouter()
+	sign.HandleFunc("/{token}", s.signingInvitationHandler).Methods("GET")
+	sign.HandleFunc("/{token}/document", s.signingDocumentHandler).Methods("GET")
+	sign.HandleFunc("/{token}/sign", s.signHandler).Methods("POST")
+	sign.HandleFunc("/{token}/decline", s.declineHandler).Methods("POST")
 }
 
 func (s *Service) healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -292,47 +632,60 @@ func (s *Service) readyHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Service) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte("# Prometheus metrics endpoint\n"))
-}
-
 func (s *Service) initiateUploadHandler(w http.ResponseWriter, r *http.Request) {
 	var req UploadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if _, _, err := mime.ParseMediaType(req.ContentType); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "A valid contentType is required")
+		return
+	}
+	if req.Size <= 0 || req.Size > s.config.MaxFileSize {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest,
+			fmt.Sprintf("size must be between 1 and %d bytes", s.config.MaxFileSize))
 		return
 	}
 
 	tenantID := getTenantID(r)
+	if err := s.checkQuota(r.Context(), tenantID, middleware.GetUserID(r.Context()), req.Size, 1); err != nil {
+		s.writeQuotaError(w, r, err)
+		return
+	}
 	docID := uuid.New()
 	objectKey := s.generateObjectKey(tenantID, req.Type, docID)
+	expiry := s.config.Presign.UploadExpiryFor(tenantID.String())
 
 	presignedURL, err := s.storage.GetPresignedUploadURL(
 		r.Context(),
 		tenantID.String(),
 		objectKey,
-		r.Header.Get("Content-Type"),
-		s.config.PresignedExpiry,
+		req.ContentType,
+		req.Size,
+		expiry,
 	)
 	if err != nil {
 		s.logger.Error("Failed to generate presigned URL", "error", err)
-		http.Error(w, "Failed to generate upload URL", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to generate upload URL")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(UploadResponse{
-		DocumentID:   docID,
-		PresignedURL: presignedURL,
-		ObjectKey:    objectKey,
+		DocumentID:      docID,
+		PresignedURL:    presignedURL,
+		ObjectKey:       objectKey,
+		RequiredHeaders: domain.UploadHeaders(req.ContentType, req.Size),
+		ExpiresAt:       time.Now().Add(expiry).UTC(),
 	})
 }
 
 func (s *Service) createDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	var doc domain.Document
 	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
@@ -341,12 +694,30 @@ func (s *Service) createDocumentHandler(w http.ResponseWriter, r *http.Request)
 	doc.CreatedAt = time.Now()
 	doc.UpdatedAt = time.Now()
 	doc.ProcessingStatus = domain.ProcessingStatusPending
+	doc.Version = 1
+
+	// Blobs are shared by reference; a document only comes to point at one
+	// by its content being stored.
+	if domain.IsBlobKey(doc.ObjectKey) {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Object key names a shared blob")
+		return
+	}
+	s.adoptContent(r.Context(), &doc)
+	doc.Renditions = nil
+	queued := s.queueRenditions(&doc)
 
 	if err := s.repo.Create(r.Context(), &doc); err != nil {
 		s.logger.Error("Failed to create document", "error", err)
-		http.Error(w, "Failed to create document", http.StatusInternalServerError)
+		if domain.IsBlobKey(doc.ObjectKey) {
+			s.releaseContent(r.Context(), doc.TenantID, doc.Bucket, doc.ObjectKey)
+		}
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create document")
 		return
 	}
+	if queued {
+		s.renderSoon()
+	}
+	s.processSoon()
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -354,12 +725,24 @@ func (s *Service) createDocumentHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *Service) listDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	s.listDocuments(w, r, false)
+}
+
+// listTrashHandler lists the tenant's deleted documents, most recently
+// deleted first.
+func (s *Service) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	s.listDocuments(w, r, true)
+}
+
+func (s *Service) listDocuments(w http.ResponseWriter, r *http.Request, deleted bool) {
 	tenantID := getTenantID(r)
 
 	filter := domain.DocumentFilter{
 		TenantID: tenantID,
 		Page:     1,
 		PageSize: 20,
+		Cursor:   r.URL.Query().Get("cursor"),
+		Deleted:  deleted,
 	}
 
 	if docType := r.URL.Query().Get("type"); docType != "" {
@@ -370,19 +753,29 @@ func (s *Service) listDocumentsHandler(w http.ResponseWriter, r *http.Request) {
 		filter.Status = domain.ProcessingStatus(status)
 	}
 
-	docs, total, err := s.repo.List(r.Context(), filter)
+	// Documents about a client, order or invoice, such as those generated
+	// for it.
+	filter.EntityType = r.URL.Query().Get("entityType")
+	filter.EntityID = r.URL.Query().Get("entityId")
+
+	page, err := s.repo.List(r.Context(), filter)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		httpresponse.Error(w, r, err)
+		return
+	}
 	if err != nil {
 		s.logger.Error("Failed to list documents", "error", err)
-		http.Error(w, "Failed to list documents", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to list documents")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"documents": docs,
-		"total":     total,
-		"page":      filter.Page,
-		"pageSize":  filter.PageSize,
+		"documents":  page.Documents,
+		"total":      page.Total,
+		"page":       filter.Page,
+		"pageSize":   filter.PageSize,
+		"nextCursor": page.NextCursor,
 	})
 }
 
@@ -393,14 +786,15 @@ func (s *Service) getDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Document not found", http.StatusNotFound)
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
 			return
 		}
 		s.logger.Error("Failed to get document", "error", err)
-		http.Error(w, "Failed to get document", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
 		return
 	}
 
+	httpresponse.SetETag(w, doc.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(doc)
 }
@@ -411,18 +805,22 @@ func (s *Service) updateDocumentHandler(w http.ResponseWriter, r *http.Request)
 
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Document not found", http.StatusNotFound)
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
 			return
 		}
 		s.logger.Error("Failed to get document", "error", err)
-		http.Error(w, "Failed to get document", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
+		return
+	}
+	if err := checkVersion(r, doc); err != nil {
+		httpresponse.Error(w, r, err)
 		return
 	}
 
@@ -435,15 +833,22 @@ func (s *Service) updateDocumentHandler(w http.ResponseWriter, r *http.Request)
 	doc.UpdatedAt = time.Now()
 
 	if err := s.repo.Update(r.Context(), doc); err != nil {
+		if errors.Is(err, repository.ErrConcurrencyConflict) {
+			httpresponse.Error(w, r, apperr.VersionConflict("document", doc.Version, 0))
+			return
+		}
 		s.logger.Error("Failed to update document", "error", err)
-		http.Error(w, "Failed to update document", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to update document")
 		return
 	}
 
+	httpresponse.SetETag(w, doc.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(doc)
 }
 
+// deleteDocumentHandler moves a document to the trash. The stored object is
+// kept until the purge job removes the document for good.
 func (s *Service) deleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	tenantID := getTenantID(r)
 	docID := getIDParam(r)
@@ -451,21 +856,25 @@ func (s *Service) deleteDocumentHandler(w http.ResponseWriter, r *http.Request)
 	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Document not found", http.StatusNotFound)
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
 			return
 		}
 		s.logger.Error("Failed to get document", "error", err)
-		http.Error(w, "Failed to get document", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
 		return
 	}
-
-	if err := s.storage.Delete(r.Context(), doc.Bucket, doc.ObjectKey); err != nil {
-		s.logger.Error("Failed to delete from storage", "error", err)
+	if err := checkVersion(r, doc); err != nil {
+		httpresponse.Error(w, r, err)
+		return
 	}
 
-	if err := s.repo.Delete(r.Context(), tenantID, docID); err != nil {
+	if err := s.repo.SoftDelete(r.Context(), tenantID, docID, middleware.GetUserID(r.Context())); err != nil {
+		if err == domain.ErrDocumentNotFound {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+			return
+		}
 		s.logger.Error("Failed to delete document", "error", err)
-		http.Error(w, "Failed to delete document", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to delete document")
 		return
 	}
 
@@ -474,83 +883,134 @@ func (s *Service) deleteDocumentHandler(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Service) downloadDocumentHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Service) restoreDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	tenantID := getTenantID(r)
 	docID := getIDParam(r)
 
-	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
+	doc, err := s.repo.Restore(r.Context(), tenantID, docID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Document not found", http.StatusNotFound)
+		if err == domain.ErrDocumentNotFound {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found in trash")
 			return
 		}
-		s.logger.Error("Failed to get document", "error", err)
-		http.Error(w, "Failed to get document", http.StatusInternalServerError)
+		s.logger.Error("Failed to restore document", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to restore document")
 		return
 	}
 
-	data, err := s.storage.Download(r.Context(), doc.Bucket, doc.ObjectKey)
+	if err := s.search.IndexDocument(r.Context(), doc); err != nil {
+		s.logger.Error("Failed to reindex restored document", "error", err)
+	}
+
+	httpresponse.SetETag(w, doc.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// purgeDocuments permanently removes trashed documents matching filter
+// together with their stored objects. A document whose object cannot be
+// removed is kept and retried on the next run.
+func (s *Service) purgeDocuments(ctx context.Context, filter bson.M) (int, error) {
+	docs, err := s.docs.FindDeleted(ctx, filter)
 	if err != nil {
-		s.logger.Error("Failed to download document", "error", err)
-		http.Error(w, "Failed to download document", http.StatusInternalServerError)
-		return
+		return 0, err
 	}
 
-	w.Header().Set("Content-Type", doc.MimeType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", doc.FileName))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", doc.Size))
-	w.Write(data)
+	purged := 0
+	for _, doc := range docs {
+		if err := s.releaseContent(ctx, doc.TenantID, s.contentBucket(&doc), doc.ObjectKey); err != nil {
+			s.logger.Error("Failed to delete from storage", "document_id", doc.ID, "error", err)
+			continue
+		}
+		if doc.ThumbnailKey != "" {
+			s.storage.Delete(ctx, doc.Bucket, doc.ThumbnailKey)
+		}
+		s.deleteRenditions(ctx, doc.Bucket, doc.Renditions)
+		if err := s.repo.Delete(ctx, doc.TenantID, doc.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
 }
 
-func (s *Service) getThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Service) downloadDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	tenantID := getTenantID(r)
 	docID := getIDParam(r)
 
+	if !rbac.Allows(middleware.GetPermissions(r.Context()), permissionDocumentRead) {
+		httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+permissionDocumentRead)
+		return
+	}
 	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
 	if err != nil {
-		http.Error(w, "Document not found", http.StatusNotFound)
+		if err == mongo.ErrNoDocuments {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+			return
+		}
+		s.logger.Error("Failed to get document", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
 		return
 	}
 
-	if doc.ThumbnailKey == "" {
-		http.Error(w, "No thumbnail available", http.StatusNotFound)
+	content, err := s.openContent(r.Context(), doc)
+	if errors.Is(err, domain.ErrDocumentArchived) {
+		writeRestoring(w, doc)
 		return
 	}
-
-	data, err := s.storage.Download(r.Context(), doc.Bucket, doc.ThumbnailKey)
 	if err != nil {
-		http.Error(w, "Failed to get thumbnail", http.StatusInternalServerError)
+		s.logger.Error("Failed to download document", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to download document")
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
-	w.Write(data)
+	w.Header().Set("Content-Type", doc.MimeType)
+	w.Header().Set("Content-Disposition", attachment(doc.FileName))
+	if doc.Checksum != "" {
+		w.Header().Set("ETag", strconv.Quote(doc.Checksum))
+	}
+	serveContent(w, r, doc.UpdatedAt, doc.Size, content)
 }
 
-func (s *Service) getPresignedURLHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Service) getThumbnailHandler(w http.ResponseWriter, r *http.Request) {
 	tenantID := getTenantID(r)
 	docID := getIDParam(r)
 
 	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
 	if err != nil {
-		http.Error(w, "Document not found", http.StatusNotFound)
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
 		return
 	}
 
-	downloadURL, err := s.storage.GetPresignedDownloadURL(
-		r.Context(),
-		doc.Bucket,
-		doc.ObjectKey,
-		15*time.Minute,
-	)
+	if rendition := doc.Rendition(thumbnailRendition); rendition != nil {
+		s.serveRendition(w, r, doc, rendition)
+		return
+	}
+	// PDFs, and images without a thumbnail rendition, have the JPEG
+	// thumbnail the processor stores.
+	if doc.ThumbnailKey == "" {
+		switch doc.ProcessingStatus {
+		case domain.ProcessingStatusPending, domain.ProcessingStatusProcessing:
+			w.Header().Set("Retry-After", "5")
+			httpresponse.ErrorStatus(w, r, http.StatusConflict, "Document is still being processed")
+		default:
+			if doc.RenditionStatus == domain.ProcessingStatusPending {
+				writeRenditionMissing(w, r, doc)
+				return
+			}
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "No thumbnail available")
+		}
+		return
+	}
+
+	data, err := s.storage.Download(r.Context(), doc.Bucket, doc.ThumbnailKey)
 	if err != nil {
-		s.logger.Error("Failed to generate presigned URL", "error", err)
-		http.Error(w, "Failed to generate URL", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get thumbnail")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"url": downloadURL})
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(data)
 }
 
 func (s *Service) updateTagsHandler(w http.ResponseWriter, r *http.Request) {
@@ -561,13 +1021,17 @@ func (s *Service) updateTagsHandler(w http.ResponseWriter, r *http.Request) {
 		Tags []string `json:"tags"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
 	if err != nil {
-		http.Error(w, "Document not found", http.StatusNotFound)
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+		return
+	}
+	if err := checkVersion(r, doc); err != nil {
+		httpresponse.Error(w, r, err)
 		return
 	}
 
@@ -575,11 +1039,16 @@ func (s *Service) updateTagsHandler(w http.ResponseWriter, r *http.Request) {
 	doc.UpdatedAt = time.Now()
 
 	if err := s.repo.Update(r.Context(), doc); err != nil {
+		if errors.Is(err, repository.ErrConcurrencyConflict) {
+			httpresponse.Error(w, r, apperr.VersionConflict("document", doc.Version, 0))
+			return
+		}
 		s.logger.Error("Failed to update tags", "error", err)
-		http.Error(w, "Failed to update tags", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to update tags")
 		return
 	}
 
+	httpresponse.SetETag(w, doc.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(doc)
 }
@@ -590,18 +1059,23 @@ func (s *Service) reprocessHandler(w http.ResponseWriter, r *http.Request) {
 
 	doc, err := s.repo.GetByID(r.Context(), tenantID, docID)
 	if err != nil {
-		http.Error(w, "Document not found", http.StatusNotFound)
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
 		return
 	}
 
 	doc.ProcessingStatus = domain.ProcessingStatusPending
 	doc.UpdatedAt = time.Now()
+	queued := s.queueRenditions(doc)
 
 	if err := s.repo.Update(r.Context(), doc); err != nil {
 		s.logger.Error("Failed to reprocess document", "error", err)
-		http.Error(w, "Failed to reprocess document", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to reprocess document")
 		return
 	}
+	if queued {
+		s.renderSoon()
+	}
+	s.processSoon()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "queued"})
@@ -610,7 +1084,7 @@ func (s *Service) reprocessHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Service) searchDocumentsHandler(w http.ResponseWriter, r *http.Request) {
 	var req SearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
@@ -633,7 +1107,7 @@ func (s *Service) searchDocumentsHandler(w http.ResponseWriter, r *http.Request)
 	results, err := s.search.Search(r.Context(), tenantID, req.Query, filters)
 	if err != nil {
 		s.logger.Error("Search failed", "error", err)
-		http.Error(w, "Search failed", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Search failed")
 		return
 	}
 
@@ -653,7 +1127,7 @@ func (s *Service) suggestHandler(w http.ResponseWriter, r *http.Request) {
 	suggestions, err := s.search.Suggest(r.Context(), tenantID, prefix)
 	if err != nil {
 		s.logger.Error("Suggest failed", "error", err)
-		http.Error(w, "Suggest failed", http.StatusInternalServerError)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Suggest failed")
 		return
 	}
 
@@ -661,18 +1135,6 @@ func (s *Service) suggestHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string][]string{"suggestions": suggestions})
 }
 
-func (s *Service) startMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotImplemented)
-}
-
-func (s *Service) uploadPartHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotImplemented)
-}
-
-func (s *Service) completeMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotImplemented)
-}
-
 func (s *Service) generateObjectKey(tenantID uuid.UUID, docType string, docID uuid.UUID) string {
 	now := time.Now()
 	return fmt.Sprintf("%s/%s/%s/%s/%s",
@@ -689,8 +1151,19 @@ func calculateChecksum(data []byte) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// checkVersion reports a version conflict when the request's If-Match names
+// a version of doc other than the current one.
+func checkVersion(r *http.Request, doc *domain.Document) error {
+	expected, ok := httpresponse.ParseETag(r.Header.Get("If-Match"))
+	if ok && expected != doc.Version {
+		return apperr.VersionConflict("document", expected, doc.Version)
+	}
+	return nil
+}
+
 func getTenantID(r *http.Request) uuid.UUID {
-	return uuid.MustParse(r.Header.Get("X-Tenant-ID"))
+	tenantID, _ := uuid.Parse(middleware.GetTenantID(r.Context()))
+	return tenantID
 }
 
 func getIDParam(r *http.Request) uuid.UUID {
@@ -698,38 +1171,6 @@ func getIDParam(r *http.Request) uuid.UUID {
 	return uuid.MustParse(vars["id"])
 }
 
-func loggerMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		fmt.Printf("%s %s %s\n", r.Method, r.URL.Path, time.Since(start))
-	})
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Tenant-ID, X-Request-ID")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
-func requestIDMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := r.Header.Get("X-Request-ID")
-		if requestID == "" {
-			requestID = uuid.New().String()
-		}
-		w.Header().Set("X-Request-ID", requestID)
-		next.ServeHTTP(w, r)
-	})
-}
-
 type MongoDocumentRepository struct {
 	collection *mongo.Collection
 }
@@ -747,22 +1188,121 @@ func (r *MongoDocumentRepository) Create(ctx context.Context, doc *domain.Docume
 
 func (r *MongoDocumentRepository) GetByID(ctx context.Context, tenantID, id uuid.UUID) (*domain.Document, error) {
 	var doc domain.Document
-	err := r.collection.FindOne(ctx, bson.M{
+	err := r.collection.FindOne(ctx, repository.NotDeleted(bson.M{
 		"_id":      id,
 		"tenantId": tenantID,
-	}).Decode(&doc)
+	})).Decode(&doc)
 	if err != nil {
 		return nil, err
 	}
 	return &doc, nil
 }
 
+// Update replaces doc if nobody else has changed it since it was read, and
+// advances its version. It reports repository.ErrConcurrencyConflict when
+// the stored document has moved on.
 func (r *MongoDocumentRepository) Update(ctx context.Context, doc *domain.Document) error {
-	_, err := r.collection.ReplaceOne(ctx, bson.M{
+	filter := bson.M{
 		"_id":      doc.ID,
 		"tenantId": doc.TenantID,
-	}, doc)
-	return err
+		"version":  doc.Version,
+	}
+	if doc.Version == 0 {
+		// Documents stored before versions were tracked have none.
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	next := *doc
+	next.Version++
+	result, err := r.collection.ReplaceOne(ctx, filter, &next)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrConcurrencyConflict
+	}
+	doc.Version++
+	return nil
+}
+
+func (r *MongoDocumentRepository) SoftDelete(ctx context.Context, tenantID, id uuid.UUID, deletedBy string) error {
+	var trashed domain.SoftDelete
+	trashed.MarkDeleted(deletedBy, time.Now())
+
+	result, err := r.collection.UpdateOne(ctx, repository.NotDeleted(bson.M{
+		"_id":      id,
+		"tenantId": tenantID,
+	}), bson.M{
+		"$set": bson.M{
+			repository.DeletedAtField: trashed.DeletedAt,
+			repository.DeletedByField: trashed.DeletedBy,
+			"updatedAt":               *trashed.DeletedAt,
+		},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrDocumentNotFound
+	}
+	return nil
+}
+
+func (r *MongoDocumentRepository) Restore(ctx context.Context, tenantID, id uuid.UUID) (*domain.Document, error) {
+	var doc domain.Document
+	err := r.collection.FindOneAndUpdate(ctx, repository.OnlyDeleted(bson.M{
+		"_id":      id,
+		"tenantId": tenantID,
+	}), bson.M{
+		"$unset": bson.M{repository.DeletedAtField: "", repository.DeletedByField: ""},
+		"$set":   bson.M{"updatedAt": time.Now().UTC()},
+		"$inc":   bson.M{"version": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// FindDeleted returns trashed documents matching filter, oldest deletion
+// first, for the purge job.
+func (r *MongoDocumentRepository) FindDeleted(ctx context.Context, filter bson.M) ([]domain.Document, error) {
+	cursor, err := r.collection.Find(ctx, repository.OnlyDeleted(filter),
+		options.Find().SetSort(bson.D{{Key: repository.DeletedAtField, Value: 1}}).SetLimit(500))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []domain.Document
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// ListFolder returns the tenant's live documents of docType, oldest first,
+// without their extracted text.
+func (r *MongoDocumentRepository) ListFolder(ctx context.Context, tenantID uuid.UUID, docType domain.DocumentType) ([]domain.Document, error) {
+	cursor, err := r.collection.Find(ctx,
+		repository.NotDeleted(bson.M{"tenantId": tenantID, "type": docType}),
+		options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+			SetProjection(bson.M{"extractedText": 0}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []domain.Document
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
 }
 
 func (r *MongoDocumentRepository) Delete(ctx context.Context, tenantID, id uuid.UUID) error {
@@ -773,44 +1313,74 @@ func (r *MongoDocumentRepository) Delete(ctx context.Context, tenantID, id uuid.
 	return err
 }
 
-func (r *MongoDocumentRepository) List(ctx context.Context, filter domain.DocumentFilter) ([]domain.Document, int64, error) {
+func (r *MongoDocumentRepository) List(ctx context.Context, filter domain.DocumentFilter) (*domain.DocumentPage, error) {
 	filterCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	query := bson.M{"tenantId": filter.TenantID}
+	sort := pagination.NewSort("createdAt", "desc")
+	if filter.Deleted {
+		repository.OnlyDeleted(query)
+		sort = pagination.NewSort(repository.DeletedAtField, "desc")
+	} else {
+		repository.NotDeleted(query)
+	}
 	if filter.Type != "" {
 		query["type"] = filter.Type
 	}
 	if filter.Status != "" {
 		query["processingStatus"] = filter.Status
 	}
+	if filter.EntityType != "" {
+		query["entityType"] = filter.EntityType
+	}
+	if filter.EntityID != "" {
+		query["entityId"] = filter.EntityID
+	}
+
+	total, _ := r.collection.CountDocuments(ctx, query)
 
 	opts := options.Find().
-		SetSkip(int64((filter.Page - 1) * filter.PageSize)).
-		SetLimit(int64(filter.PageSize)).
-		SetSort(bson.D{{Key: "createdAt", Value: -1}})
+		SetLimit(int64(filter.PageSize + 1)).
+		SetSort(sort.Keys())
+	if filter.Cursor != "" {
+		if err := sort.After(query, filter.Cursor); err != nil {
+			return nil, err
+		}
+	} else {
+		opts.SetSkip(int64((filter.Page - 1) * filter.PageSize))
+	}
 
 	cursor, err := r.collection.Find(filterCtx, query, opts)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer cursor.Close(filterCtx)
 
 	var docs []domain.Document
 	if err := cursor.All(filterCtx, &docs); err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	total, _ := r.collection.CountDocuments(ctx, query)
-	return docs, total, nil
+	page := &domain.DocumentPage{Documents: docs, Total: total}
+	if len(docs) > filter.PageSize {
+		page.Documents = docs[:filter.PageSize]
+		last := page.Documents[filter.PageSize-1]
+		if filter.Deleted {
+			page.NextCursor = sort.Cursor(last.DeletedAt, last.ID)
+		} else {
+			page.NextCursor = sort.Cursor(last.CreatedAt, last.ID)
+		}
+	}
+	return page, nil
 }
 
 func (r *MongoDocumentRepository) GetByChecksum(ctx context.Context, tenantID uuid.UUID, checksum string) (*domain.Document, error) {
 	var doc domain.Document
-	err := r.collection.FindOne(ctx, bson.M{
+	err := r.collection.FindOne(ctx, repository.NotDeleted(bson.M{
 		"checksum": checksum,
 		"tenantId": tenantID,
-	}).Decode(&doc)
+	})).Decode(&doc)
 	if err != nil {
 		return nil, err
 	}
@@ -832,6 +1402,22 @@ func (s *MinIOStorageService) Upload(ctx context.Context, bucket, objectKey stri
 	return err
 }
 
+// UploadClass uploads an object in storageClass, the bucket's default when
+// empty.
+func (s *MinIOStorageService) UploadClass(ctx context.Context, bucket, objectKey string, data []byte, contentType, storageClass string) error {
+	_, err := s.client.PutObject(ctx, bucket, objectKey, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType, StorageClass: storageClass})
+	return err
+}
+
+// RequestRestore asks for an object in a cold storage class to be made
+// readable for a day, long enough to copy it back.
+func (s *MinIOStorageService) RequestRestore(ctx context.Context, bucket, objectKey string) error {
+	var req minio.RestoreRequest
+	req.SetDays(1)
+	return s.client.RestoreObject(ctx, bucket, objectKey, "", req)
+}
+
 func (s *MinIOStorageService) Download(ctx context.Context, bucket, objectKey string) ([]byte, error) {
 	obj, err := s.client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
 	if err != nil {
@@ -841,12 +1427,31 @@ func (s *MinIOStorageService) Download(ctx context.Context, bucket, objectKey st
 	return io.ReadAll(obj)
 }
 
+// DownloadStream opens an object for reading. The object also seeks,
+// reading from the offset it seeks to.
+func (s *MinIOStorageService) DownloadStream(ctx context.Context, bucket, objectKey string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy: a missing object fails on Stat, not here.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return obj, nil
+}
+
 func (s *MinIOStorageService) Delete(ctx context.Context, bucket, objectKey string) error {
 	return s.client.RemoveObject(ctx, bucket, objectKey, minio.RemoveObjectOptions{})
 }
 
-func (s *MinIOStorageService) GetPresignedUploadURL(ctx context.Context, bucket, objectKey, contentType string, expiry time.Duration) (string, error) {
-	url, err := s.client.PresignedPutObject(ctx, bucket, objectKey, expiry)
+func (s *MinIOStorageService) GetPresignedUploadURL(ctx context.Context, bucket, objectKey, contentType string, size int64, expiry time.Duration) (string, error) {
+	headers := make(http.Header)
+	for name, value := range domain.UploadHeaders(contentType, size) {
+		headers.Set(name, value)
+	}
+	url, err := s.client.PresignHeader(ctx, http.MethodPut, bucket, objectKey, expiry, nil, headers)
 	if err != nil {
 		return "", err
 	}
@@ -883,36 +1488,6 @@ func (r *byteReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
-type ProcessingService struct{}
-
-func NewProcessingService() *ProcessingService {
-	return &ProcessingService{}
-}
-
-func (s *ProcessingService) ProcessDocument(ctx context.Context, doc *domain.Document, data []byte) (*domain.Document, error) {
-	text, err := s.ExtractText(ctx, data, doc.MimeType)
-	if err != nil {
-		doc.ProcessingStatus = domain.ProcessingStatusFailed
-		return doc, err
-	}
-	doc.ExtractedText = text
-	doc.ExtractedMetadata = s.ExtractMetadata(ctx, doc.Type, text)
-	doc.ProcessingStatus = domain.ProcessingStatusCompleted
-	return doc, nil
-}
-
-func (s *ProcessingService) ExtractText(ctx context.Context, data []byte, mimeType string) (string, error) {
-	return "", nil
-}
-
-func (s *ProcessingService) ExtractMetadata(ctx context.Context, docType domain.DocumentType, text string) domain.DocumentMetadata {
-	return domain.DocumentMetadata{}
-}
-
-func (s *ProcessingService) GenerateThumbnail(ctx context.Context, data []byte, mimeType string) ([]byte, error) {
-	return nil, nil
-}
-
 type ElasticsearchService struct {
 	client *http.Client
 	url    string
@@ -942,6 +1517,79 @@ func main() {
 	cfg := NewConfig()
 	cfg.ServicePort = 8086
 
+	// Only the trash, security, notification, presign, quota, messaging,
+	// image, numbering and locale settings and the ERP database come from
+	// the shared configuration, so tenant retention, link expiry and quota
+	// overrides, allowed origins, the email provider signing invitations
+	// are sent with, image renditions and delivery note numbers can be set
+	// in document-service.yaml.
+	shared, err := config.Load("", cfg.ServiceName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.Trash = shared.Trash
+	cfg.Security = shared.Security
+	cfg.Notifications = shared.Notifications
+	cfg.Presign = shared.Presign
+	cfg.StorageQuotas = shared.StorageQuotas
+	cfg.Images = shared.Images
+	cfg.NATS = shared.NATS
+	cfg.Messaging = shared.Messaging
+	cfg.Numbering = shared.Numbering
+	cfg.I18n = shared.I18n
+	if shared.MongoDB.Database != "" {
+		cfg.ERPDatabase = shared.MongoDB.Database
+	}
+	if interval, err := time.ParseDuration(os.Getenv("STORAGE_USAGE_INTERVAL")); err == nil && interval > 0 {
+		cfg.StorageUsageInterval = interval
+	}
+	if expiry, err := time.ParseDuration(os.Getenv("TUS_UPLOAD_EXPIRY")); err == nil && expiry > 0 {
+		cfg.TusUploadExpiry = expiry
+	}
+	if interval, err := time.ParseDuration(os.Getenv("TUS_CLEANUP_INTERVAL")); err == nil && interval > 0 {
+		cfg.TusCleanupInterval = interval
+	}
+	if size, err := strconv.ParseInt(os.Getenv("MULTIPART_MAX_SIZE"), 10, 64); err == nil && size > 0 {
+		cfg.MultipartMaxSize = size
+	}
+	if expiry, err := time.ParseDuration(os.Getenv("MULTIPART_UPLOAD_EXPIRY")); err == nil && expiry > 0 {
+		cfg.MultipartUploadExpiry = expiry
+	}
+	if interval, err := time.ParseDuration(os.Getenv("MULTIPART_CLEANUP_INTERVAL")); err == nil && interval > 0 {
+		cfg.MultipartCleanupInterval = interval
+	}
+	if interval, err := time.ParseDuration(os.Getenv("RENDER_INTERVAL")); err == nil && interval > 0 {
+		cfg.RenderInterval = interval
+	}
+	if interval, err := time.ParseDuration(os.Getenv("PROCESS_INTERVAL")); err == nil && interval > 0 {
+		cfg.ProcessInterval = interval
+	}
+	if interval, err := time.ParseDuration(os.Getenv("TIERING_INTERVAL")); err == nil && interval > 0 {
+		cfg.TieringInterval = interval
+	}
+	if suffix := os.Getenv("ARCHIVE_BUCKET_SUFFIX"); suffix != "" {
+		cfg.ArchiveBucketSuffix = suffix
+	}
+	if price, err := decimal.NewFromString(os.Getenv("STORAGE_COST_HOT")); err == nil {
+		cfg.StorageCostHot = price
+	}
+	if price, err := decimal.NewFromString(os.Getenv("STORAGE_COST_ARCHIVE")); err == nil {
+		cfg.StorageCostArchive = price
+	}
+	if currency := os.Getenv("STORAGE_COST_CURRENCY"); currency != "" {
+		cfg.StorageCostCurrency = currency
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("SIGNING_INVITATION_TTL")); err == nil && ttl > 0 {
+		cfg.SigningInvitationTTL = ttl
+	}
+	if grace, err := time.ParseDuration(os.Getenv("CAS_GRACE_PERIOD")); err == nil && grace >= 0 {
+		cfg.CASGracePeriod = grace
+	}
+	if interval, err := time.ParseDuration(os.Getenv("CAS_GC_INTERVAL")); err == nil && interval > 0 {
+		cfg.CASCollectInterval = interval
+	}
+
 	svc, err := NewService(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create service: %v\n", err)
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// multipartStorage uploads an object in numbered parts, which storage
+// joins into it once they have all arrived.
+type multipartStorage interface {
+	StartMultipart(ctx context.Context, bucket, objectKey, contentType string) (string, error)
+	// UploadPart stores size bytes of data as the part numbered number,
+	// and returns its ETag.
+	UploadPart(ctx context.Context, bucket, objectKey, uploadID string, number int, data io.Reader, size int64) (string, error)
+	CompleteMultipart(ctx context.Context, bucket, objectKey, uploadID string, parts []domain.MultipartPart) error
+	AbortMultipart(ctx context.Context, bucket, objectKey, uploadID string) error
+	ObjectSize(ctx context.Context, bucket, objectKey string) (int64, error)
+}
+
+// MultipartUploadRequest starts a multipart upload of a file of Size
+// bytes, which may be larger than MaxFileSize.
+type MultipartUploadRequest struct {
+	Type        string   `json:"type"`
+	FileName    string   `json:"fileName"`
+	ContentType string   `json:"contentType"`
+	Size        int64    `json:"size"`
+	Tags        []string `json:"tags"`
+}
+
+type MultipartUploadResponse struct {
+	UploadID    uuid.UUID `json:"uploadId"`
+	DocumentID  uuid.UUID `json:"documentId"`
+	MinPartSize int64     `json:"minPartSize"`
+	MaxPartSize int64     `json:"maxPartSize"`
+	MaxParts    int       `json:"maxParts"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// startMultipartUploadHandler starts a multipart upload, whose parts are
+// then sent to uploadPartHandler.
+func (s *Service) startMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var req MultipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, _, err := mime.ParseMediaType(req.ContentType); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "A valid contentType is required")
+		return
+	}
+	if req.Size <= 0 || req.Size > s.config.MultipartMaxSize {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest,
+			fmt.Sprintf("size must be between 1 and %d bytes", s.config.MultipartMaxSize))
+		return
+	}
+
+	ctx := r.Context()
+	tenantID := getTenantID(r)
+	userID := middleware.GetUserID(ctx)
+	if err := s.checkQuota(ctx, tenantID, userID, req.Size, 1); err != nil {
+		s.writeQuotaError(w, r, err)
+		return
+	}
+	bucket := tenantID.String()
+	if err := s.ensureBucket(ctx, bucket); err != nil {
+		s.logger.Error("Failed to create bucket", "bucket", bucket, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+
+	docType := domain.DocumentType(req.Type)
+	if docType == "" {
+		docType = domain.DocTypeOther
+	}
+	now := time.Now()
+	upload := &domain.MultipartUpload{
+		ID:         uuid.New(),
+		TenantID:   tenantID,
+		UserID:     userID,
+		DocumentID: uuid.New(),
+		Type:       docType,
+		FileName:   path.Base("/" + req.FileName),
+		MimeType:   req.ContentType,
+		Tags:       req.Tags,
+		Size:       req.Size,
+		Bucket:     bucket,
+		Parts:      []domain.MultipartPart{},
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.config.MultipartUploadExpiry),
+	}
+	if upload.FileName == "/" {
+		upload.FileName = upload.DocumentID.String()
+	}
+	upload.ObjectKey = s.generateObjectKey(tenantID, string(docType), upload.DocumentID)
+
+	storageUploadID, err := s.multipart.StartMultipart(ctx, bucket, upload.ObjectKey, upload.MimeType)
+	if err != nil {
+		s.logger.Error("Failed to start multipart upload", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+	upload.StorageUploadID = storageUploadID
+	if err := s.multipartUploads.Create(ctx, upload); err != nil {
+		s.logger.Error("Failed to create multipart upload", "error", err)
+		s.multipart.AbortMultipart(ctx, bucket, upload.ObjectKey, storageUploadID)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+
+	s.logger.Info("Multipart upload started", "upload_id", upload.ID, "tenant_id", tenantID, "size", upload.Size)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MultipartUploadResponse{
+		UploadID:    upload.ID,
+		DocumentID:  upload.DocumentID,
+		MinPartSize: domain.MinMultipartPartSize,
+		MaxPartSize: s.config.MaxFileSize,
+		MaxParts:    domain.MaxMultipartParts,
+		ExpiresAt:   upload.ExpiresAt.UTC(),
+	})
+}
+
+// getMultipartUploadHandler returns an upload with the parts received of
+// it, so a client can send again only those that did not arrive.
+func (s *Service) getMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := s.loadMultipartUpload(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(upload)
+}
+
+// uploadPartHandler stores the request body as the part numbered
+// ?partNumber= of an upload, replacing any part of that number sent
+// before. Each part may be up to MaxFileSize bytes.
+func (s *Service) uploadPartHandler(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil {
+		writeMultipartError(w, r, domain.ErrInvalidPartNumber)
+		return
+	}
+	if r.ContentLength > s.config.MaxFileSize {
+		httpresponse.ErrorStatus(w, r, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("A part may be at most %d bytes", s.config.MaxFileSize))
+		return
+	}
+	upload, ok := s.loadMultipartUpload(w, r)
+	if !ok {
+		return
+	}
+	if upload.CompletedAt != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusConflict, "The upload is completed")
+		return
+	}
+	// A body of unknown length, -1, cannot be streamed to storage as a
+	// part and is refused as empty.
+	if err := upload.CheckPart(number, r.ContentLength); err != nil {
+		writeMultipartError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	etag, err := s.multipart.UploadPart(ctx, upload.Bucket, upload.ObjectKey, upload.StorageUploadID, number, r.Body, r.ContentLength)
+	if err != nil {
+		s.logger.Error("Failed to store multipart upload part", "upload_id", upload.ID, "part", number, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to store part")
+		return
+	}
+	part := domain.MultipartPart{Number: number, Size: r.ContentLength, ETag: etag}
+	stored, err := s.multipartUploads.SetPart(ctx, upload.ID, part, time.Now().Add(s.config.MultipartUploadExpiry))
+	if err != nil {
+		s.logger.Error("Failed to record multipart upload part", "upload_id", upload.ID, "part", number, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to store part")
+		return
+	}
+	if !stored {
+		httpresponse.ErrorStatus(w, r, http.StatusConflict, "The upload was completed or aborted meanwhile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", strconv.Quote(etag))
+	json.NewEncoder(w).Encode(part)
+}
+
+// completeMultipartUploadHandler joins the parts of an upload into its
+// document, stored and processed like any other. Completing an upload
+// again returns its document.
+func (s *Service) completeMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := s.loadMultipartUpload(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if upload.CompletedAt != nil {
+		doc, err := s.repo.GetByID(ctx, upload.TenantID, upload.DocumentID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+				return
+			}
+			s.logger.Error("Failed to get document", "error", err)
+			httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+		return
+	}
+
+	doc, err := s.completeMultipartUpload(context.WithoutCancel(ctx), upload)
+	if err != nil {
+		var docErr *domain.DocumentError
+		if errors.As(err, &docErr) {
+			writeMultipartError(w, r, err)
+			return
+		}
+		s.logger.Error("Failed to complete multipart upload", "upload_id", upload.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create document")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// abortMultipartUploadHandler abandons an upload and removes the parts
+// received of it. A completed upload's document is not affected.
+func (s *Service) abortMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := s.loadMultipartUpload(w, r)
+	if !ok {
+		return
+	}
+	if err := s.removeMultipartUpload(r.Context(), upload); err != nil {
+		s.logger.Error("Failed to abort multipart upload", "upload_id", upload.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to abort upload")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadMultipartUpload returns the tenant's upload named in the path.
+// Expired uploads are gone.
+func (s *Service) loadMultipartUpload(w http.ResponseWriter, r *http.Request) (*domain.MultipartUpload, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["uploadId"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Upload not found")
+		return nil, false
+	}
+	upload, err := s.multipartUploads.Get(r.Context(), getTenantID(r), id)
+	if err != nil {
+		s.logger.Error("Failed to get multipart upload", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get upload")
+		return nil, false
+	}
+	if upload == nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Upload not found")
+		return nil, false
+	}
+	if upload.Expired(time.Now()) {
+		httpresponse.ErrorStatus(w, r, http.StatusGone, "Upload expired")
+		return nil, false
+	}
+	return upload, true
+}
+
+// writeMultipartError answers a request refused by the upload's parts.
+func writeMultipartError(w http.ResponseWriter, r *http.Request, err error) {
+	httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
+}
+
+// completeMultipartUpload joins the parts of a fully received upload into
+// its document and queues it for processing. The content stays where it
+// was uploaded to, so it is not content-addressed. Should creating the
+// document fail after its parts were joined, completing the upload again
+// creates it from the joined object.
+func (s *Service) completeMultipartUpload(ctx context.Context, upload *domain.MultipartUpload) (*domain.Document, error) {
+	parts, err := upload.CompletedParts()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.multipart.CompleteMultipart(ctx, upload.Bucket, upload.ObjectKey, upload.StorageUploadID, parts); err != nil {
+		if size, statErr := s.multipart.ObjectSize(ctx, upload.Bucket, upload.ObjectKey); statErr != nil || size != upload.Size {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	doc := &domain.Document{
+		ID:               upload.DocumentID,
+		TenantID:         upload.TenantID,
+		Type:             upload.Type,
+		FileName:         upload.FileName,
+		MimeType:         upload.MimeType,
+		Size:             upload.Size,
+		Bucket:           upload.Bucket,
+		ObjectKey:        upload.ObjectKey,
+		ProcessingStatus: domain.ProcessingStatusPending,
+		Tags:             upload.Tags,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Version:          1,
+	}
+	if userID, err := uuid.Parse(upload.UserID); err == nil {
+		doc.UploadedBy = userID
+	}
+	queued := s.queueRenditions(doc)
+	if err := s.repo.Create(ctx, doc); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		// Completed meanwhile by another request.
+		if doc, err = s.repo.GetByID(ctx, upload.TenantID, upload.DocumentID); err != nil {
+			return nil, err
+		}
+	} else {
+		if queued {
+			s.renderSoon()
+		}
+		s.processSoon()
+		if err := s.search.IndexDocument(ctx, doc); err != nil {
+			s.logger.Error("Failed to index document", "document_id", doc.ID, "error", err)
+		}
+		s.logger.Info("Multipart upload completed", "upload_id", upload.ID, "document_id", doc.ID,
+			"tenant_id", doc.TenantID, "parts", len(parts))
+	}
+
+	if err := s.multipartUploads.Complete(ctx, upload.ID, now); err != nil {
+		return nil, err
+	}
+	upload.CompletedAt = &now
+	return doc, nil
+}
+
+// removeMultipartUpload aborts an upload not completed yet, removing its
+// parts from storage, and deletes it.
+func (s *Service) removeMultipartUpload(ctx context.Context, upload *domain.MultipartUpload) error {
+	if upload.CompletedAt == nil {
+		err := s.multipart.AbortMultipart(ctx, upload.Bucket, upload.ObjectKey, upload.StorageUploadID)
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchUpload" {
+			return err
+		}
+	}
+	return s.multipartUploads.Delete(ctx, upload.ID)
+}
+
+// runMultipartExpiry aborts expired multipart uploads every
+// MultipartCleanupInterval until ctx is cancelled.
+func (s *Service) runMultipartExpiry(ctx context.Context) {
+	ticker := time.NewTicker(s.config.MultipartCleanupInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Multipart upload expiry started", "interval", s.config.MultipartCleanupInterval)
+
+	for {
+		if removed, err := s.expireMultipartUploads(ctx, time.Now()); err != nil {
+			s.logger.Error("Failed to expire multipart uploads", "removed", removed, "error", err)
+		} else if removed > 0 {
+			s.logger.Info("Expired multipart uploads", "removed", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Multipart upload expiry stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireMultipartUploads removes the uploads past their expiry, aborting
+// those never completed, and returns how many it removed. Completed
+// uploads are kept until then so clients can still look up their
+// document.
+func (s *Service) expireMultipartUploads(ctx context.Context, now time.Time) (int, error) {
+	uploads, err := s.multipartUploads.ExpiredBefore(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, upload := range uploads {
+		if err := s.removeMultipartUpload(ctx, upload); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// MultipartUploadStore keeps the state of multipart uploads.
+type MultipartUploadStore struct {
+	collection *mongo.Collection
+}
+
+func NewMultipartUploadStore(db *mongo.Database) *MultipartUploadStore {
+	return &MultipartUploadStore{collection: db.Collection("multipart_uploads")}
+}
+
+func (r *MultipartUploadStore) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiry"),
+	})
+	return err
+}
+
+func (r *MultipartUploadStore) Create(ctx context.Context, upload *domain.MultipartUpload) error {
+	_, err := r.collection.InsertOne(ctx, upload)
+	return err
+}
+
+// Get returns the tenant's upload, or nil if there is none.
+func (r *MultipartUploadStore) Get(ctx context.Context, tenantID, id uuid.UUID) (*domain.MultipartUpload, error) {
+	var upload domain.MultipartUpload
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&upload)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// SetPart records part as received in place of any part of its number,
+// extending the upload's expiry, and reports whether the upload was still
+// open to it.
+func (r *MultipartUploadStore) SetPart(ctx context.Context, id uuid.UUID, part domain.MultipartPart, expiresAt time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "completedAt": nil}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"parts": bson.M{"$concatArrays": bson.A{
+				bson.M{"$filter": bson.M{"input": "$parts", "cond": bson.M{"$ne": bson.A{"$$this.number", part.Number}}}},
+				bson.A{bson.M{"$literal": part}},
+			}},
+			"expiresAt": expiresAt,
+		}}},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// Complete marks an upload completed.
+func (r *MultipartUploadStore) Complete(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"completedAt": at}})
+	return err
+}
+
+// ExpiredBefore returns a batch of uploads that expired before now.
+func (r *MultipartUploadStore) ExpiredBefore(ctx context.Context, now time.Time) ([]*domain.MultipartUpload, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"expiresAt": bson.M{"$lte": now}},
+		options.Find().SetLimit(tieringBatchSize))
+	if err != nil {
+		return nil, err
+	}
+	var uploads []*domain.MultipartUpload
+	if err := cursor.All(ctx, &uploads); err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func (r *MultipartUploadStore) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (s *MinIOStorageService) StartMultipart(ctx context.Context, bucket, objectKey, contentType string) (string, error) {
+	return s.core().NewMultipartUpload(ctx, bucket, objectKey, minio.PutObjectOptions{ContentType: contentType})
+}
+
+func (s *MinIOStorageService) UploadPart(ctx context.Context, bucket, objectKey, uploadID string, number int, data io.Reader, size int64) (string, error) {
+	part, err := s.core().PutObjectPart(ctx, bucket, objectKey, uploadID, number, data, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+func (s *MinIOStorageService) CompleteMultipart(ctx context.Context, bucket, objectKey, uploadID string, parts []domain.MultipartPart) error {
+	complete := make([]minio.CompletePart, len(parts))
+	for i, part := range parts {
+		complete[i] = minio.CompletePart{PartNumber: part.Number, ETag: part.ETag}
+	}
+	_, err := s.core().CompleteMultipartUpload(ctx, bucket, objectKey, uploadID, complete, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *MinIOStorageService) AbortMultipart(ctx context.Context, bucket, objectKey, uploadID string) error {
+	return s.core().AbortMultipartUpload(ctx, bucket, objectKey, uploadID)
+}
+
+func (s *MinIOStorageService) ObjectSize(ctx context.Context, bucket, objectKey string) (int64, error) {
+	info, err := s.client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// core exposes the multipart upload calls the client makes itself when
+// putting large objects.
+func (s *MinIOStorageService) core() minio.Core {
+	return minio.Core{Client: s.client}
+}
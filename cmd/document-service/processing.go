@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+)
+
+// processingTimeout is how long a document's text may take to extract. A
+// document left processing longer, as by a replica that stopped, is
+// processed again.
+const processingTimeout = 10 * time.Minute
+
+// processSoon wakes the processor.
+func (s *Service) processSoon() {
+	select {
+	case s.processNow <- struct{}{}:
+	default:
+	}
+}
+
+// runProcessor extracts the text and metadata of documents pending
+// processing every ProcessInterval and whenever one is queued, until ctx
+// is cancelled.
+func (s *Service) runProcessor(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ProcessInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Document processor started", "interval", s.config.ProcessInterval)
+
+	for {
+		if processed, err := s.processDocuments(ctx); err != nil {
+			s.logger.Error("Failed to process documents", "processed", processed, "error", err)
+		} else if processed > 0 {
+			s.logger.Info("Processed documents", "processed", processed)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Document processor stopped")
+			return
+		case <-ticker.C:
+		case <-s.processNow:
+		}
+	}
+}
+
+// processDocuments processes the documents pending processing, and those
+// left processing past processingTimeout, and returns how many it
+// processed. Archived documents wait for their restore.
+func (s *Service) processDocuments(ctx context.Context) (int, error) {
+	docs, err := s.findDocuments(ctx, repository.NotDeleted(bson.M{
+		"$or": bson.A{
+			bson.M{"processingStatus": domain.ProcessingStatusPending},
+			bson.M{
+				"processingStatus": domain.ProcessingStatusProcessing,
+				"updatedAt":        bson.M{"$lt": time.Now().Add(-processingTimeout)},
+			},
+		},
+		"storageClass": bson.M{"$ne": domain.StorageClassArchive},
+	}))
+	if err != nil {
+		return 0, err
+	}
+	processed := 0
+	for _, doc := range docs {
+		if err := s.processDocument(ctx, doc); err != nil {
+			if !errors.Is(err, repository.ErrConcurrencyConflict) {
+				s.logger.Error("Failed to process document", "document_id", doc.ID, "error", err)
+			}
+			continue
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// processDocument claims doc by marking it processing, so other replicas
+// leave it, then stores the thumbnail of an image or PDF, extracts its
+// text and metadata and marks it completed, or failed, keeping the
+// thumbnail, when its text cannot be read. A file of a format nothing
+// reads text from is completed without text. A document changed
+// meanwhile is left to the next pass, and one whose content could not be
+// downloaded to the pass after processingTimeout.
+func (s *Service) processDocument(ctx context.Context, doc *domain.Document) error {
+	doc.ProcessingStatus = domain.ProcessingStatusProcessing
+	doc.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, doc); err != nil {
+		return err
+	}
+
+	extractCtx, cancel := context.WithTimeout(ctx, processingTimeout)
+	defer cancel()
+	data, err := s.storage.Download(extractCtx, doc.Bucket, doc.ObjectKey)
+	if err != nil {
+		return err
+	}
+	previousThumbnail := doc.ThumbnailKey
+	processed, err := s.processing.ProcessDocument(extractCtx, doc, data)
+	if err != nil {
+		s.logger.Warn("Failed to process document content", "document_id", doc.ID, "mime_type", doc.MimeType, "error", err)
+		doc.ProcessingStatus = domain.ProcessingStatusFailed
+		doc.ProcessingError = err.Error()
+	} else {
+		doc = processed
+		if doc.ProcessingStatus == domain.ProcessingStatusFailed {
+			s.logger.Warn("Failed to extract document text", "document_id", doc.ID, "mime_type", doc.MimeType, "error", doc.ProcessingError)
+		}
+	}
+	doc.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, doc); err != nil {
+		return err
+	}
+	// Content without a thumbnail now, such as a new version of another
+	// type, leaves the old one behind.
+	if previousThumbnail != "" && doc.ThumbnailKey == "" {
+		if err := s.storage.Delete(ctx, doc.Bucket, previousThumbnail); err != nil {
+			s.logger.Warn("Failed to delete thumbnail", "document_id", doc.ID, "object_key", previousThumbnail, "error", err)
+		}
+	}
+
+	if doc.ProcessingStatus == domain.ProcessingStatusCompleted {
+		if err := s.search.IndexDocument(ctx, doc); err != nil {
+			s.logger.Error("Failed to index document", "document_id", doc.ID, "error", err)
+		}
+	}
+	return nil
+}
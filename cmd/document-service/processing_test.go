@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/extraction"
+	"github.com/ims-erp/system/internal/infrastructure/processing"
+	"github.com/ims-erp/system/internal/middleware"
+	apptest "github.com/ims-erp/system/internal/testing"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// newProcessingService returns a Service processing documents kept in
+// memory, reading text with ocr.
+func newProcessingService(t *testing.T, ocr *extraction.OCR) (*Service, *apptest.Documents, *apptest.Storage, *apptest.Search) {
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	docs, storage, search := apptest.NewDocuments(), apptest.NewStorage(), apptest.NewSearch()
+	return &Service{
+		logger:     log,
+		repo:       docs,
+		storage:    storage,
+		search:     search,
+		processing: processing.NewDocumentProcessingService(storage, ocr, nil),
+	}, docs, storage, search
+}
+
+// storeDocument stores a pending document with content in memory.
+func storeDocument(t *testing.T, docs *apptest.Documents, storage *apptest.Storage, mimeType string, content []byte) *domain.Document {
+	doc := &domain.Document{
+		ID:               uuid.New(),
+		TenantID:         uuid.New(),
+		Type:             domain.DocTypeOther,
+		FileName:         "scan",
+		MimeType:         mimeType,
+		Bucket:           "documents",
+		ObjectKey:        "scan-" + uuid.NewString(),
+		ProcessingStatus: domain.ProcessingStatusPending,
+		CreatedAt:        time.Now(),
+	}
+	require.NoError(t, storage.Upload(context.Background(), doc.Bucket, doc.ObjectKey, content, mimeType))
+	require.NoError(t, docs.Create(context.Background(), doc))
+	return doc
+}
+
+func scanImage(t *testing.T) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 30))))
+	return buf.Bytes()
+}
+
+func TestProcessDocument_SetsThumbnailWhenTextFails(t *testing.T) {
+	svc, docs, storage, search := newProcessingService(t, &extraction.OCR{Tesseract: "false", PDFToText: "false"})
+	doc := storeDocument(t, docs, storage, "image/png", scanImage(t))
+
+	require.NoError(t, svc.processDocument(context.Background(), doc))
+
+	stored, err := docs.GetByID(context.Background(), doc.TenantID, doc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ProcessingStatusFailed, stored.ProcessingStatus)
+	assert.NotEmpty(t, stored.ProcessingError)
+	require.NotEmpty(t, stored.ThumbnailKey)
+	assert.NotEmpty(t, storage.Object(doc.Bucket, stored.ThumbnailKey))
+	assert.False(t, search.Indexed(doc.ID))
+}
+
+func TestProcessDocument_ClearsThumbnailOfContentWithoutOne(t *testing.T) {
+	svc, docs, storage, search := newProcessingService(t, &extraction.OCR{Tesseract: "false", PDFToText: "false"})
+	doc := storeDocument(t, docs, storage, "text/plain", []byte("Delivery note"))
+	doc.ThumbnailKey = "thumbnails/previous.jpg"
+	require.NoError(t, storage.Upload(context.Background(), doc.Bucket, doc.ThumbnailKey, []byte("jpeg"), "image/jpeg"))
+	require.NoError(t, docs.Update(context.Background(), doc))
+
+	require.NoError(t, svc.processDocument(context.Background(), doc))
+
+	stored, err := docs.GetByID(context.Background(), doc.TenantID, doc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ProcessingStatusCompleted, stored.ProcessingStatus)
+	assert.Equal(t, "Delivery note", stored.ExtractedText)
+	assert.Empty(t, stored.ThumbnailKey)
+	assert.Nil(t, storage.Object(doc.Bucket, "thumbnails/previous.jpg"))
+	assert.True(t, search.Indexed(doc.ID))
+}
+
+func thumbnailRequest(doc *domain.Document) *http.Request {
+	ctx := middleware.WithIdentity(context.Background(), doc.TenantID.String(), "user-1", []string{"document:read"})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/documents/"+doc.ID.String()+"/thumbnail", nil).WithContext(ctx)
+	return mux.SetURLVars(req, map[string]string{"id": doc.ID.String()})
+}
+
+func TestGetThumbnailHandler(t *testing.T) {
+	svc, docs, storage, _ := newProcessingService(t, extraction.NewOCR(""))
+	doc := storeDocument(t, docs, storage, "image/png", scanImage(t))
+
+	for _, status := range []domain.ProcessingStatus{domain.ProcessingStatusPending, domain.ProcessingStatusProcessing} {
+		doc.ProcessingStatus = status
+		require.NoError(t, docs.Update(context.Background(), doc))
+
+		rec := httptest.NewRecorder()
+		svc.getThumbnailHandler(rec, thumbnailRequest(doc))
+		assert.Equal(t, http.StatusConflict, rec.Code, status)
+		assert.Equal(t, "5", rec.Header().Get("Retry-After"), status)
+	}
+
+	doc.ProcessingStatus = domain.ProcessingStatusCompleted
+	require.NoError(t, docs.Update(context.Background(), doc))
+	rec := httptest.NewRecorder()
+	svc.getThumbnailHandler(rec, thumbnailRequest(doc))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	doc.ThumbnailKey = "thumbnails/scan.jpg"
+	require.NoError(t, storage.Upload(context.Background(), doc.Bucket, doc.ThumbnailKey, []byte("jpeg"), "image/jpeg"))
+	require.NoError(t, docs.Update(context.Background(), doc))
+	rec = httptest.NewRecorder()
+	svc.getThumbnailHandler(rec, thumbnailRequest(doc))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "jpeg", rec.Body.String())
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// storageQuota returns the tenant's storage quota.
+func (s *Service) storageQuota(tenantID uuid.UUID) domain.StorageQuota {
+	return domain.NewStorageQuota(s.config.StorageQuotas.For(tenantID.String()))
+}
+
+// measureUsage measures what the tenant stores against its quota, and
+// returns it with its breakdown by storage class.
+func (s *Service) measureUsage(ctx context.Context, tenantID uuid.UUID, now time.Time) (*domain.StorageUsage, []storageClassUsage, error) {
+	classes, err := s.storageUsage(ctx, tenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var bytes, objects int64
+	for _, class := range classes {
+		bytes += class.Bytes
+		objects += class.Documents
+	}
+	return domain.NewStorageUsage(tenantID, bytes, objects, s.storageQuota(tenantID), now), classes, nil
+}
+
+// checkQuota checks that the tenant can store addBytes more in addObjects
+// more documents. Going over a rejecting quota returns an error wrapping
+// domain.ErrStorageQuotaExceeded; going over a warning one is allowed.
+// Either is reported with a quota exceeded event.
+func (s *Service) checkQuota(ctx context.Context, tenantID uuid.UUID, userID string, addBytes, addObjects int64) error {
+	quota := s.storageQuota(tenantID)
+	if (quota.MaxBytes == 0 && quota.MaxObjects == 0) || (addBytes <= 0 && addObjects <= 0) {
+		return nil
+	}
+	usage, _, err := s.measureUsage(ctx, tenantID, time.Now())
+	if err != nil {
+		return err
+	}
+	after := domain.NewStorageUsage(tenantID, usage.Bytes+addBytes, usage.Objects+addObjects, quota, usage.MeasuredAt)
+	if !after.OverQuota() {
+		return nil
+	}
+
+	rejected := quota.Enforcement == domain.QuotaReject
+	s.publish(ctx, &events.NewStorageQuotaExceededEvent(after, userID, rejected).EventEnvelope)
+	if rejected {
+		return fmt.Errorf("%w: the upload would exceed it by %d bytes and %d documents",
+			domain.ErrStorageQuotaExceeded, after.OverageBytes, after.OverageObjects)
+	}
+	s.logger.Warn("Upload exceeds storage quota", "tenant_id", tenantID,
+		"overage_bytes", after.OverageBytes, "overage_objects", after.OverageObjects)
+	return nil
+}
+
+// writeQuotaError answers an upload refused by checkQuota, or the failure
+// to check it.
+func (s *Service) writeQuotaError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, domain.ErrStorageQuotaExceeded) {
+		httpresponse.ErrorStatus(w, r, http.StatusForbidden, err.Error())
+		return
+	}
+	s.logger.Error("Failed to check storage quota", "error", err)
+	httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to check storage quota")
+}
+
+// publish publishes an event when the service has a publisher. Events are
+// best-effort: a failure is logged.
+func (s *Service) publish(ctx context.Context, event *events.EventEnvelope) {
+	if s.events == nil {
+		return
+	}
+	if err := s.events.PublishEvent(ctx, event); err != nil {
+		s.logger.Error("Failed to publish event", "type", event.Type, "tenant_id", event.TenantID, "error", err)
+	}
+}
+
+// runUsageRecorder records every tenant's storage usage every
+// StorageUsageInterval until ctx is cancelled.
+func (s *Service) runUsageRecorder(ctx context.Context) {
+	ticker := time.NewTicker(s.config.StorageUsageInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Storage usage recorder started", "interval", s.config.StorageUsageInterval)
+
+	for {
+		if recorded, err := s.recordUsage(ctx, time.Now()); err != nil {
+			s.logger.Error("Failed to record storage usage", "recorded", recorded, "error", err)
+		} else {
+			s.logger.Debug("Recorded storage usage", "tenants", recorded)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Storage usage recorder stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordUsage measures and stores the usage of every tenant with
+// documents, publishing it for billing, and a quota exceeded event for
+// tenants that went over their quota since the last measurement. It
+// returns how many tenants it recorded.
+func (s *Service) recordUsage(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := s.docs.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$tenantId"}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var tenants []struct {
+		TenantID uuid.UUID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &tenants); err != nil {
+		return 0, err
+	}
+	recorded := 0
+	for _, tenant := range tenants {
+		tenantID := tenant.TenantID
+		usage, _, err := s.measureUsage(ctx, tenantID, now)
+		if err != nil {
+			return recorded, err
+		}
+		previous, err := s.usage.Record(ctx, usage)
+		if err != nil {
+			return recorded, err
+		}
+		s.publish(ctx, &events.NewStorageUsageRecordedEvent(usage).EventEnvelope)
+		if usage.OverQuota() && (previous == nil || !previous.OverQuota()) {
+			s.logger.Warn("Tenant over storage quota", "tenant_id", tenantID,
+				"overage_bytes", usage.OverageBytes, "overage_objects", usage.OverageObjects)
+			s.publish(ctx, &events.NewStorageQuotaExceededEvent(usage, "", false).EventEnvelope)
+		}
+		recorded++
+	}
+	return recorded, nil
+}
+
+// StorageUsageStore keeps the last recorded storage usage of each tenant.
+type StorageUsageStore struct {
+	collection *mongo.Collection
+}
+
+func NewStorageUsageStore(db *mongo.Database) *StorageUsageStore {
+	return &StorageUsageStore{collection: db.Collection("storage_usage")}
+}
+
+// Record stores usage as the tenant's latest and returns the one it
+// replaces, or nil for the first.
+func (r *StorageUsageStore) Record(ctx context.Context, usage *domain.StorageUsage) (*domain.StorageUsage, error) {
+	var previous domain.StorageUsage
+	err := r.collection.FindOneAndReplace(ctx, bson.M{"_id": usage.TenantID}, usage,
+		options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.Before)).Decode(&previous)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &previous, nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/imaging"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// Image use cases: product images are rendered for the catalogue, any
+// other image for previews.
+const (
+	useCaseProduct  = "product"
+	useCaseDocument = "document"
+)
+
+// thumbnailRendition is the rendition served as a document's thumbnail.
+const thumbnailRendition = "thumbnail"
+
+// parseRenditions returns the configured renditions by use case, checking
+// that each is named once per use case and has a format they can be
+// encoded in.
+func parseRenditions(cfg config.ImageConfig) (map[string][]imaging.Rendition, error) {
+	renditions := map[string][]imaging.Rendition{}
+	for _, rc := range cfg.Renditions {
+		rendition := imaging.Rendition{
+			Name:      rc.Name,
+			Width:     rc.Width,
+			Height:    rc.Height,
+			Format:    imaging.Format(rc.Format),
+			Quality:   rc.Quality,
+			Watermark: rc.Watermark,
+		}
+		if rc.UseCase != useCaseProduct && rc.UseCase != useCaseDocument {
+			return nil, fmt.Errorf("rendition %q: use case must be %q or %q", rc.Name, useCaseProduct, useCaseDocument)
+		}
+		if rendition.Name == "" || !rendition.Format.IsValid() || rendition.Quality < 0 || rendition.Quality > 100 {
+			return nil, fmt.Errorf("rendition %q: needs a name, a format of jpeg, png, webp or avif and a quality up to 100", rc.Name)
+		}
+		for _, other := range renditions[rc.UseCase] {
+			if other.Name == rendition.Name {
+				return nil, fmt.Errorf("rendition %q: named twice for %s images", rc.Name, rc.UseCase)
+			}
+		}
+		renditions[rc.UseCase] = append(renditions[rc.UseCase], rendition)
+	}
+	return renditions, nil
+}
+
+// renditionsFor returns the renditions rendered of doc: those of its use
+// case for an image, none for anything else.
+func (s *Service) renditionsFor(doc *domain.Document) []imaging.Rendition {
+	if !imaging.Supported(doc.MimeType) {
+		return nil
+	}
+	if doc.Type == domain.DocTypeProductImage {
+		return s.renditions[useCaseProduct]
+	}
+	return s.renditions[useCaseDocument]
+}
+
+// sharedRendition returns the watermarked rendition download links to doc
+// serve instead of its content, or "" to serve the content.
+func (s *Service) sharedRendition(doc *domain.Document) string {
+	for _, rendition := range s.renditionsFor(doc) {
+		if rendition.Watermark {
+			return rendition.Name
+		}
+	}
+	return ""
+}
+
+// queueRenditions marks doc's renditions to be rendered again from its
+// content, or removed when it no longer has any, and reports whether it
+// did. It is called before the document is saved, renderSoon after.
+func (s *Service) queueRenditions(doc *domain.Document) bool {
+	if len(s.renditionsFor(doc)) == 0 && len(doc.Renditions) == 0 {
+		return false
+	}
+	doc.RenditionStatus = domain.ProcessingStatusPending
+	return true
+}
+
+// renderSoon wakes the renderer.
+func (s *Service) renderSoon() {
+	select {
+	case s.renderNow <- struct{}{}:
+	default:
+	}
+}
+
+// runRenderer renders the renditions of documents queued for it every
+// RenderInterval and whenever one is queued, until ctx is cancelled.
+func (s *Service) runRenderer(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RenderInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Image renderer started", "interval", s.config.RenderInterval)
+
+	for {
+		if rendered, err := s.renderDocuments(ctx); err != nil {
+			s.logger.Error("Failed to render images", "rendered", rendered, "error", err)
+		} else if rendered > 0 {
+			s.logger.Info("Rendered images", "rendered", rendered)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Image renderer stopped")
+			return
+		case <-ticker.C:
+		case <-s.renderNow:
+		}
+	}
+}
+
+// renderDocuments renders the renditions of the documents queued for it,
+// and returns how many it rendered. Archived documents wait for their
+// restore.
+func (s *Service) renderDocuments(ctx context.Context) (int, error) {
+	docs, err := s.findDocuments(ctx, repository.NotDeleted(bson.M{
+		"renditionStatus": domain.ProcessingStatusPending,
+		"storageClass":    bson.M{"$ne": domain.StorageClassArchive},
+	}))
+	if err != nil {
+		return 0, err
+	}
+	rendered := 0
+	for _, doc := range docs {
+		if err := s.renderDocument(ctx, doc); err != nil {
+			s.logger.Error("Failed to render document images", "document_id", doc.ID, "error", err)
+			continue
+		}
+		rendered++
+	}
+	return rendered, nil
+}
+
+// renderDocument renders doc's renditions and replaces those it had. A
+// rendition the image cannot be rendered as is left out, and the rendering
+// marked failed; a failure to store one is retried on the next pass.
+func (s *Service) renderDocument(ctx context.Context, doc *domain.Document) error {
+	specs := s.renditionsFor(doc)
+	var data []byte
+	if len(specs) > 0 {
+		var err error
+		if data, err = s.storage.Download(ctx, doc.Bucket, doc.ObjectKey); err != nil {
+			return err
+		}
+	}
+
+	// Each rendering is stored under its own prefix, so the renditions
+	// the document still points at are never overwritten.
+	prefix := fmt.Sprintf("%s/renditions/%s/%s/", doc.TenantID, doc.ID, uuid.New())
+	status := domain.ProcessingStatusCompleted
+	var renditions []domain.Rendition
+	for _, spec := range specs {
+		out, err := s.images.Render(ctx, data, doc.MimeType, spec)
+		if err != nil {
+			s.logger.Warn("Failed to render image", "document_id", doc.ID, "rendition", spec.Name, "error", err)
+			status = domain.ProcessingStatusFailed
+			continue
+		}
+		key := prefix + spec.Name + spec.Format.Extension()
+		if err := s.storage.Upload(ctx, doc.Bucket, key, out.Data, out.ContentType); err != nil {
+			s.deleteRenditions(ctx, doc.Bucket, renditions)
+			return err
+		}
+		renditions = append(renditions, domain.Rendition{
+			Name:        spec.Name,
+			ObjectKey:   key,
+			ContentType: out.ContentType,
+			Width:       out.Width,
+			Height:      out.Height,
+			Size:        int64(len(out.Data)),
+			Watermarked: spec.Watermark && s.images.Watermark != nil,
+		})
+	}
+	if len(specs) == 0 {
+		status = ""
+	}
+
+	previous := doc.Renditions
+	doc.Renditions = renditions
+	doc.RenditionStatus = status
+	if err := s.repo.Update(ctx, doc); err != nil {
+		// Changed meanwhile; rendered again on the next pass if still
+		// queued.
+		s.deleteRenditions(ctx, doc.Bucket, renditions)
+		return err
+	}
+	s.deleteRenditions(ctx, doc.Bucket, previous)
+	return nil
+}
+
+// deleteRenditions deletes the stored renditions of a document in bucket.
+func (s *Service) deleteRenditions(ctx context.Context, bucket string, renditions []domain.Rendition) {
+	for _, rendition := range renditions {
+		if err := s.storage.Delete(ctx, bucket, rendition.ObjectKey); err != nil {
+			s.logger.Warn("Failed to delete rendition", "object_key", rendition.ObjectKey, "error", err)
+		}
+	}
+}
+
+// getRenditionHandler serves one of an image's renditions.
+func (s *Service) getRenditionHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := s.loadDocument(w, r)
+	if !ok {
+		return
+	}
+	rendition := doc.Rendition(mux.Vars(r)["name"])
+	if rendition == nil {
+		writeRenditionMissing(w, r, doc)
+		return
+	}
+	s.serveRendition(w, r, doc, rendition)
+}
+
+func (s *Service) serveRendition(w http.ResponseWriter, r *http.Request, doc *domain.Document, rendition *domain.Rendition) {
+	content, err := s.storage.DownloadStream(r.Context(), doc.Bucket, rendition.ObjectKey)
+	if err != nil {
+		s.logger.Error("Failed to get rendition", "document_id", doc.ID, "rendition", rendition.Name, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get rendition")
+		return
+	}
+	w.Header().Set("Content-Type", rendition.ContentType)
+	serveContent(w, r, doc.UpdatedAt, rendition.Size, content)
+}
+
+// writeRenditionMissing answers a request for a rendition doc does not
+// have: it is still being rendered, or could not be, or there is none by
+// that name.
+func writeRenditionMissing(w http.ResponseWriter, r *http.Request, doc *domain.Document) {
+	if doc.RenditionStatus == domain.ProcessingStatusPending {
+		w.Header().Set("Retry-After", "5")
+		httpresponse.ErrorStatus(w, r, http.StatusConflict, "Image is still being rendered")
+		return
+	}
+	httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Rendition not found")
+}
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/notification"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/internal/signing"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// signingPath is where signers open their invitations. It is public: the
+// token in the path is the signer's credential.
+const signingPath = "/api/v1/signing/"
+
+type envelopeRequest struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Signers []struct {
+		Name   string `json:"name"`
+		Email  string `json:"email"`
+		Fields []struct {
+			Label  string  `json:"label"`
+			Page   int     `json:"page"`
+			X      float64 `json:"x"`
+			Y      float64 `json:"y"`
+			Width  float64 `json:"width"`
+			Height float64 `json:"height"`
+		} `json:"fields"`
+	} `json:"signers"`
+}
+
+// createEnvelopeHandler defines the signers of a document and the fields
+// each of them signs. The envelope is bound to the document's content as
+// it is now.
+func (s *Service) createEnvelopeHandler(w http.ResponseWriter, r *http.Request) {
+	var req envelopeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+	doc, ok := s.loadDocument(w, r)
+	if !ok {
+		return
+	}
+	data, err := s.readContent(ctx, doc)
+	if errors.Is(err, domain.ErrDocumentArchived) {
+		writeArchivedError(w, r)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to download document", "document_id", doc.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to download document")
+		return
+	}
+
+	envelope := domain.NewEnvelope(doc.TenantID, doc.ID, doc.FileName, signing.Checksum(data),
+		req.Title, req.Message, middleware.GetUserID(ctx))
+	for _, signer := range req.Signers {
+		signerID, err := envelope.AddSigner(signer.Name, signer.Email)
+		if err != nil {
+			writeEnvelopeError(w, r, err)
+			return
+		}
+		for _, field := range signer.Fields {
+			if err := envelope.AddField(signerID, field.Label, field.Page, field.X, field.Y, field.Width, field.Height); err != nil {
+				writeEnvelopeError(w, r, err)
+				return
+			}
+		}
+	}
+	if len(envelope.Signers) == 0 {
+		writeEnvelopeError(w, r, domain.ErrInvalidEnvelope)
+		return
+	}
+
+	if err := s.envelopes.Create(ctx, envelope); err != nil {
+		s.logger.Error("Failed to create envelope", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create envelope")
+		return
+	}
+
+	s.logger.Info("Envelope created", "envelope_id", envelope.ID, "document_id", doc.ID, "signers", len(envelope.Signers))
+	httpresponse.SetETag(w, envelope.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(envelope)
+}
+
+// listDocumentEnvelopesHandler lists the envelopes a document was sent in.
+func (s *Service) listDocumentEnvelopesHandler(w http.ResponseWriter, r *http.Request) {
+	docID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+	s.writeEnvelopes(w, r, bson.M{"tenantId": getTenantID(r), "documentId": docID})
+}
+
+// listEnvelopesHandler lists the tenant's envelopes, latest first, those of
+// ?status= only when given.
+func (s *Service) listEnvelopesHandler(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{"tenantId": getTenantID(r)}
+	switch status := domain.EnvelopeStatus(r.URL.Query().Get("status")); status {
+	case "":
+	case domain.EnvelopeDraft, domain.EnvelopeSent, domain.EnvelopeCompleted, domain.EnvelopeDeclined, domain.EnvelopeVoided:
+		filter["status"] = status
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "status must be draft, sent, completed, declined or voided")
+		return
+	}
+	s.writeEnvelopes(w, r, filter)
+}
+
+func (s *Service) writeEnvelopes(w http.ResponseWriter, r *http.Request, filter bson.M) {
+	envelopes, err := s.envelopes.List(r.Context(), filter, 100)
+	if err != nil {
+		s.logger.Error("Failed to list envelopes", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to list envelopes")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"envelopes": envelopes})
+}
+
+// getEnvelopeHandler returns an envelope with the status of each signer.
+func (s *Service) getEnvelopeHandler(w http.ResponseWriter, r *http.Request) {
+	envelope, ok := s.loadEnvelope(w, r)
+	if !ok {
+		return
+	}
+	httpresponse.SetETag(w, envelope.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(envelope)
+}
+
+type signingLink struct {
+	SignerID uuid.UUID `json:"signerId"`
+	Email    string    `json:"email"`
+	URL      string    `json:"url"`
+	Emailed  bool      `json:"emailed"`
+}
+
+// sendEnvelopeHandler invites the signers who have not signed yet. Each
+// gets a new link, by email when an email provider is configured; the
+// links are returned too, to be passed on by hand.
+func (s *Service) sendEnvelopeHandler(w http.ResponseWriter, r *http.Request) {
+	envelope, ok := s.loadEnvelope(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	tokens, err := envelope.Send(middleware.GetUserID(ctx), s.config.SigningInvitationTTL)
+	if err != nil {
+		writeEnvelopeError(w, r, err)
+		return
+	}
+	if !s.updateEnvelope(w, r, envelope) {
+		return
+	}
+
+	links := make([]signingLink, 0, len(tokens))
+	for _, signer := range envelope.Signers {
+		token, ok := tokens[signer.ID]
+		if !ok {
+			continue
+		}
+		link := signingLink{SignerID: signer.ID, Email: signer.Email, URL: strings.TrimRight(s.config.SigningURL, "/") + "/" + token}
+		if s.mailer != nil {
+			if err := s.mailer.Send(ctx, invitation(envelope, signer, link.URL)); err != nil {
+				s.logger.Error("Failed to email signing invitation", "envelope_id", envelope.ID, "signer_id", signer.ID, "error", err)
+			} else {
+				link.Emailed = true
+			}
+		}
+		links = append(links, link)
+	}
+
+	s.logger.Info("Envelope sent", "envelope_id", envelope.ID, "invited", len(links))
+	httpresponse.SetETag(w, envelope.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"envelope": envelope, "links": links})
+}
+
+func invitation(envelope *domain.Envelope, signer domain.Signer, url string) notification.Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello %s,\n\nYou have been asked to sign \"%s\".\n\n", signer.Name, envelope.Title)
+	if envelope.Message != "" {
+		fmt.Fprintf(&body, "%s\n\n", envelope.Message)
+	}
+	fmt.Fprintf(&body, "Review and sign the document here:\n%s\n", url)
+	if envelope.ExpiresAt != nil {
+		fmt.Fprintf(&body, "\nThis link expires on %s.\n", envelope.ExpiresAt.Format("2 January 2006"))
+	}
+	return notification.Message{To: signer.Email, Subject: "Please sign: " + envelope.Title, Body: body.String()}
+}
+
+// voidEnvelopeHandler withdraws an envelope that is not completed; its
+// links stop working.
+func (s *Service) voidEnvelopeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	envelope, ok := s.loadEnvelope(w, r)
+	if !ok {
+		return
+	}
+	if err := envelope.Void(req.Reason, middleware.GetUserID(r.Context())); err != nil {
+		writeEnvelopeError(w, r, err)
+		return
+	}
+	if !s.updateEnvelope(w, r, envelope) {
+		return
+	}
+	httpresponse.SetETag(w, envelope.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(envelope)
+}
+
+// signedDocumentHandler downloads the sealed PDF of a completed envelope,
+// sealing it first if that failed when the last signer signed.
+func (s *Service) signedDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	envelope, ok := s.loadEnvelope(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if envelope.Status != domain.EnvelopeCompleted {
+		writeEnvelopeError(w, r, domain.ErrEnvelopeNotCompleted)
+		return
+	}
+
+	doc, err := s.repo.GetByID(ctx, envelope.TenantID, envelope.DocumentID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+			return
+		}
+		s.logger.Error("Failed to get document", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
+		return
+	}
+
+	var sealed []byte
+	if envelope.SealedObjectKey == "" {
+		sealed, err = s.seal(ctx, envelope, doc)
+	} else {
+		sealed, err = s.storage.Download(ctx, doc.Bucket, envelope.SealedObjectKey)
+	}
+	if err != nil {
+		if errors.Is(err, signing.ErrDocumentChanged) {
+			httpresponse.Error(w, r, apperr.Conflict("document %s has changed since it was sent for signature", doc.ID))
+			return
+		}
+		if errors.Is(err, domain.ErrDocumentArchived) {
+			writeArchivedError(w, r)
+			return
+		}
+		s.logger.Error("Failed to get signed document", "envelope_id", envelope.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get signed document")
+		return
+	}
+
+	name := strings.TrimSuffix(doc.FileName, ".pdf") + "-signed.pdf"
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", attachment(name))
+	w.Header().Set("X-Checksum-SHA256", envelope.SealedChecksum)
+	w.Write(sealed)
+}
+
+// seal stores the signed PDF of a completed envelope beside its document.
+func (s *Service) seal(ctx context.Context, envelope *domain.Envelope, doc *domain.Document) ([]byte, error) {
+	original, err := s.readContent(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := signing.Seal(envelope, original)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s/signed/%s.pdf", envelope.TenantID, envelope.ID)
+	if err := s.storage.Upload(ctx, doc.Bucket, key, sealed, "application/pdf"); err != nil {
+		return nil, err
+	}
+	if err := envelope.Seal(key, signing.Checksum(sealed)); err != nil {
+		return nil, err
+	}
+	if err := s.envelopes.Update(ctx, envelope); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Envelope sealed", "envelope_id", envelope.ID, "checksum", envelope.SealedChecksum)
+	return sealed, nil
+}
+
+// signingView is what a signer sees of an envelope.
+type signingView struct {
+	EnvelopeID       uuid.UUID               `json:"envelopeId"`
+	Title            string                  `json:"title"`
+	Message          string                  `json:"message,omitempty"`
+	DocumentName     string                  `json:"documentName"`
+	DocumentChecksum string                  `json:"documentChecksum"`
+	Status           domain.EnvelopeStatus   `json:"status"`
+	ExpiresAt        *time.Time              `json:"expiresAt,omitempty"`
+	Signer           domain.Signer           `json:"signer"`
+	Fields           []domain.SignatureField `json:"fields"`
+}
+
+// signingInvitationHandler shows a signer what they are asked to sign, and
+// records that they opened it.
+func (s *Service) signingInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	envelope, signer, ok := s.loadInvitation(w, r)
+	if !ok {
+		return
+	}
+	if signer.Status == domain.SignerInvited {
+		envelope.View(signer.ID, clientIP(r))
+		if err := s.envelopes.Update(r.Context(), envelope); err != nil {
+			// Viewing does not depend on it being recorded.
+			s.logger.Warn("Failed to record envelope view", "envelope_id", envelope.ID, "error", err)
+		}
+		signer = envelope.Signer(signer.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signingView{
+		EnvelopeID:       envelope.ID,
+		Title:            envelope.Title,
+		Message:          envelope.Message,
+		DocumentName:     envelope.DocumentName,
+		DocumentChecksum: envelope.DocumentChecksum,
+		Status:           envelope.Status,
+		ExpiresAt:        envelope.ExpiresAt,
+		Signer:           *signer,
+		Fields:           envelope.SignerFields(signer.ID),
+	})
+}
+
+// signingDocumentHandler downloads the document a signer is asked to sign.
+func (s *Service) signingDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	envelope, _, ok := s.loadInvitation(w, r)
+	if !ok {
+		return
+	}
+	doc, data, err := s.envelopeDocument(r.Context(), envelope)
+	if err != nil {
+		s.writeEnvelopeDocumentError(w, r, envelope, err)
+		return
+	}
+	w.Header().Set("Content-Type", doc.MimeType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", doc.FileName))
+	w.Write(data)
+}
+
+type signatureRequest struct {
+	FieldID     uuid.UUID              `json:"fieldId"`
+	Method      domain.SignatureMethod `json:"method"`
+	Strokes     []domain.Stroke        `json:"strokes"`
+	Certificate string                 `json:"certificate"`
+	Signature   []byte                 `json:"signature"`
+}
+
+// signHandler records a signer's signatures, one for each of their fields:
+// drawn strokes, or a certificate with its signature of the document. The
+// last signer's signature completes and seals the envelope.
+func (s *Service) signHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Signatures []signatureRequest `json:"signatures"`
+		Consent    bool               `json:"consent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !req.Consent {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "consent to sign electronically is required")
+		return
+	}
+
+	envelope, signer, ok := s.loadInvitation(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+
+	signatures := make([]domain.Signature, 0, len(req.Signatures))
+	var document []byte
+	for _, sig := range req.Signatures {
+		signature := domain.Signature{FieldID: sig.FieldID, Method: sig.Method, Strokes: sig.Strokes}
+		if sig.Method == domain.SignatureCertificate {
+			if document == nil {
+				_, data, err := s.envelopeDocument(ctx, envelope)
+				if err != nil {
+					s.writeEnvelopeDocumentError(w, r, envelope, err)
+					return
+				}
+				document = data
+			}
+			certificate, err := signing.VerifyCertificate(sig.Certificate, sig.Signature, document, s.trustedCAs, time.Now())
+			if err != nil {
+				httpresponse.ErrorStatus(w, r, http.StatusUnprocessableEntity, strings.TrimPrefix(err.Error(), "signing: "))
+				return
+			}
+			signature.Certificate = certificate
+		}
+		signatures = append(signatures, signature)
+	}
+
+	if err := envelope.Sign(signer.ID, signatures, clientIP(r)); err != nil {
+		writeEnvelopeError(w, r, err)
+		return
+	}
+	if !s.updateEnvelope(w, r, envelope) {
+		return
+	}
+	s.logger.Info("Envelope signed", "envelope_id", envelope.ID, "signer_id", signer.ID, "status", envelope.Status)
+
+	if envelope.Status == domain.EnvelopeCompleted {
+		doc, err := s.repo.GetByID(ctx, envelope.TenantID, envelope.DocumentID)
+		if err == nil {
+			_, err = s.seal(ctx, envelope, doc)
+		}
+		if err != nil {
+			// The signatures stand; the signed PDF is sealed when first
+			// downloaded instead.
+			s.logger.Error("Failed to seal envelope", "envelope_id", envelope.ID, "error", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"envelopeId": envelope.ID,
+		"status":     envelope.Status,
+		"signer":     envelope.Signer(signer.ID),
+	})
+}
+
+// declineHandler records that a signer refuses to sign, which closes the
+// envelope for everyone.
+func (s *Service) declineHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	envelope, signer, ok := s.loadInvitation(w, r)
+	if !ok {
+		return
+	}
+	if err := envelope.Decline(signer.ID, req.Reason, clientIP(r)); err != nil {
+		writeEnvelopeError(w, r, err)
+		return
+	}
+	if !s.updateEnvelope(w, r, envelope) {
+		return
+	}
+	s.logger.Info("Envelope declined", "envelope_id", envelope.ID, "signer_id", signer.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"envelopeId": envelope.ID, "status": envelope.Status})
+}
+
+// loadInvitation finds the envelope and signer of the token in the path.
+func (s *Service) loadInvitation(w http.ResponseWriter, r *http.Request) (*domain.Envelope, *domain.Signer, bool) {
+	token := mux.Vars(r)["token"]
+	envelope, err := s.envelopes.FindBySigningToken(r.Context(), token)
+	if err != nil {
+		s.logger.Error("Failed to find envelope", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to find signing invitation")
+		return nil, nil, false
+	}
+	var signer *domain.Signer
+	if envelope != nil {
+		signer = envelope.SignerByToken(token)
+	}
+	if signer == nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Signing link not found or no longer valid")
+		return nil, nil, false
+	}
+	if envelope.Expired(time.Now()) {
+		writeEnvelopeError(w, r, domain.ErrEnvelopeExpired)
+		return nil, nil, false
+	}
+	return envelope, signer, true
+}
+
+// envelopeDocument returns the document of an envelope and its content,
+// which must still be what the envelope was created for.
+func (s *Service) envelopeDocument(ctx context.Context, envelope *domain.Envelope) (*domain.Document, []byte, error) {
+	doc, err := s.repo.GetByID(ctx, envelope.TenantID, envelope.DocumentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := s.readContent(ctx, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if signing.Checksum(data) != envelope.DocumentChecksum {
+		return nil, nil, signing.ErrDocumentChanged
+	}
+	return doc, data, nil
+}
+
+func (s *Service) writeEnvelopeDocumentError(w http.ResponseWriter, r *http.Request, envelope *domain.Envelope, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+	case errors.Is(err, signing.ErrDocumentChanged):
+		httpresponse.ErrorStatus(w, r, http.StatusConflict, "The document has changed since it was sent for signature")
+	case errors.Is(err, domain.ErrDocumentArchived):
+		writeArchivedError(w, r)
+	default:
+		s.logger.Error("Failed to get envelope document", "envelope_id", envelope.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
+	}
+}
+
+func (s *Service) loadDocument(w http.ResponseWriter, r *http.Request) (*domain.Document, bool) {
+	docID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid document ID")
+		return nil, false
+	}
+	doc, err := s.repo.GetByID(r.Context(), getTenantID(r), docID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+			return nil, false
+		}
+		s.logger.Error("Failed to get document", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
+		return nil, false
+	}
+	return doc, true
+}
+
+func (s *Service) loadEnvelope(w http.ResponseWriter, r *http.Request) (*domain.Envelope, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid envelope ID")
+		return nil, false
+	}
+	envelope, err := s.envelopes.Get(r.Context(), getTenantID(r), id)
+	if err != nil {
+		s.logger.Error("Failed to get envelope", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get envelope")
+		return nil, false
+	}
+	if envelope == nil {
+		writeEnvelopeError(w, r, domain.ErrEnvelopeNotFound)
+		return nil, false
+	}
+	return envelope, true
+}
+
+func (s *Service) updateEnvelope(w http.ResponseWriter, r *http.Request, envelope *domain.Envelope) bool {
+	if err := s.envelopes.Update(r.Context(), envelope); err != nil {
+		if errors.Is(err, repository.ErrConcurrencyConflict) {
+			httpresponse.Error(w, r, apperr.Conflict("envelope %s changed meanwhile; try again", envelope.ID))
+			return false
+		}
+		s.logger.Error("Failed to update envelope", "envelope_id", envelope.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to update envelope")
+		return false
+	}
+	return true
+}
+
+// writeEnvelopeError writes the errors of defining and signing envelopes.
+func writeEnvelopeError(w http.ResponseWriter, r *http.Request, err error) {
+	var docErr *domain.DocumentError
+	if !errors.As(err, &docErr) {
+		httpresponse.Error(w, r, err)
+		return
+	}
+	status := http.StatusBadRequest
+	switch docErr.Code {
+	case domain.ErrEnvelopeNotFound.Code:
+		status = http.StatusNotFound
+	case domain.ErrEnvelopeClosed.Code, domain.ErrSignerDone.Code, domain.ErrEnvelopeNotCompleted.Code:
+		status = http.StatusConflict
+	case domain.ErrEnvelopeExpired.Code:
+		status = http.StatusGone
+	case domain.ErrSignatureMissing.Code, domain.ErrInvalidSignature.Code:
+		status = http.StatusUnprocessableEntity
+	}
+	httpresponse.ErrorStatus(w, r, status, docErr.Message)
+}
+
+// clientIP returns the address a request came from, as forwarded by the
+// gateway or a proxy in front of the service.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loadTrustedCAs reads the PEM certificates certificate signatures must
+// chain to. Without a file any valid certificate is accepted.
+func loadTrustedCAs(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// EnvelopeStore keeps envelopes in the signature_envelopes collection.
+type EnvelopeStore struct {
+	collection *mongo.Collection
+}
+
+func NewEnvelopeStore(db *mongo.Database) *EnvelopeStore {
+	return &EnvelopeStore{collection: db.Collection("signature_envelopes")}
+}
+
+func (r *EnvelopeStore) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "signers.tokenHash", Value: 1}},
+			Options: options.Index().SetSparse(true).SetName("signing_token"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "documentId", Value: 1}},
+			Options: options.Index().SetName("envelope_document"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("status_created"),
+		},
+	})
+	return err
+}
+
+func (r *EnvelopeStore) Create(ctx context.Context, envelope *domain.Envelope) error {
+	_, err := r.collection.InsertOne(ctx, envelope)
+	return err
+}
+
+// Get returns the tenant's envelope, or nil.
+func (r *EnvelopeStore) Get(ctx context.Context, tenantID, id uuid.UUID) (*domain.Envelope, error) {
+	return r.findOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+}
+
+// FindBySigningToken returns the envelope a signer was invited to with
+// token, whatever its tenant, or nil.
+func (r *EnvelopeStore) FindBySigningToken(ctx context.Context, token string) (*domain.Envelope, error) {
+	if token == "" {
+		return nil, nil
+	}
+	return r.findOne(ctx, bson.M{"signers.tokenHash": domain.HashSigningToken(token)})
+}
+
+// List returns the envelopes matching filter, latest first.
+func (r *EnvelopeStore) List(ctx context.Context, filter bson.M, limit int64) ([]domain.Envelope, error) {
+	cursor, err := r.collection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	envelopes := []domain.Envelope{}
+	if err := cursor.All(ctx, &envelopes); err != nil {
+		return nil, err
+	}
+	return envelopes, nil
+}
+
+// Update replaces envelope if nobody else has changed it since it was
+// read, and advances its version. It reports
+// repository.ErrConcurrencyConflict when the stored envelope has moved on.
+func (r *EnvelopeStore) Update(ctx context.Context, envelope *domain.Envelope) error {
+	next := *envelope
+	next.Version++
+	result, err := r.collection.ReplaceOne(ctx, bson.M{
+		"_id":      envelope.ID,
+		"tenantId": envelope.TenantID,
+		"version":  envelope.Version,
+	}, &next)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrConcurrencyConflict
+	}
+	envelope.Version++
+	return nil
+}
+
+func (r *EnvelopeStore) findOne(ctx context.Context, filter bson.M) (*domain.Envelope, error) {
+	var envelope domain.Envelope
+	err := r.collection.FindOne(ctx, filter).Decode(&envelope)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/extraction"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// extractSupplierInvoiceHandler reads a supplier invoice out of an uploaded
+// invoice or scan into a draft for review. The document's text is read by
+// OCR the first time. Extracting again replaces the draft until it has
+// been reviewed.
+func (s *Service) extractSupplierInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenantID := getTenantID(r)
+	docID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	doc, err := s.repo.GetByID(ctx, tenantID, docID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Document not found")
+			return
+		}
+		s.logger.Error("Failed to get document", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get document")
+		return
+	}
+	if doc.Type != domain.DocTypeInvoice && doc.Type != domain.DocTypeScanned {
+		httpresponse.ErrorStatus(w, r, http.StatusUnprocessableEntity, "Supplier invoices are read from invoice and scanned documents")
+		return
+	}
+
+	existing, err := s.supplierInvoices.FindByDocument(ctx, tenantID, docID)
+	if err != nil {
+		s.logger.Error("Failed to find supplier invoice", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to extract supplier invoice")
+		return
+	}
+	if existing != nil && existing.Status != domain.SupplierInvoiceDraft {
+		httpresponse.Error(w, r, apperr.Conflict("supplier invoice %s has already been reviewed", existing.ID))
+		return
+	}
+
+	if doc.ExtractedText == "" {
+		if err := s.readText(ctx, doc); err != nil {
+			if errors.Is(err, domain.ErrDocumentArchived) {
+				writeArchivedError(w, r)
+				return
+			}
+			if errors.Is(err, extraction.ErrUnsupportedFile) {
+				httpresponse.ErrorStatus(w, r, http.StatusUnsupportedMediaType, "Text cannot be read from "+doc.MimeType+" files")
+				return
+			}
+			s.logger.Error("Failed to read document text", "document_id", docID, "error", err)
+			httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to read document text")
+			return
+		}
+	}
+
+	templates, err := s.supplierTemplates.ForTenant(ctx, tenantID)
+	if err != nil {
+		s.logger.Error("Failed to load supplier templates", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to extract supplier invoice")
+		return
+	}
+	result := extraction.Extract(doc.ExtractedText, templates)
+	invoice := domain.NewSupplierInvoice(tenantID, docID, result.Fields, result.Lines)
+	if result.Template != nil {
+		invoice.SupplierID = result.Template.SupplierID
+	}
+	if err := s.flagDuplicate(ctx, invoice); err != nil {
+		s.logger.Error("Failed to look for duplicate supplier invoices", "error", err)
+	}
+
+	status := http.StatusCreated
+	if existing != nil {
+		invoice.ID, invoice.CreatedAt, invoice.Version = existing.ID, existing.CreatedAt, existing.Version
+		err = s.supplierInvoices.Update(ctx, invoice)
+		status = http.StatusOK
+	} else {
+		err = s.supplierInvoices.Create(ctx, invoice)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrConcurrencyConflict) {
+			httpresponse.Error(w, r, apperr.Conflict("supplier invoice of document %s changed meanwhile", docID))
+			return
+		}
+		s.logger.Error("Failed to save supplier invoice", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to save supplier invoice")
+		return
+	}
+
+	s.logger.Info("Supplier invoice extracted",
+		"document_id", docID,
+		"supplier_invoice_id", invoice.ID,
+		"template", result.Template != nil,
+		"warnings", len(invoice.Warnings),
+	)
+	httpresponse.SetETag(w, invoice.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// readText reads the text of doc's file and stores it on the document.
+func (s *Service) readText(ctx context.Context, doc *domain.Document) error {
+	data, err := s.readContent(ctx, doc)
+	if err != nil {
+		return err
+	}
+	text, err := s.ocr.Text(ctx, data, doc.MimeType)
+	if err != nil {
+		return err
+	}
+	doc.ExtractedText = text
+	doc.ProcessingStatus = domain.ProcessingStatusCompleted
+	doc.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, doc); err != nil {
+		// The text is still read; it is only read again next time.
+		s.logger.Warn("Failed to store document text", "document_id", doc.ID, "error", err)
+	}
+	return nil
+}
+
+// flagDuplicate records another invoice of the same supplier and number.
+func (s *Service) flagDuplicate(ctx context.Context, invoice *domain.SupplierInvoice) error {
+	invoice.DuplicateOf = nil
+	if invoice.SupplierKey != "" && invoice.InvoiceNumber != "" {
+		duplicate, err := s.supplierInvoices.FindDuplicate(ctx, invoice)
+		if err != nil {
+			return err
+		}
+		if duplicate != nil {
+			invoice.DuplicateOf = &duplicate.ID
+		}
+	}
+	invoice.Check()
+	return nil
+}
+
+// listSupplierInvoicesHandler lists the tenant's supplier invoices, latest
+// first, those of ?status= only when given.
+func (s *Service) listSupplierInvoicesHandler(w http.ResponseWriter, r *http.Request) {
+	status := domain.SupplierInvoiceStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", domain.SupplierInvoiceDraft, domain.SupplierInvoiceApproved, domain.SupplierInvoiceRejected:
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "status must be draft, approved or rejected")
+		return
+	}
+
+	invoices, err := s.supplierInvoices.List(r.Context(), getTenantID(r), status, 100)
+	if err != nil {
+		s.logger.Error("Failed to list supplier invoices", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to list supplier invoices")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"invoices": invoices})
+}
+
+func (s *Service) getSupplierInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := s.loadSupplierInvoice(w, r)
+	if !ok {
+		return
+	}
+	httpresponse.SetETag(w, invoice.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// correctSupplierInvoiceHandler applies a reviewer's corrections to a
+// draft. Each corrected value found in the document teaches the supplier's
+// template where to read it next time.
+func (s *Service) correctSupplierInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Fields     map[string]string            `json:"fields"`
+		Lines      []domain.SupplierInvoiceLine `json:"lines"`
+		SupplierID *uuid.UUID                   `json:"supplierId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	invoice, ok := s.loadSupplierInvoice(w, r)
+	if !ok {
+		return
+	}
+	if expected, ok := httpresponse.ParseETag(r.Header.Get("If-Match")); ok && expected != invoice.Version {
+		httpresponse.Error(w, r, apperr.VersionConflict("supplier invoice", expected, invoice.Version))
+		return
+	}
+
+	ctx := r.Context()
+	changed, err := invoice.Correct(req.Fields, req.Lines)
+	if err != nil {
+		writeSupplierInvoiceError(w, r, err)
+		return
+	}
+	if req.SupplierID != nil {
+		invoice.SupplierID = req.SupplierID
+	}
+	if err := s.flagDuplicate(ctx, invoice); err != nil {
+		s.logger.Error("Failed to look for duplicate supplier invoices", "error", err)
+	}
+	if err := s.supplierInvoices.Update(ctx, invoice); err != nil {
+		if errors.Is(err, repository.ErrConcurrencyConflict) {
+			httpresponse.Error(w, r, apperr.VersionConflict("supplier invoice", invoice.Version, 0))
+			return
+		}
+		s.logger.Error("Failed to update supplier invoice", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to update supplier invoice")
+		return
+	}
+
+	if len(changed) > 0 || req.SupplierID != nil {
+		if err := s.learn(ctx, invoice, changed); err != nil {
+			// The correction stands; only the next extraction misses it.
+			s.logger.Error("Failed to update supplier template", "supplier", invoice.SupplierKey, "error", err)
+		}
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// learn teaches the template of the invoice's supplier where the changed
+// fields are in its document.
+func (s *Service) learn(ctx context.Context, invoice *domain.SupplierInvoice, changed []string) error {
+	if invoice.SupplierKey == "" {
+		return nil
+	}
+	template, err := s.supplierTemplates.Get(ctx, invoice.TenantID, invoice.SupplierKey)
+	if err != nil {
+		return err
+	}
+	if template == nil {
+		template = domain.NewSupplierTemplate(invoice.TenantID, invoice.SupplierName)
+	}
+	learnt := false
+	if invoice.SupplierID != nil && (template.SupplierID == nil || *template.SupplierID != *invoice.SupplierID) {
+		template.SupplierID = invoice.SupplierID
+		learnt = true
+	}
+
+	doc, err := s.repo.GetByID(ctx, invoice.TenantID, invoice.DocumentID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if doc != nil {
+		for _, field := range changed {
+			if extraction.Learn(template, doc.ExtractedText, field, invoice.Fields[field].Value) {
+				learnt = true
+			}
+		}
+	}
+	if !learnt {
+		return nil
+	}
+	return s.supplierTemplates.Save(ctx, template)
+}
+
+// approveSupplierInvoiceHandler approves a draft for payment.
+func (s *Service) approveSupplierInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	s.reviewSupplierInvoice(w, r, func(invoice *domain.SupplierInvoice, by uuid.UUID) error {
+		return invoice.Approve(by)
+	})
+}
+
+// rejectSupplierInvoiceHandler sets a draft aside, with an optional reason.
+func (s *Service) rejectSupplierInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	s.reviewSupplierInvoice(w, r, func(invoice *domain.SupplierInvoice, by uuid.UUID) error {
+		return invoice.Reject(req.Reason, by)
+	})
+}
+
+func (s *Service) reviewSupplierInvoice(w http.ResponseWriter, r *http.Request, review func(*domain.SupplierInvoice, uuid.UUID) error) {
+	invoice, ok := s.loadSupplierInvoice(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := uuid.Parse(middleware.GetUserID(r.Context()))
+	if err := review(invoice, userID); err != nil {
+		writeSupplierInvoiceError(w, r, err)
+		return
+	}
+	if err := s.supplierInvoices.Update(r.Context(), invoice); err != nil {
+		if errors.Is(err, repository.ErrConcurrencyConflict) {
+			httpresponse.Error(w, r, apperr.VersionConflict("supplier invoice", invoice.Version, 0))
+			return
+		}
+		s.logger.Error("Failed to update supplier invoice", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to update supplier invoice")
+		return
+	}
+
+	s.logger.Info("Supplier invoice reviewed", "supplier_invoice_id", invoice.ID, "status", invoice.Status)
+	httpresponse.SetETag(w, invoice.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
+
+func (s *Service) loadSupplierInvoice(w http.ResponseWriter, r *http.Request) (*domain.SupplierInvoice, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid supplier invoice ID")
+		return nil, false
+	}
+	invoice, err := s.supplierInvoices.Get(r.Context(), getTenantID(r), id)
+	if err != nil {
+		s.logger.Error("Failed to get supplier invoice", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get supplier invoice")
+		return nil, false
+	}
+	if invoice == nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Supplier invoice not found")
+		return nil, false
+	}
+	return invoice, true
+}
+
+// listSupplierTemplatesHandler lists what extraction has learnt of the
+// tenant's suppliers.
+func (s *Service) listSupplierTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := s.supplierTemplates.ForTenant(r.Context(), getTenantID(r))
+	if err != nil {
+		s.logger.Error("Failed to list supplier templates", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to list supplier templates")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"templates": templates})
+}
+
+// writeSupplierInvoiceError writes the errors of reviewing a supplier
+// invoice.
+func writeSupplierInvoiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var docErr *domain.DocumentError
+	if !errors.As(err, &docErr) {
+		httpresponse.Error(w, r, err)
+		return
+	}
+	switch docErr.Code {
+	case domain.ErrSupplierInvoiceReviewed.Code:
+		httpresponse.ErrorStatus(w, r, http.StatusConflict, docErr.Message)
+	case domain.ErrSupplierInvoiceIncomplete.Code:
+		httpresponse.ErrorStatus(w, r, http.StatusUnprocessableEntity, docErr.Message)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, docErr.Message)
+	}
+}
+
+// SupplierInvoiceStore keeps supplier invoices in the supplier_invoices
+// collection.
+type SupplierInvoiceStore struct {
+	collection *mongo.Collection
+}
+
+func NewSupplierInvoiceStore(db *mongo.Database) *SupplierInvoiceStore {
+	return &SupplierInvoiceStore{collection: db.Collection("supplier_invoices")}
+}
+
+// EnsureIndexes creates the store's indexes: a document has one supplier
+// invoice.
+func (r *SupplierInvoiceStore) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "documentId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("invoice_per_document"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "supplierKey", Value: 1}, {Key: "invoiceNumber", Value: 1}},
+			Options: options.Index().SetName("supplier_number"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("status_created"),
+		},
+	})
+	return err
+}
+
+func (r *SupplierInvoiceStore) Create(ctx context.Context, invoice *domain.SupplierInvoice) error {
+	_, err := r.collection.InsertOne(ctx, invoice)
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrConcurrencyConflict
+	}
+	return err
+}
+
+// Get returns the tenant's supplier invoice, or nil.
+func (r *SupplierInvoiceStore) Get(ctx context.Context, tenantID, id uuid.UUID) (*domain.SupplierInvoice, error) {
+	return r.findOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+}
+
+// FindByDocument returns the supplier invoice read from a document, or nil.
+func (r *SupplierInvoiceStore) FindByDocument(ctx context.Context, tenantID, documentID uuid.UUID) (*domain.SupplierInvoice, error) {
+	return r.findOne(ctx, bson.M{"tenantId": tenantID, "documentId": documentID})
+}
+
+// FindDuplicate returns another invoice, not rejected, of the invoice's
+// supplier and number, or nil.
+func (r *SupplierInvoiceStore) FindDuplicate(ctx context.Context, invoice *domain.SupplierInvoice) (*domain.SupplierInvoice, error) {
+	return r.findOne(ctx, bson.M{
+		"tenantId":      invoice.TenantID,
+		"supplierKey":   invoice.SupplierKey,
+		"invoiceNumber": invoice.InvoiceNumber,
+		"status":        bson.M{"$ne": domain.SupplierInvoiceRejected},
+		"_id":           bson.M{"$ne": invoice.ID},
+	})
+}
+
+// List returns the tenant's supplier invoices, latest first, of status when
+// not empty.
+func (r *SupplierInvoiceStore) List(ctx context.Context, tenantID uuid.UUID, status domain.SupplierInvoiceStatus, limit int64) ([]domain.SupplierInvoice, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := r.collection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invoices := []domain.SupplierInvoice{}
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
+
+// Update replaces invoice if nobody else has changed it since it was read,
+// and advances its version. It reports repository.ErrConcurrencyConflict
+// when the stored invoice has moved on.
+func (r *SupplierInvoiceStore) Update(ctx context.Context, invoice *domain.SupplierInvoice) error {
+	next := *invoice
+	next.Version++
+	result, err := r.collection.ReplaceOne(ctx, bson.M{
+		"_id":      invoice.ID,
+		"tenantId": invoice.TenantID,
+		"version":  invoice.Version,
+	}, &next)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrConcurrencyConflict
+	}
+	invoice.Version++
+	return nil
+}
+
+func (r *SupplierInvoiceStore) findOne(ctx context.Context, filter bson.M) (*domain.SupplierInvoice, error) {
+	var invoice domain.SupplierInvoice
+	err := r.collection.FindOne(ctx, filter).Decode(&invoice)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// SupplierTemplateStore keeps what extraction has learnt of each supplier
+// in the supplier_templates collection, one template per tenant and
+// supplier.
+type SupplierTemplateStore struct {
+	collection *mongo.Collection
+}
+
+func NewSupplierTemplateStore(db *mongo.Database) *SupplierTemplateStore {
+	return &SupplierTemplateStore{collection: db.Collection("supplier_templates")}
+}
+
+func (r *SupplierTemplateStore) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "supplierKey", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("template_per_supplier"),
+	})
+	return err
+}
+
+// ForTenant returns the tenant's templates, most corrected first.
+func (r *SupplierTemplateStore) ForTenant(ctx context.Context, tenantID uuid.UUID) ([]*domain.SupplierTemplate, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"tenantId": tenantID},
+		options.Find().SetSort(bson.D{{Key: "corrections", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	templates := []*domain.SupplierTemplate{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// Get returns the template of a supplier, or nil.
+func (r *SupplierTemplateStore) Get(ctx context.Context, tenantID uuid.UUID, supplierKey string) (*domain.SupplierTemplate, error) {
+	var template domain.SupplierTemplate
+	err := r.collection.FindOne(ctx, bson.M{"tenantId": tenantID, "supplierKey": supplierKey}).Decode(&template)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// Save stores template, replacing the supplier's.
+func (r *SupplierTemplateStore) Save(ctx context.Context, template *domain.SupplierTemplate) error {
+	_, err := r.collection.ReplaceOne(ctx,
+		bson.M{"tenantId": template.TenantID, "supplierKey": template.SupplierKey},
+		template, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/doctemplate"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+type templateRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Kind        domain.TemplateKind `json:"kind"`
+	Entity      string              `json:"entity"`
+	Format      string              `json:"format"`
+	Body        string              `json:"body"`
+}
+
+// apply sets the template's definition from the request, checking its
+// body's merge fields against those of its entity.
+func (req *templateRequest) apply(t *domain.DocumentTemplate) error {
+	t.Name = req.Name
+	t.Description = req.Description
+	t.Kind = req.Kind
+	t.Entity = req.Entity
+	t.Format = req.Format
+	t.Body = req.Body
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	parsed, err := doctemplate.Parse(t.Body)
+	if err != nil {
+		return err
+	}
+	if err := parsed.Check(doctemplate.Catalog(t.Entity)); err != nil {
+		return err
+	}
+	t.Fields = parsed.Fields()
+	return nil
+}
+
+// listTemplatesHandler lists the tenant's templates by name, those of
+// ?kind= or ?entity= only when given.
+func (s *Service) listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{"tenantId": getTenantID(r)}
+	if kind := domain.TemplateKind(r.URL.Query().Get("kind")); kind != "" {
+		if !kind.IsValid() {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "kind must be contract, quote, delivery_note, packing_slip or other")
+			return
+		}
+		filter["kind"] = kind
+	}
+	if entity := r.URL.Query().Get("entity"); entity != "" {
+		filter["entity"] = entity
+	}
+
+	templates, err := s.templates.List(r.Context(), filter)
+	if err != nil {
+		s.logger.Error("Failed to list document templates", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to list templates")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"templates": templates})
+}
+
+// templateFieldsHandler lists the merge fields templates about each entity
+// may use.
+func (s *Service) templateFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	fields := make(map[string][]string)
+	for _, entity := range []string{domain.EntityClient, domain.EntityOrder, domain.EntityInvoice, domain.EntityShipment} {
+		fields[entity] = doctemplate.Catalog(entity)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"fields": fields})
+}
+
+func (s *Service) createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	now := time.Now()
+	template := &domain.DocumentTemplate{
+		ID:        uuid.New(),
+		TenantID:  getTenantID(r),
+		CreatedBy: middleware.GetUserID(r.Context()),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+	if err := req.apply(template); err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	if err := s.templates.Create(r.Context(), template); err != nil {
+		s.logger.Error("Failed to create document template", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create template")
+		return
+	}
+
+	httpresponse.SetETag(w, template.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
+
+func (s *Service) getTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := s.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+	httpresponse.SetETag(w, template.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// updateTemplateHandler replaces a template's definition. Documents already
+// generated from it are not changed.
+func (s *Service) updateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	template, ok := s.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+	if expected, ok := httpresponse.ParseETag(r.Header.Get("If-Match")); ok && expected != template.Version {
+		httpresponse.Error(w, r, apperr.VersionConflict("document template", expected, template.Version))
+		return
+	}
+	if err := req.apply(template); err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	template.UpdatedAt = time.Now()
+	if err := s.templates.Update(r.Context(), template); err != nil {
+		if errors.Is(err, repository.ErrConcurrencyConflict) {
+			httpresponse.Error(w, r, apperr.Conflict("document template %s changed meanwhile; try again", template.ID))
+			return
+		}
+		s.logger.Error("Failed to update document template", "template_id", template.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to update template")
+		return
+	}
+
+	httpresponse.SetETag(w, template.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+func (s *Service) deleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := s.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+	if err := s.templates.Delete(r.Context(), template.TenantID, template.ID); err != nil {
+		if err == domain.ErrDocumentTemplateNotFound {
+			writeTemplateError(w, r, err)
+			return
+		}
+		s.logger.Error("Failed to delete document template", "template_id", template.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to delete template")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type generateRequest struct {
+	TemplateID uuid.UUID `json:"templateId"`
+	EntityID   string    `json:"entityId"`
+	// Format overrides the template's format, pdf or docx.
+	Format   string   `json:"format"`
+	FileName string   `json:"fileName"`
+	Tags     []string `json:"tags"`
+}
+
+// generateDocumentHandler renders a template with the values of the
+// client, order, invoice or shipment it is about, and stores the result as
+// a new document linked to that entity. Documents about shipments carry
+// the shipment's delivery note number and are added to its order.
+func (s *Service) generateDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	var req generateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.EntityID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "entityId is required")
+		return
+	}
+
+	ctx := r.Context()
+	tenantID := getTenantID(r)
+	template, err := s.templates.Get(ctx, tenantID, req.TemplateID)
+	if err != nil {
+		s.logger.Error("Failed to get document template", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get template")
+		return
+	}
+	if template == nil {
+		writeTemplateError(w, r, domain.ErrDocumentTemplateNotFound)
+		return
+	}
+	format := template.Format
+	if req.Format != "" {
+		format = req.Format
+	}
+	if !domain.IsGeneratedFormat(format) {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "format must be pdf or docx")
+		return
+	}
+
+	parsed, err := doctemplate.Parse(template.Body)
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	if template.Entity == domain.EntityShipment {
+		if err := s.numberDeliveryNote(ctx, tenantID, req.EntityID); err != nil {
+			writeTemplateError(w, r, err)
+			return
+		}
+	}
+	values, err := s.entityValues(ctx, tenantID, template.Entity, req.EntityID)
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	text := parsed.Render(doctemplate.Merge(values, time.Now()))
+
+	fileName := strings.TrimSpace(req.FileName)
+	if fileName == "" {
+		fileName = doctemplate.Title(text)
+		if fileName == "" {
+			fileName = template.Name
+		}
+	}
+	if ext := "." + format; !strings.EqualFold(path.Ext(fileName), ext) {
+		fileName += ext
+	}
+	var data []byte
+	mimeType := doctemplate.MimePDF
+	if format == domain.GeneratedDOCX {
+		data, err = doctemplate.DOCX(doctemplate.Title(text), text)
+		mimeType = doctemplate.MimeDOCX
+	} else {
+		data, err = doctemplate.PDF(text)
+	}
+	if err != nil {
+		s.logger.Error("Failed to render document", "template_id", template.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to render document")
+		return
+	}
+
+	if err := s.checkQuota(ctx, tenantID, middleware.GetUserID(ctx), int64(len(data)), 1); err != nil {
+		s.writeQuotaError(w, r, err)
+		return
+	}
+
+	docType := template.Kind.DocumentType()
+	doc := &domain.Document{
+		ID:               uuid.New(),
+		TenantID:         tenantID,
+		Type:             docType,
+		FileName:         fileName,
+		MimeType:         mimeType,
+		Size:             int64(len(data)),
+		Checksum:         calculateChecksum(data),
+		Bucket:           tenantID.String(),
+		ProcessingStatus: domain.ProcessingStatusCompleted,
+		ExtractedText:    text,
+		Tags:             append([]string{"generated", string(template.Kind)}, req.Tags...),
+		EntityType:       template.Entity,
+		EntityID:         req.EntityID,
+		TemplateID:       &template.ID,
+		Version:          1,
+	}
+	doc.ObjectKey = s.generateObjectKey(tenantID, string(docType), doc.ID)
+	if userID, err := uuid.Parse(middleware.GetUserID(ctx)); err == nil {
+		doc.UploadedBy = userID
+	}
+	doc.CreatedAt = time.Now()
+	doc.UpdatedAt = doc.CreatedAt
+
+	if err := s.ensureBucket(ctx, doc.Bucket); err != nil {
+		s.logger.Error("Failed to create bucket", "bucket", doc.Bucket, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to store document")
+		return
+	}
+	if err := s.storeContent(ctx, doc, data, mimeType); err != nil {
+		s.logger.Error("Failed to upload generated document", "document_id", doc.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to store document")
+		return
+	}
+	if err := s.repo.Create(ctx, doc); err != nil {
+		s.logger.Error("Failed to create document", "error", err)
+		s.releaseContent(ctx, doc.TenantID, doc.Bucket, doc.ObjectKey)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create document")
+		return
+	}
+	if err := s.search.IndexDocument(ctx, doc); err != nil {
+		s.logger.Error("Failed to index generated document", "document_id", doc.ID, "error", err)
+	}
+	if template.Entity == domain.EntityShipment {
+		s.recordDeliveryNote(ctx, doc, middleware.GetUserID(ctx))
+	}
+
+	s.logger.Info("Document generated", "document_id", doc.ID, "template_id", template.ID,
+		"entity", template.Entity, "entity_id", req.EntityID)
+	httpresponse.SetETag(w, doc.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// entityValues reads the merge field values of the tenant's client, order,
+// invoice or shipment from the ERP's read models, with those of the
+// order's, invoice's or shipment's client, and of the shipment's order.
+func (s *Service) entityValues(ctx context.Context, tenantID uuid.UUID, entity, id string) (map[string]doctemplate.Values, error) {
+	values := make(map[string]doctemplate.Values)
+	clientID := id
+	switch entity {
+	case domain.EntityOrder:
+		orderID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, apperr.NotFound("order %s not found", id)
+		}
+		var order domain.Order
+		err = s.erpDb.Collection("orders").FindOne(ctx, bson.M{"_id": orderID, "tenantId": tenantID}).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			return nil, apperr.NotFound("order %s not found", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[domain.EntityOrder] = doctemplate.OrderValues(&order)
+		clientID = order.ClientID.String()
+	case domain.EntityInvoice:
+		var invoice events.InvoiceDetail
+		err := s.erpDb.Collection("invoice_read").FindOne(ctx,
+			repository.NotDeleted(bson.M{"_id": id, "tenantId": tenantID.String()})).Decode(&invoice)
+		if err == mongo.ErrNoDocuments {
+			return nil, apperr.NotFound("invoice %s not found", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[domain.EntityInvoice] = doctemplate.InvoiceValues(&invoice)
+		clientID = invoice.ClientID
+	case domain.EntityShipment:
+		order, shipment, err := s.findShipment(ctx, tenantID, id)
+		if err != nil {
+			return nil, err
+		}
+		values[domain.EntityShipment] = doctemplate.ShipmentValues(order, shipment)
+		values[domain.EntityOrder] = doctemplate.OrderValues(order)
+		clientID = order.ClientID.String()
+	}
+
+	var client events.ClientDetail
+	err := s.erpDb.Collection("client_read").FindOne(ctx,
+		bson.M{"_id": clientID, "tenantId": tenantID.String()}).Decode(&client)
+	if err == nil {
+		err = s.openClient(&client)
+	}
+	switch {
+	case err == nil:
+		values[domain.EntityClient] = doctemplate.ClientValues(&client)
+	case err != mongo.ErrNoDocuments:
+		return nil, err
+	case entity == domain.EntityClient:
+		return nil, apperr.NotFound("client %s not found", id)
+	}
+	return values, nil
+}
+
+// openClient decrypts the contact details of a client read model.
+func (s *Service) openClient(client *events.ClientDetail) error {
+	var err error
+	if client.Email, err = s.pii.Decrypt(client.Email); err != nil {
+		return err
+	}
+	client.Phone, err = s.pii.Decrypt(client.Phone)
+	return err
+}
+
+// ensureBucket creates the bucket when it does not exist yet.
+func (s *Service) ensureBucket(ctx context.Context, bucket string) error {
+	exists, err := s.storage.BucketExists(ctx, bucket)
+	if err != nil || exists {
+		return err
+	}
+	return s.storage.CreateBucket(ctx, bucket)
+}
+
+func (s *Service) loadTemplate(w http.ResponseWriter, r *http.Request) (*domain.DocumentTemplate, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid template ID")
+		return nil, false
+	}
+	template, err := s.templates.Get(r.Context(), getTenantID(r), id)
+	if err != nil {
+		s.logger.Error("Failed to get document template", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get template")
+		return nil, false
+	}
+	if template == nil {
+		writeTemplateError(w, r, domain.ErrDocumentTemplateNotFound)
+		return nil, false
+	}
+	return template, true
+}
+
+// writeTemplateError writes the errors of defining templates and
+// generating documents from them.
+func writeTemplateError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, doctemplate.ErrSyntax) {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	var docErr *domain.DocumentError
+	if !errors.As(err, &docErr) {
+		httpresponse.Error(w, r, err)
+		return
+	}
+	status := http.StatusBadRequest
+	if docErr.Code == domain.ErrDocumentTemplateNotFound.Code {
+		status = http.StatusNotFound
+	}
+	httpresponse.ErrorStatus(w, r, status, docErr.Message)
+}
+
+type DocumentTemplateStore struct {
+	collection *mongo.Collection
+}
+
+func NewDocumentTemplateStore(db *mongo.Database) *DocumentTemplateStore {
+	return &DocumentTemplateStore{collection: db.Collection("document_templates")}
+}
+
+func (r *DocumentTemplateStore) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "kind", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetName("kind_name"),
+	})
+	return err
+}
+
+func (r *DocumentTemplateStore) Create(ctx context.Context, template *domain.DocumentTemplate) error {
+	_, err := r.collection.InsertOne(ctx, template)
+	return err
+}
+
+// Get returns the tenant's template, or nil.
+func (r *DocumentTemplateStore) Get(ctx context.Context, tenantID, id uuid.UUID) (*domain.DocumentTemplate, error) {
+	var template domain.DocumentTemplate
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&template)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// List returns the templates matching filter by name.
+func (r *DocumentTemplateStore) List(ctx context.Context, filter bson.M) ([]domain.DocumentTemplate, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	templates := []domain.DocumentTemplate{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// Update replaces template if nobody else has changed it since it was
+// read, and advances its version. It reports
+// repository.ErrConcurrencyConflict when the stored template has moved on.
+func (r *DocumentTemplateStore) Update(ctx context.Context, template *domain.DocumentTemplate) error {
+	next := *template
+	next.Version++
+	result, err := r.collection.ReplaceOne(ctx, bson.M{
+		"_id":      template.ID,
+		"tenantId": template.TenantID,
+		"version":  template.Version,
+	}, &next)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrConcurrencyConflict
+	}
+	template.Version++
+	return nil
+}
+
+func (r *DocumentTemplateStore) Delete(ctx context.Context, tenantID, id uuid.UUID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return domain.ErrDocumentTemplateNotFound
+	}
+	return nil
+}
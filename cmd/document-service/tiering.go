@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// tieringBatchSize is how many documents a tiering pass archives per rule,
+// or restores, before the next pass.
+const tieringBatchSize = 100
+
+// restoreRetryAfter is how long clients are told to wait before asking for
+// an archived document again.
+const restoreRetryAfter = "60"
+
+// tieredStorage stores objects in a storage class other than the bucket's
+// default, and brings them back from one that cannot be read directly.
+type tieredStorage interface {
+	UploadClass(ctx context.Context, bucket, objectKey string, data []byte, contentType, storageClass string) error
+	RequestRestore(ctx context.Context, bucket, objectKey string) error
+}
+
+// archiveBucket returns the bucket the archived documents of bucket are
+// kept in.
+func (s *Service) archiveBucket(bucket string) string {
+	return bucket + s.config.ArchiveBucketSuffix
+}
+
+// contentBucket returns the bucket doc's content is in.
+func (s *Service) contentBucket(doc *domain.Document) string {
+	if doc.Archived() {
+		return s.archiveBucket(doc.Bucket)
+	}
+	return doc.Bucket
+}
+
+// readContent reads a document's content. An archived document's content
+// cannot be read: its restore is requested instead, and
+// domain.ErrDocumentArchived returned.
+func (s *Service) readContent(ctx context.Context, doc *domain.Document) ([]byte, error) {
+	if doc.Archived() {
+		if err := s.requestRestore(ctx, doc); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrDocumentArchived
+	}
+	return s.storage.Download(ctx, doc.Bucket, doc.ObjectKey)
+}
+
+// openContent opens a document's content for reading, as readContent
+// reads it.
+func (s *Service) openContent(ctx context.Context, doc *domain.Document) (io.ReadCloser, error) {
+	if doc.Archived() {
+		if err := s.requestRestore(ctx, doc); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrDocumentArchived
+	}
+	return s.storage.DownloadStream(ctx, doc.Bucket, doc.ObjectKey)
+}
+
+// writeRestoring answers a download of an archived document: it is being
+// restored, and can be downloaded once it is.
+func writeRestoring(w http.ResponseWriter, doc *domain.Document) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", restoreRetryAfter)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"documentId":    doc.ID,
+		"storageClass":  domain.StorageClassArchive,
+		"restoreStatus": domain.RestoreStatusRestoring,
+	})
+}
+
+// writeArchivedError answers a request that needs an archived document's
+// content.
+func writeArchivedError(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", restoreRetryAfter)
+	httpresponse.ErrorStatus(w, r, http.StatusConflict, domain.ErrDocumentArchived.Message)
+}
+
+// requestRestore marks an archived document as restoring, once, and asks
+// the archive for its content when its storage class cannot be read
+// directly. The restore itself is left to the tiering job, which is woken.
+func (s *Service) requestRestore(ctx context.Context, doc *domain.Document) error {
+	result, err := s.docs.collection.UpdateOne(ctx, bson.M{
+		"_id":           doc.ID,
+		"tenantId":      doc.TenantID,
+		"storageClass":  domain.StorageClassArchive,
+		"restoreStatus": bson.M{"$ne": domain.RestoreStatusRestoring},
+	}, bson.M{"$set": bson.M{"restoreStatus": domain.RestoreStatusRestoring}})
+	if err != nil {
+		return err
+	}
+	doc.RestoreStatus = domain.RestoreStatusRestoring
+	if result.ModifiedCount == 0 {
+		return nil
+	}
+	s.logger.Info("Document restore requested", "document_id", doc.ID, "tenant_id", doc.TenantID)
+	if s.config.ArchiveStorageClass != "" {
+		if err := s.tiers.RequestRestore(ctx, s.archiveBucket(doc.Bucket), doc.ObjectKey); err != nil {
+			s.logger.Warn("Failed to request restore from archive", "document_id", doc.ID, "error", err)
+		}
+	}
+	select {
+	case s.restoreNow <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// runTiering archives documents by their tenant's storage policy and
+// restores those requested, every TieringInterval and whenever a restore
+// is requested, until ctx is cancelled.
+func (s *Service) runTiering(ctx context.Context) {
+	ticker := time.NewTicker(s.config.TieringInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Storage tiering started", "interval", s.config.TieringInterval)
+
+	archive := true
+	for {
+		if archive {
+			if archived, err := s.archiveDocuments(ctx, time.Now()); err != nil {
+				s.logger.Error("Failed to archive documents", "archived", archived, "error", err)
+			} else if archived > 0 {
+				s.logger.Info("Archived documents", "archived", archived)
+			}
+		}
+		if restored, err := s.restoreDocuments(ctx); err != nil {
+			s.logger.Error("Failed to restore documents", "restored", restored, "error", err)
+		} else if restored > 0 {
+			s.logger.Info("Restored documents", "restored", restored)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Storage tiering stopped")
+			return
+		case <-ticker.C:
+			archive = true
+		case <-s.restoreNow:
+			archive = false
+		}
+	}
+}
+
+// archiveDocuments moves the documents each tenant's storage policy says
+// are due to the archive, and returns how many it moved. Documents stored
+// content-addressed share their blob and stay hot.
+func (s *Service) archiveDocuments(ctx context.Context, now time.Time) (int, error) {
+	policies, err := s.storagePolicies.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	archived := 0
+	for _, policy := range policies {
+		var typed []domain.DocumentType
+		for _, rule := range policy.Rules {
+			if rule.Type != "" {
+				typed = append(typed, rule.Type)
+			}
+		}
+		for _, rule := range policy.Rules {
+			cutoff := rule.Cutoff(now)
+			filter := repository.NotDeleted(bson.M{
+				"tenantId":     policy.TenantID,
+				"storageClass": bson.M{"$ne": domain.StorageClassArchive},
+				"objectKey":    bson.M{"$not": bson.M{"$regex": "^[^/]+/cas/"}},
+				"createdAt":    bson.M{"$lte": cutoff},
+				"$or": bson.A{
+					bson.M{"restoredAt": nil},
+					bson.M{"restoredAt": bson.M{"$lte": cutoff}},
+				},
+			})
+			if rule.Type != "" {
+				filter["type"] = rule.Type
+			} else if len(typed) > 0 {
+				filter["type"] = bson.M{"$nin": typed}
+			}
+			docs, err := s.findDocuments(ctx, filter)
+			if err != nil {
+				return archived, err
+			}
+			for _, doc := range docs {
+				if err := s.archiveDocument(ctx, doc, now); err != nil {
+					s.logger.Error("Failed to archive document", "document_id", doc.ID, "error", err)
+					continue
+				}
+				archived++
+			}
+		}
+	}
+	return archived, nil
+}
+
+// archiveDocument copies doc's content to the archive and removes it from
+// hot storage once the document records the move.
+func (s *Service) archiveDocument(ctx context.Context, doc *domain.Document, now time.Time) error {
+	data, err := s.storage.Download(ctx, doc.Bucket, doc.ObjectKey)
+	if err != nil {
+		return err
+	}
+	archive := s.archiveBucket(doc.Bucket)
+	if err := s.ensureBucket(ctx, archive); err != nil {
+		return err
+	}
+	if err := s.tiers.UploadClass(ctx, archive, doc.ObjectKey, data, doc.MimeType, s.config.ArchiveStorageClass); err != nil {
+		return err
+	}
+	doc.StorageClass = domain.StorageClassArchive
+	doc.ArchivedAt = &now
+	doc.RestoreStatus = domain.RestoreStatusNone
+	if err := s.repo.Update(ctx, doc); err != nil {
+		// Changed meanwhile; it is archived on a later pass if still due.
+		s.storage.Delete(ctx, archive, doc.ObjectKey)
+		return err
+	}
+	if err := s.storage.Delete(ctx, doc.Bucket, doc.ObjectKey); err != nil {
+		s.logger.Warn("Failed to delete archived document from hot storage", "document_id", doc.ID, "error", err)
+	}
+	return nil
+}
+
+// restoreDocuments brings the documents whose restore was requested back
+// to hot storage, and returns how many it restored. Those the archive has
+// not made readable yet are tried again on the next pass.
+func (s *Service) restoreDocuments(ctx context.Context) (int, error) {
+	docs, err := s.findDocuments(ctx, bson.M{
+		"storageClass":  domain.StorageClassArchive,
+		"restoreStatus": domain.RestoreStatusRestoring,
+	})
+	if err != nil {
+		return 0, err
+	}
+	restored := 0
+	for _, doc := range docs {
+		archive := s.archiveBucket(doc.Bucket)
+		data, err := s.storage.Download(ctx, archive, doc.ObjectKey)
+		if err != nil {
+			s.logger.Debug("Archived document not readable yet", "document_id", doc.ID, "error", err)
+			continue
+		}
+		if err := s.storage.Upload(ctx, doc.Bucket, doc.ObjectKey, data, doc.MimeType); err != nil {
+			s.logger.Error("Failed to restore document", "document_id", doc.ID, "error", err)
+			continue
+		}
+		now := time.Now()
+		doc.StorageClass = domain.StorageClassHot
+		doc.ArchivedAt = nil
+		doc.RestoreStatus = domain.RestoreStatusNone
+		doc.RestoredAt = &now
+		if err := s.repo.Update(ctx, doc); err != nil {
+			s.logger.Error("Failed to record document restore", "document_id", doc.ID, "error", err)
+			continue
+		}
+		if err := s.storage.Delete(ctx, archive, doc.ObjectKey); err != nil {
+			s.logger.Warn("Failed to delete restored document from archive", "document_id", doc.ID, "error", err)
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+func (s *Service) findDocuments(ctx context.Context, filter bson.M) ([]*domain.Document, error) {
+	cursor, err := s.docs.collection.Find(ctx, filter, options.Find().SetLimit(tieringBatchSize))
+	if err != nil {
+		return nil, err
+	}
+	var docs []*domain.Document
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// retrieveDocumentHandler requests an archived document's restore ahead of
+// downloading it.
+func (s *Service) retrieveDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := s.loadDocument(w, r)
+	if !ok {
+		return
+	}
+	if !doc.Archived() {
+		httpresponse.ErrorStatus(w, r, http.StatusConflict, "Document is not archived")
+		return
+	}
+	if err := s.requestRestore(r.Context(), doc); err != nil {
+		s.logger.Error("Failed to request document restore", "document_id", doc.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to restore document")
+		return
+	}
+	writeRestoring(w, doc)
+}
+
+func (s *Service) getStoragePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	tenantID := getTenantID(r)
+	policy, err := s.storagePolicies.Get(r.Context(), tenantID)
+	if err != nil {
+		s.logger.Error("Failed to get storage policy", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get storage policy")
+		return
+	}
+	if policy == nil {
+		policy = &domain.StoragePolicy{TenantID: tenantID, Rules: []domain.StorageRule{}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// putStoragePolicyHandler replaces the tenant's storage policy. Documents
+// it makes due are archived on the tiering job's next pass.
+func (s *Service) putStoragePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rules []domain.StorageRule `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	policy := &domain.StoragePolicy{
+		TenantID:  getTenantID(r),
+		Rules:     req.Rules,
+		UpdatedAt: time.Now(),
+		UpdatedBy: middleware.GetUserID(r.Context()),
+	}
+	if policy.Rules == nil {
+		policy.Rules = []domain.StorageRule{}
+	}
+	if err := policy.Validate(); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.storagePolicies.Put(r.Context(), policy); err != nil {
+		s.logger.Error("Failed to store storage policy", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to store storage policy")
+		return
+	}
+	s.logger.Info("Storage policy updated", "tenant_id", policy.TenantID, "rules", len(policy.Rules))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// storageClassUsage is what a tenant stores in one storage class, and what
+// it costs a month.
+type storageClassUsage struct {
+	StorageClass domain.StorageClass `json:"storageClass"`
+	Documents    int64               `json:"documents"`
+	Bytes        int64               `json:"bytes"`
+	MonthlyCost  decimal.Decimal     `json:"monthlyCost"`
+}
+
+// storageUsageHandler reports how much the tenant stores in each storage
+// class, trashed documents included, its monthly cost at the configured
+// prices, and its standing against its storage quota. Content-addressed
+// documents count their shared blobs once.
+func (s *Service) storageUsageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenantID := getTenantID(r)
+
+	measured, usage, err := s.measureUsage(ctx, tenantID, time.Now())
+	if err != nil {
+		s.logger.Error("Failed to report storage usage", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to report storage usage")
+		return
+	}
+
+	total := decimal.Zero
+	for i := range usage {
+		price := s.config.StorageCostHot
+		if usage[i].StorageClass == domain.StorageClassArchive {
+			price = s.config.StorageCostArchive
+		}
+		gigabytes := decimal.NewFromInt(usage[i].Bytes).Div(decimal.NewFromInt(1 << 30))
+		usage[i].MonthlyCost = gigabytes.Mul(price).Round(2)
+		total = total.Add(usage[i].MonthlyCost)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenantId":       tenantID,
+		"currency":       s.config.StorageCostCurrency,
+		"classes":        usage,
+		"totalBytes":     measured.Bytes,
+		"totalObjects":   measured.Objects,
+		"monthlyCost":    total,
+		"quota":          measured.Quota,
+		"overageBytes":   measured.OverageBytes,
+		"overageObjects": measured.OverageObjects,
+		"overQuota":      measured.OverQuota(),
+	})
+}
+
+func (s *Service) storageUsage(ctx context.Context, tenantID uuid.UUID) ([]storageClassUsage, error) {
+	cursor, err := s.docs.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenantId": tenantID}}},
+		{{Key: "$project", Value: bson.M{
+			"class": bson.M{"$ifNull": bson.A{"$storageClass", domain.StorageClassHot}},
+			"size":  1,
+			// Blobs are counted from the blob store.
+			"blob": bson.M{"$regexMatch": bson.M{"input": "$objectKey", "regex": "^[^/]+/cas/"}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$class",
+			"documents": bson.M{"$sum": 1},
+			"bytes":     bson.M{"$sum": bson.M{"$cond": bson.A{"$blob", 0, "$size"}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Class     domain.StorageClass `bson:"_id"`
+		Documents int64               `bson:"documents"`
+		Bytes     int64               `bson:"bytes"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	blobBytes, err := s.blobs.TenantBytes(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := []storageClassUsage{
+		{StorageClass: domain.StorageClassHot, Bytes: blobBytes},
+		{StorageClass: domain.StorageClassArchive},
+	}
+	for _, group := range groups {
+		for i := range usage {
+			if usage[i].StorageClass == group.Class {
+				usage[i].Documents += group.Documents
+				usage[i].Bytes += group.Bytes
+			}
+		}
+	}
+	return usage, nil
+}
+
+// StoragePolicyStore keeps each tenant's storage policy.
+type StoragePolicyStore struct {
+	collection *mongo.Collection
+}
+
+func NewStoragePolicyStore(db *mongo.Database) *StoragePolicyStore {
+	return &StoragePolicyStore{collection: db.Collection("storage_policies")}
+}
+
+func (r *StoragePolicyStore) Get(ctx context.Context, tenantID uuid.UUID) (*domain.StoragePolicy, error) {
+	var policy domain.StoragePolicy
+	err := r.collection.FindOne(ctx, bson.M{"_id": tenantID}).Decode(&policy)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *StoragePolicyStore) Put(ctx context.Context, policy *domain.StoragePolicy) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": policy.TenantID}, policy, options.Replace().SetUpsert(true))
+	return err
+}
+
+// List returns the policies with at least one rule.
+func (r *StoragePolicyStore) List(ctx context.Context) ([]*domain.StoragePolicy, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"rules.0": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	var policies []*domain.StoragePolicy
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
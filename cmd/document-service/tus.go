@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// Resumable uploads speak tus 1.0.0 with the creation, expiration and
+// termination extensions: a client creates an upload of a known length,
+// sends its bytes in as many PATCH requests as its connection needs, and
+// after an interruption asks with HEAD where to carry on.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	// tusExposedHeaders are the response headers browser clients need to
+	// read to resume an upload.
+	tusExposedHeaders = "Location, Upload-Offset, Upload-Length, Upload-Expires, Upload-Metadata, " +
+		"Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, X-Document-ID"
+	tusContentType = "application/offset+octet-stream"
+)
+
+// tusHeaders sets the headers every tus response carries.
+func (s *Service) tusHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Tus-Resumable", tusVersion)
+	h.Set("Tus-Version", tusVersion)
+	h.Set("Tus-Extension", tusExtensions)
+	h.Set("Tus-Max-Size", strconv.FormatInt(s.config.MaxFileSize, 10))
+	// Only set for allowed origins, by the CORS middleware.
+	if exposed := h.Get("Access-Control-Expose-Headers"); exposed != "" {
+		h.Set("Access-Control-Expose-Headers", exposed+", "+tusExposedHeaders)
+	}
+}
+
+// tusRequest sets the tus response headers and checks that the client
+// speaks the protocol version the service does.
+func (s *Service) tusRequest(w http.ResponseWriter, r *http.Request) bool {
+	s.tusHeaders(w)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		httpresponse.ErrorStatus(w, r, http.StatusPreconditionFailed, "Tus-Resumable must be "+tusVersion)
+		return false
+	}
+	return true
+}
+
+// uploadProgressHeaders describes how far upload has come.
+func uploadProgressHeaders(w http.ResponseWriter, upload *domain.ResumableUpload) {
+	h := w.Header()
+	h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	h.Set("Cache-Control", "no-store")
+	if upload.CompletedAt != nil {
+		h.Set("X-Document-ID", upload.DocumentID.String())
+	} else {
+		h.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// createResumableUploadHandler starts a resumable upload of Upload-Length
+// bytes. Upload-Metadata may carry the document's filename, filetype,
+// type and comma-separated tags.
+func (s *Service) createResumableUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.tusRequest(w, r) {
+		return
+	}
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "A positive Upload-Length is required")
+		return
+	}
+	if length > s.config.MaxFileSize {
+		httpresponse.ErrorStatus(w, r, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Upload-Length exceeds the maximum of %d bytes", s.config.MaxFileSize))
+		return
+	}
+	metadata, err := domain.ParseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	tenantID := getTenantID(r)
+	userID := middleware.GetUserID(ctx)
+	if err := s.checkQuota(ctx, tenantID, userID, length, 1); err != nil {
+		s.writeQuotaError(w, r, err)
+		return
+	}
+	if err := s.ensureBucket(ctx, tenantID.String()); err != nil {
+		s.logger.Error("Failed to create bucket", "bucket", tenantID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+
+	now := time.Now()
+	upload := &domain.ResumableUpload{
+		ID:         uuid.New(),
+		TenantID:   tenantID,
+		UserID:     userID,
+		DocumentID: uuid.New(),
+		Length:     length,
+		Metadata:   metadata,
+		Parts:      []domain.UploadPart{},
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.config.TusUploadExpiry),
+	}
+	if err := s.uploads.Create(ctx, upload); err != nil {
+		s.logger.Error("Failed to create resumable upload", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+
+	s.logger.Info("Resumable upload created", "upload_id", upload.ID, "tenant_id", tenantID, "length", length)
+	w.Header().Set("Location", strings.TrimRight(r.URL.Path, "/")+"/"+upload.ID.String())
+	uploadProgressHeaders(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// headResumableUploadHandler tells a client where to resume an upload.
+func (s *Service) headResumableUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.tusRequest(w, r) {
+		return
+	}
+	upload, ok := s.loadUpload(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", encodeUploadMetadata(upload.Metadata))
+	}
+	uploadProgressHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// patchResumableUploadHandler stores the bytes of an upload sent from
+// Upload-Offset on. What arrives before the connection drops is kept, so
+// the client resumes after it. Once every byte has arrived, the document
+// is created and processed like any other; a failure to create it is
+// retried by an empty PATCH at the final offset.
+func (s *Service) patchResumableUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.tusRequest(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusContentType {
+		httpresponse.ErrorStatus(w, r, http.StatusUnsupportedMediaType, "Content-Type must be "+tusContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "A valid Upload-Offset is required")
+		return
+	}
+	upload, ok := s.loadUpload(w, r)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		httpresponse.ErrorStatus(w, r, http.StatusConflict,
+			fmt.Sprintf("Upload-Offset %d does not match the upload's offset %d", offset, upload.Offset))
+		return
+	}
+	if upload.CompletedAt != nil {
+		uploadProgressHeaders(w, upload)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ctx := r.Context()
+	remaining := upload.Length - upload.Offset
+	data, readErr := io.ReadAll(io.LimitReader(r.Body, remaining+1))
+	if int64(len(data)) > remaining {
+		httpresponse.ErrorStatus(w, r, http.StatusRequestEntityTooLarge, "The request body goes past Upload-Length")
+		return
+	}
+	if len(data) > 0 {
+		// The client may already be gone; what arrived is stored anyway.
+		stored, err := s.appendUploadPart(context.WithoutCancel(ctx), upload, data)
+		if err != nil {
+			s.logger.Error("Failed to store upload part", "upload_id", upload.ID, "error", err)
+			httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to store upload")
+			return
+		}
+		if !stored {
+			httpresponse.ErrorStatus(w, r, http.StatusConflict, "The upload was resumed by another request")
+			return
+		}
+	}
+	if readErr != nil {
+		s.logger.Info("Resumable upload interrupted", "upload_id", upload.ID, "offset", upload.Offset, "error", readErr)
+		return
+	}
+
+	if upload.Received() {
+		if err := s.completeUpload(context.WithoutCancel(ctx), upload); err != nil {
+			s.logger.Error("Failed to complete resumable upload", "upload_id", upload.ID, "error", err)
+			uploadProgressHeaders(w, upload)
+			httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create document")
+			return
+		}
+	}
+	uploadProgressHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteResumableUploadHandler abandons an upload and removes what was
+// received of it. A completed upload's document is not affected.
+func (s *Service) deleteResumableUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.tusRequest(w, r) {
+		return
+	}
+	upload, ok := s.loadUpload(w, r)
+	if !ok {
+		return
+	}
+	if err := s.removeUpload(r.Context(), upload); err != nil {
+		s.logger.Error("Failed to delete resumable upload", "upload_id", upload.ID, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to delete upload")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadUpload returns the tenant's upload named in the path. Expired
+// uploads are gone.
+func (s *Service) loadUpload(w http.ResponseWriter, r *http.Request) (*domain.ResumableUpload, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["uploadId"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Upload not found")
+		return nil, false
+	}
+	upload, err := s.uploads.Get(r.Context(), getTenantID(r), id)
+	if err != nil {
+		s.logger.Error("Failed to get resumable upload", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get upload")
+		return nil, false
+	}
+	if upload == nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Upload not found")
+		return nil, false
+	}
+	if upload.Expired(time.Now()) {
+		httpresponse.ErrorStatus(w, r, http.StatusGone, "Upload expired")
+		return nil, false
+	}
+	return upload, true
+}
+
+// appendUploadPart stores data as the part of upload at its offset, and
+// advances the upload past it, extending its expiry. It reports false,
+// storing nothing, when another request advanced the upload first.
+func (s *Service) appendUploadPart(ctx context.Context, upload *domain.ResumableUpload, data []byte) (bool, error) {
+	bucket := upload.TenantID.String()
+	part := domain.UploadPart{
+		Offset:    upload.Offset,
+		Size:      int64(len(data)),
+		ObjectKey: fmt.Sprintf("%s/uploads/%s/%d-%s", upload.TenantID, upload.ID, upload.Offset, uuid.New()),
+	}
+	if err := s.storage.Upload(ctx, bucket, part.ObjectKey, data, "application/octet-stream"); err != nil {
+		return false, err
+	}
+	expiresAt := time.Now().Add(s.config.TusUploadExpiry)
+	appended, err := s.uploads.Append(ctx, upload.ID, part, expiresAt)
+	if err != nil || !appended {
+		s.storage.Delete(ctx, bucket, part.ObjectKey)
+		return false, err
+	}
+	upload.Parts = append(upload.Parts, part)
+	upload.Offset += part.Size
+	upload.ExpiresAt = expiresAt
+	return true, nil
+}
+
+// completeUpload joins the parts of a fully received upload into its
+// document, stored and queued for processing like any other, and removes
+// the parts. Completing it twice creates the document once.
+func (s *Service) completeUpload(ctx context.Context, upload *domain.ResumableUpload) error {
+	bucket := upload.TenantID.String()
+	data := make([]byte, 0, upload.Length)
+	for _, part := range upload.Parts {
+		piece, err := s.storage.Download(ctx, bucket, part.ObjectKey)
+		if err != nil {
+			return err
+		}
+		data = append(data, piece...)
+	}
+	if int64(len(data)) != upload.Length {
+		return fmt.Errorf("upload %s has %d of %d bytes stored", upload.ID, len(data), upload.Length)
+	}
+
+	mimeType := upload.Metadata["filetype"]
+	if _, _, err := mime.ParseMediaType(mimeType); err != nil {
+		mimeType = http.DetectContentType(data)
+	}
+	fileName := path.Base("/" + upload.Metadata["filename"])
+	if fileName == "/" {
+		fileName = upload.DocumentID.String()
+	}
+	docType := domain.DocumentType(upload.Metadata["type"])
+	if docType == "" {
+		docType = domain.DocTypeOther
+	}
+	var tags []string
+	for _, tag := range strings.Split(upload.Metadata["tags"], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	now := time.Now()
+	doc := &domain.Document{
+		ID:               upload.DocumentID,
+		TenantID:         upload.TenantID,
+		Type:             docType,
+		FileName:         fileName,
+		MimeType:         mimeType,
+		Bucket:           bucket,
+		ProcessingStatus: domain.ProcessingStatusPending,
+		Tags:             tags,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Version:          1,
+	}
+	doc.ObjectKey = s.generateObjectKey(doc.TenantID, string(docType), doc.ID)
+	if userID, err := uuid.Parse(upload.UserID); err == nil {
+		doc.UploadedBy = userID
+	}
+	if err := s.storeContent(ctx, doc, data, mimeType); err != nil {
+		return err
+	}
+	queued := s.queueRenditions(doc)
+	if err := s.repo.Create(ctx, doc); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			s.releaseContent(ctx, doc.TenantID, doc.Bucket, doc.ObjectKey)
+			return err
+		}
+		// Completed meanwhile by another request, which stored the same
+		// content under the same key; only a blob reference is extra.
+		if domain.IsBlobKey(doc.ObjectKey) {
+			s.releaseContent(ctx, doc.TenantID, doc.Bucket, doc.ObjectKey)
+		}
+	} else {
+		if queued {
+			s.renderSoon()
+		}
+		s.processSoon()
+		if err := s.search.IndexDocument(ctx, doc); err != nil {
+			s.logger.Error("Failed to index document", "document_id", doc.ID, "error", err)
+		}
+		s.logger.Info("Resumable upload completed", "upload_id", upload.ID, "document_id", doc.ID,
+			"tenant_id", doc.TenantID, "parts", len(upload.Parts))
+	}
+
+	if err := s.uploads.Complete(ctx, upload.ID, now); err != nil {
+		return err
+	}
+	upload.CompletedAt = &now
+	s.deleteUploadParts(ctx, upload)
+	return nil
+}
+
+// removeUpload deletes an upload and what was received of it.
+func (s *Service) removeUpload(ctx context.Context, upload *domain.ResumableUpload) error {
+	s.deleteUploadParts(ctx, upload)
+	return s.uploads.Delete(ctx, upload.ID)
+}
+
+func (s *Service) deleteUploadParts(ctx context.Context, upload *domain.ResumableUpload) {
+	for _, part := range upload.Parts {
+		if err := s.storage.Delete(ctx, upload.TenantID.String(), part.ObjectKey); err != nil {
+			s.logger.Warn("Failed to delete upload part", "upload_id", upload.ID, "key", part.ObjectKey, "error", err)
+		}
+	}
+}
+
+// runUploadExpiry removes expired uploads every TusCleanupInterval until
+// ctx is cancelled.
+func (s *Service) runUploadExpiry(ctx context.Context) {
+	ticker := time.NewTicker(s.config.TusCleanupInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Resumable upload expiry started", "interval", s.config.TusCleanupInterval)
+
+	for {
+		if removed, err := s.expireUploads(ctx, time.Now()); err != nil {
+			s.logger.Error("Failed to expire resumable uploads", "removed", removed, "error", err)
+		} else if removed > 0 {
+			s.logger.Info("Expired resumable uploads", "removed", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Resumable upload expiry stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireUploads removes the uploads past their expiry, with what was
+// received of those never completed, and returns how many it removed.
+// Completed uploads are kept until then so clients can still look up
+// their document.
+func (s *Service) expireUploads(ctx context.Context, now time.Time) (int, error) {
+	uploads, err := s.uploads.ExpiredBefore(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, upload := range uploads {
+		if err := s.removeUpload(ctx, upload); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// encodeUploadMetadata encodes metadata as an Upload-Metadata header.
+func encodeUploadMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		if value == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ResumableUploadStore keeps the state of resumable uploads.
+type ResumableUploadStore struct {
+	collection *mongo.Collection
+}
+
+func NewResumableUploadStore(db *mongo.Database) *ResumableUploadStore {
+	return &ResumableUploadStore{collection: db.Collection("resumable_uploads")}
+}
+
+func (r *ResumableUploadStore) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiry"),
+	})
+	return err
+}
+
+func (r *ResumableUploadStore) Create(ctx context.Context, upload *domain.ResumableUpload) error {
+	_, err := r.collection.InsertOne(ctx, upload)
+	return err
+}
+
+// Get returns the tenant's upload, or nil if there is none.
+func (r *ResumableUploadStore) Get(ctx context.Context, tenantID, id uuid.UUID) (*domain.ResumableUpload, error) {
+	var upload domain.ResumableUpload
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&upload)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// Append records part as received, if the upload is still at its offset,
+// and reports whether it was.
+func (r *ResumableUploadStore) Append(ctx context.Context, id uuid.UUID, part domain.UploadPart, expiresAt time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":         id,
+		"offset":      part.Offset,
+		"completedAt": nil,
+	}, bson.M{
+		"$inc":  bson.M{"offset": part.Size},
+		"$push": bson.M{"parts": part},
+		"$set":  bson.M{"expiresAt": expiresAt},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// Complete marks an upload completed, its parts no longer stored.
+func (r *ResumableUploadStore) Complete(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"completedAt": at, "parts": bson.A{}},
+	})
+	return err
+}
+
+// ExpiredBefore returns a batch of uploads that expired before now.
+func (r *ResumableUploadStore) ExpiredBefore(ctx context.Context, now time.Time) ([]*domain.ResumableUpload, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"expiresAt": bson.M{"$lte": now}},
+		options.Find().SetLimit(tieringBatchSize))
+	if err != nil {
+		return nil, err
+	}
+	var uploads []*domain.ResumableUpload
+	if err := cursor.All(ctx, &uploads); err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func (r *ResumableUploadStore) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
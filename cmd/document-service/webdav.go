@@ -0,0 +1,838 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/net/webdav"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// webdavPath is where the tenant's documents are mounted as a drive. It
+// authenticates requests itself, since operating systems send WebDAV keys
+// with HTTP Basic authentication.
+const webdavPath = "/webdav/"
+
+// Permissions WebDAV requests are checked against.
+const (
+	permissionDocumentRead   = "document:read"
+	permissionDocumentWrite  = "document:write"
+	permissionDocumentDelete = "document:delete"
+)
+
+// davFolders are the folders at the root of the drive, one per document
+// type. They cannot be created, renamed or removed.
+var davFolders = []domain.DocumentType{
+	domain.DocTypeContract,
+	domain.DocTypeDeliveryNote,
+	domain.DocTypeInvoice,
+	domain.DocTypeOther,
+	domain.DocTypePackingSlip,
+	domain.DocTypeProofOfDelivery,
+	domain.DocTypePurchaseOrder,
+	domain.DocTypeQuote,
+	domain.DocTypeReceipt,
+	domain.DocTypeScanned,
+}
+
+// webdavHandler serves the tenant's documents over WebDAV, reading with
+// document:read, writing with document:write and deleting, to the trash,
+// with document:delete.
+func (s *Service) webdavHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := s.authenticateWebDAV(w, r)
+	if !ok {
+		return
+	}
+	permission := permissionDocumentWrite
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		permission = permissionDocumentRead
+	case http.MethodDelete:
+		permission = permissionDocumentDelete
+	}
+	if !rbac.Allows(middleware.GetPermissions(ctx), permission) {
+		httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+permission)
+		return
+	}
+
+	tenantID, err := uuid.Parse(middleware.GetTenantID(ctx))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusForbidden, "invalid tenant")
+		return
+	}
+	handler := &webdav.Handler{
+		Prefix:     strings.TrimSuffix(webdavPath, "/"),
+		FileSystem: &documentFS{s: s, tenantID: tenantID, userID: middleware.GetUserID(ctx)},
+		LockSystem: s.davLocks.forTenant(tenantID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !os.IsNotExist(err) {
+				s.logger.Warn("WebDAV request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		},
+	}
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// authenticateWebDAV accepts a WebDAV key or an access token, as the
+// password of Basic authentication or as a bearer token, and returns the
+// request's context with the caller's identity.
+func (s *Service) authenticateWebDAV(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	var token string
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	} else if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	challenge := func(msg string) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="documents", charset="UTF-8"`)
+		httpresponse.ErrorStatus(w, r, http.StatusUnauthorized, msg)
+	}
+	if token == "" {
+		challenge("authorization required")
+		return nil, false
+	}
+
+	if strings.HasPrefix(token, domain.WebDAVKeyPrefix) {
+		key, err := s.webdavKeys.FindByKey(r.Context(), token)
+		if err != nil {
+			s.logger.Error("Failed to look up WebDAV key", "error", err)
+			httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to authenticate")
+			return nil, false
+		}
+		if key == nil {
+			challenge("invalid or revoked WebDAV key")
+			return nil, false
+		}
+		if err := s.webdavKeys.Touch(r.Context(), key.ID, time.Now()); err != nil {
+			s.logger.Warn("Failed to record WebDAV key use", "key_id", key.ID, "error", err)
+		}
+		return middleware.WithIdentity(r.Context(), key.TenantID.String(), key.UserID, key.Permissions), true
+	}
+
+	claims, err := s.tokens.ValidateToken(token)
+	if err != nil {
+		challenge("invalid or expired access token")
+		return nil, false
+	}
+	if claims.TenantID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusForbidden, "access token is not bound to a tenant")
+		return nil, false
+	}
+	userID := claims.UserID
+	if userID == "" {
+		userID = claims.Subject
+	}
+	return middleware.WithIdentity(r.Context(), claims.TenantID, userID, claims.Permissions), true
+}
+
+// webdavLocks keeps the WebDAV locks of each tenant apart, as their drives
+// have the same paths.
+type webdavLocks struct {
+	mu       sync.Mutex
+	byTenant map[uuid.UUID]webdav.LockSystem
+}
+
+func newWebDAVLocks() *webdavLocks {
+	return &webdavLocks{byTenant: make(map[uuid.UUID]webdav.LockSystem)}
+}
+
+func (l *webdavLocks) forTenant(tenantID uuid.UUID) webdav.LockSystem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ls, ok := l.byTenant[tenantID]
+	if !ok {
+		ls = webdav.NewMemLS()
+		l.byTenant[tenantID] = ls
+	}
+	return ls
+}
+
+// documentFS is a tenant's documents as a WebDAV file system: a folder per
+// document type, holding its documents by file name. Writes go through the
+// same storage, trash and search index as the REST API.
+type documentFS struct {
+	s        *Service
+	tenantID uuid.UUID
+	userID   string
+}
+
+// davDocuments lists the documents shown in a folder of the drive.
+type davDocuments interface {
+	// ListFolder returns the tenant's live documents of a type, oldest
+	// first, without their extracted text.
+	ListFolder(ctx context.Context, tenantID uuid.UUID, docType domain.DocumentType) ([]domain.Document, error)
+}
+
+// davEntry is a document under the name it has on the drive.
+type davEntry struct {
+	name string
+	doc  domain.Document
+}
+
+// splitDAVPath returns the folder and file name of a path; both are empty
+// for the root and the file name is empty for a folder.
+func splitDAVPath(name string) (domain.DocumentType, string, error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "", "", nil
+	}
+	parts := strings.Split(name, "/")
+	folder := domain.DocumentType(parts[0])
+	if len(parts) > 2 || !isDAVFolder(folder) {
+		return "", "", os.ErrNotExist
+	}
+	if len(parts) == 2 {
+		return folder, parts[1], nil
+	}
+	return folder, "", nil
+}
+
+func isDAVFolder(folder domain.DocumentType) bool {
+	for _, f := range davFolders {
+		if f == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// entries lists the documents of a folder, oldest first. Documents sharing
+// a file name with an older one are told apart by the start of their ID,
+// as "name (1a2b3c4d).pdf".
+func (fs *documentFS) entries(ctx context.Context, folder domain.DocumentType) ([]davEntry, error) {
+	docs, err := fs.s.davDocs.ListFolder(ctx, fs.tenantID, folder)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]davEntry, len(docs))
+	seen := make(map[string]bool, len(docs))
+	for i, doc := range docs {
+		name := strings.NewReplacer("/", "_", "\\", "_").Replace(doc.FileName)
+		if name == "" {
+			name = doc.ID.String()
+		}
+		if seen[name] {
+			ext := path.Ext(name)
+			name = fmt.Sprintf("%s (%s)%s", strings.TrimSuffix(name, ext), doc.ID.String()[:8], ext)
+		}
+		seen[name] = true
+		entries[i] = davEntry{name: name, doc: doc}
+	}
+	return entries, nil
+}
+
+// find returns the entry of a file, or nil.
+func (fs *documentFS) find(ctx context.Context, folder domain.DocumentType, name string) (*davEntry, error) {
+	entries, err := fs.entries(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].name == name {
+			return &entries[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// load reads the whole document of an entry, for updating it.
+func (fs *documentFS) load(ctx context.Context, entry *davEntry) (*domain.Document, error) {
+	doc, err := fs.s.repo.GetByID(ctx, fs.tenantID, entry.doc.ID)
+	if err == mongo.ErrNoDocuments {
+		return nil, os.ErrNotExist
+	}
+	return doc, err
+}
+
+func (fs *documentFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if _, file, err := splitDAVPath(name); err == nil && file == "" {
+		return os.ErrExist
+	}
+	return os.ErrPermission
+}
+
+func (fs *documentFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	folder, file, err := splitDAVPath(name)
+	if err != nil {
+		return nil, err
+	}
+	writing := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if file == "" {
+		if writing {
+			return nil, os.ErrPermission
+		}
+		return &davDir{fs: fs, ctx: ctx, folder: folder}, nil
+	}
+
+	entry, err := fs.find(ctx, folder, file)
+	if err != nil {
+		return nil, err
+	}
+	if !writing {
+		if entry == nil {
+			return nil, os.ErrNotExist
+		}
+		return &davFile{fs: fs, ctx: ctx, entry: entry}, nil
+	}
+
+	switch {
+	case entry != nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, os.ErrExist
+	case entry == nil && flag&os.O_CREATE == 0:
+		return nil, os.ErrNotExist
+	case entry == nil && strings.HasPrefix(file, "."):
+		// Hidden files operating systems leave behind, such as .DS_Store
+		// and ._ resource forks, are not documents.
+		return nil, os.ErrPermission
+	}
+	w := &davWriter{fs: fs, ctx: ctx, folder: folder, name: file, entry: entry}
+	if entry != nil && flag&os.O_TRUNC == 0 {
+		data, err := fs.s.readContent(ctx, &entry.doc)
+		if err != nil {
+			return nil, err
+		}
+		w.buf.Write(data)
+	}
+	return w, nil
+}
+
+// RemoveAll moves a document to the trash. Folders cannot be removed.
+func (fs *documentFS) RemoveAll(ctx context.Context, name string) error {
+	folder, file, err := splitDAVPath(name)
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		return os.ErrPermission
+	}
+	entry, err := fs.find(ctx, folder, file)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return os.ErrNotExist
+	}
+	if err := fs.s.repo.SoftDelete(ctx, fs.tenantID, entry.doc.ID, fs.userID); err != nil {
+		if err == domain.ErrDocumentNotFound {
+			return os.ErrNotExist
+		}
+		return err
+	}
+	fs.s.search.DeleteFromIndex(ctx, fs.tenantID, entry.doc.ID)
+	return nil
+}
+
+// Rename renames a document, changing its type when it is moved to another
+// folder.
+func (fs *documentFS) Rename(ctx context.Context, oldName, newName string) error {
+	oldFolder, oldFile, err := splitDAVPath(oldName)
+	if err != nil {
+		return err
+	}
+	newFolder, newFile, err := splitDAVPath(newName)
+	if err != nil {
+		return os.ErrPermission
+	}
+	if oldFile == "" || newFile == "" || strings.HasPrefix(newFile, ".") {
+		return os.ErrPermission
+	}
+	entry, err := fs.find(ctx, oldFolder, oldFile)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return os.ErrNotExist
+	}
+	existing, err := fs.find(ctx, newFolder, newFile)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return os.ErrExist
+	}
+
+	doc, err := fs.load(ctx, entry)
+	if err != nil {
+		return err
+	}
+	doc.FileName = newFile
+	doc.Type = newFolder
+	doc.UpdatedAt = time.Now()
+	if err := fs.s.repo.Update(ctx, doc); err != nil {
+		return err
+	}
+	if err := fs.s.search.IndexDocument(ctx, doc); err != nil {
+		fs.s.logger.Error("Failed to reindex renamed document", "document_id", doc.ID, "error", err)
+	}
+	return nil
+}
+
+func (fs *documentFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	folder, file, err := splitDAVPath(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case folder == "":
+		return &davInfo{name: "/", dir: true}, nil
+	case file == "":
+		return &davInfo{name: string(folder), dir: true}, nil
+	}
+	entry, err := fs.find(ctx, folder, file)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, os.ErrNotExist
+	}
+	return entry.info(), nil
+}
+
+// save stores what was written to a file: a new document in the folder's
+// type, or a new version of the content of an existing one, processed
+// again.
+func (fs *documentFS) save(ctx context.Context, folder domain.DocumentType, name string, entry *davEntry, data []byte) error {
+	s := fs.s
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	var added, addedObjects int64 = int64(len(data)), 1
+	if entry != nil {
+		added, addedObjects = added-entry.doc.Size, 0
+	}
+	if err := s.checkQuota(ctx, fs.tenantID, fs.userID, added, addedObjects); err != nil {
+		return err
+	}
+
+	var doc *domain.Document
+	if entry == nil {
+		doc = &domain.Document{
+			ID:               uuid.New(),
+			TenantID:         fs.tenantID,
+			Type:             folder,
+			FileName:         name,
+			Bucket:           fs.tenantID.String(),
+			ProcessingStatus: domain.ProcessingStatusPending,
+			Version:          1,
+		}
+		doc.ObjectKey = s.generateObjectKey(fs.tenantID, string(folder), doc.ID)
+		if userID, err := uuid.Parse(fs.userID); err == nil {
+			doc.UploadedBy = userID
+		}
+		doc.CreatedAt = time.Now()
+		if err := s.ensureBucket(ctx, doc.Bucket); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if doc, err = fs.load(ctx, entry); err != nil {
+			return err
+		}
+		doc.ProcessingStatus = domain.ProcessingStatusPending
+		doc.ExtractedText = ""
+	}
+	doc.MimeType = mimeType
+	doc.UpdatedAt = time.Now()
+
+	previous, previousBucket, archived := doc.ObjectKey, s.contentBucket(doc), doc.Archived()
+	if err := s.storeContent(ctx, doc, data, mimeType); err != nil {
+		return err
+	}
+	// New content is stored hot, whatever tier the old content was in.
+	doc.StorageClass = domain.StorageClassHot
+	doc.ArchivedAt = nil
+	doc.RestoreStatus = domain.RestoreStatusNone
+	queued := s.queueRenditions(doc)
+	var err error
+	if entry == nil {
+		err = s.repo.Create(ctx, doc)
+	} else {
+		err = s.repo.Update(ctx, doc)
+	}
+	if err != nil {
+		if domain.IsBlobKey(doc.ObjectKey) {
+			s.releaseContent(ctx, doc.TenantID, doc.Bucket, doc.ObjectKey)
+		}
+		return err
+	}
+	if entry != nil && (archived || domain.IsBlobKey(previous) || previous != doc.ObjectKey) {
+		s.releaseContent(ctx, doc.TenantID, previousBucket, previous)
+	}
+	if queued {
+		s.renderSoon()
+	}
+	s.processSoon()
+	if err := s.search.IndexDocument(ctx, doc); err != nil {
+		s.logger.Error("Failed to index document", "document_id", doc.ID, "error", err)
+	}
+	s.logger.Info("Document saved over WebDAV", "document_id", doc.ID, "created", entry == nil)
+	return nil
+}
+
+// davInfo describes a folder or document.
+type davInfo struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	dir      bool
+	mimeType string
+	checksum string
+}
+
+func (e *davEntry) info() *davInfo {
+	return &davInfo{
+		name:     e.name,
+		size:     e.doc.Size,
+		modTime:  e.doc.UpdatedAt,
+		mimeType: e.doc.MimeType,
+		checksum: e.doc.Checksum,
+	}
+}
+
+func (i *davInfo) Name() string       { return i.name }
+func (i *davInfo) Size() int64        { return i.size }
+func (i *davInfo) ModTime() time.Time { return i.modTime }
+func (i *davInfo) IsDir() bool        { return i.dir }
+func (i *davInfo) Sys() interface{}   { return nil }
+
+func (i *davInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// ContentType implements webdav.ContentTyper, so listings need not read
+// each document.
+func (i *davInfo) ContentType(ctx context.Context) (string, error) {
+	if i.mimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.mimeType, nil
+}
+
+// ETag implements webdav.ETager with the document's checksum.
+func (i *davInfo) ETag(ctx context.Context) (string, error) {
+	if i.checksum == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + i.checksum + `"`, nil
+}
+
+// davDir is an open folder, or the root.
+type davDir struct {
+	fs      *documentFS
+	ctx     context.Context
+	folder  domain.DocumentType
+	entries []os.FileInfo
+	read    bool
+}
+
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		d.read = true
+		if d.folder == "" {
+			for _, folder := range davFolders {
+				d.entries = append(d.entries, &davInfo{name: string(folder), dir: true})
+			}
+		} else {
+			entries, err := d.fs.entries(d.ctx, d.folder)
+			if err != nil {
+				return nil, err
+			}
+			for i := range entries {
+				d.entries = append(d.entries, entries[i].info())
+			}
+		}
+	}
+	if count <= 0 {
+		infos := d.entries
+		d.entries = nil
+		return infos, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	infos := d.entries[:count]
+	d.entries = d.entries[count:]
+	return infos, nil
+}
+
+func (d *davDir) Stat() (os.FileInfo, error) {
+	if d.folder == "" {
+		return &davInfo{name: "/", dir: true}, nil
+	}
+	return &davInfo{name: string(d.folder), dir: true}, nil
+}
+
+func (d *davDir) Read([]byte) (int, error)       { return 0, os.ErrInvalid }
+func (d *davDir) Write([]byte) (int, error)      { return 0, os.ErrPermission }
+func (d *davDir) Seek(int64, int) (int64, error) { return 0, nil }
+func (d *davDir) Close() error                   { return nil }
+
+// davFile is a document open for reading. Its content is downloaded when
+// it is first read.
+type davFile struct {
+	fs      *documentFS
+	ctx     context.Context
+	entry   *davEntry
+	content *bytes.Reader
+}
+
+func (f *davFile) open() error {
+	if f.content != nil {
+		return nil
+	}
+	data, err := f.fs.s.readContent(f.ctx, &f.entry.doc)
+	if err != nil {
+		return err
+	}
+	f.content = bytes.NewReader(data)
+	return nil
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	return f.content.Read(p)
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	return f.content.Seek(offset, whence)
+}
+
+func (f *davFile) Stat() (os.FileInfo, error)         { return f.entry.info(), nil }
+func (f *davFile) Readdir(int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *davFile) Write([]byte) (int, error)          { return 0, os.ErrPermission }
+func (f *davFile) Close() error                       { return nil }
+
+// davWriter is a document open for writing. What is written is stored
+// when it is closed, up to the service's maximum file size.
+type davWriter struct {
+	fs     *documentFS
+	ctx    context.Context
+	folder domain.DocumentType
+	name   string
+	entry  *davEntry
+	buf    bytes.Buffer
+	closed bool
+}
+
+// errFileTooLarge is returned for writes past the maximum file size.
+var errFileTooLarge = errors.New("file exceeds the maximum size")
+
+func (f *davWriter) Write(p []byte) (int, error) {
+	if int64(f.buf.Len()+len(p)) > f.fs.s.config.MaxFileSize {
+		return 0, errFileTooLarge
+	}
+	return f.buf.Write(p)
+}
+
+func (f *davWriter) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	return f.fs.save(f.ctx, f.folder, f.name, f.entry, f.buf.Bytes())
+}
+
+func (f *davWriter) Stat() (os.FileInfo, error) {
+	return &davInfo{name: f.name, size: int64(f.buf.Len()), modTime: time.Now()}, nil
+}
+
+func (f *davWriter) Read([]byte) (int, error)           { return 0, os.ErrInvalid }
+func (f *davWriter) Seek(int64, int) (int64, error)     { return 0, os.ErrInvalid }
+func (f *davWriter) Readdir(int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+
+// createWebDAVKeyHandler issues the caller a WebDAV key with the document
+// permissions they hold, or only document:read when readOnly is set. The
+// secret is only returned here.
+func (s *Service) createWebDAVKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string `json:"name"`
+		ReadOnly bool   `json:"readOnly"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+	held := middleware.GetPermissions(ctx)
+	var permissions []string
+	for _, permission := range []string{permissionDocumentRead, permissionDocumentWrite, permissionDocumentDelete} {
+		if rbac.Allows(held, permission) && (!req.ReadOnly || permission == permissionDocumentRead) {
+			permissions = append(permissions, permission)
+		}
+	}
+	if len(permissions) == 0 {
+		httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+permissionDocumentRead)
+		return
+	}
+
+	key, secret, err := domain.NewWebDAVKey(getTenantID(r), middleware.GetUserID(ctx), req.Name, permissions)
+	if err != nil {
+		var docErr *domain.DocumentError
+		if errors.As(err, &docErr) {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, docErr.Message)
+			return
+		}
+		s.logger.Error("Failed to generate WebDAV key", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create WebDAV key")
+		return
+	}
+	if err := s.webdavKeys.Create(ctx, key); err != nil {
+		s.logger.Error("Failed to create WebDAV key", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to create WebDAV key")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"key": key, "secret": secret})
+}
+
+// listWebDAVKeysHandler lists the caller's WebDAV keys, latest first.
+func (s *Service) listWebDAVKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.webdavKeys.List(r.Context(), getTenantID(r), middleware.GetUserID(r.Context()))
+	if err != nil {
+		s.logger.Error("Failed to list WebDAV keys", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to list WebDAV keys")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+// revokeWebDAVKeyHandler revokes one of the caller's WebDAV keys.
+func (s *Service) revokeWebDAVKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid WebDAV key ID")
+		return
+	}
+	err = s.webdavKeys.Revoke(r.Context(), getTenantID(r), middleware.GetUserID(r.Context()), id, time.Now())
+	if err == domain.ErrWebDAVKeyNotFound {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, domain.ErrWebDAVKeyNotFound.Message)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to revoke WebDAV key", "key_id", id, "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to revoke WebDAV key")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type WebDAVKeyStore struct {
+	collection *mongo.Collection
+}
+
+func NewWebDAVKeyStore(db *mongo.Database) *WebDAVKeyStore {
+	return &WebDAVKeyStore{collection: db.Collection("webdav_keys")}
+}
+
+func (r *WebDAVKeyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "keyHash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("key_hash"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("user_keys"),
+		},
+	})
+	return err
+}
+
+func (r *WebDAVKeyStore) Create(ctx context.Context, key *domain.WebDAVKey) error {
+	_, err := r.collection.InsertOne(ctx, key)
+	return err
+}
+
+// FindByKey returns the key secret was issued as, or nil when there is none
+// or it has been revoked.
+func (r *WebDAVKeyStore) FindByKey(ctx context.Context, secret string) (*domain.WebDAVKey, error) {
+	var key domain.WebDAVKey
+	err := r.collection.FindOne(ctx, bson.M{
+		"keyHash":   domain.HashWebDAVKey(secret),
+		"revokedAt": nil,
+	}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// List returns a user's keys, latest first.
+func (r *WebDAVKeyStore) List(ctx context.Context, tenantID uuid.UUID, userID string) ([]domain.WebDAVKey, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"tenantId": tenantID, "userId": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []domain.WebDAVKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke revokes a user's key. It reports domain.ErrWebDAVKeyNotFound when
+// the user has no such key in use.
+func (r *WebDAVKeyStore) Revoke(ctx context.Context, tenantID uuid.UUID, userID string, id uuid.UUID, at time.Time) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":       id,
+		"tenantId":  tenantID,
+		"userId":    userID,
+		"revokedAt": nil,
+	}, bson.M{"$set": bson.M{"revokedAt": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrWebDAVKeyNotFound
+	}
+	return nil
+}
+
+// Touch records when a key was last used.
+func (r *WebDAVKeyStore) Touch(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedAt": at}})
+	return err
+}
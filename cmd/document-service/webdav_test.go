@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	apptest "github.com/ims-erp/system/internal/testing"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// folderDocuments lists the drive's folders from documents kept in memory.
+type folderDocuments struct {
+	*apptest.Documents
+}
+
+func (d folderDocuments) ListFolder(ctx context.Context, tenantID uuid.UUID, docType domain.DocumentType) ([]domain.Document, error) {
+	page, err := d.List(ctx, domain.DocumentFilter{TenantID: tenantID, Type: docType, Page: 1, PageSize: 1000})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(page.Documents, func(i, j int) bool {
+		return page.Documents[i].CreatedAt.Before(page.Documents[j].CreatedAt)
+	})
+	return page.Documents, nil
+}
+
+type davTest struct {
+	svc     *Service
+	docs    *apptest.Documents
+	storage *apptest.Storage
+	search  *apptest.Search
+	tokens  *auth.JWTService
+}
+
+func newDAVTest(t *testing.T) *davTest {
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	tokens := auth.NewJWTService(&config.AuthConfig{JWT_SECRET: "test-secret", AccessTokenExpiry: time.Hour, RefreshTokenExpiry: time.Hour}, log)
+	docs, storage, search := apptest.NewDocuments(), apptest.NewStorage(), apptest.NewSearch()
+	return &davTest{
+		svc: &Service{
+			config:   &Config{MaxFileSize: 1 << 20},
+			logger:   log,
+			repo:     docs,
+			storage:  storage,
+			search:   search,
+			tokens:   tokens,
+			davLocks: newWebDAVLocks(),
+			davDocs:  folderDocuments{docs},
+		},
+		docs:    docs,
+		storage: storage,
+		search:  search,
+		tokens:  tokens,
+	}
+}
+
+// token returns an access token of a user of tenantID holding permissions.
+func (d *davTest) token(t *testing.T, tenantID uuid.UUID, permissions ...string) string {
+	token, _, err := d.tokens.GenerateAccessToken(&domain.User{ID: uuid.New(), TenantID: tenantID, Permissions: permissions})
+	require.NoError(t, err)
+	return token
+}
+
+// addDocument stores a document of tenantID in folder with content.
+func (d *davTest) addDocument(t *testing.T, tenantID uuid.UUID, folder domain.DocumentType, name, content string) *domain.Document {
+	doc := &domain.Document{
+		ID:        uuid.New(),
+		TenantID:  tenantID,
+		Type:      folder,
+		FileName:  name,
+		MimeType:  "text/plain",
+		Bucket:    tenantID.String(),
+		ObjectKey: tenantID.String() + "/" + name,
+		Size:      int64(len(content)),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Version:   1,
+	}
+	require.NoError(t, d.storage.Upload(context.Background(), doc.Bucket, doc.ObjectKey, []byte(content), doc.MimeType))
+	require.NoError(t, d.docs.Create(context.Background(), doc))
+	return doc
+}
+
+// serve sends a WebDAV request with a Basic authentication password, as
+// operating systems do, and returns the response.
+func (d *davTest) serve(method, path, password, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if password != "" {
+		req.SetBasicAuth("user", password)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	d.svc.webdavHandler(rec, req)
+	return rec
+}
+
+func TestWebDAV_RejectsUnauthenticated(t *testing.T) {
+	d := newDAVTest(t)
+	refresh, _, err := d.tokens.GenerateRefreshToken(uuid.NewString(), uuid.NewString())
+	require.NoError(t, err)
+	other := auth.NewJWTService(&config.AuthConfig{JWT_SECRET: "other-secret", AccessTokenExpiry: time.Hour}, d.svc.logger)
+	forged, _, err := other.GenerateAccessToken(&domain.User{ID: uuid.New(), TenantID: uuid.New(), Permissions: []string{"*"}})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name     string
+		password string
+		status   int
+	}{
+		{"no credentials", "", http.StatusUnauthorized},
+		{"malformed token", "not-a-token", http.StatusUnauthorized},
+		{"token signed with another secret", forged, http.StatusUnauthorized},
+		{"refresh token", refresh, http.StatusForbidden},
+	} {
+		rec := d.serve("PROPFIND", "/webdav/", tt.password, "", map[string]string{"Depth": "1"})
+		assert.Equal(t, tt.status, rec.Code, tt.name)
+		if tt.status == http.StatusUnauthorized {
+			assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic", tt.name)
+		}
+	}
+}
+
+func TestWebDAV_PropfindListsTenantFolder(t *testing.T) {
+	d := newDAVTest(t)
+	tenantA, tenantB := uuid.New(), uuid.New()
+	d.addDocument(t, tenantA, domain.DocTypeInvoice, "inv-1.txt", "first")
+	d.addDocument(t, tenantA, domain.DocTypeInvoice, "inv-1.txt", "second")
+	d.addDocument(t, tenantA, domain.DocTypeContract, "contract.txt", "terms")
+	d.addDocument(t, tenantB, domain.DocTypeInvoice, "tenant-b.txt", "secret")
+	token := d.token(t, tenantA, permissionDocumentRead)
+
+	rec := d.serve("PROPFIND", "/webdav/", token, "", map[string]string{"Depth": "1"})
+	require.Equal(t, http.StatusMultiStatus, rec.Code)
+	for _, folder := range davFolders {
+		assert.Contains(t, rec.Body.String(), "/webdav/"+string(folder)+"/")
+	}
+
+	rec = d.serve("PROPFIND", "/webdav/invoice/", token, "", map[string]string{"Depth": "1"})
+	require.Equal(t, http.StatusMultiStatus, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "/webdav/invoice/inv-1.txt")
+	assert.Contains(t, body, "/webdav/invoice/inv-1%20%28", "a second file of the same name is told apart by its ID")
+	assert.NotContains(t, body, "contract.txt")
+	assert.NotContains(t, body, "tenant-b.txt")
+}
+
+func TestWebDAV_TenantIsolation(t *testing.T) {
+	d := newDAVTest(t)
+	tenantA, tenantB := uuid.New(), uuid.New()
+	doc := d.addDocument(t, tenantB, domain.DocTypeInvoice, "tenant-b.txt", "secret")
+	token := d.token(t, tenantA, permissionDocumentRead, permissionDocumentWrite, permissionDocumentDelete)
+
+	rec := d.serve(http.MethodGet, "/webdav/invoice/tenant-b.txt", token, "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	rec = d.serve(http.MethodDelete, "/webdav/invoice/tenant-b.txt", token, "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// x/net/webdav answers any failed rename with 403.
+	rec = d.serve("MOVE", "/webdav/invoice/tenant-b.txt", token, "", map[string]string{"Destination": "/webdav/other/mine.txt"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	stored, err := d.docs.GetByID(context.Background(), tenantB, doc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant-b.txt", stored.FileName)
+	assert.Equal(t, domain.DocTypeInvoice, stored.Type)
+
+	// The header a REST client might send does not switch tenants.
+	rec = d.serve(http.MethodGet, "/webdav/invoice/tenant-b.txt", token, "", map[string]string{"X-Tenant-ID": tenantB.String()})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestWebDAV_PutCreatesDocument(t *testing.T) {
+	d := newDAVTest(t)
+	tenantID := uuid.New()
+	token := d.token(t, tenantID, permissionDocumentRead, permissionDocumentWrite)
+
+	rec := d.serve(http.MethodPut, "/webdav/receipt/lunch.txt", token, "Total: 12.50", nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	page, err := d.docs.List(context.Background(), domain.DocumentFilter{TenantID: tenantID, Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	doc := page.Documents[0]
+	assert.Equal(t, domain.DocTypeReceipt, doc.Type)
+	assert.Equal(t, "lunch.txt", doc.FileName)
+	assert.Equal(t, domain.ProcessingStatusPending, doc.ProcessingStatus)
+	assert.Equal(t, int64(len("Total: 12.50")), doc.Size)
+	assert.Equal(t, calculateChecksum([]byte("Total: 12.50")), doc.Checksum)
+	assert.Equal(t, []byte("Total: 12.50"), d.storage.Object(doc.Bucket, doc.ObjectKey))
+	assert.True(t, d.search.Indexed(doc.ID))
+
+	rec = d.serve(http.MethodGet, "/webdav/receipt/lunch.txt", token, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Total: 12.50", rec.Body.String())
+
+	// Hidden files operating systems write are not documents.
+	assert.Equal(t, http.StatusNotFound, d.serve(http.MethodPut, "/webdav/receipt/.DS_Store", token, "x", nil).Code)
+	page, err = d.docs.List(context.Background(), domain.DocumentFilter{TenantID: tenantID, Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Documents, 1)
+}
+
+func TestWebDAV_PermissionChecks(t *testing.T) {
+	d := newDAVTest(t)
+	tenantID := uuid.New()
+	doc := d.addDocument(t, tenantID, domain.DocTypeInvoice, "inv.txt", "invoice")
+	reader := d.token(t, tenantID, permissionDocumentRead)
+	writer := d.token(t, tenantID, permissionDocumentRead, permissionDocumentWrite)
+	deleter := d.token(t, tenantID, permissionDocumentRead, permissionDocumentWrite, permissionDocumentDelete)
+	move := map[string]string{"Destination": "/webdav/other/renamed.txt"}
+
+	assert.Equal(t, http.StatusForbidden, d.serve(http.MethodGet, "/webdav/invoice/inv.txt", d.token(t, tenantID), "", nil).Code)
+	assert.Equal(t, http.StatusForbidden, d.serve(http.MethodPut, "/webdav/invoice/new.txt", reader, "x", nil).Code)
+	assert.Equal(t, http.StatusForbidden, d.serve("MOVE", "/webdav/invoice/inv.txt", reader, "", move).Code)
+	assert.Equal(t, http.StatusForbidden, d.serve(http.MethodDelete, "/webdav/invoice/inv.txt", reader, "", nil).Code)
+	assert.Equal(t, http.StatusForbidden, d.serve(http.MethodDelete, "/webdav/invoice/inv.txt", writer, "", nil).Code)
+
+	stored, err := d.docs.GetByID(context.Background(), tenantID, doc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "inv.txt", stored.FileName)
+
+	rec := d.serve("MOVE", "/webdav/invoice/inv.txt", writer, "", move)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	stored, err = d.docs.GetByID(context.Background(), tenantID, doc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed.txt", stored.FileName)
+	assert.Equal(t, domain.DocTypeOther, stored.Type)
+
+	rec = d.serve(http.MethodDelete, "/webdav/other/renamed.txt", deleter, "", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	_, err = d.docs.GetByID(context.Background(), tenantID, doc.ID)
+	assert.Error(t, err, "deleted documents go to the trash")
+	assert.False(t, d.search.Indexed(doc.ID))
+}
@@ -0,0 +1,39 @@
+package main
+
+import "github.com/ims-erp/system/internal/export"
+
+// inventoryExport exports stock records from the inventory collection for
+// POST /api/v1/inventory/exports.
+var inventoryExport = export.Source{
+	Name:       "inventory",
+	Collection: "inventory",
+	Columns: []export.Column{
+		{Header: "Item ID", Field: "_id"},
+		{Header: "SKU", Field: "sku"},
+		{Header: "Product ID", Field: "productId"},
+		{Header: "Warehouse ID", Field: "warehouseId"},
+		{Header: "Location ID", Field: "locationId"},
+		{Header: "Bin ID", Field: "binId"},
+		{Header: "Lot Number", Field: "lotNumber"},
+		{Header: "Serial Number", Field: "serialNumber"},
+		{Header: "Batch Number", Field: "batchNumber"},
+		{Header: "Expiration Date", Field: "expirationDate"},
+		{Header: "Status", Field: "status"},
+		{Header: "Quantity", Field: "quantity"},
+		{Header: "Reserved", Field: "reservedQty"},
+		{Header: "Available", Field: "availableQty"},
+		{Header: "Allocated", Field: "allocatedQty"},
+		{Header: "Unit Cost", Field: "unitCost", Number: true},
+		{Header: "Total Value", Field: "totalValue", Number: true},
+		{Header: "Last Counted", Field: "lastCountedAt"},
+		{Header: "Updated", Field: "updatedAt"},
+	},
+	Filters: map[string]string{
+		"productId":   "productId",
+		"warehouseId": "warehouseId",
+		"status":      "status",
+		"sku":         "sku",
+	},
+	DateField: "updatedAt",
+	Sort:      "sku",
+}
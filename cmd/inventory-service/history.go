@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/timezone"
+)
+
+// historyColumns are the columns of the CSV form of a product's history.
+var historyColumns = []string{
+	"Transaction ID", "Date", "Movement Type", "Warehouse ID", "Location ID",
+	"Quantity", "Change", "Balance", "Warehouse Balance",
+	"Reference Type", "Reference ID", "Lot Number", "Serial Number", "Reason", "Performed By",
+}
+
+// handleProducts serves GET /api/v1/inventory/products/{id}/history and
+// GET /api/v1/inventory/products/{id}/stock.
+func (s *InventoryService) handleProducts(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/inventory/products/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || (parts[1] != "history" && parts[1] != "stock") {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if parts[1] == "stock" {
+		s.getProductStock(w, r, parts[0])
+		return
+	}
+	s.getProductHistory(w, r, parts[0])
+}
+
+func (s *InventoryService) getProductHistory(w http.ResponseWriter, r *http.Request, productID string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	params := r.URL.Query()
+
+	loc, err := timezone.FromRequest(r, s.config.I18n.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
+		return
+	}
+
+	query := &queries.GetProductHistoryQuery{
+		TenantID:    tenantID,
+		ProductID:   productID,
+		WarehouseID: params.Get("warehouseId"),
+		LocationID:  params.Get("locationId"),
+		Page:        parseInt(params.Get("page"), 1),
+		PageSize:    parseInt(params.Get("pageSize"), 100),
+	}
+	for _, value := range params["movementType"] {
+		for _, movementType := range strings.Split(value, ",") {
+			if movementType = strings.TrimSpace(movementType); movementType != "" {
+				query.MovementTypes = append(query.MovementTypes, movementType)
+			}
+		}
+	}
+	if value := params.Get("startDate"); value != "" {
+		from, err := timezone.ParseBound(value, loc, false)
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid startDate format")
+			return
+		}
+		query.From = &from
+	}
+	if value := params.Get("endDate"); value != "" {
+		to, err := timezone.ParseBound(value, loc, true)
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid endDate format")
+			return
+		}
+		query.To = &to
+	}
+
+	if params.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		s.writeProductHistoryCSV(w, r, query, loc)
+		return
+	}
+
+	history, err := queries.GetProductHistory(r.Context(), s.transactions, query)
+	if err != nil {
+		s.logger.Error("Failed to load product history", "error", err, "product_id", productID)
+		httpresponse.Error(w, r, err)
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, history)
+}
+
+// writeProductHistoryCSV streams every selected entry, without paging. Dates
+// are written in loc. Errors after the first row can no longer change the
+// status, so they end the file early and are only logged.
+func (s *InventoryService) writeProductHistoryCSV(w http.ResponseWriter, r *http.Request, query *queries.GetProductHistoryQuery, loc *time.Location) {
+	var out *csv.Writer
+	start := func() error {
+		if out != nil {
+			return nil
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="product-%s-history.csv"`, query.ProductID))
+		out = csv.NewWriter(w)
+		return out.Write(historyColumns)
+	}
+
+	_, _, err := queries.EachProductHistoryEntry(r.Context(), s.transactions, query, func(entry queries.LedgerEntry) error {
+		if err := start(); err != nil {
+			return err
+		}
+		return out.Write([]string{
+			entry.TransactionID,
+			entry.CreatedAt.In(loc).Format(time.RFC3339),
+			entry.MovementType,
+			entry.WarehouseID,
+			entry.LocationID,
+			strconv.Itoa(entry.Quantity),
+			strconv.Itoa(entry.Change),
+			strconv.Itoa(entry.Balance),
+			strconv.Itoa(entry.WarehouseBalance),
+			entry.ReferenceType,
+			entry.ReferenceID,
+			entry.LotNumber,
+			entry.SerialNumber,
+			entry.Reason,
+			entry.PerformedBy,
+		})
+	})
+	if err != nil && out == nil {
+		s.logger.Error("Failed to load product history", "error", err, "product_id", query.ProductID)
+		httpresponse.Error(w, r, err)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Product history export interrupted", "error", err, "product_id", query.ProductID)
+	} else if err := start(); err != nil {
+		s.logger.Error("Failed to write product history", "error", err, "product_id", query.ProductID)
+	}
+	out.Flush()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/timezone"
+)
+
+// intrastatColumns are the columns of the CSV form of an Intrastat report.
+var intrastatColumns = []string{
+	"Flow", "Partner Country", "Commodity Code", "Country of Origin", "Nature of Transaction",
+	"Net Mass (kg)", "Supplementary Units", "Invoice Value", "Currency",
+}
+
+// intrastatDeclaration is the XML form of an Intrastat report.
+type intrastatDeclaration struct {
+	XMLName          xml.Name                `xml:"IntrastatDeclaration"`
+	Period           string                  `xml:"period,attr"`
+	DeclarantCountry string                  `xml:"DeclarantCountry"`
+	VATNumber        string                  `xml:"VATNumber,omitempty"`
+	Items            []queries.IntrastatLine `xml:"Item"`
+}
+
+// handleIntrastatReport serves GET /api/v1/inventory/reports/intrastat.
+func (s *InventoryService) handleIntrastatReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	tenantUUID, err := uuid.Parse(tenantID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	loc, err := timezone.FromRequest(r, s.config.I18n.LocationFor(tenantID))
+	if err != nil {
+		httpresponse.Error(w, r, err)
+		return
+	}
+
+	params := r.URL.Query()
+	declarant := s.config.Intrastat.DeclarantFor(tenantID)
+	report, err := queries.GetIntrastatReport(r.Context(), s.intrastat, &queries.GetIntrastatReportQuery{
+		TenantID:         tenantUUID,
+		DeclarantCountry: declarant.Country,
+		VATNumber:        declarant.VATNumber,
+		Period:           params.Get("period"),
+		Flow:             params.Get("flow"),
+		Location:         loc,
+	})
+	if err != nil {
+		s.logger.Error("Failed to build Intrastat report", "error", err, "tenant_id", tenantID)
+		httpresponse.Error(w, r, err)
+		return
+	}
+
+	// Files only hold declarable lines; the header tells whether movements
+	// were left out, which the JSON form lists under issues.
+	w.Header().Set("X-Intrastat-Issues", strconv.Itoa(len(report.Issues)))
+	filename := fmt.Sprintf("intrastat-%s-%s", declarant.Country, report.Period)
+	accept := r.Header.Get("Accept")
+	switch format := params.Get("format"); {
+	case format == "csv" || (format == "" && strings.Contains(accept, "text/csv")):
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		out := csv.NewWriter(w)
+		out.Write(intrastatColumns)
+		for _, line := range report.Lines {
+			out.Write([]string{
+				string(line.Flow),
+				line.PartnerCountry,
+				line.CommodityCode,
+				line.CountryOfOrigin,
+				line.NatureOfTransaction,
+				line.NetMass.String(),
+				strconv.Itoa(line.SupplementaryUnits),
+				line.Value.String(),
+				line.Currency,
+			})
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			s.logger.Error("Failed to write Intrastat report", "error", err, "tenant_id", tenantID)
+		}
+	case format == "xml" || (format == "" && strings.Contains(accept, "xml")):
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xml"`, filename))
+		w.Write([]byte(xml.Header))
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(intrastatDeclaration{
+			Period:           report.Period,
+			DeclarantCountry: report.DeclarantCountry,
+			VATNumber:        report.VATNumber,
+			Items:            report.Lines,
+		}); err != nil {
+			s.logger.Error("Failed to write Intrastat report", "error", err, "tenant_id", tenantID)
+		}
+	default:
+		httpresponse.JSON(w, http.StatusOK, report)
+	}
+}
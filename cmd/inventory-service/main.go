@@ -5,97 +5,63 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
 	"strconv"
-	"syscall"
 	"time"
 
+	"github.com/ims-erp/system/internal/auth"
 	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/export"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 	"github.com/ims-erp/system/pkg/tracer"
 )
 
-var allowedOrigins = []string{
-	"http://localhost:5173",
-	"http://localhost:5178",
-	"http://localhost:5174",
-	"http://localhost:5175",
-	"http://localhost:5176",
-	"http://localhost:5177",
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		isAllowed := false
-		for _, o := range allowedOrigins {
-			if origin == o {
-				isAllowed = true
-				break
-			}
-		}
-
-		if isAllowed {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Max-Age", "86400")
-		}
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-func corsOptionsHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		isAllowed := false
-		for _, o := range allowedOrigins {
-			if origin == o {
-				isAllowed = true
-				break
-			}
-		}
-
-		if isAllowed {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Max-Age", "86400")
-		}
-
-		w.WriteHeader(http.StatusNoContent)
-	}
-}
-
 type InventoryService struct {
-	config *config.Config
-	logger *logger.Logger
-}
-
-func NewInventoryService(cfg *config.Config, log *logger.Logger) *InventoryService {
+	config       *config.Config
+	logger       *logger.Logger
+	mongodb      *repository.MongoDB
+	redis        *repository.Redis
+	subscriber   messaging.EventSubscriber
+	cache        *repository.Cache
+	exporter     *export.Exporter
+	transactions *repository.InventoryTransactionStore
+	intrastat    *repository.IntrastatStore
+	throttle     *middleware.Throttle
+}
+
+func NewInventoryService(cfg *config.Config, log *logger.Logger, mongodb *repository.MongoDB, redis *repository.Redis, subscriber messaging.EventSubscriber, exporter *export.Exporter) *InventoryService {
 	return &InventoryService{
-		config: cfg,
-		logger: log,
+		config:       cfg,
+		logger:       log,
+		mongodb:      mongodb,
+		redis:        redis,
+		subscriber:   subscriber,
+		cache:        repository.NewCache(redis, "t:"+cfg.MongoDB.Database, log),
+		exporter:     exporter,
+		transactions: repository.NewInventoryTransactionStore(mongodb),
+		intrastat:    repository.NewIntrastatStore(mongodb),
+		throttle:     middleware.NewThrottle(repository.NewRateLimiter(redis, log), cfg.Security.Throttle, log),
 	}
 }
 
 func (s *InventoryService) setupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/health", s.healthHandler)
-	mux.HandleFunc("/ready", s.readinessHandler)
+	// MongoDB is only used for exports, product history and stock and
+	// Intrastat so far, Redis and messaging for the stock cache; stores and
+	// transports the service opens should be added here.
+	checks := health.NewHealthChecker(s.config, s.mongodb, s.redis, s.logger)
+	checks.AddComponent("messaging", health.MessagingCheck(s.subscriber))
+	mux.Handle("/health", checks.Handler())
+	mux.Handle("/ready", checks.Readiness().Handler())
 	mux.HandleFunc("/live", s.livenessHandler)
-	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.Handle("/metrics", metrics.Handler())
 
 	mux.HandleFunc("/api/v1/inventory/items", s.handleInventoryItems)
 	mux.HandleFunc("/api/v1/inventory/transactions", s.handleTransactions)
@@ -103,22 +69,16 @@ func (s *InventoryService) setupRoutes() http.Handler {
 	mux.HandleFunc("/api/v1/inventory/reservations", s.handleReservations)
 	mux.HandleFunc("/api/v1/inventory/adjustments", s.handleAdjustments)
 	mux.HandleFunc("/api/v1/inventory/levels", s.handleLevels)
-	mux.HandleFunc("/api/v1/inventory/reports/stock", s.handleStockReport)
-	mux.HandleFunc("/api/v1/inventory/reports/movements", s.handleMovementsReport)
-
-	return mux
-}
+	mux.HandleFunc("/api/v1/inventory/products/", s.handleProducts)
+	mux.Handle("/api/v1/inventory/reports/stock", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleStockReport)))
+	mux.Handle("/api/v1/inventory/reports/movements", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleMovementsReport)))
+	mux.Handle("/api/v1/inventory/reports/intrastat", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleIntrastatReport)))
 
-func (s *InventoryService) healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "healthy", "timestamp": "%s", "service": "inventory-service"}`, time.Now().UTC())
-}
+	exports := s.throttle.Limit(middleware.ThrottleExport, s.exporter.Handler("/api/v1/inventory/exports"), http.MethodPost)
+	mux.Handle("/api/v1/inventory/exports", exports)
+	mux.Handle("/api/v1/inventory/exports/", exports)
 
-func (s *InventoryService) readinessHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "ready", "timestamp": "%s"}`, time.Now().UTC())
+	return mux
 }
 
 func (s *InventoryService) livenessHandler(w http.ResponseWriter, r *http.Request) {
@@ -127,17 +87,6 @@ func (s *InventoryService) livenessHandler(w http.ResponseWriter, r *http.Reques
 	fmt.Fprintf(w, `{"status": "alive", "timestamp": "%s"}`, time.Now().UTC())
 }
 
-func (s *InventoryService) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "# Inventory Service Metrics\n")
-	fmt.Fprintf(w, "inventory_service_up 1\n")
-	fmt.Fprintf(w, "inventory_service_requests_total 0\n")
-	fmt.Fprintf(w, "inventory_service_items_total 0\n")
-	fmt.Fprintf(w, "inventory_service_transactions_total 0\n")
-	fmt.Fprintf(w, "inventory_service_warehouses_total 0\n")
-}
-
 func (s *InventoryService) handleInventoryItems(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -145,7 +94,7 @@ func (s *InventoryService) handleInventoryItems(w http.ResponseWriter, r *http.R
 	case http.MethodPost:
 		s.createInventoryItem(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -156,7 +105,7 @@ func (s *InventoryService) handleTransactions(w http.ResponseWriter, r *http.Req
 	case http.MethodPost:
 		s.createTransaction(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -167,7 +116,7 @@ func (s *InventoryService) handleWarehouses(w http.ResponseWriter, r *http.Reque
 	case http.MethodPost:
 		s.createWarehouse(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -178,7 +127,7 @@ func (s *InventoryService) handleReservations(w http.ResponseWriter, r *http.Req
 	case http.MethodPost:
 		s.createReservation(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -186,7 +135,7 @@ func (s *InventoryService) handleAdjustments(w http.ResponseWriter, r *http.Requ
 	if r.Method == http.MethodPost {
 		s.createAdjustment(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -194,7 +143,7 @@ func (s *InventoryService) handleLevels(w http.ResponseWriter, r *http.Request)
 	if r.Method == http.MethodGet {
 		s.getInventoryLevels(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -202,7 +151,7 @@ func (s *InventoryService) handleStockReport(w http.ResponseWriter, r *http.Requ
 	if r.Method == http.MethodGet {
 		s.generateStockReport(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -210,12 +159,12 @@ func (s *InventoryService) handleMovementsReport(w http.ResponseWriter, r *http.
 	if r.Method == http.MethodGet {
 		s.generateMovementsReport(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
 func (s *InventoryService) listInventoryItems(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	productID := r.URL.Query().Get("productId")
 	warehouseID := r.URL.Query().Get("warehouseId")
 	page := parseInt(r.URL.Query().Get("page"), 1)
@@ -238,7 +187,7 @@ func (s *InventoryService) createInventoryItem(w http.ResponseWriter, r *http.Re
 }
 
 func (s *InventoryService) listTransactions(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	productID := r.URL.Query().Get("productId")
 	startDate := r.URL.Query().Get("startDate")
 	endDate := r.URL.Query().Get("endDate")
@@ -259,7 +208,7 @@ func (s *InventoryService) createTransaction(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *InventoryService) listWarehouses(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 
 	_ = tenantID
 
@@ -274,7 +223,7 @@ func (s *InventoryService) createWarehouse(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *InventoryService) listReservations(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	status := r.URL.Query().Get("status")
 
 	_ = tenantID
@@ -297,7 +246,7 @@ func (s *InventoryService) createAdjustment(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *InventoryService) getInventoryLevels(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	productID := r.URL.Query().Get("productId")
 	warehouseID := r.URL.Query().Get("warehouseId")
 
@@ -310,7 +259,7 @@ func (s *InventoryService) getInventoryLevels(w http.ResponseWriter, r *http.Req
 }
 
 func (s *InventoryService) generateStockReport(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	warehouseID := r.URL.Query().Get("warehouseId")
 	includeZeroStock := r.URL.Query().Get("includeZeroStock") == "true"
 
@@ -323,7 +272,7 @@ func (s *InventoryService) generateStockReport(w http.ResponseWriter, r *http.Re
 }
 
 func (s *InventoryService) generateMovementsReport(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	startDate := r.URL.Query().Get("startDate")
 	endDate := r.URL.Query().Get("endDate")
 	groupBy := r.URL.Query().Get("groupBy")
@@ -355,6 +304,10 @@ func main() {
 	}
 	defer log.Sync()
 
+	group := lifecycle.New(log)
+
+	metrics.Initialize(cfg.App.Name)
+
 	tr, err := tracer.New(tracer.Config{
 		Enabled:      cfg.Tracing.Enabled,
 		ServiceName:  cfg.App.Name,
@@ -369,9 +322,66 @@ func main() {
 	}
 	defer tr.Shutdown(context.Background())
 
-	service := NewInventoryService(cfg, log)
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		log.Error("Failed to connect to MongoDB", "error", err)
+		os.Exit(1)
+	}
+	defer mongodb.Close(context.Background())
+	log.Info("Connected to MongoDB")
+
+	redis, err := repository.NewRedis(cfg.Redis, log)
+	if err != nil {
+		log.Error("Failed to connect to Redis", "error", err)
+		os.Exit(1)
+	}
+	defer redis.Close()
+	log.Info("Connected to Redis")
+
+	subscriber, err := messaging.NewEventSubscriber(cfg, log)
+	if err != nil {
+		log.Error("Failed to create event subscriber", "error", err, "transport", cfg.Messaging.Transport)
+		os.Exit(1)
+	}
+	defer subscriber.Close()
+	group.OnShutdown("subscriber", subscriber.Drain)
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
+
+	files, err := export.NewStorage(cfg.MinIO)
+	if err != nil {
+		log.Error("Failed to configure MinIO", "error", err)
+		os.Exit(1)
+	}
+	exporter := export.NewExporter(mongodb, files, cfg.Exports, log, inventoryExport)
+	if err := exporter.Setup(context.Background()); err != nil {
+		log.Warn("Failed to set up exports", "error", err)
+	}
+	group.Go("export worker", exporter.Run)
+
+	service := NewInventoryService(cfg, log, mongodb, redis, subscriber, exporter)
+	if err := service.transactions.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create inventory transaction indexes", "error", err)
+	}
+	if err := service.intrastat.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create Intrastat indexes", "error", err)
+	}
+	// The cache is shared by every replica, so one of them evicting a
+	// product's stock is enough.
+	for _, subject := range stockSubjects {
+		if err := subscriber.SubscribeGroup(group.Context(), subject, "inventory-stock-cache", createStockEventHandler(service.cache, log)); err != nil {
+			log.Error("Failed to subscribe", "error", err, "subject", subject)
+			os.Exit(1)
+		}
+	}
 	mux := service.setupRoutes()
-	handler := corsMiddleware(mux)
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		log.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	handler := metrics.HTTPMiddleware(middleware.Instrument(log, middleware.NewCORSMiddleware(&cfg.Security).Handler(tenants.Handler(mux))))
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
@@ -379,6 +389,7 @@ func main() {
 		ReadTimeout:  cfg.App.ReadTimeout,
 		WriteTimeout: cfg.App.WriteTimeout,
 	}
+	group.OnShutdown("http server", srv.Shutdown)
 
 	go func() {
 		log.Info("Starting inventory service", "port", cfg.App.Port)
@@ -388,20 +399,11 @@ func main() {
 		}
 	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Info("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.App.ShutdownTimeout)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Error("Server forced to shutdown", "error", err)
+	sig := group.WaitForSignal()
+	log.Info("Shutting down", "signal", sig)
+	if err := group.Shutdown(cfg.App.ShutdownTimeout); err != nil {
+		log.Error("Shutdown incomplete", "error", err)
 	}
-
-	log.Info("Server stopped")
 }
 
 func parseInt(s string, defaultVal int) int {
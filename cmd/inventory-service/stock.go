@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// stockSubjects carry the events of every movement that changes a product's
+// stock; each names the product in its data.
+var stockSubjects = []string{
+	"evt.InventoryTransaction.>",
+	"evt.InventoryAdjustment.>",
+	"evt.StockReservation.>",
+}
+
+func (s *InventoryService) getProductStock(w http.ResponseWriter, r *http.Request, productID string) {
+	query := &queries.GetProductStockQuery{
+		TenantID:    middleware.GetTenantID(r.Context()),
+		ProductID:   productID,
+		WarehouseID: r.URL.Query().Get("warehouseId"),
+	}
+	stock, err := queries.GetProductStock(r.Context(), s.transactions, s.cache, s.config.Inventory.StockCacheTTL, query)
+	if err != nil {
+		s.logger.Error("Failed to load product stock", "error", err, "product_id", productID)
+		httpresponse.Error(w, r, err)
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, stock)
+}
+
+// createStockEventHandler evicts the cached stock of the product an event
+// moved. A failed eviction is only logged: the cached view expires anyway.
+func createStockEventHandler(cache *repository.Cache, log *logger.Logger) messaging.DeliveryHandler {
+	return func(ctx context.Context, msg *messaging.Delivery) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		productID, _ := event.Data["productId"].(string)
+		if productID == "" {
+			return nil
+		}
+		if err := cache.InvalidateEntity(ctx, queries.ProductStockCacheEntity, "", productID); err != nil {
+			log.New(ctx).Warn("Failed to evict cached product stock",
+				"error", err,
+				"product_id", productID,
+				"event_type", event.Type,
+			)
+		}
+		return nil
+	}
+}
@@ -1,26 +1,51 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	_ "embed"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/google/uuid"
 )
 
+// defaultScenarios is used when no -scenarios file is given.
+//
+//go:embed scenarios.yaml
+var defaultScenarios []byte
+
 // LoadTestConfig holds configuration for load testing
 type LoadTestConfig struct {
-	BaseURL         string
-	ConcurrentUsers int
-	TestDuration    time.Duration
-	RampUpTime      time.Duration
-	TenantID        string
+	*ScenarioFile
+	TenantID string
+	Manifest *SeedManifest
+}
+
+// SeedManifest lists records created by cmd/seed. With one loaded, scenarios
+// reference existing clients, invoices and payments instead of random IDs.
+type SeedManifest struct {
+	TenantID string   `json:"tenantId"`
+	Clients  []string `json:"clients"`
+	Invoices []string `json:"invoices"`
+	Payments []string `json:"payments"`
+}
+
+func loadManifest(path string) (*SeedManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest SeedManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return &manifest, nil
 }
 
 // LoadTestMetrics tracks test metrics
@@ -31,26 +56,77 @@ type LoadTestMetrics struct {
 	TotalLatency       int64
 	MinLatency         int64
 	MaxLatency         int64
-	LatencyHistogram   map[string]int64 // P50, P95, P99
+	Latency            histogram
+	Scenarios          map[string]*ScenarioMetrics
+	Services           map[string]*ServiceMetrics
 	mu                 sync.RWMutex
 }
 
+// ScenarioMetrics counts complete runs of one scenario and why failed runs
+// stopped, keyed by step and error.
+type ScenarioMetrics struct {
+	Runs     int64
+	Failed   int64
+	Failures map[string]int64
+	Latency  latencyStats
+}
+
+// ServiceMetrics counts the requests sent to one service.
+type ServiceMetrics struct {
+	Requests int64
+	Failed   int64
+	Latency  latencyStats
+}
+
+// latencyStats accumulates a latency distribution; callers hold the metrics
+// lock.
+type latencyStats struct {
+	hist    histogram
+	totalMs int64
+	minMs   int64
+	maxMs   int64
+}
+
+func (l *latencyStats) record(d time.Duration) {
+	ms := d.Milliseconds()
+	if l.hist.count == 0 || ms < l.minMs {
+		l.minMs = ms
+	}
+	if ms > l.maxMs {
+		l.maxMs = ms
+	}
+	l.totalMs += ms
+	l.hist.record(d)
+}
+
 // LoadTestRunner executes load tests
 type LoadTestRunner struct {
 	config  LoadTestConfig
 	metrics *LoadTestMetrics
 	client  *http.Client
+	pacers  map[string]*pacer
 	stopCh  chan struct{}
 }
 
 // NewLoadTestRunner creates a new load test runner
 func NewLoadTestRunner(config LoadTestConfig) *LoadTestRunner {
+	pacers := make(map[string]*pacer)
+	services := make(map[string]*ServiceMetrics, len(config.Services))
+	for name, svc := range config.Services {
+		if svc.RPS > 0 {
+			pacers[name] = newPacer(svc.RPS)
+		}
+		services[name] = &ServiceMetrics{}
+	}
+
 	return &LoadTestRunner{
 		config: config,
 		metrics: &LoadTestMetrics{
-			MinLatency:       999999999,
-			LatencyHistogram: make(map[string]int64),
+			MinLatency: 999999999,
+			Scenarios:  make(map[string]*ScenarioMetrics),
+			Services:   services,
 		},
+		pacers: pacers,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 			Transport: &http.Transport{
@@ -64,23 +140,26 @@ func NewLoadTestRunner(config LoadTestConfig) *LoadTestRunner {
 }
 
 // Run executes the load test
-func (r *LoadTestRunner) Run(ctx context.Context) error {
+func (r *LoadTestRunner) Run(ctx context.Context) (*Report, error) {
 	fmt.Printf("Starting Phase 2 Load Test\n")
 	fmt.Printf("Configuration:\n")
 	fmt.Printf("  - Base URL: %s\n", r.config.BaseURL)
-	fmt.Printf("  - Concurrent Users: %d\n", r.config.ConcurrentUsers)
-	fmt.Printf("  - Test Duration: %s\n", r.config.TestDuration)
-	fmt.Printf("  - Ramp Up Time: %s\n", r.config.RampUpTime)
+	fmt.Printf("  - Concurrent Users: %d\n", r.config.Users)
+	fmt.Printf("  - Test Duration: %s\n", r.config.Duration)
+	fmt.Printf("  - Ramp Up Time: %s\n", r.config.RampUp)
+	fmt.Printf("  - Scenarios: %d across %d services\n", len(r.config.Scenarios), len(r.config.Services))
 	fmt.Printf("\n")
 
+	startedAt := time.Now()
+
 	// Start metrics reporter
 	go r.reportMetrics(ctx)
 
 	// Create worker pool
 	var wg sync.WaitGroup
-	usersPerSecond := float64(r.config.ConcurrentUsers) / r.config.RampUpTime.Seconds()
+	usersPerSecond := float64(r.config.Users) / r.config.RampUp.Seconds()
 
-	for i := 0; i < r.config.ConcurrentUsers; i++ {
+	for i := 0; i < r.config.Users; i++ {
 		wg.Add(1)
 		go r.worker(ctx, &wg, i)
 
@@ -91,7 +170,7 @@ func (r *LoadTestRunner) Run(ctx context.Context) error {
 	}
 
 	// Wait for test duration
-	time.Sleep(r.config.TestDuration)
+	time.Sleep(r.config.Duration)
 
 	// Signal workers to stop
 	close(r.stopCh)
@@ -99,18 +178,20 @@ func (r *LoadTestRunner) Run(ctx context.Context) error {
 	// Wait for all workers to finish
 	wg.Wait()
 
+	report := r.report(startedAt, time.Since(startedAt))
+
 	// Print final results
-	r.printResults()
+	printResults(report)
 
-	return nil
+	return report, nil
 }
 
 // worker simulates a single user
 func (r *LoadTestRunner) worker(ctx context.Context, wg *sync.WaitGroup, id int) {
 	defer wg.Done()
 
-	userID := uuid.New().String()
-	clientID := uuid.New().String()
+	session := newVars(r.config.Manifest, r.config.TenantID)
+	setupDone := len(r.config.Setup) == 0
 
 	for {
 		select {
@@ -119,55 +200,61 @@ func (r *LoadTestRunner) worker(ctx context.Context, wg *sync.WaitGroup, id int)
 		case <-ctx.Done():
 			return
 		default:
-			// Execute test scenario
-			r.executeScenario(userID, clientID)
+			if !setupDone {
+				setupDone = r.runSteps("setup", defaultService, r.config.Setup, session)
+			} else {
+				scenario := r.config.pick()
+				r.runSteps(scenario.Name, scenario.Service, scenario.Steps, session.child())
+			}
+			r.think()
 		}
 	}
 }
 
-// executeScenario runs a random test scenario
-func (r *LoadTestRunner) executeScenario(userID, clientID string) {
-	scenarios := []func(string, string) error{
-		r.scenarioCreateInvoice,
-		r.scenarioAddLineItem,
-		r.scenarioFinalizeInvoice,
-		r.scenarioRecordPayment,
-		r.scenarioListInvoices,
-		r.scenarioGetInvoice,
-		r.scenarioCreatePayment,
-		r.scenarioProcessPayment,
+// think pauses between scenario runs like a user reading the page.
+func (r *LoadTestRunner) think() {
+	if r.config.ThinkTime > 0 {
+		time.Sleep(r.config.ThinkTime/2 + time.Duration(rand.Int63n(int64(r.config.ThinkTime))))
 	}
+}
 
-	// Weight scenarios (more reads than writes)
-	weights := []int{15, 10, 8, 12, 25, 15, 8, 7}
-
-	// Select scenario based on weights
-	totalWeight := 0
-	for _, w := range weights {
-		totalWeight += w
-	}
-
-	random := rand.Intn(totalWeight)
-	cumulative := 0
-	selectedScenario := 0
-
-	for i, w := range weights {
-		cumulative += w
-		if random < cumulative {
-			selectedScenario = i
+// runSteps executes a chain of steps against service, stopping at the first
+// failure since later steps depend on what earlier ones created. It reports
+// whether every step succeeded.
+func (r *LoadTestRunner) runSteps(name, service string, steps []Step, v *vars) bool {
+	failure := ""
+	var latencies []time.Duration
+	for i := range steps {
+		step := &steps[i]
+		if p := r.pacers[service]; p != nil && !p.wait(r.stopCh) {
+			// Stopped while waiting for a slot; the run is incomplete
+			// rather than failed.
+			return false
+		}
+		result := r.runStep(service, step, v)
+		r.recordRequest(service, result)
+		latencies = append(latencies, result.latency)
+		if result.err != nil {
+			stepName := step.Name
+			if stepName == "" {
+				stepName = fmt.Sprintf("step %d", i+1)
+			}
+			failure = stepName + ": " + result.err.Error()
 			break
 		}
 	}
+	r.recordScenario(name, failure, latencies)
+	return failure == ""
+}
 
-	start := time.Now()
-	err := scenarios[selectedScenario](userID, clientID)
-	latency := time.Since(start).Milliseconds()
+func (r *LoadTestRunner) recordRequest(service string, result stepResult) {
+	latency := result.latency.Milliseconds()
 
-	// Record metrics
 	atomic.AddInt64(&r.metrics.TotalRequests, 1)
 	atomic.AddInt64(&r.metrics.TotalLatency, latency)
+	r.metrics.Latency.record(result.latency)
 
-	if err != nil {
+	if result.err != nil {
 		atomic.AddInt64(&r.metrics.FailedRequests, 1)
 	} else {
 		atomic.AddInt64(&r.metrics.SuccessfulRequests, 1)
@@ -181,121 +268,33 @@ func (r *LoadTestRunner) executeScenario(userID, clientID string) {
 	if latency > r.metrics.MaxLatency {
 		r.metrics.MaxLatency = latency
 	}
-	r.metrics.mu.Unlock()
-
-	// Small delay between requests
-	time.Sleep(time.Duration(rand.Intn(100)+50) * time.Millisecond)
-}
-
-// scenarioCreateInvoice creates a new invoice
-func (r *LoadTestRunner) scenarioCreateInvoice(userID, clientID string) error {
-	payload := map[string]interface{}{
-		"clientId":    clientID,
-		"type":        "standard",
-		"currency":    "USD",
-		"paymentTerm": "net_30",
-		"notes":       "Load test invoice",
-	}
-
-	return r.makeRequest("POST", "/api/v1/invoices", payload, userID)
-}
-
-// scenarioAddLineItem adds a line item to an invoice
-func (r *LoadTestRunner) scenarioAddLineItem(userID, clientID string) error {
-	invoiceID := uuid.New().String() // In real test, would use created invoice
-	payload := map[string]interface{}{
-		"description": "Test product",
-		"quantity":    "5",
-		"unitPrice":   "100.00",
-		"taxRate":     "20",
-	}
-
-	return r.makeRequest("POST", fmt.Sprintf("/api/v1/invoices/%s/lines", invoiceID), payload, userID)
-}
-
-// scenarioFinalizeInvoice finalizes an invoice
-func (r *LoadTestRunner) scenarioFinalizeInvoice(userID, clientID string) error {
-	invoiceID := uuid.New().String()
-	return r.makeRequest("PUT", fmt.Sprintf("/api/v1/invoices/%s/finalize", invoiceID), nil, userID)
-}
-
-// scenarioRecordPayment records a payment for an invoice
-func (r *LoadTestRunner) scenarioRecordPayment(userID, clientID string) error {
-	invoiceID := uuid.New().String()
-	payload := map[string]interface{}{
-		"amount":        "500.00",
-		"paymentMethod": "credit_card",
-		"reference":     "load-test-001",
-	}
-
-	return r.makeRequest("POST", fmt.Sprintf("/api/v1/invoices/%s/payments", invoiceID), payload, userID)
-}
-
-// scenarioListInvoices lists invoices
-func (r *LoadTestRunner) scenarioListInvoices(userID, clientID string) error {
-	return r.makeRequest("GET", fmt.Sprintf("/api/v1/invoices?tenantId=%s&page=1&pageSize=50", r.config.TenantID), nil, userID)
-}
-
-// scenarioGetInvoice gets a single invoice
-func (r *LoadTestRunner) scenarioGetInvoice(userID, clientID string) error {
-	invoiceID := uuid.New().String()
-	return r.makeRequest("GET", fmt.Sprintf("/api/v1/invoices/%s", invoiceID), nil, userID)
-}
-
-// scenarioCreatePayment creates a payment
-func (r *LoadTestRunner) scenarioCreatePayment(userID, clientID string) error {
-	payload := map[string]interface{}{
-		"invoiceId":   uuid.New().String(),
-		"clientId":    clientID,
-		"amount":      "500.00",
-		"currency":    "USD",
-		"method":      "credit_card",
-		"provider":    "stripe",
-		"description": "Load test payment",
+	if svc := r.metrics.Services[service]; svc != nil {
+		svc.Requests++
+		if result.err != nil {
+			svc.Failed++
+		}
+		svc.Latency.record(result.latency)
 	}
-
-	return r.makeRequest("POST", "/api/v1/payments", payload, userID)
-}
-
-// scenarioProcessPayment processes a payment
-func (r *LoadTestRunner) scenarioProcessPayment(userID, clientID string) error {
-	paymentID := uuid.New().String()
-	return r.makeRequest("POST", fmt.Sprintf("/api/v1/payments/%s/process", paymentID), nil, userID)
+	r.metrics.mu.Unlock()
 }
 
-// makeRequest makes an HTTP request
-func (r *LoadTestRunner) makeRequest(method, path string, payload interface{}, userID string) error {
-	url := r.config.BaseURL + path
-
-	var body []byte
-	var err error
-	if payload != nil {
-		body, err = json.Marshal(payload)
-		if err != nil {
-			return err
-		}
-	}
+func (r *LoadTestRunner) recordScenario(name, failure string, latencies []time.Duration) {
+	r.metrics.mu.Lock()
+	defer r.metrics.mu.Unlock()
 
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
-	if err != nil {
-		return err
+	sm := r.metrics.Scenarios[name]
+	if sm == nil {
+		sm = &ScenarioMetrics{Failures: make(map[string]int64)}
+		r.metrics.Scenarios[name] = sm
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Tenant-ID", r.config.TenantID)
-	req.Header.Set("X-User-ID", userID)
-
-	resp, err := r.client.Do(req)
-	if err != nil {
-		return err
+	sm.Runs++
+	if failure != "" {
+		sm.Failed++
+		sm.Failures[failure]++
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	for _, d := range latencies {
+		sm.Latency.record(d)
 	}
-
-	return nil
 }
 
 // reportMetrics periodically reports metrics
@@ -343,69 +342,76 @@ func (r *LoadTestRunner) printCurrentMetrics() {
 }
 
 // printResults prints final test results
-func (r *LoadTestRunner) printResults() {
+func printResults(rep *Report) {
 	fmt.Printf("\n")
 	fmt.Printf("========================================\n")
 	fmt.Printf("      PHASE 2 LOAD TEST RESULTS         \n")
 	fmt.Printf("========================================\n")
 	fmt.Printf("\n")
 
-	total := atomic.LoadInt64(&r.metrics.TotalRequests)
-	success := atomic.LoadInt64(&r.metrics.SuccessfulRequests)
-	failed := atomic.LoadInt64(&r.metrics.FailedRequests)
-	totalLatency := atomic.LoadInt64(&r.metrics.TotalLatency)
-
-	var avgLatency int64
-	if total > 0 {
-		avgLatency = totalLatency / total
-	}
-
-	successRate := float64(0)
-	if total > 0 {
-		successRate = float64(success) / float64(total) * 100
-	}
-
-	rps := float64(total) / r.config.TestDuration.Seconds()
-
 	fmt.Printf("Test Configuration:\n")
-	fmt.Printf("  Concurrent Users: %d\n", r.config.ConcurrentUsers)
-	fmt.Printf("  Test Duration: %s\n", r.config.TestDuration)
+	fmt.Printf("  Concurrent Users: %d\n", rep.Users)
+	fmt.Printf("  Test Duration: %s\n", time.Duration(rep.DurationSeconds*float64(time.Second)).Round(time.Second))
 	fmt.Printf("\n")
 
 	fmt.Printf("Results:\n")
-	fmt.Printf("  Total Requests: %d\n", total)
-	fmt.Printf("  Successful: %d\n", success)
-	fmt.Printf("  Failed: %d\n", failed)
-	fmt.Printf("  Success Rate: %.2f%%\n", successRate)
-	fmt.Printf("  Requests/Second: %.2f\n", rps)
+	fmt.Printf("  Total Requests: %d\n", rep.Requests)
+	fmt.Printf("  Successful: %d\n", rep.Successful)
+	fmt.Printf("  Failed: %d\n", rep.Failed)
+	fmt.Printf("  Success Rate: %.2f%%\n", rep.SuccessRate)
+	fmt.Printf("  Requests/Second: %.2f\n", rep.RPS)
 	fmt.Printf("\n")
 
 	fmt.Printf("Latency:\n")
-	fmt.Printf("  Average: %dms\n", avgLatency)
+	fmt.Printf("  Average: %.1fms\n", rep.Latency.AvgMs)
+	fmt.Printf("  Min: %dms\n", rep.Latency.MinMs)
+	fmt.Printf("  P50: %dms\n", rep.Latency.P50Ms)
+	fmt.Printf("  P95: %dms\n", rep.Latency.P95Ms)
+	fmt.Printf("  P99: %dms\n", rep.Latency.P99Ms)
+	fmt.Printf("  Max: %dms\n", rep.Latency.MaxMs)
+	fmt.Printf("\n")
 
-	r.metrics.mu.RLock()
-	fmt.Printf("  Min: %dms\n", r.metrics.MinLatency)
-	fmt.Printf("  Max: %dms\n", r.metrics.MaxLatency)
-	r.metrics.mu.RUnlock()
+	fmt.Printf("Services:\n")
+	fmt.Printf("  %-16s %10s %10s %8s %8s %8s  %s\n", "SERVICE", "REQUESTS", "RPS", "SUCCESS", "P95", "P99", "SLO")
+	for _, s := range rep.Services {
+		slo := "-"
+		if len(s.Checks) > 0 {
+			slo = "met"
+			for _, c := range s.Checks {
+				if !c.Passed {
+					slo = "BREACHED"
+				}
+			}
+		}
+		fmt.Printf("  %-16s %10d %10.2f %7.2f%% %6dms %6dms  %s\n",
+			s.Name, s.Requests, s.RPS, s.SuccessRate, s.Latency.P95Ms, s.Latency.P99Ms, slo)
+	}
+	fmt.Printf("\n")
 
+	fmt.Printf("Scenarios:\n")
+	for _, s := range rep.Scenarios {
+		fmt.Printf("  %s: %d runs, %d failed, p95 %dms\n", s.Name, s.Runs, s.Failed, s.Latency.P95Ms)
+		for i, f := range s.Failures {
+			if i == 3 {
+				break
+			}
+			fmt.Printf("    %dx %s\n", f.Count, f.Reason)
+		}
+	}
 	fmt.Printf("\n")
 
 	// Validate against requirements
 	fmt.Printf("Validation:\n")
-	passed := true
-
-	if successRate >= 99.9 {
-		fmt.Printf("  ✅ Success Rate >= 99.9%% (%.2f%%)\n", successRate)
-	} else {
-		fmt.Printf("  ❌ Success Rate >= 99.9%% (%.2f%%)\n", successRate)
-		passed = false
+	printChecks("", rep.Checks)
+	for _, s := range rep.Services {
+		printChecks(s.Name+" ", s.Checks)
+	}
+	for _, s := range rep.Scenarios {
+		printChecks(s.Name+" ", s.Checks)
 	}
-
-	// Note: P95 calculation would require storing all latencies
-	fmt.Printf("  ⏳ P95 Latency < 200ms (requires detailed histogram)\n")
 
 	fmt.Printf("\n")
-	if passed {
+	if rep.Passed {
 		fmt.Printf("✅ PHASE 2 LOAD TEST PASSED\n")
 	} else {
 		fmt.Printf("❌ PHASE 2 LOAD TEST FAILED\n")
@@ -413,21 +419,100 @@ func (r *LoadTestRunner) printResults() {
 	fmt.Printf("========================================\n")
 }
 
+func printChecks(prefix string, checks []Check) {
+	for _, c := range checks {
+		mark := "✅"
+		if !c.Passed {
+			mark = "❌"
+		}
+		fmt.Printf("  %s %s%s %s (%s)\n", mark, prefix, c.Name, c.Threshold, c.Actual)
+	}
+}
+
+// topFailures returns the n most frequent failure reasons.
+func topFailures(failures map[string]int64, n int) []string {
+	reasons := make([]string, 0, len(failures))
+	for reason := range failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if failures[reasons[i]] != failures[reasons[j]] {
+			return failures[reasons[i]] > failures[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	if len(reasons) > n {
+		reasons = reasons[:n]
+	}
+	return reasons
+}
+
 func main() {
+	scenarioPath := flag.String("scenarios", "", "scenario file (default: the built-in invoice scenarios)")
+	manifestPath := flag.String("manifest", "", "seed manifest written by cmd/seed")
+	baseURL := flag.String("base-url", "", "override the scenario file's base_url")
+	jsonOut := flag.String("json", "", "write the results as JSON to this file")
+	junitOut := flag.String("junit", "", "write the threshold checks as a JUnit report to this file")
+	flag.Parse()
+
+	data := defaultScenarios
+	if *scenarioPath != "" {
+		var err error
+		if data, err = os.ReadFile(*scenarioPath); err != nil {
+			fmt.Printf("Failed to read scenarios: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	scenarios, err := loadScenarios(data)
+	if err != nil {
+		fmt.Printf("Invalid scenarios: %v\n", err)
+		os.Exit(1)
+	}
+	if *baseURL != "" {
+		scenarios.BaseURL = *baseURL
+	}
+
 	config := LoadTestConfig{
-		BaseURL:         "http://localhost:8080",
-		ConcurrentUsers: 5000,
-		TestDuration:    5 * time.Minute,
-		RampUpTime:      30 * time.Second,
-		TenantID:        "test-tenant",
+		ScenarioFile: scenarios,
+		TenantID:     "test-tenant",
+	}
+
+	if *manifestPath != "" {
+		manifest, err := loadManifest(*manifestPath)
+		if err != nil {
+			fmt.Printf("Failed to load manifest: %v\n", err)
+			os.Exit(1)
+		}
+		config.Manifest = manifest
+		config.TenantID = manifest.TenantID
 	}
 
 	runner := NewLoadTestRunner(config)
 
-	ctx, cancel := context.WithTimeout(context.Background(), config.TestDuration+1*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), config.Duration+1*time.Minute)
 	defer cancel()
 
-	if err := runner.Run(ctx); err != nil {
+	report, err := runner.Run(ctx)
+	if err != nil {
 		fmt.Printf("Load test failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOut != "" {
+		if err := report.writeJSON(*jsonOut); err != nil {
+			fmt.Printf("Failed to write JSON results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *junitOut != "" {
+		if err := report.writeJUnit(*junitOut); err != nil {
+			fmt.Printf("Failed to write JUnit results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// A breached threshold fails the pipeline.
+	if !report.Passed {
+		os.Exit(1)
 	}
 }
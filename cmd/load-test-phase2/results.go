@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Thresholds are the SLOs a run is judged against. Zero values are not
+// checked. At the top level they apply to every request; on a scenario,
+// success rate counts whole runs and latency covers the scenario's steps.
+type Thresholds struct {
+	MinSuccessRate float64       `yaml:"min_success_rate"` // percent
+	P50            time.Duration `yaml:"p50"`
+	P95            time.Duration `yaml:"p95"`
+	P99            time.Duration `yaml:"p99"`
+	MinRPS         float64       `yaml:"min_rps"`
+}
+
+// defaultThresholds are the phase 2 targets, used when a scenario file sets
+// no top-level thresholds.
+var defaultThresholds = Thresholds{MinSuccessRate: 99.9, P95: 200 * time.Millisecond}
+
+// histogram counts latencies in 1ms buckets up to a second and 10ms buckets
+// after that, so percentiles are exact enough without keeping every sample.
+type histogram struct {
+	buckets [histogramBuckets]int64
+	count   int64
+}
+
+const (
+	histogramFineMs   = 1000
+	histogramBuckets  = histogramFineMs + 3000 // up to 31s, past the client timeout
+	histogramCoarseMs = 10
+)
+
+func (h *histogram) record(d time.Duration) {
+	ms := d.Milliseconds()
+	i := ms
+	if ms >= histogramFineMs {
+		i = histogramFineMs + (ms-histogramFineMs)/histogramCoarseMs
+	}
+	if i >= histogramBuckets {
+		i = histogramBuckets - 1
+	}
+	atomic.AddInt64(&h.buckets[i], 1)
+	atomic.AddInt64(&h.count, 1)
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// percentile (0-100).
+func (h *histogram) percentile(p float64) time.Duration {
+	count := atomic.LoadInt64(&h.count)
+	if count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i := range h.buckets {
+		seen += atomic.LoadInt64(&h.buckets[i])
+		if seen >= rank {
+			upper := int64(i + 1)
+			if i >= histogramFineMs {
+				upper = histogramFineMs + int64(i-histogramFineMs+1)*histogramCoarseMs
+			}
+			return time.Duration(upper) * time.Millisecond
+		}
+	}
+	return time.Duration(histogramFineMs+(histogramBuckets-histogramFineMs)*histogramCoarseMs) * time.Millisecond
+}
+
+// LatencyReport summarises a latency distribution in milliseconds.
+type LatencyReport struct {
+	AvgMs float64 `json:"avgMs"`
+	MinMs int64   `json:"minMs"`
+	P50Ms int64   `json:"p50Ms"`
+	P95Ms int64   `json:"p95Ms"`
+	P99Ms int64   `json:"p99Ms"`
+	MaxMs int64   `json:"maxMs"`
+}
+
+func (l *latencyStats) report() LatencyReport {
+	return latencyReport(&l.hist, l.totalMs, l.minMs, l.maxMs)
+}
+
+func latencyReport(h *histogram, totalMs, minMs, maxMs int64) LatencyReport {
+	report := LatencyReport{
+		P50Ms: h.percentile(50).Milliseconds(),
+		P95Ms: h.percentile(95).Milliseconds(),
+		P99Ms: h.percentile(99).Milliseconds(),
+		MaxMs: maxMs,
+	}
+	if count := atomic.LoadInt64(&h.count); count > 0 {
+		report.AvgMs = float64(totalMs) / float64(count)
+		report.MinMs = minMs
+	}
+	return report
+}
+
+// Check is one threshold comparison.
+type Check struct {
+	Name      string `json:"name"`
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+}
+
+// FailureCount is how often a scenario stopped for one reason.
+type FailureCount struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// ScenarioReport is the outcome of one scenario across all virtual users.
+type ScenarioReport struct {
+	Name        string         `json:"name"`
+	Runs        int64          `json:"runs"`
+	Failed      int64          `json:"failed"`
+	SuccessRate float64        `json:"successRate"`
+	Requests    int64          `json:"requests"`
+	Latency     LatencyReport  `json:"latency"`
+	Failures    []FailureCount `json:"failures,omitempty"`
+	Checks      []Check        `json:"checks,omitempty"`
+}
+
+// ServiceReport is the traffic one service received, judged against its own
+// thresholds.
+type ServiceReport struct {
+	Name        string        `json:"name"`
+	BaseURL     string        `json:"baseUrl"`
+	TargetRPS   float64       `json:"targetRps,omitempty"`
+	Requests    int64         `json:"requests"`
+	Failed      int64         `json:"failed"`
+	SuccessRate float64       `json:"successRate"`
+	RPS         float64       `json:"rps"`
+	Latency     LatencyReport `json:"latency"`
+	Checks      []Check       `json:"checks,omitempty"`
+}
+
+// Report is the machine-readable result of a load test.
+type Report struct {
+	StartedAt       time.Time        `json:"startedAt"`
+	DurationSeconds float64          `json:"durationSeconds"`
+	BaseURL         string           `json:"baseUrl"`
+	Users           int              `json:"users"`
+	Requests        int64            `json:"requests"`
+	Successful      int64            `json:"successful"`
+	Failed          int64            `json:"failed"`
+	SuccessRate     float64          `json:"successRate"`
+	RPS             float64          `json:"rps"`
+	Latency         LatencyReport    `json:"latency"`
+	Services        []ServiceReport  `json:"services"`
+	Scenarios       []ScenarioReport `json:"scenarios"`
+	Checks          []Check          `json:"checks"`
+	Passed          bool             `json:"passed"`
+}
+
+// report builds the final report and evaluates the thresholds.
+func (r *LoadTestRunner) report(startedAt time.Time, elapsed time.Duration) *Report {
+	m := r.metrics
+	rep := &Report{
+		StartedAt:       startedAt,
+		DurationSeconds: elapsed.Seconds(),
+		BaseURL:         r.config.BaseURL,
+		Users:           r.config.Users,
+		Requests:        atomic.LoadInt64(&m.TotalRequests),
+		Successful:      atomic.LoadInt64(&m.SuccessfulRequests),
+		Failed:          atomic.LoadInt64(&m.FailedRequests),
+		Passed:          true,
+	}
+	rep.SuccessRate = percent(rep.Successful, rep.Requests)
+	rep.RPS = float64(rep.Requests) / elapsed.Seconds()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rep.Latency = latencyReport(&m.Latency, atomic.LoadInt64(&m.TotalLatency), m.MinLatency, m.MaxLatency)
+	rep.Checks = r.config.Thresholds.evaluate(rep.SuccessRate, rep.Latency, rep.RPS)
+
+	services := make([]string, 0, len(m.Services))
+	for name := range m.Services {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	for _, name := range services {
+		svc, sm := r.config.Services[name], m.Services[name]
+		sr := ServiceReport{
+			Name:        name,
+			BaseURL:     r.baseURL(name),
+			TargetRPS:   svc.RPS,
+			Requests:    sm.Requests,
+			Failed:      sm.Failed,
+			SuccessRate: percent(sm.Requests-sm.Failed, sm.Requests),
+			RPS:         float64(sm.Requests) / elapsed.Seconds(),
+			Latency:     sm.Latency.report(),
+		}
+		sr.Checks = svc.Thresholds.evaluate(sr.SuccessRate, sr.Latency, sr.RPS)
+		rep.Services = append(rep.Services, sr)
+	}
+
+	thresholds := make(map[string]Thresholds, len(r.config.Scenarios))
+	for _, s := range r.config.Scenarios {
+		thresholds[s.Name] = s.Thresholds
+	}
+	names := make([]string, 0, len(m.Scenarios))
+	for name := range m.Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sm := m.Scenarios[name]
+		sr := ScenarioReport{
+			Name:        name,
+			Runs:        sm.Runs,
+			Failed:      sm.Failed,
+			SuccessRate: percent(sm.Runs-sm.Failed, sm.Runs),
+			Requests:    sm.Latency.hist.count,
+			Latency:     sm.Latency.report(),
+		}
+		for _, reason := range topFailures(sm.Failures, 10) {
+			sr.Failures = append(sr.Failures, FailureCount{Reason: reason, Count: sm.Failures[reason]})
+		}
+		sr.Checks = thresholds[name].evaluate(sr.SuccessRate, sr.Latency, float64(sr.Runs)/elapsed.Seconds())
+		rep.Scenarios = append(rep.Scenarios, sr)
+	}
+
+	for _, c := range rep.Checks {
+		rep.Passed = rep.Passed && c.Passed
+	}
+	for _, s := range rep.Services {
+		for _, c := range s.Checks {
+			rep.Passed = rep.Passed && c.Passed
+		}
+	}
+	for _, s := range rep.Scenarios {
+		for _, c := range s.Checks {
+			rep.Passed = rep.Passed && c.Passed
+		}
+	}
+	return rep
+}
+
+func (t Thresholds) evaluate(successRate float64, latency LatencyReport, rps float64) []Check {
+	var checks []Check
+	if t.MinSuccessRate > 0 {
+		checks = append(checks, Check{
+			Name:      "success rate",
+			Threshold: fmt.Sprintf(">= %.2f%%", t.MinSuccessRate),
+			Actual:    fmt.Sprintf("%.2f%%", successRate),
+			Passed:    successRate >= t.MinSuccessRate,
+		})
+	}
+	for _, p := range []struct {
+		name  string
+		limit time.Duration
+		ms    int64
+	}{
+		{"p50 latency", t.P50, latency.P50Ms},
+		{"p95 latency", t.P95, latency.P95Ms},
+		{"p99 latency", t.P99, latency.P99Ms},
+	} {
+		if p.limit > 0 {
+			checks = append(checks, Check{
+				Name:      p.name,
+				Threshold: fmt.Sprintf("<= %dms", p.limit.Milliseconds()),
+				Actual:    fmt.Sprintf("%dms", p.ms),
+				Passed:    p.ms <= p.limit.Milliseconds(),
+			})
+		}
+	}
+	if t.MinRPS > 0 {
+		checks = append(checks, Check{
+			Name:      "throughput",
+			Threshold: fmt.Sprintf(">= %.2f/s", t.MinRPS),
+			Actual:    fmt.Sprintf("%.2f/s", rps),
+			Passed:    rps >= t.MinRPS,
+		})
+	}
+	return checks
+}
+
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+func (rep *Report) writeJSON(path string) error {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes one test case per threshold check, so CI systems that
+// render JUnit show which SLO regressed.
+func (rep *Report) writeJUnit(path string) error {
+	suite := junitSuite{Name: "load-test-phase2", Time: rep.DurationSeconds}
+	add := func(class string, c Check, detail string) {
+		tc := junitCase{Name: c.Name + " " + c.Threshold, ClassName: class}
+		if !c.Passed {
+			tc.Failure = &junitFailure{Message: "actual " + c.Actual, Text: detail}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	for _, c := range rep.Checks {
+		add("overall", c, "")
+	}
+	for _, s := range rep.Services {
+		for _, c := range s.Checks {
+			add("service."+s.Name, c, "")
+		}
+	}
+	for _, s := range rep.Scenarios {
+		var detail string
+		for _, f := range s.Failures {
+			detail += fmt.Sprintf("%dx %s\n", f.Count, f.Reason)
+		}
+		for _, c := range s.Checks {
+			add("scenario."+s.Name, c, detail)
+		}
+	}
+	suite.Tests = len(suite.Cases)
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o644)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram_Percentile(t *testing.T) {
+	var h histogram
+	assert.Equal(t, time.Duration(0), h.percentile(95), "an empty histogram has no percentiles")
+
+	for i := 0; i < 90; i++ {
+		h.record(10 * time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.record(150 * time.Millisecond)
+	}
+	h.record(2345 * time.Millisecond)
+
+	assert.Equal(t, 11*time.Millisecond, h.percentile(50), "percentiles report the bucket's upper bound")
+	assert.Equal(t, 151*time.Millisecond, h.percentile(95))
+	assert.Equal(t, 151*time.Millisecond, h.percentile(99))
+	assert.Equal(t, 2350*time.Millisecond, h.percentile(100), "past a second buckets are 10ms wide")
+
+	var slow histogram
+	slow.record(time.Minute)
+	assert.Equal(t, 31*time.Second, slow.percentile(50), "latencies past the last bucket land in it")
+}
+
+func TestThresholds_Evaluate(t *testing.T) {
+	thresholds := Thresholds{MinSuccessRate: 99.9, P95: 200 * time.Millisecond, MinRPS: 100}
+	checks := thresholds.evaluate(99.5, LatencyReport{P95Ms: 200, P99Ms: 900}, 120)
+
+	require.Len(t, checks, 3, "unset thresholds are not checked")
+	assert.Equal(t, Check{Name: "success rate", Threshold: ">= 99.90%", Actual: "99.50%", Passed: false}, checks[0])
+	assert.Equal(t, Check{Name: "p95 latency", Threshold: "<= 200ms", Actual: "200ms", Passed: true}, checks[1])
+	assert.Equal(t, Check{Name: "throughput", Threshold: ">= 100.00/s", Actual: "120.00/s", Passed: true}, checks[2])
+
+	assert.Empty(t, Thresholds{}.evaluate(0, LatencyReport{}, 0))
+}
+
+// newReportRunner returns a runner that has recorded traffic for an invoice
+// scenario, one of whose runs failed.
+func newReportRunner(t *testing.T, yaml string) *LoadTestRunner {
+	runner := newScenarioRunner(t, yaml)
+	for i := 0; i < 9; i++ {
+		runner.recordRequest(defaultService, stepResult{status: 200, latency: 20 * time.Millisecond})
+		runner.recordScenario("invoices", "", []time.Duration{20 * time.Millisecond})
+	}
+	result := stepResult{status: 500, latency: 300 * time.Millisecond, err: assert.AnError}
+	runner.recordRequest(defaultService, result)
+	runner.recordScenario("invoices", "create: unexpected status 500", []time.Duration{result.latency})
+	return runner
+}
+
+func TestReport(t *testing.T) {
+	runner := newReportRunner(t, `
+thresholds: {min_success_rate: 80, p50: 50ms}
+scenarios:
+  - name: invoices
+    thresholds: {min_success_rate: 95}
+    steps: [{method: GET, path: /api/v1/invoices}]
+`)
+	rep := runner.report(time.Now(), 10*time.Second)
+
+	assert.Equal(t, int64(10), rep.Requests)
+	assert.Equal(t, int64(1), rep.Failed)
+	assert.InDelta(t, 90, rep.SuccessRate, 0.001)
+	assert.InDelta(t, 1, rep.RPS, 0.001)
+	assert.Equal(t, int64(20), rep.Latency.MinMs)
+	assert.Equal(t, int64(300), rep.Latency.MaxMs)
+	assert.InDelta(t, 48, rep.Latency.AvgMs, 0.001)
+
+	for _, c := range rep.Checks {
+		assert.True(t, c.Passed, c.Name)
+	}
+	require.Len(t, rep.Scenarios, 1)
+	scenario := rep.Scenarios[0]
+	assert.Equal(t, int64(10), scenario.Runs)
+	assert.Equal(t, []FailureCount{{Reason: "create: unexpected status 500", Count: 1}}, scenario.Failures)
+	require.Len(t, scenario.Checks, 1)
+	assert.False(t, scenario.Checks[0].Passed, "scenario thresholds count whole runs")
+	assert.False(t, rep.Passed, "any breached threshold fails the run")
+}
+
+func TestReport_Passed(t *testing.T) {
+	runner := newReportRunner(t, `
+thresholds: {min_success_rate: 80, p99: 500ms}
+scenarios: [{name: invoices, steps: [{method: GET, path: /api/v1/invoices}]}]
+`)
+	rep := runner.report(time.Now(), 10*time.Second)
+	assert.True(t, rep.Passed)
+	assert.Empty(t, rep.Scenarios[0].Checks)
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	runner := newReportRunner(t, `
+scenarios: [{name: invoices, steps: [{method: GET, path: /api/v1/invoices}]}]
+`)
+	rep := runner.report(time.Now(), 10*time.Second)
+	path := filepath.Join(t.TempDir(), "results.json")
+	require.NoError(t, rep.writeJSON(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded Report
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, rep.Requests, decoded.Requests)
+	assert.Equal(t, rep.Checks, decoded.Checks)
+	assert.Equal(t, rep.Scenarios, decoded.Scenarios)
+	assert.False(t, decoded.Passed, "the default thresholds require 99.9% success")
+}
+
+func TestReport_WriteJUnit(t *testing.T) {
+	runner := newReportRunner(t, `
+thresholds: {min_success_rate: 80, p50: 50ms}
+scenarios:
+  - name: invoices
+    thresholds: {min_success_rate: 95}
+    steps: [{method: GET, path: /api/v1/invoices}]
+`)
+	rep := runner.report(time.Now(), 10*time.Second)
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	require.NoError(t, rep.writeJUnit(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), xml.Header))
+
+	var suite junitSuite
+	require.NoError(t, xml.Unmarshal(data, &suite))
+	assert.Equal(t, 3, suite.Tests, "one case per threshold check")
+	assert.Equal(t, 1, suite.Failures)
+
+	failed := suite.Cases[2]
+	assert.Equal(t, "scenario.invoices", failed.ClassName)
+	assert.Equal(t, "success rate >= 95.00%", failed.Name)
+	require.NotNil(t, failed.Failure)
+	assert.Equal(t, "actual 90.00%", failed.Failure.Message)
+	assert.Equal(t, "1x create: unexpected status 500\n", failed.Failure.Text, "failures list why the scenario stopped")
+	assert.Nil(t, suite.Cases[0].Failure)
+}
+
+func TestTopFailures(t *testing.T) {
+	failures := map[string]int64{"b": 3, "a": 3, "c": 5, "d": 1}
+	assert.Equal(t, []string{"c", "a", "b"}, topFailures(failures, 3), "ties are ordered by reason")
+	assert.Len(t, topFailures(failures, 10), 4)
+}
+
+func TestReport_Services(t *testing.T) {
+	runner := newScenarioRunner(t, `
+thresholds: {min_success_rate: 50}
+services:
+  documents: {base_url: "http://localhost:8087", rps: 20, thresholds: {p95: 100ms}}
+scenarios: [{name: upload, service: documents, steps: [{method: GET, path: /api/v1/documents}]}]
+`)
+	runner.recordRequest("documents", stepResult{status: 200, latency: 20 * time.Millisecond})
+	runner.recordRequest("documents", stepResult{status: 200, latency: 400 * time.Millisecond})
+	rep := runner.report(time.Now(), 2*time.Second)
+
+	require.Len(t, rep.Services, 2)
+	assert.Equal(t, defaultService, rep.Services[0].Name)
+	assert.Empty(t, rep.Services[0].Checks)
+	docs := rep.Services[1]
+	assert.Equal(t, "http://localhost:8087", docs.BaseURL)
+	assert.Equal(t, float64(20), docs.TargetRPS)
+	assert.InDelta(t, 1, docs.RPS, 0.001)
+	require.Len(t, docs.Checks, 1)
+	assert.False(t, docs.Checks[0].Passed, "a slow service fails its own SLO")
+	assert.False(t, rep.Passed)
+
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	require.NoError(t, rep.writeJUnit(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `classname="service.documents"`)
+}
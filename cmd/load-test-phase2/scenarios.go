@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// ScenarioFile defines a load test: where to send traffic, how many virtual
+// users to run and the weighted scenarios they pick from.
+type ScenarioFile struct {
+	BaseURL   string        `yaml:"base_url"`
+	Users     int           `yaml:"users"`
+	Duration  time.Duration `yaml:"duration"`
+	RampUp    time.Duration `yaml:"ramp_up"`
+	ThinkTime time.Duration `yaml:"think_time"`
+	// Headers are sent with every request, templated like step fields.
+	Headers map[string]string `yaml:"headers"`
+	// Setup runs once per virtual user before its first scenario, e.g. to
+	// log in; its captures are visible to every scenario the user runs.
+	Setup     []Step     `yaml:"setup"`
+	Scenarios []Scenario `yaml:"scenarios"`
+	// Services lists the backends the scenarios exercise, keyed by the name
+	// scenarios refer to them by.
+	Services map[string]*Service `yaml:"services"`
+	// Thresholds decide whether the run passes; see Thresholds.
+	Thresholds Thresholds `yaml:"thresholds"`
+}
+
+// defaultService is where setup steps and scenarios that name no service
+// send their requests.
+const defaultService = "default"
+
+// Service is one backend under test, with its own address, request rate and
+// SLOs so a slow service cannot hide behind a fast one in the totals.
+type Service struct {
+	// BaseURL defaults to the file's base_url, normally the gateway.
+	BaseURL string `yaml:"base_url"`
+	// RPS caps the requests per second sent to the service across all
+	// virtual users; zero leaves it unpaced.
+	RPS        float64    `yaml:"rps"`
+	Thresholds Thresholds `yaml:"thresholds"`
+}
+
+// Scenario is a chain of requests, such as creating an invoice and then
+// paying it. Steps run in order and the scenario stops at the first failure.
+type Scenario struct {
+	Name       string     `yaml:"name"`
+	Service    string     `yaml:"service"`
+	Weight     int        `yaml:"weight"`
+	Steps      []Step     `yaml:"steps"`
+	Thresholds Thresholds `yaml:"thresholds"`
+}
+
+// Step is one request. Method, path, headers, payload and string values in
+// the body may reference variables as {{name}}. A path that is a full URL,
+// such as a captured presigned upload URL, is requested as is and without
+// the file-level headers. Method WS opens a WebSocket instead.
+type Step struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers"`
+	Body    interface{}       `yaml:"body"`
+	// Payload is sent verbatim instead of a JSON body, e.g. file content.
+	Payload   string    `yaml:"payload"`
+	WebSocket WebSocket `yaml:"websocket"`
+	// Capture maps a variable name to a dotted path in the JSON response,
+	// such as "id" or "tokens.accessToken".
+	Capture map[string]string `yaml:"capture"`
+	Expect  Expectation       `yaml:"expect"`
+}
+
+// Expectation is what a step's response must satisfy to count as a success.
+type Expectation struct {
+	// Status lists acceptable status codes; empty means any 2xx.
+	Status []int `yaml:"status"`
+	// Body maps dotted response paths to the values they must have.
+	Body       map[string]string `yaml:"body"`
+	MaxLatency time.Duration     `yaml:"max_latency"`
+}
+
+// loadScenarios reads a scenario file, expanding ${VAR} references from the
+// environment first so credentials stay out of the file.
+func loadScenarios(data []byte) (*ScenarioFile, error) {
+	var file ScenarioFile
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &file); err != nil {
+		return nil, err
+	}
+	if file.BaseURL == "" {
+		file.BaseURL = "http://localhost:8080"
+	}
+	if file.Users <= 0 {
+		file.Users = 50
+	}
+	if file.Duration <= 0 {
+		file.Duration = 5 * time.Minute
+	}
+	if file.Thresholds == (Thresholds{}) {
+		file.Thresholds = defaultThresholds
+	}
+	if len(file.Scenarios) == 0 {
+		return nil, fmt.Errorf("no scenarios defined")
+	}
+	if file.Services == nil {
+		file.Services = make(map[string]*Service)
+	}
+	for name, svc := range file.Services {
+		if svc == nil {
+			file.Services[name] = &Service{}
+		}
+	}
+	if file.Services[defaultService] == nil {
+		file.Services[defaultService] = &Service{}
+	}
+	for i, s := range file.Scenarios {
+		if s.Name == "" {
+			return nil, fmt.Errorf("scenario %d has no name", i+1)
+		}
+		if s.Service == "" {
+			file.Scenarios[i].Service = defaultService
+		} else if file.Services[s.Service] == nil {
+			return nil, fmt.Errorf("scenario %q uses undefined service %q", s.Name, s.Service)
+		}
+		if s.Weight <= 0 {
+			file.Scenarios[i].Weight = 1
+		}
+		if len(s.Steps) == 0 {
+			return nil, fmt.Errorf("scenario %q has no steps", s.Name)
+		}
+		for j, step := range s.Steps {
+			if step.Method == "" || step.Path == "" {
+				return nil, fmt.Errorf("scenario %q step %d needs a method and a path", s.Name, j+1)
+			}
+		}
+	}
+	return &file, nil
+}
+
+// baseURL is where requests to service go.
+func (r *LoadTestRunner) baseURL(service string) string {
+	if svc := r.config.Services[service]; svc != nil && svc.BaseURL != "" {
+		return svc.BaseURL
+	}
+	return r.config.BaseURL
+}
+
+// pacer spaces requests to hold one service at a target rate, shared by all
+// virtual users.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(rps float64) *pacer {
+	return &pacer{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// wait blocks until the caller's slot comes up. It returns false if stop
+// closes first.
+func (p *pacer) wait(stop <-chan struct{}) bool {
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	at := p.next
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// pick chooses a scenario at random in proportion to the weights.
+func (f *ScenarioFile) pick() *Scenario {
+	total := 0
+	for _, s := range f.Scenarios {
+		total += s.Weight
+	}
+	n := rand.Intn(total)
+	for i := range f.Scenarios {
+		if n < f.Scenarios[i].Weight {
+			return &f.Scenarios[i]
+		}
+		n -= f.Scenarios[i].Weight
+	}
+	return &f.Scenarios[len(f.Scenarios)-1]
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*([\w.]+)\s*\}\}`)
+
+// vars holds the variables one scenario run has captured. Built-ins resolve
+// on every reference: uuid is fresh each time and seed.client, seed.invoice
+// and seed.payment pick a record from the seed manifest.
+type vars struct {
+	values   map[string]string
+	manifest *SeedManifest
+}
+
+func newVars(manifest *SeedManifest, tenantID string) *vars {
+	return &vars{values: map[string]string{"tenantId": tenantID}, manifest: manifest}
+}
+
+// child returns a copy, so captures in one scenario run do not leak into the
+// next.
+func (v *vars) child() *vars {
+	values := make(map[string]string, len(v.values))
+	for k, val := range v.values {
+		values[k] = val
+	}
+	return &vars{values: values, manifest: v.manifest}
+}
+
+func (v *vars) lookup(name string) (string, error) {
+	if val, ok := v.values[name]; ok {
+		return val, nil
+	}
+	var ids []string
+	switch name {
+	case "uuid":
+		return uuid.New().String(), nil
+	case "seed.client":
+		ids = v.seed(func(m *SeedManifest) []string { return m.Clients })
+	case "seed.invoice":
+		ids = v.seed(func(m *SeedManifest) []string { return m.Invoices })
+	case "seed.payment":
+		ids = v.seed(func(m *SeedManifest) []string { return m.Payments })
+	default:
+		return "", fmt.Errorf("undefined variable %q", name)
+	}
+	if len(ids) == 0 {
+		return "", fmt.Errorf("%s needs a seed manifest listing such records", name)
+	}
+	return ids[rand.Intn(len(ids))], nil
+}
+
+func (v *vars) seed(ids func(*SeedManifest) []string) []string {
+	if v.manifest == nil {
+		return nil
+	}
+	return ids(v.manifest)
+}
+
+// expand replaces every {{name}} in s.
+func (v *vars) expand(s string) (string, error) {
+	var err error
+	out := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		val, lookupErr := v.lookup(placeholder.FindStringSubmatch(m)[1])
+		if lookupErr != nil && err == nil {
+			err = lookupErr
+		}
+		return val
+	})
+	return out, err
+}
+
+// expandBody templates the string values of a decoded YAML body.
+func (v *vars) expandBody(body interface{}) (interface{}, error) {
+	switch b := body.(type) {
+	case string:
+		return v.expand(b)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(b))
+		for k, val := range b {
+			expanded, err := v.expandBody(val)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = expanded
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(b))
+		for i, val := range b {
+			expanded, err := v.expandBody(val)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = expanded
+		}
+		return out, nil
+	default:
+		return body, nil
+	}
+}
+
+func (v *vars) setHeaders(header http.Header, headers map[string]string) error {
+	for k, tmpl := range headers {
+		val, err := v.expand(tmpl)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", k, err)
+		}
+		header.Set(k, val)
+	}
+	return nil
+}
+
+// stepResult is the outcome of one request.
+type stepResult struct {
+	status  int
+	latency time.Duration
+	err     error
+}
+
+// runStep sends step's request to service and checks the response against
+// its expectations, storing captures in v.
+func (r *LoadTestRunner) runStep(service string, step *Step, v *vars) stepResult {
+	method, err := v.expand(step.Method)
+	if err != nil {
+		return stepResult{err: err}
+	}
+	path, err := v.expand(step.Path)
+	if err != nil {
+		return stepResult{err: err}
+	}
+
+	url := path
+	absolute := strings.Contains(path, "://")
+	if !absolute {
+		url = r.baseURL(service) + path
+	}
+	header := http.Header{}
+	if !absolute {
+		if err := v.setHeaders(header, r.config.Headers); err != nil {
+			return stepResult{err: err}
+		}
+	}
+	if err := v.setHeaders(header, step.Headers); err != nil {
+		return stepResult{err: err}
+	}
+
+	if strings.EqualFold(method, "WS") {
+		return r.runWebSocket(step, url, header, v)
+	}
+
+	var body io.Reader
+	switch {
+	case step.Payload != "":
+		payload, err := v.expand(step.Payload)
+		if err != nil {
+			return stepResult{err: err}
+		}
+		body = strings.NewReader(payload)
+	case step.Body != nil:
+		expanded, err := v.expandBody(step.Body)
+		if err != nil {
+			return stepResult{err: err}
+		}
+		data, err := json.Marshal(expanded)
+		if err != nil {
+			return stepResult{err: err}
+		}
+		body = bytes.NewReader(data)
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/json")
+		}
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), url, body)
+	if err != nil {
+		return stepResult{err: err}
+	}
+	req.Header = header
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return stepResult{latency: time.Since(start), err: err}
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	result := stepResult{status: resp.StatusCode, latency: time.Since(start)}
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	result.err = step.Expect.check(resp.StatusCode, result.latency, data, step.Capture, v)
+	return result
+}
+
+func (e *Expectation) check(status int, latency time.Duration, data []byte, capture map[string]string, v *vars) error {
+	if !e.statusOK(status) {
+		return fmt.Errorf("unexpected status %d", status)
+	}
+	if e.MaxLatency > 0 && latency > e.MaxLatency {
+		return fmt.Errorf("latency %s over %s", latency.Round(time.Millisecond), e.MaxLatency)
+	}
+	if len(e.Body) == 0 && len(capture) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("response is not JSON: %w", err)
+	}
+	for path, want := range e.Body {
+		got, ok := jsonPath(doc, path)
+		if !ok {
+			return fmt.Errorf("response has no %s", path)
+		}
+		if got != want {
+			return fmt.Errorf("%s is %q, want %q", path, got, want)
+		}
+	}
+	for name, path := range capture {
+		val, ok := jsonPath(doc, path)
+		if !ok {
+			return fmt.Errorf("cannot capture %s: response has no %s", name, path)
+		}
+		v.values[name] = val
+	}
+	return nil
+}
+
+func (e *Expectation) statusOK(status int) bool {
+	if len(e.Status) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, s := range e.Status {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonPath resolves a dotted path such as "data.0.id" in a decoded JSON
+// document and formats the scalar it finds.
+func jsonPath(doc interface{}, path string) (string, bool) {
+	cur := doc
+	for _, key := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			cur = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			cur = node[i]
+		default:
+			return "", false
+		}
+	}
+	switch val := cur.(type) {
+	case string:
+		return val, true
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(val), true
+	case nil:
+		return "", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadScenarios(t *testing.T) {
+	t.Setenv("LOAD_TEST_PASSWORD", "s3cret")
+	file, err := loadScenarios([]byte(`
+setup:
+  - name: login
+    method: POST
+    path: /api/v1/auth/login
+    body: {password: "${LOAD_TEST_PASSWORD}"}
+    capture: {token: tokens.accessToken}
+scenarios:
+  - name: list invoices
+    steps:
+      - {method: GET, path: /api/v1/invoices}
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://localhost:8080", file.BaseURL)
+	assert.Equal(t, 50, file.Users)
+	assert.Equal(t, 5*time.Minute, file.Duration)
+	assert.Equal(t, defaultThresholds, file.Thresholds)
+	assert.Equal(t, 1, file.Scenarios[0].Weight)
+	assert.Equal(t, map[string]interface{}{"password": "s3cret"}, file.Setup[0].Body, "environment variables are expanded")
+	assert.Equal(t, "tokens.accessToken", file.Setup[0].Capture["token"])
+}
+
+func TestLoadScenarios_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"no scenarios", `users: 5`, "no scenarios defined"},
+		{"unnamed", `scenarios: [{steps: [{method: GET, path: /}]}]`, "scenario 1 has no name"},
+		{"no steps", `scenarios: [{name: empty}]`, `scenario "empty" has no steps`},
+		{"no path", `scenarios: [{name: list, steps: [{method: GET}]}]`, `scenario "list" step 1 needs a method and a path`},
+	}
+	for _, tt := range tests {
+		_, err := loadScenarios([]byte(tt.yaml))
+		require.Error(t, err, tt.name)
+		assert.Contains(t, err.Error(), tt.want, tt.name)
+	}
+}
+
+func TestLoadScenarios_Default(t *testing.T) {
+	file, err := loadScenarios(defaultScenarios)
+	require.NoError(t, err, "the built-in scenarios are valid")
+	assert.NotEmpty(t, file.Setup)
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"tenantId":"tenant-a","clients":["c1"],"invoices":["i1","i2"]}`), 0o644))
+
+	manifest, err := loadManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant-a", manifest.TenantID)
+	assert.Equal(t, []string{"i1", "i2"}, manifest.Invoices)
+
+	bad := filepath.Join(dir, "bad.json")
+	require.NoError(t, os.WriteFile(bad, []byte("{"), 0o644))
+	_, err = loadManifest(bad)
+	assert.Error(t, err)
+}
+
+func TestVars_Expand(t *testing.T) {
+	v := newVars(&SeedManifest{Clients: []string{"client-1"}}, "tenant-a")
+	v.values["invoiceId"] = "inv-1"
+
+	out, err := v.expand("/api/v1/invoices/{{ invoiceId }}?tenantId={{tenantId}}&client={{seed.client}}")
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1/invoices/inv-1?tenantId=tenant-a&client=client-1", out)
+
+	first, err := v.expand("{{uuid}}")
+	require.NoError(t, err)
+	second, _ := v.expand("{{uuid}}")
+	assert.NotEqual(t, first, second, "uuid is fresh on every reference")
+
+	_, err = v.expand("{{seed.invoice}}")
+	assert.EqualError(t, err, "seed.invoice needs a seed manifest listing such records")
+	_, err = v.expand("{{paymentId}}")
+	assert.EqualError(t, err, `undefined variable "paymentId"`)
+}
+
+func TestVars_Child(t *testing.T) {
+	session := newVars(nil, "tenant-a")
+	run := session.child()
+	run.values["invoiceId"] = "inv-1"
+
+	_, err := session.lookup("invoiceId")
+	assert.Error(t, err, "captures in one run do not leak into the session")
+	val, err := run.lookup("tenantId")
+	require.NoError(t, err)
+	assert.Equal(t, "tenant-a", val)
+}
+
+func TestVars_ExpandBody(t *testing.T) {
+	v := newVars(nil, "tenant-a")
+	v.values["clientId"] = "client-1"
+
+	body, err := v.expandBody(map[string]interface{}{
+		"clientId": "{{clientId}}",
+		"lines":    []interface{}{map[string]interface{}{"quantity": 2, "note": "for {{tenantId}}"}},
+		"draft":    true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"clientId": "client-1",
+		"lines":    []interface{}{map[string]interface{}{"quantity": 2, "note": "for tenant-a"}},
+		"draft":    true,
+	}, body)
+
+	_, err = v.expandBody([]interface{}{"{{missing}}"})
+	assert.Error(t, err)
+}
+
+func TestJSONPath(t *testing.T) {
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"data":[{"id":"inv-1","total":120.5,"paid":false}],"next":null}`), &doc))
+
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"data.0.id", "inv-1", true},
+		{"data.0.total", "120.5", true},
+		{"data.0.paid", "false", true},
+		{"next", "", true},
+		{"data.1.id", "", false},
+		{"data.x", "", false},
+		{"data", "", false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := jsonPath(doc, tt.path)
+		assert.Equal(t, tt.ok, ok, tt.path)
+		assert.Equal(t, tt.want, got, tt.path)
+	}
+}
+
+func TestExpectation_StatusOK(t *testing.T) {
+	assert.True(t, (&Expectation{}).statusOK(http.StatusCreated))
+	assert.False(t, (&Expectation{}).statusOK(http.StatusNotFound))
+	assert.True(t, (&Expectation{Status: []int{http.StatusNotFound}}).statusOK(http.StatusNotFound))
+	assert.False(t, (&Expectation{Status: []int{http.StatusNotFound}}).statusOK(http.StatusOK))
+}
+
+// newScenarioServer answers invoice creation and lookup, recording the
+// requests it receives.
+func newScenarioServer(t *testing.T) (*httptest.Server, *[]*http.Request) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Clone(r.Context()))
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/invoices":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]string{"id": "inv-1", "clientId": body["clientId"], "status": "draft"})
+		case r.URL.Path == "/api/v1/invoices/inv-1":
+			_ = json.NewEncoder(w).Encode(map[string]string{"id": "inv-1", "status": "sent"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newScenarioRunner(t *testing.T, yaml string) *LoadTestRunner {
+	file, err := loadScenarios([]byte(yaml))
+	require.NoError(t, err)
+	return NewLoadTestRunner(LoadTestConfig{ScenarioFile: file, TenantID: "tenant-a"})
+}
+
+func TestRunSteps_CapturesAndAsserts(t *testing.T) {
+	server, requests := newScenarioServer(t)
+	runner := newScenarioRunner(t, `
+base_url: `+server.URL+`
+headers: {Authorization: "Bearer {{token}}"}
+scenarios:
+  - name: invoice lifecycle
+    steps:
+      - name: create
+        method: POST
+        path: /api/v1/invoices
+        body: {clientId: "client-1"}
+        capture: {invoiceId: id}
+        expect: {status: [201], body: {status: draft}}
+      - name: get
+        method: GET
+        path: /api/v1/invoices/{{invoiceId}}
+        expect: {body: {status: sent}}
+`)
+	v := newVars(nil, "tenant-a")
+	v.values["token"] = "tok"
+
+	scenario := runner.config.Scenarios[0]
+	require.True(t, runner.runSteps(scenario.Name, scenario.Service, scenario.Steps, v))
+	assert.Equal(t, "inv-1", v.values["invoiceId"])
+
+	require.Len(t, *requests, 2)
+	create, get := (*requests)[0], (*requests)[1]
+	assert.Equal(t, "application/json", create.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer tok", create.Header.Get("Authorization"), "file headers are templated")
+	assert.Equal(t, "/api/v1/invoices/inv-1", get.URL.Path, "later steps use earlier captures")
+
+	assert.Equal(t, int64(2), runner.metrics.SuccessfulRequests)
+	sm := runner.metrics.Scenarios["invoice lifecycle"]
+	assert.Equal(t, int64(1), sm.Runs)
+	assert.Equal(t, int64(0), sm.Failed)
+}
+
+func TestRunSteps_StopsAtFirstFailure(t *testing.T) {
+	server, requests := newScenarioServer(t)
+	runner := newScenarioRunner(t, `
+base_url: `+server.URL+`
+scenarios:
+  - name: invoice lifecycle
+    steps:
+      - name: create
+        method: POST
+        path: /api/v1/invoices
+        body: {clientId: "client-1"}
+        expect: {body: {status: sent}}
+      - {name: get, method: GET, path: /api/v1/invoices/inv-1}
+`)
+	scenario := runner.config.Scenarios[0]
+	assert.False(t, runner.runSteps(scenario.Name, scenario.Service, scenario.Steps, newVars(nil, "tenant-a")))
+
+	assert.Len(t, *requests, 1, "steps after a failure are not sent")
+	assert.Equal(t, int64(1), runner.metrics.FailedRequests)
+	sm := runner.metrics.Scenarios["invoice lifecycle"]
+	assert.Equal(t, int64(1), sm.Failed)
+	assert.Equal(t, map[string]int64{`create: status is "draft", want "sent"`: 1}, sm.Failures)
+}
+
+func TestRunStep_Failures(t *testing.T) {
+	server, _ := newScenarioServer(t)
+	runner := newScenarioRunner(t, `
+base_url: `+server.URL+`
+scenarios: [{name: noop, steps: [{method: GET, path: /}]}]
+`)
+	v := newVars(nil, "tenant-a")
+
+	tests := []struct {
+		name string
+		step Step
+		want string
+	}{
+		{"status", Step{Method: "GET", Path: "/api/v1/missing"}, "unexpected status 404"},
+		{"capture", Step{Method: "GET", Path: "/api/v1/invoices/inv-1", Capture: map[string]string{"total": "total"}}, "cannot capture total: response has no total"},
+		{"variable", Step{Method: "GET", Path: "/api/v1/invoices/{{invoiceId}}"}, `undefined variable "invoiceId"`},
+		{"latency", Step{Method: "GET", Path: "/api/v1/invoices/inv-1", Expect: Expectation{MaxLatency: time.Nanosecond}}, "latency"},
+	}
+	for _, tt := range tests {
+		result := runner.runStep(defaultService, &tt.step, v)
+		require.Error(t, result.err, tt.name)
+		assert.Contains(t, result.err.Error(), tt.want, tt.name)
+	}
+}
+
+func TestLoadScenarios_Services(t *testing.T) {
+	file, err := loadScenarios([]byte(`
+services:
+  documents: {base_url: "http://localhost:8087", rps: 20}
+  products:
+scenarios:
+  - {name: upload, service: documents, steps: [{method: GET, path: /api/v1/documents}]}
+  - {name: search, steps: [{method: GET, path: /api/v1/products}]}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "documents", file.Scenarios[0].Service)
+	assert.Equal(t, defaultService, file.Scenarios[1].Service, "scenarios without a service use the default one")
+	assert.NotNil(t, file.Services["products"], "services listed without settings are kept")
+	assert.NotNil(t, file.Services[defaultService])
+
+	runner := NewLoadTestRunner(LoadTestConfig{ScenarioFile: file})
+	assert.Equal(t, "http://localhost:8087", runner.baseURL("documents"))
+	assert.Equal(t, "http://localhost:8080", runner.baseURL("products"), "services default to the file's base_url")
+	assert.NotNil(t, runner.pacers["documents"])
+	assert.Nil(t, runner.pacers["products"], "services without an rps are unpaced")
+
+	_, err = loadScenarios([]byte(`scenarios: [{name: search, service: products, steps: [{method: GET, path: /}]}]`))
+	assert.EqualError(t, err, `scenario "search" uses undefined service "products"`)
+}
+
+func TestLoadScenarios_DefaultServices(t *testing.T) {
+	file, err := loadScenarios(defaultScenarios)
+	require.NoError(t, err)
+	services := make(map[string]bool)
+	for _, s := range file.Scenarios {
+		services[s.Service] = true
+	}
+	for _, name := range []string{"invoices", "documents", "products", "orders", "analytics"} {
+		assert.True(t, services[name], "a built-in scenario exercises %s", name)
+	}
+}
+
+func TestPacer(t *testing.T) {
+	p := newPacer(100)
+	stop := make(chan struct{})
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.True(t, p.wait(stop))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond, "requests are spaced at the target rate")
+
+	slow := newPacer(0.1)
+	require.True(t, slow.wait(stop), "the first slot is immediate")
+	close(stop)
+	assert.False(t, slow.wait(stop), "waiting ends when the run stops")
+}
+
+func TestRunSteps_RecordsPerService(t *testing.T) {
+	server, _ := newScenarioServer(t)
+	runner := newScenarioRunner(t, `
+services:
+  invoices: {base_url: `+server.URL+`, rps: 1000}
+scenarios:
+  - name: lookup
+    service: invoices
+    steps:
+      - {method: GET, path: /api/v1/invoices/inv-1}
+      - {method: GET, path: /api/v1/missing}
+`)
+	scenario := runner.config.Scenarios[0]
+	assert.False(t, runner.runSteps(scenario.Name, scenario.Service, scenario.Steps, newVars(nil, "tenant-a")))
+
+	svc := runner.metrics.Services["invoices"]
+	assert.Equal(t, int64(2), svc.Requests)
+	assert.Equal(t, int64(1), svc.Failed)
+	assert.Equal(t, int64(0), runner.metrics.Services[defaultService].Requests)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket configures a WS step: connect, optionally send a message, wait
+// for a number of messages and then keep the connection open for a while, as
+// a dashboard left on screen would.
+type WebSocket struct {
+	Send string `yaml:"send"`
+	// Messages is how many messages to wait for. Expectations and captures
+	// apply to the last one.
+	Messages int `yaml:"messages"`
+	// Hold keeps the connection open after the awaited messages; it is not
+	// counted in the step's latency.
+	Hold time.Duration `yaml:"hold"`
+}
+
+// runWebSocket performs a WS step. Latency covers the handshake and the
+// awaited messages.
+func (r *LoadTestRunner) runWebSocket(step *Step, url string, header http.Header, v *vars) stepResult {
+	// http:// becomes ws:// and https:// becomes wss://.
+	url = "ws" + strings.TrimPrefix(url, "http")
+	dialer := websocket.Dialer{HandshakeTimeout: r.client.Timeout}
+
+	start := time.Now()
+	conn, resp, err := dialer.Dial(url, header)
+	if err != nil {
+		result := stepResult{latency: time.Since(start), err: err}
+		if resp != nil {
+			result.status = resp.StatusCode
+		}
+		return result
+	}
+	defer conn.Close()
+
+	if step.WebSocket.Send != "" {
+		msg, err := v.expand(step.WebSocket.Send)
+		if err != nil {
+			return stepResult{err: err}
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			return stepResult{status: resp.StatusCode, latency: time.Since(start), err: err}
+		}
+	}
+
+	var last []byte
+	conn.SetReadDeadline(start.Add(r.client.Timeout))
+	for i := 0; i < step.WebSocket.Messages; i++ {
+		if _, last, err = conn.ReadMessage(); err != nil {
+			return stepResult{status: resp.StatusCode, latency: time.Since(start), err: fmt.Errorf("message %d: %w", i+1, err)}
+		}
+	}
+	result := stepResult{status: resp.StatusCode, latency: time.Since(start)}
+
+	expect := step.Expect
+	if len(expect.Status) == 0 {
+		expect.Status = []int{http.StatusSwitchingProtocols}
+	}
+	if result.err = expect.check(resp.StatusCode, result.latency, last, step.Capture, v); result.err != nil {
+		return result
+	}
+
+	if step.WebSocket.Hold > 0 {
+		result.err = hold(conn, step.WebSocket.Hold)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return result
+}
+
+// hold drains messages for d and reports the server dropping the
+// connection early.
+func hold(conn *websocket.Conn, d time.Duration) error {
+	conn.SetReadDeadline(time.Now().Add(d))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil
+			}
+			return fmt.Errorf("connection lost while held open: %w", err)
+		}
+	}
+}
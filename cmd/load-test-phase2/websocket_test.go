@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDashboardServer streams two metric updates after the client subscribes,
+// then either stays quiet or hangs up.
+func newDashboardServer(t *testing.T, hangUp bool) (*httptest.Server, chan string) {
+	received := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case received <- string(msg):
+		default:
+		}
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"metric":"revenue","value":100}`))
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"metric":"revenue","value":250}`))
+		if hangUp {
+			return
+		}
+		_, _, _ = conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func dashboardStep(hold time.Duration) *Step {
+	return &Step{
+		Method:    "WS",
+		Path:      "/ws/dashboard",
+		WebSocket: WebSocket{Send: `{"subscribe":"{{tenantId}}"}`, Messages: 2, Hold: hold},
+		Capture:   map[string]string{"revenue": "value"},
+		Expect:    Expectation{Body: map[string]string{"metric": "revenue"}},
+	}
+}
+
+func TestRunWebSocket(t *testing.T) {
+	server, received := newDashboardServer(t, false)
+	runner := newScenarioRunner(t, `
+base_url: `+server.URL+`
+headers: {Authorization: "Bearer {{token}}"}
+scenarios: [{name: noop, steps: [{method: GET, path: /}]}]
+`)
+	v := newVars(nil, "tenant-a")
+	v.values["token"] = "tok"
+
+	start := time.Now()
+	result := runner.runStep(defaultService, dashboardStep(50*time.Millisecond), v)
+	require.NoError(t, result.err)
+	assert.Equal(t, http.StatusSwitchingProtocols, result.status)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond, "the connection is held open")
+	assert.Less(t, result.latency, 50*time.Millisecond, "holding is not counted as latency")
+	assert.Equal(t, `{"subscribe":"tenant-a"}`, <-received)
+	assert.Equal(t, "250", v.values["revenue"], "captures come from the last awaited message")
+}
+
+func TestRunWebSocket_Failures(t *testing.T) {
+	server, _ := newDashboardServer(t, true)
+	runner := newScenarioRunner(t, `
+base_url: `+server.URL+`
+scenarios: [{name: noop, steps: [{method: GET, path: /}]}]
+`)
+	v := newVars(nil, "tenant-a")
+
+	result := runner.runStep(defaultService, dashboardStep(0), v)
+	require.Error(t, result.err, "the handshake is rejected without a token")
+	assert.Equal(t, http.StatusUnauthorized, result.status)
+
+	runner.config.Headers = map[string]string{"Authorization": "Bearer tok"}
+	result = runner.runStep(defaultService, dashboardStep(time.Second), v)
+	require.Error(t, result.err)
+	assert.Contains(t, result.err.Error(), "connection lost while held open")
+
+	step := dashboardStep(0)
+	step.WebSocket.Messages = 3
+	result = runner.runStep(defaultService, step, v)
+	require.Error(t, result.err)
+	assert.Contains(t, result.err.Error(), "message 3")
+}
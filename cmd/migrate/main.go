@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ims-erp/system/internal/backup"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/migrations"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+const usage = `Usage: migrate [-config file] [-timeout d] <command>
+
+Commands:
+  up [version]   apply pending migrations, optionally only up to version
+  status         list migrations and whether they have been applied
+  check          exit with status 1 if indexes created by migrations are missing
+  backup <tenant> [file]
+                 write an archive of the tenant's data to file
+                 (default <tenant>-<time>.tar.gz)
+  restore [-replace] <file>
+                 load a tenant archive; -replace deletes the tenant's
+                 existing data first, otherwise a tenant with data is refused
+  scrub <tenant> replace the tenant's personal data with pseudonyms, e.g.
+                 after restoring production data into staging; refused
+                 when app.environment is production
+  rotate-keys    re-encrypt personal data under security.pii.active_key,
+                 encrypting values stored before encryption was enabled
+
+With database.driver=postgres, up and status also cover the PostgreSQL schema.
+`
+
+func main() {
+	configPath := flag.String("config", "", "config file (default: migrate.yaml in the usual config paths)")
+	timeout := flag.Duration("timeout", time.Hour, "give up after this long")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath, "migrate")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, err := logger.New(logger.Config{
+		Level:       cfg.Logging.Level,
+		Format:      cfg.Logging.Format,
+		ServiceName: "migrate",
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		log.Error("Failed to connect to MongoDB", "error", err)
+		os.Exit(1)
+	}
+	defer mongodb.Close(context.Background())
+
+	migrator := migrations.New(mongodb, log)
+
+	var pgMigrator *migrations.PostgresMigrator
+	if cfg.Database.Driver == "postgres" {
+		pg, err := repository.NewPostgres(cfg.Database.Postgres, log)
+		if err != nil {
+			log.Error("Failed to connect to PostgreSQL", "error", err)
+			os.Exit(1)
+		}
+		defer pg.Close()
+		pgMigrator = migrations.NewPostgres(pg.DB(), log)
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "up":
+		target := 0
+		if flag.NArg() > 1 {
+			if target, err = strconv.Atoi(flag.Arg(1)); err != nil || target <= 0 {
+				fmt.Fprintf(os.Stderr, "invalid version %q\n", flag.Arg(1))
+				os.Exit(2)
+			}
+		}
+		applied, err := migrator.Up(ctx, target)
+		if len(applied) > 0 {
+			log.Info("Applied migrations", "versions", applied)
+		}
+		if err != nil {
+			log.Error("Migration failed", "error", err)
+			os.Exit(1)
+		}
+		if len(applied) == 0 {
+			log.Info("No pending migrations")
+		}
+		if pgMigrator != nil {
+			applied, err := pgMigrator.Up(ctx, target)
+			if len(applied) > 0 {
+				log.Info("Applied PostgreSQL migrations", "versions", applied)
+			}
+			if err != nil {
+				log.Error("PostgreSQL migration failed", "error", err)
+				os.Exit(1)
+			}
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Error("Failed to read migration status", "error", err)
+			os.Exit(1)
+		}
+		printStatus("mongodb", statuses)
+		if pgMigrator != nil {
+			statuses, err := pgMigrator.Status(ctx)
+			if err != nil {
+				log.Error("Failed to read PostgreSQL migration status", "error", err)
+				os.Exit(1)
+			}
+			fmt.Println()
+			printStatus("postgres", statuses)
+		}
+
+	case "check":
+		if err := migrator.Check(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("All required indexes exist")
+
+	case "backup":
+		if flag.NArg() < 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		tenantID := flag.Arg(1)
+		path := flag.Arg(2)
+		if path == "" {
+			path = fmt.Sprintf("%s-%s.tar.gz", tenantID, time.Now().UTC().Format("20060102T150405Z"))
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			log.Error("Failed to create archive", "error", err)
+			os.Exit(1)
+		}
+		backups := backup.New(mongodb, nil, cfg.Backups, cfg.App.Environment, log)
+		manifest, err := backups.Dump(ctx, tenantID, file)
+		if err == nil {
+			err = file.Close()
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(path)
+			log.Error("Backup failed", "error", err)
+			os.Exit(1)
+		}
+		log.Info("Wrote tenant backup", "tenant_id", tenantID, "file", path,
+			"collections", len(manifest.Collections), "stored_files", manifest.Documents)
+
+	case "restore":
+		restore := flag.NewFlagSet("restore", flag.ExitOnError)
+		replace := restore.Bool("replace", false, "delete the tenant's existing data first")
+		restore.Parse(flag.Args()[1:])
+		if restore.NArg() != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		file, err := os.Open(restore.Arg(0))
+		if err != nil {
+			log.Error("Failed to open archive", "error", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		backups := backup.New(mongodb, nil, cfg.Backups, cfg.App.Environment, log)
+		manifest, err := backups.Restore(ctx, file, backup.RestoreOptions{Replace: *replace})
+		if err != nil {
+			log.Error("Restore failed", "error", err)
+			os.Exit(1)
+		}
+		log.Info("Restored tenant backup", "tenant_id", manifest.TenantID,
+			"environment", manifest.Environment, "created_at", manifest.CreatedAt,
+			"collections", len(manifest.Collections), "stored_files", manifest.Documents)
+
+	case "scrub":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		keyring, err := cfg.Security.PII.Keyring()
+		if err != nil {
+			log.Error("Failed to configure PII encryption", "error", err)
+			os.Exit(1)
+		}
+		backups := backup.New(mongodb, nil, cfg.Backups, cfg.App.Environment, log)
+		changed, err := backups.Scrub(ctx, flag.Arg(1), keyring)
+		if err != nil {
+			log.Error("Scrub failed", "error", err)
+			os.Exit(1)
+		}
+		var total int64
+		for _, n := range changed {
+			total += n
+		}
+		log.Info("Scrubbed tenant", "tenant_id", flag.Arg(1), "collections", len(changed), "documents", total)
+
+	case "rotate-keys":
+		keyring, err := cfg.Security.PII.Keyring()
+		if err != nil {
+			log.Error("Failed to configure PII encryption", "error", err)
+			os.Exit(1)
+		}
+		changed, err := repository.RotateKeys(ctx, mongodb, keyring)
+		for collection, n := range changed {
+			log.Info("Re-encrypted documents", "collection", collection, "documents", n)
+		}
+		if err != nil {
+			log.Error("Key rotation failed", "error", err)
+			os.Exit(1)
+		}
+		log.Info("Personal data is encrypted under the active key", "key", keyring.ActiveKey())
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func printStatus(database string, statuses []migrations.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tVERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", database, s.Version, s.Name, applied)
+	}
+	w.Flush()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/notification"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/ims-erp/system/pkg/tracer"
+)
+
+func main() {
+	cfg, err := config.Load("", "notification-service")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, err := logger.New(logger.Config{
+		Level:       cfg.Logging.Level,
+		Format:      cfg.Logging.Format,
+		ServiceName: cfg.App.Name,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	group := lifecycle.New(log)
+
+	metrics.Initialize(cfg.App.Name)
+
+	tr, err := tracer.New(tracer.Config{
+		Enabled:      cfg.Tracing.Enabled,
+		ServiceName:  cfg.App.Name,
+		ExporterType: cfg.Tracing.ExporterType,
+		Endpoint:     cfg.Tracing.Endpoint,
+		SamplerType:  cfg.Tracing.SamplerType,
+		SamplerRatio: cfg.Tracing.SamplerRatio,
+	})
+	if err != nil {
+		log.Error("Failed to create tracer", "error", err)
+		os.Exit(1)
+	}
+	defer tr.Shutdown(context.Background())
+
+	messaging.SetupTracePropagation()
+
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		log.Error("Failed to connect to MongoDB", "error", err)
+		os.Exit(1)
+	}
+	defer mongodb.Close(context.Background())
+	log.Info("Connected to MongoDB")
+
+	subscriber, err := messaging.NewEventSubscriber(cfg, log)
+	if err != nil {
+		log.Error("Failed to create event subscriber", "error", err, "transport", cfg.Messaging.Transport)
+		os.Exit(1)
+	}
+	defer subscriber.Close()
+	group.OnShutdown("subscriber", subscriber.Drain)
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
+
+	providers, err := notification.NewProviders(cfg.Notifications)
+	if err != nil {
+		log.Error("Failed to configure notification providers", "error", err)
+		os.Exit(1)
+	}
+
+	pii, err := cfg.Security.PII.Keyring()
+	if err != nil {
+		log.Error("Failed to configure PII encryption", "error", err)
+		os.Exit(1)
+	}
+	notifier := notification.NewNotifier(mongodb, cfg.Notifications, cfg.I18n, providers, log).WithEncryption(pii)
+	if err := notifier.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create notification indexes", "error", err)
+	}
+
+	// Like webhook-service, this is a consumer group on the whole event
+	// namespace: replicas share the work. On NATS, events published while no
+	// replica runs are not notified.
+	eventSubject := "evt.>"
+	if err := subscriber.SubscribeGroup(group.Context(), eventSubject, "notification-service", createEventHandler(notifier)); err != nil {
+		log.Error("Failed to subscribe", "error", err, "subject", eventSubject)
+		os.Exit(1)
+	}
+
+	healthChecker := health.NewHealthChecker(cfg, mongodb, nil, log)
+	healthChecker.AddComponent("messaging", health.MessagingCheck(subscriber))
+	readinessChecker := healthChecker.Readiness()
+	livenessChecker := health.NewLivenessChecker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", healthChecker.Handler())
+	mux.Handle("/ready", readinessChecker.Handler())
+	mux.Handle("/live", livenessChecker.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/api/v1/notifications", notifier.Handler())
+	mux.Handle("/api/v1/notifications/", notifier.Handler())
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		log.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
+		Handler:      metrics.HTTPMiddleware(middleware.Instrument(log, tenants.Handler(mux))),
+		ReadTimeout:  cfg.App.ReadTimeout,
+		WriteTimeout: cfg.App.WriteTimeout,
+	}
+	group.OnShutdown("http server", srv.Shutdown)
+
+	go func() {
+		log.Info("Starting notification-service", "port", cfg.App.Port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("Server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	sig := group.WaitForSignal()
+	log.Info("Shutting down", "signal", sig)
+	if err := group.Shutdown(cfg.App.ShutdownTimeout); err != nil {
+		log.Error("Shutdown incomplete", "error", err)
+	}
+}
+
+func createEventHandler(notifier *notification.Notifier) messaging.DeliveryHandler {
+	return func(ctx context.Context, msg *messaging.Delivery) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		if err := notifier.HandleEvent(ctx, &event); err != nil {
+			return fmt.Errorf("failed to send notifications for event %s: %w", event.ID, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/pdf"
+)
+
+// handleDeliveryRoutes lists the tenant's routes on ?date=, today in the
+// tenant's time zone by default, optionally of one ?warehouseId=.
+func (s *OrderService) handleDeliveryRoutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	tenantUUID, err := uuid.Parse(tenantID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().In(s.config.I18n.LocationFor(tenantID)).Format(domain.DeliveryDateLayout)
+	} else if _, err := time.Parse(domain.DeliveryDateLayout, date); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid date format")
+		return
+	}
+	var warehouseID uuid.UUID
+	if id := r.URL.Query().Get("warehouseId"); id != "" {
+		if warehouseID, err = uuid.Parse(id); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid warehouse ID")
+			return
+		}
+	}
+
+	routes, err := s.routes.FindByDate(r.Context(), tenantUUID, date, warehouseID)
+	if err != nil {
+		s.logger.Error("Failed to list delivery routes", "error", err)
+		httpresponse.Error(w, r, err)
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, map[string]interface{}{
+		"deliveryDate": date,
+		"routes":       routes,
+	})
+}
+
+// handleDeliveryRouteByID returns a route, or its driver manifest as a PDF
+// at /api/v1/delivery-routes/{id}/manifest.
+func (s *OrderService) handleDeliveryRouteByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v1/delivery-routes/")
+	id, action, _ := strings.Cut(rest, "/")
+	if action != "" && action != "manifest" {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	routeID, err := uuid.Parse(id)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid route ID")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	route, err := s.routes.FindByID(r.Context(), routeID)
+	if err != nil || route.TenantID.String() != tenantID {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Delivery route not found")
+		return
+	}
+
+	if action == "" {
+		httpresponse.JSON(w, http.StatusOK, route)
+		return
+	}
+
+	filename := fmt.Sprintf("manifest-%s-%s.pdf", route.DeliveryDate, strings.ReplaceAll(route.Vehicle, " ", ""))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+	if err := renderManifestPDF(w, route, s.config.I18n.LocationFor(tenantID)); err != nil {
+		s.logger.Warn("Failed to write driver manifest", "route_id", route.ID, "error", err)
+	}
+}
+
+// Layout of the driver manifest, in points.
+const (
+	manifestLeft   = 40.0
+	manifestRight  = pdf.PageWidth - 40
+	manifestTop    = pdf.PageHeight - 40
+	manifestBottom = 60.0
+	manifestLine   = 13.0
+
+	columnSlot      = 70.0
+	columnRecipient = 150.0
+	columnParcels   = 390.0
+	columnWeight    = 440.0
+	columnSignature = 455.0
+)
+
+// manifestDocument lays out a route's stops in delivery order, with room
+// for the recipient's signature, starting a new page when a stop does not
+// fit.
+type manifestDocument struct {
+	doc   *pdf.Document
+	pages []*pdf.Page
+	page  *pdf.Page
+	y     float64
+	loc   *time.Location
+	route *domain.DeliveryRoute
+}
+
+func renderManifestPDF(w io.Writer, route *domain.DeliveryRoute, loc *time.Location) error {
+	d := &manifestDocument{doc: pdf.New(), loc: loc, route: route}
+	d.newPage()
+	d.header()
+	d.stops()
+	d.footers()
+	_, err := d.doc.WriteTo(w)
+	return err
+}
+
+func (d *manifestDocument) newPage() {
+	d.page = d.doc.AddPage()
+	d.pages = append(d.pages, d.page)
+	d.y = manifestTop
+}
+
+func (d *manifestDocument) header() {
+	d.page.Text(manifestLeft, d.y-18, 18, true, "Driver manifest")
+	d.y -= 44
+
+	parcels := 0
+	for _, stop := range d.route.Stops {
+		parcels += stop.Parcels
+	}
+	details := [][2]string{
+		{"Route", d.route.Name},
+		{"Delivery date", d.route.DeliveryDate},
+		{"Vehicle", d.route.Vehicle},
+		{"Driver", d.route.DriverName},
+		{"Stops", fmt.Sprintf("%d (%d parcels)", len(d.route.Stops), parcels)},
+		{"Load", d.route.Load().String()},
+	}
+	for _, detail := range details {
+		if detail[1] == "" {
+			continue
+		}
+		d.page.Text(manifestLeft, d.y, 10, true, detail[0])
+		d.page.Text(manifestLeft+90, d.y, 10, false, detail[1])
+		d.y -= manifestLine + 2
+	}
+	d.y -= manifestLine
+}
+
+func (d *manifestDocument) tableHeader() {
+	d.page.Text(manifestLeft, d.y, 9, true, "#")
+	d.page.Text(columnSlot, d.y, 9, true, "Slot")
+	d.page.Text(columnRecipient, d.y, 9, true, "Order / address")
+	d.page.TextRight(columnParcels, d.y, 9, true, "Parcels")
+	d.page.TextRight(columnWeight, d.y, 9, true, "Weight")
+	d.page.Text(columnSignature, d.y, 9, true, "Received by / signature")
+	d.page.Line(manifestLeft, d.y-4, manifestRight, d.y-4)
+	d.y -= manifestLine + 4
+}
+
+func (d *manifestDocument) stops() {
+	d.tableHeader()
+	for _, stop := range d.route.Stops {
+		lines := d.stopLines(stop)
+		height := float64(len(lines))*manifestLine + 10
+		if d.y-height < manifestBottom {
+			d.newPage()
+			d.tableHeader()
+		}
+
+		d.page.Text(manifestLeft, d.y, 10, true, fmt.Sprintf("%d", stop.Sequence))
+		d.page.Text(columnSlot, d.y, 9, false, d.slot(stop))
+		d.page.TextRight(columnParcels, d.y, 9, false, fmt.Sprintf("%d", stop.Parcels))
+		d.page.TextRight(columnWeight, d.y, 9, false, stop.Weight.String())
+		for i, line := range lines {
+			d.page.Text(columnRecipient, d.y-float64(i)*manifestLine, 9, i == 0, pdf.Fit(line, 9, columnParcels-columnRecipient-45))
+		}
+		if stop.Status == domain.DeliveryStopStatusDelivered || stop.Status == domain.DeliveryStopStatusFailed {
+			d.page.Text(columnSignature, d.y, 9, false, pdf.Fit(stopOutcome(stop), 9, manifestRight-columnSignature))
+		}
+
+		d.y -= height
+		d.page.Line(manifestLeft, d.y+manifestLine-2, manifestRight, d.y+manifestLine-2)
+	}
+}
+
+// stopLines are what the driver needs to find a stop and hand the
+// shipment over: the order, tracking and delivery note numbers, the
+// address and any notes.
+func (d *manifestDocument) stopLines(stop domain.DeliveryStop) []string {
+	lines := []string{strings.TrimSpace(stop.OrderNumber + "  " + stop.TrackingNumber)}
+	if stop.DeliveryNoteNumber != "" {
+		lines = append(lines, "Delivery note: "+stop.DeliveryNoteNumber)
+	}
+	if stop.Recipient != "" {
+		lines = append(lines, stop.Recipient)
+	}
+	lines = append(lines, stop.Address.Street)
+	lines = append(lines, strings.TrimSpace(strings.Join([]string{stop.Address.PostalCode, stop.Address.City, stop.Address.Country}, " ")))
+	if stop.Notes != "" {
+		lines = append(lines, "Note: "+stop.Notes)
+	}
+	return lines
+}
+
+// slot is the stop's delivery window in the tenant's time zone.
+func (d *manifestDocument) slot(stop domain.DeliveryStop) string {
+	switch {
+	case stop.SlotStart != nil && stop.SlotEnd != nil:
+		return stop.SlotStart.In(d.loc).Format("15:04") + "-" + stop.SlotEnd.In(d.loc).Format("15:04")
+	case stop.SlotEnd != nil:
+		return "by " + stop.SlotEnd.In(d.loc).Format("15:04")
+	case stop.SlotStart != nil:
+		return "from " + stop.SlotStart.In(d.loc).Format("15:04")
+	}
+	return "any time"
+}
+
+func stopOutcome(stop domain.DeliveryStop) string {
+	if stop.Status == domain.DeliveryStopStatusFailed {
+		return "Failed: " + stop.FailureReason
+	}
+	return "Delivered to " + stop.ReceivedBy
+}
+
+// footers numbers the pages once the page count is known.
+func (d *manifestDocument) footers() {
+	total := len(d.pages)
+	for i, page := range d.pages {
+		page.TextRight(manifestRight, manifestBottom-30, 8, false, fmt.Sprintf("Page %d of %d", i+1, total))
+		page.Text(manifestLeft, manifestBottom-30, 8, false, d.route.DeliveryDate+" "+d.route.Vehicle)
+	}
+}
@@ -12,77 +12,65 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/auth"
 	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/numbering"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 	"github.com/ims-erp/system/pkg/tracer"
 )
 
-var allowedOrigins = []string{
-	"http://localhost:5173",
-	"http://localhost:5178",
-	"http://localhost:5174",
-	"http://localhost:5175",
-	"http://localhost:5176",
-	"http://localhost:5177",
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		isAllowed := false
-		for _, o := range allowedOrigins {
-			if origin == o {
-				isAllowed = true
-				break
-			}
-		}
-
-		if isAllowed {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Max-Age", "86400")
-		}
-
-		if r.Method == "OPTIONS" {
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 type OrderService struct {
-	config *config.Config
-	logger *logger.Logger
+	config  *config.Config
+	logger  *logger.Logger
+	mongodb *repository.MongoDB
+	numbers *numbering.Generator
+	routes  *repository.DeliveryRouteStore
+	// The service does not use Redis, so each replica counts its own
+	// requests against the throttle limits.
+	throttle *middleware.Throttle
 }
 
-func NewOrderService(cfg *config.Config, log *logger.Logger) *OrderService {
+func NewOrderService(cfg *config.Config, log *logger.Logger, mongodb *repository.MongoDB) *OrderService {
 	return &OrderService{
-		config: cfg,
-		logger: log,
+		config:  cfg,
+		logger:  log,
+		mongodb: mongodb,
+		numbers: numbering.NewGenerator(cfg.Numbering, cfg.I18n, repository.NewDocumentCounterStore(mongodb)),
+		routes:  repository.NewDeliveryRouteStore(mongodb),
+
+		throttle: middleware.NewThrottle(middleware.NewLocalLimiter(), cfg.Security.Throttle, log),
 	}
 }
 
 func (s *OrderService) setupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/health", s.healthHandler)
-	mux.HandleFunc("/ready", s.readinessHandler)
+	// MongoDB holds the document number sequences and delivery routes and is
+	// read for margin previews; stores and transports the service opens
+	// should be added here.
+	checks := health.NewHealthChecker(s.config, s.mongodb, nil, s.logger)
+	mux.Handle("/health", checks.Handler())
+	mux.Handle("/ready", checks.Readiness().Handler())
 	mux.HandleFunc("/live", s.livenessHandler)
-	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.Handle("/metrics", metrics.Handler())
 
 	mux.HandleFunc("/api/v1/orders", s.handleOrders)
-	mux.HandleFunc("/api/v1/orders/", s.handleOrderRouter)
-	mux.HandleFunc("/api/v1/orders/status", s.handleUpdateStatus)
-	mux.HandleFunc("/api/v1/orders/search", s.handleSearch)
-	mux.HandleFunc("/api/v1/orders/report/summary", s.handleSummaryReport)
-	mux.HandleFunc("/api/v1/orders/report/fulfillment", s.handleFulfillmentReport)
+	// Writes require If-Match now so that clients are ready for the ETags
+	// orders will carry once they are stored.
+	mux.Handle("/api/v1/orders/", middleware.RequireIfMatch(http.HandlerFunc(s.handleOrderRouter)))
+	mux.Handle("/api/v1/orders/status", middleware.RequireIfMatch(http.HandlerFunc(s.handleUpdateStatus)))
+	mux.Handle("/api/v1/orders/search", s.throttle.Limit(middleware.ThrottleSearch, http.HandlerFunc(s.handleSearch)))
+	mux.HandleFunc("/api/v1/orders/margin-preview", s.handleMarginPreview)
+	mux.Handle("/api/v1/orders/report/summary", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleSummaryReport)))
+	mux.Handle("/api/v1/orders/report/fulfillment", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleFulfillmentReport)))
+	mux.HandleFunc("/api/v1/delivery-routes", s.handleDeliveryRoutes)
+	mux.HandleFunc("/api/v1/delivery-routes/", s.handleDeliveryRouteByID)
 
 	return mux
 }
@@ -110,39 +98,16 @@ func (s *OrderService) handleOrderRouter(w http.ResponseWriter, r *http.Request)
 		r.URL.Query().Set("orderId", id)
 		s.handleOrderByID(w, r)
 	default:
-		http.Error(w, "Not found", http.StatusNotFound)
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
 	}
 }
 
-func (s *OrderService) healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "healthy", "timestamp": "%s", "service": "order-service"}`, time.Now().UTC())
-}
-
-func (s *OrderService) readinessHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "ready", "timestamp": "%s"}`, time.Now().UTC())
-}
-
 func (s *OrderService) livenessHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"status": "alive", "timestamp": "%s"}`, time.Now().UTC())
 }
 
-func (s *OrderService) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "# Order Service Metrics\n")
-	fmt.Fprintf(w, "order_service_up 1\n")
-	fmt.Fprintf(w, "order_service_requests_total 0\n")
-	fmt.Fprintf(w, "order_service_created_total 0\n")
-	fmt.Fprintf(w, "order_service_completed_total 0\n")
-	fmt.Fprintf(w, "order_service_cancelled_total 0\n")
-}
-
 func (s *OrderService) handleOrders(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -150,7 +115,7 @@ func (s *OrderService) handleOrders(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		s.createOrder(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -163,7 +128,7 @@ func (s *OrderService) handleOrderByID(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		s.cancelOrder(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -175,7 +140,7 @@ func (s *OrderService) handleOrderLines(w http.ResponseWriter, r *http.Request)
 	} else if r.Method == http.MethodPut {
 		s.updateOrderLine(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -183,7 +148,7 @@ func (s *OrderService) handleOrderPayments(w http.ResponseWriter, r *http.Reques
 	if r.Method == http.MethodPost {
 		s.addPayment(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -191,7 +156,7 @@ func (s *OrderService) handleOrderFulfillment(w http.ResponseWriter, r *http.Req
 	if r.Method == http.MethodPost {
 		s.fulfillOrder(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -199,7 +164,7 @@ func (s *OrderService) handleOrderShipment(w http.ResponseWriter, r *http.Reques
 	if r.Method == http.MethodPost {
 		s.shipOrder(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -207,7 +172,7 @@ func (s *OrderService) handleUpdateStatus(w http.ResponseWriter, r *http.Request
 	if r.Method == http.MethodPut {
 		s.updateOrderStatus(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -215,7 +180,7 @@ func (s *OrderService) handleSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		s.searchOrders(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -223,7 +188,7 @@ func (s *OrderService) handleSummaryReport(w http.ResponseWriter, r *http.Reques
 	if r.Method == http.MethodGet {
 		s.getSummaryReport(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -231,12 +196,12 @@ func (s *OrderService) handleFulfillmentReport(w http.ResponseWriter, r *http.Re
 	if r.Method == http.MethodGet {
 		s.getFulfillmentReport(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
 func (s *OrderService) listOrders(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	clientID := r.URL.Query().Get("clientId")
 	status := r.URL.Query().Get("status")
 	page := parseInt(r.URL.Query().Get("page"), 1)
@@ -253,9 +218,37 @@ func (s *OrderService) listOrders(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *OrderService) createOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, `{"message": "Order created", "id": "%s", "orderNumber": "ORD-%s"}`, generateUUID(), generateOrderNumber())
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	orderNumber, ok := s.nextNumber(w, r, numbering.DocumentOrder, req.Channel)
+	if !ok {
+		return
+	}
+	httpresponse.JSON(w, http.StatusCreated, map[string]string{
+		"message":     "Order created",
+		"id":          generateUUID(),
+		"orderNumber": orderNumber,
+	})
+}
+
+// nextNumber numbers a new document of the request's tenant, writing the
+// error response when it cannot.
+func (s *OrderService) nextNumber(w http.ResponseWriter, r *http.Request, documentType, channel string) (string, bool) {
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return "", false
+	}
+	number, err := s.numbers.Next(r.Context(), tenantID, documentType, channel)
+	if err != nil {
+		s.logger.Error("Failed to number document", "error", err, "document_type", documentType)
+		httpresponse.Error(w, r, err)
+		return "", false
+	}
+	return number, true
 }
 
 func (s *OrderService) getOrder(w http.ResponseWriter, r *http.Request) {
@@ -312,11 +305,19 @@ func (s *OrderService) shipOrder(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		TrackingNumber string `json:"trackingNumber"`
 		Carrier        string `json:"carrier"`
+		Channel        string `json:"channel"`
 	}
 	json.NewDecoder(r.Body).Decode(&req)
 
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"message": "Order shipped", "trackingNumber": "%s"}`, req.TrackingNumber)
+	shipmentNumber, ok := s.nextNumber(w, r, numbering.DocumentShipment, req.Channel)
+	if !ok {
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, map[string]string{
+		"message":        "Order shipped",
+		"shipmentNumber": shipmentNumber,
+		"trackingNumber": req.TrackingNumber,
+	})
 }
 
 func (s *OrderService) updateOrderStatus(w http.ResponseWriter, r *http.Request) {
@@ -338,7 +339,7 @@ func (s *OrderService) searchOrders(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *OrderService) getSummaryReport(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	startDate := r.URL.Query().Get("startDate")
 	endDate := r.URL.Query().Get("endDate")
 
@@ -351,7 +352,7 @@ func (s *OrderService) getSummaryReport(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *OrderService) getFulfillmentReport(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	startDate := r.URL.Query().Get("startDate")
 	endDate := r.URL.Query().Get("endDate")
 
@@ -381,6 +382,8 @@ func main() {
 	}
 	defer log.Sync()
 
+	metrics.Initialize(cfg.App.Name)
+
 	tr, err := tracer.New(tracer.Config{
 		Enabled:      cfg.Tracing.Enabled,
 		ServiceName:  cfg.App.Name,
@@ -395,9 +398,27 @@ func main() {
 	}
 	defer tr.Shutdown(context.Background())
 
-	service := NewOrderService(cfg, log)
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		log.Error("Failed to connect to MongoDB", "error", err)
+		os.Exit(1)
+	}
+	defer mongodb.Close(context.Background())
+	log.Info("Connected to MongoDB")
+
+	service := NewOrderService(cfg, log, mongodb)
+	if err := service.routes.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create delivery route indexes", "error", err)
+	}
 	mux := service.setupRoutes()
-	handler := corsMiddleware(mux)
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		log.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	handler := metrics.HTTPMiddleware(middleware.Instrument(log, middleware.NewCORSMiddleware(&cfg.Security).Handler(tenants.Handler(mux))))
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
@@ -444,7 +465,3 @@ func parseInt(s string, defaultVal int) int {
 func generateUUID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
-
-func generateOrderNumber() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
-}
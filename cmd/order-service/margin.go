@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/money"
+)
+
+// handleMarginPreview returns the expected margin of prospective order
+// lines, costed from the cost layers of the stock, and flags the lines
+// priced below their product's floor.
+func (s *OrderService) handleMarginPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	// Lines are decoded as maps so that prices can be given in minor
+	// units, as unitPriceMinor, like everywhere else.
+	var req struct {
+		WarehouseID string                   `json:"warehouseId"`
+		Currency    string                   `json:"currency"`
+		Lines       []map[string]interface{} `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	query := &queries.GetMarginPreviewQuery{TenantID: tenantID, Currency: req.Currency}
+	if req.WarehouseID != "" {
+		if query.WarehouseID, err = uuid.Parse(req.WarehouseID); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid warehouse ID")
+			return
+		}
+	}
+	for _, data := range req.Lines {
+		line, err := marginPreviewLine(data, req.Currency)
+		if err != nil {
+			httpresponse.Error(w, r, err)
+			return
+		}
+		query.Lines = append(query.Lines, line)
+	}
+
+	preview, err := queries.GetMarginPreview(r.Context(), repository.NewMarginStore(s.mongodb), query)
+	if err != nil {
+		s.logger.Error("Failed to preview margin", "error", err)
+		httpresponse.Error(w, r, err)
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, preview)
+}
+
+func marginPreviewLine(data map[string]interface{}, currency string) (queries.MarginPreviewLine, error) {
+	var line queries.MarginPreviewLine
+
+	productID, _ := data["productId"].(string)
+	id, err := uuid.Parse(productID)
+	if err != nil {
+		return line, errors.InvalidArgument("invalid product ID %q", productID)
+	}
+	line.ProductID = id
+
+	quantity, _ := data["quantity"].(float64)
+	line.Quantity = int(quantity)
+
+	unitPrice, ok, err := money.Parse(data, "unitPrice", currency)
+	if err != nil {
+		return line, err
+	}
+	if !ok {
+		return line, errors.InvalidArgument("unitPrice is required")
+	}
+	line.UnitPrice = unitPrice
+
+	if line.Discount, _, err = money.Parse(data, "discount", currency); err != nil {
+		return line, err
+	}
+	return line, nil
+}
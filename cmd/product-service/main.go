@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -11,77 +12,57 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/auth"
 	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/numbering"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 	"github.com/ims-erp/system/pkg/tracer"
 )
 
-var allowedOrigins = []string{
-	"http://localhost:5173",
-	"http://localhost:5178",
-	"http://localhost:5174",
-	"http://localhost:5175",
-	"http://localhost:5176",
-	"http://localhost:5177",
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		isAllowed := false
-		for _, o := range allowedOrigins {
-			if origin == o {
-				isAllowed = true
-				break
-			}
-		}
-
-		if isAllowed {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Max-Age", "86400")
-		}
-
-		if r.Method == "OPTIONS" {
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 type ProductService struct {
-	config *config.Config
-	logger *logger.Logger
+	config  *config.Config
+	logger  *logger.Logger
+	mongodb *repository.MongoDB
+	numbers *numbering.Generator
+	// The service does not use Redis, so each replica counts its own
+	// requests against the throttle limits.
+	throttle *middleware.Throttle
 }
 
-func NewProductService(cfg *config.Config, log *logger.Logger) *ProductService {
+func NewProductService(cfg *config.Config, log *logger.Logger, mongodb *repository.MongoDB) *ProductService {
 	return &ProductService{
-		config: cfg,
-		logger: log,
+		config:  cfg,
+		logger:  log,
+		mongodb: mongodb,
+		numbers: numbering.NewGenerator(cfg.Numbering, cfg.I18n, repository.NewDocumentCounterStore(mongodb)),
+
+		throttle: middleware.NewThrottle(middleware.NewLocalLimiter(), cfg.Security.Throttle, log),
 	}
 }
 
 func (s *ProductService) setupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/health", s.healthHandler)
-	mux.HandleFunc("/ready", s.readinessHandler)
+	// MongoDB only holds the SKU sequence so far; stores and transports the
+	// service opens should be added here.
+	checks := health.NewHealthChecker(s.config, s.mongodb, nil, s.logger)
+	mux.Handle("/health", checks.Handler())
+	mux.Handle("/ready", checks.Readiness().Handler())
 	mux.HandleFunc("/live", s.livenessHandler)
-	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.Handle("/metrics", metrics.Handler())
 
 	mux.HandleFunc("/api/v1/products", s.handleProducts)
 	mux.HandleFunc("/api/v1/products/", s.handleProductRouter)
-	mux.HandleFunc("/api/v1/products/search", s.handleSearch)
+	mux.Handle("/api/v1/products/search", s.throttle.Limit(middleware.ThrottleSearch, http.HandlerFunc(s.handleSearch)))
 	mux.HandleFunc("/api/v1/products/categories", s.handleCategories)
 	mux.HandleFunc("/api/v1/products/brands", s.handleBrands)
-	mux.HandleFunc("/api/v1/products/report/valuation", s.handleValuationReport)
+	mux.Handle("/api/v1/products/report/valuation", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleValuationReport)))
 
 	return mux
 }
@@ -109,38 +90,16 @@ func (s *ProductService) handleProductRouter(w http.ResponseWriter, r *http.Requ
 		r.URL.Query().Set("productId", id)
 		s.handleProductByID(w, r)
 	default:
-		http.Error(w, "Not found", http.StatusNotFound)
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
 	}
 }
 
-func (s *ProductService) healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "healthy", "timestamp": "%s", "service": "product-service"}`, time.Now().UTC())
-}
-
-func (s *ProductService) readinessHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "ready", "timestamp": "%s"}`, time.Now().UTC())
-}
-
 func (s *ProductService) livenessHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"status": "alive", "timestamp": "%s"}`, time.Now().UTC())
 }
 
-func (s *ProductService) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "# Product Service Metrics\n")
-	fmt.Fprintf(w, "product_service_up 1\n")
-	fmt.Fprintf(w, "product_service_requests_total 0\n")
-	fmt.Fprintf(w, "product_service_created_total 0\n")
-	fmt.Fprintf(w, "product_service_active_total 0\n")
-}
-
 func (s *ProductService) handleProducts(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -148,7 +107,7 @@ func (s *ProductService) handleProducts(w http.ResponseWriter, r *http.Request)
 	case http.MethodPost:
 		s.createProduct(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -161,7 +120,7 @@ func (s *ProductService) handleProductByID(w http.ResponseWriter, r *http.Reques
 	case http.MethodDelete:
 		s.deleteProduct(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -171,7 +130,7 @@ func (s *ProductService) handleProductVariants(w http.ResponseWriter, r *http.Re
 	} else if r.Method == http.MethodGet {
 		s.listVariants(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -181,7 +140,7 @@ func (s *ProductService) handleProductPricing(w http.ResponseWriter, r *http.Req
 	} else if r.Method == http.MethodGet {
 		s.getPricing(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -191,7 +150,7 @@ func (s *ProductService) handleProductInventory(w http.ResponseWriter, r *http.R
 	} else if r.Method == http.MethodPut {
 		s.updateInventory(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -201,7 +160,7 @@ func (s *ProductService) handleProductImages(w http.ResponseWriter, r *http.Requ
 	} else if r.Method == http.MethodDelete {
 		s.deleteImage(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -209,7 +168,7 @@ func (s *ProductService) handleSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		s.searchProducts(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -220,7 +179,7 @@ func (s *ProductService) handleCategories(w http.ResponseWriter, r *http.Request
 	case http.MethodPost:
 		s.createCategory(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -231,7 +190,7 @@ func (s *ProductService) handleBrands(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		s.createBrand(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -239,12 +198,12 @@ func (s *ProductService) handleValuationReport(w http.ResponseWriter, r *http.Re
 	if r.Method == http.MethodGet {
 		s.getValuationReport(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
 func (s *ProductService) listProducts(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	category := r.URL.Query().Get("category")
 	status := r.URL.Query().Get("status")
 	page := parseInt(r.URL.Query().Get("page"), 1)
@@ -260,10 +219,32 @@ func (s *ProductService) listProducts(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"products": [], "total": 0, "page": %d, "pageSize": %d}`, page, pageSize)
 }
 
+// createProduct numbers products created without a SKU by the tenant's sku
+// scheme.
 func (s *ProductService) createProduct(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, `{"message": "Product created", "id": "%s"}`, generateUUID())
+	var req struct {
+		SKU string `json:"sku"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	if strings.TrimSpace(req.SKU) == "" {
+		tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+			return
+		}
+		req.SKU, err = s.numbers.Next(r.Context(), tenantID, numbering.DocumentSKU, "")
+		if err != nil {
+			s.logger.Error("Failed to number product", "error", err)
+			httpresponse.Error(w, r, err)
+			return
+		}
+	}
+	httpresponse.JSON(w, http.StatusCreated, map[string]string{
+		"message": "Product created",
+		"id":      generateUUID(),
+		"sku":     req.SKU,
+	})
 }
 
 func (s *ProductService) getProduct(w http.ResponseWriter, r *http.Request) {
@@ -357,7 +338,7 @@ func (s *ProductService) createBrand(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *ProductService) getValuationReport(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantId")
+	tenantID := middleware.GetTenantID(r.Context())
 	_ = tenantID
 
 	w.Header().Set("Content-Type", "application/json")
@@ -382,6 +363,8 @@ func main() {
 	}
 	defer log.Sync()
 
+	metrics.Initialize(cfg.App.Name)
+
 	tr, err := tracer.New(tracer.Config{
 		Enabled:      cfg.Tracing.Enabled,
 		ServiceName:  cfg.App.Name,
@@ -396,9 +379,24 @@ func main() {
 	}
 	defer tr.Shutdown(context.Background())
 
-	service := NewProductService(cfg, log)
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		log.Error("Failed to connect to MongoDB", "error", err)
+		os.Exit(1)
+	}
+	defer mongodb.Close(context.Background())
+	log.Info("Connected to MongoDB")
+
+	service := NewProductService(cfg, log, mongodb)
 	mux := service.setupRoutes()
-	handler := corsMiddleware(mux)
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		log.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	handler := metrics.HTTPMiddleware(middleware.Instrument(log, middleware.NewCORSMiddleware(&cfg.Security).Handler(tenants.Handler(mux))))
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
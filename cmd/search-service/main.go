@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/search"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/ims-erp/system/pkg/tracer"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const indexerConsumer = "search-indexer"
+
+// indexFeed is one event stream the indexer consumes.
+type indexFeed struct {
+	stream  string
+	subject string
+}
+
+// indexFeeds are the streams of every searchable aggregate.
+var indexFeeds = []indexFeed{
+	{stream: "CLIENT_EVENTS", subject: "evt.Client.>"},
+	{stream: "PRODUCT_EVENTS", subject: "evt.product.>"},
+	{stream: "INVOICE_EVENTS", subject: "evt.invoice.>"},
+	{stream: "ORDER_EVENTS", subject: "evt.order.>"},
+	{stream: "DOCUMENT_EVENTS", subject: "evt.Document.>"},
+}
+
+func main() {
+	cfg, err := config.Load("", "search-service")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, err := logger.New(logger.Config{
+		Level:       cfg.Logging.Level,
+		Format:      cfg.Logging.Format,
+		ServiceName: cfg.App.Name,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	group := lifecycle.New(log)
+
+	metrics.Initialize(cfg.App.Name)
+
+	tr, err := tracer.New(tracer.Config{
+		Enabled:      cfg.Tracing.Enabled,
+		ServiceName:  cfg.App.Name,
+		ExporterType: cfg.Tracing.ExporterType,
+		Endpoint:     cfg.Tracing.Endpoint,
+		SamplerType:  cfg.Tracing.SamplerType,
+		SamplerRatio: cfg.Tracing.SamplerRatio,
+	})
+	if err != nil {
+		log.Error("Failed to create tracer", "error", err)
+		os.Exit(1)
+	}
+	defer tr.Shutdown(context.Background())
+
+	messaging.SetupTracePropagation()
+
+	client, err := search.NewClient(cfg.Elasticsearch, log)
+	if err != nil {
+		log.Error("Failed to configure Elasticsearch", "error", err)
+		os.Exit(1)
+	}
+
+	subscriber, err := messaging.NewEventSubscriber(cfg, log)
+	if err != nil {
+		log.Error("Failed to create event subscriber", "error", err, "transport", cfg.Messaging.Transport)
+		os.Exit(1)
+	}
+	defer subscriber.Close()
+	group.OnShutdown("subscriber", subscriber.Drain)
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
+
+	indexer := search.NewIndexer(client, log)
+	dlq, err := consumeEvents(group, cfg, subscriber, indexer)
+	if err != nil {
+		log.Error("Failed to start search indexer", "error", err)
+		os.Exit(1)
+	}
+
+	healthChecker := health.NewHealthChecker(cfg, nil, nil, log)
+	healthChecker.AddComponent("elasticsearch", health.ElasticsearchCheck(client))
+	healthChecker.AddComponent("messaging", health.MessagingCheck(subscriber))
+	if natsSubscriber, ok := subscriber.(*messaging.Subscriber); ok && cfg.NATS.JetStream.Enabled {
+		for _, feed := range indexFeeds {
+			healthChecker.AddComponent("consumer:"+feed.stream, health.ConsumerLagCheck(
+				natsSubscriber, feed.stream, indexerConsumer, cfg.NATS.JetStream.MaxConsumerLag))
+		}
+	}
+	readinessChecker := healthChecker.Readiness()
+	livenessChecker := health.NewLivenessChecker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", healthChecker.Handler())
+	mux.Handle("/ready", readinessChecker.Handler())
+	mux.Handle("/live", livenessChecker.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	if dlq != nil {
+		mux.Handle("/admin/dlq", dlq.Handler())
+		mux.Handle("/admin/dlq/", dlq.Handler())
+	}
+	if natsSubscriber, ok := subscriber.(*messaging.Subscriber); ok && cfg.NATS.JetStream.Enabled {
+		mux.Handle("/debug/consumers", natsSubscriber.ConsumersHandler())
+	}
+	// The service does not use Redis, so each replica counts its own
+	// searches against the throttle limits.
+	throttle := middleware.NewThrottle(middleware.NewLocalLimiter(), cfg.Security.Throttle, log)
+	mux.Handle("/api/v1/search", throttle.Limit(middleware.ThrottleSearch, search.NewHandler(client, log)))
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		log.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
+		Handler:      metrics.HTTPMiddleware(middleware.Instrument(log, tenants.Handler(mux))),
+		ReadTimeout:  cfg.App.ReadTimeout,
+		WriteTimeout: cfg.App.WriteTimeout,
+	}
+	group.OnShutdown("http server", srv.Shutdown)
+
+	go func() {
+		log.Info("Starting search-service", "port", cfg.App.Port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("Server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	sig := group.WaitForSignal()
+	log.Info("Shutting down", "signal", sig)
+	if err := group.Shutdown(cfg.App.ShutdownTimeout); err != nil {
+		log.Error("Shutdown incomplete", "error", err)
+	}
+}
+
+// consumeEvents feeds the indexer from every index feed. JetStream consumers
+// retry failed events and dead-letter them, so an Elasticsearch outage only
+// delays indexing; without JetStream, and on Kafka, the indexer runs in a
+// consumer group and failures are logged. It returns the dead letter queue
+// when JetStream is in use.
+func consumeEvents(group *lifecycle.Group, cfg *config.Config, subscriber messaging.EventSubscriber, indexer *search.Indexer) (*messaging.DeadLetterQueue, error) {
+	natsSubscriber, onNATS := subscriber.(*messaging.Subscriber)
+	if !onNATS || !cfg.NATS.JetStream.Enabled {
+		for _, feed := range indexFeeds {
+			if err := subscriber.SubscribeGroup(group.Context(), feed.subject, indexerConsumer, createEventHandler(indexer)); err != nil {
+				return nil, fmt.Errorf("subscribe %s: %w", feed.subject, err)
+			}
+		}
+		return nil, nil
+	}
+
+	deadLetter := cfg.NATS.DeadLetter
+	prefix := cfg.NATS.JetStream.StreamPrefix
+	for _, feed := range indexFeeds {
+		if err := natsSubscriber.EnsureStream(group.Context(), messaging.StreamConfig{
+			Name:     feed.stream,
+			Subjects: []string{prefix + feed.subject},
+			MaxAge:   7 * 24 * time.Hour,
+			Storage:  jetstream.FileStorage,
+		}); err != nil {
+			return nil, fmt.Errorf("ensure stream %s: %w", feed.stream, err)
+		}
+
+		cc, err := natsSubscriber.Consume(group.Context(), messaging.ConsumerSpec{
+			Stream:        feed.stream,
+			Consumer:      indexerConsumer,
+			FilterSubject: prefix + feed.subject,
+			MaxDeliver:    deadLetter.MaxDeliver,
+			AckWait:       deadLetter.AckWait,
+			Backoff:       deadLetter.Backoff,
+		}, createJetStreamHandler(indexer))
+		if err != nil {
+			return nil, fmt.Errorf("consume %s: %w", feed.stream, err)
+		}
+		group.OnShutdown("consumer "+feed.stream, func(context.Context) error {
+			cc.Stop()
+			return nil
+		})
+	}
+
+	dlq := natsSubscriber.DeadLetterQueue()
+	group.Go("dead letter monitor", func(ctx context.Context) {
+		dlq.Monitor(ctx, deadLetter.CheckInterval, deadLetter.AlertThreshold)
+	})
+	group.Go("consumer monitor", func(ctx context.Context) {
+		natsSubscriber.MonitorConsumers(ctx, cfg.NATS.JetStream.StatsInterval)
+	})
+	return dlq, nil
+}
+
+func createEventHandler(indexer *search.Indexer) messaging.DeliveryHandler {
+	return func(ctx context.Context, msg *messaging.Delivery) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		if err := indexer.HandleEvent(ctx, &event); err != nil {
+			return fmt.Errorf("failed to index %s: %w", event.Type, err)
+		}
+		return nil
+	}
+}
+
+// createJetStreamHandler surfaces indexing failures so the consumer can retry
+// and eventually dead-letter the message. Undecodable payloads are poison.
+func createJetStreamHandler(indexer *search.Indexer) messaging.MessageHandler {
+	return func(ctx context.Context, msg jetstream.Msg) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data(), &event); err != nil {
+			return fmt.Errorf("%w: %v", messaging.ErrPoison, err)
+		}
+		return indexer.HandleEvent(ctx, &event)
+	}
+}
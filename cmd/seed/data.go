@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	companyNames = []string{
+		"Northwind", "Bluestone", "Harbor", "Crescent", "Summit", "Ironbridge", "Maple", "Redwood",
+		"Silverline", "Atlas", "Pioneer", "Granite", "Lakeside", "Evergreen", "Falcon", "Keystone",
+	}
+	companySuffixes = []string{"Traders", "Industries", "Supply Co", "Logistics", "Manufacturing", "Retail", "Holdings", "Partners"}
+
+	productAdjectives = []string{"Steel", "Aluminium", "Heavy-Duty", "Compact", "Industrial", "Precision", "Reinforced", "Modular"}
+	productNouns      = []struct {
+		name     string
+		category domain.ProductCategory
+	}{
+		{"Bracket", domain.CategoryComponent},
+		{"Hinge", domain.CategoryComponent},
+		{"Fastener Kit", domain.CategoryComponent},
+		{"Shelving Unit", domain.CategoryFinishedGood},
+		{"Workbench", domain.CategoryFinishedGood},
+		{"Tool Cabinet", domain.CategoryFinishedGood},
+		{"Sheet", domain.CategoryRawMaterial},
+		{"Rod", domain.CategoryRawMaterial},
+		{"Shipping Crate", domain.CategoryPackaging},
+		{"Pallet Wrap", domain.CategoryPackaging},
+	}
+
+	cities = []domain.Address{
+		{City: "Austin", State: "TX", PostalCode: "73301", Country: "US"},
+		{City: "Denver", State: "CO", PostalCode: "80202", Country: "US"},
+		{City: "Portland", State: "OR", PostalCode: "97201", Country: "US"},
+		{City: "Columbus", State: "OH", PostalCode: "43004", Country: "US"},
+		{City: "Raleigh", State: "NC", PostalCode: "27601", Country: "US"},
+		{City: "Madison", State: "WI", PostalCode: "53703", Country: "US"},
+	}
+	streets = []string{"Main St", "Oak Ave", "Industrial Pkwy", "Commerce Dr", "Harbor Blvd", "Mill Rd"}
+
+	warehouseTypes = []domain.WarehouseType{domain.WarehouseTypeMain, domain.WarehouseTypeDistribution, domain.WarehouseTypeFulfillment}
+
+	orderSources   = []domain.OrderSource{domain.OrderSourceWeb, domain.OrderSourceAPI, domain.OrderSourcePhone, domain.OrderSourceMarketplace}
+	paymentTerms   = []domain.PaymentTerm{domain.PaymentTermNet15, domain.PaymentTermNet30, domain.PaymentTermNet30, domain.PaymentTermNet45}
+	paymentMethods = []domain.PaymentMethod{domain.PaymentMethodBankTransfer, domain.PaymentMethodWire, domain.PaymentMethodCheck}
+
+	// taxRate is the percentage applied to every seeded order and invoice line.
+	taxRate = decimal.NewFromInt(20)
+)
+
+func pick[T any](rng *rand.Rand, items []T) T {
+	return items[rng.Intn(len(items))]
+}
+
+func randomAddress(rng *rand.Rand) domain.Address {
+	addr := pick(rng, cities)
+	addr.Street = fmt.Sprintf("%d %s", 100+rng.Intn(9900), pick(rng, streets))
+	return addr
+}
+
+// randomPrice returns a price between min and max with whole cents.
+func randomPrice(rng *rand.Rand, min, max int) decimal.Decimal {
+	cents := int64(min*100 + rng.Intn((max-min)*100))
+	return decimal.New(cents, -2)
+}
+
+func slug(s string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "-", "&", "and").Replace(s))
+}
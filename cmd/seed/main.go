@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+const (
+	// DemoTenantID is the tenant scripts/seed-admin.go creates the admin user
+	// in, so the seeded data is visible after logging in as admin@erp.local.
+	DemoTenantID = "00000000-0000-0000-0000-000000000001"
+	// DemoUserID is recorded as the creator of seeded records.
+	DemoUserID = "00000000-0000-0000-0000-000000000002"
+)
+
+func main() {
+	configPath := flag.String("config", "", "config file (default: seed.yaml in the usual config paths)")
+	tenantID := flag.String("tenant", DemoTenantID, "tenant to seed")
+	userID := flag.String("user", DemoUserID, "user recorded as creator of seeded records")
+	out := flag.String("out", "seed-manifest.json", "write the IDs of seeded records to this file")
+	timeout := flag.Duration("timeout", 30*time.Minute, "give up after this long")
+
+	var volume Volume
+	flag.IntVar(&volume.Warehouses, "warehouses", 3, "number of warehouses")
+	flag.IntVar(&volume.Products, "products", 50, "number of products, stocked in every warehouse")
+	flag.IntVar(&volume.Clients, "clients", 25, "number of clients")
+	flag.IntVar(&volume.OrdersPerClient, "orders-per-client", 4, "orders per client, each invoiced")
+	flag.IntVar(&volume.MaxLines, "max-lines", 5, "maximum lines per order")
+	flag.Float64Var(&volume.PaidRatio, "paid", 0.6, "fraction of invoices paid in full")
+	flag.Float64Var(&volume.PartialRatio, "partial", 0.2, "fraction of invoices partially paid")
+	flag.Int64Var(&volume.Seed, "seed", 1, "random seed; the same seed produces the same names, quantities and prices")
+	flag.Parse()
+
+	if err := volume.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if _, err := uuid.Parse(*tenantID); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid tenant %q\n", *tenantID)
+		os.Exit(2)
+	}
+	if _, err := uuid.Parse(*userID); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid user %q\n", *userID)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath, "seed")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, err := logger.New(logger.Config{
+		Level:       cfg.Logging.Level,
+		Format:      cfg.Logging.Format,
+		ServiceName: "seed",
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		log.Error("Failed to connect to MongoDB", "error", err)
+		os.Exit(1)
+	}
+	defer mongodb.Close(context.Background())
+
+	redis, err := repository.NewRedis(cfg.Redis, log)
+	if err != nil {
+		log.Error("Failed to connect to Redis", "error", err)
+		os.Exit(1)
+	}
+	defer redis.Close()
+
+	seeder := NewSeeder(mongodb, repository.NewCache(redis, "t:"+cfg.MongoDB.Database, log), log, *tenantID, *userID, volume)
+	manifest, err := seeder.Run(ctx)
+	if err != nil {
+		log.Error("Seeding failed", "error", err)
+		os.Exit(1)
+	}
+
+	if err := writeManifest(*out, manifest); err != nil {
+		log.Error("Failed to write manifest", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Seeded tenant %s: %d warehouses, %d products, %d clients, %d orders, %d invoices, %d payments\n",
+		manifest.TenantID, len(manifest.Warehouses), len(manifest.Products), len(manifest.Clients),
+		len(manifest.Orders), len(manifest.Invoices), len(manifest.Payments))
+	fmt.Printf("Manifest written to %s\n", *out)
+}
+
+func writeManifest(path string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
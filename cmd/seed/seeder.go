@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// offlineProvider settles payments received outside a payment gateway, such
+// as bank transfers and checks, as soon as they are processed.
+const offlineProvider = "offline"
+
+// Volume controls how much data a run creates.
+type Volume struct {
+	Warehouses      int
+	Products        int
+	Clients         int
+	OrdersPerClient int
+	MaxLines        int
+	PaidRatio       float64
+	PartialRatio    float64
+	Seed            int64
+}
+
+func (v Volume) Validate() error {
+	switch {
+	case v.Warehouses < 1 || v.Products < 1 || v.Clients < 1:
+		return fmt.Errorf("warehouses, products and clients must be at least 1")
+	case v.OrdersPerClient < 0 || v.MaxLines < 1:
+		return fmt.Errorf("orders-per-client must not be negative and max-lines must be at least 1")
+	case v.PaidRatio < 0 || v.PartialRatio < 0 || v.PaidRatio+v.PartialRatio > 1:
+		return fmt.Errorf("paid and partial must be non-negative and add up to at most 1")
+	}
+	return nil
+}
+
+// Manifest lists the records a run created, so tools such as the load
+// tester can reference entities that exist.
+type Manifest struct {
+	TenantID   string    `json:"tenantId"`
+	UserID     string    `json:"userId"`
+	Seed       int64     `json:"seed"`
+	SeededAt   time.Time `json:"seededAt"`
+	Warehouses []string  `json:"warehouses"`
+	Products   []string  `json:"products"`
+	Clients    []string  `json:"clients"`
+	Orders     []string  `json:"orders"`
+	Invoices   []string  `json:"invoices"`
+	Payments   []string  `json:"payments"`
+}
+
+// Seeder creates a demo tenant. Clients, invoices and payments go through
+// the command handlers the services use, so the event store, invoice
+// numbering and read models end up as they would for data entered through
+// the API. Warehouses, products, stock and orders have no command handlers
+// yet and are written to their collections directly.
+type Seeder struct {
+	db       *repository.MongoDB
+	clients  *commands.ClientCommandHandler
+	invoices *commands.InvoiceCommandHandler
+	payments *commands.PaymentCommandHandler
+	logger   *logger.Logger
+	tenantID string
+	userID   string
+	tenant   uuid.UUID
+	user     uuid.UUID
+	volume   Volume
+	rng      *rand.Rand
+}
+
+func NewSeeder(db *repository.MongoDB, cache *repository.Cache, log *logger.Logger, tenantID, userID string, volume Volume) *Seeder {
+	eventStore := repository.NewEventStore(db, log)
+	invoiceRepo := repository.NewMongoInvoiceRepository(db, log)
+
+	// Events are projected into the read models here rather than published:
+	// subscribers such as webhooks and notifications must not react to demo
+	// data.
+	clientRead := repository.NewReadModelStore(db, "client_read", log)
+	clientEvents := eventpkg.NewClientEventHandler(clientRead, cache, log)
+	paymentEvents := eventpkg.NewPaymentEventHandler(
+		repository.NewReadModelStore(db, "payment_read_models", log),
+		repository.NewReadModelStore(db, "invoice_read", log),
+		clientRead,
+		cache,
+		log,
+	)
+	registry := eventpkg.NewEventHandlerRegistry()
+	registry.Register("ClientCreated", clientEvents.HandleClientCreated)
+	registry.Register("payment.created", paymentEvents.HandlePaymentCreated)
+	registry.Register("payment.processed", paymentEvents.HandlePaymentProcessed)
+	publisher := &projector{registry: registry}
+
+	processors := domain.NewProcessorRegistry()
+	processors.Register(offlineProvider, func(string, interface{}) (domain.PaymentProcessor, error) {
+		return offlineProcessor{}, nil
+	})
+
+	return &Seeder{
+		db: db,
+		clients: commands.NewClientCommandHandler(eventStore, publisher, log, commands.TenantConfig{
+			AutoGenerateCode:   true,
+			CodePrefix:         "CLT",
+			DefaultCreditLimit: decimal.NewFromInt(10000),
+			RequireEmail:       true,
+		}),
+		invoices: commands.NewInvoiceCommandHandler(invoiceRepo, eventStore, publisher, log, repository.NewMongoInvoiceCounter(db, log)),
+		payments: commands.NewPaymentCommandHandler(repository.NewMongoPaymentRepository(db, log), invoiceRepo, eventStore, publisher, log, processors),
+		logger:   log,
+		tenantID: tenantID,
+		userID:   userID,
+		tenant:   uuid.MustParse(tenantID),
+		user:     uuid.MustParse(userID),
+		volume:   volume,
+		rng:      rand.New(rand.NewSource(volume.Seed)),
+	}
+}
+
+// Run seeds the tenant. Each run adds a new set of records; numbering
+// continues after the tenant's existing warehouses, products and orders.
+func (s *Seeder) Run(ctx context.Context) (*Manifest, error) {
+	manifest := &Manifest{
+		TenantID: s.tenantID,
+		UserID:   s.userID,
+		Seed:     s.volume.Seed,
+		SeededAt: time.Now().UTC(),
+	}
+
+	warehouses, err := s.seedWarehouses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range warehouses {
+		manifest.Warehouses = append(manifest.Warehouses, w.ID.String())
+	}
+
+	products, err := s.seedProducts(ctx, warehouses)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		manifest.Products = append(manifest.Products, p.ID.String())
+	}
+
+	orderSeq, err := s.count(ctx, "orders")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < s.volume.Clients; i++ {
+		client, err := s.createClient(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Clients = append(manifest.Clients, client.ID.String())
+
+		for j := 0; j < s.volume.OrdersPerClient; j++ {
+			orderSeq++
+			if err := s.seedOrder(ctx, client, products, orderSeq, manifest); err != nil {
+				return nil, err
+			}
+		}
+		s.logger.Info("Seeded client", "client", i+1, "of", s.volume.Clients, "orders", s.volume.OrdersPerClient)
+	}
+
+	return manifest, nil
+}
+
+func (s *Seeder) seedWarehouses(ctx context.Context) ([]*domain.Warehouse, error) {
+	existing, err := s.count(ctx, "warehouses")
+	if err != nil {
+		return nil, err
+	}
+
+	warehouses := make([]*domain.Warehouse, 0, s.volume.Warehouses)
+	docs := make([]interface{}, 0, s.volume.Warehouses)
+	for i := 0; i < s.volume.Warehouses; i++ {
+		n := existing + i + 1
+		address := randomAddress(s.rng)
+		warehouse := domain.NewWarehouse(s.tenant, fmt.Sprintf("%s Warehouse %d", address.City, n), fmt.Sprintf("WH%02d", n), warehouseTypes[i%len(warehouseTypes)])
+		warehouse.Address = address
+		warehouse.IsPrimary = existing == 0 && i == 0
+		warehouse.Capacity = 5000 + s.rng.Intn(20)*1000
+		warehouse.ContactEmail = fmt.Sprintf("wh%02d@demo.example.com", n)
+		warehouse.OperatingHours = "Mon-Fri 08:00-18:00"
+		warehouses = append(warehouses, warehouse)
+		docs = append(docs, warehouse)
+	}
+
+	if _, err := s.db.Collection("warehouses").InsertMany(ctx, docs); err != nil {
+		return nil, fmt.Errorf("failed to insert warehouses: %w", err)
+	}
+	return warehouses, nil
+}
+
+// seedProducts creates active products and stocks each of them in every
+// warehouse; the product's quantity on hand is the sum across warehouses.
+func (s *Seeder) seedProducts(ctx context.Context, warehouses []*domain.Warehouse) ([]*domain.Product, error) {
+	existing, err := s.count(ctx, "products")
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]*domain.Product, 0, s.volume.Products)
+	productDocs := make([]interface{}, 0, s.volume.Products)
+	stockDocs := make([]interface{}, 0, s.volume.Products*len(warehouses))
+	for i := 0; i < s.volume.Products; i++ {
+		noun := pick(s.rng, productNouns)
+		name := pick(s.rng, productAdjectives) + " " + noun.name
+		sku := fmt.Sprintf("DEMO-%05d", existing+i+1)
+
+		product, err := domain.NewProduct(s.tenant, s.user, sku, name, domain.ProductTypeGood, noun.category, "USD")
+		if err != nil {
+			return nil, err
+		}
+		cost := randomPrice(s.rng, 5, 400)
+		listPrice := cost.Mul(decimal.NewFromFloat(1.3 + s.rng.Float64()*0.7)).Round(2)
+		product.SetPricing(listPrice, listPrice, cost)
+
+		onHand := 0
+		for _, warehouse := range warehouses {
+			qty := 20 + s.rng.Intn(480)
+			onHand += qty
+			stockDocs = append(stockDocs, domain.NewInventoryItem(s.tenant, product.ID, warehouse.ID, sku, qty, cost))
+		}
+		product.SetInventory(onHand, onHand/10, onHand/4)
+		product.Activate()
+
+		products = append(products, product)
+		productDocs = append(productDocs, product)
+	}
+
+	if _, err := s.db.Collection("products").InsertMany(ctx, productDocs); err != nil {
+		return nil, fmt.Errorf("failed to insert products: %w", err)
+	}
+	if _, err := s.db.Collection("inventory").InsertMany(ctx, stockDocs); err != nil {
+		return nil, fmt.Errorf("failed to insert inventory: %w", err)
+	}
+	return products, nil
+}
+
+func (s *Seeder) createClient(ctx context.Context, i int) (*domain.Client, error) {
+	name := pick(s.rng, companyNames) + " " + pick(s.rng, companySuffixes)
+	address := randomAddress(s.rng)
+
+	cmd := commands.NewCommand("client.create", s.tenantID, "", s.userID, map[string]interface{}{
+		"name":        name,
+		"email":       fmt.Sprintf("ap%d@%s.example.com", i+1, slug(name)),
+		"phone":       fmt.Sprintf("+1-555-%04d", s.rng.Intn(10000)),
+		"creditLimit": decimal.NewFromInt(int64(5+s.rng.Intn(46)) * 1000).String(),
+		"billingAddress": map[string]interface{}{
+			"street":     address.Street,
+			"city":       address.City,
+			"state":      address.State,
+			"postalCode": address.PostalCode,
+			"country":    address.Country,
+		},
+		"tags": []interface{}{"demo"},
+	})
+	client, err := s.clients.HandleCreateClient(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client %q: %w", name, err)
+	}
+	client.BillingAddress = address
+	return client, nil
+}
+
+// seedOrder creates a confirmed order for client, invoices it and, depending
+// on the configured ratios, pays the invoice in full or in part.
+func (s *Seeder) seedOrder(ctx context.Context, client *domain.Client, products []*domain.Product, seq int, manifest *Manifest) error {
+	order, err := domain.NewOrder(s.tenant, client.ID, s.user, domain.OrderTypeStandard, pick(s.rng, orderSources), "USD")
+	if err != nil {
+		return err
+	}
+	order.OrderNumber = fmt.Sprintf("SO-%d-%06d", order.CreatedAt.Year(), seq)
+	order.SetBillingAddress(&client.BillingAddress)
+	order.SetShippingAddress(&client.BillingAddress)
+
+	lines := 1 + s.rng.Intn(s.volume.MaxLines)
+	for _, idx := range s.rng.Perm(len(products))[:min(lines, len(products))] {
+		product := products[idx]
+		qty := 1 + s.rng.Intn(10)
+		tax := product.Pricing.SalePrice.Mul(decimal.NewFromInt(int64(qty))).Mul(taxRate).Div(decimal.NewFromInt(100))
+		// AddLine recalculates the total, so the line's tax is counted first.
+		order.TaxTotal = order.TaxTotal.Add(tax)
+		order.AddLine(domain.OrderLine{
+			ProductID: product.ID,
+			SKU:       product.SKU,
+			Name:      product.Name,
+			Quantity:  qty,
+			UnitPrice: product.Pricing.SalePrice,
+			UnitCost:  product.Pricing.CostPrice,
+			TaxRate:   taxRate,
+			TaxAmount: tax,
+		})
+	}
+	if err := order.Confirm(); err != nil {
+		return err
+	}
+
+	invoice, err := s.invoiceOrder(ctx, order)
+	if err != nil {
+		return fmt.Errorf("failed to invoice order %s: %w", order.OrderNumber, err)
+	}
+	order.InvoiceID = &invoice.ID
+	manifest.Invoices = append(manifest.Invoices, invoice.ID.String())
+
+	amount := decimal.Zero
+	switch r := s.rng.Float64(); {
+	case r < s.volume.PaidRatio:
+		amount = invoice.AmountDue
+	case r < s.volume.PaidRatio+s.volume.PartialRatio:
+		amount = invoice.AmountDue.Div(decimal.NewFromInt(2)).Round(2)
+	}
+	if amount.IsPositive() {
+		payment, err := s.pay(ctx, invoice, amount)
+		if err != nil {
+			return fmt.Errorf("failed to pay invoice %s: %w", invoice.InvoiceNumber, err)
+		}
+		manifest.Payments = append(manifest.Payments, payment.ID.String())
+		order.AddPayment(domain.OrderPayment{
+			Method:        string(payment.Method),
+			Amount:        payment.Amount,
+			Currency:      payment.Currency,
+			TransactionID: payment.TransactionID,
+			Provider:      payment.Provider,
+			Status:        domain.OrderPaymentStatusPaid,
+			ProcessedAt:   payment.ProcessedAt,
+		})
+	}
+
+	if _, err := s.db.Collection("orders").InsertOne(ctx, order); err != nil {
+		return fmt.Errorf("failed to insert order %s: %w", order.OrderNumber, err)
+	}
+	manifest.Orders = append(manifest.Orders, order.ID.String())
+	return nil
+}
+
+// invoiceOrder creates a finalized invoice with one line per order line.
+func (s *Seeder) invoiceOrder(ctx context.Context, order *domain.Order) (*domain.Invoice, error) {
+	invoice, err := s.invoices.HandleCreateInvoice(ctx, commands.NewCommand("createInvoice", s.tenantID, "", s.userID, map[string]interface{}{
+		"clientId":    order.ClientID.String(),
+		"currency":    order.Currency,
+		"paymentTerm": string(pick(s.rng, paymentTerms)),
+		"notes":       "Order " + order.OrderNumber,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, line := range order.Lines {
+		invoice, err = s.invoices.HandleAddLineItem(ctx, commands.NewCommand("addLineItem", s.tenantID, invoice.ID.String(), s.userID, map[string]interface{}{
+			"description": line.Name,
+			"quantity":    decimal.NewFromInt(int64(line.Quantity)).String(),
+			"unitPrice":   line.UnitPrice.String(),
+			"taxRate":     line.TaxRate.String(),
+			"productId":   line.ProductID.String(),
+			"sortOrder":   float64(i + 1),
+		}))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.invoices.HandleFinalizeInvoice(ctx, commands.NewCommand("finalizeInvoice", s.tenantID, invoice.ID.String(), s.userID, nil))
+}
+
+// pay records an offline payment against invoice and processes it, which
+// applies the amount to the invoice.
+func (s *Seeder) pay(ctx context.Context, invoice *domain.Invoice, amount decimal.Decimal) (*domain.Payment, error) {
+	payment, err := s.payments.HandleCreatePayment(ctx, commands.NewCommand("createPayment", s.tenantID, "", s.userID, map[string]interface{}{
+		"invoiceId":   invoice.ID.String(),
+		"clientId":    invoice.ClientID.String(),
+		"amount":      amount.String(),
+		"currency":    invoice.Currency,
+		"method":      string(pick(s.rng, paymentMethods)),
+		"provider":    offlineProvider,
+		"reference":   invoice.InvoiceNumber,
+		"description": "Payment for " + invoice.InvoiceNumber,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return s.payments.HandleProcessPayment(ctx, commands.NewCommand("processPayment", s.tenantID, payment.ID.String(), s.userID, nil))
+}
+
+func (s *Seeder) count(ctx context.Context, collection string) (int, error) {
+	n, err := s.db.Collection(collection).CountDocuments(ctx, bson.M{"tenantId": s.tenant})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", collection, err)
+	}
+	return int(n), nil
+}
+
+// projector applies events to the read models in-process.
+type projector struct {
+	registry *eventpkg.EventHandlerRegistry
+}
+
+func (p *projector) PublishEvent(ctx context.Context, event *eventpkg.EventEnvelope) error {
+	return stderrors.Join(p.registry.Handle(ctx, event)...)
+}
+
+type offlineProcessor struct{}
+
+func (offlineProcessor) ProcessPayment(ctx interface{}, req *domain.PaymentRequest) (*domain.PaymentResult, error) {
+	now := time.Now().UTC()
+	return &domain.PaymentResult{Success: true, Status: domain.PaymentStatusCompleted, ProcessedAt: &now}, nil
+}
+
+func (offlineProcessor) ProcessRefund(ctx interface{}, req *domain.RefundRequest) (*domain.RefundResult, error) {
+	return nil, fmt.Errorf("offline payments are refunded manually")
+}
+
+func (offlineProcessor) GetPaymentStatus(ctx interface{}, providerID string) (*domain.PaymentResult, error) {
+	return &domain.PaymentResult{Success: true, ProviderID: providerID, Status: domain.PaymentStatusCompleted}, nil
+}
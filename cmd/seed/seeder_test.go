@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVolume_Validate(t *testing.T) {
+	valid := Volume{Warehouses: 1, Products: 1, Clients: 1, OrdersPerClient: 0, MaxLines: 1, PaidRatio: 0.6, PartialRatio: 0.4}
+	assert.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name   string
+		modify func(*Volume)
+	}{
+		{"no warehouses", func(v *Volume) { v.Warehouses = 0 }},
+		{"no products", func(v *Volume) { v.Products = 0 }},
+		{"no clients", func(v *Volume) { v.Clients = 0 }},
+		{"negative orders", func(v *Volume) { v.OrdersPerClient = -1 }},
+		{"no lines", func(v *Volume) { v.MaxLines = 0 }},
+		{"negative ratio", func(v *Volume) { v.PartialRatio = -0.1 }},
+		{"ratios above one", func(v *Volume) { v.PaidRatio = 0.7 }},
+	}
+	for _, tt := range tests {
+		volume := valid
+		tt.modify(&volume)
+		assert.Error(t, volume.Validate(), tt.name)
+	}
+}
+
+func TestRandomPrice(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		price := randomPrice(rng, 5, 400)
+		assert.True(t, price.GreaterThanOrEqual(decimal.NewFromInt(5)), price.String())
+		assert.True(t, price.LessThan(decimal.NewFromInt(400)), price.String())
+		assert.True(t, price.Equal(price.Round(2)), "%s has whole cents", price)
+	}
+}
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "northwind-supply-co", slug("Northwind Supply Co"))
+	assert.Equal(t, "harbor-and-partners", slug("Harbor & Partners"))
+}
+
+func TestWriteManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed-manifest.json")
+	manifest := &Manifest{TenantID: DemoTenantID, UserID: DemoUserID, Seed: 7, Clients: []string{"client-1"}, Invoices: []string{"inv-1", "inv-2"}}
+	require.NoError(t, writeManifest(path, manifest))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var read Manifest
+	require.NoError(t, json.Unmarshal(data, &read))
+	assert.Equal(t, manifest.Invoices, read.Invoices)
+	assert.Equal(t, DemoTenantID, read.TenantID)
+}
+
+func TestSeeder_Run(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "seed-test"})
+	require.NoError(t, err)
+	mongodb, err := repository.NewMongoDB(config.MongoDBConfig{
+		URI:             "mongodb://localhost:27017",
+		Database:        "erp_system",
+		MaxPoolSize:     10,
+		MinPoolSize:     1,
+		ConnectTimeout:  10 * time.Second,
+		ServerSelection: 5 * time.Second,
+	}, log)
+	require.NoError(t, err)
+	defer mongodb.Close(context.Background())
+	redis, err := repository.NewRedis(config.RedisConfig{Mode: "standalone", Addresses: []string{"localhost:6379"}, PoolSize: 10}, log)
+	require.NoError(t, err)
+	defer redis.Close()
+
+	ctx := context.Background()
+	tenantID := uuid.NewString()
+	volume := Volume{Warehouses: 2, Products: 3, Clients: 2, OrdersPerClient: 2, MaxLines: 2, PaidRatio: 0.5, PartialRatio: 0.5, Seed: 7}
+	seeder := NewSeeder(mongodb, repository.NewCache(redis, "t:seed-test", log), log, tenantID, DemoUserID, volume)
+
+	manifest, err := seeder.Run(ctx)
+	require.NoError(t, err)
+	assert.Len(t, manifest.Warehouses, 2)
+	assert.Len(t, manifest.Products, 3)
+	assert.Len(t, manifest.Clients, 2)
+	assert.Len(t, manifest.Orders, 4)
+	assert.Len(t, manifest.Invoices, 4, "every order is invoiced")
+	assert.Len(t, manifest.Payments, 4, "with paid and partial adding up to one, every invoice is paid")
+
+	tenant := uuid.MustParse(tenantID)
+	stock, err := mongodb.Collection("inventory").CountDocuments(ctx, bson.M{"tenantId": tenant})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), stock, "every product is stocked in every warehouse")
+
+	clients := repository.NewReadModelStore(mongodb, "client_read", log)
+	client, err := clients.FindOne(ctx, bson.M{"_id": manifest.Clients[0], "tenantId": tenantID})
+	require.NoError(t, err)
+	assert.NotNil(t, client, "clients are projected into the read model")
+
+	again, err := NewSeeder(mongodb, repository.NewCache(redis, "t:seed-test", log), log, tenantID, DemoUserID, volume).Run(ctx)
+	require.NoError(t, err, "seeding a tenant twice adds a second set of records")
+	assert.NotEqual(t, manifest.Orders[0], again.Orders[0])
+	warehouses, err := mongodb.Collection("warehouses").CountDocuments(ctx, bson.M{"tenantId": tenant})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), warehouses)
+}
@@ -10,8 +10,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/auth"
 	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 )
 
 type WarehouseService struct {
@@ -29,10 +34,13 @@ func NewWarehouseService(cfg *config.Config, log *logger.Logger) *WarehouseServi
 func (s *WarehouseService) setupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/health", s.healthHandler)
-	mux.HandleFunc("/ready", s.readinessHandler)
+	// The service holds no connections yet, so there are no dependencies
+	// to check; stores and transports it opens should be added here.
+	checks := health.NewHealthChecker(s.config, nil, nil, s.logger)
+	mux.Handle("/health", checks.Handler())
+	mux.Handle("/ready", checks.Readiness().Handler())
 	mux.HandleFunc("/live", s.livenessHandler)
-	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.Handle("/metrics", metrics.Handler())
 
 	mux.HandleFunc("/api/v1/warehouses", s.handleWarehouses)
 	mux.HandleFunc("/api/v1/warehouses/", s.handleWarehouseByID)
@@ -54,35 +62,12 @@ func (s *WarehouseService) setupRoutes() http.Handler {
 	return mux
 }
 
-func (s *WarehouseService) healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "healthy", "timestamp": "%s", "service": "warehouse-service"}`, time.Now().UTC())
-}
-
-func (s *WarehouseService) readinessHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "ready", "timestamp": "%s"}`, time.Now().UTC())
-}
-
 func (s *WarehouseService) livenessHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"status": "alive", "timestamp": "%s"}`, time.Now().UTC())
 }
 
-func (s *WarehouseService) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "# Warehouse Service Metrics\n")
-	fmt.Fprintf(w, "warehouse_service_up 1\n")
-	fmt.Fprintf(w, "warehouse_service_requests_total 0\n")
-	fmt.Fprintf(w, "warehouse_service_created_total 0\n")
-	fmt.Fprintf(w, "warehouse_service_locations_total 0\n")
-	fmt.Fprintf(w, "warehouse_service_operations_total 0\n")
-}
-
 func (s *WarehouseService) handleWarehouses(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -90,7 +75,7 @@ func (s *WarehouseService) handleWarehouses(w http.ResponseWriter, r *http.Reque
 	case http.MethodPost:
 		s.createWarehouse(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -103,7 +88,7 @@ func (s *WarehouseService) handleWarehouseByID(w http.ResponseWriter, r *http.Re
 	case http.MethodDelete:
 		s.deleteWarehouse(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -114,7 +99,7 @@ func (s *WarehouseService) handleWarehouseLocations(w http.ResponseWriter, r *ht
 	case http.MethodPost:
 		s.createLocation(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -123,7 +108,7 @@ func (s *WarehouseService) handleWarehouseOperations(w http.ResponseWriter, r *h
 	case http.MethodGet:
 		s.getWarehouseOperations(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -131,7 +116,7 @@ func (s *WarehouseService) handleWarehouseCapacity(w http.ResponseWriter, r *htt
 	if r.Method == http.MethodPut {
 		s.updateCapacity(w, r)
 	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -140,7 +125,7 @@ func (s *WarehouseService) handleLocations(w http.ResponseWriter, r *http.Reques
 	case http.MethodGet:
 		s.listLocations(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -153,7 +138,7 @@ func (s *WarehouseService) handleLocationByID(w http.ResponseWriter, r *http.Req
 	case http.MethodDelete:
 		s.deleteLocation(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -164,7 +149,7 @@ func (s *WarehouseService) handleOperations(w http.ResponseWriter, r *http.Reque
 	case http.MethodPost:
 		s.createOperation(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -175,13 +160,13 @@ func (s *WarehouseService) handleOperationByID(w http.ResponseWriter, r *http.Re
 	case http.MethodPut:
 		s.updateOperation(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
 func (s *WarehouseService) handleInventoryAdjust(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 	s.adjustInventory(w, r)
@@ -189,7 +174,7 @@ func (s *WarehouseService) handleInventoryAdjust(w http.ResponseWriter, r *http.
 
 func (s *WarehouseService) handleInventoryTransfer(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 	s.transferInventory(w, r)
@@ -197,7 +182,7 @@ func (s *WarehouseService) handleInventoryTransfer(w http.ResponseWriter, r *htt
 
 func (s *WarehouseService) handleReserveStock(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 	s.reserveStock(w, r)
@@ -205,7 +190,7 @@ func (s *WarehouseService) handleReserveStock(w http.ResponseWriter, r *http.Req
 
 func (s *WarehouseService) handleReleaseStock(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 	s.releaseStock(w, r)
@@ -213,7 +198,7 @@ func (s *WarehouseService) handleReleaseStock(w http.ResponseWriter, r *http.Req
 
 func (s *WarehouseService) handleCommitStock(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 	s.commitStock(w, r)
@@ -221,7 +206,7 @@ func (s *WarehouseService) handleCommitStock(w http.ResponseWriter, r *http.Requ
 
 func (s *WarehouseService) handleInventoryLevels(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 	s.getInventoryLevels(w, r)
@@ -234,7 +219,7 @@ func (s *WarehouseService) handleInventoryMovements(w http.ResponseWriter, r *ht
 	case http.MethodPost:
 		s.createMovement(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -375,9 +360,16 @@ func (s *WarehouseService) createMovement(w http.ResponseWriter, r *http.Request
 func (s *WarehouseService) runServer() {
 	port := 8087
 
+	tokenValidator, err := auth.NewTokenValidator(&s.config.Auth, s.logger)
+	if err != nil {
+		s.logger.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: s.setupRoutes(),
+		Handler: metrics.HTTPMiddleware(middleware.Instrument(s.logger, tenants.Handler(s.setupRoutes()))),
 	}
 
 	go func() {
@@ -402,7 +394,11 @@ func (s *WarehouseService) runServer() {
 }
 
 func main() {
-	cfg := &config.Config{}
+	cfg, err := config.Load("", "warehouse-service")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
 
 	log, err := logger.New(logger.Config{
 		Level:       "info",
@@ -413,6 +409,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
 		os.Exit(1)
 	}
+	metrics.Initialize("warehouse-service")
 
 	service := NewWarehouseService(cfg, log)
 	service.runServer()
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/internal/webhook"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/ims-erp/system/pkg/tracer"
+)
+
+func main() {
+	cfg, err := config.Load("", "webhook-service")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, err := logger.New(logger.Config{
+		Level:       cfg.Logging.Level,
+		Format:      cfg.Logging.Format,
+		ServiceName: cfg.App.Name,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	group := lifecycle.New(log)
+
+	metrics.Initialize(cfg.App.Name)
+
+	tr, err := tracer.New(tracer.Config{
+		Enabled:      cfg.Tracing.Enabled,
+		ServiceName:  cfg.App.Name,
+		ExporterType: cfg.Tracing.ExporterType,
+		Endpoint:     cfg.Tracing.Endpoint,
+		SamplerType:  cfg.Tracing.SamplerType,
+		SamplerRatio: cfg.Tracing.SamplerRatio,
+	})
+	if err != nil {
+		log.Error("Failed to create tracer", "error", err)
+		os.Exit(1)
+	}
+	defer tr.Shutdown(context.Background())
+
+	messaging.SetupTracePropagation()
+
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		log.Error("Failed to connect to MongoDB", "error", err)
+		os.Exit(1)
+	}
+	defer mongodb.Close(context.Background())
+	log.Info("Connected to MongoDB")
+
+	subscriber, err := messaging.NewEventSubscriber(cfg, log)
+	if err != nil {
+		log.Error("Failed to create event subscriber", "error", err, "transport", cfg.Messaging.Transport)
+		os.Exit(1)
+	}
+	defer subscriber.Close()
+	group.OnShutdown("subscriber", subscriber.Drain)
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
+
+	dispatcher := webhook.NewDispatcher(mongodb, cfg.Webhooks, log)
+	if err := dispatcher.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create webhook indexes", "error", err)
+	}
+
+	// Events of every aggregate are matched, so on NATS this is a queue
+	// subscription on the whole event namespace rather than a JetStream
+	// consumer, which would need a stream overlapping the per-aggregate ones.
+	// Replicas share the work; on NATS, events published while no replica
+	// runs are not delivered.
+	eventSubject := "evt.>"
+	if err := subscriber.SubscribeGroup(group.Context(), eventSubject, "webhook-service", createEventHandler(dispatcher)); err != nil {
+		log.Error("Failed to subscribe", "error", err, "subject", eventSubject)
+		os.Exit(1)
+	}
+
+	group.Go("webhook dispatcher", dispatcher.Run)
+
+	healthChecker := health.NewHealthChecker(cfg, mongodb, nil, log)
+	healthChecker.AddComponent("messaging", health.MessagingCheck(subscriber))
+	readinessChecker := healthChecker.Readiness()
+	livenessChecker := health.NewLivenessChecker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", healthChecker.Handler())
+	mux.Handle("/ready", readinessChecker.Handler())
+	mux.Handle("/live", livenessChecker.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/api/v1/webhooks/", dispatcher.Handler())
+	// Every event is delivered to matching subscriptions, so the catalog is
+	// what integrators can subscribe to.
+	mux.Handle(events.CatalogPath, events.NewCatalog(cfg.App.Name, nil, events.EventTypes(events.AllEvents())).Handler())
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		log.Error("Failed to configure token validation", "error", err)
+		os.Exit(1)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.App.Port),
+		Handler:      metrics.HTTPMiddleware(middleware.Instrument(log, tenants.Handler(mux))),
+		ReadTimeout:  cfg.App.ReadTimeout,
+		WriteTimeout: cfg.App.WriteTimeout,
+	}
+	group.OnShutdown("http server", srv.Shutdown)
+
+	go func() {
+		log.Info("Starting webhook-service", "port", cfg.App.Port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("Server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	sig := group.WaitForSignal()
+	log.Info("Shutting down", "signal", sig)
+	if err := group.Shutdown(cfg.App.ShutdownTimeout); err != nil {
+		log.Error("Shutdown incomplete", "error", err)
+	}
+}
+
+func createEventHandler(dispatcher *webhook.Dispatcher) messaging.DeliveryHandler {
+	return func(ctx context.Context, msg *messaging.Delivery) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		if err := dispatcher.HandleEvent(ctx, &event); err != nil {
+			return fmt.Errorf("failed to queue webhook deliveries for event %s: %w", event.ID, err)
+		}
+		return nil
+	}
+}
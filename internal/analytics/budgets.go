@@ -0,0 +1,297 @@
+package analytics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// Categories actuals are booked under when they have no category of their
+// own.
+const (
+	UncategorizedRevenue = "uncategorized"
+	PaymentFeesCategory  = "payment_fees"
+	RefundsCategory      = "refunds"
+	CashPaidOutCategory  = "cash_paid_out"
+)
+
+// BudgetVariance compares what was budgeted for a category, or for a whole
+// type, with the actuals. Variance is actual minus budget, and
+// VariancePercent its share of the budget, zero when nothing was budgeted.
+// Over is set when an expense exceeds its budget or revenue falls short of
+// it.
+type BudgetVariance struct {
+	Type            domain.BudgetLineType `json:"type,omitempty"`
+	Category        string                `json:"category,omitempty"`
+	Department      string                `json:"department,omitempty"`
+	Budget          decimal.Decimal       `json:"budget"`
+	Actual          decimal.Decimal       `json:"actual"`
+	Variance        decimal.Decimal       `json:"variance"`
+	VariancePercent float64               `json:"variancePercent"`
+	Over            bool                  `json:"over"`
+}
+
+func newBudgetVariance(lineType domain.BudgetLineType, category, department string, budget, actual decimal.Decimal) BudgetVariance {
+	variance := BudgetVariance{
+		Type:       lineType,
+		Category:   category,
+		Department: department,
+		Budget:     budget,
+		Actual:     actual,
+		Variance:   actual.Sub(budget),
+	}
+	if budget.IsPositive() {
+		variance.VariancePercent = round2(variance.Variance.Div(budget).InexactFloat64() * 100)
+	}
+	if lineType == domain.BudgetExpense {
+		variance.Over = actual.GreaterThan(budget)
+	} else {
+		variance.Over = actual.LessThan(budget)
+	}
+	return variance
+}
+
+// BudgetReport compares a month's budget with the revenue and expenses of
+// that month in the budget's currency. Unbudgeted lists the actuals of
+// categories the budget has no line for; OtherCurrencies the currencies of
+// actuals left out for want of an exchange rate.
+type BudgetReport struct {
+	BudgetID        uuid.UUID        `json:"budgetId"`
+	Period          string           `json:"period"`
+	Currency        string           `json:"currency"`
+	From            time.Time        `json:"from"`
+	To              time.Time        `json:"to"`
+	Revenue         BudgetVariance   `json:"revenue"`
+	Expenses        BudgetVariance   `json:"expenses"`
+	Net             BudgetVariance   `json:"net"`
+	Lines           []BudgetVariance `json:"lines"`
+	Unbudgeted      []BudgetVariance `json:"unbudgeted"`
+	OtherCurrencies []string         `json:"otherCurrencies"`
+}
+
+type actualKey struct {
+	lineType   domain.BudgetLineType
+	category   string
+	department string
+}
+
+// RateFunc returns the exchange rate of currency in the budget's currency
+// on the day of at, and whether there is one.
+type RateFunc func(currency string, at time.Time) (decimal.Decimal, bool)
+
+// BudgetTally adds up a month's actual revenue from invoices and expenses
+// from payments and cash drawers, in one currency, per category and
+// department.
+type BudgetTally struct {
+	currency   string
+	from, to   time.Time
+	actuals    map[actualKey]decimal.Decimal
+	categories map[uuid.UUID]string
+	rate       RateFunc
+	other      map[string]bool
+}
+
+// NewBudgetTally counts actuals in currency dated in [from, to).
+// categories names the category of each product invoiced; invoice lines
+// of other products are uncategorized.
+func NewBudgetTally(currency string, from, to time.Time, categories map[uuid.UUID]string) *BudgetTally {
+	return &BudgetTally{
+		currency:   currency,
+		from:       from,
+		to:         to,
+		actuals:    make(map[actualKey]decimal.Decimal),
+		categories: categories,
+		other:      make(map[string]bool),
+	}
+}
+
+// WithRates converts actuals in other currencies at the rate of the day
+// they are dated. Without rates, or without a rate for the day, they are
+// left out.
+func (t *BudgetTally) WithRates(rate RateFunc) *BudgetTally {
+	t.rate = rate
+	return t
+}
+
+func (t *BudgetTally) add(lineType domain.BudgetLineType, currency, category, department string, amount decimal.Decimal, at time.Time) {
+	if currency != t.currency {
+		rate, ok := decimal.Zero, false
+		if t.rate != nil {
+			rate, ok = t.rate(currency, at)
+		}
+		if !ok {
+			t.other[currency] = true
+			return
+		}
+		amount = money.Round(amount.Mul(rate), t.currency)
+	}
+	key := actualKey{lineType, category, department}
+	t.actuals[key] = t.actuals[key].Add(amount)
+}
+
+func (t *BudgetTally) within(at time.Time) bool {
+	return !at.Before(t.from) && at.Before(t.to)
+}
+
+// AddInvoice counts the lines of an issued invoice, net of discounts and
+// excluding tax, as revenue of their product's category in the department
+// in the invoice's department metadata. Credit notes count negatively.
+func (t *BudgetTally) AddInvoice(invoice *domain.Invoice) {
+	switch invoice.Status {
+	case domain.InvoiceStatusDraft, domain.InvoiceStatusCancelled:
+		return
+	}
+	if !t.within(invoice.IssueDate) {
+		return
+	}
+	department := invoice.Metadata["department"]
+	for _, line := range invoice.Lines {
+		category := UncategorizedRevenue
+		if line.ProductID != nil {
+			if name, ok := t.categories[*line.ProductID]; ok && name != "" {
+				category = name
+			}
+		}
+		amount := line.Total
+		if invoice.Type == domain.InvoiceTypeCreditNote {
+			amount = amount.Neg()
+		}
+		t.add(domain.BudgetRevenue, invoice.Currency, category, department, amount, invoice.IssueDate)
+	}
+}
+
+// AddPayment counts the provider fees of a payment settled in the period,
+// in its settlement currency, and the amount of a payment refunded in it.
+func (t *BudgetTally) AddPayment(payment *domain.Payment) {
+	if settlement := payment.Settlement; settlement != nil && payment.ProcessedAt != nil &&
+		t.within(*payment.ProcessedAt) && settlement.Fee.IsPositive() {
+		t.add(domain.BudgetExpense, settlement.Currency, PaymentFeesCategory, "", settlement.Fee, *payment.ProcessedAt)
+	}
+	if payment.Status == domain.PaymentStatusRefunded && t.within(payment.UpdatedAt) {
+		t.add(domain.BudgetExpense, payment.Currency, RefundsCategory, "", payment.Amount, payment.UpdatedAt)
+	}
+}
+
+// AddCashSession counts the cash paid out of a drawer in the period, under
+// the paid-out's reason as category.
+func (t *BudgetTally) AddCashSession(session *domain.CashSession) {
+	for _, entry := range session.Entries {
+		if entry.Type != domain.CashEntryPaidOut || !t.within(entry.RecordedAt) {
+			continue
+		}
+		category := strings.TrimSpace(entry.Reason)
+		if category == "" {
+			category = CashPaidOutCategory
+		}
+		t.add(domain.BudgetExpense, session.Currency, category, "", entry.Amount, entry.RecordedAt)
+	}
+}
+
+// Report compares the actuals with budget. A line without a department
+// takes the actuals of its category in every department the budget has no
+// line of its own for.
+func (t *BudgetTally) Report(budget *domain.Budget) *BudgetReport {
+	report := &BudgetReport{
+		BudgetID:        budget.ID,
+		Period:          budget.Period,
+		Currency:        budget.Currency,
+		From:            t.from,
+		To:              t.to,
+		Lines:           make([]BudgetVariance, 0, len(budget.Lines)),
+		Unbudgeted:      []BudgetVariance{},
+		OtherCurrencies: []string{},
+	}
+
+	budgeted := make(map[actualKey]bool, len(budget.Lines))
+	for _, line := range budget.Lines {
+		budgeted[actualKey{line.Type, line.Category, line.Department}] = true
+	}
+	matched := make(map[actualKey]decimal.Decimal)
+	for key, amount := range t.actuals {
+		line := key
+		if !budgeted[line] {
+			line.department = ""
+		}
+		if !budgeted[line] {
+			report.Unbudgeted = append(report.Unbudgeted, newBudgetVariance(key.lineType, key.category, key.department, decimal.Zero, amount))
+			continue
+		}
+		matched[line] = matched[line].Add(amount)
+	}
+	for _, line := range budget.Lines {
+		actual := matched[actualKey{line.Type, line.Category, line.Department}]
+		report.Lines = append(report.Lines, newBudgetVariance(line.Type, line.Category, line.Department, line.Amount, actual))
+	}
+
+	actualRevenue, actualExpenses := decimal.Zero, decimal.Zero
+	for key, amount := range t.actuals {
+		if key.lineType == domain.BudgetRevenue {
+			actualRevenue = actualRevenue.Add(amount)
+		} else {
+			actualExpenses = actualExpenses.Add(amount)
+		}
+	}
+	budgetRevenue, budgetExpenses := budget.Total(domain.BudgetRevenue), budget.Total(domain.BudgetExpense)
+	report.Revenue = newBudgetVariance(domain.BudgetRevenue, "", "", budgetRevenue, actualRevenue)
+	report.Expenses = newBudgetVariance(domain.BudgetExpense, "", "", budgetExpenses, actualExpenses)
+	report.Net = newBudgetVariance(domain.BudgetRevenue, "", "", budgetRevenue.Sub(budgetExpenses), actualRevenue.Sub(actualExpenses))
+	report.Net.Type = ""
+
+	sortVariances(report.Lines)
+	sortVariances(report.Unbudgeted)
+	for currency := range t.other {
+		report.OtherCurrencies = append(report.OtherCurrencies, currency)
+	}
+	sort.Strings(report.OtherCurrencies)
+	return report
+}
+
+func sortVariances(variances []BudgetVariance) {
+	sort.Slice(variances, func(i, j int) bool {
+		a, b := variances[i], variances[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Department < b.Department
+	})
+}
+
+// BudgetAlerts returns an alert for each expense line of report whose
+// actuals exceed its budget by more than threshold percent. A line budgeted
+// at zero is alerted on as soon as anything is spent.
+func BudgetAlerts(budget *domain.Budget, report *BudgetReport, threshold float64, at time.Time) []domain.BudgetAlert {
+	var alerts []domain.BudgetAlert
+	for _, line := range report.Lines {
+		if line.Type != domain.BudgetExpense || !line.Over {
+			continue
+		}
+		if line.Budget.IsPositive() && line.VariancePercent <= threshold {
+			continue
+		}
+		alerts = append(alerts, domain.BudgetAlert{
+			ID:         strings.Join([]string{budget.ID.String(), string(line.Type), line.Category, line.Department}, ":"),
+			TenantID:   budget.TenantID,
+			BudgetID:   budget.ID,
+			Period:     budget.Period,
+			Currency:   budget.Currency,
+			Type:       line.Type,
+			Category:   line.Category,
+			Department: line.Department,
+			Budget:     line.Budget,
+			Actual:     line.Actual,
+			Variance:   line.Variance,
+			Threshold:  threshold,
+			CheckedAt:  at,
+			RaisedAt:   at,
+		})
+	}
+	return alerts
+}
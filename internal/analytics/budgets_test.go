@@ -0,0 +1,146 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var budgetMonth = time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+
+func dec(value string) decimal.Decimal {
+	return decimal.RequireFromString(value)
+}
+
+func budgetInvoice(invoiceType domain.InvoiceType, status domain.InvoiceStatus, department string, lines ...domain.InvoiceLine) *domain.Invoice {
+	return &domain.Invoice{
+		ID:        uuid.New(),
+		Type:      invoiceType,
+		Status:    status,
+		Currency:  "EUR",
+		IssueDate: budgetMonth.AddDate(0, 0, 10),
+		Lines:     lines,
+		Metadata:  map[string]string{"department": department},
+	}
+}
+
+func TestBudgetTally_Report(t *testing.T) {
+	kettle, toaster := uuid.New(), uuid.New()
+	budget, err := domain.NewBudget(uuid.New(), "2026-09", "EUR", []domain.BudgetLine{
+		{Type: domain.BudgetRevenue, Category: "kitchen", Amount: dec("1000")},
+		{Type: domain.BudgetRevenue, Category: "kitchen", Department: "online", Amount: dec("500")},
+		{Type: domain.BudgetExpense, Category: PaymentFeesCategory, Amount: dec("20")},
+		{Type: domain.BudgetExpense, Category: RefundsCategory, Amount: dec("100")},
+	}, uuid.New())
+	require.NoError(t, err)
+
+	tally := NewBudgetTally("EUR", budgetMonth, budgetMonth.AddDate(0, 1, 0), map[uuid.UUID]string{kettle: "kitchen"})
+	tally.AddInvoice(budgetInvoice(domain.InvoiceTypeStandard, domain.InvoiceStatusPaid, "online",
+		domain.InvoiceLine{ProductID: &kettle, Total: dec("600")}))
+	tally.AddInvoice(budgetInvoice(domain.InvoiceTypeStandard, domain.InvoiceStatusSent, "store",
+		domain.InvoiceLine{ProductID: &kettle, Total: dec("700")},
+		domain.InvoiceLine{ProductID: &toaster, Total: dec("50")}))
+	tally.AddInvoice(budgetInvoice(domain.InvoiceTypeCreditNote, domain.InvoiceStatusSent, "store",
+		domain.InvoiceLine{ProductID: &kettle, Total: dec("100")}))
+	tally.AddInvoice(budgetInvoice(domain.InvoiceTypeStandard, domain.InvoiceStatusDraft, "store",
+		domain.InvoiceLine{ProductID: &kettle, Total: dec("9999")}))
+
+	processed := budgetMonth.AddDate(0, 0, 3)
+	tally.AddPayment(&domain.Payment{
+		Currency: "EUR", Amount: dec("600"), Status: domain.PaymentStatusCompleted, ProcessedAt: &processed, UpdatedAt: processed,
+		Settlement: &domain.PaymentSettlement{Currency: "EUR", Fee: dec("25")},
+	})
+	tally.AddPayment(&domain.Payment{
+		Currency: "EUR", Amount: dec("80"), Status: domain.PaymentStatusRefunded, UpdatedAt: processed,
+	})
+	tally.AddPayment(&domain.Payment{
+		Currency: "USD", Amount: dec("10"), Status: domain.PaymentStatusRefunded, UpdatedAt: processed,
+	})
+	tally.AddCashSession(&domain.CashSession{Currency: "EUR", Entries: []domain.CashEntry{
+		{Type: domain.CashEntryPaidOut, Amount: dec("15"), Reason: "cleaning", RecordedAt: processed},
+		{Type: domain.CashEntryPaidOut, Amount: dec("5"), RecordedAt: budgetMonth.AddDate(0, 1, 0)},
+		{Type: domain.CashEntryPaidIn, Amount: dec("50"), RecordedAt: processed},
+	}})
+
+	report := tally.Report(budget)
+	assert.Equal(t, []string{"USD"}, report.OtherCurrencies)
+	assert.Equal(t, "1250", report.Revenue.Actual.String())
+	assert.Equal(t, "1500", report.Revenue.Budget.String())
+	assert.True(t, report.Revenue.Over, "revenue below budget")
+	assert.Equal(t, "120", report.Expenses.Actual.String())
+	assert.Equal(t, "1130", report.Net.Actual.String())
+
+	require.Len(t, report.Lines, 4)
+	assert.Equal(t, "25", report.Lines[0].Actual.String(), "payment fees")
+	assert.Equal(t, 25.0, report.Lines[0].VariancePercent)
+	assert.True(t, report.Lines[0].Over)
+	assert.Equal(t, "80", report.Lines[1].Actual.String(), "refunds")
+	assert.False(t, report.Lines[1].Over)
+	assert.Equal(t, "", report.Lines[2].Department)
+	assert.Equal(t, "600", report.Lines[2].Actual.String(), "store kitchen sales net of the credit note")
+	assert.Equal(t, "online", report.Lines[3].Department)
+	assert.Equal(t, "600", report.Lines[3].Actual.String())
+
+	require.Len(t, report.Unbudgeted, 2)
+	assert.Equal(t, "cleaning", report.Unbudgeted[0].Category)
+	assert.Equal(t, UncategorizedRevenue, report.Unbudgeted[1].Category)
+	assert.Equal(t, "50", report.Unbudgeted[1].Actual.String())
+}
+
+func TestBudgetTally_Rates(t *testing.T) {
+	budget, err := domain.NewBudget(uuid.New(), "2026-09", "EUR", []domain.BudgetLine{
+		{Type: domain.BudgetExpense, Category: RefundsCategory, Amount: dec("100")},
+	}, uuid.New())
+	require.NoError(t, err)
+	processed := budgetMonth.AddDate(0, 0, 3)
+
+	var asked time.Time
+	tally := NewBudgetTally("EUR", budgetMonth, budgetMonth.AddDate(0, 1, 0), nil).
+		WithRates(func(currency string, at time.Time) (decimal.Decimal, bool) {
+			asked = at
+			return dec("0.8583690987"), currency == "USD"
+		})
+	tally.AddPayment(&domain.Payment{Currency: "USD", Amount: dec("116.50"), Status: domain.PaymentStatusRefunded, UpdatedAt: processed})
+	tally.AddPayment(&domain.Payment{Currency: "CHF", Amount: dec("10"), Status: domain.PaymentStatusRefunded, UpdatedAt: processed})
+	report := tally.Report(budget)
+
+	assert.Equal(t, processed, asked, "converted at the rate of the day refunded")
+	assert.Equal(t, "100", report.Lines[0].Actual.String())
+	assert.Equal(t, []string{"CHF"}, report.OtherCurrencies, "currencies without a rate are left out")
+}
+
+func TestBudgetAlerts(t *testing.T) {
+	budget, err := domain.NewBudget(uuid.New(), "2026-09", "EUR", []domain.BudgetLine{
+		{Type: domain.BudgetRevenue, Category: "kitchen", Amount: dec("1000")},
+		{Type: domain.BudgetExpense, Category: PaymentFeesCategory, Amount: dec("100")},
+		{Type: domain.BudgetExpense, Category: RefundsCategory, Amount: dec("100")},
+		{Type: domain.BudgetExpense, Category: "cleaning", Amount: decimal.Zero},
+	}, uuid.New())
+	require.NoError(t, err)
+	processed := budgetMonth.AddDate(0, 0, 1)
+
+	tally := NewBudgetTally("EUR", budgetMonth, budgetMonth.AddDate(0, 1, 0), nil)
+	tally.AddPayment(&domain.Payment{
+		Currency: "EUR", Status: domain.PaymentStatusCompleted, ProcessedAt: &processed,
+		Settlement: &domain.PaymentSettlement{Currency: "EUR", Fee: dec("105")},
+	})
+	tally.AddPayment(&domain.Payment{Currency: "EUR", Amount: dec("130"), Status: domain.PaymentStatusRefunded, UpdatedAt: processed})
+	tally.AddCashSession(&domain.CashSession{Currency: "EUR", Entries: []domain.CashEntry{
+		{Type: domain.CashEntryPaidOut, Amount: dec("1"), Reason: "cleaning", RecordedAt: processed},
+	}})
+	report := tally.Report(budget)
+
+	alerts := BudgetAlerts(budget, report, 10, processed)
+	require.Len(t, alerts, 2, "revenue shortfalls and expenses within the threshold are not alerted on")
+	assert.Equal(t, "cleaning", alerts[0].Category)
+	assert.Equal(t, RefundsCategory, alerts[1].Category)
+	assert.Equal(t, "30", alerts[1].Variance.String())
+	assert.Equal(t, budget.ID.String()+":expense:refunds:", alerts[1].ID)
+
+	assert.Len(t, BudgetAlerts(budget, report, 0, processed), 3)
+}
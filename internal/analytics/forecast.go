@@ -0,0 +1,223 @@
+package analytics
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+)
+
+// seasonalMonths is how many months of demand a product needs before its
+// demand is treated as seasonal: two full years, so that every calendar
+// month is seen twice.
+const seasonalMonths = 24
+
+// DemandHistory tallies the units ordered of each product per calendar
+// month, in UTC, from the month of From up to, not including, the month of
+// To.
+type DemandHistory struct {
+	From     time.Time
+	To       time.Time
+	products map[uuid.UUID][]float64
+}
+
+func NewDemandHistory(from, to time.Time) *DemandHistory {
+	return &DemandHistory{
+		From:     monthStart(from),
+		To:       monthStart(to),
+		products: make(map[uuid.UUID][]float64),
+	}
+}
+
+// Months is how many months the history spans.
+func (h *DemandHistory) Months() int {
+	return monthsBetween(h.From, h.To)
+}
+
+// AddOrder adds the lines of order to the month it was placed in. Drafts,
+// quotes and cancelled orders are not demand.
+func (h *DemandHistory) AddOrder(order *domain.Order) {
+	switch order.Status {
+	case domain.OrderStatusDraft, domain.OrderStatusCancelled:
+		return
+	}
+	if order.Type == domain.OrderTypeQuote {
+		return
+	}
+	month := monthsBetween(h.From, monthStart(order.CreatedAt))
+	if month < 0 || month >= h.Months() {
+		return
+	}
+	for _, line := range order.Lines {
+		if line.Quantity <= 0 {
+			continue
+		}
+		series := h.products[line.ProductID]
+		if series == nil {
+			series = make([]float64, h.Months())
+			h.products[line.ProductID] = series
+		}
+		series[month] += float64(line.Quantity)
+	}
+}
+
+// Forecast forecasts the demand of productID from its history, starting at
+// the month it was first ordered in. Window is how many of the last months
+// the moving average takes.
+func (h *DemandHistory) Forecast(productID uuid.UUID, window int) DemandForecast {
+	series := h.products[productID]
+	first := 0
+	for first < len(series) && series[first] == 0 {
+		first++
+	}
+	return ForecastDemand(series[first:], h.From.AddDate(0, first, 0).Month(), window)
+}
+
+// DemandForecast is a product's forecast demand: Level units a month,
+// scaled for each calendar month by its Seasonal index. An index of 1 is an
+// average month.
+type DemandForecast struct {
+	Level    float64     `json:"level"`
+	Seasonal [12]float64 `json:"seasonal"`
+}
+
+// ForecastDemand forecasts demand from monthly units ordered, the first of
+// which were in the calendar month first, with a seasonal moving average.
+// Once there are two years of demand, each calendar month's index is its
+// average demand over the average of all months; until then every index is
+// 1. Level is the average of the last window months with their season
+// taken out.
+func ForecastDemand(monthly []float64, first time.Month, window int) DemandForecast {
+	forecast := DemandForecast{}
+	for i := range forecast.Seasonal {
+		forecast.Seasonal[i] = 1
+	}
+	if len(monthly) == 0 {
+		return forecast
+	}
+
+	if len(monthly) >= seasonalMonths {
+		var total float64
+		var sums, counts [12]float64
+		for i, units := range monthly {
+			m := (int(first) - 1 + i) % 12
+			sums[m] += units
+			counts[m]++
+			total += units
+		}
+		if average := total / float64(len(monthly)); average > 0 {
+			for m := range forecast.Seasonal {
+				forecast.Seasonal[m] = sums[m] / counts[m] / average
+			}
+		}
+	}
+
+	window = max(min(window, len(monthly)), 1)
+	var level float64
+	var months int
+	for i := len(monthly) - window; i < len(monthly); i++ {
+		index := forecast.Seasonal[(int(first)-1+i)%12]
+		if index == 0 {
+			// Nothing is ever ordered in this month; it says nothing of
+			// the level.
+			continue
+		}
+		level += monthly[i] / index
+		months++
+	}
+	if months > 0 {
+		forecast.Level = level / float64(months)
+	}
+	return forecast
+}
+
+// Daily is the demand forecast for the day of at.
+func (f DemandForecast) Daily(at time.Time) float64 {
+	month := monthStart(at)
+	days := month.AddDate(0, 1, 0).Sub(month).Hours() / 24
+	return f.Level * f.Seasonal[at.Month()-1] / days
+}
+
+// Between is the demand forecast for the whole days from from up to, not
+// including, to.
+func (f DemandForecast) Between(from, to time.Time) float64 {
+	var demand float64
+	for day := dayStart(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		demand += f.Daily(day)
+	}
+	return demand
+}
+
+// ReorderPolicy is how a product is replenished. A purchase takes
+// LeadTimeDays to arrive and should cover CoverDays of demand after it
+// does, on top of SafetyStock. Quantities are rounded up to a multiple of
+// OrderMultiple when it is set. Purchases are only planned when they must
+// be ordered within HorizonDays.
+type ReorderPolicy struct {
+	LeadTimeDays  int
+	SafetyStock   int
+	CoverDays     int
+	OrderMultiple int
+	HorizonDays   int
+}
+
+// PurchasePlan is when and how much of a product to order.
+type PurchasePlan struct {
+	DailyDemand     float64
+	ReorderPoint    int
+	Quantity        int
+	OrderBy         time.Time
+	ExpectedArrival time.Time
+}
+
+// PlanPurchase plans the next purchase of a product with stock position,
+// as of today, under policy. The product must be ordered on the first day
+// its projected position is down to the reorder point, the demand over the
+// lead time plus the safety stock; it reports false when that day is past
+// the horizon.
+func PlanPurchase(forecast DemandForecast, position int, policy ReorderPolicy, today time.Time) (PurchasePlan, bool) {
+	today = dayStart(today)
+	lead := max(policy.LeadTimeDays, 0)
+	safety := float64(policy.SafetyStock)
+
+	projected := float64(position)
+	for day := 0; day <= policy.HorizonDays; day++ {
+		orderBy := today.AddDate(0, 0, day)
+		arrival := orderBy.AddDate(0, 0, lead)
+		leadDemand := forecast.Between(orderBy, arrival)
+		if projected > leadDemand+safety {
+			projected -= forecast.Daily(orderBy)
+			continue
+		}
+
+		atArrival := projected - leadDemand
+		needed := forecast.Between(arrival, arrival.AddDate(0, 0, policy.CoverDays)) + safety - atArrival
+		quantity := max(int(math.Ceil(needed-1e-9)), 1)
+		if multiple := policy.OrderMultiple; multiple > 0 {
+			quantity = (quantity + multiple - 1) / multiple * multiple
+		}
+		return PurchasePlan{
+			DailyDemand:     math.Round(forecast.Daily(today)*100) / 100,
+			ReorderPoint:    int(math.Ceil(forecast.Between(today, today.AddDate(0, 0, lead)) + safety - 1e-9)),
+			Quantity:        quantity,
+			OrderBy:         orderBy,
+			ExpectedArrival: arrival,
+		}, true
+	}
+	return PurchasePlan{}, false
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func dayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
@@ -0,0 +1,93 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForecastDemand_MovingAverage(t *testing.T) {
+	forecast := ForecastDemand([]float64{10, 20, 30, 40}, time.March, 3)
+	assert.Equal(t, 30.0, forecast.Level)
+	assert.Equal(t, 1.0, forecast.Seasonal[time.June-1], "too little history to be seasonal")
+
+	assert.Equal(t, 40.0, ForecastDemand([]float64{10, 20, 30, 40}, time.March, 1).Level)
+	assert.Equal(t, 25.0, ForecastDemand([]float64{10, 20, 30, 40}, time.March, 12).Level)
+	assert.Equal(t, 0.0, ForecastDemand(nil, time.March, 3).Level)
+}
+
+func TestForecastDemand_Seasonal(t *testing.T) {
+	monthly := make([]float64, 24)
+	for i := range monthly {
+		monthly[i] = 10
+	}
+	monthly[11], monthly[23] = 40, 40
+
+	forecast := ForecastDemand(monthly, time.January, 3)
+	assert.InDelta(t, 3.2, forecast.Seasonal[time.December-1], 1e-9)
+	assert.InDelta(t, 0.8, forecast.Seasonal[time.October-1], 1e-9)
+	assert.InDelta(t, 12.5, forecast.Level, 1e-9, "the December peak is taken out of the average")
+
+	december := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	assert.InDelta(t, 40.0, forecast.Between(december, december.AddDate(0, 1, 0)), 1e-9)
+	assert.InDelta(t, 10.0, forecast.Between(december.AddDate(0, -2, 0), december.AddDate(0, -1, 0)), 1e-9)
+}
+
+func TestDemandHistory(t *testing.T) {
+	kettle, toaster := uuid.New(), uuid.New()
+	history := NewDemandHistory(time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2026, 5, 15, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, 4, history.Months())
+
+	order := func(status domain.OrderStatus, at time.Time, lines ...domain.OrderLine) *domain.Order {
+		return &domain.Order{Type: domain.OrderTypeStandard, Status: status, CreatedAt: at, Lines: lines}
+	}
+	month := func(m time.Month) time.Time { return time.Date(2026, m, 3, 0, 0, 0, 0, time.UTC) }
+	history.AddOrder(order(domain.OrderStatusConfirmed, month(time.February), domain.OrderLine{ProductID: kettle, Quantity: 6}))
+	history.AddOrder(order(domain.OrderStatusShipped, month(time.March), domain.OrderLine{ProductID: kettle, Quantity: 9}, domain.OrderLine{ProductID: toaster, Quantity: 1}))
+	history.AddOrder(order(domain.OrderStatusCompleted, month(time.April), domain.OrderLine{ProductID: kettle, Quantity: 12}))
+	history.AddOrder(order(domain.OrderStatusCancelled, month(time.March), domain.OrderLine{ProductID: kettle, Quantity: 100}))
+	history.AddOrder(order(domain.OrderStatusPending, month(time.May), domain.OrderLine{ProductID: kettle, Quantity: 100}))
+	quote := order(domain.OrderStatusPending, month(time.April), domain.OrderLine{ProductID: kettle, Quantity: 100})
+	quote.Type = domain.OrderTypeQuote
+	history.AddOrder(quote)
+
+	assert.Equal(t, 9.0, history.Forecast(kettle, 3).Level, "averaged from its first order, not over January")
+	assert.Equal(t, 0.5, history.Forecast(toaster, 3).Level)
+	assert.Equal(t, 0.0, history.Forecast(uuid.New(), 3).Level)
+}
+
+func TestPlanPurchase(t *testing.T) {
+	// 30 a month in September is one a day.
+	forecast := ForecastDemand([]float64{30}, time.August, 3)
+	today := time.Date(2026, 9, 1, 9, 30, 0, 0, time.UTC)
+	policy := ReorderPolicy{LeadTimeDays: 10, SafetyStock: 5, CoverDays: 10, HorizonDays: 14}
+
+	plan, ok := PlanPurchase(forecast, 20, policy, today)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, plan.DailyDemand)
+	assert.Equal(t, 15, plan.ReorderPoint)
+	assert.Equal(t, time.Date(2026, 9, 6, 0, 0, 0, 0, time.UTC), plan.OrderBy, "once 5 days sold it down to 15")
+	assert.Equal(t, time.Date(2026, 9, 16, 0, 0, 0, 0, time.UTC), plan.ExpectedArrival)
+	assert.Equal(t, 10, plan.Quantity, "10 days of cover over the 5 safety stock left on arrival")
+
+	policy.OrderMultiple = 4
+	plan, _ = PlanPurchase(forecast, 20, policy, today)
+	assert.Equal(t, 12, plan.Quantity)
+
+	policy.OrderMultiple = 0
+	plan, ok = PlanPurchase(forecast, -3, policy, today)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), plan.OrderBy)
+	assert.Equal(t, 28, plan.Quantity, "oversold stock is made up too")
+
+	_, ok = PlanPurchase(forecast, 100, policy, today)
+	assert.False(t, ok, "lasts past the horizon")
+
+	plan, ok = PlanPurchase(DemandForecast{}, 2, policy, today)
+	require.True(t, ok, "below its safety stock without demand")
+	assert.Equal(t, 3, plan.Quantity)
+}
@@ -0,0 +1,218 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+)
+
+// Leaderboard orders accepted by LaborTally.Report.
+const (
+	SortByPicksPerHour = "picksPerHour"
+	SortByPicks        = "picks"
+	SortByUnits        = "units"
+	SortByHours        = "hours"
+)
+
+// OperatorProductivity is what one operator scanned over a period. Active
+// hours are the time between each of their scans and the scan or start of
+// work before it in the same operation.
+type OperatorProductivity struct {
+	OperatorID    string  `json:"operatorId"`
+	Operations    int     `json:"operations"`
+	Scans         int     `json:"scans"`
+	Picks         int     `json:"picks"`
+	UnitsPicked   int     `json:"unitsPicked"`
+	UnitsReceived int     `json:"unitsReceived"`
+	ActiveHours   float64 `json:"activeHours"`
+	PicksPerHour  float64 `json:"picksPerHour"`
+
+	active     time.Duration
+	pickTime   time.Duration
+	operations map[uuid.UUID]bool
+}
+
+// LaborReport sums up warehouse labor over the operations completed in a
+// period. A pick is one scan on a pick operation, however many units it
+// covers. Receipt time runs from the start of a receipt, or its assignment
+// or creation when it was never started, to its completion.
+type LaborReport struct {
+	From                  time.Time              `json:"from"`
+	To                    time.Time              `json:"to"`
+	WarehouseID           string                 `json:"warehouseId,omitempty"`
+	Operations            int                    `json:"operations"`
+	Picks                 int                    `json:"picks"`
+	UnitsPicked           int                    `json:"unitsPicked"`
+	PickHours             float64                `json:"pickHours"`
+	PicksPerHour          float64                `json:"picksPerHour"`
+	Receipts              int                    `json:"receipts"`
+	UnitsReceived         int                    `json:"unitsReceived"`
+	AverageReceiptMinutes float64                `json:"averageReceiptMinutes"`
+	Operators             []OperatorProductivity `json:"operators"`
+}
+
+// LaborTally adds up completed operations one at a time.
+type LaborTally struct {
+	operations  int
+	picks       int
+	unitsPicked int
+	pickTime    time.Duration
+	receipts    int
+	unitsIn     int
+	receiptTime time.Duration
+	operators   map[uuid.UUID]*OperatorProductivity
+}
+
+func NewLaborTally() *LaborTally {
+	return &LaborTally{operators: make(map[uuid.UUID]*OperatorProductivity)}
+}
+
+// workStart is when work on operation began as far as it was recorded.
+func workStart(operation *domain.WarehouseOperation) time.Time {
+	switch {
+	case operation.StartedAt != nil:
+		return *operation.StartedAt
+	case operation.AssignedAt != nil:
+		return *operation.AssignedAt
+	default:
+		return operation.CreatedAt
+	}
+}
+
+// scans returns the scans of operation in time order. Operations completed
+// before scans were recorded count each done item as one scan by the
+// assignee at completion; without an assignee they have none.
+func scans(operation *domain.WarehouseOperation) []domain.ItemScan {
+	var all []domain.ItemScan
+	for _, item := range operation.Items {
+		all = append(all, item.Scans...)
+	}
+	if len(all) == 0 && operation.AssignedTo != nil && operation.CompletedAt != nil {
+		for _, item := range operation.Items {
+			if item.QuantityDone > 0 {
+				all = append(all, domain.ItemScan{
+					OperatorID: *operation.AssignedTo,
+					Quantity:   item.QuantityDone,
+					ScannedAt:  *operation.CompletedAt,
+				})
+			}
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].ScannedAt.Before(all[j].ScannedAt) })
+	return all
+}
+
+// Add counts operation if it is completed.
+func (t *LaborTally) Add(operation *domain.WarehouseOperation) {
+	if operation.Status != "completed" || operation.CompletedAt == nil {
+		return
+	}
+	t.operations++
+	start := workStart(operation)
+	if operation.Type == domain.OperationTypeReceipt {
+		t.receipts++
+		if elapsed := operation.CompletedAt.Sub(start); elapsed > 0 {
+			t.receiptTime += elapsed
+		}
+	}
+
+	previous := start
+	for _, scan := range scans(operation) {
+		elapsed := scan.ScannedAt.Sub(previous)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		if scan.ScannedAt.After(previous) {
+			previous = scan.ScannedAt
+		}
+
+		operator, ok := t.operators[scan.OperatorID]
+		if !ok {
+			operator = &OperatorProductivity{OperatorID: scan.OperatorID.String(), operations: make(map[uuid.UUID]bool)}
+			t.operators[scan.OperatorID] = operator
+		}
+		operator.operations[operation.ID] = true
+		operator.Scans++
+		operator.active += elapsed
+
+		switch operation.Type {
+		case domain.OperationTypePick:
+			operator.Picks++
+			operator.UnitsPicked += scan.Quantity
+			operator.pickTime += elapsed
+			t.picks++
+			t.unitsPicked += scan.Quantity
+			t.pickTime += elapsed
+		case domain.OperationTypeReceipt:
+			operator.UnitsReceived += scan.Quantity
+			t.unitsIn += scan.Quantity
+		}
+	}
+}
+
+// perHour returns count per hour of d, or 0 without any time.
+func perHour(count int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return round2(float64(count) / d.Hours())
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Report returns the totals and the limit best operators by sortBy, one of
+// the SortBy constants; other values sort by picks per hour.
+func (t *LaborTally) Report(from, to time.Time, sortBy string, limit int) *LaborReport {
+	report := &LaborReport{
+		From:          from,
+		To:            to,
+		Operations:    t.operations,
+		Picks:         t.picks,
+		UnitsPicked:   t.unitsPicked,
+		PickHours:     round2(t.pickTime.Hours()),
+		PicksPerHour:  perHour(t.picks, t.pickTime),
+		Receipts:      t.receipts,
+		UnitsReceived: t.unitsIn,
+		Operators:     make([]OperatorProductivity, 0, len(t.operators)),
+	}
+	if t.receipts > 0 {
+		report.AverageReceiptMinutes = round2(t.receiptTime.Minutes() / float64(t.receipts))
+	}
+
+	for _, operator := range t.operators {
+		entry := *operator
+		entry.Operations = len(operator.operations)
+		entry.ActiveHours = round2(operator.active.Hours())
+		entry.PicksPerHour = perHour(operator.Picks, operator.pickTime)
+		report.Operators = append(report.Operators, entry)
+	}
+
+	key := func(o OperatorProductivity) float64 {
+		switch sortBy {
+		case SortByPicks:
+			return float64(o.Picks)
+		case SortByUnits:
+			return float64(o.UnitsPicked + o.UnitsReceived)
+		case SortByHours:
+			return o.ActiveHours
+		default:
+			return o.PicksPerHour
+		}
+	}
+	sort.Slice(report.Operators, func(i, j int) bool {
+		a, b := key(report.Operators[i]), key(report.Operators[j])
+		if a != b {
+			return a > b
+		}
+		return report.Operators[i].OperatorID < report.Operators[j].OperatorID
+	})
+	if limit > 0 && len(report.Operators) > limit {
+		report.Operators = report.Operators[:limit]
+	}
+	return report
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var laborDay = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return laborDay.Add(time.Duration(minutes) * time.Minute)
+}
+
+func completedOperation(opType domain.OperationType, start, end int, items ...domain.OperationItem) *domain.WarehouseOperation {
+	startedAt, completedAt := at(start), at(end)
+	return &domain.WarehouseOperation{
+		ID:          uuid.New(),
+		Type:        opType,
+		Status:      "completed",
+		Items:       items,
+		CreatedAt:   at(start - 60),
+		StartedAt:   &startedAt,
+		CompletedAt: &completedAt,
+	}
+}
+
+func scanned(quantity int, scans ...domain.ItemScan) domain.OperationItem {
+	return domain.OperationItem{ID: uuid.New(), Quantity: quantity, QuantityDone: quantity, Status: "completed", Scans: scans}
+}
+
+func TestLaborTally_Picks(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+
+	tally := NewLaborTally()
+	// Alice picks twice in her first 30 minutes, Bob takes the last item
+	// 30 minutes later.
+	tally.Add(completedOperation(domain.OperationTypePick, 0, 60,
+		scanned(2, domain.ItemScan{OperatorID: alice, Quantity: 2, ScannedAt: at(10)}),
+		scanned(5, domain.ItemScan{OperatorID: alice, Quantity: 5, ScannedAt: at(30)}),
+		scanned(1, domain.ItemScan{OperatorID: bob, Quantity: 1, ScannedAt: at(60)}),
+	))
+	tally.Add(&domain.WarehouseOperation{ID: uuid.New(), Type: domain.OperationTypePick, Status: "in_progress"})
+
+	report := tally.Report(laborDay, laborDay.AddDate(0, 0, 1), "", 10)
+
+	assert.Equal(t, 1, report.Operations, "only completed operations count")
+	assert.Equal(t, 3, report.Picks)
+	assert.Equal(t, 8, report.UnitsPicked)
+	assert.Equal(t, 1.0, report.PickHours)
+	assert.Equal(t, 3.0, report.PicksPerHour)
+
+	require.Len(t, report.Operators, 2)
+	assert.Equal(t, alice.String(), report.Operators[0].OperatorID)
+	assert.Equal(t, 4.0, report.Operators[0].PicksPerHour)
+	assert.Equal(t, 0.5, report.Operators[0].ActiveHours)
+	assert.Equal(t, 2.0, report.Operators[1].PicksPerHour)
+
+	byPicks := tally.Report(laborDay, laborDay, SortByPicks, 1)
+	require.Len(t, byPicks.Operators, 1)
+	assert.Equal(t, alice.String(), byPicks.Operators[0].OperatorID)
+}
+
+func TestLaborTally_Receipts(t *testing.T) {
+	operator := uuid.New()
+
+	tally := NewLaborTally()
+	tally.Add(completedOperation(domain.OperationTypeReceipt, 0, 20,
+		scanned(10, domain.ItemScan{OperatorID: operator, Quantity: 10, ScannedAt: at(20)}),
+	))
+
+	// Receipts completed before scans were recorded fall back to their
+	// assignee, and to assignment when they were never started.
+	assignedAt := at(100)
+	legacy := completedOperation(domain.OperationTypeReceipt, 0, 140, scanned(4))
+	legacy.StartedAt = nil
+	legacy.AssignedTo = &operator
+	legacy.AssignedAt = &assignedAt
+	tally.Add(legacy)
+
+	report := tally.Report(laborDay, laborDay, "", 10)
+
+	assert.Equal(t, 2, report.Receipts)
+	assert.Equal(t, 14, report.UnitsReceived)
+	assert.Equal(t, 30.0, report.AverageReceiptMinutes)
+	assert.Zero(t, report.Picks)
+	require.Len(t, report.Operators, 1)
+	assert.Equal(t, 2, report.Operators[0].Operations)
+	assert.Equal(t, 14, report.Operators[0].UnitsReceived)
+	assert.Equal(t, 1.0, report.Operators[0].ActiveHours)
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/ims-erp/system/internal/events"
 	"github.com/ims-erp/system/internal/repository"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/ims-erp/system/pkg/timezone"
+	"github.com/shopspring/decimal"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/otel"
@@ -17,22 +20,32 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-// ReportingService provides BI analytics and reporting
+// ReportingService provides BI analytics and reporting. Revenue and aging
+// are read from the invoice summaries the invoice projection maintains,
+// when given, and recomputed from the invoices when they fail or have
+// nothing for the tenant.
 type ReportingService struct {
 	readModelStore *repository.ReadModelStore
+	days           *repository.ReadModelStore
+	clients        *repository.ReadModelStore
 	cache          *repository.Cache
 	logger         *logger.Logger
 	tracer         trace.Tracer
 }
 
-// NewReportingService creates a new reporting service
+// NewReportingService creates a new reporting service. days and clients
+// are the invoice day and client summaries; either may be nil.
 func NewReportingService(
 	readModelStore *repository.ReadModelStore,
+	days *repository.ReadModelStore,
+	clients *repository.ReadModelStore,
 	cache *repository.Cache,
 	logger *logger.Logger,
 ) *ReportingService {
 	return &ReportingService{
 		readModelStore: readModelStore,
+		days:           days,
+		clients:        clients,
 		cache:          cache,
 		logger:         logger,
 		tracer:         otel.Tracer("reporting-service"),
@@ -41,42 +54,42 @@ func NewReportingService(
 
 // RevenueSummary contains revenue analytics
 type RevenueSummary struct {
-	Period         string  `json:"period"`
-	StartDate      string  `json:"startDate"`
-	EndDate        string  `json:"endDate"`
-	TotalRevenue   float64 `json:"totalRevenue"`
-	InvoiceCount   int     `json:"invoiceCount"`
-	AverageInvoice float64 `json:"averageInvoice"`
-	PaidAmount     float64 `json:"paidAmount"`
-	Outstanding    float64 `json:"outstanding"`
-	OverdueAmount  float64 `json:"overdueAmount"`
+	Period         string          `json:"period"`
+	StartDate      string          `json:"startDate"`
+	EndDate        string          `json:"endDate"`
+	TotalRevenue   decimal.Decimal `json:"totalRevenue"`
+	InvoiceCount   int             `json:"invoiceCount"`
+	AverageInvoice decimal.Decimal `json:"averageInvoice"`
+	PaidAmount     decimal.Decimal `json:"paidAmount"`
+	Outstanding    decimal.Decimal `json:"outstanding"`
+	OverdueAmount  decimal.Decimal `json:"overdueAmount"`
 }
 
 // AgingBucket represents an aging category
 type AgingBucket struct {
-	Range        string  `json:"range"`
-	InvoiceCount int     `json:"invoiceCount"`
-	Amount       float64 `json:"amount"`
+	Range        string          `json:"range"`
+	InvoiceCount int             `json:"invoiceCount"`
+	Amount       decimal.Decimal `json:"amount"`
 }
 
 // AgingReport contains invoice aging analysis
 type AgingReport struct {
-	AsOfDate         time.Time     `json:"asOfDate"`
-	TotalOutstanding float64       `json:"totalOutstanding"`
-	Buckets          []AgingBucket `json:"buckets"`
+	AsOfDate         time.Time       `json:"asOfDate"`
+	TotalOutstanding decimal.Decimal `json:"totalOutstanding"`
+	Buckets          []AgingBucket   `json:"buckets"`
 }
 
 // PaymentSummary contains payment analytics
 type PaymentSummary struct {
-	Period           string         `json:"period"`
-	StartDate        string         `json:"startDate"`
-	EndDate          string         `json:"endDate"`
-	TotalPayments    int            `json:"totalPayments"`
-	TotalVolume      float64        `json:"totalVolume"`
-	SuccessRate      float64        `json:"successRate"`
-	FailedCount      int            `json:"failedCount"`
-	RefundedAmount   float64        `json:"refundedAmount"`
-	MethodsBreakdown map[string]int `json:"methodsBreakdown"`
+	Period           string          `json:"period"`
+	StartDate        string          `json:"startDate"`
+	EndDate          string          `json:"endDate"`
+	TotalPayments    int             `json:"totalPayments"`
+	TotalVolume      decimal.Decimal `json:"totalVolume"`
+	SuccessRate      float64         `json:"successRate"`
+	FailedCount      int             `json:"failedCount"`
+	RefundedAmount   decimal.Decimal `json:"refundedAmount"`
+	MethodsBreakdown map[string]int  `json:"methodsBreakdown"`
 }
 
 // DashboardData contains combined metrics for dashboard
@@ -90,7 +103,8 @@ type DashboardData struct {
 	KeyMetrics     map[string]interface{}  `json:"keyMetrics"`
 }
 
-// GetRevenueSummary returns revenue analytics for a period
+// GetRevenueSummary returns revenue analytics for the invoices issued from
+// startDate up to, but not including, endDate.
 func (s *ReportingService) GetRevenueSummary(ctx context.Context, tenantID uuid.UUID, startDate, endDate time.Time) (*RevenueSummary, error) {
 	ctx, span := s.tracer.Start(ctx, "reporting.revenue_summary",
 		trace.WithAttributes(
@@ -102,7 +116,7 @@ func (s *ReportingService) GetRevenueSummary(ctx context.Context, tenantID uuid.
 	defer span.End()
 
 	// Check cache first
-	cacheKey := fmt.Sprintf("report:revenue:%s:%s:%s", tenantID.String(), startDate.Format("20060102"), endDate.Format("20060102"))
+	cacheKey := fmt.Sprintf("report:revenue:%s:%d:%d", tenantID.String(), startDate.Unix(), endDate.Unix())
 	if cached, err := s.cache.Get(ctx, cacheKey); err == nil {
 		var summary RevenueSummary
 		if err := json.Unmarshal([]byte(cached), &summary); err == nil {
@@ -110,61 +124,42 @@ func (s *ReportingService) GetRevenueSummary(ctx context.Context, tenantID uuid.
 		}
 	}
 
-	// Query read model for invoice data
-	filter := bson.M{
-		"tenantId": tenantID.String(),
-		"issueDate": bson.M{
-			"$gte": startDate,
-			"$lte": endDate,
-		},
-	}
-
-	results, err := s.readModelStore.Find(ctx, filter)
-	if err != nil {
-		s.logger.New(ctx).Error("Failed to query invoices for revenue summary", "error", err)
-		return nil, fmt.Errorf("failed to generate revenue summary: %w", err)
-	}
-
-	var invoices []events.InvoiceSummary
-	for _, r := range results {
-		if doc, ok := r.(bson.M); ok {
-			var inv events.InvoiceSummary
-			if data, err := bson.Marshal(doc); err == nil {
-				if err := bson.Unmarshal(data, &inv); err == nil {
-					invoices = append(invoices, inv)
-				}
-			}
-		}
-	}
-
 	summary := &RevenueSummary{
 		Period:    fmt.Sprintf("%s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")),
 		StartDate: startDate.Format(time.RFC3339),
 		EndDate:   endDate.Format(time.RFC3339),
 	}
 
-	for _, inv := range invoices {
-		summary.InvoiceCount++
-		// Parse total from string
-		var total float64
-		fmt.Sscanf(inv.Total, "%f", &total)
-		summary.TotalRevenue += total
-
-		var paid float64
-		fmt.Sscanf(inv.AmountPaid, "%f", &paid)
-		summary.PaidAmount += paid
-
-		var due float64
-		fmt.Sscanf(inv.AmountDue, "%f", &due)
-		summary.Outstanding += due
-
-		if inv.Status == "overdue" {
-			summary.OverdueAmount += due
+	// Whole days are read from the day summaries, the hours before the
+	// first and after the last from the invoices.
+	firstDay, lastDay := events.SummaryDay(startDate), events.SummaryDay(endDate)
+	if firstDay.Before(startDate) {
+		firstDay = firstDay.AddDate(0, 0, 1)
+	}
+	summarized := false
+	if s.days != nil && firstDay.Before(lastDay) {
+		var err error
+		summarized, err = s.addRevenueDays(ctx, summary, tenantID, firstDay, lastDay)
+		if err != nil {
+			s.logger.New(ctx).Warn("Failed to read invoice day summaries; recomputing revenue", "error", err)
+		}
+	}
+	ranges := [][2]time.Time{{startDate, endDate}}
+	if summarized {
+		ranges = [][2]time.Time{{startDate, firstDay}, {lastDay, endDate}}
+	}
+	for _, r := range ranges {
+		if !r[0].Before(r[1]) {
+			continue
+		}
+		if err := s.addRevenueInvoices(ctx, summary, tenantID, r[0], r[1]); err != nil {
+			s.logger.New(ctx).Error("Failed to query invoices for revenue summary", "error", err)
+			return nil, fmt.Errorf("failed to generate revenue summary: %w", err)
 		}
 	}
 
 	if summary.InvoiceCount > 0 {
-		summary.AverageInvoice = summary.TotalRevenue / float64(summary.InvoiceCount)
+		summary.AverageInvoice = summary.TotalRevenue.DivRound(decimal.NewFromInt(int64(summary.InvoiceCount)), money.DefaultPlaces)
 	}
 
 	// Cache result
@@ -175,18 +170,20 @@ func (s *ReportingService) GetRevenueSummary(ctx context.Context, tenantID uuid.
 	return summary, nil
 }
 
-// GetAgingReport returns invoice aging analysis
-func (s *ReportingService) GetAgingReport(ctx context.Context, tenantID uuid.UUID, asOfDate time.Time) (*AgingReport, error) {
+// GetAgingReport returns invoice aging analysis. Invoices are bucketed by
+// the calendar days between their due date and the date of asOfDate in loc.
+func (s *ReportingService) GetAgingReport(ctx context.Context, tenantID uuid.UUID, asOfDate time.Time, loc *time.Location) (*AgingReport, error) {
 	ctx, span := s.tracer.Start(ctx, "reporting.aging_report",
 		trace.WithAttributes(
 			attribute.String("tenant_id", tenantID.String()),
 			attribute.String("as_of_date", asOfDate.Format(time.RFC3339)),
+			attribute.String("time_zone", loc.String()),
 		),
 	)
 	defer span.End()
 
 	// Check cache
-	cacheKey := fmt.Sprintf("report:aging:%s:%s", tenantID.String(), asOfDate.Format("20060102"))
+	cacheKey := fmt.Sprintf("report:aging:%s:%s:%s", tenantID.String(), timezone.Date(asOfDate, loc).Format("20060102"), loc)
 	if cached, err := s.cache.Get(ctx, cacheKey); err == nil {
 		var report AgingReport
 		if err := json.Unmarshal([]byte(cached), &report); err == nil {
@@ -194,66 +191,30 @@ func (s *ReportingService) GetAgingReport(ctx context.Context, tenantID uuid.UUI
 		}
 	}
 
-	// Query outstanding invoices
-	filter := bson.M{
-		"tenantId": tenantID.String(),
-		"status":   bson.M{"$in": []string{"sent", "partial", "overdue"}},
-	}
-
-	results, err := s.readModelStore.Find(ctx, filter)
-	if err != nil {
-		s.logger.New(ctx).Error("Failed to query invoices for aging report", "error", err)
-		return nil, fmt.Errorf("failed to generate aging report: %w", err)
-	}
-
-	var invoices []events.InvoiceSummary
-	for _, r := range results {
-		if doc, ok := r.(bson.M); ok {
-			var inv events.InvoiceSummary
-			if data, err := bson.Marshal(doc); err == nil {
-				if err := bson.Unmarshal(data, &inv); err == nil {
-					invoices = append(invoices, inv)
-				}
-			}
-		}
-	}
-
 	report := &AgingReport{
 		AsOfDate: asOfDate,
 		Buckets: []AgingBucket{
-			{Range: "Current", InvoiceCount: 0, Amount: 0},
-			{Range: "1-30 days", InvoiceCount: 0, Amount: 0},
-			{Range: "31-60 days", InvoiceCount: 0, Amount: 0},
-			{Range: "61-90 days", InvoiceCount: 0, Amount: 0},
-			{Range: "90+ days", InvoiceCount: 0, Amount: 0},
+			{Range: "Current"},
+			{Range: "1-30 days"},
+			{Range: "31-60 days"},
+			{Range: "61-90 days"},
+			{Range: "90+ days"},
 		},
 	}
 
-	for _, inv := range invoices {
-		var amountDue float64
-		fmt.Sscanf(inv.AmountDue, "%f", &amountDue)
-
-		daysOverdue := int(asOfDate.Sub(inv.DueDate).Hours() / 24)
-
-		switch {
-		case daysOverdue <= 0:
-			report.Buckets[0].InvoiceCount++
-			report.Buckets[0].Amount += amountDue
-		case daysOverdue <= 30:
-			report.Buckets[1].InvoiceCount++
-			report.Buckets[1].Amount += amountDue
-		case daysOverdue <= 60:
-			report.Buckets[2].InvoiceCount++
-			report.Buckets[2].Amount += amountDue
-		case daysOverdue <= 90:
-			report.Buckets[3].InvoiceCount++
-			report.Buckets[3].Amount += amountDue
-		default:
-			report.Buckets[4].InvoiceCount++
-			report.Buckets[4].Amount += amountDue
+	summarized := false
+	if s.clients != nil {
+		var err error
+		summarized, err = s.addReceivables(ctx, report, tenantID, asOfDate, loc)
+		if err != nil {
+			s.logger.New(ctx).Warn("Failed to read invoice client summaries; recomputing aging", "error", err)
+		}
+	}
+	if !summarized {
+		if err := s.addOutstandingInvoices(ctx, report, tenantID, asOfDate, loc); err != nil {
+			s.logger.New(ctx).Error("Failed to query invoices for aging report", "error", err)
+			return nil, fmt.Errorf("failed to generate aging report: %w", err)
 		}
-
-		report.TotalOutstanding += amountDue
 	}
 
 	// Cache result
@@ -264,7 +225,121 @@ func (s *ReportingService) GetAgingReport(ctx context.Context, tenantID uuid.UUI
 	return report, nil
 }
 
-// GetPaymentSummary returns payment analytics
+// addRevenueDays adds the tenant's day summaries of [from, to) to summary.
+// It reports false, adding nothing, when there are none, so that revenue
+// not summarized yet is recomputed.
+func (s *ReportingService) addRevenueDays(ctx context.Context, summary *RevenueSummary, tenantID uuid.UUID, from, to time.Time) (bool, error) {
+	results, err := s.days.Find(ctx, bson.M{
+		"tenantId": tenantID.String(),
+		"day":      bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil || len(results) == 0 {
+		return false, err
+	}
+	for _, result := range results {
+		var day events.InvoiceDaySummary
+		if !decodeReadModel(result, &day) {
+			continue
+		}
+		summary.InvoiceCount += day.InvoiceCount
+		summary.TotalRevenue = summary.TotalRevenue.Add(parseAmount(day.Total))
+		summary.PaidAmount = summary.PaidAmount.Add(parseAmount(day.AmountPaid))
+		summary.Outstanding = summary.Outstanding.Add(parseAmount(day.AmountDue))
+		summary.OverdueAmount = summary.OverdueAmount.Add(parseAmount(day.OverdueAmount))
+	}
+	return true, nil
+}
+
+// addRevenueInvoices adds the tenant's invoices issued in [from, to) to
+// summary.
+func (s *ReportingService) addRevenueInvoices(ctx context.Context, summary *RevenueSummary, tenantID uuid.UUID, from, to time.Time) error {
+	results, err := s.readModelStore.Find(ctx, bson.M{
+		"tenantId":  tenantID.String(),
+		"issueDate": bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		var inv events.InvoiceSummary
+		if !decodeReadModel(result, &inv) {
+			continue
+		}
+		summary.InvoiceCount++
+		summary.TotalRevenue = summary.TotalRevenue.Add(parseAmount(inv.Total))
+		summary.PaidAmount = summary.PaidAmount.Add(parseAmount(inv.AmountPaid))
+
+		due := parseAmount(inv.AmountDue)
+		summary.Outstanding = summary.Outstanding.Add(due)
+		if inv.Status == "overdue" {
+			summary.OverdueAmount = summary.OverdueAmount.Add(due)
+		}
+	}
+	return nil
+}
+
+// addReceivables ages the receivables of the tenant's client summaries
+// into report. It reports false, adding nothing, when there are none.
+func (s *ReportingService) addReceivables(ctx context.Context, report *AgingReport, tenantID uuid.UUID, asOfDate time.Time, loc *time.Location) (bool, error) {
+	results, err := s.clients.Find(ctx, bson.M{"tenantId": tenantID.String()})
+	if err != nil || len(results) == 0 {
+		return false, err
+	}
+	for _, result := range results {
+		var client events.InvoiceClientSummary
+		if !decodeReadModel(result, &client) {
+			continue
+		}
+		for _, receivable := range client.Receivables {
+			report.add(timezone.DaysSince(receivable.DueDate, asOfDate, loc), receivable.InvoiceCount, parseAmount(receivable.AmountDue))
+		}
+	}
+	return true, nil
+}
+
+// addOutstandingInvoices ages the tenant's outstanding invoices into
+// report.
+func (s *ReportingService) addOutstandingInvoices(ctx context.Context, report *AgingReport, tenantID uuid.UUID, asOfDate time.Time, loc *time.Location) error {
+	results, err := s.readModelStore.Find(ctx, bson.M{
+		"tenantId": tenantID.String(),
+		"status":   bson.M{"$in": events.OutstandingInvoiceStatuses},
+	})
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		var inv events.InvoiceSummary
+		if !decodeReadModel(result, &inv) {
+			continue
+		}
+		report.add(timezone.DaysSince(inv.DueDate, asOfDate, loc), 1, parseAmount(inv.AmountDue))
+	}
+	return nil
+}
+
+// add adds count invoices with amountDue, daysOverdue days past due, to
+// their bucket.
+func (r *AgingReport) add(daysOverdue, count int, amountDue decimal.Decimal) {
+	var bucket *AgingBucket
+	switch {
+	case daysOverdue <= 0:
+		bucket = &r.Buckets[0]
+	case daysOverdue <= 30:
+		bucket = &r.Buckets[1]
+	case daysOverdue <= 60:
+		bucket = &r.Buckets[2]
+	case daysOverdue <= 90:
+		bucket = &r.Buckets[3]
+	default:
+		bucket = &r.Buckets[4]
+	}
+	bucket.InvoiceCount += count
+	bucket.Amount = bucket.Amount.Add(amountDue)
+	r.TotalOutstanding = r.TotalOutstanding.Add(amountDue)
+}
+
+// GetPaymentSummary returns payment analytics for the payments created from
+// startDate up to, but not including, endDate.
 func (s *ReportingService) GetPaymentSummary(ctx context.Context, tenantID uuid.UUID, startDate, endDate time.Time) (*PaymentSummary, error) {
 	ctx, span := s.tracer.Start(ctx, "reporting.payment_summary",
 		trace.WithAttributes(
@@ -274,7 +349,7 @@ func (s *ReportingService) GetPaymentSummary(ctx context.Context, tenantID uuid.
 	defer span.End()
 
 	// Check cache
-	cacheKey := fmt.Sprintf("report:payments:%s:%s:%s", tenantID.String(), startDate.Format("20060102"), endDate.Format("20060102"))
+	cacheKey := fmt.Sprintf("report:payments:%s:%d:%d", tenantID.String(), startDate.Unix(), endDate.Unix())
 	if cached, err := s.cache.Get(ctx, cacheKey); err == nil {
 		var summary PaymentSummary
 		if err := json.Unmarshal([]byte(cached), &summary); err == nil {
@@ -287,7 +362,7 @@ func (s *ReportingService) GetPaymentSummary(ctx context.Context, tenantID uuid.
 		"tenantId": tenantID.String(),
 		"createdAt": bson.M{
 			"$gte": startDate,
-			"$lte": endDate,
+			"$lt":  endDate,
 		},
 	}
 
@@ -318,9 +393,8 @@ func (s *ReportingService) GetPaymentSummary(ctx context.Context, tenantID uuid.
 
 	for _, p := range payments {
 		summary.TotalPayments++
-		var amount float64
-		fmt.Sscanf(p.Amount, "%f", &amount)
-		summary.TotalVolume += amount
+		amount := parseAmount(p.Amount)
+		summary.TotalVolume = summary.TotalVolume.Add(amount)
 
 		summary.MethodsBreakdown[p.Method]++
 
@@ -330,7 +404,7 @@ func (s *ReportingService) GetPaymentSummary(ctx context.Context, tenantID uuid.
 		case "failed":
 			summary.FailedCount++
 		case "refunded":
-			summary.RefundedAmount += amount
+			summary.RefundedAmount = summary.RefundedAmount.Add(amount)
 		}
 	}
 
@@ -346,15 +420,16 @@ func (s *ReportingService) GetPaymentSummary(ctx context.Context, tenantID uuid.
 	return summary, nil
 }
 
-// GetDashboardData returns combined metrics for dashboard
-func (s *ReportingService) GetDashboardData(ctx context.Context, tenantID uuid.UUID) (*DashboardData, error) {
+// GetDashboardData returns combined metrics for dashboard. The current
+// month and the aging buckets follow the calendar in loc.
+func (s *ReportingService) GetDashboardData(ctx context.Context, tenantID uuid.UUID, loc *time.Location) (*DashboardData, error) {
 	ctx, span := s.tracer.Start(ctx, "reporting.dashboard",
 		trace.WithAttributes(attribute.String("tenant_id", tenantID.String())),
 	)
 	defer span.End()
 
 	// Check cache
-	cacheKey := fmt.Sprintf("report:dashboard:%s", tenantID.String())
+	cacheKey := fmt.Sprintf("report:dashboard:%s:%s", tenantID.String(), loc)
 	if cached, err := s.cache.Get(ctx, cacheKey); err == nil {
 		var data DashboardData
 		if err := json.Unmarshal([]byte(cached), &data); err == nil {
@@ -363,7 +438,7 @@ func (s *ReportingService) GetDashboardData(ctx context.Context, tenantID uuid.U
 	}
 
 	now := time.Now().UTC()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	startOfMonth := timezone.StartOfMonth(now, loc)
 
 	// Get revenue summary for current month
 	revenue, err := s.GetRevenueSummary(ctx, tenantID, startOfMonth, now)
@@ -372,7 +447,7 @@ func (s *ReportingService) GetDashboardData(ctx context.Context, tenantID uuid.U
 	}
 
 	// Get aging report
-	aging, err := s.GetAgingReport(ctx, tenantID, now)
+	aging, err := s.GetAgingReport(ctx, tenantID, now, loc)
 	if err != nil {
 		s.logger.New(ctx).Error("Failed to get aging report for dashboard", "error", err)
 	}
@@ -418,8 +493,9 @@ func (s *ReportingService) GetDashboardData(ctx context.Context, tenantID uuid.U
 	}
 
 	// Calculate collection rate
-	if revenue.TotalRevenue > 0 {
-		dashboard.KeyMetrics["collectionRate"] = (revenue.PaidAmount / revenue.TotalRevenue) * 100
+	if revenue.TotalRevenue.IsPositive() {
+		rate := revenue.PaidAmount.Div(revenue.TotalRevenue).Mul(decimal.NewFromInt(100)).Round(2)
+		dashboard.KeyMetrics["collectionRate"] = rate.InexactFloat64()
 	}
 
 	// Count outstanding invoices
@@ -437,3 +513,26 @@ func (s *ReportingService) GetDashboardData(ctx context.Context, tenantID uuid.U
 
 	return dashboard, nil
 }
+
+// decodeReadModel decodes a document Find returned into v.
+func decodeReadModel(result interface{}, v interface{}) bool {
+	doc, ok := result.(bson.M)
+	if !ok {
+		return false
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return false
+	}
+	return bson.Unmarshal(data, v) == nil
+}
+
+// parseAmount reads an amount of a read model, where amounts are decimal
+// strings; an invalid amount counts as zero.
+func parseAmount(amount string) decimal.Decimal {
+	value, err := decimal.NewFromString(amount)
+	if err != nil {
+		return decimal.Zero
+	}
+	return value
+}
@@ -0,0 +1,211 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+)
+
+// Groupings accepted by NewReturnTally.
+const (
+	ReturnsByProduct  = "product"
+	ReturnsBySupplier = "supplier"
+	ReturnsByLot      = "lot"
+)
+
+// ReturnRate is how much of what was shipped of a product, from a supplier
+// or of one lot of a product came back. Rates are percentages of the units
+// shipped; they are zero when nothing was shipped, though units shipped
+// earlier may still have been returned.
+type ReturnRate struct {
+	ProductID         string         `json:"productId,omitempty"`
+	SupplierID        string         `json:"supplierId,omitempty"`
+	LotNumber         string         `json:"lotNumber,omitempty"`
+	UnitsShipped      int            `json:"unitsShipped"`
+	UnitsReturned     int            `json:"unitsReturned"`
+	QualityReturns    int            `json:"qualityReturns"`
+	ReturnRate        float64        `json:"returnRate"`
+	QualityReturnRate float64        `json:"qualityReturnRate"`
+	Reasons           map[string]int `json:"reasons"`
+	Dispositions      map[string]int `json:"dispositions"`
+}
+
+func newReturnRate() *ReturnRate {
+	return &ReturnRate{Reasons: make(map[string]int), Dispositions: make(map[string]int)}
+}
+
+func (r *ReturnRate) rates() {
+	if r.UnitsShipped > 0 {
+		r.ReturnRate = round2(float64(r.UnitsReturned) * 100 / float64(r.UnitsShipped))
+		r.QualityReturnRate = round2(float64(r.QualityReturns) * 100 / float64(r.UnitsShipped))
+	}
+}
+
+// ReturnsReport sums up the units shipped and the units returned on RMAs
+// opened in a period, in total and per group, highest return rate first.
+type ReturnsReport struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	GroupBy string       `json:"groupBy"`
+	Total   ReturnRate   `json:"total"`
+	Groups  []ReturnRate `json:"groups"`
+}
+
+// ReturnAlertPolicy sets when a return rate calls for an alert: above
+// Threshold percent of at least MinShipped units shipped. QualityOnly
+// compares the quality return rate instead.
+type ReturnAlertPolicy struct {
+	Threshold   float64
+	MinShipped  int
+	QualityOnly bool
+}
+
+type returnKey struct {
+	product  string
+	supplier string
+	lot      string
+}
+
+// ReturnTally adds up shipments and returns one at a time, grouped by
+// product, supplier or product lot.
+type ReturnTally struct {
+	groupBy string
+	total   *ReturnRate
+	groups  map[returnKey]*ReturnRate
+}
+
+// NewReturnTally groups by groupBy, one of the ReturnsBy constants; other
+// values group by product.
+func NewReturnTally(groupBy string) *ReturnTally {
+	if groupBy != ReturnsBySupplier && groupBy != ReturnsByLot {
+		groupBy = ReturnsByProduct
+	}
+	return &ReturnTally{
+		groupBy: groupBy,
+		total:   newReturnRate(),
+		groups:  make(map[returnKey]*ReturnRate),
+	}
+}
+
+func (t *ReturnTally) group(productID, supplierID, lotNumber string) *ReturnRate {
+	var key returnKey
+	switch t.groupBy {
+	case ReturnsBySupplier:
+		key = returnKey{supplier: supplierID}
+	case ReturnsByLot:
+		key = returnKey{product: productID, lot: lotNumber}
+	default:
+		key = returnKey{product: productID}
+	}
+	group, ok := t.groups[key]
+	if !ok {
+		group = newReturnRate()
+		group.ProductID, group.SupplierID, group.LotNumber = key.product, key.supplier, key.lot
+		t.groups[key] = group
+	}
+	return group
+}
+
+// AddShipment counts quantity units of a lot of a product, bought from
+// supplierID, shipped to customers. The supplier and lot may be empty.
+func (t *ReturnTally) AddShipment(productID, supplierID, lotNumber string, quantity int) {
+	t.total.UnitsShipped += quantity
+	t.group(productID, supplierID, lotNumber).UnitsShipped += quantity
+}
+
+// AddReturn counts the lines of an RMA by reason and, once inspected, by
+// disposition.
+func (t *ReturnTally) AddReturn(rma *domain.ReturnAuthorization) {
+	for _, line := range rma.Lines {
+		supplierID := ""
+		if line.SupplierID != nil {
+			supplierID = line.SupplierID.String()
+		}
+		group := t.group(line.ProductID.String(), supplierID, line.LotNumber)
+		for _, rate := range []*ReturnRate{t.total, group} {
+			rate.UnitsReturned += line.Quantity
+			if line.Reason.IsQuality() {
+				rate.QualityReturns += line.Quantity
+			}
+			rate.Reasons[string(line.Reason)] += line.Quantity
+			if line.Disposition != "" {
+				rate.Dispositions[string(line.Disposition)] += line.Quantity
+			}
+		}
+	}
+}
+
+// Report returns the totals and the limit groups with the highest return
+// rates, all of them when limit is 0.
+func (t *ReturnTally) Report(from, to time.Time, limit int) *ReturnsReport {
+	report := &ReturnsReport{
+		From:    from,
+		To:      to,
+		GroupBy: t.groupBy,
+		Total:   *t.total,
+		Groups:  t.rates(),
+	}
+	report.Total.rates()
+	if limit > 0 && len(report.Groups) > limit {
+		report.Groups = report.Groups[:limit]
+	}
+	return report
+}
+
+func (t *ReturnTally) rates() []ReturnRate {
+	rates := make([]ReturnRate, 0, len(t.groups))
+	for _, group := range t.groups {
+		rate := *group
+		rate.rates()
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		a, b := rates[i], rates[j]
+		if a.ReturnRate != b.ReturnRate {
+			return a.ReturnRate > b.ReturnRate
+		}
+		if a.UnitsReturned != b.UnitsReturned {
+			return a.UnitsReturned > b.UnitsReturned
+		}
+		if a.ProductID+a.SupplierID != b.ProductID+b.SupplierID {
+			return a.ProductID+a.SupplierID < b.ProductID+b.SupplierID
+		}
+		return a.LotNumber < b.LotNumber
+	})
+	return rates
+}
+
+// Alerts returns an alert for each product whose return rate between from
+// and to is above policy. The tally must group by product.
+func (t *ReturnTally) Alerts(tenantID uuid.UUID, from, to time.Time, policy ReturnAlertPolicy) []domain.ReturnRateAlert {
+	var alerts []domain.ReturnRateAlert
+	for _, rate := range t.rates() {
+		productID, err := uuid.Parse(rate.ProductID)
+		if err != nil || rate.UnitsShipped == 0 || rate.UnitsShipped < policy.MinShipped {
+			continue
+		}
+		returned, percent := rate.UnitsReturned, rate.ReturnRate
+		if policy.QualityOnly {
+			returned, percent = rate.QualityReturns, rate.QualityReturnRate
+		}
+		if percent <= policy.Threshold {
+			continue
+		}
+		alerts = append(alerts, domain.ReturnRateAlert{
+			ID:            tenantID.String() + ":" + productID.String(),
+			TenantID:      tenantID,
+			ProductID:     productID,
+			UnitsShipped:  rate.UnitsShipped,
+			UnitsReturned: returned,
+			ReturnRate:    percent,
+			Threshold:     policy.Threshold,
+			QualityOnly:   policy.QualityOnly,
+			WindowStart:   from,
+			WindowEnd:     to,
+			RaisedAt:      to,
+		})
+	}
+	return alerts
+}
@@ -0,0 +1,115 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var returnWindow = time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+
+func returnOf(lines ...domain.ReturnLine) *domain.ReturnAuthorization {
+	return &domain.ReturnAuthorization{ID: uuid.New(), Status: domain.ReturnStatusAuthorized, Lines: lines}
+}
+
+func returnLine(productID uuid.UUID, supplierID *uuid.UUID, lot string, quantity int, reason domain.ReturnReason) domain.ReturnLine {
+	return domain.ReturnLine{ID: uuid.New(), ProductID: productID, SupplierID: supplierID, LotNumber: lot, Quantity: quantity, Reason: reason}
+}
+
+func TestReturnTally_ByProduct(t *testing.T) {
+	kettle, toaster := uuid.New(), uuid.New()
+
+	tally := NewReturnTally("")
+	tally.AddShipment(kettle.String(), "", "L1", 40)
+	tally.AddShipment(kettle.String(), "", "L2", 10)
+	tally.AddShipment(toaster.String(), "", "", 100)
+	disposed := returnLine(kettle, nil, "L1", 3, domain.ReturnReasonDefective)
+	disposed.Disposition = domain.ReturnDispositionReturnToSupplier
+	tally.AddReturn(returnOf(disposed, returnLine(kettle, nil, "L2", 2, domain.ReturnReasonNoLongerNeeded)))
+	tally.AddReturn(returnOf(returnLine(toaster, nil, "", 1, domain.ReturnReasonDamagedInTransit)))
+
+	report := tally.Report(returnWindow, returnWindow.AddDate(0, 1, 0), 0)
+	assert.Equal(t, ReturnsByProduct, report.GroupBy)
+	assert.Equal(t, 150, report.Total.UnitsShipped)
+	assert.Equal(t, 6, report.Total.UnitsReturned)
+	assert.Equal(t, 4.0, report.Total.ReturnRate)
+
+	require.Len(t, report.Groups, 2)
+	first := report.Groups[0]
+	assert.Equal(t, kettle.String(), first.ProductID)
+	assert.Equal(t, 50, first.UnitsShipped)
+	assert.Equal(t, 10.0, first.ReturnRate)
+	assert.Equal(t, 6.0, first.QualityReturnRate)
+	assert.Equal(t, map[string]int{"defective": 3, "no_longer_needed": 2}, first.Reasons)
+	assert.Equal(t, map[string]int{"return_to_supplier": 3}, first.Dispositions)
+	assert.Equal(t, 1.0, report.Groups[1].ReturnRate)
+
+	assert.Len(t, tally.Report(returnWindow, returnWindow.AddDate(0, 1, 0), 1).Groups, 1)
+}
+
+func TestReturnTally_BySupplierAndLot(t *testing.T) {
+	kettle, toaster := uuid.New(), uuid.New()
+	acme := uuid.New()
+
+	bySupplier := NewReturnTally(ReturnsBySupplier)
+	byLot := NewReturnTally(ReturnsByLot)
+	for _, tally := range []*ReturnTally{bySupplier, byLot} {
+		tally.AddShipment(kettle.String(), acme.String(), "L1", 20)
+		tally.AddShipment(toaster.String(), acme.String(), "L1", 30)
+		tally.AddShipment(kettle.String(), acme.String(), "L2", 50)
+		tally.AddReturn(returnOf(
+			returnLine(kettle, &acme, "L1", 4, domain.ReturnReasonDefective),
+			returnLine(toaster, &acme, "L1", 1, domain.ReturnReasonWrongItem),
+		))
+	}
+
+	suppliers := bySupplier.Report(returnWindow, returnWindow, 0).Groups
+	require.Len(t, suppliers, 1)
+	assert.Equal(t, acme.String(), suppliers[0].SupplierID)
+	assert.Equal(t, 100, suppliers[0].UnitsShipped)
+	assert.Equal(t, 5.0, suppliers[0].ReturnRate)
+
+	lots := byLot.Report(returnWindow, returnWindow, 0).Groups
+	require.Len(t, lots, 3, "lots are told apart per product")
+	assert.Equal(t, kettle.String(), lots[0].ProductID)
+	assert.Equal(t, "L1", lots[0].LotNumber)
+	assert.Equal(t, 20.0, lots[0].ReturnRate)
+	assert.Equal(t, 0.0, lots[2].ReturnRate)
+}
+
+func TestReturnTally_Alerts(t *testing.T) {
+	tenantID := uuid.New()
+	kettle, toaster, mixer := uuid.New(), uuid.New(), uuid.New()
+	from, to := returnWindow, returnWindow.AddDate(0, 0, 30)
+
+	tally := NewReturnTally(ReturnsByProduct)
+	tally.AddShipment(kettle.String(), "", "", 40)
+	tally.AddShipment(toaster.String(), "", "", 40)
+	tally.AddShipment(mixer.String(), "", "", 5)
+	tally.AddReturn(returnOf(
+		returnLine(kettle, nil, "", 4, domain.ReturnReasonDefective),
+		returnLine(toaster, nil, "", 4, domain.ReturnReasonNoLongerNeeded),
+		returnLine(mixer, nil, "", 5, domain.ReturnReasonDefective),
+	))
+
+	alerts := tally.Alerts(tenantID, from, to, ReturnAlertPolicy{Threshold: 5, MinShipped: 20})
+	require.Len(t, alerts, 2, "the mixer shipped too few units to judge")
+	for _, alert := range alerts {
+		assert.Equal(t, tenantID, alert.TenantID)
+		assert.Equal(t, 10.0, alert.ReturnRate)
+		assert.Equal(t, 5.0, alert.Threshold)
+		assert.Equal(t, to, alert.WindowEnd)
+	}
+
+	alerts = tally.Alerts(tenantID, from, to, ReturnAlertPolicy{Threshold: 5, MinShipped: 20, QualityOnly: true})
+	require.Len(t, alerts, 1)
+	assert.Equal(t, kettle, alerts[0].ProductID)
+	assert.Equal(t, tenantID.String()+":"+kettle.String(), alerts[0].ID)
+	assert.True(t, alerts[0].QualityOnly)
+
+	assert.Empty(t, tally.Alerts(tenantID, from, to, ReturnAlertPolicy{Threshold: 10, MinShipped: 20}), "a rate at the threshold is not above it")
+}
@@ -0,0 +1,429 @@
+// Package approval routes invoices, purchase orders, stock adjustments,
+// payouts and anything else that needs sign-off through the approval
+// workflow a tenant configured for its subject type. A workflow is a list of
+// steps, each decided by users or roles, applying from an amount and
+// optionally escalating after a number of hours.
+//
+// Services ask for approval by publishing an approval.requested event, or
+// by POSTing to the API, and learn the outcome from the approval.approved,
+// approval.rejected and approval.cancelled events. Every decision is kept on
+// the request and published, so the audit log records who decided what.
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/internal/repository"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// Permissions checked by the engine.
+const (
+	// AdminPermission lets a user configure workflows and cancel any
+	// request.
+	AdminPermission = "approval:admin"
+	// RequestPermission lets a user submit subjects for approval.
+	RequestPermission = "approval:request"
+	// ReadPermission lets a user see every request of its tenant, not only
+	// those it takes part in.
+	ReadPermission = "approval:read"
+)
+
+// Events services publish to the engine.
+const (
+	// EventRequested submits a subject: data holds subjectType, subjectId,
+	// amount, currency and summary.
+	EventRequested = "approval.requested"
+	// EventWithdrawn cancels the pending request of a subject: data holds
+	// subjectType, subjectId and reason.
+	EventWithdrawn = "approval.withdrawn"
+)
+
+const (
+	listLimit       = 200
+	escalationBatch = 100
+)
+
+type store interface {
+	ListWorkflows(ctx context.Context, tenantID string) ([]domain.ApprovalWorkflow, error)
+	GetWorkflow(ctx context.Context, tenantID, subjectType string) (*domain.ApprovalWorkflow, error)
+	PutWorkflow(ctx context.Context, workflow *domain.ApprovalWorkflow, expectedVersion int64) error
+	DeleteWorkflow(ctx context.Context, tenantID, subjectType string) error
+	CreateRequest(ctx context.Context, req *domain.ApprovalRequest) error
+	GetRequest(ctx context.Context, tenantID, id string) (*domain.ApprovalRequest, error)
+	FindPending(ctx context.Context, tenantID, subjectType, subjectID string) (*domain.ApprovalRequest, error)
+	UpdateRequest(ctx context.Context, req *domain.ApprovalRequest) error
+	ListRequests(ctx context.Context, tenantID string, f repository.ApprovalRequestFilter, limit int64) ([]domain.ApprovalRequest, error)
+	Inbox(ctx context.Context, tenantID, userID string, roles []string, limit int64) ([]domain.ApprovalRequest, error)
+	DueForEscalation(ctx context.Context, now time.Time, limit int64) ([]domain.ApprovalRequest, error)
+}
+
+// Submission asks for a subject to be approved.
+type Submission struct {
+	SubjectType string  `json:"subjectType"`
+	SubjectID   string  `json:"subjectId"`
+	Amount      float64 `json:"amount"`
+	Currency    string  `json:"currency"`
+	Summary     string  `json:"summary"`
+}
+
+// Engine starts, decides and escalates approval requests.
+type Engine struct {
+	store     store
+	publisher events.Publisher
+	logger    *logger.Logger
+	now       func() time.Time
+}
+
+// New returns an engine keeping workflows and requests in store and
+// publishing their progress to publisher.
+func New(store *repository.ApprovalStore, publisher events.Publisher, log *logger.Logger) *Engine {
+	return newEngine(store, publisher, log)
+}
+
+func newEngine(store store, publisher events.Publisher, log *logger.Logger) *Engine {
+	return &Engine{store: store, publisher: publisher, logger: log, now: time.Now}
+}
+
+// Workflows returns the workflows of tenantID.
+func (e *Engine) Workflows(ctx context.Context, tenantID string) ([]domain.ApprovalWorkflow, error) {
+	return e.store.ListWorkflows(ctx, tenantID)
+}
+
+// Workflow returns the workflow of tenantID for subjectType.
+func (e *Engine) Workflow(ctx context.Context, tenantID, subjectType string) (*domain.ApprovalWorkflow, error) {
+	workflow, err := e.store.GetWorkflow(ctx, tenantID, subjectType)
+	if errors.Is(err, repository.ErrApprovalWorkflowNotFound) {
+		return nil, apperr.NotFound("no approval workflow for %s", subjectType)
+	}
+	return workflow, err
+}
+
+// PutWorkflow saves the workflow of a subject type. With expectedVersion
+// above zero it is only replaced at that version. Requests already pending
+// keep the steps they started with.
+func (e *Engine) PutWorkflow(ctx context.Context, userID string, workflow *domain.ApprovalWorkflow, expectedVersion int64) error {
+	if err := workflow.Validate(); err != nil {
+		return domainError(err)
+	}
+	workflow.UpdatedBy = userID
+	workflow.UpdatedAt = e.now().UTC()
+	err := e.store.PutWorkflow(ctx, workflow, expectedVersion)
+	if errors.Is(err, repository.ErrConcurrencyConflict) {
+		current, getErr := e.Workflow(ctx, workflow.TenantID, workflow.SubjectType)
+		if getErr != nil {
+			return getErr
+		}
+		return apperr.VersionConflict("approval workflow", expectedVersion, current.Version)
+	}
+	if err != nil {
+		return err
+	}
+	e.publish(ctx, workflow.SubjectType, "ApprovalWorkflow", "approval.workflow_changed", workflow.TenantID, userID, map[string]interface{}{
+		"subjectType": workflow.SubjectType,
+		"steps":       workflow.Steps,
+		"version":     workflow.Version,
+	})
+	return nil
+}
+
+// DeleteWorkflow removes the workflow of a subject type, after which its
+// subjects are approved as soon as they are submitted.
+func (e *Engine) DeleteWorkflow(ctx context.Context, tenantID, userID, subjectType string) error {
+	err := e.store.DeleteWorkflow(ctx, tenantID, subjectType)
+	if errors.Is(err, repository.ErrApprovalWorkflowNotFound) {
+		return apperr.NotFound("no approval workflow for %s", subjectType)
+	}
+	if err != nil {
+		return err
+	}
+	e.publish(ctx, subjectType, "ApprovalWorkflow", "approval.workflow_deleted", tenantID, userID, map[string]interface{}{
+		"subjectType": subjectType,
+	})
+	return nil
+}
+
+// Request submits a subject for approval by userID through the workflow of
+// its type. A subject whose type has no workflow, or whose amount no step
+// applies to, is approved at once.
+func (e *Engine) Request(ctx context.Context, tenantID, userID string, s Submission) (*domain.ApprovalRequest, error) {
+	workflow, err := e.store.GetWorkflow(ctx, tenantID, s.SubjectType)
+	if errors.Is(err, repository.ErrApprovalWorkflowNotFound) {
+		workflow, err = &domain.ApprovalWorkflow{TenantID: tenantID, SubjectType: s.SubjectType}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	req, err := domain.NewApprovalRequest(uuid.New().String(), workflow, s.SubjectID, s.Amount, s.Currency, strings.TrimSpace(s.Summary), userID, e.now())
+	if err != nil {
+		return nil, domainError(err)
+	}
+	err = e.store.CreateRequest(ctx, req)
+	if errors.Is(err, repository.ErrConcurrencyConflict) {
+		return nil, apperr.Conflict("%s %s already has a pending approval request", s.SubjectType, s.SubjectID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.publishRequest(ctx, req, "approval.created", userID, map[string]interface{}{
+		"approverUsers": req.ApproverUsers,
+		"approverRoles": req.ApproverRoles,
+		"requestedBy":   userID,
+	})
+	if req.Status == domain.ApprovalApproved {
+		e.publishRequest(ctx, req, "approval.approved", userID, nil)
+	}
+	return req, nil
+}
+
+// Get returns a request userID may see: any request with ReadPermission,
+// otherwise only those it requested, decided or may decide.
+func (e *Engine) Get(ctx context.Context, tenantID, userID string, roles, permissions []string, id string) (*domain.ApprovalRequest, error) {
+	req, err := e.get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !rbac.Allows(permissions, ReadPermission) && !participant(req, userID, roles) {
+		return nil, apperr.NotFound("approval request %s not found", id)
+	}
+	return req, nil
+}
+
+// List returns the newest requests of tenantID matching f. Without
+// ReadPermission only the requests userID requested or decided are listed.
+func (e *Engine) List(ctx context.Context, tenantID, userID string, permissions []string, f repository.ApprovalRequestFilter) ([]domain.ApprovalRequest, error) {
+	if !rbac.Allows(permissions, ReadPermission) {
+		f.Participant = userID
+	}
+	return e.store.ListRequests(ctx, tenantID, f, listLimit)
+}
+
+// Inbox returns the pending requests userID, holding roles, may decide,
+// oldest first.
+func (e *Engine) Inbox(ctx context.Context, tenantID, userID string, roles []string) ([]domain.ApprovalRequest, error) {
+	return e.store.Inbox(ctx, tenantID, userID, roles, listLimit)
+}
+
+// Approve approves the current step of a request on behalf of userID.
+func (e *Engine) Approve(ctx context.Context, tenantID, userID string, roles []string, id, comment string) (*domain.ApprovalRequest, error) {
+	req, err := e.get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	step := req.CurrentStep
+	approved, err := req.Approve(userID, roles, comment, e.now())
+	if err != nil {
+		return nil, domainError(err)
+	}
+	if err := e.update(ctx, req); err != nil {
+		return nil, err
+	}
+
+	e.publishRequest(ctx, req, "approval.step_approved", userID, map[string]interface{}{
+		"step":     step,
+		"stepName": req.Steps[step].Name,
+		"comment":  strings.TrimSpace(comment),
+	})
+	if approved {
+		e.publishRequest(ctx, req, "approval.approved", userID, nil)
+	}
+	return req, nil
+}
+
+// Reject rejects a request at its current step on behalf of userID. A
+// rejection needs a comment.
+func (e *Engine) Reject(ctx context.Context, tenantID, userID string, roles []string, id, comment string) (*domain.ApprovalRequest, error) {
+	req, err := e.get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	step := req.CurrentStep
+	if err := req.Reject(userID, roles, comment, e.now()); err != nil {
+		return nil, domainError(err)
+	}
+	if err := e.update(ctx, req); err != nil {
+		return nil, err
+	}
+
+	e.publishRequest(ctx, req, "approval.rejected", userID, map[string]interface{}{
+		"step":     step,
+		"stepName": req.Steps[step].Name,
+		"comment":  strings.TrimSpace(comment),
+	})
+	return req, nil
+}
+
+// Cancel withdraws a pending request. Only its requester, or a user with
+// AdminPermission, may cancel it.
+func (e *Engine) Cancel(ctx context.Context, tenantID, userID string, permissions []string, id, reason string) (*domain.ApprovalRequest, error) {
+	req, err := e.get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.RequestedBy != userID && !rbac.Allows(permissions, AdminPermission) {
+		return nil, apperr.Forbidden("only the requester or an approval admin can cancel a request")
+	}
+	return req, e.cancel(ctx, req, userID, reason)
+}
+
+func (e *Engine) cancel(ctx context.Context, req *domain.ApprovalRequest, userID, reason string) error {
+	if err := req.Cancel(userID, reason, e.now()); err != nil {
+		return domainError(err)
+	}
+	if err := e.update(ctx, req); err != nil {
+		return err
+	}
+	e.publishRequest(ctx, req, "approval.cancelled", userID, map[string]interface{}{"reason": strings.TrimSpace(reason)})
+	return nil
+}
+
+// HandleEvent starts and withdraws requests for services that publish
+// EventRequested and EventWithdrawn. Redelivered events are harmless: a
+// subject that already has a pending request is not submitted again.
+func (e *Engine) HandleEvent(ctx context.Context, event *events.EventEnvelope) error {
+	switch event.Type {
+	case EventRequested:
+		amount, _ := event.Data["amount"].(float64)
+		_, err := e.Request(ctx, event.TenantID, event.UserID, Submission{
+			SubjectType: stringField(event.Data, "subjectType"),
+			SubjectID:   stringField(event.Data, "subjectId"),
+			Amount:      amount,
+			Currency:    stringField(event.Data, "currency"),
+			Summary:     stringField(event.Data, "summary"),
+		})
+		if apperr.Is(err, apperr.CodeConflict) {
+			return nil
+		}
+		if apperr.Is(err, apperr.CodeInvalidArgument) {
+			e.logger.New(ctx).Warnw("Ignoring invalid approval request", "error", err, "event_id", event.ID)
+			return nil
+		}
+		return err
+
+	case EventWithdrawn:
+		req, err := e.store.FindPending(ctx, event.TenantID, stringField(event.Data, "subjectType"), stringField(event.Data, "subjectId"))
+		if errors.Is(err, repository.ErrApprovalRequestNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return e.cancel(ctx, req, event.UserID, stringField(event.Data, "reason"))
+	}
+	return nil
+}
+
+// EscalateOnce escalates every pending step whose timer has run out, so
+// its escalation users and roles may decide it too.
+func (e *Engine) EscalateOnce(ctx context.Context) error {
+	now := e.now()
+	due, err := e.store.DueForEscalation(ctx, now, escalationBatch)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range due {
+		req := &due[i]
+		if !req.Escalate(now) {
+			continue
+		}
+		err := e.store.UpdateRequest(ctx, req)
+		if errors.Is(err, repository.ErrConcurrencyConflict) {
+			// Decided while we escalated; the next pass sees its new step.
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("request %s: %w", req.ID, err))
+			continue
+		}
+		step := req.Steps[req.CurrentStep]
+		e.publishRequest(ctx, req, "approval.escalated", "", map[string]interface{}{
+			"step":            req.CurrentStep,
+			"stepName":        step.Name,
+			"escalateToUsers": step.EscalateToUsers,
+			"escalateToRoles": step.EscalateToRoles,
+		})
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Engine) get(ctx context.Context, tenantID, id string) (*domain.ApprovalRequest, error) {
+	req, err := e.store.GetRequest(ctx, tenantID, id)
+	if errors.Is(err, repository.ErrApprovalRequestNotFound) {
+		return nil, apperr.NotFound("approval request %s not found", id)
+	}
+	return req, err
+}
+
+func (e *Engine) update(ctx context.Context, req *domain.ApprovalRequest) error {
+	err := e.store.UpdateRequest(ctx, req)
+	if errors.Is(err, repository.ErrConcurrencyConflict) {
+		return apperr.Conflict("approval request %s was decided concurrently; reload it", req.ID)
+	}
+	return err
+}
+
+// participant reports whether userID requested, decided or may decide req.
+func participant(req *domain.ApprovalRequest, userID string, roles []string) bool {
+	if req.RequestedBy == userID || req.CanDecide(userID, roles) {
+		return true
+	}
+	for _, decision := range req.Decisions {
+		if decision.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func domainError(err error) error {
+	var approvalErr *domain.ApprovalError
+	if !errors.As(err, &approvalErr) {
+		return err
+	}
+	switch approvalErr {
+	case domain.ErrApprovalDecided:
+		return apperr.Conflict("%s", approvalErr.Message)
+	case domain.ErrNotApprover, domain.ErrApprovalSelfDecision:
+		return apperr.Forbidden("%s", approvalErr.Message)
+	}
+	return apperr.InvalidArgument("%s", approvalErr.Message)
+}
+
+func stringField(data map[string]interface{}, key string) string {
+	s, _ := data[key].(string)
+	return s
+}
+
+func (e *Engine) publishRequest(ctx context.Context, req *domain.ApprovalRequest, eventType, userID string, data map[string]interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["requestId"] = req.ID
+	data["subjectType"] = req.SubjectType
+	data["subjectId"] = req.SubjectID
+	data["amount"] = req.Amount
+	data["currency"] = req.Currency
+	data["status"] = string(req.Status)
+	e.publish(ctx, req.ID, "ApprovalRequest", eventType, req.TenantID, userID, data)
+}
+
+func (e *Engine) publish(ctx context.Context, aggregateID, aggregateType, eventType, tenantID, userID string, data map[string]interface{}) {
+	if e.publisher == nil {
+		return
+	}
+	event := events.NewEvent(aggregateID, aggregateType, eventType, tenantID, userID, data)
+	if err := e.publisher.PublishEvent(ctx, event); err != nil {
+		e.logger.New(ctx).Warnw("Failed to publish approval event", "error", err, "event_type", eventType, "aggregate_id", aggregateID)
+	}
+}
@@ -0,0 +1,323 @@
+package approval
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tenantID = "tenant-1"
+
+type fakeStore struct {
+	workflows map[string]domain.ApprovalWorkflow
+	requests  map[string]domain.ApprovalRequest
+}
+
+func (s *fakeStore) ListWorkflows(ctx context.Context, tenantID string) ([]domain.ApprovalWorkflow, error) {
+	var workflows []domain.ApprovalWorkflow
+	for _, w := range s.workflows {
+		if w.TenantID == tenantID {
+			workflows = append(workflows, w)
+		}
+	}
+	return workflows, nil
+}
+
+func (s *fakeStore) GetWorkflow(ctx context.Context, tenantID, subjectType string) (*domain.ApprovalWorkflow, error) {
+	w, ok := s.workflows[tenantID+"/"+subjectType]
+	if !ok {
+		return nil, repository.ErrApprovalWorkflowNotFound
+	}
+	return &w, nil
+}
+
+func (s *fakeStore) PutWorkflow(ctx context.Context, workflow *domain.ApprovalWorkflow, expectedVersion int64) error {
+	id := workflow.TenantID + "/" + workflow.SubjectType
+	current, ok := s.workflows[id]
+	if expectedVersion > 0 && (!ok || current.Version != expectedVersion) {
+		return repository.ErrConcurrencyConflict
+	}
+	workflow.ID = id
+	workflow.Version = current.Version + 1
+	s.workflows[id] = *workflow
+	return nil
+}
+
+func (s *fakeStore) DeleteWorkflow(ctx context.Context, tenantID, subjectType string) error {
+	id := tenantID + "/" + subjectType
+	if _, ok := s.workflows[id]; !ok {
+		return repository.ErrApprovalWorkflowNotFound
+	}
+	delete(s.workflows, id)
+	return nil
+}
+
+func (s *fakeStore) CreateRequest(ctx context.Context, req *domain.ApprovalRequest) error {
+	if _, err := s.FindPending(ctx, req.TenantID, req.SubjectType, req.SubjectID); err == nil {
+		return repository.ErrConcurrencyConflict
+	}
+	s.requests[req.ID] = *req
+	return nil
+}
+
+func (s *fakeStore) GetRequest(ctx context.Context, tenantID, id string) (*domain.ApprovalRequest, error) {
+	req, ok := s.requests[id]
+	if !ok || req.TenantID != tenantID {
+		return nil, repository.ErrApprovalRequestNotFound
+	}
+	return &req, nil
+}
+
+func (s *fakeStore) FindPending(ctx context.Context, tenantID, subjectType, subjectID string) (*domain.ApprovalRequest, error) {
+	for _, req := range s.requests {
+		if req.TenantID == tenantID && req.SubjectType == subjectType && req.SubjectID == subjectID && req.Status == domain.ApprovalPending {
+			return &req, nil
+		}
+	}
+	return nil, repository.ErrApprovalRequestNotFound
+}
+
+func (s *fakeStore) UpdateRequest(ctx context.Context, req *domain.ApprovalRequest) error {
+	if s.requests[req.ID].Version != req.Version {
+		return repository.ErrConcurrencyConflict
+	}
+	req.Version++
+	s.requests[req.ID] = *req
+	return nil
+}
+
+func (s *fakeStore) ListRequests(ctx context.Context, tenantID string, f repository.ApprovalRequestFilter, limit int64) ([]domain.ApprovalRequest, error) {
+	var requests []domain.ApprovalRequest
+	for _, req := range s.requests {
+		if req.TenantID != tenantID || (f.Status != "" && req.Status != f.Status) {
+			continue
+		}
+		if f.Participant != "" && req.RequestedBy != f.Participant && !decided(&req, f.Participant) {
+			continue
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+func decided(req *domain.ApprovalRequest, userID string) bool {
+	for _, d := range req.Decisions {
+		if d.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeStore) Inbox(ctx context.Context, tenantID, userID string, roles []string, limit int64) ([]domain.ApprovalRequest, error) {
+	var requests []domain.ApprovalRequest
+	for _, req := range s.requests {
+		if req.TenantID == tenantID && req.CanDecide(userID, roles) {
+			requests = append(requests, req)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].CreatedAt.Before(requests[j].CreatedAt) })
+	return requests, nil
+}
+
+func (s *fakeStore) DueForEscalation(ctx context.Context, now time.Time, limit int64) ([]domain.ApprovalRequest, error) {
+	var requests []domain.ApprovalRequest
+	for _, req := range s.requests {
+		if req.Status == domain.ApprovalPending && req.EscalateAt != nil && !req.EscalateAt.After(now) {
+			requests = append(requests, req)
+		}
+	}
+	return requests, nil
+}
+
+type recordingPublisher struct {
+	events []*events.EventEnvelope
+}
+
+func (p *recordingPublisher) PublishEvent(ctx context.Context, event *events.EventEnvelope) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *recordingPublisher) types() []string {
+	var types []string
+	for _, event := range p.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func newTestEngine(t *testing.T) (*Engine, *recordingPublisher) {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "error", Format: "json"})
+	require.NoError(t, err)
+	store := &fakeStore{workflows: map[string]domain.ApprovalWorkflow{}, requests: map[string]domain.ApprovalRequest{}}
+	publisher := &recordingPublisher{}
+	engine := newEngine(store, publisher, log)
+	require.NoError(t, engine.PutWorkflow(context.Background(), "admin", &domain.ApprovalWorkflow{
+		TenantID:    tenantID,
+		SubjectType: "payout",
+		Steps: []domain.ApprovalStep{
+			{Name: "Manager", ApproverRoles: []string{"manager"}, EscalateAfterHours: 8, EscalateToUsers: []string{"cfo"}},
+			{Name: "Treasury", ApproverUsers: []string{"treasurer"}, MinAmount: 5000},
+		},
+	}, 0))
+	publisher.events = nil
+	return engine, publisher
+}
+
+func TestRequestThroughSteps(t *testing.T) {
+	engine, publisher := newTestEngine(t)
+	ctx := context.Background()
+
+	req, err := engine.Request(ctx, tenantID, "clerk", Submission{SubjectType: "payout", SubjectID: "po-1", Amount: 7000, Currency: "eur"})
+	require.NoError(t, err)
+	require.Len(t, req.Steps, 2)
+
+	_, err = engine.Request(ctx, tenantID, "clerk", Submission{SubjectType: "payout", SubjectID: "po-1", Amount: 7000})
+	assert.True(t, apperr.Is(err, apperr.CodeConflict), "a subject has one pending request")
+
+	inbox, err := engine.Inbox(ctx, tenantID, "boss", []string{"manager"})
+	require.NoError(t, err)
+	assert.Len(t, inbox, 1)
+	inbox, err = engine.Inbox(ctx, tenantID, "treasurer", nil)
+	require.NoError(t, err)
+	assert.Empty(t, inbox, "the treasury step is not current yet")
+
+	_, err = engine.Approve(ctx, tenantID, "treasurer", nil, req.ID, "")
+	assert.True(t, apperr.Is(err, apperr.CodeForbidden))
+	_, err = engine.Approve(ctx, tenantID, "boss", []string{"manager"}, req.ID, "fine")
+	require.NoError(t, err)
+	_, err = engine.Reject(ctx, tenantID, "treasurer", nil, req.ID, "")
+	assert.True(t, apperr.Is(err, apperr.CodeInvalidArgument), "a rejection needs a reason")
+	req, err = engine.Approve(ctx, tenantID, "treasurer", nil, req.ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, domain.ApprovalApproved, req.Status)
+
+	_, err = engine.Approve(ctx, tenantID, "treasurer", nil, req.ID, "")
+	assert.True(t, apperr.Is(err, apperr.CodeConflict))
+
+	assert.Equal(t, []string{"approval.created", "approval.step_approved", "approval.step_approved", "approval.approved"}, publisher.types())
+	assert.Equal(t, "po-1", publisher.events[3].Data["subjectId"])
+	assert.Equal(t, "treasurer", publisher.events[3].UserID)
+}
+
+func TestRequestWithoutWorkflowIsApproved(t *testing.T) {
+	engine, publisher := newTestEngine(t)
+
+	req, err := engine.Request(context.Background(), tenantID, "clerk", Submission{SubjectType: "stock_adjustment", SubjectID: "adj-1"})
+	require.NoError(t, err)
+	assert.Equal(t, domain.ApprovalApproved, req.Status)
+	assert.Equal(t, []string{"approval.created", "approval.approved"}, publisher.types())
+
+	_, err = engine.Request(context.Background(), tenantID, "clerk", Submission{SubjectType: "Stock Adjustment", SubjectID: "adj-1"})
+	assert.True(t, apperr.Is(err, apperr.CodeInvalidArgument))
+}
+
+func TestHandleEvent(t *testing.T) {
+	engine, publisher := newTestEngine(t)
+	ctx := context.Background()
+
+	requested := events.NewEvent("po-2", "Payout", EventRequested, tenantID, "clerk", map[string]interface{}{
+		"subjectType": "payout", "subjectId": "po-2", "amount": float64(100), "currency": "EUR",
+	})
+	require.NoError(t, engine.HandleEvent(ctx, requested))
+	require.NoError(t, engine.HandleEvent(ctx, requested), "a redelivered request is ignored")
+	assert.Equal(t, []string{"approval.created"}, publisher.types())
+
+	withdrawn := events.NewEvent("po-2", "Payout", EventWithdrawn, tenantID, "clerk", map[string]interface{}{
+		"subjectType": "payout", "subjectId": "po-2", "reason": "payout deleted",
+	})
+	require.NoError(t, engine.HandleEvent(ctx, withdrawn))
+	require.NoError(t, engine.HandleEvent(ctx, withdrawn))
+	assert.Equal(t, []string{"approval.created", "approval.cancelled"}, publisher.types())
+	assert.Equal(t, "cancelled", publisher.events[1].Data["status"])
+}
+
+func TestEscalateOnce(t *testing.T) {
+	engine, publisher := newTestEngine(t)
+	ctx := context.Background()
+	start := time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return start }
+
+	req, err := engine.Request(ctx, tenantID, "clerk", Submission{SubjectType: "payout", SubjectID: "po-3", Amount: 100})
+	require.NoError(t, err)
+
+	engine.now = func() time.Time { return start.Add(7 * time.Hour) }
+	require.NoError(t, engine.EscalateOnce(ctx))
+	inbox, err := engine.Inbox(ctx, tenantID, "cfo", nil)
+	require.NoError(t, err)
+	assert.Empty(t, inbox)
+
+	engine.now = func() time.Time { return start.Add(8 * time.Hour) }
+	require.NoError(t, engine.EscalateOnce(ctx))
+	inbox, err = engine.Inbox(ctx, tenantID, "cfo", nil)
+	require.NoError(t, err)
+	require.Len(t, inbox, 1)
+	assert.Equal(t, req.ID, inbox[0].ID)
+	assert.Equal(t, "approval.escalated", publisher.events[len(publisher.events)-1].Type)
+
+	require.NoError(t, engine.EscalateOnce(ctx))
+	assert.Len(t, publisher.events, 2, "a step escalates once")
+}
+
+func TestHandler(t *testing.T) {
+	engine, _ := newTestEngine(t)
+	handler := engine.Handler("/api/v1/approvals")
+
+	serve := func(method, path, body, userID string, roles []string, permissions ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		ctx := middleware.WithIdentity(req.Context(), tenantID, userID, permissions)
+		req = req.WithContext(middleware.WithRoles(ctx, roles))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	workflow := `{"steps":[{"name":"Lead","approverRoles":["lead"]}]}`
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/v1/approvals/workflows/invoice", workflow, "clerk", nil).Code)
+	rec := serve(http.MethodPut, "/api/v1/approvals/workflows/invoice", workflow, "admin", nil, AdminPermission)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/api/v1/approvals/workflows/invoice", `{"steps":[]}`, "admin", nil, AdminPermission).Code)
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/api/v1/approvals", `{"subjectType":"invoice","subjectId":"inv-1"}`, "clerk", nil).Code)
+	rec = serve(http.MethodPost, "/api/v1/approvals", `{"subjectType":"invoice","subjectId":"inv-1","amount":120}`, "clerk", nil, RequestPermission)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	pending, err := engine.store.FindPending(context.Background(), tenantID, "invoice", "inv-1")
+	require.NoError(t, err)
+	id := pending.ID
+
+	rec = serve(http.MethodGet, "/api/v1/approvals/inbox", "", "lead-1", []string{"lead"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), id)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/v1/approvals/"+id, "", "stranger", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/approvals/"+id, "", "auditor", nil, ReadPermission).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/approvals/"+id, "", "lead-1", []string{"lead"}).Code)
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/api/v1/approvals/"+id+"/approve", "", "clerk", []string{"lead"}).Code, "requesters do not decide their own requests")
+	rec = serve(http.MethodPost, "/api/v1/approvals/"+id+"/approve", `{"comment":"ok"}`, "lead-1", []string{"lead"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"approved"`)
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/api/v1/approvals/"+id+"/cancel", "", "clerk", nil).Code)
+
+	rec = serve(http.MethodGet, "/api/v1/approvals?status=approved", "", "lead-1", nil)
+	assert.Contains(t, rec.Body.String(), id, "deciders see the requests they decided")
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/api/v1/approvals/"+id+"/delegate", "", "lead-1", nil).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, "/api/v1/approvals/"+id, "", "lead-1", nil).Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/v1/approvals/workflows/invoice", "", "admin", nil, AdminPermission).Code)
+}
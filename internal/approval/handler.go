@@ -0,0 +1,219 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/internal/repository"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// decisionRequest is the body of approve, reject and cancel requests.
+type decisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+// Handler serves approvals under prefix, such as /api/v1/approvals:
+//
+//	GET    prefix                          requests, newest first; ?status, ?subjectType, ?subjectId
+//	POST   prefix                          submit a subject (needs "approval:request")
+//	GET    prefix/inbox                    pending requests the caller may decide
+//	GET    prefix/{id}                     one request with its decisions
+//	POST   prefix/{id}/approve             approve the current step: {"comment": "..."}
+//	POST   prefix/{id}/reject              reject, with a comment giving the reason
+//	POST   prefix/{id}/cancel              withdraw a pending request
+//	GET    prefix/workflows                the tenant's workflows
+//	GET    prefix/workflows/{subjectType}  one workflow, with its version as ETag
+//	PUT    prefix/workflows/{subjectType}  replace a workflow; honors If-Match
+//	DELETE prefix/workflows/{subjectType}  remove a workflow
+//
+// Workflows need "approval:admin" to change. Callers without
+// "approval:read" only see the requests they take part in.
+func (e *Engine) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		var parts []string
+		if path != "" {
+			parts = strings.Split(path, "/")
+		}
+		if len(parts) > 0 && parts[0] == "workflows" {
+			e.serveWorkflows(w, r, parts[1:])
+			return
+		}
+
+		ctx := r.Context()
+		tenantID := middleware.GetTenantID(ctx)
+		userID := middleware.GetUserID(ctx)
+		roles := middleware.GetRoles(ctx)
+		permissions := middleware.GetPermissions(ctx)
+
+		switch {
+		case len(parts) == 0 && r.Method == http.MethodGet:
+			q := r.URL.Query()
+			requests, err := e.List(ctx, tenantID, userID, permissions, repository.ApprovalRequestFilter{
+				Status:      domain.ApprovalStatus(q.Get("status")),
+				SubjectType: q.Get("subjectType"),
+				SubjectID:   q.Get("subjectId"),
+			})
+			if err != nil {
+				e.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": requests})
+
+		case len(parts) == 0 && r.Method == http.MethodPost:
+			if !authorize(w, r, RequestPermission) {
+				return
+			}
+			var body Submission
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&body); err != nil {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			req, err := e.Request(ctx, tenantID, userID, body)
+			if err != nil {
+				e.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusCreated, req)
+
+		case len(parts) == 1 && parts[0] == "inbox" && r.Method == http.MethodGet:
+			requests, err := e.Inbox(ctx, tenantID, userID, roles)
+			if err != nil {
+				e.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": requests})
+
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			req, err := e.Get(ctx, tenantID, userID, roles, permissions, parts[0])
+			if err != nil {
+				e.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, req)
+
+		case len(parts) == 2 && r.Method == http.MethodPost:
+			var body decisionRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			var req *domain.ApprovalRequest
+			var err error
+			switch parts[1] {
+			case "approve":
+				req, err = e.Approve(ctx, tenantID, userID, roles, parts[0], body.Comment)
+			case "reject":
+				req, err = e.Reject(ctx, tenantID, userID, roles, parts[0], body.Comment)
+			case "cancel":
+				req, err = e.Cancel(ctx, tenantID, userID, permissions, parts[0], body.Comment)
+			default:
+				httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+				return
+			}
+			if err != nil {
+				e.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, req)
+
+		case len(parts) <= 2:
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+		}
+	})
+}
+
+func (e *Engine) serveWorkflows(w http.ResponseWriter, r *http.Request, parts []string) {
+	ctx := r.Context()
+	tenantID := middleware.GetTenantID(ctx)
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		workflows, err := e.Workflows(ctx, tenantID)
+		if err != nil {
+			e.writeError(w, r, err)
+			return
+		}
+		httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": workflows})
+
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		workflow, err := e.Workflow(ctx, tenantID, parts[0])
+		if err != nil {
+			e.writeError(w, r, err)
+			return
+		}
+		httpresponse.SetETag(w, workflow.Version)
+		httpresponse.JSON(w, http.StatusOK, workflow)
+
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		if !authorize(w, r, AdminPermission) {
+			return
+		}
+		var expected int64
+		if match := r.Header.Get("If-Match"); match != "" {
+			version, ok := httpresponse.ParseETag(match)
+			if !ok {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "If-Match must be an ETag")
+				return
+			}
+			expected = version
+		}
+		var workflow domain.ApprovalWorkflow
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&workflow); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		workflow.TenantID = tenantID
+		workflow.SubjectType = parts[0]
+		if err := e.PutWorkflow(ctx, middleware.GetUserID(ctx), &workflow, expected); err != nil {
+			e.writeError(w, r, err)
+			return
+		}
+		httpresponse.SetETag(w, workflow.Version)
+		httpresponse.JSON(w, http.StatusOK, workflow)
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if !authorize(w, r, AdminPermission) {
+			return
+		}
+		if err := e.DeleteWorkflow(ctx, tenantID, middleware.GetUserID(ctx), parts[0]); err != nil {
+			e.writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) <= 1:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+	}
+}
+
+func authorize(w http.ResponseWriter, r *http.Request, permission string) bool {
+	if rbac.Allows(middleware.GetPermissions(r.Context()), permission) {
+		return true
+	}
+	httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+permission)
+	return false
+}
+
+func (e *Engine) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *apperr.Error
+	if !errors.As(err, &appErr) {
+		e.logger.New(r.Context()).Errorw("Approval request failed", "error", err)
+	}
+	httpresponse.Error(w, r, err)
+}
@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+var errInvalidQuery = errors.New("invalid query")
+
+// ReadPermission lets a user search, export and verify its tenant's audit
+// trail, which includes every user's actions and their payloads.
+const ReadPermission = "audit:read"
+
+// csvHeader lists the exported columns; Data is written as JSON.
+var csvHeader = []string{
+	"sequence", "occurredAt", "recordedAt", "kind", "action", "entityType", "entityId",
+	"userId", "sourceId", "correlationId", "success", "error", "data", "prevHash", "hash",
+}
+
+// Handler serves the audit API under /api/v1/audit:
+//
+//	GET /api/v1/audit/entries?userId=&entityType=&entityId=&action=&from=&to=&before=&limit=
+//	                                   matching entries, newest first
+//	GET /api/v1/audit/export?format=csv|json&...
+//	                                   matching entries in chain order, as CSV or NDJSON
+//	GET /api/v1/audit/verify           check the tenant's whole chain
+//
+// It runs behind the tenant middleware and every request needs "audit:read";
+// from and to are RFC 3339 times.
+func (r *Recorder) Handler() http.Handler {
+	return middleware.RequirePermission(ReadPermission, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/api/v1/audit"), "/")
+		if path != "entries" && path != "export" && path != "verify" {
+			httpresponse.ErrorStatus(w, req, http.StatusNotFound, "not found")
+			return
+		}
+		if req.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, req, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		filter, err := parseFilter(req.URL.Query())
+		if err != nil {
+			httpresponse.ErrorStatus(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.TenantID = middleware.GetTenantID(req.Context())
+
+		switch path {
+		case "entries":
+			if filter.Limit <= 0 || filter.Limit > 500 {
+				filter.Limit = 100
+			}
+			entries, err := r.store.Search(req.Context(), filter)
+			if err != nil {
+				r.writeError(w, req, err)
+				return
+			}
+			response := map[string]interface{}{"data": entries}
+			if int64(len(entries)) == filter.Limit {
+				response["nextBefore"] = entries[len(entries)-1].Sequence
+			}
+			httpresponse.JSON(w, http.StatusOK, response)
+
+		case "export":
+			r.export(w, req, filter)
+
+		case "verify":
+			r.verify(w, req, filter.TenantID)
+		}
+	}))
+}
+
+func parseFilter(query url.Values) (repository.AuditFilter, error) {
+	filter := repository.AuditFilter{
+		UserID:     query.Get("userId"),
+		EntityType: strings.ToLower(query.Get("entityType")),
+		EntityID:   query.Get("entityId"),
+		Action:     query.Get("action"),
+	}
+	var err error
+	if v := query.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("%w: from must be an RFC 3339 time", errInvalidQuery)
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("%w: to must be an RFC 3339 time", errInvalidQuery)
+		}
+	}
+	if v := query.Get("before"); v != "" {
+		if filter.BeforeSequence, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return filter, fmt.Errorf("%w: before must be a sequence number", errInvalidQuery)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return filter, fmt.Errorf("%w: limit must be a number", errInvalidQuery)
+		}
+	}
+	return filter, nil
+}
+
+// export streams the entries. Once the first entry is written the status
+// can no longer change, so a later failure only truncates the file.
+func (r *Recorder) export(w http.ResponseWriter, req *http.Request, filter repository.AuditFilter) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	var (
+		write func(*domain.AuditEntry) error
+		flush func() error
+	)
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		write = func(entry *domain.AuditEntry) error { return cw.Write(csvRecord(entry)) }
+		flush = func() error { cw.Flush(); return cw.Error() }
+		w.Header().Set("Content-Type", "text/csv")
+		cw.Write(csvHeader)
+	case "json":
+		enc := json.NewEncoder(w)
+		write = func(entry *domain.AuditEntry) error { return enc.Encode(entry) }
+		flush = func() error { return nil }
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		httpresponse.ErrorStatus(w, req, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.%s"`, time.Now().UTC().Format("20060102T150405Z"), format))
+
+	err := r.store.Each(req.Context(), filter, write)
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		r.logger.Error("Audit export failed", "error", err, "tenant_id", filter.TenantID)
+	}
+}
+
+func csvRecord(entry *domain.AuditEntry) []string {
+	data := ""
+	if len(entry.Data) > 0 {
+		raw, _ := json.Marshal(entry.Data)
+		data = string(raw)
+	}
+	return []string{
+		strconv.FormatInt(entry.Sequence, 10),
+		entry.OccurredAt.Format(time.RFC3339Nano),
+		entry.RecordedAt.Format(time.RFC3339Nano),
+		entry.Kind,
+		entry.Action,
+		entry.EntityType,
+		entry.EntityID,
+		entry.UserID,
+		entry.SourceID,
+		entry.CorrelationID,
+		strconv.FormatBool(entry.Success),
+		entry.Error,
+		data,
+		entry.PrevHash,
+		entry.Hash,
+	}
+}
+
+// verify walks the tenant's chain from the first entry and reports the first
+// break, if any. The last verified hash lets auditors anchor later checks.
+func (r *Recorder) verify(w http.ResponseWriter, req *http.Request, tenantID string) {
+	var (
+		prev    *domain.AuditEntry
+		checked int64
+	)
+	err := r.store.Each(req.Context(), repository.AuditFilter{TenantID: tenantID}, func(entry *domain.AuditEntry) error {
+		if err := domain.VerifyAuditChain(prev, []domain.AuditEntry{*entry}); err != nil {
+			return err
+		}
+		prev = entry
+		checked++
+		return nil
+	})
+	if err != nil && !errors.Is(err, domain.ErrAuditChainBroken) {
+		r.writeError(w, req, err)
+		return
+	}
+
+	result := map[string]interface{}{"valid": err == nil, "checked": checked}
+	if prev != nil {
+		result["lastVerifiedSequence"] = prev.Sequence
+		result["lastVerifiedHash"] = prev.Hash
+	}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+	httpresponse.JSON(w, http.StatusOK, result)
+}
+
+func (r *Recorder) writeError(w http.ResponseWriter, req *http.Request, err error) {
+	r.logger.Error("Audit request failed", "error", err)
+	httpresponse.ErrorStatus(w, req, http.StatusInternalServerError, "audit service unavailable")
+}
@@ -0,0 +1,29 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_RequiresReadPermission(t *testing.T) {
+	r := &Recorder{}
+	for _, path := range []string{"/api/v1/audit/entries", "/api/v1/audit/export?format=csv", "/api/v1/audit/verify"} {
+		for _, permissions := range [][]string{nil, {"client:read", "invoice:read"}} {
+			ctx := middleware.WithIdentity(context.Background(), "tenant-a", "user-1", permissions)
+			rec := httptest.NewRecorder()
+			r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+			assert.Equal(t, http.StatusForbidden, rec.Code, "%s with %v", path, permissions)
+			assert.Empty(t, rec.Header().Get("Content-Disposition"), "nothing is exported")
+		}
+	}
+
+	ctx := middleware.WithIdentity(context.Background(), "tenant-a", "user-1", []string{ReadPermission})
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/audit/entries?from=yesterday", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "holders of audit:read reach the API")
+}
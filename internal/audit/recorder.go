@@ -0,0 +1,92 @@
+// Package audit keeps the tamper-evident audit log: every domain event and
+// every command outcome becomes an entry in its tenant's hash chain, which
+// auditors can search, export and verify.
+package audit
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+type Recorder struct {
+	store  *repository.AuditStore
+	logger *logger.Logger
+}
+
+func NewRecorder(db *repository.MongoDB, log *logger.Logger) *Recorder {
+	return &Recorder{
+		store:  repository.NewAuditStore(db),
+		logger: log,
+	}
+}
+
+func (r *Recorder) EnsureIndexes(ctx context.Context) error {
+	return r.store.EnsureIndexes(ctx)
+}
+
+// HandleEvent records event. Redelivered events are recorded once.
+func (r *Recorder) HandleEvent(ctx context.Context, event *events.EventEnvelope) error {
+	if event.TenantID == "" {
+		return nil
+	}
+	return r.append(ctx, EntryFromEvent(event))
+}
+
+// HandleCommandOutcome records a handled command, including failed ones that
+// produced no event.
+func (r *Recorder) HandleCommandOutcome(ctx context.Context, outcome *commands.CommandOutcome) error {
+	if outcome.TenantID == "" {
+		return nil
+	}
+	return r.append(ctx, EntryFromCommandOutcome(outcome))
+}
+
+func (r *Recorder) append(ctx context.Context, entry *domain.AuditEntry) error {
+	err := r.store.Append(ctx, entry)
+	if errors.Is(err, repository.ErrAuditEntryExists) {
+		return nil
+	}
+	return err
+}
+
+func EntryFromEvent(event *events.EventEnvelope) *domain.AuditEntry {
+	return &domain.AuditEntry{
+		TenantID:      event.TenantID,
+		Kind:          domain.AuditKindEvent,
+		Action:        event.Type,
+		EntityType:    strings.ToLower(event.AggregateType),
+		EntityID:      event.AggregateID,
+		UserID:        event.UserID,
+		SourceID:      event.ID,
+		CorrelationID: event.CorrelationID,
+		Success:       true,
+		Data:          event.Data,
+		OccurredAt:    event.Timestamp,
+	}
+}
+
+// EntryFromCommandOutcome names the entity after the command's prefix, so
+// "client.update" is about entity type "client".
+func EntryFromCommandOutcome(outcome *commands.CommandOutcome) *domain.AuditEntry {
+	entityType, _, _ := strings.Cut(outcome.Type, ".")
+	return &domain.AuditEntry{
+		TenantID:      outcome.TenantID,
+		Kind:          domain.AuditKindCommand,
+		Action:        outcome.Type,
+		EntityType:    strings.ToLower(entityType),
+		EntityID:      outcome.TargetID,
+		UserID:        outcome.UserID,
+		SourceID:      outcome.CommandID,
+		CorrelationID: outcome.CorrelationID,
+		Success:       outcome.Success,
+		Error:         outcome.Error,
+		OccurredAt:    outcome.Timestamp,
+	}
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryFromEvent(t *testing.T) {
+	event := events.NewEvent("client-1", "Client", "ClientUpdated", "tenant-1", "user-1", map[string]interface{}{"name": "Acme"})
+
+	entry := EntryFromEvent(event)
+	assert.Equal(t, domain.AuditKindEvent, entry.Kind)
+	assert.Equal(t, "ClientUpdated", entry.Action)
+	assert.Equal(t, "client", entry.EntityType)
+	assert.Equal(t, "client-1", entry.EntityID)
+	assert.Equal(t, "user-1", entry.UserID)
+	assert.Equal(t, event.ID, entry.SourceID)
+	assert.True(t, entry.Success)
+	assert.Equal(t, "Acme", entry.Data["name"])
+}
+
+func TestEntryFromCommandOutcome(t *testing.T) {
+	cmd := commands.NewCommand("client.assign_credit_limit", "tenant-1", "client-1", "user-1", nil)
+	outcome := commands.NewCommandOutcome(cmd, errors.New("version conflict"), time.Millisecond)
+
+	entry := EntryFromCommandOutcome(outcome)
+	assert.Equal(t, domain.AuditKindCommand, entry.Kind)
+	assert.Equal(t, "client.assign_credit_limit", entry.Action)
+	assert.Equal(t, "client", entry.EntityType)
+	assert.Equal(t, "client-1", entry.EntityID)
+	assert.Equal(t, cmd.ID, entry.SourceID)
+	assert.False(t, entry.Success)
+	assert.Equal(t, "version conflict", entry.Error)
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := parseFilter(url.Values{
+		"userId":     {"user-1"},
+		"entityType": {"Invoice"},
+		"from":       {"2026-01-01T00:00:00Z"},
+		"before":     {"42"},
+		"limit":      {"10"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", filter.UserID)
+	assert.Equal(t, "invoice", filter.EntityType)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), filter.From)
+	assert.True(t, filter.To.IsZero())
+	assert.Equal(t, int64(42), filter.BeforeSequence)
+	assert.Equal(t, int64(10), filter.Limit)
+
+	_, err = parseFilter(url.Values{"to": {"yesterday"}})
+	assert.True(t, errors.Is(err, errInvalidQuery))
+}
+
+func TestCSVRecord(t *testing.T) {
+	entry := &domain.AuditEntry{
+		Sequence: 7,
+		Kind:     domain.AuditKindEvent,
+		Action:   "invoice.sent",
+		Success:  true,
+		Data:     map[string]interface{}{"total": "10.00"},
+		PrevHash: "prev",
+		Hash:     "hash",
+	}
+
+	record := csvRecord(entry)
+	require.Len(t, record, len(csvHeader))
+	assert.Equal(t, "7", record[0])
+	assert.Equal(t, `{"total":"10.00"}`, record[12])
+	assert.Equal(t, "hash", record[len(record)-1])
+}
@@ -21,6 +21,7 @@ type AuthService struct {
 	tokenService   *TokenService
 	sessionService *SessionService
 	rateLimiter    RateLimiter
+	flags          FeatureFlags
 	logger         *logger.Logger
 	config         *config.AuthConfig
 }
@@ -37,6 +38,15 @@ type RateLimiter interface {
 	Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, int, error)
 }
 
+// FeatureFlags reports the features turned on for a tenant.
+type FeatureFlags interface {
+	Enabled(ctx context.Context, tenantID, flag string) bool
+}
+
+// mfaEnforcementFlag is featureflag.MFAEnforcement, which this package
+// cannot import: featureflag depends on middleware, which depends on auth.
+const mfaEnforcementFlag = "mfa_enforcement"
+
 type RegisterRequest struct {
 	Email     string
 	Password  string
@@ -56,6 +66,10 @@ type LoginResponse struct {
 	User      *domain.User `json:"user"`
 	Tokens    *TokenPair   `json:"tokens"`
 	SessionID string       `json:"sessionId"`
+	// MFASetupRequired is set when the tenant enforces multi-factor
+	// authentication and the user has not enabled it yet; clients must
+	// send the user through MFA setup before anything else.
+	MFASetupRequired bool `json:"mfaSetupRequired,omitempty"`
 }
 
 func NewAuthService(
@@ -63,6 +77,7 @@ func NewAuthService(
 	tokenService *TokenService,
 	sessionService *SessionService,
 	rateLimiter RateLimiter,
+	flags FeatureFlags,
 	cfg *config.AuthConfig,
 	log *logger.Logger,
 ) *AuthService {
@@ -71,6 +86,7 @@ func NewAuthService(
 		tokenService:   tokenService,
 		sessionService: sessionService,
 		rateLimiter:    rateLimiter,
+		flags:          flags,
 		logger:         log,
 		config:         cfg,
 	}
@@ -182,9 +198,10 @@ func (s *AuthService) Login(ctx context.Context, tenantID, requestID string, req
 	)
 
 	return &LoginResponse{
-		User:      user,
-		Tokens:    tokenPair,
-		SessionID: session.SessionID,
+		User:             user,
+		Tokens:           tokenPair,
+		SessionID:        session.SessionID,
+		MFASetupRequired: !user.MFAEnabled && s.flags != nil && s.flags.Enabled(ctx, tenantID, mfaEnforcementFlag),
 	}, nil
 }
 
@@ -420,6 +437,8 @@ func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 			"status":        string(user.Status),
 			"tenantRole":    user.TenantRole,
 			"permissions":   user.Permissions,
+			"datascope":     user.DataScope,
+			"territories":   user.Territories,
 			"mfaEnabled":    user.MFAEnabled,
 			"lastLoginAt":   user.LastLoginAt,
 			"loginAttempts": user.LoginAttempts,
@@ -546,6 +565,16 @@ func mapToUser(data bson.M) (*domain.User, error) {
 			}
 		}
 	}
+	if dataScope, ok := data["datascope"].(string); ok {
+		user.DataScope = dataScope
+	}
+	if territories, ok := data["territories"].([]interface{}); ok {
+		for _, t := range territories {
+			if s, ok := t.(string); ok {
+				user.Territories = append(user.Territories, s)
+			}
+		}
+	}
 	if mfaEnabled, ok := data["mfaenabled"].(bool); ok {
 		user.MFAEnabled = mfaEnabled
 	}
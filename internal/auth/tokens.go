@@ -32,6 +32,10 @@ type TokenClaims struct {
 	Role        string   `json:"role"`
 	TenantRole  string   `json:"tenantRole"`
 	Permissions []string `json:"permissions"`
+	// DataScope and Territories restrict which records the user may read;
+	// see domain.Visibility.
+	DataScope   string   `json:"dataScope,omitempty"`
+	Territories []string `json:"territories,omitempty"`
 }
 
 type TokenPair struct {
@@ -92,6 +96,8 @@ func (s *JWTService) GenerateAccessToken(user *domain.User) (string, time.Time,
 		Role:        user.Role,
 		TenantRole:  user.TenantRole,
 		Permissions: user.Permissions,
+		DataScope:   user.DataScope,
+		Territories: user.Territories,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -332,3 +338,12 @@ func ExtractTokenFromHeader(authHeader string) (string, error) {
 
 	return parts[1], nil
 }
+
+// NewTokenValidator returns a JWTService for services that only validate
+// access tokens issued by the auth service.
+func NewTokenValidator(cfg *config.AuthConfig, log *logger.Logger) (*JWTService, error) {
+	if cfg.JWT_SECRET == "" {
+		return nil, fmt.Errorf("auth.jwt_secret is required to validate access tokens")
+	}
+	return NewJWTService(cfg, log), nil
+}
@@ -0,0 +1,331 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FormatVersion is the version of the archives written. Archives of a later
+// version are refused on restore.
+const FormatVersion = 1
+
+const (
+	manifestName     = "manifest.json"
+	documentsName    = "documents.jsonl"
+	collectionPrefix = "collections/"
+)
+
+var (
+	ErrInvalidArchive     = errors.New("invalid backup archive")
+	ErrUnsupportedVersion = errors.New("unsupported backup format version")
+)
+
+var collectionName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Manifest describes an archive. It is the archive's first entry.
+type Manifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	TenantID      string    `json:"tenantId"`
+	Environment   string    `json:"environment,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// Collections lists the collections the archive holds documents of.
+	Collections []CollectionEntry `json:"collections"`
+	// Documents counts the stored files listed in documents.jsonl. Their
+	// content stays in object storage and is not part of the archive.
+	Documents int64 `json:"documents"`
+}
+
+// CollectionEntry is one collection of an archive, with the SHA-256 of its
+// collections/{name}.jsonl entry.
+type CollectionEntry struct {
+	Name      string `json:"name"`
+	Documents int64  `json:"documents"`
+	SHA256    string `json:"sha256"`
+}
+
+// DocumentFile is one stored file of the tenant, listed so the objects can
+// be copied along with the archive.
+type DocumentFile struct {
+	ID        string `json:"id" bson:"_id"`
+	FileName  string `json:"fileName" bson:"fileName"`
+	Bucket    string `json:"bucket" bson:"bucket"`
+	ObjectKey string `json:"objectKey" bson:"objectKey"`
+	VersionID string `json:"versionId,omitempty" bson:"versionId"`
+	Size      int64  `json:"size" bson:"size"`
+	Checksum  string `json:"checksum,omitempty" bson:"checksum"`
+}
+
+// spool collects the documents of each collection in temporary files, in
+// MongoDB Extended JSON one per line so UUIDs, dates and decimals keep their
+// types, until the archive is written.
+type spool struct {
+	dir   string
+	files map[string]*spoolFile
+}
+
+type spoolFile struct {
+	file  *os.File
+	buf   *bufio.Writer
+	hash  hash.Hash
+	count int64
+}
+
+func newSpool() (*spool, error) {
+	dir, err := os.MkdirTemp("", "tenant-backup-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return &spool{dir: dir, files: map[string]*spoolFile{}}, nil
+}
+
+// Close removes the spooled files.
+func (s *spool) Close() error {
+	for _, f := range s.files {
+		f.file.Close()
+	}
+	return os.RemoveAll(s.dir)
+}
+
+func (s *spool) add(name string, line []byte) error {
+	f, ok := s.files[name]
+	if !ok {
+		file, err := os.Create(filepath.Join(s.dir, strconv.Itoa(len(s.files))+".jsonl"))
+		if err != nil {
+			return fmt.Errorf("failed to spool %s: %w", name, err)
+		}
+		f = &spoolFile{file: file, hash: sha256.New()}
+		f.buf = bufio.NewWriter(io.MultiWriter(file, f.hash))
+		s.files[name] = f
+	}
+	if _, err := f.buf.Write(line); err != nil {
+		return err
+	}
+	if err := f.buf.WriteByte('\n'); err != nil {
+		return err
+	}
+	f.count++
+	return nil
+}
+
+// addDocument spools doc, a document of collection name.
+func (s *spool) addDocument(name string, doc bson.Raw) error {
+	line, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s document: %w", name, err)
+	}
+	return s.add(collectionPrefix+name+".jsonl", line)
+}
+
+func (s *spool) addFile(file DocumentFile) error {
+	line, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return s.add(documentsName, line)
+}
+
+// writeTo writes manifest, completed with the spooled collections, and the
+// spooled files to w as a gzipped tar archive.
+func (s *spool) writeTo(w io.Writer, manifest *Manifest) error {
+	names := make([]string, 0, len(s.files))
+	for name, f := range s.files {
+		if err := f.buf.Flush(); err != nil {
+			return fmt.Errorf("failed to spool %s: %w", name, err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manifest.FormatVersion = FormatVersion
+	manifest.Collections = []CollectionEntry{}
+	manifest.Documents = 0
+	for _, name := range names {
+		f := s.files[name]
+		if name == documentsName {
+			manifest.Documents = f.count
+			continue
+		}
+		manifest.Collections = append(manifest.Collections, CollectionEntry{
+			Name:      strings.TrimSuffix(strings.TrimPrefix(name, collectionPrefix), ".jsonl"),
+			Documents: f.count,
+			SHA256:    hex.EncodeToString(f.hash.Sum(nil)),
+		})
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	header, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(tw, manifestName, int64(len(header)), manifest.CreatedAt, bytes.NewReader(header)); err != nil {
+		return err
+	}
+	for _, name := range names {
+		f := s.files[name]
+		info, err := f.file.Stat()
+		if err != nil {
+			return err
+		}
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := writeEntry(tw, name, info.Size(), manifest.CreatedAt, f.file); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: size, ModTime: modTime}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// extracted is an archive unpacked to temporary files, each collection
+// checked against the manifest.
+type extracted struct {
+	dir      string
+	manifest Manifest
+}
+
+// extract unpacks the archive in r and checks it against its manifest.
+func extract(r io.Reader) (*extracted, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestName {
+		return nil, fmt.Errorf("%w: %s must be the first entry", ErrInvalidArchive, manifestName)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("%w: %d; this build reads up to %d", ErrUnsupportedVersion, manifest.FormatVersion, FormatVersion)
+	}
+	if manifest.TenantID == "" {
+		return nil, fmt.Errorf("%w: the manifest names no tenant", ErrInvalidArchive)
+	}
+	expected := make(map[string]CollectionEntry, len(manifest.Collections))
+	for _, c := range manifest.Collections {
+		if !collectionName.MatchString(c.Name) {
+			return nil, fmt.Errorf("%w: invalid collection name %q", ErrInvalidArchive, c.Name)
+		}
+		expected[collectionPrefix+c.Name+".jsonl"] = c
+	}
+
+	dir, err := os.MkdirTemp("", "tenant-restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create restore directory: %w", err)
+	}
+	x := &extracted{dir: dir, manifest: manifest}
+	seen := map[string]bool{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			x.Close()
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		entry, known := expected[header.Name]
+		if header.Name == documentsName {
+			continue
+		}
+		if !known || seen[header.Name] {
+			x.Close()
+			return nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidArchive, header.Name)
+		}
+		seen[header.Name] = true
+		if err := x.save(entry, tr); err != nil {
+			x.Close()
+			return nil, err
+		}
+	}
+	for name := range expected {
+		if !seen[name] {
+			x.Close()
+			return nil, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, name)
+		}
+	}
+	return x, nil
+}
+
+func (x *extracted) save(entry CollectionEntry, r io.Reader) error {
+	file, err := os.Create(x.path(entry.Name))
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", entry.Name, err)
+	}
+	defer file.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, sum), r); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if hex.EncodeToString(sum.Sum(nil)) != entry.SHA256 {
+		return fmt.Errorf("%w: checksum mismatch in %s", ErrInvalidArchive, entry.Name)
+	}
+	return nil
+}
+
+func (x *extracted) path(collection string) string {
+	return filepath.Join(x.dir, collection+".jsonl")
+}
+
+// each calls fn with every document of collection.
+func (x *extracted) each(collection string, fn func(doc bson.D) error) error {
+	file, err := os.Open(x.path(collection))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for scanner.Scan() {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, collection, err)
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Close removes the extracted files.
+func (x *extracted) Close() error {
+	return os.RemoveAll(x.dir)
+}
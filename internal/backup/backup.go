@@ -0,0 +1,473 @@
+// Package backup archives the complete dataset of a tenant, for safekeeping
+// and to move a tenant between environments. An archive is a gzipped tar of
+// every document the tenant owns in MongoDB, aggregates, read models and
+// event store alike, one collection per entry in MongoDB Extended JSON, with
+// a manifest of counts and checksums and a list of the tenant's stored
+// files. The files themselves stay in object storage.
+//
+// Backups run on demand through the API or on a schedule and are uploaded
+// to MinIO. Restores read an archive from disk through the migrate CLI; they
+// are deliberately not offered over HTTP.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/export"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrBackupRunning is returned when a tenant's previous backup has not
+	// finished yet.
+	ErrBackupRunning = errors.New("a backup of this tenant is already running")
+	// ErrNotReady is returned for the download of an unfinished backup.
+	ErrNotReady = errors.New("backup is not ready")
+	// ErrTenantExists is returned by Restore when the tenant already has
+	// data and replacing it was not asked for.
+	ErrTenantExists = errors.New("tenant already has data")
+)
+
+// tenantFields are the fields documents name their tenant in, depending on
+// how their type was tagged.
+var tenantFields = []string{"tenantId", "tenantid", "tenant_id"}
+
+// skipped are operational collections: migrations, locks, job queues and
+// delivery bookkeeping, which belong to no tenant's dataset.
+var skipped = map[string]bool{
+	"schema_migrations": true,
+	"job_locks":         true,
+	"job_runs":          true,
+	"export_jobs":       true,
+	"replay_jobs":       true,
+	"command_jobs":      true,
+	"processed_events":  true,
+	"outbox":            true,
+	"resumable_uploads": true,
+	"tenant_backups":    true,
+}
+
+// runningFor is how long a backup may run before another one of the same
+// tenant is allowed, in case the replica running it died.
+const runningFor = 6 * time.Hour
+
+const insertBatch = 500
+
+// Backups takes, lists and restores tenant backups.
+type Backups struct {
+	db          *repository.MongoDB
+	backups     *repository.TenantBackupStore
+	files       export.Storage
+	cfg         config.BackupConfig
+	environment string
+	logger      *logger.Logger
+}
+
+// New returns backups of the tenants in db, uploaded to files. environment
+// is recorded in each manifest. files may be nil when only Dump and Restore
+// are used.
+func New(db *repository.MongoDB, files export.Storage, cfg config.BackupConfig, environment string, log *logger.Logger) *Backups {
+	return &Backups{
+		db:          db,
+		backups:     repository.NewTenantBackupStore(db),
+		files:       files,
+		cfg:         cfg,
+		environment: environment,
+		logger:      log,
+	}
+}
+
+// Setup creates the backup indexes and bucket.
+func (b *Backups) Setup(ctx context.Context) error {
+	if err := b.backups.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	exists, err := b.files.BucketExists(ctx, b.cfg.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return b.files.CreateBucket(ctx, b.cfg.Bucket)
+	}
+	return nil
+}
+
+// Start backs up tenantID in the background on behalf of userID and returns
+// the running backup.
+func (b *Backups) Start(ctx context.Context, tenantID, userID string) (*repository.TenantBackup, error) {
+	backup, err := b.create(ctx, tenantID, userID, repository.BackupTriggerManual)
+	if err != nil {
+		return nil, err
+	}
+	go b.run(context.Background(), backup)
+	return backup, nil
+}
+
+// BackupOnce backs up the tenants of the schedule one after another, then
+// deletes archives past their retention. A failing tenant does not stop the
+// others; the failures are returned together.
+func (b *Backups) BackupOnce(ctx context.Context) error {
+	tenants, err := b.scheduledTenants(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, tenantID := range tenants {
+		backup, err := b.create(ctx, tenantID, "", repository.BackupTriggerScheduled)
+		if errors.Is(err, ErrBackupRunning) {
+			continue
+		}
+		if err == nil {
+			err = b.run(ctx, backup)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenantID, err))
+		}
+	}
+	if err := b.PurgeOnce(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// PurgeOnce deletes backups older than the configured retention.
+func (b *Backups) PurgeOnce(ctx context.Context) error {
+	if b.cfg.Retention <= 0 {
+		return nil
+	}
+	expired, err := b.backups.CreatedBefore(ctx, time.Now().UTC().Add(-b.cfg.Retention))
+	if err != nil {
+		return err
+	}
+	for _, backup := range expired {
+		if backup.Status == repository.BackupStatusRunning {
+			continue
+		}
+		if backup.ObjectKey != "" {
+			if err := b.files.Delete(ctx, backup.Bucket, backup.ObjectKey); err != nil {
+				b.logger.Warn("Failed to delete expired backup archive", "backup_id", backup.ID, "error", err)
+				continue
+			}
+		}
+		if err := b.backups.Delete(ctx, backup.ID); err != nil {
+			b.logger.Warn("Failed to delete expired backup", "backup_id", backup.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// List returns the recent backups of tenantID, newest first.
+func (b *Backups) List(ctx context.Context, tenantID string, limit int64) ([]repository.TenantBackup, error) {
+	return b.backups.List(ctx, tenantID, limit)
+}
+
+// Get returns a backup of tenantID.
+func (b *Backups) Get(ctx context.Context, tenantID, id string) (*repository.TenantBackup, error) {
+	return b.backups.Get(ctx, tenantID, id)
+}
+
+// Download returns a link to the archive of a completed backup.
+func (b *Backups) Download(ctx context.Context, backup *repository.TenantBackup) (*export.Download, error) {
+	if backup.Status != repository.BackupStatusCompleted {
+		return nil, fmt.Errorf("%w: the backup is %s", ErrNotReady, backup.Status)
+	}
+	url, err := b.files.GetPresignedDownloadURL(ctx, backup.Bucket, backup.ObjectKey, b.cfg.LinkExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return &export.Download{
+		URL:       url,
+		FileName:  backup.ObjectKey[strings.LastIndex(backup.ObjectKey, "/")+1:],
+		ExpiresAt: time.Now().UTC().Add(b.cfg.LinkExpiry),
+	}, nil
+}
+
+func (b *Backups) create(ctx context.Context, tenantID, userID, trigger string) (*repository.TenantBackup, error) {
+	running, err := b.backups.Running(ctx, tenantID, time.Now().UTC().Add(-runningFor))
+	if err != nil {
+		return nil, err
+	}
+	if running {
+		return nil, ErrBackupRunning
+	}
+	backup := &repository.TenantBackup{
+		ID:            uuid.New().String(),
+		TenantID:      tenantID,
+		Trigger:       trigger,
+		RequestedBy:   userID,
+		FormatVersion: FormatVersion,
+	}
+	if err := b.backups.Create(ctx, backup); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+func (b *Backups) run(ctx context.Context, backup *repository.TenantBackup) error {
+	log := b.logger.WithFields(map[string]interface{}{
+		"backup_id": backup.ID,
+		"tenant_id": backup.TenantID,
+		"trigger":   backup.Trigger,
+	})
+	log.Infow("Backup started")
+
+	err := b.upload(ctx, backup)
+	status := repository.BackupStatusCompleted
+	if err != nil {
+		status = repository.BackupStatusFailed
+		backup.LastError = err.Error()
+	}
+	if finishErr := b.backups.Finish(context.Background(), backup, status); finishErr != nil {
+		log.Errorw("Failed to record backup result", "error", finishErr)
+	}
+	if err != nil {
+		log.Errorw("Backup failed", "error", err)
+		return err
+	}
+	log.Infow("Backup finished", "documents", backup.Documents, "size", backup.Size)
+	return nil
+}
+
+func (b *Backups) upload(ctx context.Context, backup *repository.TenantBackup) error {
+	file, err := os.CreateTemp("", "tenant-backup-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	manifest, err := b.Dump(ctx, backup.TenantID, file)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s/%s-%s.tar.gz", backup.TenantID, manifest.CreatedAt.Format("20060102T150405Z"), backup.ID)
+	if err := b.files.UploadFile(ctx, b.cfg.Bucket, key, file.Name(), "application/gzip"); err != nil {
+		return fmt.Errorf("failed to upload backup: %w", err)
+	}
+	backup.Bucket = b.cfg.Bucket
+	backup.ObjectKey = key
+	backup.Size = info.Size()
+	backup.Collections = make(map[string]int64, len(manifest.Collections))
+	backup.Documents = 0
+	for _, c := range manifest.Collections {
+		backup.Collections[c.Name] = c.Documents
+		backup.Documents += c.Documents
+	}
+	return nil
+}
+
+// Dump writes an archive of tenantID's documents in every collection to w.
+func (b *Backups) Dump(ctx context.Context, tenantID string, w io.Writer) (*Manifest, error) {
+	names, err := b.collections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSpool()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	manifest := &Manifest{TenantID: tenantID, Environment: b.environment, CreatedAt: time.Now().UTC()}
+	filter := tenantFilter(tenantID)
+	for _, name := range names {
+		cursor, err := b.db.Collection(name).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(500))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for cursor.Next(ctx) {
+			if err := s.addDocument(name, cursor.Current); err != nil {
+				cursor.Close(ctx)
+				return nil, err
+			}
+			if name == "documents" {
+				if err := addDocumentFile(s, cursor.Current); err != nil {
+					cursor.Close(ctx)
+					return nil, err
+				}
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+	if err := s.writeTo(w, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func addDocumentFile(s *spool, raw bson.Raw) error {
+	var doc struct {
+		DocumentFile `bson:",inline"`
+		ID           interface{} `bson:"_id"`
+	}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("failed to read document: %w", err)
+	}
+	file := doc.DocumentFile
+	file.ID = idString(doc.ID)
+	return s.addFile(file)
+}
+
+// RestoreOptions control Restore.
+type RestoreOptions struct {
+	// Replace deletes the tenant's existing documents first. Without it a
+	// tenant that already has data is not restored.
+	Replace bool
+}
+
+// Restore loads the archive in r into the database. The archive is checked
+// completely before anything is written. Stored files listed in the archive
+// are not copied.
+func (b *Backups) Restore(ctx context.Context, r io.Reader, opts RestoreOptions) (*Manifest, error) {
+	x, err := extract(r)
+	if err != nil {
+		return nil, err
+	}
+	defer x.Close()
+
+	filter := tenantFilter(x.manifest.TenantID)
+	if !opts.Replace {
+		names, err := b.collections(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			n, err := b.db.Collection(name).CountDocuments(ctx, filter, options.Count().SetLimit(1))
+			if err != nil {
+				return nil, fmt.Errorf("failed to check %s: %w", name, err)
+			}
+			if n > 0 {
+				return nil, fmt.Errorf("%w: %s has documents of tenant %s", ErrTenantExists, name, x.manifest.TenantID)
+			}
+		}
+	}
+
+	for _, c := range x.manifest.Collections {
+		collection := b.db.Collection(c.Name)
+		if opts.Replace {
+			if _, err := collection.DeleteMany(ctx, filter); err != nil {
+				return nil, fmt.Errorf("failed to clear %s: %w", c.Name, err)
+			}
+		}
+		batch := make([]interface{}, 0, insertBatch)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if _, err := collection.InsertMany(ctx, batch); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", c.Name, err)
+			}
+			batch = batch[:0]
+			return nil
+		}
+		err := x.each(c.Name, func(doc bson.D) error {
+			batch = append(batch, doc)
+			if len(batch) == insertBatch {
+				return flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			return nil, err
+		}
+		b.logger.Info("Restored collection", "tenant_id", x.manifest.TenantID, "collection", c.Name, "documents", c.Documents)
+	}
+	return &x.manifest, nil
+}
+
+// collections returns the collections that can hold tenant data.
+func (b *Backups) collections(ctx context.Context) ([]string, error) {
+	names, err := b.db.Database().ListCollectionNames(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	return included(names), nil
+}
+
+// included returns the names that are not operational or system
+// collections, sorted.
+func included(names []string) []string {
+	var kept []string
+	for _, name := range names {
+		if !skipped[name] && !strings.HasPrefix(name, "system.") {
+			kept = append(kept, name)
+		}
+	}
+	sort.Strings(kept)
+	return kept
+}
+
+// tenantFilter matches the documents of tenantID whichever field and type,
+// string or UUID, they store it in.
+func tenantFilter(tenantID string) bson.M {
+	values := bson.A{tenantID}
+	if id, err := uuid.Parse(tenantID); err == nil {
+		values = append(values, id)
+	}
+	or := make(bson.A, 0, len(tenantFields))
+	for _, field := range tenantFields {
+		or = append(or, bson.M{field: bson.M{"$in": values}})
+	}
+	return bson.M{"$or": or}
+}
+
+// scheduledTenants returns the configured tenants, or every tenant with
+// users.
+func (b *Backups) scheduledTenants(ctx context.Context) ([]string, error) {
+	if len(b.cfg.Tenants) > 0 {
+		return b.cfg.Tenants, nil
+	}
+	values, err := b.db.Collection("users").Distinct(ctx, "tenantid", bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	var tenants []string
+	for _, v := range values {
+		if id := idString(v); id != "" {
+			tenants = append(tenants, id)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// idString returns an ID read from a document as a string, decoding UUIDs
+// stored as binary.
+func idString(v interface{}) string {
+	switch id := v.(type) {
+	case string:
+		return id
+	case primitive.Binary:
+		if u, err := uuid.FromBytes(id.Data); err == nil {
+			return u.String()
+		}
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
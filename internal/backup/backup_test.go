@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func archive(t *testing.T, tenantID uuid.UUID) []byte {
+	t.Helper()
+	s, err := newSpool()
+	require.NoError(t, err)
+	defer s.Close()
+
+	created := time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC)
+	amount, err := primitive.ParseDecimal128("12.50")
+	require.NoError(t, err)
+	for i, doc := range []bson.M{
+		{"_id": uuid.New(), "tenantId": tenantID, "amount": amount, "createdAt": created},
+		{"_id": uuid.New(), "tenantId": tenantID, "amount": amount, "createdAt": created},
+	} {
+		raw, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		require.NoError(t, s.addDocument("invoices", raw), i)
+	}
+	raw, err := bson.Marshal(bson.M{"_id": uuid.New(), "tenantid": tenantID, "email": "ana@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, s.addDocument("users", raw))
+	require.NoError(t, s.addFile(DocumentFile{ID: "doc-1", Bucket: "documents", ObjectKey: "t/doc-1.pdf", Size: 42}))
+
+	var buf bytes.Buffer
+	manifest := &Manifest{TenantID: tenantID.String(), Environment: "staging", CreatedAt: created}
+	require.NoError(t, s.writeTo(&buf, manifest))
+	assert.Equal(t, int64(1), manifest.Documents)
+	return buf.Bytes()
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	tenantID := uuid.New()
+	x, err := extract(bytes.NewReader(archive(t, tenantID)))
+	require.NoError(t, err)
+	defer x.Close()
+
+	assert.Equal(t, FormatVersion, x.manifest.FormatVersion)
+	assert.Equal(t, tenantID.String(), x.manifest.TenantID)
+	require.Len(t, x.manifest.Collections, 2)
+	assert.Equal(t, "invoices", x.manifest.Collections[0].Name)
+	assert.Equal(t, int64(2), x.manifest.Collections[0].Documents)
+
+	var docs []bson.D
+	require.NoError(t, x.each("invoices", func(doc bson.D) error {
+		docs = append(docs, doc)
+		return nil
+	}))
+	require.Len(t, docs, 2)
+	var invoice struct {
+		TenantID  uuid.UUID            `bson:"tenantId"`
+		Amount    primitive.Decimal128 `bson:"amount"`
+		CreatedAt time.Time            `bson:"createdAt"`
+	}
+	raw, err := bson.Marshal(docs[0])
+	require.NoError(t, err)
+	require.NoError(t, bson.Unmarshal(raw, &invoice))
+	assert.Equal(t, tenantID, invoice.TenantID, "UUIDs keep their binary type")
+	assert.Equal(t, "12.50", invoice.Amount.String())
+	assert.Equal(t, time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC), invoice.CreatedAt.UTC())
+}
+
+// rewrite copies an archive, passing each entry's content through edit.
+func rewrite(t *testing.T, data []byte, edit func(name string, content []byte) []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		content = edit(header.Name, content)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: header.Name, Mode: 0o600, Size: int64(len(content))}))
+		_, err = tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return out.Bytes()
+}
+
+func TestExtractRejectsDamagedArchives(t *testing.T) {
+	data := archive(t, uuid.New())
+
+	tampered := rewrite(t, data, func(name string, content []byte) []byte {
+		if name == "collections/users.jsonl" {
+			return bytes.Replace(content, []byte("ana@"), []byte("eve@"), 1)
+		}
+		return content
+	})
+	_, err := extract(bytes.NewReader(tampered))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+
+	newer := rewrite(t, data, func(name string, content []byte) []byte {
+		if name == manifestName {
+			return bytes.Replace(content, []byte(`"formatVersion": 1`), []byte(`"formatVersion": 2`), 1)
+		}
+		return content
+	})
+	_, err = extract(bytes.NewReader(newer))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	_, err = extract(bytes.NewReader([]byte("not an archive")))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+}
+
+func TestIncluded(t *testing.T) {
+	names := []string{"users", "outbox", "events", "system.views", "job_locks", "client_read"}
+	assert.Equal(t, []string{"client_read", "events", "users"}, included(names))
+}
+
+func TestTenantFilter(t *testing.T) {
+	id := uuid.New()
+	or := tenantFilter(id.String())["$or"].(bson.A)
+	require.Len(t, or, len(tenantFields))
+	assert.Equal(t, bson.M{"tenantId": bson.M{"$in": bson.A{id.String(), id}}}, or[0])
+
+	or = tenantFilter("acme")["$or"].(bson.A)
+	assert.Equal(t, bson.M{"tenantid": bson.M{"$in": bson.A{"acme"}}}, or[1])
+}
+
+func TestIDString(t *testing.T) {
+	id := uuid.New()
+	assert.Equal(t, id.String(), idString(primitive.Binary{Data: id[:]}))
+	assert.Equal(t, "acme", idString("acme"))
+	assert.Equal(t, "", idString(nil))
+}
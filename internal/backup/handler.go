@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// AdminPermission lets a user back up its tenant and download the archives.
+const AdminPermission = "backup:admin"
+
+// Handler serves the backups of the caller's tenant under prefix, such as
+// /api/v1/backups:
+//
+//	POST prefix                 back up the tenant now
+//	GET  prefix?limit=          recent backups, newest first
+//	GET  prefix/{id}            one backup
+//	GET  prefix/{id}/download   presigned link to the archive
+//
+// Every request needs "backup:admin".
+func (b *Backups) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rbac.Allows(middleware.GetPermissions(r.Context()), AdminPermission) {
+			httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+AdminPermission)
+			return
+		}
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		parts := strings.Split(path, "/")
+		ctx := r.Context()
+		tenantID := middleware.GetTenantID(ctx)
+
+		switch {
+		case path == "" && r.Method == http.MethodPost:
+			backup, err := b.Start(ctx, tenantID, middleware.GetUserID(ctx))
+			if err != nil {
+				b.writeError(w, r, err)
+				return
+			}
+			w.Header().Set("Location", prefix+"/"+backup.ID)
+			httpresponse.JSON(w, http.StatusAccepted, backup)
+
+		case path == "" && r.Method == http.MethodGet:
+			limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+			if limit <= 0 || limit > 200 {
+				limit = 20
+			}
+			backups, err := b.List(ctx, tenantID, limit)
+			if err != nil {
+				b.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": backups})
+
+		case len(parts) == 1 && path != "" && r.Method == http.MethodGet:
+			backup, err := b.Get(ctx, tenantID, parts[0])
+			if err != nil {
+				b.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, backup)
+
+		case len(parts) == 2 && parts[1] == "download" && r.Method == http.MethodGet:
+			backup, err := b.Get(ctx, tenantID, parts[0])
+			if err != nil {
+				b.writeError(w, r, err)
+				return
+			}
+			download, err := b.Download(ctx, backup)
+			if err != nil {
+				b.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, download)
+
+		case len(parts) <= 2:
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+		}
+	})
+}
+
+func (b *Backups) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrTenantBackupNotFound):
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "backup not found")
+	case errors.Is(err, ErrBackupRunning), errors.Is(err, ErrNotReady):
+		httpresponse.ErrorStatus(w, r, http.StatusConflict, err.Error())
+	default:
+		b.logger.New(r.Context()).Errorw("Backup request failed", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "backups unavailable")
+	}
+}
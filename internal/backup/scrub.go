@@ -0,0 +1,260 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ims-erp/system/pkg/fieldcrypt"
+	"github.com/ims-erp/system/pkg/masking"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrProduction is returned by Scrub in the production environment.
+var ErrProduction = errors.New("refusing to scrub tenant data in production")
+
+// scrubbed are the fields Scrub replaces, by lower-cased name, since some
+// types are stored with untagged, lower-cased field names. Amounts are kept
+// so that staging still reconciles.
+var scrubbed = map[string]masking.Kind{
+	"firstname":        masking.Name,
+	"lastname":         masking.Name,
+	"fullname":         masking.Name,
+	"clientname":       masking.Name,
+	"contactname":      masking.Name,
+	"counterpartyname": masking.Name,
+	"email":            masking.Email,
+	"contactemail":     masking.Email,
+	"phone":            masking.Number,
+	"contactphone":     masking.Number,
+	"iban":             masking.Number,
+	"counterpartyiban": masking.Number,
+	"recipient":        masking.Text,
+	"street":           masking.Text,
+	"city":             masking.Text,
+	"postalcode":       masking.Text,
+	"customfields":     masking.Text,
+}
+
+// clientNames tells whether "name" is a client's name in a document of
+// collection; elsewhere it names products, warehouses and the like.
+func clientNames(collection string, doc bson.M) bool {
+	return collection == "client_read" || (collection == "events" && doc["aggregateType"] == "Client")
+}
+
+// Scrub anonymizes the personal data of tenantID in place, for a copy of
+// production data restored into staging: names, email addresses, phone
+// numbers, IBANs and addresses are replaced by pseudonyms. Within one run a
+// value always gets the same pseudonym, so a client's name still matches on
+// its invoices; pseudonyms cannot be traced back to the values. Email
+// addresses become addresses at example.invalid, which cannot receive mail.
+//
+// Values encrypted with keyring are opened first and their pseudonyms
+// encrypted and indexed again. It returns the number of documents changed
+// by collection.
+func (b *Backups) Scrub(ctx context.Context, tenantID string, keyring *fieldcrypt.Keyring) (map[string]int64, error) {
+	if b.environment == "production" {
+		return nil, ErrProduction
+	}
+	s, err := newScrubber(keyring)
+	if err != nil {
+		return nil, err
+	}
+	names, err := b.collections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]int64)
+	for _, name := range names {
+		collection := b.db.Collection(name)
+		cursor, err := collection.Find(ctx, tenantFilter(tenantID), options.Find().SetBatchSize(insertBatch))
+		if err != nil {
+			return changed, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err = cursor.Decode(&doc); err != nil {
+				err = fmt.Errorf("failed to decode %s document: %w", name, err)
+				break
+			}
+			var scrubbedDoc bool
+			if scrubbedDoc, err = s.scrub(doc, clientNames(name, doc)); err != nil {
+				err = fmt.Errorf("%s %v: %w", name, doc["_id"], err)
+				break
+			}
+			if !scrubbedDoc {
+				continue
+			}
+			if _, err = collection.ReplaceOne(ctx, bson.M{"_id": doc["_id"]}, doc); err != nil {
+				err = fmt.Errorf("failed to scrub %s %v: %w", name, doc["_id"], err)
+				break
+			}
+			changed[name]++
+		}
+		if err == nil {
+			err = cursor.Err()
+		}
+		cursor.Close(ctx)
+		if err != nil {
+			return changed, err
+		}
+		if changed[name] > 0 {
+			b.logger.Info("Scrubbed collection", "tenant_id", tenantID, "collection", name, "documents", changed[name])
+		}
+	}
+	return changed, nil
+}
+
+// scrubber replaces values by pseudonyms keyed with a random key, so that
+// they are consistent within a run and cannot be reversed by hashing
+// guesses.
+type scrubber struct {
+	key     []byte
+	keyring *fieldcrypt.Keyring
+}
+
+func newScrubber(keyring *fieldcrypt.Keyring) (*scrubber, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate scrub key: %w", err)
+	}
+	return &scrubber{key: key, keyring: keyring}, nil
+}
+
+// scrub replaces the scrubbed fields found anywhere in doc, and "name" too
+// when names is set, and reports whether it changed anything.
+func (s *scrubber) scrub(doc bson.M, names bool) (bool, error) {
+	changed := false
+	var walk func(v interface{}) error
+	field := func(key string, value interface{}) (interface{}, bool, error) {
+		kind, ok := scrubbed[strings.ToLower(key)]
+		if !ok && names && key == "name" {
+			kind, ok = masking.Name, true
+		}
+		if !ok {
+			return value, false, walk(value)
+		}
+		replaced, err := s.replace(kind, value, &changed)
+		return replaced, true, err
+	}
+	walk = func(v interface{}) error {
+		switch v := v.(type) {
+		case bson.M:
+			for key, value := range v {
+				replaced, ok, err := field(key, value)
+				if err != nil {
+					return err
+				}
+				v[key] = replaced
+				// Keep the lookup hash of an encrypted field in step.
+				sealed, isString := replaced.(string)
+				if _, indexed := v[key+"Hash"]; ok && isString && indexed {
+					pseudonym, err := s.keyring.Decrypt(sealed)
+					if err != nil {
+						return err
+					}
+					v[key+"Hash"] = s.keyring.Hash(pseudonym)
+				}
+			}
+		case bson.D:
+			for i := range v {
+				replaced, _, err := field(v[i].Key, v[i].Value)
+				if err != nil {
+					return err
+				}
+				v[i].Value = replaced
+			}
+		case bson.A:
+			for _, item := range v {
+				if err := walk(item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walk(doc)
+	return changed, err
+}
+
+func (s *scrubber) replace(kind masking.Kind, v interface{}, changed *bool) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return v, nil
+		}
+		value, err := s.keyring.Decrypt(v)
+		if err != nil {
+			return nil, err
+		}
+		pseudonym := s.pseudonym(kind, value)
+		if fieldcrypt.IsEncrypted(v) {
+			if pseudonym, err = s.keyring.Encrypt(pseudonym); err != nil {
+				return nil, err
+			}
+		}
+		*changed = true
+		return pseudonym, nil
+	case bson.M:
+		for key, value := range v {
+			replaced, err := s.replace(kind, value, changed)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = replaced
+		}
+	case bson.D:
+		for i := range v {
+			replaced, err := s.replace(kind, v[i].Value, changed)
+			if err != nil {
+				return nil, err
+			}
+			v[i].Value = replaced
+		}
+	case bson.A:
+		for i, item := range v {
+			replaced, err := s.replace(kind, item, changed)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = replaced
+		}
+	}
+	return v, nil
+}
+
+// pseudonym returns the replacement of value. Numbers keep their letters and
+// layout, so that an IBAN keeps its country and a phone number its format.
+func (s *scrubber) pseudonym(kind masking.Kind, value string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	sum := mac.Sum(nil)
+	tag := hex.EncodeToString(sum[:6])
+
+	switch kind {
+	case masking.Name:
+		return "Anonymized " + tag
+	case masking.Email:
+		return "user-" + tag + "@example.invalid"
+	case masking.Number:
+		var b strings.Builder
+		i := 0
+		for _, r := range value {
+			if unicode.IsDigit(r) {
+				r = rune('0' + sum[i%len(sum)]%10)
+				i++
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+	return tag
+}
@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ims-erp/system/pkg/fieldcrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestScrubber(t *testing.T) {
+	keyring, err := fieldcrypt.NewKeyring(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1", bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	email, err := keyring.Encrypt("ap@northwind.example.com")
+	require.NoError(t, err)
+
+	s, err := newScrubber(keyring)
+	require.NoError(t, err)
+	client := bson.M{
+		"name":           "Northwind Traders",
+		"email":          email,
+		"emailHash":      keyring.Hash("ap@northwind.example.com"),
+		"phone":          "+1 555-0100",
+		"creditLimit":    "5000.00",
+		"billingAddress": bson.M{"street": "1 Main St", "city": "Springfield", "country": "US"},
+	}
+	changed, err := s.scrub(client, true)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	name := client["name"].(string)
+	assert.Contains(t, name, "Anonymized ")
+	assert.True(t, fieldcrypt.IsEncrypted(client["email"].(string)), "encrypted values stay encrypted")
+	opened, err := keyring.Decrypt(client["email"].(string))
+	require.NoError(t, err)
+	assert.Contains(t, opened, "@example.invalid")
+	assert.Equal(t, keyring.Hash(opened), client["emailHash"])
+	assert.Regexp(t, `^\+\d \d{3}-\d{4}$`, client["phone"])
+	assert.NotEqual(t, "+1 555-0100", client["phone"])
+	assert.Equal(t, "5000.00", client["creditLimit"])
+	address := client["billingAddress"].(bson.M)
+	assert.NotEqual(t, "1 Main St", address["street"])
+	assert.Equal(t, "US", address["country"])
+
+	invoice := bson.M{"name": "Consulting", "clientName": "northwind traders", "lines": bson.A{bson.D{{Key: "description", Value: "Hours"}}}}
+	_, err = s.scrub(invoice, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Consulting", invoice["name"])
+	assert.Equal(t, name, invoice["clientName"], "a value gets the same pseudonym everywhere")
+
+	product := bson.M{"name": "Widget", "sku": "W-1"}
+	changed, err = s.scrub(product, false)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	withoutKeys, err := newScrubber(nil)
+	require.NoError(t, err)
+	_, err = withoutKeys.scrub(bson.M{"email": email}, false)
+	assert.ErrorIs(t, err, fieldcrypt.ErrUnknownKey, "encrypted data cannot be scrubbed without its keys")
+}
+
+func TestScrubRefusesProduction(t *testing.T) {
+	b := &Backups{environment: "production"}
+	_, err := b.Scrub(context.Background(), "acme", nil)
+	assert.ErrorIs(t, err, ErrProduction)
+}
@@ -0,0 +1,154 @@
+package bankstatement
+
+import (
+	"testing"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSV(t *testing.T) {
+	content := "\ufeffBooking Date;Value Date;Amount;Currency;Description;Counterparty;IBAN;Account\n" +
+		"01.10.2026;02.10.2026;1.234,50;eur;Invoice INV-2026-000042;ACME GmbH;de89 3704 0044 0532 0130 00;DE02120300000000202051\n" +
+		"2026-10-03;;-19,99;EUR;Bank fees;;;DE02120300000000202051\n" +
+		"2026-10-03;;0;EUR;Zero;;;\n" +
+		"2026-10-04;;50;EUR;Same;Bob;;\n" +
+		"2026-10-04;;50;EUR;Same;Bob;;\n"
+
+	statement, err := ParseCSV([]byte(content))
+	require.NoError(t, err)
+	assert.Equal(t, "DE02120300000000202051", statement.AccountIBAN)
+	assert.Equal(t, "EUR", statement.Currency)
+	require.Len(t, statement.Entries, 4, "zero amounts are skipped")
+
+	credit := statement.Entries[0]
+	assert.True(t, credit.Credit)
+	assert.Equal(t, "1234.5", credit.Amount.String())
+	assert.Equal(t, "2026-10-01", credit.BookingDate.Format("2006-01-02"))
+	require.NotNil(t, credit.ValueDate)
+	assert.Equal(t, "Invoice INV-2026-000042", credit.Reference)
+	assert.Equal(t, "ACME GmbH", credit.CounterpartyName)
+	assert.Equal(t, "DE89370400440532013000", credit.CounterpartyIBAN)
+
+	debit := statement.Entries[1]
+	assert.False(t, debit.Credit)
+	assert.Equal(t, "19.99", debit.Amount.String())
+
+	assert.NotEmpty(t, statement.Entries[2].EntryReference)
+	assert.NotEqual(t, statement.Entries[2].EntryReference, statement.Entries[3].EntryReference,
+		"identical entries get references of their own")
+
+	again, err := ParseCSV([]byte(content))
+	require.NoError(t, err)
+	assert.Equal(t, statement.Entries[0].EntryReference, again.Entries[0].EntryReference,
+		"derived references are stable across imports")
+}
+
+func TestParseCSV_CreditDebitColumns(t *testing.T) {
+	statement, err := ParseCSV([]byte("date,credit,debit,reference,transaction id\n" +
+		"2026-10-01,\"1,250.00\",,INV-1,TX-1\n" +
+		"2026-10-02,,75.00,Rent,TX-2\n"))
+	require.NoError(t, err)
+	require.Len(t, statement.Entries, 2)
+	assert.Equal(t, "", statement.Currency)
+	assert.True(t, statement.Entries[0].Credit)
+	assert.Equal(t, "1250", statement.Entries[0].Amount.String())
+	assert.Equal(t, "TX-1", statement.Entries[0].EntryReference)
+	assert.False(t, statement.Entries[1].Credit)
+	assert.Equal(t, "75", statement.Entries[1].Amount.String())
+}
+
+func TestParseCSV_Errors(t *testing.T) {
+	tests := map[string]string{
+		"no date column":   "amount\n10\n",
+		"no amount column": "date\n2026-10-01\n",
+		"invalid date":     "date,amount\n10/01/2026,10\n",
+		"invalid amount":   "date,amount\n2026-10-01,ten\n",
+		"two accounts":     "date,amount,account\n2026-10-01,10,DE1\n2026-10-01,10,DE2\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCSV([]byte(content))
+			var parseErr *ParseError
+			assert.ErrorAs(t, err, &parseErr)
+		})
+	}
+}
+
+const camt053 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <GrpHdr><MsgId>MSG-1</MsgId></GrpHdr>
+    <Stmt>
+      <Id>STMT-2026-10-01</Id>
+      <Acct><Id><IBAN>DE02 1203 0000 0000 2020 51</IBAN></Id><Ccy>EUR</Ccy></Acct>
+      <Ntry>
+        <Amt Ccy="EUR">1234.50</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2026-10-01</Dt></BookgDt>
+        <ValDt><Dt>2026-10-02</Dt></ValDt>
+        <AcctSvcrRef>BANK-REF-1</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs>
+          <RltdPties>
+            <Dbtr><Nm>ACME GmbH</Nm></Dbtr>
+            <DbtrAcct><Id><IBAN>DE89370400440532013000</IBAN></Id></DbtrAcct>
+          </RltdPties>
+          <RmtInf><Ustrd>Invoice INV-2026-000042</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">80.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><DtTm>2026-10-03T09:30:00+02:00</DtTm></BookgDt>
+        <NtryDtls><TxDtls>
+          <RltdPties><Cdtr><Pty><Nm>Landlord</Nm></Pty></Cdtr></RltdPties>
+        </TxDtls></NtryDtls>
+        <AddtlNtryInf>Rent October</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">10.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts>PDNG</Sts>
+        <BookgDt><Dt>2026-10-04</Dt></BookgDt>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+
+func TestParseCAMT053(t *testing.T) {
+	statement, err := Parse(domain.BankStatementCAMT053, []byte(camt053))
+	require.NoError(t, err)
+	assert.Equal(t, "STMT-2026-10-01", statement.Reference)
+	assert.Equal(t, "DE02120300000000202051", statement.AccountIBAN)
+	assert.Equal(t, "EUR", statement.Currency)
+	require.Len(t, statement.Entries, 2, "pending entries are skipped")
+
+	credit := statement.Entries[0]
+	assert.Equal(t, "BANK-REF-1", credit.EntryReference)
+	assert.True(t, credit.Credit)
+	assert.Equal(t, "1234.5", credit.Amount.String())
+	assert.Equal(t, "Invoice INV-2026-000042", credit.Reference)
+	assert.Equal(t, "ACME GmbH", credit.CounterpartyName)
+	assert.Equal(t, "DE89370400440532013000", credit.CounterpartyIBAN)
+	require.NotNil(t, credit.ValueDate)
+
+	debit := statement.Entries[1]
+	assert.False(t, debit.Credit)
+	assert.Equal(t, "Landlord", debit.CounterpartyName)
+	assert.Equal(t, "Rent October", debit.Reference)
+	assert.Equal(t, "2026-10-03T07:30:00Z", debit.BookingDate.Format("2006-01-02T15:04:05Z07:00"))
+	assert.NotEmpty(t, debit.EntryReference)
+}
+
+func TestParseCAMT053_Errors(t *testing.T) {
+	_, err := ParseCAMT053([]byte("<Document><BkToCstmrStmt></BkToCstmrStmt></Document>"))
+	assert.Error(t, err)
+	_, err = ParseCAMT053([]byte("not xml"))
+	assert.Error(t, err)
+	_, err = Parse("mt940", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package bankstatement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+// camtDocument is the part of an ISO 20022 BankToCustomerStatement
+// (camt.053, versions 001.02 to 001.08) that is read. Elements are matched
+// by local name, whatever the version's namespace.
+type camtDocument struct {
+	Statements []struct {
+		ID      string `xml:"Id"`
+		Account struct {
+			IBAN     string `xml:"Id>IBAN"`
+			Currency string `xml:"Ccy"`
+		} `xml:"Acct"`
+		Entries []camtEntry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtEntry struct {
+	Reference string `xml:"NtryRef"`
+	Amount    struct {
+		Value    string `xml:",chardata"`
+		Currency string `xml:"Ccy,attr"`
+	} `xml:"Amt"`
+	CreditDebit   string   `xml:"CdtDbtInd"`
+	Status        camtCode `xml:"Sts"`
+	BookingDate   camtDate `xml:"BookgDt"`
+	ValueDate     camtDate `xml:"ValDt"`
+	ServicerRef   string   `xml:"AcctSvcrRef"`
+	Transactions  []camtTx `xml:"NtryDtls>TxDtls"`
+	AddtlNtryInfo string   `xml:"AddtlNtryInf"`
+}
+
+// camtCode holds a code given as text up to version 001.07 and in Cd from
+// 001.08.
+type camtCode struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+func (c camtCode) value() string {
+	if code := strings.TrimSpace(c.Code); code != "" {
+		return code
+	}
+	return strings.TrimSpace(c.Text)
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtTx struct {
+	EndToEndID   string    `xml:"Refs>EndToEndId"`
+	Unstructured []string  `xml:"RmtInf>Ustrd"`
+	Structured   []string  `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Debtor       camtParty `xml:"RltdPties>Dbtr"`
+	DebtorIBAN   string    `xml:"RltdPties>DbtrAcct>Id>IBAN"`
+	Creditor     camtParty `xml:"RltdPties>Cdtr"`
+	CreditorIBAN string    `xml:"RltdPties>CdtrAcct>Id>IBAN"`
+}
+
+// camtParty holds a party's name, directly under it up to version 001.07
+// and under Pty from 001.08.
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p camtParty) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.PartyName
+}
+
+// ParseCAMT053 reads a camt.053 statement. Only booked entries are read;
+// an entry's remittance information and counterparty are those of its
+// transaction details.
+func ParseCAMT053(content []byte) (*Statement, error) {
+	var document camtDocument
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, &ParseError{Message: "invalid camt.053 document: " + err.Error()}
+	}
+	if len(document.Statements) != 1 {
+		return nil, &ParseError{Message: fmt.Sprintf("camt.053 document has %d statements, expected one", len(document.Statements))}
+	}
+	source := document.Statements[0]
+
+	statement := &Statement{
+		Reference:   strings.TrimSpace(source.ID),
+		AccountIBAN: domain.NormalizeIBAN(source.Account.IBAN),
+		Currency:    strings.ToUpper(strings.TrimSpace(source.Account.Currency)),
+	}
+	for i, ntry := range source.Entries {
+		location := fmt.Sprintf("entry %d", i+1)
+		if status := ntry.Status.value(); status != "" && status != "BOOK" {
+			continue
+		}
+
+		amount, err := decimal.NewFromString(strings.TrimSpace(ntry.Amount.Value))
+		if err != nil || !amount.IsPositive() {
+			return nil, &ParseError{Location: location, Message: "invalid amount " + ntry.Amount.Value}
+		}
+		entry := Entry{
+			EntryReference: strings.TrimSpace(ntry.ServicerRef),
+			Amount:         amount,
+			Currency:       strings.ToUpper(strings.TrimSpace(ntry.Amount.Currency)),
+		}
+		switch strings.TrimSpace(ntry.CreditDebit) {
+		case "CRDT":
+			entry.Credit = true
+		case "DBIT":
+		default:
+			return nil, &ParseError{Location: location, Message: "invalid credit/debit indicator " + ntry.CreditDebit}
+		}
+		if entry.EntryReference == "" {
+			entry.EntryReference = strings.TrimSpace(ntry.Reference)
+		}
+		if entry.BookingDate, err = ntry.BookingDate.parse(); err != nil {
+			return nil, &ParseError{Location: location, Message: "invalid booking date"}
+		}
+		if valueDate, err := ntry.ValueDate.parse(); err == nil {
+			entry.ValueDate = &valueDate
+		}
+
+		var references []string
+		if len(ntry.Transactions) > 0 {
+			tx := ntry.Transactions[0]
+			references = append(references, tx.Structured...)
+			references = append(references, tx.Unstructured...)
+			if entry.Credit {
+				entry.CounterpartyName = tx.Debtor.name()
+				entry.CounterpartyIBAN = domain.NormalizeIBAN(tx.DebtorIBAN)
+			} else {
+				entry.CounterpartyName = tx.Creditor.name()
+				entry.CounterpartyIBAN = domain.NormalizeIBAN(tx.CreditorIBAN)
+			}
+			if id := strings.TrimSpace(tx.EndToEndID); id != "" && id != "NOTPROVIDED" {
+				references = append(references, id)
+			}
+		}
+		if len(references) == 0 && ntry.AddtlNtryInfo != "" {
+			references = append(references, ntry.AddtlNtryInfo)
+		}
+		for i := range references {
+			references[i] = strings.TrimSpace(references[i])
+		}
+		entry.Reference = strings.TrimSpace(strings.Join(references, " "))
+		entry.CounterpartyName = strings.TrimSpace(entry.CounterpartyName)
+		statement.Entries = append(statement.Entries, entry)
+	}
+	assignReferences(statement)
+	return statement, nil
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	if date := strings.TrimSpace(d.Date); date != "" {
+		return time.Parse("2006-01-02", date)
+	}
+	dateTime, err := time.Parse(time.RFC3339, strings.TrimSpace(d.DateTime))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return dateTime.UTC(), nil
+}
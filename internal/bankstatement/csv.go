@@ -0,0 +1,194 @@
+package bankstatement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+// csvColumns maps the header names a CSV export may use, lower-cased and
+// without spaces, underscores or hyphens, to the field they hold.
+var csvColumns = map[string]string{
+	"date":                  "bookingDate",
+	"bookingdate":           "bookingDate",
+	"bookeddate":            "bookingDate",
+	"transactiondate":       "bookingDate",
+	"valuedate":             "valueDate",
+	"amount":                "amount",
+	"credit":                "credit",
+	"debit":                 "debit",
+	"currency":              "currency",
+	"reference":             "reference",
+	"description":           "reference",
+	"purpose":               "reference",
+	"remittance":            "reference",
+	"remittanceinformation": "reference",
+	"counterparty":          "counterpartyName",
+	"counterpartyname":      "counterpartyName",
+	"name":                  "counterpartyName",
+	"counterpartyiban":      "counterpartyIban",
+	"iban":                  "counterpartyIban",
+	"entryreference":        "entryReference",
+	"bankreference":         "entryReference",
+	"transactionid":         "entryReference",
+	"id":                    "entryReference",
+	"account":               "accountIban",
+	"accountiban":           "accountIban",
+}
+
+var csvDateLayouts = []string{"2006-01-02", "02.01.2006", time.RFC3339}
+
+// ParseCSV reads a CSV export with a header row. The delimiter is a comma,
+// semicolon or tab, whichever the header uses most. Each row needs a
+// booking date and either a signed amount or a credit or debit amount;
+// amounts may use a decimal comma.
+func ParseCSV(content []byte) (*Statement, error) {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	header, _, _ := bytes.Cut(content, []byte("\n"))
+	delimiter := ','
+	for _, candidate := range []rune{';', '\t'} {
+		if bytes.Count(header, []byte(string(candidate))) > bytes.Count(header, []byte(string(delimiter))) {
+			delimiter = candidate
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	names, err := reader.Read()
+	if err != nil {
+		return nil, &ParseError{Message: "statement has no header row"}
+	}
+	columns := make(map[string]int)
+	for i, name := range names {
+		key := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+		if field, ok := csvColumns[key]; ok {
+			if _, taken := columns[field]; !taken {
+				columns[field] = i
+			}
+		}
+	}
+	if _, ok := columns["bookingDate"]; !ok {
+		return nil, &ParseError{Location: "header", Message: "no booking date column"}
+	}
+	_, signed := columns["amount"]
+	_, credits := columns["credit"]
+	_, debits := columns["debit"]
+	if !signed && !credits && !debits {
+		return nil, &ParseError{Location: "header", Message: "no amount, credit or debit column"}
+	}
+
+	statement := &Statement{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		location := fmt.Sprintf("line %d", line)
+		if err != nil {
+			return nil, &ParseError{Location: location, Message: err.Error()}
+		}
+		value := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		entry := Entry{
+			EntryReference:   value("entryReference"),
+			Currency:         strings.ToUpper(value("currency")),
+			Reference:        value("reference"),
+			CounterpartyName: value("counterpartyName"),
+			CounterpartyIBAN: domain.NormalizeIBAN(value("counterpartyIban")),
+		}
+		if entry.BookingDate, err = parseCSVDate(value("bookingDate")); err != nil {
+			return nil, &ParseError{Location: location, Message: "invalid booking date " + value("bookingDate")}
+		}
+		if raw := value("valueDate"); raw != "" {
+			valueDate, err := parseCSVDate(raw)
+			if err != nil {
+				return nil, &ParseError{Location: location, Message: "invalid value date " + raw}
+			}
+			entry.ValueDate = &valueDate
+		}
+
+		var amount decimal.Decimal
+		switch {
+		case value("amount") != "":
+			amount, err = parseCSVAmount(value("amount"))
+		case value("credit") != "":
+			amount, err = parseCSVAmount(value("credit"))
+			amount = amount.Abs()
+		case value("debit") != "":
+			amount, err = parseCSVAmount(value("debit"))
+			amount = amount.Abs().Neg()
+		default:
+			return nil, &ParseError{Location: location, Message: "no amount"}
+		}
+		if err != nil {
+			return nil, &ParseError{Location: location, Message: err.Error()}
+		}
+		if amount.IsZero() {
+			continue
+		}
+		entry.Credit = amount.IsPositive()
+		entry.Amount = amount.Abs()
+
+		if account := domain.NormalizeIBAN(value("accountIban")); account != "" {
+			if statement.AccountIBAN != "" && statement.AccountIBAN != account {
+				return nil, &ParseError{Location: location, Message: "statement covers more than one account"}
+			}
+			statement.AccountIBAN = account
+		}
+		statement.Entries = append(statement.Entries, entry)
+	}
+	for i, entry := range statement.Entries {
+		if i == 0 {
+			statement.Currency = entry.Currency
+		} else if entry.Currency != statement.Currency {
+			statement.Currency = ""
+			break
+		}
+	}
+	assignReferences(statement)
+	return statement, nil
+}
+
+func parseCSVDate(value string) (time.Time, error) {
+	var err error
+	for _, layout := range csvDateLayouts {
+		var date time.Time
+		if date, err = time.Parse(layout, value); err == nil {
+			return date.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// parseCSVAmount reads an amount such as -1234.50, 1,234.50 or 1.234,50:
+// the last point or comma is the decimal separator, and any other is a
+// thousands separator.
+func parseCSVAmount(raw string) (decimal.Decimal, error) {
+	value := strings.ReplaceAll(strings.ReplaceAll(raw, " ", ""), "'", "")
+	if i := strings.LastIndexAny(value, ".,"); i >= 0 {
+		whole := strings.NewReplacer(".", "", ",", "").Replace(value[:i])
+		value = whole + "." + value[i+1:]
+	}
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid amount %s", raw)
+	}
+	return amount, nil
+}
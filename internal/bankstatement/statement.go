@@ -0,0 +1,98 @@
+// Package bankstatement reads bank account statements, as CSV exports or
+// ISO 20022 camt.053 files, into the transactions booked on them.
+package bankstatement
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+// Statement is a parsed statement. AccountIBAN and Currency are those of
+// the statement's account, when the file names them.
+type Statement struct {
+	Reference   string
+	AccountIBAN string
+	Currency    string
+	Entries     []Entry
+}
+
+// Entry is a booked transaction. Amount is positive; Credit tells money
+// received from money paid out. EntryReference identifies the entry at the
+// bank, and is derived from its details when the file gives none.
+type Entry struct {
+	EntryReference   string
+	BookingDate      time.Time
+	ValueDate        *time.Time
+	Credit           bool
+	Amount           decimal.Decimal
+	Currency         string
+	Reference        string
+	CounterpartyName string
+	CounterpartyIBAN string
+}
+
+// ParseError reports a statement that could not be read, at the line or
+// entry it names.
+type ParseError struct {
+	Location string
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Location == "" {
+		return e.Message
+	}
+	return e.Location + ": " + e.Message
+}
+
+// Parse reads a statement in format.
+func Parse(format domain.BankStatementFormat, content []byte) (*Statement, error) {
+	switch format {
+	case domain.BankStatementCSV:
+		return ParseCSV(content)
+	case domain.BankStatementCAMT053:
+		return ParseCAMT053(content)
+	}
+	return nil, &ParseError{Message: fmt.Sprintf("unsupported statement format %q", format)}
+}
+
+// assignReferences gives the entries the bank gave no reference for one
+// derived from their account, dates, amount and remittance details, so that
+// importing an overlapping statement again finds them. Identical entries of
+// a statement are told apart by their order.
+func assignReferences(statement *Statement) {
+	seen := make(map[string]int)
+	for i := range statement.Entries {
+		entry := &statement.Entries[i]
+		if entry.EntryReference != "" {
+			continue
+		}
+		direction := "D"
+		if entry.Credit {
+			direction = "C"
+		}
+		sum := sha256.Sum256([]byte(strings.Join([]string{
+			statement.AccountIBAN,
+			entry.BookingDate.Format("2006-01-02"),
+			direction,
+			entry.Amount.String(),
+			entry.Currency,
+			entry.Reference,
+			entry.CounterpartyIBAN,
+			entry.CounterpartyName,
+		}, "|")))
+		reference := "sha256:" + hex.EncodeToString(sum[:16])
+		n := seen[reference]
+		seen[reference]++
+		if n > 0 {
+			reference = fmt.Sprintf("%s/%d", reference, n)
+		}
+		entry.EntryReference = reference
+	}
+}
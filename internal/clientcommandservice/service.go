@@ -0,0 +1,401 @@
+// Package clientcommandservice is client-command-service: it handles client
+// commands, stores their events and publishes them. cmd/client-command-service
+// runs it; the e2e tests start it in-process.
+package clientcommandservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/config"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/migrations"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/internal/scheduler"
+	"github.com/ims-erp/system/internal/trash"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Start connects client-command-service to MongoDB, Redis and messaging
+// (and PostgreSQL when database.driver is postgres) as cfg says, starts its
+// background work in group and returns its HTTP handler, authenticated and
+// instrumented. The connections are closed when group shuts down.
+func Start(group *lifecycle.Group, cfg *config.Config, log *logger.Logger) (http.Handler, error) {
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB: %w", err)
+	}
+	group.OnClose("mongodb", func() error { return mongodb.Close(context.Background()) })
+	log.Info("Connected to MongoDB")
+
+	if err := migrations.New(mongodb, log).Startup(context.Background(), cfg.Migrations, "client_read", "events"); err != nil {
+		return nil, fmt.Errorf("check schema, run `migrate up`: %w", err)
+	}
+
+	redis, err := repository.NewRedis(cfg.Redis, log)
+	if err != nil {
+		return nil, fmt.Errorf("connect to Redis: %w", err)
+	}
+	group.OnClose("redis", redis.Close)
+	log.Info("Connected to Redis")
+
+	publisher, err := messaging.NewEventPublisher(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("create event publisher: %w", err)
+	}
+	group.OnClose("publisher", publisher.Close)
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
+
+	pii, err := cfg.Security.PII.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("configure PII encryption: %w", err)
+	}
+
+	// Client events, and the clients table derived from them, live in
+	// PostgreSQL when database.driver is postgres; the read model stays in
+	// MongoDB.
+	var eventStore commands.EventStore
+	var postgres *repository.Postgres
+	if cfg.Database.Driver == "postgres" {
+		postgres, err = repository.NewPostgres(cfg.Database.Postgres, log)
+		if err != nil {
+			return nil, fmt.Errorf("connect to PostgreSQL: %w", err)
+		}
+		group.OnClose("postgres", postgres.Close)
+		eventStore = repository.NewPostgresEventStore(postgres, log).
+			WithClients(repository.NewPostgresClientRepository(postgres, log))
+	} else {
+		mongoEvents := repository.NewEventStore(mongodb, log).WithEncryption(pii)
+		if err := mongoEvents.EnsureIndexes(context.Background()); err != nil {
+			log.Warn("Failed to create event store indexes", "error", err)
+		}
+		eventStore = mongoEvents
+	}
+	readModelStore := repository.NewReadModelStore(mongodb, "client_read", log).
+		WithEncryption(pii, repository.ClientPIIFields...)
+	cache := repository.NewCache(redis, "t:"+cfg.MongoDB.Database, log)
+
+	defaultCreditLimit := decimal.NewFromInt(10000)
+
+	clientCmdHandler := commands.NewClientCommandHandler(
+		eventStore,
+		publisher,
+		log,
+		commands.TenantConfig{
+			AutoGenerateCode:   true,
+			CodePrefix:         "CLT",
+			DefaultCreditLimit: defaultCreditLimit,
+			RequireEmail:       true,
+		},
+	)
+
+	// Atomic batches run in the outbox transaction, which the client
+	// commands of the batch join.
+	var batchTx commands.Transactor
+	if cfg.Outbox.Enabled {
+		var outbox *messaging.Outbox
+		if postgres != nil {
+			outbox = messaging.OpenPostgresOutbox(postgres, publisher, cfg.Outbox, log)
+		} else if outbox, err = messaging.OpenOutbox(context.Background(), mongodb, publisher, cfg.Outbox, log); err != nil {
+			return nil, fmt.Errorf("open outbox: %w", err)
+		}
+		group.Go("outbox relay", outbox.Run)
+		clientCmdHandler.WithOutbox(outbox)
+		batchTx = outbox
+		log.Info("Transactional outbox enabled")
+	}
+
+	cmdRegistry := commands.NewCommandHandlerRegistry()
+	cmdRegistry.Register("client.create", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return clientCmdHandler.HandleCreateClient(ctx, cmd)
+	})
+	cmdRegistry.Register("client.update", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return clientCmdHandler.HandleUpdateClient(ctx, cmd)
+	})
+	cmdRegistry.Register("client.deactivate", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return nil, clientCmdHandler.HandleDeactivateClient(ctx, cmd)
+	})
+	cmdRegistry.Register("client.assign_credit_limit", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return nil, clientCmdHandler.HandleAssignCreditLimit(ctx, cmd)
+	})
+	cmdRegistry.Register("client.assign_owner", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return nil, clientCmdHandler.HandleAssignClientOwner(ctx, cmd)
+	})
+	cmdRegistry.Register("client.update_billing_info", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return nil, clientCmdHandler.HandleUpdateBillingInfo(ctx, cmd)
+	})
+	cmdRegistry.Register("client.merge", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return nil, clientCmdHandler.HandleMergeClients(ctx, cmd)
+	})
+	cmdRegistry.Register("client.delete", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return nil, clientCmdHandler.HandleDeleteClient(ctx, cmd)
+	})
+	cmdRegistry.Register("client.restore", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return nil, clientCmdHandler.HandleRestoreClient(ctx, cmd)
+	})
+
+	// Command outcomes feed the audit log, which also has to see commands
+	// that failed without producing an event.
+	cmdRegistry.OnOutcome(func(ctx context.Context, outcome *commands.CommandOutcome) {
+		if err := publisher.PublishCommandOutcome(ctx, outcome); err != nil {
+			log.Warn("Failed to publish command outcome", "error", err, "command_type", outcome.Type)
+		}
+	})
+
+	batch := commands.NewBatch(cmdRegistry, batchTx)
+
+	commandJobs := repository.NewCommandJobStore(mongodb)
+	if err := commandJobs.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create command job indexes", "error", err)
+	}
+	asyncCommands := commands.NewAsyncCommands(cmdRegistry, commandJobs, cfg.AsyncCommands, log)
+	group.Go("async commands", asyncCommands.Run)
+
+	clientEventHandler := eventpkg.NewClientEventHandler(readModelStore, cache, log)
+
+	eventHandlerRegistry := eventpkg.NewEventHandlerRegistry()
+	eventHandlerRegistry.Register("ClientCreated", clientEventHandler.HandleClientCreated)
+	eventHandlerRegistry.Register("ClientUpdated", clientEventHandler.HandleClientUpdated)
+	eventHandlerRegistry.Register("ClientOwnerAssigned", clientEventHandler.HandleClientOwnerAssigned)
+	eventHandlerRegistry.Register("ClientDeactivated", clientEventHandler.HandleClientDeactivated)
+	eventHandlerRegistry.Register("CreditLimitAssigned", clientEventHandler.HandleCreditLimitAssigned)
+	eventHandlerRegistry.Register("BillingInfoUpdated", clientEventHandler.HandleBillingInfoUpdated)
+	eventHandlerRegistry.Register("ClientsMerged", clientEventHandler.HandleClientsMerged)
+	eventHandlerRegistry.Register("ClientDeleted", clientEventHandler.HandleClientDeleted)
+	eventHandlerRegistry.Register("ClientRestored", clientEventHandler.HandleClientRestored)
+	eventHandlerRegistry.Register("ClientPurged", clientEventHandler.HandleClientPurged)
+
+	jobRuns := repository.NewJobRunStore(mongodb)
+	if err := jobRuns.EnsureIndexes(context.Background(), cfg.Scheduler.HistoryRetention); err != nil {
+		log.Warn("Failed to create job run indexes", "error", err)
+	}
+	jobLocks, err := scheduler.NewLocker(cfg.Scheduler, mongodb, redis)
+	if err != nil {
+		return nil, fmt.Errorf("configure job locks: %w", err)
+	}
+	jobs := scheduler.New(cfg.Scheduler, jobLocks, jobRuns, log)
+
+	purger := trash.NewPurger(cfg.Trash, log, trash.Target{
+		Name:  "clients",
+		Purge: purgeClients(readModelStore, clientCmdHandler),
+	})
+	if err := jobs.Register(scheduler.Job{
+		Name:     "trash.purge.clients",
+		Schedule: "@every " + cfg.Trash.PurgeInterval.String(),
+		Run:      purger.PurgeOnce,
+		Timeout:  cfg.Trash.PurgeInterval,
+	}); err != nil {
+		return nil, fmt.Errorf("register job: %w", err)
+	}
+
+	group.Go("job scheduler", jobs.Run)
+
+	healthChecker := health.NewHealthChecker(cfg, mongodb, redis, log)
+	healthChecker.AddComponent("messaging", health.MessagingCheck(publisher))
+	if postgres != nil {
+		healthChecker.AddComponent("postgres", health.PostgresCheck(postgres))
+	}
+	readinessChecker := healthChecker.Readiness()
+	livenessChecker := health.NewLivenessChecker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", healthChecker.Handler())
+	mux.Handle("/ready", readinessChecker.Handler())
+	mux.Handle("/live", livenessChecker.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle(eventpkg.CatalogPath, eventpkg.NewCatalog(cfg.App.Name, eventpkg.ClientEvents, eventHandlerRegistry.EventTypes()).Handler())
+	mux.Handle("/admin/jobs", jobs.Handler())
+	mux.Handle("/admin/jobs/", jobs.Handler())
+
+	mux.HandleFunc("/api/v1/commands", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var cmd commands.CommandEnvelope
+		if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		cmd.TenantID = middleware.GetTenantID(r.Context())
+		cmd.UserID = middleware.GetUserID(r.Context())
+		if cmd.ExpectedVersion == 0 {
+			cmd.ExpectedVersion = commands.ParseIfMatch(r.Header.Get("If-Match"))
+		}
+
+		requestID := httpresponse.RequestID(r)
+		if requestID == "" {
+			requestID = generateRequestID()
+		}
+		r = r.WithContext(logger.WithRequestID(r.Context(), requestID))
+
+		if preferAsync(r) {
+			if cmd.CorrelationID == "" {
+				cmd.CorrelationID = requestID
+			}
+			status, err := asyncCommands.Submit(r.Context(), &cmd)
+			if err != nil {
+				httpresponse.Error(w, r, err)
+				return
+			}
+			w.Header().Set("Location", "/api/v1/commands/"+status.ID)
+			w.Header().Set("Preference-Applied", "respond-async")
+			httpresponse.JSON(w, http.StatusAccepted, status)
+			return
+		}
+
+		result, err := cmdRegistry.Handle(r.Context(), &cmd)
+		if err != nil {
+			log.Error("Command failed", "error", err, "command_type", cmd.Type)
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	mux.HandleFunc("/api/v1/commands/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/commands/"), "/")
+		if id == "" || strings.Contains(id, "/") {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		status, err := asyncCommands.Get(r.Context(), middleware.GetTenantID(r.Context()), id)
+		if err != nil {
+			httpresponse.Error(w, r, err)
+			return
+		}
+		httpresponse.JSON(w, http.StatusOK, status)
+	})
+
+	mux.HandleFunc("/api/v1/commands/batch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var req commands.BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		requestID := httpresponse.RequestID(r)
+		if requestID == "" {
+			requestID = generateRequestID()
+		}
+		r = r.WithContext(logger.WithRequestID(r.Context(), requestID))
+
+		tenantID := middleware.GetTenantID(r.Context())
+		userID := middleware.GetUserID(r.Context())
+		for _, cmd := range req.Commands {
+			if cmd == nil {
+				continue
+			}
+			cmd.TenantID = tenantID
+			cmd.UserID = userID
+			if cmd.ID == "" {
+				cmd.ID = uuid.New().String()
+			}
+			if cmd.CorrelationID == "" {
+				cmd.CorrelationID = requestID
+			}
+			// Client commands name their client in data; it is the
+			// aggregate an atomic batch is checked against.
+			if cmd.TargetID == "" {
+				cmd.TargetID, _ = cmd.Data["clientId"].(string)
+			}
+		}
+
+		response, err := batch.Handle(r.Context(), &req)
+		if err != nil {
+			httpresponse.Error(w, r, err)
+			return
+		}
+		if !response.Success {
+			log.Warn("Batch had failed commands", "mode", req.Mode, "failed", response.Failed, "commands", len(req.Commands))
+		}
+		httpresponse.JSON(w, http.StatusOK, response)
+	})
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		return nil, fmt.Errorf("configure token validation: %w", err)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	return metrics.HTTPMiddleware(middleware.Instrument(log, tenants.Handler(mux))), nil
+}
+
+// preferAsync reports whether the client asked for the command to be handled
+// in the background with "Prefer: respond-async" (RFC 7240).
+func preferAsync(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func generateRequestID() string {
+	return fmt.Sprintf("%d", time.Now().UnixNano())
+}
+
+// purgeClients issues a purge command for every trashed client matching the
+// filter. The read model row is removed once the ClientPurged event is
+// projected, so a client seen again before that is skipped.
+func purgeClients(store *repository.ReadModelStore, handler *commands.ClientCommandHandler) func(context.Context, bson.M) (int, error) {
+	return func(ctx context.Context, filter bson.M) (int, error) {
+		expired, err := store.Find(ctx, repository.OnlyDeleted(filter), options.Find().SetLimit(500))
+		if err != nil {
+			return 0, err
+		}
+
+		purged := 0
+		for _, item := range expired {
+			doc, _ := item.(bson.M)
+			clientID, _ := doc["_id"].(string)
+			tenantID, _ := doc["tenantId"].(string)
+
+			cmd := commands.NewCommand("client.purge", tenantID, clientID, "system:trash", map[string]interface{}{
+				"clientId": clientID,
+			})
+			err := handler.HandlePurgeClient(ctx, cmd)
+			if errors.Is(err, errors.CodeNotFound) {
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		return purged, nil
+	}
+}
@@ -0,0 +1,33 @@
+package clientqueryservice
+
+import (
+	"github.com/ims-erp/system/internal/export"
+	"github.com/ims-erp/system/internal/repository"
+)
+
+// clientExport exports the live clients of the client read model for
+// POST /api/v1/clients/exports; clients in the trash are left out.
+var clientExport = export.Source{
+	Name:       "clients",
+	Collection: "client_read",
+	Columns: []export.Column{
+		{Header: "Client ID", Field: "_id"},
+		{Header: "Name", Field: "name"},
+		{Header: "Email", Field: "email"},
+		{Header: "Phone", Field: "phone"},
+		{Header: "Status", Field: "status"},
+		{Header: "Credit Limit", Field: "creditLimit", Number: true},
+		{Header: "Current Balance", Field: "currentBalance", Number: true},
+		{Header: "Tags", Field: "tags"},
+		{Header: "Created", Field: "createdAt"},
+		{Header: "Updated", Field: "updatedAt"},
+	},
+	Filters: map[string]string{
+		"status": "status",
+		"tag":    "tags",
+	},
+	DateField: "createdAt",
+	Sort:      "name",
+	Scope:     repository.NotDeleted,
+	Owned:     true,
+}
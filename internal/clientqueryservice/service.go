@@ -0,0 +1,499 @@
+// Package clientqueryservice is client-query-service: it projects client
+// events into the client read model and serves it over REST and GraphQL.
+// cmd/client-query-service runs it; the e2e tests start it in-process.
+package clientqueryservice
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/export"
+	"github.com/ims-erp/system/internal/graphql"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/migrations"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/internal/replay"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/fieldset"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func optionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Start connects client-query-service to MongoDB, Redis, messaging and
+// MinIO as cfg says, starts the client projections and its background work
+// in group and returns its HTTP handler, authenticated and instrumented. The
+// connections are closed when group shuts down.
+func Start(group *lifecycle.Group, cfg *config.Config, log *logger.Logger) (http.Handler, error) {
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB: %w", err)
+	}
+	group.OnClose("mongodb", func() error { return mongodb.Close(context.Background()) })
+	log.Info("Connected to MongoDB")
+
+	if err := migrations.New(mongodb, log).Startup(context.Background(), cfg.Migrations, "client_read", "events"); err != nil {
+		return nil, fmt.Errorf("check schema, run `migrate up`: %w", err)
+	}
+
+	redis, err := repository.NewRedis(cfg.Redis, log)
+	if err != nil {
+		return nil, fmt.Errorf("connect to Redis: %w", err)
+	}
+	group.OnClose("redis", redis.Close)
+	log.Info("Connected to Redis")
+
+	subscriber, err := messaging.NewEventSubscriber(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("create event subscriber: %w", err)
+	}
+	group.OnClose("subscriber", subscriber.Close)
+	group.OnShutdown("subscriber", subscriber.Drain)
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
+
+	pii, err := cfg.Security.PII.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("configure PII encryption: %w", err)
+	}
+	readModelStore := repository.NewReadModelStore(mongodb, "client_read", log).
+		WithEncryption(pii, repository.ClientPIIFields...)
+	cache := repository.NewCache(redis, "t:"+cfg.MongoDB.Database, log)
+
+	// Credit status includes the credit left on the client's credit notes,
+	// read from invoice-service's read model, and client detail the account
+	// credit of their overpayments, from payment-service's.
+	clientQueryHandler := queries.NewClientQueryHandler(readModelStore, cache, log).
+		WithInvoices(repository.NewReadModelStore(mongodb, "invoice_read", log)).
+		WithPayments(repository.NewReadModelStore(mongodb, "payment_read_models", log))
+
+	processedEvents := repository.NewProcessedEventStore(mongodb)
+	if err := processedEvents.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create processed event indexes", "error", err)
+	}
+
+	eventHandlerRegistry := events.ClientProjections(readModelStore, cache, log).
+		WithProcessedEvents(processedEvents, "client-query-projections", cfg.NATS.ProcessedEventTTL)
+
+	clientSubject := "evt.Client.>"
+	var dlq *messaging.DeadLetterQueue
+	// pauseProjections lets a replay stop the projections while it swaps in
+	// a rebuilt read model. Only JetStream consumers can be paused.
+	var pauseProjections func(ctx context.Context) (func(), error)
+
+	// JetStream consumers retry failed events and dead-letter them. Without
+	// JetStream, and on Kafka, the projections run in a consumer group and
+	// failures are logged.
+	natsSubscriber, onNATS := subscriber.(*messaging.Subscriber)
+	if onNATS && cfg.NATS.JetStream.Enabled {
+		streamSubject := cfg.NATS.JetStream.StreamPrefix + clientSubject
+		if err := natsSubscriber.EnsureStream(group.Context(), messaging.StreamConfig{
+			Name:     "CLIENT_EVENTS",
+			Subjects: []string{streamSubject},
+			MaxAge:   7 * 24 * time.Hour,
+			Storage:  jetstream.FileStorage,
+		}); err != nil {
+			return nil, fmt.Errorf("ensure client event stream: %w", err)
+		}
+
+		deadLetter := cfg.NATS.DeadLetter
+		cc, err := natsSubscriber.Consume(group.Context(), messaging.ConsumerSpec{
+			Stream:        "CLIENT_EVENTS",
+			Consumer:      "client-query-projections",
+			FilterSubject: streamSubject,
+			MaxDeliver:    deadLetter.MaxDeliver,
+			AckWait:       deadLetter.AckWait,
+			Backoff:       deadLetter.Backoff,
+		}, createJetStreamHandler(eventHandlerRegistry))
+		if err != nil {
+			return nil, fmt.Errorf("start client event consumer: %w", err)
+		}
+		group.OnShutdown("consumer client-query-projections", func(context.Context) error {
+			cc.Stop()
+			return nil
+		})
+
+		pauseProjections = func(ctx context.Context) (func(), error) {
+			return natsSubscriber.PauseConsumer(ctx, "CLIENT_EVENTS", "client-query-projections", cfg.Replay.PauseFor)
+		}
+
+		dlq = natsSubscriber.DeadLetterQueue()
+		group.Go("dead letter monitor", func(ctx context.Context) {
+			dlq.Monitor(ctx, deadLetter.CheckInterval, deadLetter.AlertThreshold)
+		})
+		group.Go("consumer monitor", func(ctx context.Context) {
+			natsSubscriber.MonitorConsumers(ctx, cfg.NATS.JetStream.StatsInterval)
+		})
+	} else if err := subscriber.SubscribeGroup(group.Context(), clientSubject, "client-query-projections", createEventHandler(eventHandlerRegistry)); err != nil {
+		log.Error("Failed to subscribe", "error", err, "subject", clientSubject)
+	}
+
+	replayer := replay.NewReplayer(mongodb, cfg.Replay, log, replay.Target{
+		Name:           "client_read",
+		AggregateTypes: []string{"Client"},
+		Live:           eventHandlerRegistry,
+		Project: func(collection string) *events.EventHandlerRegistry {
+			store := repository.NewReadModelStore(mongodb, collection, log).WithEncryption(pii, repository.ClientPIIFields...)
+			return events.ClientProjections(store, cache, log)
+		},
+		Invalidate: func(ctx context.Context, tenantID string) error {
+			return cache.DeletePattern(ctx, "client:*")
+		},
+		Pause: pauseProjections,
+	}).WithEncryption(pii)
+	if err := replayer.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create replay job indexes", "error", err)
+	}
+	group.Go("projection replayer", replayer.Run)
+
+	files, err := export.NewStorage(cfg.MinIO)
+	if err != nil {
+		return nil, fmt.Errorf("configure MinIO: %w", err)
+	}
+	clients := clientExport
+	clients.Open = readModelStore.Decrypt
+	exporter := export.NewExporter(mongodb, files, cfg.Exports, log, clients).WithMasking(cfg.Security.Masking)
+	if err := exporter.Setup(context.Background()); err != nil {
+		log.Warn("Failed to set up exports", "error", err)
+	}
+	group.Go("export worker", exporter.Run)
+
+	// GraphQL serves clients together with their invoices and payments,
+	// read from the other services' read models through the same caches,
+	// so their invalidations apply.
+	resolver := &graphql.Resolver{
+		ClientHandler:  clientQueryHandler,
+		InvoiceHandler: queries.NewInvoiceQueryHandler(repository.NewReadModelStore(mongodb, "invoice_read", log), cache, log),
+		PaymentHandler: queries.NewPaymentQueryHandler(repository.NewReadModelStore(mongodb, "payment_read_models", log),
+			repository.NewCache(redis, "payment_cache", log), log),
+	}
+	executor, err := graphql.NewSchemaExecutor(resolver)
+	if err != nil {
+		return nil, fmt.Errorf("set up GraphQL: %w", err)
+	}
+	var persisted *graphql.PersistedQueries
+	if cfg.GraphQL.PersistedQueries != "" {
+		if persisted, err = graphql.LoadPersistedQueries(cfg.GraphQL.PersistedQueries); err != nil {
+			return nil, fmt.Errorf("load persisted queries: %w", err)
+		}
+	}
+	graphQL := resolver.LoaderMiddleware(graphql.LoaderConfig{})(graphql.NewHandler(executor, persisted))
+
+	healthChecker := health.NewHealthChecker(cfg, mongodb, redis, log)
+	healthChecker.AddComponent("messaging", health.MessagingCheck(subscriber))
+	if onNATS && cfg.NATS.JetStream.Enabled {
+		healthChecker.AddComponent("consumer:client-query-projections", health.ConsumerLagCheck(
+			natsSubscriber, "CLIENT_EVENTS", "client-query-projections", cfg.NATS.JetStream.MaxConsumerLag))
+	}
+	readinessChecker := healthChecker.Readiness()
+	livenessChecker := health.NewLivenessChecker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", healthChecker.Handler())
+	mux.Handle("/ready", readinessChecker.Handler())
+	mux.Handle("/live", livenessChecker.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle(events.CatalogPath, events.NewCatalog(cfg.App.Name, nil, eventHandlerRegistry.EventTypes()).Handler())
+	if dlq != nil {
+		mux.Handle("/admin/dlq", dlq.Handler())
+		mux.Handle("/admin/dlq/", dlq.Handler())
+		mux.Handle("/debug/consumers", natsSubscriber.ConsumersHandler())
+	}
+
+	mux.Handle("/admin/replay/", replayer.Handler())
+
+	mux.HandleFunc("/api/v1/clients", handleListClients(clientQueryHandler, log, false))
+	mux.HandleFunc("/api/v1/clients/trash", handleListClients(clientQueryHandler, log, true))
+	throttle := middleware.NewThrottle(repository.NewRateLimiter(redis, log), cfg.Security.Throttle, log)
+	mux.Handle("/api/v1/clients/search", throttle.Limit(middleware.ThrottleSearch, handleSearchClients(clientQueryHandler, log)))
+	mux.HandleFunc("/api/v1/clients/id/", handleGetClient(clientQueryHandler, log))
+	mux.HandleFunc("/api/v1/clients/detail/", handleGetClientDetail(clientQueryHandler, log))
+	mux.HandleFunc("/api/v1/clients/credit/", handleGetClientCreditStatus(clientQueryHandler, log))
+	exports := throttle.Limit(middleware.ThrottleExport, exporter.Handler("/api/v1/clients/exports"), http.MethodPost)
+	mux.Handle("/api/v1/clients/exports", exports)
+	mux.Handle("/api/v1/clients/exports/", exports)
+	mux.Handle("/api/v1/graphql", graphQL)
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		return nil, fmt.Errorf("configure token validation: %w", err)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	return metrics.HTTPMiddleware(middleware.Instrument(log, middleware.NewCORSMiddleware(&cfg.Security).Handler(tenants.Handler(middleware.MaskPII(cfg.Security.Masking, mux))))), nil
+}
+
+func createEventHandler(registry *events.EventHandlerRegistry) messaging.DeliveryHandler {
+	return func(ctx context.Context, msg *messaging.Delivery) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+
+		if errs := registry.Handle(ctx, &event); len(errs) > 0 {
+			return fmt.Errorf("failed to handle %s: %w", event.Type, stderrors.Join(errs...))
+		}
+		return nil
+	}
+}
+
+// createJetStreamHandler surfaces handler failures so the consumer can retry
+// and eventually dead-letter the message. Undecodable payloads are poison.
+func createJetStreamHandler(registry *events.EventHandlerRegistry) messaging.MessageHandler {
+	return func(ctx context.Context, msg jetstream.Msg) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data(), &event); err != nil {
+			return fmt.Errorf("%w: %v", messaging.ErrPoison, err)
+		}
+
+		if errs := registry.Handle(ctx, &event); len(errs) > 0 {
+			return stderrors.Join(errs...)
+		}
+		return nil
+	}
+}
+
+// handleListClients lists live clients, or the trash when deleted is set.
+func handleListClients(handler *queries.ClientQueryHandler, log *logger.Logger, deleted bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r.Context())
+
+		page := parseInt(r.URL.Query().Get("page"), 1)
+		pageSize := parseInt(r.URL.Query().Get("pageSize"), 20)
+		search := r.URL.Query().Get("search")
+		status := r.URL.Query().Get("status")
+
+		fields, err := fieldset.Parse(r.URL.Query(), "clients", queries.ClientSummaryFields)
+		if err != nil {
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		query := &queries.ListClientsQuery{
+			TenantID:   tenantID,
+			Visibility: middleware.GetVisibility(r.Context()),
+			Page:       page,
+			PageSize:   pageSize,
+			Cursor:     r.URL.Query().Get("cursor"),
+			Search:     search,
+			Status:     status,
+			SortBy:     "name",
+			SortOrder:  "asc",
+			Fields:     fields,
+			Deleted:    deleted,
+		}
+
+		result, err := handler.ListClients(r.Context(), query)
+		if err != nil {
+			log.Error("Failed to list clients", "error", err)
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fields.TrimIn(result, "clients"))
+	}
+}
+
+func handleSearchClients(handler *queries.ClientQueryHandler, log *logger.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r.Context())
+
+		term := r.URL.Query().Get("q")
+		if term == "" {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "search term is required")
+			return
+		}
+
+		limit := parseInt(r.URL.Query().Get("limit"), 10)
+
+		fields, err := fieldset.Parse(r.URL.Query(), "clients", queries.ClientSummaryFields)
+		if err != nil {
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		query := &queries.SearchClientsQuery{
+			TenantID:   tenantID,
+			Visibility: middleware.GetVisibility(r.Context()),
+			Term:       term,
+			Limit:      limit,
+			Fields:     fields,
+		}
+
+		clients, err := handler.SearchClients(r.Context(), query)
+		if err != nil {
+			log.Error("Failed to search clients", "error", err)
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fields.Trim(clients))
+	}
+}
+
+func handleGetClient(handler *queries.ClientQueryHandler, log *logger.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r.Context())
+		clientID := r.URL.Query().Get("clientId")
+		if clientID == "" {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "clientId is required")
+			return
+		}
+
+		fields, err := fieldset.Parse(r.URL.Query(), "clients", queries.ClientSummaryFields)
+		if err != nil {
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		query := &queries.GetClientByIDQuery{
+			ClientID:   clientID,
+			TenantID:   tenantID,
+			Visibility: middleware.GetVisibility(r.Context()),
+			Fields:     fields,
+		}
+
+		client, err := handler.GetClientByID(r.Context(), query)
+		if err != nil {
+			log.Error("Failed to get client", "error", err)
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		if client == nil {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "client not found")
+			return
+		}
+
+		httpresponse.SetETag(w, client.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fields.Trim(client))
+	}
+}
+
+func handleGetClientDetail(handler *queries.ClientQueryHandler, log *logger.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r.Context())
+		clientID := r.URL.Query().Get("clientId")
+		if clientID == "" {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "clientId is required")
+			return
+		}
+
+		fields, err := fieldset.Parse(r.URL.Query(), "clients", queries.ClientDetailFields)
+		if err != nil {
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		query := &queries.GetClientDetailQuery{
+			ClientID:   clientID,
+			TenantID:   tenantID,
+			Visibility: middleware.GetVisibility(r.Context()),
+			Fields:     fields,
+		}
+
+		client, err := handler.GetClientDetail(r.Context(), query)
+		if err != nil {
+			log.Error("Failed to get client detail", "error", err)
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		if client == nil {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "client not found")
+			return
+		}
+
+		httpresponse.SetETag(w, client.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fields.Trim(client))
+	}
+}
+
+func handleGetClientCreditStatus(handler *queries.ClientQueryHandler, log *logger.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r.Context())
+		clientID := r.URL.Query().Get("clientId")
+		if clientID == "" {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "clientId is required")
+			return
+		}
+
+		query := &queries.GetClientCreditStatusQuery{
+			ClientID:   clientID,
+			TenantID:   tenantID,
+			Visibility: middleware.GetVisibility(r.Context()),
+		}
+
+		status, err := handler.GetClientCreditStatus(r.Context(), query)
+		if err != nil {
+			log.Error("Failed to get client credit status", "error", err)
+			httpresponse.Error(w, r, err)
+			return
+		}
+
+		if status == nil {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "client not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+func parseInt(s string, defaultVal int) int {
+	if s == "" {
+		return defaultVal
+	}
+	val, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
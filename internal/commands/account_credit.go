@@ -0,0 +1,249 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// AccountCredit returns the client's payments holding account credit in
+// the tenant, oldest first.
+func (h *PaymentCommandHandler) AccountCredit(ctx context.Context, tenantID, clientID uuid.UUID) ([]*domain.Payment, error) {
+	payments, err := h.paymentRepo.FindByClientID(ctx, tenantID, clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to find client payments")
+	}
+	var credit []*domain.Payment
+	for _, payment := range payments {
+		if payment.AccountCredit().IsPositive() {
+			credit = append(credit, payment)
+		}
+	}
+	return credit, nil
+}
+
+// HandleApplyAccountCredit applies the account credit of the client that
+// is the command's target to one of their invoices: amount of it, or as
+// much as the invoice owes and the client has in its currency. The credit
+// is drawn from the payments received first. It returns the payments drawn
+// from and the invoice, all written in one transaction with an outbox.
+func (h *PaymentCommandHandler) HandleApplyAccountCredit(ctx context.Context, cmd *CommandEnvelope) ([]*domain.Payment, *domain.Invoice, error) {
+	tenantID, clientID, err := accountCreditTarget(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	invoiceID, err := uuid.Parse(getString(cmd.Data, "invoiceId"))
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid invoice ID")
+	}
+	invoice, err := h.invoiceRepo.FindByID(ctx, invoiceID)
+	if err != nil || invoice == nil || invoice.TenantID != tenantID {
+		return nil, nil, errors.NotFound("invoice not found")
+	}
+	if invoice.ClientID != clientID {
+		return nil, nil, errors.InvalidArgument("invoice %s belongs to another client", invoice.InvoiceNumber)
+	}
+	if err := checkExpectedVersion(cmd, "invoice", invoice.Version); err != nil {
+		return nil, nil, err
+	}
+
+	payments, err := h.AccountCredit(ctx, tenantID, clientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	amount, ok, err := money.Parse(cmd.Data, "amount", invoice.Currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		amount = decimal.Min(domain.AccountCreditBalance(payments, invoice.Currency), invoice.AmountDue)
+	}
+	draws, err := domain.DrawAccountCredit(payments, invoice.Currency, amount)
+	if err != nil {
+		return nil, nil, paymentApplicationError(err)
+	}
+
+	now := time.Now().UTC()
+	var drawn []*domain.Payment
+	var recorded []*eventpkg.EventEnvelope
+	for _, draw := range draws {
+		application, err := draw.Payment.ApplyTo(invoice, draw.Amount, &userID, now)
+		if err != nil {
+			return nil, nil, paymentApplicationError(err)
+		}
+		drawn = append(drawn, draw.Payment)
+		recorded = append(recorded, applicationEvents(cmd, draw.Payment, invoice, application)...)
+	}
+	if paid := paidEvent(cmd, invoice, recorded[len(recorded)-1]); paid != nil {
+		recorded = append(recorded, paid)
+	}
+
+	version := invoice.Version
+	versions := numberInvoiceEvents(invoice, recorded)
+	err = commitEvents(ctx, h.outbox, h.publisher, h.logger, func(ctx context.Context) error {
+		for _, payment := range drawn {
+			if err := h.paymentRepo.Update(ctx, payment); err != nil {
+				return err
+			}
+		}
+		return saveInvoiceVersions(ctx, h.invoiceRepo, invoice, versions)
+	}, recorded...)
+	if err := asVersionConflict(err, "invoice", version); err != nil {
+		h.logger.New(ctx).Error("Failed to apply account credit", "error", err)
+		return nil, nil, errors.Wrap(err, errors.CodeInternalError, "failed to apply account credit")
+	}
+
+	h.logger.New(ctx).Info("Account credit applied",
+		"client_id", clientID,
+		"invoice_id", invoice.ID,
+		"payments", len(drawn),
+		"amount", amount.String(),
+		"amount_due", invoice.AmountDue.String(),
+	)
+
+	return drawn, invoice, nil
+}
+
+// HandleRefundAccountCredit pays account credit of the client that is the
+// command's target back to them: amount of it in currency, or all of it.
+// Credit is drawn from the payments received first, each refunded through
+// its payment processor or, for payments taken outside one such as bank
+// transfers, recorded as refunded by hand with the reference of the
+// transfer back. Each payment is written as it is refunded, so a failing
+// refund leaves those before it recorded.
+func (h *PaymentCommandHandler) HandleRefundAccountCredit(ctx context.Context, cmd *CommandEnvelope) ([]*domain.Payment, error) {
+	tenantID, clientID, err := accountCreditTarget(cmd)
+	if err != nil {
+		return nil, err
+	}
+	currency := getString(cmd.Data, "currency")
+	if currency == "" {
+		return nil, errors.InvalidArgument("currency is required")
+	}
+	reason := getString(cmd.Data, "reason")
+	if reason == "" {
+		reason = "Account credit refunded"
+	}
+	reference := getString(cmd.Data, "reference")
+
+	payments, err := h.AccountCredit(ctx, tenantID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	amount, ok, err := money.Parse(cmd.Data, "amount", currency)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		amount = domain.AccountCreditBalance(payments, currency)
+	}
+	draws, err := domain.DrawAccountCredit(payments, currency, amount)
+	if err != nil {
+		return nil, paymentApplicationError(err)
+	}
+
+	var refunded []*domain.Payment
+	for _, draw := range draws {
+		if err := h.refundCredit(ctx, cmd, draw, reason, reference); err != nil {
+			return refunded, err
+		}
+		refunded = append(refunded, draw.Payment)
+	}
+
+	h.logger.New(ctx).Info("Account credit refunded",
+		"client_id", clientID,
+		"currency", currency,
+		"payments", len(refunded),
+		"amount", amount.String(),
+	)
+
+	return refunded, nil
+}
+
+// refundCredit refunds draw's amount of its payment's account credit and
+// writes the payment with its payment.credit_refunded event.
+func (h *PaymentCommandHandler) refundCredit(ctx context.Context, cmd *CommandEnvelope, draw domain.CreditDraw, reason, reference string) error {
+	payment := draw.Payment
+	data := map[string]interface{}{
+		"clientId":      payment.ClientID.String(),
+		"amount":        draw.Amount.String(),
+		"currency":      payment.Currency,
+		"reason":        reason,
+		"refundMethod":  "manual",
+		"refundId":      "",
+		"transactionId": reference,
+	}
+
+	processor, err := h.processors.GetProcessor(payment.Provider, nil)
+	var notFound *domain.ProcessorNotFoundError
+	switch {
+	case stderrors.As(err, &notFound):
+	case err != nil:
+		h.logger.New(ctx).Error("Payment processor not available for credit refund", "provider", payment.Provider, "error", err)
+		return errors.InvalidArgument("payment processor not available")
+	default:
+		result, err := processor.ProcessRefund(ctx, &domain.RefundRequest{
+			PaymentID:  payment.ID,
+			Amount:     draw.Amount,
+			Reason:     reason,
+			RefundType: "partial",
+		})
+		if err != nil || !result.Success {
+			h.logger.New(ctx).Error("Credit refund processing failed", "payment_id", payment.ID, "error", err)
+			return errors.Newf(errors.CodeInternalError, "refund processing failed: %v", err)
+		}
+		data["refundMethod"] = payment.Provider
+		data["refundId"] = result.RefundID
+		data["transactionId"] = result.TransactionID
+	}
+
+	version := payment.Version
+	if err := payment.RefundCredit(draw.Amount, time.Now().UTC()); err != nil {
+		return paymentApplicationError(err)
+	}
+	data["amountRefunded"] = payment.AmountRefunded.String()
+	data["accountCredit"] = payment.AccountCredit().String()
+
+	event := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.credit_refunded",
+		cmd.TenantID,
+		cmd.UserID,
+		data,
+	)
+	event.WithCorrelationID(cmd.CorrelationID)
+	event.Version = version + 1
+
+	err = commitEvents(ctx, h.outbox, h.publisher, h.logger, func(ctx context.Context) error {
+		return h.paymentRepo.Update(ctx, payment)
+	}, event)
+	if err := asVersionConflict(err, "payment", version); err != nil {
+		h.logger.New(ctx).Error("Failed to record credit refund", "payment_id", payment.ID, "error", err)
+		return errors.Wrap(err, errors.CodeInternalError, "failed to record credit refund")
+	}
+	return nil
+}
+
+// accountCreditTarget returns the tenant and the client, the command's
+// target, whose account credit the command draws on.
+func accountCreditTarget(cmd *CommandEnvelope) (uuid.UUID, uuid.UUID, error) {
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	clientID, err := uuid.Parse(cmd.TargetID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, errors.InvalidArgument("invalid client ID")
+	}
+	return tenantID, clientID, nil
+}
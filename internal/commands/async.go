@@ -0,0 +1,276 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// CommandJobStore keeps commands accepted for background handling.
+// repository.CommandJobStore implements it.
+type CommandJobStore interface {
+	Create(ctx context.Context, job *repository.CommandJob, retention time.Duration) error
+	Get(ctx context.Context, id string) (*repository.CommandJob, error)
+	CountPending(ctx context.Context, tenantID string) (int64, error)
+	Running(ctx context.Context, staleAfter time.Duration) (map[string]int, error)
+	Claim(ctx context.Context, owner string, busy []string) (*repository.CommandJob, error)
+	Heartbeat(ctx context.Context, job *repository.CommandJob) error
+	Finish(ctx context.Context, job *repository.CommandJob, retention time.Duration) error
+	FailStale(ctx context.Context, staleAfter, retention time.Duration) (int64, error)
+}
+
+// CommandStatus is what a client polling an asynchronous command sees.
+type CommandStatus struct {
+	*repository.CommandJob
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// AsyncCommands accepts commands for handling in the background and runs
+// them through a registry on a bounded worker pool. Jobs live in MongoDB, so
+// any replica can report on a command another replica runs. A tenant has at
+// most cfg.ConcurrencyFor(tenant) commands running across all replicas;
+// the limit is checked when a command is claimed, so two replicas claiming
+// at the same instant may briefly exceed it by one.
+type AsyncCommands struct {
+	registry *CommandHandlerRegistry
+	jobs     CommandJobStore
+	cfg      config.AsyncCommandConfig
+	owner    string
+	slots    chan struct{}
+	logger   *logger.Logger
+}
+
+func NewAsyncCommands(registry *CommandHandlerRegistry, jobs CommandJobStore, cfg config.AsyncCommandConfig, log *logger.Logger) *AsyncCommands {
+	host, _ := os.Hostname()
+	return &AsyncCommands{
+		registry: registry,
+		jobs:     jobs,
+		cfg:      cfg,
+		owner:    host + "-" + uuid.New().String()[:8],
+		slots:    make(chan struct{}, cfg.MaxConcurrent),
+		logger:   log,
+	}
+}
+
+// Submit queues cmd. Submitting a command ID again returns the job of the
+// first submission, so clients can retry a submit that timed out.
+func (a *AsyncCommands) Submit(ctx context.Context, cmd *CommandEnvelope) (*CommandStatus, error) {
+	if _, ok := a.registry.GetHandler(cmd.Type); !ok {
+		return nil, errors.InvalidArgument("unknown command type: %s", cmd.Type)
+	}
+	if cmd.ID == "" {
+		cmd.ID = uuid.New().String()
+	} else if job, err := a.jobs.Get(ctx, cmd.ID); err == nil {
+		return a.resubmitted(job, cmd)
+	}
+
+	pending, err := a.jobs.CountPending(ctx, cmd.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if pending >= int64(a.cfg.TenantPending) {
+		return nil, errors.TooManyRequests("too many commands waiting; %d are pending", pending)
+	}
+
+	payload, err := cmd.ToJSON()
+	if err != nil {
+		return nil, errors.Wrap(err, errors.CodeInvalidArgument, "invalid command")
+	}
+	job := &repository.CommandJob{
+		ID:       cmd.ID,
+		TenantID: cmd.TenantID,
+		UserID:   cmd.UserID,
+		Type:     cmd.Type,
+		Command:  string(payload),
+	}
+	if err := a.jobs.Create(ctx, job, a.cfg.Retention); err != nil {
+		if stderrors.Is(err, repository.ErrDuplicateCommand) {
+			if existing, getErr := a.jobs.Get(ctx, cmd.ID); getErr == nil {
+				return a.resubmitted(existing, cmd)
+			}
+		}
+		return nil, err
+	}
+
+	a.logger.New(ctx).Infow("Command queued", "command_id", job.ID, "command_type", job.Type, "tenant_id", job.TenantID)
+	return &CommandStatus{CommandJob: job}, nil
+}
+
+func (a *AsyncCommands) resubmitted(job *repository.CommandJob, cmd *CommandEnvelope) (*CommandStatus, error) {
+	if job.TenantID != cmd.TenantID || job.Type != cmd.Type {
+		return nil, errors.AlreadyExists("command %s was already submitted", cmd.ID)
+	}
+	return newCommandStatus(job), nil
+}
+
+// Get returns the status of one of tenantID's commands.
+func (a *AsyncCommands) Get(ctx context.Context, tenantID, id string) (*CommandStatus, error) {
+	job, err := a.jobs.Get(ctx, id)
+	if stderrors.Is(err, repository.ErrCommandJobNotFound) || (err == nil && job.TenantID != tenantID) {
+		return nil, errors.NotFound("command not found: %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newCommandStatus(job), nil
+}
+
+func newCommandStatus(job *repository.CommandJob) *CommandStatus {
+	status := &CommandStatus{CommandJob: job}
+	if job.Result != "" {
+		status.Result = json.RawMessage(job.Result)
+	}
+	return status
+}
+
+// Run claims queued commands whenever a worker slot is free and fails those
+// whose replica stopped while handling them. It blocks until ctx is
+// cancelled; commands already running are finished first.
+func (a *AsyncCommands) Run(ctx context.Context) {
+	poll := time.NewTicker(a.cfg.PollInterval)
+	defer poll.Stop()
+	stale := time.NewTicker(a.cfg.StaleAfter)
+	defer stale.Stop()
+
+	for {
+		a.claimJobs(ctx)
+
+		select {
+		case <-ctx.Done():
+			for i := 0; i < cap(a.slots); i++ {
+				a.slots <- struct{}{}
+			}
+			return
+		case <-stale.C:
+			if failed, err := a.jobs.FailStale(ctx, a.cfg.StaleAfter, a.cfg.Retention); err != nil {
+				a.logger.Warn("Failed to fail stale commands", "error", err)
+			} else if failed > 0 {
+				a.logger.Warn("Failed interrupted commands", "count", failed)
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+func (a *AsyncCommands) claimJobs(ctx context.Context) {
+	var running map[string]int
+	for {
+		select {
+		case a.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		if running == nil {
+			var err error
+			if running, err = a.jobs.Running(ctx, a.cfg.StaleAfter); err != nil {
+				<-a.slots
+				a.logger.Warn("Failed to count running commands", "error", err)
+				return
+			}
+		}
+		job, err := a.jobs.Claim(ctx, a.owner, a.busyTenants(running))
+		if err != nil || job == nil {
+			<-a.slots
+			if err != nil {
+				a.logger.Warn("Failed to claim command", "error", err)
+			}
+			return
+		}
+		running[job.TenantID]++
+
+		go func() {
+			defer func() { <-a.slots }()
+			a.run(ctx, job)
+		}()
+	}
+}
+
+// busyTenants returns the tenants that have reached their concurrency limit.
+func (a *AsyncCommands) busyTenants(running map[string]int) []string {
+	var busy []string
+	for tenantID, count := range running {
+		if count >= a.cfg.ConcurrencyFor(tenantID) {
+			busy = append(busy, tenantID)
+		}
+	}
+	sort.Strings(busy)
+	return busy
+}
+
+// run handles job. The handler does not see ctx being cancelled, so a
+// shutdown lets the command finish rather than leaving it half applied.
+func (a *AsyncCommands) run(ctx context.Context, job *repository.CommandJob) {
+	handleCtx := context.WithoutCancel(ctx)
+	log := a.logger.WithFields(map[string]interface{}{
+		"command_id":   job.ID,
+		"command_type": job.Type,
+		"tenant_id":    job.TenantID,
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		heartbeat := time.NewTicker(a.cfg.StaleAfter / 4)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-heartbeat.C:
+				if err := a.jobs.Heartbeat(handleCtx, job); err != nil {
+					log.Warnw("Failed to record command heartbeat", "error", err)
+				}
+			}
+		}
+	}()
+
+	result, err := a.handle(handleCtx, job)
+	job.Status = repository.CommandStatusSucceeded
+	if err != nil {
+		job.Status = repository.CommandStatusFailed
+		job.Error = newCommandJobError(err)
+	} else if result != nil {
+		payload, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			log.Warnw("Failed to encode command result", "error", marshalErr)
+		} else {
+			job.Result = string(payload)
+		}
+	}
+	if finishErr := a.jobs.Finish(handleCtx, job, a.cfg.Retention); finishErr != nil {
+		log.Errorw("Failed to record command result", "error", finishErr)
+	}
+	if err != nil {
+		log.Warnw("Command failed", "error", err)
+	}
+}
+
+func (a *AsyncCommands) handle(ctx context.Context, job *repository.CommandJob) (interface{}, error) {
+	cmd, err := CommandFromJSON([]byte(job.Command))
+	if err != nil {
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to decode command")
+	}
+	return a.registry.Handle(logger.WithRequestID(ctx, cmd.CorrelationID), cmd)
+}
+
+func newCommandJobError(err error) *repository.CommandJobError {
+	var appErr *errors.Error
+	if !stderrors.As(err, &appErr) {
+		appErr = errors.New(errors.CodeInternalError, "internal server error")
+	}
+	return &repository.CommandJobError{
+		Code:    string(appErr.Code),
+		Message: appErr.Message,
+		Details: appErr.Details,
+	}
+}
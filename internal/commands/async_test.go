@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCommandJobs is a CommandJobStore that keeps jobs in creation order.
+type memoryCommandJobs struct {
+	mu   sync.Mutex
+	jobs []*repository.CommandJob
+}
+
+func (s *memoryCommandJobs) Create(ctx context.Context, job *repository.CommandJob, retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.jobs {
+		if existing.ID == job.ID {
+			return repository.ErrDuplicateCommand
+		}
+	}
+	job.Status = repository.CommandStatusPending
+	job.CreatedAt = time.Now().UTC()
+	job.ExpiresAt = job.CreatedAt.Add(retention)
+	copied := *job
+	s.jobs = append(s.jobs, &copied)
+	return nil
+}
+
+func (s *memoryCommandJobs) Get(ctx context.Context, id string) (*repository.CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == id {
+			copied := *job
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrCommandJobNotFound
+}
+
+func (s *memoryCommandJobs) CountPending(ctx context.Context, tenantID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for _, job := range s.jobs {
+		if job.TenantID == tenantID && job.Status == repository.CommandStatusPending {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryCommandJobs) Running(ctx context.Context, staleAfter time.Duration) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	running := make(map[string]int)
+	for _, job := range s.jobs {
+		if job.Status == repository.CommandStatusRunning {
+			running[job.TenantID]++
+		}
+	}
+	return running, nil
+}
+
+func (s *memoryCommandJobs) Claim(ctx context.Context, owner string, busy []string) (*repository.CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+next:
+	for _, job := range s.jobs {
+		if job.Status != repository.CommandStatusPending {
+			continue
+		}
+		for _, tenantID := range busy {
+			if job.TenantID == tenantID {
+				continue next
+			}
+		}
+		job.Status = repository.CommandStatusRunning
+		job.Owner = owner
+		copied := *job
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (s *memoryCommandJobs) Heartbeat(ctx context.Context, job *repository.CommandJob) error {
+	return nil
+}
+
+func (s *memoryCommandJobs) Finish(ctx context.Context, job *repository.CommandJob, retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.jobs {
+		if existing.ID == job.ID {
+			copied := *job
+			s.jobs[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (s *memoryCommandJobs) FailStale(ctx context.Context, staleAfter, retention time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func newTestAsyncCommands(t *testing.T, cfg config.AsyncCommandConfig) (*AsyncCommands, *memoryCommandJobs, chan struct{}) {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	registry := NewCommandHandlerRegistry()
+	registry.Register("note.add", func(ctx context.Context, cmd *CommandEnvelope) (interface{}, error) {
+		<-release
+		note, _ := cmd.Data["note"].(string)
+		if note == "" {
+			return nil, errors.InvalidArgument("note is required")
+		}
+		return map[string]string{"note": note}, nil
+	})
+
+	jobs := &memoryCommandJobs{}
+	return NewAsyncCommands(registry, jobs, cfg, log), jobs, release
+}
+
+func asyncTestConfig() config.AsyncCommandConfig {
+	return config.AsyncCommandConfig{
+		MaxConcurrent:     4,
+		TenantConcurrency: 1,
+		TenantPending:     3,
+		PollInterval:      time.Hour,
+		StaleAfter:        time.Minute,
+		Retention:         time.Hour,
+	}
+}
+
+func TestAsyncCommands_Submit(t *testing.T) {
+	async, _, _ := newTestAsyncCommands(t, asyncTestConfig())
+	ctx := context.Background()
+
+	status, err := async.Submit(ctx, NewCommand("note.add", "tenant-1", "", "user-1", map[string]interface{}{"note": "a"}))
+	require.NoError(t, err)
+	assert.Equal(t, repository.CommandStatusPending, status.Status)
+
+	again, err := async.Submit(ctx, &CommandEnvelope{ID: status.ID, Type: "note.add", TenantID: "tenant-1"})
+	require.NoError(t, err, "resubmitting a command returns its job")
+	assert.Equal(t, status.ID, again.ID)
+
+	_, err = async.Submit(ctx, &CommandEnvelope{ID: status.ID, Type: "note.add", TenantID: "tenant-2"})
+	assert.True(t, errors.Is(err, errors.CodeAlreadyExists))
+
+	_, err = async.Submit(ctx, NewCommand("note.unknown", "tenant-1", "", "user-1", nil))
+	assert.EqualError(t, err, "unknown command type: note.unknown")
+
+	_, err = async.Get(ctx, "tenant-2", status.ID)
+	assert.True(t, errors.Is(err, errors.CodeNotFound), "commands of other tenants are hidden")
+}
+
+func TestAsyncCommands_TenantPendingLimit(t *testing.T) {
+	async, _, _ := newTestAsyncCommands(t, asyncTestConfig())
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := async.Submit(ctx, NewCommand("note.add", "tenant-1", "", "user-1", nil))
+		require.NoError(t, err)
+	}
+	_, err := async.Submit(ctx, NewCommand("note.add", "tenant-1", "", "user-1", nil))
+	assert.True(t, errors.Is(err, errors.CodeTooManyRequests))
+
+	_, err = async.Submit(ctx, NewCommand("note.add", "tenant-2", "", "user-1", nil))
+	assert.NoError(t, err, "the limit is per tenant")
+}
+
+func TestAsyncCommands_TenantConcurrency(t *testing.T) {
+	cfg := asyncTestConfig()
+	cfg.TenantOverrides = map[string]int{"tenant-2": 2}
+	async, jobs, release := newTestAsyncCommands(t, cfg)
+	ctx := context.Background()
+
+	var ids []string
+	for _, tenantID := range []string{"tenant-1", "tenant-1", "tenant-2", "tenant-2", "tenant-2"} {
+		status, err := async.Submit(ctx, NewCommand("note.add", tenantID, "", "user-1", map[string]interface{}{"note": tenantID}))
+		require.NoError(t, err)
+		ids = append(ids, status.ID)
+	}
+
+	async.claimJobs(ctx)
+	running, err := jobs.Running(ctx, cfg.StaleAfter)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"tenant-1": 1, "tenant-2": 2}, running)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		job, err := jobs.Get(ctx, ids[0])
+		return err == nil && job.Status == repository.CommandStatusSucceeded
+	}, time.Second, 5*time.Millisecond)
+
+	status, err := async.Get(ctx, "tenant-1", ids[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"note":"tenant-1"}`, string(status.Result))
+}
+
+func TestAsyncCommands_RecordsFailure(t *testing.T) {
+	async, jobs, release := newTestAsyncCommands(t, asyncTestConfig())
+	close(release)
+	ctx := context.Background()
+
+	status, err := async.Submit(ctx, NewCommand("note.add", "tenant-1", "", "user-1", map[string]interface{}{}))
+	require.NoError(t, err)
+
+	job, err := jobs.Claim(ctx, async.owner, nil)
+	require.NoError(t, err)
+	async.run(ctx, job)
+
+	polled, err := async.Get(ctx, "tenant-1", status.ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.CommandStatusFailed, polled.Status)
+	require.NotNil(t, polled.Error)
+	assert.Equal(t, "INVALID_ARGUMENT", polled.Error.Code)
+	assert.Equal(t, "note is required", polled.Error.Message)
+	assert.Nil(t, polled.Result)
+}
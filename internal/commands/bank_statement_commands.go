@@ -0,0 +1,508 @@
+package commands
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/bankstatement"
+	"github.com/ims-erp/system/internal/domain"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+)
+
+type BankStatementRepository interface {
+	// CreateStatement saves a statement with its transactions, and reports
+	// repository.ErrConcurrencyConflict when the file was imported before.
+	CreateStatement(ctx context.Context, statement *domain.BankStatement, transactions []*domain.BankTransaction) error
+	// ExistingReferences returns which of references were already imported
+	// for account.
+	ExistingReferences(ctx context.Context, tenantID uuid.UUID, account string, references []string) (map[string]bool, error)
+	FindTransaction(ctx context.Context, id uuid.UUID) (*domain.BankTransaction, error)
+	UpdateTransaction(ctx context.Context, transaction *domain.BankTransaction) error
+	// FindPayers returns the clients earlier credits from iban paid for.
+	FindPayers(ctx context.Context, tenantID uuid.UUID, iban string) ([]uuid.UUID, error)
+}
+
+// OpenInvoiceFinder finds the invoices bank credits may pay: pending, sent
+// or overdue with an amount due.
+type OpenInvoiceFinder interface {
+	FindOpen(ctx context.Context, tenantID uuid.UUID, currency string) ([]*domain.Invoice, error)
+}
+
+// BankReconciliationCommandHandler imports bank statements and reconciles
+// the credits on them with open invoices. Credits that match an invoice
+// with confidence are recorded as completed bank transfer payments of it
+// as they are imported; the others are left for review, where a person
+// confirms the invoice they pay or ignores them.
+type BankReconciliationCommandHandler struct {
+	statementRepo BankStatementRepository
+	paymentRepo   PaymentRepository
+	invoiceRepo   InvoiceRepository
+	openInvoices  OpenInvoiceFinder
+	publisher     Publisher
+	outbox        EventOutbox
+	logger        *logger.Logger
+}
+
+func NewBankReconciliationCommandHandler(
+	statementRepo BankStatementRepository,
+	paymentRepo PaymentRepository,
+	invoiceRepo InvoiceRepository,
+	openInvoices OpenInvoiceFinder,
+	publisher Publisher,
+	log *logger.Logger,
+) *BankReconciliationCommandHandler {
+	return &BankReconciliationCommandHandler{
+		statementRepo: statementRepo,
+		paymentRepo:   paymentRepo,
+		invoiceRepo:   invoiceRepo,
+		openInvoices:  openInvoices,
+		publisher:     publisher,
+		logger:        log,
+	}
+}
+
+// WithOutbox routes events through the transactional outbox instead of
+// publishing them directly.
+func (h *BankReconciliationCommandHandler) WithOutbox(outbox EventOutbox) *BankReconciliationCommandHandler {
+	h.outbox = outbox
+	return h
+}
+
+// HandleImportBankStatement imports the statement file in content, in
+// format csv or camt.053, and matches its credits with open invoices.
+// currency and accountIban stand in for what a CSV export leaves out.
+// Transactions already imported from another statement of the account are
+// skipped, and a file imported before is rejected.
+func (h *BankReconciliationCommandHandler) HandleImportBankStatement(ctx context.Context, cmd *CommandEnvelope) (*domain.BankStatement, []*domain.BankTransaction, error) {
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid user ID")
+	}
+	content := getString(cmd.Data, "content")
+	if strings.TrimSpace(content) == "" {
+		return nil, nil, errors.InvalidArgument("statement is empty")
+	}
+	format := domain.BankStatementFormat(getString(cmd.Data, "format"))
+	parsed, err := bankstatement.Parse(format, []byte(content))
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("%s", err.Error())
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	now := time.Now().UTC()
+	statement := &domain.BankStatement{
+		ID:          uuid.New(),
+		TenantID:    tenantID,
+		Format:      format,
+		Reference:   parsed.Reference,
+		AccountIBAN: parsed.AccountIBAN,
+		Currency:    parsed.Currency,
+		Filename:    getString(cmd.Data, "filename"),
+		Fingerprint: hex.EncodeToString(sum[:]),
+		ImportedBy:  userID,
+		ImportedAt:  now,
+	}
+	if statement.AccountIBAN == "" {
+		statement.AccountIBAN = domain.NormalizeIBAN(getString(cmd.Data, "accountIban"))
+	}
+	if statement.Currency == "" {
+		statement.Currency = strings.ToUpper(getString(cmd.Data, "currency"))
+	}
+
+	references := make([]string, len(parsed.Entries))
+	for i, entry := range parsed.Entries {
+		references[i] = entry.EntryReference
+	}
+	existing, err := h.statementRepo.ExistingReferences(ctx, tenantID, statement.AccountIBAN, references)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errors.CodeInternalError, "failed to check imported transactions")
+	}
+
+	transactions := make([]*domain.BankTransaction, 0, len(parsed.Entries))
+	for _, entry := range parsed.Entries {
+		if existing[entry.EntryReference] {
+			statement.Duplicates++
+			continue
+		}
+		currency := entry.Currency
+		if currency == "" {
+			currency = statement.Currency
+		}
+		if len(currency) != 3 {
+			return nil, nil, errors.InvalidArgument("currency is required for transactions the statement gives none for")
+		}
+		status := domain.BankTransactionUnmatched
+		if !entry.Credit {
+			status = domain.BankTransactionIgnored
+		}
+		transactions = append(transactions, &domain.BankTransaction{
+			ID:               uuid.New(),
+			TenantID:         tenantID,
+			StatementID:      statement.ID,
+			AccountIBAN:      statement.AccountIBAN,
+			EntryReference:   entry.EntryReference,
+			BookingDate:      entry.BookingDate,
+			ValueDate:        entry.ValueDate,
+			Credit:           entry.Credit,
+			Amount:           entry.Amount,
+			Currency:         currency,
+			Reference:        entry.Reference,
+			CounterpartyName: entry.CounterpartyName,
+			CounterpartyIBAN: entry.CounterpartyIBAN,
+			Status:           status,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		})
+	}
+	statement.Transactions = len(transactions)
+
+	matches, err := h.match(ctx, tenantID, transactions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counts := make(map[domain.BankTransactionStatus]int)
+	for _, transaction := range transactions {
+		counts[transaction.Status]++
+	}
+	counts[domain.BankTransactionMatched] = len(matches)
+	counts[domain.BankTransactionReview] -= len(matches)
+	event := eventpkg.NewBankStatementImportedEvent(statement, counts, cmd.UserID)
+	event.WithCorrelationID(cmd.CorrelationID)
+	err = commitEvents(ctx, h.outbox, h.publisher, h.logger, func(ctx context.Context) error {
+		return h.statementRepo.CreateStatement(ctx, statement, transactions)
+	}, &event.EventEnvelope)
+	if stderrors.Is(err, repository.ErrConcurrencyConflict) {
+		return nil, nil, errors.Conflict("statement was already imported")
+	}
+	if err != nil {
+		h.logger.New(ctx).Error("Failed to save bank statement", "error", err)
+		return nil, nil, errors.Wrap(err, errors.CodeInternalError, "failed to save bank statement")
+	}
+
+	failed := make(map[uuid.UUID]bool)
+	for i, transaction := range transactions {
+		invoice, ok := matches[transaction.ID]
+		if !ok || failed[invoice.ID] {
+			continue
+		}
+		saved := *transaction
+		if err := h.record(ctx, cmd, transaction, invoice, nil); err != nil {
+			h.logger.New(ctx).Warn("Failed to record matched bank transfer, left for review",
+				"transaction_id", transaction.ID,
+				"invoice_id", invoice.ID,
+				"error", err,
+			)
+			// The invoice may have changed under the import; leave its
+			// other matches for review too.
+			failed[invoice.ID] = true
+			transactions[i] = &saved
+		}
+	}
+
+	h.logger.New(ctx).Info("Bank statement imported",
+		"statement_id", statement.ID,
+		"format", statement.Format,
+		"transactions", statement.Transactions,
+		"duplicates", statement.Duplicates,
+		"matched", len(matches),
+	)
+	return statement, transactions, nil
+}
+
+// match ranks the open invoices each credit may pay, leaving credits with
+// candidates for review, and returns the invoices of those matched with
+// confidence by transaction. Credits after a match see the invoice's
+// amount due less what was matched.
+func (h *BankReconciliationCommandHandler) match(ctx context.Context, tenantID uuid.UUID, transactions []*domain.BankTransaction) (map[uuid.UUID]*domain.Invoice, error) {
+	open := make(map[string][]*domain.Invoice)
+	loaded := make(map[uuid.UUID]*domain.Invoice)
+	payers := make(map[string][]uuid.UUID)
+	matches := make(map[uuid.UUID]*domain.Invoice)
+	for _, transaction := range transactions {
+		if !transaction.Credit {
+			continue
+		}
+		invoices, ok := open[transaction.Currency]
+		if !ok {
+			var err error
+			if invoices, err = h.openInvoices.FindOpen(ctx, tenantID, transaction.Currency); err != nil {
+				return nil, errors.Wrap(err, errors.CodeInternalError, "failed to find open invoices")
+			}
+			open[transaction.Currency] = invoices
+			for _, invoice := range invoices {
+				loaded[invoice.ID] = invoice
+			}
+		}
+		iban := transaction.CounterpartyIBAN
+		if _, ok := payers[iban]; !ok && iban != "" {
+			found, err := h.statementRepo.FindPayers(ctx, tenantID, iban)
+			if err != nil {
+				return nil, errors.Wrap(err, errors.CodeInternalError, "failed to find payers")
+			}
+			payers[iban] = found
+		}
+
+		candidates, best := domain.MatchBankTransaction(transaction, invoices, payers[iban])
+		transaction.Candidates = candidates
+		if len(candidates) > 0 {
+			transaction.Status = domain.BankTransactionReview
+		}
+		if best == nil {
+			continue
+		}
+		for i, invoice := range invoices {
+			if invoice.ID != best.InvoiceID {
+				continue
+			}
+			matches[transaction.ID] = loaded[invoice.ID]
+			remaining := *invoice
+			remaining.AmountDue = invoice.AmountDue.Sub(transaction.Amount)
+			open[transaction.Currency] = append(append([]*domain.Invoice{}, invoices[:i]...), invoices[i+1:]...)
+			if remaining.AmountDue.IsPositive() {
+				open[transaction.Currency] = append(open[transaction.Currency], &remaining)
+			}
+			break
+		}
+	}
+	return matches, nil
+}
+
+// HandleConfirmBankMatch records an open credit as a payment of the invoice
+// in invoiceId, by default its only candidate.
+func (h *BankReconciliationCommandHandler) HandleConfirmBankMatch(ctx context.Context, cmd *CommandEnvelope) (*domain.BankTransaction, error) {
+	transaction, err := h.loadTransaction(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	invoiceID := getString(cmd.Data, "invoiceId")
+	if invoiceID == "" && len(transaction.Candidates) == 1 {
+		invoiceID = transaction.Candidates[0].InvoiceID.String()
+	}
+	if invoiceID == "" {
+		return nil, errors.InvalidArgument("invoiceId is required")
+	}
+	id, err := uuid.Parse(invoiceID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid invoice ID")
+	}
+	invoice, err := h.invoiceRepo.FindByID(ctx, id)
+	if err != nil || invoice == nil {
+		return nil, errors.NotFound("invoice not found")
+	}
+	if invoice.TenantID != transaction.TenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
+	}
+
+	if err := h.record(ctx, cmd, transaction, invoice, &userID); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// HandleIgnoreBankTransaction sets an open credit aside as not an invoice
+// payment, with a reason.
+func (h *BankReconciliationCommandHandler) HandleIgnoreBankTransaction(ctx context.Context, cmd *CommandEnvelope) (*domain.BankTransaction, error) {
+	transaction, err := h.loadTransaction(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	if err := transaction.Ignore(getString(cmd.Data, "reason"), userID); err != nil {
+		return nil, bankReconciliationError(err)
+	}
+	event := eventpkg.NewBankTransactionResolvedEvent(transaction, cmd.UserID)
+	event.WithCorrelationID(cmd.CorrelationID)
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		return h.statementRepo.UpdateTransaction(ctx, transaction)
+	}, transaction.Version, &event.EventEnvelope); err != nil {
+		return nil, err
+	}
+
+	h.logger.New(ctx).Info("Bank transaction ignored",
+		"transaction_id", transaction.ID,
+		"amount", transaction.Amount.String(),
+	)
+	return transaction, nil
+}
+
+// record applies a credit to invoice as a completed bank transfer payment,
+// settled without fees, and matches the credit to it. by is nil for
+// automatic matches.
+func (h *BankReconciliationCommandHandler) record(ctx context.Context, cmd *CommandEnvelope, transaction *domain.BankTransaction, invoice *domain.Invoice, by *uuid.UUID) error {
+	if !transaction.Credit {
+		return bankReconciliationError(domain.ErrBankTransactionDebit)
+	}
+	if !transaction.IsOpen() {
+		return bankReconciliationError(domain.ErrBankTransactionResolved)
+	}
+	switch invoice.Status {
+	case domain.InvoiceStatusPending, domain.InvoiceStatusSent, domain.InvoiceStatusOverdue:
+	default:
+		return errors.Newf(errors.CodeUnprocessable, "invoice in status %s cannot be paid", invoice.Status)
+	}
+	if invoice.Currency != transaction.Currency {
+		return errors.Newf(errors.CodeUnprocessable, "invoice is in %s, the transfer in %s", invoice.Currency, transaction.Currency)
+	}
+	payment := domain.NewPayment(transaction.TenantID, invoice.ID, invoice.ClientID, transaction.Amount, transaction.Currency, domain.PaymentMethodBankTransfer)
+	payment.Provider = "bank"
+	payment.Reference = transaction.Reference
+	payment.TransactionID = transaction.EntryReference
+	payment.Description = "Bank transfer"
+	if transaction.CounterpartyName != "" {
+		payment.Description += " from " + transaction.CounterpartyName
+	}
+	payment.MarkAsCompleted(transaction.BookingDate)
+	payment.Settle(&domain.PaymentSettlement{
+		Currency: payment.Currency,
+		Gross:    payment.Amount,
+		Fee:      decimal.Zero,
+		Net:      payment.Amount,
+		SourceID: transaction.EntryReference,
+	})
+	// A transfer for more than the invoice owes leaves the rest to the
+	// client as account credit.
+	if _, err := payment.ApplyTo(invoice, decimal.Min(payment.Amount, invoice.AmountDue), by, transaction.BookingDate); err != nil {
+		return bankReconciliationError(err)
+	}
+	version := transaction.Version
+	if err := transaction.Match(invoice, payment.ID, by); err != nil {
+		return bankReconciliationError(err)
+	}
+
+	resolved := eventpkg.NewBankTransactionResolvedEvent(transaction, cmd.UserID)
+	resolved.WithCorrelationID(cmd.CorrelationID)
+	events := append(h.bankPaymentEvents(cmd, transaction, payment), &resolved.EventEnvelope)
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		if err := h.statementRepo.UpdateTransaction(ctx, transaction); err != nil {
+			return err
+		}
+		if err := h.paymentRepo.Create(ctx, payment); err != nil {
+			return err
+		}
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, version, events...); err != nil {
+		return err
+	}
+
+	h.logger.New(ctx).Info("Bank transfer recorded",
+		"transaction_id", transaction.ID,
+		"invoice_id", invoice.ID,
+		"payment_id", payment.ID,
+		"amount", payment.Amount.String(),
+		"auto_matched", transaction.AutoMatched,
+	)
+	return nil
+}
+
+// bankPaymentEvents reports a bank transfer the way card payments are
+// reported, created and then processed with its settlement, so that payment
+// read models and revenue include it.
+func (h *BankReconciliationCommandHandler) bankPaymentEvents(cmd *CommandEnvelope, transaction *domain.BankTransaction, payment *domain.Payment) []*eventpkg.EventEnvelope {
+	created := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.created",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceId":   payment.InvoiceID.String(),
+			"clientId":    payment.ClientID.String(),
+			"amount":      payment.Amount.String(),
+			"currency":    payment.Currency,
+			"method":      string(payment.Method),
+			"provider":    payment.Provider,
+			"reference":   payment.Reference,
+			"status":      string(domain.PaymentStatusPending),
+			"description": payment.Description,
+			"metadata":    payment.Metadata,
+		},
+	)
+	processed := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.processed",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceId":         payment.InvoiceID.String(),
+			"amount":            payment.Amount.String(),
+			"transactionId":     payment.TransactionID,
+			"providerId":        payment.ProviderID,
+			"processedAt":       *payment.ProcessedAt,
+			"method":            string(payment.Method),
+			"bankTransactionId": transaction.ID.String(),
+			"settlement":        settlementData(payment.Settlement),
+		},
+	)
+	recordApplication(processed, payment)
+	for _, event := range []*eventpkg.EventEnvelope{created, processed} {
+		event.WithCorrelationID(cmd.CorrelationID)
+		event.WithMetadata("source", "bank_statement")
+	}
+	return []*eventpkg.EventEnvelope{created, processed}
+}
+
+// loadTransaction loads the bank transaction in the command's TargetID, of
+// the command's tenant and at the version the command expects.
+func (h *BankReconciliationCommandHandler) loadTransaction(ctx context.Context, cmd *CommandEnvelope) (*domain.BankTransaction, error) {
+	transactionID, err := uuid.Parse(cmd.TargetID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid bank transaction ID")
+	}
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	if _, err := uuid.Parse(cmd.UserID); err != nil {
+		return nil, errors.InvalidArgument("invalid user ID")
+	}
+
+	transaction, err := h.statementRepo.FindTransaction(ctx, transactionID)
+	if err != nil || transaction == nil {
+		return nil, errors.NotFound("bank transaction not found")
+	}
+	if transaction.TenantID != tenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "bank transaction does not belong to tenant")
+	}
+	if err := checkExpectedVersion(cmd, "bank transaction", transaction.Version); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+func (h *BankReconciliationCommandHandler) commit(ctx context.Context, write func(ctx context.Context) error, version int64, events ...*eventpkg.EventEnvelope) error {
+	err := asVersionConflict(commitEvents(ctx, h.outbox, h.publisher, h.logger, write, events...), "bank transaction", version)
+	var appErr *errors.Error
+	if err != nil && !stderrors.As(err, &appErr) {
+		h.logger.New(ctx).Error("Failed to save bank transaction", "error", err)
+		return errors.Wrap(err, errors.CodeInternalError, "failed to save bank transaction")
+	}
+	return err
+}
+
+// bankReconciliationError reports a reconciliation rule that a command
+// broke as unprocessable.
+func bankReconciliationError(err error) error {
+	var paymentErr *domain.PaymentError
+	if stderrors.As(err, &paymentErr) {
+		return errors.Newf(errors.CodeUnprocessable, "%s", paymentErr.Message)
+	}
+	return err
+}
@@ -0,0 +1,230 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockBankStatementRepo struct {
+	fingerprints map[string]bool
+	transactions map[uuid.UUID]*domain.BankTransaction
+}
+
+func (r *mockBankStatementRepo) CreateStatement(ctx context.Context, statement *domain.BankStatement, transactions []*domain.BankTransaction) error {
+	if r.fingerprints[statement.Fingerprint] {
+		return fmt.Errorf("%w: statement already imported", repository.ErrConcurrencyConflict)
+	}
+	r.fingerprints[statement.Fingerprint] = true
+	for _, transaction := range transactions {
+		stored := *transaction
+		r.transactions[transaction.ID] = &stored
+	}
+	return nil
+}
+
+func (r *mockBankStatementRepo) ExistingReferences(ctx context.Context, tenantID uuid.UUID, account string, references []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for _, transaction := range r.transactions {
+		for _, reference := range references {
+			if transaction.TenantID == tenantID && transaction.AccountIBAN == account && transaction.EntryReference == reference {
+				existing[reference] = true
+			}
+		}
+	}
+	return existing, nil
+}
+
+func (r *mockBankStatementRepo) FindTransaction(ctx context.Context, id uuid.UUID) (*domain.BankTransaction, error) {
+	transaction, ok := r.transactions[id]
+	if !ok {
+		return nil, fmt.Errorf("bank transaction not found: %s", id)
+	}
+	loaded := *transaction
+	return &loaded, nil
+}
+
+func (r *mockBankStatementRepo) UpdateTransaction(ctx context.Context, transaction *domain.BankTransaction) error {
+	if r.transactions[transaction.ID].Version != transaction.Version {
+		return fmt.Errorf("%w: bank transaction %s", repository.ErrConcurrencyConflict, transaction.ID)
+	}
+	transaction.Version++
+	stored := *transaction
+	r.transactions[transaction.ID] = &stored
+	return nil
+}
+
+func (r *mockBankStatementRepo) FindPayers(ctx context.Context, tenantID uuid.UUID, iban string) ([]uuid.UUID, error) {
+	var payers []uuid.UUID
+	for _, transaction := range r.transactions {
+		if transaction.CounterpartyIBAN == iban && transaction.ClientID != nil {
+			payers = append(payers, *transaction.ClientID)
+		}
+	}
+	return payers, nil
+}
+
+type mockOpenInvoices struct {
+	*mockInvoiceRepoForPayment
+}
+
+func (r mockOpenInvoices) FindOpen(ctx context.Context, tenantID uuid.UUID, currency string) ([]*domain.Invoice, error) {
+	var open []*domain.Invoice
+	for _, invoice := range r.invoices {
+		if invoice.TenantID == tenantID && invoice.Currency == currency && invoice.AmountDue.IsPositive() && invoice.Status == domain.InvoiceStatusSent {
+			open = append(open, invoice)
+		}
+	}
+	return open, nil
+}
+
+func TestBankReconciliationCommandHandler_Import(t *testing.T) {
+	statements := &mockBankStatementRepo{fingerprints: make(map[string]bool), transactions: make(map[uuid.UUID]*domain.BankTransaction)}
+	payments := newMockPaymentRepo()
+	invoices := newMockInvoiceRepoForPayment()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	handler := NewBankReconciliationCommandHandler(statements, payments, invoices, mockOpenInvoices{invoices}, publisher, log)
+
+	ctx := context.Background()
+	tenant := uuid.New()
+	tenantID, userID := tenant.String(), uuid.New().String()
+	invoice := func(number, due string) *domain.Invoice {
+		invoice := &domain.Invoice{
+			ID:            uuid.New(),
+			TenantID:      tenant,
+			ClientID:      uuid.New(),
+			InvoiceNumber: number,
+			Status:        domain.InvoiceStatusSent,
+			Currency:      "EUR",
+			Total:         decimal.RequireFromString(due),
+			AmountDue:     decimal.RequireFromString(due),
+		}
+		invoices.invoices[invoice.ID] = invoice
+		return invoice
+	}
+	paid := invoice("INV-2026-000042", "250.00")
+	first := invoice("INV-2026-000043", "99.00")
+	invoice("INV-2026-000044", "99.00")
+
+	content := "date,amount,currency,reference,iban,transaction id\n" +
+		"2026-10-01,250.00,EUR,INV-2026-000042,DE89370400440532013000,TX-1\n" +
+		"2026-10-02,99.00,EUR,October,,TX-2\n" +
+		"2026-10-02,12.00,EUR,Donation,,TX-3\n" +
+		"2026-10-03,-40.00,EUR,Bank fees,,TX-4\n"
+	statement, transactions, err := handler.HandleImportBankStatement(ctx, NewCommand("importBankStatement", tenantID, "", userID, map[string]interface{}{
+		"format":      "csv",
+		"content":     content,
+		"accountIban": "DE02 1203 0000 0000 2020 51",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "DE02120300000000202051", statement.AccountIBAN)
+	assert.Equal(t, 4, statement.Transactions)
+	require.Len(t, transactions, 4)
+
+	matched := transactions[0]
+	assert.Equal(t, domain.BankTransactionMatched, matched.Status)
+	assert.True(t, matched.AutoMatched)
+	assert.Equal(t, domain.InvoiceStatusPaid, paid.Status)
+	payment := payments.payments[*matched.PaymentID]
+	require.NotNil(t, payment)
+	assert.Equal(t, domain.PaymentMethodBankTransfer, payment.Method)
+	assert.Equal(t, domain.PaymentStatusCompleted, payment.Status)
+	assert.Equal(t, "TX-1", payment.TransactionID)
+	assert.Equal(t, domain.BankTransactionMatched, statements.transactions[matched.ID].Status)
+
+	review := transactions[1]
+	assert.Equal(t, domain.BankTransactionReview, review.Status)
+	assert.Len(t, review.Candidates, 2)
+	unmatched := transactions[2]
+	assert.Equal(t, domain.BankTransactionUnmatched, unmatched.Status)
+	assert.Equal(t, domain.BankTransactionIgnored, transactions[3].Status)
+
+	var types []string
+	for _, event := range publisher.events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		"bank_statement.imported",
+		"payment.created",
+		"payment.processed",
+		"bank_transaction.matched",
+	}, types)
+	imported := publisher.events[0]
+	assert.Equal(t, 1, imported.Data["matched"])
+	assert.Equal(t, 1, imported.Data["review"])
+	assert.Equal(t, 1, imported.Data["unmatched"])
+
+	_, _, err = handler.HandleImportBankStatement(ctx, NewCommand("importBankStatement", tenantID, "", userID, map[string]interface{}{
+		"format":      "csv",
+		"content":     content,
+		"accountIban": "DE02120300000000202051",
+	}))
+	assertErrorCode(t, err, errors.CodeConflict)
+
+	statement, transactions, err = handler.HandleImportBankStatement(ctx, NewCommand("importBankStatement", tenantID, "", userID, map[string]interface{}{
+		"format":      "csv",
+		"content":     content + "2026-10-04,5.00,EUR,Refund,,TX-5\n",
+		"accountIban": "DE02120300000000202051",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 4, statement.Duplicates, "transactions imported before are skipped")
+	assert.Len(t, transactions, 1)
+
+	_, _, err = handler.HandleImportBankStatement(ctx, NewCommand("importBankStatement", tenantID, "", userID, map[string]interface{}{
+		"format":  "csv",
+		"content": "amount\n10\n",
+	}))
+	assertErrorCode(t, err, errors.CodeInvalidArgument)
+
+	_, err = handler.HandleConfirmBankMatch(ctx, NewCommand("confirmBankMatch", tenantID, review.ID.String(), userID, nil))
+	assertErrorCode(t, err, errors.CodeInvalidArgument)
+
+	confirmed, err := handler.HandleConfirmBankMatch(ctx, NewCommand("confirmBankMatch", tenantID, review.ID.String(), userID, map[string]interface{}{
+		"invoiceId": first.ID.String(),
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, domain.BankTransactionMatched, confirmed.Status)
+	assert.False(t, confirmed.AutoMatched)
+	assert.Equal(t, domain.InvoiceStatusPaid, first.Status)
+
+	_, err = handler.HandleConfirmBankMatch(ctx, NewCommand("confirmBankMatch", tenantID, review.ID.String(), userID, map[string]interface{}{
+		"invoiceId": first.ID.String(),
+	}))
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+
+	_, err = handler.HandleConfirmBankMatch(ctx, NewCommand("confirmBankMatch", tenantID, transactions[0].ID.String(), userID, map[string]interface{}{
+		"invoiceId": paid.ID.String(),
+	}))
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+
+	ignored, err := handler.HandleIgnoreBankTransaction(ctx, NewCommand("ignoreBankTransaction", tenantID, transactions[0].ID.String(), userID, map[string]interface{}{
+		"reason": "refund from supplier",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, domain.BankTransactionIgnored, ignored.Status)
+	assert.Equal(t, "bank_transaction.ignored", publisher.events[len(publisher.events)-1].Type)
+
+	_, err = handler.HandleIgnoreBankTransaction(ctx, NewCommand("ignoreBankTransaction", uuid.New().String(), review.ID.String(), userID, nil))
+	assertErrorCode(t, err, errors.CodeForbidden)
+
+	// A transfer for more than the invoice owes pays it and leaves the rest
+	// as account credit.
+	small := invoice("INV-2026-000045", "10.00")
+	overpaid, err := handler.HandleConfirmBankMatch(ctx, NewCommand("confirmBankMatch", tenantID, unmatched.ID.String(), userID, map[string]interface{}{
+		"invoiceId": small.ID.String(),
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, domain.InvoiceStatusPaid, small.Status)
+	assert.True(t, small.AmountDue.IsZero())
+	assert.Equal(t, "2", payments.payments[*overpaid.PaymentID].AccountCredit().String())
+}
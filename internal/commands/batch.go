@@ -0,0 +1,234 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+	"time"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// MaxBatchSize is the largest number of commands a batch may carry.
+const MaxBatchSize = 100
+
+// BatchMode selects how a batch treats a failing command.
+type BatchMode string
+
+const (
+	// BatchAtomic applies all commands of the batch or none of them. The
+	// commands must target the same aggregate and run in one transaction.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort handles every command on its own; a failing command
+	// does not affect the others.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// Transactor runs fn in a transaction that nested calls with the context
+// passed to fn join. EventOutbox implementations satisfy it.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type BatchRequest struct {
+	Mode     BatchMode          `json:"mode"`
+	Commands []*CommandEnvelope `json:"commands"`
+}
+
+// BatchResult is the outcome of one command of a batch, at the index it had
+// in the request.
+type BatchResult struct {
+	Index     int                     `json:"index"`
+	CommandID string                  `json:"commandId"`
+	Type      string                  `json:"type"`
+	Success   bool                    `json:"success"`
+	Result    interface{}             `json:"result,omitempty"`
+	Error     *httpresponse.ErrorBody `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode      BatchMode     `json:"mode"`
+	Success   bool          `json:"success"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// errRolledBack is reported for the commands of an atomic batch that
+// succeeded but were rolled back because another command failed.
+var errRolledBack = errors.New(errors.CodeConflict, "rolled back because another command in the batch failed")
+
+// Batch handles several commands in one request through a registry.
+type Batch struct {
+	registry *CommandHandlerRegistry
+	tx       Transactor
+}
+
+// NewBatch returns a batch handler for registry. tx runs atomic batches; with
+// a nil tx only best-effort batches are accepted.
+func NewBatch(registry *CommandHandlerRegistry, tx Transactor) *Batch {
+	return &Batch{registry: registry, tx: tx}
+}
+
+// Handle validates req and handles its commands in the requested mode. An
+// error means the batch was rejected as a whole before any command ran; the
+// failures of single commands are reported in the response.
+func (b *Batch) Handle(ctx context.Context, req *BatchRequest) (*BatchResponse, error) {
+	if err := b.validate(req); err != nil {
+		return nil, err
+	}
+	if req.Mode == BatchAtomic {
+		return b.handleAtomic(ctx, req)
+	}
+
+	results := make([]BatchResult, len(req.Commands))
+	for i, cmd := range req.Commands {
+		result, err := b.handle(ctx, cmd, true)
+		results[i] = newBatchResult(i, cmd, result, err)
+	}
+	return newBatchResponse(req.Mode, results), nil
+}
+
+func (b *Batch) validate(req *BatchRequest) error {
+	switch req.Mode {
+	case BatchAtomic, BatchBestEffort:
+	case "":
+		return errors.InvalidArgument("mode is required")
+	default:
+		return errors.InvalidArgument("unsupported batch mode: %s", req.Mode)
+	}
+	if len(req.Commands) == 0 {
+		return errors.InvalidArgument("commands is required")
+	}
+	if len(req.Commands) > MaxBatchSize {
+		return errors.InvalidArgument("a batch may contain at most %d commands", MaxBatchSize)
+	}
+	for i, cmd := range req.Commands {
+		if cmd == nil {
+			return errors.InvalidArgument("command %d is empty", i)
+		}
+	}
+	if req.Mode != BatchAtomic {
+		return nil
+	}
+
+	if b.tx == nil {
+		return errors.New(errors.CodeUnprocessable, "atomic batches require the transactional outbox")
+	}
+	target := req.Commands[0].TargetID
+	if target == "" {
+		return errors.InvalidArgument("atomic batches require a targetId on every command")
+	}
+	for i, cmd := range req.Commands[1:] {
+		if cmd.TargetID != target {
+			return errors.InvalidArgument("command %d targets %q; atomic batches must target a single aggregate", i+1, cmd.TargetID)
+		}
+	}
+	return nil
+}
+
+// handleAtomic runs the commands in order in one transaction and stops at the
+// first failure, which rolls back those before it. Outcomes are reported
+// once the transaction has ended, so the audit log never records a command
+// as successful that was rolled back.
+func (b *Batch) handleAtomic(ctx context.Context, req *BatchRequest) (*BatchResponse, error) {
+	var (
+		results   []interface{}
+		durations []time.Duration
+		failed    = -1
+		cmdErr    error
+	)
+	txErr := b.tx.WithTransaction(ctx, func(txCtx context.Context) error {
+		// The transaction may be retried; start over each time.
+		results, durations, failed, cmdErr = nil, nil, -1, nil
+		for i, cmd := range req.Commands {
+			start := time.Now()
+			result, err := b.handle(txCtx, cmd, false)
+			durations = append(durations, time.Since(start))
+			if err != nil {
+				failed, cmdErr = i, err
+				return err
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if txErr != nil && failed < 0 {
+		// Every command succeeded but the commit did not.
+		failed, cmdErr = len(req.Commands)-1, txErr
+	}
+
+	batchResults := make([]BatchResult, len(req.Commands))
+	for i, cmd := range req.Commands {
+		var (
+			result   interface{}
+			err      error
+			duration time.Duration
+		)
+		switch {
+		case failed < 0:
+			result = results[i]
+		case i < failed:
+			err = errRolledBack
+		case i == failed:
+			err = cmdErr
+		default:
+			err = errors.New(errors.CodeConflict, "not run because an earlier command in the batch failed")
+		}
+		if i < len(durations) {
+			duration = durations[i]
+		}
+		if i <= failed || failed < 0 {
+			b.registry.notify(ctx, cmd, err, duration)
+		}
+		batchResults[i] = newBatchResult(i, cmd, result, err)
+	}
+	return newBatchResponse(req.Mode, batchResults), nil
+}
+
+func (b *Batch) handle(ctx context.Context, cmd *CommandEnvelope, notify bool) (interface{}, error) {
+	handler, ok := b.registry.GetHandler(cmd.Type)
+	if !ok {
+		return nil, errors.InvalidArgument("unknown command type: %s", cmd.Type)
+	}
+	if notify {
+		return b.registry.Handle(ctx, cmd)
+	}
+	return handler(ctx, cmd)
+}
+
+func newBatchResult(index int, cmd *CommandEnvelope, result interface{}, err error) BatchResult {
+	batchResult := BatchResult{
+		Index:     index,
+		CommandID: cmd.ID,
+		Type:      cmd.Type,
+		Success:   err == nil,
+		Result:    result,
+	}
+	if err != nil {
+		var appErr *errors.Error
+		if !stderrors.As(err, &appErr) {
+			appErr = errors.New(errors.CodeInternalError, "internal server error")
+		}
+		batchResult.Result = nil
+		batchResult.Error = &httpresponse.ErrorBody{
+			Code:    appErr.Code,
+			Message: appErr.Message,
+			Details: appErr.Details,
+		}
+	}
+	return batchResult
+}
+
+func newBatchResponse(mode BatchMode, results []BatchResult) *BatchResponse {
+	response := &BatchResponse{Mode: mode, Results: results}
+	for _, result := range results {
+		if result.Success {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	response.Success = response.Failed == 0
+	return response
+}
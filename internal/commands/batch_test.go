@@ -0,0 +1,183 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ims-erp/system/internal/commands"
+	pkgerrors "github.com/ims-erp/system/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchStore records the commands applied to it; its transactions drop
+// what was applied inside them when they fail.
+type batchStore struct {
+	applied []string
+	txs     int
+}
+
+func (s *batchStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.txs++
+	staged := s.applied
+	if err := fn(ctx); err != nil {
+		s.applied = staged
+		return err
+	}
+	return nil
+}
+
+func newBatchRegistry(store *batchStore) (*commands.CommandHandlerRegistry, *[]*commands.CommandOutcome) {
+	registry := commands.NewCommandHandlerRegistry()
+	registry.Register("note.add", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		note, _ := cmd.Data["note"].(string)
+		if note == "" {
+			return nil, pkgerrors.InvalidArgument("note is required")
+		}
+		store.applied = append(store.applied, note)
+		return map[string]string{"note": note}, nil
+	})
+	var outcomes []*commands.CommandOutcome
+	registry.OnOutcome(func(ctx context.Context, outcome *commands.CommandOutcome) {
+		outcomes = append(outcomes, outcome)
+	})
+	return registry, &outcomes
+}
+
+func noteCommand(target, note string) *commands.CommandEnvelope {
+	return commands.NewCommand("note.add", "tenant-1", target, "user-1", map[string]interface{}{"note": note})
+}
+
+func TestBatch_BestEffort(t *testing.T) {
+	store := &batchStore{}
+	registry, outcomes := newBatchRegistry(store)
+	batch := commands.NewBatch(registry, nil)
+
+	response, err := batch.Handle(context.Background(), &commands.BatchRequest{
+		Mode: commands.BatchBestEffort,
+		Commands: []*commands.CommandEnvelope{
+			noteCommand("a", "first"),
+			noteCommand("b", ""),
+			commands.NewCommand("note.unknown", "tenant-1", "c", "user-1", nil),
+			noteCommand("d", "last"),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.False(t, response.Success)
+	assert.Equal(t, 2, response.Succeeded)
+	assert.Equal(t, 2, response.Failed)
+	assert.Equal(t, []string{"first", "last"}, store.applied)
+	assert.Zero(t, store.txs)
+
+	require.Len(t, response.Results, 4)
+	assert.True(t, response.Results[0].Success)
+	assert.Equal(t, map[string]string{"note": "first"}, response.Results[0].Result)
+	assert.Equal(t, pkgerrors.CodeInvalidArgument, response.Results[1].Error.Code)
+	assert.Equal(t, "unknown command type: note.unknown", response.Results[2].Error.Message)
+	assert.Equal(t, 3, response.Results[3].Index)
+	assert.Len(t, *outcomes, 3, "unknown commands are not reported")
+}
+
+func TestBatch_AtomicCommits(t *testing.T) {
+	store := &batchStore{}
+	registry, outcomes := newBatchRegistry(store)
+	batch := commands.NewBatch(registry, store)
+
+	response, err := batch.Handle(context.Background(), &commands.BatchRequest{
+		Mode:     commands.BatchAtomic,
+		Commands: []*commands.CommandEnvelope{noteCommand("a", "one"), noteCommand("a", "two")},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, response.Success)
+	assert.Equal(t, 2, response.Succeeded)
+	assert.Equal(t, []string{"one", "two"}, store.applied)
+	assert.Equal(t, 1, store.txs)
+	require.Len(t, *outcomes, 2)
+	assert.True(t, (*outcomes)[1].Success)
+}
+
+func TestBatch_AtomicRollsBack(t *testing.T) {
+	store := &batchStore{}
+	registry, outcomes := newBatchRegistry(store)
+	batch := commands.NewBatch(registry, store)
+
+	response, err := batch.Handle(context.Background(), &commands.BatchRequest{
+		Mode: commands.BatchAtomic,
+		Commands: []*commands.CommandEnvelope{
+			noteCommand("a", "one"),
+			noteCommand("a", ""),
+			noteCommand("a", "three"),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.False(t, response.Success)
+	assert.Equal(t, 0, response.Succeeded)
+	assert.Empty(t, store.applied)
+
+	assert.Equal(t, pkgerrors.CodeConflict, response.Results[0].Error.Code, "the first command was rolled back")
+	assert.Equal(t, "note is required", response.Results[1].Error.Message)
+	assert.Equal(t, "not run because an earlier command in the batch failed", response.Results[2].Error.Message)
+
+	require.Len(t, *outcomes, 2, "the command that never ran is not reported")
+	assert.False(t, (*outcomes)[0].Success, "a rolled back command must not be audited as successful")
+}
+
+func TestBatch_Rejected(t *testing.T) {
+	store := &batchStore{}
+	registry, _ := newBatchRegistry(store)
+
+	tests := []struct {
+		name  string
+		batch *commands.Batch
+		req   commands.BatchRequest
+		err   string
+	}{
+		{
+			name:  "no mode",
+			batch: commands.NewBatch(registry, store),
+			req:   commands.BatchRequest{Commands: []*commands.CommandEnvelope{noteCommand("a", "x")}},
+			err:   "mode is required",
+		},
+		{
+			name:  "unknown mode",
+			batch: commands.NewBatch(registry, store),
+			req:   commands.BatchRequest{Mode: "eventual", Commands: []*commands.CommandEnvelope{noteCommand("a", "x")}},
+			err:   "unsupported batch mode: eventual",
+		},
+		{
+			name:  "empty",
+			batch: commands.NewBatch(registry, store),
+			req:   commands.BatchRequest{Mode: commands.BatchBestEffort},
+			err:   "commands is required",
+		},
+		{
+			name:  "atomic without transactions",
+			batch: commands.NewBatch(registry, nil),
+			req:   commands.BatchRequest{Mode: commands.BatchAtomic, Commands: []*commands.CommandEnvelope{noteCommand("a", "x")}},
+			err:   "atomic batches require the transactional outbox",
+		},
+		{
+			name:  "atomic across aggregates",
+			batch: commands.NewBatch(registry, store),
+			req:   commands.BatchRequest{Mode: commands.BatchAtomic, Commands: []*commands.CommandEnvelope{noteCommand("a", "x"), noteCommand("b", "y")}},
+			err:   `command 1 targets "b"; atomic batches must target a single aggregate`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.batch.Handle(context.Background(), &tt.req)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	tooMany := make([]*commands.CommandEnvelope, commands.MaxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = noteCommand("a", "x")
+	}
+	_, err := commands.NewBatch(registry, store).Handle(context.Background(), &commands.BatchRequest{Mode: commands.BatchBestEffort, Commands: tooMany})
+	assert.Error(t, err)
+	assert.Empty(t, store.applied)
+}
@@ -0,0 +1,403 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+type CashSessionRepository interface {
+	Create(ctx context.Context, session *domain.CashSession) error
+	FindByID(ctx context.Context, id uuid.UUID) (*domain.CashSession, error)
+	Update(ctx context.Context, session *domain.CashSession) error
+	// FindOpen returns the open session of a register, or nil.
+	FindOpen(ctx context.Context, tenantID uuid.UUID, registerID string) (*domain.CashSession, error)
+}
+
+// CashSessionCommandHandler runs the cash drawers of retail tenants: it
+// opens a register's session with a float, records cash payments, paid-ins
+// and paid-outs, and closes it with the counted cash. Cash paid against an
+// invoice is recorded as a completed cash payment of the invoice.
+type CashSessionCommandHandler struct {
+	sessionRepo CashSessionRepository
+	paymentRepo PaymentRepository
+	invoiceRepo InvoiceRepository
+	publisher   Publisher
+	outbox      EventOutbox
+	logger      *logger.Logger
+}
+
+func NewCashSessionCommandHandler(
+	sessionRepo CashSessionRepository,
+	paymentRepo PaymentRepository,
+	invoiceRepo InvoiceRepository,
+	publisher Publisher,
+	log *logger.Logger,
+) *CashSessionCommandHandler {
+	return &CashSessionCommandHandler{
+		sessionRepo: sessionRepo,
+		paymentRepo: paymentRepo,
+		invoiceRepo: invoiceRepo,
+		publisher:   publisher,
+		logger:      log,
+	}
+}
+
+// WithOutbox routes events through the transactional outbox instead of
+// publishing them directly.
+func (h *CashSessionCommandHandler) WithOutbox(outbox EventOutbox) *CashSessionCommandHandler {
+	h.outbox = outbox
+	return h
+}
+
+// HandleOpenCashSession opens a session of the register in registerId with
+// the openingFloat counted into the drawer. A register with an open session
+// cannot be opened again until it is closed.
+func (h *CashSessionCommandHandler) HandleOpenCashSession(ctx context.Context, cmd *CommandEnvelope) (*domain.CashSession, error) {
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid user ID")
+	}
+
+	registerID := getString(cmd.Data, "registerId")
+	currency := getString(cmd.Data, "currency")
+	if currency == "" {
+		currency = "USD"
+	}
+	openingFloat, _, err := money.Parse(cmd.Data, "openingFloat", currency)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := domain.NewCashSession(tenantID, registerID, currency, openingFloat, userID)
+	if err != nil {
+		return nil, cashSessionError(err)
+	}
+	open, err := h.sessionRepo.FindOpen(ctx, tenantID, session.RegisterID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to open cash session")
+	}
+	if open != nil {
+		return nil, errors.Conflict("register %s already has an open cash session", session.RegisterID)
+	}
+
+	event := eventpkg.NewCashSessionOpenedEvent(session, cmd.UserID)
+	event.WithCorrelationID(cmd.CorrelationID)
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		return h.sessionRepo.Create(ctx, session)
+	}, 0, &event.EventEnvelope); err != nil {
+		return nil, err
+	}
+
+	h.logger.New(ctx).Info("Cash session opened",
+		"session_id", session.ID,
+		"register_id", session.RegisterID,
+		"opening_float", session.OpeningFloat.String(),
+	)
+	return session, nil
+}
+
+// HandleRecordCashPayment records cash taken at the register for the
+// invoice in invoiceId or the order in orderId. Cash for an invoice is
+// applied to it as a completed cash payment, and cannot be more than the
+// invoice's amount due; change is given from the drawer.
+func (h *CashSessionCommandHandler) HandleRecordCashPayment(ctx context.Context, cmd *CommandEnvelope) (*domain.CashSession, error) {
+	session, err := h.loadSession(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	amount, _, err := money.Parse(cmd.Data, "amount", session.Currency)
+	if err != nil {
+		return nil, err
+	}
+	entry := domain.CashEntry{
+		Type:       domain.CashEntryPayment,
+		Amount:     amount,
+		Reference:  getString(cmd.Data, "reference"),
+		RecordedBy: userID,
+	}
+	if id := getString(cmd.Data, "invoiceId"); id != "" {
+		invoiceID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, errors.InvalidArgument("invalid invoice ID")
+		}
+		entry.InvoiceID = &invoiceID
+	}
+	if id := getString(cmd.Data, "orderId"); id != "" {
+		orderID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, errors.InvalidArgument("invalid order ID")
+		}
+		entry.OrderID = &orderID
+	}
+
+	var (
+		invoice *domain.Invoice
+		payment *domain.Payment
+	)
+	if entry.InvoiceID != nil && entry.OrderID == nil {
+		invoice, err = h.invoiceRepo.FindByID(ctx, *entry.InvoiceID)
+		if err != nil || invoice == nil {
+			return nil, errors.NotFound("invoice not found")
+		}
+		if invoice.TenantID != session.TenantID {
+			return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
+		}
+		switch invoice.Status {
+		case domain.InvoiceStatusPending, domain.InvoiceStatusSent, domain.InvoiceStatusOverdue:
+		default:
+			return nil, errors.Newf(errors.CodeUnprocessable, "invoice in status %s cannot be paid", invoice.Status)
+		}
+		if invoice.Currency != session.Currency {
+			return nil, errors.Newf(errors.CodeUnprocessable, "invoice is in %s, the register takes %s", invoice.Currency, session.Currency)
+		}
+		payment = domain.NewPayment(session.TenantID, invoice.ID, invoice.ClientID, amount, session.Currency, domain.PaymentMethodCash)
+		entry.PaymentID = &payment.ID
+	}
+
+	recorded, err := session.Record(entry)
+	if err != nil {
+		return nil, cashSessionError(err)
+	}
+
+	var events []*eventpkg.EventEnvelope
+	if payment != nil {
+		payment.Provider = "cash"
+		payment.Reference = recorded.Reference
+		payment.TransactionID = recorded.ID.String()
+		payment.Description = "Cash at register " + session.RegisterID
+		payment.MarkAsCompleted(recorded.RecordedAt)
+		// Cash carries no provider fees, so it is settled as it is taken.
+		payment.Settle(&domain.PaymentSettlement{
+			Currency: payment.Currency,
+			Gross:    payment.Amount,
+			Fee:      decimal.Zero,
+			Net:      payment.Amount,
+			SourceID: recorded.ID.String(),
+		})
+		if _, err := payment.ApplyTo(invoice, amount, &userID, recorded.RecordedAt); err != nil {
+			return nil, cashSessionError(err)
+		}
+		events = append(events, h.cashPaymentEvents(cmd, session, payment)...)
+	}
+	recordedEvent := eventpkg.NewCashEntryRecordedEvent(session, recorded, cmd.UserID)
+	recordedEvent.WithCorrelationID(cmd.CorrelationID)
+	events = append(events, &recordedEvent.EventEnvelope)
+
+	version := session.Version
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		if err := h.sessionRepo.Update(ctx, session); err != nil {
+			return err
+		}
+		if payment == nil {
+			return nil
+		}
+		if err := h.paymentRepo.Create(ctx, payment); err != nil {
+			return err
+		}
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, version, events...); err != nil {
+		return nil, err
+	}
+
+	h.logger.New(ctx).Info("Cash payment recorded",
+		"session_id", session.ID,
+		"entry_id", recorded.ID,
+		"amount", recorded.Amount.String(),
+	)
+	return session, nil
+}
+
+// cashPaymentEvents reports a cash payment of an invoice the way card
+// payments are reported, created and then processed with its settlement, so
+// that payment read models and revenue include it.
+func (h *CashSessionCommandHandler) cashPaymentEvents(cmd *CommandEnvelope, session *domain.CashSession, payment *domain.Payment) []*eventpkg.EventEnvelope {
+	created := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.created",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceId":   payment.InvoiceID.String(),
+			"clientId":    payment.ClientID.String(),
+			"amount":      payment.Amount.String(),
+			"currency":    payment.Currency,
+			"method":      string(payment.Method),
+			"provider":    payment.Provider,
+			"reference":   payment.Reference,
+			"status":      string(domain.PaymentStatusPending),
+			"description": payment.Description,
+			"metadata":    payment.Metadata,
+		},
+	)
+	processed := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.processed",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceId":     payment.InvoiceID.String(),
+			"amount":        payment.Amount.String(),
+			"transactionId": payment.TransactionID,
+			"providerId":    payment.ProviderID,
+			"processedAt":   *payment.ProcessedAt,
+			"method":        string(payment.Method),
+			"cashSessionId": session.ID.String(),
+			"settlement":    settlementData(payment.Settlement),
+		},
+	)
+	recordApplication(processed, payment)
+	for _, event := range []*eventpkg.EventEnvelope{created, processed} {
+		event.WithCorrelationID(cmd.CorrelationID)
+		event.WithMetadata("source", "cash_session")
+	}
+	return []*eventpkg.EventEnvelope{created, processed}
+}
+
+// HandleRecordCashMovement records cash put into the drawer (type paid_in)
+// or taken out of it (type paid_out) other than by a sale, with a reason.
+func (h *CashSessionCommandHandler) HandleRecordCashMovement(ctx context.Context, cmd *CommandEnvelope) (*domain.CashSession, error) {
+	session, err := h.loadSession(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	entryType := domain.CashEntryType(getString(cmd.Data, "type"))
+	if entryType != domain.CashEntryPaidIn && entryType != domain.CashEntryPaidOut {
+		return nil, errors.InvalidArgument("type must be paid_in or paid_out")
+	}
+	amount, _, err := money.Parse(cmd.Data, "amount", session.Currency)
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := session.Record(domain.CashEntry{
+		Type:       entryType,
+		Amount:     amount,
+		Reason:     getString(cmd.Data, "reason"),
+		Reference:  getString(cmd.Data, "reference"),
+		RecordedBy: userID,
+	})
+	if err != nil {
+		return nil, cashSessionError(err)
+	}
+
+	event := eventpkg.NewCashEntryRecordedEvent(session, recorded, cmd.UserID)
+	event.WithCorrelationID(cmd.CorrelationID)
+	if err := h.save(ctx, session, &event.EventEnvelope); err != nil {
+		return nil, err
+	}
+
+	h.logger.New(ctx).Info("Cash movement recorded",
+		"session_id", session.ID,
+		"entry_id", recorded.ID,
+		"type", recorded.Type,
+		"amount", recorded.Amount.String(),
+	)
+	return session, nil
+}
+
+// HandleCloseCashSession closes a session with the cash counted in the
+// drawer, in counted, recording the variance against the expected cash.
+func (h *CashSessionCommandHandler) HandleCloseCashSession(ctx context.Context, cmd *CommandEnvelope) (*domain.CashSession, error) {
+	session, err := h.loadSession(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	counted, ok, err := money.Parse(cmd.Data, "counted", session.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.InvalidArgument("counted is required")
+	}
+	if err := session.Close(counted, getString(cmd.Data, "notes"), userID); err != nil {
+		return nil, cashSessionError(err)
+	}
+
+	event := eventpkg.NewCashSessionClosedEvent(session, cmd.UserID)
+	event.WithCorrelationID(cmd.CorrelationID)
+	if err := h.save(ctx, session, &event.EventEnvelope); err != nil {
+		return nil, err
+	}
+
+	h.logger.New(ctx).Info("Cash session closed",
+		"session_id", session.ID,
+		"register_id", session.RegisterID,
+		"expected", session.Expected.String(),
+		"counted", session.Counted.String(),
+		"variance", session.Variance.String(),
+	)
+	return session, nil
+}
+
+// loadSession loads the session in the command's TargetID, of the
+// command's tenant and at the version the command expects.
+func (h *CashSessionCommandHandler) loadSession(ctx context.Context, cmd *CommandEnvelope) (*domain.CashSession, error) {
+	sessionID, err := uuid.Parse(cmd.TargetID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid cash session ID")
+	}
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	if _, err := uuid.Parse(cmd.UserID); err != nil {
+		return nil, errors.InvalidArgument("invalid user ID")
+	}
+
+	session, err := h.sessionRepo.FindByID(ctx, sessionID)
+	if err != nil || session == nil {
+		return nil, errors.NotFound("cash session not found")
+	}
+	if session.TenantID != tenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "cash session does not belong to tenant")
+	}
+	if err := checkExpectedVersion(cmd, "cash session", session.Version); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (h *CashSessionCommandHandler) save(ctx context.Context, session *domain.CashSession, event *eventpkg.EventEnvelope) error {
+	return h.commit(ctx, func(ctx context.Context) error {
+		return h.sessionRepo.Update(ctx, session)
+	}, session.Version, event)
+}
+
+func (h *CashSessionCommandHandler) commit(ctx context.Context, write func(ctx context.Context) error, version int64, events ...*eventpkg.EventEnvelope) error {
+	err := asVersionConflict(commitEvents(ctx, h.outbox, h.publisher, h.logger, write, events...), "cash session", version)
+	var appErr *errors.Error
+	if err != nil && !stderrors.As(err, &appErr) {
+		h.logger.New(ctx).Error("Failed to save cash session", "error", err)
+		return errors.Wrap(err, errors.CodeInternalError, "failed to save cash session")
+	}
+	return err
+}
+
+// cashSessionError reports a rule of the cash drawer that a command broke
+// as unprocessable.
+func cashSessionError(err error) error {
+	var paymentErr *domain.PaymentError
+	if stderrors.As(err, &paymentErr) {
+		return errors.Newf(errors.CodeUnprocessable, "%s", paymentErr.Message)
+	}
+	return err
+}
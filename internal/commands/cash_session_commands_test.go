@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCashSessionRepo struct {
+	sessions map[uuid.UUID]*domain.CashSession
+}
+
+func (r *mockCashSessionRepo) Create(ctx context.Context, session *domain.CashSession) error {
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil
+}
+
+func (r *mockCashSessionRepo) FindByID(ctx context.Context, id uuid.UUID) (*domain.CashSession, error) {
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("cash session not found: %s", id)
+	}
+	loaded := *session
+	loaded.Entries = append([]domain.CashEntry(nil), session.Entries...)
+	return &loaded, nil
+}
+
+func (r *mockCashSessionRepo) Update(ctx context.Context, session *domain.CashSession) error {
+	if r.sessions[session.ID].Version != session.Version {
+		return fmt.Errorf("%w: cash session %s", repository.ErrConcurrencyConflict, session.ID)
+	}
+	session.Version++
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil
+}
+
+func (r *mockCashSessionRepo) FindOpen(ctx context.Context, tenantID uuid.UUID, registerID string) (*domain.CashSession, error) {
+	for _, session := range r.sessions {
+		if session.TenantID == tenantID && session.RegisterID == registerID && session.Status == domain.CashSessionStatusOpen {
+			return session, nil
+		}
+	}
+	return nil, nil
+}
+
+func newTestCashSessionHandler() (*CashSessionCommandHandler, *mockCashSessionRepo, *mockPaymentRepo, *mockInvoiceRepoForPayment, *mockPublisher) {
+	sessions := &mockCashSessionRepo{sessions: make(map[uuid.UUID]*domain.CashSession)}
+	payments := newMockPaymentRepo()
+	invoices := newMockInvoiceRepoForPayment()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	return NewCashSessionCommandHandler(sessions, payments, invoices, publisher, log), sessions, payments, invoices, publisher
+}
+
+func assertErrorCode(t *testing.T, err error, code errors.Code) {
+	t.Helper()
+	var appErr *errors.Error
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, code, appErr.Code)
+}
+
+func TestCashSessionCommandHandler_Shift(t *testing.T) {
+	handler, sessions, payments, invoices, publisher := newTestCashSessionHandler()
+	ctx := context.Background()
+	tenantID, userID := uuid.New().String(), uuid.New().String()
+
+	session, err := handler.HandleOpenCashSession(ctx, NewCommand("openCashSession", tenantID, "", userID, map[string]interface{}{
+		"registerId":   "till-1",
+		"currency":     "EUR",
+		"openingFloat": "150.00",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "150", session.OpeningFloat.String())
+
+	_, err = handler.HandleOpenCashSession(ctx, NewCommand("openCashSession", tenantID, "", userID, map[string]interface{}{
+		"registerId": "till-1",
+		"currency":   "EUR",
+	}))
+	assertErrorCode(t, err, errors.CodeConflict)
+
+	invoice := &domain.Invoice{
+		ID:        uuid.New(),
+		TenantID:  session.TenantID,
+		ClientID:  uuid.New(),
+		Status:    domain.InvoiceStatusSent,
+		Currency:  "EUR",
+		Total:     decimal.NewFromInt(80),
+		AmountDue: decimal.NewFromInt(80),
+	}
+	invoices.invoices[invoice.ID] = invoice
+
+	_, err = handler.HandleRecordCashPayment(ctx, NewCommand("recordCashPayment", tenantID, session.ID.String(), userID, map[string]interface{}{
+		"invoiceId": invoice.ID.String(),
+		"amount":    "90",
+	}))
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+
+	session, err = handler.HandleRecordCashPayment(ctx, NewCommand("recordCashPayment", tenantID, session.ID.String(), userID, map[string]interface{}{
+		"invoiceId": invoice.ID.String(),
+		"amount":    "80",
+		"reference": "receipt 17",
+	}))
+	require.NoError(t, err)
+	require.Len(t, session.Entries, 1)
+	require.NotNil(t, session.Entries[0].PaymentID)
+	payment := payments.payments[*session.Entries[0].PaymentID]
+	require.NotNil(t, payment)
+	assert.Equal(t, domain.PaymentMethodCash, payment.Method)
+	assert.Equal(t, domain.PaymentStatusCompleted, payment.Status)
+	assert.Equal(t, "receipt 17", payment.Reference)
+	require.NotNil(t, payment.Settlement)
+	assert.Equal(t, "80", payment.Settlement.Net.String())
+	assert.Equal(t, domain.InvoiceStatusPaid, invoice.Status)
+
+	_, err = handler.HandleRecordCashPayment(ctx, NewCommand("recordCashPayment", tenantID, session.ID.String(), userID, map[string]interface{}{
+		"orderId": uuid.New().String(),
+		"amount":  "12.50",
+	}))
+	require.NoError(t, err)
+	_, err = handler.HandleRecordCashMovement(ctx, NewCommand("recordCashMovement", tenantID, session.ID.String(), userID, map[string]interface{}{
+		"type":   "paid_out",
+		"amount": "20",
+		"reason": "window cleaner",
+	}))
+	require.NoError(t, err)
+	_, err = handler.HandleRecordCashMovement(ctx, NewCommand("recordCashMovement", tenantID, session.ID.String(), userID, map[string]interface{}{
+		"type":   "payment",
+		"amount": "20",
+	}))
+	assertErrorCode(t, err, errors.CodeInvalidArgument)
+
+	stale := NewCommand("closeCashSession", tenantID, session.ID.String(), userID, map[string]interface{}{"counted": "222.50"})
+	stale.ExpectedVersion = 1
+	_, err = handler.HandleCloseCashSession(ctx, stale)
+	assertErrorCode(t, err, errors.CodeConflict)
+
+	session, err = handler.HandleCloseCashSession(ctx, NewCommand("closeCashSession", tenantID, session.ID.String(), userID, map[string]interface{}{
+		"counted": "220.00",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "222.5", session.Expected.String())
+	assert.Equal(t, "-2.5", session.Variance.String())
+	assert.Equal(t, domain.CashSessionStatusClosed, sessions.sessions[session.ID].Status)
+
+	_, err = handler.HandleRecordCashMovement(ctx, NewCommand("recordCashMovement", tenantID, session.ID.String(), userID, map[string]interface{}{
+		"type":   "paid_in",
+		"amount": "5",
+		"reason": "late",
+	}))
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+
+	var types []string
+	for _, event := range publisher.events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		"cash_session.opened",
+		"payment.created",
+		"payment.processed",
+		"cash_session.payment_recorded",
+		"cash_session.payment_recorded",
+		"cash_session.paid_out",
+		"cash_session.closed",
+	}, types)
+	recorded := publisher.events[3]
+	assert.Equal(t, "80", recorded.Data["amount"])
+	assert.Equal(t, "in", recorded.Data["direction"])
+	assert.Equal(t, "out", publisher.events[5].Data["direction"])
+	assert.Equal(t, "-2.5", publisher.events[6].Data["variance"])
+
+	_, err = handler.HandleCloseCashSession(ctx, NewCommand("closeCashSession", uuid.New().String(), session.ID.String(), userID, map[string]interface{}{
+		"counted": "1",
+	}))
+	assertErrorCode(t, err, errors.CodeForbidden)
+}
@@ -8,13 +8,15 @@ import (
 	eventpkg "github.com/ims-erp/system/internal/events"
 	"github.com/ims-erp/system/internal/repository"
 	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/i18n"
 	"github.com/ims-erp/system/pkg/logger"
 	"github.com/shopspring/decimal"
 )
 
 type ClientCommandHandler struct {
-	eventStore   *repository.EventStore
+	eventStore   EventStore
 	publisher    eventpkg.Publisher
+	outbox       EventOutbox
 	logger       *logger.Logger
 	tenantConfig TenantConfig
 }
@@ -31,7 +33,7 @@ type Publisher interface {
 }
 
 func NewClientCommandHandler(
-	eventStore *repository.EventStore,
+	eventStore EventStore,
 	publisher Publisher,
 	log *logger.Logger,
 	tenantConfig TenantConfig,
@@ -44,15 +46,37 @@ func NewClientCommandHandler(
 	}
 }
 
+// WithOutbox routes events through the transactional outbox instead of
+// publishing them directly.
+func (h *ClientCommandHandler) WithOutbox(outbox EventOutbox) *ClientCommandHandler {
+	h.outbox = outbox
+	return h
+}
+
+func (h *ClientCommandHandler) commit(ctx context.Context, stored repository.StoredEvent, event *eventpkg.EventEnvelope) error {
+	// The published event carries the client's new version, which the read
+	// model serves as the ETag.
+	event.Version = stored.Version
+	err := commitEvents(ctx, h.outbox, h.publisher, h.logger, func(ctx context.Context) error {
+		return h.eventStore.Save(ctx, []repository.StoredEvent{stored})
+	}, event)
+	return asVersionConflict(err, "client", stored.Version-1)
+}
+
 type CreateClientCmd struct {
 	Name              string
 	Email             string
 	Phone             string
+	Locale            string
 	CreditLimit       decimal.Decimal
 	BillingAddress    domain.Address
 	ShippingAddresses []domain.Address
 	Tags              []string
 	CustomFields      map[string]interface{}
+	// OwnerID is the sales rep the client belongs to, the creating user
+	// unless given, and Territory its sales territory.
+	OwnerID   string
+	Territory string
 }
 
 func (h *ClientCommandHandler) HandleCreateClient(ctx context.Context, cmd *CommandEnvelope) (*domain.Client, error) {
@@ -82,6 +106,18 @@ func (h *ClientCommandHandler) HandleCreateClient(ctx context.Context, cmd *Comm
 		client.Phone = phone
 	}
 
+	client.OwnerID = cmd.UserID
+	if ownerID, ok := data["ownerId"].(string); ok && ownerID != "" {
+		client.OwnerID = ownerID
+	}
+	client.Territory, _ = data["territory"].(string)
+
+	if locale, ok := data["locale"].(string); ok {
+		if client.Locale, err = parseLocale(locale); err != nil {
+			return nil, err
+		}
+	}
+
 	if creditLimit, ok := data["creditLimit"].(string); ok {
 		if limit, err := decimal.NewFromString(creditLimit); err == nil {
 			client.CreditLimit = limit
@@ -126,10 +162,13 @@ func (h *ClientCommandHandler) HandleCreateClient(ctx context.Context, cmd *Comm
 			"name":              client.Name,
 			"email":             client.Email,
 			"phone":             client.Phone,
+			"locale":            client.Locale,
 			"creditLimit":       client.CreditLimit.String(),
 			"billingAddress":    client.BillingAddress,
 			"shippingAddresses": client.ShippingAddresses,
 			"tags":              client.Tags,
+			"ownerId":           client.OwnerID,
+			"territory":         client.Territory,
 		},
 	).WithCorrelationID(cmd.CorrelationID)
 
@@ -150,14 +189,10 @@ func (h *ClientCommandHandler) HandleCreateClient(ctx context.Context, cmd *Comm
 		},
 	}
 
-	if err := h.eventStore.Save(ctx, []repository.StoredEvent{storedEvent}); err != nil {
+	if err := h.commit(ctx, storedEvent, event); err != nil {
 		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to save event")
 	}
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.Error("Failed to publish ClientCreated event", "error", err)
-	}
-
 	return client, nil
 }
 
@@ -189,6 +224,7 @@ func (h *ClientCommandHandler) HandleUpdateClient(ctx context.Context, cmd *Comm
 			client.Name = getString(e.EventData, "name")
 			client.Email = getString(e.EventData, "email")
 			client.Phone = getString(e.EventData, "phone")
+			client.Locale = getString(e.EventData, "locale")
 			client.CreditLimit = getDecimal(e.EventData, "creditLimit")
 			client.CreatedAt = e.Timestamp
 			client.Status = domain.ClientStatusActive
@@ -202,12 +238,15 @@ func (h *ClientCommandHandler) HandleUpdateClient(ctx context.Context, cmd *Comm
 			if phone, ok := e.EventData["phone"].(string); ok {
 				client.Phone = phone
 			}
+			if locale, ok := e.EventData["locale"].(string); ok {
+				client.Locale = locale
+			}
 			client.UpdatedAt = e.Timestamp
 		}
 	}
 
-	if cmd.ExpectedVersion > 0 && client.Version != cmd.ExpectedVersion {
-		return nil, errors.Conflict("client version mismatch: expected %d, got %d", cmd.ExpectedVersion, client.Version)
+	if err := checkExpectedVersion(cmd, "client", client.Version); err != nil {
+		return nil, err
 	}
 
 	if name, ok := data["name"].(string); ok {
@@ -219,6 +258,11 @@ func (h *ClientCommandHandler) HandleUpdateClient(ctx context.Context, cmd *Comm
 	if phone, ok := data["phone"].(string); ok {
 		client.Phone = phone
 	}
+	if locale, ok := data["locale"].(string); ok {
+		if client.Locale, err = parseLocale(locale); err != nil {
+			return nil, err
+		}
+	}
 
 	client.Version++
 	client.UpdatedAt = events[0].Timestamp
@@ -233,6 +277,7 @@ func (h *ClientCommandHandler) HandleUpdateClient(ctx context.Context, cmd *Comm
 			"name":    client.Name,
 			"email":   client.Email,
 			"phone":   client.Phone,
+			"locale":  client.Locale,
 			"changes": data,
 		},
 	).WithCorrelationID(cmd.CorrelationID)
@@ -254,14 +299,10 @@ func (h *ClientCommandHandler) HandleUpdateClient(ctx context.Context, cmd *Comm
 		},
 	}
 
-	if err := h.eventStore.Save(ctx, []repository.StoredEvent{storedEvent}); err != nil {
+	if err := h.commit(ctx, storedEvent, event); err != nil {
 		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to save event")
 	}
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.Error("Failed to publish ClientUpdated event", "error", err)
-	}
-
 	return client, nil
 }
 
@@ -289,6 +330,10 @@ func (h *ClientCommandHandler) HandleDeactivateClient(ctx context.Context, cmd *
 		currentVersion = e.Version
 	}
 
+	if err := checkExpectedVersion(cmd, "client", currentVersion); err != nil {
+		return err
+	}
+
 	event := eventpkg.NewEvent(
 		clientID,
 		"Client",
@@ -317,14 +362,10 @@ func (h *ClientCommandHandler) HandleDeactivateClient(ctx context.Context, cmd *
 		},
 	}
 
-	if err := h.eventStore.Save(ctx, []repository.StoredEvent{storedEvent}); err != nil {
+	if err := h.commit(ctx, storedEvent, event); err != nil {
 		return errors.Wrap(err, errors.CodeInternalError, "failed to save event")
 	}
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.Error("Failed to publish ClientDeactivated event", "error", err)
-	}
-
 	return nil
 }
 
@@ -353,6 +394,10 @@ func (h *ClientCommandHandler) HandleAssignCreditLimit(ctx context.Context, cmd
 		return errors.NotFound("client not found: %s", clientID)
 	}
 
+	if err := checkExpectedVersion(cmd, "client", int64(len(events))); err != nil {
+		return err
+	}
+
 	var oldLimit decimal.Decimal
 	for _, e := range events {
 		if e.EventType == "ClientCreated" {
@@ -393,15 +438,39 @@ func (h *ClientCommandHandler) HandleAssignCreditLimit(ctx context.Context, cmd
 		},
 	}
 
-	if err := h.eventStore.Save(ctx, []repository.StoredEvent{storedEvent}); err != nil {
+	if err := h.commit(ctx, storedEvent, event); err != nil {
 		return errors.Wrap(err, errors.CodeInternalError, "failed to save event")
 	}
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.Error("Failed to publish CreditLimitAssigned event", "error", err)
+	return nil
+}
+
+// HandleAssignClientOwner hands a client, and with it its invoices and
+// payments, to another sales rep or territory.
+func (h *ClientCommandHandler) HandleAssignClientOwner(ctx context.Context, cmd *CommandEnvelope) error {
+	ownerID, _ := cmd.Data["ownerId"].(string)
+	territory, _ := cmd.Data["territory"].(string)
+	if ownerID == "" {
+		return errors.InvalidArgument("ownerId is required")
 	}
 
-	return nil
+	clientID, history, err := h.loadClient(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	var previousOwnerID string
+	for _, e := range history {
+		if e.EventType == "ClientCreated" || e.EventType == "ClientOwnerAssigned" {
+			previousOwnerID = getString(e.EventData, "ownerId")
+		}
+	}
+
+	return h.appendEvent(ctx, cmd, clientID, "ClientOwnerAssigned", history, map[string]interface{}{
+		"ownerId":         ownerID,
+		"territory":       territory,
+		"previousOwnerId": previousOwnerID,
+	})
 }
 
 func (h *ClientCommandHandler) HandleUpdateBillingInfo(ctx context.Context, cmd *CommandEnvelope) error {
@@ -439,6 +508,10 @@ func (h *ClientCommandHandler) HandleUpdateBillingInfo(ctx context.Context, cmd
 		return errors.NotFound("client not found: %s", clientID)
 	}
 
+	if err := checkExpectedVersion(cmd, "client", int64(len(events))); err != nil {
+		return err
+	}
+
 	storedEvent := repository.StoredEvent{
 		ID:            event.ID,
 		AggregateID:   clientID,
@@ -456,14 +529,10 @@ func (h *ClientCommandHandler) HandleUpdateBillingInfo(ctx context.Context, cmd
 		},
 	}
 
-	if err := h.eventStore.Save(ctx, []repository.StoredEvent{storedEvent}); err != nil {
+	if err := h.commit(ctx, storedEvent, event); err != nil {
 		return errors.Wrap(err, errors.CodeInternalError, "failed to save event")
 	}
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.Error("Failed to publish BillingInfoUpdated event", "error", err)
-	}
-
 	return nil
 }
 
@@ -501,6 +570,10 @@ func (h *ClientCommandHandler) HandleMergeClients(ctx context.Context, cmd *Comm
 		return errors.NotFound("target client not found: %s", targetID)
 	}
 
+	if err := checkExpectedVersion(cmd, "client", int64(len(targetEvents))); err != nil {
+		return err
+	}
+
 	storedEvent := repository.StoredEvent{
 		ID:            event.ID,
 		AggregateID:   targetID,
@@ -518,17 +591,129 @@ func (h *ClientCommandHandler) HandleMergeClients(ctx context.Context, cmd *Comm
 		},
 	}
 
-	if err := h.eventStore.Save(ctx, []repository.StoredEvent{storedEvent}); err != nil {
+	if err := h.commit(ctx, storedEvent, event); err != nil {
 		return errors.Wrap(err, errors.CodeInternalError, "failed to save event")
 	}
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.Error("Failed to publish ClientsMerged event", "error", err)
+	return nil
+}
+
+// HandleDeleteClient moves a client to the trash. Trashed clients are hidden
+// from queries until they are restored or purged.
+func (h *ClientCommandHandler) HandleDeleteClient(ctx context.Context, cmd *CommandEnvelope) error {
+	clientID, history, err := h.loadClient(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if clientDeleted(history) {
+		return errors.Conflict("client is already deleted: %s", clientID)
+	}
+
+	reason, _ := cmd.Data["reason"].(string)
+	return h.appendEvent(ctx, cmd, clientID, "ClientDeleted", history, map[string]interface{}{
+		"deletedBy": cmd.UserID,
+		"reason":    reason,
+	})
+}
+
+func (h *ClientCommandHandler) HandleRestoreClient(ctx context.Context, cmd *CommandEnvelope) error {
+	clientID, history, err := h.loadClient(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if !clientDeleted(history) {
+		return errors.Conflict("client is not deleted: %s", clientID)
+	}
+
+	return h.appendEvent(ctx, cmd, clientID, "ClientRestored", history, map[string]interface{}{})
+}
+
+// HandlePurgeClient removes a trashed client from the read models for good.
+// The event history is kept for audit.
+func (h *ClientCommandHandler) HandlePurgeClient(ctx context.Context, cmd *CommandEnvelope) error {
+	clientID, history, err := h.loadClient(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if !clientDeleted(history) {
+		return errors.Conflict("client is not deleted: %s", clientID)
+	}
+
+	return h.appendEvent(ctx, cmd, clientID, "ClientPurged", history, map[string]interface{}{})
+}
+
+func (h *ClientCommandHandler) loadClient(ctx context.Context, cmd *CommandEnvelope) (string, []repository.StoredEvent, error) {
+	clientID, _ := cmd.Data["clientId"].(string)
+	if clientID == "" {
+		return "", nil, errors.InvalidArgument("clientId is required")
+	}
+
+	history, err := h.eventStore.Load(ctx, clientID)
+	if err != nil {
+		return "", nil, errors.Wrap(err, errors.CodeInternalError, "failed to load events")
+	}
+
+	if len(history) == 0 || history[0].Metadata.TenantID != cmd.TenantID || clientPurged(history) {
+		return "", nil, errors.NotFound("client not found: %s", clientID)
+	}
+
+	if err := checkExpectedVersion(cmd, "client", history[len(history)-1].Version); err != nil {
+		return "", nil, err
+	}
+	return clientID, history, nil
+}
+
+func (h *ClientCommandHandler) appendEvent(ctx context.Context, cmd *CommandEnvelope, clientID, eventType string, history []repository.StoredEvent, data map[string]interface{}) error {
+	event := eventpkg.NewEvent(
+		clientID,
+		"Client",
+		eventType,
+		cmd.TenantID,
+		cmd.UserID,
+		data,
+	).WithCorrelationID(cmd.CorrelationID)
+
+	storedEvent := repository.StoredEvent{
+		ID:            event.ID,
+		AggregateID:   clientID,
+		AggregateType: "Client",
+		EventType:     eventType,
+		EventData:     event.Data,
+		Version:       history[len(history)-1].Version + 1,
+		Timestamp:     event.Timestamp,
+		Metadata: repository.EventMetadata{
+			TenantID:      cmd.TenantID,
+			UserID:        cmd.UserID,
+			CorrelationID: cmd.CorrelationID,
+			CausationID:   cmd.ID,
+			Timestamp:     event.Timestamp,
+		},
 	}
 
+	if err := h.commit(ctx, storedEvent, event); err != nil {
+		return errors.Wrap(err, errors.CodeInternalError, "failed to save event")
+	}
 	return nil
 }
 
+// clientDeleted reports whether the client is in the trash after history.
+func clientDeleted(history []repository.StoredEvent) bool {
+	deleted := false
+	for _, e := range history {
+		switch e.EventType {
+		case "ClientDeleted":
+			deleted = true
+		case "ClientRestored":
+			deleted = false
+		}
+	}
+	return deleted
+}
+
+func clientPurged(history []repository.StoredEvent) bool {
+	return len(history) > 0 && history[len(history)-1].EventType == "ClientPurged"
+}
+
 func parseAddress(data map[string]interface{}) domain.Address {
 	return domain.Address{
 		Street:     getString(data, "street"),
@@ -539,6 +724,19 @@ func parseAddress(data map[string]interface{}) domain.Address {
 	}
 }
 
+// parseLocale normalizes a client's preferred locale to a supported one. An
+// empty locale clears the preference.
+func parseLocale(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
+	}
+	normalized, ok := i18n.Normalize(locale)
+	if !ok {
+		return "", errors.InvalidArgument("unsupported locale: %s", locale)
+	}
+	return normalized, nil
+}
+
 func getString(data map[string]interface{}, key string) string {
 	if v, ok := data[key].(string); ok {
 		return v
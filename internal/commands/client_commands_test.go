@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func clientHistory(eventTypes ...string) []repository.StoredEvent {
+	history := make([]repository.StoredEvent, len(eventTypes))
+	for i, eventType := range eventTypes {
+		history[i] = repository.StoredEvent{EventType: eventType, Version: int64(i + 1)}
+	}
+	return history
+}
+
+func TestClientDeleted(t *testing.T) {
+	assert.False(t, clientDeleted(clientHistory("ClientCreated", "ClientUpdated")))
+	assert.True(t, clientDeleted(clientHistory("ClientCreated", "ClientDeleted")))
+	assert.False(t, clientDeleted(clientHistory("ClientCreated", "ClientDeleted", "ClientRestored")))
+	assert.True(t, clientDeleted(clientHistory("ClientCreated", "ClientDeleted", "ClientRestored", "ClientDeleted", "ClientUpdated")))
+}
+
+func TestClientPurged(t *testing.T) {
+	assert.False(t, clientPurged(nil))
+	assert.False(t, clientPurged(clientHistory("ClientCreated", "ClientDeleted")))
+	assert.True(t, clientPurged(clientHistory("ClientCreated", "ClientDeleted", "ClientPurged")))
+}
+
+func TestParseLocale(t *testing.T) {
+	locale, err := parseLocale("de-AT")
+	assert.NoError(t, err)
+	assert.Equal(t, "de", locale)
+
+	locale, err = parseLocale("")
+	assert.NoError(t, err)
+	assert.Empty(t, locale)
+
+	_, err = parseLocale("ja")
+	assert.EqualError(t, err, "unsupported locale: ja")
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/httpresponse"
 )
 
 type CommandEnvelope struct {
@@ -45,6 +46,14 @@ func (c *CommandEnvelope) WithExpectedVersion(version int64) *CommandEnvelope {
 	return c
 }
 
+// ParseIfMatch reads an expected version from an HTTP If-Match header such as
+// "3" or W/"3". It returns 0, which skips the version check, when the header
+// is absent or not a version.
+func ParseIfMatch(header string) int64 {
+	version, _ := httpresponse.ParseETag(header)
+	return version
+}
+
 func (c *CommandEnvelope) WithMetadata(key, value string) *CommandEnvelope {
 	if c.Metadata == nil {
 		c.Metadata = make(map[string]string)
@@ -71,8 +80,50 @@ func CommandFromJSON(data []byte) (*CommandEnvelope, error) {
 
 type CommandHandler func(ctx context.Context, cmd *CommandEnvelope) (interface{}, error)
 
+// CommandOutcome reports how a handled command finished. It is published on
+// Subject for the audit log, which records failed commands as well as the
+// events successful ones produce.
+type CommandOutcome struct {
+	CommandID     string    `json:"commandId"`
+	Type          string    `json:"type"`
+	TenantID      string    `json:"tenantId"`
+	TargetID      string    `json:"targetId,omitempty"`
+	UserID        string    `json:"userId"`
+	CorrelationID string    `json:"correlationId"`
+	Success       bool      `json:"success"`
+	Error         string    `json:"error,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	DurationMs    int64     `json:"durationMs"`
+}
+
+func NewCommandOutcome(cmd *CommandEnvelope, err error, duration time.Duration) *CommandOutcome {
+	outcome := &CommandOutcome{
+		CommandID:     cmd.ID,
+		Type:          cmd.Type,
+		TenantID:      cmd.TenantID,
+		TargetID:      cmd.TargetID,
+		UserID:        cmd.UserID,
+		CorrelationID: cmd.CorrelationID,
+		Success:       err == nil,
+		Timestamp:     time.Now().UTC(),
+		DurationMs:    duration.Milliseconds(),
+	}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+	return outcome
+}
+
+func (o *CommandOutcome) Subject() string {
+	return "cmdresult." + o.Type
+}
+
+// OutcomeObserver is called after the registry has handled a command.
+type OutcomeObserver func(ctx context.Context, outcome *CommandOutcome)
+
 type CommandHandlerRegistry struct {
-	handlers map[string]CommandHandler
+	handlers  map[string]CommandHandler
+	observers []OutcomeObserver
 }
 
 func NewCommandHandlerRegistry() *CommandHandlerRegistry {
@@ -90,12 +141,30 @@ func (r *CommandHandlerRegistry) GetHandler(commandType string) (CommandHandler,
 	return handler, ok
 }
 
+// OnOutcome adds an observer for every command Handle dispatches.
+func (r *CommandHandlerRegistry) OnOutcome(observer OutcomeObserver) {
+	r.observers = append(r.observers, observer)
+}
+
 func (r *CommandHandlerRegistry) Handle(ctx context.Context, cmd *CommandEnvelope) (interface{}, error) {
 	handler, ok := r.GetHandler(cmd.Type)
 	if !ok {
 		return nil, nil
 	}
-	return handler(ctx, cmd)
+	start := time.Now()
+	result, err := handler(ctx, cmd)
+	r.notify(ctx, cmd, err, time.Since(start))
+	return result, err
+}
+
+func (r *CommandHandlerRegistry) notify(ctx context.Context, cmd *CommandEnvelope, err error, duration time.Duration) {
+	if len(r.observers) == 0 {
+		return
+	}
+	outcome := NewCommandOutcome(cmd, err, duration)
+	for _, observer := range r.observers {
+		observer(ctx, outcome)
+	}
 }
 
 type CommandResult struct {
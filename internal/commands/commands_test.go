@@ -2,6 +2,7 @@ package commands_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/ims-erp/system/internal/commands"
@@ -126,6 +127,32 @@ func TestCommandHandlerRegistryNotFound(t *testing.T) {
 	assert.Nil(t, result)
 }
 
+func TestCommandHandlerRegistryOnOutcome(t *testing.T) {
+	registry := commands.NewCommandHandlerRegistry()
+	registry.Register("test.fail", func(ctx context.Context, cmd *commands.CommandEnvelope) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+
+	var outcomes []*commands.CommandOutcome
+	registry.OnOutcome(func(ctx context.Context, outcome *commands.CommandOutcome) {
+		outcomes = append(outcomes, outcome)
+	})
+
+	cmd := commands.NewCommand("test.fail", "tenant-1", "target-1", "user-1", nil)
+	_, err := registry.Handle(context.Background(), cmd)
+	assert.Error(t, err)
+
+	_, err = registry.Handle(context.Background(), &commands.CommandEnvelope{Type: "unknown"})
+	assert.NoError(t, err)
+
+	require.Len(t, outcomes, 1)
+	assert.Equal(t, cmd.ID, outcomes[0].CommandID)
+	assert.Equal(t, "user-1", outcomes[0].UserID)
+	assert.False(t, outcomes[0].Success)
+	assert.Equal(t, "boom", outcomes[0].Error)
+	assert.Equal(t, "cmdresult.test.fail", outcomes[0].Subject())
+}
+
 func TestCommandResult(t *testing.T) {
 	result := &commands.CommandResult{
 		Success: true,
@@ -162,3 +189,21 @@ func TestCommandEnvelopeMultipleDataFields(t *testing.T) {
 	assert.Equal(t, 25, cmd.Data["age"])
 	assert.Equal(t, true, cmd.Data["active"])
 }
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int64
+	}{
+		{"", 0},
+		{`"3"`, 3},
+		{`W/"7"`, 7},
+		{"12", 12},
+		{`"abc"`, 0},
+		{`"-1"`, 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, commands.ParseIfMatch(tt.header), tt.header)
+	}
+}
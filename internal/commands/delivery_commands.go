@@ -0,0 +1,398 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// CreateDeliveryRoute plans a vehicle's run from a warehouse on a delivery
+// date, formatted as YYYY-MM-DD. CapacityWeight and MaxStops of zero leave
+// the route unlimited.
+type CreateDeliveryRoute struct {
+	WarehouseID    uuid.UUID
+	Name           string
+	DeliveryDate   string
+	Vehicle        string
+	CapacityWeight decimal.Decimal
+	MaxStops       int
+}
+
+// AssignShipmentToRoute adds a shipment of an order to a planned route as
+// its last stop, optionally within a delivery slot. The stop is delivered
+// to the order's shipping address, asking for Recipient.
+type AssignShipmentToRoute struct {
+	RouteID    uuid.UUID
+	OrderID    uuid.UUID
+	ShipmentID uuid.UUID
+	Recipient  string
+	SlotStart  *time.Time
+	SlotEnd    *time.Time
+	Parcels    int
+	Notes      string
+}
+
+type UnassignShipmentFromRoute struct {
+	RouteID    uuid.UUID
+	ShipmentID uuid.UUID
+}
+
+// SequenceDeliveryRoute orders the stops of a route as ShipmentIDs lists
+// them, or by slot and postal code when it is empty.
+type SequenceDeliveryRoute struct {
+	RouteID     uuid.UUID
+	ShipmentIDs []uuid.UUID
+}
+
+type DispatchDeliveryRoute struct {
+	RouteID    uuid.UUID
+	DriverID   uuid.UUID
+	DriverName string
+}
+
+// ConfirmDelivery records a delivered shipment. ProofOfDeliveryID is the
+// photo the driver uploaded to the document service; DeliveredAt defaults
+// to now.
+type ConfirmDelivery struct {
+	RouteID           uuid.UUID
+	ShipmentID        uuid.UUID
+	ReceivedBy        string
+	ProofOfDeliveryID uuid.UUID
+	DeliveredAt       *time.Time
+}
+
+type FailDelivery struct {
+	RouteID    uuid.UUID
+	ShipmentID uuid.UUID
+	Reason     string
+}
+
+type DeliveryRouteRepository interface {
+	Create(ctx context.Context, route *domain.DeliveryRoute) error
+	FindByID(ctx context.Context, id uuid.UUID) (*domain.DeliveryRoute, error)
+	Update(ctx context.Context, route *domain.DeliveryRoute) error
+	// IsShipmentRouted reports whether a shipment is on a route it has not
+	// failed delivery on.
+	IsShipmentRouted(ctx context.Context, tenantID, shipmentID uuid.UUID) (bool, error)
+}
+
+// ProofOfDeliveryReader loads the proof of delivery photos drivers upload
+// to the document service. domain.DocumentRepository implements it.
+type ProofOfDeliveryReader interface {
+	GetByID(ctx context.Context, tenantID, id uuid.UUID) (*domain.Document, error)
+}
+
+// DeliveryCommandHandler plans delivery routes for shipments and tracks
+// them out for delivery until each is delivered or has failed.
+type DeliveryCommandHandler struct {
+	routeRepo DeliveryRouteRepository
+	orderRepo OrderRepository
+	documents ProofOfDeliveryReader
+	publisher events.Publisher
+}
+
+func NewDeliveryCommandHandler(
+	routeRepo DeliveryRouteRepository,
+	orderRepo OrderRepository,
+	documents ProofOfDeliveryReader,
+	publisher events.Publisher,
+) *DeliveryCommandHandler {
+	return &DeliveryCommandHandler{
+		routeRepo: routeRepo,
+		orderRepo: orderRepo,
+		documents: documents,
+		publisher: publisher,
+	}
+}
+
+func (h *DeliveryCommandHandler) HandleCreateDeliveryRoute(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input CreateDeliveryRoute
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	route, err := domain.NewDeliveryRoute(tenantID, input.WarehouseID, userID, input.Name, input.DeliveryDate, input.Vehicle, input.CapacityWeight, input.MaxStops)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.routeRepo.Create(ctx, route); err != nil {
+		return nil, fmt.Errorf("failed to create delivery route: %w", err)
+	}
+
+	evt := events.NewDeliveryRouteCreatedEvent(route, cmd.UserID)
+	return h.publish(ctx, route, &evt.EventEnvelope, evt)
+}
+
+func (h *DeliveryCommandHandler) HandleAssignShipmentToRoute(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input AssignShipmentToRoute
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	route, err := h.loadRoute(ctx, cmd, input.RouteID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := h.orderRepo.FindByID(ctx, input.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+	if order.TenantID != route.TenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "order does not belong to tenant")
+	}
+	shipment := order.FindFulfillment(input.ShipmentID)
+	if shipment == nil {
+		return nil, domain.ErrFulfillmentNotFound
+	}
+	if order.ShippingAddress == nil || order.ShippingAddress.IsEmpty() {
+		return nil, errors.InvalidArgument("order %s has no shipping address", order.ID)
+	}
+
+	routed, err := h.routeRepo.IsShipmentRouted(ctx, route.TenantID, shipment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check shipment routes: %w", err)
+	}
+	if routed {
+		return nil, domain.ErrShipmentAlreadyRouted
+	}
+
+	parcels := input.Parcels
+	if parcels <= 0 {
+		parcels = 1
+	}
+	stop, err := route.AddStop(domain.DeliveryStop{
+		OrderID:            order.ID,
+		OrderNumber:        order.OrderNumber,
+		ShipmentID:         shipment.ID,
+		TrackingNumber:     shipment.TrackingNumber,
+		DeliveryNoteNumber: shipment.DeliveryNoteNumber,
+		Recipient:          strings.TrimSpace(input.Recipient),
+		Address:            *order.ShippingAddress,
+		Weight:             order.FulfillmentWeight(shipment),
+		Parcels:            parcels,
+		SlotStart:          input.SlotStart,
+		SlotEnd:            input.SlotEnd,
+		Notes:              strings.TrimSpace(input.Notes),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.save(ctx, route); err != nil {
+		return nil, err
+	}
+
+	evt := events.NewShipmentRoutedEvent(route, stop, cmd.UserID)
+	return h.publish(ctx, route, &evt.EventEnvelope, evt)
+}
+
+func (h *DeliveryCommandHandler) HandleUnassignShipmentFromRoute(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input UnassignShipmentFromRoute
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	route, err := h.loadRoute(ctx, cmd, input.RouteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := route.RemoveStop(input.ShipmentID); err != nil {
+		return nil, err
+	}
+
+	if err := h.save(ctx, route); err != nil {
+		return nil, err
+	}
+
+	evt := events.NewShipmentUnassignedEvent(route, input.ShipmentID, cmd.UserID)
+	return h.publish(ctx, route, &evt.EventEnvelope, evt)
+}
+
+func (h *DeliveryCommandHandler) HandleSequenceDeliveryRoute(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input SequenceDeliveryRoute
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	route, err := h.loadRoute(ctx, cmd, input.RouteID)
+	if err != nil {
+		return nil, err
+	}
+	if len(input.ShipmentIDs) == 0 {
+		err = route.PlanSequence()
+	} else {
+		err = route.SequenceStops(input.ShipmentIDs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.save(ctx, route); err != nil {
+		return nil, err
+	}
+
+	evt := events.NewDeliveryRouteSequencedEvent(route, cmd.UserID)
+	return h.publish(ctx, route, &evt.EventEnvelope, evt)
+}
+
+func (h *DeliveryCommandHandler) HandleDispatchDeliveryRoute(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input DispatchDeliveryRoute
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+	if input.DriverID == uuid.Nil {
+		return nil, errors.InvalidArgument("driverId is required")
+	}
+
+	route, err := h.loadRoute(ctx, cmd, input.RouteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := route.Dispatch(input.DriverID, input.DriverName); err != nil {
+		return nil, err
+	}
+
+	if err := h.save(ctx, route); err != nil {
+		return nil, err
+	}
+
+	evt := events.NewDeliveryRouteDispatchedEvent(route, cmd.UserID)
+	return h.publish(ctx, route, &evt.EventEnvelope, evt)
+}
+
+// HandleConfirmDelivery records a delivered shipment on its route and on
+// its order. The proof of delivery must be an image the tenant uploaded to
+// the document service.
+func (h *DeliveryCommandHandler) HandleConfirmDelivery(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input ConfirmDelivery
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+	if input.ProofOfDeliveryID == uuid.Nil {
+		return nil, domain.ErrProofOfDeliveryRequired
+	}
+
+	route, err := h.loadRoute(ctx, cmd, input.RouteID)
+	if err != nil {
+		return nil, err
+	}
+
+	photo, err := h.documents.GetByID(ctx, route.TenantID, input.ProofOfDeliveryID)
+	if err != nil || photo == nil || photo.IsDeleted() {
+		return nil, errors.InvalidArgument("proof of delivery %s not found", input.ProofOfDeliveryID)
+	}
+	if !strings.HasPrefix(photo.MimeType, "image/") {
+		return nil, errors.InvalidArgument("proof of delivery must be a photo, not %s", photo.MimeType)
+	}
+
+	deliveredAt := time.Now().UTC()
+	if input.DeliveredAt != nil {
+		deliveredAt = *input.DeliveredAt
+	}
+	stop, err := route.Deliver(input.ShipmentID, input.ReceivedBy, photo.ID, deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := h.orderRepo.FindByID(ctx, stop.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+	if err := order.DeliverShipment(stop.ShipmentID, deliveredAt); err != nil {
+		return nil, err
+	}
+
+	if err := h.save(ctx, route); err != nil {
+		return nil, err
+	}
+	if err := h.orderRepo.Update(ctx, order); err != nil {
+		return nil, fmt.Errorf("failed to record delivery on order: %w", err)
+	}
+
+	evt := events.NewShipmentDeliveredEvent(route, stop, cmd.UserID)
+	return h.publish(ctx, route, &evt.EventEnvelope, evt)
+}
+
+func (h *DeliveryCommandHandler) HandleFailDelivery(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input FailDelivery
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	route, err := h.loadRoute(ctx, cmd, input.RouteID)
+	if err != nil {
+		return nil, err
+	}
+	stop, err := route.FailStop(input.ShipmentID, input.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.save(ctx, route); err != nil {
+		return nil, err
+	}
+
+	evt := events.NewShipmentDeliveryFailedEvent(route, stop, cmd.UserID)
+	return h.publish(ctx, route, &evt.EventEnvelope, evt)
+}
+
+// loadRoute loads a route of the command's tenant at the version the
+// command expects.
+func (h *DeliveryCommandHandler) loadRoute(ctx context.Context, cmd *CommandEnvelope, routeID uuid.UUID) (*domain.DeliveryRoute, error) {
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	if _, err := uuid.Parse(cmd.UserID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	route, err := h.routeRepo.FindByID(ctx, routeID)
+	if err != nil {
+		return nil, errors.NotFound("delivery route not found")
+	}
+	if route.TenantID != tenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "delivery route does not belong to tenant")
+	}
+	if err := checkExpectedVersion(cmd, "delivery route", route.Version); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+func (h *DeliveryCommandHandler) save(ctx context.Context, route *domain.DeliveryRoute) error {
+	version := route.Version
+	if err := h.routeRepo.Update(ctx, route); err != nil {
+		return asVersionConflict(fmt.Errorf("failed to update delivery route: %w", err), "delivery route", version)
+	}
+	return nil
+}
+
+func (h *DeliveryCommandHandler) publish(ctx context.Context, route *domain.DeliveryRoute, envelope *events.EventEnvelope, evt interface{}) (*CommandResult, error) {
+	if err := h.publisher.PublishEvent(ctx, envelope); err != nil {
+		return nil, fmt.Errorf("failed to publish event: %w", err)
+	}
+	return &CommandResult{
+		Success: true,
+		Data:    route,
+		Events:  []interface{}{evt},
+	}, nil
+}
@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MockDeliveryRouteRepository struct {
+	routes map[uuid.UUID]*domain.DeliveryRoute
+}
+
+func (r *MockDeliveryRouteRepository) Create(ctx context.Context, route *domain.DeliveryRoute) error {
+	r.routes[route.ID] = route
+	return nil
+}
+
+func (r *MockDeliveryRouteRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.DeliveryRoute, error) {
+	if route, ok := r.routes[id]; ok {
+		return route, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *MockDeliveryRouteRepository) Update(ctx context.Context, route *domain.DeliveryRoute) error {
+	route.Version++
+	r.routes[route.ID] = route
+	return nil
+}
+
+func (r *MockDeliveryRouteRepository) IsShipmentRouted(ctx context.Context, tenantID, shipmentID uuid.UUID) (bool, error) {
+	for _, route := range r.routes {
+		if stop := route.FindStop(shipmentID); route.TenantID == tenantID && stop != nil && stop.Status != domain.DeliveryStopStatusFailed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type MockDocumentReader struct {
+	documents map[uuid.UUID]*domain.Document
+}
+
+func (r *MockDocumentReader) GetByID(ctx context.Context, tenantID, id uuid.UUID) (*domain.Document, error) {
+	if doc, ok := r.documents[id]; ok && doc.TenantID == tenantID {
+		return doc, nil
+	}
+	return nil, domain.ErrDocumentNotFound
+}
+
+// newDeliveryFixture returns a handler with a planned route and a shipped
+// order of 4 units of 2.5 kg in one shipment.
+func newDeliveryFixture(t *testing.T) (*DeliveryCommandHandler, *domain.DeliveryRoute, *domain.Order, *MockDocumentReader, *MockPublisher) {
+	tenantID := uuid.New()
+	route, err := domain.NewDeliveryRoute(tenantID, uuid.New(), uuid.New(), "North", "2026-10-17", "VAN-12", decimal.NewFromInt(25), 0)
+	require.NoError(t, err)
+
+	order, _ := domain.NewOrder(tenantID, uuid.New(), uuid.New(), domain.OrderTypeStandard, domain.OrderSourceWeb, "EUR")
+	order.OrderNumber = "SO-2026-000042"
+	order.SetShippingAddress(&domain.Address{Street: "1 Vitosha Blvd", City: "Sofia", PostalCode: "1000", Country: "BG"})
+	order.AddLine(domain.OrderLine{ProductID: uuid.New(), Quantity: 4, UnitPrice: decimal.NewFromInt(10), Weight: decimal.RequireFromString("2.5")})
+	order.Fulfillments = append(order.Fulfillments, domain.OrderFulfillment{
+		ID:             uuid.New(),
+		TrackingNumber: "TRK-1",
+		Lines:          []domain.FulfillmentLine{{OrderLineID: order.Lines[0].ID, Quantity: 4}},
+	})
+	order.Ship("TRK-1", "own fleet")
+
+	documents := &MockDocumentReader{documents: make(map[uuid.UUID]*domain.Document)}
+	publisher := &MockPublisher{}
+	handler := NewDeliveryCommandHandler(
+		&MockDeliveryRouteRepository{routes: map[uuid.UUID]*domain.DeliveryRoute{route.ID: route}},
+		&MockOrderRepository{orders: map[uuid.UUID]*domain.Order{order.ID: order}},
+		documents,
+		publisher,
+	)
+	return handler, route, order, documents, publisher
+}
+
+func TestDeliveryCommandHandler_AssignShipment(t *testing.T) {
+	handler, route, order, _, publisher := newDeliveryFixture(t)
+	tenantID := route.TenantID.String()
+	slotEnd := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	assign := map[string]interface{}{
+		"routeId":    route.ID.String(),
+		"orderId":    order.ID.String(),
+		"shipmentId": order.Fulfillments[0].ID.String(),
+		"recipient":  "Maria Petrova",
+		"slotEnd":    slotEnd.Format(time.RFC3339),
+		"parcels":    2,
+	}
+	result, err := handler.HandleAssignShipmentToRoute(context.Background(), NewCommand("assignShipmentToRoute", tenantID, "", uuid.New().String(), assign))
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	require.Len(t, route.Stops, 1)
+	stop := route.Stops[0]
+	assert.Equal(t, "SO-2026-000042", stop.OrderNumber)
+	assert.Equal(t, "Sofia", stop.Address.City)
+	assert.Equal(t, "10", stop.Weight.String())
+	assert.Equal(t, 2, stop.Parcels)
+	assert.True(t, slotEnd.Equal(*stop.SlotEnd))
+	assert.Equal(t, "delivery_route.shipment_assigned", publisher.events[0].Type)
+
+	_, err = handler.HandleAssignShipmentToRoute(context.Background(), NewCommand("assignShipmentToRoute", tenantID, "", uuid.New().String(), assign))
+	assert.Equal(t, domain.ErrShipmentAlreadyRouted, err)
+
+	_, err = handler.HandleAssignShipmentToRoute(context.Background(), NewCommand("assignShipmentToRoute", uuid.New().String(), "", uuid.New().String(), assign))
+	assert.Error(t, err, "another tenant's route")
+}
+
+func TestDeliveryCommandHandler_ConfirmDelivery(t *testing.T) {
+	handler, route, order, documents, publisher := newDeliveryFixture(t)
+	tenantID := route.TenantID.String()
+	shipmentID := order.Fulfillments[0].ID.String()
+
+	_, err := handler.HandleAssignShipmentToRoute(context.Background(), NewCommand("assignShipmentToRoute", tenantID, "", uuid.New().String(), map[string]interface{}{
+		"routeId": route.ID.String(), "orderId": order.ID.String(), "shipmentId": shipmentID,
+	}))
+	require.NoError(t, err)
+	_, err = handler.HandleDispatchDeliveryRoute(context.Background(), NewCommand("dispatchDeliveryRoute", tenantID, "", uuid.New().String(), map[string]interface{}{
+		"routeId": route.ID.String(), "driverId": uuid.New().String(), "driverName": "Ivan",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, domain.DeliveryStopStatusOutForDelivery, route.Stops[0].Status)
+
+	receipt := &domain.Document{ID: uuid.New(), TenantID: route.TenantID, Type: domain.DocTypeReceipt, MimeType: "application/pdf"}
+	photo := &domain.Document{ID: uuid.New(), TenantID: route.TenantID, Type: domain.DocTypeProofOfDelivery, MimeType: "image/jpeg"}
+	documents.documents[receipt.ID] = receipt
+	documents.documents[photo.ID] = photo
+
+	confirm := map[string]interface{}{
+		"routeId":           route.ID.String(),
+		"shipmentId":        shipmentID,
+		"receivedBy":        "Maria Petrova",
+		"proofOfDeliveryId": receipt.ID.String(),
+	}
+	_, err = handler.HandleConfirmDelivery(context.Background(), NewCommand("confirmDelivery", tenantID, "", uuid.New().String(), confirm))
+	assert.Error(t, err, "the proof of delivery must be a photo")
+
+	confirm["proofOfDeliveryId"] = uuid.New().String()
+	_, err = handler.HandleConfirmDelivery(context.Background(), NewCommand("confirmDelivery", tenantID, "", uuid.New().String(), confirm))
+	assert.Error(t, err, "the photo must have been uploaded")
+
+	confirm["proofOfDeliveryId"] = photo.ID.String()
+	result, err := handler.HandleConfirmDelivery(context.Background(), NewCommand("confirmDelivery", tenantID, "", uuid.New().String(), confirm))
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	assert.Equal(t, domain.DeliveryStopStatusDelivered, route.Stops[0].Status)
+	assert.Equal(t, photo.ID, *route.Stops[0].ProofOfDeliveryID)
+	assert.Equal(t, domain.DeliveryRouteStatusCompleted, route.Status)
+	assert.Equal(t, domain.OrderStatusDelivered, order.Status)
+
+	last := publisher.events[len(publisher.events)-1]
+	assert.Equal(t, "delivery_route.shipment_delivered", last.Type)
+	assert.Equal(t, "completed", last.Data["routeStatus"])
+}
+
+func TestDeliveryCommandHandler_SequenceRejectsStaleVersion(t *testing.T) {
+	handler, route, _, _, _ := newDeliveryFixture(t)
+	route.Version = 3
+
+	cmd := NewCommand("sequenceDeliveryRoute", route.TenantID.String(), "", uuid.New().String(), map[string]interface{}{
+		"routeId": route.ID.String(),
+	})
+	cmd.ExpectedVersion = 2
+
+	_, err := handler.HandleSequenceDeliveryRoute(context.Background(), cmd)
+	assert.Error(t, err)
+}
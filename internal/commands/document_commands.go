@@ -39,6 +39,10 @@ type DeleteDocument struct {
 	Force      bool
 }
 
+type RestoreDocument struct {
+	DocumentID uuid.UUID
+}
+
 type UpdateDocumentMetadata struct {
 	DocumentID uuid.UUID
 	Tags       []string
@@ -163,6 +167,7 @@ func (h *DocumentCommandHandler) HandleUploadDocument(ctx context.Context, cmd *
 		UploadedBy:       userID,
 		CreatedAt:        time.Now().UTC(),
 		UpdatedAt:        time.Now().UTC(),
+		Version:          1,
 	}
 
 	if err := h.docRepo.Create(ctx, doc); err != nil {
@@ -188,10 +193,16 @@ func (h *DocumentCommandHandler) HandleUploadDocument(ctx context.Context, cmd *
 		doc.ThumbnailKey = processedDoc.ThumbnailKey
 		doc.PageCount = processedDoc.PageCount
 		doc.ExtractedMetadata = processedDoc.ExtractedMetadata
-		doc.ProcessingStatus = domain.ProcessingStatusCompleted
+		doc.ProcessingStatus = processedDoc.ProcessingStatus
+		doc.ProcessingError = processedDoc.ProcessingError
 		doc.UpdatedAt = time.Now().UTC()
 
 		h.docRepo.Update(processCtx, doc)
+		if doc.ProcessingStatus == domain.ProcessingStatusFailed {
+			evt := events.NewDocumentProcessingFailedEvent(doc.ID.String(), doc.TenantID.String(), cmd.UserID, doc.ProcessingError)
+			h.publisher.PublishEvent(processCtx, &evt.EventEnvelope)
+			return
+		}
 		h.searchService.IndexDocument(processCtx, doc)
 
 		evt := events.NewDocumentProcessingCompletedEvent(doc, cmd.UserID)
@@ -254,7 +265,7 @@ func (h *DocumentCommandHandler) HandleGeneratePresignedUploadURL(ctx context.Co
 		expiry = 15 * time.Minute
 	}
 
-	uploadURL, err := h.storageService.GetPresignedUploadURL(ctx, bucket, objectKey, input.MimeType, expiry)
+	uploadURL, err := h.storageService.GetPresignedUploadURL(ctx, bucket, objectKey, input.MimeType, input.Size, expiry)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
@@ -272,16 +283,18 @@ func (h *DocumentCommandHandler) HandleGeneratePresignedUploadURL(ctx context.Co
 		ProcessingStatus: domain.ProcessingStatusPending,
 		CreatedAt:        time.Now().UTC(),
 		UpdatedAt:        time.Now().UTC(),
+		Version:          1,
 	}
 
 	return &CommandResult{
 		Success: true,
 		Data: map[string]interface{}{
-			"uploadUrl":  uploadURL,
-			"documentId": doc.ID.String(),
-			"bucket":     bucket,
-			"objectKey":  objectKey,
-			"expiresIn":  expiry.Seconds(),
+			"uploadUrl":       uploadURL,
+			"requiredHeaders": domain.UploadHeaders(input.MimeType, input.Size),
+			"documentId":      doc.ID.String(),
+			"bucket":          bucket,
+			"objectKey":       objectKey,
+			"expiresIn":       expiry.Seconds(),
 		},
 	}, nil
 }
@@ -331,6 +344,7 @@ func (h *DocumentCommandHandler) HandleCompleteUpload(ctx context.Context, cmd *
 		UploadedBy:       userID,
 		CreatedAt:        time.Now().UTC(),
 		UpdatedAt:        time.Now().UTC(),
+		Version:          1,
 	}
 
 	if err := h.docRepo.Create(ctx, doc); err != nil {
@@ -356,10 +370,16 @@ func (h *DocumentCommandHandler) HandleCompleteUpload(ctx context.Context, cmd *
 		doc.ThumbnailKey = processedDoc.ThumbnailKey
 		doc.PageCount = processedDoc.PageCount
 		doc.ExtractedMetadata = processedDoc.ExtractedMetadata
-		doc.ProcessingStatus = domain.ProcessingStatusCompleted
+		doc.ProcessingStatus = processedDoc.ProcessingStatus
+		doc.ProcessingError = processedDoc.ProcessingError
 		doc.UpdatedAt = time.Now().UTC()
 
 		h.docRepo.Update(processCtx, doc)
+		if doc.ProcessingStatus == domain.ProcessingStatusFailed {
+			evt := events.NewDocumentProcessingFailedEvent(doc.ID.String(), doc.TenantID.String(), cmd.UserID, doc.ProcessingError)
+			h.publisher.PublishEvent(processCtx, &evt.EventEnvelope)
+			return
+		}
 		h.searchService.IndexDocument(processCtx, doc)
 
 		evt := events.NewDocumentProcessingCompletedEvent(doc, cmd.UserID)
@@ -379,7 +399,8 @@ func (h *DocumentCommandHandler) HandleCompleteUpload(ctx context.Context, cmd *
 	}, nil
 }
 
-// HandleDeleteDocument handles document deletion
+// HandleDeleteDocument moves a document to the trash, or removes it and its
+// stored objects permanently when Force is set.
 func (h *DocumentCommandHandler) HandleDeleteDocument(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
 	var input DeleteDocument
 	if err := parseCommandData(cmd, &input); err != nil {
@@ -404,7 +425,7 @@ func (h *DocumentCommandHandler) HandleDeleteDocument(ctx context.Context, cmd *
 		}
 
 		if doc.ThumbnailKey != "" {
-			h.storageService.Delete(ctx, doc.Bucket+"-thumbnails", doc.ThumbnailKey)
+			h.storageService.Delete(ctx, doc.Bucket, doc.ThumbnailKey)
 		}
 	}
 
@@ -414,13 +435,19 @@ func (h *DocumentCommandHandler) HandleDeleteDocument(ctx context.Context, cmd *
 		_ = err
 	}
 
-	// Delete document record
-	if err := h.docRepo.Delete(ctx, tenantID, input.DocumentID); err != nil {
+	// Delete document record, or keep it in the trash until it is purged
+	if input.Force {
+		err = h.docRepo.Delete(ctx, tenantID, input.DocumentID)
+	} else {
+		err = h.docRepo.SoftDelete(ctx, tenantID, input.DocumentID, cmd.UserID)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to delete document: %w", err)
 	}
 
 	// Publish event
 	evt := events.NewDocumentDeletedEvent(input.DocumentID.String(), tenantID.String(), cmd.UserID)
+	evt.Data["permanent"] = input.Force
 	if err := h.publisher.PublishEvent(ctx, &evt.EventEnvelope); err != nil {
 		return nil, fmt.Errorf("failed to publish event: %w", err)
 	}
@@ -432,6 +459,40 @@ func (h *DocumentCommandHandler) HandleDeleteDocument(ctx context.Context, cmd *
 	}, nil
 }
 
+// HandleRestoreDocument takes a document back out of the trash
+func (h *DocumentCommandHandler) HandleRestoreDocument(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input RestoreDocument
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant ID: %w", err)
+	}
+
+	doc, err := h.docRepo.Restore(ctx, tenantID, input.DocumentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore document: %w", err)
+	}
+
+	if err := h.searchService.IndexDocument(ctx, doc); err != nil {
+		// Log but don't fail
+		_ = err
+	}
+
+	evt := events.NewDocumentRestoredEvent(doc, cmd.UserID)
+	if err := h.publisher.PublishEvent(ctx, &evt.EventEnvelope); err != nil {
+		return nil, fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return &CommandResult{
+		Success: true,
+		Data:    doc,
+		Events:  []interface{}{evt},
+	}, nil
+}
+
 // HandleUpdateDocumentMetadata updates document metadata
 func (h *DocumentCommandHandler) HandleUpdateDocumentMetadata(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
 	var input UpdateDocumentMetadata
@@ -522,10 +583,16 @@ func (h *DocumentCommandHandler) HandleReprocessDocument(ctx context.Context, cm
 		doc.ThumbnailKey = processedDoc.ThumbnailKey
 		doc.PageCount = processedDoc.PageCount
 		doc.ExtractedMetadata = processedDoc.ExtractedMetadata
-		doc.ProcessingStatus = domain.ProcessingStatusCompleted
+		doc.ProcessingStatus = processedDoc.ProcessingStatus
+		doc.ProcessingError = processedDoc.ProcessingError
 		doc.UpdatedAt = time.Now().UTC()
 
 		h.docRepo.Update(processCtx, doc)
+		if doc.ProcessingStatus == domain.ProcessingStatusFailed {
+			evt := events.NewDocumentProcessingFailedEvent(doc.ID.String(), doc.TenantID.String(), cmd.UserID, doc.ProcessingError)
+			h.publisher.PublishEvent(processCtx, &evt.EventEnvelope)
+			return
+		}
 		h.searchService.IndexDocument(processCtx, doc)
 
 		evt := events.NewDocumentProcessingCompletedEvent(doc, cmd.UserID)
@@ -2,12 +2,12 @@ package commands
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ims-erp/system/internal/domain"
 	eventpkg "github.com/ims-erp/system/internal/events"
-	"github.com/ims-erp/system/internal/repository"
 	"github.com/ims-erp/system/pkg/errors"
 	"github.com/ims-erp/system/pkg/logger"
 	"github.com/shopspring/decimal"
@@ -15,15 +15,25 @@ import (
 
 type InvoiceCommandHandler struct {
 	invoiceRepo    InvoiceRepository
-	eventStore     *repository.EventStore
+	eventStore     EventStore
 	publisher      Publisher
+	outbox         EventOutbox
 	logger         *logger.Logger
 	invoiceCounter InvoiceCounter
+	taxPeriods     TaxPeriodLocks
+	converter      CurrencyConverter
+	reminders      ReminderSuppressions
+	billing        ConsolidatedBillingRepository
+	location       func(tenantID string) *time.Location
 }
 
 type InvoiceRepository interface {
 	Create(ctx context.Context, invoice *domain.Invoice) error
 	Update(ctx context.Context, invoice *domain.Invoice) error
+	// UpdateVersions saves invoice in one conditional write if it is still
+	// at invoice.Version, advancing it by versions, and reports
+	// repository.ErrConcurrencyConflict otherwise.
+	UpdateVersions(ctx context.Context, invoice *domain.Invoice, versions int64) error
 	FindByID(ctx context.Context, id uuid.UUID) (*domain.Invoice, error)
 	FindByInvoiceNumber(ctx context.Context, tenantID uuid.UUID, invoiceNumber string) (*domain.Invoice, error)
 	FindByClientID(ctx context.Context, clientID uuid.UUID, limit, offset int) ([]*domain.Invoice, error)
@@ -33,9 +43,32 @@ type InvoiceCounter interface {
 	GetNextInvoiceNumber(ctx context.Context, tenantID uuid.UUID, year int) (string, error)
 }
 
+// TaxPeriodLocks finds the VAT periods a tenant has filed returns for.
+// repository.TaxReturnStore implements it.
+type TaxPeriodLocks interface {
+	// FiledPeriod returns the filed period at falls in, or "".
+	FiledPeriod(ctx context.Context, tenantID uuid.UUID, at time.Time) (string, error)
+}
+
+// CurrencyConverter converts amounts into a tenant's reporting currency.
+// fx.Service implements it.
+type CurrencyConverter interface {
+	// ToReportingCurrency converts amount at the rate of at, or returns nil
+	// when the tenant has no reporting currency.
+	ToReportingCurrency(ctx context.Context, tenantID uuid.UUID, amount decimal.Decimal, currency string, at time.Time) (*domain.CurrencyConversion, error)
+}
+
+// ReminderSuppressions finds the suppressions stopping the payment
+// reminders of invoices. repository.ReminderSuppressionStore implements it.
+type ReminderSuppressions interface {
+	// Active returns the suppression stopping the reminders of the
+	// client's invoice, or nil.
+	Active(ctx context.Context, tenantID, clientID, invoiceID uuid.UUID) (*domain.ReminderSuppression, error)
+}
+
 func NewInvoiceCommandHandler(
 	invoiceRepo InvoiceRepository,
-	eventStore *repository.EventStore,
+	eventStore EventStore,
 	publisher Publisher,
 	log *logger.Logger,
 	invoiceCounter InvoiceCounter,
@@ -49,6 +82,107 @@ func NewInvoiceCommandHandler(
 	}
 }
 
+// WithOutbox routes events through the transactional outbox instead of
+// publishing them directly.
+func (h *InvoiceCommandHandler) WithOutbox(outbox EventOutbox) *InvoiceCommandHandler {
+	h.outbox = outbox
+	return h
+}
+
+// WithTaxPeriodLocks rejects invoices being issued or voided in VAT
+// periods that were filed, which would change the filed return.
+func (h *InvoiceCommandHandler) WithTaxPeriodLocks(locks TaxPeriodLocks) *InvoiceCommandHandler {
+	h.taxPeriods = locks
+	return h
+}
+
+// WithCurrencyConverter records the total of invoices in the tenant's
+// reporting currency when they are finalized.
+func (h *InvoiceCommandHandler) WithCurrencyConverter(converter CurrencyConverter) *InvoiceCommandHandler {
+	h.converter = converter
+	return h
+}
+
+// WithReminderSuppressions refuses payment reminders for invoices whose
+// reminders, or whose client's, are suppressed.
+func (h *InvoiceCommandHandler) WithReminderSuppressions(suppressions ReminderSuppressions) *InvoiceCommandHandler {
+	h.reminders = suppressions
+	return h
+}
+
+// convert records the invoice total in the reporting currency at the rate
+// of its issue date. Invoicing does not wait for rates: without one the
+// invoice is left unconverted.
+func (h *InvoiceCommandHandler) convert(ctx context.Context, invoice *domain.Invoice) {
+	if h.converter == nil {
+		return
+	}
+	conversion, err := h.converter.ToReportingCurrency(ctx, invoice.TenantID, invoice.Total, invoice.Currency, invoice.IssueDate)
+	if err != nil {
+		h.logger.New(ctx).Warn("Failed to convert invoice total", "invoice_id", invoice.ID, "currency", invoice.Currency, "error", err)
+		return
+	}
+	invoice.Conversion = conversion
+}
+
+// conversionData is a conversion as carried by invoice and payment events,
+// with the amount and rate as decimal strings.
+func conversionData(conversion *domain.CurrencyConversion) map[string]interface{} {
+	return map[string]interface{}{
+		"currency": conversion.Currency,
+		"amount":   conversion.Amount.String(),
+		"rate":     conversion.Rate.String(),
+		"rateDate": conversion.RateDate,
+		"source":   conversion.Source,
+	}
+}
+
+// checkTaxPeriod rejects a change to the VAT of an invoice issued at
+// issueDate once its period is filed.
+func (h *InvoiceCommandHandler) checkTaxPeriod(ctx context.Context, tenantID uuid.UUID, issueDate time.Time) error {
+	if h.taxPeriods == nil {
+		return nil
+	}
+	period, err := h.taxPeriods.FiledPeriod(ctx, tenantID, issueDate)
+	if err != nil {
+		return errors.Wrap(err, errors.CodeInternalError, "failed to check VAT period")
+	}
+	if period != "" {
+		return errors.Newf(errors.CodeUnprocessable, "VAT return for %s is filed; invoices issued in it cannot change", period)
+	}
+	return nil
+}
+
+// commit runs write and publishes events stamped with version, the invoice
+// version write produces, so read models can serve it as the ETag.
+func (h *InvoiceCommandHandler) commit(ctx context.Context, version int64, write func(ctx context.Context) error, events ...*eventpkg.EventEnvelope) error {
+	for _, event := range events {
+		event.Version = version
+	}
+	return asVersionConflict(commitEvents(ctx, h.outbox, h.publisher, h.logger, write, events...), "invoice", version-1)
+}
+
+// numberInvoiceEvents versions the events of invoice among events one after
+// another, from the version after the invoice's, and returns how many
+// there are. saveInvoiceVersions then saves the invoice at the last one.
+func numberInvoiceEvents(invoice *domain.Invoice, events []*eventpkg.EventEnvelope) int {
+	n := 0
+	for _, event := range events {
+		if event.AggregateID == invoice.ID.String() {
+			n++
+			event.Version = invoice.Version + int64(n)
+		}
+	}
+	return n
+}
+
+// saveInvoiceVersions saves invoice at the version of the last of its
+// events, so the next command's events follow them. The write is a single
+// conditional one: a conflict leaves the stored version where it was.
+func saveInvoiceVersions(ctx context.Context, repo InvoiceRepository, invoice *domain.Invoice, versions int) error {
+	return repo.UpdateVersions(ctx, invoice, int64(max(versions, 1)))
+}
+
 func (h *InvoiceCommandHandler) HandleCreateInvoice(ctx context.Context, cmd *CommandEnvelope) (*domain.Invoice, error) {
 	data := cmd.Data
 
@@ -89,6 +223,10 @@ func (h *InvoiceCommandHandler) HandleCreateInvoice(ctx context.Context, cmd *Co
 		}
 	}
 
+	if err := h.checkTaxPeriod(ctx, tenantID, issueDate); err != nil {
+		return nil, err
+	}
+
 	invoice, err := domain.NewInvoice(
 		tenantID,
 		clientID,
@@ -126,38 +264,19 @@ func (h *InvoiceCommandHandler) HandleCreateInvoice(ctx context.Context, cmd *Co
 		return nil, errors.InternalError("failed to generate invoice number")
 	}
 	invoice.SetInvoiceNumber(invoiceNumber)
+	// Versions start at 1 so that the first ETag handed out can be checked;
+	// an expected version of 0 means no check.
+	invoice.Version = 1
+
+	event := createdEvent(cmd, invoice)
 
-	if err := h.invoiceRepo.Create(ctx, invoice); err != nil {
+	if err := h.commit(ctx, invoice.Version, func(ctx context.Context) error {
+		return h.invoiceRepo.Create(ctx, invoice)
+	}, event); err != nil {
 		h.logger.New(ctx).Error("Failed to create invoice", "error", err)
 		return nil, errors.InternalError("failed to create invoice")
 	}
 
-	event := eventpkg.NewEvent(
-		invoice.ID.String(),
-		"invoice",
-		"invoice.created",
-		cmd.TenantID,
-		cmd.UserID,
-		map[string]interface{}{
-			"invoiceNumber": invoice.InvoiceNumber,
-			"clientId":      invoice.ClientID.String(),
-			"type":          string(invoice.Type),
-			"currency":      invoice.Currency,
-			"subtotal":      invoice.Subtotal.String(),
-			"taxTotal":      invoice.TaxTotal.String(),
-			"total":         invoice.Total.String(),
-			"paymentTerm":   string(invoice.PaymentTerm),
-			"status":        string(invoice.Status),
-			"notes":         invoice.Notes,
-			"terms":         invoice.Terms,
-		},
-	)
-	event.WithCorrelationID(cmd.CorrelationID)
-
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish invoice created event", "error", err)
-	}
-
 	h.logger.New(ctx).Info("Invoice created",
 		"invoice_id", invoice.ID,
 		"invoice_number", invoice.InvoiceNumber,
@@ -168,6 +287,39 @@ func (h *InvoiceCommandHandler) HandleCreateInvoice(ctx context.Context, cmd *Co
 	return invoice, nil
 }
 
+// createdEvent is the invoice.created event of invoice.
+func createdEvent(cmd *CommandEnvelope, invoice *domain.Invoice) *eventpkg.EventEnvelope {
+	data := map[string]interface{}{
+		"invoiceNumber": invoice.InvoiceNumber,
+		"clientId":      invoice.ClientID.String(),
+		"type":          string(invoice.Type),
+		"currency":      invoice.Currency,
+		"subtotal":      invoice.Subtotal.String(),
+		"taxTotal":      invoice.TaxTotal.String(),
+		"total":         invoice.Total.String(),
+		"paymentTerm":   string(invoice.PaymentTerm),
+		"status":        string(invoice.Status),
+		"issueDate":     invoice.IssueDate,
+		"dueDate":       invoice.DueDate,
+		"notes":         invoice.Notes,
+		"terms":         invoice.Terms,
+	}
+	if invoice.BillingPeriod != "" {
+		data["billingPeriod"] = invoice.BillingPeriod
+	}
+
+	event := eventpkg.NewEvent(
+		invoice.ID.String(),
+		"invoice",
+		"invoice.created",
+		cmd.TenantID,
+		cmd.UserID,
+		data,
+	)
+	event.WithCorrelationID(cmd.CorrelationID)
+	return event
+}
+
 func (h *InvoiceCommandHandler) HandleAddLineItem(ctx context.Context, cmd *CommandEnvelope) (*domain.Invoice, error) {
 	data := cmd.Data
 
@@ -190,6 +342,10 @@ func (h *InvoiceCommandHandler) HandleAddLineItem(ctx context.Context, cmd *Comm
 		return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "invoice", invoice.Version); err != nil {
+		return nil, err
+	}
+
 	if invoice.Status != domain.InvoiceStatusDraft {
 		return nil, errors.InvalidArgument("can only add lines to draft invoices")
 	}
@@ -228,6 +384,7 @@ func (h *InvoiceCommandHandler) HandleAddLineItem(ctx context.Context, cmd *Comm
 		UnitPrice:   unitPrice,
 		Discount:    discount,
 		TaxRate:     taxRate,
+		TaxCode:     strings.TrimSpace(getString(data, "taxCode")),
 	}
 
 	if productIDStr, ok := data["productId"].(string); ok {
@@ -242,9 +399,50 @@ func (h *InvoiceCommandHandler) HandleAddLineItem(ctx context.Context, cmd *Comm
 
 	invoice.AddLine(line)
 
-	if err := h.invoiceRepo.Update(ctx, invoice); err != nil {
+	event := lineAddedEvent(cmd, invoice, invoice.Lines[len(invoice.Lines)-1])
+
+	if err := h.commit(ctx, invoice.Version+1, func(ctx context.Context) error {
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, event); err != nil {
 		h.logger.New(ctx).Error("Failed to update invoice with line item", "error", err)
-		return nil, errors.InternalError("failed to add line item")
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to add line item")
+	}
+
+	h.logger.New(ctx).Info("Invoice line added",
+		"invoice_id", invoice.ID,
+		"line_id", invoice.Lines[len(invoice.Lines)-1].ID,
+		"description", description,
+	)
+
+	return invoice, nil
+}
+
+// lineAddedEvent is the invoice.line_added event of line, carrying the
+// invoice totals with it.
+func lineAddedEvent(cmd *CommandEnvelope, invoice *domain.Invoice, line domain.InvoiceLine) *eventpkg.EventEnvelope {
+	data := map[string]interface{}{
+		"lineId":      line.ID.String(),
+		"description": line.Description,
+		"quantity":    line.Quantity.String(),
+		"unitPrice":   line.UnitPrice.String(),
+		"discount":    line.Discount.String(),
+		"taxRate":     line.TaxRate.String(),
+		"taxAmount":   line.TaxAmount.String(),
+		"lineTotal":   line.Total.String(),
+		"total":       invoice.Total.String(),
+		"subtotal":    invoice.Subtotal.String(),
+		"taxTotal":    invoice.TaxTotal.String(),
+		"sortOrder":   line.SortOrder,
+	}
+	if line.ProductID != nil {
+		data["productId"] = line.ProductID.String()
+	}
+	if line.TaxCode != "" {
+		data["taxCode"] = line.TaxCode
+	}
+	if line.OrderID != nil {
+		data["orderId"] = line.OrderID.String()
+		data["orderNumber"] = line.OrderNumber
 	}
 
 	event := eventpkg.NewEvent(
@@ -253,29 +451,10 @@ func (h *InvoiceCommandHandler) HandleAddLineItem(ctx context.Context, cmd *Comm
 		"invoice.line_added",
 		cmd.TenantID,
 		cmd.UserID,
-		map[string]interface{}{
-			"lineId":      invoice.Lines[len(invoice.Lines)-1].ID.String(),
-			"description": description,
-			"quantity":    quantity.String(),
-			"unitPrice":   unitPrice.String(),
-			"total":       invoice.Total.String(),
-			"subtotal":    invoice.Subtotal.String(),
-			"taxTotal":    invoice.TaxTotal.String(),
-		},
+		data,
 	)
 	event.WithCorrelationID(cmd.CorrelationID)
-
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish line added event", "error", err)
-	}
-
-	h.logger.New(ctx).Info("Invoice line added",
-		"invoice_id", invoice.ID,
-		"line_id", invoice.Lines[len(invoice.Lines)-1].ID,
-		"description", description,
-	)
-
-	return invoice, nil
+	return event
 }
 
 func (h *InvoiceCommandHandler) HandleRemoveLineItem(ctx context.Context, cmd *CommandEnvelope) (*domain.Invoice, error) {
@@ -303,17 +482,16 @@ func (h *InvoiceCommandHandler) HandleRemoveLineItem(ctx context.Context, cmd *C
 		return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "invoice", invoice.Version); err != nil {
+		return nil, err
+	}
+
 	if invoice.Status != domain.InvoiceStatusDraft {
 		return nil, errors.InvalidArgument("can only remove lines from draft invoices")
 	}
 
 	invoice.RemoveLine(lineID)
 
-	if err := h.invoiceRepo.Update(ctx, invoice); err != nil {
-		h.logger.New(ctx).Error("Failed to remove line item", "error", err)
-		return nil, errors.InternalError("failed to remove line item")
-	}
-
 	event := eventpkg.NewEvent(
 		invoice.ID.String(),
 		"invoice",
@@ -328,8 +506,11 @@ func (h *InvoiceCommandHandler) HandleRemoveLineItem(ctx context.Context, cmd *C
 	)
 	event.WithCorrelationID(cmd.CorrelationID)
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish line removed event", "error", err)
+	if err := h.commit(ctx, invoice.Version+1, func(ctx context.Context) error {
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to remove line item", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to remove line item")
 	}
 
 	h.logger.New(ctx).Info("Invoice line removed",
@@ -360,6 +541,10 @@ func (h *InvoiceCommandHandler) HandleFinalizeInvoice(ctx context.Context, cmd *
 		return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "invoice", invoice.Version); err != nil {
+		return nil, err
+	}
+
 	if invoice.Status != domain.InvoiceStatusDraft {
 		return nil, errors.InvalidArgument("only draft invoices can be finalized")
 	}
@@ -368,13 +553,32 @@ func (h *InvoiceCommandHandler) HandleFinalizeInvoice(ctx context.Context, cmd *
 		return nil, errors.InvalidArgument("cannot finalize invoice with no line items")
 	}
 
+	if err := h.checkTaxPeriod(ctx, tenantID, invoice.IssueDate); err != nil {
+		return nil, err
+	}
+
 	invoice.SetStatus(domain.InvoiceStatusPending)
+	h.convert(ctx, invoice)
 
-	if err := h.invoiceRepo.Update(ctx, invoice); err != nil {
+	event := finalizedEvent(cmd, invoice)
+
+	if err := h.commit(ctx, invoice.Version+1, func(ctx context.Context) error {
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, event); err != nil {
 		h.logger.New(ctx).Error("Failed to finalize invoice", "error", err)
-		return nil, errors.InternalError("failed to finalize invoice")
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to finalize invoice")
 	}
 
+	h.logger.New(ctx).Info("Invoice finalized",
+		"invoice_id", invoice.ID,
+		"invoice_number", invoice.InvoiceNumber,
+	)
+
+	return invoice, nil
+}
+
+// finalizedEvent is the invoice.finalized event of invoice.
+func finalizedEvent(cmd *CommandEnvelope, invoice *domain.Invoice) *eventpkg.EventEnvelope {
 	event := eventpkg.NewEvent(
 		invoice.ID.String(),
 		"invoice",
@@ -388,18 +592,11 @@ func (h *InvoiceCommandHandler) HandleFinalizeInvoice(ctx context.Context, cmd *
 			"dueDate":       invoice.DueDate,
 		},
 	)
-	event.WithCorrelationID(cmd.CorrelationID)
-
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish finalized event", "error", err)
+	if invoice.Conversion != nil {
+		event.Data["conversion"] = conversionData(invoice.Conversion)
 	}
-
-	h.logger.New(ctx).Info("Invoice finalized",
-		"invoice_id", invoice.ID,
-		"invoice_number", invoice.InvoiceNumber,
-	)
-
-	return invoice, nil
+	event.WithCorrelationID(cmd.CorrelationID)
+	return event
 }
 
 func (h *InvoiceCommandHandler) HandleSendInvoice(ctx context.Context, cmd *CommandEnvelope) (*domain.Invoice, error) {
@@ -422,21 +619,24 @@ func (h *InvoiceCommandHandler) HandleSendInvoice(ctx context.Context, cmd *Comm
 		return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "invoice", invoice.Version); err != nil {
+		return nil, err
+	}
+
 	if invoice.Status != domain.InvoiceStatusDraft && invoice.Status != domain.InvoiceStatusPending {
 		return nil, errors.InvalidArgument("only draft or pending invoices can be sent")
 	}
 
 	if invoice.Status == domain.InvoiceStatusDraft {
+		if err := h.checkTaxPeriod(ctx, tenantID, invoice.IssueDate); err != nil {
+			return nil, err
+		}
 		invoice.SetStatus(domain.InvoiceStatusPending)
+		h.convert(ctx, invoice)
 	}
 
 	invoice.Send()
 
-	if err := h.invoiceRepo.Update(ctx, invoice); err != nil {
-		h.logger.New(ctx).Error("Failed to send invoice", "error", err)
-		return nil, errors.InternalError("failed to send invoice")
-	}
-
 	event := eventpkg.NewEvent(
 		invoice.ID.String(),
 		"invoice",
@@ -445,14 +645,22 @@ func (h *InvoiceCommandHandler) HandleSendInvoice(ctx context.Context, cmd *Comm
 		cmd.UserID,
 		map[string]interface{}{
 			"invoiceNumber": invoice.InvoiceNumber,
+			"clientId":      invoice.ClientID.String(),
 			"sentDate":      invoice.SentDate,
 			"total":         invoice.Total.String(),
+			"currency":      invoice.Currency,
 		},
 	)
+	if invoice.Conversion != nil {
+		event.Data["conversion"] = conversionData(invoice.Conversion)
+	}
 	event.WithCorrelationID(cmd.CorrelationID)
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish sent event", "error", err)
+	if err := h.commit(ctx, invoice.Version+1, func(ctx context.Context) error {
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to send invoice", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to send invoice")
 	}
 
 	h.logger.New(ctx).Info("Invoice sent",
@@ -483,6 +691,10 @@ func (h *InvoiceCommandHandler) HandleVoidInvoice(ctx context.Context, cmd *Comm
 		return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "invoice", invoice.Version); err != nil {
+		return nil, err
+	}
+
 	if invoice.Status == domain.InvoiceStatusPaid {
 		return nil, errors.InvalidArgument("cannot void a paid invoice")
 	}
@@ -495,6 +707,12 @@ func (h *InvoiceCommandHandler) HandleVoidInvoice(ctx context.Context, cmd *Comm
 		return nil, errors.InvalidArgument("invoice is already cancelled")
 	}
 
+	if invoice.Status != domain.InvoiceStatusDraft {
+		if err := h.checkTaxPeriod(ctx, tenantID, invoice.IssueDate); err != nil {
+			return nil, err
+		}
+	}
+
 	reason := getString(cmd.Data, "reason")
 	if reason == "" {
 		reason = "Voided by user"
@@ -507,11 +725,6 @@ func (h *InvoiceCommandHandler) HandleVoidInvoice(ctx context.Context, cmd *Comm
 
 	invoice.Cancel(reason)
 
-	if err := h.invoiceRepo.Update(ctx, invoice); err != nil {
-		h.logger.New(ctx).Error("Failed to void invoice", "error", err)
-		return nil, errors.InternalError("failed to void invoice")
-	}
-
 	event := eventpkg.NewEvent(
 		invoice.ID.String(),
 		"invoice",
@@ -526,8 +739,11 @@ func (h *InvoiceCommandHandler) HandleVoidInvoice(ctx context.Context, cmd *Comm
 	)
 	event.WithCorrelationID(cmd.CorrelationID)
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish voided event", "error", err)
+	if err := h.commit(ctx, invoice.Version+1, func(ctx context.Context) error {
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to void invoice", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to void invoice")
 	}
 
 	h.logger.New(ctx).Info("Invoice voided",
@@ -559,6 +775,10 @@ func (h *InvoiceCommandHandler) HandleRecordPayment(ctx context.Context, cmd *Co
 		return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "invoice", invoice.Version); err != nil {
+		return nil, err
+	}
+
 	if invoice.Status == domain.InvoiceStatusPaid {
 		return nil, errors.InvalidArgument("invoice is already fully paid")
 	}
@@ -584,11 +804,6 @@ func (h *InvoiceCommandHandler) HandleRecordPayment(ctx context.Context, cmd *Co
 		return nil, err
 	}
 
-	if err := h.invoiceRepo.Update(ctx, invoice); err != nil {
-		h.logger.New(ctx).Error("Failed to record payment", "error", err)
-		return nil, errors.InternalError("failed to record payment")
-	}
-
 	paymentMethod := getString(cmd.Data, "paymentMethod")
 	reference := getString(cmd.Data, "reference")
 
@@ -609,9 +824,22 @@ func (h *InvoiceCommandHandler) HandleRecordPayment(ctx context.Context, cmd *Co
 		},
 	)
 	event.WithCorrelationID(cmd.CorrelationID)
+	recorded := []*eventpkg.EventEnvelope{event}
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish payment recorded event", "error", err)
+	// invoice.paid marks the payment that settles the invoice, so consumers
+	// such as webhook subscribers need not inspect every recorded payment.
+	if paid := paidEvent(cmd, invoice, event); paid != nil {
+		recorded = append(recorded, paid)
+	}
+
+	version := invoice.Version
+	versions := numberInvoiceEvents(invoice, recorded)
+	err = commitEvents(ctx, h.outbox, h.publisher, h.logger, func(ctx context.Context) error {
+		return saveInvoiceVersions(ctx, h.invoiceRepo, invoice, versions)
+	}, recorded...)
+	if err := asVersionConflict(err, "invoice", version); err != nil {
+		h.logger.New(ctx).Error("Failed to record payment", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to record payment")
 	}
 
 	h.logger.New(ctx).Info("Payment recorded",
@@ -624,3 +852,310 @@ func (h *InvoiceCommandHandler) HandleRecordPayment(ctx context.Context, cmd *Co
 
 	return invoice, nil
 }
+
+// ApplyCreditNote applies the credit note that is the command's target to
+// open invoices of its client, each allocation settling Amount of one.
+type ApplyCreditNote struct {
+	Allocations []CreditNoteAllocation `json:"allocations"`
+}
+
+type CreditNoteAllocation struct {
+	InvoiceID uuid.UUID       `json:"invoiceId"`
+	Amount    decimal.Decimal `json:"amount"`
+}
+
+// HandleApplyCreditNote applies a credit note across invoices of the same
+// client and currency. Every allocation is checked before any is applied,
+// and with an outbox all are written in one transaction. It returns the
+// credit note and the invoices in the order of the allocations.
+func (h *InvoiceCommandHandler) HandleApplyCreditNote(ctx context.Context, cmd *CommandEnvelope) (*domain.Invoice, []*domain.Invoice, error) {
+	creditNoteID, err := uuid.Parse(cmd.TargetID)
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid credit note ID")
+	}
+
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid tenant ID")
+	}
+
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	var input ApplyCreditNote
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, nil, errors.InvalidArgument("invalid allocations: %v", err)
+	}
+	if len(input.Allocations) == 0 {
+		return nil, nil, errors.InvalidArgument("at least one allocation is required")
+	}
+
+	creditNote, err := h.invoiceRepo.FindByID(ctx, creditNoteID)
+	if err != nil || creditNote == nil {
+		return nil, nil, errors.NotFound("credit note not found")
+	}
+
+	if creditNote.TenantID != tenantID {
+		return nil, nil, errors.Newf(errors.CodeForbidden, "credit note does not belong to tenant")
+	}
+
+	if err := checkExpectedVersion(cmd, "invoice", creditNote.Version); err != nil {
+		return nil, nil, err
+	}
+
+	if creditNote.Type != domain.InvoiceTypeCreditNote {
+		return nil, nil, errors.InvalidArgument("invoice %s is not a credit note", creditNote.InvoiceNumber)
+	}
+
+	if !creditNote.IsOpen() {
+		return nil, nil, errors.InvalidArgument("credit note %s has no credit to apply", creditNote.InvoiceNumber)
+	}
+
+	invoices := make([]*domain.Invoice, len(input.Allocations))
+	total := decimal.Zero
+	for i, allocation := range input.Allocations {
+		for _, previous := range input.Allocations[:i] {
+			if previous.InvoiceID == allocation.InvoiceID {
+				return nil, nil, errors.InvalidArgument("invoice %s is allocated more than once", allocation.InvoiceID)
+			}
+		}
+
+		invoice, err := h.invoiceRepo.FindByID(ctx, allocation.InvoiceID)
+		if err != nil || invoice == nil || invoice.TenantID != tenantID {
+			return nil, nil, errors.NotFound("invoice %s not found", allocation.InvoiceID)
+		}
+		if invoice.Type == domain.InvoiceTypeCreditNote {
+			return nil, nil, errors.InvalidArgument("credit cannot be applied to credit note %s", invoice.InvoiceNumber)
+		}
+		if invoice.ClientID != creditNote.ClientID {
+			return nil, nil, errors.InvalidArgument("invoice %s belongs to another client", invoice.InvoiceNumber)
+		}
+		if invoice.Currency != creditNote.Currency {
+			return nil, nil, errors.InvalidArgument("invoice %s is in %s, the credit note in %s", invoice.InvoiceNumber, invoice.Currency, creditNote.Currency)
+		}
+		if !invoice.IsOpen() {
+			return nil, nil, errors.InvalidArgument("invoice %s is not open", invoice.InvoiceNumber)
+		}
+		if !allocation.Amount.IsPositive() {
+			return nil, nil, errors.InvalidArgument("allocation amount must be greater than zero")
+		}
+		if allocation.Amount.GreaterThan(invoice.AmountDue) {
+			return nil, nil, errors.Newf(errors.CodeInvalidArgument, "allocation exceeds the amount due of invoice %s: %s", invoice.InvoiceNumber, invoice.AmountDue.String())
+		}
+
+		invoices[i] = invoice
+		total = total.Add(allocation.Amount)
+	}
+
+	if total.GreaterThan(creditNote.AmountDue) {
+		return nil, nil, errors.Newf(errors.CodeInvalidArgument, "allocations exceed the unapplied credit: %s", creditNote.AmountDue.String())
+	}
+
+	var recorded []*eventpkg.EventEnvelope
+	allocated := make([]map[string]interface{}, len(invoices))
+	for i, invoice := range invoices {
+		allocation, err := creditNote.AllocateCredit(invoice, input.Allocations[i].Amount, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		allocated[i] = map[string]interface{}{
+			"allocationId":  allocation.ID.String(),
+			"invoiceId":     invoice.ID.String(),
+			"invoiceNumber": invoice.InvoiceNumber,
+			"amount":        allocation.Amount.String(),
+		}
+
+		applied := eventpkg.NewEvent(
+			invoice.ID.String(),
+			"invoice",
+			"invoice.credit_applied",
+			cmd.TenantID,
+			cmd.UserID,
+			map[string]interface{}{
+				"invoiceNumber":    invoice.InvoiceNumber,
+				"allocationId":     allocation.ID.String(),
+				"creditNoteId":     creditNote.ID.String(),
+				"creditNoteNumber": creditNote.InvoiceNumber,
+				"amount":           allocation.Amount.String(),
+				"amountPaid":       invoice.AmountPaid.String(),
+				"amountDue":        invoice.AmountDue.String(),
+				"status":           string(invoice.Status),
+			},
+		)
+		applied.WithCorrelationID(cmd.CorrelationID)
+		recorded = append(recorded, applied)
+		if paid := paidEvent(cmd, invoice, applied); paid != nil {
+			recorded = append(recorded, paid)
+		}
+	}
+
+	event := eventpkg.NewEvent(
+		creditNote.ID.String(),
+		"invoice",
+		"invoice.credit_allocated",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceNumber": creditNote.InvoiceNumber,
+			"clientId":      creditNote.ClientID.String(),
+			"currency":      creditNote.Currency,
+			"allocations":   allocated,
+			"amount":        total.String(),
+			"amountPaid":    creditNote.AmountPaid.String(),
+			"amountDue":     creditNote.AmountDue.String(),
+			"status":        string(creditNote.Status),
+		},
+	)
+	event.WithCorrelationID(cmd.CorrelationID)
+	event.Version = creditNote.Version + 1
+	recorded = append([]*eventpkg.EventEnvelope{event}, recorded...)
+
+	versions := make([]int, len(invoices))
+	for i, invoice := range invoices {
+		versions[i] = numberInvoiceEvents(invoice, recorded)
+	}
+	err = commitEvents(ctx, h.outbox, h.publisher, h.logger, func(ctx context.Context) error {
+		if err := h.invoiceRepo.Update(ctx, creditNote); err != nil {
+			return err
+		}
+		for i, invoice := range invoices {
+			if err := saveInvoiceVersions(ctx, h.invoiceRepo, invoice, versions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, recorded...)
+	if err := asVersionConflict(err, "invoice", event.Version-1); err != nil {
+		h.logger.New(ctx).Error("Failed to apply credit note", "error", err)
+		return nil, nil, errors.Wrap(err, errors.CodeInternalError, "failed to apply credit note")
+	}
+
+	h.logger.New(ctx).Info("Credit note applied",
+		"credit_note_id", creditNote.ID,
+		"credit_note_number", creditNote.InvoiceNumber,
+		"invoices", len(invoices),
+		"amount", total.String(),
+		"unapplied", creditNote.AmountDue.String(),
+	)
+
+	return creditNote, invoices, nil
+}
+
+// PreviewInvoiceReminder returns the invoice.reminder_sent event a manual
+// reminder for the invoice would publish, without sending it, and the
+// suppression that would refuse it, if any.
+func (h *InvoiceCommandHandler) PreviewInvoiceReminder(ctx context.Context, cmd *CommandEnvelope) (*eventpkg.EventEnvelope, *domain.ReminderSuppression, error) {
+	invoice, suppression, err := h.reminderInvoice(ctx, cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	preview := *invoice
+	if err := preview.RecordReminder(time.Now().UTC()); err != nil {
+		return nil, nil, errors.Newf(errors.CodeUnprocessable, "%s", err.Error())
+	}
+	return reminderEvent(cmd, &preview), suppression, nil
+}
+
+// HandleSendInvoiceReminder sends a payment reminder for an open invoice
+// by hand, unless its reminders are suppressed. The reminder itself is
+// delivered by notification-service on invoice.reminder_sent.
+func (h *InvoiceCommandHandler) HandleSendInvoiceReminder(ctx context.Context, cmd *CommandEnvelope) (*domain.Invoice, error) {
+	invoice, suppression, err := h.reminderInvoice(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkExpectedVersion(cmd, "invoice", invoice.Version); err != nil {
+		return nil, err
+	}
+
+	if suppression != nil {
+		return nil, errors.Newf(errors.CodeConflict, "reminders for invoice %s are suppressed: %s", invoice.InvoiceNumber, suppression.Reason)
+	}
+
+	if err := invoice.RecordReminder(time.Now().UTC()); err != nil {
+		return nil, errors.Newf(errors.CodeUnprocessable, "%s", err.Error())
+	}
+
+	event := reminderEvent(cmd, invoice)
+
+	if err := h.commit(ctx, invoice.Version+1, func(ctx context.Context) error {
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to send invoice reminder", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to send invoice reminder")
+	}
+
+	h.logger.New(ctx).Info("Invoice reminder sent",
+		"invoice_id", invoice.ID,
+		"invoice_number", invoice.InvoiceNumber,
+		"reminder", invoice.RemindersSent,
+	)
+
+	return invoice, nil
+}
+
+// reminderInvoice loads the invoice a reminder is for and the suppression
+// of its reminders, if any.
+func (h *InvoiceCommandHandler) reminderInvoice(ctx context.Context, cmd *CommandEnvelope) (*domain.Invoice, *domain.ReminderSuppression, error) {
+	invoiceID, err := uuid.Parse(cmd.TargetID)
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid invoice ID")
+	}
+
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid tenant ID")
+	}
+
+	invoice, err := h.invoiceRepo.FindByID(ctx, invoiceID)
+	if err != nil || invoice == nil {
+		return nil, nil, errors.NotFound("invoice not found")
+	}
+
+	if invoice.TenantID != tenantID {
+		return nil, nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
+	}
+
+	if h.reminders == nil {
+		return invoice, nil, nil
+	}
+	suppression, err := h.reminders.Active(ctx, tenantID, invoice.ClientID, invoice.ID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errors.CodeInternalError, "failed to check reminder suppressions")
+	}
+	return invoice, suppression, nil
+}
+
+// reminderEvent is the invoice.reminder_sent event of the reminder last
+// recorded on invoice.
+func reminderEvent(cmd *CommandEnvelope, invoice *domain.Invoice) *eventpkg.EventEnvelope {
+	data := map[string]interface{}{
+		"invoiceNumber":  invoice.InvoiceNumber,
+		"clientId":       invoice.ClientID.String(),
+		"total":          invoice.Total.String(),
+		"amountDue":      invoice.AmountDue.String(),
+		"currency":       invoice.Currency,
+		"reminderNumber": invoice.RemindersSent,
+		"sentAt":         *invoice.LastReminderAt,
+		"daysOverdue":    0,
+		"manual":         true,
+	}
+	if invoice.DueDate != nil {
+		data["dueDate"] = *invoice.DueDate
+		if overdue := invoice.LastReminderAt.Sub(*invoice.DueDate); overdue > 0 {
+			data["daysOverdue"] = int(overdue.Hours() / 24)
+		}
+	}
+
+	event := eventpkg.NewEvent(
+		invoice.ID.String(),
+		"invoice",
+		"invoice.reminder_sent",
+		cmd.TenantID,
+		cmd.UserID,
+		data,
+	)
+	event.WithCorrelationID(cmd.CorrelationID)
+	return event
+}
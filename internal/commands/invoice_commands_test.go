@@ -2,11 +2,16 @@ package commands
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/ims-erp/system/internal/domain"
 	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
 	"github.com/ims-erp/system/pkg/logger"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
@@ -33,6 +38,10 @@ func (r *mockInvoiceRepo) Update(ctx context.Context, invoice *domain.Invoice) e
 	return nil
 }
 
+func (r *mockInvoiceRepo) UpdateVersions(ctx context.Context, invoice *domain.Invoice, versions int64) error {
+	return r.Update(ctx, invoice)
+}
+
 func (r *mockInvoiceRepo) FindByID(ctx context.Context, id uuid.UUID) (*domain.Invoice, error) {
 	if invoice, ok := r.invoices[id]; ok {
 		return invoice, nil
@@ -440,8 +449,93 @@ func TestInvoiceCommandHandler_HandleRecordPayment(t *testing.T) {
 	assert.Equal(t, 0, updatedInvoice.AmountPaid.Cmp(decimal.NewFromInt(500)))
 	assert.Equal(t, 0, updatedInvoice.AmountDue.Cmp(decimal.Zero))
 	assert.NotNil(t, updatedInvoice.PaidDate)
-	assert.Len(t, publisher.events, 1)
+	require.Len(t, publisher.events, 2)
 	assert.Equal(t, "invoice.payment_recorded", publisher.events[0].Type)
+	assert.Equal(t, "invoice.paid", publisher.events[1].Type)
+	assert.Equal(t, publisher.events[0].ID, publisher.events[1].CausationID)
+	assert.Equal(t, int64(1), publisher.events[0].Version)
+	assert.Equal(t, int64(2), publisher.events[1].Version)
+}
+
+// versionedInvoiceRepo keeps copies of invoices and applies writes only to
+// the version they were loaded at, like the real repositories. loaded runs
+// after every FindByID, to write concurrently with a command.
+type versionedInvoiceRepo struct {
+	*mockInvoiceRepo
+	writes int
+	loaded func(stored *domain.Invoice)
+}
+
+func (r *versionedInvoiceRepo) FindByID(ctx context.Context, id uuid.UUID) (*domain.Invoice, error) {
+	stored, ok := r.invoices[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *stored
+	if r.loaded != nil {
+		r.loaded(stored)
+	}
+	return &found, nil
+}
+
+func (r *versionedInvoiceRepo) UpdateVersions(ctx context.Context, invoice *domain.Invoice, versions int64) error {
+	r.writes++
+	if r.invoices[invoice.ID].Version != invoice.Version {
+		return fmt.Errorf("%w: invoice %s at version %d", repository.ErrConcurrencyConflict, invoice.ID, invoice.Version)
+	}
+	next := *invoice
+	next.Version += versions
+	r.invoices[invoice.ID] = &next
+	invoice.Version = next.Version
+	return nil
+}
+
+func TestInvoiceCommandHandler_HandleRecordPayment_SavesVersionsInOneWrite(t *testing.T) {
+	record := func(repo *versionedInvoiceRepo, publisher *mockPublisher) (*domain.Invoice, error) {
+		log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+		handler := NewInvoiceCommandHandler(repo, nil, publisher, log, &mockInvoiceCounter{})
+
+		tenantID := uuid.New()
+		invoice := &domain.Invoice{
+			ID:         uuid.New(),
+			TenantID:   tenantID,
+			Status:     domain.InvoiceStatusSent,
+			Total:      decimal.NewFromInt(500),
+			AmountPaid: decimal.Zero,
+			AmountDue:  decimal.NewFromInt(500),
+			Version:    4,
+		}
+		repo.invoices[invoice.ID] = invoice
+		_, err := handler.HandleRecordPayment(context.Background(), &CommandEnvelope{
+			Type:     "recordPayment",
+			TenantID: tenantID.String(),
+			TargetID: invoice.ID.String(),
+			UserID:   uuid.New().String(),
+			Data:     map[string]interface{}{"amount": "500.00"},
+		})
+		return repo.invoices[invoice.ID], err
+	}
+
+	repo := &versionedInvoiceRepo{mockInvoiceRepo: newMockInvoiceRepo()}
+	publisher := &mockPublisher{}
+	stored, err := record(repo, publisher)
+	require.NoError(t, err)
+	require.Len(t, publisher.events, 2, "the payment and the invoice being paid")
+	assert.Equal(t, 1, repo.writes, "the invoice is written once whatever the number of events")
+	assert.Equal(t, publisher.events[1].Version, stored.Version, "the stored version is the last event's")
+
+	// Another command saves the invoice after it was loaded, between what
+	// used to be the first and the second of the per-event writes.
+	repo = &versionedInvoiceRepo{mockInvoiceRepo: newMockInvoiceRepo()}
+	repo.loaded = func(stored *domain.Invoice) { stored.Version++ }
+	publisher = &mockPublisher{}
+	stored, err = record(repo, publisher)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errors.CodeConflict))
+	assert.Equal(t, 1, repo.writes)
+	assert.Equal(t, int64(5), stored.Version, "a conflict leaves the concurrent write's version in place")
+	assert.Equal(t, domain.InvoiceStatusSent, stored.Status)
+	assert.Empty(t, publisher.events)
 }
 
 func TestInvoiceCommandHandler_HandleRecordPayment_Partial(t *testing.T) {
@@ -480,6 +574,8 @@ func TestInvoiceCommandHandler_HandleRecordPayment_Partial(t *testing.T) {
 	assert.Equal(t, domain.InvoiceStatusSent, updatedInvoice.Status) // Not fully paid yet
 	assert.Equal(t, 0, updatedInvoice.AmountPaid.Cmp(decimal.NewFromInt(200)))
 	assert.Equal(t, 0, updatedInvoice.AmountDue.Cmp(decimal.NewFromInt(300)))
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "invoice.payment_recorded", publisher.events[0].Type)
 }
 
 func TestInvoiceCommandHandler_HandleRecordPayment_ExceedsAmount(t *testing.T) {
@@ -563,3 +659,356 @@ func TestInvoiceCommandHandler_HandleRemoveLineItem(t *testing.T) {
 	assert.Len(t, publisher.events, 1)
 	assert.Equal(t, "invoice.line_removed", publisher.events[0].Type)
 }
+
+func TestInvoiceCommandHandler_HandleFinalizeInvoice_VersionMismatch(t *testing.T) {
+	repo := newMockInvoiceRepo()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+
+	handler := NewInvoiceCommandHandler(repo, nil, publisher, log, &mockInvoiceCounter{})
+
+	tenantID := uuid.New()
+	invoice := &domain.Invoice{
+		ID:       uuid.New(),
+		TenantID: tenantID,
+		Status:   domain.InvoiceStatusDraft,
+		Lines:    []domain.InvoiceLine{{ID: uuid.New(), Total: decimal.NewFromInt(100)}},
+		Version:  3,
+	}
+	repo.Create(context.Background(), invoice)
+
+	cmd := &CommandEnvelope{
+		Type:            "finalizeInvoice",
+		TenantID:        tenantID.String(),
+		TargetID:        invoice.ID.String(),
+		ExpectedVersion: 2,
+	}
+
+	_, err := handler.HandleFinalizeInvoice(context.Background(), cmd)
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errors.CodeConflict))
+	details := err.(*errors.Error).Details.(errors.ConflictDetails)
+	assert.Equal(t, int64(2), details.ExpectedVersion)
+	assert.Equal(t, int64(3), details.CurrentVersion)
+	assert.True(t, details.Retryable)
+	assert.Equal(t, domain.InvoiceStatusDraft, invoice.Status)
+	assert.Empty(t, publisher.events)
+}
+
+type conflictingInvoiceRepo struct {
+	*mockInvoiceRepo
+}
+
+func (r *conflictingInvoiceRepo) Update(ctx context.Context, invoice *domain.Invoice) error {
+	return fmt.Errorf("%w: invoice %s", repository.ErrConcurrencyConflict, invoice.ID)
+}
+
+func (r *conflictingInvoiceRepo) UpdateVersions(ctx context.Context, invoice *domain.Invoice, versions int64) error {
+	return r.Update(ctx, invoice)
+}
+
+func TestInvoiceCommandHandler_HandleSendInvoice_ConcurrentWrite(t *testing.T) {
+	repo := &conflictingInvoiceRepo{newMockInvoiceRepo()}
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+
+	handler := NewInvoiceCommandHandler(repo, nil, publisher, log, &mockInvoiceCounter{})
+
+	tenantID := uuid.New()
+	invoice := &domain.Invoice{
+		ID:       uuid.New(),
+		TenantID: tenantID,
+		Status:   domain.InvoiceStatusPending,
+	}
+	repo.Create(context.Background(), invoice)
+
+	_, err := handler.HandleSendInvoice(context.Background(), &CommandEnvelope{
+		Type:     "sendInvoice",
+		TenantID: tenantID.String(),
+		TargetID: invoice.ID.String(),
+	})
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errors.CodeConflict))
+	assert.Equal(t, http.StatusConflict, err.(*errors.Error).StatusCode())
+	assert.Empty(t, publisher.events)
+}
+
+func TestInvoiceCommandHandler_HandleApplyCreditNote(t *testing.T) {
+	repo := newMockInvoiceRepo()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+
+	handler := NewInvoiceCommandHandler(repo, nil, publisher, log, &mockInvoiceCounter{})
+
+	tenantID, clientID := uuid.New(), uuid.New()
+	openInvoice := func(invoiceType domain.InvoiceType, number string, total int64) *domain.Invoice {
+		invoice := &domain.Invoice{
+			ID:            uuid.New(),
+			TenantID:      tenantID,
+			ClientID:      clientID,
+			InvoiceNumber: number,
+			Type:          invoiceType,
+			Status:        domain.InvoiceStatusSent,
+			Currency:      "EUR",
+			Total:         decimal.NewFromInt(total),
+			AmountPaid:    decimal.Zero,
+			AmountDue:     decimal.NewFromInt(total),
+		}
+		repo.Create(context.Background(), invoice)
+		return invoice
+	}
+	creditNote := openInvoice(domain.InvoiceTypeCreditNote, "CN-1", 300)
+	first := openInvoice(domain.InvoiceTypeStandard, "INV-1", 100)
+	second := openInvoice(domain.InvoiceTypeStandard, "INV-2", 500)
+
+	cmd := &CommandEnvelope{
+		Type:     "applyCreditNote",
+		TenantID: tenantID.String(),
+		TargetID: creditNote.ID.String(),
+		UserID:   uuid.New().String(),
+		Data: map[string]interface{}{
+			"allocations": []interface{}{
+				map[string]interface{}{"invoiceId": first.ID.String(), "amount": "100"},
+				map[string]interface{}{"invoiceId": second.ID.String(), "amount": "150.50"},
+			},
+		},
+	}
+
+	updated, invoices, err := handler.HandleApplyCreditNote(context.Background(), cmd)
+
+	require.NoError(t, err)
+	require.Len(t, invoices, 2)
+	assert.True(t, updated.AmountDue.Equal(decimal.RequireFromString("49.50")))
+	assert.Equal(t, domain.InvoiceStatusSent, updated.Status)
+	assert.Len(t, updated.Allocations, 2)
+	assert.Equal(t, domain.InvoiceStatusPaid, invoices[0].Status)
+	assert.True(t, invoices[1].AmountDue.Equal(decimal.RequireFromString("349.50")))
+	require.Len(t, invoices[1].Allocations, 1)
+	assert.Equal(t, creditNote.ID, invoices[1].Allocations[0].CreditNoteID)
+
+	types := make([]string, len(publisher.events))
+	for i, event := range publisher.events {
+		types[i] = event.Type
+	}
+	assert.Equal(t, []string{"invoice.credit_allocated", "invoice.credit_applied", "invoice.paid", "invoice.credit_applied"}, types)
+	assert.Equal(t, "49.5", publisher.events[0].Data["amountDue"])
+}
+
+func TestInvoiceCommandHandler_HandleApplyCreditNote_Rejected(t *testing.T) {
+	repo := newMockInvoiceRepo()
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+
+	handler := NewInvoiceCommandHandler(repo, nil, &mockPublisher{}, log, &mockInvoiceCounter{})
+
+	tenantID, clientID := uuid.New(), uuid.New()
+	creditNote := &domain.Invoice{
+		ID: uuid.New(), TenantID: tenantID, ClientID: clientID, InvoiceNumber: "CN-1",
+		Type: domain.InvoiceTypeCreditNote, Status: domain.InvoiceStatusSent, Currency: "EUR",
+		Total: decimal.NewFromInt(100), AmountPaid: decimal.Zero, AmountDue: decimal.NewFromInt(100),
+	}
+	invoice := &domain.Invoice{
+		ID: uuid.New(), TenantID: tenantID, ClientID: clientID, InvoiceNumber: "INV-1",
+		Type: domain.InvoiceTypeStandard, Status: domain.InvoiceStatusSent, Currency: "EUR",
+		Total: decimal.NewFromInt(500), AmountPaid: decimal.Zero, AmountDue: decimal.NewFromInt(500),
+	}
+	otherClient := &domain.Invoice{
+		ID: uuid.New(), TenantID: tenantID, ClientID: uuid.New(), InvoiceNumber: "INV-2",
+		Type: domain.InvoiceTypeStandard, Status: domain.InvoiceStatusSent, Currency: "EUR",
+		Total: decimal.NewFromInt(500), AmountPaid: decimal.Zero, AmountDue: decimal.NewFromInt(500),
+	}
+	for _, i := range []*domain.Invoice{creditNote, invoice, otherClient} {
+		repo.Create(context.Background(), i)
+	}
+
+	tests := []struct {
+		name        string
+		allocations []interface{}
+		want        string
+	}{
+		{"exceeds credit", []interface{}{
+			map[string]interface{}{"invoiceId": invoice.ID.String(), "amount": "100.01"},
+		}, "exceed the unapplied credit"},
+		{"other client", []interface{}{
+			map[string]interface{}{"invoiceId": otherClient.ID.String(), "amount": "10"},
+		}, "belongs to another client"},
+		{"duplicate invoice", []interface{}{
+			map[string]interface{}{"invoiceId": invoice.ID.String(), "amount": "10"},
+			map[string]interface{}{"invoiceId": invoice.ID.String(), "amount": "10"},
+		}, "more than once"},
+		{"none", []interface{}{}, "at least one allocation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &CommandEnvelope{
+				Type:     "applyCreditNote",
+				TenantID: tenantID.String(),
+				TargetID: creditNote.ID.String(),
+				Data:     map[string]interface{}{"allocations": tt.allocations},
+			}
+			_, _, err := handler.HandleApplyCreditNote(context.Background(), cmd)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+	assert.True(t, creditNote.AmountDue.Equal(decimal.NewFromInt(100)))
+	assert.Empty(t, invoice.Allocations)
+}
+
+type stubReminderSuppressions map[uuid.UUID]*domain.ReminderSuppression
+
+func (s stubReminderSuppressions) Active(ctx context.Context, tenantID, clientID, invoiceID uuid.UUID) (*domain.ReminderSuppression, error) {
+	if suppression, ok := s[invoiceID]; ok {
+		return suppression, nil
+	}
+	return s[clientID], nil
+}
+
+func TestInvoiceCommandHandler_HandleSendInvoiceReminder(t *testing.T) {
+	repo := newMockInvoiceRepo()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+
+	suppressions := stubReminderSuppressions{}
+	handler := NewInvoiceCommandHandler(repo, nil, publisher, log, &mockInvoiceCounter{}).
+		WithReminderSuppressions(suppressions)
+
+	tenantID, clientID := uuid.New(), uuid.New()
+	dueDate := time.Now().UTC().AddDate(0, 0, -10)
+	invoice := &domain.Invoice{
+		ID: uuid.New(), TenantID: tenantID, ClientID: clientID, InvoiceNumber: "INV-1",
+		Type: domain.InvoiceTypeStandard, Status: domain.InvoiceStatusSent, Currency: "EUR",
+		Total: decimal.NewFromInt(500), AmountPaid: decimal.NewFromInt(200), AmountDue: decimal.NewFromInt(300),
+		DueDate: &dueDate, Version: 3,
+	}
+	repo.Create(context.Background(), invoice)
+
+	cmd := &CommandEnvelope{
+		Type:     "sendInvoiceReminder",
+		TenantID: tenantID.String(),
+		TargetID: invoice.ID.String(),
+		UserID:   uuid.New().String(),
+	}
+
+	preview, suppression, err := handler.PreviewInvoiceReminder(context.Background(), cmd)
+	require.NoError(t, err)
+	assert.Nil(t, suppression)
+	assert.Equal(t, 1, preview.Data["reminderNumber"])
+	assert.Equal(t, 10, preview.Data["daysOverdue"])
+	assert.Zero(t, invoice.RemindersSent, "a preview records no reminder")
+	assert.Empty(t, publisher.events)
+
+	suppressions[clientID] = &domain.ReminderSuppression{ClientID: clientID, Reason: "payment plan agreed"}
+	_, err = handler.HandleSendInvoiceReminder(context.Background(), cmd)
+	require.Error(t, err)
+	assertErrorCode(t, err, errors.CodeConflict)
+	assert.Contains(t, err.Error(), "payment plan agreed")
+
+	delete(suppressions, clientID)
+	updated, err := handler.HandleSendInvoiceReminder(context.Background(), cmd)
+	require.NoError(t, err)
+	assert.Equal(t, 1, updated.RemindersSent)
+	assert.NotNil(t, updated.LastReminderAt)
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "invoice.reminder_sent", publisher.events[0].Type)
+	assert.Equal(t, "300", publisher.events[0].Data["amountDue"])
+	assert.Equal(t, int64(4), publisher.events[0].Version)
+
+	invoice.Status = domain.InvoiceStatusPaid
+	_, err = handler.HandleSendInvoiceReminder(context.Background(), cmd)
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+}
+
+type stubConsolidatedBilling struct {
+	billing  []*domain.ConsolidatedBilling
+	orders   []*domain.Order
+	invoiced map[uuid.UUID]uuid.UUID
+}
+
+func (s *stubConsolidatedBilling) EachBilling(ctx context.Context, fn func(*domain.ConsolidatedBilling) error) error {
+	for _, billing := range s.billing {
+		if err := fn(billing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stubConsolidatedBilling) SetLastPeriod(ctx context.Context, billing *domain.ConsolidatedBilling, period string) error {
+	billing.LastPeriod = period
+	return nil
+}
+
+func (s *stubConsolidatedBilling) UninvoicedOrders(ctx context.Context, tenantID, clientID uuid.UUID, before time.Time) ([]*domain.Order, error) {
+	var orders []*domain.Order
+	for _, order := range s.orders {
+		if _, ok := s.invoiced[order.ID]; !ok && order.ClientID == clientID && order.DeliveredDate.Before(before) {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (s *stubConsolidatedBilling) MarkInvoiced(ctx context.Context, tenantID, invoiceID uuid.UUID, orderIDs []uuid.UUID) error {
+	for _, id := range orderIDs {
+		if _, ok := s.invoiced[id]; !ok {
+			s.invoiced[id] = invoiceID
+		}
+	}
+	return nil
+}
+
+func TestInvoiceCommandHandler_ConsolidateDue(t *testing.T) {
+	repo := newMockInvoiceRepo()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+
+	tenantID, clientID := uuid.New(), uuid.New()
+	delivered := func(number, currency string, day int) *domain.Order {
+		at := time.Date(2026, 9, day, 12, 0, 0, 0, time.UTC)
+		return &domain.Order{
+			ID: uuid.New(), TenantID: tenantID, ClientID: clientID, OrderNumber: number, Currency: currency,
+			Status: domain.OrderStatusDelivered, DeliveredDate: &at,
+			Lines: []domain.OrderLine{{ProductID: uuid.New(), Name: "Widget", Quantity: 2, UnitPrice: decimal.NewFromInt(50)}},
+		}
+	}
+	billing := &stubConsolidatedBilling{
+		billing: []*domain.ConsolidatedBilling{{
+			ID: uuid.New(), TenantID: tenantID, ClientID: clientID,
+			Frequency: domain.BillingFrequencyMonthly, PaymentTerm: domain.PaymentTermNet30,
+		}},
+		orders:   []*domain.Order{delivered("SO-1", "EUR", 3), delivered("SO-2", "EUR", 20), delivered("SO-3", "USD", 21)},
+		invoiced: make(map[uuid.UUID]uuid.UUID),
+	}
+	handler := NewInvoiceCommandHandler(repo, nil, publisher, log, &mockInvoiceCounter{}).
+		WithConsolidatedBilling(billing, func(string) *time.Location { return time.UTC })
+
+	now := time.Date(2026, 10, 2, 3, 0, 0, 0, time.UTC)
+	require.NoError(t, handler.ConsolidateDue(context.Background(), now))
+
+	require.Len(t, repo.invoices, 2, "one invoice per currency")
+	eur := repo.invoices[domain.ConsolidatedInvoiceID(tenantID, clientID, "2026-09", "EUR")]
+	require.NotNil(t, eur)
+	assert.Equal(t, domain.InvoiceStatusPending, eur.Status)
+	assert.Equal(t, "2026-09", eur.BillingPeriod)
+	assert.Equal(t, "200", eur.Total.String())
+	assert.Equal(t, []uuid.UUID{billing.orders[0].ID, billing.orders[1].ID}, eur.InvoicedOrders())
+	assert.Equal(t, eur.ID, billing.invoiced[billing.orders[0].ID])
+	assert.Equal(t, "2026-09", billing.billing[0].LastPeriod)
+
+	types := make(map[string]int)
+	for _, event := range publisher.events {
+		types[event.Type]++
+	}
+	assert.Equal(t, map[string]int{"invoice.created": 2, "invoice.line_added": 3, "invoice.finalized": 2}, types)
+
+	// A run that stopped before marking the orders invoiced is completed
+	// by the next, without issuing anything new.
+	billing.billing[0].LastPeriod = ""
+	billing.invoiced = make(map[uuid.UUID]uuid.UUID)
+	require.NoError(t, handler.ConsolidateDue(context.Background(), now))
+	assert.Len(t, repo.invoices, 2)
+	assert.Len(t, publisher.events, 7)
+	assert.Equal(t, eur.ID, billing.invoiced[billing.orders[1].ID])
+}
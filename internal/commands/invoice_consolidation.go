@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/errors"
+)
+
+// ConsolidatedBillingRepository keeps the clients billed on consolidated
+// invoices and finds the orders those invoices bill.
+// repository.ConsolidatedBillingStore implements it.
+type ConsolidatedBillingRepository interface {
+	// EachBilling calls fn with the consolidated billing of every client,
+	// of any tenant.
+	EachBilling(ctx context.Context, fn func(*domain.ConsolidatedBilling) error) error
+	SetLastPeriod(ctx context.Context, billing *domain.ConsolidatedBilling, period string) error
+	// UninvoicedOrders returns the client's orders delivered before before
+	// that are not on an invoice yet.
+	UninvoicedOrders(ctx context.Context, tenantID, clientID uuid.UUID, before time.Time) ([]*domain.Order, error)
+	// MarkInvoiced links the orders not yet on an invoice to invoiceID.
+	MarkInvoiced(ctx context.Context, tenantID, invoiceID uuid.UUID, orderIDs []uuid.UUID) error
+}
+
+// WithConsolidatedBilling bills the delivered orders of clients set up for
+// it on one invoice per billing period, periods ending in the tenant's time
+// zone as location gives it.
+func (h *InvoiceCommandHandler) WithConsolidatedBilling(billing ConsolidatedBillingRepository, location func(tenantID string) *time.Location) *InvoiceCommandHandler {
+	h.billing = billing
+	h.location = location
+	return h
+}
+
+// ConsolidateDue issues, for every client billed on consolidated invoices
+// whose last closed billing period is not billed yet, one invoice per
+// currency for the orders delivered by the end of the period and not
+// invoiced yet. Orders delivered late in a period that was already billed
+// go on the next period's invoice. Consolidated invoices have IDs derived
+// from the client, period and currency, so a period is never invoiced
+// twice: a run that stopped halfway is completed by the next one. A client
+// that fails is logged and left for the next run.
+func (h *InvoiceCommandHandler) ConsolidateDue(ctx context.Context, now time.Time) error {
+	if h.billing == nil {
+		return nil
+	}
+
+	var clients, invoiced, failed int
+	err := h.billing.EachBilling(ctx, func(billing *domain.ConsolidatedBilling) error {
+		period := billing.ClosedPeriod(now, h.location(billing.TenantID.String()))
+		if billing.LastPeriod == period.Key {
+			return nil
+		}
+		n, err := h.consolidate(ctx, billing, period, now)
+		if err == nil {
+			err = h.billing.SetLastPeriod(ctx, billing, period.Key)
+		}
+		if err != nil {
+			failed++
+			h.logger.New(ctx).Warn("Failed to issue consolidated invoices",
+				"tenant_id", billing.TenantID, "client_id", billing.ClientID, "period", period.Key, "error", err)
+			return nil
+		}
+		clients++
+		invoiced += n
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if clients > 0 || failed > 0 {
+		h.logger.New(ctx).Info("Consolidated invoices issued", "clients", clients, "invoices", invoiced, "failed", failed)
+	}
+	if failed > 0 {
+		return errors.Newf(errors.CodeInternalError, "failed to issue consolidated invoices of %d clients", failed)
+	}
+	return nil
+}
+
+// consolidate invoices the client's uninvoiced orders for period, one
+// invoice per currency, and returns how many invoices it issued.
+func (h *InvoiceCommandHandler) consolidate(ctx context.Context, billing *domain.ConsolidatedBilling, period domain.BillingPeriod, now time.Time) (int, error) {
+	orders, err := h.billing.UninvoicedOrders(ctx, billing.TenantID, billing.ClientID, period.End)
+	if err != nil {
+		return 0, err
+	}
+	byCurrency := make(map[string][]*domain.Order)
+	var currencies []string
+	for _, order := range orders {
+		if byCurrency[order.Currency] == nil {
+			currencies = append(currencies, order.Currency)
+		}
+		byCurrency[order.Currency] = append(byCurrency[order.Currency], order)
+	}
+	sort.Strings(currencies)
+
+	issued := 0
+	for _, currency := range currencies {
+		id := domain.ConsolidatedInvoiceID(billing.TenantID, billing.ClientID, period.Key, currency)
+		// The repositories do not tell a missing invoice from a failed
+		// lookup; creating one that exists fails on its ID.
+		invoice, err := h.invoiceRepo.FindByID(ctx, id)
+		if err != nil || invoice == nil {
+			if invoice, err = h.issueConsolidated(ctx, billing, period, id, currency, byCurrency[currency], now); err != nil {
+				return issued, err
+			}
+			issued++
+		}
+		if err := h.billing.MarkInvoiced(ctx, billing.TenantID, invoice.ID, invoice.InvoicedOrders()); err != nil {
+			return issued, err
+		}
+	}
+	return issued, nil
+}
+
+// issueConsolidated creates and finalizes the consolidated invoice id of
+// orders.
+func (h *InvoiceCommandHandler) issueConsolidated(ctx context.Context, billing *domain.ConsolidatedBilling, period domain.BillingPeriod, id uuid.UUID, currency string, orders []*domain.Order, now time.Time) (*domain.Invoice, error) {
+	issueDate := now.UTC()
+	if err := h.checkTaxPeriod(ctx, billing.TenantID, issueDate); err != nil {
+		return nil, err
+	}
+
+	invoice, err := domain.NewInvoice(billing.TenantID, billing.ClientID, uuid.Nil, domain.InvoiceTypeStandard, currency, billing.PaymentTerm, issueDate)
+	if err != nil {
+		return nil, err
+	}
+	invoice.ID = id
+	invoice.BillingPeriod = period.Key
+	invoice.SetDueDate(invoice.CalculateDueDate())
+	invoice.SetNotes("Orders delivered up to " + period.End.AddDate(0, 0, -1).Format("2006-01-02") + ", billing period " + period.Key)
+
+	number, err := h.invoiceCounter.GetNextInvoiceNumber(ctx, billing.TenantID, issueDate.Year())
+	if err != nil {
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to generate invoice number")
+	}
+	invoice.SetInvoiceNumber(number)
+	invoice.Version = 1
+
+	cmd := NewCommand("consolidateInvoice", billing.TenantID.String(), id.String(), "", nil)
+	events := []*eventpkg.EventEnvelope{createdEvent(cmd, invoice)}
+	invoice.ConsolidateOrders(orders)
+	for _, line := range invoice.Lines {
+		events = append(events, lineAddedEvent(cmd, invoice, line))
+	}
+	invoice.SetStatus(domain.InvoiceStatusPending)
+	h.convert(ctx, invoice)
+	events = append(events, finalizedEvent(cmd, invoice))
+
+	if err := h.commit(ctx, invoice.Version, func(ctx context.Context) error {
+		return h.invoiceRepo.Create(ctx, invoice)
+	}, events...); err != nil {
+		return nil, err
+	}
+
+	h.logger.New(ctx).Info("Consolidated invoice issued",
+		"invoice_id", invoice.ID,
+		"invoice_number", invoice.InvoiceNumber,
+		"client_id", invoice.ClientID,
+		"period", period.Key,
+		"orders", len(orders),
+	)
+	return invoice, nil
+}
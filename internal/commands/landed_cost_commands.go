@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/money"
+)
+
+// AddLandedCost records a freight, duty or insurance charge against a
+// receipt. Amount is read from the command data with money.Parse, so it may
+// also be given as amountMinor.
+type AddLandedCost struct {
+	OperationID uuid.UUID
+	Type        string
+	Currency    string
+	Method      string
+	Reference   string
+}
+
+// ProductCostRepository loads and saves the products whose cost price a
+// landed cost changes.
+type ProductCostRepository interface {
+	FindByID(ctx context.Context, id uuid.UUID) (*domain.Product, error)
+	Update(ctx context.Context, product *domain.Product) error
+}
+
+// LandedCostCommandHandler allocates landed costs across the lines of a
+// receipt and capitalizes each share into the stock it arrived with, so that
+// inventory valuation and product margins include it.
+type LandedCostCommandHandler struct {
+	operationRepo domain.OperationRepository
+	inventoryRepo domain.InventoryRepository
+	productRepo   ProductCostRepository
+	publisher     events.Publisher
+}
+
+func NewLandedCostCommandHandler(
+	operationRepo domain.OperationRepository,
+	inventoryRepo domain.InventoryRepository,
+	productRepo ProductCostRepository,
+	publisher events.Publisher,
+) *LandedCostCommandHandler {
+	return &LandedCostCommandHandler{
+		operationRepo: operationRepo,
+		inventoryRepo: inventoryRepo,
+		productRepo:   productRepo,
+		publisher:     publisher,
+	}
+}
+
+func (h *LandedCostCommandHandler) HandleAddLandedCost(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input AddLandedCost
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	if input.Currency == "" {
+		return nil, errors.InvalidArgument("currency is required")
+	}
+	amount, ok, err := money.Parse(cmd.Data, "amount", input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.InvalidArgument("amount is required")
+	}
+
+	operation, err := h.operationRepo.FindByID(ctx, input.OperationID)
+	if err != nil {
+		return nil, fmt.Errorf("operation not found: %w", err)
+	}
+
+	cost := domain.LandedCost{
+		ID:        uuid.New(),
+		Type:      domain.LandedCostType(input.Type),
+		Amount:    amount,
+		Currency:  input.Currency,
+		Method:    domain.AllocationMethod(input.Method),
+		Reference: input.Reference,
+		CreatedBy: userID,
+	}
+	allocations, err := operation.AddLandedCost(cost)
+	if err != nil {
+		return nil, err
+	}
+	cost = operation.LandedCosts[len(operation.LandedCosts)-1]
+
+	// Load everything the cost touches before changing any of it, so that a
+	// missing item or product leaves the stock values as they were.
+	items := make(map[uuid.UUID]*domain.InventoryItem)
+	products := make(map[uuid.UUID]*domain.Product)
+	for _, allocation := range allocations {
+		if _, ok := items[allocation.ProductID]; ok {
+			continue
+		}
+		item, err := h.inventoryRepo.FindByProductAndWarehouse(ctx, allocation.ProductID, operation.WarehouseID)
+		if err != nil {
+			return nil, fmt.Errorf("inventory not found for product %s: %w", allocation.ProductID, err)
+		}
+		product, err := h.productRepo.FindByID(ctx, allocation.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("product not found: %w", err)
+		}
+		items[allocation.ProductID] = item
+		products[allocation.ProductID] = product
+	}
+
+	// Stock that has already left the warehouse cannot carry its share; the
+	// cost stays recorded on the receipt but changes no valuation.
+	capitalized := make(map[uuid.UUID]bool)
+	for _, allocation := range allocations {
+		if items[allocation.ProductID].AddLandedCost(allocation.Amount) {
+			capitalized[allocation.ProductID] = true
+		}
+	}
+	for productID := range capitalized {
+		item := items[productID]
+		if err := h.inventoryRepo.Update(ctx, item); err != nil {
+			return nil, fmt.Errorf("failed to update inventory: %w", err)
+		}
+		product := products[productID]
+		product.SetCostPrice(item.UnitCost)
+		if err := h.productRepo.Update(ctx, product); err != nil {
+			return nil, fmt.Errorf("failed to update product cost: %w", err)
+		}
+	}
+
+	if err := h.operationRepo.Update(ctx, operation); err != nil {
+		return nil, fmt.Errorf("failed to record landed cost: %w", err)
+	}
+
+	evt := events.NewLandedCostAddedEvent(operation, cost, cmd.UserID)
+	if err := h.publisher.PublishEvent(ctx, &evt.EventEnvelope); err != nil {
+		return nil, fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return &CommandResult{
+		Success: true,
+		Data:    operation,
+		Events:  []interface{}{evt},
+	}, nil
+}
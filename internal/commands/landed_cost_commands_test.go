@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MockInventoryRepository struct {
+	domain.InventoryRepository
+	items   map[uuid.UUID]*domain.InventoryItem
+	updated int
+}
+
+func (r *MockInventoryRepository) FindByProductAndWarehouse(ctx context.Context, productID, warehouseID uuid.UUID) (*domain.InventoryItem, error) {
+	for _, item := range r.items {
+		if item.ProductID == productID && item.WarehouseID == warehouseID {
+			return item, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *MockInventoryRepository) FindByProduct(ctx context.Context, productID uuid.UUID) ([]*domain.InventoryItem, error) {
+	var items []*domain.InventoryItem
+	for _, item := range r.items {
+		if item.ProductID == productID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (r *MockInventoryRepository) Update(ctx context.Context, item *domain.InventoryItem) error {
+	r.items[item.ID] = item
+	r.updated++
+	return nil
+}
+
+type MockProductRepository struct {
+	products map[uuid.UUID]*domain.Product
+}
+
+func (r *MockProductRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.Product, error) {
+	if p, ok := r.products[id]; ok {
+		return p, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *MockProductRepository) Update(ctx context.Context, product *domain.Product) error {
+	r.products[product.ID] = product
+	return nil
+}
+
+func TestLandedCostCommandHandler_AddLandedCost(t *testing.T) {
+	tenantID := uuid.New()
+	userID := uuid.New()
+	warehouseID := uuid.New()
+
+	operationRepo := NewMockOperationRepository()
+	inventoryRepo := &MockInventoryRepository{items: make(map[uuid.UUID]*domain.InventoryItem)}
+	productRepo := &MockProductRepository{products: make(map[uuid.UUID]*domain.Product)}
+	publisher := &MockPublisher{}
+
+	handler := NewLandedCostCommandHandler(operationRepo, inventoryRepo, productRepo, publisher)
+
+	receipt, _ := domain.NewWarehouseOperation(tenantID, warehouseID, userID, domain.OperationTypeReceipt, "purchase_order", uuid.New())
+	for _, unitCost := range []int64{20, 5} {
+		product := &domain.Product{ID: uuid.New(), TenantID: tenantID}
+		product.SetPricing(decimal.NewFromInt(40), decimal.NewFromInt(40), decimal.NewFromInt(unitCost))
+		productRepo.products[product.ID] = product
+
+		item := domain.NewInventoryItem(tenantID, product.ID, warehouseID, "", 0, decimal.Zero)
+		item.Receive(10, decimal.NewFromInt(unitCost))
+		inventoryRepo.items[item.ID] = item
+
+		receipt.AddItem(domain.OperationItem{
+			ID: uuid.New(), ProductID: product.ID, Quantity: 10, QuantityDone: 10,
+			UnitCost: decimal.NewFromInt(unitCost), Status: "completed",
+		})
+	}
+	operationRepo.Create(context.Background(), receipt)
+
+	cmd := NewCommand("addLandedCost", tenantID.String(), "", userID.String(), map[string]interface{}{
+		"operationId": receipt.ID.String(),
+		"type":        "freight",
+		"amount":      "50.00",
+		"currency":    "USD",
+		"method":      "value",
+		"reference":   "CARRIER-881",
+	})
+
+	result, err := handler.HandleAddLandedCost(context.Background(), cmd)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	updated, _ := operationRepo.FindByID(context.Background(), receipt.ID)
+	require.Len(t, updated.LandedCosts, 1)
+	assert.Equal(t, "40", updated.Items[0].LandedCost.String())
+	assert.Equal(t, "10", updated.Items[1].LandedCost.String())
+
+	first, _ := inventoryRepo.FindByProductAndWarehouse(context.Background(), updated.Items[0].ProductID, warehouseID)
+	assert.Equal(t, "24", first.UnitCost.String())
+	assert.Equal(t, "240", first.TotalValue.String())
+	assert.Equal(t, 2, inventoryRepo.updated)
+
+	product, _ := productRepo.FindByID(context.Background(), updated.Items[0].ProductID)
+	assert.Equal(t, "24", product.Pricing.CostPrice.String())
+	assert.Equal(t, "16", product.Pricing.Margin.String())
+
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "warehouse.operation.landed_cost_added", publisher.events[0].Type)
+}
+
+func TestLandedCostCommandHandler_AddLandedCostRejectsBadAmount(t *testing.T) {
+	operationRepo := NewMockOperationRepository()
+	handler := NewLandedCostCommandHandler(operationRepo, &MockInventoryRepository{}, &MockProductRepository{}, &MockPublisher{})
+
+	receipt, _ := domain.NewWarehouseOperation(uuid.New(), uuid.New(), uuid.New(), domain.OperationTypeReceipt, "purchase_order", uuid.New())
+	operationRepo.Create(context.Background(), receipt)
+
+	cmd := NewCommand("addLandedCost", receipt.TenantID.String(), "", uuid.New().String(), map[string]interface{}{
+		"operationId": receipt.ID.String(),
+		"type":        "duty",
+		"amount":      "12.345",
+		"currency":    "USD",
+		"method":      "quantity",
+	})
+
+	_, err := handler.HandleAddLandedCost(context.Background(), cmd)
+	assert.EqualError(t, err, "amount has more than 2 decimals for USD")
+	assert.Empty(t, receipt.LandedCosts)
+}
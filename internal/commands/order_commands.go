@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// AddOrderLine adds quantity units of a product to an order. UnitPrice and
+// Discount, the discount on the whole line, are read from the command data
+// with money.Parse in the order currency. The line's cost is expected from
+// the product's stock in WarehouseID, or in every warehouse without one.
+// A line priced below the product's floor needs OverrideReason.
+type AddOrderLine struct {
+	OrderID        uuid.UUID
+	ProductID      uuid.UUID
+	WarehouseID    uuid.UUID
+	Quantity       int
+	OverrideReason string
+}
+
+// ApprovePriceOverride approves the price override of an order line on
+// behalf of the user sending the command.
+type ApprovePriceOverride struct {
+	OrderID uuid.UUID
+	LineID  uuid.UUID
+}
+
+type OrderRepository interface {
+	FindByID(ctx context.Context, id uuid.UUID) (*domain.Order, error)
+	Update(ctx context.Context, order *domain.Order) error
+}
+
+// ProductReader loads the products order lines are priced against.
+type ProductReader interface {
+	FindByID(ctx context.Context, id uuid.UUID) (*domain.Product, error)
+}
+
+// OrderCommandHandler enters order lines, holding lines priced below their
+// product's floor until another user approves the price.
+type OrderCommandHandler struct {
+	orderRepo     OrderRepository
+	productRepo   ProductReader
+	inventoryRepo domain.InventoryRepository
+	publisher     events.Publisher
+}
+
+func NewOrderCommandHandler(
+	orderRepo OrderRepository,
+	productRepo ProductReader,
+	inventoryRepo domain.InventoryRepository,
+	publisher events.Publisher,
+) *OrderCommandHandler {
+	return &OrderCommandHandler{
+		orderRepo:     orderRepo,
+		productRepo:   productRepo,
+		inventoryRepo: inventoryRepo,
+		publisher:     publisher,
+	}
+}
+
+func (h *OrderCommandHandler) HandleAddOrderLine(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input AddOrderLine
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	if input.Quantity <= 0 {
+		return nil, errors.InvalidArgument("quantity must be positive")
+	}
+
+	order, err := h.orderRepo.FindByID(ctx, input.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+	if order.Status != domain.OrderStatusDraft && order.Status != domain.OrderStatusPending {
+		return nil, domain.ErrOrderNotEditable
+	}
+
+	unitPrice, ok, err := money.Parse(cmd.Data, "unitPrice", order.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.InvalidArgument("unitPrice is required")
+	}
+	discount, _, err := money.Parse(cmd.Data, "discount", order.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := h.productRepo.FindByID(ctx, input.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("product not found: %w", err)
+	}
+	unitCost, err := h.expectedUnitCost(ctx, product, input.WarehouseID, input.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := order.AddPricedLine(domain.OrderLine{
+		ProductID: product.ID,
+		SKU:       product.SKU,
+		Name:      product.Name,
+		Quantity:  input.Quantity,
+		UnitPrice: unitPrice,
+		UnitCost:  unitCost,
+		Discount:  discount,
+	}, product.FloorPrice(unitCost, order.Currency), userID, input.OverrideReason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.orderRepo.Update(ctx, order); err != nil {
+		return nil, fmt.Errorf("failed to add order line: %w", err)
+	}
+
+	evt := events.NewOrderLineAddedEvent(order, line, cmd.UserID)
+	if err := h.publisher.PublishEvent(ctx, &evt.EventEnvelope); err != nil {
+		return nil, fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return &CommandResult{
+		Success: true,
+		Data:    order,
+		Events:  []interface{}{evt},
+	}, nil
+}
+
+// expectedUnitCost costs quantity units of product from its stock, first in
+// first out, and any units beyond it at the product's cost price.
+func (h *OrderCommandHandler) expectedUnitCost(ctx context.Context, product *domain.Product, warehouseID uuid.UUID, quantity int) (decimal.Decimal, error) {
+	items, err := h.inventoryRepo.FindByProduct(ctx, product.ID)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to load inventory: %w", err)
+	}
+	var layers []*domain.InventoryItem
+	for _, item := range items {
+		if warehouseID == uuid.Nil || item.WarehouseID == warehouseID {
+			layers = append(layers, item)
+		}
+	}
+	unitCost, _ := domain.ExpectedUnitCost(layers, quantity, product.Pricing.CostPrice)
+	return unitCost, nil
+}
+
+func (h *OrderCommandHandler) HandleApprovePriceOverride(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input ApprovePriceOverride
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	order, err := h.orderRepo.FindByID(ctx, input.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+
+	line, err := order.ApprovePriceOverride(input.LineID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.orderRepo.Update(ctx, order); err != nil {
+		return nil, fmt.Errorf("failed to approve price override: %w", err)
+	}
+
+	evt := events.NewPriceOverrideApprovedEvent(order, line, cmd.UserID)
+	if err := h.publisher.PublishEvent(ctx, &evt.EventEnvelope); err != nil {
+		return nil, fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return &CommandResult{
+		Success: true,
+		Data:    order,
+		Events:  []interface{}{evt},
+	}, nil
+}
@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MockOrderRepository struct {
+	orders map[uuid.UUID]*domain.Order
+}
+
+func (r *MockOrderRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.Order, error) {
+	if order, ok := r.orders[id]; ok {
+		return order, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *MockOrderRepository) Update(ctx context.Context, order *domain.Order) error {
+	r.orders[order.ID] = order
+	return nil
+}
+
+// newOrderFixture returns a handler over a draft USD order and a product
+// with a 20% minimum margin, stocked in warehouseID with 5 units at 10 and
+// 5 newer ones at 20.
+func newOrderFixture(t *testing.T, warehouseID uuid.UUID) (*OrderCommandHandler, *domain.Order, *domain.Product, *MockPublisher) {
+	tenantID := uuid.New()
+	order, _ := domain.NewOrder(tenantID, uuid.New(), uuid.New(), domain.OrderTypeStandard, domain.OrderSourcePhone, "USD")
+
+	product := &domain.Product{ID: uuid.New(), TenantID: tenantID, SKU: "SKU-1", Name: "Widget"}
+	product.SetPricing(decimal.NewFromInt(30), decimal.NewFromInt(30), decimal.NewFromInt(18))
+	require.NoError(t, product.SetPriceFloor(decimal.Zero, decimal.NewFromInt(20)))
+
+	inventoryRepo := &MockInventoryRepository{items: make(map[uuid.UUID]*domain.InventoryItem)}
+	for i, unitCost := range []int64{10, 20} {
+		item := domain.NewInventoryItem(tenantID, product.ID, warehouseID, product.SKU, 5, decimal.NewFromInt(unitCost))
+		item.CreatedAt = time.Now().Add(time.Duration(i) * time.Hour)
+		inventoryRepo.items[item.ID] = item
+	}
+	elsewhere := domain.NewInventoryItem(tenantID, product.ID, uuid.New(), product.SKU, 100, decimal.NewFromInt(1))
+	elsewhere.CreatedAt = time.Now().Add(-time.Hour)
+	inventoryRepo.items[elsewhere.ID] = elsewhere
+
+	publisher := &MockPublisher{}
+	handler := NewOrderCommandHandler(
+		&MockOrderRepository{orders: map[uuid.UUID]*domain.Order{order.ID: order}},
+		&MockProductRepository{products: map[uuid.UUID]*domain.Product{product.ID: product}},
+		inventoryRepo,
+		publisher,
+	)
+	return handler, order, product, publisher
+}
+
+func TestOrderCommandHandler_AddOrderLine(t *testing.T) {
+	warehouseID := uuid.New()
+	handler, order, product, publisher := newOrderFixture(t, warehouseID)
+
+	cmd := NewCommand("addOrderLine", order.TenantID.String(), "", uuid.New().String(), map[string]interface{}{
+		"orderId":     order.ID.String(),
+		"productId":   product.ID.String(),
+		"warehouseId": warehouseID.String(),
+		"quantity":    10,
+		"unitPrice":   "20.00",
+	})
+
+	result, err := handler.HandleAddOrderLine(context.Background(), cmd)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	require.Len(t, order.Lines, 1)
+	line := order.Lines[0]
+	assert.Equal(t, "15", line.UnitCost.String(), "five units at 10 then five at 20")
+	assert.Equal(t, "18.75", line.FloorPrice.String())
+	assert.Nil(t, line.PriceOverride)
+
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "order.line_added", publisher.events[0].Type)
+}
+
+func TestOrderCommandHandler_AddOrderLineBelowFloor(t *testing.T) {
+	warehouseID := uuid.New()
+	handler, order, product, publisher := newOrderFixture(t, warehouseID)
+	data := map[string]interface{}{
+		"orderId":        order.ID.String(),
+		"productId":      product.ID.String(),
+		"warehouseId":    warehouseID.String(),
+		"quantity":       10,
+		"unitPriceMinor": 1800,
+	}
+
+	_, err := handler.HandleAddOrderLine(context.Background(), NewCommand("addOrderLine", order.TenantID.String(), "", uuid.New().String(), data))
+	assert.Equal(t, domain.ErrPriceBelowFloor, err)
+	assert.Empty(t, order.Lines)
+
+	clerk := uuid.New()
+	data["overrideReason"] = "competitor price match"
+	_, err = handler.HandleAddOrderLine(context.Background(), NewCommand("addOrderLine", order.TenantID.String(), "", clerk.String(), data))
+	require.NoError(t, err)
+	require.Len(t, order.Lines, 1)
+	require.NotNil(t, order.Lines[0].PriceOverride)
+	assert.Equal(t, "competitor price match", order.Lines[0].PriceOverride.Reason)
+	assert.Equal(t, true, publisher.events[0].Data["belowFloor"])
+
+	approve := map[string]interface{}{"orderId": order.ID.String(), "lineId": order.Lines[0].ID.String()}
+	_, err = handler.HandleApprovePriceOverride(context.Background(), NewCommand("approvePriceOverride", order.TenantID.String(), "", clerk.String(), approve))
+	assert.Equal(t, domain.ErrPriceOverrideSelfApproval, err)
+
+	result, err := handler.HandleApprovePriceOverride(context.Background(), NewCommand("approvePriceOverride", order.TenantID.String(), "", uuid.New().String(), approve))
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.True(t, order.Lines[0].PriceOverride.IsApproved())
+	assert.Equal(t, "order.price_override_approved", publisher.events[1].Type)
+	assert.NoError(t, order.Confirm())
+}
+
+func TestOrderCommandHandler_AddOrderLineToConfirmedOrder(t *testing.T) {
+	handler, order, product, _ := newOrderFixture(t, uuid.New())
+	require.NoError(t, order.Confirm())
+
+	cmd := NewCommand("addOrderLine", order.TenantID.String(), "", uuid.New().String(), map[string]interface{}{
+		"orderId":   order.ID.String(),
+		"productId": product.ID.String(),
+		"quantity":  1,
+		"unitPrice": "30",
+	})
+
+	_, err := handler.HandleAddOrderLine(context.Background(), cmd)
+	assert.Equal(t, domain.ErrOrderNotEditable, err)
+}
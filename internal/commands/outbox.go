@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// EventOutbox stages events in the same database transaction as the aggregate
+// write; a relay publishes them afterwards so a crash cannot lose events.
+type EventOutbox interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	Enqueue(ctx context.Context, events ...*eventpkg.EventEnvelope) error
+}
+
+// EventStore appends and loads aggregate events. repository.EventStore and
+// repository.PostgresEventStore implement it.
+type EventStore interface {
+	Save(ctx context.Context, events []repository.StoredEvent) error
+	Load(ctx context.Context, aggregateID string) ([]repository.StoredEvent, error)
+}
+
+// commitEvents persists an aggregate change together with its events. With an
+// outbox, write and enqueue run in one transaction. Without one it falls back
+// to write-then-publish, where a failed publish is only logged.
+func commitEvents(
+	ctx context.Context,
+	outbox EventOutbox,
+	publisher Publisher,
+	log *logger.Logger,
+	write func(ctx context.Context) error,
+	events ...*eventpkg.EventEnvelope,
+) error {
+	if outbox != nil {
+		return outbox.WithTransaction(ctx, func(txCtx context.Context) error {
+			if err := write(txCtx); err != nil {
+				return err
+			}
+			return outbox.Enqueue(txCtx, events...)
+		})
+	}
+
+	if err := write(ctx); err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := publisher.PublishEvent(ctx, event); err != nil {
+			log.New(ctx).Error("Failed to publish event", "event_type", event.Type, "aggregate_id", event.AggregateID, "error", err)
+		}
+	}
+	return nil
+}
+
+// checkExpectedVersion rejects a command whose expectedVersion no longer
+// matches the aggregate. Commands without one skip the check.
+func checkExpectedVersion(cmd *CommandEnvelope, resource string, current int64) error {
+	if cmd.ExpectedVersion > 0 && cmd.ExpectedVersion != current {
+		return errors.VersionConflict(resource, cmd.ExpectedVersion, current)
+	}
+	return nil
+}
+
+// asVersionConflict reports a write that lost a race with another writer as
+// a retryable conflict; other errors pass through unchanged.
+func asVersionConflict(err error, resource string, expected int64) error {
+	if stderrors.Is(err, repository.ErrConcurrencyConflict) {
+		return errors.VersionConflict(resource, expected, 0)
+	}
+	return err
+}
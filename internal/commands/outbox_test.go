@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/google/uuid"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type txKey struct{}
+
+type mockOutbox struct {
+	committed []*eventpkg.EventEnvelope
+	enqueueTx bool
+}
+
+func (o *mockOutbox) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	staged := o.committed
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		o.committed = staged
+		return err
+	}
+	return nil
+}
+
+func (o *mockOutbox) Enqueue(ctx context.Context, events ...*eventpkg.EventEnvelope) error {
+	o.enqueueTx, _ = ctx.Value(txKey{}).(bool)
+	o.committed = append(o.committed, events...)
+	return nil
+}
+
+func TestInvoiceCommandHandler_WithOutbox(t *testing.T) {
+	repo := newMockInvoiceRepo()
+	publisher := &mockPublisher{}
+	outbox := &mockOutbox{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+
+	handler := NewInvoiceCommandHandler(repo, nil, publisher, log, &mockInvoiceCounter{}).WithOutbox(outbox)
+
+	invoice, err := handler.HandleCreateInvoice(context.Background(), &CommandEnvelope{
+		TenantID: uuid.New().String(),
+		UserID:   uuid.New().String(),
+		Data:     map[string]interface{}{"clientId": uuid.New().String()},
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, repo.invoices, invoice.ID)
+	assert.Empty(t, publisher.events, "events must not be published directly when an outbox is set")
+	require.Len(t, outbox.committed, 1)
+	assert.Equal(t, "invoice.created", outbox.committed[0].Type)
+	assert.True(t, outbox.enqueueTx, "events must be enqueued inside the transaction")
+}
+
+func TestCommitEvents_WriteFailureSkipsEvents(t *testing.T) {
+	publisher := &mockPublisher{}
+	outbox := &mockOutbox{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	event := eventpkg.NewEvent(uuid.New().String(), "invoice", "invoice.created", uuid.New().String(), "", nil)
+	writeErr := stderrors.New("write failed")
+
+	err := commitEvents(context.Background(), outbox, publisher, log, func(ctx context.Context) error {
+		return writeErr
+	}, event)
+	assert.ErrorIs(t, err, writeErr)
+	assert.Empty(t, outbox.committed)
+
+	err = commitEvents(context.Background(), nil, publisher, log, func(ctx context.Context) error {
+		return writeErr
+	}, event)
+	assert.ErrorIs(t, err, writeErr)
+	assert.Empty(t, publisher.events)
+}
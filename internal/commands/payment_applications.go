@@ -0,0 +1,347 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// applyOnCompletion applies a payment that has just completed to its
+// invoice, amount of it up to the amount due; the rest stays unapplied,
+// to be applied to other invoices. It returns the invoice to write with
+// the payment.
+func applyOnCompletion(ctx context.Context, invoices InvoiceRepository, payment *domain.Payment, amount decimal.Decimal, at time.Time) (*domain.Invoice, *domain.PaymentApplication, error) {
+	invoice, err := invoices.FindByID(ctx, payment.InvoiceID)
+	if err != nil || invoice == nil {
+		return nil, nil, errors.NotFound("invoice not found")
+	}
+	if invoice.TenantID != payment.TenantID {
+		return nil, nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to payment tenant")
+	}
+
+	if !amount.IsPositive() || amount.GreaterThan(payment.Unapplied()) {
+		amount = payment.Unapplied()
+	}
+	if amount.GreaterThan(invoice.AmountDue) {
+		amount = invoice.AmountDue
+	}
+	application, err := payment.ApplyTo(invoice, amount, nil, at)
+	if err != nil {
+		return nil, nil, err
+	}
+	return invoice, &application, nil
+}
+
+// recordApplication adds what of a payment is applied, its applications
+// and the account credit it leaves the client, to its payment.processed
+// event.
+func recordApplication(event *eventpkg.EventEnvelope, payment *domain.Payment) {
+	event.Data["amountApplied"] = payment.AmountApplied.String()
+	event.Data["accountCredit"] = payment.AccountCredit().String()
+	event.Data["applications"] = applicationsData(payment.Applications)
+}
+
+// applicationsData is the history of applications of a payment or an
+// invoice as events carry it, in full so that read models are set from it
+// whatever they already hold.
+func applicationsData(applications []domain.PaymentApplication) []interface{} {
+	data := make([]interface{}, len(applications))
+	for i, application := range applications {
+		entry := map[string]interface{}{
+			"id":            application.ID.String(),
+			"paymentId":     application.PaymentID.String(),
+			"invoiceId":     application.InvoiceID.String(),
+			"invoiceNumber": application.InvoiceNumber,
+			"amount":        application.Amount.String(),
+			"appliedAt":     application.AppliedAt,
+		}
+		if application.AppliedBy != nil {
+			entry["appliedBy"] = application.AppliedBy.String()
+		}
+		if application.UnappliedAt != nil {
+			entry["unappliedBy"] = application.UnappliedBy.String()
+			entry["unappliedAt"] = *application.UnappliedAt
+			entry["unapplyReason"] = application.UnapplyReason
+		}
+		data[i] = entry
+	}
+	return data
+}
+
+// HandleApplyPayment applies a completed payment, the command's target, to
+// an invoice of the same client: amount of it, or as much as the invoice
+// owes and the payment has unapplied. It returns the payment and the
+// invoice, both written in one transaction with an outbox.
+func (h *PaymentCommandHandler) HandleApplyPayment(ctx context.Context, cmd *CommandEnvelope) (*domain.Payment, *domain.Invoice, error) {
+	payment, err := h.loadPayment(ctx, cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	invoiceID, err := uuid.Parse(getString(cmd.Data, "invoiceId"))
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid invoice ID")
+	}
+	invoice, err := h.invoiceRepo.FindByID(ctx, invoiceID)
+	if err != nil || invoice == nil || invoice.TenantID != payment.TenantID {
+		return nil, nil, errors.NotFound("invoice not found")
+	}
+	if invoice.ClientID != payment.ClientID {
+		return nil, nil, errors.InvalidArgument("invoice %s belongs to another client", invoice.InvoiceNumber)
+	}
+
+	amount, ok, err := money.Parse(cmd.Data, "amount", payment.Currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		amount = decimal.Min(payment.Unapplied(), invoice.AmountDue)
+	}
+
+	application, err := payment.ApplyTo(invoice, amount, &userID, time.Now().UTC())
+	if err != nil {
+		return nil, nil, paymentApplicationError(err)
+	}
+
+	recorded := applicationEvents(cmd, payment, invoice, application)
+	if paid := paidEvent(cmd, invoice, recorded[1]); paid != nil {
+		recorded = append(recorded, paid)
+	}
+
+	if err := h.commitApplication(ctx, payment, invoice, recorded...); err != nil {
+		h.logger.New(ctx).Error("Failed to apply payment", "error", err)
+		return nil, nil, errors.Wrap(err, errors.CodeInternalError, "failed to apply payment")
+	}
+
+	h.logger.New(ctx).Info("Payment applied",
+		"payment_id", payment.ID,
+		"invoice_id", invoice.ID,
+		"application_id", application.ID,
+		"amount", application.Amount.String(),
+		"unapplied", payment.Unapplied().String(),
+	)
+
+	return payment, invoice, nil
+}
+
+// applicationEvents reports application of payment to invoice: the
+// payment.applied event and the invoice.payment_applied it causes.
+func applicationEvents(cmd *CommandEnvelope, payment *domain.Payment, invoice *domain.Invoice, application domain.PaymentApplication) []*eventpkg.EventEnvelope {
+	applied := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.applied",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"applicationId": application.ID.String(),
+			"invoiceId":     invoice.ID.String(),
+			"invoiceNumber": invoice.InvoiceNumber,
+			"amount":        application.Amount.String(),
+			"amountApplied": payment.AmountApplied.String(),
+			"unapplied":     payment.Unapplied().String(),
+			"accountCredit": payment.AccountCredit().String(),
+			"applications":  applicationsData(payment.Applications),
+		},
+	)
+	applied.WithCorrelationID(cmd.CorrelationID)
+	applied.Version = payment.Version + 1
+
+	invoiceApplied := eventpkg.NewEvent(
+		invoice.ID.String(),
+		"invoice",
+		"invoice.payment_applied",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceNumber": invoice.InvoiceNumber,
+			"applicationId": application.ID.String(),
+			"paymentId":     payment.ID.String(),
+			"reference":     payment.Reference,
+			"amount":        application.Amount.String(),
+			"amountPaid":    invoice.AmountPaid.String(),
+			"amountDue":     invoice.AmountDue.String(),
+			"status":        string(invoice.Status),
+			"applications":  applicationsData(invoice.PaymentApplications),
+		},
+	)
+	invoiceApplied.WithCorrelationID(cmd.CorrelationID).WithCausationID(applied.ID)
+	return []*eventpkg.EventEnvelope{applied, invoiceApplied}
+}
+
+// paidEvent returns the invoice.paid event that marks the application
+// reported by cause as settling invoice, as when a payment is recorded
+// against it, or nil when the invoice still owes. Like the invoice's other
+// events, it is versioned by numberInvoiceEvents.
+func paidEvent(cmd *CommandEnvelope, invoice *domain.Invoice, cause *eventpkg.EventEnvelope) *eventpkg.EventEnvelope {
+	if invoice.Status != domain.InvoiceStatusPaid {
+		return nil
+	}
+	paid := eventpkg.NewEvent(
+		invoice.ID.String(),
+		"invoice",
+		"invoice.paid",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceNumber": invoice.InvoiceNumber,
+			"clientId":      invoice.ClientID.String(),
+			"total":         invoice.Total.String(),
+			"amountPaid":    invoice.AmountPaid.String(),
+			"currency":      invoice.Currency,
+		},
+	)
+	paid.WithCorrelationID(cmd.CorrelationID).WithCausationID(cause.ID)
+	return paid
+}
+
+// HandleUnapplyPayment takes an application of the payment that is the
+// command's target off its invoice, e.g. a receipt applied to the wrong
+// invoice, with a reason. The invoice owes the amount again and the
+// payment has it unapplied, to be applied again elsewhere.
+func (h *PaymentCommandHandler) HandleUnapplyPayment(ctx context.Context, cmd *CommandEnvelope) (*domain.Payment, *domain.Invoice, error) {
+	payment, err := h.loadPayment(ctx, cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+
+	applicationID, err := uuid.Parse(getString(cmd.Data, "applicationId"))
+	if err != nil {
+		return nil, nil, errors.InvalidArgument("invalid application ID")
+	}
+	reason := getString(cmd.Data, "reason")
+	if reason == "" {
+		return nil, nil, errors.InvalidArgument("a reason is required to unapply a payment")
+	}
+
+	var invoiceID uuid.UUID
+	for _, application := range payment.Applications {
+		if application.ID == applicationID {
+			invoiceID = application.InvoiceID
+		}
+	}
+	if invoiceID == uuid.Nil {
+		return nil, nil, errors.NotFound("payment application not found")
+	}
+	invoice, err := h.invoiceRepo.FindByID(ctx, invoiceID)
+	if err != nil || invoice == nil || invoice.TenantID != payment.TenantID {
+		return nil, nil, errors.NotFound("invoice not found")
+	}
+
+	application, err := payment.Unapply(applicationID, invoice, userID, reason, time.Now().UTC())
+	if err != nil {
+		return nil, nil, paymentApplicationError(err)
+	}
+
+	unapplied := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.unapplied",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"applicationId": application.ID.String(),
+			"invoiceId":     invoice.ID.String(),
+			"invoiceNumber": invoice.InvoiceNumber,
+			"amount":        application.Amount.String(),
+			"amountApplied": payment.AmountApplied.String(),
+			"unapplied":     payment.Unapplied().String(),
+			"reason":        reason,
+			"applications":  applicationsData(payment.Applications),
+		},
+	)
+	unapplied.WithCorrelationID(cmd.CorrelationID)
+	unapplied.Version = payment.Version + 1
+
+	invoiceUnapplied := eventpkg.NewEvent(
+		invoice.ID.String(),
+		"invoice",
+		"invoice.payment_unapplied",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceNumber": invoice.InvoiceNumber,
+			"applicationId": application.ID.String(),
+			"paymentId":     payment.ID.String(),
+			"amount":        application.Amount.String(),
+			"amountPaid":    invoice.AmountPaid.String(),
+			"amountDue":     invoice.AmountDue.String(),
+			"status":        string(invoice.Status),
+			"reason":        reason,
+			"applications":  applicationsData(invoice.PaymentApplications),
+		},
+	)
+	invoiceUnapplied.WithCorrelationID(cmd.CorrelationID).WithCausationID(unapplied.ID)
+
+	if err := h.commitApplication(ctx, payment, invoice, unapplied, invoiceUnapplied); err != nil {
+		h.logger.New(ctx).Error("Failed to unapply payment", "error", err)
+		return nil, nil, errors.Wrap(err, errors.CodeInternalError, "failed to unapply payment")
+	}
+
+	h.logger.New(ctx).Info("Payment unapplied",
+		"payment_id", payment.ID,
+		"invoice_id", invoice.ID,
+		"application_id", application.ID,
+		"amount", application.Amount.String(),
+		"reason", reason,
+	)
+
+	return payment, invoice, nil
+}
+
+// loadPayment loads the payment in the command's TargetID, of the
+// command's tenant and at the version the command expects.
+func (h *PaymentCommandHandler) loadPayment(ctx context.Context, cmd *CommandEnvelope) (*domain.Payment, error) {
+	paymentID, err := uuid.Parse(cmd.TargetID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid payment ID")
+	}
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	payment, err := h.paymentRepo.FindByID(ctx, paymentID)
+	if err != nil || payment == nil {
+		return nil, errors.NotFound("payment not found")
+	}
+	if payment.TenantID != tenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "payment does not belong to tenant")
+	}
+	if err := checkExpectedVersion(cmd, "payment", payment.Version); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// commitApplication writes a payment and the invoice an application
+// changed, with their events.
+func (h *PaymentCommandHandler) commitApplication(ctx context.Context, payment *domain.Payment, invoice *domain.Invoice, events ...*eventpkg.EventEnvelope) error {
+	version := payment.Version
+	versions := numberInvoiceEvents(invoice, events)
+	err := commitEvents(ctx, h.outbox, h.publisher, h.logger, func(ctx context.Context) error {
+		if err := h.paymentRepo.Update(ctx, payment); err != nil {
+			return err
+		}
+		return saveInvoiceVersions(ctx, h.invoiceRepo, invoice, versions)
+	}, events...)
+	return asVersionConflict(err, "payment", version)
+}
+
+// paymentApplicationError reports an application the domain refuses as
+// unprocessable.
+func paymentApplicationError(err error) error {
+	var paymentErr *domain.PaymentError
+	if stderrors.As(err, &paymentErr) {
+		return errors.Newf(errors.CodeUnprocessable, "%s", paymentErr.Message)
+	}
+	return err
+}
@@ -7,19 +7,20 @@ import (
 	"github.com/google/uuid"
 	"github.com/ims-erp/system/internal/domain"
 	eventpkg "github.com/ims-erp/system/internal/events"
-	"github.com/ims-erp/system/internal/repository"
 	"github.com/ims-erp/system/pkg/errors"
 	"github.com/ims-erp/system/pkg/logger"
-	"github.com/shopspring/decimal"
+	"github.com/ims-erp/system/pkg/money"
 )
 
 type PaymentCommandHandler struct {
 	paymentRepo PaymentRepository
 	invoiceRepo InvoiceRepository
-	eventStore  *repository.EventStore
+	eventStore  EventStore
 	publisher   Publisher
+	outbox      EventOutbox
 	logger      *logger.Logger
 	processors  *domain.ProcessorRegistry
+	converter   CurrencyConverter
 }
 
 type PaymentRepository interface {
@@ -28,12 +29,14 @@ type PaymentRepository interface {
 	FindByID(ctx context.Context, id uuid.UUID) (*domain.Payment, error)
 	FindByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*domain.Payment, error)
 	FindByProviderID(ctx context.Context, providerID string) (*domain.Payment, error)
+	// FindByClientID returns the client's payments, oldest first.
+	FindByClientID(ctx context.Context, tenantID, clientID uuid.UUID) ([]*domain.Payment, error)
 }
 
 func NewPaymentCommandHandler(
 	paymentRepo PaymentRepository,
 	invoiceRepo InvoiceRepository,
-	eventStore *repository.EventStore,
+	eventStore EventStore,
 	publisher Publisher,
 	log *logger.Logger,
 	processors *domain.ProcessorRegistry,
@@ -48,6 +51,39 @@ func NewPaymentCommandHandler(
 	}
 }
 
+// WithOutbox routes events through the transactional outbox instead of
+// publishing them directly.
+func (h *PaymentCommandHandler) WithOutbox(outbox EventOutbox) *PaymentCommandHandler {
+	h.outbox = outbox
+	return h
+}
+
+// WithCurrencyConverter records the amount of payments in the tenant's
+// reporting currency when they are created.
+func (h *PaymentCommandHandler) WithCurrencyConverter(converter CurrencyConverter) *PaymentCommandHandler {
+	h.converter = converter
+	return h
+}
+
+// convert records the payment amount in the reporting currency at the rate
+// of the day it is created. Payments do not wait for rates: without one
+// the payment is left unconverted.
+func (h *PaymentCommandHandler) convert(ctx context.Context, payment *domain.Payment) {
+	if h.converter == nil {
+		return
+	}
+	conversion, err := h.converter.ToReportingCurrency(ctx, payment.TenantID, payment.Amount, payment.Currency, payment.CreatedAt)
+	if err != nil {
+		h.logger.New(ctx).Warn("Failed to convert payment amount", "payment_id", payment.ID, "currency", payment.Currency, "error", err)
+		return
+	}
+	payment.Conversion = conversion
+}
+
+func (h *PaymentCommandHandler) commit(ctx context.Context, write func(ctx context.Context) error, event *eventpkg.EventEnvelope) error {
+	return asVersionConflict(commitEvents(ctx, h.outbox, h.publisher, h.logger, write, event), "payment", 0)
+}
+
 func (h *PaymentCommandHandler) HandleCreatePayment(ctx context.Context, cmd *CommandEnvelope) (*domain.Payment, error) {
 	data := cmd.Data
 
@@ -66,20 +102,19 @@ func (h *PaymentCommandHandler) HandleCreatePayment(ctx context.Context, cmd *Co
 		return nil, errors.InvalidArgument("invalid client ID")
 	}
 
-	amount := decimal.Zero
-	if amountStr, ok := data["amount"].(string); ok {
-		amount, _ = decimal.NewFromString(amountStr)
-	}
-
-	if amount.IsZero() || amount.IsNegative() {
-		return nil, errors.InvalidArgument("payment amount must be greater than zero")
-	}
-
 	currency := getString(data, "currency")
 	if currency == "" {
 		currency = "USD"
 	}
 
+	amount, _, err := money.Parse(data, "amount", currency)
+	if err != nil {
+		return nil, err
+	}
+	if !amount.IsPositive() {
+		return nil, errors.InvalidArgument("payment amount must be greater than zero")
+	}
+
 	method := domain.PaymentMethod(getString(data, "method"))
 	if method == "" {
 		method = domain.PaymentMethodCreditCard
@@ -106,10 +141,14 @@ func (h *PaymentCommandHandler) HandleCreatePayment(ctx context.Context, cmd *Co
 		payment.Description = description
 	}
 
-	if err := h.paymentRepo.Create(ctx, payment); err != nil {
-		h.logger.New(ctx).Error("Failed to create payment", "error", err)
-		return nil, errors.InternalError("failed to create payment")
+	metadata, err := paymentMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata) > 0 {
+		payment.SetMetadata(metadata)
 	}
+	h.convert(ctx, payment)
 
 	event := eventpkg.NewEvent(
 		payment.ID.String(),
@@ -127,12 +166,19 @@ func (h *PaymentCommandHandler) HandleCreatePayment(ctx context.Context, cmd *Co
 			"reference":   payment.Reference,
 			"status":      string(payment.Status),
 			"description": payment.Description,
+			"metadata":    payment.Metadata,
 		},
 	)
+	if payment.Conversion != nil {
+		event.Data["conversion"] = conversionData(payment.Conversion)
+	}
 	event.WithCorrelationID(cmd.CorrelationID)
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish payment created event", "error", err)
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		return h.paymentRepo.Create(ctx, payment)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to create payment", "error", err)
+		return nil, errors.InternalError("failed to create payment")
 	}
 
 	h.logger.New(ctx).Info("Payment created",
@@ -145,6 +191,157 @@ func (h *PaymentCommandHandler) HandleCreatePayment(ctx context.Context, cmd *Co
 	return payment, nil
 }
 
+// HandleCreatePaymentIntent creates a payment of an invoice's amount due
+// with a provider whose payments the customer confirms in the browser, and
+// returns it with the client secret to confirm it with. The payment is
+// processing, with the intent as its ProviderID, until the provider's
+// webhook completes or fails it.
+func (h *PaymentCommandHandler) HandleCreatePaymentIntent(ctx context.Context, cmd *CommandEnvelope) (*domain.Payment, string, error) {
+	data := cmd.Data
+
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, "", errors.InvalidArgument("invalid tenant ID")
+	}
+
+	invoiceID, err := uuid.Parse(getString(data, "invoiceId"))
+	if err != nil {
+		return nil, "", errors.InvalidArgument("invalid invoice ID")
+	}
+
+	invoice, err := h.invoiceRepo.FindByID(ctx, invoiceID)
+	if err != nil || invoice == nil {
+		return nil, "", errors.NotFound("invoice not found")
+	}
+	if invoice.TenantID != tenantID {
+		return nil, "", errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
+	}
+	switch invoice.Status {
+	case domain.InvoiceStatusPending, domain.InvoiceStatusSent, domain.InvoiceStatusOverdue:
+	default:
+		return nil, "", errors.Newf(errors.CodeUnprocessable, "invoice in status %s cannot be paid", invoice.Status)
+	}
+	if !invoice.AmountDue.IsPositive() {
+		return nil, "", errors.Newf(errors.CodeUnprocessable, "invoice has no amount due")
+	}
+
+	metadata, err := paymentMetadata(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	provider := getString(data, "provider")
+	if provider == "" {
+		provider = "stripe"
+	}
+	processor, err := h.processors.GetProcessor(provider, nil)
+	if err != nil {
+		h.logger.New(ctx).Error("Payment processor not found", "provider", provider, "error", err)
+		return nil, "", errors.InvalidArgument("payment processor not available")
+	}
+	intents, ok := processor.(domain.PaymentIntentCreator)
+	if !ok {
+		return nil, "", errors.InvalidArgument("payment processor does not support payment intents")
+	}
+
+	payment := domain.NewPayment(tenantID, invoice.ID, invoice.ClientID, invoice.AmountDue, invoice.Currency, domain.PaymentMethod(provider))
+	payment.Provider = provider
+	payment.Description = "Invoice " + invoice.InvoiceNumber
+
+	providerMetadata := map[string]string{
+		"tenant_id":  payment.TenantID.String(),
+		"invoice_id": payment.InvoiceID.String(),
+		"payment_id": payment.ID.String(),
+	}
+	for key, value := range metadata {
+		providerMetadata[key] = value
+	}
+
+	intent, err := intents.CreatePaymentIntent(ctx, &domain.PaymentIntentRequest{
+		PaymentID:   payment.ID,
+		Amount:      payment.Amount,
+		Currency:    payment.Currency,
+		Description: payment.Description,
+		Metadata:    providerMetadata,
+	})
+	if err != nil {
+		h.logger.New(ctx).Error("Failed to create payment intent", "provider", provider, "invoice_id", invoice.ID, "error", err)
+		return nil, "", errors.Newf(errors.CodeServiceUnavailable, "failed to create payment intent: %v", err)
+	}
+
+	payment.MarkAsProcessing(intent.ID, "")
+	metadata[provider+"_payment_intent_id"] = intent.ID
+	payment.SetMetadata(metadata)
+	h.convert(ctx, payment)
+
+	event := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.created",
+		cmd.TenantID,
+		cmd.UserID,
+		map[string]interface{}{
+			"invoiceId":   payment.InvoiceID.String(),
+			"clientId":    payment.ClientID.String(),
+			"amount":      payment.Amount.String(),
+			"currency":    payment.Currency,
+			"method":      string(payment.Method),
+			"provider":    payment.Provider,
+			"providerId":  payment.ProviderID,
+			"status":      string(payment.Status),
+			"description": payment.Description,
+			"metadata":    payment.Metadata,
+		},
+	)
+	if payment.Conversion != nil {
+		event.Data["conversion"] = conversionData(payment.Conversion)
+	}
+	event.WithCorrelationID(cmd.CorrelationID)
+
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		return h.paymentRepo.Create(ctx, payment)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to create payment", "error", err)
+		return nil, "", errors.InternalError("failed to create payment")
+	}
+
+	h.logger.New(ctx).Info("Payment intent created",
+		"payment_id", payment.ID,
+		"invoice_id", payment.InvoiceID,
+		"amount", payment.Amount.String(),
+		"provider_id", payment.ProviderID,
+	)
+
+	return payment, intent.ClientSecret, nil
+}
+
+// paymentMetadata returns the caller's metadata of a payment command,
+// checked against domain.PaymentMetadataKeys. It is never nil.
+func paymentMetadata(data map[string]interface{}) (map[string]string, error) {
+	metadata := make(map[string]string)
+	switch raw := data["metadata"].(type) {
+	case nil:
+	case map[string]string:
+		for key, value := range raw {
+			metadata[key] = value
+		}
+	case map[string]interface{}:
+		for key, value := range raw {
+			str, ok := value.(string)
+			if !ok {
+				return nil, errors.InvalidArgument("metadata %q must be a string", key)
+			}
+			metadata[key] = str
+		}
+	default:
+		return nil, errors.InvalidArgument("metadata must be an object of strings")
+	}
+	if err := domain.ValidatePaymentMetadata(metadata); err != nil {
+		return nil, errors.InvalidArgument("%s", err.Error())
+	}
+	return metadata, nil
+}
+
 func (h *PaymentCommandHandler) HandleProcessPayment(ctx context.Context, cmd *CommandEnvelope) (*domain.Payment, error) {
 	paymentID, err := uuid.Parse(cmd.TargetID)
 	if err != nil {
@@ -165,6 +362,10 @@ func (h *PaymentCommandHandler) HandleProcessPayment(ctx context.Context, cmd *C
 		return nil, errors.Newf(errors.CodeForbidden, "payment does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "payment", payment.Version); err != nil {
+		return nil, err
+	}
+
 	if payment.Status != domain.PaymentStatusPending {
 		return nil, errors.InvalidArgument("payment is not in pending status")
 	}
@@ -179,7 +380,7 @@ func (h *PaymentCommandHandler) HandleProcessPayment(ctx context.Context, cmd *C
 
 	if err := h.paymentRepo.Update(ctx, payment); err != nil {
 		h.logger.New(ctx).Error("Failed to update payment status to processing", "error", err)
-		return nil, errors.InternalError("failed to process payment")
+		return nil, errors.Wrap(asVersionConflict(err, "payment", payment.Version), errors.CodeInternalError, "failed to process payment")
 	}
 
 	req := &domain.PaymentRequest{
@@ -206,10 +407,6 @@ func (h *PaymentCommandHandler) HandleProcessPayment(ctx context.Context, cmd *C
 
 		payment.MarkAsFailed(failureCode, failureMessage)
 
-		if updateErr := h.paymentRepo.Update(ctx, payment); updateErr != nil {
-			h.logger.New(ctx).Error("Failed to update payment failure status", "error", updateErr)
-		}
-
 		event := eventpkg.NewEvent(
 			payment.ID.String(),
 			"payment",
@@ -224,7 +421,12 @@ func (h *PaymentCommandHandler) HandleProcessPayment(ctx context.Context, cmd *C
 			},
 		)
 		event.WithCorrelationID(cmd.CorrelationID)
-		h.publisher.PublishEvent(ctx, event)
+
+		if updateErr := h.commit(ctx, func(ctx context.Context) error {
+			return h.paymentRepo.Update(ctx, payment)
+		}, event); updateErr != nil {
+			h.logger.New(ctx).Error("Failed to update payment failure status", "error", updateErr)
+		}
 
 		h.logger.New(ctx).Error("Payment processing failed",
 			"payment_id", payment.ID,
@@ -248,17 +450,11 @@ func (h *PaymentCommandHandler) HandleProcessPayment(ctx context.Context, cmd *C
 		payment.ProviderID = result.ProviderID
 	}
 
-	if err := h.paymentRepo.Update(ctx, payment); err != nil {
-		h.logger.New(ctx).Error("Failed to update payment completion status", "error", err)
-		return nil, errors.InternalError("failed to complete payment")
-	}
-
-	invoice, err := h.invoiceRepo.FindByID(ctx, payment.InvoiceID)
-	if err == nil && invoice != nil {
-		invoice.MarkAsPaid(payment.Amount)
-		if updateErr := h.invoiceRepo.Update(ctx, invoice); updateErr != nil {
-			h.logger.New(ctx).Error("Failed to update invoice payment status", "error", updateErr)
-		}
+	// A payment the invoice cannot take, or takes only part of, is left
+	// unapplied to be applied to another invoice.
+	invoice, _, err := applyOnCompletion(ctx, h.invoiceRepo, payment, payment.Amount, processedAt)
+	if err != nil {
+		h.logger.New(ctx).Warn("Payment left unapplied", "payment_id", payment.ID, "invoice_id", payment.InvoiceID, "error", err)
 	}
 
 	event := eventpkg.NewEvent(
@@ -276,10 +472,20 @@ func (h *PaymentCommandHandler) HandleProcessPayment(ctx context.Context, cmd *C
 			"method":        string(payment.Method),
 		},
 	)
+	recordApplication(event, payment)
 	event.WithCorrelationID(cmd.CorrelationID)
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish payment processed event", "error", err)
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		if err := h.paymentRepo.Update(ctx, payment); err != nil {
+			return err
+		}
+		if invoice == nil {
+			return nil
+		}
+		return h.invoiceRepo.Update(ctx, invoice)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to update payment completion status", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to complete payment")
 	}
 
 	h.logger.New(ctx).Info("Payment processed successfully",
@@ -287,6 +493,7 @@ func (h *PaymentCommandHandler) HandleProcessPayment(ctx context.Context, cmd *C
 		"invoice_id", payment.InvoiceID,
 		"amount", payment.Amount.String(),
 		"transaction_id", payment.TransactionID,
+		"account_credit", payment.AccountCredit().String(),
 	)
 
 	return payment, nil
@@ -312,16 +519,29 @@ func (h *PaymentCommandHandler) HandleRefundPayment(ctx context.Context, cmd *Co
 		return nil, errors.Newf(errors.CodeForbidden, "payment does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "payment", payment.Version); err != nil {
+		return nil, err
+	}
+
 	if payment.Status != domain.PaymentStatusCompleted {
 		return nil, errors.InvalidArgument("can only refund completed payments")
 	}
 
 	amount := payment.Amount
-	if amountStr, ok := cmd.Data["amount"].(string); ok {
-		refundAmount, _ := decimal.NewFromString(amountStr)
-		if !refundAmount.IsZero() && refundAmount.IsPositive() && refundAmount.LessThanOrEqual(payment.Amount) {
-			amount = refundAmount
+	refundAmount, ok, err := money.Parse(cmd.Data, "amount", payment.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		// An amount that cannot be refunded is refused rather than taken
+		// as a request for a full refund.
+		switch {
+		case !refundAmount.IsPositive():
+			return nil, errors.InvalidArgument("refund amount must be positive")
+		case refundAmount.GreaterThan(payment.Amount):
+			return nil, errors.InvalidArgument("refund amount %s exceeds the payment amount %s", refundAmount.String(), payment.Amount.String())
 		}
+		amount = refundAmount
 	}
 
 	reason := getString(cmd.Data, "reason")
@@ -358,11 +578,6 @@ func (h *PaymentCommandHandler) HandleRefundPayment(ctx context.Context, cmd *Co
 
 	payment.MarkAsRefunded()
 
-	if err := h.paymentRepo.Update(ctx, payment); err != nil {
-		h.logger.New(ctx).Error("Failed to update payment refund status", "error", err)
-		return nil, errors.InternalError("failed to process refund")
-	}
-
 	event := eventpkg.NewEvent(
 		payment.ID.String(),
 		"payment",
@@ -380,8 +595,11 @@ func (h *PaymentCommandHandler) HandleRefundPayment(ctx context.Context, cmd *Co
 	)
 	event.WithCorrelationID(cmd.CorrelationID)
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish payment refunded event", "error", err)
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		return h.paymentRepo.Update(ctx, payment)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to update payment refund status", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to process refund")
 	}
 
 	h.logger.New(ctx).Info("Payment refunded",
@@ -414,6 +632,10 @@ func (h *PaymentCommandHandler) HandleCancelPayment(ctx context.Context, cmd *Co
 		return nil, errors.Newf(errors.CodeForbidden, "payment does not belong to tenant")
 	}
 
+	if err := checkExpectedVersion(cmd, "payment", payment.Version); err != nil {
+		return nil, err
+	}
+
 	if payment.Status == domain.PaymentStatusCompleted {
 		return nil, errors.InvalidArgument("cannot cancel completed payments, use refund instead")
 	}
@@ -429,11 +651,6 @@ func (h *PaymentCommandHandler) HandleCancelPayment(ctx context.Context, cmd *Co
 	payment.Status = domain.PaymentStatusCancelled
 	payment.UpdatedAt = time.Now().UTC()
 
-	if err := h.paymentRepo.Update(ctx, payment); err != nil {
-		h.logger.New(ctx).Error("Failed to cancel payment", "error", err)
-		return nil, errors.InternalError("failed to cancel payment")
-	}
-
 	previousStatus := string(domain.PaymentStatusPending)
 	if payment.Status == domain.PaymentStatusProcessing {
 		previousStatus = string(domain.PaymentStatusProcessing)
@@ -453,8 +670,11 @@ func (h *PaymentCommandHandler) HandleCancelPayment(ctx context.Context, cmd *Co
 	)
 	event.WithCorrelationID(cmd.CorrelationID)
 
-	if err := h.publisher.PublishEvent(ctx, event); err != nil {
-		h.logger.New(ctx).Error("Failed to publish payment cancelled event", "error", err)
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		return h.paymentRepo.Update(ctx, payment)
+	}, event); err != nil {
+		h.logger.New(ctx).Error("Failed to cancel payment", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to cancel payment")
 	}
 
 	h.logger.New(ctx).Info("Payment cancelled",
@@ -2,11 +2,13 @@ package commands
 
 import (
 	"context"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/errors"
 	"github.com/ims-erp/system/pkg/logger"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
@@ -50,6 +52,17 @@ func (r *mockPaymentRepo) FindByInvoiceID(ctx context.Context, invoiceID uuid.UU
 	return result, nil
 }
 
+func (r *mockPaymentRepo) FindByClientID(ctx context.Context, tenantID, clientID uuid.UUID) ([]*domain.Payment, error) {
+	var result []*domain.Payment
+	for _, p := range r.payments {
+		if p.TenantID == tenantID && p.ClientID == clientID {
+			result = append(result, p)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
 func (r *mockPaymentRepo) FindByProviderID(ctx context.Context, providerID string) (*domain.Payment, error) {
 	for _, p := range r.payments {
 		if p.ProviderID == providerID {
@@ -79,6 +92,10 @@ func (r *mockInvoiceRepoForPayment) Update(ctx context.Context, invoice *domain.
 	return nil
 }
 
+func (r *mockInvoiceRepoForPayment) UpdateVersions(ctx context.Context, invoice *domain.Invoice, versions int64) error {
+	return r.Update(ctx, invoice)
+}
+
 func (r *mockInvoiceRepoForPayment) FindByID(ctx context.Context, id uuid.UUID) (*domain.Invoice, error) {
 	if invoice, ok := r.invoices[id]; ok {
 		return invoice, nil
@@ -163,6 +180,36 @@ func TestPaymentCommandHandler_HandleCreatePayment_InvalidAmount(t *testing.T) {
 	assert.Contains(t, err.Error(), "payment amount must be greater than zero")
 }
 
+func TestPaymentCommandHandler_HandleCreatePayment_AmountPrecision(t *testing.T) {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	handler := NewPaymentCommandHandler(newMockPaymentRepo(), newMockInvoiceRepoForPayment(), nil, &mockPublisher{}, log, domain.NewProcessorRegistry())
+
+	create := func(data map[string]interface{}) (*domain.Payment, error) {
+		data["invoiceId"] = uuid.New().String()
+		data["clientId"] = uuid.New().String()
+		return handler.HandleCreatePayment(context.Background(), &CommandEnvelope{
+			Type:     "createPayment",
+			TenantID: uuid.New().String(),
+			UserID:   uuid.New().String(),
+			Data:     data,
+		})
+	}
+
+	payment, err := create(map[string]interface{}{"amountMinor": "1999", "currency": "USD"})
+	require.NoError(t, err)
+	assert.Equal(t, "19.99", payment.Amount.StringFixed(2))
+
+	payment, err = create(map[string]interface{}{"amountMinor": float64(1999), "currency": "JPY"})
+	require.NoError(t, err)
+	assert.Equal(t, "1999", payment.Amount.String())
+
+	_, err = create(map[string]interface{}{"amount": "10.5", "currency": "JPY"})
+	assert.EqualError(t, err, "amount has more than 0 decimals for JPY")
+
+	_, err = create(map[string]interface{}{"amount": 10.1, "currency": "USD"})
+	assert.EqualError(t, err, "amount must be a decimal string")
+}
+
 func TestPaymentCommandHandler_HandleProcessPayment_Success(t *testing.T) {
 	paymentRepo := newMockPaymentRepo()
 	invoiceRepo := newMockInvoiceRepoForPayment()
@@ -187,6 +234,7 @@ func TestPaymentCommandHandler_HandleProcessPayment_Success(t *testing.T) {
 		TenantID:  tenantID,
 		ClientID:  clientID,
 		Status:    domain.InvoiceStatusSent,
+		Currency:  "USD",
 		Total:     decimal.NewFromInt(500),
 		AmountDue: decimal.NewFromInt(500),
 	}
@@ -217,6 +265,9 @@ func TestPaymentCommandHandler_HandleProcessPayment_Success(t *testing.T) {
 	// Verify invoice was updated
 	updatedInvoice, _ := invoiceRepo.FindByID(context.Background(), invoiceID)
 	assert.Equal(t, domain.InvoiceStatusPaid, updatedInvoice.Status)
+	require.Len(t, updatedInvoice.PaymentApplications, 1)
+	assert.Equal(t, processedPayment.Applications, updatedInvoice.PaymentApplications)
+	assert.Equal(t, "500", publisher.events[0].Data["amountApplied"])
 }
 
 func TestPaymentCommandHandler_HandleProcessPayment_NotPending(t *testing.T) {
@@ -288,6 +339,54 @@ func TestPaymentCommandHandler_HandleRefundPayment(t *testing.T) {
 	assert.Equal(t, "payment.refunded", publisher.events[0].Type)
 }
 
+func TestPaymentCommandHandler_HandleRefundPayment_InvalidAmount(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{"negative", map[string]interface{}{"amount": "-10.00"}},
+		{"zero", map[string]interface{}{"amount": "0.00"}},
+		{"zero minor units", map[string]interface{}{"amountMinor": int64(0)}},
+		{"zero after rounding", map[string]interface{}{"amount": "0.004"}},
+		{"more than the payment", map[string]interface{}{"amount": "500.01"}},
+		{"not a number", map[string]interface{}{"amount": "all"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paymentRepo := newMockPaymentRepo()
+			publisher := &mockPublisher{}
+			processors := domain.NewProcessorRegistry()
+			processors.Register("stripe", func(provider string, config interface{}) (domain.PaymentProcessor, error) {
+				return &domain.StripeProcessor{}, nil
+			})
+			log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+			handler := NewPaymentCommandHandler(paymentRepo, newMockInvoiceRepoForPayment(), nil, publisher, log, processors)
+
+			tenantID := uuid.New()
+			payment := domain.NewPayment(tenantID, uuid.New(), uuid.New(), decimal.NewFromInt(500), "USD", domain.PaymentMethodCreditCard)
+			payment.Provider = "stripe"
+			payment.MarkAsProcessing("pi_test", "tx_test")
+			payment.MarkAsCompleted(time.Now().UTC())
+			paymentRepo.Create(context.Background(), payment)
+
+			refunded, err := handler.HandleRefundPayment(context.Background(), &CommandEnvelope{
+				Type:     "refundPayment",
+				TenantID: tenantID.String(),
+				TargetID: payment.ID.String(),
+				UserID:   uuid.New().String(),
+				Data:     tt.data,
+			})
+
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, errors.CodeInvalidArgument), "%v", err)
+			assert.Nil(t, refunded)
+			assert.Empty(t, publisher.events, "nothing is refunded")
+			stored, _ := paymentRepo.FindByID(context.Background(), payment.ID)
+			assert.Equal(t, domain.PaymentStatusCompleted, stored.Status)
+		})
+	}
+}
+
 func TestPaymentCommandHandler_HandleRefundPayment_NotCompleted(t *testing.T) {
 	paymentRepo := newMockPaymentRepo()
 	invoiceRepo := newMockInvoiceRepoForPayment()
@@ -407,3 +506,392 @@ func TestPaymentCommandHandler_HandleCancelPayment_AlreadyRefunded(t *testing.T)
 	assert.Nil(t, cancelledPayment)
 	assert.Contains(t, err.Error(), "payment is already refunded")
 }
+
+// mockIntentProcessor records the payment intents requested of it.
+type mockIntentProcessor struct {
+	*domain.StripeProcessor
+	requests []*domain.PaymentIntentRequest
+}
+
+func (p *mockIntentProcessor) CreatePaymentIntent(ctx context.Context, req *domain.PaymentIntentRequest) (*domain.PaymentIntent, error) {
+	p.requests = append(p.requests, req)
+	return &domain.PaymentIntent{ID: "pi_123", ClientSecret: "pi_123_secret_456", Status: "requires_payment_method"}, nil
+}
+
+func TestPaymentCommandHandler_HandleCreatePaymentIntent(t *testing.T) {
+	paymentRepo := newMockPaymentRepo()
+	invoiceRepo := newMockInvoiceRepoForPayment()
+	publisher := &mockPublisher{}
+	stripe := &mockIntentProcessor{StripeProcessor: &domain.StripeProcessor{}}
+	processors := domain.NewProcessorRegistry()
+	processors.Register("stripe", func(provider string, config interface{}) (domain.PaymentProcessor, error) {
+		return stripe, nil
+	})
+	processors.Register("paypal", func(provider string, config interface{}) (domain.PaymentProcessor, error) {
+		return &domain.PayPalProcessor{}, nil
+	})
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	handler := NewPaymentCommandHandler(paymentRepo, invoiceRepo, nil, publisher, log, processors)
+
+	tenantID := uuid.New()
+	invoice := &domain.Invoice{
+		ID:            uuid.New(),
+		TenantID:      tenantID,
+		ClientID:      uuid.New(),
+		InvoiceNumber: "INV-2026-000007",
+		Status:        domain.InvoiceStatusSent,
+		Currency:      "EUR",
+		Total:         decimal.NewFromInt(500),
+		AmountPaid:    decimal.NewFromInt(120),
+		AmountDue:     decimal.RequireFromString("380.50"),
+	}
+	invoiceRepo.Create(context.Background(), invoice)
+
+	cmd := NewCommand("createPaymentIntent", tenantID.String(), "", uuid.New().String(), map[string]interface{}{
+		"invoiceId": invoice.ID.String(),
+		"metadata":  map[string]interface{}{"order_number": "SO-2026-000042"},
+	})
+	payment, clientSecret, err := handler.HandleCreatePaymentIntent(context.Background(), cmd)
+	require.NoError(t, err)
+
+	assert.Equal(t, "pi_123_secret_456", clientSecret)
+	assert.Equal(t, domain.PaymentStatusProcessing, payment.Status)
+	assert.Equal(t, "pi_123", payment.ProviderID)
+	assert.Equal(t, "stripe", payment.Provider)
+	assert.Equal(t, "380.5", payment.Amount.String(), "the amount due is charged")
+	assert.Equal(t, "EUR", payment.Currency)
+	assert.Same(t, payment, paymentRepo.payments[payment.ID])
+	require.Len(t, stripe.requests, 1)
+	assert.Equal(t, payment.ID, stripe.requests[0].PaymentID)
+	assert.Equal(t, invoice.ID.String(), stripe.requests[0].Metadata["invoice_id"])
+	assert.Equal(t, "SO-2026-000042", stripe.requests[0].Metadata["order_number"])
+	assert.Equal(t, map[string]string{"order_number": "SO-2026-000042", "stripe_payment_intent_id": "pi_123"}, payment.Metadata)
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "payment.created", publisher.events[0].Type)
+	assert.Equal(t, "pi_123", publisher.events[0].Data["providerId"])
+
+	for _, metadata := range []interface{}{
+		map[string]interface{}{"card_last4": "4242"},
+		map[string]interface{}{"note": "4242 4242 4242 4242"},
+		map[string]interface{}{"note": 42},
+	} {
+		bad := NewCommand("createPaymentIntent", tenantID.String(), "", uuid.New().String(), map[string]interface{}{"invoiceId": invoice.ID.String(), "metadata": metadata})
+		_, _, err = handler.HandleCreatePaymentIntent(context.Background(), bad)
+		assert.True(t, errors.Is(err, errors.CodeInvalidArgument), "%v", metadata)
+	}
+	assert.Len(t, stripe.requests, 1, "rejected metadata never reaches the provider")
+
+	paypal := NewCommand("createPaymentIntent", tenantID.String(), "", uuid.New().String(), map[string]interface{}{"invoiceId": invoice.ID.String(), "provider": "paypal"})
+	_, _, err = handler.HandleCreatePaymentIntent(context.Background(), paypal)
+	assert.ErrorContains(t, err, "does not support payment intents")
+
+	invoice.Status = domain.InvoiceStatusPaid
+	_, _, err = handler.HandleCreatePaymentIntent(context.Background(), cmd)
+	assert.ErrorContains(t, err, "cannot be paid")
+
+	other := NewCommand("createPaymentIntent", uuid.New().String(), "", uuid.New().String(), map[string]interface{}{"invoiceId": invoice.ID.String()})
+	_, _, err = handler.HandleCreatePaymentIntent(context.Background(), other)
+	assert.Error(t, err, "another tenant's invoice")
+	assert.Len(t, stripe.requests, 1)
+}
+
+func TestStripeCapturedCharge(t *testing.T) {
+	chargeID, captured, err := stripeCapturedCharge(map[string]interface{}{
+		"charges": map[string]interface{}{"data": []interface{}{
+			map[string]interface{}{"id": "ch_1", "amount_captured": float64(1999)},
+		}},
+	}, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, "ch_1", chargeID)
+	assert.Equal(t, "19.99", captured.String())
+
+	chargeID, captured, err = stripeCapturedCharge(map[string]interface{}{
+		"latest_charge":   "ch_2",
+		"amount_received": float64(1500),
+	}, "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, "ch_2", chargeID)
+	assert.Equal(t, "1500", captured.String())
+
+	_, _, err = stripeCapturedCharge(map[string]interface{}{"amount_received": float64(100)}, "USD")
+	assert.Error(t, err)
+}
+
+type mockSettlementProcessor struct {
+	*domain.StripeProcessor
+	charges []string
+}
+
+func (p *mockSettlementProcessor) ChargeSettlement(ctx context.Context, chargeID string) (*domain.PaymentSettlement, error) {
+	p.charges = append(p.charges, chargeID)
+	return &domain.PaymentSettlement{
+		Currency: "USD",
+		Gross:    decimal.RequireFromString("10.00"),
+		Fee:      decimal.RequireFromString("0.59"),
+		Net:      decimal.RequireFromString("9.41"),
+		SourceID: "txn_1",
+	}, nil
+}
+
+func TestWebhookHandler_StripeSettlement(t *testing.T) {
+	paymentRepo := newMockPaymentRepo()
+	publisher := &mockPublisher{}
+	stripe := &mockSettlementProcessor{StripeProcessor: &domain.StripeProcessor{}}
+	processors := domain.NewProcessorRegistry()
+	processors.Register("stripe", func(provider string, config interface{}) (domain.PaymentProcessor, error) {
+		return stripe, nil
+	})
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	invoiceRepo := newMockInvoiceRepoForPayment()
+	handler := NewWebhookHandler(paymentRepo, invoiceRepo, publisher, log, "whsec", "").WithProcessors(processors)
+
+	tenantID := uuid.New()
+	invoice := &domain.Invoice{ID: uuid.New(), TenantID: tenantID, Status: domain.InvoiceStatusSent, Currency: "USD", Total: decimal.NewFromInt(30), AmountDue: decimal.NewFromInt(30)}
+	invoiceRepo.Create(context.Background(), invoice)
+
+	intentPayment := domain.NewPayment(tenantID, invoice.ID, uuid.New(), decimal.NewFromInt(10), "USD", domain.PaymentMethodStripe)
+	intentPayment.MarkAsProcessing("pi_1", "")
+	paymentRepo.Create(context.Background(), intentPayment)
+
+	_, err := handler.HandleStripeWebhook(context.Background(), []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":
+		{"id":"pi_1","latest_charge":"ch_1","amount_received":1000}}}`), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ch_1"}, stripe.charges, "the balance transaction is looked up")
+	require.NotNil(t, intentPayment.Settlement)
+	assert.Equal(t, "9.41", intentPayment.Settlement.Net.String())
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "payment.processed", publisher.events[0].Type)
+	assert.Equal(t, "0.59", publisher.events[0].Data["settlement"].(map[string]interface{})["fee"])
+
+	// A charge converted to EUR whose balance transaction came later.
+	laterPayment := domain.NewPayment(tenantID, invoice.ID, uuid.New(), decimal.NewFromInt(20), "USD", domain.PaymentMethodStripe)
+	laterPayment.MarkAsProcessing("pi_2", "")
+	paymentRepo.Create(context.Background(), laterPayment)
+
+	_, err = handler.HandleStripeWebhook(context.Background(), []byte(`{"id":"evt_2","type":"charge.updated","data":{"object":
+		{"id":"ch_2","payment_intent":"pi_2","balance_transaction":null}}}`), "")
+	require.NoError(t, err)
+	assert.Nil(t, laterPayment.Settlement)
+
+	_, err = handler.HandleStripeWebhook(context.Background(), []byte(`{"id":"evt_3","type":"charge.updated","data":{"object":
+		{"id":"ch_2","payment_intent":"pi_2","balance_transaction":{"id":"txn_2","currency":"eur","amount":1840,"fee":79,"net":1761,
+		"exchange_rate":0.92,"fee_details":[{"type":"stripe_fee","description":"Stripe processing fees","amount":79,"currency":"eur"}]}}}}`), "")
+	require.NoError(t, err)
+	require.NotNil(t, laterPayment.Settlement)
+	assert.Equal(t, "EUR", laterPayment.Settlement.Currency)
+	assert.Equal(t, "18.4", laterPayment.Settlement.Gross.String())
+	assert.Equal(t, "0.79", laterPayment.Settlement.Fee.String())
+	assert.Equal(t, "17.61", laterPayment.Settlement.Net.String())
+	assert.Equal(t, "0.92", laterPayment.Settlement.ExchangeRate.String())
+	require.Len(t, laterPayment.Settlement.Fees, 1)
+	assert.Equal(t, "stripe_fee", laterPayment.Settlement.Fees[0].Type)
+	require.Len(t, publisher.events, 2)
+	assert.Equal(t, "payment.settled", publisher.events[1].Type)
+	assert.Len(t, stripe.charges, 1, "an expanded balance transaction needs no lookup")
+}
+
+func TestWebhookHandler_PayPalSettlement(t *testing.T) {
+	paymentRepo := newMockPaymentRepo()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	invoiceRepo := newMockInvoiceRepoForPayment()
+	handler := NewWebhookHandler(paymentRepo, invoiceRepo, publisher, log, "", "webhook-id")
+
+	invoice := &domain.Invoice{ID: uuid.New(), TenantID: uuid.New(), Status: domain.InvoiceStatusSent, Currency: "USD", Total: decimal.NewFromInt(100), AmountDue: decimal.NewFromInt(100)}
+	invoiceRepo.Create(context.Background(), invoice)
+
+	payment := domain.NewPayment(invoice.TenantID, invoice.ID, uuid.New(), decimal.NewFromInt(100), "USD", domain.PaymentMethodPayPal)
+	payment.MarkAsProcessing("CAP-1", "")
+	paymentRepo.Create(context.Background(), payment)
+
+	_, err := handler.HandlePayPalWebhook(context.Background(), []byte(`{"id":"WH-1","event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{
+		"id":"CAP-1","amount":{"currency_code":"USD","value":"100.00"},
+		"seller_receivable_breakdown":{
+			"gross_amount":{"currency_code":"USD","value":"100.00"},
+			"paypal_fee":{"currency_code":"USD","value":"3.98"},
+			"net_amount":{"currency_code":"USD","value":"96.02"},
+			"receivable_amount":{"currency_code":"EUR","value":"88.34"},
+			"exchange_rate":{"source_currency":"USD","target_currency":"EUR","value":"0.92"}}}}`), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, domain.PaymentStatusCompleted, payment.Status)
+	require.NotNil(t, payment.Settlement)
+	assert.Equal(t, "EUR", payment.Settlement.Currency)
+	assert.Equal(t, "92", payment.Settlement.Gross.String())
+	assert.Equal(t, "3.66", payment.Settlement.Fee.String())
+	assert.Equal(t, "88.34", payment.Settlement.Net.String())
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "88.34", publisher.events[0].Data["settlement"].(map[string]interface{})["net"])
+}
+
+func TestPaymentCommandHandler_ApplyAndUnapplyPayment(t *testing.T) {
+	paymentRepo := newMockPaymentRepo()
+	invoiceRepo := newMockInvoiceRepoForPayment()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	handler := NewPaymentCommandHandler(paymentRepo, invoiceRepo, nil, publisher, log, domain.NewProcessorRegistry())
+
+	tenantID, clientID, userID := uuid.New(), uuid.New(), uuid.New()
+	sentAt := time.Now().UTC().AddDate(0, 0, -7)
+	openInvoice := func(number string, due int64) *domain.Invoice {
+		invoice := &domain.Invoice{
+			ID:            uuid.New(),
+			TenantID:      tenantID,
+			ClientID:      clientID,
+			InvoiceNumber: number,
+			Status:        domain.InvoiceStatusSent,
+			SentDate:      &sentAt,
+			Currency:      "EUR",
+			Total:         decimal.NewFromInt(due),
+			AmountDue:     decimal.NewFromInt(due),
+		}
+		invoiceRepo.Create(context.Background(), invoice)
+		return invoice
+	}
+	wrong := openInvoice("INV-2026-000010", 80)
+	right := openInvoice("INV-2026-000011", 120)
+
+	// A receipt of 100 applied to the wrong invoice as it completed,
+	// leaving 20 unapplied.
+	payment := domain.NewPayment(tenantID, wrong.ID, clientID, decimal.NewFromInt(100), "EUR", domain.PaymentMethodBankTransfer)
+	payment.MarkAsCompleted(time.Now().UTC())
+	misapplied, err := payment.ApplyTo(wrong, decimal.NewFromInt(80), nil, time.Now().UTC())
+	require.NoError(t, err)
+	paymentRepo.Create(context.Background(), payment)
+
+	command := func(data map[string]interface{}) *CommandEnvelope {
+		return &CommandEnvelope{TenantID: tenantID.String(), TargetID: payment.ID.String(), UserID: userID.String(), Data: data}
+	}
+
+	_, _, err = handler.HandleUnapplyPayment(context.Background(), command(map[string]interface{}{"applicationId": misapplied.ID.String()}))
+	assert.True(t, errors.Is(err, errors.CodeInvalidArgument), "a reason is required")
+
+	_, invoice, err := handler.HandleUnapplyPayment(context.Background(), command(map[string]interface{}{
+		"applicationId": misapplied.ID.String(),
+		"reason":        "Receipt was for INV-2026-000011",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, domain.InvoiceStatusSent, invoice.Status)
+	assert.Equal(t, "80", invoice.AmountDue.String())
+	assert.Equal(t, "100", payment.Unapplied().String())
+
+	_, invoice, err = handler.HandleApplyPayment(context.Background(), command(map[string]interface{}{"invoiceId": right.ID.String()}))
+	require.NoError(t, err)
+	assert.Equal(t, "20", invoice.AmountDue.String(), "the whole unapplied amount is applied")
+	assert.True(t, payment.Unapplied().IsZero())
+	require.Len(t, invoice.PaymentApplications, 1)
+	assert.Equal(t, &userID, invoice.PaymentApplications[0].AppliedBy)
+	require.Len(t, payment.Applications, 2)
+	assert.False(t, payment.Applications[0].Active())
+
+	_, _, err = handler.HandleApplyPayment(context.Background(), command(map[string]interface{}{"invoiceId": wrong.ID.String(), "amount": "1"}))
+	assert.True(t, errors.Is(err, errors.CodeUnprocessable), "nothing is left to apply")
+
+	other := openInvoice("INV-2026-000012", 10)
+	other.ClientID = uuid.New()
+	_, _, err = handler.HandleApplyPayment(context.Background(), command(map[string]interface{}{"invoiceId": other.ID.String()}))
+	assert.True(t, errors.Is(err, errors.CodeInvalidArgument), "invoices of another client are refused")
+
+	var types []string
+	for _, event := range publisher.events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{"payment.unapplied", "invoice.payment_unapplied", "payment.applied", "invoice.payment_applied"}, types)
+	assert.Equal(t, "Receipt was for INV-2026-000011", publisher.events[1].Data["reason"])
+}
+
+func TestPaymentCommandHandler_AccountCredit(t *testing.T) {
+	paymentRepo := newMockPaymentRepo()
+	invoiceRepo := newMockInvoiceRepoForPayment()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	processors := domain.NewProcessorRegistry()
+	processors.Register("stripe", func(provider string, config interface{}) (domain.PaymentProcessor, error) {
+		return &domain.StripeProcessor{}, nil
+	})
+	handler := NewPaymentCommandHandler(paymentRepo, invoiceRepo, nil, publisher, log, processors)
+
+	tenantID, clientID, userID := uuid.New(), uuid.New(), uuid.New()
+	sentAt := time.Now().UTC().AddDate(0, 0, -7)
+	openInvoice := func(number string, due int64) *domain.Invoice {
+		invoice := &domain.Invoice{
+			ID:            uuid.New(),
+			TenantID:      tenantID,
+			ClientID:      clientID,
+			InvoiceNumber: number,
+			Status:        domain.InvoiceStatusSent,
+			SentDate:      &sentAt,
+			Currency:      "EUR",
+			Total:         decimal.NewFromInt(due),
+			AmountDue:     decimal.NewFromInt(due),
+		}
+		invoiceRepo.Create(context.Background(), invoice)
+		return invoice
+	}
+	// Two card payments overpaid their invoices by 30 and 50.
+	overpay := func(number string, due, paid int64, daysAgo int) *domain.Payment {
+		invoice := openInvoice(number, due)
+		payment := domain.NewPayment(tenantID, invoice.ID, clientID, decimal.NewFromInt(paid), "EUR", domain.PaymentMethodCreditCard)
+		payment.Provider = "stripe"
+		payment.MarkAsCompleted(time.Now().UTC().AddDate(0, 0, -daysAgo))
+		_, err := payment.ApplyTo(invoice, invoice.AmountDue, nil, time.Now().UTC())
+		require.NoError(t, err)
+		paymentRepo.Create(context.Background(), payment)
+		return payment
+	}
+	first := overpay("INV-2026-000020", 70, 100, 5)
+	second := overpay("INV-2026-000021", 150, 200, 2)
+
+	credit, err := handler.AccountCredit(context.Background(), tenantID, clientID)
+	require.NoError(t, err)
+	assert.Len(t, credit, 2)
+	assert.Equal(t, "80", domain.AccountCreditBalance(credit, "EUR").String())
+
+	command := func(data map[string]interface{}) *CommandEnvelope {
+		return &CommandEnvelope{TenantID: tenantID.String(), TargetID: clientID.String(), UserID: userID.String(), Data: data}
+	}
+
+	next := openInvoice("INV-2026-000022", 45)
+	drawn, invoice, err := handler.HandleApplyAccountCredit(context.Background(), command(map[string]interface{}{"invoiceId": next.ID.String()}))
+	require.NoError(t, err)
+	assert.Equal(t, []*domain.Payment{first, second}, drawn, "the oldest credit is drawn first")
+	assert.Equal(t, domain.InvoiceStatusPaid, invoice.Status)
+	assert.True(t, invoice.AmountDue.IsZero())
+	require.Len(t, invoice.PaymentApplications, 2)
+	assert.True(t, first.AccountCredit().IsZero())
+	assert.Equal(t, "35", second.AccountCredit().String())
+
+	var types []string
+	for _, event := range publisher.events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{"payment.applied", "invoice.payment_applied", "payment.applied", "invoice.payment_applied", "invoice.paid"}, types)
+	assert.Equal(t, "35", publisher.events[2].Data["accountCredit"])
+	var versions []int64
+	for _, event := range []int{1, 3, 4} {
+		versions = append(versions, publisher.events[event].Version)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, versions, "each draw's invoice event follows the last")
+
+	_, _, err = handler.HandleApplyAccountCredit(context.Background(), command(map[string]interface{}{
+		"invoiceId": openInvoice("INV-2026-000023", 100).ID.String(),
+		"amount":    "36",
+	}))
+	assert.True(t, errors.Is(err, errors.CodeUnprocessable), "more than the credit is refused")
+
+	_, err = handler.HandleRefundAccountCredit(context.Background(), command(map[string]interface{}{}))
+	assert.True(t, errors.Is(err, errors.CodeInvalidArgument), "a currency is required")
+
+	refunded, err := handler.HandleRefundAccountCredit(context.Background(), command(map[string]interface{}{"currency": "EUR", "reason": "Client closed account"}))
+	require.NoError(t, err)
+	assert.Equal(t, []*domain.Payment{second}, refunded)
+	assert.True(t, second.AccountCredit().IsZero())
+	assert.Equal(t, "35", second.AmountRefunded.String())
+	assert.Equal(t, domain.PaymentStatusCompleted, second.Status, "refunding credit leaves the applied payment completed")
+	last := publisher.events[len(publisher.events)-1]
+	assert.Equal(t, "payment.credit_refunded", last.Type)
+	assert.Equal(t, "stripe", last.Data["refundMethod"])
+
+	_, err = handler.HandleRefundAccountCredit(context.Background(), command(map[string]interface{}{"currency": "EUR"}))
+	assert.True(t, errors.Is(err, errors.CodeUnprocessable), "no credit is left")
+}
@@ -12,6 +12,7 @@ import (
 	eventpkg "github.com/ims-erp/system/internal/events"
 	"github.com/ims-erp/system/pkg/errors"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/money"
 	"github.com/shopspring/decimal"
 )
 
@@ -20,6 +21,7 @@ type WebhookHandler struct {
 	paymentRepo PaymentRepository
 	invoiceRepo InvoiceRepository
 	publisher   Publisher
+	processors  *domain.ProcessorRegistry
 	logger      *logger.Logger
 
 	stripeWebhookSecret string
@@ -96,6 +98,13 @@ func NewWebhookHandler(
 	}
 }
 
+// WithProcessors lets the handler look up settlements that webhooks do not
+// carry, such as the balance transaction of a Stripe charge.
+func (h *WebhookHandler) WithProcessors(processors *domain.ProcessorRegistry) *WebhookHandler {
+	h.processors = processors
+	return h
+}
+
 // HandleStripeWebhook processes incoming Stripe webhook events
 func (h *WebhookHandler) HandleStripeWebhook(ctx context.Context, payload []byte, signature string) (*WebhookResult, error) {
 	log := h.logger.New(ctx)
@@ -149,6 +158,14 @@ func (h *WebhookHandler) HandleStripeWebhook(ctx context.Context, payload []byte
 		}
 		result.Success = true
 
+	case "charge.updated":
+		err := h.processStripeChargeUpdated(ctx, &event)
+		if err != nil {
+			result.Error = err
+			return result, err
+		}
+		result.Success = true
+
 	default:
 		log.Info("Unhandled Stripe event type", "event_type", event.Type)
 		result.Success = true
@@ -268,26 +285,9 @@ func (h *WebhookHandler) processStripePaymentIntentSucceeded(ctx context.Context
 		return errors.Newf(errors.CodeNotFound, "payment not found for payment intent: %s", paymentIntentID)
 	}
 
-	// Extract charge information
-	charges, ok := object["charges"].(map[string]interface{})
-	if !ok {
-		return errors.InternalError("invalid charges data in payment intent")
-	}
-
-	data, ok := charges["data"].([]interface{})
-	if !ok || len(data) == 0 {
-		return errors.InternalError("no charge data found in payment intent")
-	}
-
-	charge, ok := data[0].(map[string]interface{})
-	if !ok {
-		return errors.InternalError("invalid charge data structure")
-	}
-
-	transactionID, _ := charge["id"].(string)
-	amountCaptured := decimal.Zero
-	if amount, ok := charge["amount_captured"].(float64); ok {
-		amountCaptured = decimal.NewFromFloat(amount).Div(decimal.NewFromInt(100))
+	transactionID, amountCaptured, err := stripeCapturedCharge(object, payment.Currency)
+	if err != nil {
+		return err
 	}
 
 	// Mark payment as completed
@@ -300,6 +300,9 @@ func (h *WebhookHandler) processStripePaymentIntentSucceeded(ctx context.Context
 	if transactionID != "" {
 		payment.TransactionID = transactionID
 	}
+	if settlement := h.stripeSettlement(ctx, stripeEmbeddedCharge(object), transactionID); settlement != nil {
+		payment.Settle(settlement)
+	}
 
 	// Update metadata
 	if payment.Metadata == nil {
@@ -314,7 +317,9 @@ func (h *WebhookHandler) processStripePaymentIntentSucceeded(ctx context.Context
 	}
 
 	// Update invoice if applicable
+	applied := true
 	if err := h.updateInvoiceForPayment(ctx, payment, amountCaptured); err != nil {
+		applied = false
 		log.Error("Failed to update invoice for payment", "error", err)
 		// Don't return error here - payment was successful, invoice update failure is logged
 	}
@@ -330,6 +335,9 @@ func (h *WebhookHandler) processStripePaymentIntentSucceeded(ctx context.Context
 		"webhookEventId": event.ID,
 		"stripeChargeId": transactionID,
 	}
+	if payment.Settlement != nil {
+		eventData["settlement"] = settlementData(payment.Settlement)
+	}
 
 	ev := eventpkg.NewEvent(
 		payment.ID.String(),
@@ -339,6 +347,9 @@ func (h *WebhookHandler) processStripePaymentIntentSucceeded(ctx context.Context
 		"system", // Webhook events are system-generated
 		eventData,
 	)
+	if applied {
+		recordApplication(ev, payment)
+	}
 	ev.WithMetadata("source", "stripe_webhook")
 	ev.WithMetadata("webhook_event_id", event.ID)
 
@@ -356,6 +367,123 @@ func (h *WebhookHandler) processStripePaymentIntentSucceeded(ctx context.Context
 	return nil
 }
 
+// stripeCapturedCharge returns the charge of a succeeded payment intent and
+// the amount captured. API versions before 2022-11-15 embed the charges;
+// later ones only reference the latest charge, and the intent carries the
+// amount received.
+func stripeCapturedCharge(intent map[string]interface{}, currency string) (string, decimal.Decimal, error) {
+	if charges, ok := intent["charges"].(map[string]interface{}); ok {
+		data, ok := charges["data"].([]interface{})
+		if !ok || len(data) == 0 {
+			return "", decimal.Zero, errors.InternalError("no charge data found in payment intent")
+		}
+		charge, ok := data[0].(map[string]interface{})
+		if !ok {
+			return "", decimal.Zero, errors.InternalError("invalid charge data structure")
+		}
+		chargeID, _ := charge["id"].(string)
+		captured := decimal.Zero
+		if amount, ok := charge["amount_captured"].(float64); ok {
+			// Stripe amounts are integers in the currency's minor unit.
+			captured = money.FromMinor(int64(amount), currency)
+		}
+		return chargeID, captured, nil
+	}
+
+	var chargeID string
+	switch charge := intent["latest_charge"].(type) {
+	case string:
+		chargeID = charge
+	case map[string]interface{}:
+		chargeID, _ = charge["id"].(string)
+	}
+	if chargeID == "" {
+		return "", decimal.Zero, errors.InternalError("no charge found in payment intent")
+	}
+	captured := decimal.Zero
+	if amount, ok := intent["amount_received"].(float64); ok {
+		captured = money.FromMinor(int64(amount), currency)
+	}
+	return chargeID, captured, nil
+}
+
+// stripeEmbeddedCharge returns the charge of a payment intent when the
+// webhook embeds it, either in the charges of API versions before
+// 2022-11-15 or as an expanded latest_charge, and nil otherwise.
+func stripeEmbeddedCharge(intent map[string]interface{}) map[string]interface{} {
+	if charges, ok := intent["charges"].(map[string]interface{}); ok {
+		if data, ok := charges["data"].([]interface{}); ok && len(data) > 0 {
+			charge, _ := data[0].(map[string]interface{})
+			return charge
+		}
+	}
+	charge, _ := intent["latest_charge"].(map[string]interface{})
+	return charge
+}
+
+// stripeSettlement returns the settlement of a charge from its balance
+// transaction, when charge embeds it expanded, or else from the Stripe API.
+// It returns nil when the balance transaction is not available yet; Stripe
+// then sends charge.updated once it is.
+func (h *WebhookHandler) stripeSettlement(ctx context.Context, charge map[string]interface{}, chargeID string) *domain.PaymentSettlement {
+	log := h.logger.New(ctx)
+
+	if txn, ok := charge["balance_transaction"].(map[string]interface{}); ok {
+		settlement, err := domain.ParseStripeBalanceTransaction(txn)
+		if err != nil {
+			log.Warn("Invalid Stripe balance transaction", "charge_id", chargeID, "error", err)
+			return nil
+		}
+		return settlement
+	}
+	if charge != nil && charge["balance_transaction"] == nil {
+		return nil
+	}
+	if chargeID == "" || h.processors == nil {
+		return nil
+	}
+	processor, err := h.processors.GetProcessor("stripe", nil)
+	if err != nil {
+		log.Warn("Cannot look up Stripe settlement", "charge_id", chargeID, "error", err)
+		return nil
+	}
+	fetcher, ok := processor.(domain.ChargeSettlementFetcher)
+	if !ok {
+		return nil
+	}
+	settlement, err := fetcher.ChargeSettlement(ctx, chargeID)
+	if err != nil {
+		log.Warn("Failed to look up Stripe settlement", "charge_id", chargeID, "error", err)
+		return nil
+	}
+	return settlement
+}
+
+// settlementData is a settlement as carried by payment events, with
+// amounts as decimal strings.
+func settlementData(settlement *domain.PaymentSettlement) map[string]interface{} {
+	fees := make([]interface{}, len(settlement.Fees))
+	for i, fee := range settlement.Fees {
+		fees[i] = map[string]interface{}{
+			"type":        fee.Type,
+			"description": fee.Description,
+			"amount":      fee.Amount.String(),
+		}
+	}
+	data := map[string]interface{}{
+		"currency": settlement.Currency,
+		"gross":    settlement.Gross.String(),
+		"fee":      settlement.Fee.String(),
+		"net":      settlement.Net.String(),
+		"sourceId": settlement.SourceID,
+		"fees":     fees,
+	}
+	if !settlement.ExchangeRate.IsZero() {
+		data["exchangeRate"] = settlement.ExchangeRate.String()
+	}
+	return data
+}
+
 // processStripePaymentIntentFailed handles payment_intent.payment_failed events
 func (h *WebhookHandler) processStripePaymentIntentFailed(ctx context.Context, event *StripeEvent) error {
 	log := h.logger.New(ctx)
@@ -448,6 +576,90 @@ func (h *WebhookHandler) processStripePaymentIntentFailed(ctx context.Context, e
 	return nil
 }
 
+// findStripeChargePayment returns the payment of a charge. Payments are
+// stored under the charge, or under the payment intent when they were
+// created as one.
+func (h *WebhookHandler) findStripeChargePayment(ctx context.Context, charge map[string]interface{}) (*domain.Payment, error) {
+	chargeID, _ := charge["id"].(string)
+	payment, err := h.paymentRepo.FindByProviderID(ctx, chargeID)
+	if intentID, ok := charge["payment_intent"].(string); (err != nil || payment == nil) && ok && intentID != "" {
+		payment, err = h.paymentRepo.FindByProviderID(ctx, intentID)
+	}
+	if err == nil && payment == nil {
+		err = domain.ErrPaymentNotFound
+	}
+	return payment, err
+}
+
+// processStripeChargeUpdated handles charge.updated events, which Stripe
+// sends when the balance transaction of a charge becomes available after
+// the payment intent succeeded. It records the settlement of payments that
+// have none yet.
+func (h *WebhookHandler) processStripeChargeUpdated(ctx context.Context, event *StripeEvent) error {
+	log := h.logger.New(ctx)
+
+	object := event.Data.Object
+	chargeID, ok := object["id"].(string)
+	if !ok {
+		return errors.InvalidArgument("missing charge ID")
+	}
+	if object["balance_transaction"] == nil {
+		return nil
+	}
+
+	payment, err := h.findStripeChargePayment(ctx, object)
+	if err != nil {
+		// Charges of payments taken outside the ERP are not ours to record.
+		log.Info("No payment for updated Stripe charge", "charge_id", chargeID)
+		return nil
+	}
+	if payment.Settlement != nil {
+		return nil
+	}
+	settlement := h.stripeSettlement(ctx, object, chargeID)
+	if settlement == nil {
+		return nil
+	}
+
+	payment.Settle(settlement)
+	if err := h.paymentRepo.Update(ctx, payment); err != nil {
+		log.Error("Failed to record payment settlement", "error", err)
+		return errors.InternalError("failed to record payment settlement")
+	}
+	h.publishSettled(ctx, payment, event.ID, "stripe_webhook")
+	return nil
+}
+
+// publishSettled publishes payment.settled for a settlement recorded after
+// the payment was completed.
+func (h *WebhookHandler) publishSettled(ctx context.Context, payment *domain.Payment, webhookEventID, source string) {
+	ev := eventpkg.NewEvent(
+		payment.ID.String(),
+		"payment",
+		"payment.settled",
+		payment.TenantID.String(),
+		"system",
+		map[string]interface{}{
+			"invoiceId":      payment.InvoiceID.String(),
+			"settlement":     settlementData(payment.Settlement),
+			"webhookEventId": webhookEventID,
+		},
+	)
+	ev.WithMetadata("source", source)
+	ev.WithMetadata("webhook_event_id", webhookEventID)
+
+	if err := h.publisher.PublishEvent(ctx, ev); err != nil {
+		h.logger.New(ctx).Error("Failed to publish payment settled event", "error", err)
+	}
+
+	h.logger.New(ctx).Info("Payment settlement recorded",
+		"payment_id", payment.ID,
+		"currency", payment.Settlement.Currency,
+		"fee", payment.Settlement.Fee.String(),
+		"net", payment.Settlement.Net.String(),
+	)
+}
+
 // processStripeChargeRefunded handles charge.refunded events
 func (h *WebhookHandler) processStripeChargeRefunded(ctx context.Context, event *StripeEvent) error {
 	log := h.logger.New(ctx)
@@ -458,9 +670,7 @@ func (h *WebhookHandler) processStripeChargeRefunded(ctx context.Context, event
 		return errors.InvalidArgument("missing charge ID")
 	}
 
-	// Find payment by transaction ID (charge ID)
-	// Note: This might need adjustment based on how transaction IDs are stored
-	payment, err := h.paymentRepo.FindByProviderID(ctx, chargeID)
+	payment, err := h.findStripeChargePayment(ctx, object)
 	if err != nil {
 		log.Error("Payment not found for refunded charge",
 			"charge_id", chargeID,
@@ -497,7 +707,7 @@ func (h *WebhookHandler) processStripeChargeRefunded(ctx context.Context, event
 	refundID, _ := refund["id"].(string)
 	refundAmount := decimal.Zero
 	if amount, ok := refund["amount"].(float64); ok {
-		refundAmount = decimal.NewFromFloat(amount).Div(decimal.NewFromInt(100))
+		refundAmount = money.FromMinor(int64(amount), payment.Currency)
 	}
 	reason, _ := refund["reason"].(string)
 	if reason == "" {
@@ -599,6 +809,11 @@ func (h *WebhookHandler) processPayPalCaptureCompleted(ctx context.Context, even
 
 	payment.MarkAsCompleted(processedAt)
 	payment.TransactionID = transactionID
+	if settlement, err := domain.ParsePayPalCapture(resource); err != nil {
+		log.Warn("Invalid PayPal capture breakdown", "capture_id", captureID, "error", err)
+	} else if settlement != nil {
+		payment.Settle(settlement)
+	}
 
 	// Update metadata
 	if payment.Metadata == nil {
@@ -613,29 +828,39 @@ func (h *WebhookHandler) processPayPalCaptureCompleted(ctx context.Context, even
 	}
 
 	// Update invoice if applicable
+	applied := true
 	if err := h.updateInvoiceForPayment(ctx, payment, amount); err != nil {
+		applied = false
 		log.Error("Failed to update invoice for payment", "error", err)
 		// Don't return error here - payment was successful
 	}
 
 	// Emit payment processed event
+	eventData := map[string]interface{}{
+		"invoiceId":       payment.InvoiceID.String(),
+		"amount":          payment.Amount.String(),
+		"transactionId":   payment.TransactionID,
+		"providerId":      payment.ProviderID,
+		"processedAt":     processedAt,
+		"method":          string(payment.Method),
+		"webhookEventId":  event.ID,
+		"paypalCaptureId": captureID,
+	}
+	if payment.Settlement != nil {
+		eventData["settlement"] = settlementData(payment.Settlement)
+	}
+
 	ev := eventpkg.NewEvent(
 		payment.ID.String(),
 		"payment",
 		"payment.processed",
 		payment.TenantID.String(),
 		"system",
-		map[string]interface{}{
-			"invoiceId":       payment.InvoiceID.String(),
-			"amount":          payment.Amount.String(),
-			"transactionId":   payment.TransactionID,
-			"providerId":      payment.ProviderID,
-			"processedAt":     processedAt,
-			"method":          string(payment.Method),
-			"webhookEventId":  event.ID,
-			"paypalCaptureId": captureID,
-		},
+		eventData,
 	)
+	if applied {
+		recordApplication(ev, payment)
+	}
 	ev.WithMetadata("source", "paypal_webhook")
 	ev.WithMetadata("webhook_event_id", event.ID)
 
@@ -834,34 +1059,30 @@ func (h *WebhookHandler) processPayPalDisputeCreated(ctx context.Context, event
 	return nil
 }
 
-// updateInvoiceForPayment updates the invoice status when a payment is received
+// updateInvoiceForPayment applies a payment the provider completed to its
+// invoice, amount of it up to the amount due, and records the application
+// on both. Whatever the invoice does not take stays unapplied.
 func (h *WebhookHandler) updateInvoiceForPayment(ctx context.Context, payment *domain.Payment, amount decimal.Decimal) error {
 	log := h.logger.New(ctx)
 
-	invoice, err := h.invoiceRepo.FindByID(ctx, payment.InvoiceID)
+	invoice, application, err := applyOnCompletion(ctx, h.invoiceRepo, payment, amount, *payment.ProcessedAt)
 	if err != nil {
-		return fmt.Errorf("invoice not found: %w", err)
-	}
-
-	// Verify invoice belongs to same tenant
-	if invoice.TenantID != payment.TenantID {
-		return errors.Newf(errors.CodeForbidden, "invoice does not belong to payment tenant")
-	}
-
-	// Apply payment to invoice
-	if err := invoice.ApplyPayment(amount); err != nil {
 		return fmt.Errorf("failed to apply payment to invoice: %w", err)
 	}
 
 	if err := h.invoiceRepo.Update(ctx, invoice); err != nil {
 		return fmt.Errorf("failed to update invoice: %w", err)
 	}
+	if err := h.paymentRepo.Update(ctx, payment); err != nil {
+		return fmt.Errorf("failed to record payment application: %w", err)
+	}
 
 	log.Info("Invoice updated for payment",
 		"invoice_id", invoice.ID,
 		"payment_id", payment.ID,
-		"amount_paid", amount.String(),
+		"amount_paid", application.Amount.String(),
 		"amount_due", invoice.AmountDue.String(),
+		"account_credit", payment.AccountCredit().String(),
 		"status", invoice.Status,
 	)
 
@@ -0,0 +1,266 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/numbering"
+	"github.com/ims-erp/system/pkg/errors"
+)
+
+// AuthorizeReturn opens an RMA for shipped units of an order, to be sent
+// back to WarehouseID.
+type AuthorizeReturn struct {
+	OrderID     uuid.UUID
+	WarehouseID uuid.UUID
+	Lines       []ReturnLineInput
+}
+
+// ReturnLineInput returns Quantity units of an order line for Reason, one
+// of the domain.ReturnReason codes. LotNumber is read off the returned
+// units; SupplierID defaults to the product's supplier.
+type ReturnLineInput struct {
+	OrderLineID uuid.UUID
+	Quantity    int
+	Reason      domain.ReturnReason
+	ReasonNotes string
+	LotNumber   string
+	SupplierID  *uuid.UUID
+}
+
+// ReceiveReturn records the units of an RMA arriving at its warehouse.
+// ReceivedAt defaults to now.
+type ReceiveReturn struct {
+	RMAID      uuid.UUID
+	ReceivedAt *time.Time
+}
+
+// DisposeReturnLine records what is done with the units of a received RMA
+// line after inspection.
+type DisposeReturnLine struct {
+	RMAID       uuid.UUID
+	LineID      uuid.UUID
+	Disposition domain.ReturnDisposition
+	Notes       string
+}
+
+type ReturnAuthorizationRepository interface {
+	Create(ctx context.Context, rma *domain.ReturnAuthorization) error
+	FindByID(ctx context.Context, id uuid.UUID) (*domain.ReturnAuthorization, error)
+	Update(ctx context.Context, rma *domain.ReturnAuthorization) error
+	// FindByOrder returns the RMAs opened for an order.
+	FindByOrder(ctx context.Context, tenantID, orderID uuid.UUID) ([]*domain.ReturnAuthorization, error)
+}
+
+// DocumentNumberer numbers documents by the tenant's scheme.
+// numbering.Generator implements it.
+type DocumentNumberer interface {
+	Next(ctx context.Context, tenantID uuid.UUID, documentType, channel string) (string, error)
+}
+
+// ReturnCommandHandler authorizes returns of shipped order lines with a
+// reason code, and records their receipt and disposition.
+type ReturnCommandHandler struct {
+	returnRepo  ReturnAuthorizationRepository
+	orderRepo   OrderRepository
+	productRepo ProductReader
+	numbers     DocumentNumberer
+	publisher   events.Publisher
+}
+
+func NewReturnCommandHandler(
+	returnRepo ReturnAuthorizationRepository,
+	orderRepo OrderRepository,
+	productRepo ProductReader,
+	numbers DocumentNumberer,
+	publisher events.Publisher,
+) *ReturnCommandHandler {
+	return &ReturnCommandHandler{
+		returnRepo:  returnRepo,
+		orderRepo:   orderRepo,
+		productRepo: productRepo,
+		numbers:     numbers,
+		publisher:   publisher,
+	}
+}
+
+// HandleAuthorizeReturn opens an RMA. Each order line can be returned up to
+// the units its shipments carried, less those on the order's earlier RMAs.
+func (h *ReturnCommandHandler) HandleAuthorizeReturn(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input AuthorizeReturn
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+	if len(input.Lines) == 0 {
+		return nil, domain.ErrReturnEmpty
+	}
+
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	order, err := h.orderRepo.FindByID(ctx, input.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+	if order.TenantID != tenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "order does not belong to tenant")
+	}
+
+	earlier, err := h.returnRepo.FindByOrder(ctx, tenantID, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load returns of order: %w", err)
+	}
+
+	rma := domain.NewReturnAuthorization(order, input.WarehouseID, userID, "")
+	for _, requested := range input.Lines {
+		line := order.FindLine(requested.OrderLineID)
+		if line == nil {
+			return nil, domain.ErrOrderLineNotFound
+		}
+
+		returned := rma.Quantity(line.ID)
+		for _, other := range earlier {
+			returned += other.Quantity(line.ID)
+		}
+		if returned+requested.Quantity > order.ShippedQuantity(line.ID) {
+			return nil, domain.ErrReturnQuantityExceeded
+		}
+
+		supplierID := requested.SupplierID
+		if supplierID == nil {
+			product, err := h.productRepo.FindByID(ctx, line.ProductID)
+			if err != nil {
+				return nil, fmt.Errorf("product not found: %w", err)
+			}
+			supplierID = product.SupplierID
+		}
+
+		_, err := rma.AddLine(domain.ReturnLine{
+			OrderLineID: line.ID,
+			ProductID:   line.ProductID,
+			SKU:         line.SKU,
+			SupplierID:  supplierID,
+			LotNumber:   requested.LotNumber,
+			Quantity:    requested.Quantity,
+			Reason:      requested.Reason,
+			ReasonNotes: requested.ReasonNotes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rma.RMANumber, err = h.numbers.Next(ctx, tenantID, numbering.DocumentRMA, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := h.returnRepo.Create(ctx, rma); err != nil {
+		return nil, fmt.Errorf("failed to create return: %w", err)
+	}
+
+	evt := events.NewReturnAuthorizedEvent(rma, cmd.UserID)
+	return h.publish(ctx, rma, &evt.EventEnvelope, evt)
+}
+
+func (h *ReturnCommandHandler) HandleReceiveReturn(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input ReceiveReturn
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	rma, err := h.loadReturn(ctx, cmd, input.RMAID)
+	if err != nil {
+		return nil, err
+	}
+	receivedAt := time.Now().UTC()
+	if input.ReceivedAt != nil {
+		receivedAt = *input.ReceivedAt
+	}
+	if err := rma.Receive(receivedAt); err != nil {
+		return nil, err
+	}
+
+	if err := h.save(ctx, rma); err != nil {
+		return nil, err
+	}
+
+	evt := events.NewReturnReceivedEvent(rma, cmd.UserID)
+	return h.publish(ctx, rma, &evt.EventEnvelope, evt)
+}
+
+func (h *ReturnCommandHandler) HandleDisposeReturnLine(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input DisposeReturnLine
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	rma, err := h.loadReturn(ctx, cmd, input.RMAID)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := uuid.Parse(cmd.UserID)
+	line, err := rma.Dispose(input.LineID, input.Disposition, input.Notes, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.save(ctx, rma); err != nil {
+		return nil, err
+	}
+
+	evt := events.NewReturnLineDispositionedEvent(rma, line, cmd.UserID)
+	return h.publish(ctx, rma, &evt.EventEnvelope, evt)
+}
+
+// loadReturn loads an RMA of the command's tenant at the version the
+// command expects.
+func (h *ReturnCommandHandler) loadReturn(ctx context.Context, cmd *CommandEnvelope, id uuid.UUID) (*domain.ReturnAuthorization, error) {
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	if _, err := uuid.Parse(cmd.UserID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	rma, err := h.returnRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, errors.NotFound("return not found")
+	}
+	if rma.TenantID != tenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "return does not belong to tenant")
+	}
+	if err := checkExpectedVersion(cmd, "return", rma.Version); err != nil {
+		return nil, err
+	}
+	return rma, nil
+}
+
+func (h *ReturnCommandHandler) save(ctx context.Context, rma *domain.ReturnAuthorization) error {
+	version := rma.Version
+	if err := h.returnRepo.Update(ctx, rma); err != nil {
+		return asVersionConflict(fmt.Errorf("failed to update return: %w", err), "return", version)
+	}
+	return nil
+}
+
+func (h *ReturnCommandHandler) publish(ctx context.Context, rma *domain.ReturnAuthorization, envelope *events.EventEnvelope, evt interface{}) (*CommandResult, error) {
+	if err := h.publisher.PublishEvent(ctx, envelope); err != nil {
+		return nil, fmt.Errorf("failed to publish event: %w", err)
+	}
+	return &CommandResult{
+		Success: true,
+		Data:    rma,
+		Events:  []interface{}{evt},
+	}, nil
+}
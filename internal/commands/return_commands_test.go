@@ -0,0 +1,135 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	apptest "github.com/ims-erp/system/internal/testing"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReturnFixture returns a harness holding an order of 4 units of a
+// product bought from a supplier, 3 of which were shipped.
+func newReturnFixture(t *testing.T) (*apptest.Harness, *domain.Order, *domain.Product) {
+	h := apptest.New()
+	tenantID := uuid.New()
+	supplierID := uuid.New()
+	product := &domain.Product{ID: uuid.New(), TenantID: tenantID, SKU: "KETTLE-1", SupplierID: &supplierID}
+	require.NoError(t, h.Products.Create(context.Background(), product))
+
+	order, _ := domain.NewOrder(tenantID, uuid.New(), uuid.New(), domain.OrderTypeStandard, domain.OrderSourceWeb, "EUR")
+	order.OrderNumber = "SO-2026-000042"
+	order.AddLine(domain.OrderLine{ProductID: product.ID, SKU: product.SKU, Quantity: 4, UnitPrice: decimal.NewFromInt(30)})
+	order.Fulfillments = append(order.Fulfillments, domain.OrderFulfillment{
+		ID:    uuid.New(),
+		Lines: []domain.FulfillmentLine{{OrderLineID: order.Lines[0].ID, Quantity: 3}},
+	})
+	require.NoError(t, h.Orders.Create(context.Background(), order))
+	return h, order, product
+}
+
+func authorizeReturnData(order *domain.Order, quantity int, reason string) map[string]interface{} {
+	return map[string]interface{}{
+		"orderId":     order.ID.String(),
+		"warehouseId": uuid.New().String(),
+		"lines": []map[string]interface{}{{
+			"orderLineId": order.Lines[0].ID.String(),
+			"quantity":    quantity,
+			"reason":      reason,
+			"lotNumber":   " LOT-7 ",
+		}},
+	}
+}
+
+func TestReturnCommandHandler_AuthorizeReturn(t *testing.T) {
+	h, order, product := newReturnFixture(t)
+	handler := h.ReturnCommands()
+	tenantID := order.TenantID.String()
+
+	result, err := handler.HandleAuthorizeReturn(context.Background(), commands.NewCommand("authorizeReturn", tenantID, "", uuid.New().String(), authorizeReturnData(order, 2, "defective")))
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	rma := result.Data.(*domain.ReturnAuthorization)
+	assert.Equal(t, "rma-000001", rma.RMANumber)
+	assert.Equal(t, "SO-2026-000042", rma.OrderNumber)
+	assert.Equal(t, domain.ReturnStatusAuthorized, rma.Status)
+	require.Len(t, rma.Lines, 1)
+	line := rma.Lines[0]
+	assert.Equal(t, product.ID, line.ProductID)
+	assert.Equal(t, *product.SupplierID, *line.SupplierID)
+	assert.Equal(t, "LOT-7", line.LotNumber)
+	assert.Equal(t, domain.ReturnReasonDefective, line.Reason)
+	assert.Equal(t, []string{"rma.authorized"}, h.Publisher.EventTypes())
+
+	_, err = handler.HandleAuthorizeReturn(context.Background(), commands.NewCommand("authorizeReturn", tenantID, "", uuid.New().String(), authorizeReturnData(order, 2, "wrong_item")))
+	assert.Equal(t, domain.ErrReturnQuantityExceeded, err, "only 1 shipped unit is left to return")
+
+	_, err = handler.HandleAuthorizeReturn(context.Background(), commands.NewCommand("authorizeReturn", tenantID, "", uuid.New().String(), authorizeReturnData(order, 1, "changed_mind")))
+	assert.Equal(t, domain.ErrInvalidReturnReason, err)
+
+	_, err = handler.HandleAuthorizeReturn(context.Background(), commands.NewCommand("authorizeReturn", uuid.New().String(), "", uuid.New().String(), authorizeReturnData(order, 1, "defective")))
+	assert.Error(t, err, "another tenant's order")
+}
+
+func TestReturnCommandHandler_DisposeReturnLine(t *testing.T) {
+	h, order, _ := newReturnFixture(t)
+	handler := h.ReturnCommands()
+	tenantID := order.TenantID.String()
+
+	result, err := handler.HandleAuthorizeReturn(context.Background(), commands.NewCommand("authorizeReturn", tenantID, "", uuid.New().String(), authorizeReturnData(order, 3, "damaged_in_transit")))
+	require.NoError(t, err)
+	rma := result.Data.(*domain.ReturnAuthorization)
+
+	dispose := map[string]interface{}{
+		"rmaId":       rma.ID.String(),
+		"lineId":      rma.Lines[0].ID.String(),
+		"disposition": "restock",
+	}
+	_, err = handler.HandleDisposeReturnLine(context.Background(), commands.NewCommand("disposeReturnLine", tenantID, "", uuid.New().String(), dispose))
+	assert.Equal(t, domain.ErrReturnNotReceived, err)
+
+	_, err = handler.HandleReceiveReturn(context.Background(), commands.NewCommand("receiveReturn", tenantID, "", uuid.New().String(), map[string]interface{}{"rmaId": rma.ID.String()}))
+	require.NoError(t, err)
+	stored, err := h.Returns.FindByID(context.Background(), rma.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReturnStatusReceived, stored.Status)
+
+	_, err = handler.HandleDisposeReturnLine(context.Background(), commands.NewCommand("disposeReturnLine", tenantID, "", uuid.New().String(), dispose))
+	require.NoError(t, err)
+
+	stored, err = h.Returns.FindByID(context.Background(), rma.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReturnStatusClosed, stored.Status)
+	assert.Equal(t, domain.ReturnDispositionRestock, stored.Lines[0].Disposition)
+	assert.NotNil(t, stored.ClosedAt)
+	assert.Equal(t, int64(2), stored.Version, "receiving and disposing each saved the return")
+	types := h.Publisher.EventTypes()
+	assert.Equal(t, "rma.line_dispositioned", types[len(types)-1])
+
+	_, err = handler.HandleDisposeReturnLine(context.Background(), commands.NewCommand("disposeReturnLine", tenantID, "", uuid.New().String(), dispose))
+	assert.Equal(t, domain.ErrReturnNotReceived, err, "closed returns take no more dispositions")
+}
+
+func TestReturnCommandHandler_ReceiveRejectsStaleVersion(t *testing.T) {
+	h, order, _ := newReturnFixture(t)
+	handler := h.ReturnCommands()
+	tenantID := order.TenantID.String()
+
+	result, err := handler.HandleAuthorizeReturn(context.Background(), commands.NewCommand("authorizeReturn", tenantID, "", uuid.New().String(), authorizeReturnData(order, 1, "defective")))
+	require.NoError(t, err)
+	rma := result.Data.(*domain.ReturnAuthorization)
+
+	cmd := commands.NewCommand("receiveReturn", tenantID, "", uuid.New().String(), map[string]interface{}{"rmaId": rma.ID.String()})
+	cmd.ExpectedVersion = 3
+	_, err = handler.HandleReceiveReturn(context.Background(), cmd)
+	assert.Error(t, err)
+	stored, err := h.Returns.FindByID(context.Background(), rma.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReturnStatusAuthorized, stored.Status)
+}
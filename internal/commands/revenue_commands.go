@@ -0,0 +1,286 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/money"
+)
+
+type RevenueScheduleRepository interface {
+	Create(ctx context.Context, schedule *domain.RevenueSchedule) error
+	FindByID(ctx context.Context, id uuid.UUID) (*domain.RevenueSchedule, error)
+	FindByInvoice(ctx context.Context, tenantID, invoiceID uuid.UUID) ([]*domain.RevenueSchedule, error)
+	Update(ctx context.Context, schedule *domain.RevenueSchedule) error
+	// EachActive calls fn with every schedule, of any tenant, with revenue
+	// still to recognize.
+	EachActive(ctx context.Context, fn func(*domain.RevenueSchedule) error) error
+}
+
+// RevenueRecognitionCommandHandler defers the revenue of invoice lines
+// billed upfront, such as service contracts, on recognition schedules and
+// recognizes it month by month. Recognition runs for closed months only, in
+// each tenant's time zone, so a month is recognized once it has ended.
+type RevenueRecognitionCommandHandler struct {
+	scheduleRepo RevenueScheduleRepository
+	invoiceRepo  InvoiceRepository
+	publisher    Publisher
+	outbox       EventOutbox
+	location     func(tenantID string) *time.Location
+	logger       *logger.Logger
+}
+
+func NewRevenueRecognitionCommandHandler(
+	scheduleRepo RevenueScheduleRepository,
+	invoiceRepo InvoiceRepository,
+	publisher Publisher,
+	location func(tenantID string) *time.Location,
+	log *logger.Logger,
+) *RevenueRecognitionCommandHandler {
+	return &RevenueRecognitionCommandHandler{
+		scheduleRepo: scheduleRepo,
+		invoiceRepo:  invoiceRepo,
+		publisher:    publisher,
+		location:     location,
+		logger:       log,
+	}
+}
+
+// WithOutbox routes events through the transactional outbox instead of
+// publishing them directly.
+func (h *RevenueRecognitionCommandHandler) WithOutbox(outbox EventOutbox) *RevenueRecognitionCommandHandler {
+	h.outbox = outbox
+	return h
+}
+
+// HandleCreateRevenueSchedule schedules the revenue of the line in lineId
+// of the invoice in the command's TargetID. With method straight_line it is
+// spread over months months from startPeriod (YYYY-MM, by default the month
+// the invoice was issued in); with method milestone it is split between
+// milestones, each a name and an amount.
+func (h *RevenueRecognitionCommandHandler) HandleCreateRevenueSchedule(ctx context.Context, cmd *CommandEnvelope) (*domain.RevenueSchedule, error) {
+	invoiceID, err := uuid.Parse(cmd.TargetID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid invoice ID")
+	}
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid user ID")
+	}
+	lineID, err := uuid.Parse(getString(cmd.Data, "lineId"))
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid invoice line ID")
+	}
+	var input struct {
+		Months     int                      `json:"months"`
+		Milestones []map[string]interface{} `json:"milestones"`
+	}
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, errors.InvalidArgument("months must be a number and milestones a list")
+	}
+
+	invoice, err := h.invoiceRepo.FindByID(ctx, invoiceID)
+	if err != nil || invoice == nil {
+		return nil, errors.NotFound("invoice not found")
+	}
+	if invoice.TenantID != tenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "invoice does not belong to tenant")
+	}
+	var line *domain.InvoiceLine
+	for i := range invoice.Lines {
+		if invoice.Lines[i].ID == lineID {
+			line = &invoice.Lines[i]
+		}
+	}
+	if line == nil {
+		return nil, errors.NotFound("invoice line not found")
+	}
+	existing, err := h.scheduleRepo.FindByInvoice(ctx, tenantID, invoiceID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to create revenue schedule")
+	}
+	for _, schedule := range existing {
+		if schedule.InvoiceLineID == lineID {
+			return nil, errors.Conflict("%s", domain.ErrRevenueScheduleExists.Message)
+		}
+	}
+
+	var schedule *domain.RevenueSchedule
+	switch domain.RecognitionMethod(getString(cmd.Data, "method")) {
+	case domain.RecognitionStraightLine:
+		startPeriod := getString(cmd.Data, "startPeriod")
+		if startPeriod == "" {
+			startPeriod = invoice.IssueDate.In(h.location(cmd.TenantID)).Format(domain.RevenuePeriodLayout)
+		}
+		schedule, err = domain.NewStraightLineSchedule(invoice, line, startPeriod, input.Months, userID)
+	case domain.RecognitionMilestone:
+		milestones := make([]domain.RevenueMilestone, 0, len(input.Milestones))
+		for _, milestone := range input.Milestones {
+			amount, _, err := money.Parse(milestone, "amount", invoice.Currency)
+			if err != nil {
+				return nil, err
+			}
+			name, _ := milestone["name"].(string)
+			milestones = append(milestones, domain.RevenueMilestone{Name: name, Amount: amount})
+		}
+		schedule, err = domain.NewMilestoneSchedule(invoice, line, milestones, userID)
+	default:
+		return nil, errors.InvalidArgument("method must be straight_line or milestone")
+	}
+	if err != nil {
+		return nil, revenueError(err)
+	}
+
+	event := eventpkg.NewRevenueScheduleCreatedEvent(schedule, cmd.UserID)
+	event.WithCorrelationID(cmd.CorrelationID)
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		return h.scheduleRepo.Create(ctx, schedule)
+	}, 0, &event.EventEnvelope); err != nil {
+		return nil, err
+	}
+
+	h.logger.New(ctx).Info("Revenue schedule created",
+		"schedule_id", schedule.ID,
+		"invoice_id", schedule.InvoiceID,
+		"method", schedule.Method,
+		"total", schedule.Total.String(),
+	)
+	return schedule, nil
+}
+
+// HandleCompleteMilestone completes the milestone in entryId of the
+// schedule in the command's TargetID, at completedAt (RFC 3339) or now. Its
+// revenue is recognized by the run after the month it was completed in.
+func (h *RevenueRecognitionCommandHandler) HandleCompleteMilestone(ctx context.Context, cmd *CommandEnvelope) (*domain.RevenueSchedule, error) {
+	scheduleID, err := uuid.Parse(cmd.TargetID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid revenue schedule ID")
+	}
+	tenantID, err := uuid.Parse(cmd.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	entryID, err := uuid.Parse(getString(cmd.Data, "entryId"))
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid milestone ID")
+	}
+	completedAt := time.Now()
+	if value := getString(cmd.Data, "completedAt"); value != "" {
+		if completedAt, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errors.InvalidArgument("completedAt must be an RFC 3339 time")
+		}
+		if completedAt.After(time.Now()) {
+			return nil, errors.InvalidArgument("completedAt cannot be in the future")
+		}
+	}
+
+	schedule, err := h.scheduleRepo.FindByID(ctx, scheduleID)
+	if err != nil || schedule == nil {
+		return nil, errors.NotFound("revenue schedule not found")
+	}
+	if schedule.TenantID != tenantID {
+		return nil, errors.Newf(errors.CodeForbidden, "revenue schedule does not belong to tenant")
+	}
+	if err := checkExpectedVersion(cmd, "revenue schedule", schedule.Version); err != nil {
+		return nil, err
+	}
+	entry, err := schedule.CompleteMilestone(entryID, completedAt)
+	if err != nil {
+		if err == domain.ErrRecognitionEntryNotFound {
+			return nil, errors.NotFound("milestone not found")
+		}
+		return nil, revenueError(err)
+	}
+
+	event := eventpkg.NewMilestoneCompletedEvent(schedule, entry, cmd.UserID)
+	event.WithCorrelationID(cmd.CorrelationID)
+	version := schedule.Version
+	if err := h.commit(ctx, func(ctx context.Context) error {
+		return h.scheduleRepo.Update(ctx, schedule)
+	}, version, &event.EventEnvelope); err != nil {
+		return nil, err
+	}
+
+	h.logger.New(ctx).Info("Revenue milestone completed",
+		"schedule_id", schedule.ID,
+		"milestone", entry.Milestone,
+		"amount", entry.Amount.String(),
+	)
+	return schedule, nil
+}
+
+// RecognizeDue recognizes, for every active schedule, the revenue due by
+// the end of the month before now in its tenant's time zone, publishing a
+// revenue.recognized event per schedule. Months already recognized are not
+// recognized again, so the job can run daily and catch up on missed runs.
+// A schedule that fails is logged and left for the next run.
+func (h *RevenueRecognitionCommandHandler) RecognizeDue(ctx context.Context, now time.Time) error {
+	var recognized, failed int
+	err := h.scheduleRepo.EachActive(ctx, func(schedule *domain.RevenueSchedule) error {
+		loc := h.location(schedule.TenantID.String())
+		local := now.In(loc)
+		period := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc).AddDate(0, -1, 0).Format(domain.RevenuePeriodLayout)
+
+		version := schedule.Version
+		entries, err := schedule.Recognize(period, loc, now)
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+		event := eventpkg.NewRevenueRecognizedEvent(schedule, period, entries)
+		if err := h.commit(ctx, func(ctx context.Context) error {
+			return h.scheduleRepo.Update(ctx, schedule)
+		}, version, &event.EventEnvelope); err != nil {
+			failed++
+			h.logger.New(ctx).Warn("Failed to recognize revenue", "schedule_id", schedule.ID, "period", period, "error", err)
+			return nil
+		}
+		recognized++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if recognized > 0 || failed > 0 {
+		h.logger.New(ctx).Info("Revenue recognized", "schedules", recognized, "failed", failed)
+	}
+	if failed > 0 {
+		return errors.Newf(errors.CodeInternalError, "failed to recognize revenue of %d schedules", failed)
+	}
+	return nil
+}
+
+func (h *RevenueRecognitionCommandHandler) commit(ctx context.Context, write func(ctx context.Context) error, version int64, events ...*eventpkg.EventEnvelope) error {
+	err := commitEvents(ctx, h.outbox, h.publisher, h.logger, write, events...)
+	if stderrors.Is(err, repository.ErrConcurrencyConflict) && version == 0 {
+		return errors.Conflict("%s", domain.ErrRevenueScheduleExists.Message)
+	}
+	err = asVersionConflict(err, "revenue schedule", version)
+	var appErr *errors.Error
+	if err != nil && !stderrors.As(err, &appErr) {
+		h.logger.New(ctx).Error("Failed to save revenue schedule", "error", err)
+		return errors.Wrap(err, errors.CodeInternalError, "failed to save revenue schedule")
+	}
+	return err
+}
+
+// revenueError reports a rule of revenue recognition that a command broke
+// as unprocessable.
+func revenueError(err error) error {
+	var paymentErr *domain.PaymentError
+	if stderrors.As(err, &paymentErr) {
+		return errors.Newf(errors.CodeUnprocessable, "%s", paymentErr.Message)
+	}
+	return err
+}
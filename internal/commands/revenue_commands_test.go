@@ -0,0 +1,201 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRevenueScheduleRepo struct {
+	schedules map[uuid.UUID]*domain.RevenueSchedule
+}
+
+func (r *mockRevenueScheduleRepo) Create(ctx context.Context, schedule *domain.RevenueSchedule) error {
+	stored := *schedule
+	r.schedules[schedule.ID] = &stored
+	return nil
+}
+
+func (r *mockRevenueScheduleRepo) FindByID(ctx context.Context, id uuid.UUID) (*domain.RevenueSchedule, error) {
+	schedule, ok := r.schedules[id]
+	if !ok {
+		return nil, fmt.Errorf("revenue schedule not found: %s", id)
+	}
+	loaded := *schedule
+	loaded.Entries = append([]domain.RecognitionEntry(nil), schedule.Entries...)
+	return &loaded, nil
+}
+
+func (r *mockRevenueScheduleRepo) FindByInvoice(ctx context.Context, tenantID, invoiceID uuid.UUID) ([]*domain.RevenueSchedule, error) {
+	var schedules []*domain.RevenueSchedule
+	for _, schedule := range r.schedules {
+		if schedule.TenantID == tenantID && schedule.InvoiceID == invoiceID {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, nil
+}
+
+func (r *mockRevenueScheduleRepo) Update(ctx context.Context, schedule *domain.RevenueSchedule) error {
+	if r.schedules[schedule.ID].Version != schedule.Version {
+		return fmt.Errorf("%w: revenue schedule %s", repository.ErrConcurrencyConflict, schedule.ID)
+	}
+	schedule.Version++
+	stored := *schedule
+	r.schedules[schedule.ID] = &stored
+	return nil
+}
+
+func (r *mockRevenueScheduleRepo) EachActive(ctx context.Context, fn func(*domain.RevenueSchedule) error) error {
+	for id := range r.schedules {
+		schedule, _ := r.FindByID(ctx, id)
+		if schedule.Status != domain.RevenueScheduleActive {
+			continue
+		}
+		if err := fn(schedule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTestRevenueHandler(loc *time.Location) (*RevenueRecognitionCommandHandler, *mockRevenueScheduleRepo, *mockInvoiceRepoForPayment, *mockPublisher) {
+	schedules := &mockRevenueScheduleRepo{schedules: make(map[uuid.UUID]*domain.RevenueSchedule)}
+	invoices := newMockInvoiceRepoForPayment()
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	location := func(string) *time.Location { return loc }
+	return NewRevenueRecognitionCommandHandler(schedules, invoices, publisher, location, log), schedules, invoices, publisher
+}
+
+func newTestServiceInvoice(invoices *mockInvoiceRepoForPayment, total int64) *domain.Invoice {
+	invoice := &domain.Invoice{
+		ID:            uuid.New(),
+		TenantID:      uuid.New(),
+		ClientID:      uuid.New(),
+		InvoiceNumber: "INV-2025-000042",
+		Status:        domain.InvoiceStatusSent,
+		Currency:      "EUR",
+		IssueDate:     time.Date(2025, 10, 5, 9, 0, 0, 0, time.UTC),
+		Lines: []domain.InvoiceLine{
+			{ID: uuid.New(), Description: "Annual support", Total: decimal.NewFromInt(total)},
+		},
+	}
+	invoices.invoices[invoice.ID] = invoice
+	return invoice
+}
+
+func TestRevenueRecognitionCommandHandler_StraightLine(t *testing.T) {
+	handler, _, invoices, publisher := newTestRevenueHandler(time.UTC)
+	ctx := context.Background()
+	invoice := newTestServiceInvoice(invoices, 1200)
+	tenantID, userID := invoice.TenantID.String(), uuid.New().String()
+
+	_, err := handler.HandleCreateRevenueSchedule(ctx, NewCommand("createRevenueSchedule", tenantID, invoice.ID.String(), userID, map[string]interface{}{
+		"lineId": invoice.Lines[0].ID.String(),
+		"method": "straight_line",
+		"months": 0,
+	}))
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+
+	schedule, err := handler.HandleCreateRevenueSchedule(ctx, NewCommand("createRevenueSchedule", tenantID, invoice.ID.String(), userID, map[string]interface{}{
+		"lineId": invoice.Lines[0].ID.String(),
+		"method": "straight_line",
+		"months": 12,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "2025-10", schedule.Entries[0].Period, "starts in the month the invoice was issued")
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "revenue_schedule.created", publisher.events[0].Type)
+
+	_, err = handler.HandleCreateRevenueSchedule(ctx, NewCommand("createRevenueSchedule", tenantID, invoice.ID.String(), userID, map[string]interface{}{
+		"lineId": invoice.Lines[0].ID.String(),
+		"method": "straight_line",
+		"months": 6,
+	}))
+	assertErrorCode(t, err, errors.CodeConflict)
+
+	// October is still open on its last day; it is recognized in November,
+	// and catching up after missed runs recognizes every closed month.
+	require.NoError(t, handler.RecognizeDue(ctx, time.Date(2025, 10, 31, 12, 0, 0, 0, time.UTC)))
+	assert.Len(t, publisher.events, 1)
+	require.NoError(t, handler.RecognizeDue(ctx, time.Date(2025, 11, 1, 0, 5, 0, 0, time.UTC)))
+	require.NoError(t, handler.RecognizeDue(ctx, time.Date(2025, 11, 2, 0, 5, 0, 0, time.UTC)))
+	require.Len(t, publisher.events, 2)
+	recognized := publisher.events[1]
+	assert.Equal(t, "revenue.recognized", recognized.Type)
+	assert.Equal(t, "2025-10", recognized.Data["period"])
+	assert.Equal(t, "100", recognized.Data["amount"])
+	assert.Equal(t, "1100", recognized.Data["deferred"])
+
+	require.NoError(t, handler.RecognizeDue(ctx, time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC)))
+	require.Len(t, publisher.events, 3)
+	assert.Equal(t, "2026-01", publisher.events[2].Data["period"])
+	assert.Equal(t, "300", publisher.events[2].Data["amount"])
+}
+
+func TestRevenueRecognitionCommandHandler_Milestones(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	handler, schedules, invoices, publisher := newTestRevenueHandler(newYork)
+	ctx := context.Background()
+	invoice := newTestServiceInvoice(invoices, 900)
+	tenantID, userID := invoice.TenantID.String(), uuid.New().String()
+
+	_, err = handler.HandleCreateRevenueSchedule(ctx, NewCommand("createRevenueSchedule", tenantID, invoice.ID.String(), userID, map[string]interface{}{
+		"lineId": invoice.Lines[0].ID.String(),
+		"method": "milestone",
+		"milestones": []interface{}{
+			map[string]interface{}{"name": "Design", "amount": "300"},
+			map[string]interface{}{"name": "Go-live", "amount": "500"},
+		},
+	}))
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+
+	schedule, err := handler.HandleCreateRevenueSchedule(ctx, NewCommand("createRevenueSchedule", tenantID, invoice.ID.String(), userID, map[string]interface{}{
+		"lineId": invoice.Lines[0].ID.String(),
+		"method": "milestone",
+		"milestones": []interface{}{
+			map[string]interface{}{"name": "Design", "amount": "300"},
+			map[string]interface{}{"name": "Go-live", "amount": "600"},
+		},
+	}))
+	require.NoError(t, err)
+
+	_, err = handler.HandleCompleteMilestone(ctx, NewCommand("completeMilestone", uuid.New().String(), schedule.ID.String(), userID, map[string]interface{}{
+		"entryId": schedule.Entries[0].ID.String(),
+	}))
+	assertErrorCode(t, err, errors.CodeForbidden)
+
+	// 02:00 UTC on 1 November is still October in New York.
+	schedule, err = handler.HandleCompleteMilestone(ctx, NewCommand("completeMilestone", tenantID, schedule.ID.String(), userID, map[string]interface{}{
+		"entryId":     schedule.Entries[0].ID.String(),
+		"completedAt": "2025-11-01T02:00:00Z",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), schedule.Version)
+
+	stale := NewCommand("completeMilestone", tenantID, schedule.ID.String(), userID, map[string]interface{}{
+		"entryId": schedule.Entries[1].ID.String(),
+	}).WithExpectedVersion(7)
+	_, err = handler.HandleCompleteMilestone(ctx, stale)
+	assertErrorCode(t, err, errors.CodeConflict)
+
+	require.NoError(t, handler.RecognizeDue(ctx, time.Date(2025, 11, 1, 3, 0, 0, 0, time.UTC)))
+	assert.Len(t, publisher.events, 2, "October has not ended in New York yet")
+	require.NoError(t, handler.RecognizeDue(ctx, time.Date(2025, 11, 1, 5, 0, 0, 0, time.UTC)))
+	require.Len(t, publisher.events, 3)
+	assert.Equal(t, "2025-10", publisher.events[2].Data["period"])
+	assert.Equal(t, "300", publisher.events[2].Data["amount"])
+	assert.Equal(t, "600", schedules.schedules[schedule.ID].Deferred().String())
+}
@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	eventpkg "github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+type TaxReturnRepository interface {
+	// Create saves a filed return, and reports
+	// repository.ErrConcurrencyConflict when its period was filed before.
+	Create(ctx context.Context, taxReturn *domain.TaxReturn) error
+	// FindOverlapping returns a filed return whose period overlaps
+	// [from, to), or nil.
+	FindOverlapping(ctx context.Context, tenantID uuid.UUID, from, to time.Time) (*domain.TaxReturn, error)
+}
+
+// IssuedInvoiceSource streams the invoices VAT returns are built from.
+type IssuedInvoiceSource interface {
+	// EachIssued calls fn with the tenant's invoices and credit notes
+	// issued in [from, to), drafts and voided invoices left out.
+	EachIssued(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Invoice) error) error
+}
+
+// TaxReturnCommandHandler builds tenants' VAT returns from the invoices and
+// credit notes they issued, and files them. Periods are counted in each
+// tenant's time zone, and returns follow the tenant's VAT registration.
+type TaxReturnCommandHandler struct {
+	returnRepo   TaxReturnRepository
+	invoices     IssuedInvoiceSource
+	publisher    Publisher
+	outbox       EventOutbox
+	jurisdiction func(tenantID string) config.TaxJurisdiction
+	location     func(tenantID string) *time.Location
+	logger       *logger.Logger
+}
+
+func NewTaxReturnCommandHandler(
+	returnRepo TaxReturnRepository,
+	invoices IssuedInvoiceSource,
+	publisher Publisher,
+	jurisdiction func(tenantID string) config.TaxJurisdiction,
+	location func(tenantID string) *time.Location,
+	log *logger.Logger,
+) *TaxReturnCommandHandler {
+	return &TaxReturnCommandHandler{
+		returnRepo:   returnRepo,
+		invoices:     invoices,
+		publisher:    publisher,
+		jurisdiction: jurisdiction,
+		location:     location,
+		logger:       log,
+	}
+}
+
+// WithOutbox routes events through the transactional outbox instead of
+// publishing them directly.
+func (h *TaxReturnCommandHandler) WithOutbox(outbox EventOutbox) *TaxReturnCommandHandler {
+	h.outbox = outbox
+	return h
+}
+
+// BuildTaxReturn returns the tenant's VAT return for period, or for the
+// current one when period is empty: the return as filed once it is, and
+// built from the invoices until then.
+func (h *TaxReturnCommandHandler) BuildTaxReturn(ctx context.Context, tenantID, period string) (*domain.TaxReturn, error) {
+	tenant, err := uuid.Parse(tenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+	jurisdiction := h.jurisdiction(tenantID)
+	if jurisdiction.Country == "" {
+		return nil, errors.New(errors.CodeUnprocessable, "no VAT registration is configured for the tenant")
+	}
+	periodicity := domain.TaxPeriodicity(jurisdiction.Period)
+	loc := h.location(tenantID)
+	if period == "" {
+		period = domain.TaxPeriodOf(time.Now().In(loc), periodicity)
+	}
+	from, to, err := domain.TaxPeriodBounds(period, periodicity, loc)
+	if err != nil {
+		return nil, taxReturnError(err)
+	}
+
+	filed, err := h.returnRepo.FindOverlapping(ctx, tenant, from, to)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to find filed VAT returns")
+	}
+	if filed != nil && filed.Period == period {
+		return filed, nil
+	}
+
+	taxReturn := domain.NewTaxReturn(tenant, period, periodicity, from, to,
+		jurisdiction.Country, jurisdiction.VATNumber, strings.ToUpper(jurisdiction.Currency), jurisdiction.Codes)
+	if err := h.invoices.EachIssued(ctx, tenant, from, to, func(invoice *domain.Invoice) error {
+		taxReturn.AddInvoice(invoice)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to read invoices")
+	}
+	taxReturn.Total()
+	if filed != nil {
+		// The tenant changed how often it files since; the period overlaps
+		// one filed, and cannot be filed itself.
+		taxReturn.Issues = append(taxReturn.Issues, domain.TaxReturnIssue{
+			Problem: "period overlaps " + filed.Period + ", which is filed",
+		})
+	}
+	return taxReturn, nil
+}
+
+// HandleFileTaxReturn files the tenant's VAT return for period as it stands,
+// with the reference the tax authority acknowledged it with, and locks the
+// period: invoices can no longer be issued or voided in it. Corrections are
+// made by credit notes in a later period.
+func (h *TaxReturnCommandHandler) HandleFileTaxReturn(ctx context.Context, cmd *CommandEnvelope) (*domain.TaxReturn, error) {
+	userID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid user ID")
+	}
+	period := getString(cmd.Data, "period")
+	if period == "" {
+		return nil, errors.InvalidArgument("period is required")
+	}
+
+	taxReturn, err := h.BuildTaxReturn(ctx, cmd.TenantID, period)
+	if err != nil {
+		return nil, err
+	}
+	if taxReturn.IsFiled() {
+		return nil, errors.Conflict("VAT return for %s is already filed", period)
+	}
+	now := time.Now().UTC()
+	if !taxReturn.To.Before(now) {
+		return nil, errors.Newf(errors.CodeUnprocessable, "VAT period %s has not ended", period)
+	}
+	for _, issue := range taxReturn.Issues {
+		if issue.InvoiceID == uuid.Nil {
+			return nil, errors.Newf(errors.CodeUnprocessable, "VAT return for %s cannot be filed: %s", period, issue.Problem)
+		}
+	}
+	if err := taxReturn.File(getString(cmd.Data, "reference"), userID, now); err != nil {
+		return nil, taxReturnError(err)
+	}
+	taxReturn.Version = 1
+
+	event := eventpkg.NewTaxReturnFiledEvent(taxReturn, cmd.UserID)
+	event.WithCorrelationID(cmd.CorrelationID)
+	err = commitEvents(ctx, h.outbox, h.publisher, h.logger, func(ctx context.Context) error {
+		return h.returnRepo.Create(ctx, taxReturn)
+	}, &event.EventEnvelope)
+	if stderrors.Is(err, repository.ErrConcurrencyConflict) {
+		return nil, errors.Conflict("VAT return for %s is already filed", period)
+	}
+	if err != nil {
+		h.logger.New(ctx).Error("Failed to save VAT return", "error", err)
+		return nil, errors.Wrap(err, errors.CodeInternalError, "failed to save VAT return")
+	}
+
+	h.logger.New(ctx).Info("VAT return filed",
+		"tax_return_id", taxReturn.ID,
+		"period", taxReturn.Period,
+		"invoices", taxReturn.Invoices,
+		"credit_notes", taxReturn.CreditNotes,
+		"issues", len(taxReturn.Issues),
+	)
+	return taxReturn, nil
+}
+
+// taxReturnError reports a VAT rule that a request broke as invalid.
+func taxReturnError(err error) error {
+	var paymentErr *domain.PaymentError
+	if stderrors.As(err, &paymentErr) {
+		return errors.Newf(errors.CodeInvalidArgument, "%s", paymentErr.Message)
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTaxReturnRepo struct {
+	returns []*domain.TaxReturn
+}
+
+func (r *mockTaxReturnRepo) Create(ctx context.Context, taxReturn *domain.TaxReturn) error {
+	for _, filed := range r.returns {
+		if filed.TenantID == taxReturn.TenantID && filed.Period == taxReturn.Period {
+			return fmt.Errorf("%w: VAT return for %s already filed", repository.ErrConcurrencyConflict, taxReturn.Period)
+		}
+	}
+	r.returns = append(r.returns, taxReturn)
+	return nil
+}
+
+func (r *mockTaxReturnRepo) FindOverlapping(ctx context.Context, tenantID uuid.UUID, from, to time.Time) (*domain.TaxReturn, error) {
+	for _, filed := range r.returns {
+		if filed.TenantID == tenantID && filed.From.Before(to) && filed.To.After(from) {
+			return filed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *mockTaxReturnRepo) FiledPeriod(ctx context.Context, tenantID uuid.UUID, at time.Time) (string, error) {
+	filed, _ := r.FindOverlapping(ctx, tenantID, at, at.Add(time.Nanosecond))
+	if filed == nil {
+		return "", nil
+	}
+	return filed.Period, nil
+}
+
+type mockIssuedInvoices struct {
+	invoices []*domain.Invoice
+}
+
+func (s *mockIssuedInvoices) EachIssued(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Invoice) error) error {
+	for _, invoice := range s.invoices {
+		if invoice.TenantID != tenantID || invoice.IssueDate.Before(from) || !invoice.IssueDate.Before(to) {
+			continue
+		}
+		if err := fn(invoice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestTaxReturnCommandHandler_FileTaxReturn(t *testing.T) {
+	returns := &mockTaxReturnRepo{}
+	invoices := &mockIssuedInvoices{}
+	publisher := &mockPublisher{}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	jurisdiction := func(string) config.TaxJurisdiction {
+		return config.TaxJurisdiction{Country: "GB", VATNumber: "GB123456789", Currency: "GBP", Period: "quarterly"}
+	}
+	handler := NewTaxReturnCommandHandler(returns, invoices, publisher, jurisdiction,
+		func(string) *time.Location { return time.UTC }, log)
+	ctx := context.Background()
+
+	tenantID, userID := uuid.New(), uuid.New().String()
+	invoice := &domain.Invoice{
+		ID:        uuid.New(),
+		TenantID:  tenantID,
+		Type:      domain.InvoiceTypeStandard,
+		Status:    domain.InvoiceStatusSent,
+		Currency:  "GBP",
+		IssueDate: time.Date(2025, 2, 10, 9, 0, 0, 0, time.UTC),
+		Lines: []domain.InvoiceLine{
+			{Total: decimal.NewFromInt(100), TaxRate: decimal.NewFromInt(20), TaxAmount: decimal.NewFromInt(20), TaxCode: "S"},
+		},
+	}
+	invoices.invoices = append(invoices.invoices, invoice)
+
+	draft, err := handler.BuildTaxReturn(ctx, tenantID.String(), "2025-Q1")
+	require.NoError(t, err)
+	assert.False(t, draft.IsFiled())
+	assert.Equal(t, "20", draft.TotalIn("GBP").TaxAmount.String())
+
+	_, err = handler.HandleFileTaxReturn(ctx, NewCommand("fileTaxReturn", tenantID.String(), "", userID, map[string]interface{}{
+		"period": "2025-01",
+	}))
+	assertErrorCode(t, err, errors.CodeInvalidArgument)
+
+	current := domain.TaxPeriodOf(time.Now().UTC(), domain.TaxQuarterly)
+	_, err = handler.HandleFileTaxReturn(ctx, NewCommand("fileTaxReturn", tenantID.String(), "", userID, map[string]interface{}{
+		"period": current,
+	}))
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+
+	filed, err := handler.HandleFileTaxReturn(ctx, NewCommand("fileTaxReturn", tenantID.String(), "", userID, map[string]interface{}{
+		"period":    "2025-Q1",
+		"reference": "ACK-1",
+	}))
+	require.NoError(t, err)
+	assert.True(t, filed.IsFiled())
+	assert.Equal(t, "ACK-1", filed.Reference)
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "tax_return.filed", publisher.events[0].Type)
+
+	_, err = handler.HandleFileTaxReturn(ctx, NewCommand("fileTaxReturn", tenantID.String(), "", userID, map[string]interface{}{
+		"period": "2025-Q1",
+	}))
+	assertErrorCode(t, err, errors.CodeConflict)
+
+	// The filed return is kept as filed, whatever happens to the invoices.
+	invoice.Lines[0].TaxAmount = decimal.NewFromInt(40)
+	again, err := handler.BuildTaxReturn(ctx, tenantID.String(), "2025-Q1")
+	require.NoError(t, err)
+	assert.Equal(t, "20", again.TotalIn("GBP").TaxAmount.String())
+
+	invoiceRepo := newMockInvoiceRepo()
+	invoiceRepo.Create(ctx, invoice)
+	invoiceHandler := NewInvoiceCommandHandler(invoiceRepo, nil, publisher, log, &mockInvoiceCounter{}).
+		WithTaxPeriodLocks(returns)
+	_, err = invoiceHandler.HandleVoidInvoice(ctx, NewCommand("voidInvoice", tenantID.String(), invoice.ID.String(), userID, map[string]interface{}{
+		"reason": "issued twice",
+	}))
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+	assert.Equal(t, domain.InvoiceStatusSent, invoice.Status)
+}
+
+func TestTaxReturnCommandHandler_NoRegistration(t *testing.T) {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	handler := NewTaxReturnCommandHandler(&mockTaxReturnRepo{}, &mockIssuedInvoices{}, &mockPublisher{},
+		func(string) config.TaxJurisdiction { return config.TaxJurisdiction{} },
+		func(string) *time.Location { return time.UTC }, log)
+
+	_, err := handler.BuildTaxReturn(context.Background(), uuid.New().String(), "")
+	assertErrorCode(t, err, errors.CodeUnprocessable)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ims-erp/system/internal/domain"
 	"github.com/ims-erp/system/internal/events"
+	"github.com/shopspring/decimal"
 )
 
 type CreateWarehouse struct {
@@ -62,13 +64,14 @@ type UpdateLocation struct {
 }
 
 type CreateWarehouseOperation struct {
-	WarehouseID   uuid.UUID
-	Type          string
-	ReferenceType string
-	ReferenceID   uuid.UUID
-	Priority      int
-	Items         []OperationItemInput
-	Notes         string
+	WarehouseID    uuid.UUID
+	Type           string
+	ReferenceType  string
+	ReferenceID    uuid.UUID
+	PartnerCountry string
+	Priority       int
+	Items          []OperationItemInput
+	Notes          string
 }
 
 type OperationItemInput struct {
@@ -76,6 +79,8 @@ type OperationItemInput struct {
 	VariantID  *uuid.UUID
 	LocationID uuid.UUID
 	Quantity   int
+	UnitCost   string
+	Weight     string
 }
 
 type StartWarehouseOperation struct {
@@ -87,9 +92,18 @@ type CompleteWarehouseOperation struct {
 	CompletedItems []CompletedItemInput
 }
 
+// CompletedItemInput reports units of an item scanned by the user sending
+// the command. ScannedAt is when the scanner read them; it defaults to when
+// the command is handled, so devices that queue scans offline should set it.
 type CompletedItemInput struct {
-	ItemID   uuid.UUID
-	Quantity int
+	ItemID    uuid.UUID
+	Quantity  int
+	ScannedAt *time.Time
+}
+
+type AssignWarehouseOperation struct {
+	ID         uuid.UUID
+	AssignedTo uuid.UUID
 }
 
 type CancelWarehouseOperation struct {
@@ -410,6 +424,10 @@ func (h *WarehouseCommandHandler) HandleCreateWarehouseOperation(ctx context.Con
 
 	operation.Priority = input.Priority
 	operation.Notes = input.Notes
+	operation.PartnerCountry = strings.ToUpper(strings.TrimSpace(input.PartnerCountry))
+	if operation.PartnerCountry != "" && !domain.IsCountryCode(operation.PartnerCountry) {
+		return nil, fmt.Errorf("invalid partner country: %s", input.PartnerCountry)
+	}
 
 	for _, itemInput := range input.Items {
 		item := domain.OperationItem{
@@ -420,6 +438,16 @@ func (h *WarehouseCommandHandler) HandleCreateWarehouseOperation(ctx context.Con
 			Quantity:   itemInput.Quantity,
 			Status:     "pending",
 		}
+		if itemInput.UnitCost != "" {
+			if item.UnitCost, err = decimal.NewFromString(itemInput.UnitCost); err != nil {
+				return nil, fmt.Errorf("invalid unit cost: %w", err)
+			}
+		}
+		if itemInput.Weight != "" {
+			if item.Weight, err = decimal.NewFromString(itemInput.Weight); err != nil {
+				return nil, fmt.Errorf("invalid weight: %w", err)
+			}
+		}
 		operation.AddItem(item)
 	}
 
@@ -439,6 +467,43 @@ func (h *WarehouseCommandHandler) HandleCreateWarehouseOperation(ctx context.Con
 	}, nil
 }
 
+func (h *WarehouseCommandHandler) HandleAssignWarehouseOperation(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
+	var input AssignWarehouseOperation
+	if err := parseCommandData(cmd, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse command data: %w", err)
+	}
+
+	if input.AssignedTo == uuid.Nil {
+		return nil, fmt.Errorf("assignedTo is required")
+	}
+
+	operation, err := h.operationRepo.FindByID(ctx, input.ID)
+	if err != nil {
+		return nil, fmt.Errorf("operation not found: %w", err)
+	}
+
+	if operation.Status == "completed" || operation.Status == "cancelled" {
+		return nil, fmt.Errorf("cannot assign completed or cancelled operation")
+	}
+
+	operation.AssignTo(input.AssignedTo)
+
+	if err := h.operationRepo.Update(ctx, operation); err != nil {
+		return nil, fmt.Errorf("failed to assign operation: %w", err)
+	}
+
+	evt := events.NewWarehouseOperationAssignedEvent(operation, cmd.UserID)
+	if err := h.publisher.PublishEvent(ctx, &evt.EventEnvelope); err != nil {
+		return nil, fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return &CommandResult{
+		Success: true,
+		Data:    operation,
+		Events:  []interface{}{evt},
+	}, nil
+}
+
 func (h *WarehouseCommandHandler) HandleStartWarehouseOperation(ctx context.Context, cmd *CommandEnvelope) (*CommandResult, error) {
 	var input StartWarehouseOperation
 	if err := parseCommandData(cmd, &input); err != nil {
@@ -478,13 +543,22 @@ func (h *WarehouseCommandHandler) HandleCompleteWarehouseOperation(ctx context.C
 		return nil, fmt.Errorf("failed to parse command data: %w", err)
 	}
 
+	operatorID, err := uuid.Parse(cmd.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
 	operation, err := h.operationRepo.FindByID(ctx, input.ID)
 	if err != nil {
 		return nil, fmt.Errorf("operation not found: %w", err)
 	}
 
 	for _, completed := range input.CompletedItems {
-		if err := operation.CompleteItem(completed.ItemID, completed.Quantity); err != nil {
+		var scannedAt time.Time
+		if completed.ScannedAt != nil {
+			scannedAt = *completed.ScannedAt
+		}
+		if err := operation.ScanItem(completed.ItemID, operatorID, completed.Quantity, scannedAt); err != nil {
 			return nil, err
 		}
 	}
@@ -3,6 +3,7 @@ package commands
 import (
 	"context"
 	"testing"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 
@@ -536,6 +537,94 @@ func TestWarehouseCommandHandler_CompleteWarehouseOperation(t *testing.T) {
 	assert.Equal(t, "warehouse.operation.completed", publisher.events[0].Type)
 }
 
+func TestWarehouseCommandHandler_CompleteWarehouseOperationRecordsScans(t *testing.T) {
+	tenantID := uuid.New()
+	userID := uuid.New()
+	itemID := uuid.New()
+
+	operationRepo := NewMockOperationRepository()
+	publisher := &MockPublisher{}
+	handler := NewWarehouseCommandHandler(NewMockWarehouseRepository(), NewMockLocationRepository(), operationRepo, publisher)
+
+	operation, _ := domain.NewWarehouseOperation(tenantID, uuid.New(), userID, domain.OperationTypePick, "order", uuid.New())
+	operation.Start()
+	operation.AddItem(domain.OperationItem{ID: itemID, ProductID: uuid.New(), Quantity: 4, Status: "pending"})
+	operationRepo.Create(context.Background(), operation)
+
+	scannedAt := time.Date(2026, 3, 2, 9, 15, 0, 0, time.UTC)
+	cmd := NewCommand("completeWarehouseOperation", tenantID.String(), "", userID.String(), map[string]interface{}{
+		"id": operation.ID.String(),
+		"completedItems": []map[string]interface{}{
+			{"itemId": itemID.String(), "quantity": 1, "scannedAt": scannedAt},
+			{"itemId": itemID.String(), "quantity": 3},
+		},
+	})
+
+	_, err := handler.HandleCompleteWarehouseOperation(context.Background(), cmd)
+	require.NoError(t, err)
+
+	updatedOp, _ := operationRepo.FindByID(context.Background(), operation.ID)
+	scans := updatedOp.Items[0].Scans
+	require.Len(t, scans, 2)
+	assert.Equal(t, userID, scans[0].OperatorID)
+	assert.Equal(t, scannedAt, scans[0].ScannedAt)
+	assert.Equal(t, 3, scans[1].Quantity)
+}
+
+func TestWarehouseCommandHandler_AssignWarehouseOperation(t *testing.T) {
+	tenantID := uuid.New()
+	userID := uuid.New()
+	operatorID := uuid.New()
+
+	operationRepo := NewMockOperationRepository()
+	publisher := &MockPublisher{}
+	handler := NewWarehouseCommandHandler(NewMockWarehouseRepository(), NewMockLocationRepository(), operationRepo, publisher)
+
+	operation, _ := domain.NewWarehouseOperation(tenantID, uuid.New(), userID, domain.OperationTypeReceipt, "purchase_order", uuid.New())
+	operationRepo.Create(context.Background(), operation)
+
+	cmd := NewCommand("assignWarehouseOperation", tenantID.String(), "", userID.String(), map[string]interface{}{
+		"id":         operation.ID.String(),
+		"assignedTo": operatorID.String(),
+	})
+
+	result, err := handler.HandleAssignWarehouseOperation(context.Background(), cmd)
+
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	updatedOp, _ := operationRepo.FindByID(context.Background(), operation.ID)
+	require.NotNil(t, updatedOp.AssignedTo)
+	assert.Equal(t, operatorID, *updatedOp.AssignedTo)
+	assert.NotNil(t, updatedOp.AssignedAt)
+
+	assert.Len(t, publisher.events, 1)
+	assert.Equal(t, "warehouse.operation.assigned", publisher.events[0].Type)
+}
+
+func TestWarehouseCommandHandler_AssignCompletedOperation(t *testing.T) {
+	tenantID := uuid.New()
+	userID := uuid.New()
+
+	operationRepo := NewMockOperationRepository()
+	handler := NewWarehouseCommandHandler(NewMockWarehouseRepository(), NewMockLocationRepository(), operationRepo, &MockPublisher{})
+
+	operation, _ := domain.NewWarehouseOperation(tenantID, uuid.New(), userID, domain.OperationTypePick, "order", uuid.New())
+	operation.Complete()
+	operationRepo.Create(context.Background(), operation)
+
+	cmd := NewCommand("assignWarehouseOperation", tenantID.String(), "", userID.String(), map[string]interface{}{
+		"id":         operation.ID.String(),
+		"assignedTo": uuid.New().String(),
+	})
+
+	result, err := handler.HandleAssignWarehouseOperation(context.Background(), cmd)
+
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.Nil(t, operation.AssignedTo)
+}
+
 func TestWarehouseCommandHandler_CancelWarehouseOperation(t *testing.T) {
 	tenantID := uuid.New()
 	userID := uuid.New()
@@ -0,0 +1,245 @@
+// Package comments lets users discuss invoices, orders, clients and
+// documents. A comment may mention users with the @[Name](user-id) markup;
+// newly mentioned users are notified through a comment.mentioned event.
+// Edits keep the previous body and deletes move the comment to the trash,
+// and both are published as events so the audit log records them.
+package comments
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/internal/repository"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// ModeratePermission lets a user delete the comments of others.
+const ModeratePermission = "comment:moderate"
+
+const (
+	maxBodyLength = 10000
+	listLimit     = 500
+)
+
+type store interface {
+	Add(ctx context.Context, comment *domain.Comment) error
+	Get(ctx context.Context, tenantID, id string) (*domain.Comment, error)
+	List(ctx context.Context, tenantID, entityType, entityID string, limit int) ([]domain.Comment, error)
+	Save(ctx context.Context, comment *domain.Comment) error
+}
+
+type users interface {
+	FindByID(ctx context.Context, id string) (*domain.User, error)
+}
+
+// Comments adds, edits and deletes comments.
+type Comments struct {
+	store     store
+	users     users
+	publisher events.Publisher
+	logger    *logger.Logger
+}
+
+// New returns comments kept in store. Mentions are resolved against users;
+// events go to publisher.
+func New(store *repository.CommentStore, users users, publisher events.Publisher, log *logger.Logger) *Comments {
+	return newComments(store, users, publisher, log)
+}
+
+func newComments(store store, users users, publisher events.Publisher, log *logger.Logger) *Comments {
+	return &Comments{store: store, users: users, publisher: publisher, logger: log}
+}
+
+// ReadPermission is the permission needed to see, and comment on, entities
+// of entityType.
+func ReadPermission(entityType string) string {
+	return entityType + ":read"
+}
+
+// List returns the comments left on an entity, oldest first.
+func (c *Comments) List(ctx context.Context, tenantID, entityType, entityID string) ([]domain.Comment, error) {
+	if !domain.ValidCommentEntity(entityType) {
+		return nil, apperr.InvalidArgument("comments cannot be attached to %s", entityType)
+	}
+	return c.store.List(ctx, tenantID, entityType, entityID, listLimit)
+}
+
+// Add leaves a comment by userID on an entity and notifies the users it
+// mentions.
+func (c *Comments) Add(ctx context.Context, tenantID, userID, entityType, entityID, body string) (*domain.Comment, error) {
+	if !domain.ValidCommentEntity(entityType) {
+		return nil, apperr.InvalidArgument("comments cannot be attached to %s", entityType)
+	}
+	if entityID == "" {
+		return nil, apperr.InvalidArgument("entity ID is required")
+	}
+	body, err := validBody(body)
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := c.mentions(ctx, tenantID, userID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &domain.Comment{
+		ID:         uuid.New().String(),
+		TenantID:   tenantID,
+		EntityType: entityType,
+		EntityID:   entityID,
+		AuthorID:   userID,
+		Body:       body,
+		Mentions:   mentions,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := c.store.Add(ctx, comment); err != nil {
+		return nil, err
+	}
+
+	c.publish(ctx, comment, "comment.added", userID, map[string]interface{}{"body": body})
+	c.notifyMentions(ctx, comment, userID, mentions)
+	return comment, nil
+}
+
+// Edit replaces the body of a comment. Only its author may edit it; the
+// previous body is kept in its history.
+func (c *Comments) Edit(ctx context.Context, tenantID, userID, id, body string) (*domain.Comment, error) {
+	comment, err := c.get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment.AuthorID != userID {
+		return nil, apperr.Forbidden("only the author can edit a comment")
+	}
+	body, err = validBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if body == comment.Body {
+		return comment, nil
+	}
+	mentions, err := c.mentions(ctx, tenantID, userID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := comment.Body
+	previousMentions := comment.Mentions
+	now := time.Now().UTC()
+	comment.History = append(comment.History, domain.CommentEdit{Body: previous, EditedAt: now})
+	comment.Body = body
+	comment.Mentions = mentions
+	comment.EditedAt = &now
+	if err := c.store.Save(ctx, comment); err != nil {
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			return nil, apperr.NotFound("comment %s not found", id)
+		}
+		return nil, err
+	}
+
+	c.publish(ctx, comment, "comment.edited", userID, map[string]interface{}{"body": body, "previousBody": previous})
+	c.notifyMentions(ctx, comment, userID, added(previousMentions, mentions))
+	return comment, nil
+}
+
+// Delete moves a comment to the trash. Authors may delete their own
+// comments; deleting those of others needs ModeratePermission.
+func (c *Comments) Delete(ctx context.Context, tenantID, userID, id string, permissions []string) error {
+	comment, err := c.get(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if comment.AuthorID != userID && !rbac.Allows(permissions, ModeratePermission) {
+		return apperr.Forbidden("only the author or a moderator can delete a comment")
+	}
+	comment.MarkDeleted(userID, time.Now())
+	if err := c.store.Save(ctx, comment); err != nil {
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			return apperr.NotFound("comment %s not found", id)
+		}
+		return err
+	}
+
+	c.publish(ctx, comment, "comment.deleted", userID, map[string]interface{}{"body": comment.Body, "authorId": comment.AuthorID})
+	return nil
+}
+
+func (c *Comments) get(ctx context.Context, tenantID, id string) (*domain.Comment, error) {
+	comment, err := c.store.Get(ctx, tenantID, id)
+	if errors.Is(err, repository.ErrCommentNotFound) || (err == nil && comment.IsDeleted()) {
+		return nil, apperr.NotFound("comment %s not found", id)
+	}
+	return comment, err
+}
+
+func validBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", apperr.InvalidArgument("comment body is required")
+	}
+	if len([]rune(body)) > maxBodyLength {
+		return "", apperr.InvalidArgument("comment body must be at most %d characters", maxBodyLength)
+	}
+	return body, nil
+}
+
+// mentions returns the users of tenantID that body mentions. Unknown users,
+// users of other tenants and the author are left out.
+func (c *Comments) mentions(ctx context.Context, tenantID, authorID, body string) ([]string, error) {
+	var ids []string
+	for _, id := range domain.ParseMentions(body) {
+		if id == authorID {
+			continue
+		}
+		user, err := c.users.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil && user.TenantID.String() == tenantID {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// added returns the IDs in now that were not in before.
+func added(before, now []string) []string {
+	known := make(map[string]bool, len(before))
+	for _, id := range before {
+		known[id] = true
+	}
+	var ids []string
+	for _, id := range now {
+		if !known[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (c *Comments) notifyMentions(ctx context.Context, comment *domain.Comment, userID string, mentions []string) {
+	if len(mentions) == 0 {
+		return
+	}
+	c.publish(ctx, comment, "comment.mentioned", userID, map[string]interface{}{"body": comment.Body, "mentions": mentions})
+}
+
+func (c *Comments) publish(ctx context.Context, comment *domain.Comment, eventType, userID string, data map[string]interface{}) {
+	if c.publisher == nil {
+		return
+	}
+	data["commentId"] = comment.ID
+	data["entityType"] = comment.EntityType
+	data["entityId"] = comment.EntityID
+	event := events.NewEvent(comment.ID, "Comment", eventType, comment.TenantID, userID, data)
+	if err := c.publisher.PublishEvent(ctx, event); err != nil {
+		c.logger.New(ctx).Warnw("Failed to publish comment event", "error", err, "event_type", eventType, "comment_id", comment.ID)
+	}
+}
@@ -0,0 +1,194 @@
+package comments
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	tenantID = uuid.New()
+	ana      = uuid.New()
+	bo       = uuid.New()
+	cy       = uuid.New()
+	outsider = uuid.New()
+)
+
+type fakeStore struct {
+	comments map[string]domain.Comment
+}
+
+func (s *fakeStore) Add(ctx context.Context, comment *domain.Comment) error {
+	s.comments[comment.ID] = *comment
+	return nil
+}
+
+func (s *fakeStore) Get(ctx context.Context, tenantID, id string) (*domain.Comment, error) {
+	comment, ok := s.comments[id]
+	if !ok || comment.TenantID != tenantID {
+		return nil, repository.ErrCommentNotFound
+	}
+	return &comment, nil
+}
+
+func (s *fakeStore) List(ctx context.Context, tenantID, entityType, entityID string, limit int) ([]domain.Comment, error) {
+	var comments []domain.Comment
+	for _, comment := range s.comments {
+		if comment.TenantID == tenantID && comment.EntityType == entityType && comment.EntityID == entityID && !comment.IsDeleted() {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+func (s *fakeStore) Save(ctx context.Context, comment *domain.Comment) error {
+	s.comments[comment.ID] = *comment
+	return nil
+}
+
+type fakeUsers map[string]*domain.User
+
+func (u fakeUsers) FindByID(ctx context.Context, id string) (*domain.User, error) {
+	return u[id], nil
+}
+
+type recordingPublisher struct {
+	events []*events.EventEnvelope
+}
+
+func (p *recordingPublisher) PublishEvent(ctx context.Context, event *events.EventEnvelope) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *recordingPublisher) types() []string {
+	var types []string
+	for _, event := range p.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func newTestComments(t *testing.T) (*Comments, *recordingPublisher) {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "error", Format: "json"})
+	require.NoError(t, err)
+	users := fakeUsers{}
+	for _, id := range []uuid.UUID{ana, bo, cy} {
+		users[id.String()] = &domain.User{ID: id, TenantID: tenantID}
+	}
+	users[outsider.String()] = &domain.User{ID: outsider, TenantID: uuid.New()}
+	publisher := &recordingPublisher{}
+	return newComments(&fakeStore{comments: map[string]domain.Comment{}}, users, publisher, log), publisher
+}
+
+func mention(id uuid.UUID) string {
+	return "@[someone](" + id.String() + ")"
+}
+
+func TestAddNotifiesMentionedUsers(t *testing.T) {
+	comments, publisher := newTestComments(t)
+	ctx := context.Background()
+
+	body := "Please check " + mention(bo) + " " + mention(ana) + " " + mention(outsider) + " " + mention(uuid.New())
+	comment, err := comments.Add(ctx, tenantID.String(), ana.String(), domain.CommentOnInvoice, "inv-1", body)
+	require.NoError(t, err)
+	assert.Equal(t, []string{bo.String()}, comment.Mentions, "the author, other tenants and unknown users are not mentioned")
+
+	assert.Equal(t, []string{"comment.added", "comment.mentioned"}, publisher.types())
+	assert.Equal(t, []string{bo.String()}, publisher.events[1].Data["mentions"])
+	assert.Equal(t, "inv-1", publisher.events[1].Data["entityId"])
+
+	_, err = comments.Add(ctx, tenantID.String(), ana.String(), "payment", "pay-1", "hi")
+	assert.True(t, apperr.Is(err, apperr.CodeInvalidArgument))
+	_, err = comments.Add(ctx, tenantID.String(), ana.String(), domain.CommentOnInvoice, "inv-1", "   ")
+	assert.True(t, apperr.Is(err, apperr.CodeInvalidArgument))
+}
+
+func TestEditKeepsHistoryAndNotifiesNewMentions(t *testing.T) {
+	comments, publisher := newTestComments(t)
+	ctx := context.Background()
+	comment, err := comments.Add(ctx, tenantID.String(), ana.String(), domain.CommentOnOrder, "ord-1", "Ask "+mention(bo))
+	require.NoError(t, err)
+
+	_, err = comments.Edit(ctx, tenantID.String(), bo.String(), comment.ID, "mine now")
+	assert.True(t, apperr.Is(err, apperr.CodeForbidden))
+
+	publisher.events = nil
+	edited, err := comments.Edit(ctx, tenantID.String(), ana.String(), comment.ID, "Ask "+mention(bo)+" and "+mention(cy))
+	require.NoError(t, err)
+	require.Len(t, edited.History, 1)
+	assert.Equal(t, "Ask "+mention(bo), edited.History[0].Body)
+	assert.NotNil(t, edited.EditedAt)
+
+	assert.Equal(t, []string{"comment.edited", "comment.mentioned"}, publisher.types())
+	assert.Equal(t, "Ask "+mention(bo), publisher.events[0].Data["previousBody"])
+	assert.Equal(t, []string{cy.String()}, publisher.events[1].Data["mentions"], "only users mentioned by the edit are notified")
+}
+
+func TestDelete(t *testing.T) {
+	comments, publisher := newTestComments(t)
+	ctx := context.Background()
+	comment, err := comments.Add(ctx, tenantID.String(), ana.String(), domain.CommentOnClient, "client-1", "Call back")
+	require.NoError(t, err)
+
+	err = comments.Delete(ctx, tenantID.String(), bo.String(), comment.ID, []string{"client:read"})
+	assert.True(t, apperr.Is(err, apperr.CodeForbidden))
+
+	require.NoError(t, comments.Delete(ctx, tenantID.String(), bo.String(), comment.ID, []string{ModeratePermission}))
+	assert.Equal(t, "comment.deleted", publisher.events[len(publisher.events)-1].Type)
+
+	listed, err := comments.List(ctx, tenantID.String(), domain.CommentOnClient, "client-1")
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+
+	err = comments.Delete(ctx, tenantID.String(), ana.String(), comment.ID, nil)
+	assert.True(t, apperr.Is(err, apperr.CodeNotFound))
+}
+
+func TestHandler(t *testing.T) {
+	comments, _ := newTestComments(t)
+	handler := comments.Handler("/api/v1/comments")
+
+	serve := func(method, path, body string, userID uuid.UUID, permissions ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(middleware.WithIdentity(req.Context(), tenantID.String(), userID.String(), permissions))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/comments/invoice/inv-1", "", ana, "client:read").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/v1/comments/invoice", "", ana, "*").Code)
+
+	rec := serve(http.MethodPost, "/api/v1/comments/invoice/inv-1", `{"body":"Looks wrong"}`, ana, "invoice:read")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	listed, err := comments.List(context.Background(), tenantID.String(), domain.CommentOnInvoice, "inv-1")
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	id := listed[0].ID
+
+	rec = serve(http.MethodGet, "/api/v1/comments/invoice/inv-1", "", bo, "invoice:*")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Looks wrong")
+
+	// A comment is only reached through the entity it was left on.
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPut, "/api/v1/comments/client/c-1/"+id, `{"body":"x"}`, ana, "client:read").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/v1/comments/invoice/inv-1/"+id, `{"body":"x"}`, bo, "invoice:read").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/v1/comments/invoice/inv-1/"+id, `{"body":"Fixed"}`, ana, "invoice:read").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/v1/comments/invoice/inv-1", `{"body":""}`, ana, "invoice:read").Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/v1/comments/invoice/inv-1/"+id, "", ana, "invoice:read").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPatch, "/api/v1/comments/invoice/inv-1", "", ana, "invoice:read").Code)
+}
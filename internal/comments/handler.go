@@ -0,0 +1,124 @@
+package comments
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/rbac"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// commentRequest is the body of POST and PUT requests.
+type commentRequest struct {
+	Body string `json:"body"`
+}
+
+// Handler serves the comments of entities under prefix, such as
+// /api/v1/comments:
+//
+//	GET    prefix/{entityType}/{entityId}          the entity's comments, oldest first
+//	POST   prefix/{entityType}/{entityId}          comment on the entity: {"body": "..."}
+//	PUT    prefix/{entityType}/{entityId}/{id}     edit one's own comment
+//	DELETE prefix/{entityType}/{entityId}/{id}     delete a comment
+//
+// Every request needs read access to the entity type, such as
+// "invoice:read".
+func (c *Comments) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		entityType, entityID := parts[0], parts[1]
+		ctx := r.Context()
+		tenantID := middleware.GetTenantID(ctx)
+		userID := middleware.GetUserID(ctx)
+		permissions := middleware.GetPermissions(ctx)
+
+		if permission := ReadPermission(entityType); !rbac.Allows(permissions, permission) {
+			httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+permission)
+			return
+		}
+
+		switch {
+		case len(parts) == 2 && r.Method == http.MethodGet:
+			comments, err := c.List(ctx, tenantID, entityType, entityID)
+			if err != nil {
+				c.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": comments})
+
+		case len(parts) == 2 && r.Method == http.MethodPost:
+			var body commentRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&body); err != nil {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			comment, err := c.Add(ctx, tenantID, userID, entityType, entityID, body.Body)
+			if err != nil {
+				c.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusCreated, comment)
+
+		case len(parts) == 3 && r.Method == http.MethodPut:
+			var body commentRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&body); err != nil {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if !c.onEntity(w, r, tenantID, parts) {
+				return
+			}
+			comment, err := c.Edit(ctx, tenantID, userID, parts[2], body.Body)
+			if err != nil {
+				c.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, comment)
+
+		case len(parts) == 3 && r.Method == http.MethodDelete:
+			if !c.onEntity(w, r, tenantID, parts) {
+				return
+			}
+			if err := c.Delete(ctx, tenantID, userID, parts[2], permissions); err != nil {
+				c.writeError(w, r, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
+
+// onEntity checks that the comment in the path belongs to the entity in the
+// path, so read access to one entity type does not reach comments on
+// another.
+func (c *Comments) onEntity(w http.ResponseWriter, r *http.Request, tenantID string, parts []string) bool {
+	comment, err := c.get(r.Context(), tenantID, parts[2])
+	if err == nil && (comment.EntityType != parts[0] || comment.EntityID != parts[1]) {
+		err = apperr.NotFound("comment %s not found", parts[2])
+	}
+	if err != nil {
+		c.writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+func (c *Comments) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *apperr.Error
+	if !errors.As(err, &appErr) {
+		c.logger.New(r.Context()).Errorw("Comment request failed", "error", err)
+	}
+	httpresponse.Error(w, r, err)
+}
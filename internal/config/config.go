@@ -5,20 +5,53 @@ import (
 	"strings"
 	"time"
 
+	"context"
+	"github.com/ims-erp/system/pkg/timezone"
 	"github.com/spf13/viper"
+	"os"
 )
 
 type Config struct {
 	App           AppConfig           `mapstructure:"app"`
 	MongoDB       MongoDBConfig       `mapstructure:"mongodb"`
+	Database      DatabaseConfig      `mapstructure:"database"`
 	Redis         RedisConfig         `mapstructure:"redis"`
 	NATS          NATSConfig          `mapstructure:"nats"`
+	Messaging     MessagingConfig     `mapstructure:"messaging"`
 	MinIO         MinIOConfig         `mapstructure:"minio"`
+	Presign       PresignConfig       `mapstructure:"presign"`
+	StorageQuotas StorageQuotaConfig  `mapstructure:"storage_quotas"`
+	Images        ImageConfig         `mapstructure:"images"`
 	Elasticsearch ElasticsearchConfig `mapstructure:"elasticsearch"`
 	Auth          AuthConfig          `mapstructure:"auth"`
 	Security      SecurityConfig      `mapstructure:"security"`
 	Tracing       TracingConfig       `mapstructure:"tracing"`
 	Logging       LoggingConfig       `mapstructure:"logging"`
+	Gateway       GatewayConfig       `mapstructure:"gateway"`
+	Outbox        OutboxConfig        `mapstructure:"outbox"`
+	Replay        ReplayConfig        `mapstructure:"replay"`
+	Exports       ExportConfig        `mapstructure:"exports"`
+	GraphQL       GraphQLConfig       `mapstructure:"graphql"`
+	AsyncCommands AsyncCommandConfig  `mapstructure:"async_commands"`
+	FeatureFlags  FeatureFlagConfig   `mapstructure:"feature_flags"`
+	Trash         TrashConfig         `mapstructure:"trash"`
+	I18n          I18nConfig          `mapstructure:"i18n"`
+	Intrastat     IntrastatConfig     `mapstructure:"intrastat"`
+	Inventory     InventoryConfig     `mapstructure:"inventory"`
+	Tax           TaxConfig           `mapstructure:"tax"`
+	FX            FXConfig            `mapstructure:"fx"`
+	Returns       ReturnsConfig       `mapstructure:"returns"`
+	Budgets       BudgetsConfig       `mapstructure:"budgets"`
+	Forecasting   ForecastingConfig   `mapstructure:"forecasting"`
+	Approvals     ApprovalConfig      `mapstructure:"approvals"`
+	Backups       BackupConfig        `mapstructure:"backups"`
+	Numbering     NumberingConfig     `mapstructure:"numbering"`
+	Webhooks      WebhookConfig       `mapstructure:"webhooks"`
+	Notifications NotificationConfig  `mapstructure:"notifications"`
+	Scheduler     SchedulerConfig     `mapstructure:"scheduler"`
+	Secrets       SecretsConfig       `mapstructure:"secrets"`
+	Payments      PaymentsConfig      `mapstructure:"payments"`
+	Migrations    MigrationsConfig    `mapstructure:"migrations"`
 }
 
 type AppConfig struct {
@@ -70,26 +103,579 @@ type RedisConfig struct {
 }
 
 type NATSConfig struct {
-	URLs           []string        `mapstructure:"urls"`
-	Username       string          `mapstructure:"username"`
-	Password       string          `mapstructure:"password"`
-	Token          string          `mapstructure:"token"`
-	MaxReconnect   int             `mapstructure:"max_reconnect"`
-	ReconnectWait  time.Duration   `mapstructure:"reconnect_wait"`
-	ConnectTimeout time.Duration   `mapstructure:"connect_timeout"`
-	PingInterval   time.Duration   `mapstructure:"ping_interval"`
-	MaxPingsOut    int             `mapstructure:"max_pings_out"`
-	TLSEnabled     bool            `mapstructure:"tls_enabled"`
-	TLSCertFile    string          `mapstructure:"tls_cert_file"`
-	TLSKeyFile     string          `mapstructure:"tls_key_file"`
-	TLSCACertFile  string          `mapstructure:"tls_ca_cert_file"`
-	JetStream      JetStreamConfig `mapstructure:"jetstream"`
+	URLs           []string         `mapstructure:"urls"`
+	Username       string           `mapstructure:"username"`
+	Password       string           `mapstructure:"password"`
+	Token          string           `mapstructure:"token"`
+	MaxReconnect   int              `mapstructure:"max_reconnect"`
+	ReconnectWait  time.Duration    `mapstructure:"reconnect_wait"`
+	ConnectTimeout time.Duration    `mapstructure:"connect_timeout"`
+	PingInterval   time.Duration    `mapstructure:"ping_interval"`
+	MaxPingsOut    int              `mapstructure:"max_pings_out"`
+	TLSEnabled     bool             `mapstructure:"tls_enabled"`
+	TLSCertFile    string           `mapstructure:"tls_cert_file"`
+	TLSKeyFile     string           `mapstructure:"tls_key_file"`
+	TLSCACertFile  string           `mapstructure:"tls_ca_cert_file"`
+	JetStream      JetStreamConfig  `mapstructure:"jetstream"`
+	DeadLetter     DeadLetterConfig `mapstructure:"dead_letter"`
+	// ProcessedEventTTL is how long consumed event IDs are remembered for
+	// deduplication. It should cover the stream's redelivery window.
+	ProcessedEventTTL time.Duration `mapstructure:"processed_event_ttl"`
 }
 
 type JetStreamConfig struct {
 	Enabled      bool   `mapstructure:"enabled"`
 	Domain       string `mapstructure:"domain"`
 	StreamPrefix string `mapstructure:"stream_prefix"`
+	// MaxConsumerLag is the number of pending messages above which a
+	// consumer's readiness check reports it as degraded.
+	MaxConsumerLag uint64 `mapstructure:"max_consumer_lag"`
+	// StatsInterval is how often consumer pending, ack pending and
+	// redelivery counts are read from the server and exported as metrics.
+	StatsInterval time.Duration `mapstructure:"stats_interval"`
+}
+
+// MessagingConfig selects the transport events and command outcomes travel
+// over. NATS is the default; deployments that mandate Kafka set transport to
+// "kafka". JetStream consumers and their dead letter queue are NATS only.
+type MessagingConfig struct {
+	Transport string      `mapstructure:"transport"`
+	Kafka     KafkaConfig `mapstructure:"kafka"`
+}
+
+type KafkaConfig struct {
+	Brokers  []string `mapstructure:"brokers"`
+	ClientID string   `mapstructure:"client_id"`
+	// TopicPrefix is prepended to topic names: events go to
+	// <prefix>evt.<AggregateType> and command outcomes to <prefix>cmdresult.
+	TopicPrefix string `mapstructure:"topic_prefix"`
+	// SASLMechanism is "", "PLAIN", "SCRAM-SHA-256" or "SCRAM-SHA-512".
+	SASLMechanism string        `mapstructure:"sasl_mechanism"`
+	Username      string        `mapstructure:"username"`
+	Password      string        `mapstructure:"password"`
+	TLSEnabled    bool          `mapstructure:"tls_enabled"`
+	DialTimeout   time.Duration `mapstructure:"dial_timeout"`
+}
+
+// DatabaseConfig selects where a service keeps its aggregates: invoices,
+// payments, the event store (which holds clients) and the outbox. With
+// driver "postgres" those move to PostgreSQL; read models stay in MongoDB.
+type DatabaseConfig struct {
+	Driver   string         `mapstructure:"driver"`
+	Postgres PostgresConfig `mapstructure:"postgres"`
+}
+
+type PostgresConfig struct {
+	DSN             string        `mapstructure:"dsn"`
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnectTimeout  time.Duration `mapstructure:"connect_timeout"`
+}
+
+// OutboxConfig controls the transactional outbox. On MongoDB it requires a
+// replica set, since entries are written in a multi-document transaction.
+type OutboxConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	BatchSize    int           `mapstructure:"batch_size"`
+	LockTimeout  time.Duration `mapstructure:"lock_timeout"`
+	Retention    time.Duration `mapstructure:"retention"`
+}
+
+// ReplayConfig controls the read model replay worker in query services.
+// Shadow rebuilds swap collections in a transaction, so like the outbox they
+// need MongoDB to run as a replica set.
+type ReplayConfig struct {
+	MaxConcurrent int           `mapstructure:"max_concurrent"`
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	ProgressEvery int           `mapstructure:"progress_every"`
+	StaleAfter    time.Duration `mapstructure:"stale_after"`
+	// SwapBatch is how many rebuilt documents are swapped in per write.
+	SwapBatch int `mapstructure:"swap_batch"`
+	// PauseFor bounds how long live projections stay paused for a swap,
+	// so a replayer that dies mid-swap cannot stop them for good.
+	PauseFor time.Duration `mapstructure:"pause_for"`
+}
+
+// GraphQLConfig controls the GraphQL API of client-query-service.
+// PersistedQueries is the allowlist written by the UI build; when set only
+// its queries may run, otherwise clients may send any query and register
+// them as automatic persisted queries.
+type GraphQLConfig struct {
+	PersistedQueries string `mapstructure:"persisted_queries"`
+}
+
+// ExportConfig controls the asynchronous export worker. Files are written to
+// Bucket in MinIO, which defaults to "<minio.bucket_prefix>-exports", and
+// are deleted together with their job Retention after the job finishes.
+// Download links are valid for LinkExpiry.
+type ExportConfig struct {
+	Bucket        string        `mapstructure:"bucket"`
+	MaxConcurrent int           `mapstructure:"max_concurrent"`
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	ProgressEvery int           `mapstructure:"progress_every"`
+	StaleAfter    time.Duration `mapstructure:"stale_after"`
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+	MaxRows       int64         `mapstructure:"max_rows"`
+	LinkExpiry    time.Duration `mapstructure:"link_expiry"`
+	Retention     time.Duration `mapstructure:"retention"`
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+// AsyncCommandConfig controls commands accepted for background handling. A
+// replica handles up to MaxConcurrent of them at once, and all replicas
+// together handle at most TenantConcurrency of one tenant's, so a bulk
+// import cannot starve other tenants; TenantOverrides sets the limit per
+// tenant ID. A tenant may have TenantPending commands waiting before new ones
+// are refused. Results can be polled for Retention after a command finishes.
+type AsyncCommandConfig struct {
+	MaxConcurrent     int            `mapstructure:"max_concurrent"`
+	TenantConcurrency int            `mapstructure:"tenant_concurrency"`
+	TenantOverrides   map[string]int `mapstructure:"tenant_overrides"`
+	TenantPending     int            `mapstructure:"tenant_pending"`
+	PollInterval      time.Duration  `mapstructure:"poll_interval"`
+	StaleAfter        time.Duration  `mapstructure:"stale_after"`
+	Retention         time.Duration  `mapstructure:"retention"`
+}
+
+// ConcurrencyFor returns how many of tenantID's commands may run at once.
+func (c AsyncCommandConfig) ConcurrencyFor(tenantID string) int {
+	if limit, ok := c.TenantOverrides[tenantID]; ok {
+		return limit
+	}
+	return c.TenantConcurrency
+}
+
+// FeatureFlagConfig sets the value of each feature flag for tenants without
+// an override of their own. A service caches a tenant's evaluated flags for
+// CacheTTL; overrides changed through the API evict the cache at once.
+type FeatureFlagConfig struct {
+	Defaults map[string]bool `mapstructure:"defaults"`
+	CacheTTL time.Duration   `mapstructure:"cache_ttl"`
+}
+
+// TrashConfig controls how long soft-deleted aggregates stay restorable
+// before the purge job removes them. TenantRetention overrides Retention per
+// tenant ID; a zero override keeps that tenant's trash forever.
+type TrashConfig struct {
+	Retention       time.Duration            `mapstructure:"retention"`
+	PurgeInterval   time.Duration            `mapstructure:"purge_interval"`
+	TenantRetention map[string]time.Duration `mapstructure:"tenant_retention"`
+}
+
+// RetentionFor returns the trash retention that applies to tenantID.
+func (c TrashConfig) RetentionFor(tenantID string) time.Duration {
+	if retention, ok := c.TenantRetention[tenantID]; ok {
+		return retention
+	}
+	return c.Retention
+}
+
+// I18nConfig sets the locale of generated notifications and documents and
+// the time zone reports count days in. TenantLocales overrides
+// DefaultLocale per tenant ID; a client's own locale beats both.
+// TenantTimeZones overrides TimeZone, an IANA name such as "Europe/Berlin",
+// per tenant ID.
+type I18nConfig struct {
+	DefaultLocale   string            `mapstructure:"default_locale"`
+	TenantLocales   map[string]string `mapstructure:"tenant_locales"`
+	TimeZone        string            `mapstructure:"time_zone"`
+	TenantTimeZones map[string]string `mapstructure:"tenant_time_zones"`
+}
+
+// LocaleFor returns the default locale of tenantID.
+func (c I18nConfig) LocaleFor(tenantID string) string {
+	if locale, ok := c.TenantLocales[tenantID]; ok && locale != "" {
+		return locale
+	}
+	return c.DefaultLocale
+}
+
+// LocationFor returns the time zone of tenantID. Names are checked when the
+// config is loaded, so an unknown one only falls back to UTC in configs
+// built by hand.
+func (c I18nConfig) LocationFor(tenantID string) *time.Location {
+	name := c.TimeZone
+	if zone, ok := c.TenantTimeZones[tenantID]; ok && zone != "" {
+		name = zone
+	}
+	loc, err := timezone.Load(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// InventoryConfig tunes inventory-service. Product stock views are cached
+// for StockCacheTTL; inventory events evict them sooner.
+type InventoryConfig struct {
+	StockCacheTTL time.Duration `mapstructure:"stock_cache_ttl"`
+}
+
+// IntrastatConfig names the declarant of Intrastat reports. Country is the
+// EU member state, as an ISO 3166 alpha-2 code such as "DE", that the
+// tenant's warehouses are in: goods shipped to or received from another
+// member state are declared. Tenants overrides it per tenant ID; a tenant
+// without a country has nothing to declare.
+type IntrastatConfig struct {
+	Country   string                        `mapstructure:"country"`
+	VATNumber string                        `mapstructure:"vat_number"`
+	Tenants   map[string]IntrastatDeclarant `mapstructure:"tenants"`
+}
+
+type IntrastatDeclarant struct {
+	Country   string `mapstructure:"country"`
+	VATNumber string `mapstructure:"vat_number"`
+}
+
+// DeclarantFor returns the declarant of tenantID's reports.
+func (c IntrastatConfig) DeclarantFor(tenantID string) IntrastatDeclarant {
+	if declarant, ok := c.Tenants[tenantID]; ok && declarant.Country != "" {
+		return declarant
+	}
+	return IntrastatDeclarant{Country: c.Country, VATNumber: c.VATNumber}
+}
+
+// TaxConfig sets up VAT returns. Country is where the tenant is registered
+// for VAT, as an ISO 3166 alpha-2 code such as "GB"; a tenant without one
+// has no returns. Returns are filed monthly or quarterly, per Period, and
+// exported by default as Format: csv, or mtd for the JSON body of a UK
+// Making Tax Digital submission, which needs Country GB. A Currency keeps
+// invoices in others out of returns. Codes names the tax code of each rate,
+// given as a decimal string such as "20", for invoice lines that name
+// none. Tenants replaces it all per tenant ID.
+type TaxConfig struct {
+	TaxJurisdiction `mapstructure:",squash"`
+	Tenants         map[string]TaxJurisdiction `mapstructure:"tenants"`
+}
+
+type TaxJurisdiction struct {
+	Country   string            `mapstructure:"country"`
+	VATNumber string            `mapstructure:"vat_number"`
+	Currency  string            `mapstructure:"currency"`
+	Period    string            `mapstructure:"period"`
+	Format    string            `mapstructure:"format"`
+	Codes     map[string]string `mapstructure:"codes"`
+}
+
+// JurisdictionFor returns the VAT registration of tenantID, quarterly and
+// exported as CSV where nothing else is set. MTD returns are in GBP.
+func (c TaxConfig) JurisdictionFor(tenantID string) TaxJurisdiction {
+	jurisdiction := c.TaxJurisdiction
+	if tenant, ok := c.Tenants[tenantID]; ok && tenant.Country != "" {
+		jurisdiction = tenant
+	}
+	if jurisdiction.Period == "" {
+		jurisdiction.Period = "quarterly"
+	}
+	if jurisdiction.Format == "" {
+		jurisdiction.Format = "csv"
+	}
+	if jurisdiction.Format == "mtd" {
+		jurisdiction.Currency = "GBP"
+	}
+	return jurisdiction
+}
+
+func (j TaxJurisdiction) validate() error {
+	if !isCountryCode(j.Country) {
+		return fmt.Errorf("country must be an ISO 3166 alpha-2 code such as GB")
+	}
+	if j.Currency != "" && len(j.Currency) != 3 {
+		return fmt.Errorf("currency must be an ISO 4217 code such as GBP")
+	}
+	switch j.Period {
+	case "", "monthly", "quarterly":
+	default:
+		return fmt.Errorf("period must be monthly or quarterly")
+	}
+	switch j.Format {
+	case "", "csv":
+	case "mtd":
+		if j.Country != "GB" || (j.Currency != "" && j.Currency != "GBP") {
+			return fmt.Errorf("format mtd is for country GB, in GBP")
+		}
+	default:
+		return fmt.Errorf("format must be csv or mtd")
+	}
+	return nil
+}
+
+// FXConfig sets up exchange rates. Daily reference rates are synced from
+// Provider: "ecb" for the European Central Bank's euro rates, "json" for a
+// service at URL answering {"base", "date", "rates"}, or empty to sync none
+// and use only tenants' overrides. APIKey is sent to it as a bearer token.
+// Rates are synced against Base, EUR for ecb, and other pairs are crossed
+// through it.
+// A date without rates of its own, such as a weekend, takes the latest
+// rates up to MaxAge older. Amounts are converted for reporting into
+// ReportingCurrency, which TenantReportingCurrencies replaces per tenant ID.
+type FXConfig struct {
+	Provider                  string            `mapstructure:"provider"`
+	Base                      string            `mapstructure:"base"`
+	URL                       string            `mapstructure:"url"`
+	APIKey                    string            `mapstructure:"api_key"`
+	Timeout                   time.Duration     `mapstructure:"timeout"`
+	MaxAge                    time.Duration     `mapstructure:"max_age"`
+	ReportingCurrency         string            `mapstructure:"reporting_currency"`
+	TenantReportingCurrencies map[string]string `mapstructure:"tenant_reporting_currencies"`
+}
+
+// ReportingCurrencyFor returns the currency tenantID reports in, or "" when
+// its amounts are not converted.
+func (c FXConfig) ReportingCurrencyFor(tenantID string) string {
+	if currency, ok := c.TenantReportingCurrencies[tenantID]; ok && currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return strings.ToUpper(c.ReportingCurrency)
+}
+
+// ReturnsConfig sets when analytics-service raises return rate alerts. A
+// product is alerted on when the units returned on RMAs opened in the
+// trailing AlertWindow exceed AlertThreshold percent of the units shipped
+// in it, once at least MinShipped were. QualityOnly counts only returns for
+// quality reasons. TenantThresholds replaces AlertThreshold per tenant ID.
+// Rates are checked every CheckInterval.
+type ReturnsConfig struct {
+	AlertThreshold   float64            `mapstructure:"alert_threshold"`
+	AlertWindow      time.Duration      `mapstructure:"alert_window"`
+	MinShipped       int                `mapstructure:"min_shipped"`
+	QualityOnly      bool               `mapstructure:"quality_only"`
+	CheckInterval    time.Duration      `mapstructure:"check_interval"`
+	TenantThresholds map[string]float64 `mapstructure:"tenant_thresholds"`
+}
+
+// ThresholdFor returns the return rate, in percent, above which tenantID's
+// products are alerted on.
+func (c ReturnsConfig) ThresholdFor(tenantID string) float64 {
+	if threshold, ok := c.TenantThresholds[tenantID]; ok {
+		return threshold
+	}
+	return c.AlertThreshold
+}
+
+// BudgetsConfig sets when analytics-service raises budget alerts: when the
+// actual expenses of a budgeted category in the current month exceed its
+// budget by more than AlertThreshold percent. Budgets are checked every
+// CheckInterval.
+type BudgetsConfig struct {
+	AlertThreshold float64       `mapstructure:"alert_threshold"`
+	CheckInterval  time.Duration `mapstructure:"check_interval"`
+}
+
+// ForecastingConfig sets how analytics-service suggests purchases. Demand
+// is forecast from the last HistoryMonths of orders with a moving average
+// over Window months, seasonal once two years are known. Products without
+// a lead time take LeadTimeDays, and those without a minimum stock level
+// keep SafetyDays of demand as safety stock. A purchase covers CoverDays of
+// demand after it arrives and is suggested once it must be ordered within
+// HorizonDays. Suggestions are refreshed every CheckInterval.
+type ForecastingConfig struct {
+	HistoryMonths int           `mapstructure:"history_months"`
+	Window        int           `mapstructure:"window"`
+	LeadTimeDays  int           `mapstructure:"lead_time_days"`
+	SafetyDays    int           `mapstructure:"safety_days"`
+	CoverDays     int           `mapstructure:"cover_days"`
+	HorizonDays   int           `mapstructure:"horizon_days"`
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+// ApprovalConfig sets how often approval-service escalates approval steps
+// that waited longer than their workflow allows.
+type ApprovalConfig struct {
+	EscalationInterval time.Duration `mapstructure:"escalation_interval"`
+}
+
+// BackupConfig controls tenant backups taken by audit-service. Archives are
+// kept in Bucket and deleted after Retention; zero keeps them. When Schedule
+// is set, Tenants, or every tenant with users when it is empty, are backed up
+// on it. Download links stay valid for LinkExpiry.
+type BackupConfig struct {
+	Bucket     string        `mapstructure:"bucket"`
+	Schedule   string        `mapstructure:"schedule"`
+	Tenants    []string      `mapstructure:"tenants"`
+	Retention  time.Duration `mapstructure:"retention"`
+	LinkExpiry time.Duration `mapstructure:"link_expiry"`
+}
+
+// NumberingConfig sets how document numbers are formed. Schemes holds the
+// scheme of each document type: order, shipment, rma, purchase_order and
+// sku. Tenants replaces them per tenant ID and document type.
+type NumberingConfig struct {
+	Schemes map[string]NumberingScheme            `mapstructure:"schemes"`
+	Tenants map[string]map[string]NumberingScheme `mapstructure:"tenants"`
+}
+
+// NumberingScheme numbers one document type as Prefix, the channel code
+// when PerChannel is set, the year when YearlyReset is set, and the sequence
+// padded with zeros to Padding digits, joined by dashes: "SO-WEB-2026-000042".
+// YearlyReset starts the sequence over each calendar year in the tenant's
+// time zone, and PerChannel keeps a sequence per sales channel. A channel's
+// code is taken from ChannelCodes, or is the channel upper-cased.
+type NumberingScheme struct {
+	Prefix       string            `mapstructure:"prefix"`
+	Padding      int               `mapstructure:"padding"`
+	YearlyReset  bool              `mapstructure:"yearly_reset"`
+	PerChannel   bool              `mapstructure:"per_channel"`
+	ChannelCodes map[string]string `mapstructure:"channel_codes"`
+}
+
+// SchemeFor returns the scheme tenantID numbers documentType with.
+func (c NumberingConfig) SchemeFor(tenantID, documentType string) NumberingScheme {
+	if scheme, ok := c.Tenants[tenantID][documentType]; ok {
+		return scheme
+	}
+	return c.Schemes[documentType]
+}
+
+// numberedDocuments are the document types numbered from NumberingConfig,
+// with the scheme each has when none is configured.
+var numberedDocuments = map[string]NumberingScheme{
+	"order":          {Prefix: "SO", Padding: 6, YearlyReset: true},
+	"shipment":       {Prefix: "SH", Padding: 6, YearlyReset: true},
+	"delivery_note":  {Prefix: "DN", Padding: 6, YearlyReset: true},
+	"rma":            {Prefix: "RMA", Padding: 6, YearlyReset: true},
+	"purchase_order": {Prefix: "PO", Padding: 6, YearlyReset: true},
+	"sku":            {Prefix: "SKU", Padding: 8},
+}
+
+// WebhookConfig controls outbound webhook delivery in webhook-service.
+// Failed deliveries are retried MaxAttempts times, waiting BackoffBase
+// doubled per attempt up to BackoffMax. Delivery logs are kept for
+// Retention.
+type WebhookConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	BatchSize    int           `mapstructure:"batch_size"`
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	BackoffBase  time.Duration `mapstructure:"backoff_base"`
+	BackoffMax   time.Duration `mapstructure:"backoff_max"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	Retention    time.Duration `mapstructure:"retention"`
+}
+
+// NotificationConfig controls notification-service. Rules decide which
+// events notify whom on which channels; when empty the service's built-in
+// rules apply. A channel without a configured provider is skipped.
+// Notifications, including the in-app inbox, are kept for Retention.
+type NotificationConfig struct {
+	DefaultLocale string              `mapstructure:"default_locale"`
+	Rules         []NotificationRule  `mapstructure:"rules"`
+	Email         EmailProviderConfig `mapstructure:"email"`
+	SMS           SMSProviderConfig   `mapstructure:"sms"`
+	Timeout       time.Duration       `mapstructure:"timeout"`
+	Retention     time.Duration       `mapstructure:"retention"`
+}
+
+// NotificationRule sends EventType to Audience ("client" or "user") on
+// Channels ("email", "sms", "in_app").
+type NotificationRule struct {
+	EventType string   `mapstructure:"event_type"`
+	Audience  string   `mapstructure:"audience"`
+	Channels  []string `mapstructure:"channels"`
+}
+
+// EmailProviderConfig selects the email provider: "smtp" or "sendgrid".
+type EmailProviderConfig struct {
+	Provider       string `mapstructure:"provider"`
+	From           string `mapstructure:"from"`
+	SMTPHost       string `mapstructure:"smtp_host"`
+	SMTPPort       int    `mapstructure:"smtp_port"`
+	SMTPUsername   string `mapstructure:"smtp_username"`
+	SMTPPassword   string `mapstructure:"smtp_password"`
+	SendGridAPIKey string `mapstructure:"sendgrid_api_key"`
+}
+
+// SMSProviderConfig selects the SMS provider: "twilio".
+type SMSProviderConfig struct {
+	Provider         string `mapstructure:"provider"`
+	From             string `mapstructure:"from"`
+	TwilioAccountSID string `mapstructure:"twilio_account_sid"`
+	TwilioAuthToken  string `mapstructure:"twilio_auth_token"`
+}
+
+// SchedulerConfig controls the background job scheduler. Locks is "mongo"
+// or "redis" and decides where the lock that keeps a job from running on two
+// replicas at once is held. Jobs overrides a registered job's settings by
+// job name. Run history is kept for HistoryRetention.
+type SchedulerConfig struct {
+	TickInterval     time.Duration        `mapstructure:"tick_interval"`
+	Locks            string               `mapstructure:"locks"`
+	HistoryRetention time.Duration        `mapstructure:"history_retention"`
+	Jobs             map[string]JobConfig `mapstructure:"jobs"`
+}
+
+// JobConfig overrides a job's schedule (a cron expression, a descriptor such
+// as "@daily" or "@every 10m"), retries and timeout, or disables it.
+type JobConfig struct {
+	Schedule    string        `mapstructure:"schedule"`
+	Disabled    bool          `mapstructure:"disabled"`
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+}
+
+// SecretsConfig selects where "secret:" references in the configuration are
+// resolved: "env" (the default), "file" for a directory of secret files,
+// "vault" or "aws". RefreshInterval re-reads the configuration, and with it
+// every secret, so rotated credentials are picked up without a restart.
+type SecretsConfig struct {
+	Provider        string           `mapstructure:"provider"`
+	Dir             string           `mapstructure:"dir"`
+	RefreshInterval time.Duration    `mapstructure:"refresh_interval"`
+	Vault           VaultConfig      `mapstructure:"vault"`
+	AWS             AWSSecretsConfig `mapstructure:"aws"`
+}
+
+type VaultConfig struct {
+	Address   string `mapstructure:"address"`
+	Token     string `mapstructure:"token"`
+	Mount     string `mapstructure:"mount"`
+	Namespace string `mapstructure:"namespace"`
+}
+
+type AWSSecretsConfig struct {
+	Region          string `mapstructure:"region"`
+	Endpoint        string `mapstructure:"endpoint"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	SessionToken    string `mapstructure:"session_token"`
+}
+
+// MigrationsConfig controls the schema checks services run at startup.
+// IndexCheck is "fail", "warn" or "off" and decides what happens when indexes
+// created by migrations are missing; it defaults to "fail" in production and
+// "warn" elsewhere. AutoMigrate applies pending migrations first.
+type MigrationsConfig struct {
+	AutoMigrate bool   `mapstructure:"auto_migrate"`
+	IndexCheck  string `mapstructure:"index_check"`
+}
+
+// PaymentsConfig holds payment provider credentials. They are normally
+// "secret:" references rather than literal keys.
+type PaymentsConfig struct {
+	Stripe StripeConfig `mapstructure:"stripe"`
+	PayPal PayPalConfig `mapstructure:"paypal"`
+}
+
+type StripeConfig struct {
+	APIKey        string `mapstructure:"api_key"`
+	WebhookSecret string `mapstructure:"webhook_secret"`
+}
+
+type PayPalConfig struct {
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	Mode         string `mapstructure:"mode"`
+}
+
+// DeadLetterConfig controls redelivery of failing JetStream messages and when
+// they are moved to the dead-letter stream.
+type DeadLetterConfig struct {
+	MaxDeliver     int             `mapstructure:"max_deliver"`
+	AckWait        time.Duration   `mapstructure:"ack_wait"`
+	Backoff        []time.Duration `mapstructure:"backoff"`
+	AlertThreshold uint64          `mapstructure:"alert_threshold"`
+	CheckInterval  time.Duration   `mapstructure:"check_interval"`
 }
 
 type MinIOConfig struct {
@@ -103,6 +689,97 @@ type MinIOConfig struct {
 	MaxPartSize  int64  `mapstructure:"max_part_size"`
 }
 
+// PresignConfig sets how long document upload URLs and download links stay
+// valid. TenantUploadExpiry and TenantDownloadExpiry override them per
+// tenant ID.
+type PresignConfig struct {
+	UploadExpiry         time.Duration            `mapstructure:"upload_expiry"`
+	DownloadExpiry       time.Duration            `mapstructure:"download_expiry"`
+	TenantUploadExpiry   map[string]time.Duration `mapstructure:"tenant_upload_expiry"`
+	TenantDownloadExpiry map[string]time.Duration `mapstructure:"tenant_download_expiry"`
+}
+
+// UploadExpiryFor returns how long tenantID's upload URLs stay valid.
+func (c PresignConfig) UploadExpiryFor(tenantID string) time.Duration {
+	if expiry, ok := c.TenantUploadExpiry[tenantID]; ok && expiry > 0 {
+		return expiry
+	}
+	return c.UploadExpiry
+}
+
+// DownloadExpiryFor returns how long tenantID's download links stay valid.
+func (c PresignConfig) DownloadExpiryFor(tenantID string) time.Duration {
+	if expiry, ok := c.TenantDownloadExpiry[tenantID]; ok && expiry > 0 {
+		return expiry
+	}
+	return c.DownloadExpiry
+}
+
+// StorageQuotaConfig limits how much each tenant stores in
+// document-service. MaxBytes and MaxObjects apply to every tenant, zero
+// meaning unlimited, and TenantMaxBytes and TenantMaxObjects override them
+// per tenant ID. Enforcement "reject" refuses uploads that would exceed a
+// quota; "warn" accepts them and reports the overage, for billing to
+// charge. TenantEnforcement overrides it per tenant ID.
+type StorageQuotaConfig struct {
+	MaxBytes          int64             `mapstructure:"max_bytes"`
+	MaxObjects        int64             `mapstructure:"max_objects"`
+	TenantMaxBytes    map[string]int64  `mapstructure:"tenant_max_bytes"`
+	TenantMaxObjects  map[string]int64  `mapstructure:"tenant_max_objects"`
+	Enforcement       string            `mapstructure:"enforcement"`
+	TenantEnforcement map[string]string `mapstructure:"tenant_enforcement"`
+}
+
+// For returns tenantID's byte and object quotas and how they are enforced.
+func (c StorageQuotaConfig) For(tenantID string) (maxBytes, maxObjects int64, enforcement string) {
+	maxBytes, maxObjects, enforcement = c.MaxBytes, c.MaxObjects, c.Enforcement
+	if limit, ok := c.TenantMaxBytes[tenantID]; ok {
+		maxBytes = limit
+	}
+	if limit, ok := c.TenantMaxObjects[tenantID]; ok {
+		maxObjects = limit
+	}
+	if mode, ok := c.TenantEnforcement[tenantID]; ok {
+		enforcement = mode
+	}
+	return maxBytes, maxObjects, enforcement
+}
+
+// ImageConfig sets the renditions document-service renders of each
+// uploaded image: those of use case "product" for product images, those of
+// "document" for any other. Renditions with Watermark are stamped with the
+// PNG image at Watermark, at WatermarkOpacity, and are what download links
+// to images serve.
+type ImageConfig struct {
+	Renditions       []ImageRenditionConfig `mapstructure:"renditions"`
+	Watermark        string                 `mapstructure:"watermark"`
+	WatermarkOpacity float64                `mapstructure:"watermark_opacity"`
+}
+
+// ImageRenditionConfig is a rendition: the image scaled down to fit within
+// Width by Height, zero meaning no limit, and encoded in Format, one of
+// jpeg, png, webp or avif, at Quality.
+type ImageRenditionConfig struct {
+	Name      string `mapstructure:"name"`
+	UseCase   string `mapstructure:"use_case"`
+	Width     int    `mapstructure:"width"`
+	Height    int    `mapstructure:"height"`
+	Format    string `mapstructure:"format"`
+	Quality   int    `mapstructure:"quality"`
+	Watermark bool   `mapstructure:"watermark"`
+}
+
+// RenditionsFor returns the renditions of useCase.
+func (c ImageConfig) RenditionsFor(useCase string) []ImageRenditionConfig {
+	var renditions []ImageRenditionConfig
+	for _, rendition := range c.Renditions {
+		if rendition.UseCase == useCase {
+			renditions = append(renditions, rendition)
+		}
+	}
+	return renditions
+}
+
 type ElasticsearchConfig struct {
 	Addresses     []string      `mapstructure:"addresses"`
 	Username      string        `mapstructure:"username"`
@@ -139,10 +816,69 @@ type SecurityConfig struct {
 	EncryptionAlgorithm string        `mapstructure:"encryption_algorithm"`
 	RateLimitRequests   int           `mapstructure:"rate_limit_requests"`
 	RateLimitWindow     time.Duration `mapstructure:"rate_limit_window"`
-	CORSDomain          []string      `mapstructure:"cors_domain"`
-	AllowedHeaders      []string      `mapstructure:"allowed_headers"`
-	AllowedMethods      []string      `mapstructure:"allowed_methods"`
-	MaxRequestBodySize  int64         `mapstructure:"max_request_body_size"`
+	// CORSDomain lists the browser origins allowed to call the API. Entries
+	// are path.Match patterns, so "https://*.preview.example.com" admits
+	// preview deployments. A bare "*" admits any origin, without
+	// credentials, and only when CORSAllowWildcard is set. Left empty, the
+	// development environment allows the local frontend dev servers and
+	// every other environment allows no origin.
+	CORSDomain        []string `mapstructure:"cors_domain"`
+	CORSAllowWildcard bool     `mapstructure:"cors_allow_wildcard"`
+	// CORSNoCredentials stops browsers from sending cookies with
+	// cross-origin requests.
+	CORSNoCredentials  bool          `mapstructure:"cors_no_credentials"`
+	CORSMaxAge         time.Duration `mapstructure:"cors_max_age"`
+	AllowedHeaders     []string      `mapstructure:"allowed_headers"`
+	AllowedMethods     []string      `mapstructure:"allowed_methods"`
+	MaxRequestBodySize int64         `mapstructure:"max_request_body_size"`
+	// ServiceToken guards internal admin endpoints such as /config/reload.
+	// They are disabled while it is empty.
+	ServiceToken string `mapstructure:"service_token"`
+	// Throttle limits the expensive endpoints of every service.
+	Throttle ThrottleConfig `mapstructure:"throttle"`
+	// PII encrypts personal data such as client emails, phone numbers and
+	// counterparty IBANs before it is written to MongoDB.
+	PII PIIConfig `mapstructure:"pii"`
+	// Masking redacts personal data and amounts from API responses, for
+	// staging tenants holding copies of production data.
+	Masking MaskingConfig `mapstructure:"masking"`
+}
+
+// MaskingConfig turns on masking of the JSON responses of the client,
+// invoice and payment APIs for users without the "pii:unmasked"
+// permission. Fields lists further JSON fields to hide entirely.
+type MaskingConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Fields  []string `mapstructure:"fields"`
+}
+
+// ThrottleConfig limits how often one client IP and one user may call
+// expensive endpoints, such as searches, report generation and exports,
+// within Window. Classes override PerIP and PerUser for one class of
+// endpoint: "search", "report" or "export". A negative limit turns it off.
+type ThrottleConfig struct {
+	Window  time.Duration            `mapstructure:"window"`
+	PerIP   int                      `mapstructure:"per_ip"`
+	PerUser int                      `mapstructure:"per_user"`
+	Classes map[string]ThrottleLimit `mapstructure:"classes"`
+}
+
+type ThrottleLimit struct {
+	PerIP   int `mapstructure:"per_ip"`
+	PerUser int `mapstructure:"per_user"`
+}
+
+// LimitFor returns the limits of class. Limits a class leaves at 0 are the
+// defaults.
+func (c ThrottleConfig) LimitFor(class string) ThrottleLimit {
+	limit := c.Classes[class]
+	if limit.PerIP == 0 {
+		limit.PerIP = c.PerIP
+	}
+	if limit.PerUser == 0 {
+		limit.PerUser = c.PerUser
+	}
+	return limit
 }
 
 type TracingConfig struct {
@@ -164,7 +900,78 @@ type LoggingConfig struct {
 	Caller     bool   `mapstructure:"caller"`
 }
 
+type GatewayConfig struct {
+	Versioning VersioningConfig `mapstructure:"versioning"`
+	AccessLog  AccessLogConfig  `mapstructure:"access_log"`
+	BodyLimits BodyLimitsConfig `mapstructure:"body_limits"`
+	Schemas    []SchemaConfig   `mapstructure:"schemas"`
+}
+
+// BodyLimitsConfig caps request body sizes per path prefix. DefaultMaxBytes
+// falls back to security.max_request_body_size.
+type BodyLimitsConfig struct {
+	DefaultMaxBytes int64            `mapstructure:"default_max_bytes"`
+	Routes          []RouteBodyLimit `mapstructure:"routes"`
+}
+
+type RouteBodyLimit struct {
+	Prefix   string `mapstructure:"prefix"`
+	MaxBytes int64  `mapstructure:"max_bytes"`
+}
+
+// SchemaConfig binds a JSON schema file to a method and path prefix.
+type SchemaConfig struct {
+	Method string `mapstructure:"method"`
+	Prefix string `mapstructure:"prefix"`
+	File   string `mapstructure:"file"`
+}
+
+// AccessLogConfig controls gateway access logging. Successful requests are
+// sampled at SampleRate; errors and slow requests are always logged.
+type AccessLogConfig struct {
+	Disabled      bool          `mapstructure:"disabled"`
+	SampleRate    float64       `mapstructure:"sample_rate"`
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+}
+
+type VersioningConfig struct {
+	Routes []VersionRouteConfig `mapstructure:"routes"`
+}
+
+// VersionRouteConfig maps a versioned path prefix (e.g. /api/v2/clients) onto
+// an existing service route, rewriting the path and transforming JSON bodies.
+// Field rules are lists rather than maps because viper lower-cases map keys.
+type VersionRouteConfig struct {
+	Prefix          string         `mapstructure:"prefix"`
+	Route           string         `mapstructure:"route"`
+	Rewrite         string         `mapstructure:"rewrite"`
+	RequestRenames  []FieldRename  `mapstructure:"request_renames"`
+	RequestDefaults []FieldDefault `mapstructure:"request_defaults"`
+	ResponseRenames []FieldRename  `mapstructure:"response_renames"`
+}
+
+type FieldRename struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+}
+
+type FieldDefault struct {
+	Field string      `mapstructure:"field"`
+	Value interface{} `mapstructure:"value"`
+}
+
+// Load reads the configuration once. Services that pick up tunables without a
+// restart use NewManager instead.
 func Load(configPath string, configName string) (*Config, error) {
+	cfg, err := read(configPath, configName)
+	if err != nil {
+		return nil, err
+	}
+	cfg.validate()
+	return cfg, nil
+}
+
+func newViper(configPath string, configName string) *viper.Viper {
 	v := viper.New()
 
 	if configPath != "" {
@@ -181,7 +988,49 @@ func Load(configPath string, configName string) (*Config, error) {
 	v.SetEnvPrefix("ERP")
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
+	// Every service validates access tokens, but most service configs do not
+	// list the auth section, so bind the shared secret explicitly.
+	v.BindEnv("auth.jwt_secret")
+	v.BindEnv("auth.jwt_issuer")
+	v.BindEnv("security.service_token")
+	// Allowed origins differ per deployment, e.g. ERP_SECURITY_CORS_DOMAIN=
+	// "https://erp.example.com,https://*.preview.example.com".
+	v.BindEnv("security.cors_domain")
+	// Credentials and the secrets backend are rarely in the YAML files
+	// either; they are set per environment.
+	for _, key := range []string{
+		"mongodb.password",
+		"redis.password",
+		"nats.password",
+		"nats.token",
+		"minio.access_key",
+		"minio.secret_key",
+		"secrets.provider",
+		"secrets.dir",
+		"secrets.refresh_interval",
+		"secrets.vault.address",
+		"secrets.vault.token",
+		"secrets.vault.mount",
+		"secrets.aws.region",
+		"secrets.aws.endpoint",
+		"payments.stripe.api_key",
+		"payments.stripe.webhook_secret",
+		"payments.paypal.client_id",
+		"payments.paypal.client_secret",
+		"payments.paypal.mode",
+		"security.pii.enabled",
+		"security.pii.active_key",
+		"security.masking.enabled",
+		"migrations.auto_migrate",
+		"migrations.index_check",
+	} {
+		v.BindEnv(key)
+	}
+	return v
+}
 
+func read(configPath string, configName string) (*Config, error) {
+	v := newViper(configPath, configName)
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -194,8 +1043,9 @@ func Load(configPath string, configName string) (*Config, error) {
 	}
 
 	cfg.applyDefaults()
-	cfg.validate()
-
+	if err := cfg.resolveSecrets(context.Background()); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
@@ -239,6 +1089,54 @@ func (c *Config) applyDefaults() {
 	if c.NATS.ReconnectWait == 0 {
 		c.NATS.ReconnectWait = 2 * time.Second
 	}
+	if c.NATS.DeadLetter.MaxDeliver == 0 {
+		c.NATS.DeadLetter.MaxDeliver = 5
+	}
+	if c.NATS.DeadLetter.AckWait == 0 {
+		c.NATS.DeadLetter.AckWait = 30 * time.Second
+	}
+	if len(c.NATS.DeadLetter.Backoff) == 0 {
+		c.NATS.DeadLetter.Backoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+	}
+	if c.NATS.DeadLetter.AlertThreshold == 0 {
+		c.NATS.DeadLetter.AlertThreshold = 100
+	}
+	if c.NATS.DeadLetter.CheckInterval == 0 {
+		c.NATS.DeadLetter.CheckInterval = time.Minute
+	}
+	if c.NATS.ProcessedEventTTL == 0 {
+		c.NATS.ProcessedEventTTL = 7 * 24 * time.Hour
+	}
+	if c.NATS.JetStream.MaxConsumerLag == 0 {
+		c.NATS.JetStream.MaxConsumerLag = 10000
+	}
+	if c.NATS.JetStream.StatsInterval == 0 {
+		c.NATS.JetStream.StatsInterval = 15 * time.Second
+	}
+	if c.Database.Driver == "" {
+		c.Database.Driver = "mongodb"
+	}
+	if c.Database.Postgres.MaxOpenConns == 0 {
+		c.Database.Postgres.MaxOpenConns = 20
+	}
+	if c.Database.Postgres.MaxIdleConns == 0 {
+		c.Database.Postgres.MaxIdleConns = 5
+	}
+	if c.Database.Postgres.ConnMaxLifetime == 0 {
+		c.Database.Postgres.ConnMaxLifetime = 30 * time.Minute
+	}
+	if c.Database.Postgres.ConnectTimeout == 0 {
+		c.Database.Postgres.ConnectTimeout = 10 * time.Second
+	}
+	if c.Messaging.Transport == "" {
+		c.Messaging.Transport = "nats"
+	}
+	if c.Messaging.Kafka.ClientID == "" {
+		c.Messaging.Kafka.ClientID = c.App.Name
+	}
+	if c.Messaging.Kafka.DialTimeout == 0 {
+		c.Messaging.Kafka.DialTimeout = 10 * time.Second
+	}
 	if c.Auth.AccessTokenExpiry == 0 {
 		c.Auth.AccessTokenExpiry = 15 * time.Minute
 	}
@@ -260,9 +1158,302 @@ func (c *Config) applyDefaults() {
 	if c.Security.RateLimitWindow == 0 {
 		c.Security.RateLimitWindow = time.Minute
 	}
+	if c.Security.Throttle.Window == 0 {
+		c.Security.Throttle.Window = time.Minute
+	}
+	if c.Security.Throttle.PerIP == 0 {
+		c.Security.Throttle.PerIP = 120
+	}
+	if c.Security.Throttle.PerUser == 0 {
+		c.Security.Throttle.PerUser = 60
+	}
 	if c.Tracing.SamplerRatio == 0 {
 		c.Tracing.SamplerRatio = 1.0
 	}
+	if len(c.Security.CORSDomain) == 0 && (c.App.Environment == "" || c.App.Environment == "development") {
+		c.Security.CORSDomain = []string{"http://localhost:*", "http://127.0.0.1:*"}
+	}
+	if len(c.Security.AllowedMethods) == 0 {
+		c.Security.AllowedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	}
+	if len(c.Security.AllowedHeaders) == 0 {
+		c.Security.AllowedHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Request-ID", "If-Match",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"}
+	}
+	if c.Security.CORSMaxAge == 0 {
+		c.Security.CORSMaxAge = 24 * time.Hour
+	}
+	if c.Security.MaxRequestBodySize == 0 {
+		c.Security.MaxRequestBodySize = 10 * 1024 * 1024
+	}
+	if c.Gateway.BodyLimits.DefaultMaxBytes == 0 {
+		c.Gateway.BodyLimits.DefaultMaxBytes = c.Security.MaxRequestBodySize
+	}
+	if c.Gateway.AccessLog.SampleRate == 0 {
+		c.Gateway.AccessLog.SampleRate = 1.0
+	}
+	if c.Gateway.AccessLog.SlowThreshold == 0 {
+		c.Gateway.AccessLog.SlowThreshold = time.Second
+	}
+	if c.Outbox.PollInterval == 0 {
+		c.Outbox.PollInterval = time.Second
+	}
+	if c.Outbox.BatchSize == 0 {
+		c.Outbox.BatchSize = 100
+	}
+	if c.Outbox.LockTimeout == 0 {
+		c.Outbox.LockTimeout = 30 * time.Second
+	}
+	if c.Outbox.Retention == 0 {
+		c.Outbox.Retention = 7 * 24 * time.Hour
+	}
+	if c.Replay.MaxConcurrent == 0 {
+		c.Replay.MaxConcurrent = 2
+	}
+	if c.Replay.PollInterval == 0 {
+		c.Replay.PollInterval = 5 * time.Second
+	}
+	if c.Replay.ProgressEvery == 0 {
+		c.Replay.ProgressEvery = 500
+	}
+	if c.Replay.StaleAfter == 0 {
+		c.Replay.StaleAfter = 2 * time.Minute
+	}
+	if c.Replay.SwapBatch == 0 {
+		c.Replay.SwapBatch = 500
+	}
+	if c.Replay.PauseFor == 0 {
+		c.Replay.PauseFor = 5 * time.Minute
+	}
+	if c.Presign.UploadExpiry == 0 {
+		c.Presign.UploadExpiry = time.Hour
+	}
+	if c.Presign.DownloadExpiry == 0 {
+		c.Presign.DownloadExpiry = 15 * time.Minute
+	}
+	if c.StorageQuotas.Enforcement == "" {
+		c.StorageQuotas.Enforcement = "reject"
+	}
+	if c.Images.Renditions == nil {
+		c.Images.Renditions = []ImageRenditionConfig{
+			{Name: "thumbnail", UseCase: "document", Width: 200, Height: 200, Format: "webp"},
+			{Name: "preview", UseCase: "document", Width: 1280, Height: 1280, Format: "webp"},
+			{Name: "shared", UseCase: "document", Width: 1600, Height: 1600, Format: "jpeg", Watermark: true},
+			{Name: "thumbnail", UseCase: "product", Width: 200, Height: 200, Format: "webp"},
+			{Name: "listing", UseCase: "product", Width: 600, Height: 600, Format: "webp"},
+			{Name: "detail", UseCase: "product", Width: 1600, Height: 1600, Format: "avif"},
+			{Name: "shared", UseCase: "product", Width: 1200, Height: 1200, Format: "jpeg", Watermark: true},
+		}
+	}
+	if c.Images.WatermarkOpacity == 0 {
+		c.Images.WatermarkOpacity = 0.4
+	}
+	if c.Exports.Bucket == "" {
+		c.Exports.Bucket = "exports"
+		if c.MinIO.BucketPrefix != "" {
+			c.Exports.Bucket = c.MinIO.BucketPrefix + "-exports"
+		}
+	}
+	if c.Exports.MaxConcurrent == 0 {
+		c.Exports.MaxConcurrent = 2
+	}
+	if c.Exports.PollInterval == 0 {
+		c.Exports.PollInterval = 2 * time.Second
+	}
+	if c.Exports.ProgressEvery == 0 {
+		c.Exports.ProgressEvery = 1000
+	}
+	if c.Exports.StaleAfter == 0 {
+		c.Exports.StaleAfter = 2 * time.Minute
+	}
+	if c.Exports.MaxAttempts == 0 {
+		c.Exports.MaxAttempts = 3
+	}
+	if c.Exports.MaxRows == 0 {
+		c.Exports.MaxRows = 1000000
+	}
+	if c.Exports.LinkExpiry == 0 {
+		c.Exports.LinkExpiry = 15 * time.Minute
+	}
+	if c.Exports.Retention == 0 {
+		c.Exports.Retention = 24 * time.Hour
+	}
+	if c.Exports.PurgeInterval == 0 {
+		c.Exports.PurgeInterval = time.Hour
+	}
+	if c.AsyncCommands.MaxConcurrent == 0 {
+		c.AsyncCommands.MaxConcurrent = 8
+	}
+	if c.AsyncCommands.TenantConcurrency == 0 {
+		c.AsyncCommands.TenantConcurrency = 2
+	}
+	if c.AsyncCommands.TenantPending == 0 {
+		c.AsyncCommands.TenantPending = 1000
+	}
+	if c.AsyncCommands.PollInterval == 0 {
+		c.AsyncCommands.PollInterval = 500 * time.Millisecond
+	}
+	if c.AsyncCommands.StaleAfter == 0 {
+		c.AsyncCommands.StaleAfter = 2 * time.Minute
+	}
+	if c.AsyncCommands.Retention == 0 {
+		c.AsyncCommands.Retention = 24 * time.Hour
+	}
+	if c.FeatureFlags.CacheTTL == 0 {
+		c.FeatureFlags.CacheTTL = time.Minute
+	}
+	if c.Trash.Retention == 0 {
+		c.Trash.Retention = 30 * 24 * time.Hour
+	}
+	if c.Trash.PurgeInterval == 0 {
+		c.Trash.PurgeInterval = time.Hour
+	}
+	if c.Webhooks.PollInterval == 0 {
+		c.Webhooks.PollInterval = 2 * time.Second
+	}
+	if c.Webhooks.BatchSize == 0 {
+		c.Webhooks.BatchSize = 50
+	}
+	if c.Webhooks.MaxAttempts == 0 {
+		c.Webhooks.MaxAttempts = 8
+	}
+	if c.Webhooks.BackoffBase == 0 {
+		c.Webhooks.BackoffBase = 30 * time.Second
+	}
+	if c.Webhooks.BackoffMax == 0 {
+		c.Webhooks.BackoffMax = time.Hour
+	}
+	if c.Webhooks.Timeout == 0 {
+		c.Webhooks.Timeout = 10 * time.Second
+	}
+	if c.Webhooks.Retention == 0 {
+		c.Webhooks.Retention = 30 * 24 * time.Hour
+	}
+	if c.I18n.DefaultLocale == "" {
+		c.I18n.DefaultLocale = "en"
+	}
+	if c.I18n.TimeZone == "" {
+		c.I18n.TimeZone = "UTC"
+	}
+	if c.Notifications.DefaultLocale == "" {
+		c.Notifications.DefaultLocale = c.I18n.DefaultLocale
+	}
+	if c.Notifications.Timeout == 0 {
+		c.Notifications.Timeout = 10 * time.Second
+	}
+	if c.Notifications.Retention == 0 {
+		c.Notifications.Retention = 90 * 24 * time.Hour
+	}
+	if c.Notifications.Email.SMTPPort == 0 {
+		c.Notifications.Email.SMTPPort = 587
+	}
+	if c.Scheduler.TickInterval == 0 {
+		c.Scheduler.TickInterval = time.Second
+	}
+	if c.Scheduler.Locks == "" {
+		c.Scheduler.Locks = "mongo"
+	}
+	if c.Scheduler.HistoryRetention == 0 {
+		c.Scheduler.HistoryRetention = 30 * 24 * time.Hour
+	}
+	if c.Secrets.Provider == "" {
+		c.Secrets.Provider = "env"
+	}
+	if c.Secrets.Dir == "" {
+		c.Secrets.Dir = "/run/secrets"
+	}
+	if c.Secrets.Vault.Address == "" {
+		c.Secrets.Vault.Address = os.Getenv("VAULT_ADDR")
+	}
+	if c.Secrets.Vault.Token == "" {
+		c.Secrets.Vault.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if c.Secrets.AWS.Region == "" {
+		c.Secrets.AWS.Region = os.Getenv("AWS_REGION")
+	}
+	if c.Secrets.AWS.AccessKeyID == "" {
+		c.Secrets.AWS.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		c.Secrets.AWS.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		c.Secrets.AWS.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if c.Migrations.IndexCheck == "" {
+		c.Migrations.IndexCheck = "warn"
+		if c.App.Environment == "production" {
+			c.Migrations.IndexCheck = "fail"
+		}
+	}
+	if c.Payments.PayPal.Mode == "" {
+		c.Payments.PayPal.Mode = "sandbox"
+	}
+	if c.Returns.AlertThreshold == 0 {
+		c.Returns.AlertThreshold = 5
+	}
+	if c.Returns.AlertWindow == 0 {
+		c.Returns.AlertWindow = 30 * 24 * time.Hour
+	}
+	if c.Returns.MinShipped == 0 {
+		c.Returns.MinShipped = 20
+	}
+	if c.Returns.CheckInterval == 0 {
+		c.Returns.CheckInterval = time.Hour
+	}
+	if c.Budgets.CheckInterval == 0 {
+		c.Budgets.CheckInterval = time.Hour
+	}
+	if c.Forecasting.HistoryMonths == 0 {
+		c.Forecasting.HistoryMonths = 24
+	}
+	if c.Forecasting.Window == 0 {
+		c.Forecasting.Window = 3
+	}
+	if c.Forecasting.LeadTimeDays == 0 {
+		c.Forecasting.LeadTimeDays = 14
+	}
+	if c.Forecasting.SafetyDays == 0 {
+		c.Forecasting.SafetyDays = 7
+	}
+	if c.Forecasting.CoverDays == 0 {
+		c.Forecasting.CoverDays = 30
+	}
+	if c.Forecasting.HorizonDays == 0 {
+		c.Forecasting.HorizonDays = 14
+	}
+	if c.Forecasting.CheckInterval == 0 {
+		c.Forecasting.CheckInterval = 24 * time.Hour
+	}
+	if c.Inventory.StockCacheTTL == 0 {
+		c.Inventory.StockCacheTTL = 30 * time.Second
+	}
+	if c.Approvals.EscalationInterval == 0 {
+		c.Approvals.EscalationInterval = 5 * time.Minute
+	}
+	if c.Backups.Bucket == "" {
+		c.Backups.Bucket = "tenant-backups"
+		if c.MinIO.BucketPrefix != "" {
+			c.Backups.Bucket = c.MinIO.BucketPrefix + "-tenant-backups"
+		}
+	}
+	if c.Backups.LinkExpiry == 0 {
+		c.Backups.LinkExpiry = 15 * time.Minute
+	}
+	if c.FX.Base == "" {
+		c.FX.Base = "EUR"
+	}
+	c.FX.Base = strings.ToUpper(c.FX.Base)
+	if c.FX.Timeout == 0 {
+		c.FX.Timeout = 30 * time.Second
+	}
+	if c.FX.MaxAge == 0 {
+		c.FX.MaxAge = 7 * 24 * time.Hour
+	}
+	if c.Numbering.Schemes == nil {
+		c.Numbering.Schemes = make(map[string]NumberingScheme)
+	}
+	for documentType, scheme := range numberedDocuments {
+		if _, ok := c.Numbering.Schemes[documentType]; !ok {
+			c.Numbering.Schemes[documentType] = scheme
+		}
+	}
 	if c.Logging.Level == "" {
 		c.Logging.Level = "info"
 	}
@@ -281,12 +1472,137 @@ func (c *Config) validate() error {
 	if c.MongoDB.Database == "" {
 		return fmt.Errorf("mongodb.database is required")
 	}
-	if len(c.NATS.URLs) == 0 {
-		return fmt.Errorf("nats.urls is required")
+	switch c.Database.Driver {
+	case "mongodb":
+	case "postgres":
+		if c.Database.Postgres.DSN == "" {
+			return fmt.Errorf("database.postgres.dsn is required")
+		}
+	default:
+		return fmt.Errorf("database.driver must be mongodb or postgres")
+	}
+	switch c.Messaging.Transport {
+	case "nats":
+		if len(c.NATS.URLs) == 0 {
+			return fmt.Errorf("nats.urls is required")
+		}
+	case "kafka":
+		if len(c.Messaging.Kafka.Brokers) == 0 {
+			return fmt.Errorf("messaging.kafka.brokers is required")
+		}
+		switch c.Messaging.Kafka.SASLMechanism {
+		case "", "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		default:
+			return fmt.Errorf("messaging.kafka.sasl_mechanism must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512")
+		}
+	default:
+		return fmt.Errorf("messaging.transport must be nats or kafka")
+	}
+	if _, err := timezone.Load(c.I18n.TimeZone); err != nil {
+		return fmt.Errorf("i18n.time_zone: %w", err)
+	}
+	for tenantID, zone := range c.I18n.TenantTimeZones {
+		if _, err := timezone.Load(zone); err != nil {
+			return fmt.Errorf("i18n.tenant_time_zones[%s]: %w", tenantID, err)
+		}
+	}
+	if !isCountryCode(c.Intrastat.Country) {
+		return fmt.Errorf("intrastat.country must be an ISO 3166 alpha-2 code such as DE")
+	}
+	for tenantID, declarant := range c.Intrastat.Tenants {
+		if !isCountryCode(declarant.Country) {
+			return fmt.Errorf("intrastat.tenants[%s].country must be an ISO 3166 alpha-2 code such as DE", tenantID)
+		}
+	}
+	if err := c.Tax.validate(); err != nil {
+		return fmt.Errorf("tax.%w", err)
+	}
+	for tenantID, jurisdiction := range c.Tax.Tenants {
+		if err := jurisdiction.validate(); err != nil {
+			return fmt.Errorf("tax.tenants[%s].%w", tenantID, err)
+		}
+	}
+	switch c.FX.Provider {
+	case "":
+	case "ecb":
+		if c.FX.Base != "EUR" {
+			return fmt.Errorf("fx.base must be EUR for provider ecb")
+		}
+	case "json":
+		if c.FX.URL == "" {
+			return fmt.Errorf("fx.url is required for provider json")
+		}
+	default:
+		return fmt.Errorf("fx.provider must be ecb or json")
+	}
+	if len(c.FX.Base) != 3 {
+		return fmt.Errorf("fx.base must be an ISO 4217 code such as EUR")
+	}
+	if c.FX.ReportingCurrency != "" && len(c.FX.ReportingCurrency) != 3 {
+		return fmt.Errorf("fx.reporting_currency must be an ISO 4217 code such as EUR")
+	}
+	for tenantID, currency := range c.FX.TenantReportingCurrencies {
+		if currency != "" && len(currency) != 3 {
+			return fmt.Errorf("fx.tenant_reporting_currencies[%s] must be an ISO 4217 code such as EUR", tenantID)
+		}
+	}
+	if c.Returns.AlertThreshold < 0 || c.Returns.AlertThreshold > 100 {
+		return fmt.Errorf("returns.alert_threshold must be a percentage between 0 and 100")
+	}
+	for tenantID, threshold := range c.Returns.TenantThresholds {
+		if threshold < 0 || threshold > 100 {
+			return fmt.Errorf("returns.tenant_thresholds[%s] must be a percentage between 0 and 100", tenantID)
+		}
+	}
+	if c.Budgets.AlertThreshold < 0 {
+		return fmt.Errorf("budgets.alert_threshold must be a percentage of 0 or more")
+	}
+	if c.Forecasting.HistoryMonths < 0 || c.Forecasting.Window < 0 || c.Forecasting.HorizonDays < 0 {
+		return fmt.Errorf("forecasting.history_months, window and horizon_days must not be negative")
+	}
+	for documentType, scheme := range c.Numbering.Schemes {
+		if err := validateNumberingScheme(documentType, scheme); err != nil {
+			return fmt.Errorf("numbering.schemes.%w", err)
+		}
+	}
+	for tenantID, schemes := range c.Numbering.Tenants {
+		for documentType, scheme := range schemes {
+			if err := validateNumberingScheme(documentType, scheme); err != nil {
+				return fmt.Errorf("numbering.tenants[%s].%w", tenantID, err)
+			}
+		}
+	}
+	for tenantID, limit := range c.AsyncCommands.TenantOverrides {
+		if limit < 1 {
+			return fmt.Errorf("async_commands.tenant_overrides[%s] must be at least 1", tenantID)
+		}
+	}
+	return nil
+}
+
+// validateNumberingScheme checks the scheme of documentType. The padding is
+// capped at 18 digits, all a sequence can have.
+func validateNumberingScheme(documentType string, scheme NumberingScheme) error {
+	if _, ok := numberedDocuments[documentType]; !ok {
+		return fmt.Errorf("%s is not a numbered document type", documentType)
+	}
+	if scheme.Padding < 0 || scheme.Padding > 18 {
+		return fmt.Errorf("%s.padding must be between 0 and 18", documentType)
+	}
+	if strings.ContainsAny(scheme.Prefix, " \t\n") {
+		return fmt.Errorf("%s.prefix must not contain spaces", documentType)
 	}
 	return nil
 }
 
+// isCountryCode reports whether code is empty or two upper-case letters.
+func isCountryCode(code string) bool {
+	if code == "" {
+		return true
+	}
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
 func (c *Config) GetMongoURI() string {
 	if c.MongoDB.Username != "" && c.MongoDB.Password != "" {
 		return fmt.Sprintf("mongodb://%s:%s@%s/%s?authSource=%s",
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// Manager holds the current configuration and reloads it when the config
+// file changes or an operator calls /config/reload. Only tunables such as
+// CORS origins, rate limits or access log sampling should be read through
+// Current or OnChange; connection settings, ports and secrets used to build
+// clients at startup still need a restart.
+type Manager struct {
+	configPath string
+	configName string
+
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	listeners []func(*Config)
+	reloaded  time.Time
+}
+
+func NewManager(configPath string, configName string) (*Manager, error) {
+	cfg, err := read(configPath, configName)
+	if err != nil {
+		return nil, err
+	}
+	cfg.validate()
+
+	m := &Manager{configPath: configPath, configName: configName, reloaded: time.Now()}
+	m.current.Store(cfg)
+	return m, nil
+}
+
+// Current returns the configuration in effect. The returned value must not be
+// modified; a reload replaces it rather than updating it in place.
+func (m *Manager) Current() *Config {
+	return m.current.Load()
+}
+
+// OnChange registers fn to be called with the new configuration after every
+// successful reload.
+func (m *Manager) OnChange(fn func(*Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Reload reads the configuration again and, if it is valid, makes it current
+// and notifies the OnChange listeners. An invalid configuration is rejected
+// and the previous one stays in effect.
+func (m *Manager) Reload() error {
+	cfg, err := read(m.configPath, m.configName)
+	if err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current.Store(cfg)
+	m.reloaded = time.Now()
+	for _, fn := range m.listeners {
+		fn(cfg)
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever the config file is written and,
+// when secrets.refresh_interval is set, periodically so rotated secrets are
+// picked up.
+func (m *Manager) Watch(log *logger.Logger) {
+	if interval := m.Current().Secrets.RefreshInterval; interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				if err := m.Reload(); err != nil {
+					log.Error("Failed to refresh config secrets", "error", err)
+				}
+			}
+		}()
+	}
+
+	v := newViper(m.configPath, m.configName)
+	if err := v.ReadInConfig(); err != nil || v.ConfigFileUsed() == "" {
+		return
+	}
+	v.OnConfigChange(func(e fsnotify.Event) {
+		if err := m.Reload(); err != nil {
+			log.Error("Failed to reload config", "file", e.Name, "error", err)
+			return
+		}
+		log.Info("Config reloaded", "file", e.Name)
+	})
+	v.WatchConfig()
+}
+
+// ReloadHandler serves POST /config/reload. Callers authenticate with the
+// X-Service-Token header, which must match security.service_token; the
+// endpoint is disabled while no token is configured.
+func (m *Manager) ReloadHandler(log *logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			httpresponse.ErrorStatus(w, req, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		token := m.Current().Security.ServiceToken
+		if token == "" {
+			httpresponse.ErrorStatus(w, req, http.StatusForbidden, "config reload is disabled")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("X-Service-Token")), []byte(token)) != 1 {
+			httpresponse.ErrorStatus(w, req, http.StatusUnauthorized, "invalid service token")
+			return
+		}
+
+		if err := m.Reload(); err != nil {
+			log.Error("Failed to reload config", "error", err)
+			httpresponse.ErrorStatus(w, req, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		m.mu.Lock()
+		reloaded := m.reloaded
+		m.mu.Unlock()
+		log.Info("Config reloaded on request", "remote_addr", req.RemoteAddr)
+		httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"status": "reloaded", "reloadedAt": reloaded.UTC()})
+	})
+}
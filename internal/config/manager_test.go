@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfig writes a minimal valid service config with the given access
+// log sample rate and service token.
+func writeConfig(t *testing.T, path string, sampleRate float64, serviceToken string) {
+	t.Helper()
+	data := "app:\n  name: \"api-gateway\"\n" +
+		"mongodb:\n  uri: \"mongodb://localhost:27017\"\n  database: \"erp_system\"\n" +
+		"nats:\n  urls:\n    - \"localhost:4222\"\n" +
+		"security:\n  service_token: \"" + serviceToken + "\"\n" +
+		"gateway:\n  access_log:\n    sample_rate: " + jsonNumber(sampleRate) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+}
+
+func jsonNumber(f float64) string {
+	data, _ := json.Marshal(f)
+	return string(data)
+}
+
+func newTestManager(t *testing.T, serviceToken string) (*Manager, string) {
+	path := filepath.Join(t.TempDir(), "api-gateway.yaml")
+	writeConfig(t, path, 0.5, serviceToken)
+	m, err := NewManager(path, "")
+	require.NoError(t, err)
+	return m, path
+}
+
+func TestManager_Reload(t *testing.T) {
+	m, path := newTestManager(t, "s3cret")
+	initial := m.Current()
+	assert.Equal(t, 0.5, initial.Gateway.AccessLog.SampleRate)
+
+	var notified atomic.Pointer[Config]
+	m.OnChange(func(cfg *Config) { notified.Store(cfg) })
+
+	writeConfig(t, path, 0.1, "s3cret")
+	require.NoError(t, m.Reload())
+	assert.Equal(t, 0.1, m.Current().Gateway.AccessLog.SampleRate)
+	assert.Same(t, m.Current(), notified.Load(), "listeners receive the new configuration")
+	assert.Equal(t, 0.5, initial.Gateway.AccessLog.SampleRate, "a reload replaces the configuration rather than updating it")
+
+	require.NoError(t, os.WriteFile(path, []byte("app:\n  name: \"\"\n"), 0o600))
+	assert.ErrorContains(t, m.Reload(), "app.name is required")
+	assert.Equal(t, 0.1, m.Current().Gateway.AccessLog.SampleRate, "an invalid configuration leaves the previous one in effect")
+	assert.Same(t, m.Current(), notified.Load(), "listeners are not told about rejected configurations")
+}
+
+func TestManager_Watch(t *testing.T) {
+	m, path := newTestManager(t, "s3cret")
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	m.Watch(log)
+
+	writeConfig(t, path, 0.25, "s3cret")
+	assert.Eventually(t, func() bool {
+		return m.Current().Gateway.AccessLog.SampleRate == 0.25
+	}, 5*time.Second, 20*time.Millisecond, "writing the config file reloads it")
+}
+
+func TestManager_ReloadHandler(t *testing.T) {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	m, path := newTestManager(t, "s3cret")
+	handler := m.ReloadHandler(log)
+	request := func(method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/config/reload", nil)
+		if token != "" {
+			req.Header.Set("X-Service-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "s3cret").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "guess").Code)
+
+	writeConfig(t, path, 0.75, "s3cret")
+	rec := request(http.MethodPost, "s3cret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"reloaded"`)
+	assert.Equal(t, 0.75, m.Current().Gateway.AccessLog.SampleRate)
+
+	require.NoError(t, os.WriteFile(path, []byte("app:\n  name: \"\"\nsecurity:\n  service_token: \"s3cret\"\n"), 0o600))
+	assert.Equal(t, http.StatusUnprocessableEntity, request(http.MethodPost, "s3cret").Code)
+	assert.Equal(t, 0.75, m.Current().Gateway.AccessLog.SampleRate)
+
+	disabled, _ := newTestManager(t, "")
+	rec = httptest.NewRecorder()
+	disabled.ReloadHandler(log).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code, "the endpoint is off without a service token")
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/ims-erp/system/pkg/fieldcrypt"
+)
+
+// PIIConfig configures field-level encryption of personal data. Keys are
+// base64-encoded 32-byte AES keys, usually "secret:" references resolved
+// through the secrets provider. New values are sealed with ActiveKey; the
+// other keys are kept to open values sealed before a rotation. HashKey keys
+// the blind indexes that encrypted fields are looked up by, and must not
+// change once data is stored.
+type PIIConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	ActiveKey string   `mapstructure:"active_key"`
+	Keys      []PIIKey `mapstructure:"keys"`
+	HashKey   string   `mapstructure:"hash_key"`
+}
+
+type PIIKey struct {
+	ID  string `mapstructure:"id"`
+	Key string `mapstructure:"key"`
+}
+
+// Keyring returns the keyring described by c, or nil when encryption is
+// disabled.
+func (c PIIConfig) Keyring() (*fieldcrypt.Keyring, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	keys := make(map[string][]byte, len(c.Keys))
+	for _, k := range c.Keys {
+		key, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("security.pii key %s is not base64: %w", k.ID, err)
+		}
+		keys[k.ID] = key
+	}
+	hashKey, err := base64.StdEncoding.DecodeString(c.HashKey)
+	if err != nil {
+		return nil, fmt.Errorf("security.pii.hash_key is not base64: %w", err)
+	}
+	keyring, err := fieldcrypt.NewKeyring(keys, c.ActiveKey, hashKey)
+	if err != nil {
+		return nil, fmt.Errorf("security.pii: %w", err)
+	}
+	return keyring, nil
+}
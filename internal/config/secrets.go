@@ -0,0 +1,95 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/secrets"
+)
+
+// SecretPrefix marks a config value that names a secret instead of holding
+// it, e.g. `password: "secret:nats#password"`.
+const SecretPrefix = "secret:"
+
+// NewSecretsProvider returns the provider selected by cfg.Provider.
+func NewSecretsProvider(cfg SecretsConfig) (secrets.Provider, error) {
+	switch cfg.Provider {
+	case "env":
+		return secrets.EnvProvider{}, nil
+	case "file":
+		return secrets.FileProvider{Dir: cfg.Dir}, nil
+	case "vault":
+		if cfg.Vault.Address == "" || cfg.Vault.Token == "" {
+			return nil, fmt.Errorf("secrets.vault.address and secrets.vault.token are required")
+		}
+		return secrets.NewVaultProvider(cfg.Vault.Address, cfg.Vault.Token, cfg.Vault.Mount, cfg.Vault.Namespace), nil
+	case "aws":
+		if cfg.AWS.Region == "" || cfg.AWS.AccessKeyID == "" {
+			return nil, fmt.Errorf("secrets.aws.region and AWS credentials are required")
+		}
+		return secrets.NewAWSProvider(cfg.AWS.Region, cfg.AWS.Endpoint, cfg.AWS.AccessKeyID, cfg.AWS.SecretAccessKey, cfg.AWS.SessionToken), nil
+	}
+	return nil, fmt.Errorf("unknown secrets.provider %q", cfg.Provider)
+}
+
+// resolveSecrets replaces every "secret:" string in the configuration with
+// the secret's value and registers the value for log redaction. The provider
+// is only created when a reference is found.
+func (c *Config) resolveSecrets(ctx context.Context) error {
+	var provider secrets.Provider
+	return walkStrings(reflect.ValueOf(c).Elem(), "", func(path string, value reflect.Value) error {
+		ref, ok := strings.CutPrefix(value.String(), SecretPrefix)
+		if !ok {
+			return nil
+		}
+		if provider == nil {
+			p, err := NewSecretsProvider(c.Secrets)
+			if err != nil {
+				return fmt.Errorf("failed to configure secrets provider: %w", err)
+			}
+			provider = p
+		}
+		secret, err := secrets.Resolve(ctx, provider, ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		logger.RegisterSecret(secret)
+		value.SetString(secret)
+		return nil
+	})
+}
+
+// walkStrings calls fn for every settable string in v, including strings in
+// slices. Map values are not addressable and are skipped.
+func walkStrings(v reflect.Value, path string, fn func(path string, value reflect.Value) error) error {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			return fn(path, v)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			name := t.Field(i).Tag.Get("mapstructure")
+			if name == "" {
+				name = t.Field(i).Name
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			if err := walkStrings(v.Field(i), name, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package doctemplate
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/pdf"
+	"github.com/shopspring/decimal"
+)
+
+const quoteBody = `# Quote {{order.number}}
+Dear {{client.name}},
+{{#order.lines}}- {{quantity}} x {{name}} at {{unitPrice}} = {{total}} {{order.currency}}
+{{/order.lines}}Total: {{order.total}}
+{{#order.notes}}Notes: {{order.notes}}
+{{/order.notes}}`
+
+func TestParse_Fields(t *testing.T) {
+	tmpl, err := Parse(quoteBody)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []string{
+		"order.number", "client.name", "order.lines", "order.lines.quantity", "order.lines.name",
+		"order.lines.unitPrice", "order.lines.total", "order.currency", "order.total", "order.notes",
+	}
+	if got := tmpl.Fields(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Fields = %v, want %v", got, want)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, body := range []string{
+		"Dear {{client.name",
+		"{{#order.lines}}{{name}}",
+		"{{/order.lines}}",
+		"{{#order.lines}}{{/order.notes}}",
+		"{{client name}}",
+		"{{}}",
+	} {
+		if _, err := Parse(body); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Parse(%q) = %v, want ErrSyntax", body, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tmpl, err := Parse("{{client.name}} {{invoice.number}} {{client.fax}}")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	err = tmpl.Check(Catalog(domain.EntityOrder))
+	if !errors.Is(err, ErrSyntax) || !strings.Contains(err.Error(), "client.fax, invoice.number") {
+		t.Errorf("Check = %v, want unknown client.fax, invoice.number", err)
+	}
+	if err := tmpl.Check(append(Catalog(domain.EntityInvoice), "client.fax")); err != nil {
+		t.Errorf("Check = %v, want nil", err)
+	}
+}
+
+func TestRender_Order(t *testing.T) {
+	tmpl, err := Parse(quoteBody)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	order := &domain.Order{
+		OrderNumber: "SO-1001",
+		Currency:    "EUR",
+		Total:       decimal.RequireFromString("30"),
+		Lines: []domain.OrderLine{
+			{Name: "Widget", Quantity: 2, UnitPrice: decimal.RequireFromString("10"), RowTotal: decimal.RequireFromString("20")},
+			{Name: "Gadget", Quantity: 1, UnitPrice: decimal.RequireFromString("10"), RowTotal: decimal.RequireFromString("10")},
+		},
+	}
+	client := &events.ClientDetail{Name: "Acme Ltd"}
+	values := Merge(map[string]Values{
+		domain.EntityClient: ClientValues(client),
+		domain.EntityOrder:  OrderValues(order),
+	}, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC))
+
+	want := `# Quote SO-1001
+Dear Acme Ltd,
+- 2 x Widget at 10.00 = 20.00 EUR
+- 1 x Gadget at 10.00 = 10.00 EUR
+Total: 30.00
+`
+	if got := tmpl.Render(values); got != want {
+		t.Errorf("Render =\n%s\nwant\n%s", got, want)
+	}
+
+	order.Notes = "Delivery within 5 days"
+	if got := tmpl.Render(Merge(map[string]Values{domain.EntityOrder: OrderValues(order)}, time.Now())); !strings.HasSuffix(got, "Notes: Delivery within 5 days\n") {
+		t.Errorf("Render with notes = %q", got)
+	}
+}
+
+func TestRender_Shipment(t *testing.T) {
+	tmpl, err := Parse(`# Delivery note {{shipment.deliveryNoteNumber}}
+Order {{order.number}}, {{shipment.carrier}} {{shipment.trackingNumber}}
+Ship to: {{shipment.shipTo.street}}, {{shipment.shipTo.city}}
+{{#shipment.lines}}{{quantity}} | {{sku}} {{name}} | {{lotNumber}} | {{serialNumbers}}
+{{/shipment.lines}}`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := tmpl.Check(Catalog(domain.EntityShipment)); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	widget, gadget := uuid.New(), uuid.New()
+	order := &domain.Order{
+		OrderNumber:     "SO-1001",
+		ShippingAddress: &domain.Address{Street: "1 Main St", City: "Springfield"},
+		Lines: []domain.OrderLine{
+			{ID: widget, SKU: "W-1", Name: "Widget", Quantity: 5},
+			{ID: gadget, SKU: "G-1", Name: "Gadget", Quantity: 2},
+		},
+	}
+	shipment := &domain.OrderFulfillment{
+		Carrier:            "DHL",
+		TrackingNumber:     "JD0001",
+		DeliveryNoteNumber: "DN-2026-000007",
+		Lines: []domain.FulfillmentLine{
+			{OrderLineID: widget, Quantity: 3, LotNumber: "L42"},
+			{OrderLineID: gadget, Quantity: 2, SerialNumbers: []string{"SN1", "SN2"}},
+		},
+	}
+	values := Merge(map[string]Values{
+		domain.EntityOrder:    OrderValues(order),
+		domain.EntityShipment: ShipmentValues(order, shipment),
+	}, time.Now())
+
+	want := `# Delivery note DN-2026-000007
+Order SO-1001, DHL JD0001
+Ship to: 1 Main St, Springfield
+3 | W-1 Widget | L42 | 
+2 | G-1 Gadget |  | SN1, SN2
+`
+	if got := tmpl.Render(values); got != want {
+		t.Errorf("Render =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	client := strings.Join(Catalog(domain.EntityClient), ",")
+	if strings.Contains(client, "order.") || !strings.Contains(client, "client.address.city") {
+		t.Errorf("Catalog(client) = %s", client)
+	}
+	invoice := strings.Join(Catalog(domain.EntityInvoice), ",")
+	if !strings.Contains(invoice, "client.name") || !strings.Contains(invoice, "invoice.lines.taxRate") || !strings.HasPrefix(invoice, "today,") {
+		t.Errorf("Catalog(invoice) = %s", invoice)
+	}
+	shipment := strings.Join(Catalog(domain.EntityShipment), ",")
+	if !strings.Contains(shipment, "order.number") || !strings.Contains(shipment, "shipment.lines.lotNumber") || !strings.Contains(shipment, "shipment.shipTo.city") {
+		t.Errorf("Catalog(shipment) = %s", shipment)
+	}
+}
+
+func TestPDF(t *testing.T) {
+	text := "# Contract\n\n" + strings.Repeat("The supplier shall deliver the goods as agreed. ", 400)
+	data, err := PDF(text)
+	if err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.Contains(data, []byte("(Contract)")) {
+		t.Error("PDF does not contain the heading")
+	}
+	if bytes.Count(data, []byte("/Type /Page /Parent")) < 2 {
+		t.Error("long text did not flow onto a second page")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	lines := wrap(strings.Repeat("word ", 100), bodySize, 200)
+	if len(lines) < 2 {
+		t.Fatalf("wrap returned %d lines", len(lines))
+	}
+	for _, line := range lines {
+		if w := pdf.Width(line, bodySize); w > 200 {
+			t.Errorf("line %q is %.1f wide", line, w)
+		}
+	}
+	if got := wrap("", bodySize, 200); len(got) != 1 || got[0] != "" {
+		t.Errorf("wrap(\"\") = %q", got)
+	}
+}
+
+func TestDOCX(t *testing.T) {
+	data, err := DOCX("Quote <SO-1001>", "# Quote\nTerms & conditions")
+	if err != nil {
+		t.Fatalf("DOCX: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(content)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "docProps/core.xml", "word/document.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(parts["word/document.xml"], "Terms &amp; conditions") || !strings.Contains(parts["word/document.xml"], "<w:b/>") {
+		t.Errorf("document.xml = %s", parts["word/document.xml"])
+	}
+	if !strings.Contains(parts["docProps/core.xml"], "Quote &lt;SO-1001&gt;") {
+		t.Errorf("core.xml = %s", parts["docProps/core.xml"])
+	}
+}
@@ -0,0 +1,223 @@
+package doctemplate
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/shopspring/decimal"
+)
+
+const dateLayout = "2006-01-02"
+
+var addressFields = []string{"street", "city", "state", "postalCode", "country"}
+
+// catalog lists the merge fields of each entity; sections are lists whose
+// item fields follow them.
+var catalog = map[string][]string{
+	domain.EntityClient: withAddress([]string{
+		"client.name", "client.email", "client.phone", "client.status",
+	}, "client.address"),
+	domain.EntityOrder: withAddress(withAddress([]string{
+		"order.number", "order.date", "order.status", "order.currency",
+		"order.subtotal", "order.discount", "order.tax", "order.shipping", "order.total", "order.amountDue",
+		"order.shippingMethod", "order.trackingNumber", "order.notes", "order.terms",
+		"order.lines", "order.lines.sku", "order.lines.name", "order.lines.description",
+		"order.lines.quantity", "order.lines.unitPrice", "order.lines.taxRate", "order.lines.total",
+	}, "order.billingAddress"), "order.shippingAddress"),
+	domain.EntityInvoice: {
+		"invoice.number", "invoice.type", "invoice.status", "invoice.issueDate", "invoice.dueDate",
+		"invoice.currency", "invoice.subtotal", "invoice.discount", "invoice.tax", "invoice.total",
+		"invoice.amountPaid", "invoice.amountDue", "invoice.paymentTerm", "invoice.notes", "invoice.terms",
+		"invoice.lines", "invoice.lines.description", "invoice.lines.quantity", "invoice.lines.unitPrice",
+		"invoice.lines.discount", "invoice.lines.taxRate", "invoice.lines.total",
+	},
+	domain.EntityShipment: withAddress([]string{
+		"shipment.deliveryNoteNumber", "shipment.status", "shipment.shippedDate",
+		"shipment.carrier", "shipment.method", "shipment.trackingNumber",
+		"shipment.lines", "shipment.lines.sku", "shipment.lines.name", "shipment.lines.description",
+		"shipment.lines.quantity", "shipment.lines.lotNumber", "shipment.lines.serialNumbers",
+	}, "shipment.shipTo"),
+}
+
+func withAddress(fields []string, prefix string) []string {
+	for _, field := range addressFields {
+		fields = append(fields, prefix+"."+field)
+	}
+	return fields
+}
+
+// Catalog returns the merge fields templates about entity may use: its
+// own, those of its client for orders, invoices and shipments, those of
+// the order for shipments, and today's date.
+func Catalog(entity string) []string {
+	fields := []string{"today"}
+	if entity != domain.EntityClient {
+		fields = append(fields, catalog[domain.EntityClient]...)
+	}
+	if entity == domain.EntityShipment {
+		fields = append(fields, catalog[domain.EntityOrder]...)
+	}
+	return append(fields, catalog[entity]...)
+}
+
+// ClientValues returns the merge field values of a client.
+func ClientValues(client *events.ClientDetail) Values {
+	return Values{
+		"name":    client.Name,
+		"email":   client.Email,
+		"phone":   client.Phone,
+		"status":  client.Status,
+		"address": addressValues(&client.BillingAddress),
+	}
+}
+
+// OrderValues returns the merge field values of an order.
+func OrderValues(order *domain.Order) Values {
+	lines := make([]Values, len(order.Lines))
+	for i, line := range order.Lines {
+		lines[i] = Values{
+			"sku":         line.SKU,
+			"name":        line.Name,
+			"description": line.Description,
+			"quantity":    strconv.Itoa(line.Quantity),
+			"unitPrice":   amount(line.UnitPrice),
+			"taxRate":     line.TaxRate.String(),
+			"total":       amount(line.RowTotal),
+		}
+	}
+	return Values{
+		"number":          order.OrderNumber,
+		"date":            order.CreatedAt.Format(dateLayout),
+		"status":          string(order.Status),
+		"currency":        order.Currency,
+		"subtotal":        amount(order.Subtotal),
+		"discount":        amount(order.DiscountTotal),
+		"tax":             amount(order.TaxTotal),
+		"shipping":        amount(order.ShippingTotal),
+		"total":           amount(order.Total),
+		"amountDue":       amount(order.AmountDue),
+		"shippingMethod":  order.ShippingMethod,
+		"trackingNumber":  order.TrackingNumber,
+		"notes":           order.Notes,
+		"terms":           order.Terms,
+		"lines":           lines,
+		"billingAddress":  addressValues(order.BillingAddress),
+		"shippingAddress": addressValues(order.ShippingAddress),
+	}
+}
+
+// ShipmentValues returns the merge field values of one of order's
+// shipments: the order lines it ships with the quantity shipped and their
+// lot and serial numbers, and the order's shipping address.
+func ShipmentValues(order *domain.Order, shipment *domain.OrderFulfillment) Values {
+	lines := make([]Values, len(shipment.Lines))
+	for i, shipped := range shipment.Lines {
+		line := order.FindLine(shipped.OrderLineID)
+		if line == nil {
+			line = &domain.OrderLine{}
+		}
+		lines[i] = Values{
+			"sku":           line.SKU,
+			"name":          line.Name,
+			"description":   line.Description,
+			"quantity":      strconv.Itoa(shipped.Quantity),
+			"lotNumber":     shipped.LotNumber,
+			"serialNumbers": strings.Join(shipped.SerialNumbers, ", "),
+		}
+	}
+	var shippedDate string
+	if shipment.ShippedDate != nil {
+		shippedDate = date(*shipment.ShippedDate)
+	}
+	return Values{
+		"deliveryNoteNumber": shipment.DeliveryNoteNumber,
+		"status":             string(shipment.Status),
+		"shippedDate":        shippedDate,
+		"carrier":            shipment.Carrier,
+		"method":             shipment.Method,
+		"trackingNumber":     shipment.TrackingNumber,
+		"lines":              lines,
+		"shipTo":             addressValues(order.ShippingAddress),
+	}
+}
+
+// InvoiceValues returns the merge field values of an invoice.
+func InvoiceValues(invoice *events.InvoiceDetail) Values {
+	lines := make([]Values, len(invoice.Lines))
+	for i, line := range invoice.Lines {
+		lines[i] = Values{
+			"description": line.Description,
+			"quantity":    line.Quantity,
+			"unitPrice":   line.UnitPrice,
+			"discount":    line.Discount,
+			"taxRate":     line.TaxRate,
+			"total":       line.Total,
+		}
+	}
+	return Values{
+		"number":      invoice.InvoiceNumber,
+		"type":        invoice.Type,
+		"status":      invoice.Status,
+		"issueDate":   date(invoice.IssueDate),
+		"dueDate":     date(invoice.DueDate),
+		"currency":    invoice.Currency,
+		"subtotal":    invoice.Subtotal,
+		"discount":    invoice.DiscountTotal,
+		"tax":         invoice.TaxTotal,
+		"total":       invoice.Total,
+		"amountPaid":  invoice.AmountPaid,
+		"amountDue":   invoice.AmountDue,
+		"paymentTerm": invoice.PaymentTerm,
+		"notes":       invoice.Notes,
+		"terms":       invoice.Terms,
+		"lines":       lines,
+	}
+}
+
+// Merge returns the values of a document: each entity's under its name,
+// and today's date.
+func Merge(entities map[string]Values, today time.Time) Values {
+	values := Values{"today": today.Format(dateLayout)}
+	for entity, entityValues := range entities {
+		values[entity] = entityValues
+	}
+	return values
+}
+
+func addressValues(address *domain.Address) Values {
+	if address == nil {
+		address = &domain.Address{}
+	}
+	return Values{
+		"street":     address.Street,
+		"city":       address.City,
+		"state":      address.State,
+		"postalCode": address.PostalCode,
+		"country":    address.Country,
+	}
+}
+
+func amount(value decimal.Decimal) string {
+	return value.StringFixed(2)
+}
+
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+// Title returns the first heading or line of rendered text, for the
+// document's title.
+func Title(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(line, "# ")); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,213 @@
+// Package doctemplate generates documents from templates with merge
+// fields bound to ERP entities: it parses template bodies, fills them with
+// the values of a client, order or invoice, and writes the result as PDF
+// or DOCX.
+//
+// A body is text with merge fields such as {{client.name}}. A section,
+// {{#order.lines}}...{{/order.lines}}, is repeated for each item of a
+// list, whose fields are named within it without the list's prefix, as
+// {{quantity}}; over a single value it is kept only when the value is not
+// empty. Lines starting with "# " are headings.
+package doctemplate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrSyntax is returned for bodies whose merge fields or sections are not
+// well formed.
+var ErrSyntax = errors.New("doctemplate: invalid template")
+
+// Values are the merge field values of a document: strings, nested Values,
+// and lists of Values for sections.
+type Values map[string]interface{}
+
+// Template is a parsed template body.
+type Template struct {
+	nodes  []node
+	fields []string
+}
+
+type node struct {
+	text     string
+	field    string
+	section  string
+	children []node
+}
+
+// Parse parses a template body.
+func Parse(body string) (*Template, error) {
+	t := &Template{}
+	seen := make(map[string]bool)
+	type frame struct {
+		section string
+		path    string
+		nodes   []node
+	}
+	stack := []frame{{}}
+	for rest := body; rest != ""; {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			stack[len(stack)-1].nodes = append(stack[len(stack)-1].nodes, node{text: rest})
+			break
+		}
+		if start > 0 {
+			stack[len(stack)-1].nodes = append(stack[len(stack)-1].nodes, node{text: rest[:start]})
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("%w: {{ without }} on line %d", ErrSyntax, line(body, rest[start:]))
+		}
+		tag := strings.TrimSpace(rest[start+2 : start+end])
+		at := rest[start:]
+		rest = rest[start+end+2:]
+
+		parent := stack[len(stack)-1].path
+		switch {
+		case strings.HasPrefix(tag, "#"):
+			name := strings.TrimSpace(tag[1:])
+			if !isFieldName(name) {
+				return nil, fmt.Errorf("%w: section %q on line %d", ErrSyntax, tag, line(body, at))
+			}
+			path := qualify(parent, name)
+			record(t, seen, path)
+			stack = append(stack, frame{section: name, path: path})
+		case strings.HasPrefix(tag, "/"):
+			name := strings.TrimSpace(tag[1:])
+			if len(stack) == 1 || stack[len(stack)-1].section != name {
+				return nil, fmt.Errorf("%w: {{/%s}} closes no open section on line %d", ErrSyntax, name, line(body, at))
+			}
+			closed := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1].nodes = append(stack[len(stack)-1].nodes, node{section: closed.section, children: closed.nodes})
+		default:
+			if !isFieldName(tag) {
+				return nil, fmt.Errorf("%w: merge field %q on line %d", ErrSyntax, tag, line(body, at))
+			}
+			record(t, seen, qualify(parent, tag))
+			stack[len(stack)-1].nodes = append(stack[len(stack)-1].nodes, node{field: tag})
+		}
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("%w: section {{#%s}} is not closed", ErrSyntax, stack[len(stack)-1].section)
+	}
+	t.nodes = stack[0].nodes
+	return t, nil
+}
+
+// qualify returns the full name of a field within the section at path:
+// names without a dot are the section items' own fields, others are full
+// names already.
+func qualify(path, name string) string {
+	if path == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return path + "." + name
+}
+
+func record(t *Template, seen map[string]bool, field string) {
+	if !seen[field] {
+		seen[field] = true
+		t.fields = append(t.fields, field)
+	}
+}
+
+// Fields returns the full names of the merge fields and sections the
+// template uses, in the order they appear.
+func (t *Template) Fields() []string {
+	return append([]string{}, t.fields...)
+}
+
+// Check returns an error naming the template's fields that are not in
+// known.
+func (t *Template) Check(known []string) error {
+	allowed := make(map[string]bool, len(known))
+	for _, field := range known {
+		allowed[field] = true
+	}
+	var unknown []string
+	for _, field := range t.fields {
+		if !allowed[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: unknown merge fields %s", ErrSyntax, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Render fills the template with values. Fields without a value are left
+// empty.
+func (t *Template) Render(values Values) string {
+	var b strings.Builder
+	render(&b, t.nodes, []Values{values})
+	return b.String()
+}
+
+// render writes nodes, looking fields up in scopes from the innermost
+// section out.
+func render(b *strings.Builder, nodes []node, scopes []Values) {
+	for _, n := range nodes {
+		switch {
+		case n.section != "":
+			switch value := lookup(scopes, n.section).(type) {
+			case []Values:
+				for _, item := range value {
+					render(b, n.children, append(scopes, item))
+				}
+			case nil:
+			default:
+				if text, ok := value.(string); !ok || text != "" {
+					render(b, n.children, scopes)
+				}
+			}
+		case n.field != "":
+			if text, ok := lookup(scopes, n.field).(string); ok {
+				b.WriteString(text)
+			}
+		default:
+			b.WriteString(n.text)
+		}
+	}
+}
+
+func lookup(scopes []Values, field string) interface{} {
+	path := strings.Split(field, ".")
+	for i := len(scopes) - 1; i >= 0; i-- {
+		var value interface{} = scopes[i]
+		for _, name := range path {
+			values, ok := value.(Values)
+			if !ok {
+				value = nil
+				break
+			}
+			value = values[name]
+		}
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+func isFieldName(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// line returns the line number of rest, a suffix of body.
+func line(body, rest string) int {
+	return strings.Count(body[:len(body)-len(rest)], "\n") + 1
+}
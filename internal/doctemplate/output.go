@@ -0,0 +1,164 @@
+package doctemplate
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/pkg/pdf"
+)
+
+// MIME types of generated documents.
+const (
+	MimePDF  = "application/pdf"
+	MimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+)
+
+// Layout of generated PDFs, in points.
+const (
+	marginLeft   = 50.0
+	marginRight  = pdf.PageWidth - 50
+	marginTop    = pdf.PageHeight - 50
+	marginBottom = 50.0
+	bodySize     = 10.0
+	headingSize  = 16.0
+)
+
+// PDF lays out rendered text on A4 pages, wrapping long lines and setting
+// "# " lines as headings.
+func PDF(text string) ([]byte, error) {
+	doc := pdf.New()
+	page := doc.AddPage()
+	y := marginTop
+	for _, raw := range strings.Split(text, "\n") {
+		size, bold := bodySize, false
+		if heading, ok := headingText(raw); ok {
+			raw, size, bold = heading, headingSize, true
+		}
+		lines := wrap(raw, size, marginRight-marginLeft)
+		for i, line := range lines {
+			if i == 0 && bold {
+				y -= size / 2
+			}
+			if y-size*1.4 < marginBottom {
+				page = doc.AddPage()
+				y = marginTop
+			}
+			y -= size * 1.4
+			page.Text(marginLeft, y, size, bold, line)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// wrap breaks text into lines at most width wide, breaking between words
+// and fitting words too wide for a line on their own. An empty line is
+// kept, for paragraph spacing.
+func wrap(text string, size, width float64) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	current := ""
+	for _, word := range words {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if pdf.Width(candidate, size) <= width {
+			current = candidate
+			continue
+		}
+		if current != "" {
+			lines = append(lines, current)
+		}
+		current = pdf.Fit(word, size, width)
+	}
+	return append(lines, current)
+}
+
+func headingText(line string) (string, bool) {
+	if strings.HasPrefix(line, "# ") {
+		return strings.TrimSpace(line[2:]), true
+	}
+	return line, false
+}
+
+// DOCX writes rendered text as a Word document, one paragraph per line
+// and "# " lines as headings, with title as its document title.
+func DOCX(title, text string) ([]byte, error) {
+	var body bytes.Buffer
+	for _, line := range strings.Split(text, "\n") {
+		heading, ok := headingText(line)
+		body.WriteString("<w:p>")
+		if ok {
+			body.WriteString(`<w:pPr><w:spacing w:before="240" w:after="120"/></w:pPr><w:r><w:rPr><w:b/><w:sz w:val="32"/></w:rPr>`)
+		} else {
+			body.WriteString("<w:r>")
+		}
+		body.WriteString(`<w:t xml:space="preserve">`)
+		xml.EscapeText(&body, []byte(heading))
+		body.WriteString("</w:t></w:r></w:p>")
+	}
+
+	var escapedTitle bytes.Buffer
+	xml.EscapeText(&escapedTitle, []byte(title))
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", relsXML},
+		{"docProps/core.xml", strings.NewReplacer(
+			"{{title}}", escapedTitle.String(),
+			"{{created}}", time.Now().UTC().Format(time.RFC3339),
+		).Replace(coreXML)},
+		{"word/document.xml", strings.Replace(documentXML, "{{body}}", body.String(), 1)},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const contentTypesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>`
+
+const relsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`
+
+const coreXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>{{title}}</dc:title>
+<dcterms:created xsi:type="dcterms:W3CDTF">{{created}}</dcterms:created>
+</cp:coreProperties>`
+
+const documentXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>{{body}}<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1134" w:right="1134" w:bottom="1134" w:left="1134" w:header="709" w:footer="709" w:gutter="0"/></w:sectPr></w:body>
+</w:document>`
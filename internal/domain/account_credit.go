@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// AccountCredit returns what of the payment is its client's account
+// credit: the amount of a completed payment applied to no invoice, as when
+// the client paid more than the invoice was for, and not refunded.
+func (p *Payment) AccountCredit() decimal.Decimal {
+	if p.Status != PaymentStatusCompleted {
+		return decimal.Zero
+	}
+	return p.Unapplied()
+}
+
+// RefundCredit records amount of the payment's account credit as refunded
+// to the client.
+func (p *Payment) RefundCredit(amount decimal.Decimal, at time.Time) error {
+	if !amount.IsPositive() || amount.GreaterThan(p.AccountCredit()) {
+		return ErrCreditRefundExceedsCredit
+	}
+	p.AmountRefunded = p.AmountRefunded.Add(amount)
+	p.UpdatedAt = at
+	return nil
+}
+
+// CreditDraw is an amount of account credit taken from one payment.
+type CreditDraw struct {
+	Payment *Payment
+	Amount  decimal.Decimal
+}
+
+// AccountCreditBalance returns the account credit of a client's payments
+// in currency.
+func AccountCreditBalance(payments []*Payment, currency string) decimal.Decimal {
+	balance := decimal.Zero
+	for _, payment := range payments {
+		if payment.Currency == currency {
+			balance = balance.Add(payment.AccountCredit())
+		}
+	}
+	return balance
+}
+
+// DrawAccountCredit takes amount of account credit in currency from a
+// client's payments, those received first first, and returns how much to
+// take from each. It returns ErrInsufficientAccountCredit when they hold
+// less.
+func DrawAccountCredit(payments []*Payment, currency string, amount decimal.Decimal) ([]CreditDraw, error) {
+	if !amount.IsPositive() || amount.GreaterThan(AccountCreditBalance(payments, currency)) {
+		return nil, ErrInsufficientAccountCredit
+	}
+	sources := make([]*Payment, 0, len(payments))
+	for _, payment := range payments {
+		if payment.Currency == currency && payment.AccountCredit().IsPositive() {
+			sources = append(sources, payment)
+		}
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return receivedAt(sources[i]).Before(receivedAt(sources[j])) })
+
+	var draws []CreditDraw
+	left := amount
+	for _, payment := range sources {
+		if !left.IsPositive() {
+			break
+		}
+		take := decimal.Min(left, payment.AccountCredit())
+		draws = append(draws, CreditDraw{Payment: payment, Amount: take})
+		left = left.Sub(take)
+	}
+	return draws, nil
+}
+
+func receivedAt(p *Payment) time.Time {
+	if p.ProcessedAt != nil {
+		return *p.ProcessedAt
+	}
+	return p.CreatedAt
+}
+
+var (
+	ErrInsufficientAccountCredit = &PaymentError{Code: "INSUFFICIENT_ACCOUNT_CREDIT", Message: "Amount must be more than zero and at most the client's account credit in the currency"}
+	ErrCreditRefundExceedsCredit = &PaymentError{Code: "CREDIT_REFUND_EXCEEDS_CREDIT", Message: "Refunded credit must be more than zero and at most the payment's account credit"}
+)
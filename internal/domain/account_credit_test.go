@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountCredit(t *testing.T) {
+	tenantID, clientID := uuid.New(), uuid.New()
+	received := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	payment := func(amount, applied int64, currency string, daysLater int) *Payment {
+		p := NewPayment(tenantID, uuid.New(), clientID, decimal.NewFromInt(amount), currency, PaymentMethodBankTransfer)
+		p.MarkAsCompleted(received.AddDate(0, 0, daysLater))
+		p.AmountApplied = decimal.NewFromInt(applied)
+		return p
+	}
+	later := payment(300, 100, "EUR", 2)
+	earlier := payment(150, 100, "EUR", 1)
+	dollars := payment(80, 0, "USD", 0)
+	pending := NewPayment(tenantID, uuid.New(), clientID, decimal.NewFromInt(500), "EUR", PaymentMethodBankTransfer)
+	payments := []*Payment{later, earlier, dollars, pending}
+
+	assert.True(t, pending.AccountCredit().IsZero(), "only completed payments are credit")
+	assert.True(t, AccountCreditBalance(payments, "EUR").Equal(decimal.NewFromInt(250)))
+
+	draws, err := DrawAccountCredit(payments, "EUR", decimal.NewFromInt(120))
+	require.NoError(t, err)
+	require.Len(t, draws, 2)
+	assert.Same(t, earlier, draws[0].Payment, "the credit received first is drawn first")
+	assert.True(t, draws[0].Amount.Equal(decimal.NewFromInt(50)))
+	assert.Same(t, later, draws[1].Payment)
+	assert.True(t, draws[1].Amount.Equal(decimal.NewFromInt(70)))
+
+	_, err = DrawAccountCredit(payments, "EUR", decimal.NewFromInt(251))
+	assert.Equal(t, ErrInsufficientAccountCredit, err)
+	_, err = DrawAccountCredit(payments, "GBP", decimal.NewFromInt(1))
+	assert.Equal(t, ErrInsufficientAccountCredit, err)
+
+	require.NoError(t, dollars.RefundCredit(decimal.NewFromInt(30), received))
+	assert.True(t, dollars.AccountCredit().Equal(decimal.NewFromInt(50)))
+	assert.Equal(t, ErrCreditRefundExceedsCredit, dollars.RefundCredit(decimal.NewFromInt(51), received))
+	assert.Equal(t, ErrCreditRefundExceedsCredit, pending.RefundCredit(decimal.NewFromInt(1), received))
+}
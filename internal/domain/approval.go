@@ -0,0 +1,333 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ApprovalStatus is where an approval request stands.
+type ApprovalStatus string
+
+const (
+	ApprovalPending   ApprovalStatus = "pending"
+	ApprovalApproved  ApprovalStatus = "approved"
+	ApprovalRejected  ApprovalStatus = "rejected"
+	ApprovalCancelled ApprovalStatus = "cancelled"
+)
+
+// Decisions recorded on an approval request.
+const (
+	DecisionApprove  = "approve"
+	DecisionReject   = "reject"
+	DecisionEscalate = "escalate"
+	DecisionCancel   = "cancel"
+)
+
+// ApprovalStep is one step of an approval workflow. A step applies to
+// requests of at least MinAmount; it is decided by any of ApproverUsers or
+// by any user holding one of ApproverRoles. A step still pending after
+// EscalateAfterHours may also be decided by EscalateToUsers and
+// EscalateToRoles.
+type ApprovalStep struct {
+	Name               string   `json:"name" bson:"name"`
+	ApproverRoles      []string `json:"approverRoles,omitempty" bson:"approverRoles,omitempty"`
+	ApproverUsers      []string `json:"approverUsers,omitempty" bson:"approverUsers,omitempty"`
+	MinAmount          float64  `json:"minAmount,omitempty" bson:"minAmount,omitempty"`
+	EscalateAfterHours int      `json:"escalateAfterHours,omitempty" bson:"escalateAfterHours,omitempty"`
+	EscalateToRoles    []string `json:"escalateToRoles,omitempty" bson:"escalateToRoles,omitempty"`
+	EscalateToUsers    []string `json:"escalateToUsers,omitempty" bson:"escalateToUsers,omitempty"`
+}
+
+// ApprovalWorkflow is how a tenant approves one type of subject, such as
+// invoices or payouts. Its steps are decided in order.
+type ApprovalWorkflow struct {
+	ID          string         `json:"-" bson:"_id"`
+	TenantID    string         `json:"tenantId" bson:"tenantId"`
+	SubjectType string         `json:"subjectType" bson:"subjectType"`
+	Name        string         `json:"name" bson:"name"`
+	Steps       []ApprovalStep `json:"steps" bson:"steps"`
+	UpdatedBy   string         `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt   time.Time      `json:"updatedAt" bson:"updatedAt"`
+	Version     int64          `json:"version" bson:"version"`
+}
+
+var subjectType = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Validate checks that the workflow has a subject type and steps that can
+// each be decided by someone.
+func (w *ApprovalWorkflow) Validate() error {
+	if !subjectType.MatchString(w.SubjectType) {
+		return ErrInvalidApprovalSubject
+	}
+	if len(w.Steps) == 0 {
+		return ErrApprovalStepsRequired
+	}
+	for i := range w.Steps {
+		step := &w.Steps[i]
+		step.Name = strings.TrimSpace(step.Name)
+		if step.Name == "" {
+			return ErrApprovalStepName
+		}
+		if len(step.ApproverRoles) == 0 && len(step.ApproverUsers) == 0 {
+			return ErrApprovalStepApprovers
+		}
+		if step.MinAmount < 0 || step.EscalateAfterHours < 0 {
+			return ErrApprovalStepLimits
+		}
+		if step.EscalateAfterHours > 0 && len(step.EscalateToRoles) == 0 && len(step.EscalateToUsers) == 0 {
+			return ErrApprovalEscalationTarget
+		}
+	}
+	return nil
+}
+
+// StepsFor returns the steps that apply to a request for amount.
+func (w *ApprovalWorkflow) StepsFor(amount float64) []ApprovalStep {
+	var steps []ApprovalStep
+	for _, step := range w.Steps {
+		if amount >= step.MinAmount {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// ApprovalDecision is one decision recorded on a request. Escalations are
+// recorded without a user.
+type ApprovalDecision struct {
+	Step     int       `json:"step" bson:"step"`
+	StepName string    `json:"stepName" bson:"stepName"`
+	UserID   string    `json:"userId,omitempty" bson:"userId,omitempty"`
+	Decision string    `json:"decision" bson:"decision"`
+	Comment  string    `json:"comment,omitempty" bson:"comment,omitempty"`
+	At       time.Time `json:"at" bson:"at"`
+}
+
+// ApprovalRequest asks for a subject, such as an invoice, to be approved
+// through the steps of its workflow that apply to its amount. ApproverUsers
+// and ApproverRoles are those who may decide the current step, kept up to
+// date so inboxes can be queried, as is EscalateAt, when the current step
+// escalates if still pending.
+type ApprovalRequest struct {
+	ID            string             `json:"id" bson:"_id"`
+	TenantID      string             `json:"tenantId" bson:"tenantId"`
+	SubjectType   string             `json:"subjectType" bson:"subjectType"`
+	SubjectID     string             `json:"subjectId" bson:"subjectId"`
+	Amount        float64            `json:"amount" bson:"amount"`
+	Currency      string             `json:"currency,omitempty" bson:"currency,omitempty"`
+	Summary       string             `json:"summary,omitempty" bson:"summary,omitempty"`
+	RequestedBy   string             `json:"requestedBy" bson:"requestedBy"`
+	Status        ApprovalStatus     `json:"status" bson:"status"`
+	Steps         []ApprovalStep     `json:"steps" bson:"steps"`
+	CurrentStep   int                `json:"currentStep" bson:"currentStep"`
+	StepStartedAt time.Time          `json:"stepStartedAt" bson:"stepStartedAt"`
+	EscalateAt    *time.Time         `json:"escalateAt,omitempty" bson:"escalateAt,omitempty"`
+	Escalated     bool               `json:"escalated" bson:"escalated"`
+	ApproverUsers []string           `json:"approverUsers,omitempty" bson:"approverUsers,omitempty"`
+	ApproverRoles []string           `json:"approverRoles,omitempty" bson:"approverRoles,omitempty"`
+	Decisions     []ApprovalDecision `json:"decisions" bson:"decisions"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+	DecidedAt     *time.Time         `json:"decidedAt,omitempty" bson:"decidedAt,omitempty"`
+	Version       int64              `json:"version" bson:"version"`
+}
+
+// NewApprovalRequest starts a request through the steps of workflow that
+// apply to amount. A request no step applies to is approved at once.
+func NewApprovalRequest(id string, workflow *ApprovalWorkflow, subjectID string, amount float64, currency, summary, requestedBy string, now time.Time) (*ApprovalRequest, error) {
+	if !subjectType.MatchString(workflow.SubjectType) || strings.TrimSpace(subjectID) == "" {
+		return nil, ErrInvalidApprovalSubject
+	}
+	if amount < 0 {
+		return nil, ErrApprovalStepLimits
+	}
+	now = now.UTC()
+	req := &ApprovalRequest{
+		ID:            id,
+		TenantID:      workflow.TenantID,
+		SubjectType:   workflow.SubjectType,
+		SubjectID:     subjectID,
+		Amount:        amount,
+		Currency:      strings.ToUpper(currency),
+		Summary:       summary,
+		RequestedBy:   requestedBy,
+		Status:        ApprovalPending,
+		Steps:         workflow.StepsFor(amount),
+		StepStartedAt: now,
+		Decisions:     []ApprovalDecision{},
+		CreatedAt:     now,
+	}
+	if len(req.Steps) == 0 {
+		req.finish(ApprovalApproved, now)
+		return req, nil
+	}
+	req.setApprovers()
+	return req, nil
+}
+
+// CanDecide reports whether the user, holding roles, may decide the current
+// step. Requesters never decide their own requests, and no user decides two
+// steps of the same request.
+func (r *ApprovalRequest) CanDecide(userID string, roles []string) bool {
+	if r.Status != ApprovalPending || userID == "" || userID == r.RequestedBy {
+		return false
+	}
+	for _, decision := range r.Decisions {
+		if decision.UserID == userID && decision.Decision == DecisionApprove {
+			return false
+		}
+	}
+	if contains(r.ApproverUsers, userID) {
+		return true
+	}
+	for _, role := range roles {
+		if contains(r.ApproverRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Approve approves the current step, finishing the request when it was the
+// last one. It reports whether the request is now approved.
+func (r *ApprovalRequest) Approve(userID string, roles []string, comment string, now time.Time) (bool, error) {
+	if err := r.checkDecider(userID, roles); err != nil {
+		return false, err
+	}
+	now = now.UTC()
+	r.record(userID, DecisionApprove, comment, now)
+	if r.CurrentStep == len(r.Steps)-1 {
+		r.finish(ApprovalApproved, now)
+		return true, nil
+	}
+	r.CurrentStep++
+	r.StepStartedAt = now
+	r.Escalated = false
+	r.setApprovers()
+	return false, nil
+}
+
+// Reject rejects the request at the current step.
+func (r *ApprovalRequest) Reject(userID string, roles []string, comment string, now time.Time) error {
+	if err := r.checkDecider(userID, roles); err != nil {
+		return err
+	}
+	if strings.TrimSpace(comment) == "" {
+		return ErrApprovalReasonRequired
+	}
+	now = now.UTC()
+	r.record(userID, DecisionReject, comment, now)
+	r.finish(ApprovalRejected, now)
+	return nil
+}
+
+// Cancel withdraws a pending request, for example because its subject was
+// deleted.
+func (r *ApprovalRequest) Cancel(userID, reason string, now time.Time) error {
+	if r.Status != ApprovalPending {
+		return ErrApprovalDecided
+	}
+	now = now.UTC()
+	r.record(userID, DecisionCancel, reason, now)
+	r.finish(ApprovalCancelled, now)
+	return nil
+}
+
+// EscalationDue reports whether the current step has waited past its
+// escalation timer at now.
+func (r *ApprovalRequest) EscalationDue(now time.Time) bool {
+	return r.Status == ApprovalPending && !r.Escalated && r.EscalateAt != nil && !now.Before(*r.EscalateAt)
+}
+
+// Escalate lets the escalation targets of the current step decide it as
+// well, if the step's timer has run out.
+func (r *ApprovalRequest) Escalate(now time.Time) bool {
+	if !r.EscalationDue(now) {
+		return false
+	}
+	r.record("", DecisionEscalate, "", now.UTC())
+	r.Escalated = true
+	r.setApprovers()
+	return true
+}
+
+func (r *ApprovalRequest) checkDecider(userID string, roles []string) error {
+	if r.Status != ApprovalPending {
+		return ErrApprovalDecided
+	}
+	if userID == r.RequestedBy {
+		return ErrApprovalSelfDecision
+	}
+	if !r.CanDecide(userID, roles) {
+		return ErrNotApprover
+	}
+	return nil
+}
+
+func (r *ApprovalRequest) record(userID, decision, comment string, now time.Time) {
+	name := ""
+	if r.CurrentStep < len(r.Steps) {
+		name = r.Steps[r.CurrentStep].Name
+	}
+	r.Decisions = append(r.Decisions, ApprovalDecision{
+		Step:     r.CurrentStep,
+		StepName: name,
+		UserID:   userID,
+		Decision: decision,
+		Comment:  strings.TrimSpace(comment),
+		At:       now,
+	})
+}
+
+func (r *ApprovalRequest) finish(status ApprovalStatus, now time.Time) {
+	r.Status = status
+	r.DecidedAt = &now
+	r.ApproverUsers = nil
+	r.ApproverRoles = nil
+	r.EscalateAt = nil
+}
+
+func (r *ApprovalRequest) setApprovers() {
+	step := r.Steps[r.CurrentStep]
+	r.ApproverUsers = append([]string{}, step.ApproverUsers...)
+	r.ApproverRoles = append([]string{}, step.ApproverRoles...)
+	r.EscalateAt = nil
+	if r.Escalated {
+		r.ApproverUsers = append(r.ApproverUsers, step.EscalateToUsers...)
+		r.ApproverRoles = append(r.ApproverRoles, step.EscalateToRoles...)
+	} else if step.EscalateAfterHours > 0 {
+		at := r.StepStartedAt.Add(time.Duration(step.EscalateAfterHours) * time.Hour)
+		r.EscalateAt = &at
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type ApprovalError struct {
+	Code    string
+	Message string
+}
+
+func (e *ApprovalError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrInvalidApprovalSubject   = &ApprovalError{Code: "INVALID_APPROVAL_SUBJECT", Message: "Approval subjects need a type of lowercase letters, digits and underscores, and an ID"}
+	ErrApprovalStepsRequired    = &ApprovalError{Code: "APPROVAL_STEPS_REQUIRED", Message: "An approval workflow needs at least one step"}
+	ErrApprovalStepName         = &ApprovalError{Code: "APPROVAL_STEP_NAME", Message: "Every approval step needs a name"}
+	ErrApprovalStepApprovers    = &ApprovalError{Code: "APPROVAL_STEP_APPROVERS", Message: "Every approval step needs approver roles or users"}
+	ErrApprovalStepLimits       = &ApprovalError{Code: "APPROVAL_STEP_LIMITS", Message: "Approval amounts and escalation timers cannot be negative"}
+	ErrApprovalEscalationTarget = &ApprovalError{Code: "APPROVAL_ESCALATION_TARGET", Message: "An approval step with an escalation timer needs roles or users to escalate to"}
+	ErrApprovalDecided          = &ApprovalError{Code: "APPROVAL_DECIDED", Message: "The approval request has already been decided"}
+	ErrApprovalSelfDecision     = &ApprovalError{Code: "APPROVAL_SELF_DECISION", Message: "Approval requests must be decided by someone other than their requester"}
+	ErrNotApprover              = &ApprovalError{Code: "NOT_APPROVER", Message: "You cannot decide the current step of this approval request"}
+	ErrApprovalReasonRequired   = &ApprovalError{Code: "APPROVAL_REASON_REQUIRED", Message: "A rejection needs a comment giving the reason"}
+)
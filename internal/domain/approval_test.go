@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testWorkflow() *ApprovalWorkflow {
+	return &ApprovalWorkflow{
+		TenantID:    "tenant-1",
+		SubjectType: "invoice",
+		Steps: []ApprovalStep{
+			{Name: "Manager", ApproverRoles: []string{"manager"}, EscalateAfterHours: 24, EscalateToUsers: []string{"cfo"}},
+			{Name: "Finance", ApproverUsers: []string{"controller"}, MinAmount: 10000},
+		},
+	}
+}
+
+func TestApprovalWorkflowValidate(t *testing.T) {
+	assert.NoError(t, testWorkflow().Validate())
+
+	w := testWorkflow()
+	w.SubjectType = "Invoice"
+	assert.Equal(t, ErrInvalidApprovalSubject, w.Validate())
+
+	w = testWorkflow()
+	w.Steps = nil
+	assert.Equal(t, ErrApprovalStepsRequired, w.Validate())
+
+	w = testWorkflow()
+	w.Steps[1].ApproverUsers = nil
+	assert.Equal(t, ErrApprovalStepApprovers, w.Validate())
+
+	w = testWorkflow()
+	w.Steps[0].EscalateToUsers = nil
+	assert.Equal(t, ErrApprovalEscalationTarget, w.Validate())
+}
+
+func TestApprovalRequestSteps(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	small, err := NewApprovalRequest("r-1", testWorkflow(), "inv-1", 500, "eur", "", "clerk", now)
+	require.NoError(t, err)
+	assert.Len(t, small.Steps, 1, "the finance step only applies from 10000")
+	assert.Equal(t, "EUR", small.Currency)
+
+	none := testWorkflow()
+	none.Steps = none.Steps[1:]
+	auto, err := NewApprovalRequest("r-2", none, "inv-2", 500, "EUR", "", "clerk", now)
+	require.NoError(t, err)
+	assert.Equal(t, ApprovalApproved, auto.Status, "a request no step applies to is approved at once")
+
+	req, err := NewApprovalRequest("r-3", testWorkflow(), "inv-3", 25000, "EUR", "", "clerk", now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"manager"}, req.ApproverRoles)
+
+	_, err = req.Approve("clerk", []string{"manager"}, "", now)
+	assert.Equal(t, ErrApprovalSelfDecision, err)
+	_, err = req.Approve("sales", []string{"sales"}, "", now)
+	assert.Equal(t, ErrNotApprover, err)
+
+	done, err := req.Approve("boss", []string{"manager"}, "ok", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, 1, req.CurrentStep)
+	assert.Equal(t, []string{"controller"}, req.ApproverUsers)
+	assert.Nil(t, req.EscalateAt, "the finance step has no escalation timer")
+
+	assert.Equal(t, ErrApprovalReasonRequired, req.Reject("controller", nil, " ", now))
+	done, err = req.Approve("controller", nil, "", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, ApprovalApproved, req.Status)
+	assert.Empty(t, req.ApproverUsers)
+	require.Len(t, req.Decisions, 2)
+	assert.Equal(t, "Finance", req.Decisions[1].StepName)
+
+	_, err = req.Approve("controller", nil, "", now)
+	assert.Equal(t, ErrApprovalDecided, err)
+}
+
+func TestApprovalRequestNoUserDecidesTwice(t *testing.T) {
+	w := testWorkflow()
+	w.Steps[1].ApproverRoles = []string{"manager"}
+	req, err := NewApprovalRequest("r-1", w, "inv-1", 20000, "EUR", "", "clerk", time.Now())
+	require.NoError(t, err)
+
+	_, err = req.Approve("boss", []string{"manager"}, "", time.Now())
+	require.NoError(t, err)
+	assert.False(t, req.CanDecide("boss", []string{"manager"}))
+	assert.True(t, req.CanDecide("other-boss", []string{"manager"}))
+}
+
+func TestApprovalRequestEscalation(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	req, err := NewApprovalRequest("r-1", testWorkflow(), "inv-1", 500, "EUR", "", "clerk", now)
+	require.NoError(t, err)
+	require.NotNil(t, req.EscalateAt)
+	assert.Equal(t, now.Add(24*time.Hour), *req.EscalateAt)
+
+	assert.False(t, req.Escalate(now.Add(23*time.Hour)))
+	assert.False(t, req.CanDecide("cfo", nil))
+
+	assert.True(t, req.Escalate(now.Add(24*time.Hour)))
+	assert.True(t, req.CanDecide("cfo", nil))
+	assert.True(t, req.CanDecide("boss", []string{"manager"}), "the step's own approvers may still decide")
+	assert.Nil(t, req.EscalateAt)
+	assert.False(t, req.Escalate(now.Add(48*time.Hour)), "a step escalates once")
+	assert.Equal(t, DecisionEscalate, req.Decisions[0].Decision)
+
+	require.NoError(t, req.Reject("cfo", nil, "not budgeted", now.Add(25*time.Hour)))
+	assert.Equal(t, ApprovalRejected, req.Status)
+	assert.Equal(t, ErrApprovalDecided, req.Cancel("clerk", "", now))
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	AuditKindEvent   = "event"
+	AuditKindCommand = "command"
+)
+
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// AuditEntry is one append-only record of the audit log. Entries of a tenant
+// are numbered from 1 and each one's Hash covers its content and the Hash of
+// the entry before it, so editing, removing or reordering an entry breaks
+// every hash after it.
+//
+// SourceID is the event or command ID the entry was recorded from; a tenant
+// has at most one entry per source.
+type AuditEntry struct {
+	ID            string                 `json:"id" bson:"_id"`
+	TenantID      string                 `json:"tenantId" bson:"tenantId"`
+	Sequence      int64                  `json:"sequence" bson:"sequence"`
+	Kind          string                 `json:"kind" bson:"kind"`
+	Action        string                 `json:"action" bson:"action"`
+	EntityType    string                 `json:"entityType,omitempty" bson:"entityType,omitempty"`
+	EntityID      string                 `json:"entityId,omitempty" bson:"entityId,omitempty"`
+	UserID        string                 `json:"userId,omitempty" bson:"userId,omitempty"`
+	SourceID      string                 `json:"sourceId" bson:"sourceId"`
+	CorrelationID string                 `json:"correlationId,omitempty" bson:"correlationId,omitempty"`
+	Success       bool                   `json:"success" bson:"success"`
+	Error         string                 `json:"error,omitempty" bson:"error,omitempty"`
+	Data          map[string]interface{} `json:"data,omitempty" bson:"data,omitempty"`
+	OccurredAt    time.Time              `json:"occurredAt" bson:"occurredAt"`
+	RecordedAt    time.Time              `json:"recordedAt" bson:"recordedAt"`
+	PrevHash      string                 `json:"prevHash" bson:"prevHash"`
+	Hash          string                 `json:"hash" bson:"hash"`
+}
+
+// Seal places the entry after prev, or first when prev is nil, and computes
+// its hash. Timestamps are cut to milliseconds, the precision MongoDB keeps,
+// so the hash still matches once the entry is read back.
+func (e *AuditEntry) Seal(prev *AuditEntry) {
+	e.Sequence = 1
+	e.PrevHash = ""
+	if prev != nil {
+		e.Sequence = prev.Sequence + 1
+		e.PrevHash = prev.Hash
+	}
+	e.OccurredAt = e.OccurredAt.UTC().Truncate(time.Millisecond)
+	e.RecordedAt = e.RecordedAt.UTC().Truncate(time.Millisecond)
+	e.Hash = e.ComputeHash()
+}
+
+// ComputeHash returns the hex SHA-256 of the entry's fields other than Hash.
+func (e *AuditEntry) ComputeHash() string {
+	content := *e
+	content.Hash = ""
+	// Map keys are sorted by encoding/json, so the encoding is stable.
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAuditChain checks entries, in sequence order, against their hashes
+// and against each other. prev is the entry before entries[0], or nil when
+// entries starts the chain.
+func VerifyAuditChain(prev *AuditEntry, entries []AuditEntry) error {
+	for i := range entries {
+		entry := &entries[i]
+		wantSeq, wantPrev := int64(1), ""
+		if prev != nil {
+			wantSeq, wantPrev = prev.Sequence+1, prev.Hash
+		}
+		switch {
+		case entry.Sequence != wantSeq:
+			return fmt.Errorf("%w: expected sequence %d, found %d", ErrAuditChainBroken, wantSeq, entry.Sequence)
+		case entry.PrevHash != wantPrev:
+			return fmt.Errorf("%w: entry %d does not follow entry %d", ErrAuditChainBroken, entry.Sequence, wantSeq-1)
+		case entry.Hash != entry.ComputeHash():
+			return fmt.Errorf("%w: entry %d was modified", ErrAuditChainBroken, entry.Sequence)
+		}
+		prev = entry
+	}
+	return nil
+}
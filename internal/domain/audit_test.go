@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func auditChain(n int) []AuditEntry {
+	entries := make([]AuditEntry, n)
+	var prev *AuditEntry
+	for i := range entries {
+		entries[i] = AuditEntry{
+			ID:         "entry",
+			TenantID:   "tenant-1",
+			Kind:       AuditKindEvent,
+			Action:     "invoice.sent",
+			UserID:     "user-1",
+			Success:    true,
+			Data:       map[string]interface{}{"total": "100.00", "lines": float64(i)},
+			OccurredAt: time.Date(2026, 1, 2, 3, 4, 5, 6789, time.UTC),
+			RecordedAt: time.Now(),
+		}
+		entries[i].Seal(prev)
+		prev = &entries[i]
+	}
+	return entries
+}
+
+func TestAuditEntry_Seal(t *testing.T) {
+	entries := auditChain(2)
+
+	assert.Equal(t, int64(1), entries[0].Sequence)
+	assert.Empty(t, entries[0].PrevHash)
+	assert.Equal(t, int64(2), entries[1].Sequence)
+	assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	assert.Len(t, entries[0].Hash, 64)
+	assert.Equal(t, 0, entries[0].OccurredAt.Nanosecond()%int(time.Millisecond))
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	entries := auditChain(3)
+	require.NoError(t, VerifyAuditChain(nil, entries))
+	require.NoError(t, VerifyAuditChain(&entries[0], entries[1:]))
+
+	tampered := auditChain(3)
+	tampered[1].UserID = "user-2"
+	err := VerifyAuditChain(nil, tampered)
+	assert.True(t, errors.Is(err, ErrAuditChainBroken))
+	assert.Contains(t, err.Error(), "entry 2 was modified")
+
+	resealed := auditChain(3)
+	resealed[1].Data = map[string]interface{}{"total": "1.00"}
+	resealed[1].Seal(&resealed[0])
+	err = VerifyAuditChain(nil, resealed)
+	assert.Contains(t, err.Error(), "entry 3 does not follow entry 2")
+
+	missing := auditChain(3)
+	err = VerifyAuditChain(nil, []AuditEntry{missing[0], missing[2]})
+	assert.Contains(t, err.Error(), "expected sequence 2, found 3")
+
+	assert.Error(t, VerifyAuditChain(nil, entries[1:]))
+}
@@ -0,0 +1,251 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// BankStatementFormat is the file format a bank statement was imported
+// from.
+type BankStatementFormat string
+
+const (
+	BankStatementCSV     BankStatementFormat = "csv"
+	BankStatementCAMT053 BankStatementFormat = "camt.053"
+)
+
+// BankStatement is a statement of one of the tenant's bank accounts as
+// imported. Its transactions are kept apart, and transactions already
+// imported from an earlier, overlapping statement are skipped and counted
+// as Duplicates.
+type BankStatement struct {
+	ID           uuid.UUID           `json:"id" bson:"_id"`
+	TenantID     uuid.UUID           `json:"tenantId" bson:"tenantId"`
+	Format       BankStatementFormat `json:"format" bson:"format"`
+	Reference    string              `json:"reference,omitempty" bson:"reference,omitempty"`
+	AccountIBAN  string              `json:"accountIban,omitempty" bson:"accountIban,omitempty"`
+	Currency     string              `json:"currency" bson:"currency"`
+	Filename     string              `json:"filename,omitempty" bson:"filename,omitempty"`
+	Fingerprint  string              `json:"fingerprint" bson:"fingerprint"`
+	Transactions int                 `json:"transactions" bson:"transactions"`
+	Duplicates   int                 `json:"duplicates" bson:"duplicates"`
+	ImportedBy   uuid.UUID           `json:"importedBy" bson:"importedBy"`
+	ImportedAt   time.Time           `json:"importedAt" bson:"importedAt"`
+}
+
+// BankTransactionStatus is where a statement transaction is in
+// reconciliation. Credits are matched to invoices; debits are ignored.
+type BankTransactionStatus string
+
+const (
+	// BankTransactionUnmatched is a credit no open invoice resembles.
+	BankTransactionUnmatched BankTransactionStatus = "unmatched"
+	// BankTransactionReview is a credit with candidate invoices none of
+	// which could be matched with confidence, left for a person to confirm.
+	BankTransactionReview BankTransactionStatus = "review"
+	// BankTransactionMatched is a credit recorded as a payment of an
+	// invoice.
+	BankTransactionMatched BankTransactionStatus = "matched"
+	// BankTransactionIgnored is a debit, or a credit set aside as not an
+	// invoice payment.
+	BankTransactionIgnored BankTransactionStatus = "ignored"
+)
+
+// BankTransaction is one booked entry of a bank statement. Amount is
+// positive; Credit tells money received from money paid out.
+// CounterpartyIBANHash is the blind index of CounterpartyIBAN, kept only when
+// the store encrypts it.
+type BankTransaction struct {
+	ID                   uuid.UUID             `json:"id" bson:"_id"`
+	TenantID             uuid.UUID             `json:"tenantId" bson:"tenantId"`
+	StatementID          uuid.UUID             `json:"statementId" bson:"statementId"`
+	AccountIBAN          string                `json:"accountIban,omitempty" bson:"accountIban,omitempty"`
+	EntryReference       string                `json:"entryReference" bson:"entryReference"`
+	BookingDate          time.Time             `json:"bookingDate" bson:"bookingDate"`
+	ValueDate            *time.Time            `json:"valueDate,omitempty" bson:"valueDate,omitempty"`
+	Credit               bool                  `json:"credit" bson:"credit"`
+	Amount               decimal.Decimal       `json:"amount" bson:"amount"`
+	Currency             string                `json:"currency" bson:"currency"`
+	Reference            string                `json:"reference,omitempty" bson:"reference,omitempty"`
+	CounterpartyName     string                `json:"counterpartyName,omitempty" bson:"counterpartyName,omitempty"`
+	CounterpartyIBAN     string                `json:"counterpartyIban,omitempty" bson:"counterpartyIban,omitempty"`
+	CounterpartyIBANHash string                `json:"-" bson:"counterpartyIbanHash,omitempty"`
+	Status               BankTransactionStatus `json:"status" bson:"status"`
+	Candidates           []BankMatchCandidate  `json:"candidates,omitempty" bson:"candidates,omitempty"`
+	InvoiceID            *uuid.UUID            `json:"invoiceId,omitempty" bson:"invoiceId,omitempty"`
+	ClientID             *uuid.UUID            `json:"clientId,omitempty" bson:"clientId,omitempty"`
+	PaymentID            *uuid.UUID            `json:"paymentId,omitempty" bson:"paymentId,omitempty"`
+	AutoMatched          bool                  `json:"autoMatched,omitempty" bson:"autoMatched,omitempty"`
+	IgnoreReason         string                `json:"ignoreReason,omitempty" bson:"ignoreReason,omitempty"`
+	ResolvedBy           *uuid.UUID            `json:"resolvedBy,omitempty" bson:"resolvedBy,omitempty"`
+	ResolvedAt           *time.Time            `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+	CreatedAt            time.Time             `json:"createdAt" bson:"createdAt"`
+	UpdatedAt            time.Time             `json:"updatedAt" bson:"updatedAt"`
+	Version              int64                 `json:"version" bson:"version"`
+}
+
+// IsOpen reports whether the transaction is still to be reconciled.
+func (t *BankTransaction) IsOpen() bool {
+	return t.Status == BankTransactionUnmatched || t.Status == BankTransactionReview
+}
+
+// Match records the transaction as paying invoice with payment. by is nil
+// when it was matched automatically.
+func (t *BankTransaction) Match(invoice *Invoice, paymentID uuid.UUID, by *uuid.UUID) error {
+	if !t.IsOpen() {
+		return ErrBankTransactionResolved
+	}
+	now := time.Now().UTC()
+	t.Status = BankTransactionMatched
+	t.InvoiceID = &invoice.ID
+	t.ClientID = &invoice.ClientID
+	t.PaymentID = &paymentID
+	t.AutoMatched = by == nil
+	t.ResolvedBy = by
+	t.ResolvedAt = &now
+	t.UpdatedAt = now
+	return nil
+}
+
+// Ignore sets an open credit aside as not an invoice payment.
+func (t *BankTransaction) Ignore(reason string, by uuid.UUID) error {
+	if !t.IsOpen() {
+		return ErrBankTransactionResolved
+	}
+	now := time.Now().UTC()
+	t.Status = BankTransactionIgnored
+	t.IgnoreReason = reason
+	t.ResolvedBy = &by
+	t.ResolvedAt = &now
+	t.UpdatedAt = now
+	return nil
+}
+
+// Reasons a candidate invoice resembles a bank transaction.
+const (
+	BankMatchReference = "reference"
+	BankMatchAmount    = "amount"
+	BankMatchIBAN      = "iban"
+)
+
+// Weights of the reasons in a candidate's score. No reason alone reaches
+// BankAutoMatchScore: a transaction is matched automatically only when two
+// of them agree.
+var bankMatchWeights = map[string]int{
+	BankMatchReference: 40,
+	BankMatchAmount:    40,
+	BankMatchIBAN:      20,
+}
+
+// BankAutoMatchScore is the score a sole best candidate needs for its
+// transaction to be matched without review.
+const BankAutoMatchScore = 60
+
+// maxBankMatchCandidates bounds the candidates kept for review.
+const maxBankMatchCandidates = 5
+
+// BankMatchCandidate is an open invoice a credit may pay, with why.
+type BankMatchCandidate struct {
+	InvoiceID     uuid.UUID       `json:"invoiceId" bson:"invoiceId"`
+	InvoiceNumber string          `json:"invoiceNumber" bson:"invoiceNumber"`
+	ClientID      uuid.UUID       `json:"clientId" bson:"clientId"`
+	AmountDue     decimal.Decimal `json:"amountDue" bson:"amountDue"`
+	Score         int             `json:"score" bson:"score"`
+	Reasons       []string        `json:"reasons" bson:"reasons"`
+}
+
+// MatchBankTransaction ranks the open invoices a credit may pay, best
+// first, and returns the one it can be matched to without review, if any.
+// An invoice is a candidate when in the credit's currency and its number
+// appears in the credit's reference, its amount due equals the credit, or
+// payers, the clients the credit's counterparty IBAN has paid for before,
+// include its client. The best candidate is matched when it alone has the
+// best score, that score reaches BankAutoMatchScore and the credit does not
+// exceed its amount due.
+func MatchBankTransaction(transaction *BankTransaction, invoices []*Invoice, payers []uuid.UUID) ([]BankMatchCandidate, *BankMatchCandidate) {
+	if !transaction.Credit {
+		return nil, nil
+	}
+	reference := normalizeBankReference(transaction.Reference)
+	paid := make(map[uuid.UUID]bool, len(payers))
+	for _, clientID := range payers {
+		paid[clientID] = true
+	}
+
+	var candidates []BankMatchCandidate
+	for _, invoice := range invoices {
+		if invoice.Currency != transaction.Currency || !invoice.AmountDue.IsPositive() {
+			continue
+		}
+		var reasons []string
+		if number := normalizeBankReference(invoice.InvoiceNumber); number != "" && strings.Contains(reference, number) {
+			reasons = append(reasons, BankMatchReference)
+		}
+		if invoice.AmountDue.Equal(transaction.Amount) {
+			reasons = append(reasons, BankMatchAmount)
+		}
+		if paid[invoice.ClientID] {
+			reasons = append(reasons, BankMatchIBAN)
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		score := 0
+		for _, reason := range reasons {
+			score += bankMatchWeights[reason]
+		}
+		candidates = append(candidates, BankMatchCandidate{
+			InvoiceID:     invoice.ID,
+			InvoiceNumber: invoice.InvoiceNumber,
+			ClientID:      invoice.ClientID,
+			AmountDue:     invoice.AmountDue,
+			Score:         score,
+			Reasons:       reasons,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > maxBankMatchCandidates {
+		candidates = candidates[:maxBankMatchCandidates]
+	}
+
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+	best := candidates[0]
+	if best.Score < BankAutoMatchScore || transaction.Amount.GreaterThan(best.AmountDue) {
+		return candidates, nil
+	}
+	if len(candidates) > 1 && candidates[1].Score == best.Score {
+		return candidates, nil
+	}
+	return candidates, &best
+}
+
+// normalizeBankReference keeps only the letters and digits of a payment
+// reference, upper-cased, so that "inv 2026/000123" contains
+// "INV-2026-000123".
+func normalizeBankReference(reference string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, reference)
+}
+
+// NormalizeIBAN strips the spaces of an IBAN and upper-cases it.
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+var (
+	ErrBankTransactionResolved = &PaymentError{Code: "BANK_TRANSACTION_RESOLVED", Message: "Bank transaction has already been matched or ignored"}
+	ErrBankTransactionDebit    = &PaymentError{Code: "BANK_TRANSACTION_DEBIT", Message: "Only credits can be matched to invoices"}
+)
@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openBankInvoice(number string, due string) *Invoice {
+	return &Invoice{
+		ID:            uuid.New(),
+		ClientID:      uuid.New(),
+		InvoiceNumber: number,
+		Currency:      "EUR",
+		Status:        InvoiceStatusSent,
+		AmountDue:     decimal.RequireFromString(due),
+	}
+}
+
+func bankCredit(amount, reference string) *BankTransaction {
+	return &BankTransaction{
+		ID:        uuid.New(),
+		Credit:    true,
+		Amount:    decimal.RequireFromString(amount),
+		Currency:  "EUR",
+		Reference: reference,
+		Status:    BankTransactionUnmatched,
+	}
+}
+
+func TestMatchBankTransaction(t *testing.T) {
+	first := openBankInvoice("INV-2026-000041", "100.00")
+	second := openBankInvoice("INV-2026-000042", "250.00")
+	third := openBankInvoice("INV-2026-000043", "250.00")
+	dollars := openBankInvoice("INV-2026-000044", "250.00")
+	dollars.Currency = "USD"
+	invoices := []*Invoice{first, second, third, dollars}
+
+	t.Run("reference and amount", func(t *testing.T) {
+		candidates, match := MatchBankTransaction(bankCredit("250", "Payment inv 2026/000042, thanks"), invoices, nil)
+		require.NotNil(t, match)
+		assert.Equal(t, second.ID, match.InvoiceID)
+		assert.Equal(t, []string{BankMatchReference, BankMatchAmount}, match.Reasons)
+		assert.Len(t, candidates, 2, "the other invoice of the same amount is kept as a candidate")
+	})
+
+	t.Run("amount alone is reviewed", func(t *testing.T) {
+		candidates, match := MatchBankTransaction(bankCredit("250", "Thanks"), invoices, nil)
+		assert.Nil(t, match)
+		assert.Len(t, candidates, 2)
+	})
+
+	t.Run("amount and known payer", func(t *testing.T) {
+		_, match := MatchBankTransaction(bankCredit("250", ""), invoices, []uuid.UUID{third.ClientID})
+		require.NotNil(t, match)
+		assert.Equal(t, third.ID, match.InvoiceID)
+	})
+
+	t.Run("partial payment by reference and payer", func(t *testing.T) {
+		_, match := MatchBankTransaction(bankCredit("40", "INV-2026-000041"), invoices, []uuid.UUID{first.ClientID})
+		require.NotNil(t, match)
+		assert.Equal(t, first.ID, match.InvoiceID)
+	})
+
+	t.Run("overpayment is reviewed", func(t *testing.T) {
+		candidates, match := MatchBankTransaction(bankCredit("140", "INV-2026-000041"), invoices, []uuid.UUID{first.ClientID})
+		assert.Nil(t, match)
+		assert.Len(t, candidates, 1)
+	})
+
+	t.Run("tie is reviewed", func(t *testing.T) {
+		third.ClientID = second.ClientID
+		_, match := MatchBankTransaction(bankCredit("250", ""), invoices, []uuid.UUID{second.ClientID})
+		assert.Nil(t, match)
+	})
+
+	t.Run("nothing alike", func(t *testing.T) {
+		candidates, match := MatchBankTransaction(bankCredit("7", "Donation"), invoices, nil)
+		assert.Nil(t, match)
+		assert.Empty(t, candidates)
+	})
+
+	t.Run("debits are not matched", func(t *testing.T) {
+		debit := bankCredit("250", "INV-2026-000042")
+		debit.Credit = false
+		candidates, match := MatchBankTransaction(debit, invoices, nil)
+		assert.Nil(t, match)
+		assert.Empty(t, candidates)
+	})
+}
+
+func TestBankTransaction_Resolve(t *testing.T) {
+	invoice := openBankInvoice("INV-1", "10")
+	transaction := bankCredit("10", "INV-1")
+	userID := uuid.New()
+
+	require.NoError(t, transaction.Match(invoice, uuid.New(), nil))
+	assert.Equal(t, BankTransactionMatched, transaction.Status)
+	assert.True(t, transaction.AutoMatched)
+	assert.Equal(t, invoice.ClientID, *transaction.ClientID)
+	assert.ErrorIs(t, transaction.Ignore("duplicate", userID), ErrBankTransactionResolved)
+
+	other := bankCredit("10", "")
+	require.NoError(t, other.Ignore("owner's deposit", userID))
+	assert.Equal(t, BankTransactionIgnored, other.Status)
+	assert.Equal(t, userID, *other.ResolvedBy)
+	assert.ErrorIs(t, other.Match(invoice, uuid.New(), &userID), ErrBankTransactionResolved)
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Blob is content stored once under its SHA-256 checksum in a tenant's
+// bucket, shared by every document of the tenant with that content. Its ID
+// is its object key. Refs counts the documents referencing it, trashed ones
+// included; a blob nobody has referenced for the grace period is collected.
+type Blob struct {
+	ID             string     `json:"id" bson:"_id"`
+	TenantID       uuid.UUID  `json:"tenantId" bson:"tenantId"`
+	Bucket         string     `json:"bucket" bson:"bucket"`
+	Checksum       string     `json:"checksum" bson:"checksum"`
+	Size           int64      `json:"size" bson:"size"`
+	Refs           int64      `json:"refs" bson:"refs"`
+	CreatedAt      time.Time  `json:"createdAt" bson:"createdAt"`
+	UnreferencedAt *time.Time `json:"unreferencedAt,omitempty" bson:"unreferencedAt,omitempty"`
+	// Stored is set once the content has been uploaded. The collector
+	// clears it when it claims the blob, holding writers off until
+	// CollectingUntil, so whoever references the blob next uploads it
+	// again.
+	Stored          bool       `json:"stored" bson:"stored"`
+	CollectingUntil *time.Time `json:"-" bson:"collectingUntil,omitempty"`
+}
+
+// BlobKey returns the object key content with checksum is stored under in
+// a content-addressed tenant's bucket.
+func BlobKey(tenantID uuid.UUID, checksum string) string {
+	return fmt.Sprintf("%s/cas/%s/%s", tenantID, checksum[:2], checksum)
+}
+
+// IsBlobKey reports whether an object key is that of a blob, shared by
+// reference, rather than of a single document.
+func IsBlobKey(key string) bool {
+	parts := strings.Split(key, "/")
+	return len(parts) == 4 && parts[1] == "cas"
+}
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// BudgetPeriodLayout formats the calendar month a budget is for.
+const BudgetPeriodLayout = "2006-01"
+
+// BudgetLineType is whether a budget line plans revenue or an expense.
+type BudgetLineType string
+
+const (
+	BudgetRevenue BudgetLineType = "revenue"
+	BudgetExpense BudgetLineType = "expense"
+)
+
+// Budget plans a tenant's revenue and expenses for one month, in one
+// currency, per category and optionally per department.
+type Budget struct {
+	ID        uuid.UUID    `json:"id" bson:"_id"`
+	TenantID  uuid.UUID    `json:"tenantId" bson:"tenantId"`
+	Period    string       `json:"period" bson:"period"`
+	Currency  string       `json:"currency" bson:"currency"`
+	Lines     []BudgetLine `json:"lines" bson:"lines"`
+	CreatedBy uuid.UUID    `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time    `json:"createdAt" bson:"createdAt"`
+	UpdatedBy uuid.UUID    `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt time.Time    `json:"updatedAt" bson:"updatedAt"`
+	Version   int64        `json:"version" bson:"version"`
+}
+
+// BudgetLine is the amount planned for a category. A line without a
+// department covers the category in every department.
+type BudgetLine struct {
+	Type       BudgetLineType  `json:"type" bson:"type"`
+	Category   string          `json:"category" bson:"category"`
+	Department string          `json:"department,omitempty" bson:"department,omitempty"`
+	Amount     decimal.Decimal `json:"amount" bson:"amount"`
+}
+
+// NewBudget plans period, a month formatted YYYY-MM, in currency.
+func NewBudget(tenantID uuid.UUID, period, currency string, lines []BudgetLine, createdBy uuid.UUID) (*Budget, error) {
+	if _, err := time.Parse(BudgetPeriodLayout, period); err != nil {
+		return nil, ErrInvalidBudgetPeriod
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) != 3 {
+		return nil, ErrInvalidBudgetCurrency
+	}
+	now := time.Now().UTC()
+	budget := &Budget{
+		ID:        uuid.New(),
+		TenantID:  tenantID,
+		Period:    period,
+		Currency:  currency,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		UpdatedBy: createdBy,
+		UpdatedAt: now,
+	}
+	if err := budget.SetLines(lines, createdBy); err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+// SetLines replaces the budget's lines. Each type, category and department
+// is budgeted once, with an amount of at least zero in the budget's
+// currency.
+func (b *Budget) SetLines(lines []BudgetLine, updatedBy uuid.UUID) error {
+	if len(lines) == 0 {
+		return ErrBudgetLinesRequired
+	}
+	type lineKey struct {
+		lineType   BudgetLineType
+		category   string
+		department string
+	}
+	seen := make(map[lineKey]bool, len(lines))
+	cleaned := make([]BudgetLine, 0, len(lines))
+	for _, line := range lines {
+		line.Category = strings.TrimSpace(line.Category)
+		line.Department = strings.TrimSpace(line.Department)
+		if line.Type != BudgetRevenue && line.Type != BudgetExpense {
+			return ErrInvalidBudgetLineType
+		}
+		if line.Category == "" {
+			return ErrBudgetCategoryRequired
+		}
+		if line.Amount.IsNegative() || !money.Round(line.Amount, b.Currency).Equal(line.Amount) {
+			return ErrInvalidBudgetAmount
+		}
+		key := lineKey{line.Type, line.Category, line.Department}
+		if seen[key] {
+			return ErrDuplicateBudgetLine
+		}
+		seen[key] = true
+		cleaned = append(cleaned, line)
+	}
+	b.Lines = cleaned
+	b.UpdatedBy = updatedBy
+	b.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// Total is what the budget plans for lines of type.
+func (b *Budget) Total(lineType BudgetLineType) decimal.Decimal {
+	total := decimal.Zero
+	for _, line := range b.Lines {
+		if line.Type == lineType {
+			total = total.Add(line.Amount)
+		}
+	}
+	return total
+}
+
+// BudgetAlert is raised when the actual expenses of a budgeted category
+// exceed its budget by more than Threshold percent.
+type BudgetAlert struct {
+	ID         string          `json:"id" bson:"_id"`
+	TenantID   uuid.UUID       `json:"tenantId" bson:"tenantId"`
+	BudgetID   uuid.UUID       `json:"budgetId" bson:"budgetId"`
+	Period     string          `json:"period" bson:"period"`
+	Currency   string          `json:"currency" bson:"currency"`
+	Type       BudgetLineType  `json:"type" bson:"type"`
+	Category   string          `json:"category" bson:"category"`
+	Department string          `json:"department,omitempty" bson:"department,omitempty"`
+	Budget     decimal.Decimal `json:"budget" bson:"budget"`
+	Actual     decimal.Decimal `json:"actual" bson:"actual"`
+	Variance   decimal.Decimal `json:"variance" bson:"variance"`
+	Threshold  float64         `json:"threshold" bson:"threshold"`
+	CheckedAt  time.Time       `json:"checkedAt" bson:"checkedAt"`
+	RaisedAt   time.Time       `json:"raisedAt" bson:"raisedAt"`
+}
+
+var (
+	ErrInvalidBudgetPeriod    = &PaymentError{Code: "INVALID_BUDGET_PERIOD", Message: "Budget periods are months formatted YYYY-MM"}
+	ErrInvalidBudgetCurrency  = &PaymentError{Code: "INVALID_BUDGET_CURRENCY", Message: "Budget currency must be an ISO 4217 code"}
+	ErrBudgetLinesRequired    = &PaymentError{Code: "BUDGET_LINES_REQUIRED", Message: "Budget needs at least one line"}
+	ErrInvalidBudgetLineType  = &PaymentError{Code: "INVALID_BUDGET_LINE_TYPE", Message: "Budget line type must be revenue or expense"}
+	ErrBudgetCategoryRequired = &PaymentError{Code: "BUDGET_CATEGORY_REQUIRED", Message: "Budget lines need a category"}
+	ErrInvalidBudgetAmount    = &PaymentError{Code: "INVALID_BUDGET_AMOUNT", Message: "Budget amounts must be zero or more, in the currency's minor unit"}
+	ErrDuplicateBudgetLine    = &PaymentError{Code: "DUPLICATE_BUDGET_LINE", Message: "Category and department are budgeted twice"}
+)
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBudget(t *testing.T) {
+	tenantID, userID := uuid.New(), uuid.New()
+	lines := []BudgetLine{
+		{Type: BudgetRevenue, Category: " electronics ", Amount: decimal.RequireFromString("5000.00")},
+		{Type: BudgetExpense, Category: "payment_fees", Amount: decimal.RequireFromString("80")},
+		{Type: BudgetExpense, Category: "payment_fees", Department: "sales", Amount: decimal.Zero},
+	}
+
+	budget, err := NewBudget(tenantID, "2026-10", "eur", lines, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", budget.Currency)
+	assert.Equal(t, "electronics", budget.Lines[0].Category)
+	assert.Equal(t, "5000", budget.Total(BudgetRevenue).String())
+	assert.Equal(t, "80", budget.Total(BudgetExpense).String())
+
+	_, err = NewBudget(tenantID, "2026-13", "EUR", lines, userID)
+	assert.ErrorIs(t, err, ErrInvalidBudgetPeriod)
+	_, err = NewBudget(tenantID, "2026-10", "EURO", lines, userID)
+	assert.ErrorIs(t, err, ErrInvalidBudgetCurrency)
+}
+
+func TestBudget_SetLines(t *testing.T) {
+	budget, err := NewBudget(uuid.New(), "2026-10", "JPY", []BudgetLine{
+		{Type: BudgetExpense, Category: "refunds", Amount: decimal.NewFromInt(1000)},
+	}, uuid.New())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		lines []BudgetLine
+		want  error
+	}{
+		{"no lines", nil, ErrBudgetLinesRequired},
+		{"unknown type", []BudgetLine{{Type: "asset", Category: "x", Amount: decimal.Zero}}, ErrInvalidBudgetLineType},
+		{"no category", []BudgetLine{{Type: BudgetExpense, Category: " ", Amount: decimal.Zero}}, ErrBudgetCategoryRequired},
+		{"negative", []BudgetLine{{Type: BudgetExpense, Category: "x", Amount: decimal.NewFromInt(-1)}}, ErrInvalidBudgetAmount},
+		{"below minor unit", []BudgetLine{{Type: BudgetExpense, Category: "x", Amount: decimal.RequireFromString("10.5")}}, ErrInvalidBudgetAmount},
+		{"duplicate", []BudgetLine{
+			{Type: BudgetExpense, Category: "x", Amount: decimal.Zero},
+			{Type: BudgetExpense, Category: "x ", Amount: decimal.NewFromInt(5)},
+		}, ErrDuplicateBudgetLine},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, budget.SetLines(tt.lines, uuid.New()), tt.want)
+			assert.Len(t, budget.Lines, 1, "lines are kept when invalid")
+		})
+	}
+
+	require.NoError(t, budget.SetLines([]BudgetLine{
+		{Type: BudgetExpense, Category: "x", Amount: decimal.Zero},
+		{Type: BudgetRevenue, Category: "x", Amount: decimal.NewFromInt(5)},
+	}, uuid.New()))
+	assert.Len(t, budget.Lines, 2)
+}
@@ -0,0 +1,262 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type CashSessionStatus string
+
+const (
+	CashSessionStatusOpen   CashSessionStatus = "open"
+	CashSessionStatusClosed CashSessionStatus = "closed"
+)
+
+// CashEntryType is a movement of cash into or out of a drawer.
+type CashEntryType string
+
+const (
+	// CashEntryPayment is cash taken from a customer for an invoice or an
+	// order.
+	CashEntryPayment CashEntryType = "payment"
+	// CashEntryPaidIn is cash put into the drawer other than a sale, such as
+	// change brought from the safe.
+	CashEntryPaidIn CashEntryType = "paid_in"
+	// CashEntryPaidOut is cash taken out of the drawer other than a refund,
+	// such as petty cash or a bank drop.
+	CashEntryPaidOut CashEntryType = "paid_out"
+)
+
+func (t CashEntryType) IsValid() bool {
+	switch t {
+	case CashEntryPayment, CashEntryPaidIn, CashEntryPaidOut:
+		return true
+	}
+	return false
+}
+
+// CashSession is one shift of a cash drawer at a register: opened with a
+// float, taking cash payments and paid-ins and paid-outs, and closed with
+// the cash counted in the drawer. Only one session of a register is open at
+// a time.
+type CashSession struct {
+	ID           uuid.UUID         `json:"id" bson:"_id"`
+	TenantID     uuid.UUID         `json:"tenantId" bson:"tenantId"`
+	RegisterID   string            `json:"registerId" bson:"registerId"`
+	Currency     string            `json:"currency" bson:"currency"`
+	Status       CashSessionStatus `json:"status" bson:"status"`
+	OpeningFloat decimal.Decimal   `json:"openingFloat" bson:"openingFloat"`
+	Entries      []CashEntry       `json:"entries" bson:"entries"`
+	Expected     decimal.Decimal   `json:"expected" bson:"expected"`
+	Counted      *decimal.Decimal  `json:"counted" bson:"counted"`
+	Variance     *decimal.Decimal  `json:"variance" bson:"variance"`
+	CloseNotes   string            `json:"closeNotes,omitempty" bson:"closeNotes,omitempty"`
+	OpenedBy     uuid.UUID         `json:"openedBy" bson:"openedBy"`
+	OpenedAt     time.Time         `json:"openedAt" bson:"openedAt"`
+	ClosedBy     *uuid.UUID        `json:"closedBy" bson:"closedBy"`
+	ClosedAt     *time.Time        `json:"closedAt" bson:"closedAt"`
+	UpdatedAt    time.Time         `json:"updatedAt" bson:"updatedAt"`
+	Version      int64             `json:"version" bson:"version"`
+}
+
+// CashEntry is one movement of cash in a session. Payments name the invoice
+// or order paid, and PaymentID the payment recorded against an invoice;
+// paid-ins and paid-outs carry a Reason.
+type CashEntry struct {
+	ID         uuid.UUID       `json:"id" bson:"_id"`
+	Type       CashEntryType   `json:"type" bson:"type"`
+	Amount     decimal.Decimal `json:"amount" bson:"amount"`
+	InvoiceID  *uuid.UUID      `json:"invoiceId,omitempty" bson:"invoiceId,omitempty"`
+	OrderID    *uuid.UUID      `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	PaymentID  *uuid.UUID      `json:"paymentId,omitempty" bson:"paymentId,omitempty"`
+	Reason     string          `json:"reason,omitempty" bson:"reason,omitempty"`
+	Reference  string          `json:"reference,omitempty" bson:"reference,omitempty"`
+	RecordedBy uuid.UUID       `json:"recordedBy" bson:"recordedBy"`
+	RecordedAt time.Time       `json:"recordedAt" bson:"recordedAt"`
+}
+
+func NewCashSession(tenantID uuid.UUID, registerID, currency string, openingFloat decimal.Decimal, openedBy uuid.UUID) (*CashSession, error) {
+	registerID = strings.TrimSpace(registerID)
+	if registerID == "" {
+		return nil, ErrCashRegisterRequired
+	}
+	if openingFloat.IsNegative() {
+		return nil, ErrInvalidCashAmount
+	}
+	now := time.Now().UTC()
+	return &CashSession{
+		ID:           uuid.New(),
+		TenantID:     tenantID,
+		RegisterID:   registerID,
+		Currency:     strings.ToUpper(currency),
+		Status:       CashSessionStatusOpen,
+		OpeningFloat: openingFloat,
+		Entries:      []CashEntry{},
+		Expected:     openingFloat,
+		OpenedBy:     openedBy,
+		OpenedAt:     now,
+		UpdatedAt:    now,
+	}, nil
+}
+
+// Record adds a movement of cash to the open session and returns it with
+// its ID set. A payment is for exactly one invoice or order; paid-ins and
+// paid-outs need a reason, and a paid-out cannot take more than the drawer
+// should hold.
+func (s *CashSession) Record(entry CashEntry) (*CashEntry, error) {
+	if s.Status != CashSessionStatusOpen {
+		return nil, ErrCashSessionClosed
+	}
+	if !entry.Type.IsValid() {
+		return nil, ErrInvalidCashEntryType
+	}
+	if !entry.Amount.IsPositive() {
+		return nil, ErrInvalidCashAmount
+	}
+	entry.Reason = strings.TrimSpace(entry.Reason)
+	entry.Reference = strings.TrimSpace(entry.Reference)
+	switch entry.Type {
+	case CashEntryPayment:
+		if (entry.InvoiceID == nil) == (entry.OrderID == nil) {
+			return nil, ErrCashPaymentTarget
+		}
+	default:
+		if entry.Reason == "" {
+			return nil, ErrCashReasonRequired
+		}
+		entry.InvoiceID, entry.OrderID, entry.PaymentID = nil, nil, nil
+	}
+	if entry.Type == CashEntryPaidOut && entry.Amount.GreaterThan(s.Expected) {
+		return nil, ErrCashPaidOutExceedsDrawer
+	}
+
+	now := time.Now().UTC()
+	entry.ID = uuid.New()
+	entry.RecordedAt = now
+	s.Entries = append(s.Entries, entry)
+	s.Expected = s.expected()
+	s.UpdatedAt = now
+	return &s.Entries[len(s.Entries)-1], nil
+}
+
+// expected is the cash the drawer should hold: the float, plus payments and
+// paid-ins, less paid-outs.
+func (s *CashSession) expected() decimal.Decimal {
+	total := s.OpeningFloat
+	for _, entry := range s.Entries {
+		if entry.Type == CashEntryPaidOut {
+			total = total.Sub(entry.Amount)
+		} else {
+			total = total.Add(entry.Amount)
+		}
+	}
+	return total
+}
+
+// Close ends the session with the cash counted in the drawer. Variance is
+// the counted cash less the expected: positive when the drawer is over,
+// negative when it is short.
+func (s *CashSession) Close(counted decimal.Decimal, notes string, by uuid.UUID) error {
+	if s.Status != CashSessionStatusOpen {
+		return ErrCashSessionClosed
+	}
+	if counted.IsNegative() {
+		return ErrInvalidCashAmount
+	}
+	now := time.Now().UTC()
+	s.Expected = s.expected()
+	variance := counted.Sub(s.Expected)
+	s.Counted = &counted
+	s.Variance = &variance
+	s.CloseNotes = strings.TrimSpace(notes)
+	s.Status = CashSessionStatusClosed
+	s.ClosedBy = &by
+	s.ClosedAt = &now
+	s.UpdatedAt = now
+	return nil
+}
+
+// CashZReport totals a session's cash by movement. Final is false while the
+// session is open, when Counted and Variance are not known yet.
+type CashZReport struct {
+	SessionID       uuid.UUID            `json:"sessionId"`
+	RegisterID      string               `json:"registerId"`
+	Currency        string               `json:"currency"`
+	Final           bool                 `json:"final"`
+	OpenedBy        uuid.UUID            `json:"openedBy"`
+	OpenedAt        time.Time            `json:"openedAt"`
+	ClosedBy        *uuid.UUID           `json:"closedBy"`
+	ClosedAt        *time.Time           `json:"closedAt"`
+	OpeningFloat    decimal.Decimal      `json:"openingFloat"`
+	Payments        CashTotal            `json:"payments"`
+	InvoicePayments CashTotal            `json:"invoicePayments"`
+	OrderPayments   CashTotal            `json:"orderPayments"`
+	PaidIn          CashTotal            `json:"paidIn"`
+	PaidOut         CashTotal            `json:"paidOut"`
+	PaidOutByReason map[string]CashTotal `json:"paidOutByReason"`
+	Expected        decimal.Decimal      `json:"expected"`
+	Counted         *decimal.Decimal     `json:"counted"`
+	Variance        *decimal.Decimal     `json:"variance"`
+}
+
+// CashTotal counts entries and sums their amounts.
+type CashTotal struct {
+	Count  int             `json:"count"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+func (t *CashTotal) add(amount decimal.Decimal) {
+	t.Count++
+	t.Amount = t.Amount.Add(amount)
+}
+
+// ZReport totals the session for the end-of-shift report.
+func (s *CashSession) ZReport() *CashZReport {
+	report := &CashZReport{
+		SessionID:       s.ID,
+		RegisterID:      s.RegisterID,
+		Currency:        s.Currency,
+		Final:           s.Status == CashSessionStatusClosed,
+		OpenedBy:        s.OpenedBy,
+		OpenedAt:        s.OpenedAt,
+		ClosedBy:        s.ClosedBy,
+		ClosedAt:        s.ClosedAt,
+		OpeningFloat:    s.OpeningFloat,
+		Expected:        s.expected(),
+		Counted:         s.Counted,
+		Variance:        s.Variance,
+		PaidOutByReason: map[string]CashTotal{},
+	}
+	for _, entry := range s.Entries {
+		switch entry.Type {
+		case CashEntryPayment:
+			report.Payments.add(entry.Amount)
+			if entry.InvoiceID != nil {
+				report.InvoicePayments.add(entry.Amount)
+			} else {
+				report.OrderPayments.add(entry.Amount)
+			}
+		case CashEntryPaidIn:
+			report.PaidIn.add(entry.Amount)
+		case CashEntryPaidOut:
+			report.PaidOut.add(entry.Amount)
+			total := report.PaidOutByReason[entry.Reason]
+			total.add(entry.Amount)
+			report.PaidOutByReason[entry.Reason] = total
+		}
+	}
+	return report
+}
+
+var (
+	ErrCashRegisterRequired     = &PaymentError{Code: "CASH_REGISTER_REQUIRED", Message: "Register ID is required"}
+	ErrInvalidCashAmount        = &PaymentError{Code: "INVALID_CASH_AMOUNT", Message: "Invalid cash amount"}
+	ErrInvalidCashEntryType     = &PaymentError{Code: "INVALID_CASH_ENTRY_TYPE", Message: "Invalid cash entry type"}
+	ErrCashPaymentTarget        = &PaymentError{Code: "CASH_PAYMENT_TARGET", Message: "A cash payment is for exactly one invoice or order"}
+	ErrCashReasonRequired       = &PaymentError{Code: "CASH_REASON_REQUIRED", Message: "Paid-ins and paid-outs need a reason"}
+	ErrCashPaidOutExceedsDrawer = &PaymentError{Code: "CASH_PAID_OUT_EXCEEDS_DRAWER", Message: "Paid-out is more than the drawer holds"}
+	ErrCashSessionClosed        = &PaymentError{Code: "CASH_SESSION_CLOSED", Message: "Cash session is closed"}
+)
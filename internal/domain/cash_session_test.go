@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCashSessionRecordAndClose(t *testing.T) {
+	_, err := NewCashSession(uuid.New(), " ", "EUR", decimal.NewFromInt(100), uuid.New())
+	assert.Equal(t, ErrCashRegisterRequired, err)
+	_, err = NewCashSession(uuid.New(), "till-1", "EUR", decimal.NewFromInt(-1), uuid.New())
+	assert.Equal(t, ErrInvalidCashAmount, err)
+
+	session, err := NewCashSession(uuid.New(), " till-1 ", "eur", decimal.NewFromInt(100), uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, "till-1", session.RegisterID)
+	assert.Equal(t, "EUR", session.Currency)
+	assert.Equal(t, CashSessionStatusOpen, session.Status)
+
+	invoiceID, orderID := uuid.New(), uuid.New()
+	entry, err := session.Record(CashEntry{Type: CashEntryPayment, Amount: decimal.RequireFromString("45.50"), InvoiceID: &invoiceID})
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, entry.ID)
+	_, err = session.Record(CashEntry{Type: CashEntryPayment, Amount: decimal.NewFromInt(20), OrderID: &orderID})
+	require.NoError(t, err)
+	_, err = session.Record(CashEntry{Type: CashEntryPaidIn, Amount: decimal.NewFromInt(50), Reason: "change from safe"})
+	require.NoError(t, err)
+	_, err = session.Record(CashEntry{Type: CashEntryPaidOut, Amount: decimal.NewFromInt(10), Reason: "postage"})
+	require.NoError(t, err)
+	assert.Equal(t, "205.5", session.Expected.String())
+
+	_, err = session.Record(CashEntry{Type: CashEntryPayment, Amount: decimal.NewFromInt(1)})
+	assert.Equal(t, ErrCashPaymentTarget, err)
+	_, err = session.Record(CashEntry{Type: CashEntryPayment, Amount: decimal.NewFromInt(1), InvoiceID: &invoiceID, OrderID: &orderID})
+	assert.Equal(t, ErrCashPaymentTarget, err)
+	_, err = session.Record(CashEntry{Type: CashEntryPaidOut, Amount: decimal.NewFromInt(1), Reason: " "})
+	assert.Equal(t, ErrCashReasonRequired, err)
+	_, err = session.Record(CashEntry{Type: CashEntryPaidOut, Amount: decimal.NewFromInt(300), Reason: "bank drop"})
+	assert.Equal(t, ErrCashPaidOutExceedsDrawer, err)
+	_, err = session.Record(CashEntry{Type: CashEntryPaidIn, Amount: decimal.Zero, Reason: "float"})
+	assert.Equal(t, ErrInvalidCashAmount, err)
+	_, err = session.Record(CashEntry{Type: "refund", Amount: decimal.NewFromInt(1)})
+	assert.Equal(t, ErrInvalidCashEntryType, err)
+	assert.Len(t, session.Entries, 4)
+
+	require.NoError(t, session.Close(decimal.NewFromInt(200), " short ", uuid.New()))
+	assert.Equal(t, CashSessionStatusClosed, session.Status)
+	assert.Equal(t, "-5.5", session.Variance.String())
+	assert.Equal(t, "short", session.CloseNotes)
+	assert.Equal(t, ErrCashSessionClosed, session.Close(decimal.NewFromInt(200), "", uuid.New()))
+	_, err = session.Record(CashEntry{Type: CashEntryPaidIn, Amount: decimal.NewFromInt(1), Reason: "late"})
+	assert.Equal(t, ErrCashSessionClosed, err)
+}
+
+func TestCashSessionZReport(t *testing.T) {
+	session, err := NewCashSession(uuid.New(), "till-1", "EUR", decimal.NewFromInt(100), uuid.New())
+	require.NoError(t, err)
+	invoiceID, orderID := uuid.New(), uuid.New()
+	session.Record(CashEntry{Type: CashEntryPayment, Amount: decimal.NewFromInt(30), InvoiceID: &invoiceID})
+	session.Record(CashEntry{Type: CashEntryPayment, Amount: decimal.NewFromInt(12), OrderID: &orderID})
+	session.Record(CashEntry{Type: CashEntryPaidOut, Amount: decimal.NewFromInt(5), Reason: "postage"})
+	session.Record(CashEntry{Type: CashEntryPaidOut, Amount: decimal.NewFromInt(7), Reason: "postage"})
+
+	report := session.ZReport()
+	assert.False(t, report.Final)
+	assert.Nil(t, report.Variance)
+	assert.Equal(t, 2, report.Payments.Count)
+	assert.Equal(t, "42", report.Payments.Amount.String())
+	assert.Equal(t, "30", report.InvoicePayments.Amount.String())
+	assert.Equal(t, "12", report.OrderPayments.Amount.String())
+	assert.Equal(t, 0, report.PaidIn.Count)
+	assert.Equal(t, 2, report.PaidOutByReason["postage"].Count)
+	assert.Equal(t, "130", report.Expected.String())
+
+	require.NoError(t, session.Close(decimal.NewFromInt(131), "", uuid.New()))
+	report = session.ZReport()
+	assert.True(t, report.Final)
+	assert.Equal(t, "131", report.Counted.String())
+	assert.Equal(t, "1", report.Variance.String())
+}
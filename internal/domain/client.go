@@ -43,6 +43,7 @@ type Client struct {
 	Name              string
 	Email             string
 	Phone             string
+	Locale            string
 	Status            ClientStatus
 	CreditLimit       decimal.Decimal
 	CurrentBalance    decimal.Decimal
@@ -53,6 +54,8 @@ type Client struct {
 	Version           int64
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
+
+	Ownership
 }
 
 func NewClient(tenantID uuid.UUID, name, email string) *Client {
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"regexp"
+	"time"
+)
+
+// Entities comments can be attached to.
+const (
+	CommentOnInvoice  = "invoice"
+	CommentOnOrder    = "order"
+	CommentOnClient   = "client"
+	CommentOnDocument = "document"
+)
+
+// ValidCommentEntity reports whether comments can be attached to entityType.
+func ValidCommentEntity(entityType string) bool {
+	switch entityType {
+	case CommentOnInvoice, CommentOnOrder, CommentOnClient, CommentOnDocument:
+		return true
+	}
+	return false
+}
+
+// CommentEdit is a body a comment had before it was edited.
+type CommentEdit struct {
+	Body     string    `json:"body" bson:"body"`
+	EditedAt time.Time `json:"editedAt" bson:"editedAt"`
+}
+
+// Comment is a note a user left on an entity. Mentions are the IDs of the
+// users mentioned in Body; History keeps the bodies it had before edits.
+type Comment struct {
+	ID         string        `json:"id" bson:"_id"`
+	TenantID   string        `json:"tenantId" bson:"tenantId"`
+	EntityType string        `json:"entityType" bson:"entityType"`
+	EntityID   string        `json:"entityId" bson:"entityId"`
+	AuthorID   string        `json:"authorId" bson:"authorId"`
+	Body       string        `json:"body" bson:"body"`
+	Mentions   []string      `json:"mentions,omitempty" bson:"mentions,omitempty"`
+	History    []CommentEdit `json:"history,omitempty" bson:"history,omitempty"`
+	CreatedAt  time.Time     `json:"createdAt" bson:"createdAt"`
+	EditedAt   *time.Time    `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	SoftDelete `bson:",inline"`
+}
+
+// mention matches the markup the frontend writes for a mention,
+// @[Display Name](user-id).
+var mention = regexp.MustCompile(`@\[[^\]\n]*\]\(([A-Za-z0-9-]{1,64})\)`)
+
+// ParseMentions returns the IDs of the users body mentions, each once, in
+// the order they are first mentioned.
+func ParseMentions(body string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, match := range mention.FindAllStringSubmatch(body, -1) {
+		if id := match[1]; !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	body := "@[Ana Lopez](user-1) can you check this with @[Bo](user-2)? cc @[Ana Lopez](user-1), mail ana@example.com"
+	assert.Equal(t, []string{"user-1", "user-2"}, ParseMentions(body))
+	assert.Empty(t, ParseMentions("no mentions, just @ana and @[Bo]()"))
+}
+
+func TestValidCommentEntity(t *testing.T) {
+	assert.True(t, ValidCommentEntity(CommentOnInvoice))
+	assert.True(t, ValidCommentEntity(CommentOnDocument))
+	assert.False(t, ValidCommentEntity("payment"))
+}
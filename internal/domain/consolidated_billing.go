@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type BillingFrequency string
+
+const (
+	BillingFrequencyWeekly  BillingFrequency = "weekly"
+	BillingFrequencyMonthly BillingFrequency = "monthly"
+)
+
+// ConsolidatedBilling bills a client's delivered orders on one invoice per
+// billing period instead of one per order. LastPeriod is the last period
+// the client was billed for.
+type ConsolidatedBilling struct {
+	ID          uuid.UUID        `json:"id" bson:"_id"`
+	TenantID    uuid.UUID        `json:"tenantId" bson:"tenantId"`
+	ClientID    uuid.UUID        `json:"clientId" bson:"clientId"`
+	Frequency   BillingFrequency `json:"frequency" bson:"frequency"`
+	PaymentTerm PaymentTerm      `json:"paymentTerm" bson:"paymentTerm"`
+	LastPeriod  string           `json:"lastPeriod,omitempty" bson:"lastPeriod,omitempty"`
+	UpdatedBy   uuid.UUID        `json:"updatedBy" bson:"updatedBy"`
+	CreatedAt   time.Time        `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt" bson:"updatedAt"`
+}
+
+// NewConsolidatedBilling bills the client's orders every frequency, on
+// invoices with paymentTerm, net 30 by default.
+func NewConsolidatedBilling(tenantID, clientID uuid.UUID, frequency BillingFrequency, paymentTerm PaymentTerm, updatedBy uuid.UUID) (*ConsolidatedBilling, error) {
+	if frequency != BillingFrequencyWeekly && frequency != BillingFrequencyMonthly {
+		return nil, ErrInvalidBillingFrequency
+	}
+	if paymentTerm == "" {
+		paymentTerm = PaymentTermNet30
+	}
+	now := time.Now().UTC()
+	return &ConsolidatedBilling{
+		ID:          uuid.New(),
+		TenantID:    tenantID,
+		ClientID:    clientID,
+		Frequency:   frequency,
+		PaymentTerm: paymentTerm,
+		UpdatedBy:   updatedBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// BillingPeriod is the span of days, from Start up to End, whose
+// deliveries one consolidated invoice bills. Key names it: 2026-W41 for a
+// week, 2026-10 for a month.
+type BillingPeriod struct {
+	Key   string    `json:"key"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ClosedPeriod returns the last billing period that ended by now in loc:
+// the week up to the latest Monday, or the month up to the 1st.
+func (b *ConsolidatedBilling) ClosedPeriod(now time.Time, loc *time.Location) BillingPeriod {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	if b.Frequency == BillingFrequencyWeekly {
+		end := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		start := end.AddDate(0, 0, -7)
+		year, week := start.ISOWeek()
+		return BillingPeriod{Key: fmt.Sprintf("%d-W%02d", year, week), Start: start, End: end}
+	}
+	end := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	start := end.AddDate(0, -1, 0)
+	return BillingPeriod{Key: start.Format("2006-01"), Start: start, End: end}
+}
+
+// consolidatedInvoices names the IDs of consolidated invoices.
+var consolidatedInvoices = uuid.MustParse("5b1f0c8e-3a5d-4f6e-9c21-7d4e8a0b6f13")
+
+// ConsolidatedInvoiceID is the ID of the client's consolidated invoice for
+// a billing period and currency. It is the same on every run, so a period
+// is never invoiced twice.
+func ConsolidatedInvoiceID(tenantID, clientID uuid.UUID, period, currency string) uuid.UUID {
+	return uuid.NewSHA1(consolidatedInvoices, []byte(tenantID.String()+"/"+clientID.String()+"/"+period+"/"+currency))
+}
+
+// ConsolidateOrders adds the lines of delivered orders to the invoice,
+// grouped by order in order of delivery, each group followed by the
+// order's shipping and handling. Every line keeps the order it came from.
+func (i *Invoice) ConsolidateOrders(orders []*Order) {
+	orders = append([]*Order(nil), orders...)
+	sort.SliceStable(orders, func(a, b int) bool {
+		if !deliveredAt(orders[a]).Equal(deliveredAt(orders[b])) {
+			return deliveredAt(orders[a]).Before(deliveredAt(orders[b]))
+		}
+		return orders[a].OrderNumber < orders[b].OrderNumber
+	})
+
+	for _, order := range orders {
+		orderID := order.ID
+		add := func(line InvoiceLine) {
+			line.OrderID = &orderID
+			line.OrderNumber = order.OrderNumber
+			line.ServiceDate = order.DeliveredDate
+			line.SortOrder = len(i.Lines) + 1
+			i.AddLine(line)
+		}
+		for _, line := range order.Lines {
+			productID := line.ProductID
+			add(InvoiceLine{
+				Description: line.Name,
+				Quantity:    decimal.NewFromInt(int64(line.Quantity)),
+				UnitPrice:   line.UnitPrice,
+				Discount:    line.Discount,
+				TaxRate:     line.TaxRate,
+				ProductID:   &productID,
+			})
+		}
+		for _, charge := range []struct {
+			name   string
+			amount decimal.Decimal
+		}{{"Shipping", order.ShippingTotal}, {"Handling", order.HandlingTotal}} {
+			if charge.amount.IsPositive() {
+				add(InvoiceLine{Description: charge.name, Quantity: decimal.NewFromInt(1), UnitPrice: charge.amount})
+			}
+		}
+	}
+}
+
+// InvoicedOrders returns the IDs of the orders the invoice's lines came
+// from, in the order of the lines.
+func (i *Invoice) InvoicedOrders() []uuid.UUID {
+	var ids []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, line := range i.Lines {
+		if line.OrderID != nil && !seen[*line.OrderID] {
+			seen[*line.OrderID] = true
+			ids = append(ids, *line.OrderID)
+		}
+	}
+	return ids
+}
+
+func deliveredAt(order *Order) time.Time {
+	if order.DeliveredDate == nil {
+		return time.Time{}
+	}
+	return *order.DeliveredDate
+}
+
+var ErrInvalidBillingFrequency = &PaymentError{Code: "INVALID_BILLING_FREQUENCY", Message: "frequency must be weekly or monthly"}
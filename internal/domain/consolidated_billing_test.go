@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsolidatedBilling_ClosedPeriod(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// Wednesday 15 October 2026, 00:30 in Berlin.
+	now := time.Date(2026, 10, 14, 22, 30, 0, 0, time.UTC)
+
+	monthly := &ConsolidatedBilling{Frequency: BillingFrequencyMonthly}
+	period := monthly.ClosedPeriod(now, loc)
+	assert.Equal(t, "2026-09", period.Key)
+	assert.Equal(t, time.Date(2026, 9, 1, 0, 0, 0, 0, loc), period.Start)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, loc), period.End)
+
+	weekly := &ConsolidatedBilling{Frequency: BillingFrequencyWeekly}
+	period = weekly.ClosedPeriod(now, loc)
+	assert.Equal(t, "2026-W41", period.Key)
+	assert.Equal(t, time.Date(2026, 10, 5, 0, 0, 0, 0, loc), period.Start)
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, loc), period.End)
+
+	monday := time.Date(2026, 10, 12, 8, 0, 0, 0, loc)
+	assert.Equal(t, "2026-W41", weekly.ClosedPeriod(monday, loc).Key, "a week closes on Monday")
+
+	_, err = NewConsolidatedBilling(uuid.New(), uuid.New(), "daily", "", uuid.New())
+	assert.ErrorIs(t, err, ErrInvalidBillingFrequency)
+}
+
+func TestInvoice_ConsolidateOrders(t *testing.T) {
+	first, second := time.Date(2026, 9, 3, 0, 0, 0, 0, time.UTC), time.Date(2026, 9, 10, 0, 0, 0, 0, time.UTC)
+	later := &Order{ID: uuid.New(), OrderNumber: "SO-2", DeliveredDate: &second, Lines: []OrderLine{
+		{ProductID: uuid.New(), Name: "Bolt", Quantity: 10, UnitPrice: decimal.NewFromInt(2), TaxRate: decimal.NewFromInt(20)},
+	}}
+	earlier := &Order{ID: uuid.New(), OrderNumber: "SO-1", DeliveredDate: &first, ShippingTotal: decimal.NewFromInt(5), Lines: []OrderLine{
+		{ProductID: uuid.New(), Name: "Nut", Quantity: 4, UnitPrice: decimal.NewFromInt(3), Discount: decimal.NewFromInt(2)},
+		{ProductID: uuid.New(), Name: "Washer", Quantity: 1, UnitPrice: decimal.NewFromInt(1)},
+	}}
+
+	invoice := &Invoice{Currency: "EUR"}
+	invoice.ConsolidateOrders([]*Order{later, earlier})
+
+	require.Len(t, invoice.Lines, 4)
+	var numbers, descriptions []string
+	for i, line := range invoice.Lines {
+		assert.Equal(t, i+1, line.SortOrder)
+		numbers = append(numbers, line.OrderNumber)
+		descriptions = append(descriptions, line.Description)
+	}
+	assert.Equal(t, []string{"SO-1", "SO-1", "SO-1", "SO-2"}, numbers)
+	assert.Equal(t, []string{"Nut", "Washer", "Shipping", "Bolt"}, descriptions)
+	assert.Equal(t, []uuid.UUID{earlier.ID, later.ID}, invoice.InvoicedOrders())
+	assert.Equal(t, "10", invoice.Lines[0].Total.String(), "order line discounts carry over")
+	assert.Equal(t, "40", invoice.Total.String())
+}
@@ -0,0 +1,352 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// DeliveryDateLayout is the layout of DeliveryRoute.DeliveryDate, a day in
+// the tenant's time zone.
+const DeliveryDateLayout = "2006-01-02"
+
+type DeliveryRouteStatus string
+
+const (
+	DeliveryRouteStatusPlanned    DeliveryRouteStatus = "planned"
+	DeliveryRouteStatusDispatched DeliveryRouteStatus = "dispatched"
+	DeliveryRouteStatusCompleted  DeliveryRouteStatus = "completed"
+)
+
+type DeliveryStopStatus string
+
+const (
+	DeliveryStopStatusScheduled      DeliveryStopStatus = "scheduled"
+	DeliveryStopStatusOutForDelivery DeliveryStopStatus = "out_for_delivery"
+	DeliveryStopStatusDelivered      DeliveryStopStatus = "delivered"
+	DeliveryStopStatusFailed         DeliveryStopStatus = "failed"
+)
+
+// DeliveryRoute is one vehicle's run on a delivery date: the shipments it
+// carries, in the order they are dropped off. CapacityWeight and MaxStops
+// limit what can be assigned to it; zero means no limit.
+type DeliveryRoute struct {
+	ID             uuid.UUID           `json:"id" bson:"_id"`
+	TenantID       uuid.UUID           `json:"tenantId" bson:"tenantId"`
+	WarehouseID    uuid.UUID           `json:"warehouseId" bson:"warehouseId"`
+	Name           string              `json:"name" bson:"name"`
+	DeliveryDate   string              `json:"deliveryDate" bson:"deliveryDate"`
+	Vehicle        string              `json:"vehicle" bson:"vehicle"`
+	CapacityWeight decimal.Decimal     `json:"capacityWeight" bson:"capacityWeight"`
+	MaxStops       int                 `json:"maxStops" bson:"maxStops"`
+	DriverID       *uuid.UUID          `json:"driverId" bson:"driverId"`
+	DriverName     string              `json:"driverName" bson:"driverName"`
+	Status         DeliveryRouteStatus `json:"status" bson:"status"`
+	Stops          []DeliveryStop      `json:"stops" bson:"stops"`
+	DispatchedAt   *time.Time          `json:"dispatchedAt" bson:"dispatchedAt"`
+	CompletedAt    *time.Time          `json:"completedAt" bson:"completedAt"`
+	CreatedBy      uuid.UUID           `json:"createdBy" bson:"createdBy"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time           `json:"updatedAt" bson:"updatedAt"`
+	Version        int64               `json:"-" bson:"version"`
+}
+
+// DeliveryStop drops off one shipment of an order. The slot, when set, is
+// the window promised to the customer.
+type DeliveryStop struct {
+	ID                 uuid.UUID          `json:"id" bson:"_id"`
+	Sequence           int                `json:"sequence" bson:"sequence"`
+	OrderID            uuid.UUID          `json:"orderId" bson:"orderId"`
+	OrderNumber        string             `json:"orderNumber" bson:"orderNumber"`
+	ShipmentID         uuid.UUID          `json:"shipmentId" bson:"shipmentId"`
+	TrackingNumber     string             `json:"trackingNumber" bson:"trackingNumber"`
+	DeliveryNoteNumber string             `json:"deliveryNoteNumber,omitempty" bson:"deliveryNoteNumber,omitempty"`
+	Recipient          string             `json:"recipient" bson:"recipient"`
+	Address            Address            `json:"address" bson:"address"`
+	Weight             decimal.Decimal    `json:"weight" bson:"weight"`
+	Parcels            int                `json:"parcels" bson:"parcels"`
+	SlotStart          *time.Time         `json:"slotStart" bson:"slotStart"`
+	SlotEnd            *time.Time         `json:"slotEnd" bson:"slotEnd"`
+	Notes              string             `json:"notes" bson:"notes"`
+	Status             DeliveryStopStatus `json:"status" bson:"status"`
+	DeliveredAt        *time.Time         `json:"deliveredAt" bson:"deliveredAt"`
+	ReceivedBy         string             `json:"receivedBy" bson:"receivedBy"`
+	ProofOfDeliveryID  *uuid.UUID         `json:"proofOfDeliveryId" bson:"proofOfDeliveryId"`
+	FailureReason      string             `json:"failureReason" bson:"failureReason"`
+}
+
+func (s *DeliveryStop) isOpen() bool {
+	return s.Status == DeliveryStopStatusScheduled || s.Status == DeliveryStopStatusOutForDelivery
+}
+
+func NewDeliveryRoute(
+	tenantID, warehouseID, createdBy uuid.UUID,
+	name, deliveryDate, vehicle string,
+	capacityWeight decimal.Decimal,
+	maxStops int,
+) (*DeliveryRoute, error) {
+	if _, err := time.Parse(DeliveryDateLayout, deliveryDate); err != nil {
+		return nil, ErrInvalidDeliveryDate
+	}
+	if capacityWeight.IsNegative() || maxStops < 0 {
+		return nil, ErrInvalidRouteCapacity
+	}
+
+	now := time.Now().UTC()
+	return &DeliveryRoute{
+		ID:             uuid.New(),
+		TenantID:       tenantID,
+		WarehouseID:    warehouseID,
+		Name:           strings.TrimSpace(name),
+		DeliveryDate:   deliveryDate,
+		Vehicle:        strings.TrimSpace(vehicle),
+		CapacityWeight: capacityWeight,
+		MaxStops:       maxStops,
+		Status:         DeliveryRouteStatusPlanned,
+		Stops:          []DeliveryStop{},
+		CreatedBy:      createdBy,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}, nil
+}
+
+// Load is the weight of the shipments assigned to the route.
+func (r *DeliveryRoute) Load() decimal.Decimal {
+	load := decimal.Zero
+	for _, stop := range r.Stops {
+		load = load.Add(stop.Weight)
+	}
+	return load
+}
+
+// AddStop assigns a shipment to the route as its last stop, as long as the
+// vehicle has room for it, and returns the stop with its ID set.
+func (r *DeliveryRoute) AddStop(stop DeliveryStop) (*DeliveryStop, error) {
+	if r.Status != DeliveryRouteStatusPlanned {
+		return nil, ErrRouteNotPlanned
+	}
+	if r.FindStop(stop.ShipmentID) != nil {
+		return nil, ErrShipmentAlreadyRouted
+	}
+	if stop.SlotStart != nil && stop.SlotEnd != nil && !stop.SlotEnd.After(*stop.SlotStart) {
+		return nil, ErrInvalidDeliverySlot
+	}
+	if r.MaxStops > 0 && len(r.Stops) >= r.MaxStops {
+		return nil, ErrRouteCapacityExceeded
+	}
+	if r.CapacityWeight.IsPositive() && r.Load().Add(stop.Weight).GreaterThan(r.CapacityWeight) {
+		return nil, ErrRouteCapacityExceeded
+	}
+
+	stop.ID = uuid.New()
+	stop.Sequence = len(r.Stops) + 1
+	stop.Status = DeliveryStopStatusScheduled
+	r.Stops = append(r.Stops, stop)
+	r.UpdatedAt = time.Now().UTC()
+	return &r.Stops[len(r.Stops)-1], nil
+}
+
+// RemoveStop takes a shipment off a planned route and closes the gap in
+// the sequence.
+func (r *DeliveryRoute) RemoveStop(shipmentID uuid.UUID) error {
+	if r.Status != DeliveryRouteStatusPlanned {
+		return ErrRouteNotPlanned
+	}
+	stops := make([]DeliveryStop, 0, len(r.Stops))
+	for _, stop := range r.Stops {
+		if stop.ShipmentID != shipmentID {
+			stops = append(stops, stop)
+		}
+	}
+	if len(stops) == len(r.Stops) {
+		return ErrDeliveryStopNotFound
+	}
+	r.Stops = stops
+	r.renumber()
+	return nil
+}
+
+// FindStop returns the stop of a shipment, or nil when the route does not
+// carry it.
+func (r *DeliveryRoute) FindStop(shipmentID uuid.UUID) *DeliveryStop {
+	for i := range r.Stops {
+		if r.Stops[i].ShipmentID == shipmentID {
+			return &r.Stops[i]
+		}
+	}
+	return nil
+}
+
+// SequenceStops puts the stops in the order of shipmentIDs, which must name
+// every shipment on the route once.
+func (r *DeliveryRoute) SequenceStops(shipmentIDs []uuid.UUID) error {
+	if r.Status != DeliveryRouteStatusPlanned {
+		return ErrRouteNotPlanned
+	}
+	if len(shipmentIDs) != len(r.Stops) {
+		return ErrInvalidStopSequence
+	}
+	position := make(map[uuid.UUID]int, len(shipmentIDs))
+	for i, id := range shipmentIDs {
+		if _, seen := position[id]; seen || r.FindStop(id) == nil {
+			return ErrInvalidStopSequence
+		}
+		position[id] = i
+	}
+	sort.SliceStable(r.Stops, func(i, j int) bool {
+		return position[r.Stops[i].ShipmentID] < position[r.Stops[j].ShipmentID]
+	})
+	r.renumber()
+	return nil
+}
+
+// PlanSequence orders the stops by the end of their slot, so that the
+// tightest promises are kept first, then by the start of it, and groups
+// the rest by postal code and street so that neighbours are visited
+// together. Stops without a slot go last.
+func (r *DeliveryRoute) PlanSequence() error {
+	if r.Status != DeliveryRouteStatusPlanned {
+		return ErrRouteNotPlanned
+	}
+	sort.SliceStable(r.Stops, func(i, j int) bool {
+		a, b := r.Stops[i], r.Stops[j]
+		if c := compareSlotTime(a.SlotEnd, b.SlotEnd); c != 0 {
+			return c < 0
+		}
+		if c := compareSlotTime(a.SlotStart, b.SlotStart); c != 0 {
+			return c < 0
+		}
+		if a.Address.PostalCode != b.Address.PostalCode {
+			return a.Address.PostalCode < b.Address.PostalCode
+		}
+		return a.Address.Street < b.Address.Street
+	})
+	r.renumber()
+	return nil
+}
+
+// compareSlotTime orders slot times, earliest first and unset last.
+func compareSlotTime(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case a.Before(*b):
+		return -1
+	case b.Before(*a):
+		return 1
+	}
+	return 0
+}
+
+func (r *DeliveryRoute) renumber() {
+	for i := range r.Stops {
+		r.Stops[i].Sequence = i + 1
+	}
+	r.UpdatedAt = time.Now().UTC()
+}
+
+// Dispatch hands the route to its driver and puts every stop out for
+// delivery.
+func (r *DeliveryRoute) Dispatch(driverID uuid.UUID, driverName string) error {
+	if r.Status != DeliveryRouteStatusPlanned {
+		return ErrRouteNotPlanned
+	}
+	if len(r.Stops) == 0 {
+		return ErrRouteEmpty
+	}
+	now := time.Now().UTC()
+	r.DriverID = &driverID
+	r.DriverName = strings.TrimSpace(driverName)
+	for i := range r.Stops {
+		r.Stops[i].Status = DeliveryStopStatusOutForDelivery
+	}
+	r.Status = DeliveryRouteStatusDispatched
+	r.DispatchedAt = &now
+	r.UpdatedAt = now
+	return nil
+}
+
+// Deliver records that a shipment was handed over to receivedBy, with the
+// proof of delivery photo stored in the document service. The route is
+// completed with its last open stop.
+func (r *DeliveryRoute) Deliver(shipmentID uuid.UUID, receivedBy string, proofOfDeliveryID uuid.UUID, deliveredAt time.Time) (*DeliveryStop, error) {
+	stop, err := r.outForDelivery(shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	if proofOfDeliveryID == uuid.Nil {
+		return nil, ErrProofOfDeliveryRequired
+	}
+	deliveredAt = deliveredAt.UTC()
+	stop.Status = DeliveryStopStatusDelivered
+	stop.DeliveredAt = &deliveredAt
+	stop.ReceivedBy = strings.TrimSpace(receivedBy)
+	stop.ProofOfDeliveryID = &proofOfDeliveryID
+	r.completeIfDone()
+	return stop, nil
+}
+
+// FailStop records that a shipment could not be delivered. The route is
+// completed with its last open stop.
+func (r *DeliveryRoute) FailStop(shipmentID uuid.UUID, reason string) (*DeliveryStop, error) {
+	stop, err := r.outForDelivery(shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrDeliveryFailureReason
+	}
+	stop.Status = DeliveryStopStatusFailed
+	stop.FailureReason = strings.TrimSpace(reason)
+	r.completeIfDone()
+	return stop, nil
+}
+
+func (r *DeliveryRoute) outForDelivery(shipmentID uuid.UUID) (*DeliveryStop, error) {
+	if r.Status != DeliveryRouteStatusDispatched {
+		return nil, ErrRouteNotDispatched
+	}
+	stop := r.FindStop(shipmentID)
+	if stop == nil {
+		return nil, ErrDeliveryStopNotFound
+	}
+	if stop.Status != DeliveryStopStatusOutForDelivery {
+		return nil, ErrDeliveryStopClosed
+	}
+	return stop, nil
+}
+
+func (r *DeliveryRoute) completeIfDone() {
+	now := time.Now().UTC()
+	r.UpdatedAt = now
+	for i := range r.Stops {
+		if r.Stops[i].isOpen() {
+			return
+		}
+	}
+	r.Status = DeliveryRouteStatusCompleted
+	r.CompletedAt = &now
+}
+
+var (
+	ErrInvalidDeliveryDate     = &OrderError{Code: "INVALID_DELIVERY_DATE", Message: "Delivery date must be formatted as YYYY-MM-DD"}
+	ErrInvalidRouteCapacity    = &OrderError{Code: "INVALID_ROUTE_CAPACITY", Message: "Route capacity cannot be negative"}
+	ErrInvalidDeliverySlot     = &OrderError{Code: "INVALID_DELIVERY_SLOT", Message: "Delivery slot must end after it starts"}
+	ErrRouteCapacityExceeded   = &OrderError{Code: "ROUTE_CAPACITY_EXCEEDED", Message: "Shipment does not fit on the route's vehicle"}
+	ErrShipmentAlreadyRouted   = &OrderError{Code: "SHIPMENT_ALREADY_ROUTED", Message: "Shipment is already on a delivery route"}
+	ErrRouteNotPlanned         = &OrderError{Code: "ROUTE_NOT_PLANNED", Message: "Delivery route has already been dispatched"}
+	ErrRouteNotDispatched      = &OrderError{Code: "ROUTE_NOT_DISPATCHED", Message: "Delivery route is not out for delivery"}
+	ErrRouteEmpty              = &OrderError{Code: "ROUTE_EMPTY", Message: "Delivery route has no stops"}
+	ErrInvalidStopSequence     = &OrderError{Code: "INVALID_STOP_SEQUENCE", Message: "Stop sequence must list every shipment on the route once"}
+	ErrDeliveryStopNotFound    = &OrderError{Code: "DELIVERY_STOP_NOT_FOUND", Message: "Shipment is not on the delivery route"}
+	ErrDeliveryStopClosed      = &OrderError{Code: "DELIVERY_STOP_CLOSED", Message: "Delivery stop is not out for delivery"}
+	ErrProofOfDeliveryRequired = &OrderError{Code: "PROOF_OF_DELIVERY_REQUIRED", Message: "A proof of delivery photo is required"}
+	ErrDeliveryFailureReason   = &OrderError{Code: "DELIVERY_FAILURE_REASON_REQUIRED", Message: "A reason is required for a failed delivery"}
+)
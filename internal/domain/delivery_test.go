@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRoute(t *testing.T, capacity int64, maxStops int) *DeliveryRoute {
+	route, err := NewDeliveryRoute(uuid.New(), uuid.New(), uuid.New(), "North", "2026-10-17", "VAN-12", decimal.NewFromInt(capacity), maxStops)
+	require.NoError(t, err)
+	return route
+}
+
+func TestNewDeliveryRoute(t *testing.T) {
+	route := newTestRoute(t, 500, 10)
+	assert.Equal(t, DeliveryRouteStatusPlanned, route.Status)
+	assert.Empty(t, route.Stops)
+
+	_, err := NewDeliveryRoute(uuid.New(), uuid.New(), uuid.New(), "", "17/10/2026", "", decimal.Zero, 0)
+	assert.Equal(t, ErrInvalidDeliveryDate, err)
+	_, err = NewDeliveryRoute(uuid.New(), uuid.New(), uuid.New(), "", "2026-10-17", "", decimal.NewFromInt(-1), 0)
+	assert.Equal(t, ErrInvalidRouteCapacity, err)
+}
+
+func TestDeliveryRouteAddStopCapacity(t *testing.T) {
+	route := newTestRoute(t, 100, 2)
+
+	first, err := route.AddStop(DeliveryStop{ShipmentID: uuid.New(), Weight: decimal.NewFromInt(60)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.Sequence)
+	assert.Equal(t, DeliveryStopStatusScheduled, first.Status)
+
+	_, err = route.AddStop(DeliveryStop{ShipmentID: first.ShipmentID})
+	assert.Equal(t, ErrShipmentAlreadyRouted, err)
+	_, err = route.AddStop(DeliveryStop{ShipmentID: uuid.New(), Weight: decimal.NewFromInt(41)})
+	assert.Equal(t, ErrRouteCapacityExceeded, err, "the vehicle takes 100")
+
+	_, err = route.AddStop(DeliveryStop{ShipmentID: uuid.New(), Weight: decimal.NewFromInt(40)})
+	require.NoError(t, err)
+	_, err = route.AddStop(DeliveryStop{ShipmentID: uuid.New()})
+	assert.Equal(t, ErrRouteCapacityExceeded, err, "the route takes two stops")
+	assert.Equal(t, "100", route.Load().String())
+
+	start := time.Now()
+	unlimited := newTestRoute(t, 0, 0)
+	_, err = unlimited.AddStop(DeliveryStop{ShipmentID: uuid.New(), SlotStart: &start, SlotEnd: &start})
+	assert.Equal(t, ErrInvalidDeliverySlot, err)
+}
+
+func TestDeliveryRouteSequence(t *testing.T) {
+	route := newTestRoute(t, 0, 0)
+	morning := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	noon := morning.Add(3 * time.Hour)
+
+	open, _ := route.AddStop(DeliveryStop{ShipmentID: uuid.New(), Address: Address{PostalCode: "1000"}})
+	late, _ := route.AddStop(DeliveryStop{ShipmentID: uuid.New(), SlotEnd: &noon})
+	early, _ := route.AddStop(DeliveryStop{ShipmentID: uuid.New(), SlotEnd: &morning})
+	nearby, _ := route.AddStop(DeliveryStop{ShipmentID: uuid.New(), Address: Address{PostalCode: "0999"}})
+	ids := []uuid.UUID{open.ShipmentID, late.ShipmentID, early.ShipmentID, nearby.ShipmentID}
+
+	require.NoError(t, route.PlanSequence())
+	var planned []uuid.UUID
+	for i, stop := range route.Stops {
+		planned = append(planned, stop.ShipmentID)
+		assert.Equal(t, i+1, stop.Sequence)
+	}
+	assert.Equal(t, []uuid.UUID{ids[2], ids[1], ids[3], ids[0]}, planned)
+
+	require.NoError(t, route.SequenceStops(ids))
+	assert.Equal(t, ids[0], route.Stops[0].ShipmentID)
+	assert.Equal(t, ErrInvalidStopSequence, route.SequenceStops(ids[:3]))
+	assert.Equal(t, ErrInvalidStopSequence, route.SequenceStops([]uuid.UUID{ids[0], ids[0], ids[1], ids[2]}))
+
+	require.NoError(t, route.RemoveStop(ids[1]))
+	assert.Len(t, route.Stops, 3)
+	assert.Equal(t, 2, route.FindStop(ids[2]).Sequence)
+	assert.Equal(t, ErrDeliveryStopNotFound, route.RemoveStop(ids[1]))
+}
+
+func TestDeliveryRouteDispatchAndDeliver(t *testing.T) {
+	route := newTestRoute(t, 0, 0)
+	driver := uuid.New()
+	assert.Equal(t, ErrRouteEmpty, route.Dispatch(driver, "Ivan"))
+
+	first, _ := route.AddStop(DeliveryStop{ShipmentID: uuid.New()})
+	second, _ := route.AddStop(DeliveryStop{ShipmentID: uuid.New()})
+	firstID, secondID := first.ShipmentID, second.ShipmentID
+
+	_, err := route.Deliver(firstID, "Jane", uuid.New(), time.Now())
+	assert.Equal(t, ErrRouteNotDispatched, err)
+
+	require.NoError(t, route.Dispatch(driver, "Ivan"))
+	assert.Equal(t, DeliveryRouteStatusDispatched, route.Status)
+	assert.Equal(t, DeliveryStopStatusOutForDelivery, route.Stops[0].Status)
+	_, err = route.AddStop(DeliveryStop{ShipmentID: uuid.New()})
+	assert.Equal(t, ErrRouteNotPlanned, err)
+
+	_, err = route.Deliver(firstID, "Jane", uuid.Nil, time.Now())
+	assert.Equal(t, ErrProofOfDeliveryRequired, err)
+
+	photo := uuid.New()
+	stop, err := route.Deliver(firstID, "Jane", photo, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryStopStatusDelivered, stop.Status)
+	assert.Equal(t, photo, *stop.ProofOfDeliveryID)
+	_, err = route.Deliver(firstID, "Jane", photo, time.Now())
+	assert.Equal(t, ErrDeliveryStopClosed, err)
+
+	_, err = route.FailStop(secondID, "")
+	assert.Equal(t, ErrDeliveryFailureReason, err)
+	stop, err = route.FailStop(secondID, "nobody home")
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryStopStatusFailed, stop.Status)
+	assert.Equal(t, DeliveryRouteStatusCompleted, route.Status)
+	assert.NotNil(t, route.CompletedAt)
+}
+
+func TestOrderDeliverShipment(t *testing.T) {
+	order, _ := NewOrder(uuid.New(), uuid.New(), uuid.New(), OrderTypeStandard, OrderSourceWeb, "EUR")
+	order.AddLine(OrderLine{ProductID: uuid.New(), Quantity: 3, UnitPrice: decimal.NewFromInt(5), Weight: decimal.RequireFromString("1.5")})
+	first := OrderFulfillment{ID: uuid.New(), Lines: []FulfillmentLine{{OrderLineID: order.Lines[0].ID, Quantity: 2}}}
+	second := OrderFulfillment{ID: uuid.New(), Lines: []FulfillmentLine{{OrderLineID: order.Lines[0].ID, Quantity: 1}}}
+	order.Fulfillments = append(order.Fulfillments, first, second)
+	order.Ship("TRK-1", "own fleet")
+
+	assert.Equal(t, "3", order.FulfillmentWeight(&order.Fulfillments[0]).String())
+	assert.Equal(t, ErrFulfillmentNotFound, order.DeliverShipment(uuid.New(), time.Now()))
+
+	require.NoError(t, order.DeliverShipment(first.ID, time.Now()))
+	assert.Equal(t, OrderStatusShipped, order.Status, "one shipment is still on its way")
+	require.NoError(t, order.DeliverShipment(second.ID, time.Now()))
+	assert.Equal(t, OrderStatusDelivered, order.Status)
+	assert.NotNil(t, order.DeliveredDate)
+}
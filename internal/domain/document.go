@@ -2,6 +2,8 @@ package domain
 
 import (
 	"context"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,6 +19,20 @@ const (
 	DocTypeContract      DocumentType = "contract"
 	DocTypeScanned       DocumentType = "scanned"
 	DocTypeOther         DocumentType = "other"
+
+	// DocTypeProofOfDelivery is a photo taken by the driver at a delivery
+	// stop.
+	DocTypeProofOfDelivery DocumentType = "proof_of_delivery"
+
+	// DocTypeQuote, DocTypeDeliveryNote and DocTypePackingSlip are
+	// generated from document templates.
+	DocTypeQuote        DocumentType = "quote"
+	DocTypeDeliveryNote DocumentType = "delivery_note"
+	DocTypePackingSlip  DocumentType = "packing_slip"
+
+	// DocTypeProductImage is a picture of a product, rendered for the
+	// catalogue.
+	DocTypeProductImage DocumentType = "product_image"
 )
 
 type ProcessingStatus string
@@ -29,25 +45,90 @@ const (
 )
 
 type Document struct {
-	ID                uuid.UUID
-	TenantID          uuid.UUID
-	Type              DocumentType
-	FileName          string
-	MimeType          string
-	Size              int64
-	Checksum          string
-	Bucket            string
-	ObjectKey         string
-	VersionID         string
-	ProcessingStatus  ProcessingStatus
-	ExtractedText     string
-	ThumbnailKey      string
-	PageCount         int
-	ExtractedMetadata DocumentMetadata
-	Tags              []string
-	UploadedBy        uuid.UUID
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
+	ID                uuid.UUID        `bson:"_id"`
+	TenantID          uuid.UUID        `bson:"tenantId"`
+	Type              DocumentType     `bson:"type"`
+	FileName          string           `bson:"fileName"`
+	MimeType          string           `bson:"mimeType"`
+	Size              int64            `bson:"size"`
+	Checksum          string           `bson:"checksum"`
+	Bucket            string           `bson:"bucket"`
+	ObjectKey         string           `bson:"objectKey"`
+	VersionID         string           `bson:"versionId"`
+	ProcessingStatus  ProcessingStatus `bson:"processingStatus"`
+	ExtractedText     string           `bson:"extractedText"`
+	ThumbnailKey      string           `bson:"thumbnailKey"`
+	PageCount         int              `bson:"pageCount"`
+	ExtractedMetadata DocumentMetadata `bson:"extractedMetadata"`
+	Tags              []string         `bson:"tags"`
+	UploadedBy        uuid.UUID        `bson:"uploadedBy"`
+	CreatedAt         time.Time        `bson:"createdAt"`
+	UpdatedAt         time.Time        `bson:"updatedAt"`
+	Version           int64            `bson:"version"`
+	// EntityType and EntityID link a document to the client, order or
+	// invoice it is about; TemplateID is the template it was generated
+	// from.
+	EntityType string     `bson:"entityType,omitempty"`
+	EntityID   string     `bson:"entityId,omitempty"`
+	TemplateID *uuid.UUID `bson:"templateId,omitempty"`
+	// ProcessingError is why the text of a failed document could not be
+	// read.
+	ProcessingError string `bson:"processingError,omitempty"`
+	// StorageClass is the tier the content is kept in, hot when empty. An
+	// archived document's content is in its bucket's archive and has to be
+	// restored, which RestoreStatus tracks, before it can be read again.
+	StorageClass  StorageClass  `bson:"storageClass,omitempty"`
+	ArchivedAt    *time.Time    `bson:"archivedAt,omitempty"`
+	RestoreStatus RestoreStatus `bson:"restoreStatus,omitempty"`
+	RestoredAt    *time.Time    `bson:"restoredAt,omitempty"`
+	// Renditions are the resized and converted copies rendered of an
+	// image, which RenditionStatus tracks the rendering of.
+	Renditions      []Rendition      `bson:"renditions,omitempty"`
+	RenditionStatus ProcessingStatus `bson:"renditionStatus,omitempty"`
+	SoftDelete      `bson:",inline"`
+}
+
+// Rendition is a copy of an image rendered for a use case, kept in the
+// document's bucket under ObjectKey.
+type Rendition struct {
+	Name        string `json:"name" bson:"name"`
+	ObjectKey   string `json:"objectKey" bson:"objectKey"`
+	ContentType string `json:"contentType" bson:"contentType"`
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+	Size        int64  `json:"size" bson:"size"`
+	Watermarked bool   `json:"watermarked,omitempty" bson:"watermarked,omitempty"`
+}
+
+// Rendition returns the document's rendition called name, or nil.
+func (d *Document) Rendition(name string) *Rendition {
+	for i := range d.Renditions {
+		if d.Renditions[i].Name == name {
+			return &d.Renditions[i]
+		}
+	}
+	return nil
+}
+
+// StorageClass is a storage tier.
+type StorageClass string
+
+const (
+	StorageClassHot     StorageClass = "hot"
+	StorageClassArchive StorageClass = "archive"
+)
+
+// RestoreStatus is how far an archived document's restore has come.
+type RestoreStatus string
+
+const (
+	RestoreStatusNone      RestoreStatus = ""
+	RestoreStatusRestoring RestoreStatus = "restoring"
+)
+
+// Archived reports whether the document's content is in the archive.
+func (d *Document) Archived() bool {
+	return d.StorageClass == StorageClassArchive
 }
 
 type DocumentMetadata struct {
@@ -69,8 +150,22 @@ type DocumentFilter struct {
 	DateFrom   *time.Time
 	DateTo     *time.Time
 	FileName   string
+	EntityType string
+	EntityID   string
 	Page       int
 	PageSize   int
+	// Cursor continues a listing after the last document of a previous
+	// page; Page is ignored when it is set.
+	Cursor string
+	// Deleted lists the trash instead of live documents.
+	Deleted bool
+}
+
+// DocumentPage is one page of a listing. NextCursor is empty on the last page.
+type DocumentPage struct {
+	Documents  []Document
+	Total      int64
+	NextCursor string
 }
 
 func (d *Document) IsValid() bool {
@@ -84,7 +179,8 @@ func (d *Document) IsValid() bool {
 func (t DocumentType) IsValid() bool {
 	switch t {
 	case DocTypeInvoice, DocTypePurchaseOrder, DocTypeReceipt,
-		DocTypeContract, DocTypeScanned, DocTypeOther:
+		DocTypeContract, DocTypeScanned, DocTypeOther,
+		DocTypeQuote, DocTypeDeliveryNote, DocTypeProductImage:
 		return true
 	}
 	return false
@@ -132,27 +228,54 @@ var (
 	ErrChecksumMismatch    = &DocumentError{Code: "CHECKSUM_MISMATCH", Message: "document checksum mismatch"}
 	ErrBucketNotFound      = &DocumentError{Code: "BUCKET_NOT_FOUND", Message: "bucket not found"}
 	ErrPresignedURLExpired = &DocumentError{Code: "PRESIGNED_URL_EXPIRED", Message: "presigned URL has expired"}
+	ErrDocumentArchived    = &DocumentError{Code: "DOCUMENT_ARCHIVED", Message: "document is archived and being restored; try again later"}
 )
 
 type DocumentRepository interface {
 	Create(ctx context.Context, doc *Document) error
 	GetByID(ctx context.Context, tenantID, id uuid.UUID) (*Document, error)
 	Update(ctx context.Context, doc *Document) error
+	// SoftDelete moves a document to the trash; Restore takes it back out.
+	// Both report ErrDocumentNotFound when the document is not in the
+	// expected state.
+	SoftDelete(ctx context.Context, tenantID, id uuid.UUID, deletedBy string) error
+	Restore(ctx context.Context, tenantID, id uuid.UUID) (*Document, error)
+	// Delete removes a document permanently.
 	Delete(ctx context.Context, tenantID, id uuid.UUID) error
-	List(ctx context.Context, filter DocumentFilter) ([]Document, int64, error)
+	List(ctx context.Context, filter DocumentFilter) (*DocumentPage, error)
 	GetByChecksum(ctx context.Context, tenantID uuid.UUID, checksum string) (*Document, error)
 }
 
 type StorageService interface {
 	Upload(ctx context.Context, bucket, objectKey string, data []byte, contentType string) error
 	Download(ctx context.Context, bucket, objectKey string) ([]byte, error)
+	// DownloadStream opens an object for reading without loading it into
+	// memory. The reader also implements io.Seeker when storage can read
+	// from an offset, so ranges of the object can be served.
+	DownloadStream(ctx context.Context, bucket, objectKey string) (io.ReadCloser, error)
 	Delete(ctx context.Context, bucket, objectKey string) error
-	GetPresignedUploadURL(ctx context.Context, bucket, objectKey string, contentType string, expiry time.Duration) (string, error)
+	// GetPresignedUploadURL returns a URL objectKey can be uploaded to until
+	// expiry. The headers of UploadHeaders(contentType, size) are signed
+	// into it, so storage refuses an upload of another type or size.
+	GetPresignedUploadURL(ctx context.Context, bucket, objectKey string, contentType string, size int64, expiry time.Duration) (string, error)
 	GetPresignedDownloadURL(ctx context.Context, bucket, objectKey string, expiry time.Duration) (string, error)
 	BucketExists(ctx context.Context, bucket string) (bool, error)
 	CreateBucket(ctx context.Context, bucket string) error
 }
 
+// UploadHeaders returns the headers an upload to a presigned URL must be
+// sent with: the content type and, when known, the size it was signed for.
+func UploadHeaders(contentType string, size int64) map[string]string {
+	headers := map[string]string{}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	if size > 0 {
+		headers["Content-Length"] = strconv.FormatInt(size, 10)
+	}
+	return headers
+}
+
 type ProcessingService interface {
 	ProcessDocument(ctx context.Context, doc *Document, data []byte) (*Document, error)
 	ExtractText(ctx context.Context, data []byte, mimeType string) (string, error)
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TemplateKind is what a document template produces.
+type TemplateKind string
+
+const (
+	TemplateKindContract     TemplateKind = "contract"
+	TemplateKindQuote        TemplateKind = "quote"
+	TemplateKindDeliveryNote TemplateKind = "delivery_note"
+	TemplateKindPackingSlip  TemplateKind = "packing_slip"
+	TemplateKindOther        TemplateKind = "other"
+)
+
+// DocumentType returns the type of the documents generated from templates
+// of the kind.
+func (k TemplateKind) DocumentType() DocumentType {
+	switch k {
+	case TemplateKindContract:
+		return DocTypeContract
+	case TemplateKindQuote:
+		return DocTypeQuote
+	case TemplateKindDeliveryNote:
+		return DocTypeDeliveryNote
+	case TemplateKindPackingSlip:
+		return DocTypePackingSlip
+	}
+	return DocTypeOther
+}
+
+func (k TemplateKind) IsValid() bool {
+	switch k {
+	case TemplateKindContract, TemplateKindQuote, TemplateKindDeliveryNote, TemplateKindPackingSlip, TemplateKindOther:
+		return true
+	}
+	return false
+}
+
+// ERP entities documents are generated for, and linked to. A shipment is
+// one fulfillment of an order.
+const (
+	EntityClient   = "client"
+	EntityOrder    = "order"
+	EntityInvoice  = "invoice"
+	EntityShipment = "shipment"
+)
+
+// Formats documents are generated in.
+const (
+	GeneratedPDF  = "pdf"
+	GeneratedDOCX = "docx"
+)
+
+// DocumentTemplate is a tenant's template for generating documents about
+// an ERP entity. Body is text with merge fields such as {{client.name}},
+// and sections such as {{#order.lines}}...{{/order.lines}} repeated for
+// each item of a list; Fields lists the merge fields it uses.
+type DocumentTemplate struct {
+	ID          uuid.UUID    `json:"id" bson:"_id"`
+	TenantID    uuid.UUID    `json:"tenantId" bson:"tenantId"`
+	Name        string       `json:"name" bson:"name"`
+	Description string       `json:"description,omitempty" bson:"description,omitempty"`
+	Kind        TemplateKind `json:"kind" bson:"kind"`
+	Entity      string       `json:"entity" bson:"entity"`
+	Format      string       `json:"format" bson:"format"`
+	Body        string       `json:"body" bson:"body"`
+	Fields      []string     `json:"fields" bson:"fields"`
+	CreatedBy   string       `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time    `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt" bson:"updatedAt"`
+	Version     int64        `json:"version" bson:"version"`
+}
+
+// Validate checks the template's name, kind, entity and default format,
+// defaulting the format to PDF. Merge fields are checked when the body is
+// parsed.
+func (t *DocumentTemplate) Validate() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Format == "" {
+		t.Format = GeneratedPDF
+	}
+	if t.Name == "" || !t.Kind.IsValid() || !IsGeneratedFormat(t.Format) || strings.TrimSpace(t.Body) == "" {
+		return ErrInvalidDocumentTemplate
+	}
+	switch t.Entity {
+	case EntityClient, EntityOrder, EntityInvoice, EntityShipment:
+		return nil
+	}
+	return ErrInvalidDocumentTemplate
+}
+
+// IsGeneratedFormat reports whether documents can be generated in format.
+func IsGeneratedFormat(format string) bool {
+	return format == GeneratedPDF || format == GeneratedDOCX
+}
+
+var (
+	ErrDocumentTemplateNotFound = &DocumentError{Code: "DOCUMENT_TEMPLATE_NOT_FOUND", Message: "document template not found"}
+	ErrInvalidDocumentTemplate  = &DocumentError{Code: "INVALID_DOCUMENT_TEMPLATE", Message: "a template needs a name, a body, a kind (contract, quote, delivery_note, packing_slip, other), an entity (client, order, invoice, shipment) and a format (pdf, docx)"}
+)
@@ -22,6 +22,7 @@ func TestDocumentType_IsValid(t *testing.T) {
 		{"valid contract", DocTypeContract, true},
 		{"valid scanned", DocTypeScanned, true},
 		{"valid other", DocTypeOther, true},
+		{"valid product image", DocTypeProductImage, true},
 		{"invalid type", DocumentType("invalid"), false},
 		{"empty type", DocumentType(""), false},
 	}
@@ -330,3 +331,29 @@ func TestDocumentErrorTypes(t *testing.T) {
 	assert.Equal(t, "PRESIGNED_URL_EXPIRED", ErrPresignedURLExpired.Code)
 	assert.Equal(t, "presigned URL has expired", ErrPresignedURLExpired.Message)
 }
+
+func TestBlobKey(t *testing.T) {
+	tenantID := uuid.MustParse("6f1c2b9e-3d4a-4c5b-8e7f-0a1b2c3d4e5f")
+	checksum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	key := BlobKey(tenantID, checksum)
+	assert.Equal(t, tenantID.String()+"/cas/9f/"+checksum, key)
+	assert.True(t, IsBlobKey(key))
+	assert.False(t, IsBlobKey(tenantID.String()+"/invoice/2026/10/"+uuid.NewString()))
+	assert.False(t, IsBlobKey(""))
+}
+
+func TestUploadHeaders(t *testing.T) {
+	assert.Equal(t, map[string]string{"Content-Type": "application/pdf", "Content-Length": "48213"},
+		UploadHeaders("application/pdf", 48213))
+	assert.Equal(t, map[string]string{"Content-Type": "image/png"}, UploadHeaders("image/png", 0))
+}
+
+func TestDocument_Rendition(t *testing.T) {
+	doc := &Document{Renditions: []Rendition{
+		{Name: "thumbnail", ObjectKey: "t/renditions/a/thumbnail.webp"},
+		{Name: "shared", ObjectKey: "t/renditions/a/shared.jpg", Watermarked: true},
+	}}
+	assert.Equal(t, "t/renditions/a/shared.jpg", doc.Rendition("shared").ObjectKey)
+	assert.Nil(t, doc.Rendition("large"))
+}
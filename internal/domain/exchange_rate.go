@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ExchangeRateManual is the source of rates tenants set themselves.
+const ExchangeRateManual = "manual"
+
+// ExchangeRate is the price of one Base in Quote on a day. Rates synced
+// from the provider are shared by all tenants. A tenant's override, with
+// TenantID set, replaces them for the tenant from its day until the next
+// override of the pair.
+type ExchangeRate struct {
+	ID        uuid.UUID       `json:"id" bson:"_id"`
+	TenantID  *uuid.UUID      `json:"tenantId,omitempty" bson:"tenantId"`
+	Base      string          `json:"base" bson:"base"`
+	Quote     string          `json:"quote" bson:"quote"`
+	Rate      decimal.Decimal `json:"rate" bson:"rate"`
+	Date      time.Time       `json:"date" bson:"date"`
+	Source    string          `json:"source" bson:"source"`
+	Note      string          `json:"note,omitempty" bson:"note,omitempty"`
+	SetBy     *uuid.UUID      `json:"setBy,omitempty" bson:"setBy,omitempty"`
+	UpdatedAt time.Time       `json:"updatedAt" bson:"updatedAt"`
+}
+
+// NewExchangeRate returns the rate of base in quote on the day of date,
+// as published by source.
+func NewExchangeRate(base, quote string, rate decimal.Decimal, date time.Time, source string) (*ExchangeRate, error) {
+	base, quote = strings.ToUpper(strings.TrimSpace(base)), strings.ToUpper(strings.TrimSpace(quote))
+	if len(base) != 3 || len(quote) != 3 || base == quote {
+		return nil, ErrInvalidCurrencyPair
+	}
+	if !rate.IsPositive() {
+		return nil, ErrInvalidExchangeRate
+	}
+	return &ExchangeRate{
+		ID:        uuid.New(),
+		Base:      base,
+		Quote:     quote,
+		Rate:      rate,
+		Date:      RateDay(date),
+		Source:    source,
+		UpdatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// NewExchangeRateOverride returns a tenant's own rate of base in quote
+// from the day of date on.
+func NewExchangeRateOverride(tenantID uuid.UUID, base, quote string, rate decimal.Decimal, date time.Time, setBy uuid.UUID, note string) (*ExchangeRate, error) {
+	override, err := NewExchangeRate(base, quote, rate, date, ExchangeRateManual)
+	if err != nil {
+		return nil, err
+	}
+	override.TenantID = &tenantID
+	override.SetBy = &setBy
+	override.Note = strings.TrimSpace(note)
+	return override, nil
+}
+
+// RateDay returns the calendar day of t, in t's location, as midnight UTC:
+// the form rates are dated in.
+func RateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// CurrencyConversion records an amount converted into the tenant's
+// reporting currency, at the rate of the day it was converted for.
+type CurrencyConversion struct {
+	Currency string          `json:"currency" bson:"currency"`
+	Amount   decimal.Decimal `json:"amount" bson:"amount"`
+	Rate     decimal.Decimal `json:"rate" bson:"rate"`
+	RateDate time.Time       `json:"rateDate" bson:"rateDate"`
+	Source   string          `json:"source" bson:"source"`
+}
+
+var (
+	ErrInvalidCurrencyPair = &PaymentError{Code: "INVALID_CURRENCY_PAIR", Message: "exchange rates are between two different ISO 4217 currencies"}
+	ErrInvalidExchangeRate = &PaymentError{Code: "INVALID_EXCHANGE_RATE", Message: "exchange rate must be greater than zero"}
+)
@@ -0,0 +1,49 @@
+package domain
+
+// IntrastatFlow is the direction of a movement of goods between EU member
+// states: a dispatch leaves the declarant's country, an arrival enters it.
+type IntrastatFlow string
+
+const (
+	IntrastatDispatch IntrastatFlow = "dispatch"
+	IntrastatArrival  IntrastatFlow = "arrival"
+)
+
+func (f IntrastatFlow) IsValid() bool {
+	return f == IntrastatDispatch || f == IntrastatArrival
+}
+
+// euMemberStates are the ISO 3166 alpha-2 codes of the EU member states.
+// Greece is listed as GR, although Intrastat forms print it as EL.
+var euMemberStates = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "CY": true, "CZ": true, "DE": true,
+	"DK": true, "EE": true, "ES": true, "FI": true, "FR": true, "GR": true,
+	"HR": true, "HU": true, "IE": true, "IT": true, "LT": true, "LU": true,
+	"LV": true, "MT": true, "NL": true, "PL": true, "PT": true, "RO": true,
+	"SE": true, "SI": true, "SK": true,
+}
+
+// IsEUMemberState reports whether country, an ISO 3166 alpha-2 code, is an
+// EU member state.
+func IsEUMemberState(country string) bool {
+	return euMemberStates[country]
+}
+
+// IsCountryCode reports whether code looks like an ISO 3166 alpha-2 code.
+func IsCountryCode(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// IsCommodityCode reports whether code is an 8-digit Combined Nomenclature
+// code.
+func IsCommodityCode(code string) bool {
+	if len(code) != 8 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
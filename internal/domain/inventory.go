@@ -2,9 +2,11 @@ package domain
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
 	"github.com/shopspring/decimal"
 )
 
@@ -40,6 +42,33 @@ const (
 	MovementTypeExpired            MovementType = "expired"
 )
 
+func (t MovementType) IsValid() bool {
+	switch t {
+	case MovementTypeReceipt, MovementTypeShipment, MovementTypeTransferIn, MovementTypeTransferOut,
+		MovementTypeAdjustment, MovementTypeReservation, MovementTypeReservationRelease,
+		MovementTypeAllocation, MovementTypeDeallocation, MovementTypeReturn, MovementTypeWriteOff,
+		MovementTypeCycleCount, MovementTypeDamaged, MovementTypeExpired:
+		return true
+	}
+	return false
+}
+
+// OnHandDelta returns how a movement of quantity changes the stock on hand.
+// Adjustments and cycle counts record a signed difference; reservations and
+// allocations only move stock between available and held, so they leave the
+// stock on hand as it is.
+func (t MovementType) OnHandDelta(quantity int) int {
+	switch t {
+	case MovementTypeReceipt, MovementTypeTransferIn, MovementTypeReturn:
+		return quantity
+	case MovementTypeShipment, MovementTypeTransferOut, MovementTypeWriteOff, MovementTypeDamaged, MovementTypeExpired:
+		return -quantity
+	case MovementTypeAdjustment, MovementTypeCycleCount:
+		return quantity
+	}
+	return 0
+}
+
 type WarehouseType string
 
 const (
@@ -311,6 +340,56 @@ func (i *InventoryItem) Receive(quantity int, unitCost decimal.Decimal) {
 	i.Status = InventoryStatusAvailable
 }
 
+// AddLandedCost capitalizes a landed cost into the stock on hand, raising
+// its value and unit cost. It returns false, changing nothing, when there is
+// no stock left to carry the cost.
+func (i *InventoryItem) AddLandedCost(amount decimal.Decimal) bool {
+	if i.Quantity <= 0 {
+		return false
+	}
+	quantity := decimal.NewFromInt(int64(i.Quantity))
+	i.TotalValue = i.UnitCost.Mul(quantity).Add(amount)
+	i.UnitCost = i.TotalValue.Div(quantity)
+	i.UpdatedAt = time.Now().UTC()
+	return true
+}
+
+// ExpectedUnitCost is what selling quantity units is expected to cost per
+// unit, taking them from the cost layers first in, first out. Layers are the
+// inventory items of the product; quarantined, damaged and expired stock is
+// not sold and so is skipped. Units beyond the stock cost fallback, usually
+// the product's cost price. covered is how many units the layers supplied.
+func ExpectedUnitCost(layers []*InventoryItem, quantity int, fallback decimal.Decimal) (unitCost decimal.Decimal, covered int) {
+	if quantity <= 0 {
+		return fallback, 0
+	}
+	ordered := make([]*InventoryItem, 0, len(layers))
+	for _, layer := range layers {
+		switch {
+		case layer.Quantity <= 0:
+		case layer.Status == InventoryStatusQuarantine, layer.Status == InventoryStatusDamaged, layer.Status == InventoryStatusExpired:
+		default:
+			ordered = append(ordered, layer)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].CreatedAt.Before(ordered[j].CreatedAt) })
+
+	total := decimal.Zero
+	for _, layer := range ordered {
+		if covered == quantity {
+			break
+		}
+		take := layer.Quantity
+		if take > quantity-covered {
+			take = quantity - covered
+		}
+		total = total.Add(layer.UnitCost.Mul(decimal.NewFromInt(int64(take))))
+		covered += take
+	}
+	total = total.Add(fallback.Mul(decimal.NewFromInt(int64(quantity - covered))))
+	return total.Div(decimal.NewFromInt(int64(quantity))), covered
+}
+
 func (i *InventoryItem) Ship(quantity int) error {
 	if quantity > i.Quantity {
 		return ErrInsufficientInventory
@@ -500,35 +579,219 @@ var (
 	ErrCannotReleaseMoreThanReserved          = &WarehouseError{Code: "CANNOT_RELEASE_MORE", Message: "Cannot release more than reserved"}
 	ErrCannotDeactivateLocationWithStock      = &WarehouseError{Code: "CANNOT_DEACTIVATE_WITH_STOCK", Message: "Cannot deactivate location with stock"}
 	ErrOperationItemNotFound                  = &WarehouseError{Code: "OPERATION_ITEM_NOT_FOUND", Message: "Operation item not found"}
+	ErrLandedCostReceiptOnly                  = &WarehouseError{Code: "LANDED_COST_RECEIPT_ONLY", Message: "Landed costs can only be recorded against receipts"}
+	ErrLandedCostCancelledReceipt             = &WarehouseError{Code: "LANDED_COST_CANCELLED_RECEIPT", Message: "Cannot record landed costs against a cancelled receipt"}
+	ErrInvalidLandedCostType                  = &WarehouseError{Code: "INVALID_LANDED_COST_TYPE", Message: "Invalid landed cost type"}
+	ErrInvalidAllocationMethod                = &WarehouseError{Code: "INVALID_ALLOCATION_METHOD", Message: "Invalid allocation method"}
+	ErrInvalidLandedCostAmount                = &WarehouseError{Code: "INVALID_LANDED_COST_AMOUNT", Message: "Landed cost amount must be positive"}
+	ErrNoLandedCostBasis                      = &WarehouseError{Code: "NO_LANDED_COST_BASIS", Message: "No received lines to allocate the landed cost across"}
 )
 
 type WarehouseOperation struct {
-	ID            uuid.UUID       `json:"id" bson:"_id"`
-	TenantID      uuid.UUID       `json:"tenantId" bson:"tenantId"`
-	WarehouseID   uuid.UUID       `json:"warehouseId" bson:"warehouseId"`
-	Type          OperationType   `json:"type" bson:"type"`
-	ReferenceType string          `json:"referenceType" bson:"referenceType"`
-	ReferenceID   uuid.UUID       `json:"referenceId" bson:"referenceId"`
-	Status        string          `json:"status" bson:"status"`
-	Priority      int             `json:"priority" bson:"priority"`
-	AssignedTo    *uuid.UUID      `json:"assignedTo" bson:"assignedTo"`
-	Items         []OperationItem `json:"items" bson:"items"`
-	Notes         string          `json:"notes" bson:"notes"`
-	StartedAt     *time.Time      `json:"startedAt" bson:"startedAt"`
-	CompletedAt   *time.Time      `json:"completedAt" bson:"completedAt"`
-	CreatedBy     uuid.UUID       `json:"createdBy" bson:"createdBy"`
-	CreatedAt     time.Time       `json:"createdAt" bson:"createdAt"`
-	UpdatedAt     time.Time       `json:"updatedAt" bson:"updatedAt"`
+	ID            uuid.UUID     `json:"id" bson:"_id"`
+	TenantID      uuid.UUID     `json:"tenantId" bson:"tenantId"`
+	WarehouseID   uuid.UUID     `json:"warehouseId" bson:"warehouseId"`
+	Type          OperationType `json:"type" bson:"type"`
+	ReferenceType string        `json:"referenceType" bson:"referenceType"`
+	ReferenceID   uuid.UUID     `json:"referenceId" bson:"referenceId"`
+	// PartnerCountry is, on receipts, the country the goods were sent from;
+	// receipts from another EU member state are Intrastat arrivals.
+	PartnerCountry string          `json:"partnerCountry,omitempty" bson:"partnerCountry,omitempty"`
+	Status         string          `json:"status" bson:"status"`
+	Priority       int             `json:"priority" bson:"priority"`
+	AssignedTo     *uuid.UUID      `json:"assignedTo" bson:"assignedTo"`
+	AssignedAt     *time.Time      `json:"assignedAt" bson:"assignedAt"`
+	Items          []OperationItem `json:"items" bson:"items"`
+	Notes          string          `json:"notes" bson:"notes"`
+	StartedAt      *time.Time      `json:"startedAt" bson:"startedAt"`
+	CompletedAt    *time.Time      `json:"completedAt" bson:"completedAt"`
+	CreatedBy      uuid.UUID       `json:"createdBy" bson:"createdBy"`
+	CreatedAt      time.Time       `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt" bson:"updatedAt"`
+	LandedCosts    []LandedCost    `json:"landedCosts,omitempty" bson:"landedCosts,omitempty"`
 }
 
+// OperationItem is a line of a warehouse operation. On receipts UnitCost is
+// the purchase cost and Weight the weight of one unit; LandedCost is the
+// total of the landed costs allocated to the line.
 type OperationItem struct {
-	ID           uuid.UUID  `json:"id" bson:"_id"`
-	ProductID    uuid.UUID  `json:"productId" bson:"productId"`
-	VariantID    *uuid.UUID `json:"variantId" bson:"variantId"`
-	LocationID   uuid.UUID  `json:"locationId" bson:"locationId"`
-	Quantity     int        `json:"quantity" bson:"quantity"`
-	QuantityDone int        `json:"quantityDone" bson:"quantityDone"`
-	Status       string     `json:"status" bson:"status"`
+	ID           uuid.UUID       `json:"id" bson:"_id"`
+	ProductID    uuid.UUID       `json:"productId" bson:"productId"`
+	VariantID    *uuid.UUID      `json:"variantId" bson:"variantId"`
+	LocationID   uuid.UUID       `json:"locationId" bson:"locationId"`
+	Quantity     int             `json:"quantity" bson:"quantity"`
+	QuantityDone int             `json:"quantityDone" bson:"quantityDone"`
+	Status       string          `json:"status" bson:"status"`
+	UnitCost     decimal.Decimal `json:"unitCost" bson:"unitCost"`
+	Weight       decimal.Decimal `json:"weight" bson:"weight"`
+	LandedCost   decimal.Decimal `json:"landedCost" bson:"landedCost"`
+	Scans        []ItemScan      `json:"scans,omitempty" bson:"scans,omitempty"`
+}
+
+// ItemScan records an operator scanning Quantity units of an operation
+// item, such as picking them from a bin or putting them away.
+type ItemScan struct {
+	OperatorID uuid.UUID `json:"operatorId" bson:"operatorId"`
+	Quantity   int       `json:"quantity" bson:"quantity"`
+	ScannedAt  time.Time `json:"scannedAt" bson:"scannedAt"`
+}
+
+// LandedUnitCost is the cost of one received unit of the line including its
+// share of the landed costs.
+func (i OperationItem) LandedUnitCost() decimal.Decimal {
+	if i.QuantityDone <= 0 {
+		return i.UnitCost
+	}
+	return i.UnitCost.Add(i.LandedCost.Div(decimal.NewFromInt(int64(i.QuantityDone))))
+}
+
+type LandedCostType string
+
+const (
+	LandedCostFreight   LandedCostType = "freight"
+	LandedCostDuty      LandedCostType = "duty"
+	LandedCostInsurance LandedCostType = "insurance"
+)
+
+func (t LandedCostType) IsValid() bool {
+	switch t {
+	case LandedCostFreight, LandedCostDuty, LandedCostInsurance:
+		return true
+	}
+	return false
+}
+
+// AllocationMethod decides how a landed cost is shared between the lines of
+// a receipt: in proportion to their purchase value, their weight or the
+// number of units received.
+type AllocationMethod string
+
+const (
+	AllocateByValue    AllocationMethod = "value"
+	AllocateByWeight   AllocationMethod = "weight"
+	AllocateByQuantity AllocationMethod = "quantity"
+)
+
+func (m AllocationMethod) IsValid() bool {
+	switch m {
+	case AllocateByValue, AllocateByWeight, AllocateByQuantity:
+		return true
+	}
+	return false
+}
+
+// LandedCost is a freight, duty or insurance charge recorded against a
+// receipt, with the share of it each line received.
+type LandedCost struct {
+	ID          uuid.UUID              `json:"id" bson:"_id"`
+	Type        LandedCostType         `json:"type" bson:"type"`
+	Amount      decimal.Decimal        `json:"amount" bson:"amount"`
+	Currency    string                 `json:"currency" bson:"currency"`
+	Method      AllocationMethod       `json:"method" bson:"method"`
+	Reference   string                 `json:"reference,omitempty" bson:"reference,omitempty"`
+	Allocations []LandedCostAllocation `json:"allocations" bson:"allocations"`
+	CreatedBy   uuid.UUID              `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time              `json:"createdAt" bson:"createdAt"`
+}
+
+type LandedCostAllocation struct {
+	ItemID    uuid.UUID       `json:"itemId" bson:"itemId"`
+	ProductID uuid.UUID       `json:"productId" bson:"productId"`
+	Amount    decimal.Decimal `json:"amount" bson:"amount"`
+}
+
+// AllocateAmount splits amount in proportion to weights, rounding each share
+// to the minor unit of currency. The rounding difference goes to the largest
+// share so that the shares always add up to amount. Zero weights get
+// nothing; it returns nil when all weights are zero.
+func AllocateAmount(amount decimal.Decimal, weights []decimal.Decimal, currency string) []decimal.Decimal {
+	total := decimal.Zero
+	largest := -1
+	for i, weight := range weights {
+		total = total.Add(weight)
+		if weight.IsPositive() && (largest < 0 || weight.GreaterThan(weights[largest])) {
+			largest = i
+		}
+	}
+	if largest < 0 || !total.IsPositive() {
+		return nil
+	}
+
+	shares := make([]decimal.Decimal, len(weights))
+	allocated := decimal.Zero
+	for i, weight := range weights {
+		if i == largest || !weight.IsPositive() {
+			continue
+		}
+		shares[i] = money.Round(amount.Mul(weight).Div(total), currency)
+		allocated = allocated.Add(shares[i])
+	}
+	shares[largest] = amount.Sub(allocated)
+	return shares
+}
+
+// AddLandedCost allocates cost across the received quantities of the
+// receipt's lines by cost.Method and records it. Lines received after a
+// landed cost was recorded take no share of it. It returns the allocations,
+// which are also stored on cost.
+func (o *WarehouseOperation) AddLandedCost(cost LandedCost) ([]LandedCostAllocation, error) {
+	if o.Type != OperationTypeReceipt {
+		return nil, ErrLandedCostReceiptOnly
+	}
+	if o.Status == "cancelled" {
+		return nil, ErrLandedCostCancelledReceipt
+	}
+	if !cost.Type.IsValid() {
+		return nil, ErrInvalidLandedCostType
+	}
+	if !cost.Method.IsValid() {
+		return nil, ErrInvalidAllocationMethod
+	}
+	if !cost.Amount.IsPositive() {
+		return nil, ErrInvalidLandedCostAmount
+	}
+
+	weights := make([]decimal.Decimal, len(o.Items))
+	for i, item := range o.Items {
+		if item.QuantityDone <= 0 {
+			continue
+		}
+		received := decimal.NewFromInt(int64(item.QuantityDone))
+		switch cost.Method {
+		case AllocateByValue:
+			weights[i] = item.UnitCost.Mul(received)
+		case AllocateByWeight:
+			weights[i] = item.Weight.Mul(received)
+		case AllocateByQuantity:
+			weights[i] = received
+		}
+	}
+	shares := AllocateAmount(cost.Amount, weights, cost.Currency)
+	if shares == nil {
+		return nil, ErrNoLandedCostBasis
+	}
+
+	cost.Allocations = nil
+	for i, share := range shares {
+		if share.IsZero() {
+			continue
+		}
+		o.Items[i].LandedCost = o.Items[i].LandedCost.Add(share)
+		cost.Allocations = append(cost.Allocations, LandedCostAllocation{
+			ItemID:    o.Items[i].ID,
+			ProductID: o.Items[i].ProductID,
+			Amount:    share,
+		})
+	}
+	if cost.ID == uuid.Nil {
+		cost.ID = uuid.New()
+	}
+	if cost.CreatedAt.IsZero() {
+		cost.CreatedAt = time.Now().UTC()
+	}
+	o.LandedCosts = append(o.LandedCosts, cost)
+	o.UpdatedAt = time.Now().UTC()
+	return cost.Allocations, nil
 }
 
 func NewWarehouseOperation(
@@ -564,8 +827,10 @@ func (o *WarehouseOperation) AddItem(item OperationItem) {
 }
 
 func (o *WarehouseOperation) AssignTo(userID uuid.UUID) {
+	now := time.Now().UTC()
 	o.AssignedTo = &userID
-	o.UpdatedAt = time.Now().UTC()
+	o.AssignedAt = &now
+	o.UpdatedAt = now
 }
 
 func (o *WarehouseOperation) Start() {
@@ -591,6 +856,25 @@ func (o *WarehouseOperation) CompleteItem(itemID uuid.UUID, quantity int) error
 	return ErrOperationItemNotFound
 }
 
+// ScanItem records operatorID scanning quantity units of an item at
+// scannedAt, now when it is zero, and completes them.
+func (o *WarehouseOperation) ScanItem(itemID, operatorID uuid.UUID, quantity int, scannedAt time.Time) error {
+	if scannedAt.IsZero() {
+		scannedAt = time.Now().UTC()
+	}
+	for i := range o.Items {
+		if o.Items[i].ID == itemID {
+			o.Items[i].Scans = append(o.Items[i].Scans, ItemScan{
+				OperatorID: operatorID,
+				Quantity:   quantity,
+				ScannedAt:  scannedAt.UTC(),
+			})
+			return o.CompleteItem(itemID, quantity)
+		}
+	}
+	return ErrOperationItemNotFound
+}
+
 func (o *WarehouseOperation) IsComplete() bool {
 	for _, item := range o.Items {
 		if item.Status != "completed" {
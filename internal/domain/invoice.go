@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
 	"github.com/shopspring/decimal"
 )
 
@@ -63,10 +64,28 @@ type Invoice struct {
 	Terms         string            `json:"terms" bson:"terms"`
 	AttachmentURL string            `json:"attachmentUrl" bson:"attachmentUrl"`
 	Metadata      map[string]string `json:"metadata" bson:"metadata"`
-	CreatedBy     uuid.UUID         `json:"createdBy" bson:"createdBy"`
-	CreatedAt     time.Time         `json:"createdAt" bson:"createdAt"`
-	UpdatedAt     time.Time         `json:"updatedAt" bson:"updatedAt"`
-	Version       int64             `json:"-" bson:"version"`
+	// Allocations are the credit applied from a credit note to invoices,
+	// kept on both. A credit note's AmountPaid is the credit applied and
+	// its AmountDue the credit still unapplied; an invoice counts applied
+	// credit in AmountPaid like a payment.
+	Allocations []CreditAllocation `json:"allocations,omitempty" bson:"allocations,omitempty"`
+	// RemindersSent counts the payment reminders sent for the invoice, the
+	// last at LastReminderAt.
+	RemindersSent  int        `json:"remindersSent,omitempty" bson:"remindersSent,omitempty"`
+	LastReminderAt *time.Time `json:"lastReminderAt,omitempty" bson:"lastReminderAt,omitempty"`
+	// BillingPeriod is the period whose deliveries a consolidated invoice
+	// bills, e.g. 2026-10.
+	BillingPeriod string `json:"billingPeriod,omitempty" bson:"billingPeriod,omitempty"`
+	// PaymentApplications are the payments applied to the invoice, with
+	// those unapplied since, kept on the payment too.
+	PaymentApplications []PaymentApplication `json:"paymentApplications,omitempty" bson:"paymentApplications,omitempty"`
+	// Conversion is the total in the tenant's reporting currency, at the
+	// rate of the issue date, set when the invoice is finalized.
+	Conversion *CurrencyConversion `json:"conversion,omitempty" bson:"conversion,omitempty"`
+	CreatedBy  uuid.UUID           `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time           `json:"updatedAt" bson:"updatedAt"`
+	Version    int64               `json:"version" bson:"version"`
 }
 
 type InvoiceLine struct {
@@ -76,11 +95,28 @@ type InvoiceLine struct {
 	UnitPrice   decimal.Decimal `json:"unitPrice" bson:"unitPrice"`
 	Discount    decimal.Decimal `json:"discount" bson:"discount"`
 	TaxRate     decimal.Decimal `json:"taxRate" bson:"taxRate"`
+	TaxCode     string          `json:"taxCode,omitempty" bson:"taxCode,omitempty"`
 	TaxAmount   decimal.Decimal `json:"taxAmount" bson:"taxAmount"`
 	Total       decimal.Decimal `json:"total" bson:"total"`
 	ProductID   *uuid.UUID      `json:"productId" bson:"productId"`
 	ServiceDate *time.Time      `json:"serviceDate" bson:"serviceDate"`
 	SortOrder   int             `json:"sortOrder" bson:"sortOrder"`
+	// OrderID is the order a line of a consolidated invoice bills.
+	OrderID     *uuid.UUID `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	OrderNumber string     `json:"orderNumber,omitempty" bson:"orderNumber,omitempty"`
+}
+
+// CreditAllocation is an amount of a credit note applied to an invoice of
+// the same client.
+type CreditAllocation struct {
+	ID               uuid.UUID       `json:"id" bson:"id"`
+	CreditNoteID     uuid.UUID       `json:"creditNoteId" bson:"creditNoteId"`
+	CreditNoteNumber string          `json:"creditNoteNumber" bson:"creditNoteNumber"`
+	InvoiceID        uuid.UUID       `json:"invoiceId" bson:"invoiceId"`
+	InvoiceNumber    string          `json:"invoiceNumber" bson:"invoiceNumber"`
+	Amount           decimal.Decimal `json:"amount" bson:"amount"`
+	AllocatedBy      uuid.UUID       `json:"allocatedBy" bson:"allocatedBy"`
+	AllocatedAt      time.Time       `json:"allocatedAt" bson:"allocatedAt"`
 }
 
 func NewInvoice(
@@ -118,9 +154,11 @@ func NewInvoice(
 	return invoice, nil
 }
 
+// AddLine adds line, computing its total after discount and its tax
+// rounded to the invoice currency.
 func (i *Invoice) AddLine(line InvoiceLine) {
-	line.Total = line.Quantity.Mul(line.UnitPrice).Sub(line.Discount)
-	line.TaxAmount = line.Total.Mul(line.TaxRate).Div(decimal.NewFromInt(100))
+	line.Total = money.Round(line.Quantity.Mul(line.UnitPrice).Sub(line.Discount), i.Currency)
+	line.TaxAmount = money.Round(line.Total.Mul(line.TaxRate).Div(decimal.NewFromInt(100)), i.Currency)
 	line.ID = uuid.New()
 	i.Lines = append(i.Lines, line)
 	i.recalculate()
@@ -147,13 +185,16 @@ func (i *Invoice) UpdateLine(lineID uuid.UUID, update func(*InvoiceLine)) {
 	i.recalculate()
 }
 
+// recalculate sums the lines. Subtotal is before discounts, which line
+// totals are already net of, so that Total is Subtotal - DiscountTotal +
+// TaxTotal and the discount is only taken off once.
 func (i *Invoice) recalculate() {
 	subtotal := decimal.Zero
 	taxTotal := decimal.Zero
 	discountTotal := decimal.Zero
 
 	for _, line := range i.Lines {
-		subtotal = subtotal.Add(line.Total)
+		subtotal = subtotal.Add(line.Total).Add(line.Discount)
 		taxTotal = taxTotal.Add(line.TaxAmount)
 		discountTotal = discountTotal.Add(line.Discount)
 	}
@@ -224,6 +265,57 @@ func (i *Invoice) ApplyPayment(amount decimal.Decimal) error {
 	return nil
 }
 
+// IsOpen reports whether the invoice is issued and not yet settled,
+// cancelled or refunded.
+func (i *Invoice) IsOpen() bool {
+	switch i.Status {
+	case InvoiceStatusPending, InvoiceStatusSent, InvoiceStatusOverdue:
+		return true
+	}
+	return false
+}
+
+// AllocateCredit applies amount of credit note i to invoice, which it
+// settles like a payment, and records the allocation on both. A credit
+// note is paid once all of its credit is applied.
+func (i *Invoice) AllocateCredit(invoice *Invoice, amount decimal.Decimal, allocatedBy uuid.UUID) (CreditAllocation, error) {
+	if amount.GreaterThan(i.AmountDue) || amount.GreaterThan(invoice.AmountDue) {
+		return CreditAllocation{}, ErrCreditExceedsAmount
+	}
+	allocation := CreditAllocation{
+		ID:               uuid.New(),
+		CreditNoteID:     i.ID,
+		CreditNoteNumber: i.InvoiceNumber,
+		InvoiceID:        invoice.ID,
+		InvoiceNumber:    invoice.InvoiceNumber,
+		Amount:           amount,
+		AllocatedBy:      allocatedBy,
+		AllocatedAt:      time.Now().UTC(),
+	}
+	i.MarkAsPaid(amount)
+	invoice.MarkAsPaid(amount)
+	i.Allocations = append(i.Allocations, allocation)
+	invoice.Allocations = append(invoice.Allocations, allocation)
+	return allocation, nil
+}
+
+// CanRemind reports whether a payment reminder can be sent for the
+// invoice: it is open and has an amount due. Credit notes are not.
+func (i *Invoice) CanRemind() bool {
+	return i.Type != InvoiceTypeCreditNote && i.IsOpen() && i.AmountDue.GreaterThan(decimal.Zero)
+}
+
+// RecordReminder records a payment reminder sent at at.
+func (i *Invoice) RecordReminder(at time.Time) error {
+	if !i.CanRemind() {
+		return ErrInvoiceNotRemindable
+	}
+	i.RemindersSent++
+	i.LastReminderAt = &at
+	i.UpdatedAt = at
+	return nil
+}
+
 func (i *Invoice) Cancel(reason string) {
 	i.Status = InvoiceStatusCancelled
 	i.Notes = i.Notes + "\nCancelled: " + reason
@@ -291,3 +383,13 @@ var ErrPaymentExceedsAmount = &PaymentError{
 	Code:    "PAYMENT_EXCEEDS_AMOUNT",
 	Message: "Payment amount exceeds the amount due",
 }
+
+var ErrInvoiceNotRemindable = &PaymentError{
+	Code:    "INVOICE_NOT_REMINDABLE",
+	Message: "Reminders are only sent for open invoices with an amount due",
+}
+
+var ErrCreditExceedsAmount = &PaymentError{
+	Code:    "CREDIT_EXCEEDS_AMOUNT",
+	Message: "Credit amount exceeds the unapplied credit or the amount due",
+}
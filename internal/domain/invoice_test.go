@@ -2,9 +2,11 @@ package domain
 
 import (
 	"testing"
+	"testing/quick"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -290,3 +292,82 @@ func TestInvoiceLineCalculations(t *testing.T) {
 	assert.True(t, line.Total.Equal(expectedTotal))
 	assert.True(t, line.TaxAmount.Equal(expectedTaxAmount))
 }
+
+func TestInvoiceTotalsProperties(t *testing.T) {
+	type lineInput struct {
+		Quantity   uint8
+		PriceMinor uint32
+		Discount   uint16
+		TaxRate    uint8
+	}
+	property := func(inputs []lineInput, jpy bool) bool {
+		currency := "USD"
+		if jpy {
+			currency = "JPY"
+		}
+		places := money.Places(currency)
+		invoice, _ := NewInvoice(uuid.New(), uuid.New(), uuid.New(), InvoiceTypeStandard, currency, PaymentTermNet30, time.Now())
+
+		gross := decimal.Zero
+		for _, in := range inputs {
+			quantity := decimal.NewFromInt(int64(in.Quantity) + 1)
+			price := money.FromMinor(int64(in.PriceMinor), currency)
+			discount := decimal.Min(money.FromMinor(int64(in.Discount), currency), quantity.Mul(price))
+			invoice.AddLine(InvoiceLine{
+				Quantity:  quantity,
+				UnitPrice: price,
+				Discount:  discount,
+				TaxRate:   decimal.NewFromInt(int64(in.TaxRate % 30)),
+			})
+			gross = gross.Add(quantity.Mul(price))
+		}
+
+		lineTotals := decimal.Zero
+		for _, line := range invoice.Lines {
+			if line.Total.Exponent() < -places || line.TaxAmount.Exponent() < -places {
+				return false
+			}
+			lineTotals = lineTotals.Add(line.Total).Add(line.TaxAmount)
+		}
+		return invoice.Subtotal.Equal(gross) &&
+			invoice.Total.Equal(invoice.Subtotal.Sub(invoice.DiscountTotal).Add(invoice.TaxTotal)) &&
+			invoice.Total.Equal(lineTotals) &&
+			invoice.AmountDue.Equal(invoice.Total)
+	}
+	assert.NoError(t, quick.Check(property, nil))
+}
+
+func TestInvoiceTaxRoundedToCurrency(t *testing.T) {
+	invoice, _ := NewInvoice(uuid.New(), uuid.New(), uuid.New(), InvoiceTypeStandard, "JPY", PaymentTermNet30, time.Now())
+	invoice.AddLine(InvoiceLine{
+		Quantity:  decimal.NewFromInt(3),
+		UnitPrice: decimal.NewFromInt(333),
+		Discount:  decimal.NewFromInt(10),
+		TaxRate:   decimal.NewFromInt(8),
+	})
+
+	assert.Equal(t, "999", invoice.Subtotal.String())
+	assert.Equal(t, "79", invoice.TaxTotal.String())
+	assert.Equal(t, "1068", invoice.Total.String())
+}
+
+func TestInvoiceRecordReminder(t *testing.T) {
+	invoice, _ := NewInvoice(uuid.New(), uuid.New(), uuid.New(), InvoiceTypeStandard, "USD", PaymentTermNet30, time.Now())
+	invoice.AddLine(InvoiceLine{Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(100)})
+	assert.ErrorIs(t, invoice.RecordReminder(time.Now()), ErrInvoiceNotRemindable, "drafts are not reminded")
+
+	invoice.Send()
+	at := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, invoice.RecordReminder(at))
+	require.NoError(t, invoice.RecordReminder(at.AddDate(0, 0, 7)))
+	assert.Equal(t, 2, invoice.RemindersSent)
+	assert.Equal(t, at.AddDate(0, 0, 7), *invoice.LastReminderAt)
+
+	invoice.MarkAsPaid(invoice.AmountDue)
+	assert.False(t, invoice.CanRemind())
+
+	creditNote, _ := NewInvoice(uuid.New(), uuid.New(), uuid.New(), InvoiceTypeCreditNote, "USD", PaymentTermNet30, time.Now())
+	creditNote.AddLine(InvoiceLine{Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(100)})
+	creditNote.Send()
+	assert.False(t, creditNote.CanRemind())
+}
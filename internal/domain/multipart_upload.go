@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Parts of a multipart upload are numbered from 1 to MaxMultipartParts;
+// all but the last must be at least MinMultipartPartSize bytes, as object
+// storage requires.
+const (
+	MinMultipartPartSize = 5 * 1024 * 1024
+	MaxMultipartParts    = 10000
+)
+
+// MultipartUpload is a file of Size bytes uploaded in numbered parts,
+// straight into the object storage multipart upload StorageUploadID of
+// ObjectKey. Parts may be sent in any order, and sent again to replace
+// them; completing the upload joins them, in order of their numbers, into
+// the document DocumentID. Uploads not completed by ExpiresAt are aborted.
+type MultipartUpload struct {
+	ID              uuid.UUID       `json:"id" bson:"_id"`
+	TenantID        uuid.UUID       `json:"tenantId" bson:"tenantId"`
+	UserID          string          `json:"userId" bson:"userId"`
+	DocumentID      uuid.UUID       `json:"documentId" bson:"documentId"`
+	Type            DocumentType    `json:"type" bson:"type"`
+	FileName        string          `json:"fileName" bson:"fileName"`
+	MimeType        string          `json:"mimeType" bson:"mimeType"`
+	Tags            []string        `json:"tags,omitempty" bson:"tags,omitempty"`
+	Size            int64           `json:"size" bson:"size"`
+	Bucket          string          `json:"-" bson:"bucket"`
+	ObjectKey       string          `json:"-" bson:"objectKey"`
+	StorageUploadID string          `json:"-" bson:"storageUploadId"`
+	Parts           []MultipartPart `json:"parts" bson:"parts"`
+	CreatedAt       time.Time       `json:"createdAt" bson:"createdAt"`
+	ExpiresAt       time.Time       `json:"expiresAt" bson:"expiresAt"`
+	CompletedAt     *time.Time      `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+}
+
+// MultipartPart is a part of a multipart upload, identified in object
+// storage by its ETag.
+type MultipartPart struct {
+	Number int    `json:"number" bson:"number"`
+	Size   int64  `json:"size" bson:"size"`
+	ETag   string `json:"etag" bson:"etag"`
+}
+
+// Received returns how many bytes of the upload's parts have arrived.
+func (u *MultipartUpload) Received() int64 {
+	var received int64
+	for _, part := range u.Parts {
+		received += part.Size
+	}
+	return received
+}
+
+// CheckPart checks that a part numbered number of size bytes can be added
+// to the upload, replacing any part of that number, without its parts
+// going past its size.
+func (u *MultipartUpload) CheckPart(number int, size int64) error {
+	if number < 1 || number > MaxMultipartParts {
+		return ErrInvalidPartNumber
+	}
+	if size <= 0 {
+		return ErrMultipartPartEmpty
+	}
+	received := u.Received()
+	for _, part := range u.Parts {
+		if part.Number == number {
+			received -= part.Size
+		}
+	}
+	if received+size > u.Size {
+		return &DocumentError{Code: ErrMultipartSizeMismatch.Code,
+			Message: fmt.Sprintf("the part would take the upload past its size of %d bytes", u.Size)}
+	}
+	return nil
+}
+
+// CompletedParts returns the upload's parts in order of their numbers,
+// once every byte of it has arrived in parts large enough to be joined.
+func (u *MultipartUpload) CompletedParts() ([]MultipartPart, error) {
+	if received := u.Received(); received != u.Size {
+		return nil, &DocumentError{Code: ErrMultipartSizeMismatch.Code,
+			Message: fmt.Sprintf("%d of the upload's %d bytes have arrived", received, u.Size)}
+	}
+	parts := append([]MultipartPart(nil), u.Parts...)
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	for _, part := range parts[:len(parts)-1] {
+		if part.Size < MinMultipartPartSize {
+			return nil, &DocumentError{Code: ErrMultipartPartTooSmall.Code,
+				Message: fmt.Sprintf("part %d is %d bytes; all but the last part must be at least %d", part.Number, part.Size, MinMultipartPartSize)}
+		}
+	}
+	return parts, nil
+}
+
+// Expired reports whether the upload was abandoned before it completed.
+func (u *MultipartUpload) Expired(now time.Time) bool {
+	return u.CompletedAt == nil && !now.Before(u.ExpiresAt)
+}
+
+var (
+	ErrInvalidPartNumber     = &DocumentError{Code: "INVALID_PART_NUMBER", Message: fmt.Sprintf("partNumber must be between 1 and %d", MaxMultipartParts)}
+	ErrMultipartPartEmpty    = &DocumentError{Code: "MULTIPART_PART_EMPTY", Message: "a part must have a Content-Length of at least one byte"}
+	ErrMultipartSizeMismatch = &DocumentError{Code: "MULTIPART_SIZE_MISMATCH", Message: "the upload's parts do not add up to its size"}
+	ErrMultipartPartTooSmall = &DocumentError{Code: "MULTIPART_PART_TOO_SMALL", Message: "all but the last part must be at least 5 MiB"}
+)
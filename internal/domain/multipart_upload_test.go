@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultipartUpload_Parts(t *testing.T) {
+	upload := &MultipartUpload{Size: 2*MinMultipartPartSize + 100}
+	assert.ErrorIs(t, upload.CheckPart(0, 100), ErrInvalidPartNumber)
+	assert.ErrorIs(t, upload.CheckPart(MaxMultipartParts+1, 100), ErrInvalidPartNumber)
+	assert.ErrorIs(t, upload.CheckPart(1, 0), ErrMultipartPartEmpty)
+	assert.ErrorIs(t, upload.CheckPart(1, upload.Size+1), ErrMultipartSizeMismatch)
+
+	upload.Parts = []MultipartPart{
+		{Number: 3, Size: 100, ETag: "c"},
+		{Number: 1, Size: MinMultipartPartSize, ETag: "a"},
+	}
+	_, err := upload.CompletedParts()
+	assert.ErrorIs(t, err, ErrMultipartSizeMismatch)
+	require.NoError(t, upload.CheckPart(2, MinMultipartPartSize))
+	require.NoError(t, upload.CheckPart(3, 100), "a part may be sent again")
+	assert.Error(t, upload.CheckPart(2, MinMultipartPartSize+1))
+
+	upload.Parts = append(upload.Parts, MultipartPart{Number: 2, Size: MinMultipartPartSize, ETag: "b"})
+	parts, err := upload.CompletedParts()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, []int{parts[0].Number, parts[1].Number, parts[2].Number})
+	assert.Equal(t, 3, upload.Parts[0].Number, "the upload's parts are left in their order")
+
+	upload.Parts[1].Size, upload.Parts[0].Size = 100, MinMultipartPartSize
+	_, err = upload.CompletedParts()
+	var docErr *DocumentError
+	require.ErrorAs(t, err, &docErr)
+	assert.Equal(t, ErrMultipartPartTooSmall.Code, docErr.Code)
+}
+
+func TestMultipartUpload_Expired(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	upload := &MultipartUpload{ExpiresAt: now.Add(time.Hour)}
+	assert.False(t, upload.Expired(now))
+	assert.True(t, upload.Expired(now.Add(time.Hour)))
+	upload.CompletedAt = &now
+	assert.False(t, upload.Expired(now.Add(2*time.Hour)), "completed uploads do not expire")
+}
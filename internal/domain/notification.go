@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelInApp = "in_app"
+)
+
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// Notification audiences: the client an event is about, the user who
+// caused it, or the users it mentions (the "mentions" of its data).
+const (
+	AudienceClient    = "client"
+	AudienceUser      = "user"
+	AudienceMentioned = "mentioned"
+)
+
+var ErrInvalidNotificationTemplate = errors.New("invalid notification template")
+
+func ValidChannel(channel string) bool {
+	return channel == ChannelEmail || channel == ChannelSMS || channel == ChannelInApp
+}
+
+// NotificationTemplate renders one event type for one channel and locale.
+// Templates use text/template syntax; see notification.TemplateData for the
+// fields available. Subject is ignored for SMS.
+type NotificationTemplate struct {
+	ID        string    `json:"id" bson:"_id"`
+	TenantID  string    `json:"tenantId" bson:"tenantId"`
+	EventType string    `json:"eventType" bson:"eventType"`
+	Channel   string    `json:"channel" bson:"channel"`
+	Locale    string    `json:"locale" bson:"locale"`
+	Subject   string    `json:"subject,omitempty" bson:"subject,omitempty"`
+	Body      string    `json:"body" bson:"body"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+func (t *NotificationTemplate) Validate() error {
+	if t.EventType == "" {
+		return fmt.Errorf("%w: eventType is required", ErrInvalidNotificationTemplate)
+	}
+	if !ValidChannel(t.Channel) {
+		return fmt.Errorf("%w: unknown channel %q", ErrInvalidNotificationTemplate, t.Channel)
+	}
+	if t.Locale == "" {
+		return fmt.Errorf("%w: locale is required", ErrInvalidNotificationTemplate)
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return fmt.Errorf("%w: body is required", ErrInvalidNotificationTemplate)
+	}
+	return nil
+}
+
+// NotificationPreference holds a user's contact details and opt-outs.
+// Channels missing from Channels are enabled.
+type NotificationPreference struct {
+	TenantID        string          `json:"tenantId" bson:"tenantId"`
+	UserID          string          `json:"userId" bson:"userId"`
+	Email           string          `json:"email,omitempty" bson:"email,omitempty"`
+	Phone           string          `json:"phone,omitempty" bson:"phone,omitempty"`
+	Locale          string          `json:"locale,omitempty" bson:"locale,omitempty"`
+	Channels        map[string]bool `json:"channels,omitempty" bson:"channels,omitempty"`
+	MutedEventTypes []string        `json:"mutedEventTypes,omitempty" bson:"mutedEventTypes,omitempty"`
+	UpdatedAt       time.Time       `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Allows reports whether the user wants eventType notifications on channel.
+func (p *NotificationPreference) Allows(channel, eventType string) bool {
+	if enabled, ok := p.Channels[channel]; ok && !enabled {
+		return false
+	}
+	for _, muted := range p.MutedEventTypes {
+		if muted == eventType {
+			return false
+		}
+	}
+	return true
+}
+
+// Notification is a message sent, or being sent, to one recipient on one
+// channel. In-app notifications form the user's inbox; the others are kept
+// as a delivery log.
+type Notification struct {
+	ID        string     `json:"id" bson:"_id"`
+	TenantID  string     `json:"tenantId" bson:"tenantId"`
+	UserID    string     `json:"userId,omitempty" bson:"userId,omitempty"`
+	EventID   string     `json:"eventId" bson:"eventId"`
+	EventType string     `json:"eventType" bson:"eventType"`
+	Channel   string     `json:"channel" bson:"channel"`
+	Recipient string     `json:"recipient" bson:"recipient"`
+	Subject   string     `json:"subject,omitempty" bson:"subject,omitempty"`
+	Body      string     `json:"body" bson:"body"`
+	Status    string     `json:"status" bson:"status"`
+	Error     string     `json:"error,omitempty" bson:"error,omitempty"`
+	ReadAt    *time.Time `json:"readAt,omitempty" bson:"readAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	SentAt    *time.Time `json:"sentAt,omitempty" bson:"sentAt,omitempty"`
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationPreference_Allows(t *testing.T) {
+	var none NotificationPreference
+	assert.True(t, none.Allows(ChannelEmail, "invoice.sent"))
+
+	pref := NotificationPreference{
+		Channels:        map[string]bool{ChannelSMS: false, ChannelEmail: true},
+		MutedEventTypes: []string{"invoice.paid"},
+	}
+	assert.True(t, pref.Allows(ChannelEmail, "payment.failed"))
+	assert.True(t, pref.Allows(ChannelInApp, "payment.failed"))
+	assert.False(t, pref.Allows(ChannelSMS, "payment.failed"))
+	assert.False(t, pref.Allows(ChannelEmail, "invoice.paid"))
+}
+
+func TestNotificationTemplate_Validate(t *testing.T) {
+	valid := NotificationTemplate{EventType: "invoice.sent", Channel: ChannelEmail, Locale: "en", Body: "Hello"}
+	require.NoError(t, valid.Validate())
+
+	for name, tpl := range map[string]NotificationTemplate{
+		"no event type":   {Channel: ChannelEmail, Locale: "en", Body: "Hello"},
+		"unknown channel": {EventType: "invoice.sent", Channel: "fax", Locale: "en", Body: "Hello"},
+		"no locale":       {EventType: "invoice.sent", Channel: ChannelEmail, Body: "Hello"},
+		"empty body":      {EventType: "invoice.sent", Channel: ChannelEmail, Locale: "en", Body: " "},
+	} {
+		assert.True(t, errors.Is(tpl.Validate(), ErrInvalidNotificationTemplate), name)
+	}
+}
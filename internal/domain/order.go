@@ -1,9 +1,11 @@
 package domain
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
 	"github.com/shopspring/decimal"
 )
 
@@ -145,6 +147,32 @@ type OrderLine struct {
 	ReturnableQty int                    `json:"returnableQty" bson:"returnableQty"`
 	Position      int                    `json:"position" bson:"position"`
 	CustomFields  map[string]interface{} `json:"customFields" bson:"customFields"`
+	FloorPrice    decimal.Decimal        `json:"floorPrice" bson:"floorPrice"`
+	PriceOverride *PriceOverride         `json:"priceOverride,omitempty" bson:"priceOverride,omitempty"`
+}
+
+// NetUnitPrice is what one unit of the line sells for after its discount.
+func (l OrderLine) NetUnitPrice() decimal.Decimal {
+	if l.Quantity <= 0 {
+		return l.UnitPrice
+	}
+	quantity := decimal.NewFromInt(int64(l.Quantity))
+	return l.UnitPrice.Mul(quantity).Sub(l.Discount).Div(quantity)
+}
+
+// PriceOverride lets an order line sell below its floor price. It is
+// requested with a reason when the line is added and holds the order back
+// from confirmation until another user approves it.
+type PriceOverride struct {
+	Reason      string     `json:"reason" bson:"reason"`
+	RequestedBy uuid.UUID  `json:"requestedBy" bson:"requestedBy"`
+	RequestedAt time.Time  `json:"requestedAt" bson:"requestedAt"`
+	ApprovedBy  *uuid.UUID `json:"approvedBy" bson:"approvedBy"`
+	ApprovedAt  *time.Time `json:"approvedAt" bson:"approvedAt"`
+}
+
+func (p *PriceOverride) IsApproved() bool {
+	return p.ApprovedBy != nil
 }
 
 type OrderDiscount struct {
@@ -193,11 +221,19 @@ type OrderFulfillment struct {
 	ShippedDate    *time.Time        `json:"shippedDate" bson:"shippedDate"`
 	DeliveredDate  *time.Time        `json:"deliveredDate" bson:"deliveredDate"`
 	Lines          []FulfillmentLine `json:"lines" bson:"lines"`
+	// DeliveryNoteNumber is numbered when the shipment's first delivery
+	// note or packing slip is generated, and kept by those generated
+	// again; DeliveryNoteID and PackingSlipID are the latest documents.
+	DeliveryNoteNumber string     `json:"deliveryNoteNumber,omitempty" bson:"deliveryNoteNumber,omitempty"`
+	DeliveryNoteID     *uuid.UUID `json:"deliveryNoteId,omitempty" bson:"deliveryNoteId,omitempty"`
+	PackingSlipID      *uuid.UUID `json:"packingSlipId,omitempty" bson:"packingSlipId,omitempty"`
 }
 
 type FulfillmentLine struct {
-	OrderLineID uuid.UUID `json:"orderLineId" bson:"orderLineId"`
-	Quantity    int       `json:"quantity" bson:"quantity"`
+	OrderLineID   uuid.UUID `json:"orderLineId" bson:"orderLineId"`
+	Quantity      int       `json:"quantity" bson:"quantity"`
+	LotNumber     string    `json:"lotNumber,omitempty" bson:"lotNumber,omitempty"`
+	SerialNumbers []string  `json:"serialNumbers,omitempty" bson:"serialNumbers,omitempty"`
 }
 
 func NewOrder(
@@ -247,12 +283,68 @@ func NewOrder(
 func (o *Order) AddLine(line OrderLine) {
 	line.ID = uuid.New()
 	line.Position = len(o.Lines) + 1
-	line.RowTotal = line.UnitPrice.Mul(decimal.NewFromInt(int64(line.Quantity))).Sub(line.Discount)
+	line.RowTotal = money.Round(line.UnitPrice.Mul(decimal.NewFromInt(int64(line.Quantity))).Sub(line.Discount), o.Currency)
 	line.RowCost = line.UnitCost.Mul(decimal.NewFromInt(int64(line.Quantity)))
 	o.Lines = append(o.Lines, line)
 	o.recalculate()
 }
 
+// AddPricedLine adds line with the floor price its product may sell at. A
+// line below the floor needs overrideReason, recorded as a price override
+// requested by requestedBy, and is returned with its ID set.
+func (o *Order) AddPricedLine(line OrderLine, floor decimal.Decimal, requestedBy uuid.UUID, overrideReason string) (*OrderLine, error) {
+	line.FloorPrice = floor
+	line.PriceOverride = nil
+	if line.NetUnitPrice().LessThan(floor) {
+		if strings.TrimSpace(overrideReason) == "" {
+			return nil, ErrPriceBelowFloor
+		}
+		line.PriceOverride = &PriceOverride{
+			Reason:      strings.TrimSpace(overrideReason),
+			RequestedBy: requestedBy,
+			RequestedAt: time.Now().UTC(),
+		}
+	}
+	o.AddLine(line)
+	return &o.Lines[len(o.Lines)-1], nil
+}
+
+// ApprovePriceOverride approves the price override of a line. The user who
+// requested it cannot approve it.
+func (o *Order) ApprovePriceOverride(lineID, approverID uuid.UUID) (*OrderLine, error) {
+	for i := range o.Lines {
+		line := &o.Lines[i]
+		if line.ID != lineID {
+			continue
+		}
+		switch {
+		case line.PriceOverride == nil:
+			return nil, ErrNoPriceOverride
+		case line.PriceOverride.IsApproved():
+			return nil, ErrPriceOverrideApproved
+		case line.PriceOverride.RequestedBy == approverID:
+			return nil, ErrPriceOverrideSelfApproval
+		}
+		now := time.Now().UTC()
+		line.PriceOverride.ApprovedBy = &approverID
+		line.PriceOverride.ApprovedAt = &now
+		o.UpdatedAt = now
+		return line, nil
+	}
+	return nil, ErrOrderLineNotFound
+}
+
+// HasPendingPriceOverrides reports whether a line is priced below its floor
+// without an approved override.
+func (o *Order) HasPendingPriceOverrides() bool {
+	for _, line := range o.Lines {
+		if line.PriceOverride != nil && !line.PriceOverride.IsApproved() {
+			return true
+		}
+	}
+	return false
+}
+
 func (o *Order) RemoveLine(lineID uuid.UUID) {
 	newLines := make([]OrderLine, 0, len(o.Lines))
 	for _, line := range o.Lines {
@@ -293,13 +385,19 @@ func (o *Order) SetShippingMethod(method, provider string, cost decimal.Decimal)
 	o.recalculate()
 }
 
-func (o *Order) Confirm() {
+// Confirm confirms a draft or pending order. Orders with price overrides
+// still awaiting approval cannot be confirmed.
+func (o *Order) Confirm() error {
+	if o.HasPendingPriceOverrides() {
+		return ErrPriceOverridePending
+	}
 	if o.Status == OrderStatusDraft || o.Status == OrderStatusPending {
 		o.Status = OrderStatusConfirmed
 		now := time.Now().UTC()
 		o.ConfirmedAt = &now
 		o.UpdatedAt = now
 	}
+	return nil
 }
 
 func (o *Order) Process() {
@@ -326,6 +424,79 @@ func (o *Order) Deliver() {
 	o.UpdatedAt = now
 }
 
+// FindLine returns the line with id, or nil when the order has none.
+func (o *Order) FindLine(id uuid.UUID) *OrderLine {
+	for i := range o.Lines {
+		if o.Lines[i].ID == id {
+			return &o.Lines[i]
+		}
+	}
+	return nil
+}
+
+// FindFulfillment returns the shipment with id, or nil when the order has
+// none.
+func (o *Order) FindFulfillment(id uuid.UUID) *OrderFulfillment {
+	for i := range o.Fulfillments {
+		if o.Fulfillments[i].ID == id {
+			return &o.Fulfillments[i]
+		}
+	}
+	return nil
+}
+
+// FulfillmentWeight is the weight of what a shipment carries, from the
+// weights of the order lines it ships.
+func (o *Order) FulfillmentWeight(fulfillment *OrderFulfillment) decimal.Decimal {
+	weight := decimal.Zero
+	for _, shipped := range fulfillment.Lines {
+		for _, line := range o.Lines {
+			if line.ID == shipped.OrderLineID {
+				weight = weight.Add(line.Weight.Mul(decimal.NewFromInt(int64(shipped.Quantity))))
+			}
+		}
+	}
+	return weight
+}
+
+// ShippedQuantity is the units of an order line its shipments carry.
+func (o *Order) ShippedQuantity(lineID uuid.UUID) int {
+	quantity := 0
+	for _, fulfillment := range o.Fulfillments {
+		for _, shipped := range fulfillment.Lines {
+			if shipped.OrderLineID == lineID {
+				quantity += shipped.Quantity
+			}
+		}
+	}
+	return quantity
+}
+
+// DeliverShipment records that one of the order's shipments was delivered
+// at deliveredAt. The order is delivered with its last shipment once
+// everything has been shipped.
+func (o *Order) DeliverShipment(id uuid.UUID, deliveredAt time.Time) error {
+	fulfillment := o.FindFulfillment(id)
+	if fulfillment == nil {
+		return ErrFulfillmentNotFound
+	}
+	deliveredAt = deliveredAt.UTC()
+	fulfillment.DeliveredDate = &deliveredAt
+	o.UpdatedAt = time.Now().UTC()
+
+	if o.FulfillmentStatus != FulfillmentStatusFulfilled {
+		return nil
+	}
+	for _, f := range o.Fulfillments {
+		if f.DeliveredDate == nil {
+			return nil
+		}
+	}
+	o.Status = OrderStatusDelivered
+	o.DeliveredDate = &deliveredAt
+	return nil
+}
+
 func (o *Order) Complete() {
 	if o.Status == OrderStatusDelivered || o.Status == OrderStatusShipped {
 		o.Status = OrderStatusCompleted
@@ -423,6 +594,16 @@ var ErrOrderNotEditable = &OrderError{
 	Message: "Order cannot be edited in current status",
 }
 
+var (
+	ErrOrderLineNotFound         = &OrderError{Code: "ORDER_LINE_NOT_FOUND", Message: "Order line not found"}
+	ErrPriceBelowFloor           = &OrderError{Code: "PRICE_BELOW_FLOOR", Message: "Price is below the product's floor price; an override reason is required"}
+	ErrNoPriceOverride           = &OrderError{Code: "NO_PRICE_OVERRIDE", Message: "Order line has no price override"}
+	ErrPriceOverrideApproved     = &OrderError{Code: "PRICE_OVERRIDE_APPROVED", Message: "Price override is already approved"}
+	ErrPriceOverrideSelfApproval = &OrderError{Code: "PRICE_OVERRIDE_SELF_APPROVAL", Message: "Price override must be approved by someone other than its requester"}
+	ErrPriceOverridePending      = &OrderError{Code: "PRICE_OVERRIDE_PENDING", Message: "Order has price overrides awaiting approval"}
+	ErrFulfillmentNotFound       = &OrderError{Code: "FULFILLMENT_NOT_FOUND", Message: "Order has no such shipment"}
+)
+
 type OrderError struct {
 	Code    string
 	Message string
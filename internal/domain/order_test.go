@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderAddPricedLine(t *testing.T) {
+	order, _ := NewOrder(uuid.New(), uuid.New(), uuid.New(), OrderTypeStandard, OrderSourcePhone, "USD")
+	clerk := uuid.New()
+	floor := decimal.NewFromInt(10)
+
+	line, err := order.AddPricedLine(OrderLine{ProductID: uuid.New(), Quantity: 2, UnitPrice: decimal.NewFromInt(12)}, floor, clerk, "")
+	require.NoError(t, err)
+	assert.Nil(t, line.PriceOverride)
+	assert.Equal(t, "10", line.FloorPrice.String())
+
+	_, err = order.AddPricedLine(OrderLine{ProductID: uuid.New(), Quantity: 2, UnitPrice: decimal.NewFromInt(12), Discount: decimal.NewFromInt(6)}, floor, clerk, " ")
+	assert.Equal(t, ErrPriceBelowFloor, err, "the discount takes the net price to 9")
+	assert.Len(t, order.Lines, 1)
+
+	line, err = order.AddPricedLine(OrderLine{ProductID: uuid.New(), Quantity: 1, UnitPrice: decimal.NewFromInt(9)}, floor, clerk, "price match")
+	require.NoError(t, err)
+	require.NotNil(t, line.PriceOverride)
+	assert.Equal(t, "price match", line.PriceOverride.Reason)
+	assert.Equal(t, clerk, line.PriceOverride.RequestedBy)
+	assert.False(t, line.PriceOverride.IsApproved())
+	assert.Equal(t, "33", order.Subtotal.String())
+}
+
+func TestOrderApprovePriceOverride(t *testing.T) {
+	order, _ := NewOrder(uuid.New(), uuid.New(), uuid.New(), OrderTypeStandard, OrderSourcePhone, "USD")
+	clerk := uuid.New()
+	manager := uuid.New()
+
+	cheap, _ := order.AddPricedLine(OrderLine{ProductID: uuid.New(), Quantity: 1, UnitPrice: decimal.NewFromInt(9)}, decimal.NewFromInt(10), clerk, "price match")
+	cheapID := cheap.ID
+	full, _ := order.AddPricedLine(OrderLine{ProductID: uuid.New(), Quantity: 1, UnitPrice: decimal.NewFromInt(12)}, decimal.NewFromInt(10), clerk, "")
+
+	assert.Equal(t, ErrPriceOverridePending, order.Confirm())
+	assert.Equal(t, OrderStatusDraft, order.Status)
+
+	_, err := order.ApprovePriceOverride(cheapID, clerk)
+	assert.Equal(t, ErrPriceOverrideSelfApproval, err)
+	_, err = order.ApprovePriceOverride(full.ID, manager)
+	assert.Equal(t, ErrNoPriceOverride, err)
+	_, err = order.ApprovePriceOverride(uuid.New(), manager)
+	assert.Equal(t, ErrOrderLineNotFound, err)
+
+	line, err := order.ApprovePriceOverride(cheapID, manager)
+	require.NoError(t, err)
+	assert.Equal(t, manager, *line.PriceOverride.ApprovedBy)
+	_, err = order.ApprovePriceOverride(cheapID, manager)
+	assert.Equal(t, ErrPriceOverrideApproved, err)
+
+	require.NoError(t, order.Confirm())
+	assert.Equal(t, OrderStatusConfirmed, order.Status)
+}
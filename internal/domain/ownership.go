@@ -0,0 +1,36 @@
+package domain
+
+// Ownership is embedded in records that belong to a sales rep: clients, and
+// the invoices and payments of a client, which carry their client's
+// ownership. Territory is the sales territory the record lies in.
+type Ownership struct {
+	OwnerID   string `json:"ownerId,omitempty" bson:"ownerId,omitempty"`
+	Territory string `json:"territory,omitempty" bson:"territory,omitempty"`
+}
+
+// Data scopes of a user: users with the tenant scope see every record of
+// their tenant, users with the own scope only the records they own or that
+// lie in one of their territories.
+const (
+	DataScopeTenant = "tenant"
+	DataScopeOwn    = "own"
+)
+
+// Visibility is the set of records a caller may read. The zero Visibility
+// is unrestricted: every record of the tenant.
+type Visibility struct {
+	Scope       string
+	OwnerID     string
+	Territories []string
+}
+
+// OwnVisibility restricts a caller to the records userID owns and those in
+// territories.
+func OwnVisibility(userID string, territories []string) Visibility {
+	return Visibility{Scope: DataScopeOwn, OwnerID: userID, Territories: territories}
+}
+
+// Restricted reports whether v hides any record.
+func (v Visibility) Restricted() bool {
+	return v.Scope == DataScopeOwn
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
@@ -33,25 +34,37 @@ const (
 )
 
 type Payment struct {
-	ID             uuid.UUID         `json:"id" bson:"_id"`
-	TenantID       uuid.UUID         `json:"tenantId" bson:"tenantId"`
-	InvoiceID      uuid.UUID         `json:"invoiceId" bson:"invoiceId"`
-	ClientID       uuid.UUID         `json:"clientId" bson:"clientId"`
-	Amount         decimal.Decimal   `json:"amount" bson:"amount"`
-	Currency       string            `json:"currency" bson:"currency"`
-	Status         PaymentStatus     `json:"status" bson:"status"`
-	Method         PaymentMethod     `json:"method" bson:"method"`
-	Provider       string            `json:"provider" bson:"provider"`
-	ProviderID     string            `json:"providerId" bson:"providerId"`
-	TransactionID  string            `json:"transactionId" bson:"transactionId"`
-	Reference      string            `json:"reference" bson:"reference"`
-	Description    string            `json:"description" bson:"description"`
-	Metadata       map[string]string `json:"metadata" bson:"metadata"`
-	FailureCode    string            `json:"failureCode" bson:"failureCode"`
-	FailureMessage string            `json:"failureMessage" bson:"failureMessage"`
-	ProcessedAt    *time.Time        `json:"processedAt" bson:"processedAt"`
-	CreatedAt      time.Time         `json:"createdAt" bson:"createdAt"`
-	UpdatedAt      time.Time         `json:"updatedAt" bson:"updatedAt"`
+	ID             uuid.UUID          `json:"id" bson:"_id"`
+	TenantID       uuid.UUID          `json:"tenantId" bson:"tenantId"`
+	InvoiceID      uuid.UUID          `json:"invoiceId" bson:"invoiceId"`
+	ClientID       uuid.UUID          `json:"clientId" bson:"clientId"`
+	Amount         decimal.Decimal    `json:"amount" bson:"amount"`
+	Currency       string             `json:"currency" bson:"currency"`
+	Status         PaymentStatus      `json:"status" bson:"status"`
+	Method         PaymentMethod      `json:"method" bson:"method"`
+	Provider       string             `json:"provider" bson:"provider"`
+	ProviderID     string             `json:"providerId" bson:"providerId"`
+	TransactionID  string             `json:"transactionId" bson:"transactionId"`
+	Reference      string             `json:"reference" bson:"reference"`
+	Description    string             `json:"description" bson:"description"`
+	Metadata       map[string]string  `json:"metadata" bson:"metadata"`
+	FailureCode    string             `json:"failureCode" bson:"failureCode"`
+	FailureMessage string             `json:"failureMessage" bson:"failureMessage"`
+	Settlement     *PaymentSettlement `json:"settlement,omitempty" bson:"settlement,omitempty"`
+	// AmountApplied is how much of the payment is applied to invoices, by
+	// the active Applications; the rest is unapplied.
+	AmountApplied decimal.Decimal      `json:"amountApplied" bson:"amountApplied"`
+	Applications  []PaymentApplication `json:"applications,omitempty" bson:"applications,omitempty"`
+	// AmountRefunded is how much of the payment's account credit is
+	// refunded to the client.
+	AmountRefunded decimal.Decimal `json:"amountRefunded" bson:"amountRefunded"`
+	// Conversion is the amount in the tenant's reporting currency, at the
+	// rate of the day the payment was created.
+	Conversion  *CurrencyConversion `json:"conversion,omitempty" bson:"conversion,omitempty"`
+	ProcessedAt *time.Time          `json:"processedAt" bson:"processedAt"`
+	CreatedAt   time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt" bson:"updatedAt"`
+	Version     int64               `json:"version" bson:"version"`
 }
 
 type PaymentRequest struct {
@@ -126,6 +139,8 @@ type StripeProcessor struct {
 	apiKey        string
 	webhookSecret string
 	version       string
+	baseURL       string
+	client        *http.Client
 }
 
 type PayPalProcessor struct {
@@ -202,6 +217,8 @@ func NewStripeProcessor(apiKey, webhookSecret string) *StripeProcessor {
 		apiKey:        apiKey,
 		webhookSecret: webhookSecret,
 		version:       "2023-10-16",
+		baseURL:       "https://api.stripe.com",
+		client:        &http.Client{Timeout: 30 * time.Second},
 	}
 }
 
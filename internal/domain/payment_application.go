@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// PaymentApplication is an amount of a payment applied to an invoice. It is
+// kept on both; once unapplied, e.g. because the receipt was applied to the
+// wrong invoice, it stays in their history with who unapplied it, when and
+// why. AppliedBy is nil for payments applied as they complete.
+type PaymentApplication struct {
+	ID            uuid.UUID       `json:"id" bson:"id"`
+	PaymentID     uuid.UUID       `json:"paymentId" bson:"paymentId"`
+	InvoiceID     uuid.UUID       `json:"invoiceId" bson:"invoiceId"`
+	InvoiceNumber string          `json:"invoiceNumber" bson:"invoiceNumber"`
+	Amount        decimal.Decimal `json:"amount" bson:"amount"`
+	AppliedBy     *uuid.UUID      `json:"appliedBy,omitempty" bson:"appliedBy,omitempty"`
+	AppliedAt     time.Time       `json:"appliedAt" bson:"appliedAt"`
+	UnappliedBy   *uuid.UUID      `json:"unappliedBy,omitempty" bson:"unappliedBy,omitempty"`
+	UnappliedAt   *time.Time      `json:"unappliedAt,omitempty" bson:"unappliedAt,omitempty"`
+	UnapplyReason string          `json:"unapplyReason,omitempty" bson:"unapplyReason,omitempty"`
+}
+
+// Active reports whether the application still counts towards the
+// balances of its payment and invoice.
+func (a PaymentApplication) Active() bool {
+	return a.UnappliedAt == nil
+}
+
+// Unapplied returns the amount of the payment neither applied to an
+// invoice nor refunded.
+func (p *Payment) Unapplied() decimal.Decimal {
+	return p.Amount.Sub(p.AmountApplied).Sub(p.AmountRefunded)
+}
+
+// ApplyTo applies amount of a completed payment to an open invoice in the
+// same currency, which it settles like any payment, and records the
+// application on both. by is nil when the payment is applied as it
+// completes.
+func (p *Payment) ApplyTo(invoice *Invoice, amount decimal.Decimal, by *uuid.UUID, at time.Time) (PaymentApplication, error) {
+	if p.Status != PaymentStatusCompleted {
+		return PaymentApplication{}, ErrPaymentNotApplicable
+	}
+	if invoice.Type == InvoiceTypeCreditNote || !invoice.IsOpen() {
+		return PaymentApplication{}, ErrInvoiceNotPayable
+	}
+	if invoice.Currency != p.Currency {
+		return PaymentApplication{}, ErrApplicationCurrency
+	}
+	if !amount.IsPositive() || amount.GreaterThan(p.Unapplied()) {
+		return PaymentApplication{}, ErrApplicationExceedsAmount
+	}
+	if err := invoice.ApplyPayment(amount); err != nil {
+		return PaymentApplication{}, ErrApplicationExceedsAmount
+	}
+
+	application := PaymentApplication{
+		ID:            uuid.New(),
+		PaymentID:     p.ID,
+		InvoiceID:     invoice.ID,
+		InvoiceNumber: invoice.InvoiceNumber,
+		Amount:        amount,
+		AppliedBy:     by,
+		AppliedAt:     at,
+	}
+	p.AmountApplied = p.AmountApplied.Add(amount)
+	p.Applications = append(p.Applications, application)
+	p.UpdatedAt = at
+	invoice.PaymentApplications = append(invoice.PaymentApplications, application)
+	return application, nil
+}
+
+// Unapply takes the active application applicationID off invoice, which
+// owes its amount again, and leaves the amount unapplied on the payment
+// to be applied elsewhere.
+func (p *Payment) Unapply(applicationID uuid.UUID, invoice *Invoice, by uuid.UUID, reason string, at time.Time) (PaymentApplication, error) {
+	index := -1
+	for i, application := range p.Applications {
+		if application.ID == applicationID && application.InvoiceID == invoice.ID && application.Active() {
+			index = i
+		}
+	}
+	if index < 0 {
+		return PaymentApplication{}, ErrPaymentApplicationNotFound
+	}
+
+	application := &p.Applications[index]
+	if err := invoice.ReversePayment(application.Amount); err != nil {
+		return PaymentApplication{}, err
+	}
+	application.UnappliedBy = &by
+	application.UnappliedAt = &at
+	application.UnapplyReason = reason
+	p.AmountApplied = p.AmountApplied.Sub(application.Amount)
+	p.UpdatedAt = at
+
+	for i := range invoice.PaymentApplications {
+		if invoice.PaymentApplications[i].ID == applicationID {
+			invoice.PaymentApplications[i] = *application
+		}
+	}
+	return *application, nil
+}
+
+// ReversePayment takes amount paid off the invoice again. A paid invoice
+// reopens, as sent if it had been sent.
+func (i *Invoice) ReversePayment(amount decimal.Decimal) error {
+	if amount.GreaterThan(i.AmountPaid) {
+		return ErrReversalExceedsPaid
+	}
+	i.AmountPaid = i.AmountPaid.Sub(amount)
+	i.AmountDue = i.Total.Sub(i.AmountPaid)
+	if i.Status == InvoiceStatusPaid && i.AmountDue.IsPositive() {
+		i.Status = InvoiceStatusPending
+		if i.SentDate != nil {
+			i.Status = InvoiceStatusSent
+		}
+		i.PaidDate = nil
+	}
+	i.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+var (
+	ErrPaymentNotApplicable       = &PaymentError{Code: "PAYMENT_NOT_APPLICABLE", Message: "Only completed payments can be applied to invoices"}
+	ErrInvoiceNotPayable          = &PaymentError{Code: "INVOICE_NOT_PAYABLE", Message: "Payments are only applied to open invoices, not credit notes"}
+	ErrApplicationCurrency        = &PaymentError{Code: "APPLICATION_CURRENCY_MISMATCH", Message: "Invoice and payment are in different currencies"}
+	ErrApplicationExceedsAmount   = &PaymentError{Code: "APPLICATION_EXCEEDS_AMOUNT", Message: "Applied amount must be more than zero and at most the unapplied payment and the amount due"}
+	ErrPaymentApplicationNotFound = &PaymentError{Code: "PAYMENT_APPLICATION_NOT_FOUND", Message: "Payment has no such application to the invoice"}
+	ErrReversalExceedsPaid        = &PaymentError{Code: "REVERSAL_EXCEEDS_PAID", Message: "Reversed amount exceeds the amount paid"}
+)
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaymentApplyAndUnapply(t *testing.T) {
+	tenantID, clientID, userID := uuid.New(), uuid.New(), uuid.New()
+	openInvoice := func(number string, total int64) *Invoice {
+		invoice, err := NewInvoice(tenantID, clientID, userID, InvoiceTypeStandard, "EUR", PaymentTermNet30, time.Now())
+		require.NoError(t, err)
+		invoice.SetInvoiceNumber(number)
+		invoice.AddLine(InvoiceLine{Description: "Service", Quantity: decimal.NewFromInt(1), UnitPrice: decimal.NewFromInt(total)})
+		invoice.Send()
+		return invoice
+	}
+	wrong := openInvoice("INV-2026-000001", 100)
+	right := openInvoice("INV-2026-000002", 150)
+
+	payment := NewPayment(tenantID, wrong.ID, clientID, decimal.NewFromInt(100), "EUR", PaymentMethodBankTransfer)
+	_, err := payment.ApplyTo(wrong, decimal.NewFromInt(100), nil, time.Now())
+	assert.Equal(t, ErrPaymentNotApplicable, err, "a pending payment has nothing to apply")
+
+	appliedAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	payment.MarkAsCompleted(appliedAt)
+	misapplied, err := payment.ApplyTo(wrong, decimal.NewFromInt(100), nil, appliedAt)
+	require.NoError(t, err)
+	assert.Equal(t, InvoiceStatusPaid, wrong.Status)
+	assert.True(t, payment.Unapplied().IsZero())
+	assert.Equal(t, []PaymentApplication{misapplied}, wrong.PaymentApplications)
+
+	_, err = payment.ApplyTo(right, decimal.NewFromInt(1), &userID, appliedAt)
+	assert.Equal(t, ErrApplicationExceedsAmount, err, "the payment is fully applied")
+
+	unappliedAt := appliedAt.Add(24 * time.Hour)
+	_, err = payment.Unapply(misapplied.ID, right, userID, "Wrong invoice", unappliedAt)
+	assert.Equal(t, ErrPaymentApplicationNotFound, err, "the application is to another invoice")
+
+	unapplied, err := payment.Unapply(misapplied.ID, wrong, userID, "Wrong invoice", unappliedAt)
+	require.NoError(t, err)
+	assert.False(t, unapplied.Active())
+	assert.Equal(t, "Wrong invoice", unapplied.UnapplyReason)
+	assert.Equal(t, InvoiceStatusSent, wrong.Status, "the invoice reopens")
+	assert.Nil(t, wrong.PaidDate)
+	assert.True(t, wrong.AmountDue.Equal(decimal.NewFromInt(100)))
+	assert.Equal(t, unapplied, wrong.PaymentApplications[0], "the invoice keeps the unapplied application")
+	assert.True(t, payment.Unapplied().Equal(decimal.NewFromInt(100)))
+
+	_, err = payment.Unapply(misapplied.ID, wrong, userID, "Again", unappliedAt)
+	assert.Equal(t, ErrPaymentApplicationNotFound, err, "an application is unapplied once")
+
+	reapplied, err := payment.ApplyTo(right, decimal.NewFromInt(100), &userID, unappliedAt)
+	require.NoError(t, err)
+	assert.True(t, reapplied.Active())
+	assert.True(t, right.AmountDue.Equal(decimal.NewFromInt(50)))
+	assert.Equal(t, InvoiceStatusSent, right.Status)
+	assert.True(t, payment.AmountApplied.Equal(payment.Amount))
+	assert.Len(t, payment.Applications, 2)
+
+	usd, err := NewInvoice(tenantID, clientID, userID, InvoiceTypeStandard, "USD", PaymentTermNet30, time.Now())
+	require.NoError(t, err)
+	usd.Send()
+	_, err = payment.ApplyTo(usd, decimal.NewFromInt(1), &userID, unappliedAt)
+	assert.Equal(t, ErrApplicationCurrency, err)
+}
@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// PaymentIntentRequest asks a provider to prepare a payment that the
+// customer then confirms in the browser. PaymentID makes the request
+// idempotent.
+type PaymentIntentRequest struct {
+	PaymentID   uuid.UUID
+	Amount      decimal.Decimal
+	Currency    string
+	Description string
+	Metadata    map[string]string
+}
+
+// PaymentIntent is a payment prepared with a provider. ClientSecret lets
+// the frontend confirm it and is not stored.
+type PaymentIntent struct {
+	ID           string `json:"id"`
+	ClientSecret string `json:"client_secret"`
+	Status       string `json:"status"`
+}
+
+// PaymentIntentCreator is implemented by processors whose payments are
+// confirmed by the customer and completed by the provider's webhook.
+type PaymentIntentCreator interface {
+	CreatePaymentIntent(ctx context.Context, req *PaymentIntentRequest) (*PaymentIntent, error)
+}
+
+// ProviderError is an error reported by a payment provider's API.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s (%s)", e.Provider, e.Message, e.Code)
+	}
+	return fmt.Sprintf("%s: %s", e.Provider, e.Message)
+}
+
+// CreatePaymentIntent creates a Stripe PaymentIntent with automatic payment
+// methods, so that the methods enabled in the Stripe dashboard are offered.
+func (p *StripeProcessor) CreatePaymentIntent(ctx context.Context, req *PaymentIntentRequest) (*PaymentIntent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(money.ToMinor(req.Amount, req.Currency), 10))
+	form.Set("currency", strings.ToLower(req.Currency))
+	form.Set("automatic_payment_methods[enabled]", "true")
+	if req.Description != "" {
+		form.Set("description", req.Description)
+	}
+	keys := make([]string, 0, len(req.Metadata))
+	for key := range req.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		form.Set("metadata["+key+"]", req.Metadata[key])
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/payment_intents", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("stripe: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Idempotency-Key", req.PaymentID.String())
+
+	body, err := p.do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var intent PaymentIntent
+	if err := json.Unmarshal(body, &intent); err != nil {
+		return nil, fmt.Errorf("stripe: invalid payment intent: %w", err)
+	}
+	if intent.ID == "" || intent.ClientSecret == "" {
+		return nil, fmt.Errorf("stripe: payment intent without ID or client secret")
+	}
+	return &intent, nil
+}
+
+// do sends an authenticated request to the Stripe API and returns the body
+// of a successful response. Failures are returned as a *ProviderError.
+func (p *StripeProcessor) do(httpReq *http.Request) ([]byte, error) {
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	httpReq.Header.Set("Stripe-Version", p.version)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("stripe: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("stripe: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(body, &failure)
+		if failure.Error.Message == "" {
+			failure.Error.Message = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		}
+		return nil, &ProviderError{Provider: "stripe", StatusCode: resp.StatusCode, Code: failure.Error.Code, Message: failure.Error.Message}
+	}
+	return body, nil
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/ims-erp/system/pkg/carddata"
+)
+
+// PaymentMetadataKeys are the metadata keys callers may set on a payment.
+// Metadata is passed on to the payment provider, so it is restricted to
+// keys that cannot hold cardholder data by design; other keys are set by
+// the service itself, such as stripe_payment_intent_id.
+var PaymentMetadataKeys = map[string]string{
+	"order_id":           "ID of the order being paid",
+	"order_number":       "Number of the order being paid",
+	"customer_reference": "The customer's own reference for the payment",
+	"purchase_order":     "The customer's purchase order number",
+	"channel":            "Sales channel the payment was taken in",
+	"note":               "Free-text note for staff",
+}
+
+// MaxPaymentMetadataValue is the longest metadata value, in characters, that
+// a caller may set, matching Stripe's limit.
+const MaxPaymentMetadataValue = 500
+
+// ValidatePaymentMetadata rejects metadata with keys other than
+// PaymentMetadataKeys, values longer than MaxPaymentMetadataValue, or values
+// holding a card number. The error names the key, never the value.
+func ValidatePaymentMetadata(metadata map[string]string) error {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := metadata[key]
+		if _, ok := PaymentMetadataKeys[key]; !ok {
+			return &PaymentError{Code: "INVALID_PAYMENT_METADATA", Message: fmt.Sprintf("metadata key %q is not allowed", key)}
+		}
+		if utf8.RuneCountInString(value) > MaxPaymentMetadataValue {
+			return &PaymentError{Code: "INVALID_PAYMENT_METADATA", Message: fmt.Sprintf("metadata %q is longer than %d characters", key, MaxPaymentMetadataValue)}
+		}
+		if carddata.ContainsPAN(value) {
+			return &PaymentError{Code: "INVALID_PAYMENT_METADATA", Message: fmt.Sprintf("metadata %q must not contain a card number", key)}
+		}
+	}
+	return nil
+}
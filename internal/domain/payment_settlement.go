@@ -0,0 +1,196 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// PaymentSettlement is what the provider pays out for a completed payment,
+// in the currency it settles in: the gross amount, converted when the
+// payment was taken in another currency, the provider's fees and the net.
+type PaymentSettlement struct {
+	Currency     string          `json:"currency" bson:"currency"`
+	Gross        decimal.Decimal `json:"gross" bson:"gross"`
+	Fee          decimal.Decimal `json:"fee" bson:"fee"`
+	Net          decimal.Decimal `json:"net" bson:"net"`
+	ExchangeRate decimal.Decimal `json:"exchangeRate" bson:"exchangeRate"`
+	Fees         []PaymentFee    `json:"fees,omitempty" bson:"fees,omitempty"`
+	SourceID     string          `json:"sourceId" bson:"sourceId"`
+}
+
+// PaymentFee is one of the fees making up a settlement's Fee, such as
+// Stripe's processing fee or tax on it.
+type PaymentFee struct {
+	Type        string          `json:"type" bson:"type"`
+	Description string          `json:"description,omitempty" bson:"description,omitempty"`
+	Amount      decimal.Decimal `json:"amount" bson:"amount"`
+}
+
+// Settle records what the provider pays out for the payment.
+func (p *Payment) Settle(settlement *PaymentSettlement) {
+	p.Settlement = settlement
+	p.UpdatedAt = time.Now().UTC()
+}
+
+// ChargeSettlementFetcher is implemented by processors that can look up the
+// settlement of a charge, when the webhook completing a payment does not
+// carry it.
+type ChargeSettlementFetcher interface {
+	ChargeSettlement(ctx context.Context, chargeID string) (*PaymentSettlement, error)
+}
+
+// ParseStripeBalanceTransaction reads the settlement from a Stripe balance
+// transaction. Its amounts are integers in the minor unit of the settlement
+// currency; exchange_rate is set when the charge was converted.
+func ParseStripeBalanceTransaction(txn map[string]interface{}) (*PaymentSettlement, error) {
+	id, _ := txn["id"].(string)
+	currency, _ := txn["currency"].(string)
+	if id == "" || currency == "" {
+		return nil, fmt.Errorf("stripe: balance transaction without ID or currency")
+	}
+	currency = strings.ToUpper(currency)
+	minor := func(value interface{}) decimal.Decimal {
+		if amount, ok := value.(float64); ok {
+			return money.FromMinor(int64(amount), currency)
+		}
+		return decimal.Zero
+	}
+
+	settlement := &PaymentSettlement{
+		Currency: currency,
+		Gross:    minor(txn["amount"]),
+		Fee:      minor(txn["fee"]),
+		Net:      minor(txn["net"]),
+		SourceID: id,
+	}
+	if rate, ok := txn["exchange_rate"].(float64); ok {
+		settlement.ExchangeRate = decimal.NewFromFloat(rate)
+	}
+	if details, ok := txn["fee_details"].([]interface{}); ok {
+		for _, item := range details {
+			detail, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			feeType, _ := detail["type"].(string)
+			description, _ := detail["description"].(string)
+			settlement.Fees = append(settlement.Fees, PaymentFee{Type: feeType, Description: description, Amount: minor(detail["amount"])})
+		}
+	}
+	return settlement, nil
+}
+
+// ParsePayPalCapture reads the settlement from the seller receivable
+// breakdown of a PayPal capture. PayPal gives the gross, fee and net in the
+// currency of the payment; when the payment is converted, receivable_amount
+// is the net in the settlement currency, and the gross and fee are
+// converted at the capture's exchange rate. It returns nil without a
+// breakdown, which PayPal leaves out of pending captures.
+func ParsePayPalCapture(capture map[string]interface{}) (*PaymentSettlement, error) {
+	breakdown, ok := capture["seller_receivable_breakdown"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	gross, grossCurrency, err := paypalAmount(breakdown, "gross_amount")
+	if err != nil {
+		return nil, err
+	}
+	fee, _, err := paypalAmount(breakdown, "paypal_fee")
+	if err != nil {
+		return nil, err
+	}
+	net, _, err := paypalAmount(breakdown, "net_amount")
+	if err != nil {
+		return nil, err
+	}
+	if grossCurrency == "" {
+		return nil, fmt.Errorf("paypal: capture breakdown without gross amount")
+	}
+	if net.IsZero() {
+		net = gross.Sub(fee)
+	}
+
+	id, _ := capture["id"].(string)
+	settlement := &PaymentSettlement{
+		Currency: grossCurrency,
+		Gross:    gross,
+		Fee:      fee,
+		Net:      net,
+		SourceID: id,
+	}
+
+	receivable, receivableCurrency, err := paypalAmount(breakdown, "receivable_amount")
+	if err != nil {
+		return nil, err
+	}
+	if receivableCurrency != "" && receivableCurrency != grossCurrency {
+		rate := decimal.Zero
+		if exchange, ok := breakdown["exchange_rate"].(map[string]interface{}); ok {
+			if value, ok := exchange["value"].(string); ok {
+				rate, _ = decimal.NewFromString(value)
+			}
+		}
+		if rate.IsZero() {
+			return nil, fmt.Errorf("paypal: converted capture without exchange rate")
+		}
+		settlement.Currency = receivableCurrency
+		settlement.Gross = money.Round(gross.Mul(rate), receivableCurrency)
+		settlement.Net = receivable
+		settlement.Fee = settlement.Gross.Sub(receivable)
+		settlement.ExchangeRate = rate
+	}
+	if !settlement.Fee.IsZero() {
+		settlement.Fees = []PaymentFee{{Type: "paypal_fee", Amount: settlement.Fee}}
+	}
+	return settlement, nil
+}
+
+// paypalAmount reads a PayPal money object, {"currency_code", "value"},
+// returning a zero amount without a currency when it is missing.
+func paypalAmount(parent map[string]interface{}, key string) (decimal.Decimal, string, error) {
+	object, ok := parent[key].(map[string]interface{})
+	if !ok {
+		return decimal.Zero, "", nil
+	}
+	currency, _ := object["currency_code"].(string)
+	value, _ := object["value"].(string)
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero, "", fmt.Errorf("paypal: invalid %s: %w", key, err)
+	}
+	return amount, strings.ToUpper(currency), nil
+}
+
+// ChargeSettlement looks up the balance transaction of a Stripe charge.
+func (p *StripeProcessor) ChargeSettlement(ctx context.Context, chargeID string) (*PaymentSettlement, error) {
+	query := url.Values{}
+	query.Set("expand[]", "balance_transaction")
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/v1/charges/"+url.PathEscape(chargeID)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("stripe: %w", err)
+	}
+
+	body, err := p.do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	var charge struct {
+		BalanceTransaction json.RawMessage `json:"balance_transaction"`
+	}
+	if err := json.Unmarshal(body, &charge); err != nil {
+		return nil, fmt.Errorf("stripe: invalid charge: %w", err)
+	}
+	var txn map[string]interface{}
+	if err := json.Unmarshal(charge.BalanceTransaction, &txn); err != nil || txn == nil {
+		return nil, fmt.Errorf("stripe: charge %s has no balance transaction yet", chargeID)
+	}
+	return ParseStripeBalanceTransaction(txn)
+}
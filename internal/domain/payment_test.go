@@ -1,6 +1,10 @@
 package domain
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -276,3 +280,127 @@ func TestRefundResult(t *testing.T) {
 	assert.True(t, result.Success)
 	assert.Equal(t, "ref_123", result.RefundID)
 }
+
+func TestStripeProcessor_CreatePaymentIntent(t *testing.T) {
+	paymentID := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/payment_intents", r.URL.Path)
+		assert.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+		assert.Equal(t, paymentID.String(), r.Header.Get("Idempotency-Key"))
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "1050", r.PostForm.Get("amount"))
+		assert.Equal(t, "eur", r.PostForm.Get("currency"))
+		assert.Equal(t, "true", r.PostForm.Get("automatic_payment_methods[enabled]"))
+		assert.Equal(t, "inv-1", r.PostForm.Get("metadata[invoice_id]"))
+		w.Write([]byte(`{"id":"pi_1","client_secret":"pi_1_secret","status":"requires_payment_method"}`))
+	}))
+	defer srv.Close()
+
+	p := NewStripeProcessor("sk_test", "")
+	p.baseURL, p.client = srv.URL, srv.Client()
+	intent, err := p.CreatePaymentIntent(context.Background(), &PaymentIntentRequest{
+		PaymentID: paymentID,
+		Amount:    decimal.RequireFromString("10.50"),
+		Currency:  "EUR",
+		Metadata:  map[string]string{"invoice_id": "inv-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pi_1", intent.ID)
+	assert.Equal(t, "pi_1_secret", intent.ClientSecret)
+}
+
+func TestStripeProcessor_CreatePaymentIntentError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"code":"amount_too_small","message":"Amount must be at least 0.50 usd"}}`))
+	}))
+	defer srv.Close()
+
+	p := NewStripeProcessor("sk_test", "")
+	p.baseURL, p.client = srv.URL, srv.Client()
+	_, err := p.CreatePaymentIntent(context.Background(), &PaymentIntentRequest{PaymentID: uuid.New(), Amount: decimal.NewFromInt(0), Currency: "USD"})
+
+	var providerErr *ProviderError
+	require.ErrorAs(t, err, &providerErr)
+	assert.Equal(t, "amount_too_small", providerErr.Code)
+	assert.Equal(t, http.StatusBadRequest, providerErr.StatusCode)
+}
+
+func TestValidatePaymentMetadata(t *testing.T) {
+	assert.NoError(t, ValidatePaymentMetadata(nil))
+	assert.NoError(t, ValidatePaymentMetadata(map[string]string{"order_id": "SO-2026-000042", "note": "left at reception"}))
+
+	err := ValidatePaymentMetadata(map[string]string{"order_id": "SO-1", "card": "x"})
+	assert.EqualError(t, err, `metadata key "card" is not allowed`)
+	err = ValidatePaymentMetadata(map[string]string{"note": "card 4111 1111 1111 1111"})
+	assert.EqualError(t, err, `metadata "note" must not contain a card number`)
+	err = ValidatePaymentMetadata(map[string]string{"note": strings.Repeat("x", MaxPaymentMetadataValue+1)})
+	assert.Error(t, err)
+}
+
+func TestStripeProcessor_ChargeSettlement(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/charges/ch_1", r.URL.Path)
+		assert.Equal(t, "balance_transaction", r.URL.Query().Get("expand[]"))
+		assert.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"id":"ch_1","balance_transaction":{"id":"txn_1","currency":"usd","amount":1050,"fee":60,"net":990,"exchange_rate":null,
+			"fee_details":[{"type":"stripe_fee","description":"Stripe processing fees","amount":60}]}}`))
+	}))
+	defer srv.Close()
+
+	p := NewStripeProcessor("sk_test", "")
+	p.baseURL, p.client = srv.URL, srv.Client()
+	settlement, err := p.ChargeSettlement(context.Background(), "ch_1")
+	require.NoError(t, err)
+	assert.Equal(t, "USD", settlement.Currency)
+	assert.Equal(t, "10.5", settlement.Gross.String())
+	assert.Equal(t, "0.6", settlement.Fee.String())
+	assert.Equal(t, "9.9", settlement.Net.String())
+	assert.True(t, settlement.ExchangeRate.IsZero())
+	require.Len(t, settlement.Fees, 1)
+	assert.Equal(t, "stripe_fee", settlement.Fees[0].Type)
+	assert.Equal(t, "Stripe processing fees", settlement.Fees[0].Description)
+	assert.Equal(t, "0.6", settlement.Fees[0].Amount.String())
+	assert.Equal(t, "txn_1", settlement.SourceID)
+}
+
+func TestStripeProcessor_ChargeSettlementPending(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"ch_1","balance_transaction":null}`))
+	}))
+	defer srv.Close()
+
+	p := NewStripeProcessor("sk_test", "")
+	p.baseURL, p.client = srv.URL, srv.Client()
+	_, err := p.ChargeSettlement(context.Background(), "ch_1")
+	assert.ErrorContains(t, err, "no balance transaction yet")
+}
+
+func TestParsePayPalCapture(t *testing.T) {
+	settlement, err := ParsePayPalCapture(map[string]interface{}{"id": "CAP-1", "status": "PENDING"})
+	require.NoError(t, err)
+	assert.Nil(t, settlement, "pending captures have no breakdown")
+
+	settlement, err = ParsePayPalCapture(map[string]interface{}{
+		"id": "CAP-2",
+		"seller_receivable_breakdown": map[string]interface{}{
+			"gross_amount": map[string]interface{}{"currency_code": "USD", "value": "50.00"},
+			"paypal_fee":   map[string]interface{}{"currency_code": "USD", "value": "2.24"},
+			"net_amount":   map[string]interface{}{"currency_code": "USD", "value": "47.76"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "USD", settlement.Currency)
+	assert.Equal(t, "47.76", settlement.Net.String())
+	assert.Equal(t, "2.24", settlement.Fee.String())
+	assert.True(t, settlement.ExchangeRate.IsZero())
+	assert.Equal(t, "CAP-2", settlement.SourceID)
+
+	_, err = ParsePayPalCapture(map[string]interface{}{
+		"seller_receivable_breakdown": map[string]interface{}{
+			"gross_amount":      map[string]interface{}{"currency_code": "USD", "value": "50.00"},
+			"receivable_amount": map[string]interface{}{"currency_code": "EUR", "value": "44.00"},
+		},
+	})
+	assert.ErrorContains(t, err, "without exchange rate")
+}
@@ -1,9 +1,11 @@
 package domain
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
 	"github.com/shopspring/decimal"
 )
 
@@ -48,6 +50,8 @@ type Product struct {
 	Currency         string          `json:"currency" bson:"currency"`
 	Brand            string          `json:"brand" bson:"brand"`
 	Manufacturer     string          `json:"manufacturer" bson:"manufacturer"`
+	// SupplierID is the client the product is bought from, if any.
+	SupplierID *uuid.UUID `json:"supplierId" bson:"supplierId"`
 
 	Pricing ProductPricing  `json:"pricing" bson:"pricing"`
 	Cost    decimal.Decimal `json:"cost" bson:"cost"`
@@ -74,6 +78,13 @@ type Product struct {
 	TaxCategory string `json:"taxCategory" bson:"taxCategory"`
 	HSNCode     string `json:"hsnCode" bson:"hsnCode"`
 
+	// Customs data for Intrastat: the 8-digit Combined Nomenclature code,
+	// the country the goods were made in and the net weight of one unit in
+	// kilograms.
+	CommodityCode   string          `json:"commodityCode" bson:"commodityCode"`
+	CountryOfOrigin string          `json:"countryOfOrigin" bson:"countryOfOrigin"`
+	NetWeight       decimal.Decimal `json:"netWeight" bson:"netWeight"`
+
 	CreatedBy uuid.UUID `json:"createdBy" bson:"createdBy"`
 	UpdatedBy uuid.UUID `json:"updatedBy" bson:"updatedBy"`
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
@@ -96,6 +107,10 @@ type ProductPricing struct {
 	DiscountType   string          `json:"discountType" bson:"discountType"`
 	ValidFrom      *time.Time      `json:"validFrom" bson:"validFrom"`
 	ValidUntil     *time.Time      `json:"validUntil" bson:"validUntil"`
+
+	// MinMarginPercent is the least gross margin, as a percentage of the
+	// selling price, that orders may sell the product at.
+	MinMarginPercent decimal.Decimal `json:"minMarginPercent" bson:"minMarginPercent"`
 }
 
 type ProductInventory struct {
@@ -201,6 +216,64 @@ func (p *Product) SetPricing(listPrice, salePrice, costPrice decimal.Decimal) {
 	p.UpdatedAt = time.Now().UTC()
 }
 
+// SetCostPrice changes the cost price, such as when landed costs raise it,
+// and recomputes the margin against the list price.
+func (p *Product) SetCostPrice(costPrice decimal.Decimal) {
+	p.SetPricing(p.Pricing.ListPrice, p.Pricing.SalePrice, costPrice)
+}
+
+// SetPriceFloor sets the lowest net unit price orders may sell the product at
+// without an approved override: minPrice, and the price that keeps a gross
+// margin of minMarginPercent over the unit cost. Zero turns either off.
+func (p *Product) SetPriceFloor(minPrice, minMarginPercent decimal.Decimal) error {
+	if minPrice.IsNegative() {
+		return ErrInvalidMinPrice
+	}
+	if minMarginPercent.IsNegative() || minMarginPercent.GreaterThanOrEqual(decimal.NewFromInt(100)) {
+		return ErrInvalidMinMargin
+	}
+	p.Pricing.MinPrice = minPrice
+	p.Pricing.MinMarginPercent = minMarginPercent
+	p.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// FloorPrice is the lowest net unit price the product may be sold at when
+// one unit costs unitCost: the higher of the minimum price and the price
+// that keeps the minimum margin, rounded up to the minor unit of currency.
+// It is zero when neither is set.
+func (p *Product) FloorPrice(unitCost decimal.Decimal, currency string) decimal.Decimal {
+	floor := p.Pricing.MinPrice
+	if p.Pricing.MinMarginPercent.IsPositive() && unitCost.IsPositive() {
+		share := decimal.NewFromInt(1).Sub(p.Pricing.MinMarginPercent.Div(decimal.NewFromInt(100)))
+		if marginFloor := unitCost.Div(share); marginFloor.GreaterThan(floor) {
+			floor = marginFloor
+		}
+	}
+	return floor.RoundCeil(money.Places(currency))
+}
+
+// SetCustomsInfo sets the data Intrastat declarations need. Spaces in
+// commodityCode are dropped and countryOfOrigin is upper-cased.
+func (p *Product) SetCustomsInfo(commodityCode, countryOfOrigin string, netWeight decimal.Decimal) error {
+	commodityCode = strings.ReplaceAll(commodityCode, " ", "")
+	countryOfOrigin = strings.ToUpper(strings.TrimSpace(countryOfOrigin))
+	if !IsCommodityCode(commodityCode) {
+		return ErrInvalidCommodityCode
+	}
+	if !IsCountryCode(countryOfOrigin) {
+		return ErrInvalidCountryOfOrigin
+	}
+	if netWeight.IsNegative() {
+		return ErrInvalidNetWeight
+	}
+	p.CommodityCode = commodityCode
+	p.CountryOfOrigin = countryOfOrigin
+	p.NetWeight = netWeight
+	p.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
 func (p *Product) SetInventory(quantityOnHand, reorderPoint, reorderQuantity int) {
 	p.Inventory.QuantityOnHand = quantityOnHand
 	p.Inventory.ReorderPoint = reorderPoint
@@ -341,6 +414,14 @@ var ErrInsufficientStock = &ProductError{
 	Message: "Insufficient stock available",
 }
 
+var (
+	ErrInvalidCommodityCode   = &ProductError{Code: "INVALID_COMMODITY_CODE", Message: "Commodity code must be 8 digits"}
+	ErrInvalidCountryOfOrigin = &ProductError{Code: "INVALID_COUNTRY_OF_ORIGIN", Message: "Country of origin must be an ISO 3166 alpha-2 code"}
+	ErrInvalidNetWeight       = &ProductError{Code: "INVALID_NET_WEIGHT", Message: "Net weight cannot be negative"}
+	ErrInvalidMinPrice        = &ProductError{Code: "INVALID_MIN_PRICE", Message: "Minimum price cannot be negative"}
+	ErrInvalidMinMargin       = &ProductError{Code: "INVALID_MIN_MARGIN", Message: "Minimum margin must be at least 0 and below 100 percent"}
+)
+
 type ProductError struct {
 	Code    string
 	Message string
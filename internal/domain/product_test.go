@@ -294,3 +294,37 @@ func TestProductStatusConstants(t *testing.T) {
 	assert.Equal(t, ProductStatus("inactive"), ProductStatusInactive)
 	assert.Equal(t, ProductStatus("discontinued"), ProductStatusDiscontinued)
 }
+
+func TestProductSetCustomsInfo(t *testing.T) {
+	product := &Product{}
+
+	require.NoError(t, product.SetCustomsInfo("8471 3000", " de", decimal.RequireFromString("1.25")))
+	assert.Equal(t, "84713000", product.CommodityCode)
+	assert.Equal(t, "DE", product.CountryOfOrigin)
+	assert.Equal(t, "1.25", product.NetWeight.String())
+
+	assert.Equal(t, ErrInvalidCommodityCode, product.SetCustomsInfo("8471", "DE", decimal.Zero))
+	assert.Equal(t, ErrInvalidCountryOfOrigin, product.SetCustomsInfo("84713000", "Germany", decimal.Zero))
+	assert.Equal(t, ErrInvalidNetWeight, product.SetCustomsInfo("84713000", "DE", decimal.NewFromInt(-1)))
+	assert.Equal(t, "84713000", product.CommodityCode, "a rejected change keeps the previous data")
+}
+
+func TestIsEUMemberState(t *testing.T) {
+	assert.True(t, IsEUMemberState("FR"))
+	assert.False(t, IsEUMemberState("GB"))
+	assert.False(t, IsEUMemberState("fr"))
+}
+
+func TestProductFloorPrice(t *testing.T) {
+	product := &Product{}
+	assert.True(t, product.FloorPrice(decimal.NewFromInt(10), "USD").IsZero(), "no floor without rules")
+
+	require.NoError(t, product.SetPriceFloor(decimal.NewFromInt(12), decimal.NewFromInt(25)))
+	assert.Equal(t, "13.34", product.FloorPrice(decimal.NewFromInt(10), "USD").String(), "the margin floor is rounded up")
+	assert.Equal(t, "12", product.FloorPrice(decimal.NewFromInt(6), "USD").String(), "the minimum price wins over a lower margin floor")
+	assert.Equal(t, "1334", product.FloorPrice(decimal.NewFromInt(1000), "JPY").String())
+
+	assert.Equal(t, ErrInvalidMinPrice, product.SetPriceFloor(decimal.NewFromInt(-1), decimal.Zero))
+	assert.Equal(t, ErrInvalidMinMargin, product.SetPriceFloor(decimal.Zero, decimal.NewFromInt(100)))
+	assert.Equal(t, "25", product.Pricing.MinMarginPercent.String(), "a rejected change keeps the previous rules")
+}
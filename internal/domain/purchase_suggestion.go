@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PurchaseSuggestionStatus is where a purchase suggestion is in its review.
+type PurchaseSuggestionStatus string
+
+const (
+	PurchaseSuggestionOpen      PurchaseSuggestionStatus = "open"
+	PurchaseSuggestionAccepted  PurchaseSuggestionStatus = "accepted"
+	PurchaseSuggestionDismissed PurchaseSuggestionStatus = "dismissed"
+)
+
+// PurchaseSuggestion proposes buying Quantity of a product by OrderBy, so
+// that it arrives, LeadTimeDays later, before the stock runs below its
+// SafetyStock. It is worked out from the forecast DailyDemand and the
+// StockPosition, on hand less reserved, when it was GeneratedAt.
+//
+// Open suggestions are refreshed by every forecast run until a buyer
+// accepts or dismisses them. A decided suggestion keeps new ones for the
+// product away until SuppressedUntil: an accepted order's arrival, or the
+// dismissed suggestion's order date.
+type PurchaseSuggestion struct {
+	ID               uuid.UUID                `json:"id" bson:"_id"`
+	TenantID         uuid.UUID                `json:"tenantId" bson:"tenantId"`
+	ProductID        uuid.UUID                `json:"productId" bson:"productId"`
+	SKU              string                   `json:"sku" bson:"sku"`
+	Name             string                   `json:"name" bson:"name"`
+	SupplierID       *uuid.UUID               `json:"supplierId,omitempty" bson:"supplierId,omitempty"`
+	Status           PurchaseSuggestionStatus `json:"status" bson:"status"`
+	DailyDemand      float64                  `json:"dailyDemand" bson:"dailyDemand"`
+	LeadTimeDays     int                      `json:"leadTimeDays" bson:"leadTimeDays"`
+	SafetyStock      int                      `json:"safetyStock" bson:"safetyStock"`
+	ReorderPoint     int                      `json:"reorderPoint" bson:"reorderPoint"`
+	StockPosition    int                      `json:"stockPosition" bson:"stockPosition"`
+	Quantity         int                      `json:"quantity" bson:"quantity"`
+	OrderBy          time.Time                `json:"orderBy" bson:"orderBy"`
+	ExpectedArrival  time.Time                `json:"expectedArrival" bson:"expectedArrival"`
+	AcceptedQuantity int                      `json:"acceptedQuantity,omitempty" bson:"acceptedQuantity,omitempty"`
+	Reason           string                   `json:"reason,omitempty" bson:"reason,omitempty"`
+	DecidedBy        *uuid.UUID               `json:"decidedBy,omitempty" bson:"decidedBy,omitempty"`
+	DecidedAt        *time.Time               `json:"decidedAt,omitempty" bson:"decidedAt,omitempty"`
+	SuppressedUntil  *time.Time               `json:"suppressedUntil,omitempty" bson:"suppressedUntil,omitempty"`
+	GeneratedAt      time.Time                `json:"generatedAt" bson:"generatedAt"`
+	Version          int64                    `json:"version" bson:"version"`
+}
+
+// Accept approves the suggestion for a purchase order of quantity, or of
+// the suggested quantity when quantity is 0.
+func (s *PurchaseSuggestion) Accept(userID uuid.UUID, quantity int) error {
+	if s.Status != PurchaseSuggestionOpen {
+		return ErrPurchaseSuggestionDecided
+	}
+	if quantity < 0 {
+		return ErrInvalidSuggestedQuantity
+	}
+	if quantity == 0 {
+		quantity = s.Quantity
+	}
+	now := time.Now().UTC()
+	arrival := now.AddDate(0, 0, s.LeadTimeDays)
+	s.Status = PurchaseSuggestionAccepted
+	s.AcceptedQuantity = quantity
+	s.DecidedBy = &userID
+	s.DecidedAt = &now
+	s.SuppressedUntil = &arrival
+	return nil
+}
+
+// Dismiss rejects the suggestion; reason says why, for the next review.
+func (s *PurchaseSuggestion) Dismiss(userID uuid.UUID, reason string) error {
+	if s.Status != PurchaseSuggestionOpen {
+		return ErrPurchaseSuggestionDecided
+	}
+	now := time.Now().UTC()
+	until := s.OrderBy
+	if until.Before(now) {
+		until = now
+	}
+	s.Status = PurchaseSuggestionDismissed
+	s.Reason = reason
+	s.DecidedBy = &userID
+	s.DecidedAt = &now
+	s.SuppressedUntil = &until
+	return nil
+}
+
+var (
+	ErrPurchaseSuggestionDecided = &InventoryError{Code: "PURCHASE_SUGGESTION_DECIDED", Message: "Purchase suggestion has already been accepted or dismissed"}
+	ErrInvalidSuggestedQuantity  = &InventoryError{Code: "INVALID_SUGGESTED_QUANTITY", Message: "Quantity must not be negative"}
+)
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openSuggestion(orderBy time.Time) *PurchaseSuggestion {
+	return &PurchaseSuggestion{
+		ID:           uuid.New(),
+		Status:       PurchaseSuggestionOpen,
+		LeadTimeDays: 10,
+		Quantity:     40,
+		OrderBy:      orderBy,
+	}
+}
+
+func TestPurchaseSuggestion_Accept(t *testing.T) {
+	userID := uuid.New()
+	suggestion := openSuggestion(time.Now())
+
+	require.NoError(t, suggestion.Accept(userID, 0))
+	assert.Equal(t, PurchaseSuggestionAccepted, suggestion.Status)
+	assert.Equal(t, 40, suggestion.AcceptedQuantity, "defaults to the suggested quantity")
+	assert.Equal(t, &userID, suggestion.DecidedBy)
+	require.NotNil(t, suggestion.SuppressedUntil)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 10), *suggestion.SuppressedUntil, time.Minute)
+
+	assert.ErrorIs(t, suggestion.Accept(userID, 10), ErrPurchaseSuggestionDecided)
+	assert.ErrorIs(t, openSuggestion(time.Now()).Accept(userID, -1), ErrInvalidSuggestedQuantity)
+
+	changed := openSuggestion(time.Now())
+	require.NoError(t, changed.Accept(userID, 60))
+	assert.Equal(t, 60, changed.AcceptedQuantity)
+}
+
+func TestPurchaseSuggestion_Dismiss(t *testing.T) {
+	orderBy := time.Now().AddDate(0, 0, 5).UTC()
+	suggestion := openSuggestion(orderBy)
+
+	require.NoError(t, suggestion.Dismiss(uuid.New(), "supplier discontinued it"))
+	assert.Equal(t, PurchaseSuggestionDismissed, suggestion.Status)
+	assert.Equal(t, "supplier discontinued it", suggestion.Reason)
+	assert.Equal(t, orderBy, *suggestion.SuppressedUntil, "suppressed until it was due")
+	assert.ErrorIs(t, suggestion.Dismiss(uuid.New(), ""), ErrPurchaseSuggestionDecided)
+
+	overdue := openSuggestion(time.Now().AddDate(0, 0, -3))
+	require.NoError(t, overdue.Dismiss(uuid.New(), ""))
+	assert.WithinDuration(t, time.Now(), *overdue.SuppressedUntil, time.Minute)
+}
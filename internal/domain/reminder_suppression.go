@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReminderSuppression stops payment reminders, whether sent by hand or by
+// dunning, for an invoice or, without an InvoiceID, for every invoice of a
+// client, until it is lifted. Lifted suppressions are kept, so who stopped
+// and resumed a client's reminders, and why, stays on record.
+type ReminderSuppression struct {
+	ID           uuid.UUID  `json:"id" bson:"_id"`
+	TenantID     uuid.UUID  `json:"tenantId" bson:"tenantId"`
+	ClientID     uuid.UUID  `json:"clientId" bson:"clientId"`
+	InvoiceID    *uuid.UUID `json:"invoiceId,omitempty" bson:"invoiceId,omitempty"`
+	Reason       string     `json:"reason" bson:"reason"`
+	SuppressedBy uuid.UUID  `json:"suppressedBy" bson:"suppressedBy"`
+	SuppressedAt time.Time  `json:"suppressedAt" bson:"suppressedAt"`
+	LiftedBy     *uuid.UUID `json:"liftedBy,omitempty" bson:"liftedBy,omitempty"`
+	LiftedAt     *time.Time `json:"liftedAt,omitempty" bson:"liftedAt,omitempty"`
+	LiftReason   string     `json:"liftReason,omitempty" bson:"liftReason,omitempty"`
+}
+
+// NewReminderSuppression suppresses the reminders of the client's invoice,
+// or of all of the client's invoices when invoiceID is nil, for reason.
+func NewReminderSuppression(tenantID, clientID uuid.UUID, invoiceID *uuid.UUID, reason string, suppressedBy uuid.UUID) (*ReminderSuppression, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrSuppressionReasonRequired
+	}
+	return &ReminderSuppression{
+		ID:           uuid.New(),
+		TenantID:     tenantID,
+		ClientID:     clientID,
+		InvoiceID:    invoiceID,
+		Reason:       reason,
+		SuppressedBy: suppressedBy,
+		SuppressedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Active reports whether the suppression has not been lifted.
+func (s *ReminderSuppression) Active() bool {
+	return s.LiftedAt == nil
+}
+
+// Lift resumes the reminders the suppression stopped, for reason.
+func (s *ReminderSuppression) Lift(liftedBy uuid.UUID, reason string, at time.Time) error {
+	if !s.Active() {
+		return ErrSuppressionLifted
+	}
+	s.LiftedBy = &liftedBy
+	s.LiftedAt = &at
+	s.LiftReason = strings.TrimSpace(reason)
+	return nil
+}
+
+var (
+	ErrSuppressionReasonRequired = &PaymentError{Code: "SUPPRESSION_REASON_REQUIRED", Message: "a reason for suppressing reminders is required"}
+	ErrSuppressionLifted         = &PaymentError{Code: "SUPPRESSION_LIFTED", Message: "the reminder suppression has already been lifted"}
+)
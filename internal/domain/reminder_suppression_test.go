@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReminderSuppression(t *testing.T) {
+	_, err := NewReminderSuppression(uuid.New(), uuid.New(), nil, "  ", uuid.New())
+	assert.ErrorIs(t, err, ErrSuppressionReasonRequired)
+
+	suppression, err := NewReminderSuppression(uuid.New(), uuid.New(), nil, " Disputed delivery ", uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, "Disputed delivery", suppression.Reason)
+	assert.True(t, suppression.Active())
+
+	liftedBy := uuid.New()
+	at := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, suppression.Lift(liftedBy, "Settled with the client", at))
+	assert.False(t, suppression.Active())
+	assert.Equal(t, liftedBy, *suppression.LiftedBy)
+	assert.Equal(t, "Settled with the client", suppression.LiftReason)
+	assert.ErrorIs(t, suppression.Lift(liftedBy, "", at), ErrSuppressionLifted)
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResumableUpload is a file uploaded in pieces over the tus protocol. Each
+// piece received is stored as a part at its offset; once Offset reaches
+// Length the parts are joined into the document DocumentID, and the
+// upload is completed. Uploads not completed by ExpiresAt are abandoned.
+type ResumableUpload struct {
+	ID          uuid.UUID         `json:"id" bson:"_id"`
+	TenantID    uuid.UUID         `json:"tenantId" bson:"tenantId"`
+	UserID      string            `json:"userId" bson:"userId"`
+	DocumentID  uuid.UUID         `json:"documentId" bson:"documentId"`
+	Length      int64             `json:"length" bson:"length"`
+	Offset      int64             `json:"offset" bson:"offset"`
+	Metadata    map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	Parts       []UploadPart      `json:"-" bson:"parts"`
+	CreatedAt   time.Time         `json:"createdAt" bson:"createdAt"`
+	ExpiresAt   time.Time         `json:"expiresAt" bson:"expiresAt"`
+	CompletedAt *time.Time        `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+}
+
+// UploadPart is a piece of a resumable upload, stored under ObjectKey.
+type UploadPart struct {
+	Offset    int64  `bson:"offset"`
+	Size      int64  `bson:"size"`
+	ObjectKey string `bson:"objectKey"`
+}
+
+// Received reports whether every byte of the upload has been received.
+func (u *ResumableUpload) Received() bool {
+	return u.Offset == u.Length
+}
+
+// Expired reports whether the upload was abandoned before it completed.
+func (u *ResumableUpload) Expired(now time.Time) bool {
+	return u.CompletedAt == nil && !now.Before(u.ExpiresAt)
+}
+
+// ParseUploadMetadata parses a tus Upload-Metadata header: comma-separated
+// pairs of a key and its base64-encoded value, which may be left out.
+func ParseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, ErrInvalidUploadMetadata
+		}
+		if _, seen := metadata[fields[0]]; seen {
+			return nil, ErrInvalidUploadMetadata
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, ErrInvalidUploadMetadata
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata, nil
+}
+
+var ErrInvalidUploadMetadata = &DocumentError{Code: "INVALID_UPLOAD_METADATA", Message: "Upload-Metadata must be comma-separated keys, each named once, with base64 values"}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	metadata, err := ParseUploadMetadata("filename ZGVsaXZlcnkuanBn, filetype aW1hZ2UvanBlZw==,is_confidential")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"filename":        "delivery.jpg",
+		"filetype":        "image/jpeg",
+		"is_confidential": "",
+	}, metadata)
+
+	metadata, err = ParseUploadMetadata("")
+	require.NoError(t, err)
+	assert.Empty(t, metadata)
+
+	for _, header := range []string{"filename not-base64!", "filename YQ== extra", "a YQ==, a Yg==", "a YQ==,,b Yg=="} {
+		_, err := ParseUploadMetadata(header)
+		assert.ErrorIs(t, err, ErrInvalidUploadMetadata, header)
+	}
+}
+
+func TestResumableUpload_State(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	upload := &ResumableUpload{Length: 100, Offset: 40, ExpiresAt: now.Add(time.Hour)}
+	assert.False(t, upload.Received())
+	assert.False(t, upload.Expired(now))
+	assert.True(t, upload.Expired(now.Add(time.Hour)))
+
+	upload.Offset = 100
+	assert.True(t, upload.Received())
+	upload.CompletedAt = &now
+	assert.False(t, upload.Expired(now.Add(2*time.Hour)), "completed uploads do not expire")
+}
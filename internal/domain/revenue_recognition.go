@@ -0,0 +1,322 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// RevenuePeriodLayout formats the calendar month revenue is recognized in.
+const RevenuePeriodLayout = "2006-01"
+
+// MaxRecognitionMonths bounds a straight-line schedule to ten years.
+const MaxRecognitionMonths = 120
+
+// RecognitionMethod is how the revenue of an invoice line is spread over
+// time.
+type RecognitionMethod string
+
+const (
+	// RecognitionStraightLine recognizes equal parts of the line in each
+	// month of the service period.
+	RecognitionStraightLine RecognitionMethod = "straight_line"
+	// RecognitionMilestone recognizes a part of the line as each milestone
+	// of the contract is completed.
+	RecognitionMilestone RecognitionMethod = "milestone"
+)
+
+type RevenueScheduleStatus string
+
+const (
+	RevenueScheduleActive    RevenueScheduleStatus = "active"
+	RevenueScheduleCompleted RevenueScheduleStatus = "completed"
+)
+
+// RevenueSchedule defers the revenue of an invoice line billed upfront, such
+// as a service contract, and recognizes it over the months of the service
+// or as its milestones are completed. Until then it is deferred revenue.
+type RevenueSchedule struct {
+	ID            uuid.UUID             `json:"id" bson:"_id"`
+	TenantID      uuid.UUID             `json:"tenantId" bson:"tenantId"`
+	InvoiceID     uuid.UUID             `json:"invoiceId" bson:"invoiceId"`
+	InvoiceNumber string                `json:"invoiceNumber" bson:"invoiceNumber"`
+	InvoiceLineID uuid.UUID             `json:"invoiceLineId" bson:"invoiceLineId"`
+	ClientID      uuid.UUID             `json:"clientId" bson:"clientId"`
+	Description   string                `json:"description" bson:"description"`
+	Currency      string                `json:"currency" bson:"currency"`
+	Method        RecognitionMethod     `json:"method" bson:"method"`
+	Total         decimal.Decimal       `json:"total" bson:"total"`
+	Recognized    decimal.Decimal       `json:"recognized" bson:"recognized"`
+	Status        RevenueScheduleStatus `json:"status" bson:"status"`
+	Entries       []RecognitionEntry    `json:"entries" bson:"entries"`
+	CreatedBy     uuid.UUID             `json:"createdBy" bson:"createdBy"`
+	CreatedAt     time.Time             `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time             `json:"updatedAt" bson:"updatedAt"`
+	Version       int64                 `json:"version" bson:"version"`
+}
+
+// RecognitionEntry is a part of a schedule's revenue. Straight-line entries
+// are due in their Period; milestone entries once CompletedAt is set.
+// RecognizedIn is the month the entry was recognized in.
+type RecognitionEntry struct {
+	ID           uuid.UUID       `json:"id" bson:"_id"`
+	Period       string          `json:"period,omitempty" bson:"period,omitempty"`
+	Milestone    string          `json:"milestone,omitempty" bson:"milestone,omitempty"`
+	Amount       decimal.Decimal `json:"amount" bson:"amount"`
+	CompletedAt  *time.Time      `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+	RecognizedIn string          `json:"recognizedIn,omitempty" bson:"recognizedIn,omitempty"`
+	RecognizedAt *time.Time      `json:"recognizedAt,omitempty" bson:"recognizedAt,omitempty"`
+}
+
+// RevenueMilestone names a part of a line's revenue recognized when the
+// milestone is completed.
+type RevenueMilestone struct {
+	Name   string          `json:"name"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+func newRevenueSchedule(invoice *Invoice, line *InvoiceLine, method RecognitionMethod, createdBy uuid.UUID) (*RevenueSchedule, error) {
+	switch invoice.Status {
+	case InvoiceStatusDraft, InvoiceStatusCancelled, InvoiceStatusRefunded:
+		return nil, ErrInvoiceNotRecognizable
+	}
+	if !line.Total.IsPositive() {
+		return nil, ErrInvalidRecognitionAmount
+	}
+	now := time.Now().UTC()
+	return &RevenueSchedule{
+		ID:            uuid.New(),
+		TenantID:      invoice.TenantID,
+		InvoiceID:     invoice.ID,
+		InvoiceNumber: invoice.InvoiceNumber,
+		InvoiceLineID: line.ID,
+		ClientID:      invoice.ClientID,
+		Description:   line.Description,
+		Currency:      invoice.Currency,
+		Method:        method,
+		Total:         line.Total,
+		Recognized:    decimal.Zero,
+		Status:        RevenueScheduleActive,
+		Entries:       []RecognitionEntry{},
+		CreatedBy:     createdBy,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// NewStraightLineSchedule spreads the line's total evenly over months
+// starting with startPeriod, rounded to the currency's minor unit; the last
+// month takes what rounding leaves over.
+func NewStraightLineSchedule(invoice *Invoice, line *InvoiceLine, startPeriod string, months int, createdBy uuid.UUID) (*RevenueSchedule, error) {
+	start, err := time.Parse(RevenuePeriodLayout, startPeriod)
+	if err != nil {
+		return nil, ErrInvalidRevenuePeriod
+	}
+	if months < 1 || months > MaxRecognitionMonths {
+		return nil, ErrInvalidRecognitionMonths
+	}
+	schedule, err := newRevenueSchedule(invoice, line, RecognitionStraightLine, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	monthly := money.Round(schedule.Total.Div(decimal.NewFromInt(int64(months))), schedule.Currency)
+	remaining := schedule.Total
+	for i := 0; i < months; i++ {
+		amount := monthly
+		if i == months-1 {
+			amount = remaining
+		}
+		remaining = remaining.Sub(amount)
+		schedule.Entries = append(schedule.Entries, RecognitionEntry{
+			ID:     uuid.New(),
+			Period: start.AddDate(0, i, 0).Format(RevenuePeriodLayout),
+			Amount: amount,
+		})
+	}
+	return schedule, nil
+}
+
+// NewMilestoneSchedule splits the line's total between milestones, whose
+// amounts must add up to it.
+func NewMilestoneSchedule(invoice *Invoice, line *InvoiceLine, milestones []RevenueMilestone, createdBy uuid.UUID) (*RevenueSchedule, error) {
+	if len(milestones) == 0 {
+		return nil, ErrMilestonesRequired
+	}
+	schedule, err := newRevenueSchedule(invoice, line, RecognitionMilestone, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	total := decimal.Zero
+	names := make(map[string]bool)
+	for _, milestone := range milestones {
+		name := strings.TrimSpace(milestone.Name)
+		if name == "" || names[name] {
+			return nil, ErrInvalidMilestone
+		}
+		if !milestone.Amount.IsPositive() {
+			return nil, ErrInvalidRecognitionAmount
+		}
+		names[name] = true
+		total = total.Add(milestone.Amount)
+		schedule.Entries = append(schedule.Entries, RecognitionEntry{
+			ID:        uuid.New(),
+			Milestone: name,
+			Amount:    milestone.Amount,
+		})
+	}
+	if !total.Equal(schedule.Total) {
+		return nil, ErrMilestonesTotal
+	}
+	return schedule, nil
+}
+
+// Deferred is the part of the schedule not recognized yet.
+func (s *RevenueSchedule) Deferred() decimal.Decimal {
+	return s.Total.Sub(s.Recognized)
+}
+
+// CompleteMilestone records that a milestone was completed at completedAt,
+// making its revenue due in that month.
+func (s *RevenueSchedule) CompleteMilestone(entryID uuid.UUID, completedAt time.Time) (*RecognitionEntry, error) {
+	if s.Method != RecognitionMilestone {
+		return nil, ErrNotMilestoneSchedule
+	}
+	for i := range s.Entries {
+		entry := &s.Entries[i]
+		if entry.ID != entryID {
+			continue
+		}
+		if entry.CompletedAt != nil {
+			return nil, ErrMilestoneCompleted
+		}
+		completedAt = completedAt.UTC()
+		entry.CompletedAt = &completedAt
+		s.UpdatedAt = time.Now().UTC()
+		return entry, nil
+	}
+	return nil, ErrRecognitionEntryNotFound
+}
+
+// Recognize recognizes, in period, the entries due by its end: straight-line
+// months up to period and milestones completed by then, in loc. It returns
+// the entries recognized now, which are none when nothing new is due. The
+// schedule completes with its last entry.
+func (s *RevenueSchedule) Recognize(period string, loc *time.Location, at time.Time) ([]RecognitionEntry, error) {
+	through, err := time.ParseInLocation(RevenuePeriodLayout, period, loc)
+	if err != nil {
+		return nil, ErrInvalidRevenuePeriod
+	}
+	end := through.AddDate(0, 1, 0)
+
+	at = at.UTC()
+	var recognized []RecognitionEntry
+	for i := range s.Entries {
+		entry := &s.Entries[i]
+		if entry.RecognizedAt != nil {
+			continue
+		}
+		switch {
+		case entry.Period != "" && entry.Period <= period:
+		case entry.CompletedAt != nil && entry.CompletedAt.Before(end):
+		default:
+			continue
+		}
+		entry.RecognizedIn = period
+		entry.RecognizedAt = &at
+		s.Recognized = s.Recognized.Add(entry.Amount)
+		recognized = append(recognized, *entry)
+	}
+	if len(recognized) == 0 {
+		return nil, nil
+	}
+
+	s.Status = RevenueScheduleCompleted
+	for _, entry := range s.Entries {
+		if entry.RecognizedAt == nil {
+			s.Status = RevenueScheduleActive
+			break
+		}
+	}
+	s.UpdatedAt = at
+	return recognized, nil
+}
+
+// DeferredRevenue totals the schedules of a tenant in one currency: what
+// was invoiced upfront, what has been recognized and what is still
+// deferred. Upcoming spreads the deferred straight-line revenue over the
+// months it is due in; milestones not completed yet are Unscheduled.
+type DeferredRevenue struct {
+	Currency    string          `json:"currency"`
+	Schedules   int             `json:"schedules"`
+	Total       decimal.Decimal `json:"total"`
+	Recognized  decimal.Decimal `json:"recognized"`
+	Deferred    decimal.Decimal `json:"deferred"`
+	Upcoming    []RevenuePeriod `json:"upcoming"`
+	Unscheduled decimal.Decimal `json:"unscheduled"`
+}
+
+// RevenuePeriod is revenue due in one month.
+type RevenuePeriod struct {
+	Period string          `json:"period"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// SummarizeDeferredRevenue totals schedules by currency, in currency order.
+// Upcoming includes past months whose recognition run is still to come.
+func SummarizeDeferredRevenue(schedules []*RevenueSchedule) []DeferredRevenue {
+	byCurrency := make(map[string]*DeferredRevenue)
+	upcoming := make(map[string]map[string]decimal.Decimal)
+	for _, schedule := range schedules {
+		total, ok := byCurrency[schedule.Currency]
+		if !ok {
+			total = &DeferredRevenue{Currency: schedule.Currency, Upcoming: []RevenuePeriod{}}
+			byCurrency[schedule.Currency] = total
+			upcoming[schedule.Currency] = make(map[string]decimal.Decimal)
+		}
+		total.Schedules++
+		total.Total = total.Total.Add(schedule.Total)
+		total.Recognized = total.Recognized.Add(schedule.Recognized)
+		total.Deferred = total.Deferred.Add(schedule.Deferred())
+		for _, entry := range schedule.Entries {
+			if entry.RecognizedAt != nil {
+				continue
+			}
+			if entry.Period != "" {
+				upcoming[schedule.Currency][entry.Period] = upcoming[schedule.Currency][entry.Period].Add(entry.Amount)
+			} else if entry.CompletedAt == nil {
+				total.Unscheduled = total.Unscheduled.Add(entry.Amount)
+			}
+		}
+	}
+
+	totals := make([]DeferredRevenue, 0, len(byCurrency))
+	for currency, total := range byCurrency {
+		for period, amount := range upcoming[currency] {
+			total.Upcoming = append(total.Upcoming, RevenuePeriod{Period: period, Amount: amount})
+		}
+		sort.Slice(total.Upcoming, func(i, j int) bool { return total.Upcoming[i].Period < total.Upcoming[j].Period })
+		totals = append(totals, *total)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Currency < totals[j].Currency })
+	return totals
+}
+
+var (
+	ErrInvoiceNotRecognizable   = &PaymentError{Code: "INVOICE_NOT_RECOGNIZABLE", Message: "Revenue of a draft, cancelled or refunded invoice cannot be scheduled"}
+	ErrInvalidRecognitionAmount = &PaymentError{Code: "INVALID_RECOGNITION_AMOUNT", Message: "Recognized amounts must be positive"}
+	ErrInvalidRevenuePeriod     = &PaymentError{Code: "INVALID_REVENUE_PERIOD", Message: "Revenue periods are months formatted YYYY-MM"}
+	ErrInvalidRecognitionMonths = &PaymentError{Code: "INVALID_RECOGNITION_MONTHS", Message: "Straight-line schedules run for 1 to 120 months"}
+	ErrMilestonesRequired       = &PaymentError{Code: "MILESTONES_REQUIRED", Message: "Milestone schedules need at least one milestone"}
+	ErrInvalidMilestone         = &PaymentError{Code: "INVALID_MILESTONE", Message: "Milestones need a unique name"}
+	ErrMilestonesTotal          = &PaymentError{Code: "MILESTONES_TOTAL", Message: "Milestone amounts must add up to the line total"}
+	ErrNotMilestoneSchedule     = &PaymentError{Code: "NOT_MILESTONE_SCHEDULE", Message: "Schedule is not milestone-based"}
+	ErrMilestoneCompleted       = &PaymentError{Code: "MILESTONE_COMPLETED", Message: "Milestone is already completed"}
+	ErrRecognitionEntryNotFound = &PaymentError{Code: "RECOGNITION_ENTRY_NOT_FOUND", Message: "Milestone not found"}
+	ErrRevenueScheduleExists    = &PaymentError{Code: "REVENUE_SCHEDULE_EXISTS", Message: "Invoice line already has a revenue schedule"}
+)
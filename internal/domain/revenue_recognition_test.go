@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestContractInvoice(total string) (*Invoice, *InvoiceLine) {
+	line := InvoiceLine{ID: uuid.New(), Description: "Support contract", Total: decimal.RequireFromString(total)}
+	invoice := &Invoice{
+		ID:            uuid.New(),
+		TenantID:      uuid.New(),
+		ClientID:      uuid.New(),
+		InvoiceNumber: "INV-1",
+		Status:        InvoiceStatusSent,
+		Currency:      "EUR",
+		Lines:         []InvoiceLine{line},
+	}
+	return invoice, &invoice.Lines[0]
+}
+
+func TestStraightLineSchedule(t *testing.T) {
+	invoice, line := newTestContractInvoice("1000.00")
+
+	_, err := NewStraightLineSchedule(invoice, line, "2026-13", 12, uuid.New())
+	assert.Equal(t, ErrInvalidRevenuePeriod, err)
+	_, err = NewStraightLineSchedule(invoice, line, "2026-11", 0, uuid.New())
+	assert.Equal(t, ErrInvalidRecognitionMonths, err)
+
+	schedule, err := NewStraightLineSchedule(invoice, line, "2026-11", 3, uuid.New())
+	require.NoError(t, err)
+	require.Len(t, schedule.Entries, 3)
+	assert.Equal(t, "2026-11", schedule.Entries[0].Period)
+	assert.Equal(t, "2027-01", schedule.Entries[2].Period)
+	assert.Equal(t, "333.33", schedule.Entries[0].Amount.String())
+	assert.Equal(t, "333.34", schedule.Entries[2].Amount.String())
+
+	at := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	recognized, err := schedule.Recognize("2026-10", time.UTC, at)
+	require.NoError(t, err)
+	assert.Empty(t, recognized)
+
+	recognized, err = schedule.Recognize("2026-11", time.UTC, at)
+	require.NoError(t, err)
+	require.Len(t, recognized, 1)
+	assert.Equal(t, "2026-11", recognized[0].RecognizedIn)
+	recognized, err = schedule.Recognize("2026-11", time.UTC, at)
+	require.NoError(t, err)
+	assert.Empty(t, recognized, "recognizing a month twice does nothing")
+	assert.Equal(t, "666.67", schedule.Deferred().String())
+
+	recognized, err = schedule.Recognize("2027-03", time.UTC, at)
+	require.NoError(t, err)
+	assert.Len(t, recognized, 2)
+	assert.Equal(t, RevenueScheduleCompleted, schedule.Status)
+	assert.True(t, schedule.Deferred().IsZero())
+
+	invoice.Status = InvoiceStatusDraft
+	_, err = NewStraightLineSchedule(invoice, line, "2026-11", 3, uuid.New())
+	assert.Equal(t, ErrInvoiceNotRecognizable, err)
+}
+
+func TestMilestoneSchedule(t *testing.T) {
+	invoice, line := newTestContractInvoice("900")
+	_, err := NewMilestoneSchedule(invoice, line, []RevenueMilestone{{Name: "Design", Amount: decimal.NewFromInt(300)}}, uuid.New())
+	assert.Equal(t, ErrMilestonesTotal, err)
+	_, err = NewMilestoneSchedule(invoice, line, []RevenueMilestone{
+		{Name: "Design", Amount: decimal.NewFromInt(300)},
+		{Name: " Design ", Amount: decimal.NewFromInt(600)},
+	}, uuid.New())
+	assert.Equal(t, ErrInvalidMilestone, err)
+
+	schedule, err := NewMilestoneSchedule(invoice, line, []RevenueMilestone{
+		{Name: "Design", Amount: decimal.NewFromInt(300)},
+		{Name: "Go-live", Amount: decimal.NewFromInt(600)},
+	}, uuid.New())
+	require.NoError(t, err)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// 23:30 UTC on 31 January is already February in Berlin.
+	_, err = schedule.CompleteMilestone(schedule.Entries[0].ID, time.Date(2027, 1, 31, 23, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	_, err = schedule.CompleteMilestone(schedule.Entries[0].ID, time.Now())
+	assert.Equal(t, ErrMilestoneCompleted, err)
+	_, err = schedule.CompleteMilestone(uuid.New(), time.Now())
+	assert.Equal(t, ErrRecognitionEntryNotFound, err)
+
+	recognized, err := schedule.Recognize("2027-01", berlin, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, recognized)
+	recognized, err = schedule.Recognize("2027-02", berlin, time.Now())
+	require.NoError(t, err)
+	require.Len(t, recognized, 1)
+	assert.Equal(t, "Design", recognized[0].Milestone)
+	assert.Equal(t, RevenueScheduleActive, schedule.Status)
+
+	totals := SummarizeDeferredRevenue([]*RevenueSchedule{schedule})
+	require.Len(t, totals, 1)
+	assert.Equal(t, "300", totals[0].Recognized.String())
+	assert.Equal(t, "600", totals[0].Deferred.String())
+	assert.Equal(t, "600", totals[0].Unscheduled.String())
+	assert.Empty(t, totals[0].Upcoming)
+}
+
+func TestSummarizeDeferredRevenue(t *testing.T) {
+	invoice, line := newTestContractInvoice("120")
+	first, err := NewStraightLineSchedule(invoice, line, "2027-01", 2, uuid.New())
+	require.NoError(t, err)
+	second, err := NewStraightLineSchedule(invoice, line, "2027-02", 2, uuid.New())
+	require.NoError(t, err)
+	_, err = first.Recognize("2027-01", time.UTC, time.Now())
+	require.NoError(t, err)
+	usdInvoice, usdLine := newTestContractInvoice("50")
+	usdInvoice.Currency = "USD"
+	third, err := NewStraightLineSchedule(usdInvoice, usdLine, "2027-01", 1, uuid.New())
+	require.NoError(t, err)
+
+	totals := SummarizeDeferredRevenue([]*RevenueSchedule{first, second, third})
+	require.Len(t, totals, 2)
+	assert.Equal(t, "EUR", totals[0].Currency)
+	assert.Equal(t, 2, totals[0].Schedules)
+	assert.Equal(t, "240", totals[0].Total.String())
+	assert.Equal(t, "60", totals[0].Recognized.String())
+	assert.Equal(t, "180", totals[0].Deferred.String())
+	require.Len(t, totals[0].Upcoming, 2)
+	assert.Equal(t, RevenuePeriod{Period: "2027-02", Amount: decimal.NewFromInt(120)}.Period, totals[0].Upcoming[0].Period)
+	assert.Equal(t, "120", totals[0].Upcoming[0].Amount.String())
+	assert.Equal(t, "60", totals[0].Upcoming[1].Amount.String())
+	assert.Equal(t, "USD", totals[1].Currency)
+}
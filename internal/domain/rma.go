@@ -0,0 +1,237 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReturnReason is why a customer sends goods back, as recorded on the RMA.
+type ReturnReason string
+
+const (
+	ReturnReasonDefective        ReturnReason = "defective"
+	ReturnReasonNotAsDescribed   ReturnReason = "not_as_described"
+	ReturnReasonMissingParts     ReturnReason = "missing_parts"
+	ReturnReasonDamagedInTransit ReturnReason = "damaged_in_transit"
+	ReturnReasonWrongItem        ReturnReason = "wrong_item"
+	ReturnReasonNoLongerNeeded   ReturnReason = "no_longer_needed"
+	ReturnReasonOrderedByMistake ReturnReason = "ordered_by_mistake"
+	ReturnReasonOther            ReturnReason = "other"
+)
+
+func (r ReturnReason) IsValid() bool {
+	switch r {
+	case ReturnReasonDefective, ReturnReasonNotAsDescribed, ReturnReasonMissingParts,
+		ReturnReasonDamagedInTransit, ReturnReasonWrongItem, ReturnReasonNoLongerNeeded,
+		ReturnReasonOrderedByMistake, ReturnReasonOther:
+		return true
+	}
+	return false
+}
+
+// IsQuality reports whether the reason points at the product itself rather
+// than at the carrier, the warehouse or the customer.
+func (r ReturnReason) IsQuality() bool {
+	return r == ReturnReasonDefective || r == ReturnReasonNotAsDescribed || r == ReturnReasonMissingParts
+}
+
+// ReturnDisposition is what is done with returned units once inspected.
+type ReturnDisposition string
+
+const (
+	ReturnDispositionRestock          ReturnDisposition = "restock"
+	ReturnDispositionRefurbish        ReturnDisposition = "refurbish"
+	ReturnDispositionReturnToSupplier ReturnDisposition = "return_to_supplier"
+	ReturnDispositionScrap            ReturnDisposition = "scrap"
+)
+
+func (d ReturnDisposition) IsValid() bool {
+	switch d {
+	case ReturnDispositionRestock, ReturnDispositionRefurbish, ReturnDispositionReturnToSupplier, ReturnDispositionScrap:
+		return true
+	}
+	return false
+}
+
+type ReturnStatus string
+
+const (
+	ReturnStatusAuthorized ReturnStatus = "authorized"
+	ReturnStatusReceived   ReturnStatus = "received"
+	ReturnStatusClosed     ReturnStatus = "closed"
+)
+
+// ReturnAuthorization (RMA) lets a customer send back units of an order.
+// It is authorized with a reason per line, received at a warehouse, and
+// closed once every line has a disposition.
+type ReturnAuthorization struct {
+	ID          uuid.UUID    `json:"id" bson:"_id"`
+	TenantID    uuid.UUID    `json:"tenantId" bson:"tenantId"`
+	RMANumber   string       `json:"rmaNumber" bson:"rmaNumber"`
+	OrderID     uuid.UUID    `json:"orderId" bson:"orderId"`
+	OrderNumber string       `json:"orderNumber" bson:"orderNumber"`
+	ClientID    uuid.UUID    `json:"clientId" bson:"clientId"`
+	WarehouseID uuid.UUID    `json:"warehouseId" bson:"warehouseId"`
+	Status      ReturnStatus `json:"status" bson:"status"`
+	Lines       []ReturnLine `json:"lines" bson:"lines"`
+	ReceivedAt  *time.Time   `json:"receivedAt" bson:"receivedAt"`
+	ClosedAt    *time.Time   `json:"closedAt" bson:"closedAt"`
+	CreatedBy   uuid.UUID    `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time    `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt" bson:"updatedAt"`
+	Version     int64        `json:"-" bson:"version"`
+}
+
+// ReturnLine returns units of one order line. SupplierID and LotNumber
+// trace the units back to where they were bought and the batch they came
+// from, for return rates per supplier and lot.
+type ReturnLine struct {
+	ID               uuid.UUID         `json:"id" bson:"_id"`
+	OrderLineID      uuid.UUID         `json:"orderLineId" bson:"orderLineId"`
+	ProductID        uuid.UUID         `json:"productId" bson:"productId"`
+	SKU              string            `json:"sku" bson:"sku"`
+	SupplierID       *uuid.UUID        `json:"supplierId" bson:"supplierId"`
+	LotNumber        string            `json:"lotNumber" bson:"lotNumber"`
+	Quantity         int               `json:"quantity" bson:"quantity"`
+	Reason           ReturnReason      `json:"reason" bson:"reason"`
+	ReasonNotes      string            `json:"reasonNotes" bson:"reasonNotes"`
+	Disposition      ReturnDisposition `json:"disposition,omitempty" bson:"disposition,omitempty"`
+	DispositionNotes string            `json:"dispositionNotes,omitempty" bson:"dispositionNotes,omitempty"`
+	DispositionedBy  *uuid.UUID        `json:"dispositionedBy,omitempty" bson:"dispositionedBy,omitempty"`
+	DispositionedAt  *time.Time        `json:"dispositionedAt,omitempty" bson:"dispositionedAt,omitempty"`
+}
+
+func NewReturnAuthorization(order *Order, warehouseID, createdBy uuid.UUID, rmaNumber string) *ReturnAuthorization {
+	now := time.Now().UTC()
+	return &ReturnAuthorization{
+		ID:          uuid.New(),
+		TenantID:    order.TenantID,
+		RMANumber:   strings.TrimSpace(rmaNumber),
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		ClientID:    order.ClientID,
+		WarehouseID: warehouseID,
+		Status:      ReturnStatusAuthorized,
+		Lines:       []ReturnLine{},
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// AddLine authorizes the return of line.Quantity units for line.Reason and
+// returns the line with its ID set.
+func (r *ReturnAuthorization) AddLine(line ReturnLine) (*ReturnLine, error) {
+	if r.Status != ReturnStatusAuthorized {
+		return nil, ErrReturnNotAuthorized
+	}
+	if line.Quantity <= 0 {
+		return nil, ErrInvalidReturnQuantity
+	}
+	if !line.Reason.IsValid() {
+		return nil, ErrInvalidReturnReason
+	}
+	line.ID = uuid.New()
+	line.LotNumber = strings.TrimSpace(line.LotNumber)
+	line.Disposition = ""
+	r.Lines = append(r.Lines, line)
+	r.UpdatedAt = time.Now().UTC()
+	return &r.Lines[len(r.Lines)-1], nil
+}
+
+// Quantity is the units returned of an order line.
+func (r *ReturnAuthorization) Quantity(orderLineID uuid.UUID) int {
+	quantity := 0
+	for _, line := range r.Lines {
+		if line.OrderLineID == orderLineID {
+			quantity += line.Quantity
+		}
+	}
+	return quantity
+}
+
+// Receive records the returned units arriving at the warehouse.
+func (r *ReturnAuthorization) Receive(receivedAt time.Time) error {
+	if r.Status != ReturnStatusAuthorized {
+		return ErrReturnNotAuthorized
+	}
+	if len(r.Lines) == 0 {
+		return ErrReturnEmpty
+	}
+	receivedAt = receivedAt.UTC()
+	r.Status = ReturnStatusReceived
+	r.ReceivedAt = &receivedAt
+	r.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// Dispose records the outcome of inspecting a received line. The RMA is
+// closed with its last line.
+func (r *ReturnAuthorization) Dispose(lineID uuid.UUID, disposition ReturnDisposition, notes string, by uuid.UUID) (*ReturnLine, error) {
+	if r.Status != ReturnStatusReceived {
+		return nil, ErrReturnNotReceived
+	}
+	if !disposition.IsValid() {
+		return nil, ErrInvalidReturnDisposition
+	}
+	var line *ReturnLine
+	for i := range r.Lines {
+		if r.Lines[i].ID == lineID {
+			line = &r.Lines[i]
+		}
+	}
+	if line == nil {
+		return nil, ErrReturnLineNotFound
+	}
+	if line.Disposition != "" {
+		return nil, ErrReturnLineDispositioned
+	}
+
+	now := time.Now().UTC()
+	line.Disposition = disposition
+	line.DispositionNotes = strings.TrimSpace(notes)
+	line.DispositionedBy = &by
+	line.DispositionedAt = &now
+	r.UpdatedAt = now
+
+	for _, other := range r.Lines {
+		if other.Disposition == "" {
+			return line, nil
+		}
+	}
+	r.Status = ReturnStatusClosed
+	r.ClosedAt = &now
+	return line, nil
+}
+
+// ReturnRateAlert flags a product returned more often than its tenant
+// accepts: UnitsReturned on RMAs opened between WindowStart and WindowEnd
+// are ReturnRate percent of the UnitsShipped then, above Threshold. It
+// stays raised, from RaisedAt, until the rate falls back.
+type ReturnRateAlert struct {
+	ID            string    `json:"id" bson:"_id"`
+	TenantID      uuid.UUID `json:"tenantId" bson:"tenantId"`
+	ProductID     uuid.UUID `json:"productId" bson:"productId"`
+	UnitsShipped  int       `json:"unitsShipped" bson:"unitsShipped"`
+	UnitsReturned int       `json:"unitsReturned" bson:"unitsReturned"`
+	ReturnRate    float64   `json:"returnRate" bson:"returnRate"`
+	Threshold     float64   `json:"threshold" bson:"threshold"`
+	QualityOnly   bool      `json:"qualityOnly" bson:"qualityOnly"`
+	WindowStart   time.Time `json:"windowStart" bson:"windowStart"`
+	WindowEnd     time.Time `json:"windowEnd" bson:"windowEnd"`
+	RaisedAt      time.Time `json:"raisedAt" bson:"raisedAt"`
+}
+
+var (
+	ErrInvalidReturnQuantity    = &OrderError{Code: "INVALID_RETURN_QUANTITY", Message: "Returned quantity must be positive"}
+	ErrReturnQuantityExceeded   = &OrderError{Code: "RETURN_QUANTITY_EXCEEDED", Message: "Cannot return more units than were shipped"}
+	ErrInvalidReturnReason      = &OrderError{Code: "INVALID_RETURN_REASON", Message: "Invalid return reason"}
+	ErrInvalidReturnDisposition = &OrderError{Code: "INVALID_RETURN_DISPOSITION", Message: "Invalid return disposition"}
+	ErrReturnNotAuthorized      = &OrderError{Code: "RETURN_NOT_AUTHORIZED", Message: "Return has already been received"}
+	ErrReturnNotReceived        = &OrderError{Code: "RETURN_NOT_RECEIVED", Message: "Return has not been received"}
+	ErrReturnEmpty              = &OrderError{Code: "RETURN_EMPTY", Message: "Return has no lines"}
+	ErrReturnLineNotFound       = &OrderError{Code: "RETURN_LINE_NOT_FOUND", Message: "Return line not found"}
+	ErrReturnLineDispositioned  = &OrderError{Code: "RETURN_LINE_DISPOSITIONED", Message: "Return line already has a disposition"}
+)
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReturn(t *testing.T) (*ReturnAuthorization, *Order) {
+	order, err := NewOrder(uuid.New(), uuid.New(), uuid.New(), OrderTypeStandard, OrderSourceWeb, "EUR")
+	require.NoError(t, err)
+	order.AddLine(OrderLine{ProductID: uuid.New(), Quantity: 5, UnitPrice: decimal.NewFromInt(10)})
+	order.AddLine(OrderLine{ProductID: uuid.New(), Quantity: 2, UnitPrice: decimal.NewFromInt(10)})
+	order.Fulfillments = append(order.Fulfillments,
+		OrderFulfillment{ID: uuid.New(), Lines: []FulfillmentLine{{OrderLineID: order.Lines[0].ID, Quantity: 2}}},
+		OrderFulfillment{ID: uuid.New(), Lines: []FulfillmentLine{{OrderLineID: order.Lines[0].ID, Quantity: 3}, {OrderLineID: order.Lines[1].ID, Quantity: 1}}},
+	)
+	return NewReturnAuthorization(order, uuid.New(), uuid.New(), " RMA-1 "), order
+}
+
+func TestOrderShippedQuantity(t *testing.T) {
+	_, order := newTestReturn(t)
+	assert.Equal(t, 5, order.ShippedQuantity(order.Lines[0].ID))
+	assert.Equal(t, 1, order.ShippedQuantity(order.Lines[1].ID))
+	assert.Equal(t, 0, order.ShippedQuantity(uuid.New()))
+}
+
+func TestReturnAuthorizationAddLine(t *testing.T) {
+	rma, order := newTestReturn(t)
+	assert.Equal(t, "RMA-1", rma.RMANumber)
+	assert.Equal(t, order.TenantID, rma.TenantID)
+	assert.Equal(t, ReturnStatusAuthorized, rma.Status)
+
+	line, err := rma.AddLine(ReturnLine{OrderLineID: order.Lines[0].ID, Quantity: 2, Reason: ReturnReasonMissingParts, LotNumber: " L9 "})
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, line.ID)
+	assert.Equal(t, "L9", line.LotNumber)
+	_, err = rma.AddLine(ReturnLine{OrderLineID: order.Lines[0].ID, Quantity: 1, Reason: ReturnReasonOther})
+	require.NoError(t, err)
+	assert.Equal(t, 3, rma.Quantity(order.Lines[0].ID))
+
+	_, err = rma.AddLine(ReturnLine{OrderLineID: order.Lines[1].ID, Quantity: 0, Reason: ReturnReasonOther})
+	assert.Equal(t, ErrInvalidReturnQuantity, err)
+	_, err = rma.AddLine(ReturnLine{OrderLineID: order.Lines[1].ID, Quantity: 1, Reason: "broken"})
+	assert.Equal(t, ErrInvalidReturnReason, err)
+
+	assert.True(t, ReturnReasonMissingParts.IsQuality())
+	assert.False(t, ReturnReasonDamagedInTransit.IsQuality())
+}
+
+func TestReturnAuthorizationDispose(t *testing.T) {
+	rma, order := newTestReturn(t)
+	assert.Equal(t, ErrReturnEmpty, rma.Receive(time.Now()))
+
+	first, _ := rma.AddLine(ReturnLine{OrderLineID: order.Lines[0].ID, Quantity: 2, Reason: ReturnReasonDefective})
+	firstID := first.ID
+	second, _ := rma.AddLine(ReturnLine{OrderLineID: order.Lines[1].ID, Quantity: 1, Reason: ReturnReasonWrongItem})
+	secondID := second.ID
+	by := uuid.New()
+
+	_, err := rma.Dispose(firstID, ReturnDispositionScrap, "", by)
+	assert.Equal(t, ErrReturnNotReceived, err)
+
+	require.NoError(t, rma.Receive(time.Now()))
+	assert.Equal(t, ErrReturnNotAuthorized, rma.Receive(time.Now()))
+	_, err = rma.AddLine(ReturnLine{OrderLineID: order.Lines[1].ID, Quantity: 1, Reason: ReturnReasonOther})
+	assert.Equal(t, ErrReturnNotAuthorized, err)
+
+	_, err = rma.Dispose(firstID, "sell", "", by)
+	assert.Equal(t, ErrInvalidReturnDisposition, err)
+	_, err = rma.Dispose(uuid.New(), ReturnDispositionScrap, "", by)
+	assert.Equal(t, ErrReturnLineNotFound, err)
+
+	line, err := rma.Dispose(firstID, ReturnDispositionRefurbish, " cracked lid ", by)
+	require.NoError(t, err)
+	assert.Equal(t, "cracked lid", line.DispositionNotes)
+	assert.Equal(t, by, *line.DispositionedBy)
+	assert.Equal(t, ReturnStatusReceived, rma.Status, "one line is still to inspect")
+	_, err = rma.Dispose(firstID, ReturnDispositionScrap, "", by)
+	assert.Equal(t, ErrReturnLineDispositioned, err)
+
+	_, err = rma.Dispose(secondID, ReturnDispositionRestock, "", by)
+	require.NoError(t, err)
+	assert.Equal(t, ReturnStatusClosed, rma.Status)
+	assert.NotNil(t, rma.ClosedAt)
+}
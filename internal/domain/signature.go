@@ -0,0 +1,491 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EnvelopeStatus is where a document sent for signature is.
+type EnvelopeStatus string
+
+const (
+	// EnvelopeDraft has its signers and fields defined but is not sent.
+	EnvelopeDraft EnvelopeStatus = "draft"
+	// EnvelopeSent awaits its signers.
+	EnvelopeSent EnvelopeStatus = "sent"
+	// EnvelopeCompleted is signed by every signer.
+	EnvelopeCompleted EnvelopeStatus = "completed"
+	// EnvelopeDeclined was declined by a signer.
+	EnvelopeDeclined EnvelopeStatus = "declined"
+	// EnvelopeVoided was withdrawn by its sender.
+	EnvelopeVoided EnvelopeStatus = "voided"
+)
+
+// SignerStatus is where a signer of an envelope is.
+type SignerStatus string
+
+const (
+	SignerPending  SignerStatus = "pending"
+	SignerInvited  SignerStatus = "invited"
+	SignerViewed   SignerStatus = "viewed"
+	SignerSigned   SignerStatus = "signed"
+	SignerDeclined SignerStatus = "declined"
+)
+
+// SignatureMethod is how a signature was made.
+type SignatureMethod string
+
+const (
+	// SignatureDrawn is drawn by hand on the signing page.
+	SignatureDrawn SignatureMethod = "drawn"
+	// SignatureCertificate is made with the signer's X.509 certificate over
+	// the document's bytes.
+	SignatureCertificate SignatureMethod = "certificate"
+)
+
+// Envelope actions recorded in its audit trail.
+const (
+	EnvelopeActionCreated   = "created"
+	EnvelopeActionInvited   = "invited"
+	EnvelopeActionViewed    = "viewed"
+	EnvelopeActionSigned    = "signed"
+	EnvelopeActionDeclined  = "declined"
+	EnvelopeActionCompleted = "completed"
+	EnvelopeActionVoided    = "voided"
+	EnvelopeActionSealed    = "sealed"
+)
+
+// Envelope sends a document to signers, who sign the signature fields
+// assigned to them. The document's SHA-256 is taken when the envelope is
+// created, so signatures are bound to the file as it was; once everyone
+// has signed, the envelope is sealed into a signed PDF with an audit
+// certificate page, stored as SealedObjectKey.
+type Envelope struct {
+	ID               uuid.UUID        `json:"id" bson:"_id"`
+	TenantID         uuid.UUID        `json:"tenantId" bson:"tenantId"`
+	DocumentID       uuid.UUID        `json:"documentId" bson:"documentId"`
+	DocumentName     string           `json:"documentName" bson:"documentName"`
+	DocumentChecksum string           `json:"documentChecksum" bson:"documentChecksum"`
+	Title            string           `json:"title" bson:"title"`
+	Message          string           `json:"message,omitempty" bson:"message,omitempty"`
+	Status           EnvelopeStatus   `json:"status" bson:"status"`
+	Signers          []Signer         `json:"signers" bson:"signers"`
+	Fields           []SignatureField `json:"fields" bson:"fields"`
+	Signatures       []Signature      `json:"signatures" bson:"signatures"`
+	Audit            []EnvelopeEvent  `json:"audit" bson:"audit"`
+	ExpiresAt        *time.Time       `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	VoidReason       string           `json:"voidReason,omitempty" bson:"voidReason,omitempty"`
+	SealedObjectKey  string           `json:"-" bson:"sealedObjectKey,omitempty"`
+	SealedChecksum   string           `json:"sealedChecksum,omitempty" bson:"sealedChecksum,omitempty"`
+	SealedAt         *time.Time       `json:"sealedAt,omitempty" bson:"sealedAt,omitempty"`
+	CreatedBy        string           `json:"createdBy" bson:"createdBy"`
+	CreatedAt        time.Time        `json:"createdAt" bson:"createdAt"`
+	UpdatedAt        time.Time        `json:"updatedAt" bson:"updatedAt"`
+	CompletedAt      *time.Time       `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+	Version          int64            `json:"version" bson:"version"`
+}
+
+// Signer is someone asked to sign an envelope. Only the hash of the token
+// in their invitation link is kept.
+type Signer struct {
+	ID            uuid.UUID    `json:"id" bson:"id"`
+	Name          string       `json:"name" bson:"name"`
+	Email         string       `json:"email" bson:"email"`
+	Status        SignerStatus `json:"status" bson:"status"`
+	TokenHash     string       `json:"-" bson:"tokenHash,omitempty"`
+	InvitedAt     *time.Time   `json:"invitedAt,omitempty" bson:"invitedAt,omitempty"`
+	ViewedAt      *time.Time   `json:"viewedAt,omitempty" bson:"viewedAt,omitempty"`
+	SignedAt      *time.Time   `json:"signedAt,omitempty" bson:"signedAt,omitempty"`
+	DeclinedAt    *time.Time   `json:"declinedAt,omitempty" bson:"declinedAt,omitempty"`
+	DeclineReason string       `json:"declineReason,omitempty" bson:"declineReason,omitempty"`
+}
+
+// SignatureField is where a signer signs: a box on a page of the
+// document, in points from the page's bottom left corner.
+type SignatureField struct {
+	ID       uuid.UUID `json:"id" bson:"id"`
+	SignerID uuid.UUID `json:"signerId" bson:"signerId"`
+	Label    string    `json:"label,omitempty" bson:"label,omitempty"`
+	Page     int       `json:"page" bson:"page"`
+	X        float64   `json:"x" bson:"x"`
+	Y        float64   `json:"y" bson:"y"`
+	Width    float64   `json:"width" bson:"width"`
+	Height   float64   `json:"height" bson:"height"`
+}
+
+// Stroke is a line drawn in a signature field, as points from 0 to 1 across
+// and down the field from its top left corner.
+type Stroke [][2]float64
+
+// Signature is a signer's signature of one field.
+type Signature struct {
+	FieldID     uuid.UUID        `json:"fieldId" bson:"fieldId"`
+	SignerID    uuid.UUID        `json:"signerId" bson:"signerId"`
+	Method      SignatureMethod  `json:"method" bson:"method"`
+	Strokes     []Stroke         `json:"strokes,omitempty" bson:"strokes,omitempty"`
+	Certificate *CertificateInfo `json:"certificate,omitempty" bson:"certificate,omitempty"`
+	SignedAt    time.Time        `json:"signedAt" bson:"signedAt"`
+}
+
+// CertificateInfo describes the certificate a signature was made with, and
+// keeps the signature of the document's bytes.
+type CertificateInfo struct {
+	Subject      string    `json:"subject" bson:"subject"`
+	Issuer       string    `json:"issuer" bson:"issuer"`
+	SerialNumber string    `json:"serialNumber" bson:"serialNumber"`
+	Fingerprint  string    `json:"fingerprint" bson:"fingerprint"`
+	NotBefore    time.Time `json:"notBefore" bson:"notBefore"`
+	NotAfter     time.Time `json:"notAfter" bson:"notAfter"`
+	Signature    []byte    `json:"signature" bson:"signature"`
+}
+
+// EnvelopeEvent is an entry of an envelope's audit trail. Actor is the
+// sending user's ID or the signer's email.
+type EnvelopeEvent struct {
+	At       time.Time  `json:"at" bson:"at"`
+	Action   string     `json:"action" bson:"action"`
+	Actor    string     `json:"actor,omitempty" bson:"actor,omitempty"`
+	SignerID *uuid.UUID `json:"signerId,omitempty" bson:"signerId,omitempty"`
+	IP       string     `json:"ip,omitempty" bson:"ip,omitempty"`
+	Detail   string     `json:"detail,omitempty" bson:"detail,omitempty"`
+}
+
+// NewEnvelope returns a draft envelope for a document whose content has
+// the SHA-256 checksum.
+func NewEnvelope(tenantID, documentID uuid.UUID, documentName, checksum, title, message, createdBy string) *Envelope {
+	now := time.Now().UTC()
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = documentName
+	}
+	envelope := &Envelope{
+		ID:               uuid.New(),
+		TenantID:         tenantID,
+		DocumentID:       documentID,
+		DocumentName:     documentName,
+		DocumentChecksum: checksum,
+		Title:            title,
+		Message:          strings.TrimSpace(message),
+		Status:           EnvelopeDraft,
+		Signers:          []Signer{},
+		Fields:           []SignatureField{},
+		Signatures:       []Signature{},
+		CreatedBy:        createdBy,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Version:          1,
+	}
+	envelope.record(now, EnvelopeActionCreated, createdBy, nil, "", "")
+	return envelope
+}
+
+// AddSigner adds a signer to a draft and returns their ID.
+func (e *Envelope) AddSigner(name, email string) (uuid.UUID, error) {
+	if e.Status != EnvelopeDraft {
+		return uuid.Nil, ErrEnvelopeClosed
+	}
+	name, email = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(email))
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email || name == "" {
+		return uuid.Nil, ErrInvalidEnvelope
+	}
+	for _, signer := range e.Signers {
+		if signer.Email == email {
+			return uuid.Nil, ErrInvalidEnvelope
+		}
+	}
+	signer := Signer{ID: uuid.New(), Name: name, Email: email, Status: SignerPending}
+	e.Signers = append(e.Signers, signer)
+	return signer.ID, nil
+}
+
+// AddField adds a signature field of a signer to a draft.
+func (e *Envelope) AddField(signerID uuid.UUID, label string, page int, x, y, width, height float64) error {
+	if e.Status != EnvelopeDraft {
+		return ErrEnvelopeClosed
+	}
+	if e.Signer(signerID) == nil || page < 1 || x < 0 || y < 0 || width <= 0 || height <= 0 {
+		return ErrInvalidEnvelope
+	}
+	e.Fields = append(e.Fields, SignatureField{
+		ID:       uuid.New(),
+		SignerID: signerID,
+		Label:    strings.TrimSpace(label),
+		Page:     page,
+		X:        x,
+		Y:        y,
+		Width:    width,
+		Height:   height,
+	})
+	return nil
+}
+
+// Send invites the signers who have not signed yet, with links valid for
+// ttl, and returns each invited signer's token. Sending again invites them
+// anew, and their earlier links stop working.
+func (e *Envelope) Send(by string, ttl time.Duration) (map[uuid.UUID]string, error) {
+	if e.Status != EnvelopeDraft && e.Status != EnvelopeSent {
+		return nil, ErrEnvelopeClosed
+	}
+	if len(e.Signers) == 0 {
+		return nil, ErrInvalidEnvelope
+	}
+	for _, signer := range e.Signers {
+		if len(e.SignerFields(signer.ID)) == 0 {
+			return nil, ErrInvalidEnvelope
+		}
+	}
+
+	now := time.Now().UTC()
+	tokens := make(map[uuid.UUID]string)
+	for i := range e.Signers {
+		signer := &e.Signers[i]
+		if signer.Status == SignerSigned {
+			continue
+		}
+		token, err := newSigningToken()
+		if err != nil {
+			return nil, err
+		}
+		tokens[signer.ID] = token
+		signer.TokenHash = HashSigningToken(token)
+		signer.Status = SignerInvited
+		signer.InvitedAt = &now
+		e.record(now, EnvelopeActionInvited, by, &signer.ID, "", signer.Email)
+	}
+	expires := now.Add(ttl)
+	e.ExpiresAt = &expires
+	e.Status = EnvelopeSent
+	e.UpdatedAt = now
+	return tokens, nil
+}
+
+// SignerByToken returns the signer invited with token, or nil.
+func (e *Envelope) SignerByToken(token string) *Signer {
+	hash := HashSigningToken(token)
+	for i := range e.Signers {
+		if e.Signers[i].TokenHash != "" && subtle.ConstantTimeCompare([]byte(e.Signers[i].TokenHash), []byte(hash)) == 1 {
+			return &e.Signers[i]
+		}
+	}
+	return nil
+}
+
+// Signer returns the envelope's signer, or nil.
+func (e *Envelope) Signer(id uuid.UUID) *Signer {
+	for i := range e.Signers {
+		if e.Signers[i].ID == id {
+			return &e.Signers[i]
+		}
+	}
+	return nil
+}
+
+// SignerFields returns the fields a signer is to sign.
+func (e *Envelope) SignerFields(signerID uuid.UUID) []SignatureField {
+	var fields []SignatureField
+	for _, field := range e.Fields {
+		if field.SignerID == signerID {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// View records that a signer opened their invitation. Only the first view
+// is recorded.
+func (e *Envelope) View(signerID uuid.UUID, ip string) {
+	signer := e.Signer(signerID)
+	if signer == nil || signer.Status != SignerInvited {
+		return
+	}
+	now := time.Now().UTC()
+	signer.Status = SignerViewed
+	signer.ViewedAt = &now
+	e.UpdatedAt = now
+	e.record(now, EnvelopeActionViewed, signer.Email, &signer.ID, ip, "")
+}
+
+// Sign records a signer's signatures, one for each of their fields. The
+// envelope is completed when the last signer signs.
+func (e *Envelope) Sign(signerID uuid.UUID, signatures []Signature, ip string) error {
+	signer, err := e.actingSigner(signerID)
+	if err != nil {
+		return err
+	}
+	fields := e.SignerFields(signerID)
+	if len(signatures) != len(fields) {
+		return ErrSignatureMissing
+	}
+	signed := make(map[uuid.UUID]bool, len(fields))
+	for _, signature := range signatures {
+		if !hasField(fields, signature.FieldID) || signed[signature.FieldID] {
+			return ErrSignatureMissing
+		}
+		signed[signature.FieldID] = true
+		switch signature.Method {
+		case SignatureDrawn:
+			if len(signature.Strokes) == 0 {
+				return ErrInvalidSignature
+			}
+			for _, stroke := range signature.Strokes {
+				for _, point := range stroke {
+					if point[0] < 0 || point[0] > 1 || point[1] < 0 || point[1] > 1 {
+						return ErrInvalidSignature
+					}
+				}
+			}
+		case SignatureCertificate:
+			if signature.Certificate == nil {
+				return ErrInvalidSignature
+			}
+		default:
+			return ErrInvalidSignature
+		}
+	}
+
+	now := time.Now().UTC()
+	methods := make([]string, 0, len(signatures))
+	for _, signature := range signatures {
+		signature.SignerID = signerID
+		signature.SignedAt = now
+		e.Signatures = append(e.Signatures, signature)
+		methods = append(methods, string(signature.Method))
+	}
+	signer.Status = SignerSigned
+	signer.SignedAt = &now
+	signer.TokenHash = ""
+	e.UpdatedAt = now
+	e.record(now, EnvelopeActionSigned, signer.Email, &signer.ID, ip, strings.Join(methods, ", "))
+
+	for _, other := range e.Signers {
+		if other.Status != SignerSigned {
+			return nil
+		}
+	}
+	e.Status = EnvelopeCompleted
+	e.CompletedAt = &now
+	e.record(now, EnvelopeActionCompleted, "", nil, "", "")
+	return nil
+}
+
+// Decline records that a signer refuses to sign, which closes the
+// envelope.
+func (e *Envelope) Decline(signerID uuid.UUID, reason, ip string) error {
+	signer, err := e.actingSigner(signerID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	signer.Status = SignerDeclined
+	signer.DeclinedAt = &now
+	signer.DeclineReason = strings.TrimSpace(reason)
+	e.Status = EnvelopeDeclined
+	e.clearTokens()
+	e.UpdatedAt = now
+	e.record(now, EnvelopeActionDeclined, signer.Email, &signer.ID, ip, signer.DeclineReason)
+	return nil
+}
+
+// Void withdraws an envelope that is not completed.
+func (e *Envelope) Void(reason, by string) error {
+	if e.Status != EnvelopeDraft && e.Status != EnvelopeSent {
+		return ErrEnvelopeClosed
+	}
+	now := time.Now().UTC()
+	e.Status = EnvelopeVoided
+	e.VoidReason = strings.TrimSpace(reason)
+	e.clearTokens()
+	e.UpdatedAt = now
+	e.record(now, EnvelopeActionVoided, by, nil, "", e.VoidReason)
+	return nil
+}
+
+// Seal records the signed PDF of a completed envelope, with its SHA-256
+// checksum.
+func (e *Envelope) Seal(objectKey, checksum string) error {
+	if e.Status != EnvelopeCompleted {
+		return ErrEnvelopeNotCompleted
+	}
+	now := time.Now().UTC()
+	e.SealedObjectKey = objectKey
+	e.SealedChecksum = checksum
+	e.SealedAt = &now
+	e.UpdatedAt = now
+	e.record(now, EnvelopeActionSealed, "", nil, "", checksum)
+	return nil
+}
+
+// Expired reports whether the invitations of a sent envelope have run out.
+func (e *Envelope) Expired(now time.Time) bool {
+	return e.Status == EnvelopeSent && e.ExpiresAt != nil && now.After(*e.ExpiresAt)
+}
+
+func (e *Envelope) actingSigner(signerID uuid.UUID) (*Signer, error) {
+	if e.Status != EnvelopeSent {
+		return nil, ErrEnvelopeClosed
+	}
+	if e.Expired(time.Now()) {
+		return nil, ErrEnvelopeExpired
+	}
+	signer := e.Signer(signerID)
+	if signer == nil {
+		return nil, ErrEnvelopeNotFound
+	}
+	if signer.Status != SignerInvited && signer.Status != SignerViewed {
+		return nil, ErrSignerDone
+	}
+	return signer, nil
+}
+
+func (e *Envelope) clearTokens() {
+	for i := range e.Signers {
+		e.Signers[i].TokenHash = ""
+	}
+}
+
+func (e *Envelope) record(at time.Time, action, actor string, signerID *uuid.UUID, ip, detail string) {
+	e.Audit = append(e.Audit, EnvelopeEvent{At: at, Action: action, Actor: actor, SignerID: signerID, IP: ip, Detail: detail})
+}
+
+func hasField(fields []SignatureField, id uuid.UUID) bool {
+	for _, field := range fields {
+		if field.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// HashSigningToken returns the hash a signing token is stored and looked
+// up by.
+func HashSigningToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSigningToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+var (
+	ErrEnvelopeNotFound     = &DocumentError{Code: "ENVELOPE_NOT_FOUND", Message: "envelope not found"}
+	ErrInvalidEnvelope      = &DocumentError{Code: "INVALID_ENVELOPE", Message: "every signer needs a name, a distinct email and at least one signature field"}
+	ErrEnvelopeClosed       = &DocumentError{Code: "ENVELOPE_CLOSED", Message: "envelope is no longer open for signing"}
+	ErrEnvelopeExpired      = &DocumentError{Code: "ENVELOPE_EXPIRED", Message: "signing invitation has expired"}
+	ErrEnvelopeNotCompleted = &DocumentError{Code: "ENVELOPE_NOT_COMPLETED", Message: "envelope is not signed by every signer yet"}
+	ErrSignerDone           = &DocumentError{Code: "SIGNER_DONE", Message: "signer has already signed or declined"}
+	ErrSignatureMissing     = &DocumentError{Code: "SIGNATURE_MISSING", Message: "every field of the signer needs one signature"}
+	ErrInvalidSignature     = &DocumentError{Code: "INVALID_SIGNATURE", Message: "invalid signature"}
+)
@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope_SigningFlow(t *testing.T) {
+	envelope := NewEnvelope(uuid.New(), uuid.New(), "contract.pdf", "abc", "", "Please sign", "user-1")
+	assert.Equal(t, "contract.pdf", envelope.Title, "title defaults to the document name")
+	assert.Equal(t, EnvelopeDraft, envelope.Status)
+
+	jane, err := envelope.AddSigner("Jane Roe", " Jane@Example.com ")
+	require.NoError(t, err)
+	john, err := envelope.AddSigner("John Doe", "john@example.com")
+	require.NoError(t, err)
+	_, err = envelope.AddSigner("Jane again", "jane@example.com")
+	assert.ErrorIs(t, err, ErrInvalidEnvelope, "emails are distinct")
+	_, err = envelope.AddSigner("Nobody", "not an email")
+	assert.ErrorIs(t, err, ErrInvalidEnvelope)
+
+	require.NoError(t, envelope.AddField(jane, "Customer", 2, 50, 100, 200, 60))
+	assert.ErrorIs(t, envelope.AddField(uuid.New(), "", 1, 50, 100, 200, 60), ErrInvalidEnvelope)
+	assert.ErrorIs(t, envelope.AddField(john, "", 0, 50, 100, 200, 60), ErrInvalidEnvelope)
+
+	_, err = envelope.Send("user-1", time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidEnvelope, "every signer needs a field")
+	require.NoError(t, envelope.AddField(john, "Supplier", 2, 300, 100, 200, 60))
+
+	tokens, err := envelope.Send("user-1", time.Hour)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, EnvelopeSent, envelope.Status)
+	assert.Equal(t, jane, envelope.SignerByToken(tokens[jane]).ID)
+	assert.Nil(t, envelope.SignerByToken("forged"))
+	assert.NotContains(t, envelope.Signers[0].TokenHash, tokens[jane], "only the hash is kept")
+	assert.ErrorIs(t, envelope.AddField(jane, "", 1, 0, 0, 10, 10), ErrEnvelopeClosed)
+
+	envelope.View(jane, "198.51.100.7")
+	assert.Equal(t, SignerViewed, envelope.Signer(jane).Status)
+
+	janeField := envelope.SignerFields(jane)[0]
+	assert.ErrorIs(t, envelope.Sign(jane, nil, ""), ErrSignatureMissing)
+	assert.ErrorIs(t, envelope.Sign(jane, []Signature{{FieldID: envelope.SignerFields(john)[0].ID, Method: SignatureDrawn, Strokes: []Stroke{{{0, 0}}}}}, ""), ErrSignatureMissing, "signers sign their own fields")
+	assert.ErrorIs(t, envelope.Sign(jane, []Signature{{FieldID: janeField.ID, Method: SignatureDrawn}}, ""), ErrInvalidSignature)
+	assert.ErrorIs(t, envelope.Sign(jane, []Signature{{FieldID: janeField.ID, Method: SignatureDrawn, Strokes: []Stroke{{{0.5, 1.5}}}}}, ""), ErrInvalidSignature)
+
+	require.NoError(t, envelope.Sign(jane, []Signature{{FieldID: janeField.ID, Method: SignatureDrawn, Strokes: []Stroke{{{0.1, 0.5}, {0.9, 0.5}}}}}, "198.51.100.7"))
+	assert.Equal(t, SignerSigned, envelope.Signer(jane).Status)
+	assert.Equal(t, EnvelopeSent, envelope.Status)
+	assert.Nil(t, envelope.SignerByToken(tokens[jane]), "links are used once")
+	assert.ErrorIs(t, envelope.Sign(jane, nil, ""), ErrSignerDone)
+
+	resent, err := envelope.Send("user-1", time.Hour)
+	require.NoError(t, err)
+	assert.NotContains(t, resent, jane, "signed signers are not invited again")
+	assert.Nil(t, envelope.SignerByToken(tokens[john]), "resending replaces earlier links")
+
+	require.NoError(t, envelope.Sign(john, []Signature{{
+		FieldID:     envelope.SignerFields(john)[0].ID,
+		Method:      SignatureCertificate,
+		Certificate: &CertificateInfo{Subject: "CN=John Doe"},
+	}}, ""))
+	assert.Equal(t, EnvelopeCompleted, envelope.Status)
+	assert.NotNil(t, envelope.CompletedAt)
+	assert.ErrorIs(t, envelope.Void("", "user-1"), ErrEnvelopeClosed)
+
+	require.NoError(t, envelope.Seal("signed/x.pdf", "def"))
+	var actions []string
+	for _, event := range envelope.Audit {
+		actions = append(actions, event.Action)
+	}
+	assert.Equal(t, []string{
+		EnvelopeActionCreated,
+		EnvelopeActionInvited, EnvelopeActionInvited,
+		EnvelopeActionViewed,
+		EnvelopeActionSigned,
+		EnvelopeActionInvited,
+		EnvelopeActionSigned,
+		EnvelopeActionCompleted,
+		EnvelopeActionSealed,
+	}, actions)
+}
+
+func TestEnvelope_DeclineAndExpiry(t *testing.T) {
+	envelope := NewEnvelope(uuid.New(), uuid.New(), "nda.pdf", "abc", "NDA", "", "user-1")
+	signer, err := envelope.AddSigner("Jane Roe", "jane@example.com")
+	require.NoError(t, err)
+	require.NoError(t, envelope.AddField(signer, "", 1, 50, 50, 150, 40))
+	_, err = envelope.Send("user-1", -time.Minute)
+	require.NoError(t, err)
+	assert.True(t, envelope.Expired(time.Now()))
+	assert.ErrorIs(t, envelope.Decline(signer, "", ""), ErrEnvelopeExpired)
+
+	tokens, err := envelope.Send("user-1", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, envelope.Decline(signer, " wrong counterparty ", "203.0.113.1"))
+	assert.Equal(t, EnvelopeDeclined, envelope.Status)
+	assert.Equal(t, "wrong counterparty", envelope.Signer(signer).DeclineReason)
+	assert.Nil(t, envelope.SignerByToken(tokens[signer]))
+	_, err = envelope.Send("user-1", time.Hour)
+	assert.ErrorIs(t, err, ErrEnvelopeClosed)
+}
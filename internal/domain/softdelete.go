@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// SoftDelete is embedded in aggregates that go to the trash instead of being
+// removed. Trashed aggregates are hidden from default queries and can be
+// restored until the purge job removes them for good.
+type SoftDelete struct {
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	DeletedBy string     `json:"deletedBy,omitempty" bson:"deletedBy,omitempty"`
+}
+
+func (s *SoftDelete) IsDeleted() bool {
+	return s.DeletedAt != nil
+}
+
+func (s *SoftDelete) MarkDeleted(userID string, at time.Time) {
+	at = at.UTC()
+	s.DeletedAt = &at
+	s.DeletedBy = userID
+}
+
+func (s *SoftDelete) Restore() {
+	s.DeletedAt = nil
+	s.DeletedBy = ""
+}
+
+// ExpiresAt is when a trashed aggregate becomes eligible for purging. It is
+// the zero time for aggregates that are not deleted or are kept forever.
+func (s *SoftDelete) ExpiresAt(retention time.Duration) time.Time {
+	if s.DeletedAt == nil || retention <= 0 {
+		return time.Time{}
+	}
+	return s.DeletedAt.Add(retention)
+}
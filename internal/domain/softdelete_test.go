@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoftDelete_MarkDeletedAndRestore(t *testing.T) {
+	var s SoftDelete
+	assert.False(t, s.IsDeleted())
+
+	at := time.Date(2024, 3, 1, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	s.MarkDeleted("user-1", at)
+	assert.True(t, s.IsDeleted())
+	assert.Equal(t, "user-1", s.DeletedBy)
+	assert.Equal(t, time.UTC, s.DeletedAt.Location())
+	assert.True(t, s.DeletedAt.Equal(at))
+
+	s.Restore()
+	assert.False(t, s.IsDeleted())
+	assert.Empty(t, s.DeletedBy)
+}
+
+func TestSoftDelete_ExpiresAt(t *testing.T) {
+	var s SoftDelete
+	assert.True(t, s.ExpiresAt(24*time.Hour).IsZero())
+
+	at := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	s.MarkDeleted("user-1", at)
+	assert.Equal(t, at.Add(24*time.Hour), s.ExpiresAt(24*time.Hour))
+	assert.True(t, s.ExpiresAt(0).IsZero())
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StoragePolicy decides when a tenant's documents move from hot storage to
+// the archive. A rule for a document type beats the rule without one, which
+// applies to every other type; types no rule applies to stay hot.
+type StoragePolicy struct {
+	TenantID  uuid.UUID     `json:"tenantId" bson:"_id"`
+	Rules     []StorageRule `json:"rules" bson:"rules"`
+	UpdatedAt time.Time     `json:"updatedAt" bson:"updatedAt"`
+	UpdatedBy string        `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+}
+
+// StorageRule archives documents of Type, or of any type when empty,
+// ArchiveAfterDays after they were created or last restored.
+type StorageRule struct {
+	Type             DocumentType `json:"type,omitempty" bson:"type,omitempty"`
+	ArchiveAfterDays int          `json:"archiveAfterDays" bson:"archiveAfterDays"`
+}
+
+// Validate checks that every rule has a known type or none, a positive
+// age, and that no two rules cover the same type.
+func (p *StoragePolicy) Validate() error {
+	seen := map[DocumentType]bool{}
+	for _, rule := range p.Rules {
+		if rule.Type != "" && !rule.Type.IsValid() {
+			return ErrInvalidStoragePolicy
+		}
+		if rule.ArchiveAfterDays <= 0 || seen[rule.Type] {
+			return ErrInvalidStoragePolicy
+		}
+		seen[rule.Type] = true
+	}
+	return nil
+}
+
+// Cutoff returns the time documents the rule applies to must have been
+// created or restored before to be archived at now.
+func (r StorageRule) Cutoff(now time.Time) time.Time {
+	return now.AddDate(0, 0, -r.ArchiveAfterDays)
+}
+
+var ErrInvalidStoragePolicy = &DocumentError{Code: "INVALID_STORAGE_POLICY", Message: "each storage rule needs a valid, distinct document type or none, and a positive archiveAfterDays"}
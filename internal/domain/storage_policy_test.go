@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoragePolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []StorageRule
+		valid bool
+	}{
+		{"no rules", nil, true},
+		{"catch-all and typed", []StorageRule{{ArchiveAfterDays: 365}, {Type: DocTypeInvoice, ArchiveAfterDays: 90}}, true},
+		{"unknown type", []StorageRule{{Type: "memo", ArchiveAfterDays: 30}}, false},
+		{"zero days", []StorageRule{{Type: DocTypeReceipt}}, false},
+		{"duplicate type", []StorageRule{{Type: DocTypeInvoice, ArchiveAfterDays: 30}, {Type: DocTypeInvoice, ArchiveAfterDays: 60}}, false},
+		{"two catch-alls", []StorageRule{{ArchiveAfterDays: 30}, {ArchiveAfterDays: 60}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &StoragePolicy{Rules: tt.rules}
+			if tt.valid {
+				assert.NoError(t, policy.Validate())
+			} else {
+				assert.ErrorIs(t, policy.Validate(), ErrInvalidStoragePolicy)
+			}
+		})
+	}
+}
+
+func TestStorageRule_Cutoff(t *testing.T) {
+	rule := StorageRule{Type: DocTypeInvoice, ArchiveAfterDays: 90}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 7, 19, 12, 0, 0, 0, time.UTC), rule.Cutoff(now))
+}
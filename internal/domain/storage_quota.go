@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QuotaEnforcement is what happens to an upload that would take a tenant
+// over its storage quota.
+type QuotaEnforcement string
+
+const (
+	// QuotaReject refuses the upload.
+	QuotaReject QuotaEnforcement = "reject"
+	// QuotaWarn accepts the upload and reports the overage, for billing
+	// to charge.
+	QuotaWarn QuotaEnforcement = "warn"
+)
+
+// StorageQuota limits what a tenant stores. A zero limit is unlimited.
+type StorageQuota struct {
+	MaxBytes    int64            `json:"maxBytes" bson:"maxBytes"`
+	MaxObjects  int64            `json:"maxObjects" bson:"maxObjects"`
+	Enforcement QuotaEnforcement `json:"enforcement" bson:"enforcement"`
+}
+
+// NewStorageQuota returns a quota enforced as enforcement, rejecting
+// uploads unless it is QuotaWarn.
+func NewStorageQuota(maxBytes, maxObjects int64, enforcement string) StorageQuota {
+	quota := StorageQuota{MaxBytes: maxBytes, MaxObjects: maxObjects, Enforcement: QuotaReject}
+	if QuotaEnforcement(enforcement) == QuotaWarn {
+		quota.Enforcement = QuotaWarn
+	}
+	return quota
+}
+
+// Overage returns by how many bytes and objects a tenant storing bytes in
+// objects is over the quota.
+func (q StorageQuota) Overage(bytes, objects int64) (overBytes, overObjects int64) {
+	if q.MaxBytes > 0 && bytes > q.MaxBytes {
+		overBytes = bytes - q.MaxBytes
+	}
+	if q.MaxObjects > 0 && objects > q.MaxObjects {
+		overObjects = objects - q.MaxObjects
+	}
+	return overBytes, overObjects
+}
+
+// Exceeded reports whether a tenant storing bytes in objects is over the
+// quota.
+func (q StorageQuota) Exceeded(bytes, objects int64) bool {
+	overBytes, overObjects := q.Overage(bytes, objects)
+	return overBytes > 0 || overObjects > 0
+}
+
+// StorageUsage is what a tenant stored when it was measured, against its
+// quota. Objects counts documents, trashed ones included.
+type StorageUsage struct {
+	TenantID       uuid.UUID    `json:"tenantId" bson:"_id"`
+	Bytes          int64        `json:"bytes" bson:"bytes"`
+	Objects        int64        `json:"objects" bson:"objects"`
+	Quota          StorageQuota `json:"quota" bson:"quota"`
+	OverageBytes   int64        `json:"overageBytes" bson:"overageBytes"`
+	OverageObjects int64        `json:"overageObjects" bson:"overageObjects"`
+	MeasuredAt     time.Time    `json:"measuredAt" bson:"measuredAt"`
+}
+
+// NewStorageUsage measures bytes in objects against quota.
+func NewStorageUsage(tenantID uuid.UUID, bytes, objects int64, quota StorageQuota, at time.Time) *StorageUsage {
+	usage := &StorageUsage{TenantID: tenantID, Bytes: bytes, Objects: objects, Quota: quota, MeasuredAt: at}
+	usage.OverageBytes, usage.OverageObjects = quota.Overage(bytes, objects)
+	return usage
+}
+
+// OverQuota reports whether the tenant stored more than its quota.
+func (u *StorageUsage) OverQuota() bool {
+	return u.OverageBytes > 0 || u.OverageObjects > 0
+}
+
+var ErrStorageQuotaExceeded = &DocumentError{Code: "STORAGE_QUOTA_EXCEEDED", Message: "storage quota exceeded"}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStorageQuota(t *testing.T) {
+	assert.Equal(t, QuotaWarn, NewStorageQuota(100, 10, "warn").Enforcement)
+	assert.Equal(t, QuotaReject, NewStorageQuota(100, 10, "reject").Enforcement)
+	assert.Equal(t, QuotaReject, NewStorageQuota(100, 10, "").Enforcement)
+	assert.Equal(t, QuotaReject, NewStorageQuota(100, 10, "ignore").Enforcement)
+}
+
+func TestStorageQuota_Overage(t *testing.T) {
+	tests := []struct {
+		name                   string
+		quota                  StorageQuota
+		bytes, objects         int64
+		overBytes, overObjects int64
+	}{
+		{"unlimited", StorageQuota{}, 1 << 40, 1e6, 0, 0},
+		{"within", StorageQuota{MaxBytes: 1000, MaxObjects: 10}, 1000, 10, 0, 0},
+		{"over bytes", StorageQuota{MaxBytes: 1000, MaxObjects: 10}, 1500, 10, 500, 0},
+		{"over objects", StorageQuota{MaxBytes: 1000, MaxObjects: 10}, 900, 12, 0, 2},
+		{"objects only", StorageQuota{MaxObjects: 10}, 1 << 40, 11, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overBytes, overObjects := tt.quota.Overage(tt.bytes, tt.objects)
+			assert.Equal(t, tt.overBytes, overBytes)
+			assert.Equal(t, tt.overObjects, overObjects)
+			assert.Equal(t, overBytes > 0 || overObjects > 0, tt.quota.Exceeded(tt.bytes, tt.objects))
+		})
+	}
+}
+
+func TestNewStorageUsage(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	quota := NewStorageQuota(1000, 10, "warn")
+
+	usage := NewStorageUsage(uuid.New(), 1200, 4, quota, now)
+	assert.Equal(t, int64(200), usage.OverageBytes)
+	assert.Equal(t, int64(0), usage.OverageObjects)
+	assert.True(t, usage.OverQuota())
+
+	assert.False(t, NewStorageUsage(uuid.New(), 1000, 10, quota, now).OverQuota())
+}
@@ -0,0 +1,358 @@
+package domain
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// SupplierInvoiceStatus is where a supplier invoice read from an uploaded
+// document is in review.
+type SupplierInvoiceStatus string
+
+const (
+	// SupplierInvoiceDraft is extracted and awaits review.
+	SupplierInvoiceDraft SupplierInvoiceStatus = "draft"
+	// SupplierInvoiceApproved is reviewed and due to be paid.
+	SupplierInvoiceApproved SupplierInvoiceStatus = "approved"
+	// SupplierInvoiceRejected is not to be paid, or not an invoice.
+	SupplierInvoiceRejected SupplierInvoiceStatus = "rejected"
+)
+
+// Fields of a supplier invoice that are extracted, and can be corrected.
+const (
+	SupplierFieldSupplierName  = "supplierName"
+	SupplierFieldInvoiceNumber = "invoiceNumber"
+	SupplierFieldIssueDate     = "issueDate"
+	SupplierFieldDueDate       = "dueDate"
+	SupplierFieldCurrency      = "currency"
+	SupplierFieldSubtotal      = "subtotal"
+	SupplierFieldTaxAmount     = "taxAmount"
+	SupplierFieldTotal         = "total"
+)
+
+// SupplierInvoiceFields lists the fields in the order they are extracted.
+var SupplierInvoiceFields = []string{
+	SupplierFieldSupplierName,
+	SupplierFieldInvoiceNumber,
+	SupplierFieldIssueDate,
+	SupplierFieldDueDate,
+	SupplierFieldCurrency,
+	SupplierFieldSubtotal,
+	SupplierFieldTaxAmount,
+	SupplierFieldTotal,
+}
+
+// Sources of an extracted field's value.
+const (
+	// FieldSourceTemplate is read where the supplier's template says.
+	FieldSourceTemplate = "template"
+	// FieldSourceHeuristic is guessed from the layout of invoices in general.
+	FieldSourceHeuristic = "heuristic"
+	// FieldSourceCorrected is set by the reviewer.
+	FieldSourceCorrected = "corrected"
+)
+
+// ExtractedField is the value read for a field, as text, with how
+// confident the extraction is of it, from 0 to 1.
+type ExtractedField struct {
+	Value      string  `json:"value" bson:"value"`
+	Confidence float64 `json:"confidence" bson:"confidence"`
+	Source     string  `json:"source" bson:"source"`
+}
+
+// SupplierInvoiceLine is a line item of a supplier invoice.
+type SupplierInvoiceLine struct {
+	Description string          `json:"description" bson:"description"`
+	Quantity    decimal.Decimal `json:"quantity" bson:"quantity"`
+	UnitPrice   decimal.Decimal `json:"unitPrice" bson:"unitPrice"`
+	Amount      decimal.Decimal `json:"amount" bson:"amount"`
+}
+
+// SupplierInvoice is an accounts payable invoice read from a document the
+// tenant received from a supplier. It is created as a draft and reviewed:
+// the reviewer corrects what was read wrong, which teaches the supplier's
+// template, and approves it for payment or rejects it. DuplicateOf is
+// another invoice of the supplier with the same number, if any.
+type SupplierInvoice struct {
+	ID            uuid.UUID                 `json:"id" bson:"_id"`
+	TenantID      uuid.UUID                 `json:"tenantId" bson:"tenantId"`
+	DocumentID    uuid.UUID                 `json:"documentId" bson:"documentId"`
+	SupplierID    *uuid.UUID                `json:"supplierId,omitempty" bson:"supplierId,omitempty"`
+	SupplierName  string                    `json:"supplierName" bson:"supplierName"`
+	SupplierKey   string                    `json:"supplierKey" bson:"supplierKey"`
+	InvoiceNumber string                    `json:"invoiceNumber" bson:"invoiceNumber"`
+	IssueDate     *time.Time                `json:"issueDate,omitempty" bson:"issueDate,omitempty"`
+	DueDate       *time.Time                `json:"dueDate,omitempty" bson:"dueDate,omitempty"`
+	Currency      string                    `json:"currency" bson:"currency"`
+	Subtotal      decimal.Decimal           `json:"subtotal" bson:"subtotal"`
+	TaxAmount     decimal.Decimal           `json:"taxAmount" bson:"taxAmount"`
+	Total         decimal.Decimal           `json:"total" bson:"total"`
+	Lines         []SupplierInvoiceLine     `json:"lines" bson:"lines"`
+	Fields        map[string]ExtractedField `json:"fields" bson:"fields"`
+	Warnings      []string                  `json:"warnings,omitempty" bson:"warnings,omitempty"`
+	DuplicateOf   *uuid.UUID                `json:"duplicateOf,omitempty" bson:"duplicateOf,omitempty"`
+	Status        SupplierInvoiceStatus     `json:"status" bson:"status"`
+	RejectReason  string                    `json:"rejectReason,omitempty" bson:"rejectReason,omitempty"`
+	ReviewedBy    *uuid.UUID                `json:"reviewedBy,omitempty" bson:"reviewedBy,omitempty"`
+	ReviewedAt    *time.Time                `json:"reviewedAt,omitempty" bson:"reviewedAt,omitempty"`
+	CreatedAt     time.Time                 `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time                 `json:"updatedAt" bson:"updatedAt"`
+	Version       int64                     `json:"version" bson:"version"`
+}
+
+// NewSupplierInvoice returns a draft for documentID with the fields
+// extracted. Fields whose value cannot be read as their type are dropped.
+func NewSupplierInvoice(tenantID, documentID uuid.UUID, fields map[string]ExtractedField, lines []SupplierInvoiceLine) *SupplierInvoice {
+	now := time.Now().UTC()
+	invoice := &SupplierInvoice{
+		ID:         uuid.New(),
+		TenantID:   tenantID,
+		DocumentID: documentID,
+		Lines:      lines,
+		Fields:     make(map[string]ExtractedField, len(fields)),
+		Status:     SupplierInvoiceDraft,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Version:    1,
+	}
+	if invoice.Lines == nil {
+		invoice.Lines = []SupplierInvoiceLine{}
+	}
+	for _, name := range SupplierInvoiceFields {
+		if field, ok := fields[name]; ok && invoice.set(name, field.Value) == nil {
+			invoice.Fields[name] = field
+		}
+	}
+	invoice.Check()
+	return invoice
+}
+
+// Correct sets fields to the reviewer's values, and lines when not nil. It
+// returns the names of the fields whose value changed.
+func (i *SupplierInvoice) Correct(values map[string]string, lines []SupplierInvoiceLine) ([]string, error) {
+	if i.Status != SupplierInvoiceDraft {
+		return nil, ErrSupplierInvoiceReviewed
+	}
+	for name := range values {
+		if !isSupplierInvoiceField(name) {
+			return nil, ErrInvalidSupplierInvoiceField
+		}
+	}
+	var changed []string
+	for _, name := range SupplierInvoiceFields {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if err := i.set(name, value); err != nil {
+			return nil, err
+		}
+		if i.Fields[name].Value != value {
+			changed = append(changed, name)
+		}
+		i.Fields[name] = ExtractedField{Value: value, Confidence: 1, Source: FieldSourceCorrected}
+	}
+	if lines != nil {
+		i.Lines = lines
+	}
+	i.Check()
+	i.UpdatedAt = time.Now().UTC()
+	return changed, nil
+}
+
+// set parses value as field's type into the invoice. An empty value clears
+// the field.
+func (i *SupplierInvoice) set(field, value string) error {
+	switch field {
+	case SupplierFieldSupplierName:
+		i.SupplierName = value
+		i.SupplierKey = SupplierKey(value)
+	case SupplierFieldInvoiceNumber:
+		i.InvoiceNumber = value
+	case SupplierFieldCurrency:
+		if value != "" && len(value) != 3 {
+			return ErrInvalidSupplierInvoiceField
+		}
+		i.Currency = strings.ToUpper(value)
+	case SupplierFieldIssueDate, SupplierFieldDueDate:
+		var date *time.Time
+		if value != "" {
+			parsed, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return ErrInvalidSupplierInvoiceField
+			}
+			date = &parsed
+		}
+		if field == SupplierFieldIssueDate {
+			i.IssueDate = date
+		} else {
+			i.DueDate = date
+		}
+	case SupplierFieldSubtotal, SupplierFieldTaxAmount, SupplierFieldTotal:
+		amount := decimal.Zero
+		if value != "" {
+			parsed, err := decimal.NewFromString(value)
+			if err != nil {
+				return ErrInvalidSupplierInvoiceField
+			}
+			amount = parsed
+		}
+		switch field {
+		case SupplierFieldSubtotal:
+			i.Subtotal = amount
+		case SupplierFieldTaxAmount:
+			i.TaxAmount = amount
+		default:
+			i.Total = amount
+		}
+	default:
+		return ErrInvalidSupplierInvoiceField
+	}
+	return nil
+}
+
+// Check lists what a reviewer should look at in Warnings: missing fields,
+// totals that do not add up, and duplicates.
+func (i *SupplierInvoice) Check() {
+	i.Warnings = nil
+	if i.DuplicateOf != nil {
+		i.Warnings = append(i.Warnings, "the supplier has another invoice with this number")
+	}
+	if i.SupplierName == "" {
+		i.Warnings = append(i.Warnings, "supplier name not found")
+	}
+	if i.InvoiceNumber == "" {
+		i.Warnings = append(i.Warnings, "invoice number not found")
+	}
+	if i.IssueDate == nil {
+		i.Warnings = append(i.Warnings, "issue date not found")
+	}
+	if !i.Total.IsPositive() {
+		i.Warnings = append(i.Warnings, "total not found")
+	}
+	if i.Subtotal.IsPositive() && i.Total.IsPositive() && !i.Subtotal.Add(i.TaxAmount).Equal(i.Total) {
+		i.Warnings = append(i.Warnings, "subtotal and tax do not add up to the total")
+	}
+	if len(i.Lines) > 0 {
+		sum := decimal.Zero
+		for _, line := range i.Lines {
+			sum = sum.Add(line.Amount)
+		}
+		expected := i.Subtotal
+		if expected.IsZero() {
+			expected = i.Total
+		}
+		if !sum.Equal(expected) {
+			i.Warnings = append(i.Warnings, "line items do not add up to the subtotal")
+		}
+	}
+	if i.DueDate != nil && i.IssueDate != nil && i.DueDate.Before(*i.IssueDate) {
+		i.Warnings = append(i.Warnings, "due date is before the issue date")
+	}
+}
+
+// Approve accepts the invoice for payment. The supplier, number, issue date
+// and a positive total are needed.
+func (i *SupplierInvoice) Approve(by uuid.UUID) error {
+	if i.Status != SupplierInvoiceDraft {
+		return ErrSupplierInvoiceReviewed
+	}
+	if i.SupplierName == "" || i.InvoiceNumber == "" || i.IssueDate == nil || !i.Total.IsPositive() {
+		return ErrSupplierInvoiceIncomplete
+	}
+	i.review(SupplierInvoiceApproved, by)
+	return nil
+}
+
+// Reject sets the invoice aside as not to be paid.
+func (i *SupplierInvoice) Reject(reason string, by uuid.UUID) error {
+	if i.Status != SupplierInvoiceDraft {
+		return ErrSupplierInvoiceReviewed
+	}
+	i.RejectReason = strings.TrimSpace(reason)
+	i.review(SupplierInvoiceRejected, by)
+	return nil
+}
+
+func (i *SupplierInvoice) review(status SupplierInvoiceStatus, by uuid.UUID) {
+	now := time.Now().UTC()
+	i.Status = status
+	i.ReviewedBy = &by
+	i.ReviewedAt = &now
+	i.UpdatedAt = now
+}
+
+func isSupplierInvoiceField(name string) bool {
+	for _, field := range SupplierInvoiceFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SupplierTemplate is what extraction has learnt of one supplier's invoices
+// for a tenant: the label each field follows on the page, and the layout of
+// its dates. Templates are taught by the corrections of reviewers.
+type SupplierTemplate struct {
+	ID           uuid.UUID  `json:"id" bson:"_id"`
+	TenantID     uuid.UUID  `json:"tenantId" bson:"tenantId"`
+	SupplierKey  string     `json:"supplierKey" bson:"supplierKey"`
+	SupplierName string     `json:"supplierName" bson:"supplierName"`
+	SupplierID   *uuid.UUID `json:"supplierId,omitempty" bson:"supplierId,omitempty"`
+	// Labels maps a field to the text that precedes its value.
+	Labels      map[string]string `json:"labels" bson:"labels"`
+	DateLayout  string            `json:"dateLayout,omitempty" bson:"dateLayout,omitempty"`
+	Currency    string            `json:"currency,omitempty" bson:"currency,omitempty"`
+	Corrections int               `json:"corrections" bson:"corrections"`
+	UpdatedAt   time.Time         `json:"updatedAt" bson:"updatedAt"`
+}
+
+// NewSupplierTemplate returns an empty template for supplierName.
+func NewSupplierTemplate(tenantID uuid.UUID, supplierName string) *SupplierTemplate {
+	return &SupplierTemplate{
+		ID:           uuid.New(),
+		TenantID:     tenantID,
+		SupplierKey:  SupplierKey(supplierName),
+		SupplierName: strings.TrimSpace(supplierName),
+		Labels:       map[string]string{},
+		UpdatedAt:    time.Now().UTC(),
+	}
+}
+
+// Corrected records that a reviewer's correction taught the template.
+func (t *SupplierTemplate) Corrected() {
+	t.Corrections++
+	t.UpdatedAt = time.Now().UTC()
+}
+
+// SupplierKey is the form supplier names are matched in: lower-case
+// letters and digits, without the legal form, so "ACME Ltd." and "Acme
+// Ltd" are the same supplier.
+func SupplierKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if n := len(words); n > 1 && legalForms[words[n-1]] {
+		words = words[:n-1]
+	}
+	return strings.Join(words, "")
+}
+
+var legalForms = map[string]bool{
+	"ltd": true, "limited": true, "inc": true, "llc": true, "plc": true, "gmbh": true,
+	"ag": true, "sa": true, "sarl": true, "bv": true, "nv": true, "srl": true, "spa": true,
+	"oy": true, "ab": true, "as": true, "ooo": true, "eood": true, "ood": true, "co": true,
+}
+
+var (
+	ErrSupplierInvoiceNotFound     = &DocumentError{Code: "SUPPLIER_INVOICE_NOT_FOUND", Message: "supplier invoice not found"}
+	ErrSupplierInvoiceReviewed     = &DocumentError{Code: "SUPPLIER_INVOICE_REVIEWED", Message: "supplier invoice has already been approved or rejected"}
+	ErrSupplierInvoiceIncomplete   = &DocumentError{Code: "SUPPLIER_INVOICE_INCOMPLETE", Message: "supplier, invoice number, issue date and total are needed to approve"}
+	ErrInvalidSupplierInvoiceField = &DocumentError{Code: "INVALID_SUPPLIER_INVOICE_FIELD", Message: "invalid supplier invoice field"}
+)
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSupplierInvoice(t *testing.T) {
+	invoice := NewSupplierInvoice(uuid.New(), uuid.New(), map[string]ExtractedField{
+		SupplierFieldSupplierName: {Value: "Globex GmbH", Confidence: 0.6, Source: FieldSourceHeuristic},
+		SupplierFieldIssueDate:    {Value: "05/10/2026", Confidence: 0.6, Source: FieldSourceHeuristic},
+		SupplierFieldSubtotal:     {Value: "100.00", Confidence: 0.8, Source: FieldSourceHeuristic},
+		SupplierFieldTotal:        {Value: "119.00", Confidence: 0.8, Source: FieldSourceHeuristic},
+	}, nil)
+
+	assert.Equal(t, SupplierInvoiceDraft, invoice.Status)
+	assert.Equal(t, "globex", invoice.SupplierKey)
+	assert.Nil(t, invoice.IssueDate, "values not in their field's form are dropped")
+	assert.NotContains(t, invoice.Fields, SupplierFieldIssueDate)
+	assert.Equal(t, []string{
+		"invoice number not found",
+		"issue date not found",
+		"subtotal and tax do not add up to the total",
+	}, invoice.Warnings)
+	assert.ErrorIs(t, invoice.Approve(uuid.New()), ErrSupplierInvoiceIncomplete)
+}
+
+func TestSupplierInvoice_CorrectAndReview(t *testing.T) {
+	invoice := NewSupplierInvoice(uuid.New(), uuid.New(), map[string]ExtractedField{
+		SupplierFieldSupplierName:  {Value: "Globex GmbH", Confidence: 0.6, Source: FieldSourceHeuristic},
+		SupplierFieldInvoiceNumber: {Value: "GX-1", Confidence: 0.8, Source: FieldSourceHeuristic},
+		SupplierFieldTotal:         {Value: "119.00", Confidence: 0.8, Source: FieldSourceHeuristic},
+	}, nil)
+
+	_, err := invoice.Correct(map[string]string{"iban": "DE00"}, nil)
+	assert.ErrorIs(t, err, ErrInvalidSupplierInvoiceField)
+	_, err = invoice.Correct(map[string]string{SupplierFieldIssueDate: "5 Oct"}, nil)
+	assert.ErrorIs(t, err, ErrInvalidSupplierInvoiceField)
+
+	changed, err := invoice.Correct(map[string]string{
+		SupplierFieldInvoiceNumber: "GX-1",
+		SupplierFieldIssueDate:     "2026-10-05",
+		SupplierFieldSubtotal:      "100.00",
+		SupplierFieldTaxAmount:     "19.00",
+	}, []SupplierInvoiceLine{{
+		Description: "Consulting",
+		Quantity:    decimal.NewFromInt(1),
+		UnitPrice:   decimal.NewFromInt(100),
+		Amount:      decimal.NewFromInt(100),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{SupplierFieldIssueDate, SupplierFieldSubtotal, SupplierFieldTaxAmount}, changed,
+		"confirming a value read right is not a change")
+	assert.Equal(t, FieldSourceCorrected, invoice.Fields[SupplierFieldInvoiceNumber].Source)
+	assert.Empty(t, invoice.Warnings)
+
+	by := uuid.New()
+	require.NoError(t, invoice.Approve(by))
+	assert.Equal(t, SupplierInvoiceApproved, invoice.Status)
+	assert.Equal(t, &by, invoice.ReviewedBy)
+	assert.ErrorIs(t, invoice.Reject("duplicate", by), ErrSupplierInvoiceReviewed)
+	_, err = invoice.Correct(map[string]string{SupplierFieldTotal: "1"}, nil)
+	assert.ErrorIs(t, err, ErrSupplierInvoiceReviewed)
+}
+
+func TestSupplierKey(t *testing.T) {
+	assert.Equal(t, "acmesupplies", SupplierKey("ACME Supplies Ltd."))
+	assert.Equal(t, "acmesupplies", SupplierKey("Acme Supplies limited"))
+	assert.Equal(t, "globex", SupplierKey("Globex GmbH"))
+	assert.Equal(t, "ltd", SupplierKey("Ltd"), "a name is not only its legal form")
+}
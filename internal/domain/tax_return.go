@@ -0,0 +1,262 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// TaxPeriodicity is how long the periods a tenant files VAT returns for
+// are.
+type TaxPeriodicity string
+
+const (
+	TaxMonthly   TaxPeriodicity = "monthly"
+	TaxQuarterly TaxPeriodicity = "quarterly"
+)
+
+func (p TaxPeriodicity) IsValid() bool {
+	return p == TaxMonthly || p == TaxQuarterly
+}
+
+// TaxPeriodBounds returns the bounds in loc of period: a month formatted
+// 2006-01 for monthly returns, or a quarter formatted 2006-Q1 for
+// quarterly ones.
+func TaxPeriodBounds(period string, periodicity TaxPeriodicity, loc *time.Location) (from, to time.Time, err error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	switch periodicity {
+	case TaxMonthly:
+		from, err = time.ParseInLocation("2006-01", period, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrInvalidMonthlyTaxPeriod
+		}
+		return from, from.AddDate(0, 1, 0), nil
+	case TaxQuarterly:
+		year, quarter, ok := strings.Cut(period, "-Q")
+		start, err := time.ParseInLocation("2006", year, loc)
+		if !ok || err != nil || len(quarter) != 1 || quarter[0] < '1' || quarter[0] > '4' {
+			return time.Time{}, time.Time{}, ErrInvalidQuarterlyTaxPeriod
+		}
+		from = start.AddDate(0, 3*int(quarter[0]-'1'), 0)
+		return from, from.AddDate(0, 3, 0), nil
+	default:
+		return time.Time{}, time.Time{}, ErrInvalidTaxPeriodicity
+	}
+}
+
+// TaxPeriodOf returns the period at falls in, formatted as TaxPeriodBounds
+// takes it.
+func TaxPeriodOf(at time.Time, periodicity TaxPeriodicity) string {
+	if periodicity == TaxQuarterly {
+		return fmt.Sprintf("%d-Q%d", at.Year(), (int(at.Month())-1)/3+1)
+	}
+	return at.Format("2006-01")
+}
+
+// TaxReturn adds up the output VAT of a tenant's invoices and credit notes
+// issued in one period, by tax code and rate. A return is built from the
+// invoices whenever it is asked for until it is filed; the filed return is
+// kept as filed, and locks its period against invoices being issued or
+// voided in it.
+type TaxReturn struct {
+	ID          uuid.UUID         `json:"id" bson:"_id"`
+	TenantID    uuid.UUID         `json:"tenantId" bson:"tenantId"`
+	Period      string            `json:"period" bson:"period"`
+	Periodicity TaxPeriodicity    `json:"periodicity" bson:"periodicity"`
+	Country     string            `json:"country" bson:"country"`
+	VATNumber   string            `json:"vatNumber,omitempty" bson:"vatNumber,omitempty"`
+	Currency    string            `json:"currency,omitempty" bson:"currency,omitempty"`
+	From        time.Time         `json:"from" bson:"from"`
+	To          time.Time         `json:"to" bson:"to"`
+	Lines       []TaxReturnLine   `json:"lines" bson:"lines"`
+	Totals      []TaxReturnTotal  `json:"totals" bson:"totals"`
+	Invoices    int               `json:"invoices" bson:"invoices"`
+	CreditNotes int               `json:"creditNotes" bson:"creditNotes"`
+	Issues      []TaxReturnIssue  `json:"issues" bson:"issues"`
+	Reference   string            `json:"reference,omitempty" bson:"reference,omitempty"`
+	FiledBy     *uuid.UUID        `json:"filedBy,omitempty" bson:"filedBy,omitempty"`
+	FiledAt     *time.Time        `json:"filedAt,omitempty" bson:"filedAt,omitempty"`
+	Version     int64             `json:"version" bson:"version"`
+	codes       map[string]string `json:"-" bson:"-"`
+}
+
+// TaxReturnLine is the output VAT of the invoice lines of one tax code,
+// rate and currency. Credit notes count negatively. Invoices and
+// CreditNotes count the documents with lines in it.
+type TaxReturnLine struct {
+	TaxCode     string          `json:"taxCode" bson:"taxCode"`
+	TaxRate     decimal.Decimal `json:"taxRate" bson:"taxRate"`
+	Currency    string          `json:"currency" bson:"currency"`
+	NetAmount   decimal.Decimal `json:"netAmount" bson:"netAmount"`
+	TaxAmount   decimal.Decimal `json:"taxAmount" bson:"taxAmount"`
+	Invoices    int             `json:"invoices" bson:"invoices"`
+	CreditNotes int             `json:"creditNotes" bson:"creditNotes"`
+}
+
+// TaxReturnTotal adds up the lines of one currency.
+type TaxReturnTotal struct {
+	Currency  string          `json:"currency" bson:"currency"`
+	NetAmount decimal.Decimal `json:"netAmount" bson:"netAmount"`
+	TaxAmount decimal.Decimal `json:"taxAmount" bson:"taxAmount"`
+}
+
+// TaxReturnIssue is an invoice issued in the period that had to be left
+// out of the return.
+type TaxReturnIssue struct {
+	InvoiceID     uuid.UUID `json:"invoiceId" bson:"invoiceId"`
+	InvoiceNumber string    `json:"invoiceNumber" bson:"invoiceNumber"`
+	Problem       string    `json:"problem" bson:"problem"`
+}
+
+// NewTaxReturn starts the return of period, [from, to), for a tenant
+// registered for VAT in country. codes names the tax code of each rate, as
+// a decimal string such as "20", for lines that name none. A currency
+// keeps invoices in others out of the return; without one, each currency
+// is totalled apart.
+func NewTaxReturn(tenantID uuid.UUID, period string, periodicity TaxPeriodicity, from, to time.Time, country, vatNumber, currency string, codes map[string]string) *TaxReturn {
+	return &TaxReturn{
+		ID:          uuid.New(),
+		TenantID:    tenantID,
+		Period:      period,
+		Periodicity: periodicity,
+		Country:     country,
+		VATNumber:   vatNumber,
+		Currency:    currency,
+		From:        from,
+		To:          to,
+		Lines:       []TaxReturnLine{},
+		Totals:      []TaxReturnTotal{},
+		Issues:      []TaxReturnIssue{},
+		codes:       codes,
+	}
+}
+
+// AddInvoice adds the lines of an invoice or credit note issued in the
+// period. Drafts and voided invoices have no VAT to declare.
+func (r *TaxReturn) AddInvoice(invoice *Invoice) {
+	switch invoice.Status {
+	case InvoiceStatusDraft, InvoiceStatusCancelled:
+		return
+	}
+	if invoice.IssueDate.Before(r.From) || !invoice.IssueDate.Before(r.To) {
+		return
+	}
+	if r.Currency != "" && invoice.Currency != r.Currency {
+		r.Issues = append(r.Issues, TaxReturnIssue{
+			InvoiceID:     invoice.ID,
+			InvoiceNumber: invoice.InvoiceNumber,
+			Problem:       fmt.Sprintf("invoice is in %s, the return in %s", invoice.Currency, r.Currency),
+		})
+		return
+	}
+
+	credit := invoice.Type == InvoiceTypeCreditNote
+	if credit {
+		r.CreditNotes++
+	} else {
+		r.Invoices++
+	}
+	counted := make(map[int]bool)
+	for _, line := range invoice.Lines {
+		code := line.TaxCode
+		if code == "" {
+			code = r.codes[line.TaxRate.String()]
+		}
+		net, tax := line.Total, line.TaxAmount
+		if credit {
+			net, tax = net.Neg(), tax.Neg()
+		}
+
+		i := r.line(code, line.TaxRate, invoice.Currency)
+		r.Lines[i].NetAmount = r.Lines[i].NetAmount.Add(net)
+		r.Lines[i].TaxAmount = r.Lines[i].TaxAmount.Add(tax)
+		if counted[i] {
+			continue
+		}
+		counted[i] = true
+		if credit {
+			r.Lines[i].CreditNotes++
+		} else {
+			r.Lines[i].Invoices++
+		}
+	}
+}
+
+// line returns the index of the line of code, rate and currency, adding it
+// if there is none yet.
+func (r *TaxReturn) line(code string, rate decimal.Decimal, currency string) int {
+	for i, line := range r.Lines {
+		if line.TaxCode == code && line.TaxRate.Equal(rate) && line.Currency == currency {
+			return i
+		}
+	}
+	r.Lines = append(r.Lines, TaxReturnLine{TaxCode: code, TaxRate: rate, Currency: currency})
+	return len(r.Lines) - 1
+}
+
+// Total sorts the lines, by currency, then highest rate and code, and
+// totals them per currency. It is called once the invoices are added.
+func (r *TaxReturn) Total() {
+	sort.Slice(r.Lines, func(i, j int) bool {
+		a, b := r.Lines[i], r.Lines[j]
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		if !a.TaxRate.Equal(b.TaxRate) {
+			return a.TaxRate.GreaterThan(b.TaxRate)
+		}
+		return a.TaxCode < b.TaxCode
+	})
+	r.Totals = []TaxReturnTotal{}
+	for _, line := range r.Lines {
+		if n := len(r.Totals); n == 0 || r.Totals[n-1].Currency != line.Currency {
+			r.Totals = append(r.Totals, TaxReturnTotal{Currency: line.Currency})
+		}
+		total := &r.Totals[len(r.Totals)-1]
+		total.NetAmount = money.Round(total.NetAmount.Add(line.NetAmount), line.Currency)
+		total.TaxAmount = money.Round(total.TaxAmount.Add(line.TaxAmount), line.Currency)
+	}
+}
+
+// TotalIn returns the total of the lines in currency, zero when there are
+// none.
+func (r *TaxReturn) TotalIn(currency string) TaxReturnTotal {
+	for _, total := range r.Totals {
+		if total.Currency == currency {
+			return total
+		}
+	}
+	return TaxReturnTotal{Currency: currency, NetAmount: decimal.Zero, TaxAmount: decimal.Zero}
+}
+
+// IsFiled reports whether the return was filed.
+func (r *TaxReturn) IsFiled() bool {
+	return r.FiledAt != nil
+}
+
+// File records the return as filed by filedBy, with the reference the tax
+// authority acknowledged it with, if any. Invoices left out as issues stay
+// out.
+func (r *TaxReturn) File(reference string, filedBy uuid.UUID, at time.Time) error {
+	if r.IsFiled() {
+		return ErrTaxReturnFiled
+	}
+	r.Reference = strings.TrimSpace(reference)
+	r.FiledBy = &filedBy
+	r.FiledAt = &at
+	return nil
+}
+
+var (
+	ErrInvalidTaxPeriodicity     = &PaymentError{Code: "INVALID_TAX_PERIODICITY", Message: "VAT returns are monthly or quarterly"}
+	ErrInvalidMonthlyTaxPeriod   = &PaymentError{Code: "INVALID_TAX_PERIOD", Message: "VAT periods are months formatted YYYY-MM"}
+	ErrInvalidQuarterlyTaxPeriod = &PaymentError{Code: "INVALID_TAX_PERIOD", Message: "VAT periods are quarters formatted YYYY-Q1 to YYYY-Q4"}
+	ErrTaxReturnFiled            = &PaymentError{Code: "TAX_RETURN_FILED", Message: "VAT return was already filed"}
+)
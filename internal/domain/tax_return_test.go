@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaxPeriodBounds(t *testing.T) {
+	from, to, err := TaxPeriodBounds("2026-Q3", TaxQuarterly, time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), to)
+	assert.Equal(t, "2026-Q3", TaxPeriodOf(from, TaxQuarterly))
+
+	from, to, err = TaxPeriodBounds("2026-12", TaxMonthly, time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), to)
+	assert.Equal(t, "2026-12", TaxPeriodOf(from, TaxMonthly))
+
+	for _, period := range []string{"2026-Q5", "2026-Q", "2026-09", "Q3"} {
+		_, _, err := TaxPeriodBounds(period, TaxQuarterly, time.UTC)
+		assert.ErrorIs(t, err, ErrInvalidQuarterlyTaxPeriod, period)
+	}
+	_, _, err = TaxPeriodBounds("2026-Q3", TaxMonthly, time.UTC)
+	assert.ErrorIs(t, err, ErrInvalidMonthlyTaxPeriod)
+}
+
+func TestTaxReturn(t *testing.T) {
+	issued := time.Date(2026, 8, 14, 10, 0, 0, 0, time.UTC)
+	invoice := func(invoiceType InvoiceType, status InvoiceStatus, currency string, lines ...InvoiceLine) *Invoice {
+		invoice := &Invoice{
+			ID:            uuid.New(),
+			InvoiceNumber: "INV-1",
+			Type:          invoiceType,
+			Status:        status,
+			Currency:      currency,
+			IssueDate:     issued,
+		}
+		for _, line := range lines {
+			invoice.AddLine(line)
+		}
+		return invoice
+	}
+	line := func(price, rate, code string) InvoiceLine {
+		return InvoiceLine{
+			Quantity:  decimal.NewFromInt(1),
+			UnitPrice: decimal.RequireFromString(price),
+			TaxRate:   decimal.RequireFromString(rate),
+			TaxCode:   code,
+		}
+	}
+
+	from, to, err := TaxPeriodBounds("2026-Q3", TaxQuarterly, time.UTC)
+	require.NoError(t, err)
+	r := NewTaxReturn(uuid.New(), "2026-Q3", TaxQuarterly, from, to, "GB", "GB123456789", "GBP",
+		map[string]string{"20": "S", "0": "Z"})
+
+	r.AddInvoice(invoice(InvoiceTypeStandard, InvoiceStatusPaid, "GBP",
+		line("100", "20.00", ""), line("50", "20", ""), line("30", "0", ""), line("10", "0", "E")))
+	r.AddInvoice(invoice(InvoiceTypeStandard, InvoiceStatusSent, "GBP", line("200", "5", "")))
+	r.AddInvoice(invoice(InvoiceTypeCreditNote, InvoiceStatusPending, "GBP", line("40", "20", "")))
+	r.AddInvoice(invoice(InvoiceTypeStandard, InvoiceStatusDraft, "GBP", line("999", "20", "")))
+	r.AddInvoice(invoice(InvoiceTypeStandard, InvoiceStatusCancelled, "GBP", line("999", "20", "")))
+	r.AddInvoice(invoice(InvoiceTypeStandard, InvoiceStatusSent, "EUR", line("999", "20", "")))
+	late := invoice(InvoiceTypeStandard, InvoiceStatusSent, "GBP", line("999", "20", ""))
+	late.IssueDate = to
+	r.AddInvoice(late)
+	r.Total()
+
+	assert.Equal(t, 2, r.Invoices)
+	assert.Equal(t, 1, r.CreditNotes)
+	require.Len(t, r.Issues, 1, "invoices in other currencies are left out")
+
+	require.Len(t, r.Lines, 4)
+	standard := r.Lines[0]
+	assert.Equal(t, "S", standard.TaxCode)
+	assert.Equal(t, "110", standard.NetAmount.String())
+	assert.Equal(t, "22", standard.TaxAmount.String())
+	assert.Equal(t, 1, standard.Invoices, "an invoice is counted once per line")
+	assert.Equal(t, 1, standard.CreditNotes)
+	assert.Equal(t, "", r.Lines[1].TaxCode, "rates without a code keep none")
+	assert.Equal(t, "10", r.Lines[1].TaxAmount.String())
+	assert.Equal(t, "E", r.Lines[2].TaxCode)
+	assert.Equal(t, "Z", r.Lines[3].TaxCode)
+
+	total := r.TotalIn("GBP")
+	assert.Equal(t, "350", total.NetAmount.String())
+	assert.Equal(t, "32", total.TaxAmount.String())
+	assert.True(t, r.TotalIn("EUR").TaxAmount.IsZero())
+
+	userID := uuid.New()
+	require.NoError(t, r.File(" ACK-1 ", userID, issued))
+	assert.True(t, r.IsFiled())
+	assert.Equal(t, "ACK-1", r.Reference)
+	assert.ErrorIs(t, r.File("", userID, issued), ErrTaxReturnFiled)
+}
@@ -37,6 +37,8 @@ type User struct {
 	Status        UserStatus
 	TenantRole    string
 	Permissions   []string
+	DataScope     string
+	Territories   []string
 	MFAEnabled    bool
 	MFASecret     string
 	LastLoginAt   *time.Time
@@ -64,6 +66,7 @@ func NewUser(tenantID uuid.UUID, email, password, firstName, lastName string) (*
 		Status:        UserStatusActive,
 		TenantRole:    "user",
 		Permissions:   []string{},
+		DataScope:     DataScopeTenant,
 		MFAEnabled:    false,
 		LoginAttempts: 0,
 		CreatedAt:     now,
@@ -3,6 +3,7 @@ package domain
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
@@ -134,6 +135,29 @@ func TestWarehouseOperationWorkflow(t *testing.T) {
 	assert.NotNil(t, operation.CompletedAt)
 }
 
+func TestWarehouseOperationScanItem(t *testing.T) {
+	operation, _ := NewWarehouseOperation(uuid.New(), uuid.New(), uuid.New(), OperationTypePick, "order", uuid.New())
+	operatorID := uuid.New()
+	operation.AssignTo(operatorID)
+	assert.NotNil(t, operation.AssignedAt)
+
+	itemID := uuid.New()
+	operation.AddItem(OperationItem{ID: itemID, ProductID: uuid.New(), Quantity: 3, Status: "pending"})
+
+	scannedAt := time.Date(2026, 3, 2, 9, 15, 0, 0, time.UTC)
+	assert.NoError(t, operation.ScanItem(itemID, operatorID, 2, scannedAt))
+	assert.NoError(t, operation.ScanItem(itemID, operatorID, 1, time.Time{}))
+
+	item := operation.Items[0]
+	assert.Equal(t, "completed", item.Status)
+	assert.Len(t, item.Scans, 2)
+	assert.Equal(t, scannedAt, item.Scans[0].ScannedAt)
+	assert.Equal(t, operatorID, item.Scans[0].OperatorID)
+	assert.False(t, item.Scans[1].ScannedAt.IsZero(), "a scan without a time is taken now")
+
+	assert.Equal(t, ErrOperationItemNotFound, operation.ScanItem(uuid.New(), operatorID, 1, scannedAt))
+}
+
 func TestWarehouseOperationCancel(t *testing.T) {
 	operation, _ := NewWarehouseOperation(uuid.New(), uuid.New(), uuid.New(), OperationTypeReceipt, "po", uuid.New())
 
@@ -448,3 +472,96 @@ func TestInventoryErrorIs(t *testing.T) {
 	assert.True(t, errors.Is(err1, target))
 	assert.True(t, errors.Is(err1, err2))
 }
+
+func TestAllocateAmount(t *testing.T) {
+	shares := AllocateAmount(decimal.NewFromInt(100), []decimal.Decimal{
+		decimal.NewFromInt(1), decimal.NewFromInt(1), decimal.Zero, decimal.NewFromInt(1),
+	}, "USD")
+
+	assert.Equal(t, "33.33", shares[1].String())
+	assert.True(t, shares[2].IsZero(), "lines without a basis take no share")
+	assert.Equal(t, "33.33", shares[3].String())
+	assert.Equal(t, "33.34", shares[0].String(), "the rounding difference goes to the largest share")
+
+	yen := AllocateAmount(decimal.NewFromInt(1000), []decimal.Decimal{decimal.NewFromInt(1), decimal.NewFromInt(2)}, "JPY")
+	assert.Equal(t, "333", yen[0].String())
+	assert.Equal(t, "667", yen[1].String())
+
+	assert.Nil(t, AllocateAmount(decimal.NewFromInt(10), []decimal.Decimal{decimal.Zero}, "USD"))
+}
+
+func TestWarehouseOperationAddLandedCost(t *testing.T) {
+	receipt, _ := NewWarehouseOperation(uuid.New(), uuid.New(), uuid.New(), OperationTypeReceipt, "po", uuid.New())
+	receipt.AddItem(OperationItem{ID: uuid.New(), ProductID: uuid.New(), Quantity: 10, QuantityDone: 10,
+		UnitCost: decimal.NewFromInt(30), Weight: decimal.NewFromInt(1)})
+	receipt.AddItem(OperationItem{ID: uuid.New(), ProductID: uuid.New(), Quantity: 10, QuantityDone: 10,
+		UnitCost: decimal.NewFromInt(10), Weight: decimal.NewFromInt(3)})
+	receipt.AddItem(OperationItem{ID: uuid.New(), ProductID: uuid.New(), Quantity: 5,
+		UnitCost: decimal.NewFromInt(50), Weight: decimal.NewFromInt(1)})
+
+	byValue, err := receipt.AddLandedCost(LandedCost{Type: LandedCostDuty, Amount: decimal.NewFromInt(40), Currency: "USD", Method: AllocateByValue})
+	assert.NoError(t, err)
+	assert.Len(t, byValue, 2, "lines not yet received take no share")
+	assert.Equal(t, "30", byValue[0].Amount.String())
+	assert.Equal(t, "10", byValue[1].Amount.String())
+
+	byWeight, err := receipt.AddLandedCost(LandedCost{Type: LandedCostFreight, Amount: decimal.NewFromInt(20), Currency: "USD", Method: AllocateByWeight})
+	assert.NoError(t, err)
+	assert.Equal(t, "5", byWeight[0].Amount.String())
+	assert.Equal(t, "15", byWeight[1].Amount.String())
+
+	assert.Len(t, receipt.LandedCosts, 2)
+	assert.Equal(t, "35", receipt.Items[0].LandedCost.String())
+	assert.Equal(t, "33.5", receipt.Items[0].LandedUnitCost().String())
+	assert.Equal(t, "12.5", receipt.Items[1].LandedUnitCost().String())
+
+	_, err = receipt.AddLandedCost(LandedCost{Type: "storage", Amount: decimal.NewFromInt(1), Method: AllocateByValue})
+	assert.Equal(t, ErrInvalidLandedCostType, err)
+	_, err = receipt.AddLandedCost(LandedCost{Type: LandedCostInsurance, Amount: decimal.Zero, Method: AllocateByValue})
+	assert.Equal(t, ErrInvalidLandedCostAmount, err)
+
+	pick, _ := NewWarehouseOperation(uuid.New(), uuid.New(), uuid.New(), OperationTypePick, "order", uuid.New())
+	_, err = pick.AddLandedCost(LandedCost{Type: LandedCostFreight, Amount: decimal.NewFromInt(1), Method: AllocateByQuantity})
+	assert.Equal(t, ErrLandedCostReceiptOnly, err)
+
+	empty, _ := NewWarehouseOperation(uuid.New(), uuid.New(), uuid.New(), OperationTypeReceipt, "po", uuid.New())
+	_, err = empty.AddLandedCost(LandedCost{Type: LandedCostFreight, Amount: decimal.NewFromInt(1), Method: AllocateByQuantity})
+	assert.Equal(t, ErrNoLandedCostBasis, err)
+}
+
+func TestInventoryItemAddLandedCost(t *testing.T) {
+	item := NewInventoryItem(uuid.New(), uuid.New(), uuid.New(), "SKU-1", 0, decimal.Zero)
+	item.Receive(20, decimal.NewFromInt(10))
+
+	assert.True(t, item.AddLandedCost(decimal.NewFromInt(50)))
+	assert.Equal(t, "250", item.TotalValue.String())
+	assert.Equal(t, "12.5", item.UnitCost.String())
+
+	empty := NewInventoryItem(uuid.New(), uuid.New(), uuid.New(), "SKU-2", 0, decimal.NewFromInt(10))
+	assert.False(t, empty.AddLandedCost(decimal.NewFromInt(50)))
+	assert.Equal(t, "10", empty.UnitCost.String())
+}
+
+func TestExpectedUnitCost(t *testing.T) {
+	now := time.Now()
+	newer := NewInventoryItem(uuid.New(), uuid.New(), uuid.New(), "SKU-1", 10, decimal.NewFromInt(14))
+	newer.CreatedAt = now
+	older := NewInventoryItem(uuid.New(), uuid.New(), uuid.New(), "SKU-1", 5, decimal.NewFromInt(10))
+	older.CreatedAt = now.Add(-time.Hour)
+	damaged := NewInventoryItem(uuid.New(), uuid.New(), uuid.New(), "SKU-1", 50, decimal.NewFromInt(1))
+	damaged.CreatedAt = now.Add(-2 * time.Hour)
+	damaged.Status = InventoryStatusDamaged
+	layers := []*InventoryItem{newer, older, damaged}
+
+	unitCost, covered := ExpectedUnitCost(layers, 10, decimal.NewFromInt(20))
+	assert.Equal(t, "12", unitCost.String(), "five units at 10 then five at 14")
+	assert.Equal(t, 10, covered)
+
+	unitCost, covered = ExpectedUnitCost(layers, 20, decimal.NewFromInt(20))
+	assert.Equal(t, "14.5", unitCost.String(), "units beyond the stock cost the fallback")
+	assert.Equal(t, 15, covered)
+
+	unitCost, covered = ExpectedUnitCost(nil, 3, decimal.NewFromInt(20))
+	assert.Equal(t, "20", unitCost.String())
+	assert.Equal(t, 0, covered)
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebDAVKeyPrefix starts every WebDAV key, so the WebDAV endpoint can tell
+// keys from access tokens given as a password.
+const WebDAVKeyPrefix = "dav_"
+
+// WebDAVKey is a long-lived credential a user mounts the tenant's documents
+// with from their operating system, given as the password of HTTP Basic
+// authentication. It carries the document permissions its user held when
+// it was created, and only the hash of the key is stored.
+type WebDAVKey struct {
+	ID          uuid.UUID  `json:"id" bson:"_id"`
+	TenantID    uuid.UUID  `json:"tenantId" bson:"tenantId"`
+	UserID      string     `json:"userId" bson:"userId"`
+	Name        string     `json:"name" bson:"name"`
+	Hint        string     `json:"hint" bson:"hint"`
+	KeyHash     string     `json:"-" bson:"keyHash"`
+	Permissions []string   `json:"permissions" bson:"permissions"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// NewWebDAVKey returns a key for the user with permissions, and the secret
+// to hand out once: it cannot be read back.
+func NewWebDAVKey(tenantID uuid.UUID, userID, name string, permissions []string) (*WebDAVKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(permissions) == 0 {
+		return nil, "", ErrInvalidWebDAVKey
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := WebDAVKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return &WebDAVKey{
+		ID:          uuid.New(),
+		TenantID:    tenantID,
+		UserID:      userID,
+		Name:        name,
+		Hint:        secret[len(secret)-4:],
+		KeyHash:     HashWebDAVKey(secret),
+		Permissions: permissions,
+		CreatedAt:   time.Now(),
+	}, secret, nil
+}
+
+// HashWebDAVKey returns the hash a key is stored and looked up by.
+func HashWebDAVKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	ErrWebDAVKeyNotFound = &DocumentError{Code: "WEBDAV_KEY_NOT_FOUND", Message: "WebDAV key not found"}
+	ErrInvalidWebDAVKey  = &DocumentError{Code: "INVALID_WEBDAV_KEY", Message: "a WebDAV key needs a name and at least one document permission"}
+)
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+var ErrInvalidWebhookSubscription = errors.New("invalid webhook subscription")
+
+// WebhookSubscription sends a tenant's events to an external URL. EventTypes
+// holds exact event types ("invoice.paid"), prefixes ending in ".*"
+// ("invoice.*") or "*" for every event.
+type WebhookSubscription struct {
+	ID          string    `json:"id" bson:"_id"`
+	TenantID    string    `json:"tenantId" bson:"tenantId"`
+	URL         string    `json:"url" bson:"url"`
+	Secret      string    `json:"secret,omitempty" bson:"secret"`
+	EventTypes  []string  `json:"eventTypes" bson:"eventTypes"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty"`
+	Active      bool      `json:"active" bson:"active"`
+	CreatedBy   string    `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+func (s *WebhookSubscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || !u.IsAbs() || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhookSubscription)
+	}
+	if len(s.EventTypes) == 0 {
+		return fmt.Errorf("%w: at least one event type is required", ErrInvalidWebhookSubscription)
+	}
+	for _, eventType := range s.EventTypes {
+		if strings.TrimSpace(eventType) == "" {
+			return fmt.Errorf("%w: event types must not be empty", ErrInvalidWebhookSubscription)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether eventType is covered by the subscription's filters.
+func (s *WebhookSubscription) Matches(eventType string) bool {
+	for _, filter := range s.EventTypes {
+		switch {
+		case filter == "*" || filter == eventType:
+			return true
+		case strings.HasSuffix(filter, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(filter, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookAttempt is one HTTP request made for a delivery.
+type WebhookAttempt struct {
+	At         time.Time `json:"at" bson:"at"`
+	StatusCode int       `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMs int64     `json:"durationMs" bson:"durationMs"`
+}
+
+// WebhookDelivery is a single event sent to a single subscription, together
+// with the log of attempts made so far. A redelivery is a new delivery that
+// points back at the one it repeats.
+type WebhookDelivery struct {
+	ID             string           `json:"id" bson:"_id"`
+	TenantID       string           `json:"tenantId" bson:"tenantId"`
+	SubscriptionID string           `json:"subscriptionId" bson:"subscriptionId"`
+	EventID        string           `json:"eventId" bson:"eventId"`
+	EventType      string           `json:"eventType" bson:"eventType"`
+	URL            string           `json:"url" bson:"url"`
+	Payload        string           `json:"payload" bson:"payload"`
+	Status         string           `json:"status" bson:"status"`
+	Attempts       int              `json:"attempts" bson:"attempts"`
+	MaxAttempts    int              `json:"maxAttempts" bson:"maxAttempts"`
+	NextAttemptAt  *time.Time       `json:"nextAttemptAt,omitempty" bson:"nextAttemptAt,omitempty"`
+	LastStatusCode int              `json:"lastStatusCode,omitempty" bson:"lastStatusCode,omitempty"`
+	LastError      string           `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	Log            []WebhookAttempt `json:"log" bson:"log"`
+	RedeliveryOf   string           `json:"redeliveryOf,omitempty" bson:"redeliveryOf"`
+	CreatedAt      time.Time        `json:"createdAt" bson:"createdAt"`
+	DeliveredAt    *time.Time       `json:"deliveredAt,omitempty" bson:"deliveredAt,omitempty"`
+}
+
+// RecordAttempt appends attempt to the log and moves the delivery to its
+// next status. Failed attempts are retried at retryAt until MaxAttempts is
+// reached.
+func (d *WebhookDelivery) RecordAttempt(attempt WebhookAttempt, retryAt time.Time) {
+	d.Attempts++
+	d.Log = append(d.Log, attempt)
+	d.LastStatusCode = attempt.StatusCode
+	d.LastError = attempt.Error
+
+	switch {
+	case attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		at := attempt.At
+		d.Status = WebhookDeliveryDelivered
+		d.DeliveredAt = &at
+		d.NextAttemptAt = nil
+	case d.Attempts >= d.MaxAttempts:
+		d.Status = WebhookDeliveryFailed
+		d.NextAttemptAt = nil
+	default:
+		d.Status = WebhookDeliveryPending
+		d.NextAttemptAt = &retryAt
+	}
+}
+
+// WebhookBackoff is the delay before retry number attempt (starting at 1):
+// base doubled per attempt, capped at max.
+func WebhookBackoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// SignWebhook returns the X-Webhook-Signature header value for body sent at
+// ts: "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">".
+// Receivers recompute the HMAC with their secret and compare, and should
+// reject old timestamps to prevent replays.
+func SignWebhook(secret string, ts time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
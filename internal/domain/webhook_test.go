@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSubscription_Matches(t *testing.T) {
+	sub := WebhookSubscription{EventTypes: []string{"invoice.*", "payment.failed"}}
+
+	assert.True(t, sub.Matches("invoice.paid"))
+	assert.True(t, sub.Matches("invoice.payment_recorded"))
+	assert.True(t, sub.Matches("payment.failed"))
+	assert.False(t, sub.Matches("payment.processed"))
+	assert.False(t, sub.Matches("invoices.paid"))
+
+	all := WebhookSubscription{EventTypes: []string{"*"}}
+	assert.True(t, all.Matches("order.shipped"))
+}
+
+func TestWebhookSubscription_Validate(t *testing.T) {
+	valid := WebhookSubscription{URL: "https://example.com/hooks", EventTypes: []string{"invoice.paid"}}
+	require.NoError(t, valid.Validate())
+
+	for name, sub := range map[string]WebhookSubscription{
+		"relative url": {URL: "/hooks", EventTypes: []string{"invoice.paid"}},
+		"ftp url":      {URL: "ftp://example.com", EventTypes: []string{"invoice.paid"}},
+		"no events":    {URL: "https://example.com/hooks"},
+		"blank event":  {URL: "https://example.com/hooks", EventTypes: []string{" "}},
+	} {
+		err := sub.Validate()
+		assert.True(t, errors.Is(err, ErrInvalidWebhookSubscription), name)
+	}
+}
+
+func TestWebhookDelivery_RecordAttempt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	retryAt := now.Add(time.Minute)
+	d := WebhookDelivery{Status: WebhookDeliveryPending, MaxAttempts: 2}
+
+	d.RecordAttempt(WebhookAttempt{At: now, StatusCode: 500}, retryAt)
+	assert.Equal(t, WebhookDeliveryPending, d.Status)
+	assert.Equal(t, retryAt, *d.NextAttemptAt)
+	assert.Equal(t, 500, d.LastStatusCode)
+
+	d.RecordAttempt(WebhookAttempt{At: now, Error: "connection refused"}, retryAt)
+	assert.Equal(t, WebhookDeliveryFailed, d.Status)
+	assert.Nil(t, d.NextAttemptAt)
+	assert.Len(t, d.Log, 2)
+
+	ok := WebhookDelivery{Status: WebhookDeliveryPending, MaxAttempts: 2}
+	ok.RecordAttempt(WebhookAttempt{At: now, StatusCode: 204}, retryAt)
+	assert.Equal(t, WebhookDeliveryDelivered, ok.Status)
+	assert.Equal(t, now, *ok.DeliveredAt)
+	assert.Nil(t, ok.NextAttemptAt)
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, WebhookBackoff(1, 10*time.Second, time.Minute))
+	assert.Equal(t, 40*time.Second, WebhookBackoff(3, 10*time.Second, time.Minute))
+	assert.Equal(t, time.Minute, WebhookBackoff(4, 10*time.Second, time.Minute))
+	assert.Equal(t, time.Minute, WebhookBackoff(50, 10*time.Second, time.Minute))
+}
+
+func TestSignWebhook(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"invoice.paid"}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`1700000000.{"type":"invoice.paid"}`))
+
+	assert.Equal(t, "t=1700000000,v1="+hex.EncodeToString(mac.Sum(nil)), SignWebhook("secret", ts, body))
+}
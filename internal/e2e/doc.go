@@ -0,0 +1,14 @@
+// Package e2e runs business flows end to end against real infrastructure.
+// MongoDB, Redis, NATS JetStream and MinIO are started in containers with
+// testcontainers-go, so a Docker daemon is required.
+//
+// The client, invoice and payment services are started in-process with
+// their real HTTP handlers behind test servers, as their mains start them:
+// commands go through the HTTP APIs with access tokens, events travel
+// through JetStream and the projections consume them into the read models
+// the query APIs serve.
+//
+// The tests are behind the e2e build tag:
+//
+//	go test -tags=e2e ./internal/e2e/...
+package e2e
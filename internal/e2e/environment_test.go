@@ -0,0 +1,199 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/infrastructure/storage"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+const (
+	mongoImage = "mongo:7"
+	redisImage = "redis:7-alpine"
+	natsImage  = "nats:2.10-alpine"
+	minioImage = "minio/minio:RELEASE.2024-01-16T16-07-38Z"
+
+	minioUser     = "e2e-access"
+	minioPassword = "e2e-secret-key"
+
+	jwtSecret = "e2e-jwt-secret"
+)
+
+// environment is the infrastructure shared by all tests of the package,
+// and the services running on it. Tests isolate their data by tenant rather
+// than by database.
+type environment struct {
+	cfg   *config.Config
+	log   *logger.Logger
+	minio storage.MinIOConfig
+
+	services *services
+	closers  []func()
+}
+
+var env *environment
+
+func TestMain(m *testing.M) {
+	env = &environment{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	err := env.start(ctx)
+	if err == nil {
+		env.services, err = startServices(env)
+	}
+	cancel()
+	if err != nil {
+		env.close()
+		fmt.Fprintf(os.Stderr, "e2e: failed to start environment: %v\n", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	env.close()
+	os.Exit(code)
+}
+
+// onClose registers fn to run when the environment is torn down. They run
+// in reverse order.
+func (e *environment) onClose(fn func()) {
+	e.closers = append(e.closers, fn)
+}
+
+func (e *environment) close() {
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		e.closers[i]()
+	}
+}
+
+// start starts the containers and connects to them. Whatever was started is
+// torn down by close, also when start fails.
+func (e *environment) start(ctx context.Context) error {
+	start := func(image string, opts ...testcontainers.ContainerCustomizer) (*testcontainers.DockerContainer, error) {
+		ctr, err := testcontainers.Run(ctx, image, opts...)
+		if ctr != nil {
+			e.onClose(func() {
+				if err := testcontainers.TerminateContainer(ctr); err != nil {
+					fmt.Fprintf(os.Stderr, "e2e: failed to terminate %s: %v\n", image, err)
+				}
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("start %s: %w", image, err)
+		}
+		return ctr, nil
+	}
+
+	mongoC, err := start(mongoImage,
+		testcontainers.WithExposedPorts("27017/tcp"),
+		testcontainers.WithWaitStrategy(wait.ForListeningPort("27017/tcp")),
+	)
+	if err != nil {
+		return err
+	}
+	redisC, err := start(redisImage,
+		testcontainers.WithExposedPorts("6379/tcp"),
+		testcontainers.WithWaitStrategy(wait.ForListeningPort("6379/tcp")),
+	)
+	if err != nil {
+		return err
+	}
+	natsC, err := start(natsImage,
+		testcontainers.WithExposedPorts("4222/tcp"),
+		testcontainers.WithCmd("-js"),
+		testcontainers.WithWaitStrategy(wait.ForLog("Server is ready")),
+	)
+	if err != nil {
+		return err
+	}
+	minioC, err := start(minioImage,
+		testcontainers.WithExposedPorts("9000/tcp"),
+		testcontainers.WithCmd("server", "/data"),
+		testcontainers.WithEnv(map[string]string{
+			"MINIO_ROOT_USER":     minioUser,
+			"MINIO_ROOT_PASSWORD": minioPassword,
+		}),
+		testcontainers.WithWaitStrategy(wait.ForHTTP("/minio/health/live").WithPort("9000/tcp")),
+	)
+	if err != nil {
+		return err
+	}
+
+	mongoAddr, err := mongoC.PortEndpoint(ctx, "27017/tcp", "mongodb")
+	if err != nil {
+		return err
+	}
+	redisAddr, err := redisC.PortEndpoint(ctx, "6379/tcp", "")
+	if err != nil {
+		return err
+	}
+	natsAddr, err := natsC.PortEndpoint(ctx, "4222/tcp", "nats")
+	if err != nil {
+		return err
+	}
+	minioAddr, err := minioC.PortEndpoint(ctx, "9000/tcp", "")
+	if err != nil {
+		return err
+	}
+
+	// The services run with the defaults of a config without a file,
+	// pointed at the containers.
+	cfg, err := config.Load("", "e2e")
+	if err != nil {
+		return err
+	}
+	cfg.MongoDB = config.MongoDBConfig{
+		URI:             mongoAddr,
+		Database:        "erp_e2e",
+		MaxPoolSize:     20,
+		MinPoolSize:     1,
+		ConnectTimeout:  10 * time.Second,
+		ServerSelection: 5 * time.Second,
+	}
+	cfg.Redis = config.RedisConfig{
+		Mode:      "standalone",
+		Addresses: []string{redisAddr},
+		PoolSize:  10,
+	}
+	cfg.Messaging.Transport = "nats"
+	cfg.NATS.URLs = []string{natsAddr}
+	cfg.NATS.ConnectTimeout = 10 * time.Second
+	cfg.NATS.JetStream.Enabled = true
+	cfg.NATS.DeadLetter.MaxDeliver = 5
+	cfg.NATS.DeadLetter.AckWait = 5 * time.Second
+	cfg.NATS.DeadLetter.Backoff = []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, time.Second}
+	cfg.MinIO = config.MinIOConfig{
+		Endpoint:  minioAddr,
+		AccessKey: minioUser,
+		SecretKey: minioPassword,
+	}
+	cfg.Auth.JWT_SECRET = jwtSecret
+	cfg.Migrations.AutoMigrate = true
+
+	log, err := logger.New(logger.Config{
+		Level:       "error",
+		Format:      "json",
+		ServiceName: "e2e",
+	})
+	if err != nil {
+		return err
+	}
+
+	e.cfg = cfg
+	e.log = log
+	e.minio = storage.MinIOConfig{
+		Endpoint:  minioAddr,
+		AccessKey: minioUser,
+		SecretKey: minioPassword,
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/infrastructure/storage"
+)
+
+// projectionTimeout bounds how long a read model may lag behind the command
+// that changed it.
+const projectionTimeout = 30 * time.Second
+
+func TestFlow_ClientInvoicePayment(t *testing.T) {
+	s := env.services
+	u := newUser(t)
+
+	var client domain.Client
+	status, _ := u.do(t, http.MethodPost, s.clientCommands.URL+"/api/v1/commands", "", map[string]interface{}{
+		"id":   uuid.NewString(),
+		"type": "client.create",
+		"data": map[string]interface{}{
+			"name":        "Northwind Traders",
+			"email":       "ap@northwind.example.com",
+			"creditLimit": "25000",
+			"billingAddress": map[string]interface{}{
+				"street":     "1 Market Street",
+				"city":       "Springfield",
+				"postalCode": "12345",
+				"country":    "US",
+			},
+		},
+	}, &client)
+	require.Equal(t, http.StatusOK, status)
+
+	clientRead := u.await(t, s.clientQueries.URL+"/api/v1/clients/id/?clientId="+client.ID.String(), func(doc map[string]interface{}) bool {
+		return doc["name"] == "Northwind Traders"
+	})
+	assert.Equal(t, u.tenantID, clientRead["tenantId"])
+
+	invoiceURL := s.invoices.URL + "/api/v1/invoices"
+	var invoice domain.Invoice
+	status, _ = u.do(t, http.MethodPost, invoiceURL, "", map[string]interface{}{
+		"clientId":    client.ID.String(),
+		"currency":    "USD",
+		"paymentTerm": string(domain.PaymentTermNet30),
+	}, &invoice)
+	require.Equal(t, http.StatusCreated, status)
+	invoiceURL += "/" + invoice.ID.String()
+
+	status, etag := u.do(t, http.MethodPost, invoiceURL+"/lines", "", map[string]interface{}{
+		"description": "Consulting",
+		"quantity":    "4",
+		"unitPrice":   "250",
+		"taxRate":     "0",
+		"sortOrder":   1,
+	}, &invoice)
+	require.Equal(t, http.StatusCreated, status)
+	status, _ = u.do(t, http.MethodPatch, invoiceURL, etag, map[string]interface{}{"action": "finalize"}, &invoice)
+	require.Equal(t, http.StatusOK, status)
+	require.True(t, invoice.Total.Equal(decimal.NewFromInt(1000)), "total %s", invoice.Total)
+
+	invoiceRead := u.await(t, invoiceURL, func(doc map[string]interface{}) bool {
+		return doc["status"] == string(domain.InvoiceStatusPending)
+	})
+	assert.Equal(t, invoice.InvoiceNumber, invoiceRead["invoiceNumber"])
+	assert.Equal(t, "Northwind Traders", invoiceRead["clientName"])
+
+	var processed map[string]interface{}
+	status, _ = u.do(t, http.MethodPost, s.payments.URL+"/api/v1/payments/process", "", map[string]interface{}{
+		"invoiceId":   invoice.ID.String(),
+		"clientId":    client.ID.String(),
+		"amount":      json.Number(invoice.Total.String()),
+		"currency":    "USD",
+		"method":      string(domain.PaymentMethodBankTransfer),
+		"provider":    offlineProvider,
+		"reference":   invoice.InvoiceNumber,
+		"description": "Payment for " + invoice.InvoiceNumber,
+	}, &processed)
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, string(domain.PaymentStatusCompleted), processed["status"])
+	paymentID, _ := processed["paymentId"].(string)
+	require.NotEmpty(t, paymentID)
+
+	paymentRead := u.await(t, s.payments.URL+"/api/v1/payments/"+paymentID, func(doc map[string]interface{}) bool {
+		payment, _ := doc["payment"].(map[string]interface{})
+		return payment["status"] == string(domain.PaymentStatusCompleted)
+	})["payment"].(map[string]interface{})
+	assert.Equal(t, invoice.InvoiceNumber, paymentRead["invoiceNumber"])
+	assert.Equal(t, "Northwind Traders", paymentRead["clientName"])
+
+	var balance struct {
+		Status    string          `json:"status"`
+		AmountDue decimal.Decimal `json:"amountDue"`
+	}
+	status, _ = u.do(t, http.MethodGet, invoiceURL+"/payments", "", nil, &balance)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, string(domain.InvoiceStatusPaid), balance.Status)
+	assert.True(t, balance.AmountDue.IsZero(), "amount due %s", balance.AmountDue)
+}
+
+func TestFlow_ClientRenameReachesInvoices(t *testing.T) {
+	s := env.services
+	u := newUser(t)
+
+	var client domain.Client
+	status, _ := u.do(t, http.MethodPost, s.clientCommands.URL+"/api/v1/commands", "", map[string]interface{}{
+		"id":   uuid.NewString(),
+		"type": "client.create",
+		"data": map[string]interface{}{
+			"name":  "Contoso",
+			"email": "billing@contoso.example.com",
+		},
+	}, &client)
+	require.Equal(t, http.StatusOK, status)
+	u.await(t, s.clientQueries.URL+"/api/v1/clients/id/?clientId="+client.ID.String(), func(map[string]interface{}) bool { return true })
+
+	var invoice domain.Invoice
+	status, _ = u.do(t, http.MethodPost, s.invoices.URL+"/api/v1/invoices", "", map[string]interface{}{
+		"clientId":    client.ID.String(),
+		"currency":    "EUR",
+		"paymentTerm": string(domain.PaymentTermNet30),
+	}, &invoice)
+	require.Equal(t, http.StatusCreated, status)
+	invoiceURL := s.invoices.URL + "/api/v1/invoices/" + invoice.ID.String()
+	u.await(t, invoiceURL, func(doc map[string]interface{}) bool {
+		return doc["clientName"] == "Contoso"
+	})
+
+	status, _ = u.do(t, http.MethodPost, s.clientCommands.URL+"/api/v1/commands", "", map[string]interface{}{
+		"id":   uuid.NewString(),
+		"type": "client.update",
+		"data": map[string]interface{}{
+			"clientId": client.ID.String(),
+			"name":     "Contoso Ltd",
+		},
+	}, nil)
+	require.Equal(t, http.StatusOK, status)
+
+	u.await(t, invoiceURL, func(doc map[string]interface{}) bool {
+		return doc["clientName"] == "Contoso Ltd"
+	})
+}
+
+func TestStorage_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	svc, err := storage.NewMinIOStorageService(env.minio)
+	require.NoError(t, err)
+
+	bucket := "e2e-documents"
+	exists, err := svc.BucketExists(ctx, bucket)
+	require.NoError(t, err)
+	if !exists {
+		require.NoError(t, svc.CreateBucket(ctx, bucket))
+	}
+
+	key := "invoices/" + uuid.New().String() + ".pdf"
+	content := []byte("%PDF-1.4 e2e")
+	require.NoError(t, svc.Upload(ctx, bucket, key, content, "application/pdf"))
+
+	downloaded, err := svc.Download(ctx, bucket, key)
+	require.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+
+	require.NoError(t, svc.Delete(ctx, bucket, key))
+	_, err = svc.Download(ctx, bucket, key)
+	assert.Error(t, err)
+}
+
+// user calls the services as a user of a tenant of its own, with an access
+// token signed like auth-service signs them.
+type user struct {
+	tenantID string
+	token    string
+}
+
+func newUser(t *testing.T) user {
+	t.Helper()
+	tenantID := uuid.New()
+	token, _, err := auth.NewJWTService(&env.cfg.Auth, env.log).GenerateAccessToken(&domain.User{
+		ID:       uuid.New(),
+		TenantID: tenantID,
+		Email:    "e2e@example.com",
+		Role:     "admin",
+	})
+	require.NoError(t, err)
+	return user{tenantID: tenantID.String(), token: token}
+}
+
+// do sends body, when not nil, as JSON to url with If-Match set to ifMatch,
+// when not empty, and decodes a successful JSON response into out, when not
+// nil. It returns the response status and ETag.
+func (u user) do(t *testing.T, method, url, ifMatch string, body, out interface{}) (int, string) {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&payload).Encode(body))
+	}
+	req, err := http.NewRequest(method, url, &payload)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+u.token)
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		var problem map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&problem)
+		t.Logf("%s %s: %d %v", method, url, resp.StatusCode, problem)
+	} else if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode, resp.Header.Get("ETag")
+}
+
+// await polls url until it answers with a document that satisfies ready,
+// and returns it.
+func (u user) await(t *testing.T, url string, ready func(map[string]interface{}) bool) map[string]interface{} {
+	t.Helper()
+	var doc map[string]interface{}
+	require.Eventually(t, func() bool {
+		doc = nil
+		status, _ := u.do(t, http.MethodGet, url, "", nil, &doc)
+		return status == http.StatusOK && ready(doc)
+	}, projectionTimeout, 100*time.Millisecond, "%s was not projected", url)
+	return doc
+}
@@ -0,0 +1,99 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/ims-erp/system/internal/clientcommandservice"
+	"github.com/ims-erp/system/internal/clientqueryservice"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/invoiceservice"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/paymentservice"
+	"github.com/ims-erp/system/pkg/metrics"
+)
+
+// offlineProvider settles payments as soon as they are processed, like
+// bank transfers recorded by hand.
+const offlineProvider = "offline"
+
+// services are the client, invoice and payment services, each serving its
+// real HTTP handler from a test server.
+type services struct {
+	clientCommands *httptest.Server
+	clientQueries  *httptest.Server
+	invoices       *httptest.Server
+	payments       *httptest.Server
+}
+
+// startServices starts the services in-process against the environment, as
+// their mains start them: each connects to the containers, creates its
+// streams and consumers and runs its projections and jobs. Commands publish
+// to JetStream and the projections consume from it, so the read models are
+// eventually consistent with the commands, as in production.
+//
+// The services that consume client events are started before
+// client-command-service publishes any.
+func startServices(e *environment) (*services, error) {
+	metrics.Initialize("e2e")
+	group := lifecycle.New(e.log)
+	e.onClose(func() { group.Shutdown(30 * time.Second) })
+
+	processors := domain.NewProcessorRegistry()
+	processors.Register(offlineProvider, func(string, interface{}) (domain.PaymentProcessor, error) {
+		return offlineProcessor{}, nil
+	})
+
+	serve := func(name string, start func() (http.Handler, error)) (*httptest.Server, error) {
+		handler, err := start()
+		if err != nil {
+			return nil, fmt.Errorf("start %s: %w", name, err)
+		}
+		srv := httptest.NewServer(handler)
+		e.onClose(srv.Close)
+		return srv, nil
+	}
+
+	s := &services{}
+	var err error
+	if s.clientQueries, err = serve("client-query-service", func() (http.Handler, error) {
+		return clientqueryservice.Start(group, e.cfg, e.log)
+	}); err != nil {
+		return nil, err
+	}
+	if s.invoices, err = serve("invoice-service", func() (http.Handler, error) {
+		return invoiceservice.Start(group, e.cfg, e.log)
+	}); err != nil {
+		return nil, err
+	}
+	if s.payments, err = serve("payment-service", func() (http.Handler, error) {
+		return paymentservice.Start(group, e.cfg, e.log, processors)
+	}); err != nil {
+		return nil, err
+	}
+	if s.clientCommands, err = serve("client-command-service", func() (http.Handler, error) {
+		return clientcommandservice.Start(group, e.cfg, e.log)
+	}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type offlineProcessor struct{}
+
+func (offlineProcessor) ProcessPayment(ctx interface{}, req *domain.PaymentRequest) (*domain.PaymentResult, error) {
+	now := time.Now().UTC()
+	return &domain.PaymentResult{Success: true, Status: domain.PaymentStatusCompleted, ProcessedAt: &now}, nil
+}
+
+func (offlineProcessor) ProcessRefund(ctx interface{}, req *domain.RefundRequest) (*domain.RefundResult, error) {
+	return nil, fmt.Errorf("offline payments are refunded manually")
+}
+
+func (offlineProcessor) GetPaymentStatus(ctx interface{}, providerID string) (*domain.PaymentResult, error) {
+	return &domain.PaymentResult{Success: true, ProviderID: providerID, Status: domain.PaymentStatusCompleted}, nil
+}
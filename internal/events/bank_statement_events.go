@@ -0,0 +1,74 @@
+package events
+
+import (
+	"github.com/ims-erp/system/internal/domain"
+)
+
+// Bank statement events report what reconciliation did with an imported
+// statement. The payments recorded for matched credits are reported by
+// their own payment events.
+
+type BankStatementImportedEvent struct {
+	EventEnvelope
+}
+
+// NewBankStatementImportedEvent reports an import with how many of its
+// transactions were matched, left for review or found nothing alike.
+func NewBankStatementImportedEvent(statement *domain.BankStatement, counts map[domain.BankTransactionStatus]int, userID string) *BankStatementImportedEvent {
+	event := NewEvent(
+		statement.ID.String(),
+		"bank_statement",
+		"bank_statement.imported",
+		statement.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"format":       string(statement.Format),
+			"reference":    statement.Reference,
+			"accountIban":  statement.AccountIBAN,
+			"currency":     statement.Currency,
+			"transactions": statement.Transactions,
+			"duplicates":   statement.Duplicates,
+			"matched":      counts[domain.BankTransactionMatched],
+			"review":       counts[domain.BankTransactionReview],
+			"unmatched":    counts[domain.BankTransactionUnmatched],
+			"ignored":      counts[domain.BankTransactionIgnored],
+		},
+	)
+	return &BankStatementImportedEvent{*event}
+}
+
+type BankTransactionResolvedEvent struct {
+	EventEnvelope
+}
+
+// NewBankTransactionResolvedEvent reports a credit matched to an invoice
+// as bank_transaction.matched, or set aside as bank_transaction.ignored.
+func NewBankTransactionResolvedEvent(transaction *domain.BankTransaction, userID string) *BankTransactionResolvedEvent {
+	data := map[string]interface{}{
+		"statementId":      transaction.StatementID.String(),
+		"amount":           transaction.Amount.String(),
+		"currency":         transaction.Currency,
+		"bookingDate":      transaction.BookingDate,
+		"reference":        transaction.Reference,
+		"counterpartyIban": transaction.CounterpartyIBAN,
+		"autoMatched":      transaction.AutoMatched,
+	}
+	if transaction.InvoiceID != nil {
+		data["invoiceId"] = transaction.InvoiceID.String()
+	}
+	if transaction.PaymentID != nil {
+		data["paymentId"] = transaction.PaymentID.String()
+	}
+	if transaction.IgnoreReason != "" {
+		data["reason"] = transaction.IgnoreReason
+	}
+	event := NewEvent(
+		transaction.ID.String(),
+		"bank_transaction",
+		"bank_transaction."+string(transaction.Status),
+		transaction.TenantID.String(),
+		userID,
+		data,
+	)
+	return &BankTransactionResolvedEvent{*event}
+}
@@ -0,0 +1,26 @@
+package events
+
+import (
+	"context"
+
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// evictCached evicts the cached views of the entities event changed, by
+// default its aggregate, following the repository cache key convention. A
+// failure is logged rather than returned: the read model is already updated
+// and redelivering the event would apply it twice.
+func evictCached(ctx context.Context, cache *repository.Cache, log *logger.Logger, event *EventEnvelope, ids ...string) {
+	if len(ids) == 0 {
+		ids = []string{event.AggregateID}
+	}
+	entity := repository.CacheEntity(event.AggregateType)
+	if err := cache.InvalidateEntity(ctx, entity, event.TenantID, ids...); err != nil {
+		log.New(ctx).Warn("Failed to evict cached read models",
+			"error", err,
+			"entity", entity,
+			"event_type", event.Type,
+		)
+	}
+}
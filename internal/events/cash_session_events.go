@@ -0,0 +1,102 @@
+package events
+
+import (
+	"github.com/ims-erp/system/internal/domain"
+)
+
+// Cash session events carry every movement of cash with its amount,
+// currency and direction into or out of the drawer, so that the ledger can
+// post them without reading the session back.
+
+type CashSessionOpenedEvent struct {
+	EventEnvelope
+}
+
+func NewCashSessionOpenedEvent(session *domain.CashSession, userID string) *CashSessionOpenedEvent {
+	event := NewEvent(
+		session.ID.String(),
+		"cash_session",
+		"cash_session.opened",
+		session.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"registerId":   session.RegisterID,
+			"currency":     session.Currency,
+			"openingFloat": session.OpeningFloat.String(),
+			"openedAt":     session.OpenedAt,
+		},
+	)
+	return &CashSessionOpenedEvent{*event}
+}
+
+type CashEntryRecordedEvent struct {
+	EventEnvelope
+}
+
+// NewCashEntryRecordedEvent reports a payment, paid-in or paid-out as
+// cash_session.payment_recorded, cash_session.paid_in or
+// cash_session.paid_out.
+func NewCashEntryRecordedEvent(session *domain.CashSession, entry *domain.CashEntry, userID string) *CashEntryRecordedEvent {
+	direction := "in"
+	if entry.Type == domain.CashEntryPaidOut {
+		direction = "out"
+	}
+	data := map[string]interface{}{
+		"registerId": session.RegisterID,
+		"entryId":    entry.ID,
+		"entryType":  string(entry.Type),
+		"direction":  direction,
+		"amount":     entry.Amount.String(),
+		"currency":   session.Currency,
+		"reason":     entry.Reason,
+		"reference":  entry.Reference,
+		"expected":   session.Expected.String(),
+		"recordedAt": entry.RecordedAt,
+	}
+	if entry.InvoiceID != nil {
+		data["invoiceId"] = entry.InvoiceID.String()
+	}
+	if entry.OrderID != nil {
+		data["orderId"] = entry.OrderID.String()
+	}
+	if entry.PaymentID != nil {
+		data["paymentId"] = entry.PaymentID.String()
+	}
+
+	eventType := "cash_session." + string(entry.Type)
+	if entry.Type == domain.CashEntryPayment {
+		eventType = "cash_session.payment_recorded"
+	}
+	event := NewEvent(
+		session.ID.String(),
+		"cash_session",
+		eventType,
+		session.TenantID.String(),
+		userID,
+		data,
+	)
+	return &CashEntryRecordedEvent{*event}
+}
+
+type CashSessionClosedEvent struct {
+	EventEnvelope
+}
+
+func NewCashSessionClosedEvent(session *domain.CashSession, userID string) *CashSessionClosedEvent {
+	event := NewEvent(
+		session.ID.String(),
+		"cash_session",
+		"cash_session.closed",
+		session.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"registerId": session.RegisterID,
+			"currency":   session.Currency,
+			"expected":   session.Expected.String(),
+			"counted":    session.Counted.String(),
+			"variance":   session.Variance.String(),
+			"closedAt":   session.ClosedAt,
+		},
+	)
+	return &CashSessionClosedEvent{*event}
+}
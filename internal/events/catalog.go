@@ -0,0 +1,149 @@
+package events
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// EventSchema describes one event type. Version is the schema version of its
+// data; it is bumped when a field is removed or changes meaning, so that
+// webhook receivers and other consumers can tell the shapes apart.
+type EventSchema struct {
+	Type          string `json:"type"`
+	AggregateType string `json:"aggregateType"`
+	Version       int    `json:"schemaVersion"`
+}
+
+// Subject is the subject events of this type are published on.
+func (s EventSchema) Subject() string {
+	return "evt." + s.AggregateType + "." + s.Type
+}
+
+// Event schemas by aggregate. Add new event types here when a command handler
+// starts publishing them.
+var (
+	ClientEvents = []EventSchema{
+		{Type: "ClientCreated", AggregateType: "Client", Version: 1},
+		{Type: "ClientUpdated", AggregateType: "Client", Version: 1},
+		{Type: "ClientOwnerAssigned", AggregateType: "Client", Version: 1},
+		{Type: "ClientDeactivated", AggregateType: "Client", Version: 1},
+		{Type: "CreditLimitAssigned", AggregateType: "Client", Version: 1},
+		{Type: "BillingInfoUpdated", AggregateType: "Client", Version: 1},
+		{Type: "ClientsMerged", AggregateType: "Client", Version: 1},
+		{Type: "ClientDeleted", AggregateType: "Client", Version: 1},
+		{Type: "ClientRestored", AggregateType: "Client", Version: 1},
+		{Type: "ClientPurged", AggregateType: "Client", Version: 1},
+	}
+
+	InvoiceEvents = []EventSchema{
+		{Type: "invoice.created", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.line_added", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.line_removed", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.finalized", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.sent", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.voided", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.payment_recorded", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.payment_applied", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.payment_unapplied", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.credit_applied", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.credit_allocated", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.paid", AggregateType: "invoice", Version: 1},
+		{Type: "invoice.reminder_sent", AggregateType: "invoice", Version: 1},
+	}
+
+	PaymentEvents = []EventSchema{
+		{Type: "payment.created", AggregateType: "payment", Version: 1},
+		{Type: "payment.processed", AggregateType: "payment", Version: 1},
+		{Type: "payment.settled", AggregateType: "payment", Version: 1},
+		{Type: "payment.applied", AggregateType: "payment", Version: 1},
+		{Type: "payment.unapplied", AggregateType: "payment", Version: 1},
+		{Type: "payment.credit_refunded", AggregateType: "payment", Version: 1},
+		{Type: "payment.failed", AggregateType: "payment", Version: 1},
+		{Type: "payment.refunded", AggregateType: "payment", Version: 1},
+		{Type: "payment.cancelled", AggregateType: "payment", Version: 1},
+	}
+)
+
+// AllEvents returns the schemas of every registered event type.
+func AllEvents() []EventSchema {
+	var all []EventSchema
+	for _, group := range [][]EventSchema{ClientEvents, InvoiceEvents, PaymentEvents} {
+		all = append(all, group...)
+	}
+	return all
+}
+
+// LookupSchema returns the schema of eventType, if it is registered.
+func LookupSchema(eventType string) (EventSchema, bool) {
+	for _, schema := range AllEvents() {
+		if schema.Type == eventType {
+			return schema, true
+		}
+	}
+	return EventSchema{}, false
+}
+
+// CatalogEntry is an event type in a service's catalog.
+type CatalogEntry struct {
+	EventSchema
+	Subject string `json:"subject,omitempty"`
+}
+
+// Catalog lists the event types a service publishes and consumes.
+type Catalog struct {
+	Service   string         `json:"service"`
+	Publishes []CatalogEntry `json:"publishes"`
+	Consumes  []CatalogEntry `json:"consumes"`
+}
+
+// NewCatalog builds the catalog of service, which publishes the events of
+// publishes and consumes the event types in consumes, such as the EventTypes
+// of its projection registry.
+func NewCatalog(service string, publishes []EventSchema, consumes []string) *Catalog {
+	c := &Catalog{Service: service, Publishes: []CatalogEntry{}, Consumes: []CatalogEntry{}}
+	for _, schema := range publishes {
+		c.Publishes = append(c.Publishes, catalogEntry(schema))
+	}
+	for _, eventType := range consumes {
+		schema, ok := LookupSchema(eventType)
+		if !ok {
+			schema = EventSchema{Type: eventType}
+		}
+		c.Consumes = append(c.Consumes, catalogEntry(schema))
+	}
+	sort.Slice(c.Consumes, func(i, j int) bool { return c.Consumes[i].Type < c.Consumes[j].Type })
+	return c
+}
+
+// EventTypes returns the types of schemas.
+func EventTypes(schemas []EventSchema) []string {
+	types := make([]string, len(schemas))
+	for i, schema := range schemas {
+		types[i] = schema.Type
+	}
+	return types
+}
+
+func catalogEntry(schema EventSchema) CatalogEntry {
+	entry := CatalogEntry{EventSchema: schema}
+	if schema.AggregateType != "" {
+		entry.Subject = schema.Subject()
+	}
+	return entry
+}
+
+// CatalogPath is where every service serves its catalog.
+const CatalogPath = "/api/v1/_meta/events"
+
+// Handler serves GET CatalogPath.
+func (c *Catalog) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": c})
+	})
+}
@@ -41,31 +41,15 @@ func (h *ClientEventHandler) HandleClientCreated(ctx context.Context, event *Eve
 	)
 	defer span.End()
 
-	clientSummary := ClientSummary{
-		ID:             event.AggregateID,
-		TenantID:       event.TenantID,
-		Name:           getString(event.Data, "name"),
-		Email:          getString(event.Data, "email"),
-		Phone:          getString(event.Data, "phone"),
-		Status:         string(domain.ClientStatusActive),
-		CreditLimit:    getDecimal(event.Data, "creditLimit"),
-		CurrentBalance: "0",
-		Tags:           getStringSlice(event.Data, "tags"),
-		CreatedAt:      event.Timestamp,
-		UpdatedAt:      event.Timestamp,
-	}
-
-	if err := h.readModelStore.Save(ctx, clientSummary); err != nil {
-		span.RecordError(err)
-		return err
-	}
-
+	// Summaries and details are read from the same document, so the detail,
+	// which carries every summary field, is the only one stored.
 	clientDetail := ClientDetail{
 		ID:                event.AggregateID,
 		TenantID:          event.TenantID,
 		Name:              getString(event.Data, "name"),
 		Email:             getString(event.Data, "email"),
 		Phone:             getString(event.Data, "phone"),
+		Locale:            getString(event.Data, "locale"),
 		Status:            string(domain.ClientStatusActive),
 		CreditLimit:       getDecimal(event.Data, "creditLimit"),
 		CurrentBalance:    "0",
@@ -80,8 +64,10 @@ func (h *ClientEventHandler) HandleClientCreated(ctx context.Context, event *Eve
 				UserID:    event.UserID,
 			},
 		},
+		Version:   event.Version,
 		CreatedAt: event.Timestamp,
 		UpdatedAt: event.Timestamp,
+		Ownership: getOwnership(event.Data),
 	}
 
 	if err := h.readModelStore.Save(ctx, clientDetail); err != nil {
@@ -89,10 +75,12 @@ func (h *ClientEventHandler) HandleClientCreated(ctx context.Context, event *Eve
 		return err
 	}
 
+	evictCached(ctx, h.cache, h.logger, event)
+
 	h.logger.New(ctx).Info("Client created",
 		"client_id", event.AggregateID,
 		"tenant_id", event.TenantID,
-		"name", clientSummary.Name,
+		"name", clientDetail.Name,
 	)
 
 	return nil
@@ -113,10 +101,12 @@ func (h *ClientEventHandler) HandleClientUpdated(ctx context.Context, event *Eve
 	}
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"name":      getString(event.Data, "name"),
 			"email":     getString(event.Data, "email"),
 			"phone":     getString(event.Data, "phone"),
+			"locale":    getString(event.Data, "locale"),
 			"updatedAt": event.Timestamp,
 		},
 		"$push": map[string]interface{}{
@@ -134,8 +124,7 @@ func (h *ClientEventHandler) HandleClientUpdated(ctx context.Context, event *Eve
 		return err
 	}
 
-	h.cache.Delete(ctx, "client:detail:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "client:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Debug("Client updated",
 		"client_id", event.AggregateID,
@@ -162,6 +151,7 @@ func (h *ClientEventHandler) HandleClientDeactivated(ctx context.Context, event
 	reason := getString(event.Data, "reason")
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"status":    string(domain.ClientStatusInactive),
 			"updatedAt": event.Timestamp,
@@ -181,8 +171,7 @@ func (h *ClientEventHandler) HandleClientDeactivated(ctx context.Context, event
 		return err
 	}
 
-	h.cache.Delete(ctx, "client:detail:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "client:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Info("Client deactivated",
 		"client_id", event.AggregateID,
@@ -208,6 +197,7 @@ func (h *ClientEventHandler) HandleCreditLimitAssigned(ctx context.Context, even
 	}
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"creditLimit": getString(event.Data, "newLimit"),
 			"updatedAt":   event.Timestamp,
@@ -227,8 +217,7 @@ func (h *ClientEventHandler) HandleCreditLimitAssigned(ctx context.Context, even
 		return err
 	}
 
-	h.cache.Delete(ctx, "client:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "client:credit:"+event.AggregateID)
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Debug("Credit limit assigned",
 		"client_id", event.AggregateID,
@@ -256,6 +245,7 @@ func (h *ClientEventHandler) HandleBillingInfoUpdated(ctx context.Context, event
 	addr := getAddress(event.Data, "billingAddress")
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"billingAddress": addr,
 			"updatedAt":      event.Timestamp,
@@ -274,7 +264,57 @@ func (h *ClientEventHandler) HandleBillingInfoUpdated(ctx context.Context, event
 		return err
 	}
 
-	h.cache.Delete(ctx, "client:detail:"+event.AggregateID)
+	evictCached(ctx, h.cache, h.logger, event)
+
+	return nil
+}
+
+// HandleClientOwnerAssigned hands the client to another sales rep or
+// territory.
+func (h *ClientEventHandler) HandleClientOwnerAssigned(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_client_owner_assigned",
+		trace.WithAttributes(
+			attribute.String("client_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+
+	ownership := getOwnership(event.Data)
+	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
+		"$set": map[string]interface{}{
+			"ownerId":   ownership.OwnerID,
+			"territory": ownership.Territory,
+			"updatedAt": event.Timestamp,
+		},
+		"$push": map[string]interface{}{
+			"activityLog": ClientActivity{
+				Action:    "owner_assigned",
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+				Details:   "Owner changed from " + getString(event.Data, "previousOwnerId") + " to " + ownership.OwnerID,
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	h.logger.New(ctx).Debug("Client owner assigned",
+		"client_id", event.AggregateID,
+		"owner_id", ownership.OwnerID,
+		"territory", ownership.Territory,
+	)
 
 	return nil
 }
@@ -298,6 +338,7 @@ func (h *ClientEventHandler) HandleClientsMerged(ctx context.Context, event *Eve
 	}
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"updatedAt": event.Timestamp,
 		},
@@ -316,9 +357,7 @@ func (h *ClientEventHandler) HandleClientsMerged(ctx context.Context, event *Eve
 		return err
 	}
 
-	h.cache.Delete(ctx, "client:detail:"+targetID)
-	h.cache.Delete(ctx, "client:detail:"+sourceID)
-	h.cache.DeletePattern(ctx, "client:list:*")
+	evictCached(ctx, h.cache, h.logger, event, targetID, sourceID)
 
 	h.logger.New(ctx).Info("Clients merged",
 		"source_id", sourceID,
@@ -328,18 +367,145 @@ func (h *ClientEventHandler) HandleClientsMerged(ctx context.Context, event *Eve
 	return nil
 }
 
+func (h *ClientEventHandler) HandleClientDeleted(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_client_deleted",
+		trace.WithAttributes(
+			attribute.String("client_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+
+	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
+		"$set": map[string]interface{}{
+			repository.DeletedAtField: event.Timestamp,
+			repository.DeletedByField: getString(event.Data, "deletedBy"),
+			"updatedAt":               event.Timestamp,
+		},
+		"$push": map[string]interface{}{
+			"activityLog": ClientActivity{
+				Action:    "deleted",
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+				Details:   getString(event.Data, "reason"),
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	h.logger.New(ctx).Info("Client moved to trash",
+		"client_id", event.AggregateID,
+		"tenant_id", event.TenantID,
+	)
+
+	return nil
+}
+
+func (h *ClientEventHandler) HandleClientRestored(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_client_restored",
+		trace.WithAttributes(
+			attribute.String("client_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+
+	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
+		"$unset": map[string]interface{}{
+			repository.DeletedAtField: "",
+			repository.DeletedByField: "",
+		},
+		"$set": map[string]interface{}{
+			"updatedAt": event.Timestamp,
+		},
+		"$push": map[string]interface{}{
+			"activityLog": ClientActivity{
+				Action:    "restored",
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	h.logger.New(ctx).Info("Client restored from trash",
+		"client_id", event.AggregateID,
+		"tenant_id", event.TenantID,
+	)
+
+	return nil
+}
+
+func (h *ClientEventHandler) HandleClientPurged(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_client_purged",
+		trace.WithAttributes(
+			attribute.String("client_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+
+	if err := h.readModelStore.Delete(ctx, filter); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	h.logger.New(ctx).Info("Client purged",
+		"client_id", event.AggregateID,
+		"tenant_id", event.TenantID,
+	)
+
+	return nil
+}
+
 type ClientSummary struct {
 	ID             string    `bson:"_id" json:"id"`
 	TenantID       string    `bson:"tenantId" json:"tenantId"`
 	Name           string    `bson:"name" json:"name"`
 	Email          string    `bson:"email" json:"email"`
 	Phone          string    `bson:"phone" json:"phone"`
+	Locale         string    `bson:"locale,omitempty" json:"locale,omitempty"`
 	Status         string    `bson:"status" json:"status"`
 	CreditLimit    string    `bson:"creditLimit" json:"creditLimit"`
 	CurrentBalance string    `bson:"currentBalance" json:"currentBalance"`
 	Tags           []string  `bson:"tags" json:"tags"`
+	Version        int64     `bson:"version" json:"version"`
 	CreatedAt      time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt      time.Time `bson:"updatedAt" json:"updatedAt"`
+
+	domain.Ownership  `bson:",inline"`
+	domain.SoftDelete `bson:",inline"`
 }
 
 type ClientDetail struct {
@@ -348,6 +514,7 @@ type ClientDetail struct {
 	Name              string                 `bson:"name" json:"name"`
 	Email             string                 `bson:"email" json:"email"`
 	Phone             string                 `bson:"phone" json:"phone"`
+	Locale            string                 `bson:"locale,omitempty" json:"locale,omitempty"`
 	Status            string                 `bson:"status" json:"status"`
 	CreditLimit       string                 `bson:"creditLimit" json:"creditLimit"`
 	CurrentBalance    string                 `bson:"currentBalance" json:"currentBalance"`
@@ -356,8 +523,24 @@ type ClientDetail struct {
 	Tags              []string               `bson:"tags" json:"tags"`
 	CustomFields      map[string]interface{} `bson:"customFields" json:"customFields"`
 	ActivityLog       []ClientActivity       `bson:"activityLog" json:"activityLog"`
+	Version           int64                  `bson:"version" json:"version"`
 	CreatedAt         time.Time              `bson:"createdAt" json:"createdAt"`
 	UpdatedAt         time.Time              `bson:"updatedAt" json:"updatedAt"`
+	// AccountCredit is what the client paid beyond their invoices, held to
+	// apply to later invoices or refund, by currency. It is read from the
+	// payment read models with each request, not stored with the client.
+	AccountCredit []AccountCreditBalance `bson:"accountCredit,omitempty" json:"accountCredit"`
+
+	domain.Ownership  `bson:",inline"`
+	domain.SoftDelete `bson:",inline"`
+}
+
+// AccountCreditBalance is an amount of account credit in one currency, as
+// a decimal string, and the number of payments holding it.
+type AccountCreditBalance struct {
+	Currency string `bson:"currency" json:"currency"`
+	Amount   string `bson:"amount" json:"amount"`
+	Payments int    `bson:"payments" json:"payments"`
 }
 
 type ClientActivity struct {
@@ -377,6 +560,17 @@ type ClientCreditStatus struct {
 	Utilization     float64   `bson:"utilization" json:"utilization"`
 	RiskLevel       string    `bson:"riskLevel" json:"riskLevel"`
 	LastCheck       time.Time `bson:"lastCheck" json:"lastCheck"`
+	// UnappliedCredit is the credit of the client's issued credit notes not
+	// yet applied to invoices, by currency.
+	UnappliedCredit []CreditBalance `bson:"unappliedCredit" json:"unappliedCredit"`
+}
+
+// CreditBalance is an amount of credit in one currency, as a decimal
+// string, and the number of credit notes it is on.
+type CreditBalance struct {
+	Currency    string `bson:"currency" json:"currency"`
+	Amount      string `bson:"amount" json:"amount"`
+	CreditNotes int    `bson:"creditNotes" json:"creditNotes"`
 }
 
 func getString(data map[string]interface{}, key string) string {
@@ -386,6 +580,14 @@ func getString(data map[string]interface{}, key string) string {
 	return ""
 }
 
+// getOwnership reads the owner and territory carried by a client event.
+func getOwnership(data map[string]interface{}) domain.Ownership {
+	return domain.Ownership{
+		OwnerID:   getString(data, "ownerId"),
+		Territory: getString(data, "territory"),
+	}
+}
+
 func getDecimal(data map[string]interface{}, key string) string {
 	if v, ok := data[key].(string); ok {
 		return v
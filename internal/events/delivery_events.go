@@ -0,0 +1,166 @@
+package events
+
+import (
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+)
+
+type DeliveryRouteCreatedEvent struct {
+	EventEnvelope
+}
+
+func NewDeliveryRouteCreatedEvent(route *domain.DeliveryRoute, userID string) *DeliveryRouteCreatedEvent {
+	event := NewEvent(
+		route.ID.String(),
+		"DeliveryRoute",
+		"delivery_route.created",
+		route.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"name":           route.Name,
+			"warehouseId":    route.WarehouseID,
+			"deliveryDate":   route.DeliveryDate,
+			"vehicle":        route.Vehicle,
+			"capacityWeight": route.CapacityWeight.String(),
+			"maxStops":       route.MaxStops,
+		},
+	)
+	return &DeliveryRouteCreatedEvent{*event}
+}
+
+type ShipmentRoutedEvent struct {
+	EventEnvelope
+}
+
+func NewShipmentRoutedEvent(route *domain.DeliveryRoute, stop *domain.DeliveryStop, userID string) *ShipmentRoutedEvent {
+	event := NewEvent(
+		route.ID.String(),
+		"DeliveryRoute",
+		"delivery_route.shipment_assigned",
+		route.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"stopId":       stop.ID,
+			"orderId":      stop.OrderID,
+			"shipmentId":   stop.ShipmentID,
+			"sequence":     stop.Sequence,
+			"deliveryDate": route.DeliveryDate,
+			"slotStart":    stop.SlotStart,
+			"slotEnd":      stop.SlotEnd,
+			"weight":       stop.Weight.String(),
+			"load":         route.Load().String(),
+		},
+	)
+	return &ShipmentRoutedEvent{*event}
+}
+
+type ShipmentUnassignedEvent struct {
+	EventEnvelope
+}
+
+func NewShipmentUnassignedEvent(route *domain.DeliveryRoute, shipmentID uuid.UUID, userID string) *ShipmentUnassignedEvent {
+	event := NewEvent(
+		route.ID.String(),
+		"DeliveryRoute",
+		"delivery_route.shipment_unassigned",
+		route.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"shipmentId": shipmentID,
+			"load":       route.Load().String(),
+		},
+	)
+	return &ShipmentUnassignedEvent{*event}
+}
+
+type DeliveryRouteSequencedEvent struct {
+	EventEnvelope
+}
+
+func NewDeliveryRouteSequencedEvent(route *domain.DeliveryRoute, userID string) *DeliveryRouteSequencedEvent {
+	shipments := make([]string, len(route.Stops))
+	for i, stop := range route.Stops {
+		shipments[i] = stop.ShipmentID.String()
+	}
+
+	event := NewEvent(
+		route.ID.String(),
+		"DeliveryRoute",
+		"delivery_route.sequenced",
+		route.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"shipmentIds": shipments,
+		},
+	)
+	return &DeliveryRouteSequencedEvent{*event}
+}
+
+type DeliveryRouteDispatchedEvent struct {
+	EventEnvelope
+}
+
+func NewDeliveryRouteDispatchedEvent(route *domain.DeliveryRoute, userID string) *DeliveryRouteDispatchedEvent {
+	event := NewEvent(
+		route.ID.String(),
+		"DeliveryRoute",
+		"delivery_route.dispatched",
+		route.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"deliveryDate": route.DeliveryDate,
+			"driverId":     route.DriverID,
+			"driverName":   route.DriverName,
+			"vehicle":      route.Vehicle,
+			"stops":        len(route.Stops),
+			"dispatchedAt": route.DispatchedAt,
+		},
+	)
+	return &DeliveryRouteDispatchedEvent{*event}
+}
+
+type ShipmentDeliveredEvent struct {
+	EventEnvelope
+}
+
+func NewShipmentDeliveredEvent(route *domain.DeliveryRoute, stop *domain.DeliveryStop, userID string) *ShipmentDeliveredEvent {
+	event := NewEvent(
+		route.ID.String(),
+		"DeliveryRoute",
+		"delivery_route.shipment_delivered",
+		route.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"stopId":            stop.ID,
+			"orderId":           stop.OrderID,
+			"shipmentId":        stop.ShipmentID,
+			"deliveredAt":       stop.DeliveredAt,
+			"receivedBy":        stop.ReceivedBy,
+			"proofOfDeliveryId": stop.ProofOfDeliveryID,
+			"routeStatus":       string(route.Status),
+		},
+	)
+	return &ShipmentDeliveredEvent{*event}
+}
+
+type ShipmentDeliveryFailedEvent struct {
+	EventEnvelope
+}
+
+func NewShipmentDeliveryFailedEvent(route *domain.DeliveryRoute, stop *domain.DeliveryStop, userID string) *ShipmentDeliveryFailedEvent {
+	event := NewEvent(
+		route.ID.String(),
+		"DeliveryRoute",
+		"delivery_route.shipment_failed",
+		route.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"stopId":      stop.ID,
+			"orderId":     stop.OrderID,
+			"shipmentId":  stop.ShipmentID,
+			"reason":      stop.FailureReason,
+			"routeStatus": string(route.Status),
+		},
+	)
+	return &ShipmentDeliveryFailedEvent{*event}
+}
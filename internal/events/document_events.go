@@ -113,6 +113,24 @@ func NewDocumentDeletedEvent(docID, tenantID, userID string) *DocumentDeletedEve
 	return &DocumentDeletedEvent{*event}
 }
 
+type DocumentRestoredEvent struct {
+	EventEnvelope
+}
+
+func NewDocumentRestoredEvent(doc *domain.Document, userID string) *DocumentRestoredEvent {
+	event := NewEvent(
+		doc.ID.String(),
+		"Document",
+		"document.restored",
+		doc.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"fileName": doc.FileName,
+		},
+	)
+	return &DocumentRestoredEvent{*event}
+}
+
 type DocumentUpdatedEvent struct {
 	EventEnvelope
 }
@@ -169,3 +187,54 @@ func NewDocumentSearchIndexDeletedEvent(docID, tenantID, userID string) *Documen
 	)
 	return &DocumentSearchIndexDeletedEvent{*event}
 }
+
+type StorageUsageRecordedEvent struct {
+	EventEnvelope
+}
+
+// NewStorageUsageRecordedEvent reports what a tenant stores in
+// document-service, measured periodically, for billing to meter.
+func NewStorageUsageRecordedEvent(usage *domain.StorageUsage) *StorageUsageRecordedEvent {
+	event := NewEvent(
+		usage.TenantID.String(),
+		"DocumentStorage",
+		"document.storage.usage_recorded",
+		usage.TenantID.String(),
+		"",
+		storageUsageData(usage),
+	)
+	return &StorageUsageRecordedEvent{*event}
+}
+
+type StorageQuotaExceededEvent struct {
+	EventEnvelope
+}
+
+// NewStorageQuotaExceededEvent reports that a tenant went over its storage
+// quota: an upload was rejected, or accepted and charged as overage.
+func NewStorageQuotaExceededEvent(usage *domain.StorageUsage, userID string, rejected bool) *StorageQuotaExceededEvent {
+	data := storageUsageData(usage)
+	data["rejected"] = rejected
+	event := NewEvent(
+		usage.TenantID.String(),
+		"DocumentStorage",
+		"document.storage.quota_exceeded",
+		usage.TenantID.String(),
+		userID,
+		data,
+	)
+	return &StorageQuotaExceededEvent{*event}
+}
+
+func storageUsageData(usage *domain.StorageUsage) map[string]interface{} {
+	return map[string]interface{}{
+		"bytes":          usage.Bytes,
+		"objects":        usage.Objects,
+		"maxBytes":       usage.Quota.MaxBytes,
+		"maxObjects":     usage.Quota.MaxObjects,
+		"enforcement":    string(usage.Quota.Enforcement),
+		"overageBytes":   usage.OverageBytes,
+		"overageObjects": usage.OverageObjects,
+		"measuredAt":     usage.MeasuredAt,
+	}
+}
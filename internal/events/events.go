@@ -3,9 +3,11 @@ package events
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Publisher interface {
@@ -83,13 +85,21 @@ func EventFromJSON(data []byte) (*EventEnvelope, error) {
 
 type EventHandler func(ctx context.Context, event *EventEnvelope) error
 
+// EventHandlerRegistry dispatches events to registered handlers. Handlers are
+// idempotent by default: an event ID a handler has already applied is skipped.
 type EventHandlerRegistry struct {
-	handlers map[string][]EventHandler
+	handlers  map[string][]EventHandler
+	processed ProcessedEventStore
+	consumer  string
+	ttl       time.Duration
 }
 
 func NewEventHandlerRegistry() *EventHandlerRegistry {
 	return &EventHandlerRegistry{
-		handlers: make(map[string][]EventHandler),
+		handlers:  make(map[string][]EventHandler),
+		processed: NewMemoryProcessedEventStore(),
+		consumer:  DefaultConsumerName,
+		ttl:       DefaultProcessedEventTTL,
 	}
 }
 
@@ -101,17 +111,59 @@ func (r *EventHandlerRegistry) GetHandlers(eventType string) []EventHandler {
 	return r.handlers[eventType]
 }
 
+// EventTypes returns the event types with at least one handler.
+func (r *EventHandlerRegistry) EventTypes() []string {
+	types := make([]string, 0, len(r.handlers))
+	for eventType := range r.handlers {
+		types = append(types, eventType)
+	}
+	return types
+}
+
 func (r *EventHandlerRegistry) Handle(ctx context.Context, event *EventEnvelope) []error {
 	errors := make([]error, 0)
 	handlers := r.GetHandlers(event.Type)
-	for _, handler := range handlers {
-		if err := handler(ctx, event); err != nil {
+	if len(handlers) == 0 {
+		return errors
+	}
+	ctx = handlerContext(ctx, event)
+	for i, handler := range handlers {
+		consumer := r.handlerConsumer(event.Type, i)
+		if err := r.handle(ctx, event, consumer, handler); err != nil {
 			errors = append(errors, err)
 		}
 	}
 	return errors
 }
 
+// handle runs a single handler in its own span, skipping events it has
+// already applied.
+func (r *EventHandlerRegistry) handle(ctx context.Context, event *EventEnvelope, consumer string, handler EventHandler) (err error) {
+	ctx, span := startHandlerSpan(ctx, event, consumer)
+	defer func() { endHandlerSpan(span, err) }()
+
+	if r.processed == nil || event.ID == "" {
+		return handler(ctx, event)
+	}
+
+	done, err := r.processed.IsProcessed(ctx, consumer, event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check processed event %s: %w", event.ID, err)
+	}
+	if done {
+		span.SetAttributes(attribute.Bool("event.duplicate", true))
+		return nil
+	}
+
+	if err := handler(ctx, event); err != nil {
+		return err
+	}
+	// The handler has already applied the event; reporting a failed mark
+	// would trigger the very redelivery this is meant to absorb.
+	_ = r.processed.MarkProcessed(ctx, consumer, event.ID, r.ttl)
+	return nil
+}
+
 type Event interface {
 	EventType() string
 	AggregateID() string
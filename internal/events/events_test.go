@@ -9,6 +9,11 @@ import (
 	"github.com/ims-erp/system/internal/domain"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestNewEvent(t *testing.T) {
@@ -561,3 +566,131 @@ func TestNewInventoryShippedEvent(t *testing.T) {
 	assert.Equal(t, 25, event.Data["quantity"])
 	assert.Equal(t, "sales_order", event.Data["referenceType"])
 }
+
+func TestEventHandlerRegistry_HandleSkipsProcessedEvents(t *testing.T) {
+	registry := NewEventHandlerRegistry()
+	eventType := "warehouse.created"
+	calls := 0
+
+	registry.Register(eventType, func(ctx context.Context, event *EventEnvelope) error {
+		calls++
+		return nil
+	})
+
+	event := NewEvent(uuid.New().String(), "warehouse", eventType, uuid.New().String(), uuid.New().String(), nil)
+	assert.Empty(t, registry.Handle(context.Background(), event))
+	assert.Empty(t, registry.Handle(context.Background(), event))
+
+	assert.Equal(t, 1, calls)
+}
+
+func TestEventHandlerRegistry_HandleRetriesOnlyFailedHandlers(t *testing.T) {
+	registry := NewEventHandlerRegistry().WithProcessedEvents(NewMemoryProcessedEventStore(), "projections", time.Hour)
+	eventType := "warehouse.created"
+	okCalls, failCalls := 0, 0
+
+	registry.Register(eventType, func(ctx context.Context, event *EventEnvelope) error {
+		okCalls++
+		return nil
+	})
+	registry.Register(eventType, func(ctx context.Context, event *EventEnvelope) error {
+		failCalls++
+		if failCalls == 1 {
+			return assert.AnError
+		}
+		return nil
+	})
+
+	event := NewEvent(uuid.New().String(), "warehouse", eventType, uuid.New().String(), uuid.New().String(), nil)
+	assert.Len(t, registry.Handle(context.Background(), event), 1)
+	assert.Empty(t, registry.Handle(context.Background(), event))
+	assert.Empty(t, registry.Handle(context.Background(), event))
+
+	assert.Equal(t, 1, okCalls)
+	assert.Equal(t, 2, failCalls)
+}
+
+func TestMemoryProcessedEventStore_Expiry(t *testing.T) {
+	store := NewMemoryProcessedEventStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.NoError(t, store.MarkProcessed(ctx, "projections", "evt-1", time.Minute))
+	processed, err := store.IsProcessed(ctx, "projections", "evt-1")
+	require.NoError(t, err)
+	assert.True(t, processed)
+
+	processed, _ = store.IsProcessed(ctx, "other", "evt-1")
+	assert.False(t, processed)
+
+	now = now.Add(2 * time.Minute)
+	processed, _ = store.IsProcessed(ctx, "projections", "evt-1")
+	assert.False(t, processed)
+
+	require.NoError(t, store.MarkProcessed(ctx, "projections", "evt-2", time.Minute))
+	assert.NotContains(t, store.expiresAt, "projections/evt-1")
+}
+
+func TestEventHandlerRegistry_HandleContinuesPublisherTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	ctx, publish := provider.Tracer("test").Start(context.Background(), "publish")
+	event := NewEvent(uuid.New().String(), "invoice", "created", "tenant-1", "user-1", nil).InjectTraceContext(ctx)
+	publish.End()
+	require.NotEmpty(t, event.Metadata["traceparent"])
+
+	payload, err := event.ToJSON()
+	require.NoError(t, err)
+	received, err := EventFromJSON(payload)
+	require.NoError(t, err)
+
+	var handlerSpan trace.SpanContext
+	registry := NewEventHandlerRegistry()
+	registry.Register("created", func(ctx context.Context, e *EventEnvelope) error {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return nil
+	})
+	require.Empty(t, registry.Handle(context.Background(), received))
+
+	assert.Equal(t, publish.SpanContext().TraceID(), handlerSpan.TraceID())
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "event.handle created", spans[1].Name())
+	assert.Equal(t, publish.SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Equal(t, handlerSpan.SpanID(), spans[1].SpanContext().SpanID())
+}
+
+func TestCatalog_ProjectionsConsumeCataloguedEvents(t *testing.T) {
+	for name, registry := range map[string]*EventHandlerRegistry{
+		"client":  ClientProjections(nil, nil, nil),
+		"invoice": InvoiceProjections(nil, nil, nil, nil, nil),
+		"payment": PaymentProjections(nil, nil, nil, nil, nil),
+	} {
+		for _, eventType := range registry.EventTypes() {
+			_, ok := LookupSchema(eventType)
+			assert.True(t, ok, "%s projections consume %s, which is not in the catalog", name, eventType)
+		}
+	}
+}
+
+func TestCatalog_Entries(t *testing.T) {
+	catalog := NewCatalog("invoice-service", InvoiceEvents, []string{"ClientUpdated", "legacy.event"})
+
+	require.Len(t, catalog.Publishes, len(InvoiceEvents))
+	assert.Equal(t, "evt.invoice.invoice.created", catalog.Publishes[0].Subject)
+	assert.Equal(t, 1, catalog.Publishes[0].Version)
+
+	require.Len(t, catalog.Consumes, 2)
+	assert.Equal(t, "evt.Client.ClientUpdated", catalog.Consumes[0].Subject)
+	assert.Equal(t, "legacy.event", catalog.Consumes[1].Type)
+	assert.Empty(t, catalog.Consumes[1].Subject)
+}
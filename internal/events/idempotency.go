@@ -0,0 +1,80 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultConsumerName      = "default"
+	DefaultProcessedEventTTL = 24 * time.Hour
+)
+
+// ProcessedEventStore remembers which events a consumer has already applied.
+// Records only need to outlive the redelivery window, so stores may expire
+// them after the given TTL.
+type ProcessedEventStore interface {
+	IsProcessed(ctx context.Context, consumer, eventID string) (bool, error)
+	MarkProcessed(ctx context.Context, consumer, eventID string, ttl time.Duration) error
+}
+
+// MemoryProcessedEventStore is a process-local ProcessedEventStore. It is the
+// registry default and only deduplicates redeliveries to the same instance.
+type MemoryProcessedEventStore struct {
+	mu        sync.Mutex
+	expiresAt map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryProcessedEventStore() *MemoryProcessedEventStore {
+	return &MemoryProcessedEventStore{
+		expiresAt: make(map[string]time.Time),
+		now:       time.Now,
+	}
+}
+
+func (s *MemoryProcessedEventStore) IsProcessed(ctx context.Context, consumer, eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.expiresAt[consumer+"/"+eventID]
+	return ok && s.now().Before(expiresAt), nil
+}
+
+func (s *MemoryProcessedEventStore) MarkProcessed(ctx context.Context, consumer, eventID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.expiresAt[consumer+"/"+eventID] = now.Add(ttl)
+
+	// Compact at most once per TTL so marking stays cheap.
+	if now.Sub(s.lastSweep) >= ttl {
+		for key, expiresAt := range s.expiresAt {
+			if !now.Before(expiresAt) {
+				delete(s.expiresAt, key)
+			}
+		}
+		s.lastSweep = now
+	}
+	return nil
+}
+
+// WithProcessedEvents replaces the registry's processed-event tracking.
+// consumer must be stable across restarts and unique per projection, since
+// it namespaces the records in a shared store.
+func (r *EventHandlerRegistry) WithProcessedEvents(store ProcessedEventStore, consumer string, ttl time.Duration) *EventHandlerRegistry {
+	r.processed = store
+	r.consumer = consumer
+	r.ttl = ttl
+	return r
+}
+
+// handlerConsumer identifies a single registered handler, so that when one
+// handler fails only that handler runs again on redelivery.
+func (r *EventHandlerRegistry) handlerConsumer(eventType string, index int) string {
+	return r.consumer + "/" + eventType + "#" + strconv.Itoa(index)
+}
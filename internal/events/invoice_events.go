@@ -2,36 +2,73 @@ package events
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ims-erp/system/internal/domain"
 	"github.com/ims-erp/system/internal/repository"
 	"github.com/ims-erp/system/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// InvoiceEventHandler projects invoice events into one invoice_read document
+// per invoice, carrying its lines, totals and activity. The client's name
+// and ownership are denormalized from the client read model so invoice lists
+// can show, search and restrict by them without a join.
 type InvoiceEventHandler struct {
 	readModelStore *repository.ReadModelStore
+	clients        *repository.ReadModelStore
 	cache          *repository.Cache
 	logger         *logger.Logger
 	tracer         trace.Tracer
 }
 
+// NewInvoiceEventHandler creates the handler. clients is the client read
+// model used to look up client names; it may be nil, leaving names empty.
 func NewInvoiceEventHandler(
 	readModelStore *repository.ReadModelStore,
+	clients *repository.ReadModelStore,
 	cache *repository.Cache,
 	log *logger.Logger,
 ) *InvoiceEventHandler {
 	return &InvoiceEventHandler{
 		readModelStore: readModelStore,
+		clients:        clients,
 		cache:          cache,
 		logger:         log,
 		tracer:         otel.Tracer("invoice-event-handler"),
 	}
 }
 
+// client returns the client's current name and ownership, empty if it is
+// unknown. A missing name is not worth failing the projection for:
+// ClientUpdated and ClientOwnerAssigned fill them in later.
+func (h *InvoiceEventHandler) client(ctx context.Context, tenantID, clientID string) (string, domain.Ownership) {
+	if h.clients == nil || clientID == "" {
+		return "", domain.Ownership{}
+	}
+	result, err := h.clients.FindOne(ctx, map[string]interface{}{
+		"_id":      clientID,
+		"tenantId": tenantID,
+	})
+	if err != nil {
+		h.logger.New(ctx).Warn("Failed to look up client name", "error", err, "client_id", clientID)
+		return "", domain.Ownership{}
+	}
+	if doc, ok := result.(bson.M); ok {
+		name, _ := doc["name"].(string)
+		ownerID, _ := doc["ownerId"].(string)
+		territory, _ := doc["territory"].(string)
+		return name, domain.Ownership{OwnerID: ownerID, Territory: territory}
+	}
+	return "", domain.Ownership{}
+}
+
 func (h *InvoiceEventHandler) HandleInvoiceCreated(ctx context.Context, event *EventEnvelope) error {
 	ctx, span := h.tracer.Start(ctx, "handle_invoice_created",
 		trace.WithAttributes(
@@ -41,55 +78,36 @@ func (h *InvoiceEventHandler) HandleInvoiceCreated(ctx context.Context, event *E
 	)
 	defer span.End()
 
-	dueDate := getTime(event.Data, "dueDate")
-
-	summary := InvoiceSummary{
-		ID:            event.AggregateID,
-		TenantID:      event.TenantID,
-		InvoiceNumber: getString(event.Data, "invoiceNumber"),
-		ClientID:      getString(event.Data, "clientId"),
-		Type:          getString(event.Data, "type"),
-		Status:        getString(event.Data, "status"),
-		Currency:      getString(event.Data, "currency"),
-		Subtotal:      getString(event.Data, "subtotal"),
-		TaxTotal:      getString(event.Data, "taxTotal"),
-		DiscountTotal: "0",
-		Total:         getString(event.Data, "total"),
-		AmountPaid:    "0",
-		AmountDue:     getString(event.Data, "total"),
-		PaymentTerm:   getString(event.Data, "paymentTerm"),
-		DueDate:       dueDate,
-		IssueDate:     event.Timestamp,
-		LineCount:     0,
-		Notes:         getString(event.Data, "notes"),
-		CreatedAt:     event.Timestamp,
-		UpdatedAt:     event.Timestamp,
+	issueDate := getTime(event.Data, "issueDate")
+	if issueDate.IsZero() {
+		issueDate = event.Timestamp
 	}
+	clientID := getString(event.Data, "clientId")
+	clientName, ownership := h.client(ctx, event.TenantID, clientID)
 
-	if err := h.readModelStore.Save(ctx, summary); err != nil {
-		span.RecordError(err)
-		return err
-	}
-
-	detail := InvoiceDetail{
+	invoice := InvoiceDetail{
 		ID:            event.AggregateID,
 		TenantID:      event.TenantID,
 		InvoiceNumber: getString(event.Data, "invoiceNumber"),
-		ClientID:      getString(event.Data, "clientId"),
+		ClientID:      clientID,
+		ClientName:    clientName,
 		Type:          getString(event.Data, "type"),
 		Status:        getString(event.Data, "status"),
 		Currency:      getString(event.Data, "currency"),
-		Subtotal:      getString(event.Data, "subtotal"),
-		TaxTotal:      getString(event.Data, "taxTotal"),
-		Total:         getString(event.Data, "total"),
+		Subtotal:      getDecimal(event.Data, "subtotal"),
+		TaxTotal:      getDecimal(event.Data, "taxTotal"),
+		DiscountTotal: "0",
+		Total:         getDecimal(event.Data, "total"),
 		AmountPaid:    "0",
-		AmountDue:     getString(event.Data, "total"),
+		AmountDue:     getDecimal(event.Data, "total"),
 		PaymentTerm:   getString(event.Data, "paymentTerm"),
-		DueDate:       dueDate,
-		IssueDate:     event.Timestamp,
+		DueDate:       getTime(event.Data, "dueDate"),
+		IssueDate:     issueDate,
 		Lines:         []InvoiceLineSummary{},
+		LineCount:     0,
 		Notes:         getString(event.Data, "notes"),
 		Terms:         getString(event.Data, "terms"),
+		BillingPeriod: getString(event.Data, "billingPeriod"),
 		ActivityLog: []InvoiceActivity{
 			{
 				Action:    "created",
@@ -97,18 +115,26 @@ func (h *InvoiceEventHandler) HandleInvoiceCreated(ctx context.Context, event *E
 				UserID:    event.UserID,
 			},
 		},
+		Version:   event.Version,
 		CreatedAt: event.Timestamp,
 		UpdatedAt: event.Timestamp,
+		Ownership: ownership,
 	}
 
-	if err := h.readModelStore.Save(ctx, detail); err != nil {
+	if err := h.readModelStore.Save(ctx, invoice); err != nil {
+		if errors.Is(err, repository.ErrReadModelExists) {
+			// Redelivered; the invoice was projected the first time.
+			return nil
+		}
 		span.RecordError(err)
 		return err
 	}
 
+	evictCached(ctx, h.cache, h.logger, event)
+
 	h.logger.New(ctx).Info("Invoice created in read model",
 		"invoice_id", event.AggregateID,
-		"invoice_number", summary.InvoiceNumber,
+		"invoice_number", invoice.InvoiceNumber,
 		"tenant_id", event.TenantID,
 	)
 
@@ -135,10 +161,19 @@ func (h *InvoiceEventHandler) HandleLineItemAdded(ctx context.Context, event *Ev
 		Description: getString(event.Data, "description"),
 		Quantity:    getString(event.Data, "quantity"),
 		UnitPrice:   getString(event.Data, "unitPrice"),
-		Total:       "0",
+		Discount:    getString(event.Data, "discount"),
+		TaxRate:     getString(event.Data, "taxRate"),
+		TaxCode:     getString(event.Data, "taxCode"),
+		TaxAmount:   getString(event.Data, "taxAmount"),
+		Total:       getDecimal(event.Data, "lineTotal"),
+		ProductID:   getString(event.Data, "productId"),
+		SortOrder:   getInt(event.Data, "sortOrder"),
+		OrderID:     getString(event.Data, "orderId"),
+		OrderNumber: getString(event.Data, "orderNumber"),
 	}
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"subtotal":  getString(event.Data, "subtotal"),
 			"taxTotal":  getString(event.Data, "taxTotal"),
@@ -159,9 +194,7 @@ func (h *InvoiceEventHandler) HandleLineItemAdded(ctx context.Context, event *Ev
 		return err
 	}
 
-	h.cache.Delete(ctx, "invoice:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "invoice:summary:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "invoice:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Debug("Line item added to invoice read model",
 		"invoice_id", event.AggregateID,
@@ -187,6 +220,7 @@ func (h *InvoiceEventHandler) HandleLineItemRemoved(ctx context.Context, event *
 	lineID := getString(event.Data, "lineId")
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"subtotal":  getString(event.Data, "subtotal"),
 			"total":     getString(event.Data, "total"),
@@ -208,8 +242,7 @@ func (h *InvoiceEventHandler) HandleLineItemRemoved(ctx context.Context, event *
 		return err
 	}
 
-	h.cache.Delete(ctx, "invoice:detail:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "invoice:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Debug("Line item removed from invoice read model",
 		"invoice_id", event.AggregateID,
@@ -232,14 +265,20 @@ func (h *InvoiceEventHandler) HandleInvoiceFinalized(ctx context.Context, event
 		"tenantId": event.TenantID,
 	}
 
+	set := map[string]interface{}{
+		"status":    string(domain.InvoiceStatusPending),
+		"total":     getString(event.Data, "total"),
+		"amountDue": getString(event.Data, "amountDue"),
+		"dueDate":   getTime(event.Data, "dueDate"),
+		"updatedAt": event.Timestamp,
+	}
+	if conversion := getConversion(event.Data); conversion != nil {
+		set["conversion"] = conversion
+	}
+
 	update := map[string]interface{}{
-		"$set": map[string]interface{}{
-			"status":    string(domain.InvoiceStatusPending),
-			"total":     getString(event.Data, "total"),
-			"amountDue": getString(event.Data, "amountDue"),
-			"dueDate":   getTime(event.Data, "dueDate"),
-			"updatedAt": event.Timestamp,
-		},
+		"$max": map[string]interface{}{"version": event.Version},
+		"$set": set,
 		"$push": map[string]interface{}{
 			"activityLog": InvoiceActivity{
 				Action:    "finalized",
@@ -254,9 +293,7 @@ func (h *InvoiceEventHandler) HandleInvoiceFinalized(ctx context.Context, event
 		return err
 	}
 
-	h.cache.Delete(ctx, "invoice:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "invoice:summary:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "invoice:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Info("Invoice finalized in read model",
 		"invoice_id", event.AggregateID,
@@ -278,12 +315,19 @@ func (h *InvoiceEventHandler) HandleInvoiceSent(ctx context.Context, event *Even
 		"tenantId": event.TenantID,
 	}
 
+	set := map[string]interface{}{
+		"status":    string(domain.InvoiceStatusSent),
+		"sentDate":  getTime(event.Data, "sentDate"),
+		"updatedAt": event.Timestamp,
+	}
+	if conversion := getConversion(event.Data); conversion != nil {
+		// Drafts sent straight away are finalized by being sent.
+		set["conversion"] = conversion
+	}
+
 	update := map[string]interface{}{
-		"$set": map[string]interface{}{
-			"status":    string(domain.InvoiceStatusSent),
-			"sentDate":  getTime(event.Data, "sentDate"),
-			"updatedAt": event.Timestamp,
-		},
+		"$max": map[string]interface{}{"version": event.Version},
+		"$set": set,
 		"$push": map[string]interface{}{
 			"activityLog": InvoiceActivity{
 				Action:    "sent",
@@ -298,8 +342,7 @@ func (h *InvoiceEventHandler) HandleInvoiceSent(ctx context.Context, event *Even
 		return err
 	}
 
-	h.cache.Delete(ctx, "invoice:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "invoice:summary:"+event.AggregateID)
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Info("Invoice sent in read model",
 		"invoice_id", event.AggregateID,
@@ -324,6 +367,7 @@ func (h *InvoiceEventHandler) HandleInvoiceVoided(ctx context.Context, event *Ev
 	reason := getString(event.Data, "reason")
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"status":    string(domain.InvoiceStatusCancelled),
 			"updatedAt": event.Timestamp,
@@ -343,9 +387,7 @@ func (h *InvoiceEventHandler) HandleInvoiceVoided(ctx context.Context, event *Ev
 		return err
 	}
 
-	h.cache.Delete(ctx, "invoice:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "invoice:summary:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "invoice:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Info("Invoice voided in read model",
 		"invoice_id", event.AggregateID,
@@ -375,6 +417,7 @@ func (h *InvoiceEventHandler) HandlePaymentRecorded(ctx context.Context, event *
 	}
 
 	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
 		"$set": map[string]interface{}{
 			"amountPaid": getString(event.Data, "amountPaid"),
 			"amountDue":  getString(event.Data, "amountDue"),
@@ -400,9 +443,7 @@ func (h *InvoiceEventHandler) HandlePaymentRecorded(ctx context.Context, event *
 		return err
 	}
 
-	h.cache.Delete(ctx, "invoice:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "invoice:summary:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "invoice:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Info("Payment recorded in invoice read model",
 		"invoice_id", event.AggregateID,
@@ -413,6 +454,278 @@ func (h *InvoiceEventHandler) HandlePaymentRecorded(ctx context.Context, event *
 	return nil
 }
 
+// HandlePaymentApplication records a payment applied to the invoice, or
+// unapplied from it, with the invoice's applications and balances after.
+func (h *InvoiceEventHandler) HandlePaymentApplication(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_payment_application",
+		trace.WithAttributes(
+			attribute.String("invoice_id", event.AggregateID),
+			attribute.String("event_type", event.Type),
+		),
+	)
+	defer span.End()
+
+	action := "payment_applied"
+	details := "Payment of " + getString(event.Data, "amount") + " applied"
+	if event.Type == "invoice.payment_unapplied" {
+		action = "payment_unapplied"
+		details = "Payment of " + getString(event.Data, "amount") + " unapplied: " + getString(event.Data, "reason")
+	}
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+
+	status := getString(event.Data, "status")
+	paidDate := time.Time{}
+	if status == string(domain.InvoiceStatusPaid) {
+		paidDate = event.Timestamp
+	}
+	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
+		"$set": map[string]interface{}{
+			"amountPaid":          getString(event.Data, "amountPaid"),
+			"amountDue":           getString(event.Data, "amountDue"),
+			"status":              status,
+			"paidDate":            paidDate,
+			"paymentApplications": getApplications(event.Data),
+			"updatedAt":           event.Timestamp,
+		},
+		"$push": map[string]interface{}{
+			"activityLog": InvoiceActivity{
+				Action:    action,
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+				Details:   details,
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	h.logger.New(ctx).Info("Payment application recorded in invoice read model",
+		"invoice_id", event.AggregateID,
+		"payment_id", getString(event.Data, "paymentId"),
+		"amount_due", getString(event.Data, "amountDue"),
+	)
+
+	return nil
+}
+
+// HandleCreditApplied records credit applied from a credit note to the
+// invoice, which settles it like a payment.
+func (h *InvoiceEventHandler) HandleCreditApplied(ctx context.Context, event *EventEnvelope) error {
+	allocation := CreditAllocationView{
+		ID:               getString(event.Data, "allocationId"),
+		CreditNoteID:     getString(event.Data, "creditNoteId"),
+		CreditNoteNumber: getString(event.Data, "creditNoteNumber"),
+		InvoiceID:        event.AggregateID,
+		InvoiceNumber:    getString(event.Data, "invoiceNumber"),
+		Amount:           getString(event.Data, "amount"),
+		AllocatedAt:      event.Timestamp,
+	}
+	details := "Credit of " + allocation.Amount + " applied from " + allocation.CreditNoteNumber
+	return h.allocateCredit(ctx, event, "credit_applied", details, []CreditAllocationView{allocation})
+}
+
+// HandleCreditAllocated records the invoices a credit note was applied to
+// and the credit left unapplied.
+func (h *InvoiceEventHandler) HandleCreditAllocated(ctx context.Context, event *EventEnvelope) error {
+	allocations := getAllocations(event.Data)
+	for i := range allocations {
+		allocations[i].CreditNoteID = event.AggregateID
+		allocations[i].CreditNoteNumber = getString(event.Data, "invoiceNumber")
+		allocations[i].AllocatedAt = event.Timestamp
+	}
+	details := fmt.Sprintf("Credit of %s applied to %d invoices", getString(event.Data, "amount"), len(allocations))
+	return h.allocateCredit(ctx, event, "credit_allocated", details, allocations)
+}
+
+func (h *InvoiceEventHandler) allocateCredit(ctx context.Context, event *EventEnvelope, action, details string, allocations []CreditAllocationView) error {
+	ctx, span := h.tracer.Start(ctx, "handle_"+action,
+		trace.WithAttributes(
+			attribute.String("invoice_id", event.AggregateID),
+		),
+	)
+	defer span.End()
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+
+	status := getString(event.Data, "status")
+	set := map[string]interface{}{
+		"amountPaid": getString(event.Data, "amountPaid"),
+		"amountDue":  getString(event.Data, "amountDue"),
+		"status":     status,
+		"updatedAt":  event.Timestamp,
+	}
+	if status == string(domain.InvoiceStatusPaid) {
+		set["paidDate"] = event.Timestamp
+	}
+	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
+		"$set": set,
+		"$push": map[string]interface{}{
+			"allocations": map[string]interface{}{"$each": allocations},
+			"activityLog": InvoiceActivity{
+				Action:    action,
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+				Details:   details,
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	h.logger.New(ctx).Info("Credit allocation recorded in invoice read model",
+		"invoice_id", event.AggregateID,
+		"amount_paid", getString(event.Data, "amountPaid"),
+		"amount_due", getString(event.Data, "amountDue"),
+	)
+
+	return nil
+}
+
+// HandleReminderSent counts a payment reminder sent for the invoice.
+func (h *InvoiceEventHandler) HandleReminderSent(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_invoice_reminder_sent",
+		trace.WithAttributes(
+			attribute.String("invoice_id", event.AggregateID),
+		),
+	)
+	defer span.End()
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+
+	details := fmt.Sprintf("Reminder %v sent", event.Data["reminderNumber"])
+	if manual, _ := event.Data["manual"].(bool); manual {
+		details += " manually"
+	}
+
+	update := map[string]interface{}{
+		"$max": map[string]interface{}{"version": event.Version},
+		"$inc": map[string]interface{}{"remindersSent": 1},
+		"$set": map[string]interface{}{
+			"lastReminderAt": getTime(event.Data, "sentAt"),
+			"updatedAt":      event.Timestamp,
+		},
+		"$push": map[string]interface{}{
+			"activityLog": InvoiceActivity{
+				Action:    "reminder_sent",
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+				Details:   details,
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	h.logger.New(ctx).Info("Invoice reminder recorded in read model",
+		"invoice_id", event.AggregateID,
+	)
+
+	return nil
+}
+
+// HandleClientUpdated refreshes the client name denormalized into the
+// client's invoices.
+func (h *InvoiceEventHandler) HandleClientUpdated(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_client_updated",
+		trace.WithAttributes(
+			attribute.String("client_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	name := getString(event.Data, "name")
+	if name == "" {
+		return nil
+	}
+
+	filter := map[string]interface{}{
+		"clientId": event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+	update := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"clientName": name,
+		},
+	}
+
+	if err := h.readModelStore.UpdateMany(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	// Lists are evicted now; cached single-invoice views age out.
+	if err := h.cache.InvalidateEntity(ctx, repository.CacheEntity("invoice"), event.TenantID); err != nil {
+		h.logger.New(ctx).Warn("Failed to evict cached invoice lists", "error", err)
+	}
+
+	return nil
+}
+
+// HandleClientOwnerAssigned hands the client's invoices to its new owner
+// and territory.
+func (h *InvoiceEventHandler) HandleClientOwnerAssigned(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_client_owner_assigned",
+		trace.WithAttributes(
+			attribute.String("client_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	filter := map[string]interface{}{
+		"clientId": event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+	update := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"ownerId":   getString(event.Data, "ownerId"),
+			"territory": getString(event.Data, "territory"),
+		},
+	}
+
+	if err := h.readModelStore.UpdateMany(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	// Every cached view of the client's invoices may now be visible to
+	// someone else.
+	if err := h.cache.DeletePattern(ctx, "invoice:*"); err != nil {
+		h.logger.New(ctx).Warn("Failed to evict cached invoices", "error", err)
+	}
+
+	return nil
+}
+
+// InvoiceSummary is the list view of an invoice_read document.
 type InvoiceSummary struct {
 	ID            string    `bson:"_id" json:"id"`
 	TenantID      string    `bson:"tenantId" json:"tenantId"`
@@ -435,10 +748,16 @@ type InvoiceSummary struct {
 	PaidDate      time.Time `bson:"paidDate" json:"paidDate,omitempty"`
 	LineCount     int       `bson:"lineCount" json:"lineCount"`
 	Notes         string    `bson:"notes" json:"notes,omitempty"`
+	Version       int64     `bson:"version" json:"version"`
 	CreatedAt     time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt     time.Time `bson:"updatedAt" json:"updatedAt"`
+
+	domain.Ownership `bson:",inline"`
 }
 
+// InvoiceDetail is the full invoice_read document. Version is the version of
+// the invoice the last applied event produced and is served as the ETag;
+// events only ever raise it, so a redelivered event cannot roll it back.
 type InvoiceDetail struct {
 	ID            string               `bson:"_id" json:"id"`
 	TenantID      string               `bson:"tenantId" json:"tenantId"`
@@ -460,11 +779,105 @@ type InvoiceDetail struct {
 	SentDate      time.Time            `bson:"sentDate" json:"sentDate,omitempty"`
 	PaidDate      time.Time            `bson:"paidDate" json:"paidDate,omitempty"`
 	Lines         []InvoiceLineSummary `bson:"lines" json:"lines"`
+	Conversion    *ConversionView      `bson:"conversion,omitempty" json:"conversion,omitempty"`
+	LineCount     int                  `bson:"lineCount" json:"lineCount"`
 	Notes         string               `bson:"notes" json:"notes,omitempty"`
 	Terms         string               `bson:"terms" json:"terms,omitempty"`
 	ActivityLog   []InvoiceActivity    `bson:"activityLog" json:"activityLog,omitempty"`
-	CreatedAt     time.Time            `bson:"createdAt" json:"createdAt"`
-	UpdatedAt     time.Time            `bson:"updatedAt" json:"updatedAt"`
+	// Allocations are the credit applied to the invoice or, on a credit
+	// note, from it.
+	Allocations []CreditAllocationView `bson:"allocations,omitempty" json:"allocations,omitempty"`
+	Version     int64                  `bson:"version" json:"version"`
+	CreatedAt   time.Time              `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time              `bson:"updatedAt" json:"updatedAt"`
+	// RemindersSent counts the payment reminders sent for the invoice, the
+	// last at LastReminderAt.
+	RemindersSent  int       `bson:"remindersSent,omitempty" json:"remindersSent,omitempty"`
+	LastReminderAt time.Time `bson:"lastReminderAt,omitempty" json:"lastReminderAt,omitempty"`
+	// BillingPeriod is the period a consolidated invoice bills.
+	BillingPeriod string `bson:"billingPeriod,omitempty" json:"billingPeriod,omitempty"`
+	// PaymentApplications are the payments applied to the invoice, with
+	// those unapplied since.
+	PaymentApplications []PaymentApplicationView `bson:"paymentApplications,omitempty" json:"paymentApplications,omitempty"`
+
+	domain.Ownership `bson:",inline"`
+}
+
+// ConversionView is an amount converted into the tenant's reporting
+// currency, with the amount and rate as decimal strings.
+type ConversionView struct {
+	Currency string    `bson:"currency" json:"currency"`
+	Amount   string    `bson:"amount" json:"amount"`
+	Rate     string    `bson:"rate" json:"rate"`
+	RateDate time.Time `bson:"rateDate" json:"rateDate"`
+	Source   string    `bson:"source" json:"source"`
+}
+
+// CreditAllocationView is credit applied from a credit note to an
+// invoice, with the amount as a decimal string.
+type CreditAllocationView struct {
+	ID               string    `bson:"id" json:"id"`
+	CreditNoteID     string    `bson:"creditNoteId" json:"creditNoteId"`
+	CreditNoteNumber string    `bson:"creditNoteNumber" json:"creditNoteNumber"`
+	InvoiceID        string    `bson:"invoiceId" json:"invoiceId"`
+	InvoiceNumber    string    `bson:"invoiceNumber" json:"invoiceNumber"`
+	Amount           string    `bson:"amount" json:"amount"`
+	AllocatedAt      time.Time `bson:"allocatedAt" json:"allocatedAt"`
+}
+
+// getAllocations reads the allocations carried by invoice.credit_allocated.
+func getAllocations(data map[string]interface{}) []CreditAllocationView {
+	encoded, err := json.Marshal(data["allocations"])
+	if err != nil {
+		return nil
+	}
+	var allocations []struct {
+		ID            string `json:"allocationId"`
+		InvoiceID     string `json:"invoiceId"`
+		InvoiceNumber string `json:"invoiceNumber"`
+		Amount        string `json:"amount"`
+	}
+	if err := json.Unmarshal(encoded, &allocations); err != nil {
+		return nil
+	}
+	views := make([]CreditAllocationView, len(allocations))
+	for i, allocation := range allocations {
+		views[i] = CreditAllocationView{
+			ID:            allocation.ID,
+			InvoiceID:     allocation.InvoiceID,
+			InvoiceNumber: allocation.InvoiceNumber,
+			Amount:        allocation.Amount,
+		}
+	}
+	return views
+}
+
+// getConversion reads the conversion carried by an invoice or payment
+// event, or nil when it carries none.
+func getInt(data map[string]interface{}, key string) int {
+	switch v := data[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func getConversion(data map[string]interface{}) *ConversionView {
+	raw, ok := data["conversion"]
+	if !ok || raw == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var conversion ConversionView
+	if err := json.Unmarshal(encoded, &conversion); err != nil || conversion.Currency == "" {
+		return nil
+	}
+	return &conversion
 }
 
 type InvoiceLineSummary struct {
@@ -474,10 +887,13 @@ type InvoiceLineSummary struct {
 	UnitPrice   string `bson:"unitPrice" json:"unitPrice"`
 	Discount    string `bson:"discount" json:"discount,omitempty"`
 	TaxRate     string `bson:"taxRate" json:"taxRate,omitempty"`
+	TaxCode     string `bson:"taxCode,omitempty" json:"taxCode,omitempty"`
 	TaxAmount   string `bson:"taxAmount" json:"taxAmount,omitempty"`
 	Total       string `bson:"total" json:"total"`
 	ProductID   string `bson:"productId" json:"productId,omitempty"`
 	SortOrder   int    `bson:"sortOrder" json:"sortOrder"`
+	OrderID     string `bson:"orderId,omitempty" json:"orderId,omitempty"`
+	OrderNumber string `bson:"orderNumber,omitempty" json:"orderNumber,omitempty"`
 }
 
 type InvoiceActivity struct {
@@ -0,0 +1,364 @@
+package events
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Invoice summaries roll the invoice read model up per tenant and day and
+// per tenant and client, so revenue and aging reports read a document per
+// day or client instead of every invoice.
+const (
+	InvoiceDaySummaryCollection    = "invoice_day_summaries"
+	InvoiceClientSummaryCollection = "invoice_client_summaries"
+)
+
+// OutstandingInvoiceStatuses are the statuses of invoices aged as
+// receivables.
+var OutstandingInvoiceStatuses = []string{"sent", "partial", "overdue"}
+
+// InvoiceDaySummary totals the invoices a tenant issued on one UTC day, as
+// they stand now. Amounts are decimal strings, as in the read model.
+type InvoiceDaySummary struct {
+	ID            string    `bson:"_id" json:"id"`
+	TenantID      string    `bson:"tenantId" json:"tenantId"`
+	Day           time.Time `bson:"day" json:"day"`
+	InvoiceCount  int       `bson:"invoiceCount" json:"invoiceCount"`
+	Total         string    `bson:"total" json:"total"`
+	AmountPaid    string    `bson:"amountPaid" json:"amountPaid"`
+	AmountDue     string    `bson:"amountDue" json:"amountDue"`
+	OverdueAmount string    `bson:"overdueAmount" json:"overdueAmount"`
+	UpdatedAt     time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Receivable is what is still due on a client's outstanding invoices due
+// at one time.
+type Receivable struct {
+	DueDate      time.Time `bson:"dueDate" json:"dueDate"`
+	InvoiceCount int       `bson:"invoiceCount" json:"invoiceCount"`
+	AmountDue    string    `bson:"amountDue" json:"amountDue"`
+}
+
+// InvoiceClientSummary totals a client's invoices as they stand now, with
+// its receivables by due date, earliest first.
+type InvoiceClientSummary struct {
+	ID           string       `bson:"_id" json:"id"`
+	TenantID     string       `bson:"tenantId" json:"tenantId"`
+	ClientID     string       `bson:"clientId" json:"clientId"`
+	ClientName   string       `bson:"clientName" json:"clientName,omitempty"`
+	InvoiceCount int          `bson:"invoiceCount" json:"invoiceCount"`
+	Total        string       `bson:"total" json:"total"`
+	AmountPaid   string       `bson:"amountPaid" json:"amountPaid"`
+	AmountDue    string       `bson:"amountDue" json:"amountDue"`
+	Receivables  []Receivable `bson:"receivables" json:"receivables"`
+	UpdatedAt    time.Time    `bson:"updatedAt" json:"updatedAt"`
+}
+
+// SummaryDay is the UTC day the invoice issued at t is summarized under.
+func SummaryDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func InvoiceDaySummaryID(tenantID string, day time.Time) string {
+	return tenantID + ":" + SummaryDay(day).Format("2006-01-02")
+}
+
+func InvoiceClientSummaryID(tenantID, clientID string) string {
+	return tenantID + ":" + clientID
+}
+
+type invoiceSums struct {
+	count   int
+	total   decimal.Decimal
+	paid    decimal.Decimal
+	due     decimal.Decimal
+	overdue decimal.Decimal
+}
+
+func (s *invoiceSums) add(invoice InvoiceSummary) {
+	due := readAmount(invoice.AmountDue)
+	s.count++
+	s.total = s.total.Add(readAmount(invoice.Total))
+	s.paid = s.paid.Add(readAmount(invoice.AmountPaid))
+	s.due = s.due.Add(due)
+	if invoice.Status == "overdue" {
+		s.overdue = s.overdue.Add(due)
+	}
+}
+
+type daySums struct {
+	invoiceSums
+	tenantID string
+	day      time.Time
+}
+
+type clientSums struct {
+	invoiceSums
+	tenantID    string
+	clientID    string
+	clientName  string
+	receivables map[time.Time]*invoiceSums
+}
+
+// InvoiceRollup sums invoices into their day and client summaries.
+type InvoiceRollup struct {
+	days    map[string]*daySums
+	clients map[string]*clientSums
+}
+
+func NewInvoiceRollup() *InvoiceRollup {
+	return &InvoiceRollup{
+		days:    make(map[string]*daySums),
+		clients: make(map[string]*clientSums),
+	}
+}
+
+// Add adds an invoice to the summaries of the day it was issued and of its
+// client.
+func (r *InvoiceRollup) Add(invoice InvoiceSummary) {
+	dayID := InvoiceDaySummaryID(invoice.TenantID, invoice.IssueDate)
+	day := r.days[dayID]
+	if day == nil {
+		day = &daySums{tenantID: invoice.TenantID, day: SummaryDay(invoice.IssueDate)}
+		r.days[dayID] = day
+	}
+	day.add(invoice)
+
+	clientID := InvoiceClientSummaryID(invoice.TenantID, invoice.ClientID)
+	client := r.clients[clientID]
+	if client == nil {
+		client = &clientSums{
+			tenantID:    invoice.TenantID,
+			clientID:    invoice.ClientID,
+			receivables: make(map[time.Time]*invoiceSums),
+		}
+		r.clients[clientID] = client
+	}
+	client.add(invoice)
+	if invoice.ClientName != "" {
+		client.clientName = invoice.ClientName
+	}
+	if isOutstanding(invoice.Status) {
+		due := invoice.DueDate.UTC()
+		receivable := client.receivables[due]
+		if receivable == nil {
+			receivable = &invoiceSums{}
+			client.receivables[due] = receivable
+		}
+		receivable.add(invoice)
+	}
+}
+
+// Days returns the day summaries, ordered by ID.
+func (r *InvoiceRollup) Days(updatedAt time.Time) []InvoiceDaySummary {
+	summaries := make([]InvoiceDaySummary, 0, len(r.days))
+	for id, sums := range r.days {
+		summaries = append(summaries, InvoiceDaySummary{
+			ID:            id,
+			TenantID:      sums.tenantID,
+			Day:           sums.day,
+			InvoiceCount:  sums.count,
+			Total:         sums.total.String(),
+			AmountPaid:    sums.paid.String(),
+			AmountDue:     sums.due.String(),
+			OverdueAmount: sums.overdue.String(),
+			UpdatedAt:     updatedAt,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	return summaries
+}
+
+// Clients returns the client summaries, ordered by ID.
+func (r *InvoiceRollup) Clients(updatedAt time.Time) []InvoiceClientSummary {
+	summaries := make([]InvoiceClientSummary, 0, len(r.clients))
+	for id, sums := range r.clients {
+		receivables := make([]Receivable, 0, len(sums.receivables))
+		for due, receivable := range sums.receivables {
+			receivables = append(receivables, Receivable{
+				DueDate:      due,
+				InvoiceCount: receivable.count,
+				AmountDue:    receivable.due.String(),
+			})
+		}
+		sort.Slice(receivables, func(i, j int) bool { return receivables[i].DueDate.Before(receivables[j].DueDate) })
+		summaries = append(summaries, InvoiceClientSummary{
+			ID:           id,
+			TenantID:     sums.tenantID,
+			ClientID:     sums.clientID,
+			ClientName:   sums.clientName,
+			InvoiceCount: sums.count,
+			Total:        sums.total.String(),
+			AmountPaid:   sums.paid.String(),
+			AmountDue:    sums.due.String(),
+			Receivables:  receivables,
+			UpdatedAt:    updatedAt,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	return summaries
+}
+
+func isOutstanding(status string) bool {
+	for _, outstanding := range OutstandingInvoiceStatuses {
+		if status == outstanding {
+			return true
+		}
+	}
+	return false
+}
+
+// readAmount reads an amount of a read model; an invalid amount counts as
+// zero.
+func readAmount(amount string) decimal.Decimal {
+	value, err := decimal.NewFromString(amount)
+	if err != nil {
+		return decimal.Zero
+	}
+	return value
+}
+
+// InvoiceSummaryProjector keeps the invoice summaries of the invoice read
+// model. It registers after InvoiceEventHandler, reads the invoice an event
+// changed back from the read model, and sums the invoices of its day and
+// client again. Summing again rather than applying the change makes
+// redelivered and out-of-order events harmless.
+type InvoiceSummaryProjector struct {
+	invoices *repository.ReadModelStore
+	days     *repository.ReadModelStore
+	clients  *repository.ReadModelStore
+	logger   *logger.Logger
+	tracer   trace.Tracer
+}
+
+func NewInvoiceSummaryProjector(invoices, days, clients *repository.ReadModelStore, log *logger.Logger) *InvoiceSummaryProjector {
+	return &InvoiceSummaryProjector{
+		invoices: invoices,
+		days:     days,
+		clients:  clients,
+		logger:   log,
+		tracer:   otel.Tracer("invoice-summary-projector"),
+	}
+}
+
+// HandleInvoiceChanged sums the day and client of the event's invoice
+// again. An invoice not in the read model yet has nothing to sum.
+func (p *InvoiceSummaryProjector) HandleInvoiceChanged(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := p.tracer.Start(ctx, "summarize_invoice",
+		trace.WithAttributes(
+			attribute.String("invoice_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	result, err := p.invoices.FindOne(ctx, bson.M{"_id": event.AggregateID, "tenantId": event.TenantID})
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	invoices := decodeInvoiceSummaries([]interface{}{result})
+	if len(invoices) == 0 {
+		return nil
+	}
+	invoice := invoices[0]
+
+	if err := p.refreshDay(ctx, event.TenantID, invoice.IssueDate); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if err := p.refreshClient(ctx, event.TenantID, invoice.ClientID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// HandleClientUpdated sums the client's invoices again, after their client
+// name was updated.
+func (p *InvoiceSummaryProjector) HandleClientUpdated(ctx context.Context, event *EventEnvelope) error {
+	return p.refreshClient(ctx, event.TenantID, event.AggregateID)
+}
+
+func (p *InvoiceSummaryProjector) refreshDay(ctx context.Context, tenantID string, issued time.Time) error {
+	day := SummaryDay(issued)
+	results, err := p.invoices.Find(ctx, bson.M{
+		"tenantId":  tenantID,
+		"issueDate": bson.M{"$gte": day, "$lt": day.AddDate(0, 0, 1)},
+	})
+	if err != nil {
+		return err
+	}
+	rollup := NewInvoiceRollup()
+	for _, invoice := range decodeInvoiceSummaries(results) {
+		rollup.Add(invoice)
+	}
+	id := InvoiceDaySummaryID(tenantID, day)
+	summaries := rollup.Days(time.Now().UTC())
+	if len(summaries) == 0 {
+		return p.days.Delete(ctx, bson.M{"_id": id})
+	}
+	return upsertSummary(ctx, p.days, id, summaries[0])
+}
+
+func (p *InvoiceSummaryProjector) refreshClient(ctx context.Context, tenantID, clientID string) error {
+	results, err := p.invoices.Find(ctx, bson.M{"tenantId": tenantID, "clientId": clientID})
+	if err != nil {
+		return err
+	}
+	rollup := NewInvoiceRollup()
+	for _, invoice := range decodeInvoiceSummaries(results) {
+		rollup.Add(invoice)
+	}
+	id := InvoiceClientSummaryID(tenantID, clientID)
+	summaries := rollup.Clients(time.Now().UTC())
+	if len(summaries) == 0 {
+		return p.clients.Delete(ctx, bson.M{"_id": id})
+	}
+	return upsertSummary(ctx, p.clients, id, summaries[0])
+}
+
+// upsertSummary replaces the summary id with summary.
+func upsertSummary(ctx context.Context, store *repository.ReadModelStore, id string, summary interface{}) error {
+	data, err := bson.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	var set bson.M
+	if err := bson.Unmarshal(data, &set); err != nil {
+		return err
+	}
+	delete(set, "_id")
+	return store.Upsert(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+// decodeInvoiceSummaries decodes invoice read models, skipping those that
+// do not decode.
+func decodeInvoiceSummaries(results []interface{}) []InvoiceSummary {
+	var invoices []InvoiceSummary
+	for _, result := range results {
+		doc, ok := result.(bson.M)
+		if !ok {
+			continue
+		}
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		var invoice InvoiceSummary
+		if err := bson.Unmarshal(data, &invoice); err == nil {
+			invoices = append(invoices, invoice)
+		}
+	}
+	return invoices
+}
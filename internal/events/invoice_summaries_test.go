@@ -0,0 +1,51 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvoiceRollup(t *testing.T) {
+	issued := time.Date(2026, 10, 5, 22, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	due := time.Date(2026, 11, 4, 0, 0, 0, 0, time.UTC)
+	invoice := func(id, client, status, total, paid, amountDue string, issueDate, dueDate time.Time) InvoiceSummary {
+		return InvoiceSummary{
+			ID: id, TenantID: "tenant-1", ClientID: client, Status: status,
+			Total: total, AmountPaid: paid, AmountDue: amountDue,
+			IssueDate: issueDate, DueDate: dueDate,
+		}
+	}
+
+	rollup := NewInvoiceRollup()
+	rollup.Add(invoice("inv-1", "acme", "sent", "100.00", "0", "100.00", issued, due))
+	rollup.Add(invoice("inv-2", "acme", "overdue", "50", "20", "30", issued.Add(time.Hour), due))
+	rollup.Add(invoice("inv-3", "acme", "paid", "80", "80", "0", issued.AddDate(0, 0, 2), due))
+	named := invoice("inv-4", "globex", "draft", "10", "0", "10", issued, time.Time{})
+	named.ClientName = "Globex"
+	rollup.Add(named)
+
+	days := rollup.Days(issued)
+	require.Len(t, days, 2)
+	assert.Equal(t, "tenant-1:2026-10-05", days[0].ID, "22:30 CEST is still the 5th in UTC")
+	assert.Equal(t, 3, days[0].InvoiceCount)
+	assert.Equal(t, "160", days[0].Total)
+	assert.Equal(t, "20", days[0].AmountPaid)
+	assert.Equal(t, "140", days[0].AmountDue)
+	assert.Equal(t, "30", days[0].OverdueAmount)
+	assert.Equal(t, time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC), days[0].Day)
+	assert.Equal(t, "tenant-1:2026-10-07", days[1].ID)
+
+	clients := rollup.Clients(issued)
+	require.Len(t, clients, 2)
+	acme := clients[0]
+	assert.Equal(t, "acme", acme.ClientID)
+	assert.Equal(t, 3, acme.InvoiceCount)
+	assert.Equal(t, "230", acme.Total)
+	assert.Equal(t, []Receivable{{DueDate: due, InvoiceCount: 2, AmountDue: "130"}}, acme.Receivables,
+		"only sent, partial and overdue invoices are receivables")
+	assert.Equal(t, "Globex", clients[1].ClientName)
+	assert.Empty(t, clients[1].Receivables, "drafts are not aged")
+}
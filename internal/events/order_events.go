@@ -0,0 +1,86 @@
+package events
+
+import (
+	"github.com/ims-erp/system/internal/domain"
+)
+
+type OrderLineAddedEvent struct {
+	EventEnvelope
+}
+
+func NewOrderLineAddedEvent(order *domain.Order, line *domain.OrderLine, userID string) *OrderLineAddedEvent {
+	data := map[string]interface{}{
+		"lineId":     line.ID,
+		"productId":  line.ProductID,
+		"sku":        line.SKU,
+		"quantity":   line.Quantity,
+		"unitPrice":  line.UnitPrice.String(),
+		"discount":   line.Discount.String(),
+		"floorPrice": line.FloorPrice.String(),
+		"currency":   order.Currency,
+		"belowFloor": line.PriceOverride != nil,
+	}
+	if line.PriceOverride != nil {
+		data["overrideReason"] = line.PriceOverride.Reason
+	}
+
+	event := NewEvent(
+		order.ID.String(),
+		"Order",
+		"order.line_added",
+		order.TenantID.String(),
+		userID,
+		data,
+	)
+	return &OrderLineAddedEvent{*event}
+}
+
+type PriceOverrideApprovedEvent struct {
+	EventEnvelope
+}
+
+func NewPriceOverrideApprovedEvent(order *domain.Order, line *domain.OrderLine, userID string) *PriceOverrideApprovedEvent {
+	event := NewEvent(
+		order.ID.String(),
+		"Order",
+		"order.price_override_approved",
+		order.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"lineId":      line.ID,
+			"productId":   line.ProductID,
+			"unitPrice":   line.UnitPrice.String(),
+			"floorPrice":  line.FloorPrice.String(),
+			"currency":    order.Currency,
+			"reason":      line.PriceOverride.Reason,
+			"requestedBy": line.PriceOverride.RequestedBy,
+		},
+	)
+	return &PriceOverrideApprovedEvent{*event}
+}
+
+type DeliveryNoteGeneratedEvent struct {
+	EventEnvelope
+}
+
+// NewDeliveryNoteGeneratedEvent records on the order's timeline that a
+// delivery note or packing slip was generated for one of its shipments.
+func NewDeliveryNoteGeneratedEvent(order *domain.Order, shipment *domain.OrderFulfillment, doc *domain.Document, userID string) *DeliveryNoteGeneratedEvent {
+	event := NewEvent(
+		order.ID.String(),
+		"Order",
+		"order.delivery_note_generated",
+		order.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"shipmentId":         shipment.ID,
+			"trackingNumber":     shipment.TrackingNumber,
+			"carrier":            shipment.Carrier,
+			"deliveryNoteNumber": shipment.DeliveryNoteNumber,
+			"documentId":         doc.ID,
+			"documentType":       string(doc.Type),
+			"fileName":           doc.FileName,
+		},
+	)
+	return &DeliveryNoteGeneratedEvent{*event}
+}
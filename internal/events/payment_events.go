@@ -2,11 +2,14 @@ package events
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/ims-erp/system/internal/domain"
 	"github.com/ims-erp/system/internal/repository"
 	"github.com/ims-erp/system/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -14,24 +17,58 @@ import (
 
 type PaymentEventHandler struct {
 	readModelStore *repository.ReadModelStore
+	invoices       *repository.ReadModelStore
+	clients        *repository.ReadModelStore
 	cache          *repository.Cache
 	logger         *logger.Logger
 	tracer         trace.Tracer
 }
 
+// NewPaymentEventHandler projects payment events into readModelStore.
+// Invoice numbers, and client names and ownership, are denormalized from the
+// invoices and clients read models; either may be nil, leaving the fields
+// empty.
 func NewPaymentEventHandler(
 	readModelStore *repository.ReadModelStore,
+	invoices *repository.ReadModelStore,
+	clients *repository.ReadModelStore,
 	cache *repository.Cache,
 	log *logger.Logger,
 ) *PaymentEventHandler {
 	return &PaymentEventHandler{
 		readModelStore: readModelStore,
+		invoices:       invoices,
+		clients:        clients,
 		cache:          cache,
 		logger:         log,
 		tracer:         otel.Tracer("payment-event-handler"),
 	}
 }
 
+// lookupFields returns fields of the document with id in store, "" for each
+// if the document or field is unknown. A failed lookup is logged, not
+// returned: the payment is projected without the denormalized values.
+func (h *PaymentEventHandler) lookupFields(ctx context.Context, store *repository.ReadModelStore, tenantID, id string, fields ...string) []string {
+	values := make([]string, len(fields))
+	if store == nil || id == "" {
+		return values
+	}
+	result, err := store.FindOne(ctx, map[string]interface{}{
+		"_id":      id,
+		"tenantId": tenantID,
+	})
+	if err != nil {
+		h.logger.New(ctx).Warn("Failed to look up denormalized payment fields", "error", err, "fields", fields, "id", id)
+		return values
+	}
+	if doc, ok := result.(bson.M); ok {
+		for i, field := range fields {
+			values[i], _ = doc[field].(string)
+		}
+	}
+	return values
+}
+
 func (h *PaymentEventHandler) HandlePaymentCreated(ctx context.Context, event *EventEnvelope) error {
 	ctx, span := h.tracer.Start(ctx, "handle_payment_created",
 		trace.WithAttributes(
@@ -41,40 +78,28 @@ func (h *PaymentEventHandler) HandlePaymentCreated(ctx context.Context, event *E
 	)
 	defer span.End()
 
-	paymentSummary := PaymentSummary{
-		ID:          event.AggregateID,
-		TenantID:    event.TenantID,
-		InvoiceID:   getString(event.Data, "invoiceId"),
-		ClientID:    getString(event.Data, "clientId"),
-		Amount:      getString(event.Data, "amount"),
-		Currency:    getString(event.Data, "currency"),
-		Status:      string(domain.PaymentStatusPending),
-		Method:      getString(event.Data, "method"),
-		Provider:    getString(event.Data, "provider"),
-		Reference:   getString(event.Data, "reference"),
-		Description: getString(event.Data, "description"),
-		CreatedAt:   event.Timestamp,
-		UpdatedAt:   event.Timestamp,
-	}
-
-	if err := h.readModelStore.Save(ctx, paymentSummary); err != nil {
-		span.RecordError(err)
-		return err
-	}
+	invoiceID := getString(event.Data, "invoiceId")
+	clientID := getString(event.Data, "clientId")
+	client := h.lookupFields(ctx, h.clients, event.TenantID, clientID, "name", "ownerId", "territory")
 
+	// Summaries and details are read from the same document, so the detail,
+	// which carries every summary field, is the only one stored.
 	paymentDetail := PaymentDetail{
-		ID:          event.AggregateID,
-		TenantID:    event.TenantID,
-		InvoiceID:   getString(event.Data, "invoiceId"),
-		ClientID:    getString(event.Data, "clientId"),
-		Amount:      getString(event.Data, "amount"),
-		Currency:    getString(event.Data, "currency"),
-		Status:      string(domain.PaymentStatusPending),
-		Method:      getString(event.Data, "method"),
-		Provider:    getString(event.Data, "provider"),
-		Reference:   getString(event.Data, "reference"),
-		Description: getString(event.Data, "description"),
-		Metadata:    getMap(event.Data, "metadata"),
+		ID:            event.AggregateID,
+		TenantID:      event.TenantID,
+		InvoiceID:     invoiceID,
+		InvoiceNumber: h.lookupFields(ctx, h.invoices, event.TenantID, invoiceID, "invoiceNumber")[0],
+		ClientID:      clientID,
+		ClientName:    client[0],
+		Amount:        getString(event.Data, "amount"),
+		Currency:      getString(event.Data, "currency"),
+		Status:        string(domain.PaymentStatusPending),
+		Method:        getString(event.Data, "method"),
+		Provider:      getString(event.Data, "provider"),
+		Reference:     getString(event.Data, "reference"),
+		Description:   getString(event.Data, "description"),
+		Metadata:      getMap(event.Data, "metadata"),
+		Conversion:    getConversion(event.Data),
 		ActivityLog: []PaymentActivity{
 			{
 				Action:    "created",
@@ -84,18 +109,25 @@ func (h *PaymentEventHandler) HandlePaymentCreated(ctx context.Context, event *E
 		},
 		CreatedAt: event.Timestamp,
 		UpdatedAt: event.Timestamp,
+		Ownership: domain.Ownership{OwnerID: client[1], Territory: client[2]},
 	}
 
 	if err := h.readModelStore.Save(ctx, paymentDetail); err != nil {
+		if errors.Is(err, repository.ErrReadModelExists) {
+			// Redelivered; the payment was projected the first time.
+			return nil
+		}
 		span.RecordError(err)
 		return err
 	}
 
+	evictCached(ctx, h.cache, h.logger, event)
+
 	h.logger.New(ctx).Info("Payment created in read model",
 		"payment_id", event.AggregateID,
 		"tenant_id", event.TenantID,
-		"invoice_id", paymentSummary.InvoiceID,
-		"amount", paymentSummary.Amount,
+		"invoice_id", paymentDetail.InvoiceID,
+		"amount", paymentDetail.Amount,
 	)
 
 	return nil
@@ -120,14 +152,23 @@ func (h *PaymentEventHandler) HandlePaymentProcessed(ctx context.Context, event
 		processedAt = event.Timestamp
 	}
 
+	set := map[string]interface{}{
+		"status":        string(domain.PaymentStatusCompleted),
+		"transactionId": getString(event.Data, "transactionId"),
+		"providerId":    getString(event.Data, "providerId"),
+		"processedAt":   processedAt,
+		"updatedAt":     event.Timestamp,
+	}
+	if settlement := getSettlement(event.Data); settlement != nil {
+		set["settlement"] = settlement
+	}
+	if _, ok := event.Data["amountApplied"]; ok {
+		set["amountApplied"] = getString(event.Data, "amountApplied")
+		set["applications"] = getApplications(event.Data)
+	}
+
 	update := map[string]interface{}{
-		"$set": map[string]interface{}{
-			"status":        string(domain.PaymentStatusCompleted),
-			"transactionId": getString(event.Data, "transactionId"),
-			"providerId":    getString(event.Data, "providerId"),
-			"processedAt":   processedAt,
-			"updatedAt":     event.Timestamp,
-		},
+		"$set": set,
 		"$push": map[string]interface{}{
 			"activityLog": PaymentActivity{
 				Action:    "processed",
@@ -143,9 +184,7 @@ func (h *PaymentEventHandler) HandlePaymentProcessed(ctx context.Context, event
 		return err
 	}
 
-	h.cache.Delete(ctx, "payment:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "payment:summary:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "payment:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Info("Payment processed in read model",
 		"payment_id", event.AggregateID,
@@ -156,6 +195,145 @@ func (h *PaymentEventHandler) HandlePaymentProcessed(ctx context.Context, event
 	return nil
 }
 
+// HandlePaymentSettled records the settlement of a payment whose fees the
+// provider reported after completing it.
+func (h *PaymentEventHandler) HandlePaymentSettled(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_payment_settled",
+		trace.WithAttributes(
+			attribute.String("payment_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	settlement := getSettlement(event.Data)
+	if settlement == nil {
+		return nil
+	}
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+	update := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"settlement": settlement,
+			"updatedAt":  event.Timestamp,
+		},
+		"$push": map[string]interface{}{
+			"activityLog": PaymentActivity{
+				Action:    "settled",
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+				Details:   "Net " + settlement.Net + " " + settlement.Currency + " after fees of " + settlement.Fee,
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	return nil
+}
+
+// HandlePaymentApplication records the applications of a payment to
+// invoices after payment.applied or payment.unapplied.
+func (h *PaymentEventHandler) HandlePaymentApplication(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_payment_application",
+		trace.WithAttributes(
+			attribute.String("payment_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+			attribute.String("event_type", event.Type),
+		),
+	)
+	defer span.End()
+
+	action := "applied"
+	details := "Applied " + getString(event.Data, "amount") + " to " + getString(event.Data, "invoiceNumber")
+	if event.Type == "payment.unapplied" {
+		action = "unapplied"
+		details = "Unapplied " + getString(event.Data, "amount") + " from " + getString(event.Data, "invoiceNumber") + ": " + getString(event.Data, "reason")
+	}
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+	update := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"amountApplied": getString(event.Data, "amountApplied"),
+			"applications":  getApplications(event.Data),
+			"updatedAt":     event.Timestamp,
+		},
+		"$push": map[string]interface{}{
+			"activityLog": PaymentActivity{
+				Action:    action,
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+				Details:   details,
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	return nil
+}
+
+// HandlePaymentCreditRefunded records account credit of a payment paid
+// back to its client.
+func (h *PaymentEventHandler) HandlePaymentCreditRefunded(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_payment_credit_refunded",
+		trace.WithAttributes(
+			attribute.String("payment_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	details := "Refunded " + getString(event.Data, "amount") + " " + getString(event.Data, "currency") + " of account credit"
+	if reason := getString(event.Data, "reason"); reason != "" {
+		details += ": " + reason
+	}
+
+	filter := map[string]interface{}{
+		"_id":      event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+	update := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"amountRefunded": getString(event.Data, "amountRefunded"),
+			"updatedAt":      event.Timestamp,
+		},
+		"$push": map[string]interface{}{
+			"activityLog": PaymentActivity{
+				Action:    "credit_refunded",
+				Timestamp: event.Timestamp,
+				UserID:    event.UserID,
+				Details:   details,
+			},
+		},
+	}
+
+	if err := h.readModelStore.Update(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	evictCached(ctx, h.cache, h.logger, event)
+
+	return nil
+}
+
 func (h *PaymentEventHandler) HandlePaymentFailed(ctx context.Context, event *EventEnvelope) error {
 	ctx, span := h.tracer.Start(ctx, "handle_payment_failed",
 		trace.WithAttributes(
@@ -195,9 +373,7 @@ func (h *PaymentEventHandler) HandlePaymentFailed(ctx context.Context, event *Ev
 		return err
 	}
 
-	h.cache.Delete(ctx, "payment:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "payment:summary:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "payment:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Error("Payment failed in read model",
 		"payment_id", event.AggregateID,
@@ -247,9 +423,7 @@ func (h *PaymentEventHandler) HandlePaymentRefunded(ctx context.Context, event *
 		return err
 	}
 
-	h.cache.Delete(ctx, "payment:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "payment:summary:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "payment:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Info("Payment refunded in read model",
 		"payment_id", event.AggregateID,
@@ -297,9 +471,7 @@ func (h *PaymentEventHandler) HandlePaymentCancelled(ctx context.Context, event
 		return err
 	}
 
-	h.cache.Delete(ctx, "payment:detail:"+event.AggregateID)
-	h.cache.Delete(ctx, "payment:summary:"+event.AggregateID)
-	h.cache.DeletePattern(ctx, "payment:list:*")
+	evictCached(ctx, h.cache, h.logger, event)
 
 	h.logger.New(ctx).Info("Payment cancelled in read model",
 		"payment_id", event.AggregateID,
@@ -310,27 +482,147 @@ func (h *PaymentEventHandler) HandlePaymentCancelled(ctx context.Context, event
 	return nil
 }
 
+// HandleClientOwnerAssigned hands the client's payments to its new owner
+// and territory.
+func (h *PaymentEventHandler) HandleClientOwnerAssigned(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_client_owner_assigned",
+		trace.WithAttributes(
+			attribute.String("client_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	filter := map[string]interface{}{
+		"clientId": event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+	update := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"ownerId":   getString(event.Data, "ownerId"),
+			"territory": getString(event.Data, "territory"),
+		},
+	}
+
+	if err := h.readModelStore.UpdateMany(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	// Every cached view of the client's payments may now be visible to
+	// someone else.
+	if err := h.cache.DeletePattern(ctx, "payment:*"); err != nil {
+		h.logger.New(ctx).Warn("Failed to evict cached payments", "error", err)
+	}
+
+	return nil
+}
+
+// HandleClientUpdated refreshes the client name denormalized into the
+// client's payments.
+func (h *PaymentEventHandler) HandleClientUpdated(ctx context.Context, event *EventEnvelope) error {
+	ctx, span := h.tracer.Start(ctx, "handle_client_updated",
+		trace.WithAttributes(
+			attribute.String("client_id", event.AggregateID),
+			attribute.String("tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	name := getString(event.Data, "name")
+	if name == "" {
+		return nil
+	}
+
+	filter := map[string]interface{}{
+		"clientId": event.AggregateID,
+		"tenantId": event.TenantID,
+	}
+	update := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"clientName": name,
+		},
+	}
+
+	if err := h.readModelStore.UpdateMany(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	// Lists are evicted now; cached single-payment views age out.
+	if err := h.cache.InvalidateEntity(ctx, repository.CacheEntity("payment"), event.TenantID); err != nil {
+		h.logger.New(ctx).Warn("Failed to evict cached payment lists", "error", err)
+	}
+
+	return nil
+}
+
 type PaymentSummary struct {
-	ID          string    `bson:"_id" json:"id"`
-	TenantID    string    `bson:"tenantId" json:"tenantId"`
-	InvoiceID   string    `bson:"invoiceId" json:"invoiceId"`
-	ClientID    string    `bson:"clientId" json:"clientId"`
-	Amount      string    `bson:"amount" json:"amount"`
-	Currency    string    `bson:"currency" json:"currency"`
-	Status      string    `bson:"status" json:"status"`
-	Method      string    `bson:"method" json:"method"`
-	Provider    string    `bson:"provider" json:"provider,omitempty"`
-	Reference   string    `bson:"reference" json:"reference,omitempty"`
-	Description string    `bson:"description" json:"description,omitempty"`
-	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
-	UpdatedAt   time.Time `bson:"updatedAt" json:"updatedAt"`
+	ID            string                 `bson:"_id" json:"id"`
+	TenantID      string                 `bson:"tenantId" json:"tenantId"`
+	InvoiceID     string                 `bson:"invoiceId" json:"invoiceId"`
+	InvoiceNumber string                 `bson:"invoiceNumber" json:"invoiceNumber,omitempty"`
+	ClientID      string                 `bson:"clientId" json:"clientId"`
+	ClientName    string                 `bson:"clientName" json:"clientName,omitempty"`
+	Amount        string                 `bson:"amount" json:"amount"`
+	Currency      string                 `bson:"currency" json:"currency"`
+	Status        string                 `bson:"status" json:"status"`
+	Method        string                 `bson:"method" json:"method"`
+	Provider      string                 `bson:"provider" json:"provider,omitempty"`
+	Reference     string                 `bson:"reference" json:"reference,omitempty"`
+	Description   string                 `bson:"description" json:"description,omitempty"`
+	Settlement    *PaymentSettlementView `bson:"settlement,omitempty" json:"settlement,omitempty"`
+	CreatedAt     time.Time              `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time              `bson:"updatedAt" json:"updatedAt"`
+	// AmountApplied is how much of the payment is applied to invoices.
+	AmountApplied string `bson:"amountApplied,omitempty" json:"amountApplied,omitempty"`
+
+	domain.Ownership `bson:",inline"`
+}
+
+// PaymentSettlementView is what the provider pays out for a payment, in its
+// settlement currency, with amounts as decimal strings like Amount.
+type PaymentSettlementView struct {
+	Currency     string           `bson:"currency" json:"currency"`
+	Gross        string           `bson:"gross" json:"gross"`
+	Fee          string           `bson:"fee" json:"fee"`
+	Net          string           `bson:"net" json:"net"`
+	ExchangeRate string           `bson:"exchangeRate,omitempty" json:"exchangeRate,omitempty"`
+	Fees         []PaymentFeeView `bson:"fees,omitempty" json:"fees,omitempty"`
+	SourceID     string           `bson:"sourceId" json:"sourceId,omitempty"`
+}
+
+type PaymentFeeView struct {
+	Type        string `bson:"type" json:"type"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	Amount      string `bson:"amount" json:"amount"`
+}
+
+// getSettlement reads the settlement carried by a payment event, or nil
+// when it carries none.
+func getSettlement(data map[string]interface{}) *PaymentSettlementView {
+	raw, ok := data["settlement"]
+	if !ok || raw == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var settlement PaymentSettlementView
+	if err := json.Unmarshal(encoded, &settlement); err != nil || settlement.Currency == "" {
+		return nil
+	}
+	return &settlement
 }
 
 type PaymentDetail struct {
 	ID             string                 `bson:"_id" json:"id"`
 	TenantID       string                 `bson:"tenantId" json:"tenantId"`
 	InvoiceID      string                 `bson:"invoiceId" json:"invoiceId"`
+	InvoiceNumber  string                 `bson:"invoiceNumber" json:"invoiceNumber,omitempty"`
 	ClientID       string                 `bson:"clientId" json:"clientId"`
+	ClientName     string                 `bson:"clientName" json:"clientName,omitempty"`
 	Amount         string                 `bson:"amount" json:"amount"`
 	Currency       string                 `bson:"currency" json:"currency"`
 	Status         string                 `bson:"status" json:"status"`
@@ -344,10 +636,51 @@ type PaymentDetail struct {
 	FailureCode    string                 `bson:"failureCode" json:"failureCode,omitempty"`
 	FailureMessage string                 `bson:"failureMessage" json:"failureMessage,omitempty"`
 	RefundID       string                 `bson:"refundId" json:"refundId,omitempty"`
+	Settlement     *PaymentSettlementView `bson:"settlement,omitempty" json:"settlement,omitempty"`
+	Conversion     *ConversionView        `bson:"conversion,omitempty" json:"conversion,omitempty"`
 	ProcessedAt    *time.Time             `bson:"processedAt" json:"processedAt,omitempty"`
 	ActivityLog    []PaymentActivity      `bson:"activityLog" json:"activityLog,omitempty"`
 	CreatedAt      time.Time              `bson:"createdAt" json:"createdAt"`
 	UpdatedAt      time.Time              `bson:"updatedAt" json:"updatedAt"`
+	// AmountApplied is how much of the payment is applied to invoices, by
+	// the Applications not unapplied since.
+	AmountApplied string                   `bson:"amountApplied,omitempty" json:"amountApplied,omitempty"`
+	Applications  []PaymentApplicationView `bson:"applications,omitempty" json:"applications,omitempty"`
+	// AmountRefunded is how much of the payment's account credit, what
+	// it has unapplied, was refunded to the client.
+	AmountRefunded string `bson:"amountRefunded,omitempty" json:"amountRefunded,omitempty"`
+
+	domain.Ownership `bson:",inline"`
+}
+
+// PaymentApplicationView is an amount of a payment applied to an invoice,
+// with the amount as a decimal string. UnappliedAt is set once it is
+// unapplied.
+type PaymentApplicationView struct {
+	ID            string     `bson:"id" json:"id"`
+	PaymentID     string     `bson:"paymentId" json:"paymentId"`
+	InvoiceID     string     `bson:"invoiceId" json:"invoiceId"`
+	InvoiceNumber string     `bson:"invoiceNumber" json:"invoiceNumber"`
+	Amount        string     `bson:"amount" json:"amount"`
+	AppliedBy     string     `bson:"appliedBy,omitempty" json:"appliedBy,omitempty"`
+	AppliedAt     time.Time  `bson:"appliedAt" json:"appliedAt"`
+	UnappliedBy   string     `bson:"unappliedBy,omitempty" json:"unappliedBy,omitempty"`
+	UnappliedAt   *time.Time `bson:"unappliedAt,omitempty" json:"unappliedAt,omitempty"`
+	UnapplyReason string     `bson:"unapplyReason,omitempty" json:"unapplyReason,omitempty"`
+}
+
+// getApplications reads the applications carried by payment and invoice
+// events, the whole history of the payment or invoice.
+func getApplications(data map[string]interface{}) []PaymentApplicationView {
+	applications := []PaymentApplicationView{}
+	encoded, err := json.Marshal(data["applications"])
+	if err != nil {
+		return applications
+	}
+	if err := json.Unmarshal(encoded, &applications); err != nil || applications == nil {
+		return []PaymentApplicationView{}
+	}
+	return applications
 }
 
 type PaymentActivity struct {
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSettlement(t *testing.T) {
+	settlement := getSettlement(map[string]interface{}{
+		"settlement": map[string]interface{}{
+			"currency": "EUR",
+			"gross":    "100.00",
+			"fee":      "1.65",
+			"net":      "98.35",
+			"fees":     []interface{}{map[string]interface{}{"type": "processing", "amount": "1.65"}},
+			"sourceId": "txn_1",
+		},
+	})
+	require.NotNil(t, settlement)
+	assert.Equal(t, "98.35", settlement.Net)
+	assert.Equal(t, []PaymentFeeView{{Type: "processing", Amount: "1.65"}}, settlement.Fees)
+	assert.Equal(t, "txn_1", settlement.SourceID)
+
+	assert.Nil(t, getSettlement(map[string]interface{}{}), "no settlement")
+	assert.Nil(t, getSettlement(map[string]interface{}{"settlement": nil}))
+	assert.Nil(t, getSettlement(map[string]interface{}{"settlement": map[string]interface{}{"net": "98.35"}}), "a settlement needs a currency")
+	assert.Nil(t, getSettlement(map[string]interface{}{"settlement": "98.35"}))
+}
+
+func TestGetApplications(t *testing.T) {
+	appliedAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	applications := getApplications(map[string]interface{}{
+		"applications": []interface{}{
+			map[string]interface{}{
+				"id":            "app-1",
+				"paymentId":     "pay-1",
+				"invoiceId":     "inv-1",
+				"invoiceNumber": "INV-2026-000001",
+				"amount":        "60.00",
+				"appliedAt":     appliedAt.Format(time.RFC3339),
+				"unappliedAt":   appliedAt.Add(time.Hour).Format(time.RFC3339),
+				"unapplyReason": "wrong invoice",
+			},
+			map[string]interface{}{"id": "app-2", "invoiceId": "inv-2", "amount": "40.00"},
+		},
+	})
+	require.Len(t, applications, 2)
+	assert.Equal(t, "INV-2026-000001", applications[0].InvoiceNumber)
+	assert.Equal(t, appliedAt, applications[0].AppliedAt)
+	require.NotNil(t, applications[0].UnappliedAt)
+	assert.Equal(t, "wrong invoice", applications[0].UnapplyReason)
+	assert.Nil(t, applications[1].UnappliedAt)
+
+	assert.Equal(t, []PaymentApplicationView{}, getApplications(map[string]interface{}{}), "events from before applications carry none")
+	assert.Equal(t, []PaymentApplicationView{}, getApplications(map[string]interface{}{"applications": "app-1"}))
+}
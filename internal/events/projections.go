@@ -0,0 +1,92 @@
+package events
+
+import (
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// The registries below are the read model projections of the services that
+// own them. Services, their replay workers and the end-to-end tests build
+// their projections from these, so all of them project events the same way.
+
+// ClientProjections registers the client read model projections writing to
+// store.
+func ClientProjections(store *repository.ReadModelStore, cache *repository.Cache, log *logger.Logger) *EventHandlerRegistry {
+	eventHandler := NewClientEventHandler(store, cache, log)
+
+	registry := NewEventHandlerRegistry()
+	registry.Register("ClientCreated", eventHandler.HandleClientCreated)
+	registry.Register("ClientUpdated", eventHandler.HandleClientUpdated)
+	registry.Register("ClientOwnerAssigned", eventHandler.HandleClientOwnerAssigned)
+	registry.Register("ClientDeactivated", eventHandler.HandleClientDeactivated)
+	registry.Register("CreditLimitAssigned", eventHandler.HandleCreditLimitAssigned)
+	registry.Register("BillingInfoUpdated", eventHandler.HandleBillingInfoUpdated)
+	registry.Register("ClientsMerged", eventHandler.HandleClientsMerged)
+	registry.Register("ClientDeleted", eventHandler.HandleClientDeleted)
+	registry.Register("ClientRestored", eventHandler.HandleClientRestored)
+	registry.Register("ClientPurged", eventHandler.HandleClientPurged)
+	return registry
+}
+
+// InvoiceProjections registers the invoice read model projections writing
+// to store. clients is the client read model names are looked up in. Each
+// change is then summed into the invoice summaries.
+func InvoiceProjections(store, clients *repository.ReadModelStore, summaries *InvoiceSummaryProjector, cache *repository.Cache, log *logger.Logger) *EventHandlerRegistry {
+	eventHandler := NewInvoiceEventHandler(store, clients, cache, log)
+
+	registry := NewEventHandlerRegistry()
+	registry.Register("invoice.created", eventHandler.HandleInvoiceCreated)
+	registry.Register("invoice.line_added", eventHandler.HandleLineItemAdded)
+	registry.Register("invoice.line_removed", eventHandler.HandleLineItemRemoved)
+	registry.Register("invoice.finalized", eventHandler.HandleInvoiceFinalized)
+	registry.Register("invoice.sent", eventHandler.HandleInvoiceSent)
+	registry.Register("invoice.voided", eventHandler.HandleInvoiceVoided)
+	registry.Register("invoice.payment_recorded", eventHandler.HandlePaymentRecorded)
+	registry.Register("invoice.payment_applied", eventHandler.HandlePaymentApplication)
+	registry.Register("invoice.payment_unapplied", eventHandler.HandlePaymentApplication)
+	registry.Register("invoice.credit_applied", eventHandler.HandleCreditApplied)
+	registry.Register("invoice.credit_allocated", eventHandler.HandleCreditAllocated)
+	registry.Register("invoice.reminder_sent", eventHandler.HandleReminderSent)
+	registry.Register("ClientUpdated", eventHandler.HandleClientUpdated)
+	registry.Register("ClientOwnerAssigned", eventHandler.HandleClientOwnerAssigned)
+
+	// Registered after the read model handlers, which run first.
+	for _, eventType := range []string{
+		"invoice.created",
+		"invoice.line_added",
+		"invoice.line_removed",
+		"invoice.finalized",
+		"invoice.sent",
+		"invoice.voided",
+		"invoice.payment_recorded",
+		"invoice.payment_applied",
+		"invoice.payment_unapplied",
+		"invoice.credit_applied",
+		"invoice.credit_allocated",
+	} {
+		registry.Register(eventType, summaries.HandleInvoiceChanged)
+	}
+	registry.Register("ClientUpdated", summaries.HandleClientUpdated)
+	return registry
+}
+
+// PaymentProjections registers the payment read model projections writing
+// to store. invoices and clients are the read models invoice numbers and
+// client names are looked up in.
+func PaymentProjections(store, invoices, clients *repository.ReadModelStore, cache *repository.Cache, log *logger.Logger) *EventHandlerRegistry {
+	eventHandler := NewPaymentEventHandler(store, invoices, clients, cache, log)
+
+	registry := NewEventHandlerRegistry()
+	registry.Register("payment.created", eventHandler.HandlePaymentCreated)
+	registry.Register("payment.processed", eventHandler.HandlePaymentProcessed)
+	registry.Register("payment.settled", eventHandler.HandlePaymentSettled)
+	registry.Register("payment.applied", eventHandler.HandlePaymentApplication)
+	registry.Register("payment.unapplied", eventHandler.HandlePaymentApplication)
+	registry.Register("payment.credit_refunded", eventHandler.HandlePaymentCreditRefunded)
+	registry.Register("payment.failed", eventHandler.HandlePaymentFailed)
+	registry.Register("payment.refunded", eventHandler.HandlePaymentRefunded)
+	registry.Register("payment.cancelled", eventHandler.HandlePaymentCancelled)
+	registry.Register("ClientUpdated", eventHandler.HandleClientUpdated)
+	registry.Register("ClientOwnerAssigned", eventHandler.HandleClientOwnerAssigned)
+	return registry
+}
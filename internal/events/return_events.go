@@ -0,0 +1,87 @@
+package events
+
+import (
+	"github.com/ims-erp/system/internal/domain"
+)
+
+type ReturnAuthorizedEvent struct {
+	EventEnvelope
+}
+
+func NewReturnAuthorizedEvent(rma *domain.ReturnAuthorization, userID string) *ReturnAuthorizedEvent {
+	lines := make([]map[string]interface{}, len(rma.Lines))
+	for i, line := range rma.Lines {
+		lines[i] = map[string]interface{}{
+			"lineId":      line.ID,
+			"orderLineId": line.OrderLineID,
+			"productId":   line.ProductID,
+			"supplierId":  line.SupplierID,
+			"lotNumber":   line.LotNumber,
+			"quantity":    line.Quantity,
+			"reason":      string(line.Reason),
+			"quality":     line.Reason.IsQuality(),
+		}
+	}
+
+	event := NewEvent(
+		rma.ID.String(),
+		"ReturnAuthorization",
+		"rma.authorized",
+		rma.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"rmaNumber":   rma.RMANumber,
+			"orderId":     rma.OrderID,
+			"clientId":    rma.ClientID,
+			"warehouseId": rma.WarehouseID,
+			"lines":       lines,
+		},
+	)
+	return &ReturnAuthorizedEvent{*event}
+}
+
+type ReturnReceivedEvent struct {
+	EventEnvelope
+}
+
+func NewReturnReceivedEvent(rma *domain.ReturnAuthorization, userID string) *ReturnReceivedEvent {
+	event := NewEvent(
+		rma.ID.String(),
+		"ReturnAuthorization",
+		"rma.received",
+		rma.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"rmaNumber":   rma.RMANumber,
+			"orderId":     rma.OrderID,
+			"warehouseId": rma.WarehouseID,
+			"receivedAt":  rma.ReceivedAt,
+		},
+	)
+	return &ReturnReceivedEvent{*event}
+}
+
+type ReturnLineDispositionedEvent struct {
+	EventEnvelope
+}
+
+func NewReturnLineDispositionedEvent(rma *domain.ReturnAuthorization, line *domain.ReturnLine, userID string) *ReturnLineDispositionedEvent {
+	event := NewEvent(
+		rma.ID.String(),
+		"ReturnAuthorization",
+		"rma.line_dispositioned",
+		rma.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"rmaNumber":   rma.RMANumber,
+			"lineId":      line.ID,
+			"productId":   line.ProductID,
+			"lotNumber":   line.LotNumber,
+			"quantity":    line.Quantity,
+			"warehouseId": rma.WarehouseID,
+			"disposition": string(line.Disposition),
+			"rmaStatus":   string(rma.Status),
+		},
+	)
+	return &ReturnLineDispositionedEvent{*event}
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+// Revenue schedule events carry what the ledger posts for revenue billed
+// upfront: the line total is reclassified from revenue to deferred revenue
+// when its schedule is created, and each recognition moves its amount back
+// from deferred revenue to revenue.
+
+type RevenueScheduleCreatedEvent struct {
+	EventEnvelope
+}
+
+func NewRevenueScheduleCreatedEvent(schedule *domain.RevenueSchedule, userID string) *RevenueScheduleCreatedEvent {
+	event := NewEvent(
+		schedule.ID.String(),
+		"revenue_schedule",
+		"revenue_schedule.created",
+		schedule.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"invoiceId":     schedule.InvoiceID.String(),
+			"invoiceNumber": schedule.InvoiceNumber,
+			"invoiceLineId": schedule.InvoiceLineID.String(),
+			"clientId":      schedule.ClientID.String(),
+			"method":        string(schedule.Method),
+			"amount":        schedule.Total.String(),
+			"currency":      schedule.Currency,
+			"debit":         "revenue",
+			"credit":        "deferred_revenue",
+			"entries":       len(schedule.Entries),
+		},
+	)
+	return &RevenueScheduleCreatedEvent{*event}
+}
+
+type MilestoneCompletedEvent struct {
+	EventEnvelope
+}
+
+func NewMilestoneCompletedEvent(schedule *domain.RevenueSchedule, entry *domain.RecognitionEntry, userID string) *MilestoneCompletedEvent {
+	event := NewEvent(
+		schedule.ID.String(),
+		"revenue_schedule",
+		"revenue_schedule.milestone_completed",
+		schedule.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"invoiceId":   schedule.InvoiceID.String(),
+			"entryId":     entry.ID.String(),
+			"milestone":   entry.Milestone,
+			"amount":      entry.Amount.String(),
+			"currency":    schedule.Currency,
+			"completedAt": entry.CompletedAt,
+		},
+	)
+	return &MilestoneCompletedEvent{*event}
+}
+
+type RevenueRecognizedEvent struct {
+	EventEnvelope
+}
+
+// NewRevenueRecognizedEvent reports the entries of a schedule recognized in
+// period by one run of the recognition job.
+func NewRevenueRecognizedEvent(schedule *domain.RevenueSchedule, period string, entries []domain.RecognitionEntry) *RevenueRecognizedEvent {
+	amount := decimal.Zero
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		amount = amount.Add(entry.Amount)
+		ids = append(ids, entry.ID.String())
+	}
+	event := NewEvent(
+		schedule.ID.String(),
+		"revenue_schedule",
+		"revenue.recognized",
+		schedule.TenantID.String(),
+		"",
+		map[string]interface{}{
+			"invoiceId":     schedule.InvoiceID.String(),
+			"invoiceNumber": schedule.InvoiceNumber,
+			"invoiceLineId": schedule.InvoiceLineID.String(),
+			"clientId":      schedule.ClientID.String(),
+			"period":        period,
+			"amount":        amount.String(),
+			"currency":      schedule.Currency,
+			"debit":         "deferred_revenue",
+			"credit":        "revenue",
+			"entryIds":      ids,
+			"recognized":    schedule.Recognized.String(),
+			"deferred":      schedule.Deferred().String(),
+			"status":        string(schedule.Status),
+		},
+	)
+	return &RevenueRecognizedEvent{*event}
+}
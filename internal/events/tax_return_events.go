@@ -0,0 +1,42 @@
+package events
+
+import (
+	"github.com/ims-erp/system/internal/domain"
+)
+
+type TaxReturnFiledEvent struct {
+	EventEnvelope
+}
+
+// NewTaxReturnFiledEvent reports a VAT return filed, with its totals per
+// currency. The period it covers is locked from then on.
+func NewTaxReturnFiledEvent(taxReturn *domain.TaxReturn, userID string) *TaxReturnFiledEvent {
+	totals := make([]map[string]interface{}, 0, len(taxReturn.Totals))
+	for _, total := range taxReturn.Totals {
+		totals = append(totals, map[string]interface{}{
+			"currency":  total.Currency,
+			"netAmount": total.NetAmount.String(),
+			"taxAmount": total.TaxAmount.String(),
+		})
+	}
+	event := NewEvent(
+		taxReturn.ID.String(),
+		"tax_return",
+		"tax_return.filed",
+		taxReturn.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"period":      taxReturn.Period,
+			"country":     taxReturn.Country,
+			"vatNumber":   taxReturn.VATNumber,
+			"from":        taxReturn.From,
+			"to":          taxReturn.To,
+			"totals":      totals,
+			"invoices":    taxReturn.Invoices,
+			"creditNotes": taxReturn.CreditNotes,
+			"issues":      len(taxReturn.Issues),
+			"reference":   taxReturn.Reference,
+		},
+	)
+	return &TaxReturnFiledEvent{*event}
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("events")
+
+// InjectTraceContext stores the span context of ctx in the envelope metadata
+// using the configured propagator, so the trace survives serialization into
+// the outbox and across NATS.
+func (e *EventEnvelope) InjectTraceContext(ctx context.Context) *EventEnvelope {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return e
+	}
+	if e.Metadata == nil {
+		e.Metadata = make(map[string]string)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(e.Metadata))
+	return e
+}
+
+// TraceContext returns ctx with the remote span context carried in the
+// envelope metadata, if any.
+func (e *EventEnvelope) TraceContext(ctx context.Context) context.Context {
+	if len(e.Metadata) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.Metadata))
+}
+
+// handlerContext parents handler spans on the envelope's trace unless the
+// caller, e.g. a consumer that read the message headers, already did.
+func handlerContext(ctx context.Context, event *EventEnvelope) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	return event.TraceContext(ctx)
+}
+
+func startHandlerSpan(ctx context.Context, event *EventEnvelope, consumer string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "event.handle "+event.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("event.id", event.ID),
+			attribute.String("event.type", event.Type),
+			attribute.String("event.aggregate_id", event.AggregateID),
+			attribute.String("event.tenant_id", event.TenantID),
+			attribute.String("event.handler", consumer),
+		),
+	)
+}
+
+func endHandlerSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
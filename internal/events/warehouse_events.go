@@ -155,6 +155,26 @@ func NewWarehouseOperationCreatedEvent(operation *domain.WarehouseOperation, use
 	return &WarehouseOperationCreatedEvent{*event}
 }
 
+type WarehouseOperationAssignedEvent struct {
+	EventEnvelope
+}
+
+func NewWarehouseOperationAssignedEvent(operation *domain.WarehouseOperation, userID string) *WarehouseOperationAssignedEvent {
+	event := NewEvent(
+		operation.ID.String(),
+		"WarehouseOperation",
+		"warehouse.operation.assigned",
+		operation.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"warehouseId": operation.WarehouseID,
+			"type":        string(operation.Type),
+			"assignedTo":  operation.AssignedTo,
+		},
+	)
+	return &WarehouseOperationAssignedEvent{*event}
+}
+
 type WarehouseOperationStartedEvent struct {
 	EventEnvelope
 }
@@ -228,6 +248,40 @@ func NewWarehouseOperationCancelledEvent(operation *domain.WarehouseOperation, u
 	return &WarehouseOperationCancelledEvent{*event}
 }
 
+type LandedCostAddedEvent struct {
+	EventEnvelope
+}
+
+func NewLandedCostAddedEvent(operation *domain.WarehouseOperation, cost domain.LandedCost, userID string) *LandedCostAddedEvent {
+	allocations := make([]map[string]interface{}, 0, len(cost.Allocations))
+	for _, allocation := range cost.Allocations {
+		allocations = append(allocations, map[string]interface{}{
+			"itemId":    allocation.ItemID,
+			"productId": allocation.ProductID,
+			"amount":    allocation.Amount.String(),
+		})
+	}
+
+	event := NewEvent(
+		operation.ID.String(),
+		"WarehouseOperation",
+		"warehouse.operation.landed_cost_added",
+		operation.TenantID.String(),
+		userID,
+		map[string]interface{}{
+			"warehouseId":  operation.WarehouseID,
+			"landedCostId": cost.ID,
+			"costType":     string(cost.Type),
+			"amount":       cost.Amount.String(),
+			"currency":     cost.Currency,
+			"method":       string(cost.Method),
+			"reference":    cost.Reference,
+			"allocations":  allocations,
+		},
+	)
+	return &LandedCostAddedEvent{*event}
+}
+
 type StockReservedEvent struct {
 	EventEnvelope
 }
@@ -0,0 +1,580 @@
+// Package export runs large CSV and XLSX extracts of read models in the
+// background. A request is stored as a job in MongoDB; a worker in the owning
+// service streams the matching documents into a file, uploads it to MinIO and
+// the caller fetches it through a presigned link. Exports thus never hold an
+// HTTP request open for longer than it takes to queue them.
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/infrastructure/storage"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/masking"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+
+	// xlsxMaxRows is the data rows a worksheet holds below its header.
+	xlsxMaxRows = 1048575
+)
+
+var (
+	ErrInvalidRequest = errors.New("invalid export request")
+	ErrUnknownSource  = errors.New("unknown export source")
+	ErrNotReady       = errors.New("export is not ready")
+)
+
+// Column is one column of an export.
+type Column struct {
+	Header string
+	// Field is the BSON field read, with dots for nested fields.
+	Field string
+	// Number writes numeric strings, such as amounts, as numbers in XLSX.
+	Number bool
+}
+
+// Source is a read model collection that can be exported.
+type Source struct {
+	Name       string
+	Collection string
+	Columns    []Column
+	// Filters maps the filter names a request may use to the fields they
+	// match exactly.
+	Filters map[string]string
+	// DateField is the field the from and to bounds apply to. Optional.
+	DateField string
+	// Sort orders the rows; _id breaks ties.
+	Sort string
+	// Scope further restricts the tenant's documents, for example to those
+	// not in the trash. Optional.
+	Scope func(filter map[string]interface{}) map[string]interface{}
+	// Open prepares each document before it is written, such as by
+	// decrypting encrypted fields. Optional.
+	Open func(doc bson.M) error
+	// Owned marks documents that carry domain.Ownership; users whose
+	// visibility is restricted only export those they may read.
+	Owned bool
+}
+
+// Request queues an export. Source may be omitted when the exporter only
+// serves one; Format defaults to CSV. To is exclusive. Visibility is that
+// of the requesting user, and Masked is set when its API responses are
+// masked.
+type Request struct {
+	TenantID   string            `json:"tenantId"`
+	UserID     string            `json:"userId"`
+	Visibility domain.Visibility `json:"-"`
+	Masked     bool              `json:"-"`
+	Source     string            `json:"source"`
+	Format     string            `json:"format"`
+	Filters    map[string]string `json:"filters,omitempty"`
+	From       *time.Time        `json:"from,omitempty"`
+	To         *time.Time        `json:"to,omitempty"`
+}
+
+// Storage is where finished exports are kept.
+type Storage interface {
+	UploadFile(ctx context.Context, bucket, objectKey, path, contentType string) error
+	GetPresignedDownloadURL(ctx context.Context, bucket, objectKey string, expiry time.Duration) (string, error)
+	Delete(ctx context.Context, bucket, objectKey string) error
+	BucketExists(ctx context.Context, bucket string) (bool, error)
+	CreateBucket(ctx context.Context, bucket string) error
+}
+
+// NewStorage connects to the MinIO deployment in cfg.
+func NewStorage(cfg config.MinIOConfig) (Storage, error) {
+	files, err := storage.NewMinIOStorageService(storage.MinIOConfig{
+		Endpoint:  cfg.Endpoint,
+		AccessKey: cfg.AccessKey,
+		SecretKey: cfg.SecretKey,
+		UseSSL:    cfg.UseSSL || cfg.Secure,
+		Region:    cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Download is a presigned link to a finished export.
+type Download struct {
+	URL       string    `json:"url"`
+	FileName  string    `json:"fileName"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Exporter queues export jobs and runs those of its sources on a bounded
+// worker pool. Like replay jobs, export jobs live in MongoDB, so any replica
+// can accept or report on a job another replica runs, and a job whose worker
+// dies is picked up again once its heartbeat goes stale.
+type Exporter struct {
+	db      *repository.MongoDB
+	jobs    *repository.ExportJobStore
+	files   Storage
+	sources map[string]Source
+	names   []string
+	cfg     config.ExportConfig
+	owner   string
+	slots   chan struct{}
+	logger  *logger.Logger
+	masking masking.Rules
+}
+
+func NewExporter(db *repository.MongoDB, files Storage, cfg config.ExportConfig, log *logger.Logger, sources ...Source) *Exporter {
+	host, _ := os.Hostname()
+	e := &Exporter{
+		db:      db,
+		jobs:    repository.NewExportJobStore(db),
+		files:   files,
+		sources: make(map[string]Source, len(sources)),
+		cfg:     cfg,
+		owner:   host + "-" + uuid.New().String()[:8],
+		slots:   make(chan struct{}, cfg.MaxConcurrent),
+		logger:  log,
+	}
+	for _, s := range sources {
+		e.sources[s.Name] = s
+		e.names = append(e.names, s.Name)
+	}
+	sort.Strings(e.names)
+	return e
+}
+
+// WithMasking masks the exports of users whose API responses are masked as
+// MaskPII masks the responses. It returns e unchanged when masking is
+// disabled.
+func (e *Exporter) WithMasking(cfg config.MaskingConfig) *Exporter {
+	if cfg.Enabled {
+		e.masking = masking.Default.With(masking.Text, cfg.Fields...)
+	}
+	return e
+}
+
+// Setup creates the job indexes and the export bucket.
+func (e *Exporter) Setup(ctx context.Context) error {
+	if err := e.jobs.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	exists, err := e.files.BucketExists(ctx, e.cfg.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return e.files.CreateBucket(ctx, e.cfg.Bucket)
+	}
+	return nil
+}
+
+// Start validates req and queues a job for the worker pool.
+func (e *Exporter) Start(ctx context.Context, req Request) (*repository.ExportJob, error) {
+	if req.TenantID == "" {
+		return nil, fmt.Errorf("%w: tenantId is required", ErrInvalidRequest)
+	}
+	if req.Source == "" && len(e.names) == 1 {
+		req.Source = e.names[0]
+	}
+	source, ok := e.sources[req.Source]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q; sources are %s", ErrUnknownSource, req.Source, strings.Join(e.names, ", "))
+	}
+
+	req.Format = strings.ToLower(req.Format)
+	if req.Format == "" {
+		req.Format = FormatCSV
+	}
+	if req.Format != FormatCSV && req.Format != FormatXLSX {
+		return nil, fmt.Errorf("%w: format must be csv or xlsx", ErrInvalidRequest)
+	}
+	for name := range req.Filters {
+		if _, ok := source.Filters[name]; !ok {
+			return nil, fmt.Errorf("%w: %s cannot be filtered by %q", ErrInvalidRequest, source.Name, name)
+		}
+	}
+	if (req.From != nil || req.To != nil) && source.DateField == "" {
+		return nil, fmt.Errorf("%w: %s cannot be filtered by date", ErrInvalidRequest, source.Name)
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidRequest)
+	}
+
+	job := &repository.ExportJob{
+		Source:   source.Name,
+		TenantID: req.TenantID,
+		UserID:   req.UserID,
+		Format:   req.Format,
+		Filters:  req.Filters,
+		From:     req.From,
+		To:       req.To,
+		Masked:   req.Masked && e.masking != nil,
+	}
+	if req.Visibility.Restricted() {
+		job.Visibility = &req.Visibility
+	}
+	if err := e.jobs.Create(ctx, job, e.cfg.Retention); err != nil {
+		return nil, err
+	}
+
+	e.logger.Info("Export job queued",
+		"job_id", job.ID,
+		"tenant_id", job.TenantID,
+		"source", job.Source,
+		"format", job.Format,
+	)
+	return job, nil
+}
+
+// Get returns a job of one of the exporter's sources.
+func (e *Exporter) Get(ctx context.Context, id string) (*repository.ExportJob, error) {
+	job, err := e.jobs.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := e.sources[job.Source]; !ok {
+		return nil, repository.ErrExportJobNotFound
+	}
+	return job, nil
+}
+
+// List returns a tenant's recent jobs of source, or of all the exporter's
+// sources when source is empty. Unless userID is empty only the jobs that
+// user requested are listed.
+func (e *Exporter) List(ctx context.Context, tenantID, userID, source string, limit int64) ([]repository.ExportJob, error) {
+	if source == "" && len(e.names) == 1 {
+		source = e.names[0]
+	}
+	if _, ok := e.sources[source]; !ok && source != "" {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSource, source)
+	}
+	jobs, err := e.jobs.List(ctx, tenantID, userID, source, limit)
+	if err != nil {
+		return nil, err
+	}
+	filtered := jobs[:0]
+	for _, job := range jobs {
+		if _, ok := e.sources[job.Source]; ok {
+			filtered = append(filtered, job)
+		}
+	}
+	return filtered, nil
+}
+
+// Download returns a link to the file of a completed job.
+func (e *Exporter) Download(ctx context.Context, job *repository.ExportJob) (*Download, error) {
+	if job.Status != repository.ExportStatusCompleted {
+		return nil, fmt.Errorf("%w: the export is %s", ErrNotReady, job.Status)
+	}
+	url, err := e.files.GetPresignedDownloadURL(ctx, job.Bucket, job.ObjectKey, e.cfg.LinkExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		URL:       url,
+		FileName:  job.FileName,
+		ExpiresAt: time.Now().UTC().Add(e.cfg.LinkExpiry),
+	}, nil
+}
+
+// Run claims queued jobs whenever a worker slot is free and purges expired
+// exports. It blocks until ctx is cancelled; running jobs are abandoned and
+// picked up again once their heartbeat goes stale.
+func (e *Exporter) Run(ctx context.Context) {
+	poll := time.NewTicker(e.cfg.PollInterval)
+	defer poll.Stop()
+	purge := time.NewTicker(e.cfg.PurgeInterval)
+	defer purge.Stop()
+
+	for {
+		e.claimJobs(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-purge.C:
+			e.purge(ctx)
+		case <-poll.C:
+		}
+	}
+}
+
+func (e *Exporter) claimJobs(ctx context.Context) {
+	for {
+		select {
+		case e.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		job, err := e.jobs.Claim(ctx, e.owner, e.names, e.cfg.StaleAfter)
+		if err != nil || job == nil {
+			<-e.slots
+			if err != nil {
+				e.logger.Warn("Failed to claim export job", "error", err)
+			}
+			return
+		}
+
+		go func() {
+			defer func() { <-e.slots }()
+			e.run(ctx, job)
+		}()
+	}
+}
+
+func (e *Exporter) run(ctx context.Context, job *repository.ExportJob) {
+	log := e.logger.WithFields(map[string]interface{}{
+		"job_id":    job.ID,
+		"tenant_id": job.TenantID,
+		"source":    job.Source,
+	})
+	log.Infow("Export started", "format", job.Format, "attempt", job.Attempts)
+
+	var err error
+	if job.Attempts > e.cfg.MaxAttempts {
+		err = fmt.Errorf("abandoned after %d attempts", e.cfg.MaxAttempts)
+	} else {
+		err = e.export(ctx, job)
+	}
+
+	if errors.Is(err, repository.ErrExportJobNotFound) {
+		log.Warnw("Export taken over by another worker", "rows", job.Rows)
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down; leave the job running so another worker retries it.
+		log.Infow("Export interrupted by shutdown", "rows", job.Rows)
+		return
+	}
+
+	status := repository.ExportStatusCompleted
+	if err != nil {
+		status = repository.ExportStatusFailed
+		job.LastError = err.Error()
+	}
+	if finishErr := e.jobs.Finish(context.Background(), job, status, e.cfg.Retention); finishErr != nil {
+		log.Errorw("Failed to record export result", "error", finishErr)
+	}
+	if err != nil {
+		log.Errorw("Export failed", "rows", job.Rows, "error", err)
+		return
+	}
+	log.Infow("Export finished", "rows", job.Rows, "size", job.Size)
+}
+
+func (e *Exporter) export(ctx context.Context, job *repository.ExportJob) error {
+	source, ok := e.sources[job.Source]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownSource, job.Source)
+	}
+
+	limit := e.cfg.MaxRows
+	if job.Format == FormatXLSX && limit > xlsxMaxRows {
+		limit = xlsxMaxRows
+	}
+
+	projection := bson.M{}
+	for _, c := range source.Columns {
+		projection[c.Field] = 1
+	}
+	order := bson.D{{Key: "_id", Value: 1}}
+	if source.Sort != "" {
+		order = append(bson.D{{Key: source.Sort, Value: 1}}, order...)
+	}
+	opts := options.Find().
+		SetSort(order).
+		SetProjection(projection).
+		SetLimit(limit + 1).
+		SetBatchSize(500)
+
+	cursor, err := e.db.Collection(source.Collection).Find(ctx, filterFor(source, job), opts)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", source.Collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	file, err := os.CreateTemp("", "export-*."+job.Format)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w, err := newWriter(job.Format, file, source.Columns)
+	if err != nil {
+		return err
+	}
+
+	// A replica without masking configured still masks the jobs of masked
+	// users, with the default rules.
+	rules := e.masking
+	if rules == nil {
+		rules = masking.Default
+	}
+	if err := e.jobs.Progress(ctx, job); err != nil {
+		return err
+	}
+	lastReport := time.Now()
+	for cursor.Next(ctx) {
+		if job.Rows == limit {
+			return fmt.Errorf("more than %d rows match; narrow the filters", limit)
+		}
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode %s document: %w", source.Collection, err)
+		}
+		if source.Open != nil {
+			if err := source.Open(doc); err != nil {
+				return fmt.Errorf("failed to open %s document: %w", source.Collection, err)
+			}
+		}
+		if job.Masked {
+			maskDocument(rules, doc)
+		}
+		if err := w.Row(doc); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+		job.Rows++
+
+		if job.Rows%int64(e.cfg.ProgressEvery) != 0 && time.Since(lastReport) < e.cfg.StaleAfter/4 {
+			continue
+		}
+		lastReport = time.Now()
+		if err := e.jobs.Progress(ctx, job); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", source.Collection, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	job.Size = info.Size()
+
+	job.FileName = fmt.Sprintf("%s-%s.%s", source.Name, time.Now().UTC().Format("20060102T150405Z"), job.Format)
+	job.Bucket = e.cfg.Bucket
+	job.ObjectKey = strings.Join([]string{job.TenantID, source.Name, job.ID, job.FileName}, "/")
+	if err := e.files.UploadFile(ctx, job.Bucket, job.ObjectKey, file.Name(), contentTypes[job.Format]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// filterFor selects the tenant's documents matching the job's filters that
+// the requesting user may read.
+func filterFor(source Source, job *repository.ExportJob) bson.M {
+	filter := bson.M{"tenantId": job.TenantID}
+	for name, value := range job.Filters {
+		filter[source.Filters[name]] = value
+	}
+	if job.From != nil || job.To != nil {
+		between := bson.M{}
+		if job.From != nil {
+			between["$gte"] = *job.From
+		}
+		if job.To != nil {
+			between["$lt"] = *job.To
+		}
+		filter[source.DateField] = between
+	}
+	if source.Scope != nil {
+		filter = source.Scope(filter)
+	}
+	if v := job.Visibility; source.Owned && v != nil && v.Restricted() {
+		visible := bson.A{bson.M{"ownerId": v.OwnerID}}
+		if len(v.Territories) > 0 {
+			visible = append(visible, bson.M{"territory": bson.M{"$in": v.Territories}})
+		}
+		and, _ := filter["$and"].(bson.A)
+		filter["$and"] = append(and, bson.M{"$or": visible})
+	}
+	return filter
+}
+
+// maskDocument masks the fields of doc that rules name, wherever they occur,
+// as masking.Rules masks JSON responses.
+func maskDocument(rules masking.Rules, doc bson.M) {
+	for key, value := range doc {
+		if kind, ok := rules[key]; ok {
+			doc[key] = maskValue(kind, value)
+			continue
+		}
+		switch value := value.(type) {
+		case bson.M:
+			maskDocument(rules, value)
+		case bson.A:
+			for _, item := range value {
+				if item, ok := item.(bson.M); ok {
+					maskDocument(rules, item)
+				}
+			}
+		}
+	}
+}
+
+func maskValue(kind masking.Kind, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return masking.String(kind, v)
+	case primitive.Decimal128:
+		return masking.Redacted
+	case bson.M:
+		for key, item := range v {
+			v[key] = maskValue(kind, item)
+		}
+		return v
+	case bson.A:
+		for i, item := range v {
+			v[i] = maskValue(kind, item)
+		}
+		return v
+	}
+	if kind == masking.Text {
+		return nil
+	}
+	return value
+}
+
+// purge deletes expired jobs together with their files.
+func (e *Exporter) purge(ctx context.Context) {
+	jobs, err := e.jobs.Expired(ctx, e.names, time.Now().UTC(), 500)
+	if err != nil {
+		e.logger.Warn("Failed to find expired exports", "error", err)
+		return
+	}
+	for _, job := range jobs {
+		if job.ObjectKey != "" {
+			if err := e.files.Delete(ctx, job.Bucket, job.ObjectKey); err != nil {
+				e.logger.Warn("Failed to delete expired export file", "job_id", job.ID, "error", err)
+				continue
+			}
+		}
+		if err := e.jobs.Delete(ctx, job.ID); err != nil {
+			e.logger.Warn("Failed to delete expired export job", "job_id", job.ID, "error", err)
+		}
+	}
+	if len(jobs) > 0 {
+		e.logger.Info("Purged expired exports", "count", len(jobs))
+	}
+}
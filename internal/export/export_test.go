@@ -0,0 +1,183 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testSource = Source{
+	Name:       "payments",
+	Collection: "payment_read_models",
+	Columns: []Column{
+		{Header: "ID", Field: "_id"},
+		{Header: "Client", Field: "clientName"},
+		{Header: "Amount", Field: "amount", Number: true},
+		{Header: "City", Field: "address.city"},
+		{Header: "Tags", Field: "tags"},
+		{Header: "Created", Field: "createdAt"},
+	},
+	Filters:   map[string]string{"status": "status", "clientId": "clientId"},
+	DateField: "createdAt",
+	Sort:      "createdAt",
+	Scope:     repository.NotDeleted,
+}
+
+var testDoc = bson.M{
+	"_id":        "pay-1",
+	"clientName": "=HYPERLINK(\"http://evil\")",
+	"amount":     "-12.50",
+	"address":    bson.M{"city": "Sofia"},
+	"tags":       primitive.A{"vip", "net30"},
+	"createdAt":  primitive.NewDateTimeFromTime(time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)),
+}
+
+func TestCSVWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := newWriter(FormatCSV, &out, testSource.Columns)
+	require.NoError(t, err)
+	require.NoError(t, w.Row(testDoc))
+	require.NoError(t, w.Row(bson.M{"_id": "pay-2", "createdAt": primitive.NewDateTimeFromTime(time.Time{})}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "ID,Client,Amount,City,Tags,Created\n"+
+		"pay-1,\"'=HYPERLINK(\"\"http://evil\"\")\",-12.50,Sofia,\"vip, net30\",2026-03-01T09:30:00Z\n"+
+		"pay-2,,,,,\n", out.String())
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := newWriter(FormatXLSX, &out, testSource.Columns)
+	require.NoError(t, err)
+	require.NoError(t, w.Row(testDoc))
+	require.NoError(t, w.Close())
+
+	f, err := excelize.OpenReader(&out)
+	require.NoError(t, err)
+	defer f.Close()
+	rows, err := f.GetRows("Sheet1", excelize.Options{RawCellValue: true})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, []string{"ID", "Client", "Amount", "City", "Tags", "Created"}, rows[0])
+	assert.Equal(t, "=HYPERLINK(\"http://evil\")", rows[1][1], "xlsx cells are text, never formulas")
+	assert.Equal(t, "-12.5", rows[1][2])
+	assert.Equal(t, "vip, net30", rows[1][4])
+
+	formula, err := f.GetCellFormula("Sheet1", "B2")
+	require.NoError(t, err)
+	assert.Empty(t, formula)
+}
+
+func TestFilterFor(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	job := &repository.ExportJob{
+		TenantID: "tenant-1",
+		Filters:  map[string]string{"status": "completed"},
+		From:     &from,
+	}
+	assert.Equal(t, bson.M{
+		"tenantId":  "tenant-1",
+		"status":    "completed",
+		"createdAt": bson.M{"$gte": from},
+		"deletedAt": nil,
+	}, filterFor(testSource, job))
+}
+
+func TestFilterFor_Visibility(t *testing.T) {
+	visibility := domain.OwnVisibility("rep-1", []string{"north"})
+	job := &repository.ExportJob{TenantID: "tenant-1", Visibility: &visibility}
+	owned := testSource
+	owned.Owned = true
+	assert.Equal(t, bson.M{
+		"tenantId":  "tenant-1",
+		"deletedAt": nil,
+		"$and": bson.A{bson.M{"$or": bson.A{
+			bson.M{"ownerId": "rep-1"},
+			bson.M{"territory": bson.M{"$in": []string{"north"}}},
+		}}},
+	}, filterFor(owned, job))
+
+	assert.Equal(t, bson.M{"tenantId": "tenant-1", "deletedAt": nil}, filterFor(testSource, job),
+		"documents without an owner are not restricted")
+}
+
+func TestMaskDocument(t *testing.T) {
+	e := (&Exporter{}).WithMasking(config.MaskingConfig{Enabled: true, Fields: []string{"reference"}})
+	doc := bson.M{
+		"_id":        "pay-1",
+		"clientName": "Northwind",
+		"amount":     "120.00",
+		"reference":  "INV-7",
+		"quantity":   int32(3),
+		"address":    bson.M{"city": "Sofia", "country": "BG"},
+		"status":     "completed",
+	}
+	maskDocument(e.masking, doc)
+	assert.Equal(t, bson.M{
+		"_id":        "pay-1",
+		"clientName": "N***",
+		"amount":     "***",
+		"reference":  "***",
+		"quantity":   int32(3),
+		"address":    bson.M{"city": "***", "country": "BG"},
+		"status":     "completed",
+	}, doc)
+
+	assert.Nil(t, (&Exporter{}).WithMasking(config.MaskingConfig{}).masking, "masking is off unless enabled")
+}
+
+func TestRequestedBy(t *testing.T) {
+	job := &repository.ExportJob{TenantID: "tenant-1", UserID: "user-1"}
+	request := func(userID string, permissions ...string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/payments/exports/job-1", nil)
+		return req.WithContext(middleware.WithIdentity(req.Context(), "tenant-1", userID, permissions))
+	}
+
+	assert.True(t, requestedBy(request("user-1"), job))
+	assert.False(t, requestedBy(request("user-2"), job), "users only see their own exports")
+	assert.True(t, requestedBy(request("user-2", middleware.AdminPermission), job), "admins see every export")
+	assert.False(t, requestedBy(request(""), &repository.ExportJob{TenantID: "tenant-1"}),
+		"callers without a user see no exports")
+}
+
+func TestStartRejectsInvalidRequests(t *testing.T) {
+	e := &Exporter{sources: map[string]Source{testSource.Name: testSource}, names: []string{testSource.Name}}
+	ctx := context.Background()
+	from := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, -1, 0)
+
+	for name, req := range map[string]Request{
+		"no tenant":      {},
+		"unknown source": {TenantID: "t", Source: "orders"},
+		"bad format":     {TenantID: "t", Format: "pdf"},
+		"unknown filter": {TenantID: "t", Filters: map[string]string{"amount": "1"}},
+		"empty range":    {TenantID: "t", From: &from, To: &to},
+	} {
+		_, err := e.Start(ctx, req)
+		assert.Error(t, err, name)
+	}
+
+	_, err := e.Start(ctx, Request{TenantID: "t", Source: "orders"})
+	assert.ErrorIs(t, err, ErrUnknownSource)
+	_, err = e.Start(ctx, Request{TenantID: "t", Format: "pdf"})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func TestDownloadRequiresCompletedJob(t *testing.T) {
+	e := &Exporter{}
+	_, err := e.Download(context.Background(), &repository.ExportJob{Status: repository.ExportStatusRunning})
+	assert.ErrorIs(t, err, ErrNotReady)
+}
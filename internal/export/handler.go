@@ -0,0 +1,141 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// Handler serves the export API under prefix, such as
+// /api/v1/payments/exports:
+//
+//	POST prefix                   queue an export
+//	GET  prefix?source=&limit=    list recent exports
+//	GET  prefix/{id}              export status
+//	GET  prefix/{id}/download     presigned link to the finished file
+//
+// It runs behind the tenant middleware; exports are always for the caller's
+// tenant and only contain the records the caller may read, masked as its API
+// responses are. Users see the
+// exports they requested and admins those of the whole tenant; other
+// exports are reported as not found.
+func (e *Exporter) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, prefix), "/")
+		parts := strings.Split(path, "/")
+		tenantID := middleware.GetTenantID(req.Context())
+
+		switch {
+		case path == "" && req.Method == http.MethodPost:
+			var body Request
+			if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+				httpresponse.ErrorStatus(w, req, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			body.TenantID = tenantID
+			body.UserID = middleware.GetUserID(req.Context())
+			body.Visibility = middleware.GetVisibility(req.Context())
+			body.Masked = !rbac.Allows(middleware.GetPermissions(req.Context()), middleware.UnmaskedPermission)
+			job, err := e.Start(req.Context(), body)
+			if err != nil {
+				e.writeError(w, req, err)
+				return
+			}
+			w.Header().Set("Location", prefix+"/"+job.ID)
+			httpresponse.JSON(w, http.StatusAccepted, job)
+
+		case path == "" && req.Method == http.MethodGet:
+			limit, _ := strconv.ParseInt(req.URL.Query().Get("limit"), 10, 64)
+			if limit <= 0 || limit > 200 {
+				limit = 20
+			}
+			userID, all := requester(req)
+			if !all && userID == "" {
+				httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": []repository.ExportJob{}})
+				return
+			}
+			jobs, err := e.List(req.Context(), tenantID, userID, req.URL.Query().Get("source"), limit)
+			if err != nil {
+				e.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": jobs})
+
+		case len(parts) == 1 && path != "" && req.Method == http.MethodGet:
+			job, err := e.tenantJob(req, tenantID, parts[0])
+			if err != nil {
+				e.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, job)
+
+		case len(parts) == 2 && parts[1] == "download" && req.Method == http.MethodGet:
+			job, err := e.tenantJob(req, tenantID, parts[0])
+			if err != nil {
+				e.writeError(w, req, err)
+				return
+			}
+			download, err := e.Download(req.Context(), job)
+			if err != nil {
+				e.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, download)
+
+		case len(parts) == 1 || (len(parts) == 2 && parts[1] == "download"):
+			httpresponse.ErrorStatus(w, req, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			httpresponse.ErrorStatus(w, req, http.StatusNotFound, "not found")
+		}
+	})
+}
+
+func (e *Exporter) tenantJob(req *http.Request, tenantID, id string) (*repository.ExportJob, error) {
+	job, err := e.Get(req.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if job.TenantID != tenantID || !requestedBy(req, job) {
+		return nil, repository.ErrExportJobNotFound
+	}
+	return job, nil
+}
+
+// requestedBy reports whether the caller may see job: it requested it or is
+// an admin.
+func requestedBy(req *http.Request, job *repository.ExportJob) bool {
+	userID, all := requester(req)
+	return all || (userID != "" && job.UserID == userID)
+}
+
+// requester returns the user whose exports the caller may see, or all for
+// admins, who see every export of their tenant.
+func requester(req *http.Request) (userID string, all bool) {
+	if rbac.Allows(middleware.GetPermissions(req.Context()), middleware.AdminPermission) {
+		return "", true
+	}
+	return middleware.GetUserID(req.Context()), false
+}
+
+func (e *Exporter) writeError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, ErrUnknownSource):
+		httpresponse.ErrorStatus(w, req, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNotReady):
+		httpresponse.ErrorStatus(w, req, http.StatusConflict, err.Error())
+	case errors.Is(err, repository.ErrExportJobNotFound):
+		httpresponse.ErrorStatus(w, req, http.StatusNotFound, err.Error())
+	default:
+		e.logger.Error("Export request failed", "error", err)
+		httpresponse.ErrorStatus(w, req, http.StatusInternalServerError, "export service unavailable")
+	}
+}
@@ -0,0 +1,199 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:  "text/csv",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// writer writes the rows of an export after its header.
+type writer interface {
+	Row(doc bson.M) error
+	Close() error
+}
+
+func newWriter(format string, out io.Writer, columns []Column) (writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(out, columns)
+	case FormatXLSX:
+		return newXLSXWriter(out, columns)
+	}
+	return nil, fmt.Errorf("%w: format must be csv or xlsx", ErrInvalidRequest)
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []Column
+	record  []string
+}
+
+func newCSVWriter(out io.Writer, columns []Column) (*csvWriter, error) {
+	w := &csvWriter{w: csv.NewWriter(out), columns: columns, record: make([]string, len(columns))}
+	for i, c := range columns {
+		w.record[i] = c.Header
+	}
+	return w, w.w.Write(w.record)
+}
+
+func (w *csvWriter) Row(doc bson.M) error {
+	for i, c := range w.columns {
+		w.record[i] = csvText(cellValue(lookup(doc, c.Field)))
+	}
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// csvText formats a cell for CSV. Text that a spreadsheet would evaluate as
+// a formula is prefixed with a quote, since exported names and notes are
+// user input.
+func csvText(v interface{}) string {
+	text := cellText(v)
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			text = "'" + text
+		}
+	}
+	return text
+}
+
+func cellText(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+type xlsxWriter struct {
+	file      *excelize.File
+	sheet     *excelize.StreamWriter
+	out       io.Writer
+	columns   []Column
+	row       int
+	dateStyle int
+}
+
+func newXLSXWriter(out io.Writer, columns []Column) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	sheet, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		return nil, err
+	}
+	headerStyle, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+	// Built-in format 22 is "m/d/yy h:mm", shown in the reader's locale.
+	dateStyle, err := file.NewStyle(&excelize.Style{NumFmt: 22})
+	if err != nil {
+		return nil, err
+	}
+
+	w := &xlsxWriter{file: file, sheet: sheet, out: out, columns: columns, row: 1, dateStyle: dateStyle}
+	header := make([]interface{}, len(columns))
+	for i, c := range columns {
+		header[i] = excelize.Cell{StyleID: headerStyle, Value: c.Header}
+	}
+	if err := sheet.SetRow("A1", header, excelize.RowOpts{}); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *xlsxWriter) Row(doc bson.M) error {
+	w.row++
+	cells := make([]interface{}, len(w.columns))
+	for i, c := range w.columns {
+		value := cellValue(lookup(doc, c.Field))
+		switch v := value.(type) {
+		case time.Time:
+			value = excelize.Cell{StyleID: w.dateStyle, Value: v}
+		case string:
+			if c.Number {
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					value = n
+				}
+			}
+		}
+		cells[i] = value
+	}
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	return w.sheet.SetRow(cell, cells)
+}
+
+func (w *xlsxWriter) Close() error {
+	defer w.file.Close()
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.file.Write(w.out)
+}
+
+// lookup returns the value at a dotted path of doc.
+func lookup(doc bson.M, path string) interface{} {
+	var value interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(bson.M)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// cellValue converts a decoded BSON value to a string, number, bool or
+// time. Unset and zero times are empty, lists are joined and embedded
+// documents are written as JSON.
+func cellValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string, bool, int32, int64, float64:
+		return v
+	case primitive.DateTime:
+		return cellValue(v.Time())
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC()
+	case primitive.Decimal128:
+		return v.String()
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.A:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = cellText(cellValue(item))
+		}
+		return strings.Join(parts, ", ")
+	case bson.M, bson.D:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,553 @@
+// Package extraction reads supplier invoices: the supplier, number, dates,
+// totals and line items of the text of an uploaded invoice. Fields are read
+// where the supplier's template says when it has learnt where, and guessed
+// from the usual layout of invoices otherwise. Templates learn from the
+// corrections reviewers make to what was read.
+package extraction
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+// Confidence of values by how they were found.
+const (
+	confidenceTemplate   = 0.95
+	confidenceLabelled   = 0.8
+	confidenceGeneric    = 0.6
+	confidenceGuess      = 0.4
+	confidenceConsistent = 0.9
+)
+
+// Result is what was read from an invoice's text.
+type Result struct {
+	Fields map[string]domain.ExtractedField
+	Lines  []domain.SupplierInvoiceLine
+	// Template is the supplier's template the text was read with, if the
+	// supplier was recognized.
+	Template *domain.SupplierTemplate
+}
+
+var (
+	amountPattern = `-?\d{1,3}(?:[,.' ]?\d{3})*[.,]\d{2}`
+	amountRe      = regexp.MustCompile(amountPattern)
+	dateRe        = regexp.MustCompile(`(?i)\b(\d{4}-\d{1,2}-\d{1,2}|\d{1,2}[./-]\d{1,2}[./-]\d{2,4}|\d{1,2}\.?\s+[a-z]{3,9}\.?,?\s+\d{4}|[a-z]{3,9}\.?\s+\d{1,2},?\s+\d{4})\b`)
+	numberRe      = regexp.MustCompile(`(?i)\b(?:invoice|inv|bill)\s*(?:no\.?|nr\.?|number|num|#)?\s*[:#]?\s*([a-z0-9][a-z0-9\-/.]*\d[a-z0-9\-/]*)`)
+	currencyRe    = regexp.MustCompile(`\b(EUR|USD|GBP|CHF|BGN|RON|PLN|CZK|HUF|SEK|NOK|DKK|JPY|CNY|CAD|AUD|NZD|TRY)\b`)
+	lineItemRe    = regexp.MustCompile(`^\s*(.*?[\p{L}].*?)\s+(\d+(?:[.,]\d+)?)\s*(?:x|@|pcs|units?|ea)?\s+[€£$]?\s*(` + amountPattern + `)\s+[€£$]?\s*(` + amountPattern + `)\s*(?:[€£$]|[A-Z]{3})?\s*$`)
+	columnRe      = regexp.MustCompile(`\s{2,}|\t`)
+)
+
+var currencySymbols = map[string]string{"€": "EUR", "£": "GBP", "$": "USD", "лв": "BGN"}
+
+// Labels invoices commonly put before each field, most specific first.
+var (
+	issueDateLabels = []string{"invoice date", "date of issue", "issue date", "issued on", "tax point", "date"}
+	dueDateLabels   = []string{"due date", "payment due", "due by", "pay by", "due on", "due"}
+	totalLabels     = []string{"total due", "amount due", "balance due", "grand total", "invoice total", "total amount", "amount payable", "total"}
+	subtotalLabels  = []string{"subtotal", "sub-total", "sub total", "net total", "total net", "net amount", "total excl", "total before tax"}
+	taxLabels       = []string{"vat amount", "total vat", "total tax", "tax amount", "sales tax", "vat", "gst", "tax"}
+)
+
+// titleWords mark the lines at the top of an invoice that are not the
+// supplier's name.
+var titleWords = regexp.MustCompile(`(?i)\b(invoice|bill|receipt|statement|page|tax|credit note|date|no\.?)\b`)
+
+// Extract reads an invoice's text with the tenant's supplier templates.
+func Extract(text string, templates []*domain.SupplierTemplate) *Result {
+	lines := splitLines(text)
+	result := &Result{Fields: make(map[string]domain.ExtractedField), Template: recognize(lines, templates)}
+
+	layout := ""
+	if result.Template != nil {
+		layout = result.Template.DateLayout
+		result.set(domain.SupplierFieldSupplierName, result.Template.SupplierName, confidenceTemplate, domain.FieldSourceTemplate)
+		if result.Template.Currency != "" {
+			result.set(domain.SupplierFieldCurrency, result.Template.Currency, confidenceTemplate, domain.FieldSourceTemplate)
+		}
+		for field, label := range result.Template.Labels {
+			values := valuesAfter(lines, label)
+			if field == domain.SupplierFieldTotal {
+				reverse(values)
+			}
+			for _, text := range values {
+				if isAmountField(field) && !startsAmount(text) {
+					continue
+				}
+				if value, ok := readField(field, text, layout); ok {
+					result.set(field, value, confidenceTemplate, domain.FieldSourceTemplate)
+					break
+				}
+			}
+		}
+	}
+
+	result.guessSupplier(lines)
+	result.guessNumber(lines)
+	result.guessDate(domain.SupplierFieldDueDate, lines, dueDateLabels, layout, nil)
+	result.guessDate(domain.SupplierFieldIssueDate, lines, issueDateLabels, layout, dueDateLabels)
+	result.guessAmount(domain.SupplierFieldSubtotal, lines, subtotalLabels, nil)
+	result.guessAmount(domain.SupplierFieldTaxAmount, lines, taxLabels, []string{"total incl", "including", "incl."})
+	result.guessAmount(domain.SupplierFieldTotal, lines, totalLabels, append(subtotalLabels, taxLabels[:3]...))
+	result.guessCurrency(lines)
+	result.Lines = lineItems(lines)
+	result.reconcile()
+	return result
+}
+
+// set records a field unless a value was found with more confidence.
+func (r *Result) set(field, value string, confidence float64, source string) {
+	if value == "" {
+		return
+	}
+	if current, ok := r.Fields[field]; ok && current.Confidence >= confidence {
+		return
+	}
+	r.Fields[field] = domain.ExtractedField{Value: value, Confidence: confidence, Source: source}
+}
+
+func (r *Result) has(field string) bool {
+	_, ok := r.Fields[field]
+	return ok
+}
+
+// recognize returns the template of the supplier whose name appears in the
+// text, preferring the longest name.
+func recognize(lines []string, templates []*domain.SupplierTemplate) *domain.SupplierTemplate {
+	keys := make([]string, 0, len(lines))
+	for _, line := range lines {
+		keys = append(keys, domain.SupplierKey(line))
+	}
+	all := strings.Join(keys, "")
+
+	var best *domain.SupplierTemplate
+	for _, template := range templates {
+		key := template.SupplierKey
+		if len(key) < 3 || !strings.Contains(all, key) {
+			continue
+		}
+		if best == nil || len(key) > len(best.SupplierKey) {
+			best = template
+		}
+	}
+	return best
+}
+
+// guessSupplier takes the first line at the top of the invoice that is not
+// a title, trusting it more when it ends in a legal form.
+func (r *Result) guessSupplier(lines []string) {
+	for i, line := range lines {
+		if i >= 6 {
+			return
+		}
+		name := strings.TrimSpace(columnRe.Split(line, 2)[0])
+		if name == "" || titleWords.MatchString(name) || !hasLetter(name) || amountRe.MatchString(name) {
+			continue
+		}
+		confidence := confidenceGuess
+		if endsInLegalForm(name) {
+			confidence = confidenceGeneric
+		}
+		r.set(domain.SupplierFieldSupplierName, name, confidence, domain.FieldSourceHeuristic)
+		return
+	}
+}
+
+func (r *Result) guessNumber(lines []string) {
+	for _, line := range lines {
+		if match := numberRe.FindStringSubmatch(line); match != nil {
+			if dateRe.MatchString(match[1]) {
+				continue
+			}
+			r.set(domain.SupplierFieldInvoiceNumber, strings.TrimRight(match[1], "."), confidenceLabelled, domain.FieldSourceHeuristic)
+			return
+		}
+	}
+}
+
+// guessDate reads the date after the first of labels found. The last,
+// generic label is not looked for on lines holding any of except.
+func (r *Result) guessDate(field string, lines, labels []string, layout string, except []string) {
+	for i, label := range labels {
+		generic := i == len(labels)-1
+		for _, line := range lines {
+			lower := strings.ToLower(line)
+			if !hasWord(lower, label) || (generic && containsAny(lower, except)) {
+				continue
+			}
+			values := valuesAfter([]string{line}, label)
+			if len(values) == 0 {
+				continue
+			}
+			if value, ok := readField(field, values[0], layout); ok {
+				confidence := confidenceLabelled
+				if generic {
+					confidence = confidenceGeneric
+				}
+				r.set(field, value, confidence, domain.FieldSourceHeuristic)
+				return
+			}
+		}
+	}
+}
+
+// guessAmount reads the amount on the line of the first of labels found,
+// the last such line for totals, which close an invoice.
+func (r *Result) guessAmount(field string, lines, labels, except []string) {
+	for i, label := range labels {
+		value, found := "", false
+		for _, line := range lines {
+			lower := strings.ToLower(line)
+			if !hasWord(lower, label) || containsAny(lower, except) {
+				continue
+			}
+			amounts := amountRe.FindAllString(lower[strings.Index(lower, label):], -1)
+			if len(amounts) == 0 {
+				continue
+			}
+			if amount, ok := parseAmount(amounts[len(amounts)-1]); ok {
+				value, found = amount.StringFixed(2), true
+				if field != domain.SupplierFieldTotal {
+					break
+				}
+			}
+		}
+		if found {
+			confidence := confidenceLabelled
+			if i == len(labels)-1 {
+				confidence = confidenceGeneric
+			}
+			r.set(field, value, confidence, domain.FieldSourceHeuristic)
+			return
+		}
+	}
+}
+
+// guessCurrency takes the currency on the total's line, or the one the
+// text names most.
+func (r *Result) guessCurrency(lines []string) {
+	counts := make(map[string]int)
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		currencies := currencyRe.FindAllString(line, -1)
+		for symbol, code := range currencySymbols {
+			if strings.Contains(line, symbol) {
+				currencies = append(currencies, code)
+			}
+		}
+		for _, code := range currencies {
+			counts[code]++
+			if hasWord(lower, "total") && !containsAny(lower, subtotalLabels) {
+				r.set(domain.SupplierFieldCurrency, code, confidenceLabelled, domain.FieldSourceHeuristic)
+			}
+		}
+	}
+	best, most := "", 0
+	for code, count := range counts {
+		if count > most || (count == most && code < best) {
+			best, most = code, count
+		}
+	}
+	r.set(domain.SupplierFieldCurrency, best, confidenceGuess, domain.FieldSourceHeuristic)
+}
+
+// lineItems reads the lines of a description, quantity, unit price and
+// amount that agree with each other.
+func lineItems(lines []string) []domain.SupplierInvoiceLine {
+	items := []domain.SupplierInvoiceLine{}
+	for _, line := range lines {
+		match := lineItemRe.FindStringSubmatch(line)
+		if match == nil || containsAny(strings.ToLower(match[1]), append(totalLabels, taxLabels...)) {
+			continue
+		}
+		quantity, err := decimal.NewFromString(strings.ReplaceAll(match[2], ",", "."))
+		if err != nil {
+			continue
+		}
+		unitPrice, ok1 := parseAmount(match[3])
+		amount, ok2 := parseAmount(match[4])
+		if !ok1 || !ok2 || !quantity.Mul(unitPrice).Round(2).Equal(amount) {
+			continue
+		}
+		items = append(items, domain.SupplierInvoiceLine{
+			Description: strings.TrimSpace(match[1]),
+			Quantity:    quantity,
+			UnitPrice:   unitPrice,
+			Amount:      amount,
+		})
+	}
+	return items
+}
+
+// reconcile trusts totals that add up, and works out the one missing when
+// the other two are known.
+func (r *Result) reconcile() {
+	subtotal, okSubtotal := r.amount(domain.SupplierFieldSubtotal)
+	tax, okTax := r.amount(domain.SupplierFieldTaxAmount)
+	total, okTotal := r.amount(domain.SupplierFieldTotal)
+	switch {
+	case okSubtotal && okTax && okTotal:
+		if subtotal.Add(tax).Equal(total) {
+			for _, field := range []string{domain.SupplierFieldSubtotal, domain.SupplierFieldTaxAmount, domain.SupplierFieldTotal} {
+				r.boost(field, confidenceConsistent)
+			}
+		}
+	case okSubtotal && okTax:
+		r.set(domain.SupplierFieldTotal, subtotal.Add(tax).StringFixed(2), confidenceGeneric, domain.FieldSourceHeuristic)
+	case okTotal && okTax:
+		r.set(domain.SupplierFieldSubtotal, total.Sub(tax).StringFixed(2), confidenceGeneric, domain.FieldSourceHeuristic)
+	}
+
+	if len(r.Lines) > 0 {
+		sum := decimal.Zero
+		for _, line := range r.Lines {
+			sum = sum.Add(line.Amount)
+		}
+		if subtotal, ok := r.amount(domain.SupplierFieldSubtotal); ok && subtotal.Equal(sum) {
+			r.boost(domain.SupplierFieldSubtotal, confidenceConsistent)
+		} else if !r.has(domain.SupplierFieldSubtotal) {
+			r.set(domain.SupplierFieldSubtotal, sum.StringFixed(2), confidenceGuess, domain.FieldSourceHeuristic)
+		}
+	}
+}
+
+func (r *Result) amount(field string) (decimal.Decimal, bool) {
+	extracted, ok := r.Fields[field]
+	if !ok {
+		return decimal.Zero, false
+	}
+	amount, err := decimal.NewFromString(extracted.Value)
+	return amount, err == nil
+}
+
+func (r *Result) boost(field string, confidence float64) {
+	if current, ok := r.Fields[field]; ok && current.Confidence < confidence {
+		current.Confidence = confidence
+		r.Fields[field] = current
+	}
+}
+
+// valuesAfter returns the text after each instance of label in lines, top
+// down: the rest of its line, or the next line when the label closes its
+// line. Instances within a longer word are skipped.
+func valuesAfter(lines []string, label string) []string {
+	var values []string
+	for i, line := range lines {
+		for offset := 0; offset < len(line); {
+			index := indexFold(line[offset:], label)
+			if index < 0 {
+				break
+			}
+			start, end := offset+index, offset+index+len(label)
+			offset = start + 1
+			if (start > 0 && isWordRune(line[start-1])) || (end < len(line) && isWordRune(line[end])) {
+				continue
+			}
+			values = append(values, nextValue(lines, i, strings.TrimLeft(line[end:], " \t:#.-")))
+		}
+	}
+	return values
+}
+
+func nextValue(lines []string, i int, rest string) string {
+	if rest != "" {
+		return rest
+	}
+	for _, next := range lines[i+1:] {
+		if strings.TrimSpace(next) != "" {
+			return strings.TrimSpace(next)
+		}
+	}
+	return ""
+}
+
+// startsAmount reports whether text starts with an amount, so that the
+// label "Total" is not read on a "Total VAT" line.
+var startsAmount = regexp.MustCompile(`^\s*(?:[€£$]|[A-Z]{3})?\s*-?\d`).MatchString
+
+// readField parses a field out of the text following its label, in the
+// form the field is stored in.
+func readField(field, text, layout string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", false
+	}
+	switch field {
+	case domain.SupplierFieldIssueDate, domain.SupplierFieldDueDate:
+		match := dateRe.FindString(text)
+		if match == "" {
+			return "", false
+		}
+		date, ok := parseDate(match, layout)
+		if !ok {
+			return "", false
+		}
+		return date.Format("2006-01-02"), true
+	case domain.SupplierFieldSubtotal, domain.SupplierFieldTaxAmount, domain.SupplierFieldTotal:
+		match := amountRe.FindString(text)
+		amount, ok := parseAmount(match)
+		if !ok {
+			return "", false
+		}
+		return amount.StringFixed(2), true
+	case domain.SupplierFieldCurrency:
+		if code := currencyRe.FindString(text); code != "" {
+			return code, true
+		}
+		return "", false
+	default:
+		value := strings.TrimRight(columnRe.Split(text, 2)[0], ".,;")
+		if words := strings.Fields(value); field == domain.SupplierFieldInvoiceNumber && len(words) > 0 {
+			value = words[0]
+		}
+		return value, value != ""
+	}
+}
+
+// parseAmount reads an amount written with either decimal separator and any
+// thousands separator: "1,234.56", "1.234,56" and "1 234,56".
+func parseAmount(text string) (decimal.Decimal, bool) {
+	text = strings.TrimSpace(text)
+	if len(text) < 4 {
+		return decimal.Zero, false
+	}
+	negative := strings.HasPrefix(text, "-")
+	separator := len(text) - 3
+	if text[separator] != '.' && text[separator] != ',' {
+		return decimal.Zero, false
+	}
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, text[:separator])
+	amount, err := decimal.NewFromString(digits + "." + text[separator+1:])
+	if err != nil {
+		return decimal.Zero, false
+	}
+	if negative {
+		amount = amount.Neg()
+	}
+	return amount, true
+}
+
+// Layouts of numeric dates in which day and month can be told apart only by
+// the supplier's habit.
+const (
+	LayoutDayFirst   = "02/01/2006"
+	LayoutMonthFirst = "01/02/2006"
+)
+
+var textDateLayouts = []string{
+	"2006-1-2", "2 Jan 2006", "2 January 2006", "2. January 2006", "2 Jan. 2006",
+	"Jan 2, 2006", "January 2, 2006", "Jan 2 2006", "January 2 2006", "Jan. 2, 2006",
+}
+
+// parseDate reads a date. Numeric dates are read day first unless layout
+// says month first, or the first number cannot be a month.
+func parseDate(text, layout string) (time.Time, bool) {
+	text = strings.Join(strings.Fields(text), " ")
+	for _, candidate := range textDateLayouts {
+		if date, err := time.Parse(candidate, text); err == nil {
+			return date, true
+		}
+	}
+
+	parts := strings.FieldsFunc(text, func(r rune) bool { return r == '/' || r == '.' || r == '-' })
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	if len(parts[2]) == 2 {
+		parts[2] = "20" + parts[2]
+	}
+	day, month := parts[0], parts[1]
+	if layout == LayoutMonthFirst {
+		day, month = month, day
+	}
+	date, err := time.Parse("2/1/2006", day+"/"+month+"/"+parts[2])
+	if err != nil && layout == "" {
+		date, err = time.Parse("2/1/2006", month+"/"+day+"/"+parts[2])
+	}
+	return date, err == nil
+}
+
+func splitLines(text string) []string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return lines
+}
+
+// hasWord reports whether text holds word on its own, not within another
+// word: "total" is not in "subtotal".
+func hasWord(text, word string) bool {
+	for offset := 0; ; {
+		index := strings.Index(text[offset:], word)
+		if index < 0 {
+			return false
+		}
+		start, end := offset+index, offset+index+len(word)
+		if (start == 0 || !isWordRune(text[start-1])) && (end == len(text) || !isWordRune(text[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isWordRune(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+func isAmountField(field string) bool {
+	return field == domain.SupplierFieldSubtotal || field == domain.SupplierFieldTaxAmount || field == domain.SupplierFieldTotal
+}
+
+func reverse(values []string) {
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
+	}
+}
+
+// indexFold returns the index of the first instance of substr in s, case
+// insensitively.
+func indexFold(s, substr string) int {
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		// Lower-casing changed the length of some letter, so indexes into
+		// lower are not indexes into s.
+		return strings.Index(s, substr)
+	}
+	return strings.Index(lower, strings.ToLower(substr))
+}
+
+// endsInLegalForm reports whether name ends in a company's legal form, such
+// as Ltd or GmbH, which supplier names at the top of invoices often do.
+func endsInLegalForm(name string) bool {
+	plain := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+	return domain.SupplierKey(name) != plain
+}
+
+func containsAny(text string, words []string) bool {
+	for _, word := range words {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLetter(text string) bool {
+	return strings.IndexFunc(text, unicode.IsLetter) >= 0
+}
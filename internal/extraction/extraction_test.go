@@ -0,0 +1,235 @@
+package extraction
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const acmeInvoice = `ACME Supplies Ltd
+12 Harbour Road, Bristol BS1 4RN
+VAT Reg No: GB 123 4567 89
+
+INVOICE
+Invoice No: AS-20931
+Invoice Date: 05/10/2026
+Due Date: 04/11/2026
+
+Description              Qty   Unit Price     Amount
+Copy paper A4 (box)        4        21.50      86.00
+Toner cartridge TN-2420    2        54.00     108.00
+
+Subtotal                                      194.00
+VAT 20%                                        38.80
+Total due                               GBP   232.80
+`
+
+func TestExtract_Heuristics(t *testing.T) {
+	result := Extract(acmeInvoice, nil)
+	assert.Nil(t, result.Template)
+
+	values := make(map[string]string)
+	for field, extracted := range result.Fields {
+		values[field] = extracted.Value
+		assert.Equal(t, domain.FieldSourceHeuristic, extracted.Source, field)
+	}
+	assert.Equal(t, map[string]string{
+		domain.SupplierFieldSupplierName:  "ACME Supplies Ltd",
+		domain.SupplierFieldInvoiceNumber: "AS-20931",
+		domain.SupplierFieldIssueDate:     "2026-10-05",
+		domain.SupplierFieldDueDate:       "2026-11-04",
+		domain.SupplierFieldCurrency:      "GBP",
+		domain.SupplierFieldSubtotal:      "194.00",
+		domain.SupplierFieldTaxAmount:     "38.80",
+		domain.SupplierFieldTotal:         "232.80",
+	}, values)
+	assert.Equal(t, confidenceConsistent, result.Fields[domain.SupplierFieldTotal].Confidence, "totals that add up are trusted")
+
+	require.Len(t, result.Lines, 2)
+	assert.Equal(t, "Toner cartridge TN-2420", result.Lines[1].Description)
+	assert.Equal(t, "2", result.Lines[1].Quantity.String())
+	assert.Equal(t, "108", result.Lines[1].Amount.String())
+
+	invoice := domain.NewSupplierInvoice(uuid.New(), uuid.New(), result.Fields, result.Lines)
+	assert.Empty(t, invoice.Warnings)
+	assert.Equal(t, "acmesupplies", invoice.SupplierKey)
+}
+
+// A supplier writing dates month first, with its own labels, is read wrong
+// until a reviewer's corrections teach its template.
+const globexInvoice = `GLOBEX CORPORATION
+Ref.     GX/7781/26
+Billed   10/06/2026
+Payable by   11/05/2026
+Net    1.250,00 EUR
+Tax    237,50 EUR
+Pay this amount    1.487,50 EUR
+`
+
+func TestLearn_CorrectionsTeachTemplate(t *testing.T) {
+	result := Extract(globexInvoice, nil)
+	assert.Equal(t, "GLOBEX CORPORATION", result.Fields[domain.SupplierFieldSupplierName].Value)
+	assert.NotContains(t, result.Fields, domain.SupplierFieldInvoiceNumber)
+	assert.NotContains(t, result.Fields, domain.SupplierFieldIssueDate)
+	assert.Equal(t, "EUR", result.Fields[domain.SupplierFieldCurrency].Value)
+
+	template := domain.NewSupplierTemplate(uuid.New(), "Globex Corporation")
+	corrections := map[string]string{
+		domain.SupplierFieldInvoiceNumber: "GX/7781/26",
+		domain.SupplierFieldIssueDate:     "2026-10-06",
+		domain.SupplierFieldDueDate:       "2026-11-05",
+		domain.SupplierFieldSubtotal:      "1250.00",
+		domain.SupplierFieldTaxAmount:     "237.50",
+		domain.SupplierFieldTotal:         "1487.50",
+	}
+	for field, value := range corrections {
+		assert.True(t, Learn(template, globexInvoice, field, value), field)
+	}
+	assert.False(t, Learn(template, globexInvoice, domain.SupplierFieldTotal, "999.99"), "values not on the page teach nothing")
+	assert.Equal(t, map[string]string{
+		domain.SupplierFieldInvoiceNumber: "Ref",
+		domain.SupplierFieldIssueDate:     "Billed",
+		domain.SupplierFieldDueDate:       "Payable by",
+		domain.SupplierFieldSubtotal:      "Net",
+		domain.SupplierFieldTaxAmount:     "Tax",
+		domain.SupplierFieldTotal:         "Pay this amount",
+	}, template.Labels)
+	assert.Equal(t, LayoutMonthFirst, template.DateLayout)
+	assert.Equal(t, len(corrections), template.Corrections)
+
+	next := `Globex Corporation
+Ref.     GX/8120/26
+Billed   11/02/2026
+Payable by   12/02/2026
+Net    300,00 EUR
+Tax    57,00 EUR
+Pay this amount    357,00 EUR
+`
+	result = Extract(next, []*domain.SupplierTemplate{templateFor("Initech"), template})
+	require.Same(t, template, result.Template)
+	for field, value := range map[string]string{
+		domain.SupplierFieldSupplierName:  "Globex Corporation",
+		domain.SupplierFieldInvoiceNumber: "GX/8120/26",
+		domain.SupplierFieldIssueDate:     "2026-11-02",
+		domain.SupplierFieldDueDate:       "2026-12-02",
+		domain.SupplierFieldSubtotal:      "300.00",
+		domain.SupplierFieldTaxAmount:     "57.00",
+		domain.SupplierFieldTotal:         "357.00",
+	} {
+		assert.Equal(t, value, result.Fields[field].Value, field)
+		assert.Equal(t, domain.FieldSourceTemplate, result.Fields[field].Source, field)
+	}
+}
+
+func templateFor(name string) *domain.SupplierTemplate {
+	template := domain.NewSupplierTemplate(uuid.New(), name)
+	template.Labels[domain.SupplierFieldTotal] = "Total"
+	return template
+}
+
+func TestParseAmount(t *testing.T) {
+	for text, expected := range map[string]string{
+		"1,234.56":     "1234.56",
+		"1.234,56":     "1234.56",
+		"1 234,56":     "1234.56",
+		"1'234.56":     "1234.56",
+		"12.50":        "12.5",
+		"-86,00":       "-86",
+		"1,234,567.89": "1234567.89",
+	} {
+		amount, ok := parseAmount(text)
+		require.True(t, ok, text)
+		assert.Equal(t, expected, amount.String(), text)
+	}
+	_, ok := parseAmount("1234")
+	assert.False(t, ok)
+}
+
+func TestParseDate(t *testing.T) {
+	for _, tc := range []struct {
+		text, layout, expected string
+	}{
+		{"05/10/2026", "", "2026-10-05"},
+		{"05/10/2026", LayoutMonthFirst, "2026-05-10"},
+		{"10/25/2026", "", "2026-10-25"},
+		{"05.10.26", "", "2026-10-05"},
+		{"2026-10-05", LayoutMonthFirst, "2026-10-05"},
+		{"5 October 2026", "", "2026-10-05"},
+		{"Oct 5, 2026", "", "2026-10-05"},
+	} {
+		date, ok := parseDate(tc.text, tc.layout)
+		require.True(t, ok, tc.text)
+		assert.Equal(t, tc.expected, date.Format("2006-01-02"), tc.text)
+	}
+	_, ok := parseDate("25/13/2026", LayoutDayFirst)
+	assert.False(t, ok)
+}
+
+func TestOCR_Text(t *testing.T) {
+	ocr := NewOCR("")
+	text, err := ocr.Text(context.Background(), []byte("Invoice No: 1"), "text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice No: 1", text)
+
+	_, err = ocr.Text(context.Background(), nil, "application/zip")
+	assert.ErrorIs(t, err, ErrUnsupportedFile)
+
+	missing := &OCR{Tesseract: "ims-erp-no-such-tesseract", PDFToText: "ims-erp-no-such-pdftotext", Languages: "eng"}
+	for _, mimeType := range []string{"image/png", "application/pdf"} {
+		_, err = missing.Text(context.Background(), []byte("data"), mimeType)
+		assert.ErrorIs(t, err, ErrToolMissing, mimeType)
+	}
+}
+
+func TestWordText(t *testing.T) {
+	var docx bytes.Buffer
+	archive := zip.NewWriter(&docx)
+	body, err := archive.Create("word/document.xml")
+	require.NoError(t, err)
+	_, err = body.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Service </w:t></w:r><w:r><w:t>Agreement</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Value</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>1,200.00</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	text, err := WordText(docx.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "Service Agreement\nValue\t1,200.00\n", text)
+
+	_, err = WordText([]byte("not a zip"))
+	assert.Error(t, err)
+}
+
+func TestTika_Text(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/tika", r.URL.Path)
+		assert.Equal(t, "text/plain", r.Header.Get("Accept"))
+		if r.Header.Get("Content-Type") == "application/zip" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write(bytes.ToUpper(body))
+	}))
+	defer server.Close()
+
+	tika := NewTika(server.URL + "/")
+	text, err := tika.Text(context.Background(), []byte("quarterly report"), "application/vnd.ms-excel")
+	require.NoError(t, err)
+	assert.Equal(t, "QUARTERLY REPORT", text)
+
+	_, err = tika.Text(context.Background(), nil, "application/zip")
+	assert.ErrorIs(t, err, ErrUnsupportedFile)
+}
@@ -0,0 +1,187 @@
+package extraction
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+)
+
+// maxLabelLength bounds labels learnt, so that a value found mid-sentence
+// does not make the whole sentence its label.
+const maxLabelLength = 40
+
+// Learn teaches template where field's corrected value is in text: the
+// label it follows, and for dates the supplier's layout. It reports whether
+// the template learnt anything; values not found in the text teach nothing.
+func Learn(template *domain.SupplierTemplate, text, field, value string) bool {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "", field == domain.SupplierFieldSupplierName:
+		// Suppliers are recognized by the name their template is for.
+		return false
+	case field == domain.SupplierFieldCurrency:
+		template.Currency = strings.ToUpper(value)
+		template.Corrected()
+		return true
+	}
+
+	lines := splitLines(text)
+	// Totals close an invoice, after line amounts that may be the same.
+	last := field == domain.SupplierFieldTotal
+	for _, form := range writtenForms(field, value) {
+		for _, at := range occurrences(lines, form.text, last) {
+			label := labelBefore(lines, at.line, at.index)
+			if label == "" {
+				continue
+			}
+			if template.Labels == nil {
+				template.Labels = make(map[string]string)
+			}
+			template.Labels[field] = label
+			if form.layout != "" {
+				template.DateLayout = form.layout
+			}
+			template.Corrected()
+			return true
+		}
+	}
+	return false
+}
+
+// writtenForm is a way a value may be written on an invoice, with the date
+// layout it tells when it tells one.
+type writtenForm struct {
+	text   string
+	layout string
+}
+
+// writtenForms lists the ways value may be written on an invoice.
+func writtenForms(field, value string) []writtenForm {
+	switch field {
+	case domain.SupplierFieldIssueDate, domain.SupplierFieldDueDate:
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil
+		}
+		dayFirst, monthFirst := LayoutDayFirst, LayoutMonthFirst
+		if date.Day() == int(date.Month()) {
+			// Either way round reads the same.
+			dayFirst, monthFirst = "", ""
+		}
+		forms := []writtenForm{}
+		for _, separator := range []string{"/", ".", "-"} {
+			forms = append(forms,
+				writtenForm{date.Format("02" + separator + "01" + separator + "2006"), dayFirst},
+				writtenForm{date.Format("2" + separator + "1" + separator + "2006"), dayFirst},
+				writtenForm{date.Format("01" + separator + "02" + separator + "2006"), monthFirst},
+				writtenForm{date.Format("1" + separator + "2" + separator + "2006"), monthFirst},
+				writtenForm{date.Format("02" + separator + "01" + separator + "06"), dayFirst},
+				writtenForm{date.Format("01" + separator + "02" + separator + "06"), monthFirst},
+			)
+		}
+		forms = append(forms, writtenForm{text: value})
+		for _, layout := range textDateLayouts {
+			forms = append(forms, writtenForm{text: date.Format(layout)})
+		}
+		return forms
+	case domain.SupplierFieldSubtotal, domain.SupplierFieldTaxAmount, domain.SupplierFieldTotal:
+		amount, err := decimal.NewFromString(value)
+		if err != nil {
+			return nil
+		}
+		plain := amount.StringFixed(2)
+		whole, cents := plain[:len(plain)-3], plain[len(plain)-2:]
+		forms := []writtenForm{{text: plain}, {text: whole + "," + cents}}
+		for _, separators := range [][2]string{{",", "."}, {".", ","}, {" ", ","}, {"'", "."}} {
+			if grouped := groupThousands(whole, separators[0]); grouped != whole {
+				forms = append(forms, writtenForm{text: grouped + separators[1] + cents})
+			}
+		}
+		return forms
+	default:
+		return []writtenForm{{text: value}}
+	}
+}
+
+func groupThousands(whole, separator string) string {
+	negative := strings.HasPrefix(whole, "-")
+	whole = strings.TrimPrefix(whole, "-")
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + separator + whole[i:]
+	}
+	if negative {
+		whole = "-" + whole
+	}
+	return whole
+}
+
+type occurrence struct {
+	line, index int
+}
+
+// occurrences returns where text stands on its own in lines, case
+// insensitively: not within a longer word or number. last lists them
+// bottom up.
+func occurrences(lines []string, text string, last bool) []occurrence {
+	var found []occurrence
+	for i, line := range lines {
+		for offset := 0; offset < len(line); {
+			index := indexFold(line[offset:], text)
+			if index < 0 {
+				break
+			}
+			start, end := offset+index, offset+index+len(text)
+			if (start == 0 || !isValueRune(line[start-1])) && (end == len(line) || !isValueRune(line[end])) {
+				found = append(found, occurrence{line: i, index: start})
+			}
+			offset = start + 1
+		}
+	}
+	if last {
+		for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+			found[i], found[j] = found[j], found[i]
+		}
+	}
+	return found
+}
+
+func isValueRune(b byte) bool {
+	return isWordRune(b) || b == '.' || b == ','
+}
+
+// labelBefore returns the label of the value at index on a line: the
+// column before it on the line, or the line above when the value starts
+// its line. Labels hold a letter.
+func labelBefore(lines []string, line, index int) string {
+	before := strings.TrimRight(lines[line][:index], " \t:#.-")
+	for strings.TrimSpace(before) == "" && line > 0 {
+		line--
+		before = lines[line]
+		if strings.TrimSpace(before) != "" {
+			break
+		}
+	}
+	columns := columnRe.Split(strings.TrimSpace(before), -1)
+	label := strings.TrimRight(strings.TrimSpace(columns[len(columns)-1]), " \t:#.-")
+	// Currency symbols and codes stand between some labels and amounts.
+	label = strings.TrimSpace(strings.TrimRightFunc(label, func(r rune) bool {
+		return r == '€' || r == '£' || r == '$' || unicode.IsSpace(r)
+	}))
+	if words := strings.Fields(label); len(words) > 1 && currencyRe.MatchString(words[len(words)-1]) {
+		label = strings.Join(words[:len(words)-1], " ")
+	}
+	for len(label) > maxLabelLength {
+		words := strings.Fields(label)
+		if len(words) < 2 {
+			return ""
+		}
+		label = strings.Join(words[1:], " ")
+	}
+	if !hasLetter(label) || amountRe.MatchString(label) {
+		return ""
+	}
+	return label
+}
@@ -0,0 +1,76 @@
+package extraction
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+// ErrUnsupportedFile is returned for files text cannot be read from.
+var ErrUnsupportedFile = errors.New("extraction: cannot read text from this file type")
+
+// ErrToolMissing is returned when the command a file's text is read with is
+// not installed.
+var ErrToolMissing = errors.New("extraction: text extraction tool is not installed")
+
+// OCR reads the text of uploaded files: scans and photos with Tesseract,
+// PDFs with pdftotext, falling back to Tesseract for scanned PDFs without a
+// text layer.
+type OCR struct {
+	// Tesseract and PDFToText are the commands run, looked up in PATH
+	// unless absolute.
+	Tesseract string
+	PDFToText string
+	// Languages are Tesseract's, such as "eng+deu".
+	Languages string
+}
+
+// NewOCR returns an OCR running the default commands for languages.
+func NewOCR(languages string) *OCR {
+	if languages == "" {
+		languages = "eng"
+	}
+	return &OCR{Tesseract: "tesseract", PDFToText: "pdftotext", Languages: languages}
+}
+
+// Text returns the text of data, a file of mimeType.
+func (o *OCR) Text(ctx context.Context, data []byte, mimeType string) (string, error) {
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		return string(data), nil
+	case mimeType == "application/pdf":
+		// -layout keeps columns apart, which labels and values are told
+		// apart by.
+		// Without pdftotext, Tesseract still reads the PDF.
+		text, err := o.run(ctx, data, o.PDFToText, "-layout", "-", "-")
+		if (err != nil && !errors.Is(err, ErrToolMissing)) || strings.TrimSpace(text) != "" {
+			return text, err
+		}
+		return o.run(ctx, data, o.Tesseract, "stdin", "stdout", "-l", o.Languages, "--psm", "6")
+	case strings.HasPrefix(mimeType, "image/"):
+		// Page segmentation mode 6 reads the page as one block, keeping
+		// each line's columns on the line.
+		return o.run(ctx, data, o.Tesseract, "stdin", "stdout", "-l", o.Languages, "--psm", "6")
+	default:
+		return "", ErrUnsupportedFile
+	}
+}
+
+func (o *OCR) run(ctx context.Context, data []byte, command string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("%w: %s", ErrToolMissing, command)
+		}
+		return "", fmt.Errorf("extraction: %s failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
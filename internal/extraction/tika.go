@@ -0,0 +1,55 @@
+package extraction
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Tika reads the text of files with an Apache Tika server, for the
+// spreadsheets, presentations and older office formats OCR does not read.
+type Tika struct {
+	// URL is the server's, such as http://tika:9998.
+	URL    string
+	Client *http.Client
+}
+
+// NewTika returns a Tika reading files with the server at url.
+func NewTika(url string) *Tika {
+	return &Tika{URL: strings.TrimSuffix(url, "/"), Client: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+// Text returns the text of data, a file of mimeType. Files the server
+// cannot read return ErrUnsupportedFile.
+func (t *Tika) Text(ctx context.Context, data []byte, mimeType string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.URL+"/tika", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mimeType)
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("extraction: tika request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return "", nil
+	case http.StatusUnsupportedMediaType:
+		return "", ErrUnsupportedFile
+	default:
+		return "", fmt.Errorf("extraction: tika answered %s", resp.Status)
+	}
+	text, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("extraction: failed to read tika response: %w", err)
+	}
+	return string(text), nil
+}
@@ -0,0 +1,92 @@
+package extraction
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WordMimeType is the content type of DOCX files.
+const WordMimeType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// WordText returns the text of a DOCX file: a line per paragraph, with a
+// table's cells separated by tabs.
+func WordText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("extraction: not a DOCX file: %w", err)
+	}
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+		body, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("extraction: failed to open DOCX body: %w", err)
+		}
+		defer body.Close()
+		return wordBodyText(body)
+	}
+	return "", errors.New("extraction: DOCX file has no document body")
+}
+
+// wordBodyText reads the text runs of a WordprocessingML body. The
+// paragraphs of a table cell are joined by spaces, and each row ends its
+// line.
+func wordBodyText(body io.Reader) (string, error) {
+	var text bytes.Buffer
+	inText, cells := false, 0
+	trim := func(b byte) {
+		if n := text.Len(); n > 0 && text.Bytes()[n-1] == b {
+			text.Truncate(n - 1)
+		}
+	}
+	decoder := xml.NewDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return text.String(), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("extraction: malformed DOCX body: %w", err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "t":
+				inText = true
+			case "tc":
+				cells++
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if cells > 0 {
+					text.WriteByte(' ')
+				} else {
+					text.WriteByte('\n')
+				}
+			case "tc":
+				cells--
+				trim(' ')
+				text.WriteByte('\t')
+			case "tr":
+				trim('\t')
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(element)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package featureflag evaluates per-tenant feature flags so features can be
+// rolled out one tenant at a time. A flag is on for a tenant when the tenant
+// has an override turning it on, or when it has no override and the
+// configured default is on. Overrides live in Redis and each service caches
+// a tenant's overrides in memory; a change made through any replica is
+// announced over Redis and evicts every cache, and is published as a
+// FeatureFlagChanged event.
+package featureflag
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// Flags known to the services. A flag must be listed in Definitions before
+// it can be overridden.
+const (
+	ApprovalWorkflows = "approval_workflows"
+	MFAEnforcement    = "mfa_enforcement"
+	EInvoicing        = "e_invoicing"
+)
+
+// Definitions describes every flag by key.
+var Definitions = map[string]string{
+	ApprovalWorkflows: "Route invoices and orders through approval before they are issued",
+	MFAEnforcement:    "Require every user of the tenant to sign in with multi-factor authentication",
+	EInvoicing:        "Deliver invoices through the e-invoicing network",
+}
+
+// ErrUnknownFlag is returned for a key missing from Definitions.
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// State is a flag as evaluated for one tenant.
+type State struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Default     bool   `json:"default"`
+	Overridden  bool   `json:"overridden"`
+}
+
+type store interface {
+	Overrides(ctx context.Context, tenantID string) (map[string]bool, error)
+	SetOverride(ctx context.Context, tenantID, flag string, enabled bool) error
+	ClearOverride(ctx context.Context, tenantID, flag string) error
+	WatchChanges(ctx context.Context, changed func(tenantID string)) error
+}
+
+type cached struct {
+	overrides map[string]bool
+	expires   time.Time
+}
+
+// Flags evaluates and changes feature flags.
+type Flags struct {
+	store     store
+	defaults  map[string]bool
+	ttl       time.Duration
+	publisher events.Publisher
+	logger    *logger.Logger
+
+	mu     sync.Mutex
+	cached map[string]cached
+}
+
+// New returns flags backed by store. publisher, when not nil, receives a
+// FeatureFlagChanged event for every override change.
+func New(store *repository.FeatureFlagStore, cfg config.FeatureFlagConfig, publisher events.Publisher, log *logger.Logger) *Flags {
+	return newFlags(store, cfg, publisher, log)
+}
+
+func newFlags(store store, cfg config.FeatureFlagConfig, publisher events.Publisher, log *logger.Logger) *Flags {
+	return &Flags{
+		store:     store,
+		defaults:  cfg.Defaults,
+		ttl:       cfg.CacheTTL,
+		publisher: publisher,
+		logger:    log,
+		cached:    make(map[string]cached),
+	}
+}
+
+// Enabled reports whether flag is on for tenantID. It never fails: when the
+// overrides cannot be read, the last ones read are used, or the defaults if
+// there are none, until the cache expires again.
+func (f *Flags) Enabled(ctx context.Context, tenantID, flag string) bool {
+	if enabled, ok := f.overrides(ctx, tenantID)[flag]; ok {
+		return enabled
+	}
+	return f.defaults[flag]
+}
+
+func (f *Flags) overrides(ctx context.Context, tenantID string) map[string]bool {
+	f.mu.Lock()
+	entry, ok := f.cached[tenantID]
+	f.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.overrides
+	}
+
+	overrides, err := f.store.Overrides(ctx, tenantID)
+	if err != nil {
+		f.logger.New(ctx).Warnw("Failed to read feature flags; using last known values",
+			"error", err,
+			"tenant_id", tenantID,
+		)
+		overrides = entry.overrides
+	}
+
+	f.mu.Lock()
+	f.cached[tenantID] = cached{overrides: overrides, expires: time.Now().Add(f.ttl)}
+	f.mu.Unlock()
+	return overrides
+}
+
+// States returns every defined flag as evaluated for tenantID, sorted by
+// key. Unlike Enabled it reads the overrides from Redis and fails when they
+// cannot be read.
+func (f *Flags) States(ctx context.Context, tenantID string) ([]State, error) {
+	overrides, err := f.store.Overrides(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]State, 0, len(Definitions))
+	for key, description := range Definitions {
+		state := State{Key: key, Description: description, Default: f.defaults[key]}
+		state.Enabled, state.Overridden = overrides[key]
+		if !state.Overridden {
+			state.Enabled = state.Default
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+	return states, nil
+}
+
+// Set overrides flag for tenantID.
+func (f *Flags) Set(ctx context.Context, tenantID, userID, flag string, enabled bool) error {
+	if _, ok := Definitions[flag]; !ok {
+		return ErrUnknownFlag
+	}
+	if err := f.store.SetOverride(ctx, tenantID, flag, enabled); err != nil {
+		return err
+	}
+	f.changed(ctx, tenantID, userID, flag, map[string]interface{}{
+		"flag":       flag,
+		"enabled":    enabled,
+		"overridden": true,
+	})
+	return nil
+}
+
+// Clear removes the override of flag for tenantID, returning it to the
+// default.
+func (f *Flags) Clear(ctx context.Context, tenantID, userID, flag string) error {
+	if _, ok := Definitions[flag]; !ok {
+		return ErrUnknownFlag
+	}
+	if err := f.store.ClearOverride(ctx, tenantID, flag); err != nil {
+		return err
+	}
+	f.changed(ctx, tenantID, userID, flag, map[string]interface{}{
+		"flag":       flag,
+		"enabled":    f.defaults[flag],
+		"overridden": false,
+	})
+	return nil
+}
+
+// changed evicts the local cache and publishes the change. Other replicas
+// are evicted by the store's announcement, so a failed publish is logged
+// rather than returned.
+func (f *Flags) changed(ctx context.Context, tenantID, userID, flag string, data map[string]interface{}) {
+	f.evict(tenantID)
+	f.logger.New(ctx).Infow("Feature flag changed", "tenant_id", tenantID, "flag", flag, "enabled", data["enabled"])
+	if f.publisher == nil {
+		return
+	}
+	event := events.NewEvent(flag, "FeatureFlag", "FeatureFlagChanged", tenantID, userID, data)
+	if err := f.publisher.PublishEvent(ctx, event); err != nil {
+		f.logger.New(ctx).Warnw("Failed to publish feature flag change", "error", err, "flag", flag)
+	}
+}
+
+func (f *Flags) evict(tenantID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if tenantID == "" {
+		f.cached = make(map[string]cached)
+		return
+	}
+	delete(f.cached, tenantID)
+}
+
+// Run evicts cached overrides as changes are announced until ctx is
+// cancelled. After losing the subscription it drops the whole cache, since
+// changes may have been missed, and subscribes again.
+func (f *Flags) Run(ctx context.Context) error {
+	for {
+		err := f.store.WatchChanges(ctx, f.evict)
+		if ctx.Err() != nil {
+			return nil
+		}
+		f.evict("")
+		if err != nil {
+			f.logger.Warn("Feature flag change subscription lost", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
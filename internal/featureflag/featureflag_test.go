@@ -0,0 +1,194 @@
+package featureflag
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	overrides map[string]map[string]bool
+	reads     int
+	err       error
+}
+
+func (s *fakeStore) Overrides(ctx context.Context, tenantID string) (map[string]bool, error) {
+	s.reads++
+	if s.err != nil {
+		return nil, s.err
+	}
+	copied := make(map[string]bool)
+	for flag, enabled := range s.overrides[tenantID] {
+		copied[flag] = enabled
+	}
+	return copied, nil
+}
+
+func (s *fakeStore) SetOverride(ctx context.Context, tenantID, flag string, enabled bool) error {
+	if s.overrides[tenantID] == nil {
+		s.overrides[tenantID] = make(map[string]bool)
+	}
+	s.overrides[tenantID][flag] = enabled
+	return nil
+}
+
+func (s *fakeStore) ClearOverride(ctx context.Context, tenantID, flag string) error {
+	delete(s.overrides[tenantID], flag)
+	return nil
+}
+
+func (s *fakeStore) WatchChanges(ctx context.Context, changed func(tenantID string)) error {
+	<-ctx.Done()
+	return nil
+}
+
+type recordingPublisher struct {
+	events []*events.EventEnvelope
+}
+
+func (p *recordingPublisher) PublishEvent(ctx context.Context, event *events.EventEnvelope) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func newTestFlags(t *testing.T) (*Flags, *fakeStore, *recordingPublisher) {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "error", Format: "json"})
+	require.NoError(t, err)
+	store := &fakeStore{overrides: map[string]map[string]bool{
+		"tenant-1": {EInvoicing: true, ApprovalWorkflows: false},
+	}}
+	publisher := &recordingPublisher{}
+	cfg := config.FeatureFlagConfig{
+		Defaults: map[string]bool{ApprovalWorkflows: true},
+		CacheTTL: time.Minute,
+	}
+	return newFlags(store, cfg, publisher, log), store, publisher
+}
+
+func TestEnabledPrefersTenantOverride(t *testing.T) {
+	flags, _, _ := newTestFlags(t)
+	ctx := context.Background()
+
+	assert.True(t, flags.Enabled(ctx, "tenant-1", EInvoicing))
+	assert.False(t, flags.Enabled(ctx, "tenant-1", ApprovalWorkflows), "override beats default")
+	assert.False(t, flags.Enabled(ctx, "tenant-1", MFAEnforcement))
+	assert.True(t, flags.Enabled(ctx, "tenant-2", ApprovalWorkflows), "default applies without override")
+	assert.False(t, flags.Enabled(ctx, "tenant-2", EInvoicing))
+}
+
+func TestEnabledCachesUntilChanged(t *testing.T) {
+	flags, store, publisher := newTestFlags(t)
+	ctx := context.Background()
+
+	assert.False(t, flags.Enabled(ctx, "tenant-1", MFAEnforcement))
+	assert.False(t, flags.Enabled(ctx, "tenant-1", MFAEnforcement))
+	assert.Equal(t, 1, store.reads)
+
+	require.NoError(t, flags.Set(ctx, "tenant-1", "user-1", MFAEnforcement, true))
+	assert.True(t, flags.Enabled(ctx, "tenant-1", MFAEnforcement))
+	assert.Equal(t, 2, store.reads)
+
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, "FeatureFlagChanged", publisher.events[0].Type)
+	assert.Equal(t, MFAEnforcement, publisher.events[0].AggregateID)
+	assert.Equal(t, "tenant-1", publisher.events[0].TenantID)
+	assert.Equal(t, true, publisher.events[0].Data["enabled"])
+
+	require.NoError(t, flags.Clear(ctx, "tenant-1", "user-1", MFAEnforcement))
+	assert.False(t, flags.Enabled(ctx, "tenant-1", MFAEnforcement))
+	assert.Len(t, publisher.events, 2)
+}
+
+func TestEnabledKeepsLastValuesWhenStoreFails(t *testing.T) {
+	flags, store, _ := newTestFlags(t)
+	ctx := context.Background()
+
+	assert.True(t, flags.Enabled(ctx, "tenant-1", EInvoicing))
+	flags.evict("")
+	store.err = errors.New("redis down")
+	assert.False(t, flags.Enabled(ctx, "tenant-1", EInvoicing), "evicted entries fall back to defaults")
+
+	store.err = nil
+	flags.evict("")
+	assert.True(t, flags.Enabled(ctx, "tenant-1", EInvoicing))
+	flags.cached["tenant-1"] = cached{overrides: flags.cached["tenant-1"].overrides}
+	store.err = errors.New("redis down")
+	assert.True(t, flags.Enabled(ctx, "tenant-1", EInvoicing), "expired entries are reused")
+}
+
+func TestSetRejectsUnknownFlag(t *testing.T) {
+	flags, _, publisher := newTestFlags(t)
+	assert.ErrorIs(t, flags.Set(context.Background(), "tenant-1", "user-1", "dark_mode", true), ErrUnknownFlag)
+	assert.ErrorIs(t, flags.Clear(context.Background(), "tenant-1", "user-1", "dark_mode"), ErrUnknownFlag)
+	assert.Empty(t, publisher.events)
+}
+
+func TestStates(t *testing.T) {
+	flags, _, _ := newTestFlags(t)
+	states, err := flags.States(context.Background(), "tenant-1")
+	require.NoError(t, err)
+	require.Len(t, states, len(Definitions))
+
+	byKey := make(map[string]State)
+	for _, state := range states {
+		byKey[state.Key] = state
+	}
+	assert.Equal(t, State{Key: ApprovalWorkflows, Description: Definitions[ApprovalWorkflows], Enabled: false, Default: true, Overridden: true}, byKey[ApprovalWorkflows])
+	assert.Equal(t, State{Key: MFAEnforcement, Description: Definitions[MFAEnforcement]}, byKey[MFAEnforcement])
+	assert.Equal(t, ApprovalWorkflows, states[0].Key)
+}
+
+func TestHandler(t *testing.T) {
+	flags, _, _ := newTestFlags(t)
+	handler := flags.Handler("/api/v1/feature-flags")
+
+	serve := func(method, path, body string, permissions ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(middleware.WithIdentity(req.Context(), "tenant-1", "user-1", permissions))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/feature-flags", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/feature-flags", "", "feature:read").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/v1/feature-flags/e_invoicing", `{"enabled":false}`, "feature:read").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/api/v1/feature-flags/e_invoicing", `{}`, "feature:write").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPut, "/api/v1/feature-flags/dark_mode", `{"enabled":true}`, "feature:write").Code)
+
+	rec := serve(http.MethodPut, "/api/v1/feature-flags/e_invoicing", `{"enabled":false}`, "feature:*")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"enabled":false`)
+	assert.False(t, flags.Enabled(context.Background(), "tenant-1", EInvoicing))
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/api/v1/feature-flags/approval_workflows", "", "*").Code)
+	assert.True(t, flags.Enabled(context.Background(), "tenant-1", ApprovalWorkflows))
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/api/v1/feature-flags", "", "*").Code)
+}
+
+func TestRequire(t *testing.T) {
+	flags, _, _ := newTestFlags(t)
+	handler := flags.Require(EInvoicing, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for tenantID, status := range map[string]int{"tenant-1": http.StatusNoContent, "tenant-2": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(middleware.WithIdentity(req.Context(), tenantID, "user-1", nil))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, status, rec.Code, tenantID)
+	}
+}
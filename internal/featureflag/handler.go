@@ -0,0 +1,120 @@
+package featureflag
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// Require serves next only to tenants that have flag on, and answers
+// 404 Not Found to the others, as if the feature did not exist.
+func (f *Flags) Require(flag string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.Enabled(r.Context(), middleware.GetTenantID(r.Context()), flag) {
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler serves the flags of the caller's tenant under prefix, such as
+// /api/v1/feature-flags:
+//
+//	GET    prefix          every flag as evaluated for the tenant
+//	PUT    prefix/{key}    override a flag: {"enabled": true}
+//	DELETE prefix/{key}    remove the override, returning to the default
+//
+// Reading requires "feature:read" and changing "feature:write".
+func (f *Flags) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		ctx := r.Context()
+		tenantID := middleware.GetTenantID(ctx)
+		userID := middleware.GetUserID(ctx)
+
+		switch {
+		case key == "" && r.Method == http.MethodGet:
+			if !f.authorize(w, r, "feature:read") {
+				return
+			}
+			states, err := f.States(ctx, tenantID)
+			if err != nil {
+				f.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": states})
+
+		case key != "" && !strings.Contains(key, "/") && r.Method == http.MethodPut:
+			if !f.authorize(w, r, "feature:write") {
+				return
+			}
+			var body struct {
+				Enabled *bool `json:"enabled"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<12)).Decode(&body); err != nil || body.Enabled == nil {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "enabled is required")
+				return
+			}
+			if err := f.Set(ctx, tenantID, userID, key, *body.Enabled); err != nil {
+				f.writeError(w, r, err)
+				return
+			}
+			f.writeState(w, r, tenantID, key)
+
+		case key != "" && !strings.Contains(key, "/") && r.Method == http.MethodDelete:
+			if !f.authorize(w, r, "feature:write") {
+				return
+			}
+			if err := f.Clear(ctx, tenantID, userID, key); err != nil {
+				f.writeError(w, r, err)
+				return
+			}
+			f.writeState(w, r, tenantID, key)
+
+		case key == "" || !strings.Contains(key, "/"):
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+		}
+	})
+}
+
+func (f *Flags) authorize(w http.ResponseWriter, r *http.Request, permission string) bool {
+	if rbac.Allows(middleware.GetPermissions(r.Context()), permission) {
+		return true
+	}
+	httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+permission)
+	return false
+}
+
+func (f *Flags) writeState(w http.ResponseWriter, r *http.Request, tenantID, key string) {
+	states, err := f.States(r.Context(), tenantID)
+	if err != nil {
+		f.writeError(w, r, err)
+		return
+	}
+	for _, state := range states {
+		if state.Key == key {
+			httpresponse.JSON(w, http.StatusOK, state)
+			return
+		}
+	}
+	f.writeError(w, r, ErrUnknownFlag)
+}
+
+func (f *Flags) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrUnknownFlag) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	f.logger.New(r.Context()).Errorw("Feature flag request failed", "error", err)
+	httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "feature flags unavailable")
+}
@@ -0,0 +1,156 @@
+package fx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	rates []*domain.ExchangeRate
+}
+
+func (s *memoryStore) Save(ctx context.Context, rates ...*domain.ExchangeRate) error {
+	for _, rate := range rates {
+		replaced := false
+		for i, stored := range s.rates {
+			if sameTenant(stored.TenantID, rate.TenantID) && stored.Base == rate.Base && stored.Quote == rate.Quote && stored.Date.Equal(rate.Date) {
+				s.rates[i], replaced = rate, true
+			}
+		}
+		if !replaced {
+			s.rates = append(s.rates, rate)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Latest(ctx context.Context, tenantID *uuid.UUID, base, quote string, from, to time.Time) (*domain.ExchangeRate, error) {
+	var latest *domain.ExchangeRate
+	for _, rate := range s.rates {
+		if !sameTenant(rate.TenantID, tenantID) || rate.Base != base || rate.Quote != quote ||
+			rate.Date.Before(from) || rate.Date.After(to) {
+			continue
+		}
+		if latest == nil || rate.Date.After(latest.Date) {
+			latest = rate
+		}
+	}
+	return latest, nil
+}
+
+func sameTenant(a, b *uuid.UUID) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+const ecbFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2026-10-16">
+			<Cube currency="USD" rate="1.1650"/>
+			<Cube currency="GBP" rate="0.8700"/>
+			<Cube currency="JPY" rate="175.20"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func newTestService(t *testing.T) (*Service, *memoryStore) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ecbFeed))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config.FXConfig{
+		Provider:                  "ecb",
+		Base:                      "EUR",
+		URL:                       server.URL,
+		Timeout:                   time.Second,
+		MaxAge:                    7 * 24 * time.Hour,
+		ReportingCurrency:         "EUR",
+		TenantReportingCurrencies: map[string]string{},
+	}
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	store := &memoryStore{}
+	return NewService(cfg, store, NewProvider(cfg), log), store
+}
+
+func TestService_SyncAndCross(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	require.NoError(t, service.Sync(ctx))
+	require.NoError(t, service.Sync(ctx), "syncing again replaces the day's rates")
+	require.Len(t, store.rates, 3)
+
+	// A Sunday takes Friday's rates.
+	sunday := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	rate, err := service.Rate(ctx, uuid.Nil, "usd", "EUR", sunday)
+	require.NoError(t, err)
+	assert.Equal(t, "0.8583690987", rate.Rate.String())
+	assert.Equal(t, time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), rate.Date)
+	assert.Equal(t, "ecb", rate.Source)
+
+	rate, err = service.Rate(ctx, uuid.Nil, "GBP", "USD", sunday)
+	require.NoError(t, err)
+	assert.Equal(t, "1.3390804598", rate.Rate.String())
+
+	amount, _, err := service.Convert(ctx, uuid.Nil, decimal.NewFromInt(100), "USD", "JPY", sunday)
+	require.NoError(t, err)
+	assert.Equal(t, "15039", amount.String(), "rounded to the minor unit of the currency converted to")
+
+	_, err = service.Rate(ctx, uuid.Nil, "USD", "EUR", sunday.AddDate(0, 0, -3))
+	assert.ErrorIs(t, err, ErrNoRate, "no rates before the first synced")
+	_, err = service.Rate(ctx, uuid.Nil, "USD", "EUR", sunday.AddDate(0, 0, 30))
+	assert.ErrorIs(t, err, ErrNoRate, "rates older than the max age are not used")
+	_, err = service.Rate(ctx, uuid.Nil, "USD", "CHF", sunday)
+	assert.ErrorIs(t, err, ErrNoRate)
+}
+
+func TestService_Overrides(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	require.NoError(t, service.Sync(ctx))
+
+	tenantID := uuid.New()
+	override, err := domain.NewExchangeRateOverride(tenantID, "EUR", "USD", decimal.RequireFromString("1.20"),
+		time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), uuid.New(), "company rate")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, override))
+
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	rate, err := service.Rate(ctx, tenantID, "EUR", "USD", at)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2", rate.Rate.String())
+	assert.Equal(t, domain.ExchangeRateManual, rate.Source)
+
+	rate, err = service.Rate(ctx, tenantID, "USD", "EUR", at)
+	require.NoError(t, err)
+	assert.Equal(t, "0.8333333333", rate.Rate.String(), "overrides apply either way round")
+
+	rate, err = service.Rate(ctx, uuid.New(), "EUR", "USD", at)
+	require.NoError(t, err)
+	assert.Equal(t, "1.165", rate.Rate.String(), "other tenants keep the synced rate")
+
+	_, err = service.Rate(ctx, tenantID, "EUR", "USD", time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC))
+	require.Error(t, err, "overrides apply from their day on")
+
+	conversion, err := service.ToReportingCurrency(ctx, tenantID, decimal.NewFromInt(120), "USD", at)
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", conversion.Currency)
+	assert.Equal(t, "100", conversion.Amount.String())
+
+	_, err = domain.NewExchangeRateOverride(tenantID, "EUR", "EUR", decimal.NewFromInt(1), at, uuid.New(), "")
+	assert.ErrorIs(t, err, domain.ErrInvalidCurrencyPair)
+	_, err = domain.NewExchangeRateOverride(tenantID, "EUR", "USD", decimal.Zero, at, uuid.New(), "")
+	assert.ErrorIs(t, err, domain.ErrInvalidExchangeRate)
+}
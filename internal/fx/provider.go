@@ -0,0 +1,170 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/shopspring/decimal"
+)
+
+// ECBDailyURL is the European Central Bank's feed of the latest euro
+// reference rates, published on TARGET business days around 16:00 CET.
+const ECBDailyURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+// Quote holds the rates a provider published for a day: how much of each
+// currency one Base buys.
+type Quote struct {
+	Base  string
+	Date  time.Time
+	Rates map[string]decimal.Decimal
+}
+
+// Provider publishes daily reference rates.
+type Provider interface {
+	// Name is the source rates synced from the provider are stored under.
+	Name() string
+	// Latest returns the latest rates published.
+	Latest(ctx context.Context) (*Quote, error)
+}
+
+// NewProvider returns the provider cfg names, or nil when rates are not
+// synced.
+func NewProvider(cfg config.FXConfig) Provider {
+	client := &http.Client{Timeout: cfg.Timeout}
+	switch cfg.Provider {
+	case "ecb":
+		feed := cfg.URL
+		if feed == "" {
+			feed = ECBDailyURL
+		}
+		return &ecbProvider{client: client, url: feed}
+	case "json":
+		return &jsonProvider{client: client, url: cfg.URL, base: cfg.Base, apiKey: cfg.APIKey}
+	default:
+		return nil
+	}
+}
+
+type ecbProvider struct {
+	client *http.Client
+	url    string
+}
+
+// ecbEnvelope is the eurofxref feed: a Cube per day holding a Cube per
+// currency.
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+func (p *ecbProvider) Name() string { return "ecb" }
+
+func (p *ecbProvider) Latest(ctx context.Context) (*Quote, error) {
+	body, err := fetch(ctx, p.client, p.url, "")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("fx: failed to decode ECB rates: %w", err)
+	}
+	if len(envelope.Days) == 0 {
+		return nil, fmt.Errorf("fx: ECB feed has no rates")
+	}
+	day := envelope.Days[0]
+	date, err := time.Parse("2006-01-02", day.Time)
+	if err != nil {
+		return nil, fmt.Errorf("fx: ECB rates have an invalid date %q", day.Time)
+	}
+	quote := &Quote{Base: "EUR", Date: date, Rates: make(map[string]decimal.Decimal, len(day.Rates))}
+	for _, rate := range day.Rates {
+		value, err := decimal.NewFromString(rate.Rate)
+		if err != nil {
+			return nil, fmt.Errorf("fx: ECB rate of %s is invalid: %q", rate.Currency, rate.Rate)
+		}
+		quote.Rates[rate.Currency] = value
+	}
+	return quote, nil
+}
+
+type jsonProvider struct {
+	client *http.Client
+	url    string
+	base   string
+	apiKey string
+}
+
+func (p *jsonProvider) Name() string {
+	if u, err := url.Parse(p.url); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "json"
+}
+
+func (p *jsonProvider) Latest(ctx context.Context) (*Quote, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("fx: invalid provider URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("base", p.base)
+	u.RawQuery = query.Encode()
+
+	body, err := fetch(ctx, p.client, u.String(), p.apiKey)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var response struct {
+		Base  string                     `json:"base"`
+		Date  string                     `json:"date"`
+		Rates map[string]decimal.Decimal `json:"rates"`
+	}
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("fx: failed to decode rates: %w", err)
+	}
+	if !strings.EqualFold(response.Base, p.base) {
+		return nil, fmt.Errorf("fx: provider returned rates of %s, not %s", response.Base, p.base)
+	}
+	date, err := time.Parse("2006-01-02", response.Date)
+	if err != nil {
+		return nil, fmt.Errorf("fx: rates have an invalid date %q", response.Date)
+	}
+	return &Quote{Base: strings.ToUpper(response.Base), Date: date, Rates: response.Rates}, nil
+}
+
+// fetch GETs rawURL, sending apiKey as a bearer token when set.
+func fetch(ctx context.Context, client *http.Client, rawURL, apiKey string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fx: failed to build request: %w", err)
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fx: failed to fetch rates: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fx: provider answered %s", resp.Status)
+	}
+	return resp.Body, nil
+}
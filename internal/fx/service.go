@@ -0,0 +1,201 @@
+// Package fx keeps exchange rates: daily reference rates synced from a
+// provider, stored with their history, and tenants' own overrides. It looks
+// up the rate of any two currencies on a date, crossing them through the
+// provider's base currency, and converts amounts with it.
+package fx
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// ErrNoRate is returned when there is no rate of a pair on a date.
+var ErrNoRate = stderrors.New("fx: no exchange rate")
+
+// ratePlaces is the precision crossed and inverted rates are rounded to.
+const ratePlaces = 10
+
+// Store keeps rates. repository.ExchangeRateStore implements it.
+type Store interface {
+	Save(ctx context.Context, rates ...*domain.ExchangeRate) error
+	// Latest returns the latest rate of the pair dated from from to to,
+	// both included, or nil: synced for a nil tenantID, or the tenant's
+	// override.
+	Latest(ctx context.Context, tenantID *uuid.UUID, base, quote string, from, to time.Time) (*domain.ExchangeRate, error)
+}
+
+// Rate is the price of one From in To on Date, the day of the rate used,
+// which can be before the date asked for when it had no rates.
+type Rate struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Rate   decimal.Decimal `json:"rate"`
+	Date   time.Time       `json:"date"`
+	Source string          `json:"source"`
+}
+
+// Service syncs rates from the provider and looks them up.
+type Service struct {
+	store     Store
+	provider  Provider
+	base      string
+	maxAge    time.Duration
+	reporting func(tenantID string) string
+	logger    *logger.Logger
+}
+
+// NewService returns a service looking up rates in store. provider is nil
+// in services that only look rates up.
+func NewService(cfg config.FXConfig, store Store, provider Provider, log *logger.Logger) *Service {
+	return &Service{
+		store:     store,
+		provider:  provider,
+		base:      strings.ToUpper(cfg.Base),
+		maxAge:    cfg.MaxAge,
+		reporting: cfg.ReportingCurrencyFor,
+		logger:    log,
+	}
+}
+
+// Sync stores the latest rates of the provider. Rates already stored for
+// their day are replaced, so it can run any number of times a day.
+func (s *Service) Sync(ctx context.Context) error {
+	if s.provider == nil {
+		return nil
+	}
+	quote, err := s.provider.Latest(ctx)
+	if err != nil {
+		return err
+	}
+	if quote.Base != s.base {
+		return fmt.Errorf("fx: %s publishes rates of %s, not %s", s.provider.Name(), quote.Base, s.base)
+	}
+
+	rates := make([]*domain.ExchangeRate, 0, len(quote.Rates))
+	for currency, value := range quote.Rates {
+		rate, err := domain.NewExchangeRate(quote.Base, currency, value, quote.Date, s.provider.Name())
+		if err != nil {
+			s.logger.Warn("Skipping invalid exchange rate", "base", quote.Base, "quote", currency, "rate", value.String())
+			continue
+		}
+		rates = append(rates, rate)
+	}
+	if err := s.store.Save(ctx, rates...); err != nil {
+		return err
+	}
+	s.logger.Info("Exchange rates synced",
+		"provider", s.provider.Name(),
+		"date", quote.Date.Format("2006-01-02"),
+		"rates", len(rates),
+	)
+	return nil
+}
+
+// Rate returns the rate of from in to for tenantID on the day of at. The
+// tenant's latest override of the pair up to that day comes first, either
+// way round; otherwise synced rates are crossed through the base currency,
+// taking the latest up to the service's max age before the day.
+func (s *Service) Rate(ctx context.Context, tenantID uuid.UUID, from, to string, at time.Time) (*Rate, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	day := domain.RateDay(at)
+	if from == to {
+		return &Rate{From: from, To: to, Rate: decimal.NewFromInt(1), Date: day, Source: "identity"}, nil
+	}
+
+	if tenantID != uuid.Nil {
+		override, err := s.store.Latest(ctx, &tenantID, from, to, time.Time{}, day)
+		if err != nil {
+			return nil, err
+		}
+		if override != nil {
+			return &Rate{From: from, To: to, Rate: override.Rate, Date: override.Date, Source: override.Source}, nil
+		}
+		override, err = s.store.Latest(ctx, &tenantID, to, from, time.Time{}, day)
+		if err != nil {
+			return nil, err
+		}
+		if override != nil {
+			return &Rate{From: from, To: to, Rate: invert(override.Rate), Date: override.Date, Source: override.Source}, nil
+		}
+	}
+
+	fromLeg, err := s.leg(ctx, from, day)
+	if err != nil {
+		return nil, err
+	}
+	toLeg, err := s.leg(ctx, to, day)
+	if err != nil {
+		return nil, err
+	}
+	if fromLeg == nil || toLeg == nil {
+		return nil, fmt.Errorf("%w of %s in %s on %s", ErrNoRate, from, to, day.Format("2006-01-02"))
+	}
+	rate := &Rate{
+		From:   from,
+		To:     to,
+		Rate:   toLeg.Rate.DivRound(fromLeg.Rate, ratePlaces),
+		Date:   fromLeg.Date,
+		Source: fromLeg.Source,
+	}
+	if toLeg.Date.Before(rate.Date) {
+		rate.Date = toLeg.Date
+	}
+	if rate.Source == "" {
+		rate.Source = toLeg.Source
+	}
+	return rate, nil
+}
+
+// leg returns the synced rate of the base currency in currency on day, or
+// nil when there is none recent enough.
+func (s *Service) leg(ctx context.Context, currency string, day time.Time) (*domain.ExchangeRate, error) {
+	if currency == s.base {
+		return &domain.ExchangeRate{Base: s.base, Quote: currency, Rate: decimal.NewFromInt(1), Date: day}, nil
+	}
+	return s.store.Latest(ctx, nil, s.base, currency, day.Add(-s.maxAge), day)
+}
+
+// Convert converts amount from from to to at the rate of at, rounded to
+// the minor unit of to.
+func (s *Service) Convert(ctx context.Context, tenantID uuid.UUID, amount decimal.Decimal, from, to string, at time.Time) (decimal.Decimal, *Rate, error) {
+	rate, err := s.Rate(ctx, tenantID, from, to, at)
+	if err != nil {
+		return decimal.Zero, nil, err
+	}
+	return money.Round(amount.Mul(rate.Rate), rate.To), rate, nil
+}
+
+// ToReportingCurrency converts amount into tenantID's reporting currency
+// at the rate of at. It returns nil when the tenant has no reporting
+// currency.
+func (s *Service) ToReportingCurrency(ctx context.Context, tenantID uuid.UUID, amount decimal.Decimal, currency string, at time.Time) (*domain.CurrencyConversion, error) {
+	reporting := s.reporting(tenantID.String())
+	if reporting == "" {
+		return nil, nil
+	}
+	converted, rate, err := s.Convert(ctx, tenantID, amount, currency, reporting, at)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.CurrencyConversion{
+		Currency: reporting,
+		Amount:   converted,
+		Rate:     rate.Rate,
+		RateDate: rate.Date,
+		Source:   rate.Source,
+	}, nil
+}
+
+func invert(rate decimal.Decimal) decimal.Decimal {
+	return decimal.NewFromInt(1).DivRound(rate, ratePlaces)
+}
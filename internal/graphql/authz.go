@@ -0,0 +1,29 @@
+package graphql
+
+import (
+	"context"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/pkg/errors"
+)
+
+// Authorize reports whether the caller holds permission, honouring the same
+// "*" and "module:*" wildcards as the REST services.
+func Authorize(ctx context.Context, permission string) error {
+	if rbac.Allows(middleware.GetPermissions(ctx), permission) {
+		return nil
+	}
+	return errors.Forbidden("missing permission %s", permission)
+}
+
+// HasPermission implements the @hasPermission schema directive. A field the
+// caller may not read resolves to null with an error at its path, so the rest
+// of the query still returns; its resolver, and any loader behind it, is not
+// called.
+func HasPermission(ctx context.Context, obj interface{}, next func(ctx context.Context) (interface{}, error), permission string) (interface{}, error) {
+	if err := Authorize(ctx, permission); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
@@ -0,0 +1,42 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasPermission(t *testing.T) {
+	next := func(ctx context.Context) (interface{}, error) { return "resolved", nil }
+	withPermissions := func(permissions ...string) context.Context {
+		return context.WithValue(context.Background(), middleware.PermissionsContextKey, permissions)
+	}
+
+	tests := []struct {
+		name        string
+		permissions []string
+		allowed     bool
+	}{
+		{"exact", []string{"invoice:read"}, true},
+		{"module wildcard", []string{"invoice:*"}, true},
+		{"action wildcard", []string{"*:read"}, true},
+		{"admin", []string{"*"}, true},
+		{"other permission", []string{"client:read", "invoice:write"}, false},
+		{"none", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := HasPermission(withPermissions(tt.permissions...), nil, next, "invoice:read")
+			if tt.allowed {
+				assert.NoError(t, err)
+				assert.Equal(t, "resolved", res)
+			} else {
+				assert.True(t, errors.Is(err, errors.CodeForbidden))
+				assert.Nil(t, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchFunc loads values for keys in one call. Keys missing from the returned
+// map resolve to the zero value.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader collects the keys requested within Wait of each other, up to
+// MaxBatch, and loads them with a single BatchFunc call. Results are cached
+// for the loader's lifetime, so a loader is created per request.
+type Loader[K comparable, V any] struct {
+	fetch    BatchFunc[K, V]
+	wait     time.Duration
+	maxBatch int
+
+	mu    sync.Mutex
+	cache map[K]*loaderResult[V]
+	batch *loaderBatch[K, V]
+}
+
+type loaderResult[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+type loaderBatch[K comparable, V any] struct {
+	ctx     context.Context
+	keys    []K
+	results []*loaderResult[V]
+	timer   *time.Timer
+}
+
+func NewLoader[K comparable, V any](fetch BatchFunc[K, V], wait time.Duration, maxBatch int) *Loader[K, V] {
+	if wait <= 0 {
+		wait = 2 * time.Millisecond
+	}
+	if maxBatch <= 0 {
+		maxBatch = 100
+	}
+	return &Loader[K, V]{
+		fetch:    fetch,
+		wait:     wait,
+		maxBatch: maxBatch,
+		cache:    make(map[K]*loaderResult[V]),
+	}
+}
+
+// Load returns the value for key, joining the pending batch or starting one.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	result, ok := l.cache[key]
+	if !ok {
+		result = &loaderResult[V]{done: make(chan struct{})}
+		l.cache[key] = result
+
+		if l.batch == nil {
+			b := &loaderBatch[K, V]{ctx: ctx}
+			b.timer = time.AfterFunc(l.wait, func() { l.dispatch(b) })
+			l.batch = b
+		}
+		b := l.batch
+		b.keys = append(b.keys, key)
+		b.results = append(b.results, result)
+		if len(b.keys) >= l.maxBatch {
+			l.batch = nil
+			if b.timer.Stop() {
+				go l.run(b)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-result.done:
+		return result.value, result.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// LoadMany loads every key, batching them together. It returns the first
+// error encountered.
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) ([]V, error) {
+	values := make([]V, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key K) {
+			defer wg.Done()
+			values[i], errs[i] = l.Load(ctx, key)
+		}(i, key)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Prime stores a value already known, such as a parent loaded by a list
+// query, so later loads of key do not fetch it again.
+func (l *Loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.cache[key]; ok {
+		return
+	}
+	result := &loaderResult[V]{done: make(chan struct{}), value: value}
+	close(result.done)
+	l.cache[key] = result
+}
+
+func (l *Loader[K, V]) dispatch(b *loaderBatch[K, V]) {
+	l.mu.Lock()
+	if l.batch == b {
+		l.batch = nil
+	}
+	l.mu.Unlock()
+	l.run(b)
+}
+
+func (l *Loader[K, V]) run(b *loaderBatch[K, V]) {
+	values, err := l.fetch(context.WithoutCancel(b.ctx), b.keys)
+	for i, key := range b.keys {
+		result := b.results[i]
+		if err != nil {
+			result.err = err
+		} else {
+			result.value = values[key]
+		}
+		close(result.done)
+	}
+
+	// Failed keys are dropped from the cache so a later Load retries them.
+	if err != nil {
+		l.mu.Lock()
+		for i, key := range b.keys {
+			if l.cache[key] == b.results[i] {
+				delete(l.cache, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
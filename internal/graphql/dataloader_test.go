@@ -0,0 +1,89 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoaderBatchesConcurrentLoads(t *testing.T) {
+	var calls atomic.Int32
+	var batchSizes sync.Map
+	loader := NewLoader(func(ctx context.Context, keys []string) (map[string]string, error) {
+		n := calls.Add(1)
+		batchSizes.Store(n, len(keys))
+		values := make(map[string]string, len(keys))
+		for _, k := range keys {
+			if k != "missing" {
+				values[k] = "value-" + k
+			}
+		}
+		return values, nil
+	}, 10*time.Millisecond, 100)
+
+	values, err := loader.LoadMany(context.Background(), []string{"a", "b", "c", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"value-a", "value-b", "value-c", ""}, values)
+	assert.Equal(t, int32(1), calls.Load())
+
+	value, err := loader.Load(context.Background(), "b")
+	require.NoError(t, err)
+	assert.Equal(t, "value-b", value)
+	assert.Equal(t, int32(1), calls.Load(), "cached keys are not fetched again")
+}
+
+func TestLoaderSplitsAtMaxBatch(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		mu.Lock()
+		sizes = append(sizes, len(keys))
+		mu.Unlock()
+		values := make(map[int]int, len(keys))
+		for _, k := range keys {
+			values[k] = k * 2
+		}
+		return values, nil
+	}, 50*time.Millisecond, 3)
+
+	values, err := loader.LoadMany(context.Background(), []int{1, 2, 3, 4, 5, 6, 7})
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 4, 6, 8, 10, 12, 14}, values)
+	assert.ElementsMatch(t, []int{3, 3, 1}, sizes)
+}
+
+func TestLoaderRetriesFailedKeys(t *testing.T) {
+	fail := true
+	loader := NewLoader(func(ctx context.Context, keys []string) (map[string]int, error) {
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return map[string]int{"a": 1}, nil
+	}, time.Millisecond, 10)
+
+	_, err := loader.Load(context.Background(), "a")
+	assert.EqualError(t, err, "unavailable")
+
+	fail = false
+	value, err := loader.Load(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, value)
+}
+
+func TestLoaderPrime(t *testing.T) {
+	loader := NewLoader(func(ctx context.Context, keys []string) (map[string]int, error) {
+		t.Fatal("primed key was fetched")
+		return nil, nil
+	}, time.Millisecond, 10)
+
+	loader.Prime("a", 7)
+	value, err := loader.Load(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, 7, value)
+}
@@ -0,0 +1,525 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// errNonNull reports a null in a non-null position; it nulls the nearest
+// nullable parent, as the GraphQL spec requires.
+var errNonNull = errors.New("non-null field resolved to null")
+
+// SchemaExecutor runs queries against Schema. Root fields are resolved by
+// the Resolver's query methods and relations by its field resolvers, such
+// as Invoice().Client, which go through the request's loaders. Every other
+// field is read from the model's struct field of the same name, or the one
+// whose graphql tag names it.
+//
+// Only queries are served: writes go through the REST command APIs and live
+// updates through the WebSocket gateway.
+type SchemaExecutor struct {
+	schema   *ast.Schema
+	resolver *Resolver
+}
+
+func NewSchemaExecutor(resolver *Resolver) (*SchemaExecutor, error) {
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: Schema})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GraphQL schema: %w", err)
+	}
+	return &SchemaExecutor{schema: schema, resolver: resolver}, nil
+}
+
+func (e *SchemaExecutor) Execute(ctx context.Context, req *Request) *Response {
+	doc, errs := gqlparser.LoadQuery(e.schema, req.Query)
+	if len(errs) > 0 {
+		return validationFailed(errs)
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	if op == nil {
+		return errorResponse(fmt.Errorf("unknown operation %q", req.OperationName), "GRAPHQL_VALIDATION_FAILED")
+	}
+	if op.Operation != ast.Query {
+		return errorResponse(fmt.Errorf("%s operations are not supported", op.Operation), "OPERATION_NOT_SUPPORTED")
+	}
+	vars, err := validator.VariableValues(e.schema, op, req.Variables)
+	if err != nil {
+		return errorResponse(err, "GRAPHQL_VALIDATION_FAILED")
+	}
+
+	x := &execution{schema: e.schema, resolver: e.resolver, vars: vars, fragments: doc.Fragments}
+	data, rootErr := x.selectionSet(ctx, nil, e.schema.Query, reflect.ValueOf(e.resolver.Query()), op.SelectionSet)
+	if rootErr != nil {
+		data = nil
+	}
+	encoded, encodeErr := json.Marshal(data)
+	if encodeErr != nil {
+		return errorResponse(encodeErr, string(apperr.CodeInternalError))
+	}
+	return &Response{Data: encoded, Errors: x.errors}
+}
+
+func validationFailed(errs gqlerror.List) *Response {
+	resp := &Response{}
+	for _, err := range errs {
+		resp.Errors = append(resp.Errors, ResponseError{
+			Message:    err.Message,
+			Extensions: map[string]interface{}{"code": "GRAPHQL_VALIDATION_FAILED"},
+		})
+	}
+	return resp
+}
+
+// execution is the state of one request. List items are completed
+// concurrently so that their relations are batched by the loaders.
+type execution struct {
+	schema    *ast.Schema
+	resolver  *Resolver
+	vars      map[string]interface{}
+	fragments ast.FragmentDefinitionList
+
+	mu     sync.Mutex
+	errors []ResponseError
+}
+
+// collectedField is a field of a selection set with the sub-selections of
+// every occurrence of its response name merged.
+type collectedField struct {
+	*ast.Field
+	selections ast.SelectionSet
+}
+
+func (x *execution) selectionSet(ctx context.Context, path []interface{}, def *ast.Definition, parent reflect.Value, set ast.SelectionSet) (interface{}, error) {
+	var fields []*collectedField
+	x.collect(def, set, &fields, map[string]*collectedField{})
+
+	out := make(object, 0, len(fields))
+	for _, f := range fields {
+		value, err := x.field(ctx, appendPath(path, f.Alias), def, parent, f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, member{name: f.Alias, value: value})
+	}
+	return out, nil
+}
+
+func (x *execution) collect(def *ast.Definition, set ast.SelectionSet, fields *[]*collectedField, seen map[string]*collectedField) {
+	for _, selection := range set {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if !x.included(s.Directives) {
+				continue
+			}
+			alias := s.Alias
+			if alias == "" {
+				alias = s.Name
+			}
+			if f, ok := seen[alias]; ok {
+				f.selections = append(f.selections, s.SelectionSet...)
+				continue
+			}
+			f := &collectedField{Field: s, selections: s.SelectionSet}
+			f.Alias = alias
+			seen[alias] = f
+			*fields = append(*fields, f)
+		case *ast.InlineFragment:
+			if x.included(s.Directives) && x.applies(def, s.TypeCondition) {
+				x.collect(def, s.SelectionSet, fields, seen)
+			}
+		case *ast.FragmentSpread:
+			fragment := x.fragments.ForName(s.Name)
+			if fragment != nil && x.included(s.Directives) && x.applies(def, fragment.TypeCondition) {
+				x.collect(def, fragment.SelectionSet, fields, seen)
+			}
+		}
+	}
+}
+
+func (x *execution) included(directives ast.DirectiveList) bool {
+	if skip := directives.ForName("skip"); skip != nil && skip.ArgumentMap(x.vars)["if"] == true {
+		return false
+	}
+	if include := directives.ForName("include"); include != nil && include.ArgumentMap(x.vars)["if"] == false {
+		return false
+	}
+	return true
+}
+
+func (x *execution) applies(def *ast.Definition, condition string) bool {
+	if condition == "" || condition == def.Name {
+		return true
+	}
+	for _, possible := range x.schema.GetPossibleTypes(x.schema.Types[condition]) {
+		if possible.Name == def.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *execution) field(ctx context.Context, path []interface{}, def *ast.Definition, parent reflect.Value, f *collectedField) (interface{}, error) {
+	if f.Name == "__typename" {
+		return def.Name, nil
+	}
+	fieldDef := def.Fields.ForName(f.Name)
+	value, err := x.resolve(ctx, def, parent, f)
+	if err != nil {
+		return x.null(path, fieldDef.Type, err)
+	}
+	return x.complete(ctx, path, fieldDef.Type, f.selections, value)
+}
+
+// resolve returns the value of a field, checking the @hasPermission
+// directive of its definition first.
+func (x *execution) resolve(ctx context.Context, def *ast.Definition, parent reflect.Value, f *collectedField) (value interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			value, err = nil, apperr.InternalError("failed to resolve %s.%s", def.Name, f.Name)
+		}
+	}()
+	if strings.HasPrefix(f.Name, "__") {
+		return nil, apperr.InvalidArgument("introspection is not supported")
+	}
+
+	next := func(ctx context.Context) (interface{}, error) {
+		return x.resolveField(ctx, def, parent, f)
+	}
+	if directive := f.Definition.Directives.ForName("hasPermission"); directive != nil {
+		permission, _ := directive.ArgumentMap(x.vars)["permission"].(string)
+		return HasPermission(ctx, parent.Interface(), next, permission)
+	}
+	return next(ctx)
+}
+
+func (x *execution) resolveField(ctx context.Context, def *ast.Definition, parent reflect.Value, f *collectedField) (interface{}, error) {
+	name := strings.ToUpper(f.Name[:1]) + f.Name[1:]
+	if def == x.schema.Query {
+		if method := parent.MethodByName(name); method.IsValid() {
+			return x.call(ctx, method, nil, f)
+		}
+		return nil, apperr.InternalError("query %s is not implemented", f.Name)
+	}
+
+	// Field resolvers, such as Resolver.Invoice().Client, win over the
+	// model's struct field of the same name.
+	if typeResolver := reflect.ValueOf(x.resolver).MethodByName(def.Name); typeResolver.IsValid() &&
+		typeResolver.Type().NumIn() == 0 && typeResolver.Type().NumOut() == 1 {
+		if method := typeResolver.Call(nil)[0].MethodByName(name); method.IsValid() {
+			return x.call(ctx, method, &parent, f)
+		}
+	}
+	if field, ok := structField(parent, f.Name); ok {
+		return field.Interface(), nil
+	}
+	return nil, nil
+}
+
+// call invokes a resolver method with ctx, the parent object of field
+// resolvers and the field's arguments in schema order.
+func (x *execution) call(ctx context.Context, method reflect.Value, parent *reflect.Value, f *collectedField) (interface{}, error) {
+	methodType := method.Type()
+	in := []reflect.Value{reflect.ValueOf(ctx)}
+	if parent != nil {
+		in = append(in, *parent)
+	}
+	args := f.ArgumentMap(x.vars)
+	for _, arg := range f.Definition.Arguments {
+		if len(in) == methodType.NumIn() {
+			break
+		}
+		value, err := x.argument(arg, args[arg.Name], methodType.In(len(in)))
+		if err != nil {
+			return nil, err
+		}
+		in = append(in, value)
+	}
+	if len(in) != methodType.NumIn() {
+		return nil, apperr.InternalError("resolver of %s does not match the schema", f.Name)
+	}
+
+	out := method.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	return out[0].Interface(), nil
+}
+
+// argument converts a coerced argument to the resolver's parameter type.
+// Input objects and scalars go through JSON, which the model types decode;
+// enum values are lower-cased to match the model's constants.
+func (x *execution) argument(arg *ast.ArgumentDefinition, value interface{}, goType reflect.Type) (reflect.Value, error) {
+	ptr := reflect.New(goType)
+	if value == nil {
+		return ptr.Elem(), nil
+	}
+	data, err := json.Marshal(x.input(arg.Type, value))
+	if err == nil {
+		err = json.Unmarshal(data, ptr.Interface())
+	}
+	if err != nil {
+		return reflect.Value{}, apperr.InvalidArgument("invalid argument %s", arg.Name)
+	}
+	return ptr.Elem(), nil
+}
+
+func (x *execution) input(typ *ast.Type, value interface{}) interface{} {
+	if typ.Elem != nil {
+		if list, ok := value.([]interface{}); ok {
+			for i := range list {
+				list[i] = x.input(typ.Elem, list[i])
+			}
+		}
+		return value
+	}
+	def := x.schema.Types[typ.NamedType]
+	switch def.Kind {
+	case ast.Enum:
+		if s, ok := value.(string); ok {
+			return strings.ToLower(s)
+		}
+	case ast.InputObject:
+		if m, ok := value.(map[string]interface{}); ok {
+			for _, field := range def.Fields {
+				if v, ok := m[field.Name]; ok && v != nil {
+					m[field.Name] = x.input(field.Type, v)
+				}
+			}
+		}
+	}
+	return value
+}
+
+// complete serializes a resolved value as typ, descending into objects
+// with selections.
+func (x *execution) complete(ctx context.Context, path []interface{}, typ *ast.Type, selections ast.SelectionSet, value interface{}) (interface{}, error) {
+	raw := reflect.ValueOf(value)
+	v := indirect(raw)
+	if isNull(v, typ) {
+		if typ.NonNull {
+			return x.null(path, typ, apperr.InternalError("%s must not be null", typ.Name()))
+		}
+		return nil, nil
+	}
+
+	if typ.Elem != nil {
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return x.null(path, typ, apperr.InternalError("%s is not a list", typ))
+		}
+		items := make([]interface{}, v.Len())
+		failed := make([]bool, v.Len())
+		completeItem := func(i int) {
+			var err error
+			items[i], err = x.complete(ctx, appendPath(path, i), typ.Elem, selections, v.Index(i).Interface())
+			failed[i] = err != nil
+		}
+		if kind := x.schema.Types[typ.Elem.Name()].Kind; kind == ast.Scalar || kind == ast.Enum {
+			for i := range items {
+				completeItem(i)
+			}
+		} else {
+			var wg sync.WaitGroup
+			for i := range items {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					completeItem(i)
+				}(i)
+			}
+			wg.Wait()
+		}
+		for _, itemFailed := range failed {
+			if itemFailed {
+				return x.null(path, typ, nil)
+			}
+		}
+		return items, nil
+	}
+
+	def := x.schema.Types[typ.NamedType]
+	switch def.Kind {
+	case ast.Scalar:
+		scalar, err := serializeScalar(def.Name, v)
+		if err != nil {
+			return x.null(path, typ, err)
+		}
+		return scalar, nil
+	case ast.Enum:
+		name := strings.ToUpper(fmt.Sprint(v.Interface()))
+		if def.EnumValues.ForName(name) == nil {
+			return x.null(path, typ, apperr.InternalError("%q is not a %s", v.Interface(), def.Name))
+		}
+		return name, nil
+	case ast.Interface, ast.Union:
+		concrete := x.schema.Types[v.Type().Name()]
+		if concrete == nil || !x.applies(concrete, def.Name) {
+			return x.null(path, typ, apperr.InternalError("%s is not a %s", v.Type().Name(), def.Name))
+		}
+		def = concrete
+	}
+	obj, err := x.selectionSet(ctx, path, def, raw, selections)
+	if err != nil {
+		return x.null(path, typ, nil)
+	}
+	return obj, nil
+}
+
+// null records err, if any, and returns the null for typ: errNonNull when
+// the type is non-null, so the parent is nulled in turn.
+func (x *execution) null(path []interface{}, typ *ast.Type, err error) (interface{}, error) {
+	if err != nil {
+		x.fail(path, err)
+	}
+	if typ.NonNull {
+		return nil, errNonNull
+	}
+	return nil, nil
+}
+
+func (x *execution) fail(path []interface{}, err error) {
+	code, message := string(apperr.CodeInternalError), err.Error()
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		code, message = string(appErr.Code), appErr.Message
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.errors = append(x.errors, ResponseError{
+		Message:    message,
+		Path:       path,
+		Extensions: map[string]interface{}{"code": code},
+	})
+}
+
+// isNull reports whether v is null as typ: nil, a zero time in a nullable
+// position, or a nil slice, which is an empty list in a non-null one.
+func isNull(v reflect.Value, typ *ast.Type) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	case reflect.Slice:
+		return v.IsNil() && (typ.Elem == nil || !typ.NonNull)
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.IsZero() && !typ.NonNull
+	}
+	return false
+}
+
+func serializeScalar(name string, v reflect.Value) (interface{}, error) {
+	value := v.Interface()
+	switch name {
+	case "Int":
+		switch {
+		case v.CanInt():
+			return v.Int(), nil
+		case v.CanUint():
+			return v.Uint(), nil
+		case v.CanFloat():
+			return int64(v.Float()), nil
+		}
+		if d, ok := value.(decimal.Decimal); ok {
+			return d.IntPart(), nil
+		}
+	case "Float":
+		switch {
+		case v.CanFloat():
+			return v.Float(), nil
+		case v.CanInt():
+			return float64(v.Int()), nil
+		}
+		if d, ok := value.(decimal.Decimal); ok {
+			return d.InexactFloat64(), nil
+		}
+	case "Boolean":
+		if v.Kind() == reflect.Bool {
+			return v.Bool(), nil
+		}
+	case "String", "ID", "UUID":
+		if v.Kind() == reflect.String {
+			return v.String(), nil
+		}
+		if s, ok := value.(fmt.Stringer); ok {
+			return s.String(), nil
+		}
+	default:
+		// Time, Decimal and JSON values encode themselves.
+		return value, nil
+	}
+	return nil, apperr.InternalError("%T is not a %s", value, name)
+}
+
+// structField returns the field of struct v named name, or tagged with it.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	v = indirect(v)
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if tag := field.Tag.Get("graphql"); tag == name || (tag == "" && strings.EqualFold(field.Name, name)) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func appendPath(path []interface{}, element interface{}) []interface{} {
+	return append(path[:len(path):len(path)], element)
+}
+
+// object is a response object, whose fields keep the order of the query.
+type object []member
+
+type member struct {
+	name  string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(m.name)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
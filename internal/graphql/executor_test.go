@@ -0,0 +1,114 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveGraphQL posts query to a handler over a Resolver without query
+// handlers, as a caller holding permissions.
+func serveGraphQL(t *testing.T, query string, permissions ...string) (int, *Response) {
+	executor, err := NewSchemaExecutor(&Resolver{})
+	require.NoError(t, err)
+	handler := NewHandler(executor, nil)
+
+	body, err := json.Marshal(Request{Query: query})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/graphql", strings.NewReader(string(body)))
+	req = req.WithContext(middleware.WithIdentity(req.Context(), "tenant-1", "user-1", permissions))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec.Code, &resp
+}
+
+func TestHandler_ForbiddenField(t *testing.T) {
+	status, resp := serveGraphQL(t, `{
+		inventoryItem(id: "8d6e1a52-3c1f-4a8e-9b7a-2f0c5d4e6a71") { sku quantity }
+		invoice(id: "2b3c4d5e-6f70-4812-9a3b-4c5d6e7f8091") { invoiceNumber }
+	}`, "inventory:read")
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"inventoryItem":{"sku":"","quantity":0},"invoice":null}`, string(resp.Data),
+		"the rest of the query still returns")
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, []interface{}{"invoice"}, resp.Errors[0].Path)
+	assert.Equal(t, "FORBIDDEN", resp.Errors[0].Extensions["code"],
+		"the invoice resolver, which has no query handler here, is not called")
+	assert.Contains(t, resp.Errors[0].Message, "invoice:read")
+}
+
+func TestHandler_RefusesMutations(t *testing.T) {
+	_, resp := serveGraphQL(t, `mutation { deleteClient(id: "2b3c4d5e-6f70-4812-9a3b-4c5d6e7f8091") }`, "*")
+	assert.Empty(t, resp.Data)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "OPERATION_NOT_SUPPORTED", resp.Errors[0].Extensions["code"])
+}
+
+func TestHandler_ValidationErrors(t *testing.T) {
+	_, resp := serveGraphQL(t, `{ invoice(id: "x") { unknownField } }`, "*")
+	assert.Empty(t, resp.Data)
+	require.NotEmpty(t, resp.Errors)
+	assert.Equal(t, "GRAPHQL_VALIDATION_FAILED", resp.Errors[0].Extensions["code"])
+}
+
+func TestExecute_Selections(t *testing.T) {
+	executor, err := NewSchemaExecutor(&Resolver{})
+	require.NoError(t, err)
+
+	resp := executor.Execute(context.Background(), &Request{
+		Query: `query Item($skip: Boolean!) {
+			item: inventoryItem(id: "8d6e1a52-3c1f-4a8e-9b7a-2f0c5d4e6a71") {
+				__typename
+				...Stock
+				sku @skip(if: $skip)
+				... on InventoryItem { reservedQty }
+			}
+		}
+		fragment Stock on InventoryItem { quantity availableQty }`,
+		Variables: map[string]interface{}{"skip": true},
+	})
+	assert.Empty(t, resp.Errors)
+	assert.Equal(t, `{"item":{"__typename":"InventoryItem","quantity":0,"availableQty":0,"reservedQty":0}}`, string(resp.Data),
+		"fields keep the order of the query")
+}
+
+func TestExecute_NonNullBubbles(t *testing.T) {
+	executor, err := NewSchemaExecutor(&Resolver{})
+	require.NoError(t, err)
+
+	// InventoryItem.status is non-null and the empty status is no
+	// InventoryStatus, so the nullable item becomes null.
+	resp := executor.Execute(context.Background(), &Request{
+		Query: `{ inventoryItem(id: "8d6e1a52-3c1f-4a8e-9b7a-2f0c5d4e6a71") { sku status } }`,
+	})
+	assert.JSONEq(t, `{"inventoryItem":null}`, string(resp.Data))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, []interface{}{"inventoryItem", "status"}, resp.Errors[0].Path)
+}
+
+func TestArgumentEnums(t *testing.T) {
+	executor, err := NewSchemaExecutor(&Resolver{})
+	require.NoError(t, err)
+	x := &execution{schema: executor.schema}
+
+	field := executor.schema.Query.Fields.ForName("invoices")
+	value, err := x.argument(field.Arguments.ForName("filter"),
+		map[string]interface{}{"status": "PAID", "clientId": "client-1"},
+		reflect.TypeOf(&InvoiceFilter{}))
+	require.NoError(t, err)
+	filter := value.Interface().(*InvoiceFilter)
+	require.NotNil(t, filter.Status)
+	assert.Equal(t, string(InvoiceStatusPaid), *filter.Status, "enum values map to the model's constants")
+}
@@ -0,0 +1,130 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// maxRequestBytes bounds the request body; persisted queries keep real
+// requests far below it.
+const maxRequestBytes = 1 << 20
+
+// Request is a decoded GraphQL request, with the query text resolved.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    *RequestExtensions     `json:"extensions,omitempty"`
+}
+
+type RequestExtensions struct {
+	PersistedQuery *PersistedQueryExtension `json:"persistedQuery,omitempty"`
+}
+
+type PersistedQueryExtension struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []ResponseError `json:"errors,omitempty"`
+}
+
+type ResponseError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Executor runs a resolved request against the schema; SchemaExecutor
+// implements it.
+type Executor interface {
+	Execute(ctx context.Context, req *Request) *Response
+}
+
+// Handler serves GraphQL over HTTP: POST with a JSON body, or GET with
+// query, operationName, variables and extensions parameters, which is how
+// clients send persisted queries so responses can be cached.
+type Handler struct {
+	executor  Executor
+	persisted *PersistedQueries
+}
+
+func NewHandler(executor Executor, persisted *PersistedQueries) *Handler {
+	if persisted == nil {
+		persisted = NewAutomaticPersistedQueries()
+	}
+	return &Handler{executor: executor, persisted: persisted}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeRequest(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, errorResponse(err, "BAD_REQUEST"))
+		return
+	}
+
+	var hash string
+	if req.Extensions != nil && req.Extensions.PersistedQuery != nil {
+		hash = req.Extensions.PersistedQuery.Sha256Hash
+	}
+	query, err := h.persisted.Resolve(req.Query, hash)
+	switch {
+	case errors.Is(err, ErrPersistedQueryNotFound):
+		// Clients retry with the full query; this is not a failed request.
+		writeResponse(w, http.StatusOK, errorResponse(err, "PERSISTED_QUERY_NOT_FOUND"))
+		return
+	case errors.Is(err, ErrPersistedQueryRequired):
+		writeResponse(w, http.StatusForbidden, errorResponse(err, "PERSISTED_QUERY_REQUIRED"))
+		return
+	case err != nil:
+		writeResponse(w, http.StatusBadRequest, errorResponse(err, "BAD_REQUEST"))
+		return
+	}
+	req.Query = query
+
+	writeResponse(w, http.StatusOK, h.executor.Execute(r.Context(), req))
+}
+
+func decodeRequest(r *http.Request) (*Request, error) {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return nil, errors.New("variables must be a JSON object")
+			}
+		}
+		if v := q.Get("extensions"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Extensions); err != nil {
+				return nil, errors.New("extensions must be a JSON object")
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+			return nil, errors.New("request body must be a GraphQL request")
+		}
+	default:
+		return nil, errors.New("only GET and POST are supported")
+	}
+	return &req, nil
+}
+
+func errorResponse(err error, code string) *Response {
+	return &Response{Errors: []ResponseError{{
+		Message:    err.Error(),
+		Extensions: map[string]interface{}{"code": code},
+	}}}
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp *Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,132 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/queries"
+)
+
+type loadersContextKey struct{}
+
+// Loaders batch the lookups field resolvers make per parent, so a page of
+// invoices loads its clients and payments in one query each instead of one
+// per invoice. They are scoped to a request and its tenant.
+type Loaders struct {
+	ClientByID        *Loader[string, *Client]
+	InvoiceByID       *Loader[string, *Invoice]
+	InvoicesByClient  *Loader[string, []*Invoice]
+	PaymentsByInvoice *Loader[string, []*Payment]
+}
+
+// LoaderConfig tunes batching; zero values use the Loader defaults.
+type LoaderConfig struct {
+	Wait     time.Duration
+	MaxBatch int
+}
+
+func NewLoaders(r *Resolver, tenantID string, visibility domain.Visibility, cfg LoaderConfig) *Loaders {
+	return &Loaders{
+		ClientByID: NewLoader(func(ctx context.Context, ids []string) (map[string]*Client, error) {
+			summaries, err := r.ClientHandler.GetClientsByIDs(ctx, &queries.GetClientsByIDsQuery{
+				TenantID:   tenantID,
+				Visibility: visibility,
+				ClientIDs:  ids,
+			})
+			if err != nil {
+				return nil, err
+			}
+			clients := make(map[string]*Client, len(summaries))
+			for i := range summaries {
+				clients[summaries[i].ID] = mapClientSummaryToGraphQL(&summaries[i])
+			}
+			return clients, nil
+		}, cfg.Wait, cfg.MaxBatch),
+
+		InvoiceByID: NewLoader(func(ctx context.Context, ids []string) (map[string]*Invoice, error) {
+			summaries, err := r.InvoiceHandler.GetInvoicesByIDs(ctx, &queries.GetInvoicesByIDsQuery{
+				TenantID:   tenantID,
+				Visibility: visibility,
+				InvoiceIDs: ids,
+			})
+			if err != nil {
+				return nil, err
+			}
+			invoices := make(map[string]*Invoice, len(summaries))
+			for i := range summaries {
+				invoices[summaries[i].ID] = mapInvoiceSummaryToGraphQL(&summaries[i])
+			}
+			return invoices, nil
+		}, cfg.Wait, cfg.MaxBatch),
+
+		InvoicesByClient: NewLoader(func(ctx context.Context, ids []string) (map[string][]*Invoice, error) {
+			summaries, err := r.InvoiceHandler.ListInvoicesByClients(ctx, &queries.ListInvoicesByClientsQuery{
+				TenantID:   tenantID,
+				Visibility: visibility,
+				ClientIDs:  ids,
+			})
+			if err != nil {
+				return nil, err
+			}
+			invoices := make(map[string][]*Invoice, len(ids))
+			for i := range summaries {
+				inv := mapInvoiceSummaryToGraphQL(&summaries[i])
+				invoices[inv.ClientID] = append(invoices[inv.ClientID], inv)
+			}
+			return invoices, nil
+		}, cfg.Wait, cfg.MaxBatch),
+
+		PaymentsByInvoice: NewLoader(func(ctx context.Context, ids []string) (map[string][]*Payment, error) {
+			summaries, err := r.PaymentHandler.GetPaymentsByInvoices(ctx, &queries.GetPaymentsByInvoicesQuery{
+				TenantID:   tenantID,
+				Visibility: visibility,
+				InvoiceIDs: ids,
+			})
+			if err != nil {
+				return nil, err
+			}
+			payments := make(map[string][]*Payment, len(ids))
+			for i := range summaries {
+				p := mapPaymentSummaryToGraphQL(&summaries[i])
+				payments[p.InvoiceID] = append(payments[p.InvoiceID], p)
+			}
+			return payments, nil
+		}, cfg.Wait, cfg.MaxBatch),
+	}
+}
+
+// WithLoaders returns ctx carrying loaders.
+func WithLoaders(ctx context.Context, loaders *Loaders) context.Context {
+	return context.WithValue(ctx, loadersContextKey{}, loaders)
+}
+
+// LoadersFromContext returns the request's loaders, or nil outside a request
+// that went through LoaderMiddleware.
+func LoadersFromContext(ctx context.Context) *Loaders {
+	loaders, _ := ctx.Value(loadersContextKey{}).(*Loaders)
+	return loaders
+}
+
+// LoaderMiddleware gives each request a fresh set of loaders for its tenant.
+// It must run after authentication has put the tenant in the context.
+func (r *Resolver) LoaderMiddleware(cfg LoaderConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			ctx = WithLoaders(ctx, NewLoaders(r, getTenantID(ctx), getVisibility(ctx), cfg))
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// loaders returns the request's loaders, creating an unshared set when the
+// request did not go through LoaderMiddleware so resolvers still work, just
+// without batching across fields.
+func (r *Resolver) loaders(ctx context.Context) *Loaders {
+	if loaders := LoadersFromContext(ctx); loaders != nil {
+		return loaders
+	}
+	return NewLoaders(r, getTenantID(ctx), getVisibility(ctx), LoaderConfig{})
+}
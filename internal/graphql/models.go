@@ -21,11 +21,11 @@ type Client struct {
 	Type          string
 	TaxID         string
 	CreditLimit   decimal.Decimal
-	CurrentCredit decimal.Decimal
-	Address       *Address
+	CurrentCredit decimal.Decimal `graphql:"currentBalance"`
+	Address       *Address        `graphql:"billingAddress"`
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
-	Metadata      map[string]string
+	Metadata      map[string]string `graphql:"customFields"`
 }
 
 // Invoice represents a billing document
@@ -42,7 +42,8 @@ type Invoice struct {
 	TaxTotal      decimal.Decimal
 	DiscountTotal decimal.Decimal
 	Total         decimal.Decimal
-	BalanceDue    decimal.Decimal
+	AmountPaid    decimal.Decimal
+	BalanceDue    decimal.Decimal `graphql:"amountDue"`
 	Currency      string
 	LineItems     []*InvoiceLineItem
 	Payments      []*Payment
@@ -63,7 +64,7 @@ type InvoiceLineItem struct {
 	Discount    decimal.Decimal
 	TaxRate     decimal.Decimal
 	TaxAmount   decimal.Decimal
-	LineTotal   decimal.Decimal
+	LineTotal   decimal.Decimal `graphql:"total"`
 }
 
 // Payment represents a payment made on an invoice
@@ -202,7 +203,7 @@ type RelatedEntity struct {
 
 // Address represents a physical address
 type Address struct {
-	Street1    string
+	Street1    string `graphql:"street"`
 	Street2    string
 	City       string
 	State      string
@@ -629,6 +630,22 @@ type MutationResolver interface {
 	ReprocessDocument(ctx context.Context, id string) (*Document, error)
 }
 
+// ClientResolver resolves Client fields that load related records
+type ClientResolver interface {
+	Invoices(ctx context.Context, obj *Client) ([]*Invoice, error)
+}
+
+// InvoiceResolver resolves Invoice fields that load related records
+type InvoiceResolver interface {
+	Client(ctx context.Context, obj *Invoice) (*Client, error)
+	Payments(ctx context.Context, obj *Invoice) ([]*Payment, error)
+}
+
+// PaymentResolver resolves Payment fields that load related records
+type PaymentResolver interface {
+	Invoice(ctx context.Context, obj *Payment) (*Invoice, error)
+}
+
 // SubscriptionResolver defines the Subscription root type
 type SubscriptionResolver interface {
 	// Client subscriptions
@@ -0,0 +1,125 @@
+package graphql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Error messages follow the Apollo automatic persisted query protocol, so
+// clients know to retry with the full query text.
+var (
+	ErrPersistedQueryNotFound = errors.New("PersistedQueryNotFound")
+	ErrPersistedQueryMismatch = errors.New("provided sha does not match query")
+	ErrPersistedQueryRequired = errors.New("only persisted queries are accepted")
+)
+
+// maxAutomaticQueries bounds the queries registered by clients in automatic
+// mode; beyond it an arbitrary entry is evicted.
+const maxAutomaticQueries = 1000
+
+// PersistedQueries resolves the query text of a request sent by hash.
+//
+// In automatic mode any query may run, and queries sent with their hash are
+// remembered so clients can later send the hash alone. In allowlist mode,
+// used in production, only the queries loaded at startup may run, whether
+// sent by hash or in full.
+type PersistedQueries struct {
+	mu        sync.RWMutex
+	queries   map[string]string
+	allowlist bool
+}
+
+// NewAutomaticPersistedQueries returns a store that accepts any query and
+// registers the ones clients send with their hash.
+func NewAutomaticPersistedQueries() *PersistedQueries {
+	return &PersistedQueries{queries: make(map[string]string)}
+}
+
+// LoadPersistedQueries reads an allowlist written by the UI build: a JSON
+// object mapping the sha256 hex of each query to its text.
+func LoadPersistedQueries(path string) (*PersistedQueries, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persisted queries: %w", err)
+	}
+	var queries map[string]string
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("failed to parse persisted queries %s: %w", path, err)
+	}
+	for hash, query := range queries {
+		if QueryHash(query) != hash {
+			return nil, fmt.Errorf("persisted query %s: %w", hash, ErrPersistedQueryMismatch)
+		}
+	}
+	return &PersistedQueries{queries: queries, allowlist: true}, nil
+}
+
+// QueryHash returns the hash clients send for query.
+func QueryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// Len returns the number of known queries.
+func (p *PersistedQueries) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.queries)
+}
+
+// Resolve returns the query to execute for a request carrying query text,
+// a hash, or both.
+func (p *PersistedQueries) Resolve(query, hash string) (string, error) {
+	if hash == "" {
+		if query == "" {
+			return "", errors.New("query is required")
+		}
+		if p.allowlist && !p.known(QueryHash(query)) {
+			return "", ErrPersistedQueryRequired
+		}
+		return query, nil
+	}
+
+	if query == "" {
+		p.mu.RLock()
+		stored, ok := p.queries[hash]
+		p.mu.RUnlock()
+		if !ok {
+			return "", ErrPersistedQueryNotFound
+		}
+		return stored, nil
+	}
+
+	if QueryHash(query) != hash {
+		return "", ErrPersistedQueryMismatch
+	}
+	if p.allowlist {
+		if !p.known(hash) {
+			return "", ErrPersistedQueryRequired
+		}
+		return query, nil
+	}
+
+	p.mu.Lock()
+	if _, ok := p.queries[hash]; !ok && len(p.queries) >= maxAutomaticQueries {
+		for evict := range p.queries {
+			delete(p.queries, evict)
+			break
+		}
+	}
+	p.queries[hash] = query
+	p.mu.Unlock()
+	return query, nil
+}
+
+func (p *PersistedQueries) known(hash string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.queries[hash]
+	return ok
+}
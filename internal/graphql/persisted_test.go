@@ -0,0 +1,69 @@
+package graphql
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testQuery = `query Invoice($id: UUID!) { invoice(id: $id) { invoiceNumber client { name } } }`
+
+func TestAutomaticPersistedQueries(t *testing.T) {
+	store := NewAutomaticPersistedQueries()
+	hash := QueryHash(testQuery)
+
+	_, err := store.Resolve("", hash)
+	assert.ErrorIs(t, err, ErrPersistedQueryNotFound)
+
+	query, err := store.Resolve(testQuery, hash)
+	require.NoError(t, err)
+	assert.Equal(t, testQuery, query)
+
+	query, err = store.Resolve("", hash)
+	require.NoError(t, err)
+	assert.Equal(t, testQuery, query)
+
+	_, err = store.Resolve(testQuery, QueryHash("{ clients { totalCount } }"))
+	assert.ErrorIs(t, err, ErrPersistedQueryMismatch)
+
+	query, err = store.Resolve("{ clients { totalCount } }", "")
+	require.NoError(t, err, "ad hoc queries run in automatic mode")
+	assert.Equal(t, "{ clients { totalCount } }", query)
+}
+
+func TestAllowlistPersistedQueries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.json")
+	data, err := json.Marshal(map[string]string{QueryHash(testQuery): testQuery})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	store, err := LoadPersistedQueries(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+
+	query, err := store.Resolve("", QueryHash(testQuery))
+	require.NoError(t, err)
+	assert.Equal(t, testQuery, query)
+
+	_, err = store.Resolve(testQuery, "")
+	assert.NoError(t, err, "allowlisted text may be sent in full")
+
+	other := "{ clients { totalCount } }"
+	_, err = store.Resolve(other, "")
+	assert.ErrorIs(t, err, ErrPersistedQueryRequired)
+	_, err = store.Resolve(other, QueryHash(other))
+	assert.ErrorIs(t, err, ErrPersistedQueryRequired)
+	assert.Equal(t, 1, store.Len(), "allowlist does not register queries")
+}
+
+func TestLoadPersistedQueriesRejectsWrongHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"deadbeef": "{ clients { totalCount } }"}`), 0o644))
+
+	_, err := LoadPersistedQueries(path)
+	assert.ErrorIs(t, err, ErrPersistedQueryMismatch)
+}
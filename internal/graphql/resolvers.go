@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
 	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/middleware"
 	"github.com/ims-erp/system/internal/queries"
 	"github.com/shopspring/decimal"
 )
@@ -44,6 +46,21 @@ func (r *Resolver) Subscription() SubscriptionResolver {
 	return &subscriptionResolver{r}
 }
 
+// Client field resolvers
+func (r *Resolver) Client() ClientResolver {
+	return &clientResolver{r}
+}
+
+// Invoice field resolvers
+func (r *Resolver) Invoice() InvoiceResolver {
+	return &invoiceResolver{r}
+}
+
+// Payment field resolvers
+func (r *Resolver) Payment() PaymentResolver {
+	return &paymentResolver{r}
+}
+
 // queryResolver handles Query operations
 type queryResolver struct {
 	*Resolver
@@ -58,8 +75,9 @@ func (r *queryResolver) Client(ctx context.Context, id string) (*Client, error)
 	tenantID := getTenantID(ctx)
 
 	client, err := r.ClientHandler.GetClientByID(ctx, &queries.GetClientByIDQuery{
-		ClientID: clientID.String(),
-		TenantID: tenantID,
+		ClientID:   clientID.String(),
+		TenantID:   tenantID,
+		Visibility: getVisibility(ctx),
 	})
 	if err != nil {
 		return nil, err
@@ -76,18 +94,14 @@ func (r *queryResolver) Clients(ctx context.Context, filter *ClientFilter, first
 		pageSize = *first
 	}
 
-	page := 1
-	if after != nil {
-		// Parse cursor to get page number
-		page = parseCursor(*after) + 1
-	}
-
 	result, err := r.ClientHandler.ListClients(ctx, &queries.ListClientsQuery{
-		TenantID: tenantID,
-		Page:     page,
-		PageSize: pageSize,
-		Search:   getString(filter.Search),
-		Status:   getString(filter.Status),
+		TenantID:   tenantID,
+		Visibility: getVisibility(ctx),
+		Page:       1,
+		PageSize:   pageSize,
+		Cursor:     getString(after),
+		Search:     getString(filter.Search),
+		Status:     getString(filter.Status),
 	})
 	if err != nil {
 		return nil, err
@@ -105,8 +119,9 @@ func (r *queryResolver) Invoice(ctx context.Context, id string) (*Invoice, error
 	tenantID := getTenantID(ctx)
 
 	result, err := r.InvoiceHandler.GetInvoiceByID(ctx, &queries.GetInvoiceByIDQuery{
-		InvoiceID: invoiceID.String(),
-		TenantID:  tenantID,
+		InvoiceID:  invoiceID.String(),
+		TenantID:   tenantID,
+		Visibility: getVisibility(ctx),
 	})
 	if err != nil {
 		return nil, err
@@ -127,15 +142,12 @@ func (r *queryResolver) Invoices(ctx context.Context, filter *InvoiceFilter, fir
 		pageSize = *first
 	}
 
-	page := 1
-	if after != nil {
-		page = parseCursor(*after) + 1
-	}
-
 	query := &queries.ListInvoicesQuery{
-		TenantID: tenantID,
-		Page:     page,
-		PageSize: pageSize,
+		TenantID:   tenantID,
+		Visibility: getVisibility(ctx),
+		Page:       1,
+		PageSize:   pageSize,
+		Cursor:     getString(after),
 	}
 
 	if filter != nil {
@@ -170,8 +182,9 @@ func (r *queryResolver) Payment(ctx context.Context, id string) (*Payment, error
 	tenantID := getTenantID(ctx)
 
 	result, err := r.PaymentHandler.GetPaymentByID(ctx, &queries.GetPaymentByIDQuery{
-		PaymentID: paymentID.String(),
-		TenantID:  tenantID,
+		PaymentID:  paymentID.String(),
+		TenantID:   tenantID,
+		Visibility: getVisibility(ctx),
 	})
 	if err != nil {
 		return nil, err
@@ -193,10 +206,11 @@ func (r *queryResolver) PaymentsByInvoice(ctx context.Context, invoiceID string)
 	tenantID := getTenantID(ctx)
 
 	result, err := r.PaymentHandler.GetPaymentsByInvoice(ctx, &queries.GetPaymentsByInvoiceQuery{
-		InvoiceID: invID.String(),
-		TenantID:  tenantID,
-		Page:      1,
-		PageSize:  100,
+		InvoiceID:  invID.String(),
+		TenantID:   tenantID,
+		Visibility: getVisibility(ctx),
+		Page:       1,
+		PageSize:   100,
 	})
 	if err != nil {
 		return nil, err
@@ -316,6 +330,7 @@ func (r *queryResolver) Documents(ctx context.Context, docType *DocumentType, st
 		TenantID: tenantID,
 		Page:     1,
 		PageSize: pageSize,
+		Cursor:   getString(after),
 		Type:     typeStr,
 		Status:   getString(status),
 	})
@@ -386,8 +401,9 @@ func (r *mutationResolver) IssueInvoice(ctx context.Context, id string) (*Invoic
 
 	// Fetch the invoice first
 	result, err := r.InvoiceHandler.GetInvoiceByID(ctx, &queries.GetInvoiceByIDQuery{
-		InvoiceID: invoiceID.String(),
-		TenantID:  tenantID,
+		InvoiceID:  invoiceID.String(),
+		TenantID:   tenantID,
+		Visibility: getVisibility(ctx),
 	})
 	if err != nil {
 		return nil, err
@@ -429,8 +445,9 @@ func (r *mutationResolver) PayInvoice(ctx context.Context, id string, input Crea
 
 	// Fetch and update invoice
 	result, err := r.InvoiceHandler.GetInvoiceByID(ctx, &queries.GetInvoiceByIDQuery{
-		InvoiceID: invoiceID.String(),
-		TenantID:  tenantID,
+		InvoiceID:  invoiceID.String(),
+		TenantID:   tenantID,
+		Visibility: getVisibility(ctx),
 	})
 	if err != nil {
 		return nil, err
@@ -767,10 +784,67 @@ func (r *subscriptionResolver) DocumentProcessed(ctx context.Context, documentID
 	return ch, nil
 }
 
+// Field resolvers load related records through the request's loaders, so
+// resolving a field across a page of parents costs one query.
+
+type clientResolver struct {
+	*Resolver
+}
+
+func (r *clientResolver) Invoices(ctx context.Context, obj *Client) ([]*Invoice, error) {
+	invoices, err := r.loaders(ctx).InvoicesByClient.Load(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	if invoices == nil {
+		return []*Invoice{}, nil
+	}
+	return invoices, nil
+}
+
+type invoiceResolver struct {
+	*Resolver
+}
+
+func (r *invoiceResolver) Client(ctx context.Context, obj *Invoice) (*Client, error) {
+	if obj.Client != nil {
+		return obj.Client, nil
+	}
+	return r.loaders(ctx).ClientByID.Load(ctx, obj.ClientID)
+}
+
+func (r *invoiceResolver) Payments(ctx context.Context, obj *Invoice) ([]*Payment, error) {
+	if obj.Payments != nil {
+		return obj.Payments, nil
+	}
+	payments, err := r.loaders(ctx).PaymentsByInvoice.Load(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	if payments == nil {
+		return []*Payment{}, nil
+	}
+	return payments, nil
+}
+
+type paymentResolver struct {
+	*Resolver
+}
+
+func (r *paymentResolver) Invoice(ctx context.Context, obj *Payment) (*Invoice, error) {
+	if obj.Invoice != nil {
+		return obj.Invoice, nil
+	}
+	return r.loaders(ctx).InvoiceByID.Load(ctx, obj.InvoiceID)
+}
+
 // Helper functions
 func getTenantID(ctx context.Context) string {
-	// Extract tenant ID from context
-	return "default-tenant"
+	return middleware.GetTenantID(ctx)
+}
+
+func getVisibility(ctx context.Context) domain.Visibility {
+	return middleware.GetVisibility(ctx)
 }
 
 func getString(s *string) string {
@@ -817,10 +891,8 @@ func mapClientConnectionToGraphQL(result *queries.ListClientsResult) *ClientConn
 	return &ClientConnection{
 		Edges: edges,
 		PageInfo: &PageInfo{
-			HasNextPage: result.Page < result.TotalPages,
-			HasPrevPage: result.Page > 1,
-			StartCursor: string(rune(0)),
-			EndCursor:   string(rune(len(edges) - 1)),
+			HasNextPage: result.NextCursor != "",
+			EndCursor:   result.NextCursor,
 			TotalCount:  int(result.Total),
 		},
 	}
@@ -982,10 +1054,8 @@ func mapDocumentConnectionToGraphQL(result *queries.ListDocumentsResult) *Docume
 	return &DocumentConnection{
 		Edges: edges,
 		PageInfo: &PageInfo{
-			HasNextPage: result.Page < result.TotalPages,
-			HasPrevPage: result.Page > 1,
-			StartCursor: string(rune(0)),
-			EndCursor:   string(rune(len(edges) - 1)),
+			HasNextPage: result.NextCursor != "",
+			EndCursor:   result.NextCursor,
 			TotalCount:  int(result.Total),
 		},
 	}
@@ -1001,6 +1071,7 @@ func mapInvoiceSummaryToGraphQL(inv *events.InvoiceSummary) *Invoice {
 	taxTotal, _ := decimal.NewFromString(inv.TaxTotal)
 	discountTotal, _ := decimal.NewFromString(inv.DiscountTotal)
 	total, _ := decimal.NewFromString(inv.Total)
+	amountPaid, _ := decimal.NewFromString(inv.AmountPaid)
 	balanceDue, _ := decimal.NewFromString(inv.AmountDue)
 
 	return &Invoice{
@@ -1015,6 +1086,7 @@ func mapInvoiceSummaryToGraphQL(inv *events.InvoiceSummary) *Invoice {
 		TaxTotal:      taxTotal,
 		DiscountTotal: discountTotal,
 		Total:         total,
+		AmountPaid:    amountPaid,
 		BalanceDue:    balanceDue,
 		Currency:      inv.Currency,
 		Notes:         inv.Notes,
@@ -1057,10 +1129,8 @@ func mapInvoiceConnectionToGraphQL(result *queries.ListInvoicesResult) *InvoiceC
 	return &InvoiceConnection{
 		Edges: edges,
 		PageInfo: &PageInfo{
-			HasNextPage: result.Page < result.TotalPages,
-			HasPrevPage: result.Page > 1,
-			StartCursor: string(rune(0)),
-			EndCursor:   string(rune(len(edges) - 1)),
+			HasNextPage: result.NextCursor != "",
+			EndCursor:   result.NextCursor,
 			TotalCount:  int(result.Total),
 		},
 	}
@@ -8,27 +8,40 @@ scalar UUID
 scalar Decimal
 scalar JSON
 
+# Fields marked with hasPermission resolve to null with an error unless the
+# caller holds the permission.
+directive @hasPermission(permission: String!) on FIELD_DEFINITION
+
 # Enums
 enum ClientStatus {
   ACTIVE
   INACTIVE
   SUSPENDED
+  PENDING
   MERGED
 }
 
 enum InvoiceStatus {
   DRAFT
+  PENDING
   ISSUED
+  SENT
+  PARTIAL
   PAID
   OVERDUE
   VOID
+  CANCELLED
+  REFUNDED
 }
 
 enum PaymentStatus {
   PENDING
+  PROCESSING
   COMPLETED
   FAILED
   REFUNDED
+  PARTIAL_REFUNDED
+  CANCELLED
 }
 
 enum WarehouseStatus {
@@ -71,13 +84,14 @@ type Client implements Node {
   email: String!
   phone: String
   status: ClientStatus!
-  creditLimit: Decimal
-  currentBalance: Decimal
-  availableCredit: Decimal
+  creditLimit: Decimal @hasPermission(permission: "credit:read")
+  currentBalance: Decimal @hasPermission(permission: "credit:read")
+  availableCredit: Decimal @hasPermission(permission: "credit:read")
   tags: [String!]
   billingAddress: Address
   shippingAddresses: [Address!]
   customFields: JSON
+  invoices: [Invoice!]! @hasPermission(permission: "invoice:read")
   createdAt: Time!
   updatedAt: Time!
 }
@@ -95,7 +109,7 @@ type Invoice implements Node {
   id: UUID!
   tenantId: UUID!
   clientId: UUID!
-  client: Client
+  client: Client @hasPermission(permission: "client:read")
   invoiceNumber: String!
   status: InvoiceStatus!
   issueDate: Time!
@@ -106,6 +120,7 @@ type Invoice implements Node {
   amountPaid: Decimal!
   amountDue: Decimal!
   lineItems: [InvoiceLineItem!]!
+  payments: [Payment!]! @hasPermission(permission: "payment:read")
   notes: String
   createdAt: Time!
   updatedAt: Time!
@@ -125,7 +140,7 @@ type Payment implements Node {
   id: UUID!
   tenantId: UUID!
   invoiceId: UUID!
-  invoice: Invoice
+  invoice: Invoice @hasPermission(permission: "invoice:read")
   amount: Decimal!
   currency: String!
   status: PaymentStatus!
@@ -133,6 +148,7 @@ type Payment implements Node {
   reference: String
   processedAt: Time
   createdAt: Time!
+  updatedAt: Time!
 }
 
 # Warehouse types
@@ -418,28 +434,28 @@ input InventoryFilter {
 # Query root type
 type Query {
   # Client queries
-  client(id: UUID!): Client
+  client(id: UUID!): Client @hasPermission(permission: "client:read")
   clients(
     filter: ClientFilter
     first: Int
     after: String
     last: Int
     before: String
-  ): ClientConnection!
+  ): ClientConnection! @hasPermission(permission: "client:read")
   
   # Invoice queries
-  invoice(id: UUID!): Invoice
+  invoice(id: UUID!): Invoice @hasPermission(permission: "invoice:read")
   invoices(
     filter: InvoiceFilter
     first: Int
     after: String
     last: Int
     before: String
-  ): InvoiceConnection!
+  ): InvoiceConnection! @hasPermission(permission: "invoice:read")
   
   # Payment queries
-  payment(id: UUID!): Payment
-  paymentsByInvoice(invoiceId: UUID!): [Payment!]!
+  payment(id: UUID!): Payment @hasPermission(permission: "payment:read")
+  paymentsByInvoice(invoiceId: UUID!): [Payment!]! @hasPermission(permission: "payment:read")
   
   # Warehouse queries
   warehouse(id: UUID!): Warehouse
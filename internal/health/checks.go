@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/internal/search"
+)
+
+// Connection is a messaging client that reports whether it is connected;
+// messaging publishers and subscribers satisfy it for NATS and Kafka.
+type Connection interface {
+	Connected() bool
+}
+
+// ConsumerLagSource reports how many messages a durable consumer has yet to
+// process; messaging.Subscriber implements it for JetStream.
+type ConsumerLagSource interface {
+	ConsumerPending(ctx context.Context, stream, consumer string) (uint64, error)
+}
+
+// ping runs fn and reports the dependency healthy if it returns nil.
+func ping(fn func(ctx context.Context) error) func(ctx context.Context) Check {
+	return func(ctx context.Context) Check {
+		start := time.Now()
+		if err := fn(ctx); err != nil {
+			return Check{
+				Status:  StatusUnhealthy,
+				Latency: time.Since(start).String(),
+				Error:   err.Error(),
+			}
+		}
+		return Check{
+			Status:  StatusHealthy,
+			Latency: time.Since(start).String(),
+			Message: "Connected",
+		}
+	}
+}
+
+func MongoDBCheck(db *repository.MongoDB) func(ctx context.Context) Check {
+	return ping(db.Health)
+}
+
+func RedisCheck(r *repository.Redis) func(ctx context.Context) Check {
+	return ping(r.Health)
+}
+
+func ElasticsearchCheck(c *search.Client) func(ctx context.Context) Check {
+	return ping(c.Ping)
+}
+
+func PostgresCheck(p *repository.Postgres) func(ctx context.Context) Check {
+	return ping(p.Ping)
+}
+
+// MessagingCheck reports conn unhealthy while it is disconnected, including
+// while the client is reconnecting.
+func MessagingCheck(conn Connection) func(ctx context.Context) Check {
+	return ping(func(ctx context.Context) error {
+		if !conn.Connected() {
+			return errors.New("not connected")
+		}
+		return nil
+	})
+}
+
+// ConsumerLagCheck reports the consumer unhealthy if its state cannot be
+// read, and degraded when more than maxPending messages are waiting.
+func ConsumerLagCheck(src ConsumerLagSource, stream, consumer string, maxPending uint64) func(ctx context.Context) Check {
+	return func(ctx context.Context) Check {
+		start := time.Now()
+		pending, err := src.ConsumerPending(ctx, stream, consumer)
+		check := Check{Latency: time.Since(start).String()}
+		switch {
+		case err != nil:
+			check.Status = StatusUnhealthy
+			check.Error = err.Error()
+		case pending > maxPending:
+			check.Status = StatusDegraded
+			check.Message = fmt.Sprintf("%d messages pending (threshold %d)", pending, maxPending)
+		default:
+			check.Status = StatusHealthy
+			check.Message = fmt.Sprintf("%d messages pending", pending)
+		}
+		return check
+	}
+}
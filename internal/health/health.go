@@ -8,17 +8,27 @@ import (
 
 	"github.com/ims-erp/system/internal/config"
 	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+	// StatusDegraded marks a dependency that works but is behind, such as a
+	// lagging consumer. It does not fail readiness.
+	StatusDegraded = "degraded"
+)
+
 type HealthChecker struct {
-	config  *config.Config
-	mongodb *repository.MongoDB
-	redis   *repository.Redis
-	logger  *logger.Logger
-	tracer  trace.Tracer
+	config     *config.Config
+	mongodb    *repository.MongoDB
+	redis      *repository.Redis
+	components []Component
+	logger     *logger.Logger
+	tracer     trace.Tracer
 }
 
 func NewHealthChecker(
@@ -56,6 +66,29 @@ type Component struct {
 	Checker func(ctx context.Context) Check
 }
 
+// AddComponent adds a check besides MongoDB and Redis.
+func (h *HealthChecker) AddComponent(name string, checker func(ctx context.Context) Check) {
+	h.components = append(h.components, Component{name, checker})
+}
+
+// Readiness returns a ReadinessChecker over the same dependencies, so /ready
+// gates traffic on what /health reports. Components added to h later are not
+// included.
+func (h *HealthChecker) Readiness() *ReadinessChecker {
+	return &ReadinessChecker{components: h.dependencies(), logger: h.logger}
+}
+
+func (h *HealthChecker) dependencies() []Component {
+	var components []Component
+	if h.mongodb != nil {
+		components = append(components, Component{"mongodb", MongoDBCheck(h.mongodb)})
+	}
+	if h.redis != nil {
+		components = append(components, Component{"redis", RedisCheck(h.redis)})
+	}
+	return append(components, h.components...)
+}
+
 func (h *HealthChecker) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
@@ -65,7 +98,7 @@ func (h *HealthChecker) Handler() http.Handler {
 		statusJSON, err := json.Marshal(status)
 		if err != nil {
 			h.logger.Error("Failed to marshal health status", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 
@@ -86,15 +119,10 @@ func (h *HealthChecker) GetHealth(ctx context.Context) HealthStatus {
 
 	var overallStatus string = "healthy"
 
-	components := []Component{
-		{"mongodb", h.checkMongoDB},
-		{"redis", h.checkRedis},
-	}
-
-	for _, comp := range components {
+	for _, comp := range h.dependencies() {
 		check := comp.Checker(ctx)
 		checks[comp.Name] = check
-		if check.Status != "healthy" {
+		if check.Status == StatusUnhealthy {
 			overallStatus = "unhealthy"
 		}
 	}
@@ -108,44 +136,6 @@ func (h *HealthChecker) GetHealth(ctx context.Context) HealthStatus {
 	}
 }
 
-func (h *HealthChecker) checkMongoDB(ctx context.Context) Check {
-	start := time.Now()
-	defer func() { _ = time.Since(start) }()
-
-	if err := h.mongodb.Health(ctx); err != nil {
-		return Check{
-			Status:  "unhealthy",
-			Latency: time.Since(start).String(),
-			Error:   err.Error(),
-		}
-	}
-
-	return Check{
-		Status:  "healthy",
-		Latency: time.Since(start).String(),
-		Message: "Connected",
-	}
-}
-
-func (h *HealthChecker) checkRedis(ctx context.Context) Check {
-	start := time.Now()
-	defer func() { _ = time.Since(start) }()
-
-	if err := h.redis.Health(ctx); err != nil {
-		return Check{
-			Status:  "unhealthy",
-			Latency: time.Since(start).String(),
-			Error:   err.Error(),
-		}
-	}
-
-	return Check{
-		Status:  "healthy",
-		Latency: time.Since(start).String(),
-		Message: "Connected",
-	}
-}
-
 type ReadinessChecker struct {
 	components []Component
 	logger     *logger.Logger
@@ -173,7 +163,7 @@ func (r *ReadinessChecker) Handler() http.Handler {
 		for _, comp := range r.components {
 			check := comp.Checker(ctx)
 			checks[comp.Name] = check
-			if check.Status != "healthy" {
+			if check.Status == StatusUnhealthy {
 				allReady = false
 			}
 		}
@@ -185,11 +175,14 @@ func (r *ReadinessChecker) Handler() http.Handler {
 			Status: "ready",
 			Checks: checks,
 		}
+		if !allReady {
+			status.Status = "not_ready"
+		}
 
 		statusJSON, err := json.Marshal(status)
 		if err != nil {
 			r.logger.Error("Failed to marshal readiness status", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			httpresponse.ErrorStatus(w, req, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConnection bool
+
+func (c fakeConnection) Connected() bool { return bool(c) }
+
+type fakeLag struct {
+	pending uint64
+	err     error
+}
+
+func (f fakeLag) ConsumerPending(ctx context.Context, stream, consumer string) (uint64, error) {
+	return f.pending, f.err
+}
+
+type readiness struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+}
+
+func serveReady(t *testing.T, r *ReadinessChecker) (int, readiness) {
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var body readiness
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec.Code, body
+}
+
+func newTestReadiness(t *testing.T) *ReadinessChecker {
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	return NewReadinessChecker(log)
+}
+
+func TestReadinessFailsOnUnhealthyDependency(t *testing.T) {
+	r := newTestReadiness(t)
+	r.AddComponent("nats", MessagingCheck(fakeConnection(false)))
+	r.AddComponent("redis", func(ctx context.Context) Check { return Check{Status: StatusHealthy} })
+
+	code, body := serveReady(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not_ready", body.Status)
+	assert.Equal(t, StatusUnhealthy, body.Checks["nats"].Status)
+	assert.Equal(t, "not connected", body.Checks["nats"].Error)
+	assert.Equal(t, StatusHealthy, body.Checks["redis"].Status)
+}
+
+func TestReadinessToleratesDegradedConsumer(t *testing.T) {
+	r := newTestReadiness(t)
+	r.AddComponent("nats", MessagingCheck(fakeConnection(true)))
+	r.AddComponent("consumer", ConsumerLagCheck(fakeLag{pending: 500}, "CLIENT_EVENTS", "projections", 100))
+
+	code, body := serveReady(t, r)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body.Status)
+	assert.Equal(t, StatusDegraded, body.Checks["consumer"].Status)
+	assert.Contains(t, body.Checks["consumer"].Message, "500 messages pending")
+}
+
+func TestConsumerLagCheck(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Equal(t, StatusHealthy, ConsumerLagCheck(fakeLag{pending: 3}, "S", "c", 10)(ctx).Status)
+
+	check := ConsumerLagCheck(fakeLag{err: errors.New("consumer not found")}, "S", "c", 10)(ctx)
+	assert.Equal(t, StatusUnhealthy, check.Status)
+	assert.Equal(t, "consumer not found", check.Error)
+}
@@ -0,0 +1,257 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+// ErrUnsupportedImage is returned for files that are not an image the
+// pipeline can decode.
+var ErrUnsupportedImage = errors.New("imaging: cannot decode this image type")
+
+// Format is the file format a rendition is encoded in.
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatWebP Format = "webp"
+	FormatAVIF Format = "avif"
+)
+
+// IsValid reports whether renditions can be encoded in f.
+func (f Format) IsValid() bool {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatWebP, FormatAVIF:
+		return true
+	}
+	return false
+}
+
+// ContentType returns the MIME type of files in f.
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Extension returns the file extension of files in f.
+func (f Format) Extension() string {
+	if f == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// Rendition describes one rendering of an image: scaled down to fit
+// within Width by Height, either of which may be zero for no limit,
+// watermarked when Watermark is set and encoded in Format at Quality, from
+// 1 to 100 or zero for the encoder's default. Images are never scaled up.
+type Rendition struct {
+	Name      string `json:"name"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Format    Format `json:"format"`
+	Quality   int    `json:"quality,omitempty"`
+	Watermark bool   `json:"watermark,omitempty"`
+}
+
+// Output is a rendered image.
+type Output struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// decoders are the image types renditions are made from, by MIME type.
+var decoders = map[string]func([]byte) (image.Image, error){
+	"image/jpeg": func(data []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(data)) },
+	"image/png":  func(data []byte) (image.Image, error) { return png.Decode(bytes.NewReader(data)) },
+	"image/gif":  func(data []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(data)) },
+	"image/webp": func(data []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(data)) },
+	"image/bmp":  func(data []byte) (image.Image, error) { return bmp.Decode(bytes.NewReader(data)) },
+	"image/tiff": func(data []byte) (image.Image, error) { return tiff.Decode(bytes.NewReader(data)) },
+}
+
+// Supported reports whether renditions can be made of images of mimeType.
+func Supported(mimeType string) bool {
+	_, ok := decoders[mimeType]
+	return ok
+}
+
+// Pipeline renders images. Each rendition is decoded afresh, turned upright
+// by its EXIF orientation and re-encoded without any of the original's
+// metadata, so locations and camera details never leave with it. WebP and
+// AVIF are encoded with cwebp and avifenc.
+type Pipeline struct {
+	// CWebP and AVIFEnc are the commands run, looked up in PATH unless
+	// absolute, and PDFToPPM the one first pages of PDFs are drawn with.
+	CWebP    string
+	AVIFEnc  string
+	PDFToPPM string
+	// Watermark is stamped in the bottom right corner of watermarked
+	// renditions at WatermarkOpacity, from 0 to 1. Without one, they are
+	// rendered unmarked.
+	Watermark        image.Image
+	WatermarkOpacity float64
+}
+
+// NewPipeline returns a Pipeline running the default encoders, without a
+// watermark.
+func NewPipeline() *Pipeline {
+	return &Pipeline{CWebP: "cwebp", AVIFEnc: "avifenc", PDFToPPM: "pdftoppm", WatermarkOpacity: 0.4}
+}
+
+// LoadWatermark reads the PNG image at path to watermark renditions with.
+func LoadWatermark(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// Render renders data, an image of mimeType, as r.
+func (p *Pipeline) Render(ctx context.Context, data []byte, mimeType string, r Rendition) (*Output, error) {
+	decode, ok := decoders[mimeType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	img, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("imaging: failed to decode image: %w", err)
+	}
+	if mimeType == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+	img = fit(img, r.Width, r.Height)
+	if r.Watermark && p.Watermark != nil {
+		img = p.watermark(img)
+	}
+
+	out, err := p.encode(ctx, img, r.Format, r.Quality)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	return &Output{Data: out, ContentType: r.Format.ContentType(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// fit scales img down to fit within width by height, keeping its aspect
+// ratio. A zero limit leaves that side unconstrained.
+func fit(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	scale := 1.0
+	if width > 0 && w > width {
+		scale = float64(width) / float64(w)
+	}
+	if height > 0 && h > height && float64(height)/float64(h) < scale {
+		scale = float64(height) / float64(h)
+	}
+	if scale == 1.0 {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// watermark stamps the watermark on img, scaled to at most a quarter of
+// its width, inset from the bottom right corner.
+func (p *Pipeline) watermark(img image.Image) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	mark := fit(p.Watermark, max(1, dst.Bounds().Dx()/4), max(1, dst.Bounds().Dy()/4))
+	size := mark.Bounds().Size()
+	margin := dst.Bounds().Dx() / 40
+	at := image.Pt(dst.Bounds().Dx()-size.X-margin, dst.Bounds().Dy()-size.Y-margin)
+	opacity := color.Alpha{A: uint8(min(max(p.WatermarkOpacity, 0), 1) * 255)}
+	draw.DrawMask(dst, image.Rectangle{Min: at, Max: at.Add(size)}, mark, mark.Bounds().Min,
+		image.NewUniform(opacity), image.Point{}, draw.Over)
+	return dst
+}
+
+func (p *Pipeline) encode(ctx context.Context, img image.Image, format Format, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJPEG:
+		if quality == 0 {
+			quality = 85
+		}
+		// JPEG has no transparency: transparent areas become white
+		// rather than black.
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("imaging: failed to encode JPEG: %w", err)
+		}
+		return buf.Bytes(), nil
+	case FormatPNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("imaging: failed to encode PNG: %w", err)
+		}
+		return buf.Bytes(), nil
+	case FormatWebP:
+		if quality == 0 {
+			quality = 80
+		}
+		return p.run(ctx, img, ".webp", p.CWebP, "-quiet", "-q", fmt.Sprint(quality), "{in}", "-o", "{out}")
+	case FormatAVIF:
+		if quality == 0 {
+			quality = 60
+		}
+		return p.run(ctx, img, ".avif", p.AVIFEnc, "-q", fmt.Sprint(quality), "{in}", "{out}")
+	default:
+		return nil, fmt.Errorf("imaging: unknown format %q", format)
+	}
+}
+
+// run encodes img with an external encoder, which reads it as a PNG from
+// the file given for {in} and writes the file given for {out}.
+func (p *Pipeline) run(ctx context.Context, img image.Image, ext, command string, args ...string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "imaging-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out"+ext)
+	var src bytes.Buffer
+	if err := png.Encode(&src, img); err != nil {
+		return nil, fmt.Errorf("imaging: failed to encode PNG: %w", err)
+	}
+	if err := os.WriteFile(in, src.Bytes(), 0o600); err != nil {
+		return nil, err
+	}
+	for i, arg := range args {
+		args[i] = strings.NewReplacer("{in}", in, "{out}", out).Replace(arg)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("imaging: %s failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(out)
+}
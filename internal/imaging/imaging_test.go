@@ -0,0 +1,152 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// exifJPEG returns a JPEG of img with an EXIF segment recording
+// orientation.
+func exifJPEG(t *testing.T, img image.Image, orientation uint16) []byte {
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, img, nil))
+
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	data := append([]byte{0xFF, 0xD8}, append(segment, payload...)...)
+	return append(data, encoded.Bytes()[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	img := solid(4, 2, color.White)
+	assert.Equal(t, 6, exifOrientation(exifJPEG(t, img, 6)))
+	assert.Equal(t, 1, exifOrientation(exifJPEG(t, img, 12)))
+
+	var plain bytes.Buffer
+	require.NoError(t, jpeg.Encode(&plain, img, nil))
+	assert.Equal(t, 1, exifOrientation(plain.Bytes()))
+	assert.Equal(t, 1, exifOrientation([]byte("not an image")))
+}
+
+func TestOrient(t *testing.T) {
+	// A 2x1 image, red on the left, stored rotated: orientation 6 turns it
+	// clockwise, putting red on top.
+	img := solid(2, 1, color.White)
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	upright := orient(img, 6)
+	assert.Equal(t, image.Rect(0, 0, 1, 2), upright.Bounds())
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, upright.At(0, 0))
+
+	mirrored := orient(img, 2)
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, mirrored.At(1, 0))
+	assert.Same(t, image.Image(img), orient(img, 1))
+}
+
+func TestFit(t *testing.T) {
+	img := solid(400, 200, color.White)
+	assert.Equal(t, image.Pt(100, 50), fit(img, 100, 100).Bounds().Size())
+	assert.Equal(t, image.Pt(200, 100), fit(img, 0, 100).Bounds().Size())
+	assert.Equal(t, image.Pt(400, 200), fit(img, 800, 800).Bounds().Size(), "never scaled up")
+	assert.Equal(t, image.Pt(400, 200), fit(img, 0, 0).Bounds().Size())
+}
+
+func TestPipeline_Render(t *testing.T) {
+	p := NewPipeline()
+	data := exifJPEG(t, solid(400, 200, color.White), 6)
+
+	out, err := p.Render(context.Background(), data, "image/jpeg", Rendition{Name: "thumbnail", Width: 100, Height: 100, Format: FormatJPEG})
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", out.ContentType)
+	// Turned upright before it is fitted, then stored without EXIF.
+	assert.Equal(t, 50, out.Width)
+	assert.Equal(t, 100, out.Height)
+	assert.NotContains(t, string(out.Data), "Exif")
+
+	decoded, err := jpeg.Decode(bytes.NewReader(out.Data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(50, 100), decoded.Bounds().Size())
+
+	_, err = p.Render(context.Background(), []byte("%PDF-1.7"), "application/pdf", Rendition{Format: FormatPNG})
+	assert.ErrorIs(t, err, ErrUnsupportedImage)
+}
+
+func TestPipeline_RenderWatermark(t *testing.T) {
+	var src bytes.Buffer
+	require.NoError(t, png.Encode(&src, solid(200, 200, color.White)))
+
+	p := NewPipeline()
+	p.Watermark = solid(40, 40, color.Black)
+	p.WatermarkOpacity = 1
+
+	plain, err := p.Render(context.Background(), src.Bytes(), "image/png", Rendition{Format: FormatPNG})
+	require.NoError(t, err)
+	marked, err := p.Render(context.Background(), src.Bytes(), "image/png", Rendition{Format: FormatPNG, Watermark: true})
+	require.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(plain.Data))
+	require.NoError(t, err)
+	r, _, _, _ := decoded.At(180, 180).RGBA()
+	assert.Equal(t, uint32(0xFFFF), r)
+
+	decoded, err = png.Decode(bytes.NewReader(marked.Data))
+	require.NoError(t, err)
+	r, _, _, _ = decoded.At(180, 180).RGBA()
+	assert.Equal(t, uint32(0), r, "bottom right corner is watermarked")
+	r, _, _, _ = decoded.At(10, 10).RGBA()
+	assert.Equal(t, uint32(0xFFFF), r)
+}
+
+func TestPipeline_RenderEncoderMissing(t *testing.T) {
+	var src bytes.Buffer
+	require.NoError(t, png.Encode(&src, solid(10, 10, color.White)))
+
+	p := NewPipeline()
+	p.CWebP = "/nonexistent/cwebp"
+	_, err := p.Render(context.Background(), src.Bytes(), "image/png", Rendition{Format: FormatWebP})
+	assert.ErrorContains(t, err, "/nonexistent/cwebp failed")
+}
+
+func TestPipeline_FirstPageRendererMissing(t *testing.T) {
+	p := NewPipeline()
+	p.PDFToPPM = "/nonexistent/pdftoppm"
+	_, err := p.FirstPage(context.Background(), []byte("%PDF-1.7"), 400)
+	assert.ErrorContains(t, err, "/nonexistent/pdftoppm failed")
+}
+
+func TestFormat(t *testing.T) {
+	assert.True(t, FormatAVIF.IsValid())
+	assert.False(t, Format("heic").IsValid())
+	assert.Equal(t, ".jpg", FormatJPEG.Extension())
+	assert.Equal(t, "image/webp", FormatWebP.ContentType())
+	assert.True(t, Supported("image/webp"))
+	assert.False(t, Supported("application/pdf"))
+}
@@ -0,0 +1,35 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// FirstPage draws the first page of data, a PDF, as a PNG at most width
+// pixels wide, to render like any other image.
+func (p *Pipeline) FirstPage(ctx context.Context, data []byte, width int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "imaging-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.pdf"), filepath.Join(dir, "page")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.PDFToPPM, "-f", "1", "-l", "1", "-singlefile", "-png",
+		"-scale-to-x", fmt.Sprint(width), "-scale-to-y", "-1", in, out)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("imaging: %s failed: %w: %s", p.PDFToPPM, err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(out + ".png")
+}
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
 )
 
 // Region represents a deployment region
@@ -161,7 +163,7 @@ func RegionMiddleware(lb *LoadBalancer) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract tenant ID from request
-			tenantIDStr := r.Header.Get("X-Tenant-ID")
+			tenantIDStr := middleware.GetTenantID(r.Context())
 			if tenantIDStr == "" {
 				tenantIDStr = "default"
 			}
@@ -174,7 +176,7 @@ func RegionMiddleware(lb *LoadBalancer) func(http.Handler) http.Handler {
 			// Get region
 			region, err := lb.GetHealthyRegion(tenantID, nil)
 			if err != nil {
-				http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+				httpresponse.ErrorStatus(w, r, http.StatusServiceUnavailable, "Service unavailable")
 				return
 			}
 
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+
+	"github.com/ims-erp/system/pkg/httpresponse"
 )
 
 // CompressionMiddleware compresses HTTP responses using gzip
@@ -140,7 +142,7 @@ func (m *RequestCoalescingMiddleware) Handler(next http.Handler) http.Handler {
 			<-pending.done
 
 			if pending.err != nil {
-				http.Error(w, pending.err.Error(), http.StatusInternalServerError)
+				httpresponse.Error(w, r, pending.err)
 				return
 			}
 
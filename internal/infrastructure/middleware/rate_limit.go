@@ -1,11 +1,12 @@
 package middleware
 
 import (
-	"encoding/json"
 	"net"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/ims-erp/system/pkg/httpresponse"
 )
 
 // tokenBucket implements a simple token bucket rate limiter
@@ -86,11 +87,7 @@ func (rl *RateLimiter) Handler(next http.Handler) http.Handler {
 
 		// Check rate limit
 		if !limiter.Allow() {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusTooManyRequests)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "Rate limit exceeded. Please try again later.",
-			})
+			httpresponse.ErrorStatus(w, r, http.StatusTooManyRequests, "Rate limit exceeded. Please try again later.")
 			return
 		}
 
@@ -200,11 +197,7 @@ func NewCircuitBreaker(threshold int, timeout time.Duration) *CircuitBreaker {
 func (cb *CircuitBreaker) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !cb.CanExecute() {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "Service temporarily unavailable (circuit breaker open)",
-			})
+			httpresponse.ErrorStatus(w, r, http.StatusServiceUnavailable, "Service temporarily unavailable (circuit breaker open)")
 			return
 		}
 
@@ -1,17 +1,16 @@
 package processing
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/extraction"
+	"github.com/ims-erp/system/internal/imaging"
 	"github.com/shopspring/decimal"
 )
 
@@ -19,16 +18,28 @@ import (
 type DocumentProcessingService struct {
 	storageService domain.StorageService
 	extractors     map[domain.DocumentType]MetadataExtractor
+	images         *imaging.Pipeline
+	ocr            *extraction.OCR
+	tika           *extraction.Tika
 }
 
+// thumbnailRendition is the rendition stored as a document's thumbnail.
+var thumbnailRendition = imaging.Rendition{Name: "thumbnail", Width: 200, Height: 200, Format: imaging.FormatJPEG, Quality: 85}
+
 // MetadataExtractor extracts metadata from document text
 type MetadataExtractor func(text string) domain.DocumentMetadata
 
 // NewDocumentProcessingService creates a new document processing service
-func NewDocumentProcessingService(storageService domain.StorageService) *DocumentProcessingService {
+// reading text with ocr and, for the formats it does not read, tika when
+// not nil. Thumbnails of images and PDFs are only made with a
+// storageService to store them in.
+func NewDocumentProcessingService(storageService domain.StorageService, ocr *extraction.OCR, tika *extraction.Tika) *DocumentProcessingService {
 	service := &DocumentProcessingService{
 		storageService: storageService,
 		extractors:     make(map[domain.DocumentType]MetadataExtractor),
+		images:         imaging.NewPipeline(),
+		ocr:            ocr,
+		tika:           tika,
 	}
 
 	// Register extractors
@@ -40,72 +51,73 @@ func NewDocumentProcessingService(storageService domain.StorageService) *Documen
 	return service
 }
 
-// ProcessDocument processes a document: extracts text, metadata, and generates thumbnail
+// ProcessDocument processes a document: extracts text, metadata, and
+// generates thumbnail. It returns a copy of doc, completed, with the key
+// of its thumbnail, or none when its type has none. A document whose text
+// cannot be read is returned failed, with the reason in ProcessingError,
+// and still gets its thumbnail; one of a format nothing reads text from
+// is completed without text.
 func (s *DocumentProcessingService) ProcessDocument(ctx context.Context, doc *domain.Document, data []byte) (*domain.Document, error) {
-	processedDoc := &domain.Document{
-		ID:               doc.ID,
-		TenantID:         doc.TenantID,
-		Type:             doc.Type,
-		FileName:         doc.FileName,
-		MimeType:         doc.MimeType,
-		Size:             doc.Size,
-		Checksum:         doc.Checksum,
-		Bucket:           doc.Bucket,
-		ObjectKey:        doc.ObjectKey,
-		VersionID:        doc.VersionID,
-		ProcessingStatus: doc.ProcessingStatus,
-		Tags:             doc.Tags,
-		UploadedBy:       doc.UploadedBy,
-		CreatedAt:        doc.CreatedAt,
-		UpdatedAt:        time.Now().UTC(),
+	processedDoc := *doc
+	processedDoc.UpdatedAt = time.Now().UTC()
+	processedDoc.ProcessingError = ""
+
+	// Generate thumbnail for images and the first page of PDFs, whether
+	// or not their text is read. A document whose thumbnail fails is
+	// still processed, without one.
+	processedDoc.ThumbnailKey = ""
+	if s.storageService != nil && hasThumbnail(doc.MimeType) {
+		thumbnail, err := s.GenerateThumbnail(ctx, data, doc.MimeType)
+		if err == nil {
+			thumbnailKey := thumbnailObjectKey(doc)
+			err = s.storageService.Upload(ctx, doc.Bucket, thumbnailKey, thumbnail, thumbnailRendition.Format.ContentType())
+			if err == nil {
+				processedDoc.ThumbnailKey = thumbnailKey
+			}
+		}
 	}
 
-	// Extract text based on document type
+	// Extract text based on document type. A host without the OCR tools
+	// still processes scans and PDFs, without text.
 	text, err := s.ExtractText(ctx, data, doc.MimeType)
-	if err != nil {
-		return nil, fmt.Errorf("failed to extract text: %w", err)
+	switch {
+	case err == nil:
+	case errors.Is(err, extraction.ErrToolMissing), errors.Is(err, extraction.ErrUnsupportedFile):
+		text = ""
+	default:
+		processedDoc.ExtractedText = ""
+		processedDoc.ExtractedMetadata = domain.DocumentMetadata{}
+		processedDoc.ProcessingStatus = domain.ProcessingStatusFailed
+		processedDoc.ProcessingError = fmt.Sprintf("failed to extract text: %v", err)
+		return &processedDoc, nil
 	}
 	processedDoc.ExtractedText = text
 
 	// Extract metadata
 	processedDoc.ExtractedMetadata = s.ExtractMetadata(ctx, doc.Type, text)
 
-	// Generate thumbnail for images and PDFs
-	if isImage(doc.MimeType) || doc.MimeType == "application/pdf" {
-		thumbnail, err := s.GenerateThumbnail(ctx, data, doc.MimeType)
-		if err == nil && thumbnail != nil {
-			thumbnailKey := fmt.Sprintf("thumbnails/%s.jpg", doc.ID.String())
-			err = s.storageService.Upload(ctx, doc.Bucket+"-processed", thumbnailKey, thumbnail, "image/jpeg")
-			if err == nil {
-				processedDoc.ThumbnailKey = thumbnailKey
-			}
-		}
-	}
-
 	// Estimate page count
 	processedDoc.PageCount = estimatePageCount(data, doc.MimeType, text)
+	processedDoc.ProcessingStatus = domain.ProcessingStatusCompleted
 
-	return processedDoc, nil
+	return &processedDoc, nil
 }
 
-// ExtractText extracts text from document data
+// ExtractText extracts text from document data: PDFs, scans and photos
+// with OCR, DOCX files directly and other formats with Tika. Formats
+// nothing reads return extraction.ErrUnsupportedFile.
 func (s *DocumentProcessingService) ExtractText(ctx context.Context, data []byte, mimeType string) (string, error) {
 	switch {
-	case mimeType == "text/plain":
+	case strings.HasPrefix(mimeType, "text/"):
 		return string(data), nil
-	case mimeType == "application/pdf":
-		// In a real implementation, use a PDF library to extract text
-		// For now, return a placeholder
-		return extractTextFromPDF(data)
-	case isImage(mimeType):
-		// In a real implementation, use OCR (Tesseract, etc.)
-		// For now, return a placeholder
-		return performOCR(data, mimeType)
-	case mimeType == "application/msword" || mimeType == "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
-		// In a real implementation, use a DOCX library
-		return extractTextFromWord(data)
+	case mimeType == extraction.WordMimeType:
+		return extraction.WordText(data)
+	case mimeType == "application/pdf" || isImage(mimeType):
+		return s.ocr.Text(ctx, data, mimeType)
+	case s.tika != nil:
+		return s.tika.Text(ctx, data, mimeType)
 	default:
-		return "", fmt.Errorf("unsupported mime type for text extraction: %s", mimeType)
+		return "", fmt.Errorf("%w: %s", extraction.ErrUnsupportedFile, mimeType)
 	}
 }
 
@@ -120,40 +132,35 @@ func (s *DocumentProcessingService) ExtractMetadata(ctx context.Context, docType
 	return extractGenericMetadata(text)
 }
 
-// GenerateThumbnail creates a thumbnail image from document data
+// GenerateThumbnail creates a thumbnail image from document data, an
+// image or the first page of a PDF, with the same pipeline document-service
+// renders its renditions with.
 func (s *DocumentProcessingService) GenerateThumbnail(ctx context.Context, data []byte, mimeType string) ([]byte, error) {
-	if !isImage(mimeType) {
-		return nil, fmt.Errorf("cannot generate thumbnail for non-image type: %s", mimeType)
+	if !hasThumbnail(mimeType) {
+		return nil, fmt.Errorf("cannot generate thumbnail for type: %s", mimeType)
 	}
 
-	// Decode image
-	var img image.Image
-	var err error
-
-	switch {
-	case mimeType == "image/jpeg":
-		img, err = jpeg.Decode(bytes.NewReader(data))
-	case mimeType == "image/png":
-		img, err = png.Decode(bytes.NewReader(data))
-	default:
-		return nil, fmt.Errorf("unsupported image format: %s", mimeType)
-	}
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+	if mimeType == "application/pdf" {
+		// Drawn at twice the thumbnail's width, so it is scaled down
+		// sharp.
+		page, err := s.images.FirstPage(ctx, data, 2*thumbnailRendition.Width)
+		if err != nil {
+			return nil, fmt.Errorf("failed to draw first page: %w", err)
+		}
+		data, mimeType = page, "image/png"
 	}
 
-	// Resize to thumbnail (max 200x200)
-	thumb := resizeImage(img, 200, 200)
-
-	// Encode to JPEG
-	var buf bytes.Buffer
-	err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	out, err := s.images.Render(ctx, data, mimeType, thumbnailRendition)
 	if err != nil {
-		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+		return nil, fmt.Errorf("failed to generate thumbnail: %w", err)
 	}
+	return out.Data, nil
+}
 
-	return buf.Bytes(), nil
+// thumbnailObjectKey returns the object key doc's thumbnail is stored under, in
+// the document's bucket. Each processing overwrites the last thumbnail.
+func thumbnailObjectKey(doc *domain.Document) string {
+	return fmt.Sprintf("%s/thumbnails/%s%s", doc.TenantID, doc.ID, thumbnailRendition.Format.Extension())
 }
 
 // Helper functions
@@ -162,27 +169,19 @@ func isImage(mimeType string) bool {
 	return strings.HasPrefix(mimeType, "image/")
 }
 
-func extractTextFromPDF(data []byte) (string, error) {
-	// Placeholder for PDF text extraction
-	// In production, use a library like pdfcpu or unidoc
-	return "PDF content placeholder", nil
-}
-
-func performOCR(data []byte, mimeType string) (string, error) {
-	// Placeholder for OCR
-	// In production, use Tesseract via a Go wrapper or call external service
-	return "OCR text placeholder", nil
-}
-
-func extractTextFromWord(data []byte) (string, error) {
-	// Placeholder for Word document text extraction
-	// In production, use a library like unioffice
-	return "Word document content placeholder", nil
+// hasThumbnail reports whether documents of mimeType get a thumbnail.
+func hasThumbnail(mimeType string) bool {
+	return imaging.Supported(mimeType) || mimeType == "application/pdf"
 }
 
 func estimatePageCount(data []byte, mimeType string, text string) int {
 	switch {
 	case mimeType == "application/pdf":
+		// pdftotext ends each page with a form feed; a scan read by
+		// Tesseract has none.
+		if pages := strings.Count(text, "\f"); pages > 0 {
+			return pages
+		}
 		// Rough estimate: average PDF page is ~50KB
 		return len(data)/(50*1024) + 1
 	case isImage(mimeType):
@@ -193,41 +192,6 @@ func estimatePageCount(data []byte, mimeType string, text string) int {
 	}
 }
 
-func resizeImage(img image.Image, maxWidth, maxHeight int) image.Image {
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-
-	// Calculate new dimensions while maintaining aspect ratio
-	if width > maxWidth || height > maxHeight {
-		scaleX := float64(maxWidth) / float64(width)
-		scaleY := float64(maxHeight) / float64(height)
-		scale := scaleX
-		if scaleY < scale {
-			scale = scaleY
-		}
-
-		newWidth := int(float64(width) * scale)
-		newHeight := int(float64(height) * scale)
-
-		// Create new image
-		newImg := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-
-		// Simple nearest-neighbor resize
-		for y := 0; y < newHeight; y++ {
-			for x := 0; x < newWidth; x++ {
-				srcX := int(float64(x) / scale)
-				srcY := int(float64(y) / scale)
-				newImg.Set(x, y, img.At(srcX+bounds.Min.X, srcY+bounds.Min.Y))
-			}
-		}
-
-		return newImg
-	}
-
-	return img
-}
-
 // Metadata extractors
 
 func extractInvoiceMetadata(text string) domain.DocumentMetadata {
@@ -0,0 +1,102 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/extraction"
+	apptest "github.com/ims-erp/system/internal/testing"
+)
+
+func pngImage(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 30; y++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// failingOCR runs commands that fail on every file.
+func failingOCR() *extraction.OCR {
+	return &extraction.OCR{Tesseract: "false", PDFToText: "false", Languages: "eng"}
+}
+
+// missingOCR runs commands that are not installed.
+func missingOCR() *extraction.OCR {
+	return &extraction.OCR{Tesseract: "/nonexistent/tesseract", PDFToText: "/nonexistent/pdftotext", Languages: "eng"}
+}
+
+func testDocument(mimeType string) *domain.Document {
+	return &domain.Document{
+		ID:               uuid.New(),
+		TenantID:         uuid.New(),
+		Type:             domain.DocTypeReceipt,
+		MimeType:         mimeType,
+		Bucket:           "documents",
+		ProcessingStatus: domain.ProcessingStatusProcessing,
+	}
+}
+
+func TestProcessDocument_MissingOCRToolExtractsNoText(t *testing.T) {
+	storage := apptest.NewStorage()
+	service := NewDocumentProcessingService(storage, missingOCR(), nil)
+	doc := testDocument("image/png")
+
+	processed, err := service.ProcessDocument(context.Background(), doc, pngImage(t))
+	require.NoError(t, err)
+	assert.Equal(t, domain.ProcessingStatusCompleted, processed.ProcessingStatus)
+	assert.Empty(t, processed.ExtractedText)
+	assert.Equal(t, thumbnailObjectKey(doc), processed.ThumbnailKey)
+	assert.NotEmpty(t, storage.Object("documents", processed.ThumbnailKey))
+}
+
+func TestExtractText_MissingOCRTool(t *testing.T) {
+	service := NewDocumentProcessingService(nil, missingOCR(), nil)
+
+	for _, mimeType := range []string{"image/png", "application/pdf"} {
+		_, err := service.ExtractText(context.Background(), []byte("data"), mimeType)
+		assert.ErrorIs(t, err, extraction.ErrToolMissing, mimeType)
+	}
+}
+
+func TestProcessDocument_ExtractionFailureKeepsThumbnail(t *testing.T) {
+	storage := apptest.NewStorage()
+	service := NewDocumentProcessingService(storage, failingOCR(), nil)
+	doc := testDocument("image/png")
+	doc.ExtractedText = "stale"
+
+	processed, err := service.ProcessDocument(context.Background(), doc, pngImage(t))
+	require.NoError(t, err)
+	assert.Equal(t, domain.ProcessingStatusFailed, processed.ProcessingStatus)
+	assert.Contains(t, processed.ProcessingError, "failed to extract text")
+	assert.Empty(t, processed.ExtractedText)
+	assert.Equal(t, thumbnailObjectKey(doc), processed.ThumbnailKey)
+	assert.NotEmpty(t, storage.Object("documents", processed.ThumbnailKey))
+}
+
+func TestProcessDocument_ClearsThumbnailKey(t *testing.T) {
+	service := NewDocumentProcessingService(apptest.NewStorage(), missingOCR(), nil)
+	doc := testDocument("application/zip")
+	doc.ThumbnailKey = thumbnailObjectKey(doc)
+	doc.ProcessingError = "failed to extract text: earlier version"
+
+	processed, err := service.ProcessDocument(context.Background(), doc, []byte("PK"))
+	require.NoError(t, err)
+	assert.Equal(t, domain.ProcessingStatusCompleted, processed.ProcessingStatus)
+	assert.Empty(t, processed.ThumbnailKey)
+	assert.Empty(t, processed.ProcessingError)
+	assert.Equal(t, thumbnailObjectKey(doc), doc.ThumbnailKey, "the document passed in is left unchanged")
+}
@@ -5,11 +5,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/ims-erp/system/internal/domain"
 )
 
 // MinIOStorageService implements domain.StorageService using MinIO
@@ -61,6 +64,20 @@ func (s *MinIOStorageService) Upload(ctx context.Context, bucket, objectKey stri
 	return nil
 }
 
+// UploadFile uploads the file at path to MinIO storage without reading it
+// into memory
+func (s *MinIOStorageService) UploadFile(ctx context.Context, bucket, objectKey, path, contentType string) error {
+	_, err := s.client.FPutObject(ctx, bucket, objectKey, path, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return nil
+}
+
 // Download retrieves data from MinIO storage
 func (s *MinIOStorageService) Download(ctx context.Context, bucket, objectKey string) ([]byte, error) {
 	object, err := s.client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
@@ -77,6 +94,23 @@ func (s *MinIOStorageService) Download(ctx context.Context, bucket, objectKey st
 	return data, nil
 }
 
+// DownloadStream opens an object in MinIO storage for reading. The
+// returned object also seeks, reading from the offset it seeks to.
+func (s *MinIOStorageService) DownloadStream(ctx context.Context, bucket, objectKey string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	// GetObject is lazy: stat the object so a missing one fails here
+	// rather than on the first read.
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	return object, nil
+}
+
 // Delete removes an object from MinIO storage
 func (s *MinIOStorageService) Delete(ctx context.Context, bucket, objectKey string) error {
 	err := s.client.RemoveObject(ctx, bucket, objectKey, minio.RemoveObjectOptions{})
@@ -87,14 +121,19 @@ func (s *MinIOStorageService) Delete(ctx context.Context, bucket, objectKey stri
 	return nil
 }
 
-// GetPresignedUploadURL generates a presigned URL for uploading
-func (s *MinIOStorageService) GetPresignedUploadURL(ctx context.Context, bucket, objectKey string, contentType string, expiry time.Duration) (string, error) {
+// GetPresignedUploadURL generates a presigned URL for uploading, signed for
+// the content type and size
+func (s *MinIOStorageService) GetPresignedUploadURL(ctx context.Context, bucket, objectKey string, contentType string, size int64, expiry time.Duration) (string, error) {
 	// Set default expiry
 	if expiry <= 0 {
 		expiry = 15 * time.Minute
 	}
 
-	presignedURL, err := s.client.PresignedPutObject(ctx, bucket, objectKey, expiry)
+	headers := make(http.Header)
+	for name, value := range domain.UploadHeaders(contentType, size) {
+		headers.Set(name, value)
+	}
+	presignedURL, err := s.client.PresignHeader(ctx, http.MethodPut, bucket, objectKey, expiry, nil, headers)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned upload URL: %w", err)
 	}
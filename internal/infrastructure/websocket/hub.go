@@ -9,6 +9,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/middleware"
 )
 
 // Hub manages WebSocket connections and broadcasts messages
@@ -106,8 +107,8 @@ func (h *Hub) ServeWs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract tenant ID from request context or headers
-	tenantID := r.Header.Get("X-Tenant-ID")
+	// Tenant ID is set by the tenant middleware
+	tenantID := middleware.GetTenantID(r.Context())
 	if tenantID == "" {
 		tenantID = "default"
 	}
@@ -0,0 +1,244 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// findReadModel returns the read model with id in store decoded as T.
+func findReadModel[T any](t *testing.T, store *repository.ReadModelStore, tenantID, id string) T {
+	t.Helper()
+	result, err := store.FindOne(context.Background(), map[string]interface{}{"_id": id, "tenantId": tenantID})
+	require.NoError(t, err)
+	require.NotNil(t, result, "read model %s not found", id)
+	data, err := bson.Marshal(result)
+	require.NoError(t, err)
+	var model T
+	require.NoError(t, bson.Unmarshal(data, &model))
+	return model
+}
+
+func TestInvoiceEventProjection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	mongodb, _, _, _, cache, log, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	store := repository.NewReadModelStore(mongodb, "invoice_read", log)
+	clients := repository.NewReadModelStore(mongodb, "client_read", log)
+	eventHandler := events.NewInvoiceEventHandler(store, clients, cache, log)
+
+	ctx := context.Background()
+	tenantID := "test-tenant-" + uuid.NewString()
+	clientID := uuid.NewString()
+	invoiceID := uuid.NewString()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	require.NoError(t, clients.Save(ctx, events.ClientSummary{ID: clientID, TenantID: tenantID, Name: "Northwind Traders"}))
+
+	event := func(eventType string, version int64, data map[string]interface{}) *events.EventEnvelope {
+		return &events.EventEnvelope{
+			ID:            uuid.NewString(),
+			Type:          eventType,
+			AggregateID:   invoiceID,
+			AggregateType: "invoice",
+			TenantID:      tenantID,
+			UserID:        "user-1",
+			Version:       version,
+			Data:          data,
+			Timestamp:     now,
+		}
+	}
+
+	created := event("invoice.created", 1, map[string]interface{}{
+		"invoiceNumber": "INV-2026-000001",
+		"clientId":      clientID,
+		"type":          "standard",
+		"status":        "draft",
+		"currency":      "EUR",
+		"subtotal":      "0",
+		"taxTotal":      "0",
+		"total":         "0",
+		"paymentTerm":   "net_30",
+		"dueDate":       now.AddDate(0, 0, 30),
+	})
+	require.NoError(t, eventHandler.HandleInvoiceCreated(ctx, created))
+	require.NoError(t, eventHandler.HandleInvoiceCreated(ctx, created), "a redelivered creation is ignored")
+
+	invoice := findReadModel[events.InvoiceDetail](t, store, tenantID, invoiceID)
+	assert.Equal(t, "INV-2026-000001", invoice.InvoiceNumber)
+	assert.Equal(t, "Northwind Traders", invoice.ClientName, "the client name is denormalized from the client read model")
+	assert.Equal(t, "draft", invoice.Status)
+	assert.Empty(t, invoice.Lines)
+
+	require.NoError(t, eventHandler.HandleLineItemAdded(ctx, event("invoice.line_added", 2, map[string]interface{}{
+		"lineId":      uuid.NewString(),
+		"description": "Consulting",
+		"quantity":    "10",
+		"unitPrice":   "100",
+		"taxRate":     "20",
+		"taxAmount":   "200",
+		"lineTotal":   "1200",
+		"subtotal":    "1000",
+		"taxTotal":    "200",
+		"total":       "1200",
+	})))
+
+	invoice = findReadModel[events.InvoiceDetail](t, store, tenantID, invoiceID)
+	require.Len(t, invoice.Lines, 1)
+	assert.Equal(t, 1, invoice.LineCount)
+	assert.Equal(t, "1200", invoice.Lines[0].Total)
+	assert.Equal(t, "1200", invoice.Total)
+	assert.Equal(t, "1200", invoice.AmountDue)
+	assert.Equal(t, int64(2), invoice.Version)
+
+	detailKey := "invoice:detail:" + invoiceID
+	listKey := "invoice:list:" + tenantID + ":page=1"
+	require.NoError(t, cache.Set(ctx, detailKey, invoice, time.Minute))
+	require.NoError(t, cache.Set(ctx, listKey, []events.InvoiceDetail{invoice}, time.Minute))
+
+	require.NoError(t, eventHandler.HandlePaymentRecorded(ctx, event("invoice.payment_recorded", 3, map[string]interface{}{
+		"amount":     "1200",
+		"amountPaid": "1200",
+		"amountDue":  "0",
+		"status":     "paid",
+	})))
+	require.NoError(t, eventHandler.HandleInvoiceCreated(ctx, event("invoice.created", 1, created.Data)))
+
+	invoice = findReadModel[events.InvoiceDetail](t, store, tenantID, invoiceID)
+	assert.Equal(t, "paid", invoice.Status)
+	assert.Equal(t, "1200", invoice.AmountPaid)
+	assert.Equal(t, "0", invoice.AmountDue)
+	assert.False(t, invoice.PaidDate.IsZero())
+	assert.Equal(t, int64(3), invoice.Version, "an older event does not take the version back")
+	for _, key := range []string{detailKey, listKey} {
+		cached, err := cache.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, cached, "%s is evicted when the invoice changes", key)
+	}
+
+	require.NoError(t, eventHandler.HandleClientUpdated(ctx, &events.EventEnvelope{
+		ID:            uuid.NewString(),
+		Type:          "ClientUpdated",
+		AggregateID:   clientID,
+		AggregateType: "Client",
+		TenantID:      tenantID,
+		Data:          map[string]interface{}{"name": "Northwind Ltd"},
+		Timestamp:     now,
+	}))
+
+	invoice = findReadModel[events.InvoiceDetail](t, store, tenantID, invoiceID)
+	assert.Equal(t, "Northwind Ltd", invoice.ClientName, "renamed clients are renamed on their invoices")
+}
+
+func TestPaymentEventProjection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	mongodb, _, _, _, cache, log, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	store := repository.NewReadModelStore(mongodb, "payment_read_models", log)
+	invoices := repository.NewReadModelStore(mongodb, "invoice_read", log)
+	clients := repository.NewReadModelStore(mongodb, "client_read", log)
+	eventHandler := events.NewPaymentEventHandler(store, invoices, clients, cache, log)
+
+	ctx := context.Background()
+	tenantID := "test-tenant-" + uuid.NewString()
+	clientID := uuid.NewString()
+	invoiceID := uuid.NewString()
+	paymentID := uuid.NewString()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	require.NoError(t, clients.Save(ctx, events.ClientSummary{ID: clientID, TenantID: tenantID, Name: "Northwind Traders"}))
+	require.NoError(t, invoices.Save(ctx, events.InvoiceSummary{ID: invoiceID, TenantID: tenantID, ClientID: clientID, InvoiceNumber: "INV-2026-000007"}))
+
+	event := func(eventType string, data map[string]interface{}) *events.EventEnvelope {
+		return &events.EventEnvelope{
+			ID:            uuid.NewString(),
+			Type:          eventType,
+			AggregateID:   paymentID,
+			AggregateType: "payment",
+			TenantID:      tenantID,
+			UserID:        "user-1",
+			Data:          data,
+			Timestamp:     now,
+		}
+	}
+
+	created := event("payment.created", map[string]interface{}{
+		"invoiceId": invoiceID,
+		"clientId":  clientID,
+		"amount":    "150.00",
+		"currency":  "EUR",
+		"method":    "credit_card",
+		"provider":  "stripe",
+	})
+	require.NoError(t, eventHandler.HandlePaymentCreated(ctx, created))
+	require.NoError(t, eventHandler.HandlePaymentCreated(ctx, created), "a redelivered creation is ignored")
+
+	payment := findReadModel[events.PaymentDetail](t, store, tenantID, paymentID)
+	assert.Equal(t, "pending", payment.Status)
+	assert.Equal(t, "INV-2026-000007", payment.InvoiceNumber, "the invoice number is denormalized from the invoice read model")
+	assert.Equal(t, "Northwind Traders", payment.ClientName)
+	assert.Equal(t, "150.00", payment.Amount)
+
+	require.NoError(t, eventHandler.HandlePaymentProcessed(ctx, event("payment.processed", map[string]interface{}{
+		"transactionId": "txn_1",
+		"amountApplied": "100.00",
+		"applications": []interface{}{map[string]interface{}{
+			"id": "app-1", "paymentId": paymentID, "invoiceId": invoiceID, "invoiceNumber": "INV-2026-000007", "amount": "100.00",
+		}},
+		"settlement": map[string]interface{}{"currency": "EUR", "gross": "150.00", "fee": "2.40", "net": "147.60"},
+	})))
+
+	payment = findReadModel[events.PaymentDetail](t, store, tenantID, paymentID)
+	assert.Equal(t, "completed", payment.Status)
+	assert.Equal(t, "txn_1", payment.TransactionID)
+	assert.Equal(t, "100.00", payment.AmountApplied)
+	require.Len(t, payment.Applications, 1)
+	require.NotNil(t, payment.Settlement)
+	assert.Equal(t, "147.60", payment.Settlement.Net)
+	assert.NotNil(t, payment.ProcessedAt)
+
+	require.NoError(t, eventHandler.HandlePaymentApplication(ctx, event("payment.unapplied", map[string]interface{}{
+		"amount":        "100.00",
+		"invoiceNumber": "INV-2026-000007",
+		"reason":        "wrong invoice",
+		"amountApplied": "0",
+		"applications": []interface{}{map[string]interface{}{
+			"id": "app-1", "invoiceId": invoiceID, "amount": "100.00", "unappliedAt": now.Format(time.RFC3339),
+		}},
+	})))
+
+	payment = findReadModel[events.PaymentDetail](t, store, tenantID, paymentID)
+	assert.Equal(t, "0", payment.AmountApplied)
+	require.Len(t, payment.Applications, 1)
+	assert.NotNil(t, payment.Applications[0].UnappliedAt)
+	assert.Equal(t, "unapplied", payment.ActivityLog[len(payment.ActivityLog)-1].Action)
+
+	require.NoError(t, eventHandler.HandleClientOwnerAssigned(ctx, &events.EventEnvelope{
+		ID:            uuid.NewString(),
+		Type:          "ClientOwnerAssigned",
+		AggregateID:   clientID,
+		AggregateType: "Client",
+		TenantID:      tenantID,
+		Data:          map[string]interface{}{"ownerId": "rep-1", "territory": "north"},
+		Timestamp:     now,
+	}))
+
+	payment = findReadModel[events.PaymentDetail](t, store, tenantID, paymentID)
+	assert.Equal(t, "rep-1", payment.OwnerID, "payments follow their client's owner")
+	assert.Equal(t, "north", payment.Territory)
+}
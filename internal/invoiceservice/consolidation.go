@@ -0,0 +1,134 @@
+package invoiceservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const consolidatedBillingPath = "/api/v1/consolidated-billing"
+
+// handleConsolidatedBilling lists the clients the tenant bills on
+// consolidated invoices, or sets how one is billed.
+func (s *InvoiceService) handleConsolidatedBilling(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listConsolidatedBilling(w, r)
+	case http.MethodPut:
+		s.setConsolidatedBilling(w, r)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) listConsolidatedBilling(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	limit := parseInt(r.URL.Query().Get("limit"), 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	billing, err := s.consolidatedBilling.List(r.Context(), tenantID, int64(limit))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"billing": billing})
+}
+
+// setConsolidatedBilling bills a client's delivered orders on one invoice
+// per week or month from the next closed period on.
+func (s *InvoiceService) setConsolidatedBilling(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenantID, err := uuid.Parse(middleware.GetTenantID(ctx))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	userID, _ := uuid.Parse(middleware.GetUserID(ctx))
+
+	var req struct {
+		ClientID    string `json:"clientId"`
+		Frequency   string `json:"frequency"`
+		PaymentTerm string `json:"paymentTerm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid clientId")
+		return
+	}
+	client, err := s.clients.FindOne(ctx, repository.NotDeleted(bson.M{"_id": clientID.String(), "tenantId": tenantID.String()}))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if client == nil {
+		s.writeError(w, r, errors.NotFound("client not found"))
+		return
+	}
+
+	billing, err := domain.NewConsolidatedBilling(tenantID, clientID, domain.BillingFrequency(req.Frequency), domain.PaymentTerm(req.PaymentTerm), userID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	saved, err := s.consolidatedBilling.Save(ctx, billing)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.logger.Info("Consolidated billing set",
+		"tenant_id", tenantID,
+		"client_id", clientID,
+		"frequency", billing.Frequency,
+	)
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"billing": saved})
+}
+
+// handleConsolidatedBillingByClient serves DELETE
+// /api/v1/consolidated-billing/{clientId}: the client's orders are no
+// longer consolidated. Invoices already issued stay.
+func (s *InvoiceService) handleConsolidatedBillingByClient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	clientID, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, consolidatedBillingPath+"/"))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+
+	deleted, err := s.consolidatedBilling.Delete(r.Context(), tenantID, clientID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if !deleted {
+		s.writeError(w, r, errors.NotFound("client is not billed on consolidated invoices"))
+		return
+	}
+	s.logger.Info("Consolidated billing removed", "tenant_id", tenantID, "client_id", clientID)
+	w.WriteHeader(http.StatusNoContent)
+}
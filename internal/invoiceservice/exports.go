@@ -0,0 +1,39 @@
+package invoiceservice
+
+import "github.com/ims-erp/system/internal/export"
+
+// invoiceExport exports the invoice read model for
+// POST /api/v1/invoices/exports.
+var invoiceExport = export.Source{
+	Name:       "invoices",
+	Collection: "invoice_read",
+	Columns: []export.Column{
+		{Header: "Invoice ID", Field: "_id"},
+		{Header: "Invoice Number", Field: "invoiceNumber"},
+		{Header: "Type", Field: "type"},
+		{Header: "Status", Field: "status"},
+		{Header: "Client", Field: "clientName"},
+		{Header: "Client ID", Field: "clientId"},
+		{Header: "Currency", Field: "currency"},
+		{Header: "Subtotal", Field: "subtotal", Number: true},
+		{Header: "Tax", Field: "taxTotal", Number: true},
+		{Header: "Discount", Field: "discountTotal", Number: true},
+		{Header: "Total", Field: "total", Number: true},
+		{Header: "Amount Paid", Field: "amountPaid", Number: true},
+		{Header: "Amount Due", Field: "amountDue", Number: true},
+		{Header: "Payment Term", Field: "paymentTerm"},
+		{Header: "Issue Date", Field: "issueDate"},
+		{Header: "Due Date", Field: "dueDate"},
+		{Header: "Sent Date", Field: "sentDate"},
+		{Header: "Paid Date", Field: "paidDate"},
+	},
+	Filters: map[string]string{
+		"clientId": "clientId",
+		"status":   "status",
+		"type":     "type",
+		"currency": "currency",
+	},
+	DateField: "issueDate",
+	Sort:      "issueDate",
+	Owned:     true,
+}
@@ -0,0 +1,213 @@
+package invoiceservice
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/fx"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/shopspring/decimal"
+)
+
+const fxOverridesPath = "/api/v1/fx/overrides"
+
+// maxRateHistory is the longest range of rate history served at once.
+const maxRateHistory = 366 * 24 * time.Hour
+
+// handleFXRate serves GET /api/v1/fx/rates: the rate of ?from in ?to on
+// ?date=YYYY-MM-DD, today by default, as the tenant converts at it.
+func (s *InvoiceService) handleFXRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	params := r.URL.Query()
+	if params.Get("from") == "" || params.Get("to") == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "from and to currencies are required")
+		return
+	}
+	at := time.Now().UTC()
+	if date := params.Get("date"); date != "" {
+		if at, err = time.Parse("2006-01-02", date); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "date must be YYYY-MM-DD")
+			return
+		}
+	}
+
+	rate, err := s.fx.Rate(r.Context(), tenantID, params.Get("from"), params.Get("to"), at)
+	if stderrors.Is(err, fx.ErrNoRate) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "No exchange rate for the date")
+		return
+	}
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, rate)
+}
+
+// handleFXRateHistory serves GET /api/v1/fx/rates/history: the synced
+// rates of ?base in ?quote dated from ?from to ?to, the last 30 days by
+// default.
+func (s *InvoiceService) handleFXRateHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	params := r.URL.Query()
+	base, quote := strings.ToUpper(params.Get("base")), strings.ToUpper(params.Get("quote"))
+	if base == "" || quote == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "base and quote currencies are required")
+		return
+	}
+	to := domain.RateDay(time.Now().UTC())
+	from := to.AddDate(0, 0, -30)
+	var err error
+	if value := params.Get("from"); value != "" {
+		if from, err = time.Parse("2006-01-02", value); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "from must be YYYY-MM-DD")
+			return
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if to, err = time.Parse("2006-01-02", value); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "to must be YYYY-MM-DD")
+			return
+		}
+	}
+	if to.Before(from) || to.Sub(from) > maxRateHistory {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "History covers up to a year, from before to")
+		return
+	}
+
+	rates, err := s.exchangeRates.History(r.Context(), nil, base, quote, from, to)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"rates": rates})
+}
+
+// handleFXOverrides lists the tenant's rate overrides, or sets one.
+func (s *InvoiceService) handleFXOverrides(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listFXOverrides(w, r)
+	case http.MethodPut:
+		s.setFXOverride(w, r)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) listFXOverrides(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	limit := parseInt(r.URL.Query().Get("limit"), 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	overrides, err := s.exchangeRates.Overrides(r.Context(), tenantID, int64(limit))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"overrides": overrides})
+}
+
+// setFXOverride sets the tenant's rate of a pair from a day on, replacing
+// the override of that day if there is one.
+func (s *InvoiceService) setFXOverride(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenantID, err := uuid.Parse(middleware.GetTenantID(ctx))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	userID, _ := uuid.Parse(middleware.GetUserID(ctx))
+
+	var req struct {
+		Base  string          `json:"base"`
+		Quote string          `json:"quote"`
+		Date  string          `json:"date"`
+		Rate  decimal.Decimal `json:"rate"`
+		Note  string          `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "date must be YYYY-MM-DD")
+		return
+	}
+
+	override, err := domain.NewExchangeRateOverride(tenantID, req.Base, req.Quote, req.Rate, date, userID, req.Note)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.exchangeRates.Save(ctx, override); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	// Read it back: replacing an override keeps the ID it was created with.
+	saved, err := s.exchangeRates.Latest(ctx, &tenantID, override.Base, override.Quote, override.Date, override.Date)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.logger.Info("Exchange rate override set",
+		"tenant_id", tenantID,
+		"pair", override.Base+"/"+override.Quote,
+		"date", req.Date,
+		"rate", override.Rate.String(),
+	)
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"override": saved})
+}
+
+// handleFXOverrideByID serves DELETE /api/v1/fx/overrides/{id}. The
+// synced rate applies again, or the pair's earlier override.
+func (s *InvoiceService) handleFXOverrideByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	id, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, fxOverridesPath+"/"))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid override ID")
+		return
+	}
+
+	deleted, err := s.exchangeRates.DeleteOverride(r.Context(), tenantID, id)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if !deleted {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Exchange rate override not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
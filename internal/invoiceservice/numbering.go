@@ -0,0 +1,121 @@
+package invoiceservice
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/numbering"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// numberingAuditColumns are the columns of the CSV form of a numbering
+// audit, one row per finding.
+var numberingAuditColumns = []string{
+	"Document Type", "Year", "Finding", "Number", "To Number", "Count", "Document ID", "Kind", "User", "Reason", "Date",
+}
+
+// handleNumberingAuditReport serves GET /api/v1/invoices/report/numbering:
+// the gaps in the tenant's invoice numbers of ?year=, or of every year,
+// with the voided, duplicated and irregular numbers, as JSON or, with
+// ?format=csv or Accept: text/csv, as CSV.
+func (s *InvoiceService) handleNumberingAuditReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	params := r.URL.Query()
+	year := 0
+	if value := params.Get("year"); value != "" {
+		var err error
+		if year, err = strconv.Atoi(value); err != nil || year < 1 {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "year must be a year such as 2026")
+			return
+		}
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	audit, err := s.queryHandler.GetNumberingAudit(r.Context(), &queries.GetNumberingAuditQuery{TenantID: tenantID, Year: year})
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	format := params.Get("format")
+	switch {
+	case format == "csv" || (format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv")):
+		filename := "invoice-numbering"
+		if year != 0 {
+			filename = fmt.Sprintf("invoice-numbering-%d", year)
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		out := csv.NewWriter(w)
+		out.Write(numberingAuditColumns)
+		for _, row := range numberingAuditRows(audit) {
+			out.Write(row)
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			s.logger.Error("Failed to write numbering audit", "error", err, "tenant_id", tenantID)
+		}
+	case format == "" || format == "json":
+		s.writeJSON(w, http.StatusOK, audit)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "format must be json or csv")
+	}
+}
+
+// numberingAuditRows returns the findings of audit as rows of
+// numberingAuditColumns: gaps, then voided and duplicated numbers, by
+// sequence, then irregular numbers.
+func numberingAuditRows(audit *queries.NumberingAudit) [][]string {
+	var rows [][]string
+	issuedRow := func(sequence numbering.SequenceAudit, finding string, number numbering.Issued) []string {
+		row := []string{
+			sequence.DocumentType, auditYear(sequence.Year), finding, number.Number, "", "1",
+			number.DocumentID, number.Kind, "", "", formatAuditDate(number.IssuedAt),
+		}
+		if number.Voided != nil {
+			row[8], row[9], row[10] = number.Voided.UserID, number.Voided.Reason, formatAuditDate(number.Voided.At)
+		}
+		return row
+	}
+	for _, sequence := range audit.Sequences {
+		for _, gap := range sequence.Gaps {
+			rows = append(rows, []string{
+				sequence.DocumentType, auditYear(sequence.Year), "gap", gap.FromNumber, gap.ToNumber,
+				strconv.FormatInt(gap.Count, 10), "", "", "", "", "",
+			})
+		}
+		for _, number := range sequence.Voided {
+			rows = append(rows, issuedRow(sequence, "voided", number))
+		}
+		for _, number := range sequence.Duplicates {
+			rows = append(rows, issuedRow(sequence, "duplicate", number))
+		}
+	}
+	for _, number := range audit.Irregular {
+		rows = append(rows, issuedRow(numbering.SequenceAudit{DocumentType: number.Key.DocumentType}, "irregular", number))
+	}
+	return rows
+}
+
+func auditYear(year int) string {
+	if year == 0 {
+		return ""
+	}
+	return strconv.Itoa(year)
+}
+
+func formatAuditDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,274 @@
+package invoiceservice
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/i18n"
+	"github.com/ims-erp/system/pkg/pdf"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// generatePDF renders the invoice document in the locale asked for with
+// ?locale=, else the client's locale, else the tenant's.
+func (s *InvoiceService) generatePDF(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+	tenantID := middleware.GetTenantID(ctx)
+
+	requested := r.URL.Query().Get("locale")
+	if requested != "" {
+		if _, ok := i18n.Normalize(requested); !ok {
+			s.writeError(w, r, errors.InvalidArgument("unsupported locale: %s", requested))
+			return
+		}
+	}
+
+	invoice, err := s.queryHandler.GetInvoiceDetail(ctx, &queries.GetInvoiceByIDQuery{
+		InvoiceID:  invoiceID,
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+	})
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if invoice == nil {
+		s.writeError(w, r, errors.NotFound("invoice not found"))
+		return
+	}
+
+	locale := i18n.Resolve(requested, s.clientLocale(r, invoice), s.config.I18n.LocaleFor(tenantID))
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Language", locale)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": invoice.InvoiceNumber + ".pdf"}))
+	w.WriteHeader(http.StatusOK)
+	if err := renderInvoicePDF(w, invoice, locale); err != nil {
+		s.logger.New(ctx).Warnw("Failed to write invoice PDF", "invoice_id", invoiceID, "error", err)
+	}
+}
+
+// clientLocale returns the locale of the invoice's client, or "" when the
+// client has none or cannot be read.
+func (s *InvoiceService) clientLocale(r *http.Request, invoice *events.InvoiceDetail) string {
+	if s.clients == nil || invoice.ClientID == "" {
+		return ""
+	}
+	result, err := s.clients.FindOne(r.Context(), bson.M{"_id": invoice.ClientID, "tenantId": invoice.TenantID})
+	if err != nil {
+		s.logger.New(r.Context()).Warnw("Failed to read client locale", "client_id", invoice.ClientID, "error", err)
+		return ""
+	}
+	client, _ := result.(bson.M)
+	locale, _ := client["locale"].(string)
+	return locale
+}
+
+// Layout of the invoice document, in points.
+const (
+	marginLeft   = 50.0
+	marginRight  = pdf.PageWidth - 50
+	marginTop    = pdf.PageHeight - 50
+	marginBottom = 60.0
+	lineHeight   = 16.0
+
+	columnQuantity  = 330.0
+	columnUnitPrice = 410.0
+	columnTax       = 470.0
+)
+
+// invoiceDocument lays out an invoice top to bottom, starting a new page
+// when the next row does not fit.
+type invoiceDocument struct {
+	doc     *pdf.Document
+	pages   []*pdf.Page
+	page    *pdf.Page
+	y       float64
+	locale  string
+	invoice *events.InvoiceDetail
+}
+
+func renderInvoicePDF(w io.Writer, invoice *events.InvoiceDetail, locale string) error {
+	d := &invoiceDocument{doc: pdf.New(), locale: locale, invoice: invoice}
+	d.newPage()
+	d.header()
+	d.lines()
+	d.totals()
+	d.remarks()
+	d.footers()
+	_, err := d.doc.WriteTo(w)
+	return err
+}
+
+func (d *invoiceDocument) t(text string) string {
+	return i18n.Translate(d.locale, text)
+}
+
+func (d *invoiceDocument) money(amount string) string {
+	value, err := decimal.NewFromString(amount)
+	if err != nil {
+		value = decimal.Zero
+	}
+	return i18n.FormatMoney(d.locale, value, d.invoice.Currency)
+}
+
+func (d *invoiceDocument) newPage() {
+	d.page = d.doc.AddPage()
+	d.pages = append(d.pages, d.page)
+	d.y = marginTop
+}
+
+// ensure starts a new page unless height fits above the bottom margin.
+func (d *invoiceDocument) ensure(height float64) bool {
+	if d.y-height >= marginBottom {
+		return false
+	}
+	d.newPage()
+	return true
+}
+
+func (d *invoiceDocument) header() {
+	title := "Invoice"
+	switch domain.InvoiceType(d.invoice.Type) {
+	case domain.InvoiceTypeCreditNote:
+		title = "Credit note"
+	case domain.InvoiceTypeDebitNote:
+		title = "Debit note"
+	}
+	d.page.Text(marginLeft, d.y-20, 20, true, d.t(title))
+	d.y -= 50
+
+	details := [][2]string{
+		{d.t("Invoice number"), d.invoice.InvoiceNumber},
+		{d.t("Issue date"), i18n.FormatDate(d.locale, d.invoice.IssueDate)},
+		{d.t("Due date"), i18n.FormatDate(d.locale, d.invoice.DueDate)},
+	}
+	for _, detail := range details {
+		if detail[1] == "" {
+			continue
+		}
+		d.page.Text(marginLeft, d.y, 10, true, detail[0])
+		d.page.Text(marginLeft+110, d.y, 10, false, detail[1])
+		d.y -= lineHeight
+	}
+
+	if d.invoice.ClientName != "" {
+		d.y -= lineHeight
+		d.page.Text(marginLeft, d.y, 10, true, d.t("Bill to"))
+		d.y -= lineHeight
+		d.page.Text(marginLeft, d.y, 10, false, d.invoice.ClientName)
+		d.y -= lineHeight
+	}
+	d.y -= lineHeight
+}
+
+func (d *invoiceDocument) tableHeader() {
+	d.page.Text(marginLeft, d.y, 10, true, d.t("Description"))
+	d.page.TextRight(columnQuantity, d.y, 10, true, d.t("Quantity"))
+	d.page.TextRight(columnUnitPrice, d.y, 10, true, d.t("Unit price"))
+	d.page.TextRight(columnTax, d.y, 10, true, d.t("Tax"))
+	d.page.TextRight(marginRight, d.y, 10, true, d.t("Amount"))
+	d.page.Line(marginLeft, d.y-5, marginRight, d.y-5)
+	d.y -= lineHeight + 4
+}
+
+func (d *invoiceDocument) lines() {
+	d.tableHeader()
+	for _, line := range d.invoice.Lines {
+		if d.ensure(lineHeight) {
+			d.tableHeader()
+		}
+		quantity, err := decimal.NewFromString(line.Quantity)
+		if err != nil {
+			quantity = decimal.Zero
+		}
+		d.page.Text(marginLeft, d.y, 10, false, pdf.Fit(line.Description, 10, columnQuantity-marginLeft-70))
+		d.page.TextRight(columnQuantity, d.y, 10, false, i18n.FormatNumber(d.locale, quantity, quantityPlaces(line.Quantity)))
+		d.page.TextRight(columnUnitPrice, d.y, 10, false, d.money(line.UnitPrice))
+		d.page.TextRight(columnTax, d.y, 10, false, d.money(line.TaxAmount))
+		d.page.TextRight(marginRight, d.y, 10, false, d.money(line.Total))
+		d.y -= lineHeight
+	}
+	d.page.Line(marginLeft, d.y+lineHeight-5, marginRight, d.y+lineHeight-5)
+	d.y -= lineHeight / 2
+}
+
+func (d *invoiceDocument) totals() {
+	type row struct {
+		label  string
+		amount string
+		bold   bool
+	}
+	rows := []row{{label: "Subtotal", amount: d.invoice.Subtotal}}
+	if !isZero(d.invoice.DiscountTotal) {
+		rows = append(rows, row{label: "Discount", amount: d.invoice.DiscountTotal})
+	}
+	rows = append(rows,
+		row{label: "Tax", amount: d.invoice.TaxTotal},
+		row{label: "Total", amount: d.invoice.Total, bold: true},
+	)
+	if !isZero(d.invoice.AmountPaid) {
+		rows = append(rows,
+			row{label: "Amount paid", amount: d.invoice.AmountPaid},
+			row{label: "Amount due", amount: d.invoice.AmountDue, bold: true},
+		)
+	}
+
+	d.ensure(float64(len(rows)) * lineHeight)
+	for _, r := range rows {
+		d.page.Text(columnUnitPrice-60, d.y, 10, r.bold, d.t(r.label))
+		d.page.TextRight(marginRight, d.y, 10, r.bold, d.money(r.amount))
+		d.y -= lineHeight
+	}
+}
+
+func (d *invoiceDocument) remarks() {
+	for _, remark := range [][2]string{{"Notes", d.invoice.Notes}, {"Terms", d.invoice.Terms}} {
+		if strings.TrimSpace(remark[1]) == "" {
+			continue
+		}
+		d.y -= lineHeight
+		d.ensure(2 * lineHeight)
+		d.page.Text(marginLeft, d.y, 10, true, d.t(remark[0]))
+		d.y -= lineHeight
+		for _, text := range strings.Split(remark[1], "\n") {
+			d.ensure(lineHeight)
+			d.page.Text(marginLeft, d.y, 10, false, pdf.Fit(text, 10, marginRight-marginLeft))
+			d.y -= lineHeight
+		}
+	}
+}
+
+// footers numbers the pages once the page count is known.
+func (d *invoiceDocument) footers() {
+	total := len(d.pages)
+	for i, page := range d.pages {
+		footer := d.t(fmt.Sprintf("Page %d of %d", i+1, total))
+		page.TextRight(marginRight, marginBottom-30, 8, false, footer)
+		page.Text(marginLeft, marginBottom-30, 8, false, d.invoice.InvoiceNumber)
+	}
+}
+
+// quantityPlaces returns the decimals quantity is written with, ignoring
+// trailing zeros: "2.500" has 1.
+func quantityPlaces(quantity string) int32 {
+	_, fraction, ok := strings.Cut(quantity, ".")
+	if !ok {
+		return 0
+	}
+	return int32(len(strings.TrimRight(fraction, "0")))
+}
+
+func isZero(amount string) bool {
+	value, err := decimal.NewFromString(amount)
+	return err != nil || value.IsZero()
+}
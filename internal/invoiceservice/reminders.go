@@ -0,0 +1,264 @@
+package invoiceservice
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const reminderSuppressionsPath = "/api/v1/reminder-suppressions"
+
+// handleInvoiceReminder serves /api/v1/invoices/{id}/reminder: GET previews
+// the payment reminder the invoice would get, POST sends it.
+func (s *InvoiceService) handleInvoiceReminder(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	switch r.Method {
+	case http.MethodGet:
+		s.previewReminder(w, r, invoiceID)
+	case http.MethodPost:
+		s.sendReminder(w, r, invoiceID)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// previewReminder renders the reminder notifications as they would be sent
+// now, with the suppression that would refuse them, if any. Nothing is
+// sent or recorded.
+func (s *InvoiceService) previewReminder(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+
+	cmd := commands.NewCommand("previewInvoiceReminder", middleware.GetTenantID(ctx), invoiceID, middleware.GetUserID(ctx), nil)
+	event, suppression, err := s.invoiceHandler.PreviewInvoiceReminder(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	notifications, err := s.notifier.Preview(ctx, event)
+	if err != nil {
+		s.writeError(w, r, errors.Wrap(err, errors.CodeInternalError, "failed to render reminder"))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"invoiceId":      invoiceID,
+		"reminderNumber": event.Data["reminderNumber"],
+		"daysOverdue":    event.Data["daysOverdue"],
+		"suppression":    suppression,
+		"notifications":  notifications,
+	})
+}
+
+func (s *InvoiceService) sendReminder(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+
+	cmd := commands.NewCommand("sendInvoiceReminder", middleware.GetTenantID(ctx), invoiceID, middleware.GetUserID(ctx), nil)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+
+	invoice, err := s.invoiceHandler.HandleSendInvoiceReminder(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusOK, invoice)
+}
+
+// handleReminderSuppressions lists the tenant's reminder suppressions, or
+// adds one.
+func (s *InvoiceService) handleReminderSuppressions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listReminderSuppressions(w, r)
+	case http.MethodPost:
+		s.suppressReminders(w, r)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// listReminderSuppressions lists suppressions, latest first, of ?clientId
+// or ?invoiceId, and only those in force with ?active=true.
+func (s *InvoiceService) listReminderSuppressions(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	params := r.URL.Query()
+	var clientID, invoiceID *uuid.UUID
+	for _, filter := range []struct {
+		name string
+		id   **uuid.UUID
+	}{{"clientId", &clientID}, {"invoiceId", &invoiceID}} {
+		value := params.Get(filter.name)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid "+filter.name)
+			return
+		}
+		*filter.id = &id
+	}
+	limit := parseInt(params.Get("limit"), 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	suppressions, err := s.reminderSuppressions.List(r.Context(), tenantID, clientID, invoiceID, params.Get("active") == "true", int64(limit))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"suppressions": suppressions})
+}
+
+// suppressReminders stops the reminders of an invoice, or of every invoice
+// of a client, for a reason.
+func (s *InvoiceService) suppressReminders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenantID, err := uuid.Parse(middleware.GetTenantID(ctx))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	userID, _ := uuid.Parse(middleware.GetUserID(ctx))
+
+	var req struct {
+		InvoiceID string `json:"invoiceId"`
+		ClientID  string `json:"clientId"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if (req.InvoiceID == "") == (req.ClientID == "") {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Either invoiceId or clientId is required")
+		return
+	}
+
+	var clientID uuid.UUID
+	var invoiceID *uuid.UUID
+	if req.InvoiceID != "" {
+		id, err := uuid.Parse(req.InvoiceID)
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid invoiceId")
+			return
+		}
+		invoice, err := s.invoiceRepo.FindByID(ctx, id)
+		if err != nil || invoice == nil || invoice.TenantID != tenantID {
+			s.writeError(w, r, errors.NotFound("invoice not found"))
+			return
+		}
+		clientID, invoiceID = invoice.ClientID, &id
+	} else {
+		if clientID, err = uuid.Parse(req.ClientID); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid clientId")
+			return
+		}
+		client, err := s.clients.FindOne(ctx, repository.NotDeleted(bson.M{"_id": clientID.String(), "tenantId": tenantID.String()}))
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		if client == nil {
+			s.writeError(w, r, errors.NotFound("client not found"))
+			return
+		}
+	}
+
+	suppression, err := domain.NewReminderSuppression(tenantID, clientID, invoiceID, req.Reason, userID)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.reminderSuppressions.Add(ctx, suppression); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.logger.Info("Payment reminders suppressed",
+		"tenant_id", tenantID,
+		"suppression_id", suppression.ID,
+		"client_id", clientID,
+		"invoice_id", req.InvoiceID,
+		"user_id", userID,
+		"reason", suppression.Reason,
+	)
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{"suppression": suppression})
+}
+
+// handleReminderSuppressionByID serves DELETE
+// /api/v1/reminder-suppressions/{id}, lifting the suppression for the
+// optional reason in the body. The suppression is kept, marked lifted.
+func (s *InvoiceService) handleReminderSuppressionByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	ctx := r.Context()
+	tenantID, err := uuid.Parse(middleware.GetTenantID(ctx))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	userID, _ := uuid.Parse(middleware.GetUserID(ctx))
+	id, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, reminderSuppressionsPath+"/"))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid suppression ID")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	suppression, err := s.reminderSuppressions.Get(ctx, tenantID, id)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if suppression == nil {
+		s.writeError(w, r, errors.NotFound("reminder suppression not found"))
+		return
+	}
+	if err := suppression.Lift(userID, req.Reason, time.Now().UTC()); err != nil {
+		s.writeError(w, r, errors.Conflict("%s", err.Error()))
+		return
+	}
+	lifted, err := s.reminderSuppressions.Lift(ctx, suppression)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if !lifted {
+		s.writeError(w, r, errors.Conflict("%s", domain.ErrSuppressionLifted.Error()))
+		return
+	}
+	s.logger.Info("Payment reminders resumed",
+		"tenant_id", tenantID,
+		"suppression_id", suppression.ID,
+		"client_id", suppression.ClientID,
+		"user_id", userID,
+		"reason", suppression.LiftReason,
+	)
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"suppression": suppression})
+}
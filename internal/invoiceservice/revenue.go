@@ -0,0 +1,193 @@
+package invoiceservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+const revenueSchedulesPath = "/api/v1/invoices/revenue-schedules/"
+
+// handleInvoiceRevenueSchedules lists the revenue schedules of an invoice's
+// lines, or schedules the revenue of one of them.
+func (s *InvoiceService) handleInvoiceRevenueSchedules(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listRevenueSchedules(w, r, invoiceID)
+	case http.MethodPost:
+		s.createRevenueSchedule(w, r, invoiceID)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleRevenueScheduleByID returns a schedule, or completes one of its
+// milestones at {id}/milestones/{entryId}/complete.
+func (s *InvoiceService) handleRevenueScheduleByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, revenueSchedulesPath), "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		s.getRevenueSchedule(w, r, parts[0])
+	case len(parts) == 4 && parts[1] == "milestones" && parts[3] == "complete":
+		if r.Method != http.MethodPost {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		s.completeMilestone(w, r, parts[0], parts[2])
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *InvoiceService) listRevenueSchedules(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	invoiceID, err := uuid.Parse(id)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+
+	schedules, err := s.revenueSchedules.FindByInvoice(r.Context(), tenantID, invoiceID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"schedules": schedules})
+}
+
+// createRevenueSchedule schedules the revenue of the invoice line in
+// lineId, straight-line over months from startPeriod or by milestones.
+func (s *InvoiceService) createRevenueSchedule(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	var req struct {
+		LineID      string `json:"lineId"`
+		Method      string `json:"method"`
+		StartPeriod string `json:"startPeriod"`
+		Months      int    `json:"months"`
+		Milestones  []struct {
+			Name        string      `json:"name"`
+			Amount      json.Number `json:"amount"`
+			AmountMinor json.Number `json:"amountMinor"`
+		} `json:"milestones"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.LineID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "lineId is required")
+		return
+	}
+
+	milestones := make([]interface{}, 0, len(req.Milestones))
+	for _, milestone := range req.Milestones {
+		data := map[string]interface{}{"name": milestone.Name}
+		if milestone.Amount != "" {
+			data["amount"] = milestone.Amount.String()
+		}
+		if milestone.AmountMinor != "" {
+			data["amountMinor"] = milestone.AmountMinor.String()
+		}
+		milestones = append(milestones, data)
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("createRevenueSchedule", middleware.GetTenantID(ctx), invoiceID, middleware.GetUserID(ctx), map[string]interface{}{
+		"lineId":      req.LineID,
+		"method":      req.Method,
+		"startPeriod": req.StartPeriod,
+		"months":      req.Months,
+		"milestones":  milestones,
+	})
+	schedule, err := s.revenueHandler.HandleCreateRevenueSchedule(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeRevenueSchedule(w, http.StatusCreated, schedule)
+}
+
+func (s *InvoiceService) getRevenueSchedule(w http.ResponseWriter, r *http.Request, id string) {
+	scheduleID, err := uuid.Parse(id)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid revenue schedule ID")
+		return
+	}
+	schedule, err := s.revenueSchedules.FindByID(r.Context(), scheduleID)
+	if err != nil || schedule.TenantID.String() != middleware.GetTenantID(r.Context()) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Revenue schedule not found")
+		return
+	}
+	s.writeRevenueSchedule(w, http.StatusOK, schedule)
+}
+
+// completeMilestone completes a milestone, now or at completedAt.
+func (s *InvoiceService) completeMilestone(w http.ResponseWriter, r *http.Request, id, entryID string) {
+	var req struct {
+		CompletedAt string `json:"completedAt"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("completeMilestone", middleware.GetTenantID(ctx), id, middleware.GetUserID(ctx), map[string]interface{}{
+		"entryId":     entryID,
+		"completedAt": req.CompletedAt,
+	})
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	schedule, err := s.revenueHandler.HandleCompleteMilestone(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeRevenueSchedule(w, http.StatusOK, schedule)
+}
+
+// handleDeferredRevenueReport totals the tenant's revenue still deferred on
+// active schedules, per currency, with the months it is due in.
+func (s *InvoiceService) handleDeferredRevenueReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	schedules, err := s.revenueSchedules.FindByTenant(r.Context(), tenantID, domain.RevenueScheduleActive)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tenantId":   tenantID,
+		"currencies": domain.SummarizeDeferredRevenue(schedules),
+	})
+}
+
+func (s *InvoiceService) writeRevenueSchedule(w http.ResponseWriter, status int, schedule *domain.RevenueSchedule) {
+	httpresponse.SetETag(w, schedule.Version)
+	s.writeJSON(w, status, map[string]interface{}{
+		"schedule": schedule,
+		"deferred": schedule.Deferred(),
+	})
+}
@@ -0,0 +1,978 @@
+// Package invoiceservice is invoice-service: it handles invoice commands,
+// projects invoice events into the invoice read model and serves both,
+// along with reports, tax returns, exchange rates and exports.
+// cmd/invoice-service runs it; the e2e tests start it in-process.
+package invoiceservice
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/export"
+	"github.com/ims-erp/system/internal/fx"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/migrations"
+	"github.com/ims-erp/system/internal/notification"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/internal/scheduler"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/fieldset"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/ims-erp/system/pkg/timezone"
+)
+
+type InvoiceService struct {
+	config         *config.Config
+	logger         *logger.Logger
+	invoiceHandler *commands.InvoiceCommandHandler
+	queryHandler   *queries.InvoiceQueryHandler
+	clients        *repository.ReadModelStore
+	invoiceRepo    commands.InvoiceRepository
+	publisher      commands.Publisher
+	health         *health.HealthChecker
+
+	revenueHandler   *commands.RevenueRecognitionCommandHandler
+	revenueSchedules *repository.RevenueScheduleStore
+	taxHandler       *commands.TaxReturnCommandHandler
+	taxReturns       *repository.TaxReturnStore
+	fx               *fx.Service
+	exchangeRates    *repository.ExchangeRateStore
+	throttle         *middleware.Throttle
+
+	reminderSuppressions *repository.ReminderSuppressionStore
+	notifier             *notification.Notifier
+	consolidatedBilling  *repository.ConsolidatedBillingStore
+}
+
+func NewInvoiceService(
+	cfg *config.Config,
+	log *logger.Logger,
+	invoiceHandler *commands.InvoiceCommandHandler,
+	queryHandler *queries.InvoiceQueryHandler,
+	clients *repository.ReadModelStore,
+	invoiceRepo commands.InvoiceRepository,
+	publisher commands.Publisher,
+	healthChecker *health.HealthChecker,
+) *InvoiceService {
+	return &InvoiceService{
+		config:         cfg,
+		logger:         log,
+		invoiceHandler: invoiceHandler,
+		queryHandler:   queryHandler,
+		clients:        clients,
+		invoiceRepo:    invoiceRepo,
+		publisher:      publisher,
+		health:         healthChecker,
+	}
+}
+
+func (s *InvoiceService) setupRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.Handle("/health", s.health.Handler())
+	mux.Handle("/ready", s.health.Readiness().Handler())
+	mux.HandleFunc("/live", s.livenessHandler)
+	mux.Handle("/metrics", metrics.Handler())
+
+	mux.HandleFunc("/api/v1/invoices", s.handleInvoices)
+	mux.Handle("/api/v1/invoices/", middleware.RequireIfMatch(http.HandlerFunc(s.handleInvoiceOperations)))
+	mux.Handle("/api/v1/invoices/report/outstanding", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleOutstandingReport)))
+	mux.Handle("/api/v1/invoices/report/overdue", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleOverdueReport)))
+	mux.Handle("/api/v1/invoices/report/summary", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleSummaryReport)))
+	mux.Handle("/api/v1/invoices/report/deferred-revenue", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleDeferredRevenueReport)))
+	mux.HandleFunc(revenueSchedulesPath, s.handleRevenueScheduleByID)
+	mux.Handle("/api/v1/invoices/report/vat", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleVATReport)))
+	mux.Handle("/api/v1/invoices/report/numbering", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleNumberingAuditReport)))
+	mux.HandleFunc(taxReturnsPath, s.handleTaxReturns)
+	mux.HandleFunc("/api/v1/fx/rates", s.handleFXRate)
+	mux.HandleFunc("/api/v1/fx/rates/history", s.handleFXRateHistory)
+	mux.HandleFunc(fxOverridesPath, s.handleFXOverrides)
+	mux.HandleFunc(fxOverridesPath+"/", s.handleFXOverrideByID)
+	mux.HandleFunc(reminderSuppressionsPath, s.handleReminderSuppressions)
+	mux.HandleFunc(reminderSuppressionsPath+"/", s.handleReminderSuppressionByID)
+	mux.HandleFunc(consolidatedBillingPath, s.handleConsolidatedBilling)
+	mux.HandleFunc(consolidatedBillingPath+"/", s.handleConsolidatedBillingByClient)
+
+	return mux
+}
+
+func (s *InvoiceService) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status": "alive", "timestamp": "%s"}`, time.Now().UTC())
+}
+
+func (s *InvoiceService) handleInvoices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listInvoices(w, r)
+	case http.MethodPost:
+		s.createInvoice(w, r)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) handleInvoiceOperations(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/invoices/")
+	parts := strings.Split(path, "/")
+
+	if len(parts) == 0 || parts[0] == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid invoice ID")
+		return
+	}
+
+	invoiceID := parts[0]
+
+	if len(parts) > 1 {
+		switch parts[1] {
+		case "lines":
+			s.handleInvoiceLines(w, r, invoiceID)
+		case "payments":
+			s.handleInvoicePayments(w, r, invoiceID)
+		case "allocations":
+			s.handleCreditAllocations(w, r, invoiceID)
+		case "send":
+			s.handleInvoiceSend(w, r, invoiceID)
+		case "pdf":
+			s.handleInvoicePDF(w, r, invoiceID)
+		case "reminder":
+			s.handleInvoiceReminder(w, r, invoiceID)
+		case "revenue-schedules":
+			s.handleInvoiceRevenueSchedules(w, r, invoiceID)
+		default:
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.getInvoice(w, r, invoiceID)
+	case http.MethodPut, http.MethodPatch:
+		s.updateInvoice(w, r, invoiceID)
+	case http.MethodDelete:
+		s.deleteInvoice(w, r, invoiceID)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) handleInvoiceLines(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	if r.Method == http.MethodPost {
+		s.addInvoiceLine(w, r, invoiceID)
+	} else if r.Method == http.MethodDelete {
+		s.removeInvoiceLine(w, r, invoiceID)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) handleInvoicePayments(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	if r.Method == http.MethodPost {
+		s.recordPayment(w, r, invoiceID)
+	} else if r.Method == http.MethodGet {
+		s.getInvoicePayments(w, r, invoiceID)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// getInvoicePayments returns the history of the payments applied to an
+// invoice, those unapplied since included, with its balances.
+func (s *InvoiceService) getInvoicePayments(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	id, err := uuid.Parse(invoiceID)
+	if err != nil {
+		s.writeError(w, r, errors.InvalidArgument("invalid invoice ID"))
+		return
+	}
+	invoice, err := s.invoiceRepo.FindByID(r.Context(), id)
+	if err != nil || invoice == nil || invoice.TenantID.String() != middleware.GetTenantID(r.Context()) {
+		s.writeError(w, r, errors.NotFound("invoice not found"))
+		return
+	}
+
+	applications := invoice.PaymentApplications
+	if applications == nil {
+		applications = []domain.PaymentApplication{}
+	}
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"invoiceId":     invoice.ID.String(),
+		"invoiceNumber": invoice.InvoiceNumber,
+		"currency":      invoice.Currency,
+		"total":         invoice.Total.String(),
+		"amountPaid":    invoice.AmountPaid.String(),
+		"amountDue":     invoice.AmountDue.String(),
+		"status":        string(invoice.Status),
+		"applications":  applications,
+	})
+}
+
+func (s *InvoiceService) handleCreditAllocations(w http.ResponseWriter, r *http.Request, creditNoteID string) {
+	if r.Method == http.MethodPost {
+		s.applyCreditNote(w, r, creditNoteID)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) handleInvoiceSend(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	if r.Method == http.MethodPost {
+		s.sendInvoice(w, r, invoiceID)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) handleInvoicePDF(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	if r.Method == http.MethodGet {
+		s.generatePDF(w, r, invoiceID)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) listInvoices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	clientID := r.URL.Query().Get("clientId")
+	status := r.URL.Query().Get("status")
+	page := parseInt(r.URL.Query().Get("page"), 1)
+	pageSize := parseInt(r.URL.Query().Get("pageSize"), 20)
+
+	fields, err := fieldset.Parse(r.URL.Query(), "invoices", queries.InvoiceFields)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	query := &queries.ListInvoicesQuery{
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		ClientID:   clientID,
+		Status:     status,
+		Page:       page,
+		PageSize:   pageSize,
+		Cursor:     r.URL.Query().Get("cursor"),
+		Fields:     fields,
+	}
+
+	result, err := s.queryHandler.ListInvoices(ctx, query)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, fields.TrimIn(result, "invoices"))
+}
+
+func (s *InvoiceService) createInvoice(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		ClientID    string                 `json:"clientId"`
+		Type        string                 `json:"type"`
+		Currency    string                 `json:"currency"`
+		PaymentTerm string                 `json:"paymentTerm"`
+		IssueDate   string                 `json:"issueDate"`
+		DueDate     string                 `json:"dueDate"`
+		Notes       string                 `json:"notes"`
+		Terms       string                 `json:"terms"`
+		Data        map[string]interface{} `json:"data"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, errors.InvalidArgument("invalid request body"))
+		return
+	}
+
+	if req.ClientID == "" {
+		s.writeError(w, r, errors.InvalidArgument("clientId is required"))
+		return
+	}
+	data := req.Data
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["clientId"] = req.ClientID
+	data["type"] = req.Type
+	data["currency"] = req.Currency
+	data["paymentTerm"] = req.PaymentTerm
+	data["issueDate"] = req.IssueDate
+	data["dueDate"] = req.DueDate
+	data["notes"] = req.Notes
+	data["terms"] = req.Terms
+
+	cmd := commands.NewCommand("createInvoice", middleware.GetTenantID(ctx), "", middleware.GetUserID(ctx), data)
+
+	invoice, err := s.invoiceHandler.HandleCreateInvoice(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusCreated, invoice)
+}
+
+func (s *InvoiceService) getInvoice(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	fields, err := fieldset.Parse(r.URL.Query(), "invoices", queries.InvoiceFields)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	query := &queries.GetInvoiceByIDQuery{
+		InvoiceID:  invoiceID,
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		Fields:     fields,
+	}
+
+	invoice, err := s.queryHandler.GetInvoiceByID(ctx, query)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if invoice == nil {
+		s.writeError(w, r, errors.NotFound("invoice not found"))
+		return
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusOK, fields.Trim(invoice))
+}
+
+func (s *InvoiceService) updateInvoice(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	var req struct {
+		Action string                 `json:"action"`
+		Data   map[string]interface{} `json:"data"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, errors.InvalidArgument("invalid request body"))
+		return
+	}
+
+	cmd := commands.NewCommand("", tenantID, invoiceID, middleware.GetUserID(ctx), req.Data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+
+	var invoice *domain.Invoice
+	var err error
+
+	switch req.Action {
+	case "finalize":
+		cmd.Type = "finalizeInvoice"
+		invoice, err = s.invoiceHandler.HandleFinalizeInvoice(ctx, cmd)
+	case "void", "cancel":
+		cmd.Type = "voidInvoice"
+		invoice, err = s.invoiceHandler.HandleVoidInvoice(ctx, cmd)
+	case "send":
+		cmd.Type = "sendInvoice"
+		invoice, err = s.invoiceHandler.HandleSendInvoice(ctx, cmd)
+	default:
+		s.writeError(w, r, errors.InvalidArgument("invalid action: must be 'finalize', 'void', 'cancel', or 'send'"))
+		return
+	}
+
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusOK, invoice)
+}
+
+func (s *InvoiceService) deleteInvoice(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"message": "Invoice deleted"}`)
+}
+
+func (s *InvoiceService) addInvoiceLine(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	var req struct {
+		Description string                 `json:"description"`
+		Quantity    string                 `json:"quantity"`
+		UnitPrice   string                 `json:"unitPrice"`
+		Discount    string                 `json:"discount"`
+		TaxRate     string                 `json:"taxRate"`
+		TaxCode     string                 `json:"taxCode"`
+		ProductID   string                 `json:"productId"`
+		SortOrder   int                    `json:"sortOrder"`
+		Data        map[string]interface{} `json:"data"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, errors.InvalidArgument("invalid request body"))
+		return
+	}
+
+	data := req.Data
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["description"] = req.Description
+	data["quantity"] = req.Quantity
+	data["unitPrice"] = req.UnitPrice
+	data["discount"] = req.Discount
+	data["taxRate"] = req.TaxRate
+	data["taxCode"] = req.TaxCode
+	data["productId"] = req.ProductID
+	data["sortOrder"] = float64(req.SortOrder)
+
+	cmd := commands.NewCommand("addLineItem", tenantID, invoiceID, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+
+	invoice, err := s.invoiceHandler.HandleAddLineItem(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusCreated, invoice)
+}
+
+func (s *InvoiceService) removeInvoiceLine(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	lineID := r.URL.Query().Get("lineId")
+	if lineID == "" {
+		var req struct {
+			LineID string `json:"lineId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err == nil {
+			lineID = req.LineID
+		}
+	}
+
+	if lineID == "" {
+		s.writeError(w, r, errors.InvalidArgument("lineId is required"))
+		return
+	}
+
+	data := map[string]interface{}{
+		"lineId": lineID,
+	}
+
+	cmd := commands.NewCommand("removeLineItem", tenantID, invoiceID, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+
+	invoice, err := s.invoiceHandler.HandleRemoveLineItem(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusOK, invoice)
+}
+
+func (s *InvoiceService) recordPayment(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	var req struct {
+		Amount        string `json:"amount"`
+		PaymentMethod string `json:"paymentMethod"`
+		Reference     string `json:"reference"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, errors.InvalidArgument("invalid request body"))
+		return
+	}
+
+	if req.Amount == "" {
+		s.writeError(w, r, errors.InvalidArgument("amount is required"))
+		return
+	}
+
+	data := map[string]interface{}{
+		"amount":        req.Amount,
+		"paymentMethod": req.PaymentMethod,
+		"reference":     req.Reference,
+	}
+
+	cmd := commands.NewCommand("recordPayment", tenantID, invoiceID, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+
+	invoice, err := s.invoiceHandler.HandleRecordPayment(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusCreated, invoice)
+}
+
+// applyCreditNote applies a credit note to open invoices of its client,
+// answering with the credit note and the invoices it was applied to.
+func (s *InvoiceService) applyCreditNote(w http.ResponseWriter, r *http.Request, creditNoteID string) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	var req struct {
+		Allocations []struct {
+			InvoiceID string `json:"invoiceId"`
+			Amount    string `json:"amount"`
+		} `json:"allocations"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, errors.InvalidArgument("invalid request body"))
+		return
+	}
+
+	allocations := make([]interface{}, len(req.Allocations))
+	for i, allocation := range req.Allocations {
+		if allocation.InvoiceID == "" || allocation.Amount == "" {
+			s.writeError(w, r, errors.InvalidArgument("each allocation needs an invoiceId and an amount"))
+			return
+		}
+		allocations[i] = map[string]interface{}{
+			"invoiceId": allocation.InvoiceID,
+			"amount":    allocation.Amount,
+		}
+	}
+
+	data := map[string]interface{}{
+		"allocations": allocations,
+	}
+
+	cmd := commands.NewCommand("applyCreditNote", tenantID, creditNoteID, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+
+	creditNote, invoices, err := s.invoiceHandler.HandleApplyCreditNote(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	httpresponse.SetETag(w, creditNote.Version)
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"creditNote": creditNote,
+		"invoices":   invoices,
+	})
+}
+
+func (s *InvoiceService) sendInvoice(w http.ResponseWriter, r *http.Request, invoiceID string) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	data := make(map[string]interface{})
+
+	cmd := commands.NewCommand("sendInvoice", tenantID, invoiceID, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+
+	invoice, err := s.invoiceHandler.HandleSendInvoice(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	httpresponse.SetETag(w, invoice.Version)
+	s.writeJSON(w, http.StatusOK, invoice)
+}
+
+func (s *InvoiceService) handleOutstandingReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	loc, err := timezone.FromRequest(r, s.config.I18n.LocationFor(tenantID))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	page := parseInt(r.URL.Query().Get("page"), 1)
+	pageSize := parseInt(r.URL.Query().Get("pageSize"), 20)
+
+	query := &queries.GetOverdueInvoicesQuery{
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		Page:       page,
+		PageSize:   pageSize,
+		Location:   loc,
+	}
+
+	result, err := s.queryHandler.GetOverdueInvoices(ctx, query)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+func (s *InvoiceService) handleOverdueReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	loc, err := timezone.FromRequest(r, s.config.I18n.LocationFor(tenantID))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	page := parseInt(r.URL.Query().Get("page"), 1)
+	pageSize := parseInt(r.URL.Query().Get("pageSize"), 20)
+
+	query := &queries.GetOverdueInvoicesQuery{
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		Page:       page,
+		PageSize:   pageSize,
+		Location:   loc,
+	}
+
+	result, err := s.queryHandler.GetOverdueInvoices(ctx, query)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+func (s *InvoiceService) handleSummaryReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	loc, err := timezone.FromRequest(r, s.config.I18n.LocationFor(tenantID))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	startDateStr := r.URL.Query().Get("startDate")
+	endDateStr := r.URL.Query().Get("endDate")
+
+	query := &queries.GetInvoiceStatsQuery{
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		Location:   loc,
+	}
+
+	if startDateStr != "" {
+		if startDate, err := timezone.ParseBound(startDateStr, loc, false); err == nil {
+			query.StartDate = startDate
+		}
+	}
+
+	if endDateStr != "" {
+		if endDate, err := timezone.ParseBound(endDateStr, loc, true); err == nil {
+			query.EndDate = endDate
+		}
+	}
+
+	stats, err := s.queryHandler.GetInvoiceStats(ctx, query)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *InvoiceService) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+// writeError writes err in the shared error format. Errors without an
+// application code are logged here, since the client only sees a generic
+// message.
+func (s *InvoiceService) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *errors.Error
+	if !stderrors.As(err, &appErr) || appErr.StatusCode() >= http.StatusInternalServerError {
+		s.logger.New(r.Context()).Errorw("Request failed", "path", r.URL.Path, "error", err)
+	}
+	httpresponse.Error(w, r, err)
+}
+
+// Start connects invoice-service to MongoDB, Redis, messaging and MinIO as
+// cfg says, starts the invoice projections, exports and scheduled jobs in
+// group and returns its HTTP handler, authenticated and instrumented. The
+// connections are closed when group shuts down.
+func Start(group *lifecycle.Group, cfg *config.Config, log *logger.Logger) (http.Handler, error) {
+	mongodb, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB: %w", err)
+	}
+	group.OnClose("mongodb", func() error { return mongodb.Close(context.Background()) })
+	log.Info("Connected to MongoDB")
+
+	if err := migrations.New(mongodb, log).Startup(context.Background(), cfg.Migrations, "invoice_read", events.InvoiceDaySummaryCollection, events.InvoiceClientSummaryCollection); err != nil {
+		return nil, fmt.Errorf("check schema, run `migrate up`: %w", err)
+	}
+
+	redis, err := repository.NewRedis(cfg.Redis, log)
+	if err != nil {
+		return nil, fmt.Errorf("connect to Redis: %w", err)
+	}
+	group.OnClose("redis", redis.Close)
+	log.Info("Connected to Redis")
+
+	subscriber, err := messaging.NewEventSubscriber(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("create event subscriber: %w", err)
+	}
+	group.OnClose("subscriber", subscriber.Close)
+	group.OnShutdown("subscriber", subscriber.Drain)
+	log.Info("Connected to messaging", "transport", cfg.Messaging.Transport)
+
+	readModelStore := repository.NewReadModelStore(mongodb, "invoice_read", log)
+	clientStore := repository.NewReadModelStore(mongodb, "client_read", log)
+	cache := repository.NewCache(redis, "t:"+cfg.MongoDB.Database, log)
+
+	invoiceRepo := repository.NewMongoInvoiceRepository(mongodb, log)
+	publisher, err := messaging.NewEventPublisher(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("create event publisher: %w", err)
+	}
+	group.OnClose("publisher", publisher.Close)
+
+	// Invoice numbers run gapless per tenant and year, which the numbering
+	// audit checks.
+	invoiceCounter := repository.NewMongoInvoiceCounter(mongodb, log)
+
+	invoiceHandler := commands.NewInvoiceCommandHandler(
+		invoiceRepo,
+		nil,
+		publisher,
+		log,
+		invoiceCounter,
+	)
+
+	queryHandler := queries.NewInvoiceQueryHandler(
+		readModelStore,
+		cache,
+		log,
+	).WithInvoiceSequences(invoiceCounter)
+
+	processedEvents := repository.NewProcessedEventStore(mongodb)
+	if err := processedEvents.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create processed event indexes", "error", err)
+	}
+
+	summaries := events.NewInvoiceSummaryProjector(
+		readModelStore,
+		repository.NewReadModelStore(mongodb, events.InvoiceDaySummaryCollection, log),
+		repository.NewReadModelStore(mongodb, events.InvoiceClientSummaryCollection, log),
+		log,
+	)
+	projections := events.InvoiceProjections(readModelStore, clientStore, summaries, cache, log).
+		WithProcessedEvents(processedEvents, projectionConsumer, cfg.NATS.ProcessedEventTTL)
+	dlq, err := consumeProjections(group, cfg, subscriber, projections, log)
+	if err != nil {
+		return nil, fmt.Errorf("start invoice projections: %w", err)
+	}
+
+	files, err := export.NewStorage(cfg.MinIO)
+	if err != nil {
+		return nil, fmt.Errorf("configure MinIO: %w", err)
+	}
+	exporter := export.NewExporter(mongodb, files, cfg.Exports, log, invoiceExport).WithMasking(cfg.Security.Masking)
+	if err := exporter.Setup(context.Background()); err != nil {
+		log.Warn("Failed to set up exports", "error", err)
+	}
+	group.Go("export worker", exporter.Run)
+
+	healthChecker := health.NewHealthChecker(cfg, mongodb, redis, log)
+	healthChecker.AddComponent("messaging", health.MessagingCheck(subscriber))
+	if natsSubscriber, ok := subscriber.(*messaging.Subscriber); ok && cfg.NATS.JetStream.Enabled {
+		healthChecker.AddComponent("consumer:"+projectionConsumer, health.ConsumerLagCheck(
+			natsSubscriber, "INVOICE_EVENTS", projectionConsumer, cfg.NATS.JetStream.MaxConsumerLag))
+	}
+
+	// Revenue of lines billed upfront is recognized by a daily job; each
+	// run recognizes the months that have ended in each tenant's time zone.
+	revenueSchedules := repository.NewRevenueScheduleStore(mongodb)
+	if err := revenueSchedules.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create revenue schedule indexes", "error", err)
+	}
+	revenueHandler := commands.NewRevenueRecognitionCommandHandler(revenueSchedules, invoiceRepo, publisher, cfg.I18n.LocationFor, log)
+
+	// A filed VAT return locks its period: invoices can no longer be issued
+	// or voided in it.
+	taxReturns := repository.NewTaxReturnStore(mongodb)
+	if err := taxReturns.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create tax return indexes", "error", err)
+	}
+	invoiceHandler.WithTaxPeriodLocks(taxReturns)
+	taxHandler := commands.NewTaxReturnCommandHandler(taxReturns, invoiceRepo, publisher, cfg.Tax.JurisdictionFor, cfg.I18n.LocationFor, log)
+
+	// Exchange rates are synced here by a daily job, for every service;
+	// invoices record their total in the tenant's reporting currency when
+	// they are issued.
+	exchangeRates := repository.NewExchangeRateStore(mongodb)
+	if err := exchangeRates.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create exchange rate indexes", "error", err)
+	}
+	fxService := fx.NewService(cfg.FX, exchangeRates, fx.NewProvider(cfg.FX), log)
+	invoiceHandler.WithCurrencyConverter(fxService)
+
+	// Payment reminders are sent by notification-service on
+	// invoice.reminder_sent; the notifier here only renders previews of
+	// them, so it has no providers.
+	reminderSuppressions := repository.NewReminderSuppressionStore(mongodb)
+	if err := reminderSuppressions.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create reminder suppression indexes", "error", err)
+	}
+	invoiceHandler.WithReminderSuppressions(reminderSuppressions)
+	pii, err := cfg.Security.PII.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("configure PII encryption: %w", err)
+	}
+	notifier := notification.NewNotifier(mongodb, cfg.Notifications, cfg.I18n, nil, log).WithEncryption(pii)
+
+	// Clients set up for it get their delivered orders billed on one
+	// invoice per week or month, by a daily job.
+	consolidatedBilling := repository.NewConsolidatedBillingStore(mongodb)
+	if err := consolidatedBilling.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create consolidated billing indexes", "error", err)
+	}
+	invoiceHandler.WithConsolidatedBilling(consolidatedBilling, cfg.I18n.LocationFor)
+	if cfg.Outbox.Enabled {
+		outbox, err := messaging.OpenOutbox(context.Background(), mongodb, publisher, cfg.Outbox, log)
+		if err != nil {
+			return nil, fmt.Errorf("open outbox: %w", err)
+		}
+		group.Go("outbox relay", outbox.Run)
+		revenueHandler.WithOutbox(outbox)
+		taxHandler.WithOutbox(outbox)
+		log.Info("Transactional outbox enabled")
+	}
+
+	jobRuns := repository.NewJobRunStore(mongodb)
+	if err := jobRuns.EnsureIndexes(context.Background(), cfg.Scheduler.HistoryRetention); err != nil {
+		log.Warn("Failed to create job run indexes", "error", err)
+	}
+	jobLocks, err := scheduler.NewLocker(cfg.Scheduler, mongodb, redis)
+	if err != nil {
+		return nil, fmt.Errorf("configure job locks: %w", err)
+	}
+	jobs := scheduler.New(cfg.Scheduler, jobLocks, jobRuns, log)
+	if err := jobs.Register(scheduler.Job{
+		Name:     "revenue.recognition",
+		Schedule: "@daily",
+		Run: func(ctx context.Context) error {
+			return revenueHandler.RecognizeDue(ctx, time.Now())
+		},
+		Timeout: 30 * time.Minute,
+	}); err != nil {
+		return nil, fmt.Errorf("register job: %w", err)
+	}
+	if err := jobs.Register(scheduler.Job{
+		Name:     "fx.sync",
+		Schedule: "@daily",
+		Run:      fxService.Sync,
+		Timeout:  5 * time.Minute,
+	}); err != nil {
+		return nil, fmt.Errorf("register job: %w", err)
+	}
+	if err := jobs.Register(scheduler.Job{
+		Name:     "invoice.consolidation",
+		Schedule: "@daily",
+		Run: func(ctx context.Context) error {
+			return invoiceHandler.ConsolidateDue(ctx, time.Now())
+		},
+		Timeout: 30 * time.Minute,
+	}); err != nil {
+		return nil, fmt.Errorf("register job: %w", err)
+	}
+	group.Go("job scheduler", jobs.Run)
+
+	service := NewInvoiceService(cfg, log, invoiceHandler, queryHandler, clientStore, invoiceRepo, publisher, healthChecker)
+	service.revenueHandler = revenueHandler
+	service.revenueSchedules = revenueSchedules
+	service.taxHandler = taxHandler
+	service.taxReturns = taxReturns
+	service.fx = fxService
+	service.exchangeRates = exchangeRates
+	service.reminderSuppressions = reminderSuppressions
+	service.notifier = notifier
+	service.consolidatedBilling = consolidatedBilling
+	service.throttle = middleware.NewThrottle(repository.NewRateLimiter(redis, log), cfg.Security.Throttle, log)
+	mux := service.setupRoutes()
+	mux.Handle(events.CatalogPath, events.NewCatalog(cfg.App.Name, events.InvoiceEvents, projections.EventTypes()).Handler())
+	mux.Handle("/admin/jobs", jobs.Handler())
+	mux.Handle("/admin/jobs/", jobs.Handler())
+	exports := service.throttle.Limit(middleware.ThrottleExport, exporter.Handler("/api/v1/invoices/exports"), http.MethodPost)
+	mux.Handle("/api/v1/invoices/exports", exports)
+	mux.Handle("/api/v1/invoices/exports/", exports)
+	if dlq != nil {
+		mux.Handle("/admin/dlq", dlq.Handler())
+		mux.Handle("/admin/dlq/", dlq.Handler())
+	}
+	if natsSubscriber, ok := subscriber.(*messaging.Subscriber); ok && cfg.NATS.JetStream.Enabled {
+		mux.Handle("/debug/consumers", natsSubscriber.ConsumersHandler())
+	}
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		return nil, fmt.Errorf("configure token validation: %w", err)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator)
+
+	return metrics.HTTPMiddleware(middleware.Instrument(log, tenants.Handler(middleware.MaskPII(cfg.Security.Masking, mux)))), nil
+}
+
+func parseInt(s string, defaultVal int) int {
+	if s == "" {
+		return defaultVal
+	}
+	val, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
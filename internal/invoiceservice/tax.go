@@ -0,0 +1,189 @@
+package invoiceservice
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+const taxReturnsPath = "/api/v1/invoices/tax-returns"
+
+// vatColumns are the columns of the CSV form of a VAT return.
+var vatColumns = []string{
+	"Tax Code", "Tax Rate", "Currency", "Net Amount", "Tax Amount", "Invoices", "Credit Notes",
+}
+
+// mtdVATReturn is the body of a VAT return submitted to HMRC under Making
+// Tax Digital. Only output VAT is tracked here, so the boxes for
+// acquisitions, input VAT and purchases are zero.
+type mtdVATReturn struct {
+	PeriodKey                    string      `json:"periodKey"`
+	VATDueSales                  json.Number `json:"vatDueSales"`
+	VATDueAcquisitions           json.Number `json:"vatDueAcquisitions"`
+	TotalVATDue                  json.Number `json:"totalVatDue"`
+	VATReclaimedCurrPeriod       json.Number `json:"vatReclaimedCurrPeriod"`
+	NetVATDue                    json.Number `json:"netVatDue"`
+	TotalValueSalesExVAT         json.Number `json:"totalValueSalesExVAT"`
+	TotalValuePurchasesExVAT     json.Number `json:"totalValuePurchasesExVAT"`
+	TotalValueGoodsSuppliedExVAT json.Number `json:"totalValueGoodsSuppliedExVAT"`
+	TotalAcquisitionsExVAT       json.Number `json:"totalAcquisitionsExVAT"`
+	Finalised                    bool        `json:"finalised"`
+}
+
+func newMTDVATReturn(periodKey string, taxReturn *domain.TaxReturn) mtdVATReturn {
+	total := taxReturn.TotalIn("GBP")
+	zero := json.Number("0.00")
+	return mtdVATReturn{
+		PeriodKey:                    periodKey,
+		VATDueSales:                  json.Number(total.TaxAmount.StringFixed(2)),
+		VATDueAcquisitions:           zero,
+		TotalVATDue:                  json.Number(total.TaxAmount.StringFixed(2)),
+		VATReclaimedCurrPeriod:       zero,
+		NetVATDue:                    json.Number(total.TaxAmount.Abs().StringFixed(2)),
+		TotalValueSalesExVAT:         json.Number(total.NetAmount.Truncate(0).String()),
+		TotalValuePurchasesExVAT:     json.Number("0"),
+		TotalValueGoodsSuppliedExVAT: json.Number("0"),
+		TotalAcquisitionsExVAT:       json.Number("0"),
+		Finalised:                    true,
+	}
+}
+
+// handleVATReport serves GET /api/v1/invoices/report/vat: the tenant's VAT
+// return for ?period=, the current one by default, as JSON, as CSV, or as
+// the MTD body for the HMRC period in ?periodKey=. The filed return is
+// served once the period is filed.
+func (s *InvoiceService) handleVATReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		// Clients asking for JSON get the return itself; downloads are in
+		// the format the tenant files in.
+		format = s.config.Tax.JurisdictionFor(tenantID).Format
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			format = "json"
+		}
+	}
+	if format == "mtd" && params.Get("periodKey") == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "periodKey is required for MTD returns")
+		return
+	}
+
+	taxReturn, err := s.taxHandler.BuildTaxReturn(r.Context(), tenantID, params.Get("period"))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	// Exports only hold declarable lines; the header tells whether invoices
+	// were left out, which the JSON form lists under issues.
+	w.Header().Set("X-VAT-Issues", strconv.Itoa(len(taxReturn.Issues)))
+	filename := fmt.Sprintf("vat-%s-%s", taxReturn.Country, taxReturn.Period)
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		out := csv.NewWriter(w)
+		out.Write(vatColumns)
+		for _, line := range taxReturn.Lines {
+			out.Write([]string{
+				line.TaxCode,
+				line.TaxRate.String(),
+				line.Currency,
+				line.NetAmount.String(),
+				line.TaxAmount.String(),
+				strconv.Itoa(line.Invoices),
+				strconv.Itoa(line.CreditNotes),
+			})
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			s.logger.Error("Failed to write VAT return", "error", err, "tenant_id", tenantID)
+		}
+	case "mtd":
+		if taxReturn.Country != "GB" {
+			httpresponse.ErrorStatus(w, r, http.StatusUnprocessableEntity, "MTD returns are for UK VAT registrations")
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		s.writeJSON(w, http.StatusOK, newMTDVATReturn(params.Get("periodKey"), taxReturn))
+	case "json":
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"return": taxReturn,
+			"filed":  taxReturn.IsFiled(),
+		})
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "format must be json, csv or mtd")
+	}
+}
+
+// handleTaxReturns lists the tenant's filed VAT returns, or files one.
+func (s *InvoiceService) handleTaxReturns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listTaxReturns(w, r)
+	case http.MethodPost:
+		s.fileTaxReturn(w, r)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *InvoiceService) listTaxReturns(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	limit := parseInt(r.URL.Query().Get("limit"), 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	returns, err := s.taxReturns.List(r.Context(), tenantID, int64(limit))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"returns": returns})
+}
+
+// fileTaxReturn files the return of period as it stands, with the
+// reference the tax authority acknowledged it with. The period is locked
+// from then on.
+func (s *InvoiceService) fileTaxReturn(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Period    string `json:"period"`
+		Reference string `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("fileTaxReturn", middleware.GetTenantID(ctx), "", middleware.GetUserID(ctx), map[string]interface{}{
+		"period":    req.Period,
+		"reference": req.Reference,
+	})
+	taxReturn, err := s.taxHandler.HandleFileTaxReturn(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{"return": taxReturn})
+}
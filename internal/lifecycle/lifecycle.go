@@ -0,0 +1,183 @@
+// Package lifecycle coordinates a service's shutdown. Background workers run
+// under a Group's context; intake such as HTTP servers and message
+// subscriptions registers shutdown hooks. On shutdown the hooks run first, in
+// reverse order of registration, so nothing new arrives; then the workers'
+// context is cancelled and the Group waits for them, all within one deadline.
+// Connections both use are closed last.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// ErrShutdownTimeout is returned by Shutdown when hooks or workers were still
+// running at the deadline.
+var ErrShutdownTimeout = errors.New("shutdown deadline exceeded")
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type closer struct {
+	name string
+	fn   func() error
+}
+
+type Group struct {
+	logger *logger.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	hooks   []hook
+	closers []closer
+	running map[string]int
+	wg      sync.WaitGroup
+}
+
+func New(log *logger.Logger) *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{
+		logger:  log,
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]int),
+	}
+}
+
+// Context is cancelled when workers are told to stop. Pass it to consumers
+// and loops that are not started with Go.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs fn in a goroutine. fn must return soon after ctx is cancelled;
+// Shutdown waits for it.
+func (g *Group) Go(name string, fn func(ctx context.Context)) {
+	g.mu.Lock()
+	g.running[name]++
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			g.mu.Lock()
+			if g.running[name]--; g.running[name] == 0 {
+				delete(g.running, name)
+			}
+			g.mu.Unlock()
+		}()
+		fn(g.ctx)
+	}()
+}
+
+// OnShutdown registers fn to run at shutdown, before workers are stopped.
+// Hooks run one at a time, the last registered first, like deferred calls.
+func (g *Group) OnShutdown(name string, fn func(ctx context.Context) error) {
+	g.mu.Lock()
+	g.hooks = append(g.hooks, hook{name: name, fn: fn})
+	g.mu.Unlock()
+}
+
+// OnClose registers fn to run at the very end of shutdown, once the workers
+// have returned or the deadline has passed, for the connections hooks and
+// workers use. Like hooks, the last registered runs first.
+func (g *Group) OnClose(name string, fn func() error) {
+	g.mu.Lock()
+	g.closers = append(g.closers, closer{name: name, fn: fn})
+	g.mu.Unlock()
+}
+
+// WaitForSignal blocks until the process receives SIGINT or SIGTERM, or the
+// Group's context is cancelled, and returns the signal (nil if cancelled).
+func (g *Group) WaitForSignal() os.Signal {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case sig := <-quit:
+		return sig
+	case <-g.ctx.Done():
+		return nil
+	}
+}
+
+// Shutdown runs the hooks, then stops the workers, giving both together
+// timeout to finish, and then closes the connections. Hook and close errors
+// are logged and returned joined.
+func (g *Group) Shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+
+	g.mu.Lock()
+	hooks := append([]hook(nil), g.hooks...)
+	g.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		g.logger.Info("Shutdown: stopping", "component", h.name)
+		hookStart := time.Now()
+		if err := h.fn(ctx); err != nil {
+			g.logger.Error("Shutdown: failed to stop", "component", h.name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		g.logger.Info("Shutdown: stopped", "component", h.name, "duration_ms", time.Since(hookStart).Milliseconds())
+	}
+
+	g.cancel()
+	if workers := g.Running(); len(workers) > 0 {
+		g.logger.Info("Shutdown: waiting for workers", "workers", workers)
+	}
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		g.logger.Info("Shutdown complete", "duration_ms", time.Since(start).Milliseconds())
+	case <-ctx.Done():
+		g.logger.Error("Shutdown: deadline exceeded", "timeout", timeout, "still_running", g.Running())
+		errs = append(errs, ErrShutdownTimeout)
+	}
+
+	g.mu.Lock()
+	closers := append([]closer(nil), g.closers...)
+	g.mu.Unlock()
+	for i := len(closers) - 1; i >= 0; i-- {
+		c := closers[i]
+		if err := c.fn(); err != nil {
+			g.logger.Error("Shutdown: failed to close", "component", c.name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Running lists the workers that have not returned, sorted by name.
+func (g *Group) Running() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	names := make([]string, 0, len(g.running))
+	for name := range g.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,97 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGroup(t *testing.T) *Group {
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	return New(log)
+}
+
+func TestShutdownRunsHooksInReverseThenStopsWorkers(t *testing.T) {
+	g := newTestGroup(t)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(s string) {
+		mu.Lock()
+		order = append(order, s)
+		mu.Unlock()
+	}
+
+	g.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		record("worker")
+	})
+	g.OnShutdown("subscriber", func(ctx context.Context) error {
+		record("subscriber")
+		return nil
+	})
+	g.OnShutdown("http", func(ctx context.Context) error {
+		record("http")
+		return nil
+	})
+	g.OnClose("mongodb", func() error {
+		record("mongodb")
+		return nil
+	})
+	g.OnClose("publisher", func() error {
+		record("publisher")
+		return nil
+	})
+
+	require.NoError(t, g.Shutdown(time.Second))
+	assert.Equal(t, []string{"http", "subscriber", "worker", "publisher", "mongodb"}, order)
+	assert.Empty(t, g.Running())
+}
+
+func TestShutdownWaitsForInFlightWork(t *testing.T) {
+	g := newTestGroup(t)
+
+	finished := false
+	g.Go("aggregation", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		finished = true
+	})
+
+	require.NoError(t, g.Shutdown(time.Second))
+	assert.True(t, finished)
+}
+
+func TestShutdownReportsDeadline(t *testing.T) {
+	g := newTestGroup(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	g.Go("stuck", func(ctx context.Context) { <-release })
+
+	err := g.Shutdown(20 * time.Millisecond)
+	assert.ErrorIs(t, err, ErrShutdownTimeout)
+	assert.Equal(t, []string{"stuck"}, g.Running())
+}
+
+func TestShutdownJoinsHookErrors(t *testing.T) {
+	g := newTestGroup(t)
+
+	ran := false
+	g.OnShutdown("first", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	g.OnShutdown("broken", func(ctx context.Context) error { return errors.New("boom") })
+
+	err := g.Shutdown(time.Second)
+	assert.ErrorContains(t, err, "broken: boom")
+	assert.True(t, ran, "later hooks still run after a failure")
+}
@@ -0,0 +1,110 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/metrics"
+)
+
+// ConsumerState is a JetStream consumer's progress as reported by the server
+// and exposed by /debug/consumers.
+type ConsumerState struct {
+	Stream        string     `json:"stream"`
+	Consumer      string     `json:"consumer"`
+	FilterSubject string     `json:"filterSubject"`
+	Pending       uint64     `json:"pending"`
+	AckPending    int        `json:"ackPending"`
+	Redelivered   int        `json:"redelivered"`
+	WaitingPulls  int        `json:"waitingPulls"`
+	Delivered     uint64     `json:"delivered"`
+	AckFloor      uint64     `json:"ackFloor"`
+	LastActive    *time.Time `json:"lastActive,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// ConsumerStates reads the state of every consumer started by Consume. A
+// consumer whose info cannot be read is listed with Error set.
+func (s *Subscriber) ConsumerStates(ctx context.Context) []ConsumerState {
+	s.mu.RLock()
+	specs := append([]ConsumerSpec(nil), s.consumers...)
+	s.mu.RUnlock()
+
+	states := make([]ConsumerState, 0, len(specs))
+	for _, spec := range specs {
+		state := ConsumerState{
+			Stream:        spec.Stream,
+			Consumer:      spec.Consumer,
+			FilterSubject: spec.FilterSubject,
+		}
+		if err := s.readConsumerState(ctx, &state); err != nil {
+			state.Error = err.Error()
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+func (s *Subscriber) readConsumerState(ctx context.Context, state *ConsumerState) error {
+	c, err := s.js.Consumer(ctx, state.Stream, state.Consumer)
+	if err != nil {
+		return fmt.Errorf("failed to get consumer: %w", err)
+	}
+	info, err := c.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get consumer info: %w", err)
+	}
+	state.Pending = info.NumPending
+	state.AckPending = info.NumAckPending
+	state.Redelivered = info.NumRedelivered
+	state.WaitingPulls = info.NumWaiting
+	state.Delivered = info.Delivered.Stream
+	state.AckFloor = info.AckFloor.Stream
+	state.LastActive = info.Delivered.Last
+	return nil
+}
+
+// MonitorConsumers exports pending, ack pending and redelivered counts for
+// every consumer started by Consume. It runs until ctx is cancelled.
+func (s *Subscriber) MonitorConsumers(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, state := range s.ConsumerStates(ctx) {
+			if state.Error != "" {
+				s.logger.Warn("Failed to read consumer state",
+					"stream", state.Stream,
+					"consumer", state.Consumer,
+					"error", state.Error,
+				)
+				continue
+			}
+			metrics.SetConsumerState(state.Stream, state.Consumer,
+				state.Pending, uint64(state.AckPending), uint64(state.Redelivered))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ConsumersHandler serves GET /debug/consumers, listing the state of every
+// consumer started by Consume. The consumers are shared by every tenant, so
+// it runs behind the tenant middleware and needs middleware.AdminPermission.
+func (s *Subscriber) ConsumersHandler() http.Handler {
+	return middleware.RequirePermission(middleware.AdminPermission, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": s.ConsumerStates(r.Context())})
+	}))
+}
@@ -0,0 +1,117 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsumers serves consumer info from memory. Consumers it does not
+// hold are not found.
+type fakeConsumers struct {
+	jetstream.JetStream
+	infos map[string]*jetstream.ConsumerInfo
+}
+
+func (f *fakeConsumers) Consumer(ctx context.Context, stream, consumer string) (jetstream.Consumer, error) {
+	info, ok := f.infos[stream+"/"+consumer]
+	if !ok {
+		return nil, jetstream.ErrConsumerNotFound
+	}
+	return &fakeJetStreamConsumer{info: info}, nil
+}
+
+type fakeJetStreamConsumer struct {
+	jetstream.Consumer
+	info *jetstream.ConsumerInfo
+}
+
+func (c *fakeJetStreamConsumer) Info(ctx context.Context) (*jetstream.ConsumerInfo, error) {
+	return c.info, nil
+}
+
+func newTestConsumerSubscriber(t *testing.T) *Subscriber {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	lastActive := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	return &Subscriber{
+		js: &fakeConsumers{infos: map[string]*jetstream.ConsumerInfo{
+			"INVOICE_EVENTS/invoice-read-projections": {
+				NumPending:     42,
+				NumAckPending:  3,
+				NumRedelivered: 1,
+				NumWaiting:     2,
+				Delivered:      jetstream.SequenceInfo{Stream: 120, Last: &lastActive},
+				AckFloor:       jetstream.SequenceInfo{Stream: 117},
+			},
+		}},
+		logger: log,
+		consumers: []ConsumerSpec{
+			{Stream: "INVOICE_EVENTS", Consumer: "invoice-read-projections", FilterSubject: "evt.invoice.>"},
+			{Stream: "CLIENT_EVENTS", Consumer: "invoice-read-client-names", FilterSubject: "evt.Client.ClientUpdated"},
+		},
+	}
+}
+
+func TestSubscriber_ConsumerStates(t *testing.T) {
+	states := newTestConsumerSubscriber(t).ConsumerStates(context.Background())
+	require.Len(t, states, 2)
+
+	assert.Equal(t, "evt.invoice.>", states[0].FilterSubject)
+	assert.Equal(t, uint64(42), states[0].Pending)
+	assert.Equal(t, 3, states[0].AckPending)
+	assert.Equal(t, 1, states[0].Redelivered)
+	assert.Equal(t, 2, states[0].WaitingPulls)
+	assert.Equal(t, uint64(120), states[0].Delivered)
+	assert.Equal(t, uint64(117), states[0].AckFloor)
+	require.NotNil(t, states[0].LastActive)
+	assert.Empty(t, states[0].Error)
+
+	assert.Equal(t, "invoice-read-client-names", states[1].Consumer)
+	assert.Contains(t, states[1].Error, "failed to get consumer", "an unreadable consumer is listed with its error")
+}
+
+func TestSubscriber_MonitorConsumersExportsState(t *testing.T) {
+	metrics.Initialize("test")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	newTestConsumerSubscriber(t).MonitorConsumers(ctx, time.Hour)
+
+	assert.Equal(t, float64(42), testutil.ToFloat64(metrics.ConsumerPending.WithLabelValues("INVOICE_EVENTS", "invoice-read-projections")))
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.ConsumerAckPending.WithLabelValues("INVOICE_EVENTS", "invoice-read-projections")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ConsumerRetrying.WithLabelValues("INVOICE_EVENTS", "invoice-read-projections")))
+}
+
+func TestSubscriber_ConsumersHandler(t *testing.T) {
+	handler := newTestConsumerSubscriber(t).ConsumersHandler()
+	request := func(method string, permissions ...string) *httptest.ResponseRecorder {
+		ctx := middleware.WithIdentity(context.Background(), "tenant-a", "user-1", permissions)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, "/debug/consumers", nil).WithContext(ctx))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet).Code)
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "invoice:read").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, middleware.AdminPermission).Code)
+
+	rec := request(http.MethodGet, middleware.AdminPermission)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Data []ConsumerState `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Len(t, body.Data, 2)
+	assert.Equal(t, uint64(42), body.Data[0].Pending)
+}
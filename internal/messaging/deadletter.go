@@ -0,0 +1,259 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DLQStreamName    = "DLQ"
+	dlqSubjectPrefix = "dlq."
+	dlqNoTenant      = "_"
+
+	HeaderDLQSubject    = "dlq-original-subject"
+	HeaderDLQStream     = "dlq-stream"
+	HeaderDLQConsumer   = "dlq-consumer"
+	HeaderDLQError      = "dlq-error"
+	HeaderDLQDeliveries = "dlq-deliveries"
+	HeaderDLQFailedAt   = "dlq-failed-at"
+
+	// HeaderTenantID is set on published events and commands.
+	HeaderTenantID = "tenant-id"
+)
+
+// ErrPoison marks a message that can never be processed, such as one that
+// fails to decode. Wrapped errors skip redelivery and go straight to the DLQ.
+var ErrPoison = errors.New("poison message")
+
+// ConsumerSpec describes a durable JetStream consumer with dead-letter
+// handling. Failed messages are redelivered with Backoff delays until
+// MaxDeliver is reached, then copied to dlq.<Stream>.<tenant>.<subject>.
+type ConsumerSpec struct {
+	Stream        string
+	Consumer      string
+	FilterSubject string
+	MaxDeliver    int
+	AckWait       time.Duration
+	Backoff       []time.Duration
+}
+
+// MessageHandler processes one JetStream message; a nil error acks it.
+type MessageHandler func(ctx context.Context, msg jetstream.Msg) error
+
+// DLQSubject returns the dead-letter subject for a message of tenantID from
+// stream. The tenant is part of the subject so the admin API can list and
+// count one tenant's dead letters; messages without one go under
+// dlqNoTenant, which no tenant can see.
+func DLQSubject(stream, tenantID, subject string) string {
+	if tenantID == "" || strings.ContainsAny(tenantID, ".*> ") {
+		tenantID = dlqNoTenant
+	}
+	return dlqSubjectPrefix + stream + "." + tenantID + "." + subject
+}
+
+// EnsureDLQStream creates the shared dead-letter stream if it does not exist.
+func EnsureDLQStream(ctx context.Context, js jetstream.JetStream) (jetstream.Stream, error) {
+	stream, err := js.Stream(ctx, DLQStreamName)
+	if err == nil {
+		return stream, nil
+	}
+	if !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return nil, fmt.Errorf("failed to get DLQ stream: %w", err)
+	}
+
+	stream, err = js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:      DLQStreamName,
+		Subjects:  []string{dlqSubjectPrefix + ">"},
+		Retention: jetstream.LimitsPolicy,
+		MaxAge:    14 * 24 * time.Hour,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DLQ stream: %w", err)
+	}
+	return stream, nil
+}
+
+// Consume starts a durable pull consumer for spec. Messages are acked on
+// success, delayed-nak'd on failure and dead-lettered once MaxDeliver is hit.
+func (s *Subscriber) Consume(ctx context.Context, spec ConsumerSpec, handler MessageHandler) (jetstream.ConsumeContext, error) {
+	if s.js == nil {
+		return nil, fmt.Errorf("JetStream not enabled")
+	}
+
+	if _, err := EnsureDLQStream(ctx, s.js); err != nil {
+		return nil, err
+	}
+
+	stream, err := s.js.Stream(ctx, spec.Stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream: %w", err)
+	}
+
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Name:          spec.Consumer,
+		Durable:       spec.Consumer,
+		FilterSubject: spec.FilterSubject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       spec.AckWait,
+		MaxDeliver:    spec.MaxDeliver,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	cc, err := consumer.Consume(func(msg jetstream.Msg) {
+		s.process(ctx, spec, handler, msg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start consumer: %w", err)
+	}
+
+	s.mu.Lock()
+	s.consumers = append(s.consumers, spec)
+	s.mu.Unlock()
+
+	s.logger.Info("Started JetStream consumer",
+		"stream", spec.Stream,
+		"consumer", spec.Consumer,
+		"subject", spec.FilterSubject,
+		"max_deliver", spec.MaxDeliver,
+	)
+	return cc, nil
+}
+
+func (s *Subscriber) process(ctx context.Context, spec ConsumerSpec, handler MessageHandler, msg jetstream.Msg) {
+	msgCtx, span := otel.Tracer("messaging").Start(ExtractTraceContext(ctx, msg.Headers()), "nats.consume",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination", msg.Subject()),
+			attribute.String("messaging.consumer", spec.Consumer),
+		),
+	)
+	var deliveries uint64 = 1
+	if md, mdErr := msg.Metadata(); mdErr == nil {
+		deliveries = md.NumDelivered
+	}
+	if deliveries > 1 {
+		metrics.RecordConsumerRedelivery(spec.Stream, spec.Consumer)
+	}
+
+	start := time.Now()
+	err := handler(msgCtx, msg)
+	metrics.ObserveNATS(msg.Subject(), "consume", start, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	if err == nil {
+		if ackErr := msg.Ack(); ackErr != nil {
+			s.logger.Warn("Failed to ack message", "subject", msg.Subject(), "error", ackErr)
+			return
+		}
+		metrics.RecordConsumerAck(spec.Stream, spec.Consumer, "ack")
+		return
+	}
+
+	if errors.Is(err, ErrPoison) || (spec.MaxDeliver > 0 && deliveries >= uint64(spec.MaxDeliver)) {
+		s.deadLetter(ctx, spec, msg, deliveries, err)
+		return
+	}
+
+	s.logger.Warn("Message handling failed, will retry",
+		"subject", msg.Subject(),
+		"consumer", spec.Consumer,
+		"deliveries", deliveries,
+		"error", err,
+	)
+	msg.NakWithDelay(retryDelay(spec.Backoff, deliveries))
+	metrics.RecordConsumerAck(spec.Stream, spec.Consumer, "nak")
+}
+
+// deadLetter copies msg to the DLQ and terminates it. If the copy fails the
+// message is nak'd so it is not lost.
+func (s *Subscriber) deadLetter(ctx context.Context, spec ConsumerSpec, msg jetstream.Msg, deliveries uint64, cause error) {
+	dlqMsg := nats.NewMsg(DLQSubject(spec.Stream, msg.Headers().Get(HeaderTenantID), msg.Subject()))
+	dlqMsg.Data = msg.Data()
+	for key, values := range msg.Headers() {
+		for _, v := range values {
+			dlqMsg.Header.Add(key, v)
+		}
+	}
+	dlqMsg.Header.Set(HeaderDLQSubject, msg.Subject())
+	dlqMsg.Header.Set(HeaderDLQStream, spec.Stream)
+	dlqMsg.Header.Set(HeaderDLQConsumer, spec.Consumer)
+	dlqMsg.Header.Set(HeaderDLQError, cause.Error())
+	dlqMsg.Header.Set(HeaderDLQDeliveries, strconv.FormatUint(deliveries, 10))
+	dlqMsg.Header.Set(HeaderDLQFailedAt, time.Now().UTC().Format(time.RFC3339))
+
+	if _, err := s.js.PublishMsg(ctx, dlqMsg); err != nil {
+		s.logger.Error("Failed to dead-letter message", "subject", msg.Subject(), "error", err)
+		msg.NakWithDelay(retryDelay(spec.Backoff, deliveries))
+		metrics.RecordConsumerAck(spec.Stream, spec.Consumer, "nak")
+		return
+	}
+
+	metrics.RecordDeadLetter(spec.Stream, spec.Consumer)
+	s.logger.Error("Message moved to dead-letter queue",
+		"subject", msg.Subject(),
+		"stream", spec.Stream,
+		"consumer", spec.Consumer,
+		"deliveries", deliveries,
+		"error", cause,
+	)
+	msg.TermWithReason(truncate(cause.Error(), 256))
+	metrics.RecordConsumerAck(spec.Stream, spec.Consumer, "term")
+}
+
+func retryDelay(backoff []time.Duration, deliveries uint64) time.Duration {
+	if len(backoff) == 0 {
+		return 0
+	}
+	i := int(deliveries) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(backoff) {
+		i = len(backoff) - 1
+	}
+	return backoff[i]
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// dlqSourceStream extracts the source stream name from a DLQ subject.
+func dlqSourceStream(subject string) string {
+	rest := strings.TrimPrefix(subject, dlqSubjectPrefix)
+	if i := strings.IndexByte(rest, '.'); i >= 0 {
+		return rest[:i]
+	}
+	return rest
+}
+
+// dlqTenant extracts the tenant a dead letter belongs to from its subject.
+func dlqTenant(subject string) string {
+	parts := strings.SplitN(strings.TrimPrefix(subject, dlqSubjectPrefix), ".", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,357 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DeadLetter is a dead-lettered message as exposed by the admin API.
+type DeadLetter struct {
+	Sequence        uint64            `json:"sequence"`
+	Stream          string            `json:"stream"`
+	Consumer        string            `json:"consumer"`
+	OriginalSubject string            `json:"originalSubject"`
+	Error           string            `json:"error"`
+	Deliveries      int               `json:"deliveries"`
+	FailedAt        string            `json:"failedAt"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Data            json.RawMessage   `json:"data"`
+}
+
+// DeadLetterQueue inspects and requeues messages in the DLQ stream.
+type DeadLetterQueue struct {
+	js     jetstream.JetStream
+	logger *logger.Logger
+}
+
+func NewDeadLetterQueue(js jetstream.JetStream, log *logger.Logger) *DeadLetterQueue {
+	return &DeadLetterQueue{js: js, logger: log}
+}
+
+// DeadLetterQueue returns an admin view of the DLQ, or nil without JetStream.
+func (s *Subscriber) DeadLetterQueue() *DeadLetterQueue {
+	if s.js == nil {
+		return nil
+	}
+	return NewDeadLetterQueue(s.js, s.logger)
+}
+
+// Depth returns the number of dead letters per source stream.
+func (q *DeadLetterQueue) Depth(ctx context.Context) (map[string]uint64, error) {
+	return q.depth(ctx, dlqSubjectPrefix+">")
+}
+
+// TenantDepth returns the number of tenantID's dead letters per source
+// stream.
+func (q *DeadLetterQueue) TenantDepth(ctx context.Context, tenantID string) (map[string]uint64, error) {
+	return q.depth(ctx, dlqSubjectPrefix+"*."+tenantID+".>")
+}
+
+func (q *DeadLetterQueue) depth(ctx context.Context, filter string) (map[string]uint64, error) {
+	stream, err := EnsureDLQStream(ctx, q.js)
+	if err != nil {
+		return nil, err
+	}
+	info, err := stream.Info(ctx, jetstream.WithSubjectFilter(filter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DLQ info: %w", err)
+	}
+
+	depth := make(map[string]uint64)
+	for subject, count := range info.State.Subjects {
+		depth[dlqSourceStream(subject)] += count
+	}
+	return depth, nil
+}
+
+// List returns up to limit of tenantID's dead letters, oldest first. An
+// empty stream name lists those of every stream.
+func (q *DeadLetterQueue) List(ctx context.Context, tenantID, stream string, limit int) ([]DeadLetter, error) {
+	dlq, err := EnsureDLQStream(ctx, q.js)
+	if err != nil {
+		return nil, err
+	}
+
+	if stream == "" {
+		stream = "*"
+	}
+	filter := dlqSubjectPrefix + stream + "." + tenantID + ".>"
+
+	consumer, err := dlq.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{filter},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DLQ: %w", err)
+	}
+
+	batch, err := consumer.FetchNoWait(limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DLQ: %w", err)
+	}
+
+	letters := make([]DeadLetter, 0, limit)
+	for msg := range batch.Messages() {
+		md, err := msg.Metadata()
+		if err != nil {
+			continue
+		}
+		letters = append(letters, toDeadLetter(md.Sequence.Stream, msg.Headers(), msg.Data()))
+	}
+	if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+		return letters, fmt.Errorf("failed to read DLQ: %w", err)
+	}
+	return letters, nil
+}
+
+// Get returns one of tenantID's dead letters.
+func (q *DeadLetterQueue) Get(ctx context.Context, tenantID string, seq uint64) (*DeadLetter, error) {
+	raw, err := q.getRaw(ctx, tenantID, seq)
+	if err != nil {
+		return nil, err
+	}
+	letter := toDeadLetter(raw.Sequence, raw.Header, raw.Data)
+	return &letter, nil
+}
+
+// Requeue republishes one of tenantID's dead letters to its original subject
+// and removes it from the DLQ.
+func (q *DeadLetterQueue) Requeue(ctx context.Context, tenantID string, seq uint64) error {
+	raw, err := q.getRaw(ctx, tenantID, seq)
+	if err != nil {
+		return err
+	}
+
+	subject := raw.Header.Get(HeaderDLQSubject)
+	if subject == "" {
+		return fmt.Errorf("dead letter %d has no original subject", seq)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = raw.Data
+	for key, values := range raw.Header {
+		if strings.HasPrefix(key, "dlq-") || key == jetstream.MsgIDHeader {
+			continue
+		}
+		for _, v := range values {
+			msg.Header.Add(key, v)
+		}
+	}
+
+	if _, err := q.js.PublishMsg(ctx, msg); err != nil {
+		return fmt.Errorf("failed to requeue dead letter: %w", err)
+	}
+
+	if err := q.delete(ctx, seq); err != nil {
+		return err
+	}
+
+	q.logger.Info("Requeued dead letter", "sequence", seq, "subject", subject, "tenant_id", tenantID)
+	return nil
+}
+
+// Delete discards one of tenantID's dead letters.
+func (q *DeadLetterQueue) Delete(ctx context.Context, tenantID string, seq uint64) error {
+	if _, err := q.getRaw(ctx, tenantID, seq); err != nil {
+		return err
+	}
+	return q.delete(ctx, seq)
+}
+
+func (q *DeadLetterQueue) delete(ctx context.Context, seq uint64) error {
+	stream, err := EnsureDLQStream(ctx, q.js)
+	if err != nil {
+		return err
+	}
+	if err := stream.DeleteMsg(ctx, seq); err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return ErrDeadLetterNotFound
+		}
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+	return nil
+}
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// getRaw returns the dead letter at seq. Those of other tenants are
+// reported as not found.
+func (q *DeadLetterQueue) getRaw(ctx context.Context, tenantID string, seq uint64) (*jetstream.RawStreamMsg, error) {
+	stream, err := EnsureDLQStream(ctx, q.js)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := stream.GetMsg(ctx, seq)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+	if dlqTenant(raw.Subject) != tenantID {
+		return nil, ErrDeadLetterNotFound
+	}
+	return raw, nil
+}
+
+// Monitor exports DLQ depth per stream and logs an alert whenever a stream's
+// depth is above threshold. It runs until ctx is cancelled.
+func (q *DeadLetterQueue) Monitor(ctx context.Context, interval time.Duration, threshold uint64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		depth, err := q.Depth(ctx)
+		if err != nil {
+			q.logger.Warn("Failed to read DLQ depth", "error", err)
+		}
+		for stream, count := range depth {
+			metrics.SetDLQDepth(stream, count)
+			if threshold > 0 && count > threshold {
+				q.logger.Error("Dead-letter queue depth above threshold",
+					"stream", stream,
+					"depth", count,
+					"threshold", threshold,
+				)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Handler serves the DLQ admin API under /admin/dlq:
+//
+//	GET    /admin/dlq                          depth per stream
+//	GET    /admin/dlq/messages?stream=&limit=  list dead letters
+//	GET    /admin/dlq/messages/{seq}           one dead letter
+//	POST   /admin/dlq/messages/{seq}/requeue   republish to the original subject
+//	DELETE /admin/dlq/messages/{seq}           discard
+//
+// It runs behind the tenant middleware and needs middleware.AdminPermission.
+// Only the dead letters of the caller's tenant are counted, listed or
+// changed; those of other tenants are reported as not found.
+func (q *DeadLetterQueue) Handler() http.Handler {
+	return middleware.RequirePermission(middleware.AdminPermission, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/dlq"), "/")
+		parts := strings.Split(path, "/")
+		tenantID := middleware.GetTenantID(r.Context())
+		if tenantID == "" || strings.ContainsAny(tenantID, ".*> ") {
+			httpresponse.ErrorStatus(w, r, http.StatusForbidden, "access token is not bound to a tenant")
+			return
+		}
+
+		switch {
+		case path == "" && r.Method == http.MethodGet:
+			depth, err := q.TenantDepth(r.Context(), tenantID)
+			if err != nil {
+				q.writeError(w, r, err)
+				return
+			}
+			var total uint64
+			for _, count := range depth {
+				total += count
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{
+				"total":   total,
+				"streams": depth,
+			})
+
+		case path == "messages" && r.Method == http.MethodGet:
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			if limit <= 0 || limit > 500 {
+				limit = 50
+			}
+			letters, err := q.List(r.Context(), tenantID, r.URL.Query().Get("stream"), limit)
+			if err != nil {
+				q.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": letters})
+
+		case len(parts) >= 2 && parts[0] == "messages":
+			seq, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invalid sequence")
+				return
+			}
+
+			switch {
+			case len(parts) == 2 && r.Method == http.MethodGet:
+				letter, err := q.Get(r.Context(), tenantID, seq)
+				if err != nil {
+					q.writeError(w, r, err)
+					return
+				}
+				httpresponse.JSON(w, http.StatusOK, letter)
+			case len(parts) == 2 && r.Method == http.MethodDelete:
+				if err := q.Delete(r.Context(), tenantID, seq); err != nil {
+					q.writeError(w, r, err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			case len(parts) == 3 && parts[2] == "requeue" && r.Method == http.MethodPost:
+				if err := q.Requeue(r.Context(), tenantID, seq); err != nil {
+					q.writeError(w, r, err)
+					return
+				}
+				httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"sequence": seq, "status": "requeued"})
+			default:
+				httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			}
+
+		default:
+			httpresponse.ErrorStatus(w, r, http.StatusNotFound, "not found")
+		}
+	}))
+}
+
+func (q *DeadLetterQueue) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrDeadLetterNotFound) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	q.logger.Error("DLQ admin request failed", "error", err)
+	httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "dead-letter queue unavailable")
+}
+
+func toDeadLetter(seq uint64, header nats.Header, data []byte) DeadLetter {
+	deliveries, _ := strconv.Atoi(header.Get(HeaderDLQDeliveries))
+	letter := DeadLetter{
+		Sequence:        seq,
+		Stream:          header.Get(HeaderDLQStream),
+		Consumer:        header.Get(HeaderDLQConsumer),
+		OriginalSubject: header.Get(HeaderDLQSubject),
+		Error:           header.Get(HeaderDLQError),
+		Deliveries:      deliveries,
+		FailedAt:        header.Get(HeaderDLQFailedAt),
+		Headers:         make(map[string]string),
+	}
+	for key := range header {
+		if !strings.HasPrefix(key, "dlq-") {
+			letter.Headers[key] = header.Get(key)
+		}
+	}
+	if json.Valid(data) {
+		letter.Data = data
+	} else {
+		letter.Data, _ = json.Marshal(string(data))
+	}
+	return letter
+}
@@ -0,0 +1,149 @@
+package messaging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeJetStream serves the DLQ stream from memory. Methods the admin API
+// does not use panic through the nil embedded interfaces.
+type fakeJetStream struct {
+	jetstream.JetStream
+	dlq       *fakeStream
+	published []*nats.Msg
+}
+
+func (f *fakeJetStream) Stream(ctx context.Context, name string) (jetstream.Stream, error) {
+	return f.dlq, nil
+}
+
+func (f *fakeJetStream) PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	f.published = append(f.published, msg)
+	return &jetstream.PubAck{}, nil
+}
+
+type fakeStream struct {
+	jetstream.Stream
+	msgs map[uint64]*jetstream.RawStreamMsg
+}
+
+func (s *fakeStream) GetMsg(ctx context.Context, seq uint64, opts ...jetstream.GetMsgOpt) (*jetstream.RawStreamMsg, error) {
+	msg, ok := s.msgs[seq]
+	if !ok {
+		return nil, jetstream.ErrMsgNotFound
+	}
+	return msg, nil
+}
+
+func (s *fakeStream) DeleteMsg(ctx context.Context, seq uint64) error {
+	if _, ok := s.msgs[seq]; !ok {
+		return jetstream.ErrMsgNotFound
+	}
+	delete(s.msgs, seq)
+	return nil
+}
+
+func deadLetterMsg(seq uint64, tenantID, subject string) *jetstream.RawStreamMsg {
+	header := nats.Header{}
+	header.Set(HeaderTenantID, tenantID)
+	header.Set(HeaderDLQSubject, subject)
+	header.Set(HeaderDLQStream, "CLIENT_EVENTS")
+	header.Set(HeaderDLQError, "boom")
+	return &jetstream.RawStreamMsg{
+		Subject:  DLQSubject("CLIENT_EVENTS", tenantID, subject),
+		Sequence: seq,
+		Header:   header,
+		Data:     []byte(`{"id":"evt-1"}`),
+	}
+}
+
+func newTestDLQ(t *testing.T) (*DeadLetterQueue, *fakeJetStream) {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	js := &fakeJetStream{dlq: &fakeStream{msgs: map[uint64]*jetstream.RawStreamMsg{
+		1: deadLetterMsg(1, "tenant-a", "evt.Client.client.created"),
+		2: deadLetterMsg(2, "tenant-b", "evt.Client.client.updated"),
+	}}}
+	return NewDeadLetterQueue(js, log), js
+}
+
+func dlqRequest(method, path string, permissions ...string) *http.Request {
+	ctx := middleware.WithIdentity(context.Background(), "tenant-a", "user-1", permissions)
+	return httptest.NewRequest(method, path, nil).WithContext(ctx)
+}
+
+func TestDLQSubject(t *testing.T) {
+	subject := DLQSubject("CLIENT_EVENTS", "tenant-a", "evt.Client.client.created")
+	assert.Equal(t, "dlq.CLIENT_EVENTS.tenant-a.evt.Client.client.created", subject)
+	assert.Equal(t, "CLIENT_EVENTS", dlqSourceStream(subject))
+	assert.Equal(t, "tenant-a", dlqTenant(subject))
+
+	for _, tenantID := range []string{"", "a.b", "*", ">"} {
+		assert.Equal(t, dlqNoTenant, dlqTenant(DLQSubject("CLIENT_EVENTS", tenantID, "evt.x")), tenantID)
+	}
+}
+
+func TestDeadLetterQueueHandler_RequiresAdminPermission(t *testing.T) {
+	dlq, js := newTestDLQ(t)
+
+	for _, req := range []*http.Request{
+		dlqRequest(http.MethodGet, "/admin/dlq"),
+		dlqRequest(http.MethodGet, "/admin/dlq/messages/1", "client:read"),
+		dlqRequest(http.MethodPost, "/admin/dlq/messages/1/requeue", "*:read"),
+		dlqRequest(http.MethodDelete, "/admin/dlq/messages/1"),
+	} {
+		rec := httptest.NewRecorder()
+		dlq.Handler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code, req.Method+" "+req.URL.Path)
+	}
+	assert.Len(t, js.dlq.msgs, 2)
+	assert.Empty(t, js.published)
+}
+
+func TestDeadLetterQueueHandler_ScopedToTenant(t *testing.T) {
+	dlq, js := newTestDLQ(t)
+
+	rec := httptest.NewRecorder()
+	dlq.Handler().ServeHTTP(rec, dlqRequest(http.MethodGet, "/admin/dlq/messages/1", middleware.AdminPermission))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "evt.Client.client.created")
+
+	for _, req := range []*http.Request{
+		dlqRequest(http.MethodGet, "/admin/dlq/messages/2", middleware.AdminPermission),
+		dlqRequest(http.MethodPost, "/admin/dlq/messages/2/requeue", middleware.AdminPermission),
+		dlqRequest(http.MethodDelete, "/admin/dlq/messages/2", middleware.AdminPermission),
+	} {
+		rec := httptest.NewRecorder()
+		dlq.Handler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code, req.Method+" "+req.URL.Path)
+		assert.NotContains(t, rec.Body.String(), "evt.Client.client.updated")
+	}
+	assert.Contains(t, js.dlq.msgs, uint64(2))
+	assert.Empty(t, js.published)
+}
+
+func TestDeadLetterQueueHandler_RequeueOwnDeadLetter(t *testing.T) {
+	dlq, js := newTestDLQ(t)
+
+	rec := httptest.NewRecorder()
+	dlq.Handler().ServeHTTP(rec, dlqRequest(http.MethodPost, "/admin/dlq/messages/1/requeue", middleware.AdminPermission))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	require.Len(t, js.published, 1)
+	assert.Equal(t, "evt.Client.client.created", js.published[0].Subject)
+	assert.Equal(t, "tenant-a", js.published[0].Header.Get(HeaderTenantID))
+	assert.Empty(t, js.published[0].Header.Get(HeaderDLQError))
+	assert.NotContains(t, js.dlq.msgs, uint64(1))
+
+	rec = httptest.NewRecorder()
+	dlq.Handler().ServeHTTP(rec, dlqRequest(http.MethodDelete, "/admin/dlq/messages/1", middleware.AdminPermission))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
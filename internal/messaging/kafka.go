@@ -0,0 +1,275 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrKafkaUnavailable is returned when the binary was built without the
+// Kafka client; build with `-tags kafka` to include it.
+var ErrKafkaUnavailable = errors.New("kafka transport is not compiled in; build with -tags kafka")
+
+// KafkaRecord is a record produced to or consumed from a topic.
+type KafkaRecord struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// KafkaClient is the part of a Kafka client the transport uses. The franz-go
+// implementation lives in kafka_franz.go.
+type KafkaClient interface {
+	// Produce writes rec and waits for it to be acknowledged. Records with
+	// the same key go to the same partition.
+	Produce(ctx context.Context, rec *KafkaRecord) error
+	// Consume joins group, reads the topics matching topics, a regular
+	// expression, and calls handle for each record in partition order,
+	// committing offsets after handle returns. It blocks until ctx is done
+	// or the group session fails.
+	Consume(ctx context.Context, group, topics string, handle func(ctx context.Context, rec *KafkaRecord)) error
+	Ping(ctx context.Context) error
+	Close()
+}
+
+// newKafkaClient is replaced by kafka_franz.go when built with the kafka tag.
+var newKafkaClient = func(cfg config.KafkaConfig) (KafkaClient, error) {
+	return nil, ErrKafkaUnavailable
+}
+
+// KafkaTransport publishes and consumes over Kafka. Events go to one topic
+// per aggregate type, keyed by aggregate ID, so each aggregate's events stay
+// in one partition and are consumed in order. Subscriptions are consumer
+// groups with committed offsets: a group resumes where it stopped, and each
+// partition is read by one member at a time.
+type KafkaTransport struct {
+	client      KafkaClient
+	topicPrefix string
+	logger      *logger.Logger
+
+	mu        sync.Mutex
+	consumers []context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func NewKafkaTransport(cfg config.KafkaConfig, log *logger.Logger) (*KafkaTransport, error) {
+	client, err := newKafkaClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	return newKafkaTransport(client, cfg.TopicPrefix, log), nil
+}
+
+func newKafkaTransport(client KafkaClient, topicPrefix string, log *logger.Logger) *KafkaTransport {
+	return &KafkaTransport{client: client, topicPrefix: topicPrefix, logger: log}
+}
+
+func (t *KafkaTransport) PublishEvent(ctx context.Context, event *events.EventEnvelope) error {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = event.TraceContext(ctx)
+	}
+	ctx, span := otel.Tracer("messaging").Start(ctx, "kafka.publish.event",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("event.type", event.Type),
+			attribute.String("event.aggregate_id", event.AggregateID),
+			attribute.String("event.tenant_id", event.TenantID),
+		),
+	)
+	defer span.End()
+
+	event.InjectTraceContext(ctx)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	rec := &KafkaRecord{
+		Topic: t.topicPrefix + "evt." + event.AggregateType,
+		Key:   event.AggregateID,
+		Value: data,
+		Headers: map[string]string{
+			"subject":        event.Subject(),
+			"event-id":       event.ID,
+			"event-type":     event.Type,
+			"aggregate-id":   event.AggregateID,
+			"aggregate-type": event.AggregateType,
+			"tenant-id":      event.TenantID,
+			"user-id":        event.UserID,
+			"trace-id":       span.SpanContext().TraceID().String(),
+		},
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(rec.Headers))
+
+	if err := t.client.Produce(ctx, rec); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to publish event to Kafka: %w", err)
+	}
+
+	t.logger.New(ctx).Debug("Published event",
+		"event_type", event.Type,
+		"aggregate_id", event.AggregateID,
+		"topic", rec.Topic,
+	)
+	return nil
+}
+
+func (t *KafkaTransport) PublishCommandOutcome(ctx context.Context, outcome *commands.CommandOutcome) error {
+	data, err := json.Marshal(outcome)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command outcome: %w", err)
+	}
+
+	key := outcome.TargetID
+	if key == "" {
+		key = outcome.CommandID
+	}
+	rec := &KafkaRecord{
+		Topic: t.topicPrefix + "cmdresult",
+		Key:   key,
+		Value: data,
+		Headers: map[string]string{
+			"subject":      outcome.Subject(),
+			"command-type": outcome.Type,
+			"tenant-id":    outcome.TenantID,
+			"user-id":      outcome.UserID,
+		},
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(rec.Headers))
+
+	if err := t.client.Produce(ctx, rec); err != nil {
+		return fmt.Errorf("failed to publish command outcome: %w", err)
+	}
+	return nil
+}
+
+// SubscribeGroup consumes the topics subject maps to as group, restarting
+// the group session if it fails, until ctx is done or the transport closes.
+func (t *KafkaTransport) SubscribeGroup(ctx context.Context, subject, group string, handler DeliveryHandler) error {
+	topics, err := t.topicsFor(subject)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.mu.Lock()
+	t.consumers = append(t.consumers, cancel)
+	t.mu.Unlock()
+
+	handle := func(ctx context.Context, rec *KafkaRecord) {
+		d := &Delivery{
+			Subject: rec.Headers["subject"],
+			Key:     rec.Key,
+			Data:    rec.Value,
+			Headers: rec.Headers,
+		}
+		if !subjectMatches(subject, d.Subject) {
+			return
+		}
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(rec.Headers))
+		if err := handler(ctx, d); err != nil {
+			t.logger.Error("Failed to handle message", "error", err, "subject", d.Subject, "group", group)
+		}
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		backoff := time.Second
+		for {
+			err := t.client.Consume(ctx, group, topics, handle)
+			if ctx.Err() != nil {
+				return
+			}
+			t.logger.Warn("Kafka consumer stopped; rejoining", "error", err, "group", group, "topics", topics)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+		}
+	}()
+	return nil
+}
+
+// topicsFor returns the regular expression matching the topics that carry
+// messages on subject.
+func (t *KafkaTransport) topicsFor(subject string) (string, error) {
+	tokens := strings.Split(subject, ".")
+	prefix := regexp.QuoteMeta(t.topicPrefix)
+	switch tokens[0] {
+	case "evt":
+		if len(tokens) < 2 {
+			return "", fmt.Errorf("unsupported subject %q", subject)
+		}
+		if tokens[1] == "*" || tokens[1] == ">" {
+			return "^" + prefix + `evt\.[^.]+$`, nil
+		}
+		return "^" + prefix + regexp.QuoteMeta("evt."+tokens[1]) + "$", nil
+	case "cmdresult":
+		return "^" + prefix + "cmdresult$", nil
+	default:
+		return "", fmt.Errorf("unsupported subject %q", subject)
+	}
+}
+
+// Drain stops the consumers and waits for in-flight handlers; offsets of
+// records handled so far are committed, so the group resumes after them.
+func (t *KafkaTransport) Drain(ctx context.Context) error {
+	t.mu.Lock()
+	for _, cancel := range t.consumers {
+		cancel()
+	}
+	t.consumers = nil
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *KafkaTransport) Connected() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return t.client.Ping(ctx) == nil
+}
+
+// Close stops the consumers, waiting for in-flight handlers, and closes the
+// client.
+func (t *KafkaTransport) Close() error {
+	t.mu.Lock()
+	for _, cancel := range t.consumers {
+		cancel()
+	}
+	t.consumers = nil
+	t.mu.Unlock()
+	t.wg.Wait()
+	t.client.Close()
+	return nil
+}
@@ -0,0 +1,130 @@
+//go:build kafka
+
+package messaging
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+func init() {
+	newKafkaClient = newFranzClient
+}
+
+// franzClient implements KafkaClient with franz-go. Producing uses one
+// shared client; each consumer group gets its own client, since franz-go
+// binds a client to one group.
+type franzClient struct {
+	opts     []kgo.Opt
+	producer *kgo.Client
+}
+
+func newFranzClient(cfg config.KafkaConfig) (KafkaClient, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ClientID(cfg.ClientID),
+		kgo.DialTimeout(cfg.DialTimeout),
+	}
+	switch cfg.SASLMechanism {
+	case "PLAIN":
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.Username, Pass: cfg.Password}.AsMechanism()))
+	case "SCRAM-SHA-256":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha256Mechanism()))
+	case "SCRAM-SHA-512":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha512Mechanism()))
+	}
+	if cfg.TLSEnabled {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+
+	// The default partitioner hashes the key, and idempotent writes keep a
+	// partition's records in the order they were produced across retries.
+	producer, err := kgo.NewClient(append(opts[:len(opts):len(opts)],
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.AllowAutoTopicCreation(),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	return &franzClient{opts: opts, producer: producer}, nil
+}
+
+func (c *franzClient) Produce(ctx context.Context, rec *KafkaRecord) error {
+	r := &kgo.Record{Topic: rec.Topic, Key: []byte(rec.Key), Value: rec.Value}
+	for k, v := range rec.Headers {
+		r.Headers = append(r.Headers, kgo.RecordHeader{Key: k, Value: []byte(v)})
+	}
+	return c.producer.ProduceSync(ctx, r).FirstErr()
+}
+
+func (c *franzClient) Consume(ctx context.Context, group, topics string, handle func(ctx context.Context, rec *KafkaRecord)) error {
+	client, err := kgo.NewClient(append(c.opts[:len(c.opts):len(c.opts)],
+		kgo.ConsumerGroup(group),
+		kgo.ConsumeTopics(topics),
+		kgo.ConsumeRegex(),
+		kgo.DisableAutoCommit(),
+		kgo.BlockRebalanceOnPoll(),
+	)...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for {
+		fetches := client.PollFetches(ctx)
+		if fetches.IsClientClosed() || ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var fetchErr error
+		fetches.EachError(func(topic string, partition int32, err error) {
+			fetchErr = fmt.Errorf("fetch %s[%d]: %w", topic, partition, err)
+		})
+		if fetchErr != nil {
+			client.AllowRebalance()
+			return fetchErr
+		}
+
+		// Partitions are handled one after another and records in offset
+		// order, which keeps each aggregate's events in order.
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			for _, r := range p.Records {
+				rec := &KafkaRecord{
+					Topic:   r.Topic,
+					Key:     string(r.Key),
+					Value:   r.Value,
+					Headers: make(map[string]string, len(r.Headers)),
+				}
+				for _, h := range r.Headers {
+					rec.Headers[h.Key] = string(h.Value)
+				}
+				handle(ctx, rec)
+			}
+		})
+
+		// Records handled before a drain are committed even though ctx is
+		// already cancelled, so the group resumes after them.
+		commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		err := client.CommitUncommittedOffsets(commitCtx)
+		cancel()
+		client.AllowRebalance()
+		if err != nil {
+			return fmt.Errorf("commit offsets: %w", err)
+		}
+	}
+}
+
+func (c *franzClient) Ping(ctx context.Context) error {
+	return c.producer.Ping(ctx)
+}
+
+func (c *franzClient) Close() {
+	c.producer.Close()
+}
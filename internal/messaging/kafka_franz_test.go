@@ -0,0 +1,131 @@
+//go:build kafka
+
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/kafka"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const kafkaImage = "confluentinc/confluent-local:7.5.0"
+
+// startKafka runs a single broker for the test and returns a config for it.
+// It needs a Docker daemon.
+func startKafka(t *testing.T) config.KafkaConfig {
+	if testing.Short() {
+		t.Skip("skipping Kafka container test in short mode")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	ctr, err := kafka.Run(ctx, kafkaImage, kafka.WithClusterID("ims-erp-test"))
+	testcontainers.CleanupContainer(t, ctr)
+	require.NoError(t, err)
+	brokers, err := ctr.Brokers(ctx)
+	require.NoError(t, err)
+
+	return config.KafkaConfig{
+		Brokers:     brokers,
+		ClientID:    "messaging-test",
+		TopicPrefix: "erp.",
+		DialTimeout: 10 * time.Second,
+	}
+}
+
+func newFranzTransport(t *testing.T, cfg config.KafkaConfig) *KafkaTransport {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	transport, err := NewKafkaTransport(cfg, log)
+	require.NoError(t, err)
+	t.Cleanup(func() { transport.Close() })
+	return transport
+}
+
+// received collects the deliveries of a subscription.
+type received struct {
+	mu         sync.Mutex
+	deliveries []*Delivery
+}
+
+func (r *received) handle(ctx context.Context, d *Delivery) error {
+	r.mu.Lock()
+	r.deliveries = append(r.deliveries, d)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *received) subjects() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subjects := make([]string, len(r.deliveries))
+	for i, d := range r.deliveries {
+		subjects[i] = d.Subject
+	}
+	return subjects
+}
+
+func TestFranzPublishSubscribe(t *testing.T) {
+	cfg := startKafka(t)
+	transport := newFranzTransport(t, cfg)
+	ctx := context.Background()
+	require.NoError(t, transport.client.Ping(ctx))
+
+	// Publishing first creates the topic, so the regex consumer finds it
+	// when it joins and starts from the beginning.
+	var want []string
+	for i := 0; i < 5; i++ {
+		eventType := fmt.Sprintf("ClientUpdated%d", i)
+		event := events.NewEvent("client-1", "Client", eventType, "tenant-1", "user-1", map[string]interface{}{"n": i})
+		require.NoError(t, transport.PublishEvent(ctx, event))
+		want = append(want, "evt.Client."+eventType)
+	}
+	require.NoError(t, transport.PublishEvent(ctx, events.NewEvent("invoice-1", "Invoice", "InvoiceCreated", "tenant-1", "user-1", nil)))
+
+	var clients received
+	require.NoError(t, transport.SubscribeGroup(ctx, "evt.Client.>", "client-projection", clients.handle))
+
+	require.Eventually(t, func() bool { return len(clients.subjects()) == len(want) }, time.Minute, 100*time.Millisecond)
+	assert.Equal(t, want, clients.subjects(), "one aggregate's events arrive in order, other topics are not consumed")
+
+	clients.mu.Lock()
+	d := clients.deliveries[0]
+	clients.mu.Unlock()
+	assert.Equal(t, "client-1", d.Key)
+	assert.Equal(t, "tenant-1", d.Headers["tenant-id"])
+	assert.Contains(t, string(d.Data), `"aggregateId":"client-1"`)
+}
+
+func TestFranzGroupCommitsOffsets(t *testing.T) {
+	cfg := startKafka(t)
+	ctx := context.Background()
+
+	first := newFranzTransport(t, cfg)
+	require.NoError(t, first.PublishEvent(ctx, events.NewEvent("client-1", "Client", "ClientCreated", "tenant-1", "user-1", nil)))
+
+	var before received
+	require.NoError(t, first.SubscribeGroup(ctx, "evt.>", "audit-service", before.handle))
+	require.Eventually(t, func() bool { return len(before.subjects()) == 1 }, time.Minute, 100*time.Millisecond)
+	require.NoError(t, first.Drain(ctx))
+	require.NoError(t, first.Close())
+
+	// A new member of the group resumes after the committed offset.
+	second := newFranzTransport(t, cfg)
+	require.NoError(t, second.PublishEvent(ctx, events.NewEvent("client-1", "Client", "ClientUpdated", "tenant-1", "user-1", nil)))
+
+	var after received
+	require.NoError(t, second.SubscribeGroup(ctx, "evt.>", "audit-service", after.handle))
+	require.Eventually(t, func() bool { return len(after.subjects()) >= 1 }, time.Minute, 100*time.Millisecond)
+	time.Sleep(time.Second)
+	assert.Equal(t, []string{"evt.Client.ClientUpdated"}, after.subjects())
+}
@@ -0,0 +1,192 @@
+package messaging
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKafka delivers every produced record to the consumers whose topic
+// pattern matches, in produce order. Like a real client, Consume returns only
+// after the handlers it started have returned.
+type fakeKafka struct {
+	mu        sync.Mutex
+	produced  []*KafkaRecord
+	consumers []*fakeConsumer
+}
+
+type fakeConsumer struct {
+	group  string
+	topics *regexp.Regexp
+	handle func(ctx context.Context, rec *KafkaRecord)
+	ctx    context.Context
+	wg     sync.WaitGroup
+}
+
+func (f *fakeKafka) Produce(ctx context.Context, rec *KafkaRecord) error {
+	f.mu.Lock()
+	f.produced = append(f.produced, rec)
+	consumers := append([]*fakeConsumer(nil), f.consumers...)
+	f.mu.Unlock()
+	for _, c := range consumers {
+		if c.topics.MatchString(rec.Topic) {
+			c.wg.Add(1)
+			c.handle(c.ctx, rec)
+			c.wg.Done()
+		}
+	}
+	return nil
+}
+
+func (f *fakeKafka) Consume(ctx context.Context, group, topics string, handle func(ctx context.Context, rec *KafkaRecord)) error {
+	c := &fakeConsumer{group: group, topics: regexp.MustCompile(topics), handle: handle, ctx: ctx}
+	f.mu.Lock()
+	f.consumers = append(f.consumers, c)
+	f.mu.Unlock()
+	<-ctx.Done()
+	c.wg.Wait()
+	return ctx.Err()
+}
+
+func (f *fakeKafka) Ping(ctx context.Context) error { return nil }
+
+func (f *fakeKafka) Close() {}
+
+func (f *fakeKafka) waitForConsumers(t *testing.T, n int) {
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return len(f.consumers) == n
+	}, time.Second, 5*time.Millisecond)
+}
+
+func newTestKafkaTransport(t *testing.T) (*KafkaTransport, *fakeKafka) {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	client := &fakeKafka{}
+	transport := newKafkaTransport(client, "erp.", log)
+	t.Cleanup(func() { transport.Close() })
+	return transport, client
+}
+
+func TestKafkaPublishEventKeysByAggregate(t *testing.T) {
+	transport, client := newTestKafkaTransport(t)
+
+	event := events.NewEvent("client-1", "Client", "ClientCreated", "tenant-1", "user-1", map[string]interface{}{"name": "Acme"})
+	require.NoError(t, transport.PublishEvent(context.Background(), event))
+
+	require.Len(t, client.produced, 1)
+	rec := client.produced[0]
+	assert.Equal(t, "erp.evt.Client", rec.Topic)
+	assert.Equal(t, "client-1", rec.Key)
+	assert.Equal(t, "evt.Client.ClientCreated", rec.Headers["subject"])
+	assert.Equal(t, "tenant-1", rec.Headers["tenant-id"])
+}
+
+func TestKafkaPublishCommandOutcome(t *testing.T) {
+	transport, client := newTestKafkaTransport(t)
+
+	outcome := &commands.CommandOutcome{CommandID: "cmd-1", Type: "CreateClient", TenantID: "tenant-1", TargetID: "client-1"}
+	require.NoError(t, transport.PublishCommandOutcome(context.Background(), outcome))
+
+	require.Len(t, client.produced, 1)
+	assert.Equal(t, "erp.cmdresult", client.produced[0].Topic)
+	assert.Equal(t, "client-1", client.produced[0].Key)
+	assert.Equal(t, "cmdresult.CreateClient", client.produced[0].Headers["subject"])
+}
+
+func TestKafkaSubscribeGroupFiltersBySubject(t *testing.T) {
+	transport, client := newTestKafkaTransport(t)
+
+	var mu sync.Mutex
+	var all, created []string
+	require.NoError(t, transport.SubscribeGroup(context.Background(), "evt.>", "audit-service", func(ctx context.Context, d *Delivery) error {
+		mu.Lock()
+		all = append(all, d.Subject)
+		mu.Unlock()
+		return nil
+	}))
+	require.NoError(t, transport.SubscribeGroup(context.Background(), "evt.Client.ClientCreated", "welcome", func(ctx context.Context, d *Delivery) error {
+		mu.Lock()
+		created = append(created, d.Key)
+		mu.Unlock()
+		return nil
+	}))
+	client.waitForConsumers(t, 2)
+
+	publish := func(eventType, aggregateID, aggregateType string) {
+		event := events.NewEvent(aggregateID, aggregateType, eventType, "tenant-1", "user-1", nil)
+		require.NoError(t, transport.PublishEvent(context.Background(), event))
+	}
+	publish("ClientCreated", "client-1", "Client")
+	publish("ClientUpdated", "client-1", "Client")
+	publish("InvoiceCreated", "invoice-1", "Invoice")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"evt.Client.ClientCreated", "evt.Client.ClientUpdated", "evt.Invoice.InvoiceCreated"}, all)
+	assert.Equal(t, []string{"client-1"}, created)
+}
+
+func TestKafkaTopicsFor(t *testing.T) {
+	transport, _ := newTestKafkaTransport(t)
+
+	tests := []struct {
+		subject string
+		topics  string
+	}{
+		{"evt.>", `^erp\.evt\.[^.]+$`},
+		{"evt.Client.>", `^erp\.evt\.Client$`},
+		{"cmdresult.>", `^erp\.cmdresult$`},
+	}
+	for _, tt := range tests {
+		topics, err := transport.topicsFor(tt.subject)
+		require.NoError(t, err)
+		assert.Equal(t, tt.topics, topics, tt.subject)
+	}
+
+	_, err := transport.topicsFor("cmd.CreateClient")
+	assert.Error(t, err)
+}
+
+func TestSubjectMatches(t *testing.T) {
+	assert.True(t, subjectMatches("evt.>", "evt.Client.ClientCreated"))
+	assert.True(t, subjectMatches("evt.*.ClientCreated", "evt.Client.ClientCreated"))
+	assert.True(t, subjectMatches("evt.Client.ClientCreated", "evt.Client.ClientCreated"))
+	assert.False(t, subjectMatches("evt.>", "evt"))
+	assert.False(t, subjectMatches("evt.Client.>", "evt.Invoice.InvoiceCreated"))
+	assert.False(t, subjectMatches("evt.*", "evt.Client.ClientCreated"))
+}
+
+func TestKafkaDrainWaitsForHandlers(t *testing.T) {
+	transport, client := newTestKafkaTransport(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var handled bool
+	require.NoError(t, transport.SubscribeGroup(context.Background(), "evt.>", "audit-service", func(ctx context.Context, d *Delivery) error {
+		close(started)
+		<-release
+		handled = true
+		return nil
+	}))
+	client.waitForConsumers(t, 1)
+
+	go transport.PublishEvent(context.Background(), events.NewEvent("client-1", "Client", "ClientCreated", "tenant-1", "user-1", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, transport.Drain(ctx), context.DeadlineExceeded)
+
+	close(release)
+	require.NoError(t, transport.Drain(context.Background()))
+	assert.True(t, handled)
+}
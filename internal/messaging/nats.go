@@ -3,6 +3,7 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/ims-erp/system/internal/commands"
 	"github.com/ims-erp/system/internal/events"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"go.opentelemetry.io/otel"
@@ -78,8 +80,14 @@ func NewPublisher(config NATSConfig, log *logger.Logger) (*Publisher, error) {
 }
 
 func (p *Publisher) PublishEvent(ctx context.Context, event *events.EventEnvelope) error {
+	// Events relayed from the outbox carry the trace of the request that
+	// produced them; publish within that trace rather than the relay's.
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = event.TraceContext(ctx)
+	}
 	tracer := otel.Tracer("messaging")
 	ctx, span := tracer.Start(ctx, "nats.publish.event",
+		trace.WithSpanKind(trace.SpanKindProducer),
 		trace.WithAttributes(
 			attribute.String("event.type", event.Type),
 			attribute.String("event.aggregate_id", event.AggregateID),
@@ -88,6 +96,7 @@ func (p *Publisher) PublishEvent(ctx context.Context, event *events.EventEnvelop
 	)
 	defer span.End()
 
+	event.InjectTraceContext(ctx)
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
@@ -99,22 +108,29 @@ func (p *Publisher) PublishEvent(ctx context.Context, event *events.EventEnvelop
 	msg.Header.Set("event-type", event.Type)
 	msg.Header.Set("aggregate-id", event.AggregateID)
 	msg.Header.Set("aggregate-type", event.AggregateType)
-	msg.Header.Set("tenant-id", event.TenantID)
+	msg.Header.Set(HeaderTenantID, event.TenantID)
 	msg.Header.Set("user-id", event.UserID)
 	msg.Header.Set("trace-id", span.SpanContext().TraceID().String())
+	InjectTraceContext(ctx, msg.Header)
 
+	start := time.Now()
 	if p.js == nil {
 		if err := p.conn.PublishMsg(msg); err != nil {
+			metrics.ObserveNATS(subject, "publish", start, err)
 			span.RecordError(err)
 			return fmt.Errorf("failed to publish event: %w", err)
 		}
 	} else {
-		_, err := p.js.Publish(ctx, subject, data)
+		// The event ID doubles as the JetStream message ID so outbox
+		// retries are deduplicated by the server.
+		_, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(event.ID))
 		if err != nil {
+			metrics.ObserveNATS(subject, "publish", start, err)
 			span.RecordError(err)
 			return fmt.Errorf("failed to publish event to JetStream: %w", err)
 		}
 	}
+	metrics.ObserveNATS(subject, "publish", start, nil)
 
 	p.logger.New(ctx).Debug("Published event",
 		"event_type", event.Type,
@@ -128,6 +144,7 @@ func (p *Publisher) PublishEvent(ctx context.Context, event *events.EventEnvelop
 func (p *Publisher) PublishCommand(ctx context.Context, cmd *commands.CommandEnvelope) error {
 	tracer := otel.Tracer("messaging")
 	ctx, span := tracer.Start(ctx, "nats.publish.command",
+		trace.WithSpanKind(trace.SpanKindProducer),
 		trace.WithAttributes(
 			attribute.String("command.type", cmd.Type),
 			attribute.String("command.target_id", cmd.TargetID),
@@ -146,22 +163,27 @@ func (p *Publisher) PublishCommand(ctx context.Context, cmd *commands.CommandEnv
 	msg.Data = data
 	msg.Header.Set("command-type", cmd.Type)
 	msg.Header.Set("target-id", cmd.TargetID)
-	msg.Header.Set("tenant-id", cmd.TenantID)
+	msg.Header.Set(HeaderTenantID, cmd.TenantID)
 	msg.Header.Set("user-id", cmd.UserID)
 	msg.Header.Set("trace-id", span.SpanContext().TraceID().String())
+	InjectTraceContext(ctx, msg.Header)
 
+	start := time.Now()
 	if p.js == nil {
 		if err := p.conn.PublishMsg(msg); err != nil {
+			metrics.ObserveNATS(subject, "publish", start, err)
 			span.RecordError(err)
 			return fmt.Errorf("failed to publish command: %w", err)
 		}
 	} else {
-		_, err := p.js.Publish(ctx, subject, data)
+		_, err := p.js.PublishMsg(ctx, msg)
 		if err != nil {
+			metrics.ObserveNATS(subject, "publish", start, err)
 			span.RecordError(err)
 			return fmt.Errorf("failed to publish command to JetStream: %w", err)
 		}
 	}
+	metrics.ObserveNATS(subject, "publish", start, nil)
 
 	p.logger.New(ctx).Debug("Published command",
 		"command_type", cmd.Type,
@@ -172,10 +194,37 @@ func (p *Publisher) PublishCommand(ctx context.Context, cmd *commands.CommandEnv
 	return nil
 }
 
+// PublishCommandOutcome publishes on core NATS only: no stream covers
+// command outcomes, and an outcome lost while the audit service is down is
+// no worse than the command's events being its only trace.
+func (p *Publisher) PublishCommandOutcome(ctx context.Context, outcome *commands.CommandOutcome) error {
+	data, err := json.Marshal(outcome)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command outcome: %w", err)
+	}
+
+	subject := p.config.StreamPrefix + outcome.Subject()
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set("command-type", outcome.Type)
+	msg.Header.Set(HeaderTenantID, outcome.TenantID)
+	msg.Header.Set("user-id", outcome.UserID)
+	InjectTraceContext(ctx, msg.Header)
+
+	start := time.Now()
+	err = p.conn.PublishMsg(msg)
+	metrics.ObserveNATS(subject, "publish", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to publish command outcome: %w", err)
+	}
+	return nil
+}
+
 func (p *Publisher) RequestReply(ctx context.Context, subject string, data []byte, timeout time.Duration) ([]byte, error) {
 	msg := nats.NewMsg(subject)
 	msg.Data = data
 	msg.Header.Set("trace-id", trace.SpanFromContext(ctx).SpanContext().TraceID().String())
+	InjectTraceContext(ctx, msg.Header)
 
 	resp, err := p.conn.RequestMsgWithContext(ctx, msg)
 	if err != nil {
@@ -202,6 +251,8 @@ type Subscriber struct {
 	handlers map[string][]nats.MsgHandler
 	mu       sync.RWMutex
 	subs     []*nats.Subscription
+	// consumers are the durable JetStream consumers started by Consume.
+	consumers []ConsumerSpec
 }
 
 func NewSubscriber(config NATSConfig, log *logger.Logger) (*Subscriber, error) {
@@ -244,7 +295,7 @@ func (s *Subscriber) Subscribe(subject string, handler nats.MsgHandler) error {
 
 	s.handlers[subject] = append(s.handlers[subject], handler)
 
-	sub, err := s.conn.Subscribe(subject, handler)
+	sub, err := s.conn.Subscribe(subject, instrumentHandler(handler))
 	if err != nil {
 		return fmt.Errorf("failed to subscribe: %w", err)
 	}
@@ -259,7 +310,7 @@ func (s *Subscriber) SubscribeQueue(subject, queue string, handler nats.MsgHandl
 
 	s.handlers[subject] = append(s.handlers[subject], handler)
 
-	sub, err := s.conn.QueueSubscribe(subject, queue, handler)
+	sub, err := s.conn.QueueSubscribe(subject, queue, instrumentHandler(handler))
 	if err != nil {
 		return fmt.Errorf("failed to subscribe to queue: %w", err)
 	}
@@ -289,6 +340,15 @@ func (s *Subscriber) SubscribeJetStream(ctx context.Context, streamName, consume
 	return nil
 }
 
+// instrumentHandler records consume count and handler duration per subject.
+func instrumentHandler(handler nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		start := time.Now()
+		handler(msg)
+		metrics.ObserveNATS(msg.Subject, "consume", start, nil)
+	}
+}
+
 func (s *Subscriber) UnsubscribeAll() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -299,12 +359,96 @@ func (s *Subscriber) UnsubscribeAll() {
 	s.subs = make([]*nats.Subscription, 0)
 }
 
+// Drain unsubscribes from every subject, JetStream consumers included, lets
+// handlers finish the messages already received and closes the connection.
+// It returns ctx's error if that takes longer than ctx allows.
+func (s *Subscriber) Drain(ctx context.Context) error {
+	if s.conn.IsClosed() {
+		return nil
+	}
+	if err := s.conn.Drain(); err != nil {
+		return fmt.Errorf("failed to drain NATS connection: %w", err)
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for !s.conn.IsClosed() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 func (s *Subscriber) Close() error {
 	s.UnsubscribeAll()
 	s.conn.Close()
 	return nil
 }
 
+// ConsumerPending returns how many messages a durable JetStream consumer has
+// not yet processed: those not delivered plus those awaiting an ack.
+func (s *Subscriber) ConsumerPending(ctx context.Context, stream, consumer string) (uint64, error) {
+	if s.js == nil {
+		return 0, errors.New("JetStream is not enabled")
+	}
+	c, err := s.js.Consumer(ctx, stream, consumer)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get consumer: %w", err)
+	}
+	info, err := c.Info(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get consumer info: %w", err)
+	}
+	return info.NumPending + uint64(info.NumAckPending), nil
+}
+
+// PauseConsumer stops the server delivering to a durable JetStream consumer
+// on every replica for at most d, and waits until the messages already
+// delivered are acked. It returns a function that resumes the consumer; if
+// that is never called the server resumes it once d has passed.
+func (s *Subscriber) PauseConsumer(ctx context.Context, stream, consumer string, d time.Duration) (func(), error) {
+	if s.js == nil {
+		return nil, errors.New("JetStream is not enabled")
+	}
+	if _, err := s.js.PauseConsumer(ctx, stream, consumer, time.Now().Add(d)); err != nil {
+		return nil, fmt.Errorf("failed to pause consumer: %w", err)
+	}
+	resume := func() {
+		if _, err := s.js.ResumeConsumer(context.Background(), stream, consumer); err != nil {
+			s.logger.Error("Failed to resume consumer", "stream", stream, "consumer", consumer, "error", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		c, err := s.js.Consumer(ctx, stream, consumer)
+		if err != nil {
+			resume()
+			return nil, fmt.Errorf("failed to get consumer: %w", err)
+		}
+		info, err := c.Info(ctx)
+		if err != nil {
+			resume()
+			return nil, fmt.Errorf("failed to get consumer info: %w", err)
+		}
+		if info.NumAckPending == 0 {
+			return resume, nil
+		}
+		select {
+		case <-ctx.Done():
+			resume()
+			return nil, fmt.Errorf("consumer still had messages in flight: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
 func (s *Subscriber) Connected() bool {
 	return s.conn.IsConnected()
 }
@@ -320,6 +464,41 @@ func InjectTraceID(ctx context.Context, headers nats.Header) {
 	}
 }
 
+// InjectTraceContext writes the W3C trace context of ctx into headers.
+func InjectTraceContext(ctx context.Context, headers nats.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+}
+
+// ExtractTraceContext returns ctx with the remote span context found in
+// headers, if any.
+func ExtractTraceContext(ctx context.Context, headers nats.Header) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(headers))
+}
+
+// MessageContext is the starting context for handling a core NATS message.
+func MessageContext(msg *nats.Msg) context.Context {
+	return ExtractTraceContext(context.Background(), msg.Header)
+}
+
+// headerCarrier adapts nats.Header, whose keys are not canonicalized, to the
+// propagation API.
+type headerCarrier nats.Header
+
+func (c headerCarrier) Get(key string) string { return nats.Header(c).Get(key) }
+
+func (c headerCarrier) Set(key, value string) { nats.Header(c).Set(key, value) }
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 func SetupTracePropagation() {
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
 		propagation.TraceContext{},
@@ -358,6 +537,36 @@ func (p *Publisher) CreateStream(ctx context.Context, cfg StreamConfig) error {
 	return err
 }
 
+// EnsureStream creates the stream if it does not exist yet; an existing
+// stream is left untouched.
+func (s *Subscriber) EnsureStream(ctx context.Context, cfg StreamConfig) error {
+	if s.js == nil {
+		return fmt.Errorf("JetStream not enabled")
+	}
+
+	if _, err := s.js.Stream(ctx, cfg.Name); err == nil {
+		return nil
+	} else if !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return fmt.Errorf("failed to get stream: %w", err)
+	}
+
+	_, err := s.js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:      cfg.Name,
+		Subjects:  cfg.Subjects,
+		Retention: cfg.Retention,
+		MaxAge:    cfg.MaxAge,
+		MaxBytes:  cfg.MaxBytes,
+		MaxMsgs:   cfg.MaxMsgs,
+		Storage:   cfg.Storage,
+		Replicas:  cfg.Replicas,
+		Discard:   cfg.Discard,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stream: %w", err)
+	}
+	return nil
+}
+
 func (p *Publisher) CreateConsumer(ctx context.Context, streamName, consumerName string, cfg ConsumerConfig) error {
 	if p.js == nil {
 		return fmt.Errorf("JetStream not enabled")
@@ -0,0 +1,155 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	metrics.Initialize("test")
+
+	var handled []string
+	handler := instrumentHandler(func(msg *nats.Msg) {
+		handled = append(handled, string(msg.Data))
+	})
+	handler(&nats.Msg{Subject: "cmd.invoice.send", Data: []byte("1")})
+	handler(&nats.Msg{Subject: "cmd.invoice.send", Data: []byte("2")})
+
+	assert.Equal(t, []string{"1", "2"}, handled)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.NATSMessages.WithLabelValues("cmd.invoice.send", "consume", "ok")))
+}
+
+// useTestTracing records spans and propagates W3C trace context for the
+// duration of the test.
+func useTestTracing(t *testing.T) (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return provider, recorder
+}
+
+func TestTraceContextHeaders(t *testing.T) {
+	provider, _ := useTestTracing(t)
+	ctx, span := provider.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	msg := nats.NewMsg("cmd.invoice.send")
+	InjectTraceContext(ctx, msg.Header)
+	require.NotEmpty(t, msg.Header.Get("traceparent"))
+
+	remote := trace.SpanContextFromContext(MessageContext(msg))
+	assert.True(t, remote.IsRemote())
+	assert.Equal(t, span.SpanContext().TraceID(), remote.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), remote.SpanID())
+
+	assert.False(t, trace.SpanContextFromContext(MessageContext(&nats.Msg{})).IsValid(), "messages without headers start no trace")
+}
+
+func TestPublisher_PublishEventContinuesEventTrace(t *testing.T) {
+	provider, recorder := useTestTracing(t)
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	js := &fakeJetStream{}
+	publisher := &Publisher{js: js, logger: log}
+
+	requestCtx, request := provider.Tracer("test").Start(context.Background(), "POST /api/v1/invoices")
+	event := events.NewEvent(uuid.New().String(), "invoice", "invoice.created", "tenant-a", "user-1", nil).InjectTraceContext(requestCtx)
+	request.End()
+
+	require.NoError(t, publisher.PublishEvent(context.Background(), event), "the outbox relay publishes without a trace of its own")
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	publish := spans[1]
+	assert.Equal(t, "nats.publish.event", publish.Name())
+	assert.Equal(t, trace.SpanKindProducer, publish.SpanKind())
+	assert.Equal(t, request.SpanContext().SpanID(), publish.Parent().SpanID(), "the publish continues the request's trace")
+
+	require.Len(t, js.published, 1)
+	header := js.published[0].Header
+	remote := trace.SpanContextFromContext(ExtractTraceContext(context.Background(), header))
+	assert.Equal(t, publish.SpanContext().SpanID(), remote.SpanID(), "consumers continue from the publish span")
+	assert.Equal(t, header.Get("traceparent"), event.Metadata["traceparent"], "the envelope carries the same trace as the headers")
+}
+
+// fakeJetStreamMsg is a JetStream message delivered for the first time.
+type fakeJetStreamMsg struct {
+	jetstream.Msg
+	subject string
+	header  nats.Header
+	acked   bool
+	nakked  bool
+}
+
+func (m *fakeJetStreamMsg) Subject() string      { return m.subject }
+func (m *fakeJetStreamMsg) Headers() nats.Header { return m.header }
+func (m *fakeJetStreamMsg) Ack() error           { m.acked = true; return nil }
+
+func (m *fakeJetStreamMsg) NakWithDelay(delay time.Duration) error {
+	m.nakked = true
+	return nil
+}
+
+func (m *fakeJetStreamMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: 1}, nil
+}
+
+func TestSubscriber_ProcessContinuesPublisherTrace(t *testing.T) {
+	metrics.Initialize("test")
+	provider, recorder := useTestTracing(t)
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	subscriber := &Subscriber{logger: log}
+	spec := ConsumerSpec{Stream: "INVOICE_EVENTS", Consumer: "invoice-read-projections", MaxDeliver: 5}
+
+	publishCtx, publish := provider.Tracer("test").Start(context.Background(), "nats.publish.event")
+	header := nats.Header{}
+	InjectTraceContext(publishCtx, header)
+	publish.End()
+
+	var handlerSpan trace.SpanContext
+	handled := &fakeJetStreamMsg{subject: "evt.invoice.invoice.created", header: header}
+	subscriber.process(context.Background(), spec, func(ctx context.Context, msg jetstream.Msg) error {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return nil
+	}, handled)
+
+	failure := errors.New("read model unavailable")
+	failed := &fakeJetStreamMsg{subject: "evt.invoice.invoice.created", header: header}
+	subscriber.process(context.Background(), spec, func(ctx context.Context, msg jetstream.Msg) error {
+		return failure
+	}, failed)
+
+	assert.True(t, handled.acked)
+	assert.True(t, failed.nakked)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	consume := spans[1]
+	assert.Equal(t, "nats.consume", consume.Name())
+	assert.Equal(t, publish.SpanContext().SpanID(), consume.Parent().SpanID(), "consumers continue the publisher's trace")
+	assert.Equal(t, consume.SpanContext().SpanID(), handlerSpan.SpanID(), "handlers run inside the consume span")
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
@@ -0,0 +1,212 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+)
+
+// OutboxStore persists staged events. repository.OutboxStore keeps them in
+// MongoDB and repository.PostgresOutboxStore in PostgreSQL.
+type OutboxStore interface {
+	Add(ctx context.Context, entries ...repository.OutboxEntry) error
+	Claim(ctx context.Context, limit int, lockFor time.Duration) ([]repository.OutboxEntry, error)
+	MarkDelivered(ctx context.Context, id string) error
+	MarkFailed(ctx context.Context, id string, cause error) error
+	Backlog(ctx context.Context) (int64, time.Time, error)
+}
+
+// Transactor runs fn in a transaction of the database the outbox lives in.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Outbox stages events within the caller's transaction. It satisfies
+// commands.EventOutbox.
+type Outbox struct {
+	db    Transactor
+	store OutboxStore
+	relay *OutboxRelay
+	purge func(ctx context.Context)
+}
+
+func NewOutbox(db Transactor, store OutboxStore) *Outbox {
+	return &Outbox{db: db, store: store}
+}
+
+func (o *Outbox) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return o.db.WithTransaction(ctx, fn)
+}
+
+func (o *Outbox) Enqueue(ctx context.Context, evts ...*events.EventEnvelope) error {
+	entries := make([]repository.OutboxEntry, 0, len(evts))
+	for _, event := range evts {
+		payload, err := event.InjectTraceContext(ctx).ToJSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		entries = append(entries, repository.OutboxEntry{
+			ID:          event.ID,
+			EventType:   event.Type,
+			AggregateID: event.AggregateID,
+			TenantID:    event.TenantID,
+			Payload:     payload,
+		})
+	}
+	return o.store.Add(ctx, entries...)
+}
+
+// OpenOutbox prepares the outbox collection. The returned Outbox is handed
+// to command handlers; Run relays its entries.
+func OpenOutbox(ctx context.Context, db *repository.MongoDB, publisher events.Publisher, cfg config.OutboxConfig, log *logger.Logger) (*Outbox, error) {
+	store := repository.NewOutboxStore(db, log)
+	if err := store.EnsureIndexes(ctx, cfg.Retention); err != nil {
+		return nil, err
+	}
+
+	outbox := NewOutbox(db, store)
+	outbox.relay = NewOutboxRelay(store, publisher, cfg, log)
+	return outbox, nil
+}
+
+// OpenPostgresOutbox is OpenOutbox for services whose aggregates live in
+// PostgreSQL; the outbox table is created by the Postgres migrations. While
+// Run is relaying, delivered entries older than cfg.Retention are purged
+// hourly.
+func OpenPostgresOutbox(db *repository.Postgres, publisher events.Publisher, cfg config.OutboxConfig, log *logger.Logger) *Outbox {
+	store := repository.NewPostgresOutboxStore(db, log)
+
+	outbox := NewOutbox(db, store)
+	outbox.relay = NewOutboxRelay(store, publisher, cfg, log)
+	outbox.purge = func(ctx context.Context) {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := store.PurgeDelivered(ctx, cfg.Retention); err != nil {
+					log.Warn("Failed to purge outbox", "error", err)
+				}
+			}
+		}
+	}
+	return outbox
+}
+
+// Run relays staged events until ctx is cancelled, returning once the batch
+// in progress has been published.
+func (o *Outbox) Run(ctx context.Context) {
+	if o.purge != nil {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			o.purge(ctx)
+		}()
+		defer func() { <-done }()
+	}
+	o.relay.Run(ctx)
+}
+
+// OutboxRelay polls the outbox and publishes pending entries, marking each
+// one delivered once the publish is acknowledged. Delivery is at-least-once.
+type OutboxRelay struct {
+	store     OutboxStore
+	publisher events.Publisher
+	config    config.OutboxConfig
+	logger    *logger.Logger
+}
+
+func NewOutboxRelay(store OutboxStore, publisher events.Publisher, cfg config.OutboxConfig, log *logger.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		store:     store,
+		publisher: publisher,
+		config:    cfg,
+		logger:    log,
+	}
+}
+
+// Run relays until ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	r.logger.Info("Outbox relay started", "poll_interval", r.config.PollInterval, "batch_size", r.config.BatchSize)
+
+	for {
+		r.relayPending(ctx)
+		r.reportBacklog(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayPending drains the outbox in batches until it is empty or a batch
+// comes back short.
+func (r *OutboxRelay) relayPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		entries, err := r.store.Claim(ctx, r.config.BatchSize, r.config.LockTimeout)
+		if err != nil {
+			r.logger.Error("Failed to claim outbox entries", "error", err)
+		}
+
+		for _, entry := range entries {
+			err := r.relay(ctx, entry)
+			metrics.RecordOutboxRelay(err)
+			if err != nil {
+				r.logger.Warn("Failed to relay outbox entry",
+					"outbox_id", entry.ID,
+					"event_type", entry.EventType,
+					"attempts", entry.Attempts,
+					"error", err,
+				)
+				if markErr := r.store.MarkFailed(ctx, entry.ID, err); markErr != nil {
+					r.logger.Error("Failed to release outbox entry", "outbox_id", entry.ID, "error", markErr)
+				}
+				continue
+			}
+			if err := r.store.MarkDelivered(ctx, entry.ID); err != nil {
+				r.logger.Error("Failed to mark outbox entry delivered", "outbox_id", entry.ID, "error", err)
+			}
+		}
+
+		if err != nil || len(entries) < r.config.BatchSize {
+			return
+		}
+	}
+}
+
+func (r *OutboxRelay) relay(ctx context.Context, entry repository.OutboxEntry) error {
+	var event events.EventEnvelope
+	if err := json.Unmarshal(entry.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode outbox payload: %w", err)
+	}
+	return r.publisher.PublishEvent(ctx, &event)
+}
+
+func (r *OutboxRelay) reportBacklog(ctx context.Context) {
+	pending, oldest, err := r.store.Backlog(ctx)
+	if err != nil {
+		r.logger.Warn("Failed to read outbox backlog", "error", err)
+		return
+	}
+
+	var lag time.Duration
+	if !oldest.IsZero() {
+		lag = time.Since(oldest)
+	}
+	metrics.SetOutboxBacklog(pending, lag)
+}
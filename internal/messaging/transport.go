@@ -0,0 +1,132 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/nats-io/nats.go"
+)
+
+// EventPublisher publishes events and command outcomes over the configured
+// transport. Events with the same aggregate ID are delivered in the order
+// they were published.
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, event *events.EventEnvelope) error
+	PublishCommandOutcome(ctx context.Context, outcome *commands.CommandOutcome) error
+	Connected() bool
+	Close() error
+}
+
+// EventSubscriber delivers messages to consumer groups. Each message on a
+// subject goes to one member of each group, so replicas of a service share
+// the work.
+type EventSubscriber interface {
+	// SubscribeGroup delivers messages whose subject matches subject, a
+	// NATS-style pattern where * matches one token and > the rest, to
+	// handler. Errors from handler are logged; the message is not redelivered.
+	SubscribeGroup(ctx context.Context, subject, group string, handler DeliveryHandler) error
+	// Drain stops delivering new messages and waits, until ctx is done, for
+	// handlers already running to return. Call Close afterwards.
+	Drain(ctx context.Context) error
+	Connected() bool
+	Close() error
+}
+
+// Delivery is a received message, independent of transport.
+type Delivery struct {
+	Subject string
+	// Key is the aggregate ID for events; it determines ordering.
+	Key     string
+	Data    []byte
+	Headers map[string]string
+}
+
+// DeliveryHandler processes a delivery. ctx carries the producer's trace.
+type DeliveryHandler func(ctx context.Context, d *Delivery) error
+
+// NATSConfigFrom builds the connection settings services pass to
+// NewPublisher and NewSubscriber.
+func NATSConfigFrom(cfg config.NATSConfig) NATSConfig {
+	return NATSConfig{
+		URLs:           cfg.URLs,
+		Username:       cfg.Username,
+		Password:       cfg.Password,
+		Token:          cfg.Token,
+		MaxReconnect:   cfg.MaxReconnect,
+		ReconnectWait:  cfg.ReconnectWait,
+		ConnectTimeout: cfg.ConnectTimeout,
+		JetStream:      cfg.JetStream.Enabled,
+		Domain:         cfg.JetStream.Domain,
+		StreamPrefix:   cfg.JetStream.StreamPrefix,
+	}
+}
+
+// NewEventPublisher connects to the transport selected by
+// messaging.transport.
+func NewEventPublisher(cfg *config.Config, log *logger.Logger) (EventPublisher, error) {
+	switch cfg.Messaging.Transport {
+	case "kafka":
+		return NewKafkaTransport(cfg.Messaging.Kafka, log)
+	case "", "nats":
+		return NewPublisher(NATSConfigFrom(cfg.NATS), log)
+	default:
+		return nil, fmt.Errorf("unknown messaging transport %q", cfg.Messaging.Transport)
+	}
+}
+
+// NewEventSubscriber connects to the transport selected by
+// messaging.transport.
+func NewEventSubscriber(cfg *config.Config, log *logger.Logger) (EventSubscriber, error) {
+	switch cfg.Messaging.Transport {
+	case "kafka":
+		return NewKafkaTransport(cfg.Messaging.Kafka, log)
+	case "", "nats":
+		return NewSubscriber(NATSConfigFrom(cfg.NATS), log)
+	default:
+		return nil, fmt.Errorf("unknown messaging transport %q", cfg.Messaging.Transport)
+	}
+}
+
+// SubscribeGroup joins a NATS queue group. Core NATS does not persist
+// messages, so those published while no member runs are missed, and members
+// handle messages concurrently, so per-aggregate ordering holds only within
+// one member.
+func (s *Subscriber) SubscribeGroup(ctx context.Context, subject, group string, handler DeliveryHandler) error {
+	return s.SubscribeQueue(s.config.StreamPrefix+subject, group, func(msg *nats.Msg) {
+		d := &Delivery{
+			Subject: strings.TrimPrefix(msg.Subject, s.config.StreamPrefix),
+			Key:     msg.Header.Get("aggregate-id"),
+			Data:    msg.Data,
+			Headers: make(map[string]string, len(msg.Header)),
+		}
+		for k := range msg.Header {
+			d.Headers[k] = msg.Header.Get(k)
+		}
+		if err := handler(MessageContext(msg), d); err != nil {
+			s.logger.Error("Failed to handle message", "error", err, "subject", msg.Subject, "group", group)
+		}
+	})
+}
+
+// subjectMatches reports whether subject matches a NATS-style pattern.
+func subjectMatches(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ims-erp/system/pkg/carddata"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// maxScannedBody bounds how much of a request body RejectCardData reads.
+const maxScannedBody = 1 << 20
+
+// RejectCardData answers requests carrying cardholder data with 400 before
+// they reach next, so that card numbers and security codes are never
+// processed or stored. The query string and JSON or form bodies are
+// scanned; bodies that do not parse are left for next to reject. report,
+// if not nil, is told where the data was found, never what it was.
+func RejectCardData(report func(r *http.Request, findings []carddata.Finding), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		findings := carddata.ScanValues(r.URL.Query())
+		if r.Body != nil && r.Body != http.NoBody {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxScannedBody+1))
+			r.Body.Close()
+			if err != nil {
+				httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			if len(body) > maxScannedBody {
+				httpresponse.ErrorStatus(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			findings = append(findings, scanBody(r.Header.Get("Content-Type"), body)...)
+		}
+		if len(findings) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if report != nil {
+			report(r, findings)
+		}
+		rejected := errors.InvalidArgument("card data must not be sent to this API; collect it with the payment provider's hosted fields")
+		rejected.Details = findings
+		httpresponse.Error(w, r, rejected)
+	})
+}
+
+func scanBody(contentType string, body []byte) []carddata.Finding {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		return carddata.ScanValues(values)
+	}
+	findings, err := carddata.ScanJSON(body)
+	if err != nil {
+		return nil
+	}
+	return findings
+}
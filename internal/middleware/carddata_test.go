@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ims-erp/system/pkg/carddata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectCardData(t *testing.T) {
+	var reached string
+	var reported []carddata.Finding
+	handler := RejectCardData(func(r *http.Request, findings []carddata.Finding) {
+		reported = findings
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reached = string(body)
+	}))
+
+	clean := `{"invoiceId":"550e8400-e29b-41d4-a716-446655440000","metadata":{"order_id":"SO-1"}}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/payments/intents", strings.NewReader(clean)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, clean, reached, "the body is passed on unchanged")
+	assert.Nil(t, reported)
+
+	reached = ""
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/payments/process",
+		strings.NewReader(`{"invoiceId":"x","metadata":{"note":"4111 1111 1111 1111"},"cvv":"123"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, reached)
+	assert.Equal(t, []carddata.Finding{
+		{Field: "cvv", Reason: carddata.ReasonSensitiveField},
+		{Field: "metadata.note", Reason: carddata.ReasonCardNumber},
+	}, reported)
+	assert.NotContains(t, rec.Body.String(), "4111")
+	var body struct {
+		Error struct {
+			Code    string             `json:"code"`
+			Details []carddata.Finding `json:"details"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "INVALID_ARGUMENT", body.Error.Code)
+	assert.Equal(t, reported, body.Error.Details)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/refund", strings.NewReader("card_number=4111111111111111"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/payments?search=4111111111111111", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/config"
+)
+
+// CORSPolicy decides which browser origins may call an API and with which
+// response headers, from the security.cors_* settings.
+type CORSPolicy struct {
+	origins      []string
+	anyOrigin    bool
+	credentials  bool
+	allowMethods string
+	allowHeaders string
+	maxAge       string
+}
+
+func NewCORSPolicy(cfg *config.SecurityConfig) *CORSPolicy {
+	p := &CORSPolicy{
+		credentials:  !cfg.CORSNoCredentials,
+		allowMethods: strings.Join(cfg.AllowedMethods, ", "),
+		allowHeaders: strings.Join(cfg.AllowedHeaders, ", "),
+		maxAge:       strconv.Itoa(int(cfg.CORSMaxAge.Seconds())),
+	}
+	for _, o := range cfg.CORSDomain {
+		if o == "*" {
+			p.anyOrigin = cfg.CORSAllowWildcard
+			continue
+		}
+		p.origins = append(p.origins, o)
+	}
+	return p
+}
+
+// Origins returns how many origin patterns the policy allows.
+func (p *CORSPolicy) Origins() int {
+	return len(p.origins)
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or
+// "" if the origin is not allowed.
+func (p *CORSPolicy) allowOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, pattern := range p.origins {
+		if ok, _ := path.Match(pattern, origin); ok {
+			return origin
+		}
+	}
+	if p.anyOrigin {
+		return "*"
+	}
+	return ""
+}
+
+// Apply sets the CORS response headers for r's origin, if it is allowed.
+func (p *CORSPolicy) Apply(w http.ResponseWriter, r *http.Request) {
+	allowed := p.allowOrigin(r.Header.Get("Origin"))
+	if allowed == "" {
+		return
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", allowed)
+	h.Set("Access-Control-Allow-Methods", p.allowMethods)
+	h.Set("Access-Control-Allow-Headers", p.allowHeaders)
+	h.Set("Access-Control-Max-Age", p.maxAge)
+	// Clients send the ETag back in If-Match when they change a resource.
+	h.Set("Access-Control-Expose-Headers", "ETag")
+	// Browsers refuse credentials on a wildcard response, so they are
+	// only offered to origins that were matched.
+	if p.credentials && allowed != "*" {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if allowed != "*" {
+		h.Add("Vary", "Origin")
+	}
+}
+
+// CORSMiddleware applies a CORSPolicy and answers preflight requests.
+type CORSMiddleware struct {
+	policy *CORSPolicy
+}
+
+func NewCORSMiddleware(cfg *config.SecurityConfig) *CORSMiddleware {
+	return &CORSMiddleware{policy: NewCORSPolicy(cfg)}
+}
+
+func (m *CORSMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.policy.Apply(w, r)
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
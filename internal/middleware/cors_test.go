@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func corsResponse(cfg config.SecurityConfig, origin string) http.Header {
+	handler := NewCORSMiddleware(&cfg).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil)
+	req.Header.Set("Origin", origin)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Header()
+}
+
+func TestCORSMatchesOriginPatterns(t *testing.T) {
+	cfg := config.SecurityConfig{
+		CORSDomain:     []string{"https://erp.example.com", "https://*.preview.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		CORSMaxAge:     time.Hour,
+	}
+
+	h := corsResponse(cfg, "https://pr-42.preview.example.com")
+	assert.Equal(t, "https://pr-42.preview.example.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", h.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST", h.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "3600", h.Get("Access-Control-Max-Age"))
+	assert.Equal(t, "ETag", h.Get("Access-Control-Expose-Headers"))
+
+	assert.Empty(t, corsResponse(cfg, "https://evil.example.org").Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, corsResponse(cfg, "https://a/b.preview.example.com").Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSWildcardRequiresOptIn(t *testing.T) {
+	cfg := config.SecurityConfig{CORSDomain: []string{"*"}}
+	assert.Empty(t, corsResponse(cfg, "https://anywhere.test").Get("Access-Control-Allow-Origin"))
+
+	cfg.CORSAllowWildcard = true
+	h := corsResponse(cfg, "https://anywhere.test")
+	assert.Equal(t, "*", h.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, h.Get("Access-Control-Allow-Credentials"))
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestLogKey struct{}
+
+// requestLog collects what inner middleware learns about the caller, so the
+// access log line written on the way out can carry the tenant and user that
+// TenantMiddleware resolved.
+type requestLog struct {
+	tenantID string
+	userID   string
+}
+
+func requestLogFrom(ctx context.Context) *requestLog {
+	if rec, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rec
+	}
+	return nil
+}
+
+// LoggingMiddleware assigns a request ID, puts it and the trace ID on the
+// request context for handler logs, and writes one structured line per
+// request. Successful probe and metrics requests are not logged.
+type LoggingMiddleware struct {
+	logger *logger.Logger
+}
+
+func NewLoggingMiddleware(log *logger.Logger) *LoggingMiddleware {
+	return &LoggingMiddleware{logger: log}
+}
+
+func (m *LoggingMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ctx := r.Context()
+		requestID := logger.GetRequestID(ctx)
+		if requestID == "" {
+			requestID = r.Header.Get("X-Request-ID")
+		}
+		if requestID == "" {
+			requestID = uuid.New().String()
+		}
+		ctx = logger.WithRequestID(ctx, requestID)
+		w.Header().Set("X-Request-ID", requestID)
+
+		sc := trace.SpanContextFromContext(ctx)
+		if !sc.IsValid() {
+			sc = trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header)))
+		}
+		if sc.HasTraceID() {
+			ctx = logger.WithTraceID(ctx, sc.TraceID().String())
+		}
+
+		rec := &requestLog{}
+		ctx = context.WithValue(ctx, requestLogKey{}, rec)
+
+		sw := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status < http.StatusBadRequest && isProbePath(r.URL.Path) {
+			return
+		}
+		if rec.tenantID != "" {
+			ctx = logger.WithTenantID(ctx, rec.tenantID)
+		}
+		if rec.userID != "" {
+			ctx = logger.WithUserID(ctx, rec.userID)
+		}
+
+		fields := []interface{}{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", sw.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"ip", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		}
+		log := m.logger.New(ctx)
+		switch {
+		case status >= http.StatusInternalServerError:
+			log.Errorw("HTTP request", fields...)
+		case status >= http.StatusBadRequest:
+			log.Warnw("HTTP request", fields...)
+		default:
+			log.Infow("HTTP request", fields...)
+		}
+	})
+}
+
+func isProbePath(path string) bool {
+	for _, p := range defaultPublicPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// RecoveryMiddleware turns a panicking handler into a JSON 500 and logs the
+// panic with its stack trace and the request's context fields.
+type RecoveryMiddleware struct {
+	logger *logger.Logger
+}
+
+func NewRecoveryMiddleware(log *logger.Logger) *RecoveryMiddleware {
+	return &RecoveryMiddleware{logger: log}
+}
+
+func (m *RecoveryMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// net/http uses ErrAbortHandler to abort a response on purpose.
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+
+			m.logger.New(r.Context()).Errorw("Panic recovered",
+				"error", fmt.Sprint(rec),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"stack", string(debug.Stack()),
+			)
+
+			httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Instrument wraps next with the shared HTTP server middleware: tracing spans,
+// request logging and panic recovery. Authentication belongs inside it, so
+// rejected requests are logged too.
+func Instrument(log *logger.Logger, next http.Handler) http.Handler {
+	next = NewRecoveryMiddleware(log).Handler(next)
+	next = NewLoggingMiddleware(log).Handler(next)
+	return NewTracingMiddleware().Handler(next)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack keeps websocket upgrades working behind the middleware.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(t *testing.T) *logger.Logger {
+	log, err := logger.New(logger.Config{Level: "fatal", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	return log
+}
+
+func TestInstrumentRecoversPanicsAsJSON(t *testing.T) {
+	handler := Instrument(newTestLogger(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/things", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "req-1", rec.Header().Get("X-Request-ID"))
+	var body httpresponse.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "req-1", body.Error.RequestID)
+}
+
+func TestLoggingMiddlewareCollectsIdentity(t *testing.T) {
+	var seen *requestLog
+	handler := NewLoggingMiddleware(newTestLogger(t)).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithIdentity(r.Context(), "tenant-1", "user-1", nil)
+		seen = requestLogFrom(ctx)
+		assert.NotEmpty(t, logger.GetRequestID(ctx))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/things/1", nil))
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("X-Request-ID"))
+	require.NotNil(t, seen)
+	assert.Equal(t, "tenant-1", seen.tenantID)
+	assert.Equal(t, "user-1", seen.userID)
+}
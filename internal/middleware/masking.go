@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/masking"
+)
+
+// UnmaskedPermission lets a user see personal data and amounts in the
+// responses of services with masking enabled.
+const UnmaskedPermission = "pii:unmasked"
+
+// MaskPII masks personal data and amounts in the JSON responses of next to
+// /api/ requests, as masking.Default describes and with cfg.Fields hidden
+// entirely, for users without UnmaskedPermission. It returns next unchanged
+// when masking is disabled. It must run inside TenantMiddleware, which sets
+// the permissions. Successful /api/ responses that are not JSON, such as PDF
+// and CSV downloads, cannot be masked and are refused with 403; responses
+// outside /api/, such as health checks and admin endpoints, are passed
+// through.
+func MaskPII(cfg config.MaskingConfig, next http.Handler) http.Handler {
+	if !cfg.Enabled {
+		return next
+	}
+	rules := masking.Default.With(masking.Text, cfg.Fields...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || rbac.Allows(GetPermissions(r.Context()), UnmaskedPermission) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &maskingRecorder{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		body := rec.body.Bytes()
+		isJSON := strings.HasPrefix(rec.header.Get("Content-Type"), "application/json")
+		if !isJSON && len(body) > 0 && rec.status < http.StatusMultipleChoices {
+			httpresponse.ErrorStatus(w, r, http.StatusForbidden, "response cannot be masked; missing permission "+UnmaskedPermission)
+			return
+		}
+		if isJSON && len(body) > 0 {
+			masked, err := rules.MaskJSON(body)
+			if err != nil {
+				// Never let an unparsable body through unmasked.
+				httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to mask response")
+				return
+			}
+			body = masked
+			rec.header.Set("Content-Length", strconv.Itoa(len(body)))
+			rec.header.Set("X-Data-Masked", "true")
+		}
+		for key, values := range rec.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.status)
+		w.Write(body)
+	})
+}
+
+// maskingRecorder holds a response back until it has been masked.
+type maskingRecorder struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func (r *maskingRecorder) Header() http.Header { return r.header }
+
+func (r *maskingRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+}
+
+func (r *maskingRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
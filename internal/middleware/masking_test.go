@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskPII(t *testing.T) {
+	handler := MaskPII(config.MaskingConfig{Enabled: true, Fields: []string{"notes"}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/invoices/pdf" {
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.4 Northwind"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"data":{"clientName":"Northwind","total":"120.00","notes":"call Ann","status":"sent"}}`))
+	}))
+
+	serve := func(path string, permissions ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(WithIdentity(context.Background(), "t1", "u1", permissions))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/api/v1/invoices")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("X-Data-Masked"))
+	assert.JSONEq(t, `{"data":{"clientName":"N***","total":"***","notes":"***","status":"sent"}}`, rec.Body.String())
+
+	rec = serve("/api/v1/invoices", UnmaskedPermission)
+	assert.Empty(t, rec.Header().Get("X-Data-Masked"))
+	assert.Contains(t, rec.Body.String(), "Northwind")
+
+	rec = serve("/api/v1/invoices/pdf")
+	assert.Equal(t, http.StatusForbidden, rec.Code, "files cannot be masked")
+	assert.NotContains(t, rec.Body.String(), "Northwind")
+
+	rec = serve("/api/v1/invoices/pdf", UnmaskedPermission)
+	assert.Equal(t, "%PDF-1.4 Northwind", rec.Body.String())
+
+	rec = serve("/admin/dlq")
+	assert.Contains(t, rec.Body.String(), "Northwind")
+}
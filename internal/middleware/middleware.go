@@ -2,12 +2,12 @@ package middleware
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/ims-erp/system/pkg/logger"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -21,6 +21,8 @@ const (
 	UserContextKey        AuthContextKey = "user"
 	TenantContextKey      AuthContextKey = "tenant"
 	PermissionsContextKey AuthContextKey = "permissions"
+	VisibilityContextKey  AuthContextKey = "visibility"
+	RolesContextKey       AuthContextKey = "roles"
 )
 
 func GetUserID(ctx context.Context) string {
@@ -50,36 +52,17 @@ func GetPermissions(ctx context.Context) []string {
 	return nil
 }
 
-type LoggingMiddleware struct {
-	logger *logger.Logger
+// GetRoles returns the caller's user and tenant roles.
+func GetRoles(ctx context.Context) []string {
+	roles, _ := ctx.Value(RolesContextKey).([]string)
+	return roles
 }
 
-func NewLoggingMiddleware(log *logger.Logger) *LoggingMiddleware {
-	return &LoggingMiddleware{logger: log}
-}
-
-func (m *LoggingMiddleware) Handler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		next.ServeHTTP(w, r)
-
-		duration := time.Since(start)
-
-		userID := GetUserID(r.Context())
-		tenantID := GetTenantID(r.Context())
-
-		m.logger.New(r.Context()).Info("HTTP request",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"status", w.Header().Get("X-Status-Code"),
-			"duration_ms", duration.Milliseconds(),
-			"user_id", userID,
-			"tenant_id", tenantID,
-			"ip", r.RemoteAddr,
-			"user_agent", r.UserAgent(),
-		)
-	})
+// GetVisibility returns the records the caller may read, every record of
+// its tenant unless its access token restricts it.
+func GetVisibility(ctx context.Context) domain.Visibility {
+	v, _ := ctx.Value(VisibilityContextKey).(domain.Visibility)
+	return v
 }
 
 type TracingMiddleware struct {
@@ -111,79 +94,6 @@ func (m *TracingMiddleware) Handler(next http.Handler) http.Handler {
 	})
 }
 
-type RecoveryMiddleware struct {
-	logger *logger.Logger
-}
-
-func NewRecoveryMiddleware(log *logger.Logger) *RecoveryMiddleware {
-	return &RecoveryMiddleware{logger: log}
-}
-
-func (m *RecoveryMiddleware) Handler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if r := recover(); r != nil {
-				m.logger.Error("Panic recovered",
-					"error", r,
-				)
-
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"error": "Internal server error",
-					"code":  "INTERNAL_ERROR",
-				})
-			}
-		}()
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-type CORSMiddleware struct {
-	allowedOrigins []string
-	allowedMethods []string
-	allowedHeaders []string
-}
-
-func NewCORSMiddleware(cfg *config.SecurityConfig) *CORSMiddleware {
-	return &CORSMiddleware{
-		allowedOrigins: cfg.CORSDomain,
-		allowedMethods: cfg.AllowedMethods,
-		allowedHeaders: cfg.AllowedHeaders,
-	}
-}
-
-func (m *CORSMiddleware) Handler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		if origin != "" {
-			allowed := false
-			for _, o := range m.allowedOrigins {
-				if o == "*" || o == origin {
-					allowed = true
-					break
-				}
-			}
-
-			if allowed {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				w.Header().Set("Access-Control-Allow-Methods", strings.Join(m.allowedMethods, ","))
-				w.Header().Set("Access-Control-Allow-Headers", strings.Join(m.allowedHeaders, ","))
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
-				w.Header().Set("Access-Control-Max-Age", "86400")
-			}
-		}
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 type SecurityHeadersMiddleware struct{}
 
 func NewSecurityHeadersMiddleware() *SecurityHeadersMiddleware {
@@ -261,12 +171,12 @@ func (m *ValidatorMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		contentType := r.Header.Get("Content-Type")
 		if contentType != "" && !strings.Contains(contentType, "application/json") {
-			http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Content-Type must be application/json")
 			return
 		}
 
 		if r.ContentLength > 10*1024*1024 {
-			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			httpresponse.ErrorStatus(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
 			return
 		}
 
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// AdminPermission lets a user run the operational endpoints of a service for
+// its tenant, such as /admin/dlq, /admin/replay and /debug/consumers.
+const AdminPermission = "system:admin"
+
+// RequirePermission answers requests whose caller does not hold permission
+// with 403 before they reach next. It runs behind the tenant middleware,
+// which puts the caller's permissions on the context.
+func RequirePermission(permission string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rbac.Allows(GetPermissions(r.Context()), permission) {
+			httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission "+permission)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
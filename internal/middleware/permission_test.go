@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequirePermission(t *testing.T) {
+	handler := RequirePermission(AdminPermission, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name        string
+		permissions []string
+		status      int
+	}{
+		{"none", nil, http.StatusForbidden},
+		{"other", []string{"client:read", "*:read"}, http.StatusForbidden},
+		{"admin", []string{AdminPermission}, http.StatusOK},
+		{"wildcard", []string{"system:*"}, http.StatusOK},
+		{"superuser", []string{"*"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithIdentity(context.Background(), "tenant-1", "user-1", tt.permissions)
+			req := httptest.NewRequest(http.MethodGet, "/admin/dlq", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// RequireIfMatch makes PUT, PATCH and DELETE requests say which version of
+// the resource they change, so that concurrent editors cannot overwrite each
+// other's work. If-Match must carry an ETag returned by a GET, or "*" to
+// change the resource whatever its version. Requests without it get 428; a
+// stale ETag is answered with 412 by the handler once it knows the current
+// version.
+func RequireIfMatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+			if ifMatch == "" {
+				httpresponse.ErrorStatus(w, r, http.StatusPreconditionRequired, "If-Match header is required; send the ETag of the version being changed")
+				return
+			}
+			if _, ok := httpresponse.ParseETag(ifMatch); !ok && ifMatch != "*" {
+				httpresponse.ErrorStatus(w, r, http.StatusPreconditionFailed, "If-Match does not name a version of this resource")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
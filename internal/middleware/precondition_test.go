@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireIfMatch(t *testing.T) {
+	handler := RequireIfMatch(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		method  string
+		ifMatch string
+		status  int
+	}{
+		{http.MethodGet, "", http.StatusOK},
+		{http.MethodPost, "", http.StatusOK},
+		{http.MethodPut, "", http.StatusPreconditionRequired},
+		{http.MethodDelete, "", http.StatusPreconditionRequired},
+		{http.MethodPatch, `"abc"`, http.StatusPreconditionFailed},
+		{http.MethodPut, `"3"`, http.StatusOK},
+		{http.MethodPut, `W/"3"`, http.StatusOK},
+		{http.MethodDelete, "*", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.ifMatch, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/invoices/1", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/rbac"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// ViewAllDataPermission lets a user whose data scope is restricted to its
+// own records read every record of its tenant.
+const ViewAllDataPermission = "data:all"
+
+// defaultPublicPaths never require a token.
+var defaultPublicPaths = []string{"/health", "/ready", "/live", "/metrics"}
+
+type TokenValidator interface {
+	ValidateToken(token string) (*auth.TokenClaims, error)
+}
+
+// TenantMiddleware authenticates requests with a bearer access token and puts
+// the tenant, user, roles, permissions and visibility from its claims on the
+// context. Handlers read them with GetTenantID, GetUserID and GetVisibility; the X-Tenant-ID header and
+// tenantId query parameter are never trusted, and a request naming a tenant
+// other than the token's is rejected.
+type TenantMiddleware struct {
+	validator   TokenValidator
+	publicPaths []string
+}
+
+// NewTenantMiddleware skips authentication for health and metrics endpoints
+// and for publicPaths. A public path ending in "/" matches every path below it.
+func NewTenantMiddleware(validator TokenValidator, publicPaths ...string) *TenantMiddleware {
+	return &TenantMiddleware{
+		validator:   validator,
+		publicPaths: append(append([]string{}, defaultPublicPaths...), publicPaths...),
+	}
+}
+
+func (m *TenantMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || m.isPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := bearerToken(r)
+		if token == "" {
+			httpresponse.ErrorStatus(w, r, http.StatusUnauthorized, "authorization required")
+			return
+		}
+		claims, err := m.validator.ValidateToken(token)
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusUnauthorized, "invalid or expired access token")
+			return
+		}
+		if claims.TenantID == "" {
+			httpresponse.ErrorStatus(w, r, http.StatusForbidden, "access token is not bound to a tenant")
+			return
+		}
+
+		for _, requested := range []string{r.Header.Get("X-Tenant-ID"), r.URL.Query().Get("tenantId")} {
+			if requested != "" && requested != claims.TenantID {
+				httpresponse.ErrorStatus(w, r, http.StatusForbidden, "tenant does not match access token")
+				return
+			}
+		}
+
+		userID := claims.UserID
+		if userID == "" {
+			userID = claims.Subject
+		}
+		ctx := WithIdentity(r.Context(), claims.TenantID, userID, claims.Permissions)
+		ctx = WithVisibility(ctx, visibility(claims, userID))
+		ctx = WithRoles(ctx, roles(claims))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (m *TenantMiddleware) isPublic(path string) bool {
+	for _, p := range m.publicPaths {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithIdentity records an authenticated caller on ctx, for the middleware and
+// for tests of handlers that sit behind it.
+func WithIdentity(ctx context.Context, tenantID, userID string, permissions []string) context.Context {
+	ctx = context.WithValue(ctx, TenantContextKey, tenantID)
+	ctx = context.WithValue(ctx, UserContextKey, userID)
+	ctx = context.WithValue(ctx, PermissionsContextKey, permissions)
+	if rec := requestLogFrom(ctx); rec != nil {
+		rec.tenantID, rec.userID = tenantID, userID
+	}
+	ctx = logger.WithTenantID(ctx, tenantID)
+	return logger.WithUserID(ctx, userID)
+}
+
+// WithVisibility records the records the caller may read on ctx.
+func WithVisibility(ctx context.Context, v domain.Visibility) context.Context {
+	return context.WithValue(ctx, VisibilityContextKey, v)
+}
+
+// WithRoles records the caller's roles on ctx.
+func WithRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, RolesContextKey, roles)
+}
+
+// roles returns the user and tenant roles of a token that are set.
+func roles(claims *auth.TokenClaims) []string {
+	var roles []string
+	for _, role := range []string{claims.Role, claims.TenantRole} {
+		if role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// visibility returns the records a token's user may read: only its own and
+// those of its territories when its data scope is restricted, unless it
+// holds ViewAllDataPermission.
+func visibility(claims *auth.TokenClaims, userID string) domain.Visibility {
+	if claims.DataScope != domain.DataScopeOwn || rbac.Allows(claims.Permissions, ViewAllDataPermission) {
+		return domain.Visibility{}
+	}
+	return domain.OwnVisibility(userID, claims.Territories)
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTokens returns a JWT service signing tokens the middleware it
+// validates for accepts.
+func newTestTokens(t *testing.T) (*auth.JWTService, *TenantMiddleware) {
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	tokens := auth.NewJWTService(&config.AuthConfig{
+		JWT_SECRET:         "test-secret",
+		JWT_ISSUER:         "ims-erp",
+		AccessTokenExpiry:  time.Hour,
+		RefreshTokenExpiry: 24 * time.Hour,
+	}, log)
+	return tokens, NewTenantMiddleware(tokens, "/webhooks/")
+}
+
+// serveTenant runs req through m and returns the response and the tenant
+// the handler behind it saw, and whether that handler was reached.
+func serveTenant(m *TenantMiddleware, req *http.Request) (*httptest.ResponseRecorder, string, bool) {
+	var tenantID string
+	reached := false
+	rec := httptest.NewRecorder()
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		tenantID = GetTenantID(r.Context())
+	})).ServeHTTP(rec, req)
+	return rec, tenantID, reached
+}
+
+func bearer(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestTenantMiddleware_Handler(t *testing.T) {
+	tokens, m := newTestTokens(t)
+	user := &domain.User{ID: uuid.New(), TenantID: uuid.New(), Role: "user", Permissions: []string{"client:read"}}
+	access, _, err := tokens.GenerateAccessToken(user)
+	require.NoError(t, err)
+	refresh, _, err := tokens.GenerateRefreshToken(user.ID.String(), user.TenantID.String())
+	require.NoError(t, err)
+	other, _, err := auth.NewJWTService(&config.AuthConfig{JWT_SECRET: "other-secret", AccessTokenExpiry: time.Hour}, nil).GenerateAccessToken(user)
+	require.NoError(t, err)
+	tenantID := user.TenantID.String()
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"missing token", httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil), http.StatusUnauthorized},
+		{"not a bearer token", func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil)
+			req.Header.Set("Authorization", "Basic "+access)
+			return req
+		}(), http.StatusUnauthorized},
+		{"malformed token", bearer(httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil), "not-a-jwt"), http.StatusUnauthorized},
+		{"token signed with another secret", bearer(httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil), other), http.StatusUnauthorized},
+		{"refresh token", bearer(httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil), refresh), http.StatusForbidden},
+		{"other tenant in header", func() *http.Request {
+			req := bearer(httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil), access)
+			req.Header.Set("X-Tenant-ID", uuid.NewString())
+			return req
+		}(), http.StatusForbidden},
+		{"other tenant in query", bearer(httptest.NewRequest(http.MethodGet, "/api/v1/clients?tenantId="+uuid.NewString(), nil), access), http.StatusForbidden},
+		{"own tenant in header", func() *http.Request {
+			req := bearer(httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil), access)
+			req.Header.Set("X-Tenant-ID", tenantID)
+			return req
+		}(), http.StatusOK},
+		{"access token", bearer(httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil), access), http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec, gotTenant, reached := serveTenant(m, tt.req)
+		assert.Equal(t, tt.status, rec.Code, tt.name)
+		assert.Equal(t, tt.status == http.StatusOK, reached, tt.name)
+		if reached {
+			assert.Equal(t, tenantID, gotTenant, tt.name)
+		}
+	}
+}
+
+func TestTenantMiddleware_PublicPaths(t *testing.T) {
+	_, m := newTestTokens(t)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/health", nil),
+		httptest.NewRequest(http.MethodGet, "/metrics", nil),
+		httptest.NewRequest(http.MethodPost, "/webhooks/stripe", nil),
+		httptest.NewRequest(http.MethodOptions, "/api/v1/clients", nil),
+	} {
+		rec, tenantID, reached := serveTenant(m, req)
+		assert.True(t, reached, req.Method+" "+req.URL.Path)
+		assert.Equal(t, http.StatusOK, rec.Code, req.Method+" "+req.URL.Path)
+		assert.Empty(t, tenantID, req.Method+" "+req.URL.Path)
+	}
+
+	// Only paths below a public prefix ending in "/" are public.
+	for _, path := range []string{"/webhooks", "/healthz", "/api/v1/health"} {
+		rec, _, reached := serveTenant(m, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.False(t, reached, path)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	rep := &auth.TokenClaims{DataScope: domain.DataScopeOwn, Territories: []string{"north"}}
+	assert.Equal(t, domain.OwnVisibility("rep-1", []string{"north"}), visibility(rep, "rep-1"))
+
+	assert.False(t, visibility(&auth.TokenClaims{}, "user-1").Restricted())
+	assert.False(t, visibility(&auth.TokenClaims{DataScope: domain.DataScopeTenant}, "user-1").Restricted())
+
+	for _, permissions := range [][]string{{ViewAllDataPermission}, {"data:*"}, {"*"}} {
+		admin := &auth.TokenClaims{DataScope: domain.DataScopeOwn, Permissions: permissions}
+		assert.False(t, visibility(admin, "admin-1").Restricted(), permissions)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	assert.Equal(t, []string{"user", "approver"}, roles(&auth.TokenClaims{Role: "user", TenantRole: "approver"}))
+	assert.Equal(t, []string{"admin"}, roles(&auth.TokenClaims{Role: "admin"}))
+	assert.Empty(t, roles(&auth.TokenClaims{}))
+}
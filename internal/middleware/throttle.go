@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+)
+
+// Endpoint classes with their own limits in security.throttle.classes.
+const (
+	ThrottleSearch = "search"
+	ThrottleReport = "report"
+	ThrottleExport = "export"
+)
+
+// Limiter counts a request against identifier and reports whether no more
+// than limit were made within window. repository.RateLimiter implements it
+// on Redis, shared by all replicas of a service.
+type Limiter interface {
+	Allow(ctx context.Context, identifier string, limit int, window time.Duration) (bool, int, error)
+}
+
+// Throttle applies the security.throttle limits to expensive endpoints.
+type Throttle struct {
+	limiter Limiter
+	config  config.ThrottleConfig
+	logger  *logger.Logger
+}
+
+func NewThrottle(limiter Limiter, cfg config.ThrottleConfig, log *logger.Logger) *Throttle {
+	return &Throttle{limiter: limiter, config: cfg, logger: log}
+}
+
+// Limit counts requests to next against the per-IP and per-user limits of
+// class and answers 429 once either is exceeded. If methods are given, only
+// requests with one of them are counted, so that polling an export does not
+// use up the limit for starting one. Requests are let through when the
+// limiter fails. A nil Throttle limits nothing.
+func (t *Throttle) Limit(class string, next http.Handler, methods ...string) http.Handler {
+	if t == nil {
+		return next
+	}
+	limit := t.config.LimitFor(class)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(methods) > 0 && !containsMethod(methods, r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !t.allow(r, class, "ip", ClientIP(r), limit.PerIP) {
+			t.reject(w, r, class, "ip")
+			return
+		}
+		if userID := GetUserID(r.Context()); userID != "" {
+			if !t.allow(r, class, "user", GetTenantID(r.Context())+":"+userID, limit.PerUser) {
+				t.reject(w, r, class, "user")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *Throttle) allow(r *http.Request, class, scope, key string, limit int) bool {
+	if limit < 0 || key == "" {
+		return true
+	}
+	allowed, _, err := t.limiter.Allow(r.Context(), "throttle:"+class+":"+scope+":"+key, limit, t.config.Window)
+	if err != nil {
+		t.logger.Warn("Rate limiter unavailable; request not limited", "class", class, "error", err)
+		return true
+	}
+	return allowed
+}
+
+func (t *Throttle) reject(w http.ResponseWriter, r *http.Request, class, scope string) {
+	metrics.RecordThrottle(class, scope)
+	w.Header().Set("Retry-After", strconv.Itoa(int(t.config.Window.Seconds())))
+	httpresponse.Error(w, r, errors.TooManyRequests("too many %s requests; try again later", class))
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address a request came from, as forwarded by the
+// gateway or a proxy in front of the service, without its port.
+func ClientIP(r *http.Request) string {
+	addr := r.RemoteAddr
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addr = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// LocalLimiter counts requests in fixed windows in memory. Services without
+// Redis use it; each replica then enforces the limits on its own.
+type LocalLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*localWindow
+	swept   time.Time
+	now     func() time.Time
+}
+
+type localWindow struct {
+	start time.Time
+	count int
+}
+
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{windows: make(map[string]*localWindow), now: time.Now}
+}
+
+func (l *LocalLimiter) Allow(ctx context.Context, identifier string, limit int, window time.Duration) (bool, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.swept) >= window {
+		l.sweep(now, window)
+	}
+	w, ok := l.windows[identifier]
+	if !ok || now.Sub(w.start) >= window {
+		w = &localWindow{start: now}
+		l.windows[identifier] = w
+	}
+	w.count++
+	return w.count <= limit, w.count, nil
+}
+
+// sweep drops windows that have ended, so that clients seen once do not
+// accumulate.
+func (l *LocalLimiter) sweep(now time.Time, window time.Duration) {
+	for id, w := range l.windows {
+		if now.Sub(w.start) >= window {
+			delete(l.windows, id)
+		}
+	}
+	l.swept = now
+}
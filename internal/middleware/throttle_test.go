@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLogger(t *testing.T) *logger.Logger {
+	log, err := logger.New(logger.Config{Level: "fatal", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	return log
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, int, time.Duration) (bool, int, error) {
+	return false, 0, errors.New("redis down")
+}
+
+func throttled(throttle *Throttle, class string, methods ...string) http.Handler {
+	return throttle.Limit(class, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), methods...)
+}
+
+func throttleStatus(handler http.Handler, method, ip, userID string) int {
+	req := httptest.NewRequest(method, "/api/v1/orders/search", nil)
+	req.RemoteAddr = ip + ":51234"
+	if userID != "" {
+		ctx := context.WithValue(req.Context(), UserContextKey, userID)
+		req = req.WithContext(context.WithValue(ctx, TenantContextKey, "tenant-1"))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestThrottleLimitsPerIPAndPerUser(t *testing.T) {
+	cfg := config.ThrottleConfig{
+		Window:  time.Minute,
+		PerIP:   3,
+		PerUser: 2,
+		Classes: map[string]config.ThrottleLimit{ThrottleExport: {PerIP: 1}},
+	}
+	throttle := NewThrottle(NewLocalLimiter(), cfg, testLogger(t))
+	search := throttled(throttle, ThrottleSearch)
+
+	assert.Equal(t, http.StatusOK, throttleStatus(search, http.MethodGet, "10.0.0.1", "user-1"))
+	assert.Equal(t, http.StatusOK, throttleStatus(search, http.MethodGet, "10.0.0.2", "user-1"))
+	assert.Equal(t, http.StatusTooManyRequests, throttleStatus(search, http.MethodGet, "10.0.0.3", "user-1"))
+
+	assert.Equal(t, http.StatusOK, throttleStatus(search, http.MethodGet, "10.0.0.4", ""))
+	assert.Equal(t, http.StatusOK, throttleStatus(search, http.MethodGet, "10.0.0.4", ""))
+	assert.Equal(t, http.StatusOK, throttleStatus(search, http.MethodGet, "10.0.0.4", ""))
+	assert.Equal(t, http.StatusTooManyRequests, throttleStatus(search, http.MethodGet, "10.0.0.4", ""))
+
+	// Classes are counted separately and only for the given methods.
+	exports := throttled(throttle, ThrottleExport, http.MethodPost)
+	assert.Equal(t, http.StatusOK, throttleStatus(exports, http.MethodPost, "10.0.0.4", ""))
+	assert.Equal(t, http.StatusTooManyRequests, throttleStatus(exports, http.MethodPost, "10.0.0.4", ""))
+	assert.Equal(t, http.StatusOK, throttleStatus(exports, http.MethodGet, "10.0.0.4", ""))
+}
+
+func TestThrottleSetsRetryAfter(t *testing.T) {
+	throttle := NewThrottle(NewLocalLimiter(), config.ThrottleConfig{Window: 30 * time.Second, PerIP: 1, PerUser: -1}, testLogger(t))
+	handler := throttled(throttle, ThrottleReport)
+	throttleStatus(handler, http.MethodGet, "10.0.0.1", "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/invoices/report/summary", nil)
+	req.RemoteAddr = "10.0.0.1:40000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+}
+
+func TestThrottleLetsRequestsThroughWhenLimiterFails(t *testing.T) {
+	throttle := NewThrottle(failingLimiter{}, config.ThrottleConfig{Window: time.Minute, PerIP: 1, PerUser: 1}, testLogger(t))
+	handler := throttled(throttle, ThrottleSearch)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, throttleStatus(handler, http.MethodGet, "10.0.0.1", "user-1"))
+	}
+
+	var none *Throttle
+	assert.Equal(t, http.StatusOK, throttleStatus(throttled(none, ThrottleSearch), http.MethodGet, "10.0.0.1", ""))
+}
+
+func TestLocalLimiterStartsNewWindow(t *testing.T) {
+	limiter := NewLocalLimiter()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	allowed, _, _ := limiter.Allow(context.Background(), "ip:10.0.0.1", 1, time.Minute)
+	assert.True(t, allowed)
+	allowed, _, _ = limiter.Allow(context.Background(), "ip:10.0.0.1", 1, time.Minute)
+	assert.False(t, allowed)
+
+	now = now.Add(time.Minute)
+	allowed, count, _ := limiter.Allow(context.Background(), "ip:10.0.0.1", 1, time.Minute)
+	assert.True(t, allowed)
+	assert.Equal(t, 1, count)
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:5000"
+	assert.Equal(t, "192.0.2.1", ClientIP(req))
+
+	req.Header.Set("X-Forwarded-For", "198.51.100.7:61000, 10.0.0.1")
+	assert.Equal(t, "198.51.100.7", ClientIP(req))
+}
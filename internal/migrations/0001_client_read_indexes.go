@@ -0,0 +1,16 @@
+package migrations
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// clientReadIndexes covers the client list and search queries, which always
+// filter by tenant and the trash marker and page by createdAt or _id.
+var clientReadIndexes = Migration{
+	Version: 1,
+	Name:    "client_read_indexes",
+	Indexes: []Index{
+		{Collection: "client_read", Name: "tenant_created", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "deletedAt", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Collection: "client_read", Name: "tenant_status", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}}},
+		{Collection: "client_read", Name: "tenant_email", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "email", Value: 1}}},
+		{Collection: "client_read", Name: "tenant_tags", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "tags", Value: 1}}},
+	},
+}
@@ -0,0 +1,14 @@
+package migrations
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// userIndexes backs login by email. Users are stored without bson tags, so
+// the tenant field is "tenantid". Creating the index fails if a tenant
+// already has two users with the same email; those have to be merged first.
+var userIndexes = Migration{
+	Version: 2,
+	Name:    "user_indexes",
+	Indexes: []Index{
+		{Collection: "users", Name: "tenant_email", Keys: bson.D{{Key: "tenantid", Value: 1}, {Key: "email", Value: 1}}, Unique: true},
+	},
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// paymentIndexes covers payment lists filtered by invoice, client or status
+// and the statistics queries over createdAt, plus the payment and invoice
+// repository lookups by invoice, provider reference, number and client.
+var paymentIndexes = Migration{
+	Version: 3,
+	Name:    "payment_indexes",
+	Indexes: []Index{
+		{Collection: "payment_read_models", Name: "tenant_created", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Collection: "payment_read_models", Name: "tenant_invoice", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "invoiceId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Collection: "payment_read_models", Name: "tenant_client", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "clientId", Value: 1}}},
+		{Collection: "payment_read_models", Name: "tenant_status", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}}},
+		{Collection: "payments", Name: "invoice_created", Keys: bson.D{{Key: "invoiceId", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Collection: "payments", Name: "provider_id", Keys: bson.D{{Key: "providerId", Value: 1}}},
+		{Collection: "invoices", Name: "tenant_number", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "invoiceNumber", Value: 1}}},
+		{Collection: "invoices", Name: "client_created", Keys: bson.D{{Key: "clientId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	},
+}
@@ -0,0 +1,14 @@
+package migrations
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// documentIndexes covers the document list, newest first, and the trash
+// listing ordered by deletion time.
+var documentIndexes = Migration{
+	Version: 4,
+	Name:    "document_indexes",
+	Indexes: []Index{
+		{Collection: "documents", Name: "tenant_created", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "deletedAt", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Collection: "documents", Name: "tenant_deleted", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "deletedAt", Value: -1}, {Key: "_id", Value: -1}}},
+	},
+}
@@ -0,0 +1,15 @@
+package migrations
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// eventIndexes serves replays and LoadByType, which read a tenant's events of
+// some aggregate types from a point in time. The (aggregateId, version)
+// index is created by the event store itself.
+var eventIndexes = Migration{
+	Version: 5,
+	Name:    "event_indexes",
+	Indexes: []Index{
+		{Collection: "events", Name: "tenant_type_timestamp", Keys: bson.D{{Key: "metadata.tenantId", Value: 1}, {Key: "aggregateType", Value: 1}, {Key: "timestamp", Value: 1}}},
+		{Collection: "events", Name: "type_timestamp", Keys: bson.D{{Key: "aggregateType", Value: 1}, {Key: "timestamp", Value: 1}}},
+	},
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// backfillClientCreatedAt sets createdAt on client read models written
+// without one, from updatedAt. Keyset pagination sorted by createdAt skips
+// documents missing the field.
+var backfillClientCreatedAt = Migration{
+	Version: 6,
+	Name:    "backfill_client_created_at",
+	Backfill: func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("client_read").UpdateMany(ctx,
+			bson.M{"createdAt": bson.M{"$exists": false}, "updatedAt": bson.M{"$exists": true}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{"createdAt": "$updatedAt"}}}},
+		)
+		return err
+	},
+}
@@ -0,0 +1,17 @@
+package migrations
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// invoiceReadIndexes covers invoice lists sorted by issue date and filtered
+// by client, status or type, the overdue query over dueDate, and the client
+// rename projection that updates every invoice of a client.
+var invoiceReadIndexes = Migration{
+	Version: 7,
+	Name:    "invoice_read_indexes",
+	Indexes: []Index{
+		{Collection: "invoice_read", Name: "tenant_issued", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "issueDate", Value: -1}, {Key: "_id", Value: -1}}},
+		{Collection: "invoice_read", Name: "tenant_client", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "clientId", Value: 1}, {Key: "issueDate", Value: -1}}},
+		{Collection: "invoice_read", Name: "tenant_status_due", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "dueDate", Value: 1}}},
+		{Collection: "invoice_read", Name: "tenant_number", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "invoiceNumber", Value: 1}}},
+	},
+}
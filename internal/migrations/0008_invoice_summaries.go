@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// invoiceSummaries indexes the invoice summaries reports read by tenant and
+// day or client, and sums up the invoices projected before the summaries
+// were maintained. The invoice projection keeps them up to date from then
+// on.
+var invoiceSummaries = Migration{
+	Version: 8,
+	Name:    "invoice_summaries",
+	Indexes: []Index{
+		{Collection: events.InvoiceDaySummaryCollection, Name: "tenant_day", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "day", Value: 1}}},
+		{Collection: events.InvoiceClientSummaryCollection, Name: "tenant_client", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "clientId", Value: 1}}},
+	},
+	Backfill: backfillInvoiceSummaries,
+}
+
+func backfillInvoiceSummaries(ctx context.Context, db *mongo.Database) error {
+	opts := options.Find().SetProjection(bson.M{"lines": 0, "activityLog": 0}).SetBatchSize(1000)
+	cursor, err := db.Collection("invoice_read").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	rollup := events.NewInvoiceRollup()
+	for cursor.Next(ctx) {
+		var invoice events.InvoiceSummary
+		if err := cursor.Decode(&invoice); err != nil {
+			return fmt.Errorf("decode invoice: %w", err)
+		}
+		rollup.Add(invoice)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	days := db.Collection(events.InvoiceDaySummaryCollection)
+	for _, summary := range rollup.Days(now) {
+		if _, err := days.ReplaceOne(ctx, bson.M{"_id": summary.ID}, summary, options.Replace().SetUpsert(true)); err != nil {
+			return err
+		}
+	}
+	clients := db.Collection(events.InvoiceClientSummaryCollection)
+	for _, summary := range rollup.Clients(now) {
+		if _, err := clients.ReplaceOne(ctx, bson.M{"_id": summary.ID}, summary, options.Replace().SetUpsert(true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package migrations
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// clientPIIHashIndexes covers client lookups by email and phone once
+// security.pii encrypts them; the queries then match the blind indexes.
+var clientPIIHashIndexes = Migration{
+	Version: 9,
+	Name:    "client_pii_hash_indexes",
+	Indexes: []Index{
+		{Collection: "client_read", Name: "tenant_email_hash", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "emailHash", Value: 1}}},
+		{Collection: "client_read", Name: "tenant_phone_hash", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "phoneHash", Value: 1}}},
+	},
+}
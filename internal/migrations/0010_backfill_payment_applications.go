@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backfillPaymentApplications records the payments completed before
+// applications were kept as fully applied to their invoice, so they are not
+// counted as unapplied and applied again. The application takes the
+// payment's ID; values are copied as stored.
+var backfillPaymentApplications = Migration{
+	Version:  10,
+	Name:     "backfill_payment_applications",
+	Backfill: backfillApplications,
+}
+
+func backfillApplications(ctx context.Context, db *mongo.Database) error {
+	payments, invoices := db.Collection("payments"), db.Collection("invoices")
+	filter := bson.M{
+		"status":       bson.M{"$in": []string{"completed", "refunded"}},
+		"invoiceId":    bson.M{"$exists": true},
+		"applications": bson.M{"$exists": false},
+	}
+	opts := options.Find().SetProjection(bson.M{
+		"tenantId": 1, "invoiceId": 1, "amount": 1, "processedAt": 1, "createdAt": 1,
+	}).SetBatchSize(1000)
+	cursor, err := payments.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var payment bson.M
+		if err := cursor.Decode(&payment); err != nil {
+			return fmt.Errorf("decode payment: %w", err)
+		}
+		var invoice struct {
+			InvoiceNumber string `bson:"invoiceNumber"`
+		}
+		err := invoices.FindOne(ctx,
+			bson.M{"_id": payment["invoiceId"], "tenantId": payment["tenantId"]},
+			options.FindOne().SetProjection(bson.M{"invoiceNumber": 1}),
+		).Decode(&invoice)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("find invoice of payment %v: %w", payment["_id"], err)
+		}
+
+		appliedAt := payment["processedAt"]
+		if appliedAt == nil {
+			appliedAt = payment["createdAt"]
+		}
+		application := bson.M{
+			"id":            payment["_id"],
+			"paymentId":     payment["_id"],
+			"invoiceId":     payment["invoiceId"],
+			"invoiceNumber": invoice.InvoiceNumber,
+			"amount":        payment["amount"],
+			"appliedAt":     appliedAt,
+		}
+		if _, err := invoices.UpdateOne(ctx,
+			bson.M{"_id": payment["invoiceId"], "paymentApplications.id": bson.M{"$ne": payment["_id"]}},
+			bson.M{"$push": bson.M{"paymentApplications": application}},
+		); err != nil {
+			return err
+		}
+		if _, err := payments.UpdateOne(ctx,
+			bson.M{"_id": payment["_id"], "applications": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"amountApplied": payment["amount"], "applications": bson.A{application}}},
+		); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
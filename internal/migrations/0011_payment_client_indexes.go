@@ -0,0 +1,13 @@
+package migrations
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// paymentClientIndexes covers the payment repository lookup by client, which
+// sums a client's account credit.
+var paymentClientIndexes = Migration{
+	Version: 11,
+	Name:    "payment_client_indexes",
+	Indexes: []Index{
+		{Collection: "payments", Name: "tenant_client_created", Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "clientId", Value: 1}, {Key: "createdAt", Value: 1}}},
+	},
+}
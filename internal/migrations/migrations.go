@@ -0,0 +1,298 @@
+// Package migrations applies versioned schema changes to MongoDB: index
+// creation for the collections services query and data backfills. Each
+// migration lives in its own file and is listed in All. Applied versions are
+// recorded in schema_migrations; migrations are forward-only.
+//
+// Services that keep aggregates in PostgreSQL (database.driver=postgres) also
+// need the SQL migrations under sql/, applied by PostgresMigrator.
+//
+// Services check at startup that the indexes they rely on exist, so a
+// deployment that skipped `migrate up` is caught before it scans collections
+// under load.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrMissingIndexes = errors.New("required indexes are missing")
+	ErrLocked         = errors.New("migrations are being applied by another process")
+)
+
+// lockName is the job lock held while migrations are applied, so replicas
+// starting with auto_migrate do not run them concurrently.
+const lockName = "schema-migrations"
+
+// Index is an index a migration creates. Services check for it by name.
+type Index struct {
+	Collection string
+	Name       string
+	Keys       bson.D
+	Unique     bool
+}
+
+func (i Index) model() mongo.IndexModel {
+	opts := options.Index().SetName(i.Name)
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	return mongo.IndexModel{Keys: i.Keys, Options: opts}
+}
+
+// Migration is one versioned schema change. Indexes are created first, then
+// Backfill runs. Both must be safe to repeat, since a migration interrupted
+// before it was recorded runs again.
+type Migration struct {
+	Version  int
+	Name     string
+	Indexes  []Index
+	Backfill func(ctx context.Context, db *mongo.Database) error
+}
+
+// Status reports whether a migration has been applied.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// Store records applied migrations; repository.MigrationStore implements it.
+type Store interface {
+	Applied(ctx context.Context) ([]repository.MigrationRecord, error)
+	Record(ctx context.Context, record repository.MigrationRecord) error
+}
+
+// IndexLister lists index names; repository.MongoDB implements it.
+type IndexLister interface {
+	IndexNames(ctx context.Context, collection string) (map[string]bool, error)
+}
+
+// Locker is satisfied by repository.JobLockStore.
+type Locker interface {
+	TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, name, owner string) error
+}
+
+type Migrator struct {
+	migrations []Migration
+	store      Store
+	indexes    IndexLister
+	locker     Locker
+	apply      func(ctx context.Context, m Migration) error
+	owner      string
+	logger     *logger.Logger
+}
+
+func New(db *repository.MongoDB, log *logger.Logger) *Migrator {
+	host, _ := os.Hostname()
+	m := &Migrator{
+		migrations: All(),
+		store:      repository.NewMigrationStore(db),
+		indexes:    db,
+		locker:     repository.NewJobLockStore(db),
+		owner:      host + "-" + uuid.New().String()[:8],
+		logger:     log,
+	}
+	m.apply = func(ctx context.Context, migration Migration) error {
+		return run(ctx, db.Database(), migration)
+	}
+	return m
+}
+
+func run(ctx context.Context, db *mongo.Database, m Migration) error {
+	byCollection := make(map[string][]mongo.IndexModel)
+	var collections []string
+	for _, idx := range m.Indexes {
+		if _, ok := byCollection[idx.Collection]; !ok {
+			collections = append(collections, idx.Collection)
+		}
+		byCollection[idx.Collection] = append(byCollection[idx.Collection], idx.model())
+	}
+	for _, collection := range collections {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, byCollection[collection]); err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %w", collection, err)
+		}
+	}
+	if m.Backfill != nil {
+		if err := m.Backfill(ctx, db); err != nil {
+			return fmt.Errorf("backfill failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Status lists every known migration in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies pending migrations in version order, up to and including
+// target, or all of them when target is 0. It returns the versions applied.
+func (m *Migrator) Up(ctx context.Context, target int) ([]int, error) {
+	locked, err := m.locker.TryLock(ctx, lockName, m.owner, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrLocked
+	}
+	defer func() {
+		if err := m.locker.Unlock(context.WithoutCancel(ctx), lockName, m.owner); err != nil {
+			m.logger.Warn("Failed to release migration lock", "error", err)
+		}
+	}()
+
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, migration := range m.migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		m.logger.Info("Applying migration", "version", migration.Version, "name", migration.Name)
+		start := time.Now()
+		if err := m.apply(ctx, migration); err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		record := repository.MigrationRecord{
+			Version:    migration.Version,
+			Name:       migration.Name,
+			AppliedAt:  time.Now().UTC().Truncate(time.Millisecond),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err := m.store.Record(ctx, record); err != nil && !errors.Is(err, repository.ErrMigrationApplied) {
+			return done, err
+		}
+		done = append(done, migration.Version)
+	}
+	return done, nil
+}
+
+// Check reports the indexes on the given collections, or on every collection
+// when none are given, that migrations create but that do not exist.
+func (m *Migrator) Check(ctx context.Context, collections ...string) error {
+	wanted := make(map[string]bool, len(collections))
+	for _, c := range collections {
+		wanted[c] = true
+	}
+
+	existing := make(map[string]map[string]bool)
+	var missing []string
+	for _, migration := range m.migrations {
+		for _, idx := range migration.Indexes {
+			if len(wanted) > 0 && !wanted[idx.Collection] {
+				continue
+			}
+			names, ok := existing[idx.Collection]
+			if !ok {
+				var err error
+				if names, err = m.indexes.IndexNames(ctx, idx.Collection); err != nil {
+					return err
+				}
+				existing[idx.Collection] = names
+			}
+			if !names[idx.Name] {
+				missing = append(missing, fmt.Sprintf("%s.%s (migration %d)", idx.Collection, idx.Name, migration.Version))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingIndexes, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Startup runs the checks a service performs before serving: it applies
+// pending migrations when auto_migrate is set, then checks the indexes on
+// collections. A failed check is returned only when index_check is "fail".
+func (m *Migrator) Startup(ctx context.Context, cfg config.MigrationsConfig, collections ...string) error {
+	if cfg.AutoMigrate {
+		applied, err := m.Up(ctx, 0)
+		switch {
+		case errors.Is(err, ErrLocked):
+			m.logger.Info("Migrations are being applied by another replica")
+		case err != nil:
+			return err
+		case len(applied) > 0:
+			m.logger.Info("Applied migrations", "versions", applied)
+		}
+	}
+
+	if cfg.IndexCheck == "off" {
+		return nil
+	}
+	err := m.Check(ctx, collections...)
+	if err == nil || cfg.IndexCheck == "fail" {
+		return err
+	}
+	m.logger.Warn("Schema check failed; run `migrate up`", "error", err)
+	return nil
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context) (map[int]repository.MigrationRecord, error) {
+	records, err := m.store.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]repository.MigrationRecord, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// All returns the migrations in version order.
+func All() []Migration {
+	all := []Migration{
+		clientReadIndexes,
+		userIndexes,
+		paymentIndexes,
+		documentIndexes,
+		eventIndexes,
+		backfillClientCreatedAt,
+		invoiceReadIndexes,
+		invoiceSummaries,
+		clientPIIHashIndexes,
+		backfillPaymentApplications,
+		paymentClientIndexes,
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all
+}
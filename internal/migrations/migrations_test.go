@@ -0,0 +1,166 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type memoryStore struct {
+	records []repository.MigrationRecord
+}
+
+func (s *memoryStore) Applied(ctx context.Context) ([]repository.MigrationRecord, error) {
+	return s.records, nil
+}
+
+func (s *memoryStore) Record(ctx context.Context, record repository.MigrationRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+type memoryIndexes map[string]map[string]bool
+
+func (m memoryIndexes) IndexNames(ctx context.Context, collection string) (map[string]bool, error) {
+	if names, ok := m[collection]; ok {
+		return names, nil
+	}
+	return map[string]bool{}, nil
+}
+
+type memoryLocker struct {
+	owner string
+}
+
+func (l *memoryLocker) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	if l.owner != "" && l.owner != owner {
+		return false, nil
+	}
+	l.owner = owner
+	return true, nil
+}
+
+func (l *memoryLocker) Unlock(ctx context.Context, name, owner string) error {
+	if l.owner == owner {
+		l.owner = ""
+	}
+	return nil
+}
+
+func newTestMigrator(t *testing.T, migrations []Migration, store *memoryStore, indexes memoryIndexes, locker *memoryLocker) (*Migrator, *[]int) {
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	var ran []int
+	m := &Migrator{
+		migrations: migrations,
+		store:      store,
+		indexes:    indexes,
+		locker:     locker,
+		owner:      "test",
+		logger:     log,
+	}
+	m.apply = func(ctx context.Context, migration Migration) error {
+		ran = append(ran, migration.Version)
+		for _, idx := range migration.Indexes {
+			if indexes[idx.Collection] == nil {
+				indexes[idx.Collection] = map[string]bool{}
+			}
+			indexes[idx.Collection][idx.Name] = true
+		}
+		return nil
+	}
+	return m, &ran
+}
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "clients", Indexes: []Index{{Collection: "client_read", Name: "tenant_created", Keys: bson.D{{Key: "tenantId", Value: 1}}}}},
+	{Version: 2, Name: "users", Indexes: []Index{{Collection: "users", Name: "tenant_email", Keys: bson.D{{Key: "tenantid", Value: 1}}}}},
+	{Version: 3, Name: "backfill"},
+}
+
+func TestAll_IsOrderedAndNamed(t *testing.T) {
+	names := map[string]bool{}
+	prev := 0
+	for _, m := range All() {
+		assert.Greater(t, m.Version, prev, m.Name)
+		prev = m.Version
+		assert.NotEmpty(t, m.Name)
+		assert.True(t, len(m.Indexes) > 0 || m.Backfill != nil, m.Name)
+		for _, idx := range m.Indexes {
+			key := idx.Collection + "." + idx.Name
+			assert.NotEmpty(t, idx.Name, m.Name)
+			assert.False(t, names[key], "duplicate index %s", key)
+			names[key] = true
+		}
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	store := &memoryStore{records: []repository.MigrationRecord{{Version: 1, Name: "clients"}}}
+	m, ran := newTestMigrator(t, testMigrations, store, memoryIndexes{}, &memoryLocker{})
+
+	applied, err := m.Up(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, applied)
+
+	applied, err = m.Up(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, applied)
+	assert.Equal(t, []int{2, 3}, *ran)
+
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	for _, s := range statuses {
+		assert.True(t, s.Applied, s.Name)
+	}
+}
+
+func TestMigrator_UpLocked(t *testing.T) {
+	m, ran := newTestMigrator(t, testMigrations, &memoryStore{}, memoryIndexes{}, &memoryLocker{owner: "other"})
+	_, err := m.Up(context.Background(), 0)
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Empty(t, *ran)
+}
+
+func TestMigrator_Check(t *testing.T) {
+	indexes := memoryIndexes{"client_read": {"_id_": true, "tenant_created": true}}
+	m, _ := newTestMigrator(t, testMigrations, &memoryStore{}, indexes, &memoryLocker{})
+
+	assert.NoError(t, m.Check(context.Background(), "client_read"))
+
+	err := m.Check(context.Background())
+	assert.True(t, errors.Is(err, ErrMissingIndexes))
+	assert.ErrorContains(t, err, "users.tenant_email (migration 2)")
+}
+
+func TestMigrator_Startup(t *testing.T) {
+	m, _ := newTestMigrator(t, testMigrations, &memoryStore{}, memoryIndexes{}, &memoryLocker{})
+	assert.NoError(t, m.Startup(context.Background(), config.MigrationsConfig{IndexCheck: "warn"}, "users"))
+	assert.True(t, errors.Is(m.Startup(context.Background(), config.MigrationsConfig{IndexCheck: "fail"}, "users"), ErrMissingIndexes))
+
+	assert.NoError(t, m.Startup(context.Background(), config.MigrationsConfig{AutoMigrate: true, IndexCheck: "fail"}, "users"))
+}
+
+func TestSQLMigrationsAreOrdered(t *testing.T) {
+	all, err := SQLMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+
+	for i, m := range all {
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.SQL)
+		if i > 0 {
+			assert.Greater(t, m.Version, all[i-1].Version)
+		}
+	}
+	assert.Equal(t, "aggregates", all[0].Name)
+}
@@ -0,0 +1,195 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// postgresLockID is the advisory lock key held while a Postgres migration is
+// applied, so concurrent `migrate up` runs apply each version once.
+const postgresLockID = 7245310
+
+// SQLMigration is a versioned PostgreSQL schema change, read from
+// sql/NNNN_name.sql. Each runs in its own transaction.
+type SQLMigration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// SQLMigrations returns the embedded Postgres migrations in version order.
+func SQLMigrations() ([]SQLMigration, error) {
+	entries, err := sqlFiles.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var all []SQLMigration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, rest, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration file %s must be named NNNN_name.sql", entry.Name())
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migration version %d used by %s and %s", version, other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		body, err := sqlFiles.ReadFile(path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, SQLMigration{Version: version, Name: rest, SQL: string(body)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
+
+// PostgresMigrator applies SQLMigrations, recording them in the
+// schema_migrations table.
+type PostgresMigrator struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewPostgres(db *sql.DB, log *logger.Logger) *PostgresMigrator {
+	return &PostgresMigrator{db: db, logger: log}
+}
+
+func (m *PostgresMigrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version     INTEGER PRIMARY KEY,
+			name        TEXT        NOT NULL,
+			applied_at  TIMESTAMPTZ NOT NULL,
+			duration_ms BIGINT      NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (m *PostgresMigrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Status lists every Postgres migration in version order.
+func (m *PostgresMigrator) Status(ctx context.Context) ([]Status, error) {
+	all, err := SQLMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(all))
+	for _, migration := range all {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if at, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies pending migrations up to and including target, or all of them
+// when target is 0, and returns the versions applied.
+func (m *PostgresMigrator) Up(ctx context.Context, target int) ([]int, error) {
+	all, err := SQLMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, migration := range all {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		ok, err := m.apply(ctx, migration)
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		if ok {
+			done = append(done, migration.Version)
+		}
+	}
+	return done, nil
+}
+
+// apply runs migration unless it is already recorded. The advisory lock is
+// held until the transaction ends, so a concurrent runner waits and then
+// sees the version recorded.
+func (m *PostgresMigrator) apply(ctx context.Context, migration SQLMigration) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, postgresLockID); err != nil {
+		return false, fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	var exists bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version,
+	).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	m.logger.Info("Applying migration", "version", migration.Version, "name", migration.Name)
+	start := time.Now()
+	if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, applied_at, duration_ms) VALUES ($1, $2, $3, $4)`,
+		migration.Version, migration.Name, time.Now().UTC(), time.Since(start).Milliseconds(),
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
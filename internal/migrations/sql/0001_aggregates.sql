@@ -0,0 +1,83 @@
+-- Aggregates for services running with database.driver=postgres. Lookup and
+-- reporting fields are columns; the full aggregate is kept in document.
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id             UUID PRIMARY KEY,
+    tenant_id      UUID        NOT NULL,
+    invoice_number TEXT        NOT NULL,
+    client_id      UUID        NOT NULL,
+    status         TEXT        NOT NULL,
+    currency       TEXT        NOT NULL,
+    total          NUMERIC(20, 4) NOT NULL,
+    amount_due     NUMERIC(20, 4) NOT NULL,
+    due_date       TIMESTAMPTZ,
+    version        BIGINT      NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ NOT NULL,
+    updated_at     TIMESTAMPTZ NOT NULL,
+    document       JSONB       NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS invoices_tenant_number ON invoices (tenant_id, invoice_number);
+CREATE INDEX IF NOT EXISTS invoices_client_created ON invoices (client_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS invoices_tenant_status_due ON invoices (tenant_id, status, due_date);
+
+CREATE TABLE IF NOT EXISTS invoice_counters (
+    tenant_id  UUID        NOT NULL,
+    year       INTEGER     NOT NULL,
+    sequence   BIGINT      NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (tenant_id, year)
+);
+
+CREATE TABLE IF NOT EXISTS payments (
+    id          UUID PRIMARY KEY,
+    tenant_id   UUID        NOT NULL,
+    invoice_id  UUID        NOT NULL,
+    client_id   UUID        NOT NULL,
+    provider_id TEXT,
+    status      TEXT        NOT NULL,
+    amount      NUMERIC(20, 4) NOT NULL,
+    currency    TEXT        NOT NULL,
+    version     BIGINT      NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    document    JSONB       NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS payments_invoice_created ON payments (invoice_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS payments_provider_id ON payments (provider_id) WHERE provider_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS payments_tenant_status ON payments (tenant_id, status);
+
+CREATE TABLE IF NOT EXISTS events (
+    id             TEXT        NOT NULL UNIQUE,
+    aggregate_id   TEXT        NOT NULL,
+    aggregate_type TEXT        NOT NULL,
+    event_type     TEXT        NOT NULL,
+    event_data     JSONB       NOT NULL,
+    tenant_id      TEXT        NOT NULL,
+    user_id        TEXT        NOT NULL,
+    correlation_id TEXT        NOT NULL DEFAULT '',
+    causation_id   TEXT        NOT NULL DEFAULT '',
+    version        BIGINT      NOT NULL,
+    timestamp      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (aggregate_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS events_type_tenant_time ON events (aggregate_type, tenant_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id           TEXT PRIMARY KEY,
+    event_type   TEXT        NOT NULL,
+    aggregate_id TEXT        NOT NULL,
+    tenant_id    TEXT        NOT NULL,
+    payload      BYTEA       NOT NULL,
+    status       TEXT        NOT NULL,
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    locked_until TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL,
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS outbox_delivered ON outbox (delivered_at) WHERE status = 'delivered';
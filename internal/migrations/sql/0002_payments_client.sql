@@ -0,0 +1,4 @@
+-- The payment repository lookup by client, which sums a client's account
+-- credit.
+
+CREATE INDEX IF NOT EXISTS payments_tenant_client_created ON payments (tenant_id, client_id, created_at);
@@ -0,0 +1,22 @@
+-- Current state of each client, kept by the event store in the same
+-- transaction as the client's events. The events table stays the source of
+-- truth; a row is rebuilt from it whenever the client changes.
+
+CREATE TABLE IF NOT EXISTS clients (
+    id         UUID PRIMARY KEY,
+    tenant_id  UUID        NOT NULL,
+    name       TEXT        NOT NULL,
+    email      TEXT        NOT NULL DEFAULT '',
+    status     TEXT        NOT NULL,
+    owner_id   TEXT        NOT NULL DEFAULT '',
+    territory  TEXT        NOT NULL DEFAULT '',
+    version    BIGINT      NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    document   JSONB       NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS clients_tenant_status ON clients (tenant_id, status) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS clients_tenant_email ON clients (tenant_id, lower(email)) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS clients_tenant_owner ON clients (tenant_id, owner_id);
@@ -0,0 +1,160 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// preferenceRequest is the body of PUT /preferences.
+type preferenceRequest struct {
+	Email           string          `json:"email"`
+	Phone           string          `json:"phone"`
+	Locale          string          `json:"locale"`
+	Channels        map[string]bool `json:"channels"`
+	MutedEventTypes []string        `json:"mutedEventTypes"`
+}
+
+// Handler serves the notification API under /api/v1/notifications:
+//
+//	GET    /api/v1/notifications?unread=&limit=      the caller's in-app inbox
+//	POST   /api/v1/notifications/{id}/read           mark an inbox item read
+//	GET    /api/v1/notifications/preferences         the caller's preferences
+//	PUT    /api/v1/notifications/preferences         replace the caller's preferences
+//	GET    /api/v1/notifications/templates           tenant templates and built-in defaults
+//	PUT    /api/v1/notifications/templates           create or replace a tenant template
+//	DELETE /api/v1/notifications/templates/{id}      delete a tenant template
+//
+// It runs behind the tenant middleware.
+func (n *Notifier) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/api/v1/notifications"), "/")
+		parts := strings.Split(path, "/")
+		tenantID := middleware.GetTenantID(req.Context())
+		userID := middleware.GetUserID(req.Context())
+
+		switch {
+		case path == "" && req.Method == http.MethodGet:
+			limit, _ := strconv.ParseInt(req.URL.Query().Get("limit"), 10, 64)
+			if limit <= 0 || limit > 200 {
+				limit = 50
+			}
+			unreadOnly := req.URL.Query().Get("unread") == "true"
+			inbox, err := n.notifications.Inbox(req.Context(), tenantID, userID, unreadOnly, limit)
+			if err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			unread, err := n.notifications.UnreadCount(req.Context(), tenantID, userID)
+			if err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": inbox, "unread": unread})
+
+		case len(parts) == 2 && parts[1] == "read" && req.Method == http.MethodPost:
+			if err := n.notifications.MarkRead(req.Context(), tenantID, userID, parts[0]); err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case path == "preferences" && req.Method == http.MethodGet:
+			pref, err := n.preferences.Get(req.Context(), tenantID, userID)
+			if err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, pref)
+
+		case path == "preferences" && req.Method == http.MethodPut:
+			var body preferenceRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+				httpresponse.ErrorStatus(w, req, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			for channel := range body.Channels {
+				if !domain.ValidChannel(channel) {
+					httpresponse.ErrorStatus(w, req, http.StatusBadRequest, "unknown channel "+channel)
+					return
+				}
+			}
+			pref := &domain.NotificationPreference{
+				TenantID:        tenantID,
+				UserID:          userID,
+				Email:           body.Email,
+				Phone:           body.Phone,
+				Locale:          body.Locale,
+				Channels:        body.Channels,
+				MutedEventTypes: body.MutedEventTypes,
+			}
+			if err := n.preferences.Save(req.Context(), pref); err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, pref)
+
+		case path == "templates" && req.Method == http.MethodGet:
+			templates, err := n.templates.List(req.Context(), tenantID)
+			if err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": templates, "defaults": defaultTemplates})
+
+		case path == "templates" && req.Method == http.MethodPut:
+			var tpl domain.NotificationTemplate
+			if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&tpl); err != nil {
+				httpresponse.ErrorStatus(w, req, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			tpl.TenantID = tenantID
+			if err := tpl.Validate(); err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			if _, _, err := Render(tpl, TemplateData{}); err != nil {
+				httpresponse.ErrorStatus(w, req, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := n.templates.Save(req.Context(), &tpl); err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, tpl)
+
+		case len(parts) == 2 && parts[0] == "templates" && req.Method == http.MethodDelete:
+			if err := n.templates.Delete(req.Context(), tenantID, parts[1]); err != nil {
+				n.writeError(w, req, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case path == "" || path == "preferences" || path == "templates" ||
+			(len(parts) == 2 && (parts[1] == "read" || parts[0] == "templates")):
+			httpresponse.ErrorStatus(w, req, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			httpresponse.ErrorStatus(w, req, http.StatusNotFound, "not found")
+		}
+	})
+}
+
+func (n *Notifier) writeError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidNotificationTemplate):
+		httpresponse.ErrorStatus(w, req, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrNotificationNotFound), errors.Is(err, repository.ErrNotificationTemplateNotFound):
+		httpresponse.ErrorStatus(w, req, http.StatusNotFound, err.Error())
+	default:
+		n.logger.Error("Notification request failed", "error", err)
+		httpresponse.ErrorStatus(w, req, http.StatusInternalServerError, "notification service unavailable")
+	}
+}
@@ -0,0 +1,357 @@
+// Package notification turns domain events into email, SMS and in-app
+// notifications. Rules decide which events notify the client an event is
+// about, the user who caused it or the users it mentions; templates are
+// looked up per tenant and recipient locale, falling back to built-in ones. A recipient without a
+// locale of their own gets the tenant's.
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/fieldcrypt"
+	"github.com/ims-erp/system/pkg/i18n"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultRules apply when the configuration has none.
+var DefaultRules = []config.NotificationRule{
+	{EventType: "invoice.sent", Audience: domain.AudienceClient, Channels: []string{domain.ChannelEmail}},
+	{EventType: "invoice.reminder_sent", Audience: domain.AudienceClient, Channels: []string{domain.ChannelEmail}},
+	{EventType: "invoice.paid", Audience: domain.AudienceUser, Channels: []string{domain.ChannelInApp, domain.ChannelEmail}},
+	{EventType: "payment.failed", Audience: domain.AudienceUser, Channels: []string{domain.ChannelInApp, domain.ChannelEmail, domain.ChannelSMS}},
+	{EventType: "order.shipped", Audience: domain.AudienceClient, Channels: []string{domain.ChannelEmail, domain.ChannelSMS}},
+	{EventType: "comment.mentioned", Audience: domain.AudienceMentioned, Channels: []string{domain.ChannelInApp, domain.ChannelEmail}},
+}
+
+// recipient is who a rule notifies. UserID is empty for clients, who have
+// no inbox and no preferences.
+type recipient struct {
+	UserID string
+	Name   string
+	Email  string
+	Phone  string
+	Locale string
+	pref   *domain.NotificationPreference
+}
+
+func (r *recipient) address(channel string) string {
+	switch channel {
+	case domain.ChannelEmail:
+		return r.Email
+	case domain.ChannelSMS:
+		return r.Phone
+	case domain.ChannelInApp:
+		return r.UserID
+	}
+	return ""
+}
+
+type Notifier struct {
+	templates     *repository.NotificationTemplateStore
+	preferences   *repository.NotificationPreferenceStore
+	notifications *repository.NotificationStore
+	clients       *repository.ReadModelStore
+	providers     map[string]Provider
+	rules         map[string][]config.NotificationRule
+	cfg           config.NotificationConfig
+	locales       config.I18nConfig
+	logger        *logger.Logger
+}
+
+func NewNotifier(db *repository.MongoDB, cfg config.NotificationConfig, locales config.I18nConfig, providers map[string]Provider, log *logger.Logger) *Notifier {
+	rules := cfg.Rules
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+	byEvent := make(map[string][]config.NotificationRule)
+	for _, rule := range rules {
+		byEvent[rule.EventType] = append(byEvent[rule.EventType], rule)
+	}
+
+	return &Notifier{
+		templates:     repository.NewNotificationTemplateStore(db),
+		preferences:   repository.NewNotificationPreferenceStore(db),
+		notifications: repository.NewNotificationStore(db),
+		clients:       repository.NewReadModelStore(db, "client_read", log),
+		providers:     providers,
+		rules:         byEvent,
+		cfg:           cfg,
+		locales:       locales,
+		logger:        log,
+	}
+}
+
+// WithEncryption lets the notifier read client contact details encrypted
+// with keyring.
+func (n *Notifier) WithEncryption(keyring *fieldcrypt.Keyring) *Notifier {
+	n.clients.WithEncryption(keyring, repository.ClientPIIFields...)
+	return n
+}
+
+func (n *Notifier) EnsureIndexes(ctx context.Context) error {
+	if err := n.templates.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	if err := n.preferences.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	return n.notifications.EnsureIndexes(ctx, n.cfg.Retention)
+}
+
+// HandleEvent sends the notifications the rules ask for. An event that was
+// already handled is not sent again.
+func (n *Notifier) HandleEvent(ctx context.Context, event *events.EventEnvelope) error {
+	rules := n.rules[event.Type]
+	if len(rules) == 0 || event.TenantID == "" {
+		return nil
+	}
+
+	var errs []error
+	for _, rule := range rules {
+		recipients, err := n.recipients(ctx, event, rule.Audience)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, to := range recipients {
+			for _, channel := range rule.Channels {
+				if err := n.notify(ctx, event, to, channel); err != nil {
+					errs = append(errs, fmt.Errorf("%s via %s: %w", event.Type, channel, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recipients looks up the recipients for audience. Only the mentioned
+// audience can have more than one.
+func (n *Notifier) recipients(ctx context.Context, event *events.EventEnvelope, audience string) ([]*recipient, error) {
+	if audience != domain.AudienceMentioned {
+		to, err := n.resolve(ctx, event, audience)
+		if err != nil || to == nil {
+			return nil, err
+		}
+		return []*recipient{to}, nil
+	}
+
+	mentions, _ := event.Data["mentions"].([]interface{})
+	var recipients []*recipient
+	for _, mention := range mentions {
+		userID, _ := mention.(string)
+		if userID == "" {
+			continue
+		}
+		to, err := n.user(ctx, event.TenantID, userID)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, to)
+	}
+	return recipients, nil
+}
+
+// resolve looks up the recipient for audience, or returns nil if the event
+// has none.
+func (n *Notifier) resolve(ctx context.Context, event *events.EventEnvelope, audience string) (*recipient, error) {
+	switch audience {
+	case domain.AudienceUser:
+		if event.UserID == "" {
+			return nil, nil
+		}
+		return n.user(ctx, event.TenantID, event.UserID)
+
+	case domain.AudienceClient:
+		clientID, _ := event.Data["clientId"].(string)
+		if clientID == "" {
+			return nil, nil
+		}
+		result, err := n.clients.FindOne(ctx, repository.NotDeleted(bson.M{"_id": clientID, "tenantId": event.TenantID}))
+		if err != nil || result == nil {
+			return nil, err
+		}
+		client, _ := result.(bson.M)
+		name, _ := client["name"].(string)
+		email, _ := client["email"].(string)
+		phone, _ := client["phone"].(string)
+		locale, _ := client["locale"].(string)
+		return &recipient{Name: name, Email: email, Phone: phone, Locale: n.localeFor(event.TenantID, locale)}, nil
+	}
+
+	n.logger.Warn("Unknown notification audience", "audience", audience, "event_type", event.Type)
+	return nil, nil
+}
+
+func (n *Notifier) notify(ctx context.Context, event *events.EventEnvelope, to *recipient, channel string) error {
+	if to.pref != nil && !to.pref.Allows(channel, event.Type) {
+		return nil
+	}
+	address := to.address(channel)
+	if address == "" {
+		return nil
+	}
+	provider := n.providers[channel]
+	if provider == nil && channel != domain.ChannelInApp {
+		n.logger.Debug("No provider for notification channel", "channel", channel, "event_type", event.Type)
+		return nil
+	}
+
+	subject, body, ok, err := n.render(ctx, event, to, channel)
+	if err != nil || !ok {
+		return err
+	}
+
+	now := time.Now().UTC()
+	record := &domain.Notification{
+		TenantID:  event.TenantID,
+		UserID:    to.UserID,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Channel:   channel,
+		Recipient: address,
+		Subject:   subject,
+		Body:      body,
+		Status:    domain.NotificationPending,
+		CreatedAt: now,
+	}
+	if channel == domain.ChannelInApp {
+		record.Status = domain.NotificationSent
+		record.SentAt = &now
+	}
+	if err := n.notifications.Add(ctx, record); err != nil {
+		if errors.Is(err, repository.ErrNotificationExists) {
+			return nil
+		}
+		return err
+	}
+	if channel == domain.ChannelInApp {
+		return nil
+	}
+
+	sendErr := provider.Send(ctx, Message{To: address, Subject: subject, Body: body})
+	if sendErr != nil {
+		record.Status = domain.NotificationFailed
+		record.Error = sendErr.Error()
+	} else {
+		sentAt := time.Now().UTC()
+		record.Status = domain.NotificationSent
+		record.SentAt = &sentAt
+	}
+	if err := n.notifications.SetStatus(ctx, record); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// render renders the event's template for the recipient and channel. It
+// reports false when there is no template.
+func (n *Notifier) render(ctx context.Context, event *events.EventEnvelope, to *recipient, channel string) (string, string, bool, error) {
+	tpl, ok, err := n.template(ctx, event.TenantID, event.Type, channel, to.Locale)
+	if err != nil || !ok {
+		return "", "", false, err
+	}
+	subject, body, err := Render(tpl, TemplateData{
+		EventID:       event.ID,
+		EventType:     event.Type,
+		AggregateID:   event.AggregateID,
+		OccurredAt:    event.Timestamp,
+		RecipientName: to.Name,
+		Locale:        i18n.Resolve(to.Locale, n.cfg.DefaultLocale),
+		Data:          event.Data,
+	})
+	if err != nil {
+		return "", "", false, err
+	}
+	return subject, body, true, nil
+}
+
+// Preview is a notification as it would be sent.
+type Preview struct {
+	Channel   string `json:"channel"`
+	Recipient string `json:"recipient,omitempty"`
+	Locale    string `json:"locale"`
+	Subject   string `json:"subject,omitempty"`
+	Body      string `json:"body"`
+}
+
+// Preview renders the notifications the rules would send for event,
+// without sending or recording them. Recipient is empty when the recipient
+// has no address for the channel; users' opt-outs are not applied.
+func (n *Notifier) Preview(ctx context.Context, event *events.EventEnvelope) ([]Preview, error) {
+	previews := []Preview{}
+	for _, rule := range n.rules[event.Type] {
+		recipients, err := n.recipients(ctx, event, rule.Audience)
+		if err != nil {
+			return nil, err
+		}
+		for _, to := range recipients {
+			for _, channel := range rule.Channels {
+				subject, body, ok, err := n.render(ctx, event, to, channel)
+				if err != nil {
+					return nil, fmt.Errorf("%s via %s: %w", event.Type, channel, err)
+				}
+				if !ok {
+					continue
+				}
+				previews = append(previews, Preview{
+					Channel:   channel,
+					Recipient: to.address(channel),
+					Locale:    i18n.Resolve(to.Locale, n.cfg.DefaultLocale),
+					Subject:   subject,
+					Body:      body,
+				})
+			}
+		}
+	}
+	return previews, nil
+}
+
+// user returns a user of tenantID as a recipient, reached as their
+// preferences say.
+func (n *Notifier) user(ctx context.Context, tenantID, userID string) (*recipient, error) {
+	pref, err := n.preferences.Get(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &recipient{
+		UserID: userID,
+		Email:  pref.Email,
+		Phone:  pref.Phone,
+		Locale: n.localeFor(tenantID, pref.Locale),
+		pref:   pref,
+	}, nil
+}
+
+// localeFor returns locale, or the tenant's locale when the recipient has
+// none.
+func (n *Notifier) localeFor(tenantID, locale string) string {
+	if locale != "" {
+		return locale
+	}
+	return n.locales.LocaleFor(tenantID)
+}
+
+// template finds the best template for locale: the tenant's own, then the
+// built-in one, trying the locale, its language and the default locale in
+// turn.
+func (n *Notifier) template(ctx context.Context, tenantID, eventType, channel, locale string) (domain.NotificationTemplate, bool, error) {
+	locales := LocaleCandidates(locale, n.cfg.DefaultLocale)
+
+	custom, err := n.templates.Find(ctx, tenantID, eventType, channel, locales)
+	if err != nil {
+		return domain.NotificationTemplate{}, false, err
+	}
+	if tpl, ok := pickTemplate(custom, eventType, channel, locales); ok {
+		return tpl, true, nil
+	}
+	tpl, ok := pickTemplate(defaultTemplates, eventType, channel, locales)
+	return tpl, ok, nil
+}
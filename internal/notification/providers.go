@@ -0,0 +1,181 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+)
+
+// Message is a rendered notification for one recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Provider sends messages on an external channel.
+type Provider interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewProviders builds the configured email and SMS providers, keyed by
+// channel. Channels without a provider are left out.
+func NewProviders(cfg config.NotificationConfig) (map[string]Provider, error) {
+	client := &http.Client{Timeout: cfg.Timeout}
+	providers := make(map[string]Provider)
+
+	switch email := cfg.Email; email.Provider {
+	case "":
+	case "smtp":
+		providers[domain.ChannelEmail] = &SMTPProvider{
+			Addr:     net.JoinHostPort(email.SMTPHost, strconv.Itoa(email.SMTPPort)),
+			Host:     email.SMTPHost,
+			Username: email.SMTPUsername,
+			Password: email.SMTPPassword,
+			From:     email.From,
+		}
+	case "sendgrid":
+		providers[domain.ChannelEmail] = &SendGridProvider{
+			APIKey:   email.SendGridAPIKey,
+			From:     email.From,
+			Endpoint: "https://api.sendgrid.com/v3/mail/send",
+			Client:   client,
+		}
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", email.Provider)
+	}
+
+	switch sms := cfg.SMS; sms.Provider {
+	case "":
+	case "twilio":
+		providers[domain.ChannelSMS] = &TwilioProvider{
+			AccountSID: sms.TwilioAccountSID,
+			AuthToken:  sms.TwilioAuthToken,
+			From:       sms.From,
+			BaseURL:    "https://api.twilio.com",
+			Client:     client,
+		}
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", sms.Provider)
+	}
+
+	return providers, nil
+}
+
+// SMTPProvider sends plain text email through an SMTP relay, using
+// STARTTLS when the server offers it.
+type SMTPProvider struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (p *SMTPProvider) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if p.Username != "" {
+		auth = smtp.PlainAuth("", p.Username, p.Password, p.Host)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", headerValue(p.From))
+	fmt.Fprintf(&body, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&body, "Subject: %s\r\n", headerValue(msg.Subject))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(p.Addr, auth, p.From, []string{msg.To}, []byte(body.String())); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// headerValue keeps rendered values from injecting extra mail headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+}
+
+// SendGridProvider sends email through the SendGrid v3 API.
+type SendGridProvider struct {
+	APIKey   string
+	From     string
+	Endpoint string
+	Client   *http.Client
+}
+
+func (p *SendGridProvider) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{
+			{"to": []map[string]string{{"email": msg.To}}},
+		},
+		"from":    map[string]string{"email": p.From},
+		"subject": msg.Subject,
+		"content": []map[string]string{{"type": "text/plain", "value": msg.Body}},
+	})
+	if err != nil {
+		return fmt.Errorf("sendgrid: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("sendgrid: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	return doProviderRequest(p.Client, req, "sendgrid")
+}
+
+// TwilioProvider sends SMS through the Twilio Messages API.
+type TwilioProvider struct {
+	AccountSID string
+	AuthToken  string
+	From       string
+	BaseURL    string
+	Client     *http.Client
+}
+
+func (p *TwilioProvider) Send(ctx context.Context, msg Message) error {
+	form := url.Values{}
+	form.Set("To", msg.To)
+	form.Set("From", p.From)
+	form.Set("Body", msg.Body)
+
+	endpoint := p.BaseURL + "/2010-04-01/Accounts/" + url.PathEscape(p.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("twilio: %w", err)
+	}
+	req.SetBasicAuth(p.AccountSID, p.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return doProviderRequest(p.Client, req, "twilio")
+}
+
+func doProviderRequest(client *http.Client, req *http.Request, provider string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: unexpected status %d: %s", provider, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	return nil
+}
@@ -0,0 +1,68 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProviders(t *testing.T) {
+	providers, err := NewProviders(config.NotificationConfig{
+		Email: config.EmailProviderConfig{Provider: "sendgrid"},
+		SMS:   config.SMSProviderConfig{Provider: "twilio"},
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &SendGridProvider{}, providers[domain.ChannelEmail])
+	assert.IsType(t, &TwilioProvider{}, providers[domain.ChannelSMS])
+
+	providers, err = NewProviders(config.NotificationConfig{})
+	require.NoError(t, err)
+	assert.Empty(t, providers)
+
+	_, err = NewProviders(config.NotificationConfig{Email: config.EmailProviderConfig{Provider: "pigeon"}})
+	assert.Error(t, err)
+}
+
+func TestSendGridProvider_Send(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	p := &SendGridProvider{APIKey: "key", From: "erp@example.com", Endpoint: srv.URL, Client: srv.Client()}
+	require.NoError(t, p.Send(context.Background(), Message{To: "a@example.com", Subject: "Hi", Body: "Hello"}))
+
+	assert.Equal(t, "Hi", body["subject"])
+	assert.Equal(t, map[string]interface{}{"email": "erp@example.com"}, body["from"])
+}
+
+func TestTwilioProvider_Send(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2010-04-01/Accounts/AC1/Messages.json", r.URL.Path)
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "AC1", user)
+		assert.Equal(t, "token", pass)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "+15550001", r.PostForm.Get("To"))
+		assert.Equal(t, "Hello", r.PostForm.Get("Body"))
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"invalid number"}`))
+	}))
+	defer srv.Close()
+
+	p := &TwilioProvider{AccountSID: "AC1", AuthToken: "token", From: "+15559999", BaseURL: srv.URL, Client: srv.Client()}
+	err := p.Send(context.Background(), Message{To: "+15550001", Body: "Hello"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status 400")
+	assert.Contains(t, err.Error(), "invalid number")
+}
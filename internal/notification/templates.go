@@ -0,0 +1,461 @@
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/i18n"
+	"github.com/shopspring/decimal"
+)
+
+// TemplateData is passed to templates. Data is the event payload, e.g.
+// {{.Data.invoiceNumber}}. Locale is the recipient's locale; the money,
+// number and date functions format in it, e.g.
+// {{money .Data.total .Data.currency}}.
+type TemplateData struct {
+	EventID       string
+	EventType     string
+	AggregateID   string
+	OccurredAt    time.Time
+	RecipientName string
+	Locale        string
+	Data          map[string]interface{}
+}
+
+// defaultTemplates are used when a tenant has no template of its own for an
+// event type, channel and locale. Every built-in template exists in each
+// locale of i18n.Supported.
+var defaultTemplates = []domain.NotificationTemplate{
+	{
+		EventType: "invoice.sent",
+		Channel:   domain.ChannelEmail,
+		Locale:    "en",
+		Subject:   "Invoice {{.Data.invoiceNumber}}",
+		Body:      "Hello{{with .RecipientName}} {{.}}{{end}},\n\nInvoice {{.Data.invoiceNumber}} for {{money .Data.total .Data.currency}} has been issued to you.\n",
+	},
+	{
+		EventType: "invoice.reminder_sent",
+		Channel:   domain.ChannelEmail,
+		Locale:    "en",
+		Subject:   "Payment reminder: invoice {{.Data.invoiceNumber}}",
+		Body:      "Hello{{with .RecipientName}} {{.}}{{end}},\n\nThis is a reminder that {{money .Data.amountDue .Data.currency}} of invoice {{.Data.invoiceNumber}} is still outstanding{{with .Data.dueDate}}; it was due on {{date .}}{{end}}. If you have already paid, please disregard this message.\n",
+	},
+	{
+		EventType: "invoice.paid",
+		Channel:   domain.ChannelEmail,
+		Locale:    "en",
+		Subject:   "Invoice {{.Data.invoiceNumber}} paid",
+		Body:      "Invoice {{.Data.invoiceNumber}} has been paid in full ({{money .Data.amountPaid .Data.currency}}).\n",
+	},
+	{
+		EventType: "invoice.paid",
+		Channel:   domain.ChannelInApp,
+		Locale:    "en",
+		Subject:   "Invoice paid",
+		Body:      "Invoice {{.Data.invoiceNumber}} has been paid in full.",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelEmail,
+		Locale:    "en",
+		Subject:   "Payment failed",
+		Body:      "A payment of {{number .Data.amount 2}} failed: {{.Data.failureMessage}}.\n",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelSMS,
+		Locale:    "en",
+		Body:      "Payment of {{number .Data.amount 2}} failed: {{.Data.failureMessage}}",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelInApp,
+		Locale:    "en",
+		Subject:   "Payment failed",
+		Body:      "A payment of {{number .Data.amount 2}} failed: {{.Data.failureMessage}}.",
+	},
+	{
+		EventType: "order.shipped",
+		Channel:   domain.ChannelEmail,
+		Locale:    "en",
+		Subject:   "Your order {{.Data.orderNumber}} has shipped",
+		Body:      "Hello{{with .RecipientName}} {{.}}{{end}},\n\nYour order {{.Data.orderNumber}} is on its way.{{with .Data.trackingNumber}} Tracking number: {{.}}.{{end}}\n",
+	},
+	{
+		EventType: "order.shipped",
+		Channel:   domain.ChannelSMS,
+		Locale:    "en",
+		Body:      "Your order {{.Data.orderNumber}} has shipped.{{with .Data.trackingNumber}} Tracking: {{.}}{{end}}",
+	},
+	{
+		EventType: "comment.mentioned",
+		Channel:   domain.ChannelEmail,
+		Locale:    "en",
+		Subject:   "You were mentioned in a comment",
+		Body:      "You were mentioned in a comment on {{.Data.entityType}} {{.Data.entityId}}:\n\n{{.Data.body}}\n",
+	},
+	{
+		EventType: "comment.mentioned",
+		Channel:   domain.ChannelInApp,
+		Locale:    "en",
+		Subject:   "You were mentioned in a comment",
+		Body:      "You were mentioned on {{.Data.entityType}} {{.Data.entityId}}: {{.Data.body}}",
+	},
+	{
+		EventType: "invoice.sent",
+		Channel:   domain.ChannelEmail,
+		Locale:    "de",
+		Subject:   "Rechnung {{.Data.invoiceNumber}}",
+		Body:      "Guten Tag{{with .RecipientName}} {{.}}{{end}},\n\nwir haben Ihnen die Rechnung {{.Data.invoiceNumber}} über {{money .Data.total .Data.currency}} ausgestellt.\n",
+	},
+	{
+		EventType: "invoice.reminder_sent",
+		Channel:   domain.ChannelEmail,
+		Locale:    "de",
+		Subject:   "Zahlungserinnerung: Rechnung {{.Data.invoiceNumber}}",
+		Body:      "Guten Tag{{with .RecipientName}} {{.}}{{end}},\n\nwir möchten Sie daran erinnern, dass von der Rechnung {{.Data.invoiceNumber}} noch {{money .Data.amountDue .Data.currency}} offen sind{{with .Data.dueDate}}; sie war am {{date .}} fällig{{end}}. Sollten Sie bereits bezahlt haben, betrachten Sie diese Nachricht bitte als gegenstandslos.\n",
+	},
+	{
+		EventType: "invoice.paid",
+		Channel:   domain.ChannelEmail,
+		Locale:    "de",
+		Subject:   "Rechnung {{.Data.invoiceNumber}} bezahlt",
+		Body:      "Die Rechnung {{.Data.invoiceNumber}} wurde vollständig bezahlt ({{money .Data.amountPaid .Data.currency}}).\n",
+	},
+	{
+		EventType: "invoice.paid",
+		Channel:   domain.ChannelInApp,
+		Locale:    "de",
+		Subject:   "Rechnung bezahlt",
+		Body:      "Die Rechnung {{.Data.invoiceNumber}} wurde vollständig bezahlt.",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelEmail,
+		Locale:    "de",
+		Subject:   "Zahlung fehlgeschlagen",
+		Body:      "Eine Zahlung über {{number .Data.amount 2}} ist fehlgeschlagen: {{.Data.failureMessage}}.\n",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelSMS,
+		Locale:    "de",
+		Body:      "Zahlung über {{number .Data.amount 2}} fehlgeschlagen: {{.Data.failureMessage}}",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelInApp,
+		Locale:    "de",
+		Subject:   "Zahlung fehlgeschlagen",
+		Body:      "Eine Zahlung über {{number .Data.amount 2}} ist fehlgeschlagen: {{.Data.failureMessage}}.",
+	},
+	{
+		EventType: "order.shipped",
+		Channel:   domain.ChannelEmail,
+		Locale:    "de",
+		Subject:   "Ihre Bestellung {{.Data.orderNumber}} wurde versandt",
+		Body:      "Guten Tag{{with .RecipientName}} {{.}}{{end}},\n\nIhre Bestellung {{.Data.orderNumber}} ist unterwegs.{{with .Data.trackingNumber}} Sendungsnummer: {{.}}.{{end}}\n",
+	},
+	{
+		EventType: "order.shipped",
+		Channel:   domain.ChannelSMS,
+		Locale:    "de",
+		Body:      "Ihre Bestellung {{.Data.orderNumber}} wurde versandt.{{with .Data.trackingNumber}} Sendung: {{.}}{{end}}",
+	},
+	{
+		EventType: "comment.mentioned",
+		Channel:   domain.ChannelEmail,
+		Locale:    "de",
+		Subject:   "Sie wurden in einem Kommentar erwähnt",
+		Body:      "Sie wurden in einem Kommentar zu {{.Data.entityType}} {{.Data.entityId}} erwähnt:\n\n{{.Data.body}}\n",
+	},
+	{
+		EventType: "comment.mentioned",
+		Channel:   domain.ChannelInApp,
+		Locale:    "de",
+		Subject:   "Sie wurden in einem Kommentar erwähnt",
+		Body:      "Sie wurden bei {{.Data.entityType}} {{.Data.entityId}} erwähnt: {{.Data.body}}",
+	},
+	{
+		EventType: "invoice.sent",
+		Channel:   domain.ChannelEmail,
+		Locale:    "fr",
+		Subject:   "Facture {{.Data.invoiceNumber}}",
+		Body:      "Bonjour{{with .RecipientName}} {{.}}{{end}},\n\nLa facture {{.Data.invoiceNumber}} d'un montant de {{money .Data.total .Data.currency}} vous a été émise.\n",
+	},
+	{
+		EventType: "invoice.reminder_sent",
+		Channel:   domain.ChannelEmail,
+		Locale:    "fr",
+		Subject:   "Rappel de paiement : facture {{.Data.invoiceNumber}}",
+		Body:      "Bonjour{{with .RecipientName}} {{.}}{{end}},\n\nNous vous rappelons que {{money .Data.amountDue .Data.currency}} de la facture {{.Data.invoiceNumber}} restent à régler{{with .Data.dueDate}} ; elle était échue le {{date .}}{{end}}. Si vous avez déjà payé, veuillez ne pas tenir compte de ce message.\n",
+	},
+	{
+		EventType: "invoice.paid",
+		Channel:   domain.ChannelEmail,
+		Locale:    "fr",
+		Subject:   "Facture {{.Data.invoiceNumber}} payée",
+		Body:      "La facture {{.Data.invoiceNumber}} a été entièrement payée ({{money .Data.amountPaid .Data.currency}}).\n",
+	},
+	{
+		EventType: "invoice.paid",
+		Channel:   domain.ChannelInApp,
+		Locale:    "fr",
+		Subject:   "Facture payée",
+		Body:      "La facture {{.Data.invoiceNumber}} a été entièrement payée.",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelEmail,
+		Locale:    "fr",
+		Subject:   "Échec du paiement",
+		Body:      "Un paiement de {{number .Data.amount 2}} a échoué : {{.Data.failureMessage}}.\n",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelSMS,
+		Locale:    "fr",
+		Body:      "Paiement de {{number .Data.amount 2}} échoué : {{.Data.failureMessage}}",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelInApp,
+		Locale:    "fr",
+		Subject:   "Échec du paiement",
+		Body:      "Un paiement de {{number .Data.amount 2}} a échoué : {{.Data.failureMessage}}.",
+	},
+	{
+		EventType: "order.shipped",
+		Channel:   domain.ChannelEmail,
+		Locale:    "fr",
+		Subject:   "Votre commande {{.Data.orderNumber}} a été expédiée",
+		Body:      "Bonjour{{with .RecipientName}} {{.}}{{end}},\n\nVotre commande {{.Data.orderNumber}} est en route.{{with .Data.trackingNumber}} Numéro de suivi : {{.}}.{{end}}\n",
+	},
+	{
+		EventType: "order.shipped",
+		Channel:   domain.ChannelSMS,
+		Locale:    "fr",
+		Body:      "Votre commande {{.Data.orderNumber}} a été expédiée.{{with .Data.trackingNumber}} Suivi : {{.}}{{end}}",
+	},
+	{
+		EventType: "comment.mentioned",
+		Channel:   domain.ChannelEmail,
+		Locale:    "fr",
+		Subject:   "Vous avez été mentionné dans un commentaire",
+		Body:      "Vous avez été mentionné dans un commentaire sur {{.Data.entityType}} {{.Data.entityId}} :\n\n{{.Data.body}}\n",
+	},
+	{
+		EventType: "comment.mentioned",
+		Channel:   domain.ChannelInApp,
+		Locale:    "fr",
+		Subject:   "Vous avez été mentionné dans un commentaire",
+		Body:      "Vous avez été mentionné sur {{.Data.entityType}} {{.Data.entityId}} : {{.Data.body}}",
+	},
+	{
+		EventType: "invoice.sent",
+		Channel:   domain.ChannelEmail,
+		Locale:    "es",
+		Subject:   "Factura {{.Data.invoiceNumber}}",
+		Body:      "Hola{{with .RecipientName}} {{.}}{{end}}:\n\nSe le ha emitido la factura {{.Data.invoiceNumber}} por {{money .Data.total .Data.currency}}.\n",
+	},
+	{
+		EventType: "invoice.reminder_sent",
+		Channel:   domain.ChannelEmail,
+		Locale:    "es",
+		Subject:   "Recordatorio de pago: factura {{.Data.invoiceNumber}}",
+		Body:      "Hola{{with .RecipientName}} {{.}}{{end}}:\n\nLe recordamos que quedan pendientes {{money .Data.amountDue .Data.currency}} de la factura {{.Data.invoiceNumber}}{{with .Data.dueDate}}, que vencía el {{date .}}{{end}}. Si ya ha realizado el pago, ignore este mensaje.\n",
+	},
+	{
+		EventType: "invoice.paid",
+		Channel:   domain.ChannelEmail,
+		Locale:    "es",
+		Subject:   "Factura {{.Data.invoiceNumber}} pagada",
+		Body:      "La factura {{.Data.invoiceNumber}} se ha pagado por completo ({{money .Data.amountPaid .Data.currency}}).\n",
+	},
+	{
+		EventType: "invoice.paid",
+		Channel:   domain.ChannelInApp,
+		Locale:    "es",
+		Subject:   "Factura pagada",
+		Body:      "La factura {{.Data.invoiceNumber}} se ha pagado por completo.",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelEmail,
+		Locale:    "es",
+		Subject:   "Pago fallido",
+		Body:      "Un pago de {{number .Data.amount 2}} ha fallado: {{.Data.failureMessage}}.\n",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelSMS,
+		Locale:    "es",
+		Body:      "El pago de {{number .Data.amount 2}} ha fallado: {{.Data.failureMessage}}",
+	},
+	{
+		EventType: "payment.failed",
+		Channel:   domain.ChannelInApp,
+		Locale:    "es",
+		Subject:   "Pago fallido",
+		Body:      "Un pago de {{number .Data.amount 2}} ha fallado: {{.Data.failureMessage}}.",
+	},
+	{
+		EventType: "order.shipped",
+		Channel:   domain.ChannelEmail,
+		Locale:    "es",
+		Subject:   "Su pedido {{.Data.orderNumber}} ha sido enviado",
+		Body:      "Hola{{with .RecipientName}} {{.}}{{end}}:\n\nSu pedido {{.Data.orderNumber}} está en camino.{{with .Data.trackingNumber}} Número de seguimiento: {{.}}.{{end}}\n",
+	},
+	{
+		EventType: "order.shipped",
+		Channel:   domain.ChannelSMS,
+		Locale:    "es",
+		Body:      "Su pedido {{.Data.orderNumber}} ha sido enviado.{{with .Data.trackingNumber}} Seguimiento: {{.}}{{end}}",
+	},
+	{
+		EventType: "comment.mentioned",
+		Channel:   domain.ChannelEmail,
+		Locale:    "es",
+		Subject:   "Le han mencionado en un comentario",
+		Body:      "Le han mencionado en un comentario sobre {{.Data.entityType}} {{.Data.entityId}}:\n\n{{.Data.body}}\n",
+	},
+	{
+		EventType: "comment.mentioned",
+		Channel:   domain.ChannelInApp,
+		Locale:    "es",
+		Subject:   "Le han mencionado en un comentario",
+		Body:      "Le han mencionado en {{.Data.entityType}} {{.Data.entityId}}: {{.Data.body}}",
+	},
+}
+
+// LocaleCandidates lists the locales to try for locale, most specific first:
+// "de-AT" gives de-AT, de and then fallback.
+func LocaleCandidates(locale, fallback string) []string {
+	var candidates []string
+	add := func(l string) {
+		if l == "" {
+			return
+		}
+		for _, c := range candidates {
+			if c == l {
+				return
+			}
+		}
+		candidates = append(candidates, l)
+	}
+
+	add(locale)
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		add(locale[:i])
+	}
+	add(fallback)
+	return candidates
+}
+
+// pickTemplate returns the template whose locale comes first in locales.
+func pickTemplate(templates []domain.NotificationTemplate, eventType, channel string, locales []string) (domain.NotificationTemplate, bool) {
+	for _, locale := range locales {
+		for _, tpl := range templates {
+			if tpl.EventType == eventType && tpl.Channel == channel && tpl.Locale == locale {
+				return tpl, true
+			}
+		}
+	}
+	return domain.NotificationTemplate{}, false
+}
+
+// Render executes the template's subject and body with data. Missing data
+// fields render as empty.
+func Render(tpl domain.NotificationTemplate, data TemplateData) (string, string, error) {
+	subject, err := execute("subject", tpl.Subject, data)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := execute("body", tpl.Body, data)
+	if err != nil {
+		return "", "", err
+	}
+	return subject, body, nil
+}
+
+func execute(name, text string, data TemplateData) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	t, err := template.New(name).Option("missingkey=zero").Funcs(formatFuncs(data.Locale)).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return strings.ReplaceAll(buf.String(), "<no value>", ""), nil
+}
+
+// formatFuncs returns the template functions that format values from event
+// payloads in locale. Values that are missing or do not parse render as
+// given.
+func formatFuncs(locale string) template.FuncMap {
+	locale = i18n.Resolve(locale)
+	return template.FuncMap{
+		"money": func(amount interface{}, currency interface{}) string {
+			value, ok := toDecimal(amount)
+			if !ok {
+				return toString(amount)
+			}
+			return i18n.FormatMoney(locale, value, toString(currency))
+		},
+		"number": func(amount interface{}, places int) string {
+			value, ok := toDecimal(amount)
+			if !ok {
+				return toString(amount)
+			}
+			return i18n.FormatNumber(locale, value, int32(places))
+		},
+		"date": func(value interface{}) string {
+			switch v := value.(type) {
+			case time.Time:
+				return i18n.FormatDate(locale, v)
+			case *time.Time:
+				if v != nil {
+					return i18n.FormatDate(locale, *v)
+				}
+				return ""
+			case string:
+				if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+					return i18n.FormatDate(locale, t)
+				}
+			}
+			return toString(value)
+		},
+	}
+}
+
+func toDecimal(value interface{}) (decimal.Decimal, bool) {
+	switch v := value.(type) {
+	case string:
+		d, err := decimal.NewFromString(v)
+		return d, err == nil
+	case float64:
+		return decimal.NewFromFloat(v), true
+	case int:
+		return decimal.NewFromInt(int64(v)), true
+	case int64:
+		return decimal.NewFromInt(v), true
+	case decimal.Decimal:
+		return v, true
+	}
+	return decimal.Decimal{}, false
+}
+
+func toString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,93 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocaleCandidates(t *testing.T) {
+	assert.Equal(t, []string{"de-AT", "de", "en"}, LocaleCandidates("de-AT", "en"))
+	assert.Equal(t, []string{"pt_BR", "pt", "en"}, LocaleCandidates("pt_BR", "en"))
+	assert.Equal(t, []string{"en"}, LocaleCandidates("en", "en"))
+	assert.Equal(t, []string{"en"}, LocaleCandidates("", "en"))
+}
+
+func TestPickTemplate_PrefersMostSpecificLocale(t *testing.T) {
+	templates := []domain.NotificationTemplate{
+		{EventType: "invoice.sent", Channel: domain.ChannelEmail, Locale: "en", Body: "en"},
+		{EventType: "invoice.sent", Channel: domain.ChannelEmail, Locale: "de", Body: "de"},
+		{EventType: "invoice.sent", Channel: domain.ChannelSMS, Locale: "de-AT", Body: "sms"},
+	}
+
+	tpl, ok := pickTemplate(templates, "invoice.sent", domain.ChannelEmail, LocaleCandidates("de-AT", "en"))
+	require.True(t, ok)
+	assert.Equal(t, "de", tpl.Body)
+
+	tpl, ok = pickTemplate(templates, "invoice.sent", domain.ChannelEmail, LocaleCandidates("fr", "en"))
+	require.True(t, ok)
+	assert.Equal(t, "en", tpl.Body)
+
+	_, ok = pickTemplate(templates, "invoice.paid", domain.ChannelEmail, []string{"en"})
+	assert.False(t, ok)
+}
+
+func TestRender(t *testing.T) {
+	tpl := domain.NotificationTemplate{
+		Subject: "Invoice {{.Data.invoiceNumber}}",
+		Body:    "Hello{{with .RecipientName}} {{.}}{{end}}, total {{.Data.total}}{{.Data.missing}}.",
+	}
+
+	subject, body, err := Render(tpl, TemplateData{
+		RecipientName: "Acme",
+		Data:          map[string]interface{}{"invoiceNumber": "INV-1", "total": "100.00"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice INV-1", subject)
+	assert.Equal(t, "Hello Acme, total 100.00.", body)
+
+	_, _, err = Render(domain.NotificationTemplate{Body: "{{.Data.x"}, TemplateData{})
+	assert.Error(t, err)
+}
+
+func TestDefaultTemplatesRender(t *testing.T) {
+	for _, tpl := range defaultTemplates {
+		require.NoError(t, tpl.Validate(), tpl.EventType)
+		_, _, err := Render(tpl, TemplateData{Data: map[string]interface{}{}})
+		assert.NoError(t, err, tpl.EventType)
+	}
+	for _, locale := range i18n.Supported {
+		for _, rule := range DefaultRules {
+			for _, channel := range rule.Channels {
+				_, ok := pickTemplate(defaultTemplates, rule.EventType, channel, []string{locale})
+				assert.True(t, ok, "%s via %s has no default %s template", rule.EventType, channel, locale)
+			}
+		}
+	}
+}
+
+func TestRender_FormatsInLocale(t *testing.T) {
+	tpl := domain.NotificationTemplate{
+		Subject: "{{date .Data.sentDate}}",
+		Body:    "{{money .Data.total .Data.currency}} / {{number .Data.amount 2}} / {{money .Data.missing .Data.currency}}",
+	}
+	data := map[string]interface{}{
+		"sentDate": "2026-03-01T10:00:00Z",
+		"total":    "1234.5",
+		"currency": "EUR",
+		"amount":   float64(99),
+	}
+
+	subject, body, err := Render(tpl, TemplateData{Locale: "de", Data: data})
+	require.NoError(t, err)
+	assert.Equal(t, "01.03.2026", subject)
+	assert.Equal(t, "1.234,50\u00a0€ / 99,00 / ", body)
+
+	subject, body, err = Render(tpl, TemplateData{Data: data})
+	require.NoError(t, err)
+	assert.Equal(t, "03/01/2026", subject)
+	assert.Equal(t, "€1,234.50 / 99.00 / ", body)
+}
@@ -0,0 +1,127 @@
+package numbering
+
+import (
+	"sort"
+	"time"
+)
+
+// Issued is a number a document was issued under. Voided is set when the
+// document was voided afterwards; its number stays used.
+type Issued struct {
+	Key        Key       `json:"-"`
+	Sequence   int64     `json:"sequence"`
+	Number     string    `json:"number"`
+	DocumentID string    `json:"documentId"`
+	Kind       string    `json:"kind,omitempty"`
+	IssuedAt   time.Time `json:"issuedAt"`
+	Voided     *Void     `json:"voided,omitempty"`
+}
+
+// Void records who voided a document, when and why.
+type Void struct {
+	UserID string    `json:"userId,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Gap is a run of numbers, From to To inclusive, that no document was
+// issued under.
+type Gap struct {
+	From       int64  `json:"from"`
+	To         int64  `json:"to"`
+	Count      int64  `json:"count"`
+	FromNumber string `json:"fromNumber"`
+	ToNumber   string `json:"toNumber"`
+}
+
+// SequenceAudit is what the audit found in one sequence. Drawn is how far
+// the sequence's counter has gone, which may be past the last number
+// issued; 0 when unknown. Duplicates are the documents issued under a
+// number another document already has.
+type SequenceAudit struct {
+	DocumentType string   `json:"documentType"`
+	Channel      string   `json:"channel,omitempty"`
+	Year         int      `json:"year,omitempty"`
+	Issued       int      `json:"issued"`
+	First        int64    `json:"first"`
+	Last         int64    `json:"last"`
+	Drawn        int64    `json:"drawn,omitempty"`
+	Gaps         []Gap    `json:"gaps"`
+	Missing      int64    `json:"missing"`
+	Voided       []Issued `json:"voided"`
+	Duplicates   []Issued `json:"duplicates"`
+}
+
+// Audit checks the numbers issued in each sequence for gaps, from 1 up to
+// the last number issued or drawn, and lists the voided and duplicated
+// ones. drawn, which may be nil, gives how far each sequence's counter has
+// gone; format writes a sequence number as the document would carry it.
+// Sequences are returned by document type, channel and year.
+func Audit(issued []Issued, drawn map[Key]int64, format func(Key, int64) string) []SequenceAudit {
+	byKey := make(map[Key][]Issued)
+	for _, number := range issued {
+		byKey[number.Key] = append(byKey[number.Key], number)
+	}
+	for key := range drawn {
+		if _, ok := byKey[key]; !ok && drawn[key] > 0 {
+			byKey[key] = nil
+		}
+	}
+
+	audits := make([]SequenceAudit, 0, len(byKey))
+	for key, numbers := range byKey {
+		sort.SliceStable(numbers, func(a, b int) bool { return numbers[a].Sequence < numbers[b].Sequence })
+		audit := SequenceAudit{
+			DocumentType: key.DocumentType,
+			Channel:      key.Channel,
+			Year:         key.Year,
+			Issued:       len(numbers),
+			Drawn:        drawn[key],
+			Gaps:         []Gap{},
+			Voided:       []Issued{},
+			Duplicates:   []Issued{},
+		}
+		gap := func(from, to int64) {
+			if from > to {
+				return
+			}
+			audit.Gaps = append(audit.Gaps, Gap{
+				From:       from,
+				To:         to,
+				Count:      to - from + 1,
+				FromNumber: format(key, from),
+				ToNumber:   format(key, to),
+			})
+			audit.Missing += to - from + 1
+		}
+
+		var last int64
+		for i, number := range numbers {
+			if i > 0 && number.Sequence == last {
+				audit.Duplicates = append(audit.Duplicates, number)
+			} else {
+				gap(last+1, number.Sequence-1)
+			}
+			if number.Voided != nil {
+				audit.Voided = append(audit.Voided, number)
+			}
+			last = number.Sequence
+		}
+		if len(numbers) > 0 {
+			audit.First, audit.Last = numbers[0].Sequence, last
+		}
+		gap(last+1, audit.Drawn)
+		audits = append(audits, audit)
+	}
+
+	sort.Slice(audits, func(a, b int) bool {
+		if audits[a].DocumentType != audits[b].DocumentType {
+			return audits[a].DocumentType < audits[b].DocumentType
+		}
+		if audits[a].Channel != audits[b].Channel {
+			return audits[a].Channel < audits[b].Channel
+		}
+		return audits[a].Year < audits[b].Year
+	})
+	return audits
+}
@@ -0,0 +1,60 @@
+package numbering
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	tenantID := uuid.New()
+	invoices2026 := Key{TenantID: tenantID, DocumentType: "invoice", Year: 2026}
+	invoices2025 := Key{TenantID: tenantID, DocumentType: "invoice", Year: 2025}
+	invoices2027 := Key{TenantID: tenantID, DocumentType: "invoice", Year: 2027}
+	format := func(key Key, sequence int64) string {
+		return fmt.Sprintf("INV-%d-%06d", key.Year, sequence)
+	}
+	issue := func(key Key, sequence int64) Issued {
+		return Issued{Key: key, Sequence: sequence, Number: format(key, sequence), DocumentID: uuid.NewString()}
+	}
+
+	voided := issue(invoices2026, 3)
+	voided.Voided = &Void{UserID: "user-1", Reason: "Wrong client", At: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	duplicate := issue(invoices2026, 5)
+	issued := []Issued{
+		issue(invoices2026, 5), issue(invoices2026, 1), voided, issue(invoices2026, 2), duplicate, issue(invoices2026, 9),
+		issue(invoices2025, 1), issue(invoices2025, 2),
+	}
+	drawn := map[Key]int64{invoices2026: 11, invoices2027: 2}
+
+	audits := Audit(issued, drawn, format)
+	require.Len(t, audits, 3)
+	assert.Equal(t, 2025, audits[0].Year, "sequences are in order of year")
+	assert.Empty(t, audits[0].Gaps, "an unknown counter adds no trailing gap")
+	assert.Zero(t, audits[0].Missing)
+
+	audit := audits[1]
+	assert.Equal(t, 2026, audit.Year)
+	assert.Equal(t, 6, audit.Issued)
+	assert.Equal(t, int64(1), audit.First)
+	assert.Equal(t, int64(9), audit.Last)
+	assert.Equal(t, []Gap{
+		{From: 4, To: 4, Count: 1, FromNumber: "INV-2026-000004", ToNumber: "INV-2026-000004"},
+		{From: 6, To: 8, Count: 3, FromNumber: "INV-2026-000006", ToNumber: "INV-2026-000008"},
+		{From: 10, To: 11, Count: 2, FromNumber: "INV-2026-000010", ToNumber: "INV-2026-000011"},
+	}, audit.Gaps, "numbers drawn after the last one issued are missing too")
+	assert.Equal(t, int64(6), audit.Missing)
+	require.Len(t, audit.Voided, 1)
+	assert.Equal(t, "Wrong client", audit.Voided[0].Voided.Reason)
+	require.Len(t, audit.Duplicates, 1)
+	assert.Equal(t, "INV-2026-000005", audit.Duplicates[0].Number)
+
+	assert.Equal(t, 2027, audits[2].Year)
+	assert.Zero(t, audits[2].Issued)
+	assert.Equal(t, []Gap{{From: 1, To: 2, Count: 2, FromNumber: "INV-2027-000001", ToNumber: "INV-2027-000002"}}, audits[2].Gaps,
+		"a sequence drawn from without any document issued is all gap")
+}
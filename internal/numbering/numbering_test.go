@@ -0,0 +1,80 @@
+package numbering
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryCounter struct {
+	mu        sync.Mutex
+	sequences map[Key]int64
+}
+
+func (c *memoryCounter) Next(ctx context.Context, key Key) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sequences == nil {
+		c.sequences = make(map[Key]int64)
+	}
+	c.sequences[key]++
+	return c.sequences[key], nil
+}
+
+func TestFormat(t *testing.T) {
+	tenantID := uuid.New()
+	scheme := config.NumberingScheme{Prefix: "SO", Padding: 6, ChannelCodes: map[string]string{"marketplace": "MP"}}
+
+	assert.Equal(t, "SO-2026-000042", Format(scheme, Key{TenantID: tenantID, Year: 2026}, 42))
+	assert.Equal(t, "SO-MP-2026-000001", Format(scheme, Key{TenantID: tenantID, Channel: "marketplace", Year: 2026}, 1))
+	assert.Equal(t, "SO-WEB-000007", Format(scheme, Key{TenantID: tenantID, Channel: "web"}, 7))
+	assert.Equal(t, "1234567", Format(config.NumberingScheme{Padding: 3}, Key{}, 1234567))
+}
+
+func TestGenerator_Next(t *testing.T) {
+	tenantID := uuid.New()
+	other := uuid.New()
+	schemes := config.NumberingConfig{
+		Schemes: map[string]config.NumberingScheme{
+			DocumentOrder:    {Prefix: "SO", Padding: 4, YearlyReset: true},
+			DocumentShipment: {Prefix: "SH", Padding: 4},
+		},
+		Tenants: map[string]map[string]config.NumberingScheme{
+			tenantID.String(): {DocumentOrder: {Prefix: "ACME", Padding: 3, YearlyReset: true, PerChannel: true}},
+		},
+	}
+	locales := config.I18nConfig{
+		TimeZone:        "UTC",
+		TenantTimeZones: map[string]string{tenantID.String(): "Pacific/Auckland"},
+	}
+	g := NewGenerator(schemes, locales, &memoryCounter{})
+	// Already 2027 in Auckland.
+	g.now = func() time.Time { return time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+
+	next := func(tenant uuid.UUID, documentType, channel string) string {
+		number, err := g.Next(ctx, tenant, documentType, channel)
+		require.NoError(t, err)
+		return number
+	}
+
+	assert.Equal(t, "ACME-WEB-2027-001", next(tenantID, DocumentOrder, "web"))
+	assert.Equal(t, "ACME-WEB-2027-002", next(tenantID, DocumentOrder, " Web "))
+	assert.Equal(t, "ACME-POS-2027-001", next(tenantID, DocumentOrder, "pos"), "each channel has its own sequence")
+	assert.Equal(t, "SO-2026-0001", next(other, DocumentOrder, "web"), "channels share one sequence by default")
+	assert.Equal(t, "SO-2026-0002", next(other, DocumentOrder, "pos"))
+	assert.Equal(t, "SH-0001", next(tenantID, DocumentShipment, ""), "document types have their own sequences")
+
+	g.now = func() time.Time { return time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC) }
+	assert.Equal(t, "SO-2027-0001", next(other, DocumentOrder, ""), "the sequence restarts each year")
+	assert.Equal(t, "SH-0002", next(tenantID, DocumentShipment, ""))
+
+	_, err := g.Next(ctx, tenantID, "invoice", "")
+	assert.Error(t, err)
+}
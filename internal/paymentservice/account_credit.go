@@ -0,0 +1,193 @@
+package paymentservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+const accountCreditPath = "/api/v1/payments/account-credit/"
+
+// handleAccountCredit returns the account credit of client {clientId}, what
+// of their completed payments is applied to no invoice and not refunded,
+// and applies it to an invoice at {clientId}/apply or refunds it at
+// {clientId}/refund.
+func (s *PaymentService) handleAccountCredit(w http.ResponseWriter, r *http.Request) {
+	clientID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, accountCreditPath), "/")
+
+	method := http.MethodPost
+	switch action {
+	case "":
+		method = http.MethodGet
+	case "apply", "refund":
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != method {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	switch action {
+	case "":
+		s.getAccountCredit(w, r, clientID)
+	case "apply":
+		s.applyAccountCredit(w, r, clientID)
+	case "refund":
+		s.refundAccountCredit(w, r, clientID)
+	}
+}
+
+func (s *PaymentService) getAccountCredit(w http.ResponseWriter, r *http.Request, id string) {
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	payments, err := s.paymentHandler.AccountCredit(r.Context(), tenantID, clientID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, accountCreditBody(clientID, payments))
+}
+
+func (s *PaymentService) applyAccountCredit(w http.ResponseWriter, r *http.Request, clientID string) {
+	var req struct {
+		InvoiceID   string      `json:"invoiceId"`
+		Amount      json.Number `json:"amount"`
+		AmountMinor json.Number `json:"amountMinor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.InvoiceID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invoiceId is required")
+		return
+	}
+
+	data := map[string]interface{}{"invoiceId": req.InvoiceID}
+	setAmount(data, req.Amount, req.AmountMinor)
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("applyAccountCredit", middleware.GetTenantID(ctx), clientID, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	payments, invoice, err := s.paymentHandler.HandleApplyAccountCredit(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeCreditChange(w, r, clientID, payments, invoice)
+}
+
+func (s *PaymentService) refundAccountCredit(w http.ResponseWriter, r *http.Request, clientID string) {
+	var req struct {
+		Currency    string      `json:"currency"`
+		Amount      json.Number `json:"amount"`
+		AmountMinor json.Number `json:"amountMinor"`
+		Reason      string      `json:"reason"`
+		Reference   string      `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Currency == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "currency is required")
+		return
+	}
+
+	data := map[string]interface{}{
+		"currency":  strings.ToUpper(req.Currency),
+		"reason":    req.Reason,
+		"reference": req.Reference,
+	}
+	setAmount(data, req.Amount, req.AmountMinor)
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("refundAccountCredit", middleware.GetTenantID(ctx), clientID, middleware.GetUserID(ctx), data)
+	payments, err := s.paymentHandler.HandleRefundAccountCredit(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeCreditChange(w, r, clientID, payments, nil)
+}
+
+// writeCreditChange writes the client's account credit left after a change,
+// the payments it was drawn from and, when applied, the invoice it paid.
+func (s *PaymentService) writeCreditChange(w http.ResponseWriter, r *http.Request, id string, drawn []*domain.Payment, invoice *domain.Invoice) {
+	clientID, _ := uuid.Parse(id)
+	tenantID, _ := uuid.Parse(middleware.GetTenantID(r.Context()))
+	payments, err := s.paymentHandler.AccountCredit(r.Context(), tenantID, clientID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	body := accountCreditBody(clientID, payments)
+	drawnFrom := make([]string, len(drawn))
+	for i, payment := range drawn {
+		drawnFrom[i] = payment.ID.String()
+	}
+	body["drawnFrom"] = drawnFrom
+	if invoice != nil {
+		body["invoice"] = map[string]interface{}{
+			"id":            invoice.ID.String(),
+			"invoiceNumber": invoice.InvoiceNumber,
+			"status":        string(invoice.Status),
+			"amountPaid":    invoice.AmountPaid.String(),
+			"amountDue":     invoice.AmountDue.String(),
+		}
+	}
+	s.writeJSON(w, http.StatusOK, body)
+}
+
+// accountCreditBody is a client's account credit balance per currency and
+// the payments holding it.
+func accountCreditBody(clientID uuid.UUID, payments []*domain.Payment) map[string]interface{} {
+	seen := make(map[string]bool)
+	var currencies []string
+	sources := make([]map[string]interface{}, len(payments))
+	for i, payment := range payments {
+		sources[i] = map[string]interface{}{
+			"paymentId":     payment.ID.String(),
+			"invoiceId":     payment.InvoiceID.String(),
+			"reference":     payment.Reference,
+			"amount":        payment.Amount.String(),
+			"currency":      payment.Currency,
+			"accountCredit": payment.AccountCredit().String(),
+			"processedAt":   payment.ProcessedAt,
+		}
+		if !seen[payment.Currency] {
+			seen[payment.Currency] = true
+			currencies = append(currencies, payment.Currency)
+		}
+	}
+	sort.Strings(currencies)
+	balances := make([]map[string]interface{}, len(currencies))
+	for i, currency := range currencies {
+		balances[i] = map[string]interface{}{
+			"currency": currency,
+			"amount":   domain.AccountCreditBalance(payments, currency).String(),
+		}
+	}
+	return map[string]interface{}{
+		"clientId": clientID.String(),
+		"balances": balances,
+		"payments": sources,
+	}
+}
@@ -0,0 +1,134 @@
+package paymentservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+const paymentsPath = "/api/v1/payments/"
+
+// handlePaymentByID returns a payment, or its applications to invoices at
+// {id}/applications, where POST applies it to another invoice and DELETE
+// {id}/applications/{applicationId} unapplies it.
+func (s *PaymentService) handlePaymentByID(w http.ResponseWriter, r *http.Request) {
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, paymentsPath), "/")
+	action, applicationID, _ := strings.Cut(rest, "/")
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.getPayment(w, r)
+	case action == "applications" && applicationID == "" && r.Method == http.MethodGet:
+		s.getPaymentApplications(w, r, id)
+	case action == "applications" && applicationID == "" && r.Method == http.MethodPost:
+		s.applyPayment(w, r, id)
+	case action == "applications" && applicationID != "" && r.Method == http.MethodDelete:
+		s.unapplyPayment(w, r, id, applicationID)
+	case action == "" || action == "applications":
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+	}
+}
+
+// getPaymentApplications returns the history of a payment's applications,
+// unapplied ones included, with the amount applied and left unapplied.
+func (s *PaymentService) getPaymentApplications(w http.ResponseWriter, r *http.Request, id string) {
+	paymentID, err := uuid.Parse(id)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid payment ID")
+		return
+	}
+	payment, err := s.paymentRepo.FindByID(r.Context(), paymentID)
+	if err != nil || payment == nil || payment.TenantID.String() != middleware.GetTenantID(r.Context()) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Payment not found")
+		return
+	}
+	s.writeApplications(w, http.StatusOK, payment, nil)
+}
+
+func (s *PaymentService) applyPayment(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		InvoiceID   string      `json:"invoiceId"`
+		Amount      json.Number `json:"amount"`
+		AmountMinor json.Number `json:"amountMinor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.InvoiceID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invoiceId is required")
+		return
+	}
+
+	data := map[string]interface{}{"invoiceId": req.InvoiceID}
+	setAmount(data, req.Amount, req.AmountMinor)
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("applyPayment", middleware.GetTenantID(ctx), id, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	payment, invoice, err := s.paymentHandler.HandleApplyPayment(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeApplications(w, http.StatusCreated, payment, invoice)
+}
+
+func (s *PaymentService) unapplyPayment(w http.ResponseWriter, r *http.Request, id, applicationID string) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("unapplyPayment", middleware.GetTenantID(ctx), id, middleware.GetUserID(ctx), map[string]interface{}{
+		"applicationId": applicationID,
+		"reason":        req.Reason,
+	})
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	payment, invoice, err := s.paymentHandler.HandleUnapplyPayment(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeApplications(w, http.StatusOK, payment, invoice)
+}
+
+// writeApplications writes a payment's applications with its version as
+// the ETag and, after a change, the invoice it changed.
+func (s *PaymentService) writeApplications(w http.ResponseWriter, status int, payment *domain.Payment, invoice *domain.Invoice) {
+	applications := payment.Applications
+	if applications == nil {
+		applications = []domain.PaymentApplication{}
+	}
+	body := map[string]interface{}{
+		"paymentId":     payment.ID.String(),
+		"amount":        payment.Amount.String(),
+		"currency":      payment.Currency,
+		"amountApplied": payment.AmountApplied.String(),
+		"unapplied":     payment.Unapplied().String(),
+		"applications":  applications,
+	}
+	if invoice != nil {
+		body["invoice"] = map[string]interface{}{
+			"id":            invoice.ID.String(),
+			"invoiceNumber": invoice.InvoiceNumber,
+			"status":        string(invoice.Status),
+			"amountPaid":    invoice.AmountPaid.String(),
+			"amountDue":     invoice.AmountDue.String(),
+		}
+	}
+	httpresponse.SetETag(w, payment.Version)
+	s.writeJSON(w, status, body)
+}
@@ -0,0 +1,258 @@
+package paymentservice
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+const (
+	bankStatementsPath   = "/api/v1/payments/bank-statements"
+	bankTransactionsPath = "/api/v1/payments/bank-transactions"
+
+	// maxBankStatementSize bounds an uploaded statement file.
+	maxBankStatementSize = 10 << 20
+)
+
+// handleBankStatements lists the tenant's imported statements, latest
+// first, or imports one.
+func (s *PaymentService) handleBankStatements(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listBankStatements(w, r)
+	case http.MethodPost:
+		s.importBankStatement(w, r)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) listBankStatements(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	limit := parseInt(r.URL.Query().Get("limit"), 50)
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	statements, err := s.bankStatements.ListStatements(r.Context(), tenantID, int64(limit))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"statements": statements})
+}
+
+// importBankStatement imports the statement file in the request body, in
+// the ?format= given or the one its Content-Type names: text/csv for CSV,
+// XML for camt.053. ?currency= and ?accountIban= stand in for what a CSV
+// export leaves out, and ?filename= is kept with the statement.
+func (s *PaymentService) importBankStatement(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := domain.BankStatementFormat(query.Get("format"))
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch {
+		case mediaType == "text/csv":
+			format = domain.BankStatementCSV
+		case strings.HasSuffix(mediaType, "/xml"):
+			format = domain.BankStatementCAMT053
+		default:
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "format must be csv or camt.053")
+			return
+		}
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBankStatementSize))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusRequestEntityTooLarge, "Statement is too large")
+		return
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("importBankStatement", middleware.GetTenantID(ctx), "", middleware.GetUserID(ctx), map[string]interface{}{
+		"format":      string(format),
+		"content":     string(content),
+		"filename":    query.Get("filename"),
+		"currency":    query.Get("currency"),
+		"accountIban": query.Get("accountIban"),
+	})
+	statement, transactions, err := s.bankHandler.HandleImportBankStatement(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"statement":    statement,
+		"transactions": transactions,
+	})
+}
+
+// handleBankStatementByID returns a statement with its transactions.
+func (s *PaymentService) handleBankStatementByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	statementID, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, bankStatementsPath+"/"))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid bank statement ID")
+		return
+	}
+	statement, err := s.bankStatements.FindStatement(r.Context(), statementID)
+	if err != nil || statement.TenantID.String() != middleware.GetTenantID(r.Context()) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Bank statement not found")
+		return
+	}
+
+	transactions, err := s.bankStatements.ListTransactions(r.Context(), statement.TenantID, &statement.ID, "", int64(statement.Transactions)+1)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"statement":    statement,
+		"transactions": transactions,
+	})
+}
+
+// handleBankTransactions lists the tenant's bank transactions in ?status=,
+// by default the review queue: credits with candidate invoices but none
+// matched with confidence.
+func (s *PaymentService) handleBankTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	status := domain.BankTransactionStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = domain.BankTransactionReview
+	case domain.BankTransactionReview, domain.BankTransactionUnmatched, domain.BankTransactionMatched, domain.BankTransactionIgnored:
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "status must be review, unmatched, matched or ignored")
+		return
+	}
+	limit := parseInt(r.URL.Query().Get("limit"), 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	transactions, err := s.bankStatements.ListTransactions(r.Context(), tenantID, nil, status, int64(limit))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"transactions": transactions})
+}
+
+// handleBankTransactionByID returns a transaction with its candidate
+// invoices, and resolves it at {id}/confirm and {id}/ignore.
+func (s *PaymentService) handleBankTransactionByID(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, bankTransactionsPath+"/"), "/")
+
+	method := http.MethodPost
+	if action == "" {
+		method = http.MethodGet
+	}
+	switch action {
+	case "", "confirm", "ignore":
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != method {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	switch action {
+	case "":
+		s.getBankTransaction(w, r, id)
+	case "confirm":
+		s.confirmBankMatch(w, r, id)
+	case "ignore":
+		s.ignoreBankTransaction(w, r, id)
+	}
+}
+
+func (s *PaymentService) getBankTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	transactionID, err := uuid.Parse(id)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid bank transaction ID")
+		return
+	}
+	transaction, err := s.bankStatements.FindTransaction(r.Context(), transactionID)
+	if err != nil || transaction.TenantID.String() != middleware.GetTenantID(r.Context()) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Bank transaction not found")
+		return
+	}
+	s.writeBankTransaction(w, http.StatusOK, transaction)
+}
+
+// confirmBankMatch records a credit as a payment of the invoice in
+// invoiceId, which may be left out when the credit has one candidate.
+func (s *PaymentService) confirmBankMatch(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		InvoiceID string `json:"invoiceId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("confirmBankMatch", middleware.GetTenantID(ctx), id, middleware.GetUserID(ctx), map[string]interface{}{
+		"invoiceId": req.InvoiceID,
+	})
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	transaction, err := s.bankHandler.HandleConfirmBankMatch(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeBankTransaction(w, http.StatusOK, transaction)
+}
+
+func (s *PaymentService) ignoreBankTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("ignoreBankTransaction", middleware.GetTenantID(ctx), id, middleware.GetUserID(ctx), map[string]interface{}{
+		"reason": req.Reason,
+	})
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	transaction, err := s.bankHandler.HandleIgnoreBankTransaction(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeBankTransaction(w, http.StatusOK, transaction)
+}
+
+func (s *PaymentService) writeBankTransaction(w http.ResponseWriter, status int, transaction *domain.BankTransaction) {
+	httpresponse.SetETag(w, transaction.Version)
+	s.writeJSON(w, status, map[string]interface{}{"transaction": transaction})
+}
@@ -0,0 +1,259 @@
+package paymentservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+const cashSessionsPath = "/api/v1/payments/cash-sessions"
+
+// handleCashSessions lists the tenant's cash sessions, newest first,
+// optionally of one ?registerId= and ?status=, or opens one.
+func (s *PaymentService) handleCashSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listCashSessions(w, r)
+	case http.MethodPost:
+		s.openCashSession(w, r)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleCashSessionByID returns a session, or its Z-report at
+// {id}/z-report, and records payments, paid-ins and paid-outs and closes
+// the session at {id}/payments, {id}/paid-in, {id}/paid-out and {id}/close.
+func (s *PaymentService) handleCashSessionByID(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, cashSessionsPath+"/"), "/")
+
+	method := http.MethodPost
+	if action == "" || action == "z-report" {
+		method = http.MethodGet
+	}
+	switch action {
+	case "", "z-report", "payments", "paid-in", "paid-out", "close":
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != method {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	switch action {
+	case "", "z-report":
+		s.getCashSession(w, r, id, action == "z-report")
+	case "payments":
+		s.recordCashPayment(w, r, id)
+	case "paid-in":
+		s.recordCashMovement(w, r, id, domain.CashEntryPaidIn)
+	case "paid-out":
+		s.recordCashMovement(w, r, id, domain.CashEntryPaidOut)
+	case "close":
+		s.closeCashSession(w, r, id)
+	}
+}
+
+func (s *PaymentService) listCashSessions(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := uuid.Parse(middleware.GetTenantID(r.Context()))
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+	status := domain.CashSessionStatus(r.URL.Query().Get("status"))
+	if status != "" && status != domain.CashSessionStatusOpen && status != domain.CashSessionStatusClosed {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "status must be open or closed")
+		return
+	}
+	limit := parseInt(r.URL.Query().Get("limit"), 50)
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	sessions, err := s.cashSessions.List(r.Context(), tenantID, r.URL.Query().Get("registerId"), status, int64(limit))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessions})
+}
+
+func (s *PaymentService) openCashSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RegisterID        string      `json:"registerId"`
+		Currency          string      `json:"currency"`
+		OpeningFloat      json.Number `json:"openingFloat"`
+		OpeningFloatMinor json.Number `json:"openingFloatMinor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.RegisterID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "registerId is required")
+		return
+	}
+
+	data := map[string]interface{}{
+		"registerId": req.RegisterID,
+		"currency":   req.Currency,
+	}
+	if req.OpeningFloat != "" {
+		data["openingFloat"] = req.OpeningFloat.String()
+	}
+	if req.OpeningFloatMinor != "" {
+		data["openingFloatMinor"] = req.OpeningFloatMinor.String()
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("openCashSession", middleware.GetTenantID(ctx), "", middleware.GetUserID(ctx), data)
+	session, err := s.cashHandler.HandleOpenCashSession(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeCashSession(w, http.StatusCreated, session)
+}
+
+func (s *PaymentService) getCashSession(w http.ResponseWriter, r *http.Request, id string, zReport bool) {
+	sessionID, err := uuid.Parse(id)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid cash session ID")
+		return
+	}
+	session, err := s.cashSessions.FindByID(r.Context(), sessionID)
+	if err != nil || session.TenantID.String() != middleware.GetTenantID(r.Context()) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Cash session not found")
+		return
+	}
+
+	if zReport {
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{"report": session.ZReport()})
+		return
+	}
+	s.writeCashSession(w, http.StatusOK, session)
+}
+
+// recordCashPayment records cash taken for the invoice in invoiceId or the
+// order in orderId.
+func (s *PaymentService) recordCashPayment(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		InvoiceID   string      `json:"invoiceId"`
+		OrderID     string      `json:"orderId"`
+		Amount      json.Number `json:"amount"`
+		AmountMinor json.Number `json:"amountMinor"`
+		Reference   string      `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if (req.InvoiceID == "") == (req.OrderID == "") {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "one of invoiceId or orderId is required")
+		return
+	}
+	if req.Amount == "" && req.AmountMinor == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "amount is required")
+		return
+	}
+
+	data := map[string]interface{}{
+		"invoiceId": req.InvoiceID,
+		"orderId":   req.OrderID,
+		"reference": req.Reference,
+	}
+	setAmount(data, req.Amount, req.AmountMinor)
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("recordCashPayment", middleware.GetTenantID(ctx), id, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	session, err := s.cashHandler.HandleRecordCashPayment(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeCashSession(w, http.StatusCreated, session)
+}
+
+func (s *PaymentService) recordCashMovement(w http.ResponseWriter, r *http.Request, id string, entryType domain.CashEntryType) {
+	var req struct {
+		Amount      json.Number `json:"amount"`
+		AmountMinor json.Number `json:"amountMinor"`
+		Reason      string      `json:"reason"`
+		Reference   string      `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Amount == "" && req.AmountMinor == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "amount is required")
+		return
+	}
+
+	data := map[string]interface{}{
+		"type":      string(entryType),
+		"reason":    req.Reason,
+		"reference": req.Reference,
+	}
+	setAmount(data, req.Amount, req.AmountMinor)
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("recordCashMovement", middleware.GetTenantID(ctx), id, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	session, err := s.cashHandler.HandleRecordCashMovement(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeCashSession(w, http.StatusCreated, session)
+}
+
+// closeCashSession closes a session with the cash counted in the drawer and
+// returns its Z-report.
+func (s *PaymentService) closeCashSession(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		Counted      json.Number `json:"counted"`
+		CountedMinor json.Number `json:"countedMinor"`
+		Notes        string      `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	data := map[string]interface{}{"notes": req.Notes}
+	if req.Counted != "" {
+		data["counted"] = req.Counted.String()
+	}
+	if req.CountedMinor != "" {
+		data["countedMinor"] = req.CountedMinor.String()
+	}
+
+	ctx := r.Context()
+	cmd := commands.NewCommand("closeCashSession", middleware.GetTenantID(ctx), id, middleware.GetUserID(ctx), data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+	session, err := s.cashHandler.HandleCloseCashSession(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	httpresponse.SetETag(w, session.Version)
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"session": session,
+		"report":  session.ZReport(),
+	})
+}
+
+func (s *PaymentService) writeCashSession(w http.ResponseWriter, status int, session *domain.CashSession) {
+	httpresponse.SetETag(w, session.Version)
+	s.writeJSON(w, status, map[string]interface{}{"session": session})
+}
@@ -0,0 +1,36 @@
+package paymentservice
+
+import "github.com/ims-erp/system/internal/export"
+
+// paymentExport exports the payment read model for
+// POST /api/v1/payments/exports.
+var paymentExport = export.Source{
+	Name:       "payments",
+	Collection: "payment_read_models",
+	Columns: []export.Column{
+		{Header: "Payment ID", Field: "_id"},
+		{Header: "Created", Field: "createdAt"},
+		{Header: "Status", Field: "status"},
+		{Header: "Amount", Field: "amount", Number: true},
+		{Header: "Currency", Field: "currency"},
+		{Header: "Method", Field: "method"},
+		{Header: "Provider", Field: "provider"},
+		{Header: "Reference", Field: "reference"},
+		{Header: "Invoice Number", Field: "invoiceNumber"},
+		{Header: "Invoice ID", Field: "invoiceId"},
+		{Header: "Client", Field: "clientName"},
+		{Header: "Client ID", Field: "clientId"},
+		{Header: "Description", Field: "description"},
+		{Header: "Updated", Field: "updatedAt"},
+	},
+	Filters: map[string]string{
+		"clientId":  "clientId",
+		"invoiceId": "invoiceId",
+		"status":    "status",
+		"method":    "method",
+		"currency":  "currency",
+	},
+	DateField: "createdAt",
+	Sort:      "createdAt",
+	Owned:     true,
+}
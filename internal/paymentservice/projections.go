@@ -0,0 +1,119 @@
+package paymentservice
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const projectionConsumer = "payment-read-projections"
+
+// projectionFeed is one event stream the payment read model consumes.
+type projectionFeed struct {
+	stream        string
+	streamSubject string
+	filter        string
+	consumer      string
+}
+
+// projectionFeeds are the payment events themselves, and client updates and
+// owner assignments, which carry the client name and ownership denormalized
+// into payments.
+var projectionFeeds = []projectionFeed{
+	{stream: "PAYMENT_EVENTS", streamSubject: "evt.payment.>", filter: "evt.payment.>", consumer: projectionConsumer},
+	{stream: "CLIENT_EVENTS", streamSubject: "evt.Client.>", filter: "evt.Client.ClientUpdated", consumer: "payment-read-client-names"},
+	{stream: "CLIENT_EVENTS", streamSubject: "evt.Client.>", filter: "evt.Client.ClientOwnerAssigned", consumer: "payment-read-client-owners"},
+}
+
+// consumeProjections feeds registry from every projection feed. JetStream
+// consumers retry failed events and dead-letter them; without JetStream, and
+// on Kafka, the projections run in a consumer group and failures are logged.
+// It returns the dead letter queue when JetStream is in use.
+func consumeProjections(group *lifecycle.Group, cfg *config.Config, subscriber messaging.EventSubscriber, registry *events.EventHandlerRegistry, log *logger.Logger) (*messaging.DeadLetterQueue, error) {
+	natsSubscriber, onNATS := subscriber.(*messaging.Subscriber)
+	if !onNATS || !cfg.NATS.JetStream.Enabled {
+		for _, feed := range projectionFeeds {
+			if err := subscriber.SubscribeGroup(group.Context(), feed.filter, feed.consumer, createEventHandler(registry)); err != nil {
+				return nil, fmt.Errorf("subscribe %s: %w", feed.filter, err)
+			}
+		}
+		return nil, nil
+	}
+
+	deadLetter := cfg.NATS.DeadLetter
+	prefix := cfg.NATS.JetStream.StreamPrefix
+	for _, feed := range projectionFeeds {
+		if err := natsSubscriber.EnsureStream(group.Context(), messaging.StreamConfig{
+			Name:     feed.stream,
+			Subjects: []string{prefix + feed.streamSubject},
+			MaxAge:   7 * 24 * time.Hour,
+			Storage:  jetstream.FileStorage,
+		}); err != nil {
+			return nil, fmt.Errorf("ensure stream %s: %w", feed.stream, err)
+		}
+
+		cc, err := natsSubscriber.Consume(group.Context(), messaging.ConsumerSpec{
+			Stream:        feed.stream,
+			Consumer:      feed.consumer,
+			FilterSubject: prefix + feed.filter,
+			MaxDeliver:    deadLetter.MaxDeliver,
+			AckWait:       deadLetter.AckWait,
+			Backoff:       deadLetter.Backoff,
+		}, createJetStreamHandler(registry))
+		if err != nil {
+			return nil, fmt.Errorf("consume %s: %w", feed.stream, err)
+		}
+		group.OnShutdown("consumer "+feed.consumer, func(context.Context) error {
+			cc.Stop()
+			return nil
+		})
+	}
+
+	dlq := natsSubscriber.DeadLetterQueue()
+	group.Go("dead letter monitor", func(ctx context.Context) {
+		dlq.Monitor(ctx, deadLetter.CheckInterval, deadLetter.AlertThreshold)
+	})
+	group.Go("consumer monitor", func(ctx context.Context) {
+		natsSubscriber.MonitorConsumers(ctx, cfg.NATS.JetStream.StatsInterval)
+	})
+	return dlq, nil
+}
+
+func createEventHandler(registry *events.EventHandlerRegistry) messaging.DeliveryHandler {
+	return func(ctx context.Context, msg *messaging.Delivery) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+
+		if errs := registry.Handle(ctx, &event); len(errs) > 0 {
+			return fmt.Errorf("failed to handle %s: %w", event.Type, stderrors.Join(errs...))
+		}
+		return nil
+	}
+}
+
+// createJetStreamHandler surfaces handler failures so the consumer can retry
+// and eventually dead-letter the message. Undecodable payloads are poison.
+func createJetStreamHandler(registry *events.EventHandlerRegistry) messaging.MessageHandler {
+	return func(ctx context.Context, msg jetstream.Msg) error {
+		var event events.EventEnvelope
+		if err := json.Unmarshal(msg.Data(), &event); err != nil {
+			return fmt.Errorf("%w: %v", messaging.ErrPoison, err)
+		}
+
+		if errs := registry.Handle(ctx, &event); len(errs) > 0 {
+			return stderrors.Join(errs...)
+		}
+		return nil
+	}
+}
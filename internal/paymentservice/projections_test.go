@@ -0,0 +1,81 @@
+package paymentservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subjectMatches reports whether subject falls under the NATS filter.
+func subjectMatches(filter, subject string) bool {
+	filterTokens, subjectTokens := strings.Split(filter, "."), strings.Split(subject, ".")
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(filterTokens) == len(subjectTokens)
+}
+
+func TestProjectionFeeds_DeliverEveryProjectedEvent(t *testing.T) {
+	registry := events.PaymentProjections(nil, nil, nil, nil, nil)
+	for _, eventType := range registry.EventTypes() {
+		schema, ok := events.LookupSchema(eventType)
+		require.True(t, ok, eventType)
+
+		var fed bool
+		for _, feed := range projectionFeeds {
+			if subjectMatches(feed.filter, schema.Subject()) {
+				assert.True(t, subjectMatches(feed.streamSubject, schema.Subject()), "%s is filtered from a stream it is not in", eventType)
+				fed = true
+			}
+		}
+		assert.True(t, fed, "no feed delivers %s to the payment read model", eventType)
+	}
+}
+
+// projectionMsg is a JetStream message carrying data.
+type projectionMsg struct {
+	jetstream.Msg
+	data []byte
+}
+
+func (m projectionMsg) Data() []byte { return m.data }
+
+func TestProjectionHandlers(t *testing.T) {
+	failure := errors.New("read model unavailable")
+	registry := events.NewEventHandlerRegistry()
+	registry.Register("payment.processed", func(ctx context.Context, event *events.EventEnvelope) error {
+		if event.AggregateID == "broken" {
+			return failure
+		}
+		return nil
+	})
+	encode := func(aggregateID string) []byte {
+		data, err := json.Marshal(&events.EventEnvelope{ID: aggregateID + "-event", Type: "payment.processed", AggregateID: aggregateID})
+		require.NoError(t, err)
+		return data
+	}
+
+	jetStream := createJetStreamHandler(registry)
+	assert.NoError(t, jetStream(context.Background(), projectionMsg{data: encode("pay-1")}))
+	assert.ErrorIs(t, jetStream(context.Background(), projectionMsg{data: encode("broken")}), failure, "failures are retried")
+	assert.ErrorIs(t, jetStream(context.Background(), projectionMsg{data: []byte("{")}), messaging.ErrPoison, "undecodable events are dead-lettered")
+
+	group := createEventHandler(registry)
+	assert.NoError(t, group(context.Background(), &messaging.Delivery{Data: encode("pay-2")}))
+	err := group(context.Background(), &messaging.Delivery{Data: encode("broken")})
+	assert.ErrorIs(t, err, failure)
+	assert.Contains(t, err.Error(), "payment.processed")
+}
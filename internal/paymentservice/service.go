@@ -0,0 +1,991 @@
+// Package paymentservice is payment-service: it processes payments through
+// the configured providers, applies them to invoices, reconciles bank
+// statements and cash sessions, and serves the payment read model.
+// cmd/payment-service runs it; the e2e tests start it in-process.
+package paymentservice
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/auth"
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/export"
+	"github.com/ims-erp/system/internal/fx"
+	"github.com/ims-erp/system/internal/health"
+	"github.com/ims-erp/system/internal/lifecycle"
+	"github.com/ims-erp/system/internal/messaging"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/migrations"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/carddata"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/fieldset"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/ims-erp/system/pkg/timezone"
+)
+
+type PaymentService struct {
+	config         *config.Config
+	logger         *logger.Logger
+	paymentHandler *commands.PaymentCommandHandler
+	queryHandler   *queries.PaymentQueryHandler
+	webhookHandler *commands.WebhookHandler
+	paymentRepo    commands.PaymentRepository
+	invoiceRepo    commands.InvoiceRepository
+	publisher      commands.Publisher
+	processors     *domain.ProcessorRegistry
+	cashHandler    *commands.CashSessionCommandHandler
+	cashSessions   *repository.CashSessionStore
+	bankHandler    *commands.BankReconciliationCommandHandler
+	bankStatements *repository.BankStatementStore
+	health         *health.HealthChecker
+	readiness      *health.ReadinessChecker
+	throttle       *middleware.Throttle
+}
+
+func NewPaymentService(
+	cfg *config.Config,
+	log *logger.Logger,
+	paymentHandler *commands.PaymentCommandHandler,
+	queryHandler *queries.PaymentQueryHandler,
+	webhookHandler *commands.WebhookHandler,
+	paymentRepo commands.PaymentRepository,
+	invoiceRepo commands.InvoiceRepository,
+	publisher commands.Publisher,
+	processors *domain.ProcessorRegistry,
+) *PaymentService {
+	return &PaymentService{
+		config:         cfg,
+		logger:         log,
+		paymentHandler: paymentHandler,
+		queryHandler:   queryHandler,
+		webhookHandler: webhookHandler,
+		paymentRepo:    paymentRepo,
+		invoiceRepo:    invoiceRepo,
+		publisher:      publisher,
+		processors:     processors,
+	}
+}
+
+func (s *PaymentService) setupRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.Handle("/health", s.health.Handler())
+	mux.Handle("/ready", s.readiness.Handler())
+	mux.HandleFunc("/live", s.livenessHandler)
+	mux.Handle("/metrics", metrics.Handler())
+
+	// Card data is rejected everywhere but on the webhook, whose signed
+	// provider payloads carry card details such as the last four digits.
+	guard := func(handler http.HandlerFunc) http.Handler {
+		return middleware.RejectCardData(s.reportCardData, handler)
+	}
+	mux.Handle("/api/v1/payments", guard(s.handlePayments))
+	mux.Handle("/api/v1/payments/", guard(s.handlePaymentByID))
+	mux.Handle("/api/v1/payments/process", guard(s.handleProcessPayment))
+	mux.Handle("/api/v1/payments/intents", guard(s.handlePaymentIntents))
+	mux.Handle("/api/v1/payments/refund", guard(s.handleRefund))
+	mux.HandleFunc("/api/v1/payments/webhook", s.handleWebhook)
+	mux.Handle("/api/v1/payments/methods", guard(s.handlePaymentMethods))
+	mux.Handle("/api/v1/payments/transactions", guard(s.handleTransactions))
+	mux.Handle(accountCreditPath, guard(s.handleAccountCredit))
+	mux.Handle(cashSessionsPath, guard(s.handleCashSessions))
+	mux.Handle(cashSessionsPath+"/", guard(s.handleCashSessionByID))
+	// Statement files are CSV or XML rather than JSON, and carry account
+	// numbers the card data check would take for card numbers.
+	mux.HandleFunc(bankStatementsPath, s.handleBankStatements)
+	mux.Handle(bankStatementsPath+"/", guard(s.handleBankStatementByID))
+	mux.Handle(bankTransactionsPath, guard(s.handleBankTransactions))
+	mux.Handle(bankTransactionsPath+"/", guard(s.handleBankTransactionByID))
+	mux.Handle("/api/v1/payments/report/daily", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleDailyReport)))
+	mux.Handle("/api/v1/payments/report/summary", s.throttle.Limit(middleware.ThrottleReport, http.HandlerFunc(s.handleSummaryReport)))
+
+	return mux
+}
+
+// reportCardData records a request rejected for carrying card data as a
+// payment.card_data_rejected event, so that the audit service keeps it. The
+// event names the fields, never their values.
+func (s *PaymentService) reportCardData(r *http.Request, findings []carddata.Finding) {
+	ctx := r.Context()
+	tenantID := middleware.GetTenantID(ctx)
+	userID := middleware.GetUserID(ctx)
+	requestID := httpresponse.RequestID(r)
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+
+	fields := make([]interface{}, len(findings))
+	for i, finding := range findings {
+		fields[i] = map[string]interface{}{"field": finding.Field, "reason": finding.Reason}
+	}
+	s.logger.New(ctx).Warn("Rejected request carrying card data",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"tenant_id", tenantID,
+		"user_id", userID,
+		"fields", len(findings),
+	)
+
+	event := events.NewEvent(requestID, "payment", "payment.card_data_rejected", tenantID, userID, map[string]interface{}{
+		"method":     r.Method,
+		"path":       r.URL.Path,
+		"remoteAddr": r.RemoteAddr,
+		"userAgent":  r.UserAgent(),
+		"fields":     fields,
+	})
+	event.WithCorrelationID(requestID)
+	if err := s.publisher.PublishEvent(ctx, event); err != nil {
+		s.logger.New(ctx).Error("Failed to publish card data rejection", "error", err)
+	}
+}
+
+func (s *PaymentService) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status": "alive", "timestamp": "%s"}`, time.Now().UTC())
+}
+
+func (s *PaymentService) handlePayments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listPayments(w, r)
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) handleProcessPayment(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		s.processPayment(w, r)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) handlePaymentIntents(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		s.createPaymentIntent(w, r)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) handleRefund(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		s.processRefund(w, r)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		s.processWebhook(w, r)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) handlePaymentMethods(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.getPaymentMethods(w, r)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.getTransactions(w, r)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) handleDailyReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.getDailyReport(w, r)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) handleSummaryReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.getSummaryReport(w, r)
+	} else {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *PaymentService) listPayments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	clientID := r.URL.Query().Get("clientId")
+	status := r.URL.Query().Get("status")
+	method := r.URL.Query().Get("method")
+	page := parseInt(r.URL.Query().Get("page"), 1)
+	pageSize := parseInt(r.URL.Query().Get("pageSize"), 20)
+
+	startDate, _ := time.Parse(time.RFC3339, r.URL.Query().Get("startDate"))
+	endDate, _ := time.Parse(time.RFC3339, r.URL.Query().Get("endDate"))
+
+	fields, err := fieldset.Parse(r.URL.Query(), "payments", queries.PaymentFields)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	query := &queries.ListPaymentsQuery{
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		ClientID:   clientID,
+		Status:     status,
+		Method:     method,
+		Page:       page,
+		PageSize:   pageSize,
+		Cursor:     r.URL.Query().Get("cursor"),
+		StartDate:  startDate,
+		EndDate:    endDate,
+		SortBy:     r.URL.Query().Get("sortBy"),
+		SortOrder:  r.URL.Query().Get("sortOrder"),
+		Fields:     fields,
+	}
+
+	result, err := s.queryHandler.ListPayments(ctx, query)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, fields.TrimIn(result, "payments"))
+}
+
+func (s *PaymentService) getPayment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	paymentID := r.URL.Path[len(paymentsPath):]
+	if paymentID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "payment ID is required")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	fields, err := fieldset.Parse(r.URL.Query(), "payments", queries.PaymentFields)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	query := &queries.GetPaymentByIDQuery{
+		PaymentID:  paymentID,
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		Fields:     fields,
+	}
+
+	payment, err := s.queryHandler.GetPaymentByID(ctx, query)
+	if err != nil {
+		s.logger.New(ctx).Error("Failed to get payment", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get payment")
+		return
+	}
+
+	if payment == nil {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, "Payment not found")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"payment": fields.Trim(payment)})
+}
+
+func (s *PaymentService) processPayment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		InvoiceID   string            `json:"invoiceId"`
+		ClientID    string            `json:"clientId"`
+		Amount      json.Number       `json:"amount"`
+		AmountMinor json.Number       `json:"amountMinor"`
+		Currency    string            `json:"currency"`
+		Method      string            `json:"method"`
+		Provider    string            `json:"provider"`
+		Reference   string            `json:"reference"`
+		Description string            `json:"description"`
+		Metadata    map[string]string `json:"metadata"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.InvoiceID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invoiceId is required")
+		return
+	}
+	if req.ClientID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "clientId is required")
+		return
+	}
+	if req.Amount == "" && req.AmountMinor == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "amount must be greater than zero")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(ctx)
+	userID := middleware.GetUserID(ctx)
+
+	data := map[string]interface{}{
+		"invoiceId":   req.InvoiceID,
+		"clientId":    req.ClientID,
+		"currency":    req.Currency,
+		"method":      req.Method,
+		"provider":    req.Provider,
+		"reference":   req.Reference,
+		"description": req.Description,
+		"metadata":    req.Metadata,
+	}
+	setAmount(data, req.Amount, req.AmountMinor)
+
+	cmd := commands.NewCommand("createPayment", tenantID, "", userID, data)
+
+	payment, err := s.paymentHandler.HandleCreatePayment(ctx, cmd)
+	if err != nil {
+		s.logger.New(ctx).Error("Failed to create payment", "error", err)
+		s.writeError(w, r, err)
+		return
+	}
+
+	processCmd := commands.NewCommand("processPayment", tenantID, payment.ID.String(), userID, nil)
+
+	payment, err = s.paymentHandler.HandleProcessPayment(ctx, processCmd)
+	if err != nil {
+		s.logger.New(ctx).Error("Failed to process payment", "error", err)
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":     "Payment processed",
+		"paymentId":   payment.ID.String(),
+		"status":      string(payment.Status),
+		"amount":      payment.Amount.String(),
+		"currency":    payment.Currency,
+		"method":      string(payment.Method),
+		"provider":    payment.Provider,
+		"processedAt": payment.ProcessedAt,
+	})
+}
+
+// createPaymentIntent starts a card payment of an invoice's amount due that
+// the frontend confirms with the returned client secret. The provider's
+// webhook completes the payment.
+func (s *PaymentService) createPaymentIntent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		InvoiceID string            `json:"invoiceId"`
+		Provider  string            `json:"provider"`
+		Metadata  map[string]string `json:"metadata"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.InvoiceID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "invoiceId is required")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(ctx)
+	userID := middleware.GetUserID(ctx)
+
+	cmd := commands.NewCommand("createPaymentIntent", tenantID, "", userID, map[string]interface{}{
+		"invoiceId": req.InvoiceID,
+		"provider":  req.Provider,
+		"metadata":  req.Metadata,
+	})
+
+	payment, clientSecret, err := s.paymentHandler.HandleCreatePaymentIntent(ctx, cmd)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"paymentId":    payment.ID.String(),
+		"providerId":   payment.ProviderID,
+		"clientSecret": clientSecret,
+		"status":       string(payment.Status),
+		"amount":       payment.Amount.String(),
+		"currency":     payment.Currency,
+		"provider":     payment.Provider,
+	})
+}
+
+func (s *PaymentService) processRefund(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		PaymentID   string      `json:"paymentId"`
+		Amount      json.Number `json:"amount"`
+		AmountMinor json.Number `json:"amountMinor"`
+		Reason      string      `json:"reason"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.PaymentID == "" {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "paymentId is required")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(ctx)
+	userID := middleware.GetUserID(ctx)
+
+	data := map[string]interface{}{
+		"reason": req.Reason,
+	}
+	setAmount(data, req.Amount, req.AmountMinor)
+
+	cmd := commands.NewCommand("refundPayment", tenantID, req.PaymentID, userID, data)
+	cmd.WithExpectedVersion(commands.ParseIfMatch(r.Header.Get("If-Match")))
+
+	payment, err := s.paymentHandler.HandleRefundPayment(ctx, cmd)
+	if err != nil {
+		s.logger.New(ctx).Error("Failed to process refund", "error", err)
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":   "Refund processed",
+		"paymentId": payment.ID.String(),
+		"status":    string(payment.Status),
+		"refunded":  true,
+	})
+}
+
+// setAmount passes the amount of a request on to the command as strings, so
+// that it is parsed as a decimal and never as a float64. A partial amount
+// may be given as amount or, in minor units, as amountMinor.
+func setAmount(data map[string]interface{}, amount, amountMinor json.Number) {
+	if amount != "" {
+		data["amount"] = amount.String()
+	}
+	if amountMinor != "" {
+		data["amountMinor"] = amountMinor.String()
+	}
+}
+
+func (s *PaymentService) processWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	provider := r.URL.Query().Get("provider")
+	if provider == "" {
+		provider = "stripe"
+	}
+
+	var result *commands.WebhookResult
+	var err error
+
+	switch provider {
+	case "stripe":
+		payload, signature, parseErr := s.webhookHandler.ParseStripeWebhook(r)
+		if parseErr != nil {
+			s.logger.New(ctx).Error("Failed to parse Stripe webhook", "error", parseErr)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid webhook payload")
+			return
+		}
+
+		result, err = s.webhookHandler.HandleStripeWebhook(ctx, payload, signature)
+
+	case "paypal":
+		payload, headers, parseErr := s.webhookHandler.ParsePayPalWebhook(r)
+		if parseErr != nil {
+			s.logger.New(ctx).Error("Failed to parse PayPal webhook", "error", parseErr)
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid webhook payload")
+			return
+		}
+
+		result, err = s.webhookHandler.HandlePayPalWebhook(ctx, payload, headers)
+
+	default:
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid provider")
+		return
+	}
+
+	if err != nil {
+		s.logger.New(ctx).Error("Failed to process webhook", "provider", provider, "error", err)
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   result.Success,
+		"eventId":   result.EventID,
+		"eventType": result.EventType,
+		"paymentId": result.PaymentID,
+	})
+}
+
+func (s *PaymentService) getPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	methods := []map[string]interface{}{
+		{
+			"id":        "credit_card",
+			"name":      "Credit Card",
+			"providers": []string{"stripe", "adyen"},
+		},
+		{
+			"id":        "debit_card",
+			"name":      "Debit Card",
+			"providers": []string{"stripe"},
+		},
+		{
+			"id":        "bank_transfer",
+			"name":      "Bank Transfer",
+			"providers": []string{"ach", "sepa"},
+		},
+		{
+			"id":        "paypal",
+			"name":      "PayPal",
+			"providers": []string{"paypal"},
+		},
+		{
+			"id":        "cash",
+			"name":      "Cash",
+			"providers": []string{},
+		},
+		{
+			"id":        "check",
+			"name":      "Check",
+			"providers": []string{},
+		},
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{"methods": methods})
+}
+
+func (s *PaymentService) getTransactions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	startDate, _ := time.Parse(time.RFC3339, r.URL.Query().Get("startDate"))
+	endDate, _ := time.Parse(time.RFC3339, r.URL.Query().Get("endDate"))
+
+	query := &queries.GetPaymentStatsQuery{
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		StartDate:  startDate,
+		EndDate:    endDate,
+	}
+
+	stats, err := s.queryHandler.GetPaymentStats(ctx, query)
+	if err != nil {
+		s.logger.New(ctx).Error("Failed to get transactions", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get transactions")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"transactions": stats,
+	})
+}
+
+func (s *PaymentService) getDailyReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	loc, err := timezone.FromRequest(r, s.config.I18n.LocationFor(tenantID))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().In(loc).Format(timezone.DateLayout)
+	}
+
+	start, end, err := timezone.Day(date, loc)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid date format. Use YYYY-MM-DD")
+		return
+	}
+
+	query := &queries.GetPaymentStatsQuery{
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		StartDate:  start,
+		EndDate:    end,
+	}
+
+	stats, err := s.queryHandler.GetPaymentStats(ctx, query)
+	if err != nil {
+		s.logger.New(ctx).Error("Failed to get daily report", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get daily report")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"report":            "daily",
+		"date":              date,
+		"timeZone":          loc.String(),
+		"totalTransactions": stats.TotalPayments,
+		"totalVolume":       stats.TotalAmount,
+		"totalRefunds":      stats.TotalRefunded,
+		"pendingCount":      stats.PendingCount,
+		"completedCount":    stats.CompletedCount,
+		"failedCount":       stats.FailedCount,
+		"refundedCount":     stats.RefundedCount,
+		"revenue":           stats.Revenue,
+	})
+}
+
+func (s *PaymentService) getSummaryReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenantID := middleware.GetTenantID(ctx)
+
+	loc, err := timezone.FromRequest(r, s.config.I18n.LocationFor(tenantID))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	startDateStr := r.URL.Query().Get("startDate")
+	endDateStr := r.URL.Query().Get("endDate")
+
+	var startDate, endDate time.Time
+
+	if startDateStr != "" {
+		startDate, err = timezone.ParseBound(startDateStr, loc, false)
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid startDate format")
+			return
+		}
+	}
+
+	if endDateStr != "" {
+		endDate, err = timezone.ParseBound(endDateStr, loc, true)
+		if err != nil {
+			httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "Invalid endDate format")
+			return
+		}
+	}
+
+	query := &queries.GetPaymentStatsQuery{
+		TenantID:   tenantID,
+		Visibility: middleware.GetVisibility(ctx),
+		StartDate:  startDate,
+		EndDate:    endDate,
+	}
+
+	stats, err := s.queryHandler.GetPaymentStats(ctx, query)
+	if err != nil {
+		s.logger.New(ctx).Error("Failed to get summary report", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "Failed to get summary report")
+		return
+	}
+
+	successRate := 0.0
+	if stats.TotalPayments > 0 {
+		successRate = float64(stats.CompletedCount) / float64(stats.TotalPayments) * 100
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"report":            "summary",
+		"period":            map[string]interface{}{"start": startDateStr, "end": endDateStr, "timeZone": loc.String()},
+		"totalVolume":       stats.TotalAmount,
+		"totalTransactions": stats.TotalPayments,
+		"successRate":       successRate,
+		"pendingCount":      stats.PendingCount,
+		"completedCount":    stats.CompletedCount,
+		"failedCount":       stats.FailedCount,
+		"refundedCount":     stats.RefundedCount,
+		"cancelledCount":    stats.CancelledCount,
+		"revenue":           stats.Revenue,
+	})
+}
+
+func (s *PaymentService) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.New(context.Background()).Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+// writeError writes err in the shared error format. Errors without an
+// application code are logged here, since the client only sees a generic
+// message.
+func (s *PaymentService) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *errors.Error
+	if !stderrors.As(err, &appErr) || appErr.StatusCode() >= http.StatusInternalServerError {
+		s.logger.New(r.Context()).Errorw("Request failed", "path", r.URL.Path, "error", err)
+	}
+	httpresponse.Error(w, r, err)
+}
+
+// Start connects payment-service to MongoDB, Redis, messaging and MinIO
+// (and PostgreSQL when database.driver is postgres) as cfg says, starts the
+// payment projections and exports in group and returns its HTTP handler,
+// authenticated and instrumented. Payments are processed by the providers
+// registered in processors. The connections are closed when group shuts
+// down.
+func Start(group *lifecycle.Group, cfg *config.Config, log *logger.Logger, processors *domain.ProcessorRegistry) (http.Handler, error) {
+	// Initialize MongoDB connection
+	mongoDB, err := repository.NewMongoDB(cfg.MongoDB, log)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB: %w", err)
+	}
+	group.OnClose("mongodb", func() error { return mongoDB.Close(context.Background()) })
+
+	if err := migrations.New(mongoDB, log).Startup(context.Background(), cfg.Migrations, "payment_read_models", "payments", "invoices"); err != nil {
+		return nil, fmt.Errorf("check schema, run `migrate up`: %w", err)
+	}
+
+	// Initialize repositories; aggregates live in PostgreSQL when
+	// database.driver is postgres, read models stay in MongoDB.
+	var (
+		paymentRepo  commands.PaymentRepository
+		invoiceRepo  commands.InvoiceRepository
+		openInvoices commands.OpenInvoiceFinder
+		eventStore   commands.EventStore
+		postgres     *repository.Postgres
+	)
+	switch cfg.Database.Driver {
+	case "postgres":
+		postgres, err = repository.NewPostgres(cfg.Database.Postgres, log)
+		if err != nil {
+			return nil, fmt.Errorf("connect to PostgreSQL: %w", err)
+		}
+		group.OnClose("postgres", postgres.Close)
+		paymentRepo = repository.NewPostgresPaymentRepository(postgres, log)
+		invoices := repository.NewPostgresInvoiceRepository(postgres, log)
+		invoiceRepo, openInvoices = invoices, invoices
+		eventStore = repository.NewPostgresEventStore(postgres, log)
+	default:
+		paymentRepo = repository.NewMongoPaymentRepository(mongoDB, log)
+		invoices := repository.NewMongoInvoiceRepository(mongoDB, log)
+		invoiceRepo, openInvoices = invoices, invoices
+		eventStore = repository.NewEventStore(mongoDB, log)
+	}
+
+	// Initialize read model stores; invoice numbers and client names are
+	// denormalized into payments from the invoice and client read models.
+	readModelStore := repository.NewReadModelStore(mongoDB, "payment_read_models", log)
+	invoiceStore := repository.NewReadModelStore(mongoDB, "invoice_read", log)
+	clientStore := repository.NewReadModelStore(mongoDB, "client_read", log)
+
+	// Initialize Redis connection
+	redisClient, err := repository.NewRedis(cfg.Redis, log)
+	if err != nil {
+		return nil, fmt.Errorf("connect to Redis: %w", err)
+	}
+	group.OnClose("redis", redisClient.Close)
+
+	// Initialize cache (using Redis)
+	cache := repository.NewCache(redisClient, "payment_cache", log)
+
+	// Initialize publisher (NATS or Kafka, per messaging.transport)
+	publisher, err := messaging.NewEventPublisher(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("create event publisher: %w", err)
+	}
+
+	subscriber, err := messaging.NewEventSubscriber(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("create event subscriber: %w", err)
+	}
+	group.OnClose("subscriber", subscriber.Close)
+	group.OnShutdown("subscriber", subscriber.Drain)
+
+	// Initialize handlers
+	paymentHandler := commands.NewPaymentCommandHandler(
+		paymentRepo,
+		invoiceRepo,
+		eventStore,
+		publisher,
+		log,
+		processors,
+	)
+	// Rates are synced by the invoice service; payments only look them up
+	// to record their amount in the tenant's reporting currency.
+	paymentHandler.WithCurrencyConverter(fx.NewService(cfg.FX, repository.NewExchangeRateStore(mongoDB), nil, log))
+
+	// Cash drawer sessions of retail registers are kept in MongoDB whatever
+	// the database driver.
+	cashSessions := repository.NewCashSessionStore(mongoDB)
+	if err := cashSessions.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create cash session indexes", "error", err)
+	}
+	cashHandler := commands.NewCashSessionCommandHandler(
+		cashSessions,
+		paymentRepo,
+		invoiceRepo,
+		publisher,
+		log,
+	)
+
+	// Imported bank statements are kept in MongoDB as well, with the
+	// counterparty IBANs encrypted when PII encryption is on.
+	pii, err := cfg.Security.PII.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("configure PII encryption: %w", err)
+	}
+	bankStatements := repository.NewBankStatementStore(mongoDB).WithEncryption(pii)
+	if err := bankStatements.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create bank statement indexes", "error", err)
+	}
+	bankHandler := commands.NewBankReconciliationCommandHandler(
+		bankStatements,
+		paymentRepo,
+		invoiceRepo,
+		openInvoices,
+		publisher,
+		log,
+	)
+
+	if cfg.Outbox.Enabled {
+		var outbox *messaging.Outbox
+		if postgres != nil {
+			outbox = messaging.OpenPostgresOutbox(postgres, publisher, cfg.Outbox, log)
+		} else if outbox, err = messaging.OpenOutbox(context.Background(), mongoDB, publisher, cfg.Outbox, log); err != nil {
+			return nil, fmt.Errorf("open outbox: %w", err)
+		}
+		group.Go("outbox relay", outbox.Run)
+		paymentHandler.WithOutbox(outbox)
+		cashHandler.WithOutbox(outbox)
+		bankHandler.WithOutbox(outbox)
+		log.Info("Transactional outbox enabled")
+	}
+
+	queryHandler := queries.NewPaymentQueryHandler(
+		readModelStore,
+		cache,
+		log,
+	)
+
+	webhookHandler := commands.NewWebhookHandler(
+		paymentRepo,
+		invoiceRepo,
+		publisher,
+		log,
+		os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		os.Getenv("PAYPAL_WEBHOOK_ID"),
+	).WithProcessors(processors)
+
+	processedEvents := repository.NewProcessedEventStore(mongoDB)
+	if err := processedEvents.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("Failed to create processed event indexes", "error", err)
+	}
+
+	projections := events.PaymentProjections(readModelStore, invoiceStore, clientStore, cache, log).
+		WithProcessedEvents(processedEvents, projectionConsumer, cfg.NATS.ProcessedEventTTL)
+	dlq, err := consumeProjections(group, cfg, subscriber, projections, log)
+	if err != nil {
+		return nil, fmt.Errorf("start payment projections: %w", err)
+	}
+
+	files, err := export.NewStorage(cfg.MinIO)
+	if err != nil {
+		return nil, fmt.Errorf("configure MinIO: %w", err)
+	}
+	exporter := export.NewExporter(mongoDB, files, cfg.Exports, log, paymentExport).WithMasking(cfg.Security.Masking)
+	if err := exporter.Setup(context.Background()); err != nil {
+		log.Warn("Failed to set up exports", "error", err)
+	}
+	group.Go("export worker", exporter.Run)
+
+	service := NewPaymentService(
+		cfg,
+		log,
+		paymentHandler,
+		queryHandler,
+		webhookHandler,
+		paymentRepo,
+		invoiceRepo,
+		publisher,
+		processors,
+	)
+
+	service.cashHandler = cashHandler
+	service.cashSessions = cashSessions
+	service.bankHandler = bankHandler
+	service.bankStatements = bankStatements
+
+	service.health = health.NewHealthChecker(cfg, mongoDB, redisClient, log)
+	service.health.AddComponent("messaging", health.MessagingCheck(publisher))
+	if postgres != nil {
+		service.health.AddComponent("postgres", health.PostgresCheck(postgres))
+	}
+	if natsSubscriber, ok := subscriber.(*messaging.Subscriber); ok && cfg.NATS.JetStream.Enabled {
+		service.health.AddComponent("consumer:"+projectionConsumer, health.ConsumerLagCheck(
+			natsSubscriber, "PAYMENT_EVENTS", projectionConsumer, cfg.NATS.JetStream.MaxConsumerLag))
+	}
+	service.readiness = service.health.Readiness()
+	service.throttle = middleware.NewThrottle(repository.NewRateLimiter(redisClient, log), cfg.Security.Throttle, log)
+
+	mux := service.setupRoutes()
+	mux.Handle(events.CatalogPath, events.NewCatalog(cfg.App.Name, events.PaymentEvents, projections.EventTypes()).Handler())
+	if dlq != nil {
+		mux.Handle("/admin/dlq", dlq.Handler())
+		mux.Handle("/admin/dlq/", dlq.Handler())
+	}
+	if natsSubscriber, ok := subscriber.(*messaging.Subscriber); ok && cfg.NATS.JetStream.Enabled {
+		mux.Handle("/debug/consumers", natsSubscriber.ConsumersHandler())
+	}
+	exports := service.throttle.Limit(middleware.ThrottleExport, exporter.Handler("/api/v1/payments/exports"), http.MethodPost)
+	mux.Handle("/api/v1/payments/exports", exports)
+	mux.Handle("/api/v1/payments/exports/", exports)
+
+	tokenValidator, err := auth.NewTokenValidator(&cfg.Auth, log)
+	if err != nil {
+		return nil, fmt.Errorf("configure token validation: %w", err)
+	}
+	tenants := middleware.NewTenantMiddleware(tokenValidator, "/api/v1/payments/webhook")
+
+	return metrics.HTTPMiddleware(middleware.Instrument(log, tenants.Handler(middleware.MaskPII(cfg.Security.Masking, mux)))), nil
+}
+
+func parseInt(s string, defaultVal int) int {
+	if s == "" {
+		return defaultVal
+	}
+	val, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
+
+func generateUUID() string {
+	return uuid.New().String()
+}
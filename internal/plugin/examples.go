@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/httpresponse"
 )
 
 // SlackNotificationPlugin sends notifications to Slack
@@ -237,7 +238,7 @@ func (p *CustomReportPlugin) handleExportReport(w http.ResponseWriter, r *http.R
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -9,6 +9,7 @@ import (
 
 	"github.com/ims-erp/system/internal/commands"
 	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/httpresponse"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -157,13 +158,13 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.mu.RUnlock()
 
 	if !exists {
-		http.NotFound(w, req)
+		httpresponse.ErrorStatus(w, req, http.StatusNotFound, "Not found")
 		return
 	}
 
 	// Check method
 	if route.Method != "" && route.Method != req.Method {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpresponse.ErrorStatus(w, req, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
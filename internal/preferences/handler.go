@@ -0,0 +1,114 @@
+package preferences
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ims-erp/system/internal/middleware"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// maxValueBytes caps the size of one saved value.
+const maxValueBytes = 64 << 10
+
+// Handler serves the caller's own preferences under prefix, such as
+// /api/v1/preferences:
+//
+//	GET    prefix           every preference the caller saved
+//	GET    prefix/schemas   the kinds of preferences with their schemas
+//	GET    prefix/{key}     one preference, with its version as ETag
+//	PUT    prefix/{key}     save the request body as the value of key
+//	DELETE prefix/{key}     remove the preference
+//
+// PUT honors If-Match, so two tabs saving the same layout do not overwrite
+// each other unnoticed.
+func (p *Preferences) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		ctx := r.Context()
+		tenantID := middleware.GetTenantID(ctx)
+		userID := middleware.GetUserID(ctx)
+		if userID == "" {
+			httpresponse.ErrorStatus(w, r, http.StatusUnauthorized, "preferences belong to a user")
+			return
+		}
+
+		switch {
+		case key == "" && r.Method == http.MethodGet:
+			prefs, err := p.List(ctx, tenantID, userID)
+			if err != nil {
+				p.writeError(w, r, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": prefs})
+
+		case key == "schemas" && r.Method == http.MethodGet:
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": Definitions})
+
+		case key != "" && r.Method == http.MethodGet:
+			pref, err := p.Get(ctx, tenantID, userID, key)
+			if err != nil {
+				p.writeError(w, r, err)
+				return
+			}
+			httpresponse.SetETag(w, pref.Version)
+			httpresponse.JSON(w, http.StatusOK, pref)
+
+		case key != "" && r.Method == http.MethodPut:
+			var expected int64
+			if match := r.Header.Get("If-Match"); match != "" {
+				version, ok := httpresponse.ParseETag(match)
+				if !ok {
+					httpresponse.ErrorStatus(w, r, http.StatusBadRequest, "If-Match must be an ETag")
+					return
+				}
+				expected = version
+			}
+			value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueBytes))
+			if err != nil {
+				httpresponse.ErrorStatus(w, r, http.StatusRequestEntityTooLarge, "preference value is too large")
+				return
+			}
+			pref, err := p.Put(ctx, tenantID, userID, key, json.RawMessage(value), expected)
+			if err != nil {
+				p.writeError(w, r, err)
+				return
+			}
+			httpresponse.SetETag(w, pref.Version)
+			httpresponse.JSON(w, http.StatusOK, pref)
+
+		case key != "" && r.Method == http.MethodDelete:
+			if err := p.Delete(ctx, tenantID, userID, key); err != nil {
+				p.writeError(w, r, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
+
+func (p *Preferences) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrUnknownKey) {
+		httpresponse.ErrorStatus(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	var appErr *apperr.Error
+	if !errors.As(err, &appErr) {
+		p.logger.New(r.Context()).Errorw("Preference request failed", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusInternalServerError, "preferences unavailable")
+		return
+	}
+	if _, ok := appErr.Details.(apperr.ValidationErrors); ok {
+		httpresponse.WriteError(w, r, http.StatusUnprocessableEntity, appErr)
+		return
+	}
+	httpresponse.Error(w, r, appErr)
+}
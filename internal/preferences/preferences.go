@@ -0,0 +1,298 @@
+// Package preferences keeps per-user settings the frontend shares across
+// modules: saved list filters, column layouts, default warehouse and
+// currency, and notification settings. Each setting is a JSON value under a
+// key and is validated against the schema of its key before it is saved.
+// Notification settings are also written to the notification preferences
+// the notifier reads, so they take effect without a second save.
+package preferences
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+	apperr "github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/jsonschema"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// Kinds of preferences. Saved views and column layouts belong to one list
+// and are saved under the kind and the list, such as "views.invoices"; the
+// others are saved under the kind alone.
+const (
+	SavedViews    = "views"
+	ColumnLayout  = "columns"
+	Defaults      = "defaults"
+	Notifications = "notifications"
+)
+
+// Definition describes a kind of preference.
+type Definition struct {
+	Description string             `json:"description"`
+	PerList     bool               `json:"perList"`
+	Schema      *jsonschema.Schema `json:"schema"`
+}
+
+// Definitions describes every kind by name. A key must name one of them.
+var Definitions = map[string]Definition{
+	SavedViews: {
+		Description: "Saved filters and sort order of a list, one of which may be the default",
+		PerList:     true,
+		Schema: mustParse(`{
+			"type": "array",
+			"maxItems": 50,
+			"items": {
+				"type": "object",
+				"required": ["name", "filters"],
+				"additionalProperties": false,
+				"properties": {
+					"name": {"type": "string", "minLength": 1, "maxLength": 80},
+					"filters": {"type": "object"},
+					"sort": {
+						"type": "object",
+						"required": ["field"],
+						"additionalProperties": false,
+						"properties": {
+							"field": {"type": "string", "minLength": 1, "maxLength": 64},
+							"direction": {"enum": ["asc", "desc"]}
+						}
+					},
+					"default": {"type": "boolean"}
+				}
+			}
+		}`),
+	},
+	ColumnLayout: {
+		Description: "Columns shown in a list, in order, with their widths and the page size",
+		PerList:     true,
+		Schema: mustParse(`{
+			"type": "object",
+			"required": ["columns"],
+			"additionalProperties": false,
+			"properties": {
+				"columns": {
+					"type": "array",
+					"maxItems": 100,
+					"items": {
+						"type": "object",
+						"required": ["field"],
+						"additionalProperties": false,
+						"properties": {
+							"field": {"type": "string", "minLength": 1, "maxLength": 64},
+							"width": {"type": "integer", "minimum": 20, "maximum": 2000},
+							"visible": {"type": "boolean"}
+						}
+					}
+				},
+				"pageSize": {"type": "integer", "minimum": 1, "maximum": 500}
+			}
+		}`),
+	},
+	Defaults: {
+		Description: "Default warehouse and currency of new documents",
+		Schema: mustParse(`{
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"warehouseId": {"type": "string", "minLength": 1, "maxLength": 64},
+				"currency": {"type": "string", "pattern": "^[A-Z]{3}$"}
+			}
+		}`),
+	},
+	Notifications: {
+		Description: "Notification channels turned on or off and event types muted",
+		Schema: mustParse(`{
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"channels": {
+					"type": "object",
+					"additionalProperties": false,
+					"properties": {
+						"email": {"type": "boolean"},
+						"sms": {"type": "boolean"},
+						"in_app": {"type": "boolean"}
+					}
+				},
+				"mutedEventTypes": {
+					"type": "array",
+					"maxItems": 100,
+					"items": {"type": "string", "minLength": 1, "maxLength": 100}
+				}
+			}
+		}`),
+	},
+}
+
+func mustParse(schema string) *jsonschema.Schema {
+	s, err := jsonschema.Parse([]byte(schema))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ErrUnknownKey is returned for a key that names no kind in Definitions, or
+// lacks or has a list the kind does not expect.
+var ErrUnknownKey = errors.New("unknown preference")
+
+var listName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+// Lookup returns the definition of the kind key names.
+func Lookup(key string) (Definition, error) {
+	kind, list, scoped := strings.Cut(key, ".")
+	def, ok := Definitions[kind]
+	if !ok || def.PerList != scoped || (scoped && !listName.MatchString(list)) {
+		return Definition{}, ErrUnknownKey
+	}
+	return def, nil
+}
+
+// Preference is a saved preference with its value.
+type Preference struct {
+	repository.Preference
+	Value json.RawMessage `json:"value"`
+}
+
+type store interface {
+	List(ctx context.Context, tenantID, userID string) ([]repository.Preference, error)
+	Get(ctx context.Context, tenantID, userID, key string) (*repository.Preference, error)
+	Put(ctx context.Context, tenantID, userID, key, value string, expectedVersion int64) (*repository.Preference, error)
+	Delete(ctx context.Context, tenantID, userID, key string) (bool, error)
+}
+
+type notificationStore interface {
+	Get(ctx context.Context, tenantID, userID string) (*domain.NotificationPreference, error)
+	Save(ctx context.Context, pref *domain.NotificationPreference) error
+}
+
+// Preferences reads and saves the preferences of users.
+type Preferences struct {
+	store         store
+	notifications notificationStore
+	logger        *logger.Logger
+}
+
+// New returns preferences saved in store. Notification settings are also
+// saved in notifications.
+func New(store *repository.PreferenceStore, notifications *repository.NotificationPreferenceStore, log *logger.Logger) *Preferences {
+	return newPreferences(store, notifications, log)
+}
+
+func newPreferences(store store, notifications notificationStore, log *logger.Logger) *Preferences {
+	return &Preferences{store: store, notifications: notifications, logger: log}
+}
+
+// List returns every preference userID saved, ordered by key.
+func (p *Preferences) List(ctx context.Context, tenantID, userID string) ([]Preference, error) {
+	saved, err := p.store.List(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs := make([]Preference, 0, len(saved))
+	for _, pref := range saved {
+		prefs = append(prefs, Preference{Preference: pref, Value: json.RawMessage(pref.Value)})
+	}
+	return prefs, nil
+}
+
+// Get returns the preference userID saved under key.
+func (p *Preferences) Get(ctx context.Context, tenantID, userID, key string) (*Preference, error) {
+	if _, err := Lookup(key); err != nil {
+		return nil, err
+	}
+	pref, err := p.store.Get(ctx, tenantID, userID, key)
+	if errors.Is(err, repository.ErrPreferenceNotFound) {
+		return nil, apperr.NotFound("preference %s not found", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Preference{Preference: *pref, Value: json.RawMessage(pref.Value)}, nil
+}
+
+// Put validates value against the schema of key and saves it. With
+// expectedVersion above zero the preference is only replaced at that
+// version.
+func (p *Preferences) Put(ctx context.Context, tenantID, userID, key string, value json.RawMessage, expectedVersion int64) (*Preference, error) {
+	def, err := Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	violations, err := def.Schema.ValidateJSON(value)
+	if err != nil {
+		return nil, apperr.InvalidArgument("value is not valid JSON")
+	}
+	if len(violations) > 0 {
+		appErr := apperr.InvalidArgument("preference %s failed schema validation", key)
+		appErr.Details = violations
+		return nil, appErr
+	}
+
+	pref, err := p.store.Put(ctx, tenantID, userID, key, string(value), expectedVersion)
+	if errors.Is(err, repository.ErrPreferenceConflict) {
+		return nil, p.conflict(ctx, tenantID, userID, key, expectedVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key == Notifications {
+		if err := p.syncNotifications(ctx, tenantID, userID, value); err != nil {
+			return nil, err
+		}
+	}
+	return &Preference{Preference: *pref, Value: json.RawMessage(pref.Value)}, nil
+}
+
+// Delete removes the preference userID saved under key, returning to the
+// frontend's default.
+func (p *Preferences) Delete(ctx context.Context, tenantID, userID, key string) error {
+	if _, err := Lookup(key); err != nil {
+		return err
+	}
+	found, err := p.store.Delete(ctx, tenantID, userID, key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperr.NotFound("preference %s not found", key)
+	}
+	if key == Notifications {
+		return p.syncNotifications(ctx, tenantID, userID, json.RawMessage(`{}`))
+	}
+	return nil
+}
+
+func (p *Preferences) conflict(ctx context.Context, tenantID, userID, key string, expected int64) error {
+	current, err := p.store.Get(ctx, tenantID, userID, key)
+	if errors.Is(err, repository.ErrPreferenceNotFound) {
+		return apperr.NotFound("preference %s not found", key)
+	}
+	if err != nil {
+		return err
+	}
+	return apperr.VersionConflict("preference", expected, current.Version)
+}
+
+// syncNotifications replaces the channels and muted event types of userID's
+// notification preferences, keeping their contact details.
+func (p *Preferences) syncNotifications(ctx context.Context, tenantID, userID string, value json.RawMessage) error {
+	var settings struct {
+		Channels        map[string]bool `json:"channels"`
+		MutedEventTypes []string        `json:"mutedEventTypes"`
+	}
+	if err := json.Unmarshal(value, &settings); err != nil {
+		return err
+	}
+	pref, err := p.notifications.Get(ctx, tenantID, userID)
+	if err != nil {
+		return err
+	}
+	pref.Channels = settings.Channels
+	pref.MutedEventTypes = settings.MutedEventTypes
+	return p.notifications.Save(ctx, pref)
+}
@@ -0,0 +1,177 @@
+package preferences
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	prefs map[string]*repository.Preference
+}
+
+func (s *fakeStore) List(ctx context.Context, tenantID, userID string) ([]repository.Preference, error) {
+	var prefs []repository.Preference
+	for _, pref := range s.prefs {
+		if pref.TenantID == tenantID && pref.UserID == userID {
+			prefs = append(prefs, *pref)
+		}
+	}
+	return prefs, nil
+}
+
+func (s *fakeStore) Get(ctx context.Context, tenantID, userID, key string) (*repository.Preference, error) {
+	pref, ok := s.prefs[tenantID+"/"+userID+"/"+key]
+	if !ok {
+		return nil, repository.ErrPreferenceNotFound
+	}
+	copied := *pref
+	return &copied, nil
+}
+
+func (s *fakeStore) Put(ctx context.Context, tenantID, userID, key, value string, expectedVersion int64) (*repository.Preference, error) {
+	id := tenantID + "/" + userID + "/" + key
+	pref, ok := s.prefs[id]
+	if expectedVersion > 0 && (!ok || pref.Version != expectedVersion) {
+		return nil, repository.ErrPreferenceConflict
+	}
+	if !ok {
+		pref = &repository.Preference{ID: id, TenantID: tenantID, UserID: userID, Key: key}
+		s.prefs[id] = pref
+	}
+	pref.Value = value
+	pref.Version++
+	copied := *pref
+	return &copied, nil
+}
+
+func (s *fakeStore) Delete(ctx context.Context, tenantID, userID, key string) (bool, error) {
+	id := tenantID + "/" + userID + "/" + key
+	_, ok := s.prefs[id]
+	delete(s.prefs, id)
+	return ok, nil
+}
+
+type fakeNotificationStore struct {
+	saved map[string]*domain.NotificationPreference
+}
+
+func (s *fakeNotificationStore) Get(ctx context.Context, tenantID, userID string) (*domain.NotificationPreference, error) {
+	if pref, ok := s.saved[userID]; ok {
+		copied := *pref
+		return &copied, nil
+	}
+	return &domain.NotificationPreference{TenantID: tenantID, UserID: userID}, nil
+}
+
+func (s *fakeNotificationStore) Save(ctx context.Context, pref *domain.NotificationPreference) error {
+	s.saved[pref.UserID] = pref
+	return nil
+}
+
+func newTestPreferences(t *testing.T) (*Preferences, *fakeNotificationStore) {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "error", Format: "json"})
+	require.NoError(t, err)
+	notifications := &fakeNotificationStore{saved: map[string]*domain.NotificationPreference{
+		"user-1": {TenantID: "tenant-1", UserID: "user-1", Email: "ana@example.com"},
+	}}
+	return newPreferences(&fakeStore{prefs: map[string]*repository.Preference{}}, notifications, log), notifications
+}
+
+func TestLookup(t *testing.T) {
+	for _, key := range []string{"views.invoices", "columns.sales-orders", "defaults", "notifications"} {
+		_, err := Lookup(key)
+		assert.NoError(t, err, key)
+	}
+	for _, key := range []string{"views", "defaults.invoices", "views.Invoices", "views.a/b", "theme"} {
+		_, err := Lookup(key)
+		assert.ErrorIs(t, err, ErrUnknownKey, key)
+	}
+}
+
+func TestPutValidatesAgainstSchema(t *testing.T) {
+	prefs, _ := newTestPreferences(t)
+	ctx := context.Background()
+
+	_, err := prefs.Put(ctx, "tenant-1", "user-1", "defaults", []byte(`{"currency":"eur"}`), 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "schema validation")
+
+	_, err = prefs.Put(ctx, "tenant-1", "user-1", "views.invoices", []byte(`[{"name":"Overdue"}]`), 0)
+	require.Error(t, err)
+
+	pref, err := prefs.Put(ctx, "tenant-1", "user-1", "views.invoices",
+		[]byte(`[{"name":"Overdue","filters":{"status":"overdue"},"sort":{"field":"dueDate","direction":"asc"},"default":true}]`), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pref.Version)
+	assert.Contains(t, string(pref.Value), "Overdue")
+}
+
+func TestPutNotificationsUpdatesNotifier(t *testing.T) {
+	prefs, notifications := newTestPreferences(t)
+	ctx := context.Background()
+
+	_, err := prefs.Put(ctx, "tenant-1", "user-1", Notifications,
+		[]byte(`{"channels":{"sms":false},"mutedEventTypes":["order.shipped"]}`), 0)
+	require.NoError(t, err)
+	saved := notifications.saved["user-1"]
+	assert.Equal(t, "ana@example.com", saved.Email, "contact details are kept")
+	assert.False(t, saved.Allows("sms", "invoice.paid"))
+	assert.False(t, saved.Allows("email", "order.shipped"))
+
+	require.NoError(t, prefs.Delete(ctx, "tenant-1", "user-1", Notifications))
+	assert.True(t, notifications.saved["user-1"].Allows("sms", "order.shipped"))
+}
+
+func TestHandler(t *testing.T) {
+	prefs, _ := newTestPreferences(t)
+	handler := prefs.Handler("/api/v1/preferences")
+
+	serve := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(middleware.WithIdentity(req.Context(), "tenant-1", "user-1", nil))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/v1/preferences/defaults", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPut, "/api/v1/preferences/theme", `{}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, serve(http.MethodPut, "/api/v1/preferences/defaults", `{"currency":"euro"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/api/v1/preferences/defaults", `{`).Code)
+
+	rec := serve(http.MethodPut, "/api/v1/preferences/defaults", `{"currency":"EUR","warehouseId":"wh-1"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+
+	rec = serve(http.MethodGet, "/api/v1/preferences/defaults", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":{"currency":"EUR","warehouseId":"wh-1"}`)
+
+	rec = serve(http.MethodPut, "/api/v1/preferences/defaults", `{"currency":"USD"}`, "If-Match", `"3"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/v1/preferences/defaults", `{"currency":"USD"}`, "If-Match", `"1"`).Code)
+
+	rec = serve(http.MethodGet, "/api/v1/preferences", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"key":"defaults"`)
+	assert.Contains(t, serve(http.MethodGet, "/api/v1/preferences/schemas", "").Body.String(), `"views"`)
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/v1/preferences/defaults", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/api/v1/preferences/defaults", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/api/v1/preferences", "").Code)
+}
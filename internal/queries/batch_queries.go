@@ -0,0 +1,137 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Batch queries load read models for many parents in one round trip. They
+// back the GraphQL dataloaders and bypass the cache, since each batch is a
+// different combination of keys.
+
+type GetClientsByIDsQuery struct {
+	TenantID   string
+	ClientIDs  []string
+	Visibility domain.Visibility
+}
+
+type ListInvoicesByClientsQuery struct {
+	TenantID   string
+	ClientIDs  []string
+	Visibility domain.Visibility
+}
+
+type GetInvoicesByIDsQuery struct {
+	TenantID   string
+	InvoiceIDs []string
+	Visibility domain.Visibility
+}
+
+type GetPaymentsByInvoicesQuery struct {
+	TenantID   string
+	InvoiceIDs []string
+	Visibility domain.Visibility
+}
+
+func (h *ClientQueryHandler) GetClientsByIDs(ctx context.Context, query *GetClientsByIDsQuery) ([]events.ClientSummary, error) {
+	ctx, span := h.tracer.Start(ctx, "query.get_clients_by_ids",
+		trace.WithAttributes(
+			attribute.String("tenant_id", query.TenantID),
+			attribute.Int("count", len(query.ClientIDs)),
+		),
+	)
+	defer span.End()
+
+	results, err := h.readModelStore.Find(ctx, restrict(bson.M{
+		"tenantId": query.TenantID,
+		"_id":      bson.M{"$in": query.ClientIDs},
+	}, query.Visibility))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get clients by IDs: %w", err)
+	}
+	return decodeReadModels[events.ClientSummary](results), nil
+}
+
+func (h *InvoiceQueryHandler) GetInvoicesByIDs(ctx context.Context, query *GetInvoicesByIDsQuery) ([]events.InvoiceSummary, error) {
+	ctx, span := h.tracer.Start(ctx, "query.get_invoices_by_ids",
+		trace.WithAttributes(
+			attribute.String("tenant_id", query.TenantID),
+			attribute.Int("count", len(query.InvoiceIDs)),
+		),
+	)
+	defer span.End()
+
+	results, err := h.readModelStore.Find(ctx, restrict(bson.M{
+		"tenantId": query.TenantID,
+		"_id":      bson.M{"$in": query.InvoiceIDs},
+	}, query.Visibility))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get invoices by IDs: %w", err)
+	}
+	return decodeReadModels[events.InvoiceSummary](results), nil
+}
+
+func (h *InvoiceQueryHandler) ListInvoicesByClients(ctx context.Context, query *ListInvoicesByClientsQuery) ([]events.InvoiceSummary, error) {
+	ctx, span := h.tracer.Start(ctx, "query.list_invoices_by_clients",
+		trace.WithAttributes(
+			attribute.String("tenant_id", query.TenantID),
+			attribute.Int("count", len(query.ClientIDs)),
+		),
+	)
+	defer span.End()
+
+	results, err := h.readModelStore.Find(ctx, restrict(bson.M{
+		"tenantId": query.TenantID,
+		"clientId": bson.M{"$in": query.ClientIDs},
+	}, query.Visibility))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list invoices by clients: %w", err)
+	}
+	return decodeReadModels[events.InvoiceSummary](results), nil
+}
+
+func (h *PaymentQueryHandler) GetPaymentsByInvoices(ctx context.Context, query *GetPaymentsByInvoicesQuery) ([]events.PaymentSummary, error) {
+	ctx, span := h.tracer.Start(ctx, "query.get_payments_by_invoices",
+		trace.WithAttributes(
+			attribute.String("tenant_id", query.TenantID),
+			attribute.Int("count", len(query.InvoiceIDs)),
+		),
+	)
+	defer span.End()
+
+	results, err := h.readModelStore.Find(ctx, restrict(bson.M{
+		"tenantId":  query.TenantID,
+		"invoiceId": bson.M{"$in": query.InvoiceIDs},
+	}, query.Visibility))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get payments by invoices: %w", err)
+	}
+	return decodeReadModels[events.PaymentSummary](results), nil
+}
+
+// decodeReadModels converts the documents ReadModelStore returns into T,
+// skipping any that do not decode.
+func decodeReadModels[T any](results []interface{}) []T {
+	out := make([]T, 0, len(results))
+	for _, r := range results {
+		data, err := bson.Marshal(r)
+		if err != nil {
+			continue
+		}
+		var v T
+		if err := bson.Unmarshal(data, &v); err == nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,24 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/ims-erp/system/internal/events"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDecodeReadModels(t *testing.T) {
+	results := []interface{}{
+		bson.M{"_id": "pay-1", "tenantId": "tenant-1", "invoiceId": "inv-1", "amount": "10.00"},
+		bson.M{"_id": "pay-2", "tenantId": "tenant-1", "invoiceId": "inv-2", "amount": "25.50"},
+		bson.M{"_id": 42},
+	}
+
+	payments := decodeReadModels[events.PaymentSummary](results)
+
+	assert.Len(t, payments, 2)
+	assert.Equal(t, "pay-1", payments[0].ID)
+	assert.Equal(t, "inv-2", payments[1].InvoiceID)
+	assert.Equal(t, "25.50", payments[1].Amount)
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
+	"github.com/ims-erp/system/internal/domain"
 	"github.com/ims-erp/system/internal/events"
 	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/fieldset"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/pagination"
+	"github.com/shopspring/decimal"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -17,6 +22,8 @@ import (
 
 type ClientQueryHandler struct {
 	readModelStore *repository.ReadModelStore
+	invoices       *repository.ReadModelStore
+	payments       *repository.ReadModelStore
 	cache          *repository.Cache
 	logger         *logger.Logger
 	tracer         trace.Tracer
@@ -35,36 +42,68 @@ func NewClientQueryHandler(
 	}
 }
 
+// WithInvoices reads the client's unapplied credit for its credit status
+// from the invoice read model in store.
+func (h *ClientQueryHandler) WithInvoices(store *repository.ReadModelStore) *ClientQueryHandler {
+	h.invoices = store
+	return h
+}
+
+// WithPayments reads the client's account credit for their detail from the
+// payment read model in store.
+func (h *ClientQueryHandler) WithPayments(store *repository.ReadModelStore) *ClientQueryHandler {
+	h.payments = store
+	return h
+}
+
+// Client views can be narrowed to a sparse fieldset of these fields.
+var (
+	ClientSummaryFields = fieldset.Of(events.ClientSummary{})
+	ClientDetailFields  = fieldset.Of(events.ClientDetail{})
+)
+
 type GetClientByIDQuery struct {
-	ClientID string
-	TenantID string
+	ClientID   string
+	TenantID   string
+	Fields     fieldset.Set
+	Visibility domain.Visibility
 }
 
 type GetClientDetailQuery struct {
-	ClientID string
-	TenantID string
+	ClientID   string
+	TenantID   string
+	Fields     fieldset.Set
+	Visibility domain.Visibility
 }
 
 type ListClientsQuery struct {
 	TenantID  string
 	Page      int
 	PageSize  int
+	Cursor    string
 	Search    string
 	Status    string
 	Tags      []string
 	SortBy    string
 	SortOrder string
+	Fields    fieldset.Set
+	// Deleted lists the trash instead of live clients.
+	Deleted    bool
+	Visibility domain.Visibility
 }
 
 type SearchClientsQuery struct {
-	TenantID string
-	Term     string
-	Limit    int
+	TenantID   string
+	Term       string
+	Limit      int
+	Fields     fieldset.Set
+	Visibility domain.Visibility
 }
 
 type GetClientCreditStatusQuery struct {
-	ClientID string
-	TenantID string
+	ClientID   string
+	TenantID   string
+	Visibility domain.Visibility
 }
 
 type ListClientsResult struct {
@@ -73,6 +112,7 @@ type ListClientsResult struct {
 	Page       int                    `json:"page"`
 	PageSize   int                    `json:"pageSize"`
 	TotalPages int                    `json:"totalPages"`
+	NextCursor string                 `json:"nextCursor,omitempty"`
 }
 
 func (h *ClientQueryHandler) GetClientByID(ctx context.Context, query *GetClientByIDQuery) (*events.ClientSummary, error) {
@@ -84,18 +124,21 @@ func (h *ClientQueryHandler) GetClientByID(ctx context.Context, query *GetClient
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("client:summary:%s", query.ClientID)
-	if cached, err := h.cache.Get(ctx, cacheKey); err == nil && cached != "" {
+	cacheKey := fmt.Sprintf("client:summary:%s%s%s", query.ClientID, query.Fields.CacheKey(), visibilityKey(query.Visibility))
+	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
-		return nil, nil
+		var client events.ClientSummary
+		if err := json.Unmarshal(cached, &client); err == nil {
+			return &client, nil
+		}
 	}
 
-	filter := map[string]interface{}{
+	filter := restrict(repository.NotDeleted(map[string]interface{}{
 		"_id":      query.ClientID,
 		"tenantId": query.TenantID,
-	}
+	}), query.Visibility)
 
-	result, err := h.readModelStore.FindOne(ctx, filter)
+	result, err := h.readModelStore.FindOne(ctx, filter, options.FindOne().SetProjection(query.Fields.Projection("version")))
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to get client: %w", err)
@@ -105,10 +148,11 @@ func (h *ClientQueryHandler) GetClientByID(ctx context.Context, query *GetClient
 		return nil, nil
 	}
 
-	client, ok := result.(events.ClientSummary)
-	if !ok {
+	decoded := decodeReadModels[events.ClientSummary]([]interface{}{result})
+	if len(decoded) == 0 {
 		return nil, fmt.Errorf("invalid client data")
 	}
+	client := decoded[0]
 
 	h.cache.Set(ctx, cacheKey, client, 5*time.Minute)
 
@@ -124,21 +168,21 @@ func (h *ClientQueryHandler) GetClientDetail(ctx context.Context, query *GetClie
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("client:detail:%s", query.ClientID)
+	cacheKey := fmt.Sprintf("client:detail:%s%s%s", query.ClientID, query.Fields.CacheKey(), visibilityKey(query.Visibility))
 	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
 		var client events.ClientDetail
 		if err := json.Unmarshal(cached, &client); err == nil {
-			return &client, nil
+			return h.withAccountCredit(ctx, query, &client)
 		}
 	}
 
-	filter := map[string]interface{}{
+	filter := restrict(repository.NotDeleted(map[string]interface{}{
 		"_id":      query.ClientID,
 		"tenantId": query.TenantID,
-	}
+	}), query.Visibility)
 
-	result, err := h.readModelStore.FindOne(ctx, filter)
+	result, err := h.readModelStore.FindOne(ctx, filter, options.FindOne().SetProjection(query.Fields.Projection("version")))
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to get client detail: %w", err)
@@ -148,16 +192,88 @@ func (h *ClientQueryHandler) GetClientDetail(ctx context.Context, query *GetClie
 		return nil, nil
 	}
 
-	clientDetail, ok := result.(events.ClientDetail)
-	if !ok {
+	decoded := decodeReadModels[events.ClientDetail]([]interface{}{result})
+	if len(decoded) == 0 {
 		return nil, fmt.Errorf("invalid client detail data")
 	}
+	clientDetail := decoded[0]
 
 	if data, err := json.Marshal(clientDetail); err == nil {
 		h.cache.Set(ctx, cacheKey, data, 5*time.Minute)
 	}
 
-	return &clientDetail, nil
+	return h.withAccountCredit(ctx, query, &clientDetail)
+}
+
+// withAccountCredit sets the account credit of client from the payment
+// read model, before the response is trimmed to the caller's fields and
+// masked. It is not cached with the client, whose cache payments do not
+// evict.
+func (h *ClientQueryHandler) withAccountCredit(ctx context.Context, query *GetClientDetailQuery, client *events.ClientDetail) (*events.ClientDetail, error) {
+	filter := accountCreditFilter(query)
+	if h.payments == nil || filter == nil {
+		return client, nil
+	}
+	results, err := h.payments.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client account credit: %w", err)
+	}
+	client.AccountCredit = accountCredit(decodeReadModels[events.PaymentDetail](results))
+	return client, nil
+}
+
+// accountCreditFilter returns the filter for the payments holding the
+// account credit of the client of query, restricted to those the caller
+// sees, or nil when the caller's fields leave the account credit out.
+func accountCreditFilter(query *GetClientDetailQuery) map[string]interface{} {
+	if !query.Fields.Has("accountCredit") {
+		return nil
+	}
+	return restrict(map[string]interface{}{
+		"tenantId": query.TenantID,
+		"clientId": query.ClientID,
+		"status":   string(domain.PaymentStatusCompleted),
+	}, query.Visibility)
+}
+
+// accountCredit sums the account credit of completed payments by currency:
+// what of each is neither applied to invoices nor refunded. Payments
+// projected before applications were recorded are taken as applied in
+// full.
+func accountCredit(payments []events.PaymentDetail) []events.AccountCreditBalance {
+	balances := []events.AccountCreditBalance{}
+	totals := make(map[string]decimal.Decimal)
+	index := make(map[string]int)
+	for _, payment := range payments {
+		if payment.AmountApplied == "" {
+			continue
+		}
+		credit, err := decimal.NewFromString(payment.Amount)
+		if err != nil {
+			continue
+		}
+		for _, field := range []string{payment.AmountApplied, payment.AmountRefunded} {
+			if amount, err := decimal.NewFromString(field); err == nil {
+				credit = credit.Sub(amount)
+			}
+		}
+		if !credit.IsPositive() {
+			continue
+		}
+		i, ok := index[payment.Currency]
+		if !ok {
+			i = len(balances)
+			index[payment.Currency] = i
+			balances = append(balances, events.AccountCreditBalance{Currency: payment.Currency})
+		}
+		totals[payment.Currency] = totals[payment.Currency].Add(credit)
+		balances[i].Payments++
+	}
+	for i := range balances {
+		balances[i].Amount = totals[balances[i].Currency].String()
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Currency < balances[j].Currency })
+	return balances
 }
 
 func (h *ClientQueryHandler) ListClients(ctx context.Context, query *ListClientsQuery) (*ListClientsResult, error) {
@@ -170,8 +286,9 @@ func (h *ClientQueryHandler) ListClients(ctx context.Context, query *ListClients
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("client:list:%s:%d:%d:%s:%s:%v",
-		query.TenantID, query.Page, query.PageSize, query.Search, query.Status, query.Tags)
+	cacheKey := fmt.Sprintf("client:list:%s:%d:%d:%s:%s:%v:%s:%s:%s:%t%s%s",
+		query.TenantID, query.Page, query.PageSize, query.Search, query.Status, query.Tags,
+		query.SortBy, query.SortOrder, query.Cursor, query.Deleted, query.Fields.CacheKey(), visibilityKey(query.Visibility))
 	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
 		var result ListClientsResult
@@ -183,11 +300,16 @@ func (h *ClientQueryHandler) ListClients(ctx context.Context, query *ListClients
 	filter := map[string]interface{}{
 		"tenantId": query.TenantID,
 	}
+	if query.Deleted {
+		repository.OnlyDeleted(filter)
+	} else {
+		repository.NotDeleted(filter)
+	}
 
 	if query.Search != "" {
 		filter["$or"] = []map[string]interface{}{
 			{"name": map[string]interface{}{"$regex": query.Search, "$options": "i"}},
-			{"email": map[string]interface{}{"$regex": query.Search, "$options": "i"}},
+			h.readModelStore.Match("email", query.Search),
 		}
 	}
 
@@ -201,6 +323,8 @@ func (h *ClientQueryHandler) ListClients(ctx context.Context, query *ListClients
 		}
 	}
 
+	restrict(filter, query.Visibility)
+
 	total, err := h.readModelStore.Count(ctx, filter)
 	if err != nil {
 		span.RecordError(err)
@@ -211,12 +335,19 @@ func (h *ClientQueryHandler) ListClients(ctx context.Context, query *ListClients
 	if pageSize <= 0 {
 		pageSize = 20
 	}
-	skip := (query.Page - 1) * pageSize
 
+	sort := pagination.NewSort(query.SortBy, query.SortOrder)
 	findOpts := options.Find().
-		SetSkip(int64(skip)).
-		SetLimit(int64(pageSize)).
-		SetSort(map[string]int{query.SortBy: getSortOrder(query.SortOrder)})
+		SetLimit(int64(pageSize + 1)).
+		SetSort(sort.Keys()).
+		SetProjection(query.Fields.Projection(sort.Field))
+	if query.Cursor != "" {
+		if err := sort.After(filter, query.Cursor); err != nil {
+			return nil, err
+		}
+	} else {
+		findOpts.SetSkip(int64((query.Page - 1) * pageSize))
+	}
 
 	results, err := h.readModelStore.Find(ctx, filter, findOpts)
 	if err != nil {
@@ -224,12 +355,9 @@ func (h *ClientQueryHandler) ListClients(ctx context.Context, query *ListClients
 		return nil, fmt.Errorf("failed to list clients: %w", err)
 	}
 
-	clients := make([]events.ClientSummary, 0, len(results))
-	for _, r := range results {
-		if client, ok := r.(events.ClientSummary); ok {
-			clients = append(clients, client)
-		}
-	}
+	results, nextCursor := sort.Page(results, pageSize)
+
+	clients := decodeReadModels[events.ClientSummary](results)
 
 	totalPages := int(total) / pageSize
 	if int(total)%pageSize > 0 {
@@ -242,6 +370,7 @@ func (h *ClientQueryHandler) ListClients(ctx context.Context, query *ListClients
 		Page:       query.Page,
 		PageSize:   pageSize,
 		TotalPages: totalPages,
+		NextCursor: nextCursor,
 	}
 
 	if data, err := json.Marshal(result); err == nil {
@@ -266,17 +395,20 @@ func (h *ClientQueryHandler) SearchClients(ctx context.Context, query *SearchCli
 	}
 
 	filter := map[string]interface{}{
-		"tenantId": query.TenantID,
+		"tenantId":                query.TenantID,
+		repository.DeletedAtField: nil,
 		"$or": []map[string]interface{}{
 			{"name": map[string]interface{}{"$regex": query.Term, "$options": "i"}},
-			{"email": map[string]interface{}{"$regex": query.Term, "$options": "i"}},
-			{"phone": map[string]interface{}{"$regex": query.Term, "$options": "i"}},
+			h.readModelStore.Match("email", query.Term),
+			h.readModelStore.Match("phone", query.Term),
 		},
 	}
+	restrict(filter, query.Visibility)
 
 	findOpts := options.Find().
 		SetLimit(int64(limit)).
-		SetSort(map[string]int{"name": 1})
+		SetSort(map[string]int{"name": 1}).
+		SetProjection(query.Fields.Projection())
 
 	results, err := h.readModelStore.Find(ctx, filter, findOpts)
 	if err != nil {
@@ -284,14 +416,7 @@ func (h *ClientQueryHandler) SearchClients(ctx context.Context, query *SearchCli
 		return nil, fmt.Errorf("failed to search clients: %w", err)
 	}
 
-	clients := make([]events.ClientSummary, 0, len(results))
-	for _, r := range results {
-		if client, ok := r.(events.ClientSummary); ok {
-			clients = append(clients, client)
-		}
-	}
-
-	return clients, nil
+	return decodeReadModels[events.ClientSummary](results), nil
 }
 
 func (h *ClientQueryHandler) GetClientCreditStatus(ctx context.Context, query *GetClientCreditStatusQuery) (*events.ClientCreditStatus, error) {
@@ -303,7 +428,7 @@ func (h *ClientQueryHandler) GetClientCreditStatus(ctx context.Context, query *G
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("client:credit:%s", query.ClientID)
+	cacheKey := fmt.Sprintf("client:credit:%s%s", query.ClientID, visibilityKey(query.Visibility))
 	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
 		var status events.ClientCreditStatus
@@ -313,8 +438,9 @@ func (h *ClientQueryHandler) GetClientCreditStatus(ctx context.Context, query *G
 	}
 
 	client, err := h.GetClientByID(ctx, &GetClientByIDQuery{
-		ClientID: query.ClientID,
-		TenantID: query.TenantID,
+		ClientID:   query.ClientID,
+		TenantID:   query.TenantID,
+		Visibility: query.Visibility,
 	})
 	if err != nil {
 		return nil, err
@@ -333,6 +459,22 @@ func (h *ClientQueryHandler) GetClientCreditStatus(ctx context.Context, query *G
 		Utilization:     0,
 		RiskLevel:       "low",
 		LastCheck:       time.Now().UTC(),
+		UnappliedCredit: []events.CreditBalance{},
+	}
+	if h.invoices != nil {
+		results, err := h.invoices.Find(ctx, repository.NotDeleted(map[string]interface{}{
+			"tenantId": query.TenantID,
+			"clientId": query.ClientID,
+			"type":     string(domain.InvoiceTypeCreditNote),
+			"status": map[string]interface{}{"$in": []string{
+				string(domain.InvoiceStatusPending), string(domain.InvoiceStatusSent), string(domain.InvoiceStatusOverdue),
+			}},
+		}))
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		creditStatus.UnappliedCredit = unappliedCredit(decodeReadModels[events.InvoiceDetail](results))
 	}
 
 	if data, err := json.Marshal(creditStatus); err == nil {
@@ -342,6 +484,32 @@ func (h *ClientQueryHandler) GetClientCreditStatus(ctx context.Context, query *G
 	return &creditStatus, nil
 }
 
+// unappliedCredit sums the credit left on creditNotes by currency.
+func unappliedCredit(creditNotes []events.InvoiceDetail) []events.CreditBalance {
+	balances := []events.CreditBalance{}
+	totals := make(map[string]decimal.Decimal)
+	index := make(map[string]int)
+	for _, note := range creditNotes {
+		amount, err := decimal.NewFromString(note.AmountDue)
+		if err != nil || !amount.IsPositive() {
+			continue
+		}
+		i, ok := index[note.Currency]
+		if !ok {
+			i = len(balances)
+			index[note.Currency] = i
+			balances = append(balances, events.CreditBalance{Currency: note.Currency})
+		}
+		totals[note.Currency] = totals[note.Currency].Add(amount)
+		balances[i].CreditNotes++
+	}
+	for i := range balances {
+		balances[i].Amount = totals[balances[i].Currency].String()
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Currency < balances[j].Currency })
+	return balances
+}
+
 func getSortOrder(order string) int {
 	if order == "desc" {
 		return -1
@@ -1,9 +1,14 @@
 package queries
 
 import (
+	"net/url"
 	"testing"
 
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/fieldset"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetClientByIDQuery(t *testing.T) {
@@ -70,6 +75,61 @@ func TestGetClientCreditStatusQuery(t *testing.T) {
 	assert.Equal(t, "tenant-456", query.TenantID)
 }
 
+func TestUnappliedCredit(t *testing.T) {
+	balances := unappliedCredit([]events.InvoiceDetail{
+		{Currency: "USD", AmountDue: "100.00"},
+		{Currency: "EUR", AmountDue: "40.50"},
+		{Currency: "USD", AmountDue: "25.25"},
+		{Currency: "USD", AmountDue: "0.00"},
+	})
+
+	assert.Equal(t, []events.CreditBalance{
+		{Currency: "EUR", Amount: "40.5", CreditNotes: 1},
+		{Currency: "USD", Amount: "125.25", CreditNotes: 2},
+	}, balances)
+	assert.Equal(t, []events.CreditBalance{}, unappliedCredit(nil))
+}
+
+func TestAccountCredit(t *testing.T) {
+	balances := accountCredit([]events.PaymentDetail{
+		{Currency: "USD", Amount: "150.00", AmountApplied: "100.00"},
+		{Currency: "EUR", Amount: "80.00", AmountApplied: "0"},
+		{Currency: "USD", Amount: "60.00", AmountApplied: "0", AmountRefunded: "35.00"},
+		{Currency: "USD", Amount: "90.00", AmountApplied: "90.00"},
+		{Currency: "USD", Amount: "500.00"},
+	})
+
+	assert.Equal(t, []events.AccountCreditBalance{
+		{Currency: "EUR", Amount: "80", Payments: 1},
+		{Currency: "USD", Amount: "75", Payments: 2},
+	}, balances)
+	assert.Equal(t, []events.AccountCreditBalance{}, accountCredit(nil))
+}
+
+func TestAccountCreditFilter(t *testing.T) {
+	query := &GetClientDetailQuery{ClientID: "client-123", TenantID: "tenant-456"}
+	assert.Equal(t, map[string]interface{}{
+		"tenantId": "tenant-456",
+		"clientId": "client-123",
+		"status":   "completed",
+	}, accountCreditFilter(query))
+
+	query.Visibility = domain.OwnVisibility("rep-1", nil)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"$or": []interface{}{map[string]interface{}{"ownerId": "rep-1"}}},
+	}, accountCreditFilter(query)["$and"], "restricted callers only count the payments they see")
+
+	fields, err := fieldset.Parse(url.Values{"fields": {"id,name"}}, "clients", ClientDetailFields)
+	require.NoError(t, err)
+	query.Fields = fields
+	assert.Nil(t, accountCreditFilter(query), "no payments are read when the fields leave the credit out")
+
+	fields, err = fieldset.Parse(url.Values{"fields": {"id,accountCredit"}}, "clients", ClientDetailFields)
+	require.NoError(t, err)
+	query.Fields = fields
+	assert.NotNil(t, accountCreditFilter(query))
+}
+
 func TestListClientsResult(t *testing.T) {
 	result := &ListClientsResult{
 		Total:      100,
@@ -48,6 +48,7 @@ type ListDocumentsQuery struct {
 	TenantID  string
 	Page      int
 	PageSize  int
+	Cursor    string
 	Type      string
 	Status    string
 	Tags      []string
@@ -127,6 +128,7 @@ type ListDocumentsResult struct {
 	Page       int               `json:"page"`
 	PageSize   int               `json:"pageSize"`
 	TotalPages int               `json:"totalPages"`
+	NextCursor string            `json:"nextCursor,omitempty"`
 }
 
 type SearchDocumentsResult struct {
@@ -205,8 +207,8 @@ func (h *DocumentQueryHandler) ListDocuments(ctx context.Context, query *ListDoc
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("document:list:%s:%s:%s:%d:%d:%s",
-		query.TenantID, query.Type, query.Status, query.Page, query.PageSize, query.Search)
+	cacheKey := fmt.Sprintf("document:list:%s:%s:%s:%d:%d:%s:%s",
+		query.TenantID, query.Type, query.Status, query.Page, query.PageSize, query.Search, query.Cursor)
 	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
 		var result ListDocumentsResult
@@ -224,6 +226,7 @@ func (h *DocumentQueryHandler) ListDocuments(ctx context.Context, query *ListDoc
 		TenantID: tenantID,
 		Page:     query.Page,
 		PageSize: query.PageSize,
+		Cursor:   query.Cursor,
 	}
 
 	if query.Type != "" {
@@ -248,29 +251,30 @@ func (h *DocumentQueryHandler) ListDocuments(ctx context.Context, query *ListDoc
 		filter.Page = 1
 	}
 
-	docs, total, err := h.docRepo.List(ctx, filter)
+	page, err := h.docRepo.List(ctx, filter)
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to list documents: %w", err)
 	}
 
-	summaries := make([]DocumentSummary, 0, len(docs))
-	for _, doc := range docs {
+	summaries := make([]DocumentSummary, 0, len(page.Documents))
+	for _, doc := range page.Documents {
 		summaries = append(summaries, *mapDocumentToSummary(&doc))
 	}
 
 	pageSize := filter.PageSize
-	totalPages := int(total) / pageSize
-	if int(total)%pageSize > 0 {
+	totalPages := int(page.Total) / pageSize
+	if int(page.Total)%pageSize > 0 {
 		totalPages++
 	}
 
 	result := &ListDocumentsResult{
 		Documents:  summaries,
-		Total:      total,
+		Total:      page.Total,
 		Page:       filter.Page,
 		PageSize:   pageSize,
 		TotalPages: totalPages,
+		NextCursor: page.NextCursor,
 	}
 
 	if data, err := json.Marshal(result); err == nil {
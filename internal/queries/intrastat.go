@@ -0,0 +1,321 @@
+package queries
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// natureOfTransactionSale is the Intrastat nature of transaction of an
+// outright purchase or sale, the only kind orders and receipts record.
+const natureOfTransactionSale = "11"
+
+// IntrastatSource streams the documents an Intrastat report is derived
+// from. repository.IntrastatStore implements it.
+type IntrastatSource interface {
+	// EachShippedOrder calls fn with the tenant's orders shipped in
+	// [from, to).
+	EachShippedOrder(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Order) error) error
+	// EachCompletedReceipt calls fn with the tenant's receipts completed in
+	// [from, to).
+	EachCompletedReceipt(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.WarehouseOperation) error) error
+	FindProducts(ctx context.Context, tenantID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]*domain.Product, error)
+}
+
+// GetIntrastatReportQuery selects one month, given as "2006-01", of a
+// tenant's movements to and from other EU member states. The month is
+// counted in Location. An empty Flow selects both flows.
+type GetIntrastatReportQuery struct {
+	TenantID         uuid.UUID
+	DeclarantCountry string
+	VATNumber        string
+	Period           string
+	Flow             string
+	Location         *time.Location
+}
+
+// IntrastatLine is one line of the declaration: the movements of a flow
+// that share partner country, commodity code, country of origin and
+// currency, added up. NetMass is in kilograms and SupplementaryUnits counts
+// the units moved.
+type IntrastatLine struct {
+	Flow                domain.IntrastatFlow `json:"flow" xml:"Flow"`
+	PartnerCountry      string               `json:"partnerCountry" xml:"PartnerCountry"`
+	CommodityCode       string               `json:"commodityCode" xml:"CommodityCode"`
+	CountryOfOrigin     string               `json:"countryOfOrigin" xml:"CountryOfOrigin"`
+	NatureOfTransaction string               `json:"natureOfTransaction" xml:"NatureOfTransaction"`
+	NetMass             decimal.Decimal      `json:"netMass" xml:"NetMass"`
+	SupplementaryUnits  int                  `json:"supplementaryUnits" xml:"SupplementaryUnits"`
+	Value               decimal.Decimal      `json:"value" xml:"InvoiceValue"`
+	Currency            string               `json:"currency" xml:"Currency"`
+	Movements           int                  `json:"movements" xml:"-"`
+}
+
+// IntrastatIssue is a movement that had to be left out of the report
+// because the data to declare it is missing.
+type IntrastatIssue struct {
+	Flow          domain.IntrastatFlow `json:"flow"`
+	ReferenceType string               `json:"referenceType"`
+	ReferenceID   string               `json:"referenceId"`
+	ProductID     string               `json:"productId,omitempty"`
+	Problem       string               `json:"problem"`
+}
+
+type IntrastatReport struct {
+	TenantID         string           `json:"tenantId"`
+	Period           string           `json:"period"`
+	DeclarantCountry string           `json:"declarantCountry"`
+	VATNumber        string           `json:"vatNumber,omitempty"`
+	From             time.Time        `json:"from"`
+	To               time.Time        `json:"to"`
+	Lines            []IntrastatLine  `json:"lines"`
+	Issues           []IntrastatIssue `json:"issues"`
+}
+
+type intrastatKey struct {
+	flow           domain.IntrastatFlow
+	partnerCountry string
+	commodityCode  string
+	origin         string
+	currency       string
+}
+
+// intrastatBuilder adds movements up into declaration lines, looking
+// products up as it meets them.
+type intrastatBuilder struct {
+	source   IntrastatSource
+	tenantID uuid.UUID
+	products map[uuid.UUID]*domain.Product
+	lines    map[intrastatKey]*IntrastatLine
+	issues   []IntrastatIssue
+}
+
+// loadProducts fetches the products of ids not looked up yet.
+func (b *intrastatBuilder) loadProducts(ctx context.Context, ids []uuid.UUID) error {
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if _, ok := b.products[id]; !ok {
+			missing = append(missing, id)
+			b.products[id] = nil
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	found, err := b.source.FindProducts(ctx, b.tenantID, missing)
+	if err != nil {
+		return err
+	}
+	for id, product := range found {
+		b.products[id] = product
+	}
+	return nil
+}
+
+// add declares quantity units of productID worth value, or records why it
+// cannot.
+func (b *intrastatBuilder) add(flow domain.IntrastatFlow, partnerCountry, referenceType, referenceID string, productID uuid.UUID, quantity int, value decimal.Decimal, currency string) {
+	issue := func(problem string) {
+		b.issues = append(b.issues, IntrastatIssue{
+			Flow:          flow,
+			ReferenceType: referenceType,
+			ReferenceID:   referenceID,
+			ProductID:     productID.String(),
+			Problem:       problem,
+		})
+	}
+
+	product := b.products[productID]
+	switch {
+	case product == nil:
+		issue("product not found")
+		return
+	case product.CommodityCode == "":
+		issue("product has no commodity code")
+		return
+	case !product.NetWeight.IsPositive():
+		issue("product has no net weight")
+		return
+	case flow == domain.IntrastatDispatch && product.CountryOfOrigin == "":
+		issue("product has no country of origin")
+		return
+	}
+	if currency == "" {
+		currency = product.Currency
+	}
+
+	key := intrastatKey{
+		flow:           flow,
+		partnerCountry: partnerCountry,
+		commodityCode:  product.CommodityCode,
+		origin:         product.CountryOfOrigin,
+		currency:       currency,
+	}
+	line, ok := b.lines[key]
+	if !ok {
+		line = &IntrastatLine{
+			Flow:                flow,
+			PartnerCountry:      partnerCountry,
+			CommodityCode:       product.CommodityCode,
+			CountryOfOrigin:     product.CountryOfOrigin,
+			NatureOfTransaction: natureOfTransactionSale,
+			Currency:            currency,
+		}
+		b.lines[key] = line
+	}
+	line.NetMass = line.NetMass.Add(product.NetWeight.Mul(decimal.NewFromInt(int64(quantity))))
+	line.SupplementaryUnits += quantity
+	line.Value = line.Value.Add(value)
+	line.Movements++
+}
+
+// intrastatPartner returns the member state a movement crossed the border
+// with, or "" when it stayed in declarant or left the EU.
+func intrastatPartner(country, declarant string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == declarant || !domain.IsEUMemberState(country) {
+		return ""
+	}
+	return country
+}
+
+// IntrastatPeriod returns the bounds of month, given as "2006-01", in loc.
+func IntrastatPeriod(month string, loc *time.Location) (from, to time.Time, err error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	from, err = time.ParseInLocation("2006-01", month, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.InvalidArgument("period must be a month such as 2026-03")
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// GetIntrastatReport derives the dispatches from the orders shipped to
+// other member states in the period and the arrivals from the receipts
+// completed from them. Orders are declared at their line totals in the
+// order currency and receipts at their lines' purchase cost; landed costs
+// are not part of the invoice value. Receipts without a partner country
+// are taken to be domestic.
+func GetIntrastatReport(ctx context.Context, source IntrastatSource, query *GetIntrastatReportQuery) (*IntrastatReport, error) {
+	if !domain.IsEUMemberState(query.DeclarantCountry) {
+		return nil, errors.New(errors.CodeUnprocessable, "no EU declarant country is configured for Intrastat")
+	}
+	flow := domain.IntrastatFlow(query.Flow)
+	if query.Flow != "" && !flow.IsValid() {
+		return nil, errors.InvalidArgument("flow must be dispatch or arrival")
+	}
+	from, to, err := IntrastatPeriod(query.Period, query.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &intrastatBuilder{
+		source:   source,
+		tenantID: query.TenantID,
+		products: make(map[uuid.UUID]*domain.Product),
+		lines:    make(map[intrastatKey]*IntrastatLine),
+	}
+
+	if query.Flow == "" || flow == domain.IntrastatDispatch {
+		err := source.EachShippedOrder(ctx, query.TenantID, from, to, func(order *domain.Order) error {
+			if order.ShippingAddress == nil || order.ShippingAddress.Country == "" {
+				b.issues = append(b.issues, IntrastatIssue{
+					Flow:          domain.IntrastatDispatch,
+					ReferenceType: "order",
+					ReferenceID:   order.ID.String(),
+					Problem:       "order has no shipping country",
+				})
+				return nil
+			}
+			partner := intrastatPartner(order.ShippingAddress.Country, query.DeclarantCountry)
+			if partner == "" {
+				return nil
+			}
+			ids := make([]uuid.UUID, 0, len(order.Lines))
+			for _, line := range order.Lines {
+				ids = append(ids, line.ProductID)
+			}
+			if err := b.loadProducts(ctx, ids); err != nil {
+				return err
+			}
+			for _, line := range order.Lines {
+				b.add(domain.IntrastatDispatch, partner, "order", order.ID.String(), line.ProductID, line.Quantity, line.RowTotal, order.Currency)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if query.Flow == "" || flow == domain.IntrastatArrival {
+		err := source.EachCompletedReceipt(ctx, query.TenantID, from, to, func(receipt *domain.WarehouseOperation) error {
+			partner := intrastatPartner(receipt.PartnerCountry, query.DeclarantCountry)
+			if partner == "" {
+				return nil
+			}
+			ids := make([]uuid.UUID, 0, len(receipt.Items))
+			for _, item := range receipt.Items {
+				ids = append(ids, item.ProductID)
+			}
+			if err := b.loadProducts(ctx, ids); err != nil {
+				return err
+			}
+			for _, item := range receipt.Items {
+				if item.QuantityDone <= 0 {
+					continue
+				}
+				value := item.UnitCost.Mul(decimal.NewFromInt(int64(item.QuantityDone)))
+				b.add(domain.IntrastatArrival, partner, "receipt", receipt.ID.String(), item.ProductID, item.QuantityDone, value, "")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &IntrastatReport{
+		TenantID:         query.TenantID.String(),
+		Period:           query.Period,
+		DeclarantCountry: query.DeclarantCountry,
+		VATNumber:        query.VATNumber,
+		From:             from,
+		To:               to,
+		Lines:            make([]IntrastatLine, 0, len(b.lines)),
+		Issues:           b.issues,
+	}
+	if report.Issues == nil {
+		report.Issues = []IntrastatIssue{}
+	}
+	for _, line := range b.lines {
+		line.NetMass = line.NetMass.Round(3)
+		line.Value = money.Round(line.Value, line.Currency)
+		report.Lines = append(report.Lines, *line)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		a, c := report.Lines[i], report.Lines[j]
+		if a.Flow != c.Flow {
+			return a.Flow == domain.IntrastatDispatch
+		}
+		if a.PartnerCountry != c.PartnerCountry {
+			return a.PartnerCountry < c.PartnerCountry
+		}
+		if a.CommodityCode != c.CommodityCode {
+			return a.CommodityCode < c.CommodityCode
+		}
+		if a.CountryOfOrigin != c.CountryOfOrigin {
+			return a.CountryOfOrigin < c.CountryOfOrigin
+		}
+		return a.Currency < c.Currency
+	})
+	return report, nil
+}
@@ -0,0 +1,156 @@
+package queries
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryIntrastat struct {
+	orders   []*domain.Order
+	receipts []*domain.WarehouseOperation
+	products map[uuid.UUID]*domain.Product
+}
+
+func (m *memoryIntrastat) EachShippedOrder(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Order) error) error {
+	for _, order := range m.orders {
+		if order.TenantID == tenantID && order.ShippedDate != nil && !order.ShippedDate.Before(from) && order.ShippedDate.Before(to) {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryIntrastat) EachCompletedReceipt(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.WarehouseOperation) error) error {
+	for _, receipt := range m.receipts {
+		if receipt.TenantID == tenantID && receipt.CompletedAt != nil && !receipt.CompletedAt.Before(from) && receipt.CompletedAt.Before(to) {
+			if err := fn(receipt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryIntrastat) FindProducts(ctx context.Context, tenantID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]*domain.Product, error) {
+	found := make(map[uuid.UUID]*domain.Product)
+	for _, id := range ids {
+		if product, ok := m.products[id]; ok {
+			found[id] = product
+		}
+	}
+	return found, nil
+}
+
+func customsProduct(code, origin string, netWeight string) *domain.Product {
+	product := &domain.Product{ID: uuid.New(), Currency: "EUR"}
+	if code != "" {
+		product.SetCustomsInfo(code, origin, decimal.RequireFromString(netWeight))
+	}
+	return product
+}
+
+func shippedOrder(tenantID uuid.UUID, country string, day int, lines ...domain.OrderLine) *domain.Order {
+	order, _ := domain.NewOrder(tenantID, uuid.New(), uuid.New(), domain.OrderTypeStandard, domain.OrderSourceWeb, "EUR")
+	order.SetShippingAddress(&domain.Address{Country: country})
+	for _, line := range lines {
+		order.AddLine(line)
+	}
+	order.Ship("TRACK", "dhl")
+	shipped := time.Date(2026, 3, day, 12, 0, 0, 0, time.UTC)
+	order.ShippedDate = &shipped
+	return order
+}
+
+func TestGetIntrastatReport(t *testing.T) {
+	tenantID := uuid.New()
+	bolts := customsProduct("7318 1580", "cn", "0.25")
+	nuts := customsProduct("73181630", "DE", "0.1")
+	unclassified := customsProduct("", "", "")
+
+	source := &memoryIntrastat{products: map[uuid.UUID]*domain.Product{
+		bolts.ID: bolts, nuts.ID: nuts, unclassified.ID: unclassified,
+	}}
+	source.orders = []*domain.Order{
+		shippedOrder(tenantID, "fr", 3,
+			domain.OrderLine{ProductID: bolts.ID, Quantity: 100, UnitPrice: decimal.RequireFromString("1.50")},
+			domain.OrderLine{ProductID: unclassified.ID, Quantity: 1, UnitPrice: decimal.NewFromInt(9)}),
+		shippedOrder(tenantID, "FR", 20,
+			domain.OrderLine{ProductID: bolts.ID, Quantity: 40, UnitPrice: decimal.RequireFromString("1.50")}),
+		shippedOrder(tenantID, "DE", 5, domain.OrderLine{ProductID: nuts.ID, Quantity: 10, UnitPrice: decimal.NewFromInt(1)}),
+		shippedOrder(tenantID, "US", 5, domain.OrderLine{ProductID: nuts.ID, Quantity: 10, UnitPrice: decimal.NewFromInt(1)}),
+		shippedOrder(tenantID, "FR", 31, domain.OrderLine{ProductID: nuts.ID, Quantity: 10, UnitPrice: decimal.NewFromInt(1)}),
+		shippedOrder(tenantID, "IT", 10, domain.OrderLine{ProductID: nuts.ID, Quantity: 10, UnitPrice: decimal.NewFromInt(1)}),
+	}
+	// The last order was shipped on April 1st in Berlin.
+	april := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	source.orders[5].ShippedDate = &april
+
+	receipt, _ := domain.NewWarehouseOperation(tenantID, uuid.New(), uuid.New(), domain.OperationTypeReceipt, "purchase_order", uuid.New())
+	receipt.PartnerCountry = "NL"
+	receipt.AddItem(domain.OperationItem{ProductID: nuts.ID, Quantity: 500, QuantityDone: 400, UnitCost: decimal.RequireFromString("0.20")})
+	receipt.Complete()
+	completed := time.Date(2026, 3, 12, 9, 0, 0, 0, time.UTC)
+	receipt.CompletedAt = &completed
+	source.receipts = []*domain.WarehouseOperation{receipt}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	report, err := GetIntrastatReport(context.Background(), source, &GetIntrastatReportQuery{
+		TenantID:         tenantID,
+		DeclarantCountry: "DE",
+		Period:           "2026-03",
+		Location:         berlin,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, report.Lines, 3)
+	assert.Equal(t, "210", report.Lines[0].Value.String())
+	assert.Equal(t, "FR", report.Lines[0].PartnerCountry, "lower-case countries are matched")
+	assert.Equal(t, "35", report.Lines[0].NetMass.String())
+	assert.Equal(t, 140, report.Lines[0].SupplementaryUnits)
+	assert.Equal(t, 2, report.Lines[0].Movements)
+
+	assert.Equal(t, "FR", report.Lines[1].PartnerCountry)
+	assert.Equal(t, "73181630", report.Lines[1].CommodityCode)
+	assert.Equal(t, 10, report.Lines[1].SupplementaryUnits, "domestic, non-EU and April shipments are left out")
+
+	assert.Equal(t, domain.IntrastatArrival, report.Lines[2].Flow)
+	assert.Equal(t, "NL", report.Lines[2].PartnerCountry)
+	assert.Equal(t, "40", report.Lines[2].NetMass.String())
+	assert.Equal(t, "80", report.Lines[2].Value.String())
+
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, "product has no commodity code", report.Issues[0].Problem)
+
+	arrivals, err := GetIntrastatReport(context.Background(), source, &GetIntrastatReportQuery{
+		TenantID:         tenantID,
+		DeclarantCountry: "DE",
+		Period:           "2026-03",
+		Flow:             "arrival",
+		Location:         berlin,
+	})
+	require.NoError(t, err)
+	require.Len(t, arrivals.Lines, 1)
+	assert.Empty(t, arrivals.Issues)
+}
+
+func TestGetIntrastatReport_Invalid(t *testing.T) {
+	source := &memoryIntrastat{}
+	_, err := GetIntrastatReport(context.Background(), source, &GetIntrastatReportQuery{Period: "2026-03"})
+	assert.EqualError(t, err, "no EU declarant country is configured for Intrastat")
+
+	_, err = GetIntrastatReport(context.Background(), source, &GetIntrastatReportQuery{DeclarantCountry: "DE", Period: "March"})
+	assert.EqualError(t, err, "period must be a month such as 2026-03")
+
+	_, err = GetIntrastatReport(context.Background(), source, &GetIntrastatReportQuery{DeclarantCountry: "DE", Period: "2026-03", Flow: "export"})
+	assert.EqualError(t, err, "flow must be dispatch or arrival")
+}
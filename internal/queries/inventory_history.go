@@ -0,0 +1,244 @@
+package queries
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+)
+
+// InventoryTransactionSource streams a product's stock movements oldest
+// first. repository.InventoryTransactionStore implements it.
+type InventoryTransactionSource interface {
+	Each(ctx context.Context, filter repository.InventoryTransactionFilter, fn func(repository.InventoryTransactionRecord) error) error
+}
+
+// GetProductHistoryQuery selects the ledger of one product. WarehouseID and
+// LocationID narrow it to one place; MovementTypes and From hide entries
+// without changing the balances, which always count every earlier movement.
+// To is exclusive.
+type GetProductHistoryQuery struct {
+	TenantID      string
+	ProductID     string
+	WarehouseID   string
+	LocationID    string
+	MovementTypes []string
+	From          *time.Time
+	To            *time.Time
+	Page          int
+	PageSize      int
+}
+
+// LedgerEntry is a stock movement with the balances it left behind. Change
+// is the signed effect on the stock on hand; Balance is the running stock at
+// the entry's warehouse and location, WarehouseBalance that of the whole
+// warehouse.
+type LedgerEntry struct {
+	TransactionID    string    `json:"transactionId"`
+	CreatedAt        time.Time `json:"createdAt"`
+	MovementType     string    `json:"movementType"`
+	WarehouseID      string    `json:"warehouseId"`
+	LocationID       string    `json:"locationId,omitempty"`
+	Quantity         int       `json:"quantity"`
+	Change           int       `json:"change"`
+	Balance          int       `json:"balance"`
+	WarehouseBalance int       `json:"warehouseBalance"`
+	ReferenceType    string    `json:"referenceType,omitempty"`
+	ReferenceID      string    `json:"referenceId,omitempty"`
+	LotNumber        string    `json:"lotNumber,omitempty"`
+	SerialNumber     string    `json:"serialNumber,omitempty"`
+	Reason           string    `json:"reason,omitempty"`
+	PerformedBy      string    `json:"performedBy,omitempty"`
+}
+
+// LocationBalance is the stock of a product at a warehouse location; an
+// empty LocationID is stock not booked to a location.
+type LocationBalance struct {
+	WarehouseID string `json:"warehouseId"`
+	LocationID  string `json:"locationId,omitempty"`
+	Quantity    int    `json:"quantity"`
+}
+
+type ProductHistory struct {
+	ProductID  string            `json:"productId"`
+	From       *time.Time        `json:"from,omitempty"`
+	To         *time.Time        `json:"to,omitempty"`
+	Opening    []LocationBalance `json:"opening"`
+	Closing    []LocationBalance `json:"closing"`
+	Entries    []LedgerEntry     `json:"entries"`
+	Total      int               `json:"total"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"pageSize"`
+	TotalPages int               `json:"totalPages"`
+}
+
+type ledgerKey struct {
+	warehouseID string
+	locationID  string
+}
+
+// Ledger keeps running stock balances of one product per warehouse and
+// location as movements are posted in order.
+type Ledger struct {
+	locations  map[ledgerKey]int
+	warehouses map[string]int
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{locations: make(map[ledgerKey]int), warehouses: make(map[string]int)}
+}
+
+// Post applies record and returns it as a ledger entry. Stock arriving is
+// booked to ToLocationID and stock leaving to FromLocationID, each falling
+// back to the other when only one is set.
+func (l *Ledger) Post(record repository.InventoryTransactionRecord) LedgerEntry {
+	change := domain.MovementType(record.MovementType).OnHandDelta(record.Quantity)
+	location := record.ToLocationID
+	if change < 0 || location == "" {
+		location = record.FromLocationID
+	}
+	if location == "" {
+		location = record.ToLocationID
+	}
+
+	key := ledgerKey{warehouseID: record.WarehouseID, locationID: location}
+	l.locations[key] += change
+	l.warehouses[record.WarehouseID] += change
+
+	return LedgerEntry{
+		TransactionID:    record.ID,
+		CreatedAt:        record.CreatedAt,
+		MovementType:     record.MovementType,
+		WarehouseID:      record.WarehouseID,
+		LocationID:       location,
+		Quantity:         record.Quantity,
+		Change:           change,
+		Balance:          l.locations[key],
+		WarehouseBalance: l.warehouses[record.WarehouseID],
+		ReferenceType:    record.ReferenceType,
+		ReferenceID:      record.ReferenceID,
+		LotNumber:        record.LotNumber,
+		SerialNumber:     record.SerialNumber,
+		Reason:           record.Reason,
+		PerformedBy:      record.PerformedBy,
+	}
+}
+
+// Balances returns the balances of every place the product has been, or
+// only of locationID when it is set, ordered by warehouse and location.
+func (l *Ledger) Balances(locationID string) []LocationBalance {
+	balances := make([]LocationBalance, 0, len(l.locations))
+	for key, quantity := range l.locations {
+		if locationID != "" && key.locationID != locationID {
+			continue
+		}
+		balances = append(balances, LocationBalance{WarehouseID: key.warehouseID, LocationID: key.locationID, Quantity: quantity})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].WarehouseID != balances[j].WarehouseID {
+			return balances[i].WarehouseID < balances[j].WarehouseID
+		}
+		return balances[i].LocationID < balances[j].LocationID
+	})
+	return balances
+}
+
+func validateProductHistoryQuery(query *GetProductHistoryQuery) error {
+	if query.ProductID == "" {
+		return errors.InvalidArgument("productId is required")
+	}
+	for _, movementType := range query.MovementTypes {
+		if !domain.MovementType(movementType).IsValid() {
+			return errors.InvalidArgument("unknown movement type: %s", movementType)
+		}
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return errors.InvalidArgument("startDate must be before endDate")
+	}
+	return nil
+}
+
+// EachProductHistoryEntry posts the product's movements up to query.To to a
+// ledger and calls fn with the entries query selects, oldest first. It
+// returns the balances at query.From and the ledger, whose balances are
+// those at query.To.
+func EachProductHistoryEntry(ctx context.Context, source InventoryTransactionSource, query *GetProductHistoryQuery, fn func(LedgerEntry) error) (opening []LocationBalance, ledger *Ledger, err error) {
+	if err := validateProductHistoryQuery(query); err != nil {
+		return nil, nil, err
+	}
+	types := make(map[string]bool, len(query.MovementTypes))
+	for _, movementType := range query.MovementTypes {
+		types[movementType] = true
+	}
+
+	ledger = NewLedger()
+	err = source.Each(ctx, repository.InventoryTransactionFilter{
+		TenantID:    query.TenantID,
+		ProductID:   query.ProductID,
+		WarehouseID: query.WarehouseID,
+		Before:      query.To,
+	}, func(record repository.InventoryTransactionRecord) error {
+		inPeriod := query.From == nil || !record.CreatedAt.Before(*query.From)
+		if inPeriod && opening == nil {
+			opening = ledger.Balances(query.LocationID)
+		}
+		entry := ledger.Post(record)
+		if !inPeriod || (len(types) > 0 && !types[entry.MovementType]) {
+			return nil
+		}
+		if query.LocationID != "" && entry.LocationID != query.LocationID {
+			return nil
+		}
+		return fn(entry)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if opening == nil {
+		opening = ledger.Balances(query.LocationID)
+	}
+	return opening, ledger, nil
+}
+
+// GetProductHistory returns one page of a product's ledger with the opening
+// balances at query.From and the closing balances at query.To.
+func GetProductHistory(ctx context.Context, source InventoryTransactionSource, query *GetProductHistoryQuery) (*ProductHistory, error) {
+	pageSize := query.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	if pageSize > 1000 {
+		pageSize = 1000
+	}
+	page := query.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	history := &ProductHistory{
+		ProductID: query.ProductID,
+		From:      query.From,
+		To:        query.To,
+		Entries:   []LedgerEntry{},
+		Page:      page,
+		PageSize:  pageSize,
+	}
+	skip := (page - 1) * pageSize
+	opening, ledger, err := EachProductHistoryEntry(ctx, source, query, func(entry LedgerEntry) error {
+		history.Total++
+		if history.Total > skip && len(history.Entries) < pageSize {
+			history.Entries = append(history.Entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	history.Opening = opening
+	history.Closing = ledger.Balances(query.LocationID)
+	history.TotalPages = (history.Total + pageSize - 1) / pageSize
+	return history, nil
+}
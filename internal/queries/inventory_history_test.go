@@ -0,0 +1,122 @@
+package queries
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryTransactions []repository.InventoryTransactionRecord
+
+func (m memoryTransactions) Each(ctx context.Context, filter repository.InventoryTransactionFilter, fn func(repository.InventoryTransactionRecord) error) error {
+	for _, record := range m {
+		if record.ProductID != filter.ProductID ||
+			(filter.WarehouseID != "" && record.WarehouseID != filter.WarehouseID) ||
+			(filter.Before != nil && !record.CreatedAt.Before(*filter.Before)) {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func movement(id string, day int, movementType, warehouse, from, to string, quantity int) repository.InventoryTransactionRecord {
+	return repository.InventoryTransactionRecord{
+		ID:             id,
+		ProductID:      "product-1",
+		WarehouseID:    warehouse,
+		FromLocationID: from,
+		ToLocationID:   to,
+		MovementType:   movementType,
+		Quantity:       quantity,
+		CreatedAt:      time.Date(2026, 3, day, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+var productMovements = memoryTransactions{
+	movement("t1", 1, "receipt", "wh-1", "", "A1", 100),
+	movement("t2", 2, "reservation", "wh-1", "", "A1", 30),
+	movement("t3", 3, "shipment", "wh-1", "A1", "", 30),
+	movement("t4", 4, "transfer_out", "wh-1", "A1", "B2", 20),
+	movement("t5", 4, "transfer_in", "wh-1", "A1", "B2", 20),
+	movement("t6", 5, "adjustment", "wh-1", "B2", "", -2),
+	movement("t7", 6, "receipt", "wh-2", "", "", 10),
+}
+
+func TestLedger_Post(t *testing.T) {
+	ledger := NewLedger()
+	var entries []LedgerEntry
+	for _, record := range productMovements {
+		entries = append(entries, ledger.Post(record))
+	}
+
+	assert.Equal(t, 100, entries[0].Balance)
+	assert.Equal(t, 0, entries[1].Change, "reservations do not change the stock on hand")
+	assert.Equal(t, 70, entries[2].Balance)
+	assert.Equal(t, "A1", entries[3].LocationID)
+	assert.Equal(t, 50, entries[3].Balance)
+	assert.Equal(t, "B2", entries[4].LocationID)
+	assert.Equal(t, 20, entries[4].Balance)
+	assert.Equal(t, 70, entries[4].WarehouseBalance, "a transfer within a warehouse keeps its total")
+	assert.Equal(t, 18, entries[5].Balance)
+	assert.Equal(t, 10, entries[6].WarehouseBalance)
+
+	assert.Equal(t, []LocationBalance{
+		{WarehouseID: "wh-1", LocationID: "A1", Quantity: 50},
+		{WarehouseID: "wh-1", LocationID: "B2", Quantity: 18},
+		{WarehouseID: "wh-2", Quantity: 10},
+	}, ledger.Balances(""))
+}
+
+func TestGetProductHistory_Filters(t *testing.T) {
+	from := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)
+
+	history, err := GetProductHistory(context.Background(), productMovements, &GetProductHistoryQuery{
+		ProductID:     "product-1",
+		WarehouseID:   "wh-1",
+		MovementTypes: []string{"transfer_in", "adjustment"},
+		From:          &from,
+		To:            &to,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []LocationBalance{{WarehouseID: "wh-1", LocationID: "A1", Quantity: 100}}, history.Opening)
+	require.Equal(t, 2, history.Total)
+	assert.Equal(t, "t5", history.Entries[0].TransactionID)
+	assert.Equal(t, 20, history.Entries[0].Balance, "hidden movements still count towards the balance")
+	assert.Equal(t, 18, history.Entries[1].Balance)
+	assert.Equal(t, []LocationBalance{
+		{WarehouseID: "wh-1", LocationID: "A1", Quantity: 50},
+		{WarehouseID: "wh-1", LocationID: "B2", Quantity: 18},
+	}, history.Closing)
+}
+
+func TestGetProductHistory_Pages(t *testing.T) {
+	history, err := GetProductHistory(context.Background(), productMovements, &GetProductHistoryQuery{
+		ProductID: "product-1",
+		Page:      2,
+		PageSize:  3,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, history.Total)
+	assert.Equal(t, 3, history.TotalPages)
+	require.Len(t, history.Entries, 3)
+	assert.Equal(t, "t4", history.Entries[0].TransactionID)
+	assert.Empty(t, history.Opening)
+}
+
+func TestGetProductHistory_Invalid(t *testing.T) {
+	_, err := GetProductHistory(context.Background(), productMovements, &GetProductHistoryQuery{
+		ProductID:     "product-1",
+		MovementTypes: []string{"teleport"},
+	})
+	assert.EqualError(t, err, "unknown movement type: teleport")
+}
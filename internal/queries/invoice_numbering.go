@@ -0,0 +1,152 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/numbering"
+	"github.com/ims-erp/system/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// documentInvoice is the document type of invoice numbers in numbering
+// audits. Credit and debit notes are numbered in the same sequence.
+const documentInvoice = "invoice"
+
+// invoiceNumberPattern matches the numbers the invoice counters hand out,
+// INV-{year}-{sequence}.
+var invoiceNumberPattern = regexp.MustCompile(`^INV-(\d{4})-(\d+)$`)
+
+// InvoiceSequences reads how far a tenant's invoice numbers have been
+// drawn in a year. repository.MongoInvoiceCounter implements it.
+type InvoiceSequences interface {
+	GetCurrentSequence(ctx context.Context, tenantID uuid.UUID, year int) (int64, error)
+}
+
+// WithInvoiceSequences lets numbering audits count the numbers drawn after
+// the last invoice issued as missing.
+func (h *InvoiceQueryHandler) WithInvoiceSequences(sequences InvoiceSequences) *InvoiceQueryHandler {
+	h.sequences = sequences
+	return h
+}
+
+// GetNumberingAuditQuery audits the tenant's invoice numbers of Year, or
+// of every year when 0.
+type GetNumberingAuditQuery struct {
+	TenantID string
+	Year     int
+}
+
+// NumberingAudit is the numbering audit of a tenant's invoices, one
+// sequence per year. Irregular lists the invoices whose number is not of
+// any sequence.
+type NumberingAudit struct {
+	TenantID    string                    `json:"tenantId"`
+	Sequences   []numbering.SequenceAudit `json:"sequences"`
+	Irregular   []numbering.Issued        `json:"irregular"`
+	GeneratedAt time.Time                 `json:"generatedAt"`
+}
+
+// GetNumberingAudit checks the tenant's invoice numbers for gaps and lists
+// the voided invoices, with who voided them and why. It reads every
+// invoice of the tenant regardless of the caller's visibility, since a
+// partial view would show gaps that are not there.
+func (h *InvoiceQueryHandler) GetNumberingAudit(ctx context.Context, query *GetNumberingAuditQuery) (*NumberingAudit, error) {
+	ctx, span := h.tracer.Start(ctx, "query.get_numbering_audit",
+		trace.WithAttributes(
+			attribute.String("tenant_id", query.TenantID),
+			attribute.Int("year", query.Year),
+		),
+	)
+	defer span.End()
+
+	tenantID, err := uuid.Parse(query.TenantID)
+	if err != nil {
+		return nil, errors.InvalidArgument("invalid tenant ID")
+	}
+
+	filter := map[string]interface{}{"tenantId": query.TenantID}
+	if query.Year != 0 {
+		filter["invoiceNumber"] = map[string]interface{}{"$regex": fmt.Sprintf("^INV-%d-", query.Year)}
+	}
+	results, err := h.readModelStore.Find(ctx, filter, options.Find().SetProjection(map[string]interface{}{
+		"invoiceNumber": 1, "type": 1, "status": 1, "issueDate": 1, "activityLog": 1,
+	}))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to audit invoice numbers: %w", err)
+	}
+
+	audit := &NumberingAudit{TenantID: query.TenantID, Irregular: []numbering.Issued{}, GeneratedAt: time.Now().UTC()}
+	var issued []numbering.Issued
+	years := make(map[int]bool)
+	if query.Year != 0 {
+		years[query.Year] = true
+	}
+	for _, invoice := range decodeReadModels[events.InvoiceDetail](results) {
+		number, ok := issuedInvoice(tenantID, invoice)
+		if !ok {
+			audit.Irregular = append(audit.Irregular, number)
+			continue
+		}
+		issued = append(issued, number)
+		years[number.Key.Year] = true
+	}
+
+	drawn := make(map[numbering.Key]int64)
+	if h.sequences != nil {
+		for year := range years {
+			sequence, err := h.sequences.GetCurrentSequence(ctx, tenantID, year)
+			if err != nil {
+				span.RecordError(err)
+				return nil, fmt.Errorf("failed to audit invoice numbers: %w", err)
+			}
+			drawn[numbering.Key{TenantID: tenantID, DocumentType: documentInvoice, Year: year}] = sequence
+		}
+	}
+
+	audit.Sequences = numbering.Audit(issued, drawn, func(key numbering.Key, sequence int64) string {
+		return fmt.Sprintf("INV-%d-%06d", key.Year, sequence)
+	})
+	return audit, nil
+}
+
+// issuedInvoice returns the number invoice was issued under, and whether
+// it is of the invoice sequence of its year.
+func issuedInvoice(tenantID uuid.UUID, invoice events.InvoiceDetail) (numbering.Issued, bool) {
+	number := numbering.Issued{
+		Key:        numbering.Key{TenantID: tenantID, DocumentType: documentInvoice},
+		Number:     invoice.InvoiceNumber,
+		DocumentID: invoice.ID,
+		Kind:       invoice.Type,
+		IssuedAt:   invoice.IssueDate,
+	}
+	if invoice.Status == string(domain.InvoiceStatusCancelled) {
+		number.Voided = &numbering.Void{}
+		for _, activity := range invoice.ActivityLog {
+			if activity.Action == "voided" {
+				number.Voided = &numbering.Void{UserID: activity.UserID, Reason: activity.Details, At: activity.Timestamp}
+			}
+		}
+	}
+
+	match := invoiceNumberPattern.FindStringSubmatch(invoice.InvoiceNumber)
+	if match == nil {
+		return number, false
+	}
+	number.Key.Year, _ = strconv.Atoi(match[1])
+	sequence, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil || sequence < 1 {
+		return number, false
+	}
+	number.Sequence = sequence
+	return number, true
+}
@@ -0,0 +1,45 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssuedInvoice(t *testing.T) {
+	tenantID := uuid.New()
+	voidedAt := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+
+	number, ok := issuedInvoice(tenantID, events.InvoiceDetail{
+		ID:            "inv-1",
+		InvoiceNumber: "INV-2026-000042",
+		Type:          "credit_note",
+		Status:        "cancelled",
+		ActivityLog: []events.InvoiceActivity{
+			{Action: "created", UserID: "user-1"},
+			{Action: "voided", UserID: "user-2", Details: "Duplicate of INV-2026-000041", Timestamp: voidedAt},
+		},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, 2026, number.Key.Year)
+	assert.Equal(t, documentInvoice, number.Key.DocumentType)
+	assert.Equal(t, int64(42), number.Sequence)
+	assert.Equal(t, "credit_note", number.Kind)
+	if assert.NotNil(t, number.Voided) {
+		assert.Equal(t, "user-2", number.Voided.UserID)
+		assert.Equal(t, "Duplicate of INV-2026-000041", number.Voided.Reason)
+		assert.Equal(t, voidedAt, number.Voided.At)
+	}
+
+	number, ok = issuedInvoice(tenantID, events.InvoiceDetail{ID: "inv-2", InvoiceNumber: "INV-2026-000043", Status: "paid"})
+	assert.True(t, ok)
+	assert.Nil(t, number.Voided)
+
+	for _, irregular := range []string{"", "2026-17", "INV-2026-000000", "INV-26-000001"} {
+		_, ok := issuedInvoice(tenantID, events.InvoiceDetail{ID: "inv-3", InvoiceNumber: irregular})
+		assert.False(t, ok, irregular)
+	}
+}
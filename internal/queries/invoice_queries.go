@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ims-erp/system/internal/domain"
 	"github.com/ims-erp/system/internal/events"
 	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/fieldset"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/pagination"
+	"github.com/ims-erp/system/pkg/timezone"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -20,6 +24,7 @@ type InvoiceQueryHandler struct {
 	cache          *repository.Cache
 	logger         *logger.Logger
 	tracer         trace.Tracer
+	sequences      InvoiceSequences
 }
 
 func NewInvoiceQueryHandler(
@@ -35,41 +40,59 @@ func NewInvoiceQueryHandler(
 	}
 }
 
+// InvoiceFields are the fields invoice views can be narrowed to.
+var InvoiceFields = fieldset.Of(events.InvoiceSummary{})
+
 type GetInvoiceByIDQuery struct {
-	InvoiceID string
-	TenantID  string
+	InvoiceID  string
+	TenantID   string
+	Fields     fieldset.Set
+	Visibility domain.Visibility
 }
 
 type ListInvoicesQuery struct {
-	TenantID  string
-	ClientID  string
-	Page      int
-	PageSize  int
-	Search    string
-	Status    string
-	Type      string
-	StartDate time.Time
-	EndDate   time.Time
-	SortBy    string
-	SortOrder string
+	TenantID   string
+	ClientID   string
+	Page       int
+	PageSize   int
+	Cursor     string
+	Search     string
+	Status     string
+	Type       string
+	StartDate  time.Time
+	EndDate    time.Time
+	SortBy     string
+	SortOrder  string
+	Fields     fieldset.Set
+	Visibility domain.Visibility
 }
 
 type SearchInvoicesQuery struct {
-	TenantID string
-	Term     string
-	Limit    int
+	TenantID   string
+	Term       string
+	Limit      int
+	Visibility domain.Visibility
 }
 
+// GetOverdueInvoicesQuery lists the open invoices due before today in
+// Location, UTC when nil.
 type GetOverdueInvoicesQuery struct {
-	TenantID string
-	Page     int
-	PageSize int
+	TenantID   string
+	Page       int
+	PageSize   int
+	Location   *time.Location
+	Visibility domain.Visibility
 }
 
+// GetInvoiceStatsQuery counts the invoices issued from StartDate up to, but
+// not including, EndDate; invoices are overdue once their due date is
+// before today in Location, UTC when nil.
 type GetInvoiceStatsQuery struct {
-	TenantID  string
-	StartDate time.Time
-	EndDate   time.Time
+	TenantID   string
+	StartDate  time.Time
+	EndDate    time.Time
+	Location   *time.Location
+	Visibility domain.Visibility
 }
 
 type ListInvoicesResult struct {
@@ -78,6 +101,7 @@ type ListInvoicesResult struct {
 	Page       int                     `json:"page"`
 	PageSize   int                     `json:"pageSize"`
 	TotalPages int                     `json:"totalPages"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
 }
 
 type InvoiceStats struct {
@@ -104,18 +128,21 @@ func (h *InvoiceQueryHandler) GetInvoiceByID(ctx context.Context, query *GetInvo
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("invoice:summary:%s", query.InvoiceID)
-	if cached, err := h.cache.Get(ctx, cacheKey); err == nil && cached != "" {
+	cacheKey := fmt.Sprintf("invoice:summary:%s%s%s", query.InvoiceID, query.Fields.CacheKey(), visibilityKey(query.Visibility))
+	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
-		return nil, nil
+		var invoice events.InvoiceSummary
+		if err := json.Unmarshal(cached, &invoice); err == nil {
+			return &invoice, nil
+		}
 	}
 
-	filter := map[string]interface{}{
+	filter := restrict(map[string]interface{}{
 		"_id":      query.InvoiceID,
 		"tenantId": query.TenantID,
-	}
+	}, query.Visibility)
 
-	result, err := h.readModelStore.FindOne(ctx, filter)
+	result, err := h.readModelStore.FindOne(ctx, filter, options.FindOne().SetProjection(query.Fields.Projection("version")))
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to get invoice: %w", err)
@@ -125,16 +152,48 @@ func (h *InvoiceQueryHandler) GetInvoiceByID(ctx context.Context, query *GetInvo
 		return nil, nil
 	}
 
-	invoice, ok := result.(events.InvoiceSummary)
-	if !ok {
+	decoded := decodeReadModels[events.InvoiceSummary]([]interface{}{result})
+	if len(decoded) == 0 {
 		return nil, fmt.Errorf("invalid invoice data")
 	}
+	invoice := decoded[0]
 
 	h.cache.Set(ctx, cacheKey, invoice, 5*time.Minute)
 
 	return &invoice, nil
 }
 
+// GetInvoiceDetail returns the invoice with its lines, as needed to render
+// the invoice document, or nil if there is no such invoice. Fields are
+// ignored.
+func (h *InvoiceQueryHandler) GetInvoiceDetail(ctx context.Context, query *GetInvoiceByIDQuery) (*events.InvoiceDetail, error) {
+	ctx, span := h.tracer.Start(ctx, "query.get_invoice_detail",
+		trace.WithAttributes(
+			attribute.String("invoice_id", query.InvoiceID),
+			attribute.String("tenant_id", query.TenantID),
+		),
+	)
+	defer span.End()
+
+	result, err := h.readModelStore.FindOne(ctx, restrict(map[string]interface{}{
+		"_id":      query.InvoiceID,
+		"tenantId": query.TenantID,
+	}, query.Visibility))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+	if result == nil {
+		return nil, nil
+	}
+
+	decoded := decodeReadModels[events.InvoiceDetail]([]interface{}{result})
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("invalid invoice data")
+	}
+	return &decoded[0], nil
+}
+
 func (h *InvoiceQueryHandler) ListInvoices(ctx context.Context, query *ListInvoicesQuery) (*ListInvoicesResult, error) {
 	ctx, span := h.tracer.Start(ctx, "query.list_invoices",
 		trace.WithAttributes(
@@ -145,8 +204,9 @@ func (h *InvoiceQueryHandler) ListInvoices(ctx context.Context, query *ListInvoi
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("invoice:list:%s:%s:%d:%d:%s:%s:%s",
-		query.TenantID, query.ClientID, query.Page, query.PageSize, query.Search, query.Status, query.Type)
+	cacheKey := fmt.Sprintf("invoice:list:%s:%s:%d:%d:%s:%s:%s:%s:%s:%s%s%s",
+		query.TenantID, query.ClientID, query.Page, query.PageSize, query.Search, query.Status, query.Type,
+		query.SortBy, query.SortOrder, query.Cursor, query.Fields.CacheKey(), visibilityKey(query.Visibility))
 	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
 		var result ListInvoicesResult
@@ -181,10 +241,12 @@ func (h *InvoiceQueryHandler) ListInvoices(ctx context.Context, query *ListInvoi
 	if !query.StartDate.IsZero() && !query.EndDate.IsZero() {
 		filter["issueDate"] = map[string]interface{}{
 			"$gte": query.StartDate,
-			"$lte": query.EndDate,
+			"$lt":  query.EndDate,
 		}
 	}
 
+	restrict(filter, query.Visibility)
+
 	total, err := h.readModelStore.Count(ctx, filter)
 	if err != nil {
 		span.RecordError(err)
@@ -195,17 +257,24 @@ func (h *InvoiceQueryHandler) ListInvoices(ctx context.Context, query *ListInvoi
 	if pageSize <= 0 {
 		pageSize = 20
 	}
-	skip := (query.Page - 1) * pageSize
 
 	sortBy := query.SortBy
 	if sortBy == "" {
 		sortBy = "issueDate"
 	}
 
+	sort := pagination.NewSort(sortBy, query.SortOrder)
 	findOpts := options.Find().
-		SetSkip(int64(skip)).
-		SetLimit(int64(pageSize)).
-		SetSort(map[string]int{sortBy: getSortOrder(query.SortOrder)})
+		SetLimit(int64(pageSize + 1)).
+		SetSort(sort.Keys()).
+		SetProjection(query.Fields.Projection(sort.Field))
+	if query.Cursor != "" {
+		if err := sort.After(filter, query.Cursor); err != nil {
+			return nil, err
+		}
+	} else {
+		findOpts.SetSkip(int64((query.Page - 1) * pageSize))
+	}
 
 	results, err := h.readModelStore.Find(ctx, filter, findOpts)
 	if err != nil {
@@ -213,12 +282,9 @@ func (h *InvoiceQueryHandler) ListInvoices(ctx context.Context, query *ListInvoi
 		return nil, fmt.Errorf("failed to list invoices: %w", err)
 	}
 
-	invoices := make([]events.InvoiceSummary, 0, len(results))
-	for _, r := range results {
-		if invoice, ok := r.(events.InvoiceSummary); ok {
-			invoices = append(invoices, invoice)
-		}
-	}
+	results, nextCursor := sort.Page(results, pageSize)
+
+	invoices := decodeReadModels[events.InvoiceSummary](results)
 
 	totalPages := int(total) / pageSize
 	if int(total)%pageSize > 0 {
@@ -231,6 +297,7 @@ func (h *InvoiceQueryHandler) ListInvoices(ctx context.Context, query *ListInvoi
 		Page:       query.Page,
 		PageSize:   pageSize,
 		TotalPages: totalPages,
+		NextCursor: nextCursor,
 	}
 
 	if data, err := json.Marshal(result); err == nil {
@@ -262,6 +329,7 @@ func (h *InvoiceQueryHandler) SearchInvoices(ctx context.Context, query *SearchI
 			{"notes": map[string]interface{}{"$regex": query.Term, "$options": "i"}},
 		},
 	}
+	restrict(filter, query.Visibility)
 
 	findOpts := options.Find().
 		SetLimit(int64(limit)).
@@ -273,12 +341,7 @@ func (h *InvoiceQueryHandler) SearchInvoices(ctx context.Context, query *SearchI
 		return nil, fmt.Errorf("failed to search invoices: %w", err)
 	}
 
-	invoices := make([]events.InvoiceSummary, 0, len(results))
-	for _, r := range results {
-		if invoice, ok := r.(events.InvoiceSummary); ok {
-			invoices = append(invoices, invoice)
-		}
-	}
+	invoices := decodeReadModels[events.InvoiceSummary](results)
 
 	return invoices, nil
 }
@@ -291,13 +354,11 @@ func (h *InvoiceQueryHandler) GetOverdueInvoices(ctx context.Context, query *Get
 	)
 	defer span.End()
 
-	now := time.Now().UTC()
-
-	filter := map[string]interface{}{
+	filter := restrict(map[string]interface{}{
 		"tenantId": query.TenantID,
 		"status":   map[string]interface{}{"$in": []string{"pending", "sent", "partial"}},
-		"dueDate":  map[string]interface{}{"$lt": now},
-	}
+		"dueDate":  map[string]interface{}{"$lt": today(query.Location)},
+	}, query.Visibility)
 
 	total, err := h.readModelStore.Count(ctx, filter)
 	if err != nil {
@@ -322,12 +383,7 @@ func (h *InvoiceQueryHandler) GetOverdueInvoices(ctx context.Context, query *Get
 		return nil, fmt.Errorf("failed to get overdue invoices: %w", err)
 	}
 
-	invoices := make([]events.InvoiceSummary, 0, len(results))
-	for _, r := range results {
-		if invoice, ok := r.(events.InvoiceSummary); ok {
-			invoices = append(invoices, invoice)
-		}
-	}
+	invoices := decodeReadModels[events.InvoiceSummary](results)
 
 	totalPages := int(total) / pageSize
 	if int(total)%pageSize > 0 {
@@ -351,7 +407,7 @@ func (h *InvoiceQueryHandler) GetInvoiceStats(ctx context.Context, query *GetInv
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("invoice:stats:%s", query.TenantID)
+	cacheKey := fmt.Sprintf("invoice:stats:%s:%d:%d:%s%s", query.TenantID, query.StartDate.Unix(), query.EndDate.Unix(), query.Location, visibilityKey(query.Visibility))
 	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
 		var stats InvoiceStats
@@ -367,9 +423,10 @@ func (h *InvoiceQueryHandler) GetInvoiceStats(ctx context.Context, query *GetInv
 	if !query.StartDate.IsZero() && !query.EndDate.IsZero() {
 		filter["issueDate"] = map[string]interface{}{
 			"$gte": query.StartDate,
-			"$lte": query.EndDate,
+			"$lt":  query.EndDate,
 		}
 	}
+	restrict(filter, query.Visibility)
 
 	totalCount, err := h.readModelStore.Count(ctx, filter)
 	if err != nil {
@@ -377,24 +434,23 @@ func (h *InvoiceQueryHandler) GetInvoiceStats(ctx context.Context, query *GetInv
 		return nil, fmt.Errorf("failed to get invoice stats: %w", err)
 	}
 
-	pendingFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "pending"}
+	pendingFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "pending"}, query.Visibility)
 	pendingCount, _ := h.readModelStore.Count(ctx, pendingFilter)
 
-	sentFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "sent"}
+	sentFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "sent"}, query.Visibility)
 	sentCount, _ := h.readModelStore.Count(ctx, sentFilter)
 
-	paidFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "paid"}
+	paidFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "paid"}, query.Visibility)
 	paidCount, _ := h.readModelStore.Count(ctx, paidFilter)
 
-	now := time.Now().UTC()
-	overdueFilter := map[string]interface{}{
+	overdueFilter := restrict(map[string]interface{}{
 		"tenantId": query.TenantID,
 		"status":   map[string]interface{}{"$in": []string{"pending", "sent", "partial"}},
-		"dueDate":  map[string]interface{}{"$lt": now},
-	}
+		"dueDate":  map[string]interface{}{"$lt": today(query.Location)},
+	}, query.Visibility)
 	overdueCount, _ := h.readModelStore.Count(ctx, overdueFilter)
 
-	cancelledFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "cancelled"}
+	cancelledFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "cancelled"}, query.Visibility)
 	cancelledCount, _ := h.readModelStore.Count(ctx, cancelledFilter)
 
 	stats := &InvoiceStats{
@@ -418,3 +474,12 @@ func (h *InvoiceQueryHandler) GetInvoiceStats(ctx context.Context, query *GetInv
 
 	return stats, nil
 }
+
+// today returns today's date in loc, UTC when nil, in the form due dates are
+// stored in, so that an invoice due today is not yet overdue.
+func today(loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return timezone.Date(time.Now(), loc)
+}
@@ -0,0 +1,162 @@
+package queries
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// MarginSource loads what a margin preview is costed from.
+// repository.MarginStore implements it.
+type MarginSource interface {
+	FindProducts(ctx context.Context, tenantID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]*domain.Product, error)
+	// FindCostLayers returns the tenant's inventory items of the products,
+	// only those in warehouseID unless it is uuid.Nil.
+	FindCostLayers(ctx context.Context, tenantID uuid.UUID, productIDs []uuid.UUID, warehouseID uuid.UUID) ([]*domain.InventoryItem, error)
+}
+
+// MarginPreviewLine is a prospective order line. Discount is on the whole
+// line.
+type MarginPreviewLine struct {
+	ProductID uuid.UUID
+	Quantity  int
+	UnitPrice decimal.Decimal
+	Discount  decimal.Decimal
+}
+
+// GetMarginPreviewQuery prices Lines in Currency against the stock in
+// WarehouseID, or in all of the tenant's warehouses when it is uuid.Nil.
+type GetMarginPreviewQuery struct {
+	TenantID    uuid.UUID
+	WarehouseID uuid.UUID
+	Currency    string
+	Lines       []MarginPreviewLine
+}
+
+// LineMargin is the expected margin of one line. UncostedQuantity counts
+// the units the stock does not cover, costed at the product's cost price.
+type LineMargin struct {
+	ProductID        string          `json:"productId"`
+	SKU              string          `json:"sku"`
+	Name             string          `json:"name"`
+	Quantity         int             `json:"quantity"`
+	NetUnitPrice     decimal.Decimal `json:"netUnitPrice"`
+	Revenue          decimal.Decimal `json:"revenue"`
+	ExpectedUnitCost decimal.Decimal `json:"expectedUnitCost"`
+	ExpectedCost     decimal.Decimal `json:"expectedCost"`
+	Margin           decimal.Decimal `json:"margin"`
+	MarginPercent    decimal.Decimal `json:"marginPercent"`
+	FloorPrice       decimal.Decimal `json:"floorPrice"`
+	BelowFloor       bool            `json:"belowFloor"`
+	UncostedQuantity int             `json:"uncostedQuantity"`
+}
+
+// MarginPreview is the expected margin of an order before it is entered.
+// MarginPercent is the margin as a percentage of revenue. Lines below their
+// floor would need an approved price override.
+type MarginPreview struct {
+	Currency      string          `json:"currency"`
+	Revenue       decimal.Decimal `json:"revenue"`
+	ExpectedCost  decimal.Decimal `json:"expectedCost"`
+	Margin        decimal.Decimal `json:"margin"`
+	MarginPercent decimal.Decimal `json:"marginPercent"`
+	BelowFloor    int             `json:"belowFloor"`
+	Lines         []LineMargin    `json:"lines"`
+}
+
+// marginPercent is margin as a percentage of revenue, or zero without any.
+func marginPercent(margin, revenue decimal.Decimal) decimal.Decimal {
+	if !revenue.IsPositive() {
+		return decimal.Zero
+	}
+	return margin.Div(revenue).Mul(decimal.NewFromInt(100)).Round(2)
+}
+
+// GetMarginPreview costs each line from the cost layers of the stock first
+// in, first out, the way AddOrderLine does. Lines of the same product take
+// their units one after the other, so a later line is costed from the
+// layers an earlier one left.
+func GetMarginPreview(ctx context.Context, source MarginSource, query *GetMarginPreviewQuery) (*MarginPreview, error) {
+	if query.Currency == "" {
+		return nil, errors.InvalidArgument("currency is required")
+	}
+	if len(query.Lines) == 0 {
+		return nil, errors.InvalidArgument("at least one line is required")
+	}
+	ids := make([]uuid.UUID, 0, len(query.Lines))
+	for _, line := range query.Lines {
+		if line.Quantity <= 0 {
+			return nil, errors.InvalidArgument("quantity must be positive")
+		}
+		ids = append(ids, line.ProductID)
+	}
+
+	products, err := source.FindProducts(ctx, query.TenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+	items, err := source.FindCostLayers(ctx, query.TenantID, ids, query.WarehouseID)
+	if err != nil {
+		return nil, err
+	}
+	layers := make(map[uuid.UUID][]*domain.InventoryItem)
+	for _, item := range items {
+		layers[item.ProductID] = append(layers[item.ProductID], item)
+	}
+
+	preview := &MarginPreview{
+		Currency: query.Currency,
+		Lines:    make([]LineMargin, 0, len(query.Lines)),
+	}
+	taken := make(map[uuid.UUID]int)
+	for _, line := range query.Lines {
+		product, ok := products[line.ProductID]
+		if !ok {
+			return nil, errors.InvalidArgument("product %s not found", line.ProductID)
+		}
+
+		// The cost of this line is what the units taken so far plus its
+		// own cost, less what the units taken so far cost alone.
+		before := taken[line.ProductID]
+		after := before + line.Quantity
+		costBefore, coveredBefore := domain.ExpectedUnitCost(layers[line.ProductID], before, product.Pricing.CostPrice)
+		costAfter, coveredAfter := domain.ExpectedUnitCost(layers[line.ProductID], after, product.Pricing.CostPrice)
+		cost := costAfter.Mul(decimal.NewFromInt(int64(after))).Sub(costBefore.Mul(decimal.NewFromInt(int64(before))))
+		taken[line.ProductID] = after
+
+		orderLine := domain.OrderLine{Quantity: line.Quantity, UnitPrice: line.UnitPrice, Discount: line.Discount}
+		unitCost := cost.Div(decimal.NewFromInt(int64(line.Quantity)))
+		revenue := money.Round(line.UnitPrice.Mul(decimal.NewFromInt(int64(line.Quantity))).Sub(line.Discount), query.Currency)
+		cost = money.Round(cost, query.Currency)
+		floor := product.FloorPrice(unitCost, query.Currency)
+
+		margin := LineMargin{
+			ProductID:        product.ID.String(),
+			SKU:              product.SKU,
+			Name:             product.Name,
+			Quantity:         line.Quantity,
+			NetUnitPrice:     money.Round(orderLine.NetUnitPrice(), query.Currency),
+			Revenue:          revenue,
+			ExpectedUnitCost: money.Round(unitCost, query.Currency),
+			ExpectedCost:     cost,
+			Margin:           revenue.Sub(cost),
+			MarginPercent:    marginPercent(revenue.Sub(cost), revenue),
+			FloorPrice:       floor,
+			BelowFloor:       orderLine.NetUnitPrice().LessThan(floor),
+			UncostedQuantity: line.Quantity - (coveredAfter - coveredBefore),
+		}
+		if margin.BelowFloor {
+			preview.BelowFloor++
+		}
+		preview.Revenue = preview.Revenue.Add(revenue)
+		preview.ExpectedCost = preview.ExpectedCost.Add(cost)
+		preview.Lines = append(preview.Lines, margin)
+	}
+	preview.Margin = preview.Revenue.Sub(preview.ExpectedCost)
+	preview.MarginPercent = marginPercent(preview.Margin, preview.Revenue)
+	return preview, nil
+}
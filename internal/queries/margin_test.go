@@ -0,0 +1,117 @@
+package queries
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryMargins struct {
+	products map[uuid.UUID]*domain.Product
+	items    []*domain.InventoryItem
+}
+
+func (m *memoryMargins) FindProducts(ctx context.Context, tenantID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]*domain.Product, error) {
+	found := make(map[uuid.UUID]*domain.Product)
+	for _, id := range ids {
+		if product, ok := m.products[id]; ok && product.TenantID == tenantID {
+			found[id] = product
+		}
+	}
+	return found, nil
+}
+
+func (m *memoryMargins) FindCostLayers(ctx context.Context, tenantID uuid.UUID, productIDs []uuid.UUID, warehouseID uuid.UUID) ([]*domain.InventoryItem, error) {
+	var layers []*domain.InventoryItem
+	for _, item := range m.items {
+		if item.TenantID == tenantID && (warehouseID == uuid.Nil || item.WarehouseID == warehouseID) {
+			layers = append(layers, item)
+		}
+	}
+	return layers, nil
+}
+
+func TestGetMarginPreview(t *testing.T) {
+	tenantID := uuid.New()
+	warehouseID := uuid.New()
+
+	product := &domain.Product{ID: uuid.New(), TenantID: tenantID, SKU: "SKU-1", Name: "Widget"}
+	product.SetPricing(decimal.NewFromInt(30), decimal.NewFromInt(30), decimal.NewFromInt(25))
+	require.NoError(t, product.SetPriceFloor(decimal.Zero, decimal.NewFromInt(20)))
+
+	source := &memoryMargins{products: map[uuid.UUID]*domain.Product{product.ID: product}}
+	for i, unitCost := range []int64{10, 20} {
+		item := domain.NewInventoryItem(tenantID, product.ID, warehouseID, product.SKU, 4, decimal.NewFromInt(unitCost))
+		item.CreatedAt = time.Now().Add(time.Duration(i) * time.Hour)
+		source.items = append(source.items, item)
+	}
+
+	preview, err := GetMarginPreview(context.Background(), source, &GetMarginPreviewQuery{
+		TenantID:    tenantID,
+		WarehouseID: warehouseID,
+		Currency:    "USD",
+		Lines: []MarginPreviewLine{
+			{ProductID: product.ID, Quantity: 4, UnitPrice: decimal.NewFromInt(15)},
+			{ProductID: product.ID, Quantity: 6, UnitPrice: decimal.NewFromInt(30), Discount: decimal.NewFromInt(12)},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, preview.Lines, 2)
+
+	first := preview.Lines[0]
+	assert.Equal(t, "40", first.ExpectedCost.String(), "the oldest layer")
+	assert.Equal(t, "20", first.Margin.String())
+	assert.Equal(t, "33.33", first.MarginPercent.String())
+	assert.Equal(t, "12.5", first.FloorPrice.String())
+	assert.False(t, first.BelowFloor)
+
+	second := preview.Lines[1]
+	assert.Equal(t, "130", second.ExpectedCost.String(), "four units at 20 and two beyond the stock at 25")
+	assert.Equal(t, "28", second.NetUnitPrice.String())
+	assert.Equal(t, "168", second.Revenue.String())
+	assert.Equal(t, 2, second.UncostedQuantity)
+	assert.Equal(t, "27.09", second.FloorPrice.String())
+	assert.False(t, second.BelowFloor)
+
+	assert.Equal(t, "228", preview.Revenue.String())
+	assert.Equal(t, "170", preview.ExpectedCost.String())
+	assert.Equal(t, "58", preview.Margin.String())
+	assert.Equal(t, "25.44", preview.MarginPercent.String())
+	assert.Equal(t, 0, preview.BelowFloor)
+}
+
+func TestGetMarginPreviewBelowFloor(t *testing.T) {
+	tenantID := uuid.New()
+	product := &domain.Product{ID: uuid.New(), TenantID: tenantID}
+	product.SetPricing(decimal.NewFromInt(30), decimal.NewFromInt(30), decimal.NewFromInt(10))
+	require.NoError(t, product.SetPriceFloor(decimal.NewFromInt(12), decimal.Zero))
+	source := &memoryMargins{products: map[uuid.UUID]*domain.Product{product.ID: product}}
+
+	preview, err := GetMarginPreview(context.Background(), source, &GetMarginPreviewQuery{
+		TenantID: tenantID,
+		Currency: "USD",
+		Lines:    []MarginPreviewLine{{ProductID: product.ID, Quantity: 3, UnitPrice: decimal.NewFromInt(11)}},
+	})
+	require.NoError(t, err)
+	assert.True(t, preview.Lines[0].BelowFloor)
+	assert.Equal(t, 1, preview.BelowFloor)
+	assert.Equal(t, 3, preview.Lines[0].UncostedQuantity)
+}
+
+func TestGetMarginPreviewRejectsUnknownProduct(t *testing.T) {
+	_, err := GetMarginPreview(context.Background(), &memoryMargins{}, &GetMarginPreviewQuery{
+		TenantID: uuid.New(),
+		Currency: "USD",
+		Lines:    []MarginPreviewLine{{ProductID: uuid.New(), Quantity: 1, UnitPrice: decimal.NewFromInt(1)}},
+	})
+	assert.Error(t, err)
+
+	_, err = GetMarginPreview(context.Background(), &memoryMargins{}, &GetMarginPreviewQuery{Currency: "USD"})
+	assert.Error(t, err)
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ims-erp/system/internal/domain"
 	"github.com/ims-erp/system/internal/events"
 	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/fieldset"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/pagination"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -35,36 +38,48 @@ func NewPaymentQueryHandler(
 	}
 }
 
+// PaymentFields are the fields payment views can be narrowed to.
+var PaymentFields = fieldset.Of(events.PaymentSummary{})
+
 type GetPaymentByIDQuery struct {
-	PaymentID string
-	TenantID  string
+	PaymentID  string
+	TenantID   string
+	Fields     fieldset.Set
+	Visibility domain.Visibility
 }
 
 type ListPaymentsQuery struct {
-	TenantID  string
-	ClientID  string
-	InvoiceID string
-	Page      int
-	PageSize  int
-	Status    string
-	Method    string
-	StartDate time.Time
-	EndDate   time.Time
-	SortBy    string
-	SortOrder string
+	TenantID   string
+	ClientID   string
+	InvoiceID  string
+	Page       int
+	PageSize   int
+	Cursor     string
+	Status     string
+	Method     string
+	StartDate  time.Time
+	EndDate    time.Time
+	SortBy     string
+	SortOrder  string
+	Fields     fieldset.Set
+	Visibility domain.Visibility
 }
 
 type GetPaymentsByInvoiceQuery struct {
-	InvoiceID string
-	TenantID  string
-	Page      int
-	PageSize  int
+	InvoiceID  string
+	TenantID   string
+	Page       int
+	PageSize   int
+	Visibility domain.Visibility
 }
 
+// GetPaymentStatsQuery counts the payments created from StartDate up to,
+// but not including, EndDate.
 type GetPaymentStatsQuery struct {
-	TenantID  string
-	StartDate time.Time
-	EndDate   time.Time
+	TenantID   string
+	StartDate  time.Time
+	EndDate    time.Time
+	Visibility domain.Visibility
 }
 
 type ListPaymentsResult struct {
@@ -73,21 +88,23 @@ type ListPaymentsResult struct {
 	Page       int                     `json:"page"`
 	PageSize   int                     `json:"pageSize"`
 	TotalPages int                     `json:"totalPages"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
 }
 
 type PaymentStats struct {
-	TenantID       string    `json:"tenantId"`
-	TotalPayments  int64     `json:"totalPayments"`
-	PendingCount   int64     `json:"pendingCount"`
-	CompletedCount int64     `json:"completedCount"`
-	FailedCount    int64     `json:"failedCount"`
-	RefundedCount  int64     `json:"refundedCount"`
-	CancelledCount int64     `json:"cancelledCount"`
-	TotalAmount    string    `json:"totalAmount"`
-	TotalRefunded  string    `json:"totalRefunded"`
-	AverageAmount  string    `json:"averageAmount"`
-	PeriodStart    time.Time `json:"periodStart,omitempty"`
-	PeriodEnd      time.Time `json:"periodEnd,omitempty"`
+	TenantID       string           `json:"tenantId"`
+	TotalPayments  int64            `json:"totalPayments"`
+	PendingCount   int64            `json:"pendingCount"`
+	CompletedCount int64            `json:"completedCount"`
+	FailedCount    int64            `json:"failedCount"`
+	RefundedCount  int64            `json:"refundedCount"`
+	CancelledCount int64            `json:"cancelledCount"`
+	TotalAmount    string           `json:"totalAmount"`
+	TotalRefunded  string           `json:"totalRefunded"`
+	AverageAmount  string           `json:"averageAmount"`
+	Revenue        []PaymentRevenue `json:"revenue"`
+	PeriodStart    time.Time        `json:"periodStart,omitempty"`
+	PeriodEnd      time.Time        `json:"periodEnd,omitempty"`
 }
 
 func (h *PaymentQueryHandler) GetPaymentByID(ctx context.Context, query *GetPaymentByIDQuery) (*events.PaymentSummary, error) {
@@ -99,18 +116,21 @@ func (h *PaymentQueryHandler) GetPaymentByID(ctx context.Context, query *GetPaym
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("payment:summary:%s", query.PaymentID)
-	if cached, err := h.cache.Get(ctx, cacheKey); err == nil && cached != "" {
+	cacheKey := fmt.Sprintf("payment:summary:%s%s%s", query.PaymentID, query.Fields.CacheKey(), visibilityKey(query.Visibility))
+	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
-		return nil, nil
+		var payment events.PaymentSummary
+		if err := json.Unmarshal(cached, &payment); err == nil {
+			return &payment, nil
+		}
 	}
 
-	filter := map[string]interface{}{
+	filter := restrict(map[string]interface{}{
 		"_id":      query.PaymentID,
 		"tenantId": query.TenantID,
-	}
+	}, query.Visibility)
 
-	result, err := h.readModelStore.FindOne(ctx, filter)
+	result, err := h.readModelStore.FindOne(ctx, filter, options.FindOne().SetProjection(query.Fields.Projection()))
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to get payment: %w", err)
@@ -120,10 +140,11 @@ func (h *PaymentQueryHandler) GetPaymentByID(ctx context.Context, query *GetPaym
 		return nil, nil
 	}
 
-	payment, ok := result.(events.PaymentSummary)
-	if !ok {
+	decoded := decodeReadModels[events.PaymentSummary]([]interface{}{result})
+	if len(decoded) == 0 {
 		return nil, fmt.Errorf("invalid payment data")
 	}
+	payment := decoded[0]
 
 	h.cache.Set(ctx, cacheKey, payment, 5*time.Minute)
 
@@ -140,8 +161,9 @@ func (h *PaymentQueryHandler) ListPayments(ctx context.Context, query *ListPayme
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("payment:list:%s:%s:%s:%d:%d:%s:%s",
-		query.TenantID, query.ClientID, query.InvoiceID, query.Page, query.PageSize, query.Status, query.Method)
+	cacheKey := fmt.Sprintf("payment:list:%s:%s:%s:%d:%d:%s:%s:%s:%s:%s%s%s",
+		query.TenantID, query.ClientID, query.InvoiceID, query.Page, query.PageSize, query.Status, query.Method,
+		query.SortBy, query.SortOrder, query.Cursor, query.Fields.CacheKey(), visibilityKey(query.Visibility))
 	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
 		var result ListPaymentsResult
@@ -173,10 +195,12 @@ func (h *PaymentQueryHandler) ListPayments(ctx context.Context, query *ListPayme
 	if !query.StartDate.IsZero() && !query.EndDate.IsZero() {
 		filter["createdAt"] = map[string]interface{}{
 			"$gte": query.StartDate,
-			"$lte": query.EndDate,
+			"$lt":  query.EndDate,
 		}
 	}
 
+	restrict(filter, query.Visibility)
+
 	total, err := h.readModelStore.Count(ctx, filter)
 	if err != nil {
 		span.RecordError(err)
@@ -187,17 +211,24 @@ func (h *PaymentQueryHandler) ListPayments(ctx context.Context, query *ListPayme
 	if pageSize <= 0 {
 		pageSize = 20
 	}
-	skip := (query.Page - 1) * pageSize
 
 	sortBy := query.SortBy
 	if sortBy == "" {
 		sortBy = "createdAt"
 	}
 
+	sort := pagination.NewSort(sortBy, query.SortOrder)
 	findOpts := options.Find().
-		SetSkip(int64(skip)).
-		SetLimit(int64(pageSize)).
-		SetSort(map[string]int{sortBy: getSortOrder(query.SortOrder)})
+		SetLimit(int64(pageSize + 1)).
+		SetSort(sort.Keys()).
+		SetProjection(query.Fields.Projection(sort.Field))
+	if query.Cursor != "" {
+		if err := sort.After(filter, query.Cursor); err != nil {
+			return nil, err
+		}
+	} else {
+		findOpts.SetSkip(int64((query.Page - 1) * pageSize))
+	}
 
 	results, err := h.readModelStore.Find(ctx, filter, findOpts)
 	if err != nil {
@@ -205,12 +236,9 @@ func (h *PaymentQueryHandler) ListPayments(ctx context.Context, query *ListPayme
 		return nil, fmt.Errorf("failed to list payments: %w", err)
 	}
 
-	payments := make([]events.PaymentSummary, 0, len(results))
-	for _, r := range results {
-		if payment, ok := r.(events.PaymentSummary); ok {
-			payments = append(payments, payment)
-		}
-	}
+	results, nextCursor := sort.Page(results, pageSize)
+
+	payments := decodeReadModels[events.PaymentSummary](results)
 
 	totalPages := int(total) / pageSize
 	if int(total)%pageSize > 0 {
@@ -223,6 +251,7 @@ func (h *PaymentQueryHandler) ListPayments(ctx context.Context, query *ListPayme
 		Page:       query.Page,
 		PageSize:   pageSize,
 		TotalPages: totalPages,
+		NextCursor: nextCursor,
 	}
 
 	if data, err := json.Marshal(result); err == nil {
@@ -241,10 +270,10 @@ func (h *PaymentQueryHandler) GetPaymentsByInvoice(ctx context.Context, query *G
 	)
 	defer span.End()
 
-	filter := map[string]interface{}{
+	filter := restrict(map[string]interface{}{
 		"tenantId":  query.TenantID,
 		"invoiceId": query.InvoiceID,
-	}
+	}, query.Visibility)
 
 	total, err := h.readModelStore.Count(ctx, filter)
 	if err != nil {
@@ -269,12 +298,7 @@ func (h *PaymentQueryHandler) GetPaymentsByInvoice(ctx context.Context, query *G
 		return nil, fmt.Errorf("failed to get payments by invoice: %w", err)
 	}
 
-	payments := make([]events.PaymentSummary, 0, len(results))
-	for _, r := range results {
-		if payment, ok := r.(events.PaymentSummary); ok {
-			payments = append(payments, payment)
-		}
-	}
+	payments := decodeReadModels[events.PaymentSummary](results)
 
 	totalPages := int(total) / pageSize
 	if int(total)%pageSize > 0 {
@@ -298,7 +322,7 @@ func (h *PaymentQueryHandler) GetPaymentStats(ctx context.Context, query *GetPay
 	)
 	defer span.End()
 
-	cacheKey := fmt.Sprintf("payment:stats:%s", query.TenantID)
+	cacheKey := fmt.Sprintf("payment:stats:%s:%d:%d%s", query.TenantID, query.StartDate.Unix(), query.EndDate.Unix(), visibilityKey(query.Visibility))
 	if cached, err := h.cache.GetBytes(ctx, cacheKey); err == nil && cached != nil {
 		span.SetAttributes(attribute.Bool("cache_hit", true))
 		var stats PaymentStats
@@ -314,9 +338,10 @@ func (h *PaymentQueryHandler) GetPaymentStats(ctx context.Context, query *GetPay
 	if !query.StartDate.IsZero() && !query.EndDate.IsZero() {
 		filter["createdAt"] = map[string]interface{}{
 			"$gte": query.StartDate,
-			"$lte": query.EndDate,
+			"$lt":  query.EndDate,
 		}
 	}
+	restrict(filter, query.Visibility)
 
 	totalCount, err := h.readModelStore.Count(ctx, filter)
 	if err != nil {
@@ -324,21 +349,37 @@ func (h *PaymentQueryHandler) GetPaymentStats(ctx context.Context, query *GetPay
 		return nil, fmt.Errorf("failed to get payment stats: %w", err)
 	}
 
-	pendingFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "pending"}
+	pendingFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "pending"}, query.Visibility)
 	pendingCount, _ := h.readModelStore.Count(ctx, pendingFilter)
 
-	completedFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "completed"}
+	completedFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "completed"}, query.Visibility)
 	completedCount, _ := h.readModelStore.Count(ctx, completedFilter)
 
-	failedFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "failed"}
+	failedFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "failed"}, query.Visibility)
 	failedCount, _ := h.readModelStore.Count(ctx, failedFilter)
 
-	refundedFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "refunded"}
+	refundedFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "refunded"}, query.Visibility)
 	refundedCount, _ := h.readModelStore.Count(ctx, refundedFilter)
 
-	cancelledFilter := map[string]interface{}{"tenantId": query.TenantID, "status": "cancelled"}
+	cancelledFilter := restrict(map[string]interface{}{"tenantId": query.TenantID, "status": "cancelled"}, query.Visibility)
 	cancelledCount, _ := h.readModelStore.Count(ctx, cancelledFilter)
 
+	// Revenue is summed here rather than in the database, since amounts are
+	// stored as decimal strings.
+	completedInPeriod := map[string]interface{}{"status": "completed"}
+	for key, value := range filter {
+		completedInPeriod[key] = value
+	}
+	completed, err := h.readModelStore.Find(ctx, completedInPeriod, options.Find().SetProjection(map[string]interface{}{
+		"amount":     1,
+		"currency":   1,
+		"settlement": 1,
+	}))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get payment revenue: %w", err)
+	}
+
 	stats := &PaymentStats{
 		TenantID:       query.TenantID,
 		TotalPayments:  totalCount,
@@ -350,6 +391,7 @@ func (h *PaymentQueryHandler) GetPaymentStats(ctx context.Context, query *GetPay
 		TotalAmount:    "0",
 		TotalRefunded:  "0",
 		AverageAmount:  "0",
+		Revenue:        sumRevenue(decodeReadModels[events.PaymentSummary](completed)),
 		PeriodStart:    query.StartDate,
 		PeriodEnd:      query.EndDate,
 	}
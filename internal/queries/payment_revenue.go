@@ -0,0 +1,68 @@
+package queries
+
+import (
+	"sort"
+
+	"github.com/ims-erp/system/internal/events"
+	"github.com/shopspring/decimal"
+)
+
+// PaymentRevenue totals completed payments in one currency: the gross
+// amount, the provider's fees and the net revenue left after them. Settled
+// payments count in their settlement currency. Unsettled counts the
+// payments whose fees are not known yet, which count in the currency they
+// were taken in with no fees.
+type PaymentRevenue struct {
+	Currency  string          `json:"currency"`
+	Payments  int64           `json:"payments"`
+	Gross     decimal.Decimal `json:"gross"`
+	Fees      decimal.Decimal `json:"fees"`
+	Net       decimal.Decimal `json:"net"`
+	Unsettled int64           `json:"unsettled"`
+}
+
+// sumRevenue totals payments by currency, in currency order. Amounts that
+// do not parse count as zero.
+func sumRevenue(payments []events.PaymentSummary) []PaymentRevenue {
+	byCurrency := make(map[string]*PaymentRevenue)
+	for _, payment := range payments {
+		currency := payment.Currency
+		gross := parseAmount(payment.Amount)
+		fee := decimal.Zero
+		net := gross
+		if payment.Settlement != nil {
+			currency = payment.Settlement.Currency
+			gross = parseAmount(payment.Settlement.Gross)
+			fee = parseAmount(payment.Settlement.Fee)
+			net = parseAmount(payment.Settlement.Net)
+		}
+
+		revenue, ok := byCurrency[currency]
+		if !ok {
+			revenue = &PaymentRevenue{Currency: currency}
+			byCurrency[currency] = revenue
+		}
+		revenue.Payments++
+		revenue.Gross = revenue.Gross.Add(gross)
+		revenue.Fees = revenue.Fees.Add(fee)
+		revenue.Net = revenue.Net.Add(net)
+		if payment.Settlement == nil {
+			revenue.Unsettled++
+		}
+	}
+
+	totals := make([]PaymentRevenue, 0, len(byCurrency))
+	for _, revenue := range byCurrency {
+		totals = append(totals, *revenue)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Currency < totals[j].Currency })
+	return totals
+}
+
+func parseAmount(value string) decimal.Decimal {
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero
+	}
+	return amount
+}
@@ -0,0 +1,36 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/ims-erp/system/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSumRevenue(t *testing.T) {
+	revenue := sumRevenue([]events.PaymentSummary{
+		{Amount: "100.00", Currency: "USD", Settlement: &events.PaymentSettlementView{Currency: "USD", Gross: "100.00", Fee: "3.20", Net: "96.80"}},
+		{Amount: "50.00", Currency: "USD", Settlement: &events.PaymentSettlementView{Currency: "EUR", Gross: "46.00", Fee: "1.50", Net: "44.50"}},
+		{Amount: "20.00", Currency: "USD"},
+		{Amount: "30.00", Currency: "EUR"},
+	})
+
+	require.Len(t, revenue, 2)
+	eur, usd := revenue[0], revenue[1]
+	assert.Equal(t, "EUR", eur.Currency)
+	assert.Equal(t, int64(2), eur.Payments)
+	assert.Equal(t, "76", eur.Gross.String())
+	assert.Equal(t, "1.5", eur.Fees.String())
+	assert.Equal(t, "74.5", eur.Net.String())
+	assert.Equal(t, int64(1), eur.Unsettled)
+
+	assert.Equal(t, "USD", usd.Currency)
+	assert.Equal(t, int64(2), usd.Payments)
+	assert.Equal(t, "120", usd.Gross.String())
+	assert.Equal(t, "3.2", usd.Fees.String())
+	assert.Equal(t, "116.8", usd.Net.String(), "net is gross less fees, unsettled payments at their gross")
+	assert.Equal(t, int64(1), usd.Unsettled)
+
+	assert.Empty(t, sumRevenue(nil))
+}
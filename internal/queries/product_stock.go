@@ -0,0 +1,287 @@
+package queries
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/errors"
+)
+
+// ProductStockCacheEntity is the cache namespace of product stock views.
+// Keys embed the product ID, so evicting the entity with a product ID drops
+// every view of that product.
+const ProductStockCacheEntity = "productstock"
+
+// StockCache keeps computed stock views for a while. repository.Cache
+// implements it.
+type StockCache interface {
+	GetBytes(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+}
+
+// GetProductStockQuery selects the stock of one product, optionally in one
+// warehouse only.
+type GetProductStockQuery struct {
+	TenantID    string
+	ProductID   string
+	WarehouseID string
+}
+
+// LocationStock is the stock of a product at one location of a warehouse;
+// an empty LocationID is stock not booked to a location.
+type LocationStock struct {
+	LocationID string `json:"locationId,omitempty"`
+	OnHand     int    `json:"onHand"`
+	Reserved   int    `json:"reserved"`
+	Available  int    `json:"available"`
+}
+
+// WarehouseStock is the stock of a product in one warehouse. InTransit is
+// stock transferred out of the warehouse that has not arrived at the
+// receiving warehouse yet. Available is worked out on the warehouse totals,
+// so stock reserved without a location is taken from the warehouse as a
+// whole.
+type WarehouseStock struct {
+	WarehouseID string          `json:"warehouseId"`
+	OnHand      int             `json:"onHand"`
+	Reserved    int             `json:"reserved"`
+	InTransit   int             `json:"inTransit"`
+	Available   int             `json:"available"`
+	Locations   []LocationStock `json:"locations"`
+}
+
+// ProductStock is the stock of a product across warehouses. TotalAvailable
+// is what can still be sold: the sum of the warehouses' available stock.
+type ProductStock struct {
+	ProductID      string           `json:"productId"`
+	OnHand         int              `json:"onHand"`
+	Reserved       int              `json:"reserved"`
+	InTransit      int              `json:"inTransit"`
+	TotalAvailable int              `json:"totalAvailable"`
+	Warehouses     []WarehouseStock `json:"warehouses"`
+	AsOf           time.Time        `json:"asOf"`
+}
+
+// holdKey identifies stock held for one reference in one warehouse.
+type holdKey struct {
+	warehouseID   string
+	referenceType string
+	referenceID   string
+}
+
+type transferKey struct {
+	referenceType string
+	referenceID   string
+}
+
+type transit struct {
+	warehouseID string
+	quantity    int
+}
+
+// StockPosition works out on-hand, reserved and in-transit stock of one
+// product as its movements are posted in order.
+//
+// Reservations and allocations hold stock for their reference, such as an
+// order; releases, deallocations and shipments or transfers out with the
+// same reference free it again, never more than is held. Transfers out and
+// in are matched by their reference too; transfers without one are not
+// tracked in transit.
+type StockPosition struct {
+	ledger    *Ledger
+	holds     map[holdKey]map[string]int
+	transfers map[transferKey]*transit
+}
+
+func NewStockPosition() *StockPosition {
+	return &StockPosition{
+		ledger:    NewLedger(),
+		holds:     make(map[holdKey]map[string]int),
+		transfers: make(map[transferKey]*transit),
+	}
+}
+
+// Post applies record.
+func (p *StockPosition) Post(record repository.InventoryTransactionRecord) {
+	entry := p.ledger.Post(record)
+	hold := holdKey{warehouseID: record.WarehouseID, referenceType: record.ReferenceType, referenceID: record.ReferenceID}
+	transfer := transferKey{referenceType: record.ReferenceType, referenceID: record.ReferenceID}
+
+	switch domain.MovementType(record.MovementType) {
+	case domain.MovementTypeReservation, domain.MovementTypeAllocation:
+		if p.holds[hold] == nil {
+			p.holds[hold] = make(map[string]int)
+		}
+		p.holds[hold][entry.LocationID] += record.Quantity
+	case domain.MovementTypeReservationRelease, domain.MovementTypeDeallocation, domain.MovementTypeShipment:
+		p.free(hold, entry.LocationID, record.Quantity)
+	case domain.MovementTypeTransferOut:
+		p.free(hold, entry.LocationID, record.Quantity)
+		if record.ReferenceID != "" {
+			t := p.transfers[transfer]
+			if t == nil {
+				t = &transit{warehouseID: record.WarehouseID}
+				p.transfers[transfer] = t
+			}
+			t.quantity += record.Quantity
+		}
+	case domain.MovementTypeTransferIn:
+		if t := p.transfers[transfer]; t != nil && record.ReferenceID != "" {
+			t.quantity -= record.Quantity
+			if t.quantity <= 0 {
+				delete(p.transfers, transfer)
+			}
+		}
+	}
+}
+
+// free releases up to quantity of the stock held for key, at location
+// first.
+func (p *StockPosition) free(key holdKey, location string, quantity int) {
+	held := p.holds[key]
+	if held == nil {
+		return
+	}
+	locations := make([]string, 0, len(held))
+	for l := range held {
+		if l != location {
+			locations = append(locations, l)
+		}
+	}
+	sort.Strings(locations)
+	if _, ok := held[location]; ok {
+		locations = append([]string{location}, locations...)
+	}
+	for _, l := range locations {
+		if quantity <= 0 {
+			break
+		}
+		n := min(held[l], quantity)
+		held[l] -= n
+		quantity -= n
+		if held[l] <= 0 {
+			delete(held, l)
+		}
+	}
+	if len(held) == 0 {
+		delete(p.holds, key)
+	}
+}
+
+// Stock returns the position of productID, only in warehouseID when it is
+// set, with warehouses and locations ordered by ID. Places whose stock is
+// all zero are left out.
+func (p *StockPosition) Stock(productID, warehouseID string) *ProductStock {
+	warehouses := make(map[string]*WarehouseStock)
+	warehouse := func(id string) *WarehouseStock {
+		w := warehouses[id]
+		if w == nil {
+			w = &WarehouseStock{WarehouseID: id, Locations: []LocationStock{}}
+			warehouses[id] = w
+		}
+		return w
+	}
+
+	reserved := make(map[ledgerKey]int)
+	for key, held := range p.holds {
+		for location, quantity := range held {
+			reserved[ledgerKey{warehouseID: key.warehouseID, locationID: location}] += quantity
+		}
+	}
+	places := make(map[ledgerKey]bool)
+	for key, quantity := range p.ledger.locations {
+		if quantity != 0 {
+			places[key] = true
+		}
+	}
+	for key := range reserved {
+		places[key] = true
+	}
+	for key := range places {
+		onHand, held := p.ledger.locations[key], reserved[key]
+		w := warehouse(key.warehouseID)
+		w.OnHand += onHand
+		w.Reserved += held
+		w.Locations = append(w.Locations, LocationStock{
+			LocationID: key.locationID,
+			OnHand:     onHand,
+			Reserved:   held,
+			Available:  max(onHand-held, 0),
+		})
+	}
+	for _, t := range p.transfers {
+		warehouse(t.warehouseID).InTransit += t.quantity
+	}
+
+	stock := &ProductStock{ProductID: productID, Warehouses: make([]WarehouseStock, 0, len(warehouses))}
+	for _, w := range warehouses {
+		if warehouseID != "" && w.WarehouseID != warehouseID {
+			continue
+		}
+		w.Available = max(w.OnHand-w.Reserved, 0)
+		sort.Slice(w.Locations, func(i, j int) bool { return w.Locations[i].LocationID < w.Locations[j].LocationID })
+		stock.OnHand += w.OnHand
+		stock.Reserved += w.Reserved
+		stock.InTransit += w.InTransit
+		stock.TotalAvailable += w.Available
+		stock.Warehouses = append(stock.Warehouses, *w)
+	}
+	sort.Slice(stock.Warehouses, func(i, j int) bool {
+		return stock.Warehouses[i].WarehouseID < stock.Warehouses[j].WarehouseID
+	})
+	return stock
+}
+
+// ProductStockCacheKey is the cache key of the stock view query selects.
+func ProductStockCacheKey(query *GetProductStockQuery) string {
+	key := ProductStockCacheEntity + ":detail:" + query.TenantID + ":" + query.ProductID
+	if query.WarehouseID != "" {
+		key += ":" + query.WarehouseID
+	}
+	return key
+}
+
+// GetProductStock returns the stock of a product per warehouse and location,
+// worked out from all of its movements. Movements of every warehouse are
+// read even when query names one, to see transfers arrive. With a cache the
+// result is kept for ttl; cache failures only cost the lookup.
+func GetProductStock(ctx context.Context, source InventoryTransactionSource, cache StockCache, ttl time.Duration, query *GetProductStockQuery) (*ProductStock, error) {
+	if query.ProductID == "" {
+		return nil, errors.InvalidArgument("productId is required")
+	}
+	key := ProductStockCacheKey(query)
+	if cache != nil {
+		if cached, err := cache.GetBytes(ctx, key); err == nil && cached != nil {
+			var stock ProductStock
+			if err := json.Unmarshal(cached, &stock); err == nil {
+				return &stock, nil
+			}
+		}
+	}
+
+	asOf := time.Now().UTC()
+	position := NewStockPosition()
+	err := source.Each(ctx, repository.InventoryTransactionFilter{
+		TenantID:  query.TenantID,
+		ProductID: query.ProductID,
+	}, func(record repository.InventoryTransactionRecord) error {
+		position.Post(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stock := position.Stock(query.ProductID, query.WarehouseID)
+	stock.AsOf = asOf
+
+	if cache != nil && ttl > 0 {
+		if data, err := json.Marshal(stock); err == nil {
+			cache.Set(ctx, key, data, ttl)
+		}
+	}
+	return stock, nil
+}
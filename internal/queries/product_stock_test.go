@@ -0,0 +1,89 @@
+package queries
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func referenced(record repository.InventoryTransactionRecord, referenceType, referenceID string) repository.InventoryTransactionRecord {
+	record.ReferenceType = referenceType
+	record.ReferenceID = referenceID
+	return record
+}
+
+var stockMovements = memoryTransactions{
+	movement("s1", 1, "receipt", "wh-1", "", "A1", 100),
+	movement("s2", 1, "receipt", "wh-1", "", "B2", 20),
+	referenced(movement("s3", 2, "reservation", "wh-1", "", "", 30), "order", "o-1"),
+	referenced(movement("s4", 2, "reservation", "wh-1", "", "", 10), "order", "o-2"),
+	referenced(movement("s5", 3, "shipment", "wh-1", "A1", "", 25), "order", "o-1"),
+	referenced(movement("s6", 3, "reservation_release", "wh-1", "", "", 50), "order", "o-2"),
+	referenced(movement("s7", 4, "transfer_out", "wh-1", "A1", "", 40), "transfer", "tr-1"),
+	referenced(movement("s8", 5, "transfer_in", "wh-2", "", "C1", 15), "transfer", "tr-1"),
+	referenced(movement("s9", 5, "allocation", "wh-2", "", "C1", 20), "order", "o-3"),
+}
+
+func TestStockPosition(t *testing.T) {
+	position := NewStockPosition()
+	for _, record := range stockMovements {
+		position.Post(record)
+	}
+	stock := position.Stock("product-1", "")
+
+	require.Len(t, stock.Warehouses, 2)
+	wh1 := stock.Warehouses[0]
+	assert.Equal(t, "wh-1", wh1.WarehouseID)
+	assert.Equal(t, 55, wh1.OnHand)
+	assert.Equal(t, 5, wh1.Reserved, "the shipment uses up most of o-1's reservation; o-2 is released, never below zero")
+	assert.Equal(t, 25, wh1.InTransit, "15 of the 40 transferred have arrived")
+	assert.Equal(t, 50, wh1.Available)
+	assert.Equal(t, []LocationStock{
+		{LocationID: "", OnHand: 0, Reserved: 5, Available: 0},
+		{LocationID: "A1", OnHand: 35, Reserved: 0, Available: 35},
+		{LocationID: "B2", OnHand: 20, Reserved: 0, Available: 20},
+	}, wh1.Locations)
+
+	wh2 := stock.Warehouses[1]
+	assert.Equal(t, 15, wh2.OnHand)
+	assert.Equal(t, 20, wh2.Reserved)
+	assert.Equal(t, 0, wh2.Available, "over-allocated stock is not available, nor negative")
+
+	assert.Equal(t, 70, stock.OnHand)
+	assert.Equal(t, 25, stock.InTransit)
+	assert.Equal(t, 50, stock.TotalAvailable)
+}
+
+type memoryStockCache map[string][]byte
+
+func (m memoryStockCache) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	return m[key], nil
+}
+
+func (m memoryStockCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	m[key] = value.([]byte)
+	return nil
+}
+
+func TestGetProductStock(t *testing.T) {
+	cache := memoryStockCache{}
+	query := &GetProductStockQuery{TenantID: "tenant-1", ProductID: "product-1", WarehouseID: "wh-1"}
+
+	stock, err := GetProductStock(context.Background(), stockMovements, cache, time.Minute, query)
+	require.NoError(t, err)
+	require.Len(t, stock.Warehouses, 1)
+	assert.Equal(t, 25, stock.InTransit, "arrivals at other warehouses are still matched")
+	assert.Equal(t, 50, stock.TotalAvailable)
+	assert.Contains(t, cache, "productstock:detail:tenant-1:product-1:wh-1")
+
+	cached, err := GetProductStock(context.Background(), memoryTransactions{}, cache, time.Minute, query)
+	require.NoError(t, err)
+	assert.Equal(t, 50, cached.TotalAvailable, "served from the cache")
+
+	_, err = GetProductStock(context.Background(), stockMovements, nil, 0, &GetProductStockQuery{TenantID: "tenant-1"})
+	assert.EqualError(t, err, "productId is required")
+}
@@ -0,0 +1,32 @@
+package queries
+
+import (
+	"strings"
+
+	"github.com/ims-erp/system/internal/domain"
+)
+
+// restrict narrows filter to the read models v may see: those owned by its
+// owner or lying in one of its territories. Read models without an owner
+// are only seen by unrestricted callers.
+func restrict(filter map[string]interface{}, v domain.Visibility) map[string]interface{} {
+	if !v.Restricted() {
+		return filter
+	}
+	visible := []interface{}{map[string]interface{}{"ownerId": v.OwnerID}}
+	if len(v.Territories) > 0 {
+		visible = append(visible, map[string]interface{}{"territory": map[string]interface{}{"$in": v.Territories}})
+	}
+	and, _ := filter["$and"].([]interface{})
+	filter["$and"] = append(and, map[string]interface{}{"$or": visible})
+	return filter
+}
+
+// visibilityKey returns the suffix telling apart results cached for
+// callers that see different read models, "" for unrestricted callers.
+func visibilityKey(v domain.Visibility) string {
+	if !v.Restricted() {
+		return ""
+	}
+	return ":own:" + v.OwnerID + ":" + strings.Join(v.Territories, ",")
+}
@@ -0,0 +1,44 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestrict(t *testing.T) {
+	filter := restrict(map[string]interface{}{"tenantId": "tenant-1"}, domain.Visibility{})
+	assert.Equal(t, map[string]interface{}{"tenantId": "tenant-1"}, filter, "unrestricted callers see every read model")
+
+	filter = restrict(map[string]interface{}{"tenantId": "tenant-1"}, domain.OwnVisibility("rep-1", []string{"north"}))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"ownerId": "rep-1"},
+			map[string]interface{}{"territory": map[string]interface{}{"$in": []string{"north"}}},
+		}},
+	}, filter["$and"])
+
+	filter = restrict(map[string]interface{}{"tenantId": "tenant-1"}, domain.OwnVisibility("rep-1", nil))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"$or": []interface{}{map[string]interface{}{"ownerId": "rep-1"}}},
+	}, filter["$and"])
+}
+
+func TestRestrict_KeepsCursor(t *testing.T) {
+	// Restrictions and cursors both narrow the filter with $and, so neither
+	// overwrites the other's $or.
+	sort := pagination.NewSort("name", "asc")
+	filter := restrict(map[string]interface{}{}, domain.OwnVisibility("rep-1", nil))
+	require.NoError(t, sort.After(filter, sort.Cursor("Acme", "c-1")))
+	assert.Len(t, filter["$and"], 2)
+	assert.NotContains(t, filter, "$or")
+}
+
+func TestVisibilityKey(t *testing.T) {
+	assert.Empty(t, visibilityKey(domain.Visibility{}))
+	assert.Equal(t, ":own:rep-1:north,south", visibilityKey(domain.OwnVisibility("rep-1", []string{"north", "south"})))
+	assert.NotEqual(t, visibilityKey(domain.OwnVisibility("rep-1", nil)), visibilityKey(domain.OwnVisibility("rep-2", nil)))
+}
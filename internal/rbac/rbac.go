@@ -258,10 +258,15 @@ func (s *RBACService) InitializeDefaultPermissions(ctx context.Context) error {
 		{ID: uuid.New().String(), Name: "invoice:read", DisplayName: "Read Invoices", Module: "invoice", Actions: []string{"read"}, Description: "View invoices"},
 		{ID: uuid.New().String(), Name: "invoice:write", DisplayName: "Write Invoices", Module: "invoice", Actions: []string{"write"}, Description: "Create and update invoices"},
 		{ID: uuid.New().String(), Name: "invoice:approve", DisplayName: "Approve Invoices", Module: "invoice", Actions: []string{"approve"}, Description: "Approve invoices"},
+		{ID: uuid.New().String(), Name: "payment:read", DisplayName: "Read Payments", Module: "payment", Actions: []string{"read"}, Description: "View payments"},
 		{ID: uuid.New().String(), Name: "payment:process", DisplayName: "Process Payments", Module: "payment", Actions: []string{"process"}, Description: "Process payments"},
+		{ID: uuid.New().String(), Name: "credit:read", DisplayName: "Read Credit", Module: "credit", Actions: []string{"read"}, Description: "View client credit limits and balances"},
 		{ID: uuid.New().String(), Name: "user:read", DisplayName: "Read Users", Module: "user", Actions: []string{"read"}, Description: "View users"},
 		{ID: uuid.New().String(), Name: "user:write", DisplayName: "Write Users", Module: "user", Actions: []string{"write"}, Description: "Create and update users"},
 		{ID: uuid.New().String(), Name: "user:delete", DisplayName: "Delete Users", Module: "user", Actions: []string{"delete"}, Description: "Delete users"},
+		{ID: uuid.New().String(), Name: "feature:read", DisplayName: "Read Feature Flags", Module: "feature", Actions: []string{"read"}, Description: "View the tenant's feature flags"},
+		{ID: uuid.New().String(), Name: "feature:write", DisplayName: "Write Feature Flags", Module: "feature", Actions: []string{"write"}, Description: "Turn features on or off for the tenant"},
+		{ID: uuid.New().String(), Name: "system:admin", DisplayName: "Administer Services", Module: "system", Actions: []string{"admin"}, Description: "Inspect and requeue dead letters, rebuild read models and view consumer state for the tenant"},
 	}
 
 	for _, perm := range defaultPermissions {
@@ -283,14 +288,21 @@ func (s *RBACService) InitializeDefaultPermissions(ctx context.Context) error {
 }
 
 func (s *RBACService) HasAccess(userPermissions []string, requiredPermission string) bool {
-	for _, up := range userPermissions {
+	return Allows(userPermissions, requiredPermission)
+}
+
+// Allows reports whether held, such as the permissions in a caller's token,
+// grants required, directly or through "*" and wildcard segments. It needs
+// no stores, so handlers can check a request without an RBACService.
+func Allows(held []string, required string) bool {
+	for _, up := range held {
 		if up == "*" {
 			return true
 		}
-		if up == requiredPermission {
+		if up == required {
 			return true
 		}
-		if isWildcardMatch(up, requiredPermission) {
+		if isWildcardMatch(up, required) {
 			return true
 		}
 	}
@@ -0,0 +1,28 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		held     []string
+		required string
+		want     bool
+	}{
+		{[]string{"*"}, "backup:admin", true},
+		{[]string{"backup:admin"}, "backup:admin", true},
+		{[]string{"backup:*"}, "backup:admin", true},
+		{[]string{"document:read:#"}, "document:read:own", true},
+		{[]string{"backup:read"}, "backup:admin", false},
+		{[]string{"backup:*"}, "document:read", false},
+		{[]string{"document:*"}, "document:read:own", false},
+		{[]string{""}, "backup:admin", false},
+		{nil, "backup:admin", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Allows(tt.held, tt.required), "%v %s", tt.held, tt.required)
+	}
+}
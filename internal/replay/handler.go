@@ -0,0 +1,110 @@
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// Handler serves the replay admin API under /admin/replay:
+//
+//	POST   /admin/replay/jobs         queue a replay
+//	GET    /admin/replay/jobs?limit=  list recent jobs
+//	GET    /admin/replay/jobs/{id}    job progress
+//	DELETE /admin/replay/jobs/{id}    cancel a job
+//
+// It runs behind the tenant middleware and needs middleware.AdminPermission;
+// jobs are always for the caller's tenant and jobs of other tenants are
+// reported as not found.
+func (r *Replayer) Handler() http.Handler {
+	return middleware.RequirePermission(middleware.AdminPermission, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/admin/replay"), "/")
+		parts := strings.Split(path, "/")
+		tenantID := middleware.GetTenantID(req.Context())
+
+		switch {
+		case path == "jobs" && req.Method == http.MethodPost:
+			var body Request
+			if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+				httpresponse.ErrorStatus(w, req, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			body.TenantID = tenantID
+			job, err := r.Start(req.Context(), body)
+			if err != nil {
+				r.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusAccepted, job)
+
+		case path == "jobs" && req.Method == http.MethodGet:
+			limit, _ := strconv.ParseInt(req.URL.Query().Get("limit"), 10, 64)
+			if limit <= 0 || limit > 200 {
+				limit = 20
+			}
+			jobs, err := r.List(req.Context(), tenantID, limit)
+			if err != nil {
+				r.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": jobs})
+
+		case len(parts) == 2 && parts[0] == "jobs" && req.Method == http.MethodGet:
+			job, err := r.tenantJob(req, tenantID, parts[1])
+			if err != nil {
+				r.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, job)
+
+		case len(parts) == 2 && parts[0] == "jobs" && req.Method == http.MethodDelete:
+			if _, err := r.tenantJob(req, tenantID, parts[1]); err != nil {
+				r.writeError(w, req, err)
+				return
+			}
+			job, err := r.Cancel(req.Context(), parts[1])
+			if err != nil {
+				r.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusAccepted, job)
+
+		case path == "jobs" || (len(parts) == 2 && parts[0] == "jobs"):
+			httpresponse.ErrorStatus(w, req, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			httpresponse.ErrorStatus(w, req, http.StatusNotFound, "not found")
+		}
+	}))
+}
+
+func (r *Replayer) tenantJob(req *http.Request, tenantID, id string) (*repository.ReplayJob, error) {
+	job, err := r.Get(req.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if job.TenantID != tenantID {
+		return nil, repository.ErrReplayJobNotFound
+	}
+	return job, nil
+}
+
+func (r *Replayer) writeError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, ErrUnknownReadModel):
+		httpresponse.ErrorStatus(w, req, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrReplayInProgress):
+		httpresponse.ErrorStatus(w, req, http.StatusConflict, err.Error())
+	case errors.Is(err, repository.ErrReplayJobNotFound):
+		httpresponse.ErrorStatus(w, req, http.StatusNotFound, err.Error())
+	default:
+		r.logger.Error("Replay admin request failed", "error", err)
+		httpresponse.ErrorStatus(w, req, http.StatusInternalServerError, "replay service unavailable")
+	}
+}
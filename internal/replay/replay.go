@@ -0,0 +1,465 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/fieldcrypt"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+var (
+	ErrInvalidRequest   = errors.New("invalid replay request")
+	ErrUnknownReadModel = errors.New("unknown read model")
+	ErrNoHistory        = errors.New("no events to rebuild from")
+
+	errCancelled = errors.New("replay cancelled")
+)
+
+// Target is a read model that can be rebuilt from the event store.
+type Target struct {
+	// Name identifies the read model and is its live collection.
+	Name           string
+	AggregateTypes []string
+	// Live dispatches to the projections that write the live collection.
+	Live *events.EventHandlerRegistry
+	// Project returns projections that write into collection instead.
+	Project func(collection string) *events.EventHandlerRegistry
+	// Invalidate drops cached reads for a tenant after a swap. Optional.
+	Invalidate func(ctx context.Context, tenantID string) error
+	// Pause stops the live projections of every replica from writing the
+	// live collection and returns a function that resumes them. A shadow
+	// rebuild holds the pause while it applies the last events and swaps,
+	// so nothing the live projections write is overwritten. Optional;
+	// without it, live documents newer than their rebuilt copies are kept.
+	Pause func(ctx context.Context) (resume func(), err error)
+}
+
+// eventSource is the part of the event store a replay reads.
+type eventSource interface {
+	Count(ctx context.Context, f repository.EventFilter) (int64, error)
+	Stream(ctx context.Context, f repository.EventFilter, fn func(repository.StoredEvent) error) error
+}
+
+// jobStore keeps replay jobs where every replica can see them.
+type jobStore interface {
+	EnsureIndexes(ctx context.Context) error
+	Create(ctx context.Context, job *repository.ReplayJob) error
+	Get(ctx context.Context, id string) (*repository.ReplayJob, error)
+	List(ctx context.Context, tenantID string, limit int64) ([]repository.ReplayJob, error)
+	Claim(ctx context.Context, owner string, staleAfter time.Duration) (*repository.ReplayJob, error)
+	Progress(ctx context.Context, job *repository.ReplayJob) (bool, error)
+	Finish(ctx context.Context, job *repository.ReplayJob, status string) error
+	Cancel(ctx context.Context, id string) (*repository.ReplayJob, error)
+}
+
+// readModels drops shadow collections and swaps them in.
+type readModels interface {
+	DropCollection(ctx context.Context, name string) error
+	SwapTenantDocuments(ctx context.Context, target, source, tenantID string, batch int) (int64, error)
+}
+
+// Request starts a replay. Without From or FromVersion the tenant's read
+// model is rebuilt from scratch into a shadow collection and swapped in.
+// With either set, events from that point are re-applied to the live
+// collection through the idempotent live projections, which fills gaps
+// without double-applying anything.
+type Request struct {
+	TenantID    string     `json:"tenantId"`
+	ReadModel   string     `json:"readModel"`
+	From        *time.Time `json:"from,omitempty"`
+	FromVersion int64      `json:"fromVersion,omitempty"`
+	Shadow      *bool      `json:"shadow,omitempty"`
+	MaxFailures int64      `json:"maxFailures"`
+}
+
+// Replayer schedules replay jobs and runs them on a bounded worker pool.
+// Jobs are stored in MongoDB, so any replica can accept, report on or
+// cancel a job that another replica is running.
+type Replayer struct {
+	db      readModels
+	events  eventSource
+	jobs    jobStore
+	targets map[string]Target
+	cfg     config.ReplayConfig
+	owner   string
+	slots   chan struct{}
+	logger  *logger.Logger
+}
+
+func NewReplayer(db *repository.MongoDB, cfg config.ReplayConfig, log *logger.Logger, targets ...Target) *Replayer {
+	host, _ := os.Hostname()
+	r := &Replayer{
+		db:      db,
+		events:  repository.NewEventStore(db, log),
+		jobs:    repository.NewReplayJobStore(db),
+		targets: make(map[string]Target, len(targets)),
+		cfg:     cfg,
+		owner:   host + "-" + uuid.New().String()[:8],
+		slots:   make(chan struct{}, cfg.MaxConcurrent),
+		logger:  log,
+	}
+	for _, t := range targets {
+		r.targets[t.Name] = t
+	}
+	return r
+}
+
+// WithEncryption lets the replayer read events whose personal data the
+// event store encrypted with keyring.
+func (r *Replayer) WithEncryption(keyring *fieldcrypt.Keyring) *Replayer {
+	if store, ok := r.events.(*repository.EventStore); ok {
+		store.WithEncryption(keyring)
+	}
+	return r
+}
+
+func (r *Replayer) EnsureIndexes(ctx context.Context) error {
+	return r.jobs.EnsureIndexes(ctx)
+}
+
+// Start validates req and queues a job for the worker pool.
+func (r *Replayer) Start(ctx context.Context, req Request) (*repository.ReplayJob, error) {
+	if req.TenantID == "" {
+		return nil, fmt.Errorf("%w: tenantId is required", ErrInvalidRequest)
+	}
+	if req.ReadModel == "" && len(r.targets) == 1 {
+		for name := range r.targets {
+			req.ReadModel = name
+		}
+	}
+	if _, ok := r.targets[req.ReadModel]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownReadModel, req.ReadModel)
+	}
+	if req.FromVersion < 0 || req.MaxFailures < 0 {
+		return nil, fmt.Errorf("%w: fromVersion and maxFailures must not be negative", ErrInvalidRequest)
+	}
+
+	partial := req.From != nil || req.FromVersion > 0
+	shadow := !partial
+	if req.Shadow != nil {
+		shadow = *req.Shadow
+	}
+	if shadow && partial {
+		return nil, fmt.Errorf("%w: a shadow rebuild must replay the full history", ErrInvalidRequest)
+	}
+
+	job := &repository.ReplayJob{
+		ReadModel:   req.ReadModel,
+		TenantID:    req.TenantID,
+		From:        req.From,
+		FromVersion: req.FromVersion,
+		Shadow:      shadow,
+		MaxFailures: req.MaxFailures,
+	}
+	if err := r.jobs.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("Replay job queued",
+		"job_id", job.ID,
+		"tenant_id", job.TenantID,
+		"read_model", job.ReadModel,
+		"shadow", job.Shadow,
+	)
+	return job, nil
+}
+
+func (r *Replayer) Get(ctx context.Context, id string) (*repository.ReplayJob, error) {
+	return r.jobs.Get(ctx, id)
+}
+
+func (r *Replayer) List(ctx context.Context, tenantID string, limit int64) ([]repository.ReplayJob, error) {
+	return r.jobs.List(ctx, tenantID, limit)
+}
+
+func (r *Replayer) Cancel(ctx context.Context, id string) (*repository.ReplayJob, error) {
+	return r.jobs.Cancel(ctx, id)
+}
+
+// Run claims queued jobs whenever a worker slot is free. It blocks until ctx
+// is cancelled; running jobs are abandoned and picked up again once their
+// heartbeat goes stale.
+func (r *Replayer) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.claimJobs(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replayer) claimJobs(ctx context.Context) {
+	for {
+		select {
+		case r.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		job, err := r.jobs.Claim(ctx, r.owner, r.cfg.StaleAfter)
+		if err != nil || job == nil {
+			<-r.slots
+			if err != nil {
+				r.logger.Warn("Failed to claim replay job", "error", err)
+			}
+			return
+		}
+
+		go func() {
+			defer func() { <-r.slots }()
+			r.run(ctx, job)
+		}()
+	}
+}
+
+func (r *Replayer) run(ctx context.Context, job *repository.ReplayJob) {
+	log := r.logger.WithFields(map[string]interface{}{
+		"job_id":     job.ID,
+		"tenant_id":  job.TenantID,
+		"read_model": job.ReadModel,
+	})
+	log.Infow("Replay started", "shadow", job.Shadow)
+
+	err := r.replay(ctx, job)
+	if job.ShadowCollection != "" {
+		if dropErr := r.db.DropCollection(context.Background(), job.ShadowCollection); dropErr != nil {
+			log.Warnw("Failed to drop shadow collection", "collection", job.ShadowCollection, "error", dropErr)
+		}
+	}
+
+	if errors.Is(err, repository.ErrReplayJobNotFound) {
+		log.Warnw("Replay taken over by another worker", "processed", job.Processed)
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down; leave the job running so another worker resumes it.
+		log.Infow("Replay interrupted by shutdown", "processed", job.Processed)
+		return
+	}
+
+	status := repository.ReplayStatusCompleted
+	switch {
+	case errors.Is(err, errCancelled):
+		status = repository.ReplayStatusCancelled
+	case err != nil:
+		status = repository.ReplayStatusFailed
+		job.LastError = err.Error()
+	}
+
+	if finishErr := r.jobs.Finish(context.Background(), job, status); finishErr != nil {
+		log.Errorw("Failed to record replay result", "error", finishErr)
+	}
+	if status == repository.ReplayStatusFailed {
+		log.Errorw("Replay failed", "processed", job.Processed, "failed", job.Failed, "error", err)
+		return
+	}
+	log.Infow("Replay finished",
+		"status", status,
+		"total", job.Total,
+		"processed", job.Processed,
+		"failed", job.Failed,
+		"swapped", job.Swapped,
+	)
+}
+
+func (r *Replayer) replay(ctx context.Context, job *repository.ReplayJob) error {
+	target, ok := r.targets[job.ReadModel]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownReadModel, job.ReadModel)
+	}
+
+	filter := repository.EventFilter{
+		TenantID:       job.TenantID,
+		AggregateTypes: target.AggregateTypes,
+		FromVersion:    job.FromVersion,
+	}
+	if job.From != nil {
+		filter.From = *job.From
+	}
+
+	total, err := r.events.Count(ctx, filter)
+	if err != nil {
+		return err
+	}
+	job.Total = total
+
+	registry := target.Live
+	if job.Shadow {
+		// A reclaimed job may have left a half-built shadow behind.
+		if job.ShadowCollection != "" {
+			if err := r.db.DropCollection(ctx, job.ShadowCollection); err != nil {
+				return fmt.Errorf("failed to drop stale shadow collection: %w", err)
+			}
+		}
+		job.ShadowCollection = shadowCollection(target.Name)
+		// Rebuilds start from an empty collection, so every event must be
+		// applied regardless of what the live consumer has processed.
+		registry = target.Project(job.ShadowCollection).WithProcessedEvents(nil, "", 0)
+	}
+
+	if cancelled, err := r.jobs.Progress(ctx, job); err != nil {
+		return err
+	} else if cancelled {
+		return errCancelled
+	}
+
+	lastReport := time.Now()
+	apply := func(stored repository.StoredEvent) error {
+		if errs := registry.Handle(ctx, toEnvelope(stored)); len(errs) > 0 {
+			job.Failed++
+			job.LastError = errors.Join(errs...).Error()
+			if job.Failed > job.MaxFailures {
+				return fmt.Errorf("aborted after %d failed events, last at %s: %s", job.Failed, stored.ID, job.LastError)
+			}
+		}
+		job.Processed++
+		job.LastEventID = stored.ID
+
+		if job.Processed%int64(r.cfg.ProgressEvery) != 0 && time.Since(lastReport) < r.cfg.StaleAfter/4 {
+			return nil
+		}
+		lastReport = time.Now()
+		cancelled, err := r.jobs.Progress(ctx, job)
+		if err != nil {
+			return err
+		}
+		if cancelled {
+			return errCancelled
+		}
+		return nil
+	}
+
+	var mark highWater
+	err = r.events.Stream(ctx, filter, func(stored repository.StoredEvent) error {
+		mark.advance(stored)
+		return apply(stored)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !job.Shadow {
+		return nil
+	}
+	// Swapping in a rebuild of nothing would delete every live document of
+	// the tenant. The read model is not built from events in the store.
+	if job.Processed == 0 && job.Failed == 0 {
+		return fmt.Errorf("%w: the event store holds no %s events of the tenant", ErrNoHistory, strings.Join(target.AggregateTypes, ", "))
+	}
+
+	// Events stored while the rebuild ran were projected into the live
+	// collection only; apply them to the shadow too until it is level.
+	for pass := 0; pass < maxCatchUpPasses; pass++ {
+		applied, err := r.catchUp(ctx, filter, &mark, apply)
+		if err != nil {
+			return err
+		}
+		if applied == 0 {
+			break
+		}
+	}
+
+	if target.Pause != nil {
+		resume, err := target.Pause(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to pause live projections: %w", err)
+		}
+		defer resume()
+	}
+	if _, err := r.catchUp(ctx, filter, &mark, apply); err != nil {
+		return err
+	}
+
+	if cancelled, err := r.jobs.Progress(ctx, job); err != nil {
+		return err
+	} else if cancelled {
+		return errCancelled
+	}
+
+	swapped, err := r.db.SwapTenantDocuments(ctx, target.Name, job.ShadowCollection, job.TenantID, r.cfg.SwapBatch)
+	job.Swapped = swapped
+	if err != nil {
+		return fmt.Errorf("failed to swap in rebuilt read model: %w", err)
+	}
+
+	if target.Invalidate != nil {
+		if err := target.Invalidate(ctx, job.TenantID); err != nil {
+			r.logger.Warn("Failed to invalidate cache after replay", "job_id", job.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// maxCatchUpPasses bounds how often a rebuild chases events stored while it
+// catches up before it swaps regardless.
+const maxCatchUpPasses = 5
+
+// highWater is the newest event a rebuild has applied. Events are streamed
+// in timestamp order, so catching up streams from its timestamp again and
+// skips the events at that timestamp that were already applied.
+type highWater struct {
+	at   time.Time
+	seen map[string]bool
+}
+
+func (h *highWater) advance(e repository.StoredEvent) {
+	if h.seen == nil || e.Timestamp.After(h.at) {
+		h.at = e.Timestamp
+		h.seen = make(map[string]bool)
+	}
+	h.seen[e.ID] = true
+}
+
+// catchUp applies the events stored after mark and advances it. It returns
+// how many events it applied.
+func (r *Replayer) catchUp(ctx context.Context, filter repository.EventFilter, mark *highWater, apply func(repository.StoredEvent) error) (int64, error) {
+	filter.From = mark.at
+	var applied int64
+	err := r.events.Stream(ctx, filter, func(stored repository.StoredEvent) error {
+		if mark.seen[stored.ID] {
+			return nil
+		}
+		mark.advance(stored)
+		applied++
+		return apply(stored)
+	})
+	return applied, err
+}
+
+// shadowCollection is unique per attempt, so a worker that lost its job can
+// never drop the shadow its successor is building.
+func shadowCollection(readModel string) string {
+	return readModel + "_rebuild_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12]
+}
+
+func toEnvelope(e repository.StoredEvent) *events.EventEnvelope {
+	return &events.EventEnvelope{
+		ID:            e.ID,
+		Type:          e.EventType,
+		AggregateID:   e.AggregateID,
+		AggregateType: e.AggregateType,
+		TenantID:      e.Metadata.TenantID,
+		Version:       e.Version,
+		Timestamp:     e.Timestamp,
+		CorrelationID: e.Metadata.CorrelationID,
+		CausationID:   e.Metadata.CausationID,
+		UserID:        e.Metadata.UserID,
+		Data:          e.EventData,
+		Metadata:      map[string]string{"replay": "true"},
+	}
+}
@@ -0,0 +1,364 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEvents is an event store in memory. onStream runs before each Stream
+// call, so a test can store events "while" a replay reads.
+type fakeEvents struct {
+	stored   []repository.StoredEvent
+	streams  int
+	onStream func(call int)
+}
+
+func (f *fakeEvents) matches(e repository.StoredEvent, filter repository.EventFilter) bool {
+	if filter.TenantID != "" && e.Metadata.TenantID != filter.TenantID {
+		return false
+	}
+	if !filter.From.IsZero() && e.Timestamp.Before(filter.From) {
+		return false
+	}
+	if len(filter.AggregateTypes) == 0 {
+		return true
+	}
+	for _, t := range filter.AggregateTypes {
+		if e.AggregateType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeEvents) Count(ctx context.Context, filter repository.EventFilter) (int64, error) {
+	var n int64
+	for _, e := range f.stored {
+		if f.matches(e, filter) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeEvents) Stream(ctx context.Context, filter repository.EventFilter, fn func(repository.StoredEvent) error) error {
+	f.streams++
+	if f.onStream != nil {
+		f.onStream(f.streams)
+	}
+	for _, e := range append([]repository.StoredEvent(nil), f.stored...) {
+		if !f.matches(e, filter) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeEvents) add(tenantID, clientID, name string, at time.Time) {
+	f.stored = append(f.stored, repository.StoredEvent{
+		ID:            clientID + "-" + name,
+		AggregateID:   clientID,
+		AggregateType: "Client",
+		EventType:     "client.created",
+		EventData:     map[string]interface{}{"name": name},
+		Metadata:      repository.EventMetadata{TenantID: tenantID},
+		Version:       1,
+		Timestamp:     at,
+	})
+}
+
+// fakeReadModels keeps collections as maps of tenant to document ID to name
+// and logs what the replayer does to them.
+type fakeReadModels struct {
+	collections map[string]map[string]map[string]string
+	log         []string
+	batch       int
+}
+
+func newFakeReadModels() *fakeReadModels {
+	return &fakeReadModels{collections: make(map[string]map[string]map[string]string)}
+}
+
+func (f *fakeReadModels) put(collection, tenantID, id, name string) {
+	if f.collections[collection] == nil {
+		f.collections[collection] = make(map[string]map[string]string)
+	}
+	if f.collections[collection][tenantID] == nil {
+		f.collections[collection][tenantID] = make(map[string]string)
+	}
+	f.collections[collection][tenantID][id] = name
+}
+
+func (f *fakeReadModels) DropCollection(ctx context.Context, name string) error {
+	delete(f.collections, name)
+	return nil
+}
+
+func (f *fakeReadModels) SwapTenantDocuments(ctx context.Context, target, source, tenantID string, batch int) (int64, error) {
+	f.log = append(f.log, "swap")
+	f.batch = batch
+	docs := f.collections[source][tenantID]
+	if f.collections[target] == nil {
+		f.collections[target] = make(map[string]map[string]string)
+	}
+	f.collections[target][tenantID] = make(map[string]string, len(docs))
+	for id, name := range docs {
+		f.collections[target][tenantID][id] = name
+	}
+	return int64(len(docs)), nil
+}
+
+// fakeJobs stores jobs in memory; cancel makes the next progress update
+// report a cancellation.
+type fakeJobs struct {
+	jobs   map[string]*repository.ReplayJob
+	cancel bool
+}
+
+func (f *fakeJobs) EnsureIndexes(ctx context.Context) error { return nil }
+
+func (f *fakeJobs) Create(ctx context.Context, job *repository.ReplayJob) error {
+	job.ID = "job-" + job.TenantID
+	job.Status = repository.ReplayStatusPending
+	f.jobs[job.ID] = job
+	return nil
+}
+
+func (f *fakeJobs) Get(ctx context.Context, id string) (*repository.ReplayJob, error) {
+	job, ok := f.jobs[id]
+	if !ok {
+		return nil, repository.ErrReplayJobNotFound
+	}
+	return job, nil
+}
+
+func (f *fakeJobs) List(ctx context.Context, tenantID string, limit int64) ([]repository.ReplayJob, error) {
+	var jobs []repository.ReplayJob
+	for _, job := range f.jobs {
+		if job.TenantID == tenantID {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs, nil
+}
+
+func (f *fakeJobs) Claim(ctx context.Context, owner string, staleAfter time.Duration) (*repository.ReplayJob, error) {
+	return nil, nil
+}
+
+func (f *fakeJobs) Progress(ctx context.Context, job *repository.ReplayJob) (bool, error) {
+	return f.cancel, nil
+}
+
+func (f *fakeJobs) Finish(ctx context.Context, job *repository.ReplayJob, status string) error {
+	job.Status = status
+	return nil
+}
+
+func (f *fakeJobs) Cancel(ctx context.Context, id string) (*repository.ReplayJob, error) {
+	return f.Get(ctx, id)
+}
+
+const testTenant = "tenant-1"
+
+func newTestReplayer(t *testing.T, store *fakeEvents, models *fakeReadModels, target Target) (*Replayer, *fakeJobs) {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	jobs := &fakeJobs{jobs: make(map[string]*repository.ReplayJob)}
+	r := &Replayer{
+		db:      models,
+		events:  store,
+		jobs:    jobs,
+		targets: map[string]Target{target.Name: target},
+		cfg: config.ReplayConfig{
+			MaxConcurrent: 1,
+			ProgressEvery: 100,
+			StaleAfter:    time.Minute,
+			SwapBatch:     2,
+		},
+		slots:  make(chan struct{}, 1),
+		logger: log,
+	}
+	return r, jobs
+}
+
+// clientTarget projects client.created events into the named collection of
+// models.
+func clientTarget(models *fakeReadModels) Target {
+	project := func(collection string) *events.EventHandlerRegistry {
+		registry := events.NewEventHandlerRegistry()
+		registry.Register("client.created", func(ctx context.Context, event *events.EventEnvelope) error {
+			models.put(collection, event.TenantID, event.AggregateID, event.Data["name"].(string))
+			return nil
+		})
+		return registry
+	}
+	return Target{
+		Name:           "client_read",
+		AggregateTypes: []string{"Client"},
+		Live:           project("client_read"),
+		Project:        project,
+	}
+}
+
+func TestReplay_ShadowRebuildSwapsInRebuiltModel(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	store := &fakeEvents{}
+	store.add(testTenant, "c1", "Acme", start)
+	store.add(testTenant, "c2", "Globex", start.Add(time.Second))
+	store.add("tenant-2", "c3", "Initech", start.Add(time.Second))
+
+	models := newFakeReadModels()
+	models.put("client_read", testTenant, "stale", "Stale Ltd")
+	models.put("client_read", "tenant-2", "c3", "Initech")
+	r, _ := newTestReplayer(t, store, models, clientTarget(models))
+
+	job := &repository.ReplayJob{ID: "job-1", ReadModel: "client_read", TenantID: testTenant, Shadow: true}
+	require.NoError(t, r.replay(context.Background(), job))
+
+	assert.Equal(t, map[string]string{"c1": "Acme", "c2": "Globex"}, models.collections["client_read"][testTenant])
+	assert.Equal(t, map[string]string{"c3": "Initech"}, models.collections["client_read"]["tenant-2"])
+	assert.Equal(t, int64(2), job.Processed)
+	assert.Equal(t, int64(2), job.Swapped)
+	assert.Equal(t, 2, models.batch)
+	assert.True(t, strings.HasPrefix(job.ShadowCollection, "client_read_rebuild_"))
+}
+
+func TestReplay_CatchesUpWithEventsStoredDuringRebuild(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	store := &fakeEvents{}
+	store.add(testTenant, "c1", "Acme", start)
+	store.add(testTenant, "c2", "Globex", start.Add(time.Second))
+
+	models := newFakeReadModels()
+	target := clientTarget(models)
+	live := target.Live
+	// While the rebuild reads, the live projection applies two new events:
+	// one at the same timestamp as the last event read and one after it.
+	store.onStream = func(call int) {
+		if call != 1 {
+			return
+		}
+		store.add(testTenant, "c3", "Initech", start.Add(time.Second))
+		store.add(testTenant, "c4", "Umbrella", start.Add(2*time.Second))
+		for _, e := range store.stored[2:] {
+			live.Handle(context.Background(), toEnvelope(e))
+		}
+	}
+
+	var order []string
+	target.Pause = func(ctx context.Context) (func(), error) {
+		order = append(order, "pause")
+		return func() { order = append(order, "resume") }, nil
+	}
+	r, _ := newTestReplayer(t, store, models, target)
+
+	job := &repository.ReplayJob{ID: "job-1", ReadModel: "client_read", TenantID: testTenant, Shadow: true}
+	require.NoError(t, r.replay(context.Background(), job))
+
+	assert.Equal(t, map[string]string{"c1": "Acme", "c2": "Globex", "c3": "Initech", "c4": "Umbrella"},
+		models.collections["client_read"][testTenant])
+	assert.Equal(t, int64(4), job.Processed, "no event is applied twice")
+	assert.Equal(t, []string{"pause", "resume"}, order)
+	assert.Equal(t, []string{"swap"}, models.log)
+}
+
+func TestReplay_EmptyHistoryKeepsLivePayments(t *testing.T) {
+	// Payment events go through the outbox to JetStream and are never
+	// written to the event store, which holds client events only.
+	store := &fakeEvents{}
+	store.add(testTenant, "c1", "Acme", time.Now())
+
+	models := newFakeReadModels()
+	models.put("payment_read_models", testTenant, "p1", "PAY-1")
+	models.put("payment_read_models", testTenant, "p2", "PAY-2")
+	project := func(collection string) *events.EventHandlerRegistry {
+		registry := events.NewEventHandlerRegistry()
+		registry.Register("payment.created", func(ctx context.Context, event *events.EventEnvelope) error {
+			models.put(collection, event.TenantID, event.AggregateID, event.AggregateID)
+			return nil
+		})
+		return registry
+	}
+	r, _ := newTestReplayer(t, store, models, Target{
+		Name:           "payment_read_models",
+		AggregateTypes: []string{"payment"},
+		Live:           project("payment_read_models"),
+		Project:        project,
+	})
+
+	job := &repository.ReplayJob{ID: "job-1", ReadModel: "payment_read_models", TenantID: testTenant, Shadow: true}
+	assert.ErrorIs(t, r.replay(context.Background(), job), ErrNoHistory)
+	assert.Empty(t, models.log)
+	assert.Equal(t, map[string]string{"p1": "PAY-1", "p2": "PAY-2"}, models.collections["payment_read_models"][testTenant])
+}
+
+func TestReplay_PauseFailureKeepsLiveModel(t *testing.T) {
+	store := &fakeEvents{}
+	store.add(testTenant, "c1", "Acme", time.Now())
+
+	models := newFakeReadModels()
+	models.put("client_read", testTenant, "c1", "Acme Live")
+	target := clientTarget(models)
+	target.Pause = func(ctx context.Context) (func(), error) {
+		return nil, errors.New("consumer not found")
+	}
+	r, _ := newTestReplayer(t, store, models, target)
+
+	job := &repository.ReplayJob{ID: "job-1", ReadModel: "client_read", TenantID: testTenant, Shadow: true}
+	err := r.replay(context.Background(), job)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pause")
+	assert.Empty(t, models.log)
+	assert.Equal(t, "Acme Live", models.collections["client_read"][testTenant]["c1"])
+}
+
+func TestReplay_CancelledBeforeSwap(t *testing.T) {
+	store := &fakeEvents{}
+	store.add(testTenant, "c1", "Acme", time.Now())
+
+	models := newFakeReadModels()
+	r, jobs := newTestReplayer(t, store, models, clientTarget(models))
+	jobs.cancel = true
+
+	job := &repository.ReplayJob{ID: "job-1", ReadModel: "client_read", TenantID: testTenant, Shadow: true}
+	assert.ErrorIs(t, r.replay(context.Background(), job), errCancelled)
+	assert.Empty(t, models.log)
+}
+
+func TestHandler_RequiresAdminPermission(t *testing.T) {
+	models := newFakeReadModels()
+	r, jobs := newTestReplayer(t, &fakeEvents{}, models, clientTarget(models))
+
+	request := func(permissions ...string) *httptest.ResponseRecorder {
+		ctx := middleware.WithIdentity(context.Background(), testTenant, "user-1", permissions)
+		req := httptest.NewRequest(http.MethodPost, "/admin/replay/jobs", strings.NewReader(`{}`)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		r.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, request().Code)
+	assert.Equal(t, http.StatusForbidden, request("client:read", "*:read").Code)
+	assert.Empty(t, jobs.jobs)
+
+	rec := request(middleware.AdminPermission)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	require.Contains(t, jobs.jobs, "job-"+testTenant)
+	assert.Equal(t, testTenant, jobs.jobs["job-"+testTenant].TenantID)
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrApprovalWorkflowNotFound = errors.New("approval workflow not found")
+	ErrApprovalRequestNotFound  = errors.New("approval request not found")
+)
+
+// ApprovalStore keeps approval workflows, one per tenant and subject type,
+// and the approval requests started from them.
+type ApprovalStore struct {
+	workflows *mongo.Collection
+	requests  *mongo.Collection
+}
+
+func NewApprovalStore(db *MongoDB) *ApprovalStore {
+	return &ApprovalStore{
+		workflows: db.Collection("approval_workflows"),
+		requests:  db.Collection("approval_requests"),
+	}
+}
+
+// EnsureIndexes creates the store's indexes. A subject has at most one
+// pending request, which the partial unique index enforces against the
+// same subject being submitted twice at once.
+func (s *ApprovalStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.requests.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "approverUsers", Value: 1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "approverRoles", Value: 1}}},
+		{Keys: bson.D{{Key: "escalateAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{
+			Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "subjectType", Value: 1}, {Key: "subjectId", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": domain.ApprovalPending}).
+				SetName("pending_request_per_subject"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create approval request indexes: %w", err)
+	}
+	return nil
+}
+
+func approvalWorkflowID(tenantID, subjectType string) string {
+	return tenantID + "/" + subjectType
+}
+
+// ListWorkflows returns the workflows of tenantID, ordered by subject type.
+func (s *ApprovalStore) ListWorkflows(ctx context.Context, tenantID string) ([]domain.ApprovalWorkflow, error) {
+	start := time.Now()
+	cursor, err := s.workflows.Find(ctx, bson.M{"tenantId": tenantID},
+		options.Find().SetSort(bson.D{{Key: "subjectType", Value: 1}}))
+	observeMongo("find", s.workflows, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list approval workflows: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	workflows := []domain.ApprovalWorkflow{}
+	if err := cursor.All(ctx, &workflows); err != nil {
+		return nil, fmt.Errorf("failed to decode approval workflows: %w", err)
+	}
+	return workflows, nil
+}
+
+func (s *ApprovalStore) GetWorkflow(ctx context.Context, tenantID, subjectType string) (*domain.ApprovalWorkflow, error) {
+	start := time.Now()
+	var workflow domain.ApprovalWorkflow
+	err := s.workflows.FindOne(ctx, bson.M{"_id": approvalWorkflowID(tenantID, subjectType)}).Decode(&workflow)
+	observeMongo("find_one", s.workflows, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrApprovalWorkflowNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approval workflow: %w", err)
+	}
+	return &workflow, nil
+}
+
+// PutWorkflow saves workflow and sets it to its new version. With
+// expectedVersion above zero the workflow is only replaced at that version,
+// and ErrConcurrencyConflict is returned otherwise.
+func (s *ApprovalStore) PutWorkflow(ctx context.Context, workflow *domain.ApprovalWorkflow, expectedVersion int64) error {
+	workflow.ID = approvalWorkflowID(workflow.TenantID, workflow.SubjectType)
+	filter := bson.M{"_id": workflow.ID}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if expectedVersion > 0 {
+		filter["version"] = expectedVersion
+	} else {
+		opts.SetUpsert(true)
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"tenantId":    workflow.TenantID,
+			"subjectType": workflow.SubjectType,
+			"name":        workflow.Name,
+			"steps":       workflow.Steps,
+			"updatedBy":   workflow.UpdatedBy,
+			"updatedAt":   workflow.UpdatedAt,
+		},
+		"$inc": bson.M{"version": int64(1)},
+	}
+
+	start := time.Now()
+	var saved domain.ApprovalWorkflow
+	err := s.workflows.FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved)
+	observeMongo("update", s.workflows, start, err)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("%w: approval workflow %s", ErrConcurrencyConflict, workflow.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save approval workflow: %w", err)
+	}
+	workflow.Version = saved.Version
+	return nil
+}
+
+// DeleteWorkflow removes a workflow. Requests already started from it keep
+// their own copy of its steps.
+func (s *ApprovalStore) DeleteWorkflow(ctx context.Context, tenantID, subjectType string) error {
+	start := time.Now()
+	result, err := s.workflows.DeleteOne(ctx, bson.M{"_id": approvalWorkflowID(tenantID, subjectType)})
+	observeMongo("delete", s.workflows, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete approval workflow: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrApprovalWorkflowNotFound
+	}
+	return nil
+}
+
+// CreateRequest saves a new request, and reports ErrConcurrencyConflict when
+// its subject already has a pending one.
+func (s *ApprovalStore) CreateRequest(ctx context.Context, req *domain.ApprovalRequest) error {
+	start := time.Now()
+	_, err := s.requests.InsertOne(ctx, req)
+	observeMongo("insert", s.requests, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s %s already has a pending approval request", ErrConcurrencyConflict, req.SubjectType, req.SubjectID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create approval request: %w", err)
+	}
+	return nil
+}
+
+func (s *ApprovalStore) GetRequest(ctx context.Context, tenantID, id string) (*domain.ApprovalRequest, error) {
+	return s.findRequest(ctx, bson.M{"_id": id, "tenantId": tenantID})
+}
+
+// FindPending returns the pending request of a subject.
+func (s *ApprovalStore) FindPending(ctx context.Context, tenantID, subjectType, subjectID string) (*domain.ApprovalRequest, error) {
+	return s.findRequest(ctx, bson.M{
+		"tenantId":    tenantID,
+		"subjectType": subjectType,
+		"subjectId":   subjectID,
+		"status":      domain.ApprovalPending,
+	})
+}
+
+func (s *ApprovalStore) findRequest(ctx context.Context, filter bson.M) (*domain.ApprovalRequest, error) {
+	start := time.Now()
+	var req domain.ApprovalRequest
+	err := s.requests.FindOne(ctx, filter).Decode(&req)
+	observeMongo("find_one", s.requests, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrApprovalRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approval request: %w", err)
+	}
+	return &req, nil
+}
+
+// UpdateRequest saves req if it is still at the version it was read at, and
+// reports ErrConcurrencyConflict otherwise.
+func (s *ApprovalStore) UpdateRequest(ctx context.Context, req *domain.ApprovalRequest) error {
+	next := *req
+	next.Version++
+
+	start := time.Now()
+	result, err := s.requests.ReplaceOne(ctx, bson.M{"_id": req.ID, "tenantId": req.TenantID, "version": req.Version}, &next)
+	observeMongo("replace", s.requests, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update approval request: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: approval request %s at version %d", ErrConcurrencyConflict, req.ID, req.Version)
+	}
+	req.Version++
+	return nil
+}
+
+// ApprovalRequestFilter narrows ListRequests. Empty fields match every
+// request.
+type ApprovalRequestFilter struct {
+	Status      domain.ApprovalStatus
+	SubjectType string
+	SubjectID   string
+	// Participant, when set, matches only requests the user requested or
+	// decided.
+	Participant string
+}
+
+// ListRequests returns up to limit requests of tenantID, newest first.
+func (s *ApprovalStore) ListRequests(ctx context.Context, tenantID string, f ApprovalRequestFilter, limit int64) ([]domain.ApprovalRequest, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if f.SubjectType != "" {
+		filter["subjectType"] = f.SubjectType
+	}
+	if f.SubjectID != "" {
+		filter["subjectId"] = f.SubjectID
+	}
+	if f.Participant != "" {
+		filter["$or"] = bson.A{
+			bson.M{"requestedBy": f.Participant},
+			bson.M{"decisions.userId": f.Participant},
+		}
+	}
+	return s.listRequests(ctx, filter, limit)
+}
+
+// Inbox returns up to limit pending requests of tenantID whose current step
+// userID, holding roles, may decide, oldest first. Requests userID made are
+// left out.
+func (s *ApprovalStore) Inbox(ctx context.Context, tenantID, userID string, roles []string, limit int64) ([]domain.ApprovalRequest, error) {
+	approver := bson.A{bson.M{"approverUsers": userID}}
+	if len(roles) > 0 {
+		approver = append(approver, bson.M{"approverRoles": bson.M{"$in": roles}})
+	}
+	filter := bson.M{
+		"tenantId":    tenantID,
+		"status":      domain.ApprovalPending,
+		"requestedBy": bson.M{"$ne": userID},
+		"$or":         approver,
+	}
+	return s.listRequests(ctx, filter, limit, bson.E{Key: "createdAt", Value: 1})
+}
+
+// DueForEscalation returns up to limit pending requests, of every tenant,
+// whose current step was due to escalate by now.
+func (s *ApprovalStore) DueForEscalation(ctx context.Context, now time.Time, limit int64) ([]domain.ApprovalRequest, error) {
+	filter := bson.M{"status": domain.ApprovalPending, "escalateAt": bson.M{"$lte": now}}
+	return s.listRequests(ctx, filter, limit, bson.E{Key: "escalateAt", Value: 1})
+}
+
+func (s *ApprovalStore) listRequests(ctx context.Context, filter bson.M, limit int64, sort ...bson.E) ([]domain.ApprovalRequest, error) {
+	order := bson.D{{Key: "createdAt", Value: -1}}
+	if len(sort) > 0 {
+		order = bson.D(sort)
+	}
+	start := time.Now()
+	cursor, err := s.requests.Find(ctx, filter, options.Find().SetSort(order).SetLimit(limit))
+	observeMongo("find", s.requests, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list approval requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	requests := []domain.ApprovalRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, fmt.Errorf("failed to decode approval requests: %w", err)
+	}
+	return requests, nil
+}
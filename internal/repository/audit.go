@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// appendAttempts bounds how often Append retries after another writer took
+// the sequence number it computed.
+const appendAttempts = 10
+
+var (
+	// ErrAuditEntryExists is returned by AuditStore.Append when the tenant
+	// already has an entry for the entry's source.
+	ErrAuditEntryExists = errors.New("audit entry already exists")
+	ErrAuditAppendRace  = errors.New("audit append kept conflicting with concurrent writers")
+)
+
+// AuditFilter selects audit entries of a tenant. Zero fields match anything.
+// BeforeSequence pages backwards through Search results.
+type AuditFilter struct {
+	TenantID       string
+	UserID         string
+	EntityType     string
+	EntityID       string
+	Action         string
+	From           time.Time
+	To             time.Time
+	BeforeSequence int64
+	Limit          int64
+}
+
+func (f AuditFilter) query() bson.M {
+	query := bson.M{"tenantId": f.TenantID}
+	if f.UserID != "" {
+		query["userId"] = f.UserID
+	}
+	if f.EntityType != "" {
+		query["entityType"] = f.EntityType
+	}
+	if f.EntityID != "" {
+		query["entityId"] = f.EntityID
+	}
+	if f.Action != "" {
+		query["action"] = f.Action
+	}
+	occurred := bson.M{}
+	if !f.From.IsZero() {
+		occurred["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		occurred["$lt"] = f.To
+	}
+	if len(occurred) > 0 {
+		query["occurredAt"] = occurred
+	}
+	if f.BeforeSequence > 0 {
+		query["sequence"] = bson.M{"$lt": f.BeforeSequence}
+	}
+	return query
+}
+
+// AuditStore is the append-only audit log. It has no update or delete
+// operations; entries are only ever inserted at the end of a tenant's chain.
+type AuditStore struct {
+	collection *mongo.Collection
+}
+
+func NewAuditStore(db *MongoDB) *AuditStore {
+	// Nested documents in Data must decode as maps, as they were hashed,
+	// rather than as ordered primitive.D slices.
+	opts := options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})
+	return &AuditStore{collection: db.Database().Collection("audit_log", opts)}
+}
+
+func (s *AuditStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "sequence", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "sourceId", Value: 1}, {Key: "kind", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}, {Key: "sequence", Value: -1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "entityType", Value: 1}, {Key: "entityId", Value: 1}, {Key: "sequence", Value: -1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "occurredAt", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create audit log indexes: %w", err)
+	}
+	return nil
+}
+
+// Append seals entry onto the end of its tenant's chain and stores it. When
+// another writer appends first, the unique sequence index rejects the insert
+// and Append re-reads the chain head and tries again.
+func (s *AuditStore) Append(ctx context.Context, entry *domain.AuditEntry) error {
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	if entry.RecordedAt.IsZero() {
+		entry.RecordedAt = time.Now().UTC()
+	}
+
+	for attempt := 0; attempt < appendAttempts; attempt++ {
+		head, err := s.Head(ctx, entry.TenantID)
+		if err != nil {
+			return err
+		}
+		entry.Seal(head)
+
+		start := time.Now()
+		_, err = s.collection.InsertOne(ctx, entry)
+		observeMongo("insert", s.collection, start, err)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to append audit entry: %w", err)
+		}
+
+		count, err := s.collection.CountDocuments(ctx, bson.M{
+			"tenantId": entry.TenantID,
+			"sourceId": entry.SourceID,
+			"kind":     entry.Kind,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to check audit entry: %w", err)
+		}
+		if count > 0 {
+			return ErrAuditEntryExists
+		}
+	}
+	return ErrAuditAppendRace
+}
+
+// Head returns the last entry of the tenant's chain, or nil if it is empty.
+func (s *AuditStore) Head(ctx context.Context, tenantID string) (*domain.AuditEntry, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})
+
+	var entry domain.AuditEntry
+	start := time.Now()
+	err := s.collection.FindOne(ctx, bson.M{"tenantId": tenantID}, opts).Decode(&entry)
+	observeMongo("find_one", s.collection, start, err)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit chain head: %w", err)
+	}
+	return &entry, nil
+}
+
+// Search returns matching entries, newest first.
+func (s *AuditStore) Search(ctx context.Context, filter AuditFilter) ([]domain.AuditEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: -1}}).SetLimit(filter.Limit)
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter.query(), opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search audit log: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]domain.AuditEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode audit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Each calls fn for every matching entry in chain order, without loading the
+// whole result into memory. It stops at the first error fn returns.
+func (s *AuditStore) Each(ctx context.Context, filter AuditFilter, fn func(*domain.AuditEntry) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter.query(), opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry domain.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return fmt.Errorf("failed to decode audit entry: %w", err)
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
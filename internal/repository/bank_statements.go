@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/fieldcrypt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BankStatementStore keeps imported bank statements in the bank_statements
+// collection and their transactions in bank_transactions.
+type BankStatementStore struct {
+	statements   *mongo.Collection
+	transactions *mongo.Collection
+	keyring      *fieldcrypt.Keyring
+}
+
+func NewBankStatementStore(db *MongoDB) *BankStatementStore {
+	return &BankStatementStore{
+		statements:   db.Collection("bank_statements"),
+		transactions: db.Collection("bank_transactions"),
+	}
+}
+
+// WithEncryption makes the store encrypt the counterparty IBANs of the
+// transactions it saves with keyring, and look them up by their hash.
+func (s *BankStatementStore) WithEncryption(keyring *fieldcrypt.Keyring) *BankStatementStore {
+	s.keyring = keyring
+	return s
+}
+
+// seal returns a copy of transaction as stored, with its counterparty IBAN
+// encrypted.
+func (s *BankStatementStore) seal(transaction *domain.BankTransaction) (*domain.BankTransaction, error) {
+	if s.keyring == nil || transaction.CounterpartyIBAN == "" {
+		return transaction, nil
+	}
+	sealed := *transaction
+	if !fieldcrypt.IsEncrypted(sealed.CounterpartyIBAN) {
+		sealed.CounterpartyIBANHash = s.keyring.Hash(sealed.CounterpartyIBAN)
+	}
+	iban, err := s.keyring.Encrypt(sealed.CounterpartyIBAN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt counterparty IBAN: %w", err)
+	}
+	sealed.CounterpartyIBAN = iban
+	return &sealed, nil
+}
+
+func (s *BankStatementStore) open(transaction *domain.BankTransaction) error {
+	iban, err := s.keyring.Decrypt(transaction.CounterpartyIBAN)
+	if err != nil {
+		return fmt.Errorf("bank transaction %s: %w", transaction.ID, err)
+	}
+	transaction.CounterpartyIBAN = iban
+	transaction.CounterpartyIBANHash = ""
+	return nil
+}
+
+// EnsureIndexes creates the store's indexes. A file is imported once per
+// tenant, and a transaction once per account.
+func (s *BankStatementStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.statements.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "fingerprint", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("statement_per_file"),
+		},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "importedAt", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create bank statement indexes: %w", err)
+	}
+	_, err = s.transactions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "tenantId", Value: 1},
+				{Key: "accountIban", Value: 1},
+				{Key: "entryReference", Value: 1},
+			},
+			Options: options.Index().SetUnique(true).SetName("transaction_per_account"),
+		},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "bookingDate", Value: -1}}},
+		{Keys: bson.D{{Key: "statementId", Value: 1}, {Key: "bookingDate", Value: 1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "counterpartyIban", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "counterpartyIbanHash", Value: 1}, {Key: "status", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create bank transaction indexes: %w", err)
+	}
+	return nil
+}
+
+// CreateStatement saves an imported statement with its transactions, and
+// reports ErrConcurrencyConflict when the same file was imported before.
+func (s *BankStatementStore) CreateStatement(ctx context.Context, statement *domain.BankStatement, transactions []*domain.BankTransaction) error {
+	start := time.Now()
+	_, err := s.statements.InsertOne(ctx, statement)
+	observeMongo("insert", s.statements, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: statement already imported", ErrConcurrencyConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create bank statement: %w", err)
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(transactions))
+	for i, transaction := range transactions {
+		sealed, err := s.seal(transaction)
+		if err != nil {
+			return err
+		}
+		documents[i] = sealed
+	}
+	start = time.Now()
+	_, err = s.transactions.InsertMany(ctx, documents)
+	observeMongo("insert_many", s.transactions, start, err)
+	if err == nil {
+		return nil
+	}
+	// Take the statement back, so that the file can be imported again.
+	if _, deleteErr := s.statements.DeleteOne(ctx, bson.M{"_id": statement.ID}); deleteErr != nil {
+		return fmt.Errorf("failed to create bank transactions: %w (and to remove statement: %v)", err, deleteErr)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: transactions of the statement were imported concurrently", ErrConcurrencyConflict)
+	}
+	return fmt.Errorf("failed to create bank transactions: %w", err)
+}
+
+func (s *BankStatementStore) FindStatement(ctx context.Context, id uuid.UUID) (*domain.BankStatement, error) {
+	start := time.Now()
+	var statement domain.BankStatement
+	err := s.statements.FindOne(ctx, bson.M{"_id": id}).Decode(&statement)
+	observeMongo("find_one", s.statements, start, err)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("bank statement not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to find bank statement: %w", err)
+	}
+	return &statement, nil
+}
+
+// ListStatements returns a tenant's statements, latest import first.
+func (s *BankStatementStore) ListStatements(ctx context.Context, tenantID uuid.UUID, limit int64) ([]*domain.BankStatement, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "importedAt", Value: -1}}).SetLimit(limit)
+
+	start := time.Now()
+	cursor, err := s.statements.Find(ctx, bson.M{"tenantId": tenantID}, opts)
+	observeMongo("find", s.statements, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bank statements: %w", err)
+	}
+	statements := []*domain.BankStatement{}
+	if err := cursor.All(ctx, &statements); err != nil {
+		return nil, fmt.Errorf("failed to decode bank statements: %w", err)
+	}
+	return statements, nil
+}
+
+// ExistingReferences returns which of references the tenant has already
+// imported transactions of for account.
+func (s *BankStatementStore) ExistingReferences(ctx context.Context, tenantID uuid.UUID, account string, references []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	err := eachDocument(ctx, s.transactions, bson.M{
+		"tenantId":       tenantID,
+		"accountIban":    account,
+		"entryReference": bson.M{"$in": references},
+	}, func(cursor *mongo.Cursor) error {
+		var transaction struct {
+			EntryReference string `bson:"entryReference"`
+		}
+		if err := cursor.Decode(&transaction); err != nil {
+			return fmt.Errorf("failed to decode bank transaction: %w", err)
+		}
+		existing[transaction.EntryReference] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *BankStatementStore) FindTransaction(ctx context.Context, id uuid.UUID) (*domain.BankTransaction, error) {
+	start := time.Now()
+	var transaction domain.BankTransaction
+	err := s.transactions.FindOne(ctx, bson.M{"_id": id}).Decode(&transaction)
+	observeMongo("find_one", s.transactions, start, err)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("bank transaction not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to find bank transaction: %w", err)
+	}
+	if err := s.open(&transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// ListTransactions returns a tenant's transactions, of one statement
+// unless statementID is nil and in one status unless status is empty.
+// Those of a statement are listed in booking order, others latest first.
+func (s *BankStatementStore) ListTransactions(ctx context.Context, tenantID uuid.UUID, statementID *uuid.UUID, status domain.BankTransactionStatus, limit int64) ([]*domain.BankTransaction, error) {
+	filter := bson.M{"tenantId": tenantID}
+	sort := bson.D{{Key: "bookingDate", Value: -1}}
+	if statementID != nil {
+		filter["statementId"] = *statementID
+		sort = bson.D{{Key: "bookingDate", Value: 1}}
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(sort).SetLimit(limit)
+
+	start := time.Now()
+	cursor, err := s.transactions.Find(ctx, filter, opts)
+	observeMongo("find", s.transactions, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bank transactions: %w", err)
+	}
+	transactions := []*domain.BankTransaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode bank transactions: %w", err)
+	}
+	for _, transaction := range transactions {
+		if err := s.open(transaction); err != nil {
+			return nil, err
+		}
+	}
+	return transactions, nil
+}
+
+// UpdateTransaction saves transaction if it is still at the version it was
+// read at, and reports ErrConcurrencyConflict otherwise.
+func (s *BankStatementStore) UpdateTransaction(ctx context.Context, transaction *domain.BankTransaction) error {
+	next, err := s.seal(transaction)
+	if err != nil {
+		return err
+	}
+	if next == transaction {
+		copied := *transaction
+		next = &copied
+	}
+	next.Version++
+
+	start := time.Now()
+	result, err := s.transactions.ReplaceOne(ctx, bson.M{"_id": transaction.ID, "version": transaction.Version}, next)
+	observeMongo("replace", s.transactions, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update bank transaction: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: bank transaction %s at version %d", ErrConcurrencyConflict, transaction.ID, transaction.Version)
+	}
+	transaction.Version++
+	return nil
+}
+
+// FindPayers returns the clients whose invoices credits from iban were
+// matched to before.
+func (s *BankStatementStore) FindPayers(ctx context.Context, tenantID uuid.UUID, iban string) ([]uuid.UUID, error) {
+	filter := bson.M{
+		"tenantId":         tenantID,
+		"counterpartyIban": iban,
+		"status":           domain.BankTransactionMatched,
+	}
+	if s.keyring != nil {
+		delete(filter, "counterpartyIban")
+		filter["counterpartyIbanHash"] = s.keyring.Hash(iban)
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	payers := []uuid.UUID{}
+	err := eachDocument(ctx, s.transactions, filter, func(cursor *mongo.Cursor) error {
+		var transaction struct {
+			ClientID *uuid.UUID `bson:"clientId"`
+		}
+		if err := cursor.Decode(&transaction); err != nil {
+			return fmt.Errorf("failed to decode bank transaction: %w", err)
+		}
+		if transaction.ClientID != nil && !seen[*transaction.ClientID] {
+			seen[*transaction.ClientID] = true
+			payers = append(payers, *transaction.ClientID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payers, nil
+}
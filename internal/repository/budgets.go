@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BudgetStore keeps tenants' monthly budgets in the budgets collection and
+// the alerts raised on them in budget_alerts, and reads the invoices,
+// payments and cash sessions actuals are derived from.
+type BudgetStore struct {
+	budgets      *mongo.Collection
+	alerts       *mongo.Collection
+	invoices     *mongo.Collection
+	payments     *mongo.Collection
+	cashSessions *mongo.Collection
+	products     *mongo.Collection
+}
+
+func NewBudgetStore(db *MongoDB) *BudgetStore {
+	return &BudgetStore{
+		budgets:      db.Collection("budgets"),
+		alerts:       db.Collection("budget_alerts"),
+		invoices:     db.Collection("invoices"),
+		payments:     db.Collection("payments"),
+		cashSessions: db.Collection("cash_sessions"),
+		products:     db.Collection("products"),
+	}
+}
+
+// EnsureIndexes creates the store's indexes. A tenant has one budget per
+// month.
+func (s *BudgetStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.budgets.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "period", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("budget_per_month"),
+		},
+		{Keys: bson.D{{Key: "period", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create budget indexes: %w", err)
+	}
+	_, err = s.alerts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "period", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create budget alert indexes: %w", err)
+	}
+	_, err = s.invoices.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "issueDate", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create invoice issue date indexes: %w", err)
+	}
+	return nil
+}
+
+// Create saves a new budget, and reports ErrConcurrencyConflict when the
+// tenant already has one for its month.
+func (s *BudgetStore) Create(ctx context.Context, budget *domain.Budget) error {
+	start := time.Now()
+	_, err := s.budgets.InsertOne(ctx, budget)
+	observeMongo("insert", s.budgets, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: budget for %s already exists", ErrConcurrencyConflict, budget.Period)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create budget: %w", err)
+	}
+	return nil
+}
+
+// FindByPeriod returns the tenant's budget for period, or nil when it has
+// none.
+func (s *BudgetStore) FindByPeriod(ctx context.Context, tenantID uuid.UUID, period string) (*domain.Budget, error) {
+	start := time.Now()
+	var budget domain.Budget
+	err := s.budgets.FindOne(ctx, bson.M{"tenantId": tenantID, "period": period}).Decode(&budget)
+	observeMongo("find_one", s.budgets, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find budget: %w", err)
+	}
+	return &budget, nil
+}
+
+// List returns the tenant's budgets for the months from and to, inclusive,
+// oldest first.
+func (s *BudgetStore) List(ctx context.Context, tenantID uuid.UUID, from, to string) ([]*domain.Budget, error) {
+	return s.find(ctx, bson.M{"tenantId": tenantID, "period": bson.M{"$gte": from, "$lte": to}})
+}
+
+// FindForPeriods returns the budgets of every tenant for any of periods.
+func (s *BudgetStore) FindForPeriods(ctx context.Context, periods []string) ([]*domain.Budget, error) {
+	return s.find(ctx, bson.M{"period": bson.M{"$in": periods}})
+}
+
+func (s *BudgetStore) find(ctx context.Context, filter bson.M) ([]*domain.Budget, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "period", Value: 1}, {Key: "tenantId", Value: 1}})
+
+	start := time.Now()
+	cursor, err := s.budgets.Find(ctx, filter, opts)
+	observeMongo("find", s.budgets, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budgets: %w", err)
+	}
+	budgets := []*domain.Budget{}
+	if err := cursor.All(ctx, &budgets); err != nil {
+		return nil, fmt.Errorf("failed to decode budgets: %w", err)
+	}
+	return budgets, nil
+}
+
+// Update saves budget if it is still at the version it was read at, and
+// reports ErrConcurrencyConflict otherwise.
+func (s *BudgetStore) Update(ctx context.Context, budget *domain.Budget) error {
+	next := *budget
+	next.Version++
+
+	start := time.Now()
+	result, err := s.budgets.ReplaceOne(ctx, bson.M{"_id": budget.ID, "version": budget.Version}, &next)
+	observeMongo("replace", s.budgets, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update budget: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: budget %s at version %d", ErrConcurrencyConflict, budget.ID, budget.Version)
+	}
+	budget.Version++
+	return nil
+}
+
+// Delete deletes a budget and its alerts.
+func (s *BudgetStore) Delete(ctx context.Context, budget *domain.Budget) error {
+	start := time.Now()
+	_, err := s.budgets.DeleteOne(ctx, bson.M{"_id": budget.ID})
+	observeMongo("delete", s.budgets, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+	start = time.Now()
+	_, err = s.alerts.DeleteMany(ctx, bson.M{"budgetId": budget.ID})
+	observeMongo("delete_many", s.alerts, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete budget alerts: %w", err)
+	}
+	return nil
+}
+
+// EachInvoice calls fn with the tenant's invoices issued in [from, to).
+func (s *BudgetStore) EachInvoice(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Invoice) error) error {
+	return eachDocument(ctx, s.invoices, bson.M{
+		"tenantId":  tenantID,
+		"issueDate": bson.M{"$gte": from, "$lt": to},
+	}, func(cursor *mongo.Cursor) error {
+		var invoice domain.Invoice
+		if err := cursor.Decode(&invoice); err != nil {
+			return fmt.Errorf("failed to decode invoice: %w", err)
+		}
+		return fn(&invoice)
+	})
+}
+
+// EachPayment calls fn with the tenant's payments processed or refunded in
+// [from, to).
+func (s *BudgetStore) EachPayment(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Payment) error) error {
+	return eachDocument(ctx, s.payments, bson.M{
+		"tenantId": tenantID,
+		"$or": bson.A{
+			bson.M{"processedAt": bson.M{"$gte": from, "$lt": to}},
+			bson.M{"status": domain.PaymentStatusRefunded, "updatedAt": bson.M{"$gte": from, "$lt": to}},
+		},
+	}, func(cursor *mongo.Cursor) error {
+		var payment domain.Payment
+		if err := cursor.Decode(&payment); err != nil {
+			return fmt.Errorf("failed to decode payment: %w", err)
+		}
+		return fn(&payment)
+	})
+}
+
+// EachCashSession calls fn with the tenant's cash sessions that had cash
+// recorded in [from, to).
+func (s *BudgetStore) EachCashSession(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.CashSession) error) error {
+	return eachDocument(ctx, s.cashSessions, bson.M{
+		"tenantId":           tenantID,
+		"entries.recordedAt": bson.M{"$gte": from, "$lt": to},
+	}, func(cursor *mongo.Cursor) error {
+		var session domain.CashSession
+		if err := cursor.Decode(&session); err != nil {
+			return fmt.Errorf("failed to decode cash session: %w", err)
+		}
+		return fn(&session)
+	})
+}
+
+// FindCategories returns the category of each of the tenant's products.
+func (s *BudgetStore) FindCategories(ctx context.Context, tenantID uuid.UUID) (map[uuid.UUID]string, error) {
+	categories := make(map[uuid.UUID]string)
+	err := eachDocument(ctx, s.products, bson.M{"tenantId": tenantID}, func(cursor *mongo.Cursor) error {
+		var product domain.Product
+		if err := cursor.Decode(&product); err != nil {
+			return fmt.Errorf("failed to decode product: %w", err)
+		}
+		categories[product.ID] = string(product.Category)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// OpenAlerts returns the tenant's raised budget alerts, of one month unless
+// period is empty, latest month first.
+func (s *BudgetStore) OpenAlerts(ctx context.Context, tenantID uuid.UUID, period string) ([]domain.BudgetAlert, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if period != "" {
+		filter["period"] = period
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "period", Value: -1}, {Key: "_id", Value: 1}})
+
+	start := time.Now()
+	cursor, err := s.alerts.Find(ctx, filter, opts)
+	observeMongo("find", s.alerts, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budget alerts: %w", err)
+	}
+	alerts := []domain.BudgetAlert{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, fmt.Errorf("failed to decode budget alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// SaveAlerts replaces the alerts of a budget with alerts, keeping when
+// those already raised were, and returns the alerts that are new.
+func (s *BudgetStore) SaveAlerts(ctx context.Context, budget *domain.Budget, alerts []domain.BudgetAlert) ([]domain.BudgetAlert, error) {
+	open, err := s.OpenAlerts(ctx, budget.TenantID, budget.Period)
+	if err != nil {
+		return nil, err
+	}
+	raisedAt := make(map[string]time.Time, len(open))
+	for _, alert := range open {
+		raisedAt[alert.ID] = alert.RaisedAt
+	}
+
+	var raised []domain.BudgetAlert
+	ids := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		if at, ok := raisedAt[alert.ID]; ok {
+			alert.RaisedAt = at
+		} else {
+			raised = append(raised, alert)
+		}
+		ids = append(ids, alert.ID)
+
+		start := time.Now()
+		_, err := s.alerts.ReplaceOne(ctx, bson.M{"_id": alert.ID}, alert, options.Replace().SetUpsert(true))
+		observeMongo("upsert", s.alerts, start, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save budget alert: %w", err)
+		}
+	}
+
+	start := time.Now()
+	_, err = s.alerts.DeleteMany(ctx, bson.M{"budgetId": budget.ID, "_id": bson.M{"$nin": ids}})
+	observeMongo("delete_many", s.alerts, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear budget alerts: %w", err)
+	}
+	return raised, nil
+}
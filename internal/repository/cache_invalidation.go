@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Cached read models follow one key convention so that a change can be
+// evicted without knowing every view built on it. Keys are
+// "<entity>:<view>:<params>", where entity is the lower-cased aggregate type.
+// A view of a single entity embeds its ID (client:detail:<id>); a view
+// spanning a tenant's entities embeds the tenant ID (client:list:<tenant>:...).
+// Redis is shared by every replica, so evicting once evicts everywhere.
+
+// CacheEntity returns the key namespace for an aggregate type.
+func CacheEntity(aggregateType string) string {
+	return strings.ToLower(aggregateType)
+}
+
+// InvalidateEntity evicts every cached view of entity that embeds one of ids
+// or tenantID: the views of the changed entities and the tenant-wide lists
+// and statistics they appear in.
+func (c *Cache) InvalidateEntity(ctx context.Context, entity, tenantID string, ids ...string) error {
+	var errs []error
+	for _, part := range append(ids, tenantID) {
+		if part == "" {
+			continue
+		}
+		if err := c.DeletePattern(ctx, entity+":*"+escapeGlob(part)+"*"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// escapeGlob quotes the characters SCAN MATCH treats as wildcards.
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(s)
+}
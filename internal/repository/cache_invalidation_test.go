@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRedis answers SCAN and DEL from an in-memory key set instead of
+// sending them to a server. SCAN returns every match in one page.
+type memoryRedis struct {
+	keys    map[string]bool
+	scanErr error
+}
+
+func (m *memoryRedis) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (m *memoryRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (m *memoryRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		args := cmd.Args()
+		switch cmd := cmd.(type) {
+		case *redis.ScanCmd:
+			if m.scanErr != nil {
+				cmd.SetErr(m.scanErr)
+				return m.scanErr
+			}
+			var page []string
+			for key := range m.keys {
+				if ok, _ := path.Match(args[3].(string), key); ok {
+					page = append(page, key)
+				}
+			}
+			sort.Strings(page)
+			cmd.SetVal(page, 0)
+		case *redis.IntCmd:
+			var deleted int64
+			for _, arg := range args[1:] {
+				if m.keys[arg.(string)] {
+					delete(m.keys, arg.(string))
+					deleted++
+				}
+			}
+			cmd.SetVal(deleted)
+		}
+		return nil
+	}
+}
+
+func (m *memoryRedis) remaining() []string {
+	keys := make([]string, 0, len(m.keys))
+	for key := range m.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newMemoryCache(t *testing.T, keys ...string) (*Cache, *memoryRedis) {
+	mem := &memoryRedis{keys: make(map[string]bool)}
+	for _, key := range keys {
+		mem.keys["t:erp:"+key] = true
+	}
+	client := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	client.AddHook(mem)
+	t.Cleanup(func() { _ = client.Close() })
+
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	return NewCache(&Redis{client: client, logger: log}, "t:erp", log), mem
+}
+
+func TestCacheEntity(t *testing.T) {
+	assert.Equal(t, "client", CacheEntity("Client"))
+	assert.Equal(t, "invoice", CacheEntity("invoice"))
+}
+
+func TestCache_InvalidateEntity(t *testing.T) {
+	cache, mem := newMemoryCache(t,
+		"client:detail:c1",
+		"client:credit:c1",
+		"client:detail:c2",
+		"client:list:tenant-a:page=1",
+		"client:stats:tenant-a",
+		"client:list:tenant-b:page=1",
+		"invoice:detail:c1",
+	)
+
+	require.NoError(t, cache.InvalidateEntity(context.Background(), "client", "tenant-a", "c1"))
+	assert.Equal(t, []string{
+		"t:erp:client:detail:c2",
+		"t:erp:client:list:tenant-b:page=1",
+		"t:erp:invoice:detail:c1",
+	}, mem.remaining(), "the entity's views and its tenant's lists are evicted; other entities, tenants and namespaces are kept")
+
+	require.NoError(t, cache.InvalidateEntity(context.Background(), "client", "", "c2"))
+	assert.NotContains(t, mem.remaining(), "t:erp:client:detail:c2", "an event without a tenant still evicts its entities")
+}
+
+func TestCache_InvalidateEntityEscapesPatterns(t *testing.T) {
+	cache, mem := newMemoryCache(t, "client:detail:c1", "client:detail:c2")
+
+	require.NoError(t, cache.InvalidateEntity(context.Background(), "client", "tenant-a", "c*"))
+	assert.Len(t, mem.remaining(), 2, "IDs are matched literally")
+	assert.Equal(t, `a\*b\?c\[d\]e\\f`, escapeGlob(`a*b?c[d]e\f`))
+}
+
+func TestCache_InvalidateEntityReportsFailures(t *testing.T) {
+	cache, mem := newMemoryCache(t, "client:detail:c1")
+	mem.scanErr = errors.New("connection refused")
+
+	err := cache.InvalidateEntity(context.Background(), "client", "tenant-a", "c1")
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 2, len(err.(interface{ Unwrap() []error }).Unwrap()), "every pattern is attempted")
+}
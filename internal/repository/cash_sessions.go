@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CashSessionStore keeps cash drawer sessions, with their entries, in the
+// cash_sessions collection.
+type CashSessionStore struct {
+	collection *mongo.Collection
+}
+
+func NewCashSessionStore(db *MongoDB) *CashSessionStore {
+	return &CashSessionStore{collection: db.Collection("cash_sessions")}
+}
+
+// EnsureIndexes creates the store's indexes. A register has at most one
+// open session, which the partial unique index enforces against two
+// sessions being opened at once.
+func (s *CashSessionStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "registerId", Value: 1}, {Key: "openedAt", Value: -1}}},
+		{
+			Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "registerId", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": domain.CashSessionStatusOpen}).
+				SetName("open_session_per_register"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create cash session indexes: %w", err)
+	}
+	return nil
+}
+
+// Create saves a new session, and reports ErrConcurrencyConflict when its
+// register already has an open one.
+func (s *CashSessionStore) Create(ctx context.Context, session *domain.CashSession) error {
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, session)
+	observeMongo("insert", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: register %s already has an open session", ErrConcurrencyConflict, session.RegisterID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create cash session: %w", err)
+	}
+	return nil
+}
+
+func (s *CashSessionStore) FindByID(ctx context.Context, id uuid.UUID) (*domain.CashSession, error) {
+	start := time.Now()
+	var session domain.CashSession
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	observeMongo("find_one", s.collection, start, err)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("cash session not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to find cash session: %w", err)
+	}
+	return &session, nil
+}
+
+// FindOpen returns the open session of a register, or nil when it has none.
+func (s *CashSessionStore) FindOpen(ctx context.Context, tenantID uuid.UUID, registerID string) (*domain.CashSession, error) {
+	start := time.Now()
+	var session domain.CashSession
+	err := s.collection.FindOne(ctx, bson.M{
+		"tenantId":   tenantID,
+		"registerId": registerID,
+		"status":     domain.CashSessionStatusOpen,
+	}).Decode(&session)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find open cash session: %w", err)
+	}
+	return &session, nil
+}
+
+// Update saves session if it is still at the version it was read at, and
+// reports ErrConcurrencyConflict otherwise.
+func (s *CashSessionStore) Update(ctx context.Context, session *domain.CashSession) error {
+	next := *session
+	next.Version++
+
+	start := time.Now()
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": session.ID, "version": session.Version}, &next)
+	observeMongo("replace", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update cash session: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: cash session %s at version %d", ErrConcurrencyConflict, session.ID, session.Version)
+	}
+	session.Version++
+	return nil
+}
+
+// List returns a tenant's sessions, newest first, optionally of one
+// register and in one status.
+func (s *CashSessionStore) List(ctx context.Context, tenantID uuid.UUID, registerID string, status domain.CashSessionStatus, limit int64) ([]*domain.CashSession, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if registerID != "" {
+		filter["registerId"] = registerID
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "openedAt", Value: -1}}).SetLimit(limit)
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cash sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*domain.CashSession{}
+	for cursor.Next(ctx) {
+		var session domain.CashSession
+		if err := cursor.Decode(&session); err != nil {
+			return nil, fmt.Errorf("failed to decode cash session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cash sessions: %w", err)
+	}
+	return sessions, nil
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	CommandStatusPending   = "pending"
+	CommandStatusRunning   = "running"
+	CommandStatusSucceeded = "succeeded"
+	CommandStatusFailed    = "failed"
+)
+
+var (
+	ErrCommandJobNotFound = errors.New("command job not found")
+	// ErrDuplicateCommand is returned by Create for a command ID that was
+	// already accepted.
+	ErrDuplicateCommand = errors.New("command already accepted")
+)
+
+// CommandJobError is the error a failed command returned.
+type CommandJobError struct {
+	Code    string      `bson:"code" json:"code"`
+	Message string      `bson:"message" json:"message"`
+	Details interface{} `bson:"details,omitempty" json:"details,omitempty"`
+}
+
+// CommandJob is a command accepted for background handling. Its ID is the
+// command ID. Command and Result hold the JSON of the command envelope and of
+// the handler's result; the job is removed by a TTL index after ExpiresAt.
+type CommandJob struct {
+	ID          string           `bson:"_id" json:"commandId"`
+	TenantID    string           `bson:"tenantId" json:"tenantId"`
+	UserID      string           `bson:"userId,omitempty" json:"userId,omitempty"`
+	Type        string           `bson:"type" json:"type"`
+	Command     string           `bson:"command" json:"-"`
+	Status      string           `bson:"status" json:"status"`
+	Owner       string           `bson:"owner,omitempty" json:"-"`
+	Result      string           `bson:"result,omitempty" json:"-"`
+	Error       *CommandJobError `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time        `bson:"createdAt" json:"createdAt"`
+	StartedAt   *time.Time       `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	HeartbeatAt *time.Time       `bson:"heartbeatAt,omitempty" json:"-"`
+	FinishedAt  *time.Time       `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+	ExpiresAt   time.Time        `bson:"expiresAt" json:"expiresAt"`
+}
+
+type CommandJobStore struct {
+	collection *mongo.Collection
+}
+
+func NewCommandJobStore(db *MongoDB) *CommandJobStore {
+	return &CommandJobStore{collection: db.Collection("command_jobs")}
+}
+
+func (s *CommandJobStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create command job indexes: %w", err)
+	}
+	return nil
+}
+
+// Create stores job as pending, to be removed after retention unless it
+// finishes and is given a new expiry.
+func (s *CommandJobStore) Create(ctx context.Context, job *CommandJob, retention time.Duration) error {
+	job.Status = CommandStatusPending
+	job.CreatedAt = time.Now().UTC()
+	job.ExpiresAt = job.CreatedAt.Add(retention)
+
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, job)
+	observeMongo("insert", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrDuplicateCommand, job.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create command job: %w", err)
+	}
+	return nil
+}
+
+func (s *CommandJobStore) Get(ctx context.Context, id string) (*CommandJob, error) {
+	start := time.Now()
+	var job CommandJob
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCommandJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command job: %w", err)
+	}
+	return &job, nil
+}
+
+// CountPending returns how many of tenantID's commands wait to be handled.
+func (s *CommandJobStore) CountPending(ctx context.Context, tenantID string) (int64, error) {
+	start := time.Now()
+	count, err := s.collection.CountDocuments(ctx, bson.M{"tenantId": tenantID, "status": CommandStatusPending})
+	observeMongo("count", s.collection, start, err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count command jobs: %w", err)
+	}
+	return count, nil
+}
+
+// Running returns the number of running commands per tenant whose heartbeat
+// is younger than staleAfter.
+func (s *CommandJobStore) Running(ctx context.Context, staleAfter time.Duration) (map[string]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"status":      CommandStatusRunning,
+			"heartbeatAt": bson.M{"$gte": time.Now().UTC().Add(-staleAfter)},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$tenantId", "count": bson.M{"$sum": 1}}}},
+	}
+
+	start := time.Now()
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	observeMongo("aggregate", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count running command jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		TenantID string `bson:"_id"`
+		Count    int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode running command jobs: %w", err)
+	}
+	running := make(map[string]int, len(rows))
+	for _, row := range rows {
+		running[row.TenantID] = row.Count
+	}
+	return running, nil
+}
+
+// Claim assigns the oldest pending command of a tenant not in busy to owner.
+func (s *CommandJobStore) Claim(ctx context.Context, owner string, busy []string) (*CommandJob, error) {
+	now := time.Now().UTC()
+	filter := bson.M{"status": CommandStatusPending}
+	if len(busy) > 0 {
+		filter["tenantId"] = bson.M{"$nin": busy}
+	}
+	update := bson.M{"$set": bson.M{
+		"status":      CommandStatusRunning,
+		"owner":       owner,
+		"startedAt":   now,
+		"heartbeatAt": now,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	start := time.Now()
+	var job CommandJob
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	observeMongo("find_one_and_update", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim command job: %w", err)
+	}
+	return &job, nil
+}
+
+// Heartbeat tells other replicas that owner is still handling job.
+func (s *CommandJobStore) Heartbeat(ctx context.Context, job *CommandJob) error {
+	start := time.Now()
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": job.ID, "owner": job.Owner, "status": CommandStatusRunning}, bson.M{"$set": bson.M{
+		"heartbeatAt": time.Now().UTC(),
+	}})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update command job: %w", err)
+	}
+	return nil
+}
+
+// Finish moves job to a terminal status and restarts its retention. A job
+// FailStale has given up on keeps its failure.
+func (s *CommandJobStore) Finish(ctx context.Context, job *CommandJob, retention time.Duration) error {
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	job.ExpiresAt = now.Add(retention)
+
+	start := time.Now()
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": job.ID, "owner": job.Owner, "status": CommandStatusRunning}, bson.M{"$set": bson.M{
+		"status":     job.Status,
+		"result":     job.Result,
+		"error":      job.Error,
+		"finishedAt": now,
+		"expiresAt":  job.ExpiresAt,
+	}})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to finish command job: %w", err)
+	}
+	return nil
+}
+
+// FailStale fails running commands whose heartbeat is older than
+// staleAfter. Their replica stopped while handling them, so whether they
+// took effect is unknown and they are not run again.
+func (s *CommandJobStore) FailStale(ctx context.Context, staleAfter time.Duration, retention time.Duration) (int64, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"status":      CommandStatusRunning,
+		"heartbeatAt": bson.M{"$lt": now.Add(-staleAfter)},
+	}
+	update := bson.M{"$set": bson.M{
+		"status": CommandStatusFailed,
+		"error": CommandJobError{
+			Code:    "UNKNOWN",
+			Message: "the command was interrupted; check whether it took effect before retrying",
+		},
+		"finishedAt": now,
+		"expiresAt":  now.Add(retention),
+	}}
+
+	start := time.Now()
+	result, err := s.collection.UpdateMany(ctx, filter, update)
+	observeMongo("update_many", s.collection, start, err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail stale command jobs: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
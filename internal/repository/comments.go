@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrCommentNotFound = errors.New("comment not found")
+
+// CommentStore keeps the comments left on entities. Deleted comments stay
+// in the trash so their history can be audited.
+type CommentStore struct {
+	collection *mongo.Collection
+}
+
+func NewCommentStore(db *MongoDB) *CommentStore {
+	return &CommentStore{collection: db.Collection("comments")}
+}
+
+func (s *CommentStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "entityType", Value: 1}, {Key: "entityId", Value: 1}, {Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create comment indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *CommentStore) Add(ctx context.Context, comment *domain.Comment) error {
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, comment)
+	observeMongo("insert", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to add comment: %w", err)
+	}
+	return nil
+}
+
+// Get returns a comment of tenantID, also when it is deleted.
+func (s *CommentStore) Get(ctx context.Context, tenantID, id string) (*domain.Comment, error) {
+	start := time.Now()
+	var comment domain.Comment
+	err := s.collection.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&comment)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+	return &comment, nil
+}
+
+// List returns up to limit comments left on an entity, oldest first.
+func (s *CommentStore) List(ctx context.Context, tenantID, entityType, entityID string, limit int) ([]domain.Comment, error) {
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx,
+		NotDeleted(bson.M{"tenantId": tenantID, "entityType": entityType, "entityId": entityID}),
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(int64(limit)))
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	comments := []domain.Comment{}
+	if err := cursor.All(ctx, &comments); err != nil {
+		return nil, fmt.Errorf("failed to decode comments: %w", err)
+	}
+	return comments, nil
+}
+
+// Save replaces a comment that is not deleted, after an edit or on delete.
+func (s *CommentStore) Save(ctx context.Context, comment *domain.Comment) error {
+	start := time.Now()
+	result, err := s.collection.ReplaceOne(ctx,
+		NotDeleted(bson.M{"_id": comment.ID, "tenantId": comment.TenantID}), comment)
+	observeMongo("replace", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to save comment: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrCommentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ConsolidatedBillingStore keeps which clients are billed on consolidated
+// invoices, one entry per client, and reads the delivered orders those
+// invoices bill.
+type ConsolidatedBillingStore struct {
+	billing *mongo.Collection
+	orders  *mongo.Collection
+}
+
+func NewConsolidatedBillingStore(db *MongoDB) *ConsolidatedBillingStore {
+	return &ConsolidatedBillingStore{
+		billing: db.Collection("consolidated_billing"),
+		orders:  db.Collection("orders"),
+	}
+}
+
+// EnsureIndexes creates the store's indexes.
+func (s *ConsolidatedBillingStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.billing.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "clientId", Value: 1}},
+		Options: options.Index().SetName("client_billing").SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consolidated billing indexes: %w", err)
+	}
+	_, err = s.orders.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "clientId", Value: 1}, {Key: "deliveredDate", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create order delivery indexes: %w", err)
+	}
+	return nil
+}
+
+// Save sets how the client is billed, keeping the ID, creation time and
+// last billed period of an existing entry, and returns the entry saved.
+func (s *ConsolidatedBillingStore) Save(ctx context.Context, billing *domain.ConsolidatedBilling) (*domain.ConsolidatedBilling, error) {
+	start := time.Now()
+	var saved domain.ConsolidatedBilling
+	err := s.billing.FindOneAndUpdate(ctx,
+		bson.M{"tenantId": billing.TenantID, "clientId": billing.ClientID},
+		bson.M{
+			"$set": bson.M{
+				"frequency":   billing.Frequency,
+				"paymentTerm": billing.PaymentTerm,
+				"updatedBy":   billing.UpdatedBy,
+				"updatedAt":   billing.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{"_id": billing.ID, "createdAt": billing.CreatedAt},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	observeMongo("update", s.billing, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save consolidated billing: %w", err)
+	}
+	return &saved, nil
+}
+
+// List returns the tenant's consolidated billing, by client.
+func (s *ConsolidatedBillingStore) List(ctx context.Context, tenantID uuid.UUID, limit int64) ([]*domain.ConsolidatedBilling, error) {
+	start := time.Now()
+	cursor, err := s.billing.Find(ctx, bson.M{"tenantId": tenantID},
+		options.Find().SetSort(bson.D{{Key: "clientId", Value: 1}}).SetLimit(limit))
+	observeMongo("find", s.billing, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find consolidated billing: %w", err)
+	}
+	billing := []*domain.ConsolidatedBilling{}
+	if err := cursor.All(ctx, &billing); err != nil {
+		return nil, fmt.Errorf("failed to decode consolidated billing: %w", err)
+	}
+	return billing, nil
+}
+
+// Delete stops billing the client on consolidated invoices and reports
+// whether it was.
+func (s *ConsolidatedBillingStore) Delete(ctx context.Context, tenantID, clientID uuid.UUID) (bool, error) {
+	start := time.Now()
+	result, err := s.billing.DeleteOne(ctx, bson.M{"tenantId": tenantID, "clientId": clientID})
+	observeMongo("delete", s.billing, start, err)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete consolidated billing: %w", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// EachBilling calls fn with the consolidated billing of every client, of
+// any tenant.
+func (s *ConsolidatedBillingStore) EachBilling(ctx context.Context, fn func(*domain.ConsolidatedBilling) error) error {
+	return eachDocument(ctx, s.billing, bson.M{}, func(cursor *mongo.Cursor) error {
+		var billing domain.ConsolidatedBilling
+		if err := cursor.Decode(&billing); err != nil {
+			return fmt.Errorf("failed to decode consolidated billing: %w", err)
+		}
+		return fn(&billing)
+	})
+}
+
+// SetLastPeriod records that the client was billed for period.
+func (s *ConsolidatedBillingStore) SetLastPeriod(ctx context.Context, billing *domain.ConsolidatedBilling, period string) error {
+	start := time.Now()
+	_, err := s.billing.UpdateOne(ctx,
+		bson.M{"_id": billing.ID, "tenantId": billing.TenantID},
+		bson.M{"$set": bson.M{"lastPeriod": period}})
+	observeMongo("update", s.billing, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update consolidated billing: %w", err)
+	}
+	return nil
+}
+
+// UninvoicedOrders returns the client's orders delivered before before
+// that are not on an invoice yet.
+func (s *ConsolidatedBillingStore) UninvoicedOrders(ctx context.Context, tenantID, clientID uuid.UUID, before time.Time) ([]*domain.Order, error) {
+	var orders []*domain.Order
+	err := eachDocument(ctx, s.orders, bson.M{
+		"tenantId":      tenantID,
+		"clientId":      clientID,
+		"status":        bson.M{"$in": bson.A{domain.OrderStatusDelivered, domain.OrderStatusCompleted}},
+		"deliveredDate": bson.M{"$lt": before},
+		"invoiceId":     nil,
+	}, func(cursor *mongo.Cursor) error {
+		var order domain.Order
+		if err := cursor.Decode(&order); err != nil {
+			return fmt.Errorf("failed to decode order: %w", err)
+		}
+		orders = append(orders, &order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// MarkInvoiced links the orders not yet on an invoice to invoiceID.
+func (s *ConsolidatedBillingStore) MarkInvoiced(ctx context.Context, tenantID, invoiceID uuid.UUID, orderIDs []uuid.UUID) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+	start := time.Now()
+	_, err := s.orders.UpdateMany(ctx,
+		bson.M{"tenantId": tenantID, "_id": bson.M{"$in": orderIDs}, "invoiceId": nil},
+		bson.M{"$set": bson.M{"invoiceId": invoiceID, "updatedAt": time.Now().UTC()}, "$inc": bson.M{"version": 1}})
+	observeMongo("update", s.orders, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to mark orders invoiced: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DeliveryRouteStore keeps delivery routes, with their stops, in the
+// delivery_routes collection.
+type DeliveryRouteStore struct {
+	collection *mongo.Collection
+}
+
+func NewDeliveryRouteStore(db *MongoDB) *DeliveryRouteStore {
+	return &DeliveryRouteStore{collection: db.Collection("delivery_routes")}
+}
+
+func (s *DeliveryRouteStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "deliveryDate", Value: 1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "stops.shipmentId", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create delivery route indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *DeliveryRouteStore) Create(ctx context.Context, route *domain.DeliveryRoute) error {
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, route)
+	observeMongo("insert", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to create delivery route: %w", err)
+	}
+	return nil
+}
+
+func (s *DeliveryRouteStore) FindByID(ctx context.Context, id uuid.UUID) (*domain.DeliveryRoute, error) {
+	start := time.Now()
+	var route domain.DeliveryRoute
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&route)
+	observeMongo("find_one", s.collection, start, err)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("delivery route not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to find delivery route: %w", err)
+	}
+	return &route, nil
+}
+
+// Update saves route if it is still at the version it was read at, and
+// reports ErrConcurrencyConflict otherwise.
+func (s *DeliveryRouteStore) Update(ctx context.Context, route *domain.DeliveryRoute) error {
+	next := *route
+	next.Version++
+
+	start := time.Now()
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": route.ID, "version": route.Version}, &next)
+	observeMongo("replace", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery route: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: delivery route %s at version %d", ErrConcurrencyConflict, route.ID, route.Version)
+	}
+	route.Version++
+	return nil
+}
+
+func (s *DeliveryRouteStore) IsShipmentRouted(ctx context.Context, tenantID, shipmentID uuid.UUID) (bool, error) {
+	start := time.Now()
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"tenantId": tenantID,
+		"stops": bson.M{"$elemMatch": bson.M{
+			"shipmentId": shipmentID,
+			"status":     bson.M{"$ne": domain.DeliveryStopStatusFailed},
+		}},
+	})
+	observeMongo("count", s.collection, start, err)
+	if err != nil {
+		return false, fmt.Errorf("failed to find routes of shipment: %w", err)
+	}
+	return count > 0, nil
+}
+
+// FindByDate returns the tenant's routes on a delivery date, of one
+// warehouse unless warehouseID is uuid.Nil.
+func (s *DeliveryRouteStore) FindByDate(ctx context.Context, tenantID uuid.UUID, deliveryDate string, warehouseID uuid.UUID) ([]*domain.DeliveryRoute, error) {
+	filter := bson.M{"tenantId": tenantID, "deliveryDate": deliveryDate}
+	if warehouseID != uuid.Nil {
+		filter["warehouseId"] = warehouseID
+	}
+
+	routes := []*domain.DeliveryRoute{}
+	err := eachDocument(ctx, s.collection, filter, func(cursor *mongo.Cursor) error {
+		var route domain.DeliveryRoute
+		if err := cursor.Decode(&route); err != nil {
+			return fmt.Errorf("failed to decode delivery route: %w", err)
+		}
+		routes = append(routes, &route)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/numbering"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DocumentCounterStore implements numbering.Counter with one document per
+// sequence in the document_counters collection, incremented atomically by
+// an upsert.
+type DocumentCounterStore struct {
+	collection *mongo.Collection
+}
+
+func NewDocumentCounterStore(db *MongoDB) *DocumentCounterStore {
+	return &DocumentCounterStore{collection: db.Collection("document_counters")}
+}
+
+// NewDocumentCounterStoreIn counts in the document_counters collection of
+// db, for services such as document-service that reach the ERP database
+// through their own client.
+func NewDocumentCounterStoreIn(db *mongo.Database) *DocumentCounterStore {
+	return &DocumentCounterStore{collection: db.Collection("document_counters")}
+}
+
+// documentCounterID is the _id of key's counter, so that the upsert of a new
+// sequence cannot race another into a duplicate.
+func documentCounterID(key numbering.Key) string {
+	return fmt.Sprintf("%s:%s:%s:%d", key.TenantID, key.DocumentType, key.Channel, key.Year)
+}
+
+func (s *DocumentCounterStore) Next(ctx context.Context, key numbering.Key) (int64, error) {
+	start := time.Now()
+	update := bson.M{
+		"$inc": bson.M{"sequence": 1},
+		"$set": bson.M{
+			"tenantId":     key.TenantID,
+			"documentType": key.DocumentType,
+			"channel":      key.Channel,
+			"year":         key.Year,
+			"updatedAt":    time.Now().UTC(),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter struct {
+		Sequence int64 `bson:"sequence"`
+	}
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": documentCounterID(key)}, update, opts).Decode(&counter)
+	observeMongo("find_one_and_update", s.collection, start, err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment %s counter: %w", key.DocumentType, err)
+	}
+	return counter.Sequence, nil
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/pkg/fieldcrypt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EncryptedEventFields are the fields of event data holding personal data,
+// by aggregate type. An EventStore with a keyring seals them.
+var EncryptedEventFields = map[string][]string{
+	"Client": {"email", "phone"},
+}
+
+// ClientPIIFields are the fields of the client read model holding personal
+// data.
+var ClientPIIFields = []string{"email", "phone"}
+
+// hashField is where the blind index of an encrypted field is stored.
+func hashField(field string) string {
+	return field + "Hash"
+}
+
+// sealFields encrypts the string values of fields in doc in place. With
+// index set, the blind index of each is stored next to it for lookups.
+func sealFields(keyring *fieldcrypt.Keyring, doc map[string]interface{}, fields []string, index bool) error {
+	for _, field := range fields {
+		value, ok := doc[field].(string)
+		if !ok {
+			continue
+		}
+		if index && !fieldcrypt.IsEncrypted(value) {
+			doc[hashField(field)] = keyring.Hash(value)
+		}
+		sealed, err := keyring.Encrypt(value)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", field, err)
+		}
+		doc[field] = sealed
+	}
+	return nil
+}
+
+// openFields decrypts the values of fields in doc in place and drops their
+// blind indexes, which are of no use to readers.
+func openFields(keyring *fieldcrypt.Keyring, doc map[string]interface{}, fields []string) error {
+	for _, field := range fields {
+		delete(doc, hashField(field))
+		value, ok := doc[field].(string)
+		if !ok {
+			continue
+		}
+		opened, err := keyring.Decrypt(value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", field, err)
+		}
+		doc[field] = opened
+	}
+	return nil
+}
+
+// asMap returns v as a map if it is a document map.
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case bson.M:
+		return m, true
+	}
+	return nil, false
+}
+
+// toDocument converts a model to a map holding its BSON fields.
+func toDocument(model interface{}) (bson.M, error) {
+	data, err := bson.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// WithEncryption makes the store seal the EncryptedEventFields of events
+// it saves with keyring and open them when loading. A nil keyring turns
+// encryption off; events stored encrypted can then no longer be loaded.
+func (es *EventStore) WithEncryption(keyring *fieldcrypt.Keyring) *EventStore {
+	es.keyring = keyring
+	return es
+}
+
+func (es *EventStore) seal(event StoredEvent) (StoredEvent, error) {
+	fields := EncryptedEventFields[event.AggregateType]
+	if es.keyring == nil || len(fields) == 0 || event.EventData == nil {
+		return event, nil
+	}
+	// The data may be shared with the envelope being published.
+	data := make(map[string]interface{}, len(event.EventData))
+	for k, v := range event.EventData {
+		data[k] = v
+	}
+	if err := sealFields(es.keyring, data, fields, false); err != nil {
+		return event, fmt.Errorf("event %s: %w", event.ID, err)
+	}
+	event.EventData = data
+	return event, nil
+}
+
+func (es *EventStore) open(event *StoredEvent) error {
+	fields := EncryptedEventFields[event.AggregateType]
+	if len(fields) == 0 || event.EventData == nil {
+		return nil
+	}
+	if err := openFields(es.keyring, event.EventData, fields); err != nil {
+		return fmt.Errorf("event %s: %w", event.ID, err)
+	}
+	return nil
+}
+
+// WithEncryption makes the store seal fields of the documents it writes
+// with keyring, keeping a blind index of each at <field>Hash, and open them
+// in the documents it reads. Filters on those fields must use Match.
+func (s *ReadModelStore) WithEncryption(keyring *fieldcrypt.Keyring, fields ...string) *ReadModelStore {
+	s.keyring = keyring
+	s.encrypted = fields
+	return s
+}
+
+// Match returns a filter matching documents whose field contains term,
+// ignoring case. An encrypted field can only be matched as a whole, through
+// its blind index.
+func (s *ReadModelStore) Match(field, term string) map[string]interface{} {
+	if s.keyring != nil {
+		for _, encrypted := range s.encrypted {
+			if encrypted == field {
+				return map[string]interface{}{hashField(field): s.keyring.Hash(term)}
+			}
+		}
+	}
+	return map[string]interface{}{field: map[string]interface{}{"$regex": term, "$options": "i"}}
+}
+
+func (s *ReadModelStore) sealModel(model interface{}) (interface{}, error) {
+	if s.keyring == nil || len(s.encrypted) == 0 {
+		return model, nil
+	}
+	doc, err := toDocument(model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode read model: %w", err)
+	}
+	if err := sealFields(s.keyring, doc, s.encrypted, true); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// sealUpdate encrypts the fields set by update, copying the operators it
+// changes.
+func (s *ReadModelStore) sealUpdate(update interface{}) (interface{}, error) {
+	if s.keyring == nil || len(s.encrypted) == 0 {
+		return update, nil
+	}
+	ops, ok := asMap(update)
+	if !ok {
+		return update, nil
+	}
+	sealed := make(map[string]interface{}, len(ops))
+	for op, value := range ops {
+		sealed[op] = value
+		if op != "$set" && op != "$setOnInsert" {
+			continue
+		}
+		set, ok := asMap(value)
+		if !ok {
+			continue
+		}
+		copied := make(map[string]interface{}, len(set))
+		for k, v := range set {
+			copied[k] = v
+		}
+		if err := sealFields(s.keyring, copied, s.encrypted, true); err != nil {
+			return nil, err
+		}
+		sealed[op] = copied
+	}
+	return sealed, nil
+}
+
+// Decrypt opens the encrypted fields of a document of the store's collection
+// read by other means, such as an export.
+func (s *ReadModelStore) Decrypt(doc bson.M) error {
+	if len(s.encrypted) == 0 {
+		return nil
+	}
+	return openFields(s.keyring, doc, s.encrypted)
+}
+
+// RotateKeys re-seals the personal data stored in db under the active key
+// of keyring: client read models, client events and bank transaction
+// counterparties. Values still in plaintext are sealed, and given the blind
+// index lookups need. It returns the number of documents changed by
+// collection, and may be run again after an interruption.
+func RotateKeys(ctx context.Context, db *MongoDB, keyring *fieldcrypt.Keyring) (map[string]int64, error) {
+	if keyring == nil {
+		return nil, errors.New("PII encryption is not configured")
+	}
+	aggregates := make([]string, 0, len(EncryptedEventFields))
+	var eventFields []string
+	for aggregate, fields := range EncryptedEventFields {
+		aggregates = append(aggregates, aggregate)
+		for _, field := range fields {
+			eventFields = append(eventFields, "eventData."+field)
+		}
+	}
+
+	targets := []struct {
+		collection string
+		filter     bson.M
+		fields     []string
+		index      bool
+	}{
+		{"client_read", bson.M{}, ClientPIIFields, true},
+		{"events", bson.M{"aggregateType": bson.M{"$in": aggregates}}, eventFields, false},
+		{"bank_transactions", bson.M{"counterpartyIban": bson.M{"$exists": true}}, []string{"counterpartyIban"}, true},
+	}
+	changed := make(map[string]int64, len(targets))
+	for _, target := range targets {
+		n, err := rotateCollection(ctx, db.Collection(target.collection), keyring, target.filter, target.fields, target.index)
+		changed[target.collection] = n
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// rotateCollection re-seals fields, given as dotted paths, in the documents
+// of collection matching filter.
+func rotateCollection(ctx context.Context, collection *mongo.Collection, keyring *fieldcrypt.Keyring, filter bson.M, fields []string, index bool) (int64, error) {
+	var changed int64
+	err := eachDocument(ctx, collection, filter, func(cursor *mongo.Cursor) error {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode %s document: %w", collection.Name(), err)
+		}
+		set := bson.M{}
+		for _, field := range fields {
+			value, ok := lookupPath(doc, field).(string)
+			if !ok {
+				continue
+			}
+			rotated, ok, err := keyring.Rotate(value)
+			if err != nil {
+				return fmt.Errorf("%s %v: %s: %w", collection.Name(), doc["_id"], field, err)
+			}
+			if !ok {
+				continue
+			}
+			set[field] = rotated
+			if index && !fieldcrypt.IsEncrypted(value) {
+				set[hashField(field)] = keyring.Hash(value)
+			}
+		}
+		if len(set) == 0 {
+			return nil
+		}
+
+		start := time.Now()
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": set})
+		observeMongo("update", collection, start, err)
+		if err != nil {
+			return fmt.Errorf("failed to update %s %v: %w", collection.Name(), doc["_id"], err)
+		}
+		changed++
+		return nil
+	})
+	return changed, err
+}
+
+func lookupPath(doc map[string]interface{}, path string) interface{} {
+	head, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		return doc[head]
+	}
+	inner, ok := asMap(doc[head])
+	if !ok {
+		return nil
+	}
+	return lookupPath(inner, rest)
+}
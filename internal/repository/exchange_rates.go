@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExchangeRateStore keeps exchange rates in the exchange_rates collection:
+// the rates synced from the provider, with no tenant, and tenants'
+// overrides.
+type ExchangeRateStore struct {
+	rates *mongo.Collection
+}
+
+func NewExchangeRateStore(db *MongoDB) *ExchangeRateStore {
+	return &ExchangeRateStore{rates: db.Collection("exchange_rates")}
+}
+
+// EnsureIndexes creates the store's indexes. A pair has one rate a day, and
+// one override per tenant.
+func (s *ExchangeRateStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.rates.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenantId", Value: 1}, {Key: "base", Value: 1}, {Key: "quote", Value: 1}, {Key: "date", Value: -1},
+		},
+		Options: options.Index().SetUnique(true).SetName("rate_per_day"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create exchange rate indexes: %w", err)
+	}
+	return nil
+}
+
+// Save stores rates, replacing those of the same tenant, pair and day.
+func (s *ExchangeRateStore) Save(ctx context.Context, rates ...*domain.ExchangeRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(rates))
+	for _, rate := range rates {
+		filter := bson.M{"tenantId": rate.TenantID, "base": rate.Base, "quote": rate.Quote, "date": rate.Date}
+		update := bson.M{
+			"$set": bson.M{
+				"rate":      rate.Rate,
+				"source":    rate.Source,
+				"note":      rate.Note,
+				"setBy":     rate.SetBy,
+				"updatedAt": rate.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{"_id": rate.ID},
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+	}
+
+	start := time.Now()
+	_, err := s.rates.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	observeMongo("bulk_write", s.rates, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to save exchange rates: %w", err)
+	}
+	return nil
+}
+
+// Latest returns the latest rate of base in quote dated from from to to,
+// both included, or nil when there is none. A nil tenantID looks up synced
+// rates, and a tenant's ID its overrides.
+func (s *ExchangeRateStore) Latest(ctx context.Context, tenantID *uuid.UUID, base, quote string, from, to time.Time) (*domain.ExchangeRate, error) {
+	filter := bson.M{"tenantId": tenantID, "base": base, "quote": quote, "date": bson.M{"$lte": to}}
+	if !from.IsZero() {
+		filter["date"] = bson.M{"$gte": from, "$lte": to}
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "date", Value: -1}})
+
+	start := time.Now()
+	var rate domain.ExchangeRate
+	err := s.rates.FindOne(ctx, filter, opts).Decode(&rate)
+	observeMongo("find_one", s.rates, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find exchange rate: %w", err)
+	}
+	return &rate, nil
+}
+
+// History returns the rates of base in quote dated from from to to, both
+// included, oldest first: synced ones for a nil tenantID, or the tenant's
+// overrides.
+func (s *ExchangeRateStore) History(ctx context.Context, tenantID *uuid.UUID, base, quote string, from, to time.Time) ([]*domain.ExchangeRate, error) {
+	filter := bson.M{"tenantId": tenantID, "base": base, "quote": quote, "date": bson.M{"$gte": from, "$lte": to}}
+	return s.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "date", Value: 1}}))
+}
+
+// Overrides returns the tenant's overrides, latest first.
+func (s *ExchangeRateStore) Overrides(ctx context.Context, tenantID uuid.UUID, limit int64) ([]*domain.ExchangeRate, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "base", Value: 1}, {Key: "quote", Value: 1}}).SetLimit(limit)
+	return s.find(ctx, bson.M{"tenantId": tenantID}, opts)
+}
+
+// DeleteOverride removes one of the tenant's overrides, and reports
+// whether there was one.
+func (s *ExchangeRateStore) DeleteOverride(ctx context.Context, tenantID, id uuid.UUID) (bool, error) {
+	start := time.Now()
+	result, err := s.rates.DeleteOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+	observeMongo("delete", s.rates, start, err)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete exchange rate override: %w", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func (s *ExchangeRateStore) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*domain.ExchangeRate, error) {
+	start := time.Now()
+	cursor, err := s.rates.Find(ctx, filter, opts)
+	observeMongo("find", s.rates, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find exchange rates: %w", err)
+	}
+	rates := []*domain.ExchangeRate{}
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+	return rates, nil
+}
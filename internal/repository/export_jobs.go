@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+var ErrExportJobNotFound = errors.New("export job not found")
+
+// ExportJob tracks one asynchronous export. The file is written to Bucket
+// under ObjectKey once the job completes; the job and its file are purged
+// after ExpiresAt.
+type ExportJob struct {
+	ID       string `bson:"_id" json:"id"`
+	Source   string `bson:"source" json:"source"`
+	TenantID string `bson:"tenantId" json:"tenantId"`
+	UserID   string `bson:"userId,omitempty" json:"userId,omitempty"`
+	// Visibility is that of the user who requested the export, nil when
+	// it is unrestricted.
+	Visibility *domain.Visibility `bson:"visibility,omitempty" json:"-"`
+	// Masked is set when the export is masked like the requesting user's
+	// API responses.
+	Masked      bool              `bson:"masked,omitempty" json:"masked,omitempty"`
+	Format      string            `bson:"format" json:"format"`
+	Filters     map[string]string `bson:"filters,omitempty" json:"filters,omitempty"`
+	From        *time.Time        `bson:"from,omitempty" json:"from,omitempty"`
+	To          *time.Time        `bson:"to,omitempty" json:"to,omitempty"`
+	Status      string            `bson:"status" json:"status"`
+	Owner       string            `bson:"owner,omitempty" json:"-"`
+	Attempts    int               `bson:"attempts" json:"attempts"`
+	Rows        int64             `bson:"rows" json:"rows"`
+	Size        int64             `bson:"size,omitempty" json:"size,omitempty"`
+	FileName    string            `bson:"fileName,omitempty" json:"fileName,omitempty"`
+	Bucket      string            `bson:"bucket,omitempty" json:"-"`
+	ObjectKey   string            `bson:"objectKey,omitempty" json:"-"`
+	LastError   string            `bson:"lastError,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time         `bson:"createdAt" json:"createdAt"`
+	StartedAt   *time.Time        `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	HeartbeatAt *time.Time        `bson:"heartbeatAt,omitempty" json:"-"`
+	FinishedAt  *time.Time        `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+	ExpiresAt   time.Time         `bson:"expiresAt" json:"expiresAt"`
+}
+
+type ExportJobStore struct {
+	collection *mongo.Collection
+}
+
+func NewExportJobStore(db *MongoDB) *ExportJobStore {
+	return &ExportJobStore{collection: db.Collection("export_jobs")}
+}
+
+func (s *ExportJobStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create export job indexes: %w", err)
+	}
+	return nil
+}
+
+// Create stores job as pending, to be purged after retention unless it
+// completes and is given a new expiry.
+func (s *ExportJobStore) Create(ctx context.Context, job *ExportJob, retention time.Duration) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	job.Status = ExportStatusPending
+	job.CreatedAt = time.Now().UTC()
+	job.ExpiresAt = job.CreatedAt.Add(retention)
+
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, job)
+	observeMongo("insert", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to create export job: %w", err)
+	}
+	return nil
+}
+
+func (s *ExportJobStore) Get(ctx context.Context, id string) (*ExportJob, error) {
+	start := time.Now()
+	var job ExportJob
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrExportJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export job: %w", err)
+	}
+	return &job, nil
+}
+
+// List returns a tenant's most recent jobs, optionally only those of one user
+// or of one source.
+func (s *ExportJobStore) List(ctx context.Context, tenantID, userID, source string, limit int64) ([]ExportJob, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if userID != "" {
+		filter["userId"] = userID
+	}
+	if source != "" {
+		filter["source"] = source
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := make([]ExportJob, 0)
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode export jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Claim assigns the oldest pending job of one of sources to owner. Running
+// jobs whose heartbeat is older than staleAfter are claimed again, since
+// their worker is gone; Attempts counts the claims.
+func (s *ExportJobStore) Claim(ctx context.Context, owner string, sources []string, staleAfter time.Duration) (*ExportJob, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"source": bson.M{"$in": sources},
+		"$or": bson.A{
+			bson.M{"status": ExportStatusPending},
+			bson.M{"status": ExportStatusRunning, "heartbeatAt": bson.M{"$lt": now.Add(-staleAfter)}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      ExportStatusRunning,
+			"owner":       owner,
+			"startedAt":   now,
+			"heartbeatAt": now,
+			"rows":        0,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	start := time.Now()
+	var job ExportJob
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	observeMongo("find_one_and_update", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim export job: %w", err)
+	}
+	return &job, nil
+}
+
+// Progress records the rows written so far and refreshes the heartbeat. It
+// returns ErrExportJobNotFound once another worker has taken the job over.
+func (s *ExportJobStore) Progress(ctx context.Context, job *ExportJob) error {
+	now := time.Now().UTC()
+	job.HeartbeatAt = &now
+
+	start := time.Now()
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": job.ID, "owner": job.Owner}, bson.M{"$set": bson.M{
+		"rows":        job.Rows,
+		"heartbeatAt": now,
+	}})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update export job: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrExportJobNotFound
+	}
+	return nil
+}
+
+// Finish moves job to a terminal status and restarts its retention.
+func (s *ExportJobStore) Finish(ctx context.Context, job *ExportJob, status string, retention time.Duration) error {
+	now := time.Now().UTC()
+	job.Status = status
+	job.FinishedAt = &now
+	job.ExpiresAt = now.Add(retention)
+
+	start := time.Now()
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": job.ID, "owner": job.Owner}, bson.M{"$set": bson.M{
+		"status":     status,
+		"rows":       job.Rows,
+		"size":       job.Size,
+		"fileName":   job.FileName,
+		"bucket":     job.Bucket,
+		"objectKey":  job.ObjectKey,
+		"lastError":  job.LastError,
+		"finishedAt": now,
+		"expiresAt":  job.ExpiresAt,
+	}})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to finish export job: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrExportJobNotFound
+	}
+	return nil
+}
+
+// Expired returns up to limit jobs of sources that expired before now.
+func (s *ExportJobStore) Expired(ctx context.Context, sources []string, now time.Time, limit int64) ([]ExportJob, error) {
+	filter := bson.M{"source": bson.M{"$in": sources}, "expiresAt": bson.M{"$lt": now}}
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetLimit(limit))
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired export jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := make([]ExportJob, 0)
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode export jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (s *ExportJobStore) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	observeMongo("delete", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete export job: %w", err)
+	}
+	return nil
+}
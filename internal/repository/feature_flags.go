@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// featureFlagChannel carries the ID of a tenant whose flag overrides changed,
+// so every replica can drop its cached evaluation.
+const featureFlagChannel = "featureflags:changed"
+
+// FeatureFlagStore keeps per-tenant feature flag overrides in Redis, one hash
+// per tenant mapping flag key to "1" or "0". Keys are not prefixed with a
+// database name: every service evaluates the same flags.
+type FeatureFlagStore struct {
+	client redis.UniversalClient
+}
+
+func NewFeatureFlagStore(r *Redis) *FeatureFlagStore {
+	return &FeatureFlagStore{client: r.client}
+}
+
+func featureFlagKey(tenantID string) string {
+	return "featureflags:" + tenantID
+}
+
+// Overrides returns the flags set explicitly for tenantID.
+func (s *FeatureFlagStore) Overrides(ctx context.Context, tenantID string) (map[string]bool, error) {
+	start := time.Now()
+	values, err := s.client.HGetAll(ctx, featureFlagKey(tenantID)).Result()
+	metrics.ObserveRedis("hgetall", start, err)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]bool, len(values))
+	for flag, value := range values {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			continue
+		}
+		overrides[flag] = enabled
+	}
+	return overrides, nil
+}
+
+// SetOverride turns flag on or off for tenantID and announces the change.
+func (s *FeatureFlagStore) SetOverride(ctx context.Context, tenantID, flag string, enabled bool) error {
+	start := time.Now()
+	err := s.client.HSet(ctx, featureFlagKey(tenantID), flag, strconv.FormatBool(enabled)).Err()
+	metrics.ObserveRedis("hset", start, err)
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, tenantID)
+}
+
+// ClearOverride returns flag to its default for tenantID and announces the
+// change.
+func (s *FeatureFlagStore) ClearOverride(ctx context.Context, tenantID, flag string) error {
+	start := time.Now()
+	err := s.client.HDel(ctx, featureFlagKey(tenantID), flag).Err()
+	metrics.ObserveRedis("hdel", start, err)
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, tenantID)
+}
+
+func (s *FeatureFlagStore) publish(ctx context.Context, tenantID string) error {
+	start := time.Now()
+	err := s.client.Publish(ctx, featureFlagChannel, tenantID).Err()
+	metrics.ObserveRedis("publish", start, err)
+	return err
+}
+
+// WatchChanges calls changed with the tenant ID of every override change
+// until ctx is cancelled.
+func (s *FeatureFlagStore) WatchChanges(ctx context.Context, changed func(tenantID string)) error {
+	sub := s.client.Subscribe(ctx, featureFlagChannel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			changed(msg.Payload)
+		}
+	}
+}
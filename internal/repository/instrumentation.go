@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mongoMonitor traces and times every command the MongoDB driver sends. Its
+// spans, named after the command, are children of the span in the context of
+// the repository call, so a request's trace shows each round trip below the
+// EventStore or store operation that made it.
+type mongoMonitor struct {
+	tracer trace.Tracer
+	spans  sync.Map // request ID -> *mongoCommand
+}
+
+type mongoCommand struct {
+	span       trace.Span
+	collection string
+}
+
+func newMongoMonitor() *event.CommandMonitor {
+	m := &mongoMonitor{tracer: otel.Tracer("mongodb")}
+	return &event.CommandMonitor{
+		Started:   m.started,
+		Succeeded: m.succeeded,
+		Failed:    m.failed,
+	}
+}
+
+func (m *mongoMonitor) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	collection := commandCollection(evt)
+	_, span := m.tracer.Start(ctx, evt.CommandName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.name", evt.DatabaseName),
+			attribute.String("db.operation", evt.CommandName),
+			attribute.String("db.mongodb.collection", collection),
+		))
+	m.spans.Store(evt.RequestID, &mongoCommand{span: span, collection: collection})
+}
+
+func (m *mongoMonitor) succeeded(ctx context.Context, evt *event.CommandSucceededEvent) {
+	m.finish(ctx, &evt.CommandFinishedEvent, nil)
+}
+
+func (m *mongoMonitor) failed(ctx context.Context, evt *event.CommandFailedEvent) {
+	m.finish(ctx, &evt.CommandFinishedEvent, errors.New(evt.Failure))
+}
+
+func (m *mongoMonitor) finish(ctx context.Context, evt *event.CommandFinishedEvent, err error) {
+	v, ok := m.spans.LoadAndDelete(evt.RequestID)
+	if !ok {
+		return
+	}
+	cmd := v.(*mongoCommand)
+	if err != nil {
+		cmd.span.RecordError(err)
+		cmd.span.SetStatus(codes.Error, err.Error())
+	}
+	metrics.ObserveDBCommand(trace.ContextWithSpan(ctx, cmd.span), evt.CommandName, cmd.collection, evt.Duration, err)
+	cmd.span.End()
+}
+
+// commandCollection returns the collection a command targets. Most commands
+// name it as the value of their first field; getMore carries the cursor ID
+// there and the collection in a field of its own.
+func commandCollection(evt *event.CommandStartedEvent) string {
+	field := evt.CommandName
+	if field == "getMore" {
+		field = "collection"
+	}
+	if coll, ok := evt.Command.Lookup(field).StringValueOK(); ok {
+		return coll
+	}
+	return ""
+}
+
+// redisHook traces and times every command, and every pipeline as a whole,
+// sent through a Redis client. Cache and RateLimiter spans become the parents
+// of its command spans.
+type redisHook struct {
+	tracer trace.Tracer
+}
+
+func newRedisHook() redis.Hook {
+	return redisHook{tracer: otel.Tracer("redis")}
+}
+
+func (h redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		name := cmd.Name()
+		ctx, span := h.start(ctx, name, name)
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.finish(ctx, span, name, start, err)
+		return err
+	}
+}
+
+func (h redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		ctx, span := h.start(ctx, "pipeline", strings.Join(names, " "))
+		span.SetAttributes(attribute.Int("db.redis.pipeline_length", len(cmds)))
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.finish(ctx, span, "pipeline", start, err)
+		return err
+	}
+}
+
+func (h redisHook) start(ctx context.Context, name, operation string) (context.Context, trace.Span) {
+	return h.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", operation),
+		))
+}
+
+// finish ends span, treating redis.Nil as a miss rather than a failure.
+func (h redisHook) finish(ctx context.Context, span trace.Span, command string, start time.Time, err error) {
+	if err == redis.Nil {
+		err = nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	metrics.ObserveRedisCommand(ctx, command, time.Since(start), err)
+	span.End()
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracer(t *testing.T) (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return provider, recorder
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func startedEvent(t *testing.T, requestID int64, name string, command bson.D) *event.CommandStartedEvent {
+	raw, err := bson.Marshal(command)
+	require.NoError(t, err)
+	return &event.CommandStartedEvent{Command: raw, DatabaseName: "erp", CommandName: name, RequestID: requestID}
+}
+
+func TestCommandCollection(t *testing.T) {
+	assert.Equal(t, "invoice_read", commandCollection(startedEvent(t, 1, "find", bson.D{{Key: "find", Value: "invoice_read"}})))
+	assert.Equal(t, "events", commandCollection(startedEvent(t, 2, "getMore", bson.D{
+		{Key: "getMore", Value: int64(8812)},
+		{Key: "collection", Value: "events"},
+	})), "getMore names its collection in a field of its own")
+	assert.Empty(t, commandCollection(startedEvent(t, 3, "ping", bson.D{{Key: "ping", Value: 1}})))
+}
+
+func TestMongoMonitor(t *testing.T) {
+	metrics.Initialize("test")
+	provider, recorder := newTestTracer(t)
+	monitor := &mongoMonitor{tracer: provider.Tracer("mongodb")}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "EventStore.Save")
+	monitor.started(ctx, startedEvent(t, 1, "insert", bson.D{{Key: "insert", Value: "events"}}))
+	monitor.started(ctx, startedEvent(t, 2, "find", bson.D{{Key: "find", Value: "outbox"}}))
+	monitor.succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+		CommandName: "insert", RequestID: 1, Duration: 4 * time.Millisecond,
+	}})
+	monitor.failed(ctx, &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 2, Duration: time.Millisecond},
+		Failure:              "connection reset",
+	})
+	monitor.succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+		CommandName: "find", RequestID: 2,
+	}})
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3, "a command finishing twice ends its span once")
+
+	insert, find := spans[0], spans[1]
+	assert.Equal(t, "insert", insert.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), insert.Parent().SpanID(), "command spans are children of the repository call")
+	assert.Equal(t, "events", spanAttribute(insert, "db.mongodb.collection").AsString())
+	assert.Equal(t, "erp", spanAttribute(insert, "db.name").AsString())
+	assert.Equal(t, codes.Unset, insert.Status().Code)
+
+	assert.Equal(t, "find", find.Name())
+	assert.Equal(t, codes.Error, find.Status().Code)
+	assert.Equal(t, "connection reset", find.Status().Description)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.DBCommands.WithLabelValues("insert", "events", "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.DBCommands.WithLabelValues("find", "outbox", "error")))
+}
+
+func TestRedisHook_ProcessHook(t *testing.T) {
+	metrics.Initialize("test")
+	provider, recorder := newTestTracer(t)
+	hook := redisHook{tracer: provider.Tracer("redis")}
+	failure := errors.New("connection refused")
+
+	miss := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error { return redis.Nil })
+	broken := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error { return failure })
+
+	assert.Equal(t, redis.Nil, miss(context.Background(), redis.NewStringCmd(context.Background(), "get", "invoice:1")))
+	assert.ErrorIs(t, broken(context.Background(), redis.NewStatusCmd(context.Background(), "set", "invoice:1", "{}")), failure)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "get", spans[0].Name())
+	assert.Equal(t, "redis", spanAttribute(spans[0], "db.system").AsString())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code, "a cache miss is not a failure")
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RedisCommands.WithLabelValues("get", "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RedisCommands.WithLabelValues("set", "error")))
+}
+
+func TestRedisHook_ProcessPipelineHook(t *testing.T) {
+	metrics.Initialize("test")
+	provider, recorder := newTestTracer(t)
+	hook := redisHook{tracer: provider.Tracer("redis")}
+
+	var sent int
+	pipeline := hook.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		sent = len(cmds)
+		return nil
+	})
+	ctx := context.Background()
+	require.NoError(t, pipeline(ctx, []redis.Cmder{
+		redis.NewIntCmd(ctx, "incr", "ratelimit:tenant-a"),
+		redis.NewBoolCmd(ctx, "expire", "ratelimit:tenant-a", 60),
+	}))
+	assert.Equal(t, 2, sent)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1, "a pipeline is traced as one span")
+	assert.Equal(t, "pipeline", spans[0].Name())
+	assert.Equal(t, "incr expire", spanAttribute(spans[0], "db.operation").AsString())
+	assert.Equal(t, int64(2), spanAttribute(spans[0], "db.redis.pipeline_length").AsInt64())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RedisCommands.WithLabelValues("pipeline", "ok")))
+}
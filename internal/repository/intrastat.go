@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IntrastatStore reads the orders, receipts and products Intrastat reports
+// are derived from.
+type IntrastatStore struct {
+	orders     *mongo.Collection
+	operations *mongo.Collection
+	products   *mongo.Collection
+}
+
+func NewIntrastatStore(db *MongoDB) *IntrastatStore {
+	return &IntrastatStore{
+		orders:     db.Collection("orders"),
+		operations: db.Collection("warehouse_operations"),
+		products:   db.Collection("products"),
+	}
+}
+
+func (s *IntrastatStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.orders.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "shippedDate", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create order shipping indexes: %w", err)
+	}
+	_, err = s.operations.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenantId", Value: 1},
+			{Key: "type", Value: 1},
+			{Key: "status", Value: 1},
+			{Key: "completedAt", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create warehouse operation indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *IntrastatStore) EachShippedOrder(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Order) error) error {
+	return eachDocument(ctx, s.orders, bson.M{
+		"tenantId":    tenantID,
+		"shippedDate": bson.M{"$gte": from, "$lt": to},
+	}, func(cursor *mongo.Cursor) error {
+		var order domain.Order
+		if err := cursor.Decode(&order); err != nil {
+			return fmt.Errorf("failed to decode order: %w", err)
+		}
+		return fn(&order)
+	})
+}
+
+func (s *IntrastatStore) EachCompletedReceipt(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.WarehouseOperation) error) error {
+	return eachDocument(ctx, s.operations, bson.M{
+		"tenantId":    tenantID,
+		"type":        domain.OperationTypeReceipt,
+		"status":      "completed",
+		"completedAt": bson.M{"$gte": from, "$lt": to},
+	}, func(cursor *mongo.Cursor) error {
+		var receipt domain.WarehouseOperation
+		if err := cursor.Decode(&receipt); err != nil {
+			return fmt.Errorf("failed to decode receipt: %w", err)
+		}
+		return fn(&receipt)
+	})
+}
+
+func (s *IntrastatStore) FindProducts(ctx context.Context, tenantID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]*domain.Product, error) {
+	products := make(map[uuid.UUID]*domain.Product, len(ids))
+	err := eachDocument(ctx, s.products, bson.M{
+		"tenantId": tenantID,
+		"_id":      bson.M{"$in": ids},
+	}, func(cursor *mongo.Cursor) error {
+		var product domain.Product
+		if err := cursor.Decode(&product); err != nil {
+			return fmt.Errorf("failed to decode product: %w", err)
+		}
+		products[product.ID] = &product
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// eachDocument calls fn for every document of collection matching filter,
+// in _id order, and stops at the first error.
+func eachDocument(ctx context.Context, collection *mongo.Collection, filter bson.M, fn func(*mongo.Cursor) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(500)
+
+	start := time.Now()
+	cursor, err := collection.Find(ctx, filter, opts)
+	observeMongo("find", collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		if err := fn(cursor); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", collection.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InventoryTransactionRecord is a stock movement as stored in the
+// inventory_transactions collection. Quantity is as recorded: positive for
+// most movements, signed for adjustments and cycle counts.
+type InventoryTransactionRecord struct {
+	ID             string    `bson:"_id" json:"id"`
+	TenantID       string    `bson:"tenantId" json:"tenantId"`
+	ProductID      string    `bson:"productId" json:"productId"`
+	WarehouseID    string    `bson:"warehouseId" json:"warehouseId"`
+	FromLocationID string    `bson:"fromLocationId,omitempty" json:"fromLocationId,omitempty"`
+	ToLocationID   string    `bson:"toLocationId,omitempty" json:"toLocationId,omitempty"`
+	MovementType   string    `bson:"movementType" json:"movementType"`
+	Quantity       int       `bson:"quantity" json:"quantity"`
+	ReferenceType  string    `bson:"referenceType,omitempty" json:"referenceType,omitempty"`
+	ReferenceID    string    `bson:"referenceId,omitempty" json:"referenceId,omitempty"`
+	LotNumber      string    `bson:"lotNumber,omitempty" json:"lotNumber,omitempty"`
+	SerialNumber   string    `bson:"serialNumber,omitempty" json:"serialNumber,omitempty"`
+	Reason         string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	PerformedBy    string    `bson:"performedBy,omitempty" json:"performedBy,omitempty"`
+	CreatedAt      time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// InventoryTransactionFilter selects the movements of one product of a
+// tenant. WarehouseID is optional; Before, when set, is exclusive.
+type InventoryTransactionFilter struct {
+	TenantID    string
+	ProductID   string
+	WarehouseID string
+	Before      *time.Time
+}
+
+type InventoryTransactionStore struct {
+	collection *mongo.Collection
+}
+
+func NewInventoryTransactionStore(db *MongoDB) *InventoryTransactionStore {
+	return &InventoryTransactionStore{collection: db.Collection("inventory_transactions")}
+}
+
+func (s *InventoryTransactionStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenantId", Value: 1},
+			{Key: "productId", Value: 1},
+			{Key: "createdAt", Value: 1},
+			{Key: "_id", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create inventory transaction indexes: %w", err)
+	}
+	return nil
+}
+
+// Each calls fn with the movements matching filter, oldest first. It stops at
+// the first error fn returns.
+func (s *InventoryTransactionStore) Each(ctx context.Context, filter InventoryTransactionFilter, fn func(InventoryTransactionRecord) error) error {
+	query := bson.M{"tenantId": filter.TenantID, "productId": filter.ProductID}
+	if filter.WarehouseID != "" {
+		query["warehouseId"] = filter.WarehouseID
+	}
+	if filter.Before != nil {
+		query["createdAt"] = bson.M{"$lt": *filter.Before}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetBatchSize(500)
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, query, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to query inventory transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var record InventoryTransactionRecord
+		if err := cursor.Decode(&record); err != nil {
+			return fmt.Errorf("failed to decode inventory transaction: %w", err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read inventory transactions: %w", err)
+	}
+	return nil
+}
@@ -71,10 +71,17 @@ func (r *MongoInvoiceRepository) Create(ctx context.Context, invoice *domain.Inv
 
 // Update updates an existing invoice in the database
 func (r *MongoInvoiceRepository) Update(ctx context.Context, invoice *domain.Invoice) error {
+	return r.UpdateVersions(ctx, invoice, 1)
+}
+
+// UpdateVersions saves invoice if it is still at invoice.Version, advancing
+// the version by versions in the same write.
+func (r *MongoInvoiceRepository) UpdateVersions(ctx context.Context, invoice *domain.Invoice, versions int64) error {
 	ctx, span := r.tracer.Start(ctx, "mongo.invoice.update",
 		trace.WithAttributes(
 			attribute.String("invoice_id", invoice.ID.String()),
 			attribute.Int64("version", invoice.Version),
+			attribute.Int64("versions", versions),
 		),
 	)
 	defer span.End()
@@ -82,15 +89,16 @@ func (r *MongoInvoiceRepository) Update(ctx context.Context, invoice *domain.Inv
 	// Update the UpdatedAt timestamp
 	invoice.UpdatedAt = time.Now().UTC()
 
+	// The write only applies if nobody else has bumped the version since
+	// the invoice was loaded.
 	filter := bson.M{
 		"_id":     invoice.ID,
 		"version": invoice.Version,
 	}
 
-	update := bson.M{
-		"$set": invoice,
-		"$inc": bson.M{"version": 1},
-	}
+	next := *invoice
+	next.Version += versions
+	update := bson.M{"$set": &next}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -103,12 +111,12 @@ func (r *MongoInvoiceRepository) Update(ctx context.Context, invoice *domain.Inv
 	}
 
 	if result.MatchedCount == 0 {
-		err := fmt.Errorf("invoice not found or version mismatch: %s", invoice.ID)
+		err := fmt.Errorf("%w: invoice %s at version %d", ErrConcurrencyConflict, invoice.ID, invoice.Version)
 		span.RecordError(err)
 		return err
 	}
 
-	invoice.Version++
+	invoice.Version = next.Version
 
 	r.logger.New(ctx).Info("Invoice updated",
 		"invoice_id", invoice.ID,
@@ -223,3 +231,85 @@ func (r *MongoInvoiceRepository) FindByClientID(ctx context.Context, clientID uu
 	span.SetAttributes(attribute.Int("count", len(invoices)))
 	return invoices, nil
 }
+
+// FindOpen returns the tenant's invoices in currency that are awaiting
+// payment: pending, sent or overdue with an amount due.
+func (r *MongoInvoiceRepository) FindOpen(ctx context.Context, tenantID uuid.UUID, currency string) ([]*domain.Invoice, error) {
+	ctx, span := r.tracer.Start(ctx, "mongo.invoice.find_open",
+		trace.WithAttributes(
+			attribute.String("tenant_id", tenantID.String()),
+			attribute.String("currency", currency),
+		),
+	)
+	defer span.End()
+
+	filter := bson.M{
+		"tenantId": tenantID,
+		"currency": currency,
+		"status": bson.M{"$in": bson.A{
+			domain.InvoiceStatusPending,
+			domain.InvoiceStatusSent,
+			domain.InvoiceStatusOverdue,
+		}},
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"dueDate": 1}))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to find open invoices: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var invoices []*domain.Invoice
+	if err := cursor.All(ctx, &invoices); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode invoices: %w", err)
+	}
+	open := invoices[:0]
+	for _, invoice := range invoices {
+		if invoice.AmountDue.IsPositive() {
+			open = append(open, invoice)
+		}
+	}
+
+	span.SetAttributes(attribute.Int("count", len(open)))
+	return open, nil
+}
+
+// EachIssued calls fn with the tenant's invoices and credit notes issued in
+// [from, to), leaving drafts and voided invoices out.
+func (r *MongoInvoiceRepository) EachIssued(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Invoice) error) error {
+	ctx, span := r.tracer.Start(ctx, "mongo.invoice.each_issued",
+		trace.WithAttributes(attribute.String("tenant_id", tenantID.String())),
+	)
+	defer span.End()
+
+	filter := bson.M{
+		"tenantId":  tenantID,
+		"issueDate": bson.M{"$gte": from, "$lt": to},
+		"status": bson.M{"$nin": bson.A{
+			domain.InvoiceStatusDraft,
+			domain.InvoiceStatusCancelled,
+		}},
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"issueDate": 1}))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to find issued invoices: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var invoice domain.Invoice
+		if err := cursor.Decode(&invoice); err != nil {
+			return fmt.Errorf("failed to decode invoice: %w", err)
+		}
+		if err := fn(&invoice); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to find issued invoices: %w", err)
+	}
+	return nil
+}
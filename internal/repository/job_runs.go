@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+// ErrJobRunExists is returned by JobRunStore.Start when another replica
+// already started the job for the same activation time.
+var ErrJobRunExists = errors.New("job run already exists")
+
+// JobRun is one execution of a scheduled job. Trigger is "schedule" or
+// "manual"; Attempts counts retries within the run.
+type JobRun struct {
+	ID          string     `bson:"_id" json:"id"`
+	Job         string     `bson:"job" json:"job"`
+	ScheduledAt time.Time  `bson:"scheduledAt" json:"scheduledAt"`
+	Trigger     string     `bson:"trigger" json:"trigger"`
+	Owner       string     `bson:"owner" json:"owner"`
+	Status      string     `bson:"status" json:"status"`
+	Attempts    int        `bson:"attempts" json:"attempts"`
+	Error       string     `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt   time.Time  `bson:"startedAt" json:"startedAt"`
+	FinishedAt  *time.Time `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+	DurationMs  int64      `bson:"durationMs,omitempty" json:"durationMs,omitempty"`
+}
+
+type JobRunStore struct {
+	collection *mongo.Collection
+}
+
+func NewJobRunStore(db *MongoDB) *JobRunStore {
+	return &JobRunStore{collection: db.Collection("job_runs")}
+}
+
+// EnsureIndexes creates the indexes, including one that expires runs after
+// retention. The unique index on job and activation time makes each
+// activation run at most once across replicas.
+func (s *JobRunStore) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "job", Value: 1}, {Key: "scheduledAt", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "startedAt", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "startedAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create job run indexes: %w", err)
+	}
+	return nil
+}
+
+// Start records run as running.
+func (s *JobRunStore) Start(ctx context.Context, run *JobRun) error {
+	if run.ID == "" {
+		run.ID = uuid.New().String()
+	}
+	run.Status = JobRunRunning
+	run.StartedAt = time.Now().UTC()
+
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, run)
+	observeMongo("insert", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrJobRunExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start job run: %w", err)
+	}
+	return nil
+}
+
+// Finish records the outcome of run.
+func (s *JobRunStore) Finish(ctx context.Context, run *JobRun) error {
+	finishedAt := time.Now().UTC()
+	run.FinishedAt = &finishedAt
+	run.DurationMs = finishedAt.Sub(run.StartedAt).Milliseconds()
+
+	start := time.Now()
+	_, err := s.collection.UpdateByID(ctx, run.ID, bson.M{"$set": bson.M{
+		"status":     run.Status,
+		"attempts":   run.Attempts,
+		"error":      run.Error,
+		"finishedAt": run.FinishedAt,
+		"durationMs": run.DurationMs,
+	}})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to finish job run: %w", err)
+	}
+	return nil
+}
+
+// List returns the most recent runs of job.
+func (s *JobRunStore) List(ctx context.Context, job string, limit int64) ([]JobRun, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(limit)
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, bson.M{"job": job}, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job runs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	runs := make([]JobRun, 0)
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, fmt.Errorf("failed to decode job runs: %w", err)
+	}
+	return runs, nil
+}
+
+// JobLockStore holds leases in MongoDB so that only one replica runs a job
+// at a time. A lease not renewed or released by its owner expires after its
+// TTL.
+type JobLockStore struct {
+	collection *mongo.Collection
+}
+
+func NewJobLockStore(db *MongoDB) *JobLockStore {
+	return &JobLockStore{collection: db.Collection("job_locks")}
+}
+
+// TryLock takes or renews the lease on name for owner. It reports false
+// when another owner holds an unexpired lease.
+func (s *JobLockStore) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"lockedUntil": bson.M{"$lte": now}},
+			bson.M{"owner": owner},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "lockedUntil": now.Add(ttl)}}
+
+	start := time.Now()
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	observeMongo("update", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		// The lease exists and is held by someone else, so the upsert
+		// tried to insert a second document with the same _id.
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire job lock: %w", err)
+	}
+	return true, nil
+}
+
+// Unlock releases owner's lease on name. Leases held by others are left
+// alone.
+func (s *JobLockStore) Unlock(ctx context.Context, name, owner string) error {
+	start := time.Now()
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": name, "owner": owner})
+	observeMongo("delete", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to release job lock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MarginStore reads the products and inventory cost layers order margins
+// are previewed from.
+type MarginStore struct {
+	products  *mongo.Collection
+	inventory *mongo.Collection
+}
+
+func NewMarginStore(db *MongoDB) *MarginStore {
+	return &MarginStore{
+		products:  db.Collection("products"),
+		inventory: db.Collection("inventory"),
+	}
+}
+
+func (s *MarginStore) FindProducts(ctx context.Context, tenantID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]*domain.Product, error) {
+	products := make(map[uuid.UUID]*domain.Product, len(ids))
+	err := eachDocument(ctx, s.products, bson.M{
+		"tenantId": tenantID,
+		"_id":      bson.M{"$in": ids},
+	}, func(cursor *mongo.Cursor) error {
+		var product domain.Product
+		if err := cursor.Decode(&product); err != nil {
+			return fmt.Errorf("failed to decode product: %w", err)
+		}
+		products[product.ID] = &product
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// FindCostLayers returns the tenant's items in stock of the products, in
+// warehouseID only unless it is uuid.Nil.
+func (s *MarginStore) FindCostLayers(ctx context.Context, tenantID uuid.UUID, productIDs []uuid.UUID, warehouseID uuid.UUID) ([]*domain.InventoryItem, error) {
+	filter := bson.M{
+		"tenantId":  tenantID,
+		"productId": bson.M{"$in": productIDs},
+		"quantity":  bson.M{"$gt": 0},
+	}
+	if warehouseID != uuid.Nil {
+		filter["warehouseId"] = warehouseID
+	}
+
+	var items []*domain.InventoryItem
+	err := eachDocument(ctx, s.inventory, filter, func(cursor *mongo.Cursor) error {
+		var item domain.InventoryItem
+		if err := cursor.Decode(&item); err != nil {
+			return fmt.Errorf("failed to decode inventory item: %w", err)
+		}
+		items = append(items, &item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
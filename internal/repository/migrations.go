@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrMigrationApplied is returned by MigrationStore.Record when the version
+// has already been recorded.
+var ErrMigrationApplied = errors.New("migration already applied")
+
+// MigrationRecord marks a schema migration as applied.
+type MigrationRecord struct {
+	Version    int       `bson:"_id" json:"version"`
+	Name       string    `bson:"name" json:"name"`
+	AppliedAt  time.Time `bson:"appliedAt" json:"appliedAt"`
+	DurationMs int64     `bson:"durationMs" json:"durationMs"`
+}
+
+type MigrationStore struct {
+	collection *mongo.Collection
+}
+
+func NewMigrationStore(db *MongoDB) *MigrationStore {
+	return &MigrationStore{collection: db.Collection("schema_migrations")}
+}
+
+// Applied returns the applied migrations, oldest version first.
+func (s *MigrationStore) Applied(ctx context.Context) ([]MigrationRecord, error) {
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	records := make([]MigrationRecord, 0)
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode applied migrations: %w", err)
+	}
+	return records, nil
+}
+
+func (s *MigrationStore) Record(ctx context.Context, record MigrationRecord) error {
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, record)
+	observeMongo("insert", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMigrationApplied
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	return nil
+}
+
+// IndexNames returns the names of the indexes on collection. A collection
+// that does not exist yet has none.
+func (m *MongoDB) IndexNames(ctx context.Context, collection string) (map[string]bool, error) {
+	coll := m.Collection(collection)
+	start := time.Now()
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	observeMongo("list_indexes", coll, start, err)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 26 { // NamespaceNotFound
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes on %s: %w", collection, err)
+	}
+
+	names := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		names[spec.Name] = true
+	}
+	return names, nil
+}
@@ -2,11 +2,14 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/fieldcrypt"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -32,7 +35,8 @@ func NewMongoDB(cfg config.MongoDBConfig, log *logger.Logger) (*MongoDB, error)
 		SetMaxPoolSize(cfg.MaxPoolSize).
 		SetMinPoolSize(cfg.MinPoolSize).
 		SetMaxConnIdleTime(cfg.MaxConnIdleTime).
-		SetServerSelectionTimeout(cfg.ServerSelection)
+		SetServerSelectionTimeout(cfg.ServerSelection).
+		SetMonitor(newMongoMonitor())
 
 	if cfg.Username != "" && cfg.Password != "" {
 		creds := options.Credential{
@@ -78,10 +82,182 @@ func (m *MongoDB) Health(ctx context.Context) error {
 	return m.client.Ping(ctx, readpref.Primary())
 }
 
+// WithTransaction runs fn inside a multi-document transaction. Repository
+// calls made with the context passed to fn join the transaction, and so do
+// nested WithTransaction calls.
+func (m *MongoDB) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if session := mongo.SessionFromContext(ctx); session != nil {
+		return fn(ctx)
+	}
+
+	session, err := m.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// DropCollection drops collection name; a missing collection is not an
+// error.
+func (m *MongoDB) DropCollection(ctx context.Context, name string) error {
+	coll := m.Collection(name)
+	start := time.Now()
+	err := coll.Drop(ctx)
+	observeMongo("drop", coll, start, err)
+	return err
+}
+
+// SwapTenantDocuments replaces tenantID's documents in target with those in
+// source, batch documents at a time rather than in one transaction, so it
+// works for tenants of any size. A target document whose version is newer
+// than its copy in source was written by a live projection after the copy
+// was built and is kept. Target documents missing from source are deleted
+// once every copy is in place. It returns how many documents were copied.
+func (m *MongoDB) SwapTenantDocuments(ctx context.Context, target, source, tenantID string, batch int) (int64, error) {
+	if batch <= 0 {
+		batch = 500
+	}
+	dst := m.Collection(target)
+	src := m.Collection(source)
+	filter := bson.M{"tenantId": tenantID}
+
+	cursor, err := src.Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	defer cursor.Close(ctx)
+
+	var copied int64
+	kept := make(map[string]bool)
+	models := make([]mongo.WriteModel, 0, batch)
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		start := time.Now()
+		result, err := dst.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil && !onlyDuplicateKeys(err) {
+			observeMongo("bulk_write", dst, start, err)
+			return fmt.Errorf("failed to copy into %s: %w", target, err)
+		}
+		observeMongo("bulk_write", dst, start, nil)
+		if result != nil {
+			copied += result.MatchedCount + result.UpsertedCount
+		}
+		models = models[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		// cursor.Current is reused between iterations.
+		doc := bson.Raw(append([]byte(nil), cursor.Current...))
+		id := doc.Lookup("_id")
+		kept[id.String()] = true
+
+		// A newer live document fails the version filter, so the upsert
+		// collides with it on _id and leaves it alone.
+		newer := bson.A{bson.M{"version": bson.M{"$exists": false}}}
+		if version, err := doc.LookupErr("version"); err == nil {
+			newer = append(newer, bson.M{"version": bson.M{"$lte": version}})
+		}
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": id, "tenantId": tenantID, "$or": newer}).
+			SetReplacement(doc).
+			SetUpsert(true))
+		if len(models) == batch {
+			if err := flush(); err != nil {
+				return copied, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return copied, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	if err := flush(); err != nil {
+		return copied, err
+	}
+
+	return copied, m.deleteMissing(ctx, dst, filter, kept, batch)
+}
+
+// deleteMissing deletes the documents of dst matching filter whose _id is
+// not in kept, batch at a time.
+func (m *MongoDB) deleteMissing(ctx context.Context, dst *mongo.Collection, filter bson.M, kept map[string]bool, batch int) error {
+	cursor, err := dst.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dst.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	stale := make(bson.A, 0, batch)
+	flush := func() error {
+		if len(stale) == 0 {
+			return nil
+		}
+		start := time.Now()
+		_, err := dst.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": stale}, "tenantId": filter["tenantId"]})
+		observeMongo("delete_many", dst, start, err)
+		if err != nil {
+			return fmt.Errorf("failed to clear %s: %w", dst.Name(), err)
+		}
+		stale = stale[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		id := cursor.Current.Lookup("_id")
+		if kept[id.String()] {
+			continue
+		}
+		stale = append(stale, bson.RawValue{Type: id.Type, Value: append([]byte(nil), id.Value...)})
+		if len(stale) == batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", dst.Name(), err)
+	}
+	return flush()
+}
+
+// onlyDuplicateKeys reports whether err is a bulk write whose only failures
+// are duplicate keys.
+func onlyDuplicateKeys(err error) bool {
+	var bulk mongo.BulkWriteException
+	if !errors.As(err, &bulk) || bulk.WriteConcernError != nil || len(bulk.WriteErrors) == 0 {
+		return false
+	}
+	for _, e := range bulk.WriteErrors {
+		if e.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+// observeMongo records call metrics; a missing document is not a failure.
+func observeMongo(operation string, coll *mongo.Collection, start time.Time, err error) {
+	if err == mongo.ErrNoDocuments {
+		err = nil
+	}
+	metrics.ObserveDB(operation, coll.Name(), start, err)
+}
+
+// ErrConcurrencyConflict means the aggregate changed between load and save.
+var ErrConcurrencyConflict = errors.New("concurrent modification")
+
 type EventStore struct {
 	collection *mongo.Collection
 	logger     *logger.Logger
 	tracer     trace.Tracer
+	keyring    *fieldcrypt.Keyring
 }
 
 func NewEventStore(db *MongoDB, logger *logger.Logger) *EventStore {
@@ -111,6 +287,21 @@ type EventMetadata struct {
 	Timestamp     time.Time `bson:"timestamp"`
 }
 
+// EnsureIndexes makes (aggregateId, version) unique, so two writers appending
+// the same version to an aggregate cannot both succeed.
+func (es *EventStore) EnsureIndexes(ctx context.Context) error {
+	_, err := es.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "aggregateId", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("aggregate_version"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create event store indexes: %w", err)
+	}
+	return nil
+}
+
+// Save appends events. It returns ErrConcurrencyConflict if another writer
+// already stored one of the same aggregate versions.
 func (es *EventStore) Save(ctx context.Context, events []StoredEvent) error {
 	ctx, span := es.tracer.Start(ctx, "mongo.save_events")
 	defer span.End()
@@ -121,14 +312,25 @@ func (es *EventStore) Save(ctx context.Context, events []StoredEvent) error {
 
 	docs := make([]interface{}, len(events))
 	for i, e := range events {
-		docs[i] = e
+		sealed, err := es.seal(e)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+		docs[i] = sealed
 		span.AddEvent(fmt.Sprintf("event_%d", i), trace.WithAttributes(
 			attribute.String("event_type", e.EventType),
 			attribute.String("aggregate_id", e.AggregateID),
 		))
 	}
 
+	start := time.Now()
 	_, err := es.collection.InsertMany(ctx, docs)
+	observeMongo("insert_many", es.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		span.RecordError(err)
+		return fmt.Errorf("%w: aggregate %s version %d", ErrConcurrencyConflict, events[0].AggregateID, events[0].Version)
+	}
 	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("failed to save events: %w", err)
@@ -148,7 +350,9 @@ func (es *EventStore) Load(ctx context.Context, aggregateID string) ([]StoredEve
 	}
 
 	opts := options.Find().SetSort(map[string]int{"version": 1})
+	start := time.Now()
 	cursor, err := es.collection.Find(ctx, filter, opts)
+	observeMongo("find", es.collection, start, err)
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to load events: %w", err)
@@ -160,6 +364,12 @@ func (es *EventStore) Load(ctx context.Context, aggregateID string) ([]StoredEve
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to decode events: %w", err)
 	}
+	for i := range events {
+		if err := es.open(&events[i]); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
 
 	span.SetAttributes(attribute.Int("event_count", len(events)))
 	return events, nil
@@ -182,7 +392,9 @@ func (es *EventStore) LoadByType(ctx context.Context, aggregateType string, tena
 		},
 	}
 
+	start := time.Now()
 	cursor, err := es.collection.Find(ctx, filter)
+	observeMongo("find", es.collection, start, err)
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to load events: %w", err)
@@ -194,10 +406,99 @@ func (es *EventStore) LoadByType(ctx context.Context, aggregateType string, tena
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to decode events: %w", err)
 	}
+	for i := range events {
+		if err := es.open(&events[i]); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
 
 	return events, nil
 }
 
+// EventFilter selects events for replay. Zero fields match everything.
+type EventFilter struct {
+	TenantID       string
+	AggregateTypes []string
+	From           time.Time
+	FromVersion    int64
+}
+
+func (f EventFilter) query() bson.M {
+	filter := bson.M{}
+	if f.TenantID != "" {
+		filter["metadata.tenantId"] = f.TenantID
+	}
+	if len(f.AggregateTypes) > 0 {
+		filter["aggregateType"] = bson.M{"$in": f.AggregateTypes}
+	}
+	if !f.From.IsZero() {
+		filter["timestamp"] = bson.M{"$gte": f.From}
+	}
+	if f.FromVersion > 0 {
+		filter["version"] = bson.M{"$gte": f.FromVersion}
+	}
+	return filter
+}
+
+func (es *EventStore) Count(ctx context.Context, f EventFilter) (int64, error) {
+	ctx, span := es.tracer.Start(ctx, "mongo.count_events")
+	defer span.End()
+
+	start := time.Now()
+	count, err := es.collection.CountDocuments(ctx, f.query())
+	observeMongo("count", es.collection, start, err)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to count events: %w", err)
+	}
+	return count, nil
+}
+
+// Stream calls fn for each matching event in timestamp order without loading
+// them all into memory. It stops at the first error fn returns.
+func (es *EventStore) Stream(ctx context.Context, f EventFilter, fn func(StoredEvent) error) error {
+	ctx, span := es.tracer.Start(ctx, "mongo.stream_events",
+		trace.WithAttributes(attribute.String("tenant_id", f.TenantID)),
+	)
+	defer span.End()
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "timestamp", Value: 1},
+		{Key: "aggregateId", Value: 1},
+		{Key: "version", Value: 1},
+	})
+
+	start := time.Now()
+	cursor, err := es.collection.Find(ctx, f.query(), opts)
+	observeMongo("find", es.collection, start, err)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to load events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var event StoredEvent
+		if err := cursor.Decode(&event); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		if err := es.open(&event); err != nil {
+			span.RecordError(err)
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+	return nil
+}
+
 func (es *EventStore) GetLatestVersion(ctx context.Context, aggregateID string) (int64, error) {
 	ctx, span := es.tracer.Start(ctx, "mongo.get_latest_version",
 		trace.WithAttributes(attribute.String("aggregate_id", aggregateID)),
@@ -210,7 +511,10 @@ func (es *EventStore) GetLatestVersion(ctx context.Context, aggregateID string)
 
 	opts := options.FindOne().SetSort(map[string]int{"version": -1})
 	var event StoredEvent
-	if err := es.collection.FindOne(ctx, filter, opts).Decode(&event); err != nil {
+	start := time.Now()
+	err := es.collection.FindOne(ctx, filter, opts).Decode(&event)
+	observeMongo("find_one", es.collection, start, err)
+	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return 0, nil
 		}
@@ -225,6 +529,8 @@ type ReadModelStore struct {
 	collection *mongo.Collection
 	logger     *logger.Logger
 	tracer     trace.Tracer
+	keyring    *fieldcrypt.Keyring
+	encrypted  []string
 }
 
 func NewReadModelStore(db *MongoDB, collectionName string, logger *logger.Logger) *ReadModelStore {
@@ -235,11 +541,26 @@ func NewReadModelStore(db *MongoDB, collectionName string, logger *logger.Logger
 	}
 }
 
+// ErrReadModelExists means Save found a document with the same ID, typically
+// because the event creating it was delivered twice.
+var ErrReadModelExists = errors.New("read model already exists")
+
 func (s *ReadModelStore) Save(ctx context.Context, model interface{}) error {
 	ctx, span := s.tracer.Start(ctx, "mongo.save_read_model")
 	defer span.End()
 
-	_, err := s.collection.InsertOne(ctx, model)
+	model, err := s.sealModel(model)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	start := time.Now()
+	_, err = s.collection.InsertOne(ctx, model)
+	observeMongo("insert", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %v", ErrReadModelExists, err)
+	}
 	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("failed to save read model: %w", err)
@@ -252,7 +573,15 @@ func (s *ReadModelStore) Update(ctx context.Context, filter interface{}, update
 	ctx, span := s.tracer.Start(ctx, "mongo.update_read_model")
 	defer span.End()
 
+	update, err := s.sealUpdate(update)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	start := time.Now()
 	result, err := s.collection.UpdateOne(ctx, filter, update)
+	observeMongo("update", s.collection, start, err)
 	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("failed to update read model: %w", err)
@@ -265,11 +594,42 @@ func (s *ReadModelStore) Update(ctx context.Context, filter interface{}, update
 	return nil
 }
 
+// UpdateMany applies update to every matching document, such as a renamed
+// client denormalized into many invoices. Matching nothing is not an error.
+func (s *ReadModelStore) UpdateMany(ctx context.Context, filter interface{}, update interface{}) error {
+	ctx, span := s.tracer.Start(ctx, "mongo.update_many_read_models")
+	defer span.End()
+
+	update, err := s.sealUpdate(update)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	start := time.Now()
+	_, err = s.collection.UpdateMany(ctx, filter, update)
+	observeMongo("update_many", s.collection, start, err)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to update read models: %w", err)
+	}
+
+	return nil
+}
+
 func (s *ReadModelStore) Upsert(ctx context.Context, filter interface{}, update interface{}) error {
 	ctx, span := s.tracer.Start(ctx, "mongo.upsert_read_model")
 	defer span.End()
 
-	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	update, err := s.sealUpdate(update)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	start := time.Now()
+	_, err = s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	observeMongo("upsert", s.collection, start, err)
 	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("failed to upsert read model: %w", err)
@@ -278,12 +638,14 @@ func (s *ReadModelStore) Upsert(ctx context.Context, filter interface{}, update
 	return nil
 }
 
-func (s *ReadModelStore) FindOne(ctx context.Context, filter interface{}) (interface{}, error) {
+func (s *ReadModelStore) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (interface{}, error) {
 	ctx, span := s.tracer.Start(ctx, "mongo.find_one_read_model")
 	defer span.End()
 
 	var result bson.M
-	err := s.collection.FindOne(ctx, filter).Decode(&result)
+	start := time.Now()
+	err := s.collection.FindOne(ctx, filter, opts...).Decode(&result)
+	observeMongo("find_one", s.collection, start, err)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil
@@ -291,6 +653,10 @@ func (s *ReadModelStore) FindOne(ctx context.Context, filter interface{}) (inter
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to find read model: %w", err)
 	}
+	if err := s.Decrypt(result); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
 
 	return result, nil
 }
@@ -299,7 +665,9 @@ func (s *ReadModelStore) Find(ctx context.Context, filter interface{}, opts ...*
 	ctx, span := s.tracer.Start(ctx, "mongo.find_read_models")
 	defer span.End()
 
+	start := time.Now()
 	cursor, err := s.collection.Find(ctx, filter, opts...)
+	observeMongo("find", s.collection, start, err)
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to find read models: %w", err)
@@ -314,6 +682,10 @@ func (s *ReadModelStore) Find(ctx context.Context, filter interface{}, opts ...*
 
 	resultsInterface := make([]interface{}, len(results))
 	for i, r := range results {
+		if err := s.Decrypt(r); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
 		resultsInterface[i] = r
 	}
 
@@ -324,7 +696,9 @@ func (s *ReadModelStore) Delete(ctx context.Context, filter interface{}) error {
 	ctx, span := s.tracer.Start(ctx, "mongo.delete_read_model")
 	defer span.End()
 
+	start := time.Now()
 	_, err := s.collection.DeleteOne(ctx, filter)
+	observeMongo("delete", s.collection, start, err)
 	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("failed to delete read model: %w", err)
@@ -337,7 +711,9 @@ func (s *ReadModelStore) Count(ctx context.Context, filter interface{}) (int64,
 	ctx, span := s.tracer.Start(ctx, "mongo.count_read_models")
 	defer span.End()
 
+	start := time.Now()
 	count, err := s.collection.CountDocuments(ctx, filter)
+	observeMongo("count", s.collection, start, err)
 	if err != nil {
 		span.RecordError(err)
 		return 0, fmt.Errorf("failed to count read models: %w", err)
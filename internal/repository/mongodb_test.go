@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestObserveMongo(t *testing.T) {
+	metrics.Initialize("test")
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.NoError(t, err, "connecting does not dial")
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	coll := client.Database("erp").Collection("payment_read_models")
+
+	observeMongo("find_one", coll, time.Now(), nil)
+	observeMongo("find_one", coll, time.Now(), mongo.ErrNoDocuments)
+	observeMongo("find_one", coll, time.Now(), errors.New("server selection timeout"))
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.DatabaseOperations.WithLabelValues("find_one", "payment_read_models")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ErrorsTotal.WithLabelValues("db_find_one", "payment_read_models")),
+		"a missing document is not an error")
+}
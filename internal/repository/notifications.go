@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotificationNotFound         = errors.New("notification not found")
+	ErrNotificationTemplateNotFound = errors.New("notification template not found")
+	// ErrNotificationExists is returned by NotificationStore.Add when the
+	// event was already sent to the recipient on the channel.
+	ErrNotificationExists = errors.New("notification already exists")
+)
+
+type NotificationTemplateStore struct {
+	collection *mongo.Collection
+}
+
+func NewNotificationTemplateStore(db *MongoDB) *NotificationTemplateStore {
+	return &NotificationTemplateStore{collection: db.Collection("notification_templates")}
+}
+
+func (s *NotificationTemplateStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "tenantId", Value: 1},
+				{Key: "eventType", Value: 1},
+				{Key: "channel", Value: 1},
+				{Key: "locale", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create notification template indexes: %w", err)
+	}
+	return nil
+}
+
+// Save creates or replaces the tenant's template for the template's event
+// type, channel and locale.
+func (s *NotificationTemplateStore) Save(ctx context.Context, tpl *domain.NotificationTemplate) error {
+	tpl.UpdatedAt = time.Now().UTC()
+	filter := bson.M{
+		"tenantId":  tpl.TenantID,
+		"eventType": tpl.EventType,
+		"channel":   tpl.Channel,
+		"locale":    tpl.Locale,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"subject":   tpl.Subject,
+			"body":      tpl.Body,
+			"updatedAt": tpl.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{"_id": uuid.New().String()},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	start := time.Now()
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(tpl)
+	observeMongo("find_one_and_update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to save notification template: %w", err)
+	}
+	return nil
+}
+
+// Find returns the tenant's templates for eventType and channel in any of
+// locales.
+func (s *NotificationTemplateStore) Find(ctx context.Context, tenantID, eventType, channel string, locales []string) ([]domain.NotificationTemplate, error) {
+	filter := bson.M{
+		"tenantId":  tenantID,
+		"eventType": eventType,
+		"channel":   channel,
+		"locale":    bson.M{"$in": locales},
+	}
+	return s.find(ctx, filter)
+}
+
+func (s *NotificationTemplateStore) List(ctx context.Context, tenantID string) ([]domain.NotificationTemplate, error) {
+	return s.find(ctx, bson.M{"tenantId": tenantID})
+}
+
+func (s *NotificationTemplateStore) find(ctx context.Context, filter bson.M) ([]domain.NotificationTemplate, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "eventType", Value: 1}, {Key: "channel", Value: 1}, {Key: "locale", Value: 1}})
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find notification templates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	templates := make([]domain.NotificationTemplate, 0)
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, fmt.Errorf("failed to decode notification templates: %w", err)
+	}
+	return templates, nil
+}
+
+func (s *NotificationTemplateStore) Delete(ctx context.Context, tenantID, id string) error {
+	start := time.Now()
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+	observeMongo("delete", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification template: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotificationTemplateNotFound
+	}
+	return nil
+}
+
+type NotificationPreferenceStore struct {
+	collection *mongo.Collection
+}
+
+func NewNotificationPreferenceStore(db *MongoDB) *NotificationPreferenceStore {
+	return &NotificationPreferenceStore{collection: db.Collection("notification_preferences")}
+}
+
+func (s *NotificationPreferenceStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create notification preference indexes: %w", err)
+	}
+	return nil
+}
+
+// Get returns the user's preferences, or empty preferences (everything
+// enabled) if the user never saved any.
+func (s *NotificationPreferenceStore) Get(ctx context.Context, tenantID, userID string) (*domain.NotificationPreference, error) {
+	start := time.Now()
+	pref := domain.NotificationPreference{TenantID: tenantID, UserID: userID}
+	err := s.collection.FindOne(ctx, bson.M{"tenantId": tenantID, "userId": userID}).Decode(&pref)
+	observeMongo("find_one", s.collection, start, err)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	return &pref, nil
+}
+
+func (s *NotificationPreferenceStore) Save(ctx context.Context, pref *domain.NotificationPreference) error {
+	pref.UpdatedAt = time.Now().UTC()
+
+	start := time.Now()
+	_, err := s.collection.ReplaceOne(ctx,
+		bson.M{"tenantId": pref.TenantID, "userId": pref.UserID},
+		pref,
+		options.Replace().SetUpsert(true),
+	)
+	observeMongo("replace", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+	return nil
+}
+
+type NotificationStore struct {
+	collection *mongo.Collection
+}
+
+func NewNotificationStore(db *MongoDB) *NotificationStore {
+	return &NotificationStore{collection: db.Collection("notifications")}
+}
+
+// EnsureIndexes creates the inbox index, a unique index that keeps an event
+// from being sent twice to the same recipient on the same channel, and a TTL
+// index that removes notifications after retention.
+func (s *NotificationStore) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}, {Key: "channel", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "eventId", Value: 1}, {Key: "channel", Value: 1}, {Key: "recipient", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("one_notification_per_event"),
+		},
+		{
+			Keys:    bson.D{{Key: "createdAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create notification indexes: %w", err)
+	}
+	return nil
+}
+
+// Add stores n. It returns ErrNotificationExists if the event was already
+// recorded for the recipient and channel.
+func (s *NotificationStore) Add(ctx context.Context, n *domain.Notification) error {
+	if n.ID == "" {
+		n.ID = uuid.New().String()
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now().UTC()
+	}
+
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, n)
+	observeMongo("insert", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrNotificationExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add notification: %w", err)
+	}
+	return nil
+}
+
+// SetStatus records the outcome of sending n.
+func (s *NotificationStore) SetStatus(ctx context.Context, n *domain.Notification) error {
+	start := time.Now()
+	_, err := s.collection.UpdateByID(ctx, n.ID, bson.M{"$set": bson.M{
+		"status": n.Status,
+		"error":  n.Error,
+		"sentAt": n.SentAt,
+	}})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	return nil
+}
+
+// Inbox returns the user's most recent in-app notifications.
+func (s *NotificationStore) Inbox(ctx context.Context, tenantID, userID string, unreadOnly bool, limit int64) ([]domain.Notification, error) {
+	filter := bson.M{"tenantId": tenantID, "userId": userID, "channel": domain.ChannelInApp}
+	if unreadOnly {
+		filter["readAt"] = nil
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	notifications := make([]domain.Notification, 0)
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, fmt.Errorf("failed to decode notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+func (s *NotificationStore) UnreadCount(ctx context.Context, tenantID, userID string) (int64, error) {
+	start := time.Now()
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"tenantId": tenantID,
+		"userId":   userID,
+		"channel":  domain.ChannelInApp,
+		"readAt":   nil,
+	})
+	observeMongo("count", s.collection, start, err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks one of the user's in-app notifications as read.
+func (s *NotificationStore) MarkRead(ctx context.Context, tenantID, userID, id string) error {
+	now := time.Now().UTC()
+
+	start := time.Now()
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "tenantId": tenantID, "userId": userID, "channel": domain.ChannelInApp},
+		bson.M{"$set": bson.M{"readAt": now}},
+	)
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification read: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
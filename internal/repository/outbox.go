@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusDelivered = "delivered"
+)
+
+// OutboxEntry is an event staged for publishing. Payload holds the serialized
+// event envelope exactly as it will be sent.
+type OutboxEntry struct {
+	ID          string     `bson:"_id"`
+	EventType   string     `bson:"eventType"`
+	AggregateID string     `bson:"aggregateId"`
+	TenantID    string     `bson:"tenantId"`
+	Payload     []byte     `bson:"payload"`
+	Status      string     `bson:"status"`
+	Attempts    int        `bson:"attempts"`
+	LastError   string     `bson:"lastError,omitempty"`
+	LockedUntil *time.Time `bson:"lockedUntil,omitempty"`
+	CreatedAt   time.Time  `bson:"createdAt"`
+	DeliveredAt *time.Time `bson:"deliveredAt,omitempty"`
+}
+
+type OutboxStore struct {
+	collection *mongo.Collection
+	logger     *logger.Logger
+}
+
+func NewOutboxStore(db *MongoDB, logger *logger.Logger) *OutboxStore {
+	return &OutboxStore{
+		collection: db.Collection("outbox"),
+		logger:     logger,
+	}
+}
+
+// EnsureIndexes creates the polling index and a TTL index that removes
+// delivered entries after retention.
+func (s *OutboxStore) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "deliveredAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create outbox indexes: %w", err)
+	}
+	return nil
+}
+
+// Add stages entries. Call it with a transaction context so the entries are
+// committed together with the aggregate write.
+func (s *OutboxStore) Add(ctx context.Context, entries ...OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(entries))
+	for i, e := range entries {
+		if e.Status == "" {
+			e.Status = OutboxStatusPending
+		}
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now().UTC()
+		}
+		docs[i] = e
+	}
+
+	start := time.Now()
+	_, err := s.collection.InsertMany(ctx, docs)
+	observeMongo("insert_many", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to add outbox entries: %w", err)
+	}
+	return nil
+}
+
+// Claim locks up to limit pending entries, oldest first, for lockFor. Entries
+// whose lock expired (e.g. the relay crashed mid-batch) are claimed again.
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lockFor time.Duration) ([]OutboxEntry, error) {
+	var claimed []OutboxEntry
+	for len(claimed) < limit {
+		now := time.Now().UTC()
+		filter := bson.M{
+			"status": OutboxStatusPending,
+			"$or": bson.A{
+				bson.M{"lockedUntil": bson.M{"$exists": false}},
+				bson.M{"lockedUntil": bson.M{"$lt": now}},
+			},
+		}
+		update := bson.M{
+			"$set": bson.M{"lockedUntil": now.Add(lockFor)},
+			"$inc": bson.M{"attempts": 1},
+		}
+		opts := options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+			SetReturnDocument(options.After)
+
+		start := time.Now()
+		var entry OutboxEntry
+		err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+		observeMongo("find_one_and_update", s.collection, start, err)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return claimed, fmt.Errorf("failed to claim outbox entry: %w", err)
+		}
+		claimed = append(claimed, entry)
+	}
+	return claimed, nil
+}
+
+func (s *OutboxStore) MarkDelivered(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	start := time.Now()
+	_, err := s.collection.UpdateByID(ctx, id, bson.M{
+		"$set":   bson.M{"status": OutboxStatusDelivered, "deliveredAt": now},
+		"$unset": bson.M{"lockedUntil": "", "lastError": ""},
+	})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox entry delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed releases the lock so the entry is retried on the next poll.
+func (s *OutboxStore) MarkFailed(ctx context.Context, id string, cause error) error {
+	start := time.Now()
+	_, err := s.collection.UpdateByID(ctx, id, bson.M{
+		"$set":   bson.M{"lastError": cause.Error()},
+		"$unset": bson.M{"lockedUntil": ""},
+	})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox entry failed: %w", err)
+	}
+	return nil
+}
+
+// Backlog returns the number of pending entries and the creation time of the
+// oldest one (zero when the outbox is empty).
+func (s *OutboxStore) Backlog(ctx context.Context) (int64, time.Time, error) {
+	filter := bson.M{"status": OutboxStatusPending}
+
+	start := time.Now()
+	count, err := s.collection.CountDocuments(ctx, filter)
+	observeMongo("count", s.collection, start, err)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to count outbox entries: %w", err)
+	}
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+
+	start = time.Now()
+	var oldest OutboxEntry
+	err = s.collection.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: 1}})).Decode(&oldest)
+	observeMongo("find_one", s.collection, start, err)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return count, time.Time{}, fmt.Errorf("failed to load oldest outbox entry: %w", err)
+	}
+	return count, oldest.CreatedAt, nil
+}
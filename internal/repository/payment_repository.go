@@ -84,8 +84,17 @@ func (r *MongoPaymentRepository) Update(ctx context.Context, payment *domain.Pay
 	// Update the UpdatedAt timestamp
 	payment.UpdatedAt = time.Now().UTC()
 
-	filter := bson.M{"_id": payment.ID}
-	update := bson.M{"$set": payment}
+	// Payments stored before versioning have no version field; null matches
+	// a missing field, so they are treated as version 0.
+	version := interface{}(payment.Version)
+	if payment.Version == 0 {
+		version = bson.M{"$in": bson.A{0, nil}}
+	}
+	filter := bson.M{"_id": payment.ID, "version": version}
+
+	next := *payment
+	next.Version++
+	update := bson.M{"$set": &next}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -98,11 +107,13 @@ func (r *MongoPaymentRepository) Update(ctx context.Context, payment *domain.Pay
 	}
 
 	if result.MatchedCount == 0 {
-		err := fmt.Errorf("payment not found: %s", payment.ID)
+		err := fmt.Errorf("%w: payment %s at version %d", ErrConcurrencyConflict, payment.ID, payment.Version)
 		span.RecordError(err)
 		return err
 	}
 
+	payment.Version++
+
 	r.logger.New(ctx).Info("Payment updated",
 		"payment_id", payment.ID,
 		"status", payment.Status,
@@ -202,3 +213,38 @@ func (r *MongoPaymentRepository) FindByProviderID(ctx context.Context, providerI
 	span.SetAttributes(attribute.String("result", "found"))
 	return &payment, nil
 }
+
+// FindByClientID retrieves a client's payments, oldest first
+func (r *MongoPaymentRepository) FindByClientID(ctx context.Context, tenantID, clientID uuid.UUID) ([]*domain.Payment, error) {
+	ctx, span := r.tracer.Start(ctx, "mongo.payment.find_by_client",
+		trace.WithAttributes(
+			attribute.String("tenant_id", tenantID.String()),
+			attribute.String("client_id", clientID.String()),
+		),
+	)
+	defer span.End()
+
+	filter := bson.M{"tenantId": tenantID, "clientId": clientID}
+
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		span.RecordError(err)
+		r.logger.New(ctx).Error("Failed to find payments by client",
+			"client_id", clientID,
+			"error", err,
+		)
+		return nil, fmt.Errorf("failed to find payments: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var payments []*domain.Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode payments: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("count", len(payments)))
+	return payments, nil
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
+)
+
+// postgresDriver is the database/sql driver name registered by pgx's stdlib
+// package, which postgres_pgx.go imports when built with the postgres tag.
+const postgresDriver = "pgx"
+
+// ErrPostgresUnavailable is returned when the binary was built without the
+// PostgreSQL driver; build with `-tags postgres` to include it.
+var ErrPostgresUnavailable = errors.New("postgres driver is not compiled in; build with -tags postgres")
+
+// Postgres is a PostgreSQL connection pool. Repositories built on it join
+// the transaction started by WithTransaction when given its context.
+type Postgres struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewPostgres(cfg config.PostgresConfig, log *logger.Logger) (*Postgres, error) {
+	if !slices.Contains(sql.Drivers(), postgresDriver) {
+		return nil, ErrPostgresUnavailable
+	}
+
+	db, err := sql.Open(postgresDriver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PostgreSQL: %w", err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping PostgreSQL: %w", err)
+	}
+
+	log.Info("Connected to PostgreSQL")
+	return &Postgres{db: db, logger: log}, nil
+}
+
+func (p *Postgres) DB() *sql.DB {
+	return p.db
+}
+
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
+
+type postgresTxKey struct{}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// WithTransaction runs fn inside a transaction, committing if fn returns nil.
+// Calls made with a context that already carries a transaction join it.
+func (p *Postgres) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(postgresTxKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(context.WithValue(ctx, postgresTxKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(postgresTxKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return p.db
+}
+
+func observePostgres(operation, table string, start time.Time, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	metrics.ObserveDB(operation, table, start, err)
+}
+
+// isUniqueViolation reports whether err is PostgreSQL error 23505. Driver
+// errors expose the code through SQLState.
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && pgErr.SQLState() == "23505"
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PostgresClientRepository keeps the current state of each client in the
+// clients table. Clients are event sourced, so the row is derived: Refresh
+// rebuilds it from the client's events, and PostgresEventStore.WithClients
+// calls it in the same transaction as every client event it saves.
+type PostgresClientRepository struct {
+	db     *Postgres
+	events *PostgresEventStore
+	logger *logger.Logger
+	tracer trace.Tracer
+}
+
+func NewPostgresClientRepository(db *Postgres, logger *logger.Logger) *PostgresClientRepository {
+	return &PostgresClientRepository{
+		db:     db,
+		events: NewPostgresEventStore(db, logger),
+		logger: logger,
+		tracer: otel.Tracer("client-repository"),
+	}
+}
+
+// Refresh rebuilds the client's row from its events. A purged client's row
+// is removed.
+func (r *PostgresClientRepository) Refresh(ctx context.Context, clientID string) error {
+	ctx, span := r.tracer.Start(ctx, "postgres.client.refresh",
+		trace.WithAttributes(attribute.String("client_id", clientID)),
+	)
+	defer span.End()
+
+	history, err := r.events.Load(ctx, clientID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	client, deletedAt := foldClient(history)
+
+	start := time.Now()
+	if client == nil {
+		_, err = r.db.conn(ctx).ExecContext(ctx, `DELETE FROM clients WHERE id = $1`, clientID)
+		observePostgres("delete", "clients", start, err)
+		if err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to remove client: %w", err)
+		}
+		return nil
+	}
+
+	doc, err := json.Marshal(client)
+	if err != nil {
+		return fmt.Errorf("failed to encode client: %w", err)
+	}
+	_, err = r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO clients (id, tenant_id, name, email, status, owner_id, territory, version, created_at, updated_at, deleted_at, document)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE
+		SET name = $3, email = $4, status = $5, owner_id = $6, territory = $7, version = $8, updated_at = $10, deleted_at = $11, document = $12`,
+		client.ID, client.TenantID, client.Name, client.Email, string(client.Status), client.OwnerID, client.Territory,
+		client.Version, client.CreatedAt, client.UpdatedAt, deletedAt, doc,
+	)
+	observePostgres("upsert", "clients", start, err)
+	if err != nil {
+		span.RecordError(err)
+		r.logger.New(ctx).Error("Failed to save client",
+			"client_id", clientID,
+			"error", err,
+		)
+		return fmt.Errorf("failed to save client: %w", err)
+	}
+	return nil
+}
+
+// FindByID returns the tenant's client unless it is in the trash.
+func (r *PostgresClientRepository) FindByID(ctx context.Context, tenantID, id uuid.UUID) (*domain.Client, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.client.find_by_id",
+		trace.WithAttributes(attribute.String("client_id", id.String())),
+	)
+	defer span.End()
+
+	client, err := r.findOne(ctx, "tenant_id = $1 AND id = $2", tenantID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("client not found: %s", id)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return client, nil
+}
+
+// FindByEmail returns the tenant's oldest client with email, compared
+// case-insensitively, that is not in the trash.
+func (r *PostgresClientRepository) FindByEmail(ctx context.Context, tenantID uuid.UUID, email string) (*domain.Client, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.client.find_by_email",
+		trace.WithAttributes(attribute.String("tenant_id", tenantID.String())),
+	)
+	defer span.End()
+
+	client, err := r.findOne(ctx, "tenant_id = $1 AND lower(email) = $2", tenantID, strings.ToLower(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("client not found: %s", email)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return client, nil
+}
+
+func (r *PostgresClientRepository) findOne(ctx context.Context, where string, args ...interface{}) (*domain.Client, error) {
+	start := time.Now()
+	var doc []byte
+	err := r.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT document FROM clients WHERE `+where+` AND deleted_at IS NULL ORDER BY created_at LIMIT 1`, args...).Scan(&doc)
+	observePostgres("select", "clients", start, err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find client: %w", err)
+	}
+
+	var client domain.Client
+	if err := json.Unmarshal(doc, &client); err != nil {
+		return nil, fmt.Errorf("failed to decode client: %w", err)
+	}
+	return &client, nil
+}
+
+// foldClient replays a client's events. It returns nil for a client without
+// events or one that was purged, and when the client is in the trash, the
+// time it was deleted.
+func foldClient(history []StoredEvent) (*domain.Client, *time.Time) {
+	if len(history) == 0 || history[len(history)-1].EventType == "ClientPurged" {
+		return nil, nil
+	}
+
+	client := &domain.Client{
+		Status:            domain.ClientStatusActive,
+		ShippingAddresses: []domain.Address{},
+		Tags:              []string{},
+		CustomFields:      make(map[string]interface{}),
+	}
+	var deletedAt *time.Time
+	for _, e := range history {
+		data := e.EventData
+		switch e.EventType {
+		case "ClientCreated":
+			client.ID, _ = uuid.Parse(e.AggregateID)
+			client.TenantID, _ = uuid.Parse(e.Metadata.TenantID)
+			client.Name = eventString(data, "name")
+			client.Email = eventString(data, "email")
+			client.Phone = eventString(data, "phone")
+			client.Locale = eventString(data, "locale")
+			client.CreditLimit, _ = decimal.NewFromString(eventString(data, "creditLimit"))
+			client.OwnerID = eventString(data, "ownerId")
+			client.Territory = eventString(data, "territory")
+			decodeEventField(data, "billingAddress", &client.BillingAddress)
+			decodeEventField(data, "shippingAddresses", &client.ShippingAddresses)
+			decodeEventField(data, "tags", &client.Tags)
+			decodeEventField(data, "customFields", &client.CustomFields)
+			client.CreatedAt = e.Timestamp
+		case "ClientUpdated":
+			client.Name = eventString(data, "name")
+			client.Email = eventString(data, "email")
+			client.Phone = eventString(data, "phone")
+			client.Locale = eventString(data, "locale")
+		case "ClientDeactivated":
+			client.Status = domain.ClientStatusInactive
+		case "CreditLimitAssigned":
+			if limit, err := decimal.NewFromString(eventString(data, "newLimit")); err == nil {
+				client.CreditLimit = limit
+			}
+		case "ClientOwnerAssigned":
+			client.OwnerID = eventString(data, "ownerId")
+			client.Territory = eventString(data, "territory")
+		case "BillingInfoUpdated":
+			decodeEventField(data, "billingAddress", &client.BillingAddress)
+		case "ClientDeleted":
+			at := e.Timestamp
+			deletedAt = &at
+		case "ClientRestored":
+			deletedAt = nil
+		}
+		client.Version = e.Version
+		client.UpdatedAt = e.Timestamp
+	}
+	return client, deletedAt
+}
+
+func eventString(data map[string]interface{}, key string) string {
+	s, _ := data[key].(string)
+	return s
+}
+
+// decodeEventField decodes data[key] into v. Freshly appended events carry
+// domain values and loaded ones their JSON form, so it goes through JSON.
+func decodeEventField(data map[string]interface{}, key string, v interface{}) {
+	raw, ok := data[key]
+	if !ok || raw == nil {
+		return
+	}
+	if b, err := json.Marshal(raw); err == nil {
+		json.Unmarshal(b, v)
+	}
+}
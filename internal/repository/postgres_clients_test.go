@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldClient(t *testing.T) {
+	clientID, tenantID := uuid.New(), uuid.New()
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	event := func(version int64, eventType string, data map[string]interface{}) StoredEvent {
+		return StoredEvent{
+			AggregateID: clientID.String(),
+			EventType:   eventType,
+			EventData:   data,
+			Version:     version,
+			Timestamp:   created.Add(time.Duration(version) * time.Hour),
+			Metadata:    EventMetadata{TenantID: tenantID.String()},
+		}
+	}
+
+	// Events loaded back carry the JSON form of addresses and slices.
+	var loaded map[string]interface{}
+	raw, _ := json.Marshal(map[string]interface{}{
+		"name":           "Acme",
+		"email":          "billing@acme.test",
+		"creditLimit":    "1000",
+		"billingAddress": domain.Address{City: "Sofia"},
+		"tags":           []string{"vip"},
+		"territory":      "north",
+	})
+	require.NoError(t, json.Unmarshal(raw, &loaded))
+
+	history := []StoredEvent{
+		event(1, "ClientCreated", loaded),
+		event(2, "ClientUpdated", map[string]interface{}{"name": "Acme Ltd", "email": "billing@acme.test"}),
+		event(3, "CreditLimitAssigned", map[string]interface{}{"newLimit": "2500"}),
+		event(4, "BillingInfoUpdated", map[string]interface{}{"billingAddress": domain.Address{City: "Varna"}}),
+		event(5, "ClientDeactivated", map[string]interface{}{"reason": "closed"}),
+	}
+	client, deletedAt := foldClient(history)
+	require.NotNil(t, client)
+	assert.Nil(t, deletedAt)
+	assert.Equal(t, clientID, client.ID)
+	assert.Equal(t, tenantID, client.TenantID)
+	assert.Equal(t, "Acme Ltd", client.Name)
+	assert.True(t, decimal.NewFromInt(2500).Equal(client.CreditLimit))
+	assert.Equal(t, "Varna", client.BillingAddress.City)
+	assert.Equal(t, []string{"vip"}, client.Tags)
+	assert.Equal(t, "north", client.Territory)
+	assert.Equal(t, domain.ClientStatusInactive, client.Status)
+	assert.Equal(t, int64(5), client.Version)
+	assert.Equal(t, created.Add(time.Hour), client.CreatedAt)
+	assert.Equal(t, created.Add(5*time.Hour), client.UpdatedAt)
+
+	history = append(history, event(6, "ClientDeleted", map[string]interface{}{}))
+	_, deletedAt = foldClient(history)
+	require.NotNil(t, deletedAt)
+	assert.Equal(t, created.Add(6*time.Hour), *deletedAt)
+
+	history = append(history, event(7, "ClientRestored", map[string]interface{}{}))
+	_, deletedAt = foldClient(history)
+	assert.Nil(t, deletedAt)
+
+	client, _ = foldClient(append(history, event(8, "ClientPurged", map[string]interface{}{})))
+	assert.Nil(t, client, "a purged client has no row")
+	client, _ = foldClient(nil)
+	assert.Nil(t, client)
+}
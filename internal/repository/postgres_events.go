@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PostgresEventStore stores aggregate events, client events included, in the
+// events table. (aggregate_id, version) is the primary key, so two writers
+// appending the same version cannot both succeed.
+type PostgresEventStore struct {
+	db      *Postgres
+	clients *PostgresClientRepository
+	logger  *logger.Logger
+	tracer  trace.Tracer
+}
+
+func NewPostgresEventStore(db *Postgres, logger *logger.Logger) *PostgresEventStore {
+	return &PostgresEventStore{
+		db:     db,
+		logger: logger,
+		tracer: otel.Tracer("event-store"),
+	}
+}
+
+// WithClients keeps the clients table current: saving client events also
+// refreshes those clients' rows, in the same transaction.
+func (es *PostgresEventStore) WithClients(clients *PostgresClientRepository) *PostgresEventStore {
+	es.clients = clients
+	return es
+}
+
+// Save appends events in one statement. It returns ErrConcurrencyConflict if
+// another writer already stored one of the same aggregate versions.
+func (es *PostgresEventStore) Save(ctx context.Context, events []StoredEvent) error {
+	ctx, span := es.tracer.Start(ctx, "postgres.save_events")
+	defer span.End()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO events (id, aggregate_id, aggregate_type, event_type, event_data, tenant_id, user_id, correlation_id, causation_id, version, timestamp) VALUES `
+	args := make([]interface{}, 0, len(events)*11)
+	for i, e := range events {
+		data, err := json.Marshal(e.EventData)
+		if err != nil {
+			return fmt.Errorf("failed to encode event data: %w", err)
+		}
+		if i > 0 {
+			query += ", "
+		}
+		n := len(args)
+		query += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11)
+		args = append(args, e.ID, e.AggregateID, e.AggregateType, e.EventType, data,
+			e.Metadata.TenantID, e.Metadata.UserID, e.Metadata.CorrelationID, e.Metadata.CausationID,
+			e.Version, e.Timestamp)
+		span.AddEvent(fmt.Sprintf("event_%d", i), trace.WithAttributes(
+			attribute.String("event_type", e.EventType),
+			attribute.String("aggregate_id", e.AggregateID),
+		))
+	}
+
+	if es.clients == nil {
+		return es.insert(ctx, span, query, args, events)
+	}
+	return es.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := es.insert(ctx, span, query, args, events); err != nil {
+			return err
+		}
+		refreshed := make(map[string]bool)
+		for _, e := range events {
+			if e.AggregateType != "Client" || refreshed[e.AggregateID] {
+				continue
+			}
+			refreshed[e.AggregateID] = true
+			if err := es.clients.Refresh(ctx, e.AggregateID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (es *PostgresEventStore) insert(ctx context.Context, span trace.Span, query string, args []interface{}, events []StoredEvent) error {
+	start := time.Now()
+	_, err := es.db.conn(ctx).ExecContext(ctx, query, args...)
+	observePostgres("insert", "events", start, err)
+	if isUniqueViolation(err) {
+		span.RecordError(err)
+		return fmt.Errorf("%w: aggregate %s version %d", ErrConcurrencyConflict, events[0].AggregateID, events[0].Version)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to save events: %w", err)
+	}
+	return nil
+}
+
+func (es *PostgresEventStore) Load(ctx context.Context, aggregateID string) ([]StoredEvent, error) {
+	ctx, span := es.tracer.Start(ctx, "postgres.load_events",
+		trace.WithAttributes(attribute.String("aggregate_id", aggregateID)),
+	)
+	defer span.End()
+
+	events, err := es.query(ctx, `WHERE aggregate_id = $1 ORDER BY version`, aggregateID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("event_count", len(events)))
+	return events, nil
+}
+
+func (es *PostgresEventStore) LoadByType(ctx context.Context, aggregateType string, tenantID string, from time.Time) ([]StoredEvent, error) {
+	ctx, span := es.tracer.Start(ctx, "postgres.load_events_by_type",
+		trace.WithAttributes(
+			attribute.String("aggregate_type", aggregateType),
+			attribute.String("tenant_id", tenantID),
+		),
+	)
+	defer span.End()
+
+	events, err := es.query(ctx, `WHERE aggregate_type = $1 AND tenant_id = $2 AND timestamp >= $3 ORDER BY timestamp`,
+		aggregateType, tenantID, from)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return events, nil
+}
+
+func (es *PostgresEventStore) GetLatestVersion(ctx context.Context, aggregateID string) (int64, error) {
+	ctx, span := es.tracer.Start(ctx, "postgres.get_latest_version",
+		trace.WithAttributes(attribute.String("aggregate_id", aggregateID)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	var version sql.NullInt64
+	err := es.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT max(version) FROM events WHERE aggregate_id = $1`, aggregateID).Scan(&version)
+	observePostgres("select", "events", start, err)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("failed to get latest version: %w", err)
+	}
+	return version.Int64, nil
+}
+
+func (es *PostgresEventStore) query(ctx context.Context, where string, args ...interface{}) ([]StoredEvent, error) {
+	start := time.Now()
+	rows, err := es.db.conn(ctx).QueryContext(ctx, `
+		SELECT id, aggregate_id, aggregate_type, event_type, event_data, tenant_id, user_id, correlation_id, causation_id, version, timestamp
+		FROM events `+where, args...)
+	observePostgres("select", "events", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []StoredEvent
+	for rows.Next() {
+		var e StoredEvent
+		var data []byte
+		if err := rows.Scan(&e.ID, &e.AggregateID, &e.AggregateType, &e.EventType, &data,
+			&e.Metadata.TenantID, &e.Metadata.UserID, &e.Metadata.CorrelationID, &e.Metadata.CausationID,
+			&e.Version, &e.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to decode events: %w", err)
+		}
+		if err := json.Unmarshal(data, &e.EventData); err != nil {
+			return nil, fmt.Errorf("failed to decode event data: %w", err)
+		}
+		e.Metadata.Timestamp = e.Timestamp
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,364 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PostgresInvoiceRepository implements commands.InvoiceRepository. Like
+// PostgresPaymentRepository it keeps lookup and reporting fields in columns
+// and the full invoice, lines included, in the document column.
+type PostgresInvoiceRepository struct {
+	db     *Postgres
+	logger *logger.Logger
+	tracer trace.Tracer
+}
+
+func NewPostgresInvoiceRepository(db *Postgres, logger *logger.Logger) *PostgresInvoiceRepository {
+	return &PostgresInvoiceRepository{
+		db:     db,
+		logger: logger,
+		tracer: otel.Tracer("invoice-repository"),
+	}
+}
+
+func (r *PostgresInvoiceRepository) Create(ctx context.Context, invoice *domain.Invoice) error {
+	ctx, span := r.tracer.Start(ctx, "postgres.invoice.create",
+		trace.WithAttributes(
+			attribute.String("invoice_id", invoice.ID.String()),
+			attribute.String("tenant_id", invoice.TenantID.String()),
+		),
+	)
+	defer span.End()
+
+	now := time.Now().UTC()
+	if invoice.CreatedAt.IsZero() {
+		invoice.CreatedAt = now
+	}
+	if invoice.UpdatedAt.IsZero() {
+		invoice.UpdatedAt = now
+	}
+
+	doc, err := json.Marshal(invoice)
+	if err != nil {
+		return fmt.Errorf("failed to encode invoice: %w", err)
+	}
+
+	start := time.Now()
+	_, err = r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO invoices (id, tenant_id, invoice_number, client_id, status, currency, total, amount_due, due_date, version, created_at, updated_at, document)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		invoice.ID, invoice.TenantID, invoice.InvoiceNumber, invoice.ClientID, string(invoice.Status),
+		invoice.Currency, invoice.Total.String(), invoice.AmountDue.String(), invoice.DueDate,
+		invoice.Version, invoice.CreatedAt, invoice.UpdatedAt, doc,
+	)
+	observePostgres("insert", "invoices", start, err)
+	if err != nil {
+		span.RecordError(err)
+		r.logger.New(ctx).Error("Failed to create invoice",
+			"invoice_id", invoice.ID,
+			"error", err,
+		)
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	r.logger.New(ctx).Info("Invoice created",
+		"invoice_id", invoice.ID,
+		"invoice_number", invoice.InvoiceNumber,
+	)
+	return nil
+}
+
+// Update saves invoice if it is still at invoice.Version, returning
+// ErrConcurrencyConflict otherwise.
+func (r *PostgresInvoiceRepository) Update(ctx context.Context, invoice *domain.Invoice) error {
+	return r.UpdateVersions(ctx, invoice, 1)
+}
+
+// UpdateVersions is Update advancing the version by versions in the same
+// statement.
+func (r *PostgresInvoiceRepository) UpdateVersions(ctx context.Context, invoice *domain.Invoice, versions int64) error {
+	ctx, span := r.tracer.Start(ctx, "postgres.invoice.update",
+		trace.WithAttributes(
+			attribute.String("invoice_id", invoice.ID.String()),
+			attribute.String("status", string(invoice.Status)),
+		),
+	)
+	defer span.End()
+
+	invoice.UpdatedAt = time.Now().UTC()
+	next := *invoice
+	next.Version += versions
+
+	doc, err := json.Marshal(&next)
+	if err != nil {
+		return fmt.Errorf("failed to encode invoice: %w", err)
+	}
+
+	start := time.Now()
+	result, err := r.db.conn(ctx).ExecContext(ctx, `
+		UPDATE invoices
+		SET status = $3, currency = $4, total = $5, amount_due = $6, due_date = $7, version = $8, updated_at = $9, document = $10
+		WHERE id = $1 AND version = $2`,
+		invoice.ID, invoice.Version, string(next.Status), next.Currency, next.Total.String(),
+		next.AmountDue.String(), next.DueDate, next.Version, next.UpdatedAt, doc,
+	)
+	observePostgres("update", "invoices", start, err)
+	if err != nil {
+		span.RecordError(err)
+		r.logger.New(ctx).Error("Failed to update invoice",
+			"invoice_id", invoice.ID,
+			"error", err,
+		)
+		return fmt.Errorf("failed to update invoice: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		err := fmt.Errorf("%w: invoice %s at version %d", ErrConcurrencyConflict, invoice.ID, invoice.Version)
+		span.RecordError(err)
+		return err
+	}
+
+	invoice.Version = next.Version
+
+	r.logger.New(ctx).Info("Invoice updated",
+		"invoice_id", invoice.ID,
+		"status", invoice.Status,
+	)
+	return nil
+}
+
+func (r *PostgresInvoiceRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.Invoice, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.invoice.find_by_id",
+		trace.WithAttributes(attribute.String("invoice_id", id.String())),
+	)
+	defer span.End()
+
+	invoice, err := r.findOne(ctx, "id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("invoice not found: %s", id)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return invoice, nil
+}
+
+func (r *PostgresInvoiceRepository) FindByInvoiceNumber(ctx context.Context, tenantID uuid.UUID, invoiceNumber string) (*domain.Invoice, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.invoice.find_by_number",
+		trace.WithAttributes(
+			attribute.String("tenant_id", tenantID.String()),
+			attribute.String("invoice_number", invoiceNumber),
+		),
+	)
+	defer span.End()
+
+	invoice, err := r.findOne(ctx, "tenant_id = $1 AND invoice_number = $2", tenantID, invoiceNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("invoice not found: %s", invoiceNumber)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// FindByClientID returns a page of the client's invoices, newest first.
+func (r *PostgresInvoiceRepository) FindByClientID(ctx context.Context, clientID uuid.UUID, limit, offset int) ([]*domain.Invoice, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.invoice.find_by_client_id",
+		trace.WithAttributes(attribute.String("client_id", clientID.String())),
+	)
+	defer span.End()
+
+	start := time.Now()
+	rows, err := r.db.conn(ctx).QueryContext(ctx,
+		`SELECT document FROM invoices WHERE client_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`,
+		clientID, limit, offset)
+	observePostgres("select", "invoices", start, err)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to find invoices: %w", err)
+	}
+	defer rows.Close()
+
+	var invoices []*domain.Invoice
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return nil, fmt.Errorf("failed to read invoice: %w", err)
+		}
+		var invoice domain.Invoice
+		if err := json.Unmarshal(doc, &invoice); err != nil {
+			return nil, fmt.Errorf("failed to decode invoice: %w", err)
+		}
+		invoices = append(invoices, &invoice)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to find invoices: %w", err)
+	}
+	return invoices, nil
+}
+
+// FindOpen returns the tenant's invoices in currency that are awaiting
+// payment: pending, sent or overdue with an amount due.
+func (r *PostgresInvoiceRepository) FindOpen(ctx context.Context, tenantID uuid.UUID, currency string) ([]*domain.Invoice, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.invoice.find_open",
+		trace.WithAttributes(
+			attribute.String("tenant_id", tenantID.String()),
+			attribute.String("currency", currency),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	rows, err := r.db.conn(ctx).QueryContext(ctx,
+		`SELECT document FROM invoices
+		 WHERE tenant_id = $1 AND currency = $2 AND status IN ($3, $4, $5) AND amount_due > 0
+		 ORDER BY due_date`,
+		tenantID, currency, string(domain.InvoiceStatusPending), string(domain.InvoiceStatusSent), string(domain.InvoiceStatusOverdue))
+	observePostgres("select", "invoices", start, err)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to find open invoices: %w", err)
+	}
+	defer rows.Close()
+
+	var invoices []*domain.Invoice
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return nil, fmt.Errorf("failed to read invoice: %w", err)
+		}
+		var invoice domain.Invoice
+		if err := json.Unmarshal(doc, &invoice); err != nil {
+			return nil, fmt.Errorf("failed to decode invoice: %w", err)
+		}
+		invoices = append(invoices, &invoice)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to find open invoices: %w", err)
+	}
+	return invoices, nil
+}
+
+// EachIssued calls fn with the tenant's invoices and credit notes issued in
+// [from, to), leaving drafts and voided invoices out. The issue date is
+// only kept in the document.
+func (r *PostgresInvoiceRepository) EachIssued(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Invoice) error) error {
+	ctx, span := r.tracer.Start(ctx, "postgres.invoice.each_issued",
+		trace.WithAttributes(attribute.String("tenant_id", tenantID.String())),
+	)
+	defer span.End()
+
+	start := time.Now()
+	rows, err := r.db.conn(ctx).QueryContext(ctx,
+		`SELECT document FROM invoices
+		 WHERE tenant_id = $1 AND status NOT IN ($2, $3)
+		   AND (document->>'issueDate')::timestamptz >= $4 AND (document->>'issueDate')::timestamptz < $5
+		 ORDER BY (document->>'issueDate')::timestamptz`,
+		tenantID, string(domain.InvoiceStatusDraft), string(domain.InvoiceStatusCancelled), from, to)
+	observePostgres("select", "invoices", start, err)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to find issued invoices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return fmt.Errorf("failed to read invoice: %w", err)
+		}
+		var invoice domain.Invoice
+		if err := json.Unmarshal(doc, &invoice); err != nil {
+			return fmt.Errorf("failed to decode invoice: %w", err)
+		}
+		if err := fn(&invoice); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to find issued invoices: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresInvoiceRepository) findOne(ctx context.Context, where string, args ...interface{}) (*domain.Invoice, error) {
+	start := time.Now()
+	var doc []byte
+	err := r.db.conn(ctx).QueryRowContext(ctx, `SELECT document FROM invoices WHERE `+where, args...).Scan(&doc)
+	observePostgres("select", "invoices", start, err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find invoice: %w", err)
+	}
+
+	var invoice domain.Invoice
+	if err := json.Unmarshal(doc, &invoice); err != nil {
+		return nil, fmt.Errorf("failed to decode invoice: %w", err)
+	}
+	return &invoice, nil
+}
+
+// PostgresInvoiceCounter implements commands.InvoiceCounter with one row per
+// tenant and year, incremented atomically by an upsert.
+type PostgresInvoiceCounter struct {
+	db     *Postgres
+	logger *logger.Logger
+	tracer trace.Tracer
+}
+
+func NewPostgresInvoiceCounter(db *Postgres, logger *logger.Logger) *PostgresInvoiceCounter {
+	return &PostgresInvoiceCounter{
+		db:     db,
+		logger: logger,
+		tracer: otel.Tracer("invoice-counter"),
+	}
+}
+
+// GetNextInvoiceNumber returns the next number for tenantID in year, formatted
+// "INV-{year}-{sequence:06d}".
+func (c *PostgresInvoiceCounter) GetNextInvoiceNumber(ctx context.Context, tenantID uuid.UUID, year int) (string, error) {
+	ctx, span := c.tracer.Start(ctx, "postgres.invoice_counter.get_next",
+		trace.WithAttributes(
+			attribute.String("tenant_id", tenantID.String()),
+			attribute.Int("year", year),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	var sequence int64
+	err := c.db.conn(ctx).QueryRowContext(ctx, `
+		INSERT INTO invoice_counters (tenant_id, year, sequence, updated_at)
+		VALUES ($1, $2, 1, now())
+		ON CONFLICT (tenant_id, year) DO UPDATE
+		SET sequence = invoice_counters.sequence + 1, updated_at = now()
+		RETURNING sequence`,
+		tenantID, year,
+	).Scan(&sequence)
+	observePostgres("upsert", "invoice_counters", start, err)
+	if err != nil {
+		span.RecordError(err)
+		return "", fmt.Errorf("failed to increment invoice counter: %w", err)
+	}
+
+	return fmt.Sprintf("INV-%d-%06d", year, sequence), nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// PostgresOutboxStore is the outbox table counterpart of OutboxStore. Entries
+// added with a transaction context commit with the aggregate write.
+type PostgresOutboxStore struct {
+	db     *Postgres
+	logger *logger.Logger
+}
+
+func NewPostgresOutboxStore(db *Postgres, logger *logger.Logger) *PostgresOutboxStore {
+	return &PostgresOutboxStore{db: db, logger: logger}
+}
+
+func (s *PostgresOutboxStore) Add(ctx context.Context, entries ...OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO outbox (id, event_type, aggregate_id, tenant_id, payload, status, created_at) VALUES `
+	args := make([]interface{}, 0, len(entries)*7)
+	for i, e := range entries {
+		if e.Status == "" {
+			e.Status = OutboxStatusPending
+		}
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now().UTC()
+		}
+		if i > 0 {
+			query += ", "
+		}
+		n := len(args)
+		query += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+		args = append(args, e.ID, e.EventType, e.AggregateID, e.TenantID, e.Payload, e.Status, e.CreatedAt)
+	}
+
+	start := time.Now()
+	_, err := s.db.conn(ctx).ExecContext(ctx, query, args...)
+	observePostgres("insert", "outbox", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to add outbox entries: %w", err)
+	}
+	return nil
+}
+
+// Claim locks up to limit pending entries, oldest first, for lockFor. SKIP
+// LOCKED lets several relays claim disjoint batches without waiting on each
+// other; entries whose lock expired are claimed again.
+func (s *PostgresOutboxStore) Claim(ctx context.Context, limit int, lockFor time.Duration) ([]OutboxEntry, error) {
+	now := time.Now().UTC()
+	start := time.Now()
+	rows, err := s.db.conn(ctx).QueryContext(ctx, `
+		UPDATE outbox SET locked_until = $3, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = $1 AND (locked_until IS NULL OR locked_until < $2)
+			ORDER BY created_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, aggregate_id, tenant_id, payload, status, attempts, coalesce(last_error, ''), locked_until, created_at`,
+		OutboxStatusPending, now, now.Add(lockFor), limit,
+	)
+	observePostgres("update", "outbox", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox entries: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []OutboxEntry
+	for rows.Next() {
+		var e OutboxEntry
+		var lockedUntil sql.NullTime
+		if err := rows.Scan(&e.ID, &e.EventType, &e.AggregateID, &e.TenantID, &e.Payload, &e.Status,
+			&e.Attempts, &e.LastError, &lockedUntil, &e.CreatedAt); err != nil {
+			return claimed, fmt.Errorf("failed to read outbox entry: %w", err)
+		}
+		if lockedUntil.Valid {
+			e.LockedUntil = &lockedUntil.Time
+		}
+		claimed = append(claimed, e)
+	}
+	if err := rows.Err(); err != nil {
+		return claimed, fmt.Errorf("failed to claim outbox entries: %w", err)
+	}
+	// RETURNING does not preserve the subquery's order.
+	slices.SortFunc(claimed, func(a, b OutboxEntry) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return claimed, nil
+}
+
+func (s *PostgresOutboxStore) MarkDelivered(ctx context.Context, id string) error {
+	start := time.Now()
+	_, err := s.db.conn(ctx).ExecContext(ctx,
+		`UPDATE outbox SET status = $2, delivered_at = $3, locked_until = NULL, last_error = NULL WHERE id = $1`,
+		id, OutboxStatusDelivered, time.Now().UTC())
+	observePostgres("update", "outbox", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox entry delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed releases the lock so the entry is retried on the next poll.
+func (s *PostgresOutboxStore) MarkFailed(ctx context.Context, id string, cause error) error {
+	start := time.Now()
+	_, err := s.db.conn(ctx).ExecContext(ctx,
+		`UPDATE outbox SET last_error = $2, locked_until = NULL WHERE id = $1`, id, cause.Error())
+	observePostgres("update", "outbox", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox entry failed: %w", err)
+	}
+	return nil
+}
+
+// Backlog returns the number of pending entries and the creation time of the
+// oldest one (zero when the outbox is empty).
+func (s *PostgresOutboxStore) Backlog(ctx context.Context) (int64, time.Time, error) {
+	start := time.Now()
+	var count int64
+	var oldest sql.NullTime
+	err := s.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT count(*), min(created_at) FROM outbox WHERE status = $1`, OutboxStatusPending,
+	).Scan(&count, &oldest)
+	observePostgres("select", "outbox", start, err)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to count outbox entries: %w", err)
+	}
+	return count, oldest.Time, nil
+}
+
+// PurgeDelivered deletes entries delivered more than retention ago. Postgres
+// has no TTL index, so the relay calls this periodically.
+func (s *PostgresOutboxStore) PurgeDelivered(ctx context.Context, retention time.Duration) (int64, error) {
+	start := time.Now()
+	result, err := s.db.conn(ctx).ExecContext(ctx,
+		`DELETE FROM outbox WHERE status = $1 AND delivered_at < $2`,
+		OutboxStatusDelivered, time.Now().UTC().Add(-retention))
+	observePostgres("delete", "outbox", start, err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox entries: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PostgresPaymentRepository implements commands.PaymentRepository. Columns
+// hold the fields payments are looked up and reported by; the full payment
+// is kept in the document column.
+type PostgresPaymentRepository struct {
+	db     *Postgres
+	logger *logger.Logger
+	tracer trace.Tracer
+}
+
+func NewPostgresPaymentRepository(db *Postgres, logger *logger.Logger) *PostgresPaymentRepository {
+	return &PostgresPaymentRepository{
+		db:     db,
+		logger: logger,
+		tracer: otel.Tracer("payment-repository"),
+	}
+}
+
+func (r *PostgresPaymentRepository) Create(ctx context.Context, payment *domain.Payment) error {
+	ctx, span := r.tracer.Start(ctx, "postgres.payment.create",
+		trace.WithAttributes(
+			attribute.String("payment_id", payment.ID.String()),
+			attribute.String("invoice_id", payment.InvoiceID.String()),
+			attribute.String("tenant_id", payment.TenantID.String()),
+		),
+	)
+	defer span.End()
+
+	now := time.Now().UTC()
+	if payment.CreatedAt.IsZero() {
+		payment.CreatedAt = now
+	}
+	if payment.UpdatedAt.IsZero() {
+		payment.UpdatedAt = now
+	}
+
+	doc, err := json.Marshal(payment)
+	if err != nil {
+		return fmt.Errorf("failed to encode payment: %w", err)
+	}
+
+	start := time.Now()
+	_, err = r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO payments (id, tenant_id, invoice_id, client_id, provider_id, status, amount, currency, version, created_at, updated_at, document)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12)`,
+		payment.ID, payment.TenantID, payment.InvoiceID, payment.ClientID, payment.ProviderID,
+		string(payment.Status), payment.Amount.String(), payment.Currency, payment.Version,
+		payment.CreatedAt, payment.UpdatedAt, doc,
+	)
+	observePostgres("insert", "payments", start, err)
+	if err != nil {
+		span.RecordError(err)
+		r.logger.New(ctx).Error("Failed to create payment",
+			"payment_id", payment.ID,
+			"error", err,
+		)
+		return fmt.Errorf("failed to create payment: %w", err)
+	}
+
+	r.logger.New(ctx).Info("Payment created",
+		"payment_id", payment.ID,
+		"invoice_id", payment.InvoiceID,
+		"amount", payment.Amount.String(),
+	)
+	return nil
+}
+
+// Update saves payment if it is still at payment.Version, returning
+// ErrConcurrencyConflict otherwise.
+func (r *PostgresPaymentRepository) Update(ctx context.Context, payment *domain.Payment) error {
+	ctx, span := r.tracer.Start(ctx, "postgres.payment.update",
+		trace.WithAttributes(
+			attribute.String("payment_id", payment.ID.String()),
+			attribute.String("status", string(payment.Status)),
+		),
+	)
+	defer span.End()
+
+	payment.UpdatedAt = time.Now().UTC()
+	next := *payment
+	next.Version++
+
+	doc, err := json.Marshal(&next)
+	if err != nil {
+		return fmt.Errorf("failed to encode payment: %w", err)
+	}
+
+	start := time.Now()
+	result, err := r.db.conn(ctx).ExecContext(ctx, `
+		UPDATE payments
+		SET provider_id = NULLIF($3, ''), status = $4, amount = $5, currency = $6, version = $7, updated_at = $8, document = $9
+		WHERE id = $1 AND version = $2`,
+		payment.ID, payment.Version, next.ProviderID, string(next.Status), next.Amount.String(),
+		next.Currency, next.Version, next.UpdatedAt, doc,
+	)
+	observePostgres("update", "payments", start, err)
+	if err != nil {
+		span.RecordError(err)
+		r.logger.New(ctx).Error("Failed to update payment",
+			"payment_id", payment.ID,
+			"error", err,
+		)
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		err := fmt.Errorf("%w: payment %s at version %d", ErrConcurrencyConflict, payment.ID, payment.Version)
+		span.RecordError(err)
+		return err
+	}
+
+	payment.Version++
+
+	r.logger.New(ctx).Info("Payment updated",
+		"payment_id", payment.ID,
+		"status", payment.Status,
+	)
+	return nil
+}
+
+func (r *PostgresPaymentRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.Payment, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.payment.find_by_id",
+		trace.WithAttributes(attribute.String("payment_id", id.String())),
+	)
+	defer span.End()
+
+	payment, err := r.findOne(ctx, "id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment not found: %s", id)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return payment, nil
+}
+
+// FindByInvoiceID returns the invoice's payments, oldest first.
+func (r *PostgresPaymentRepository) FindByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*domain.Payment, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.payment.find_by_invoice_id",
+		trace.WithAttributes(attribute.String("invoice_id", invoiceID.String())),
+	)
+	defer span.End()
+
+	payments, err := r.findMany(ctx, `invoice_id = $1`, invoiceID)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return payments, err
+}
+
+// FindByClientID returns the client's payments, oldest first.
+func (r *PostgresPaymentRepository) FindByClientID(ctx context.Context, tenantID, clientID uuid.UUID) ([]*domain.Payment, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.payment.find_by_client_id",
+		trace.WithAttributes(attribute.String("client_id", clientID.String())),
+	)
+	defer span.End()
+
+	payments, err := r.findMany(ctx, `tenant_id = $1 AND client_id = $2`, tenantID, clientID)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return payments, err
+}
+
+func (r *PostgresPaymentRepository) findMany(ctx context.Context, where string, args ...interface{}) ([]*domain.Payment, error) {
+	start := time.Now()
+	rows, err := r.db.conn(ctx).QueryContext(ctx,
+		`SELECT document FROM payments WHERE `+where+` ORDER BY created_at ASC`, args...)
+	observePostgres("select", "payments", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []*domain.Payment
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return nil, fmt.Errorf("failed to read payment: %w", err)
+		}
+		var payment domain.Payment
+		if err := json.Unmarshal(doc, &payment); err != nil {
+			return nil, fmt.Errorf("failed to decode payment: %w", err)
+		}
+		payments = append(payments, &payment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find payments: %w", err)
+	}
+	return payments, nil
+}
+
+func (r *PostgresPaymentRepository) FindByProviderID(ctx context.Context, providerID string) (*domain.Payment, error) {
+	ctx, span := r.tracer.Start(ctx, "postgres.payment.find_by_provider_id",
+		trace.WithAttributes(attribute.String("provider_id", providerID)),
+	)
+	defer span.End()
+
+	payment, err := r.findOne(ctx, "provider_id = $1", providerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment not found for provider ID: %s", providerID)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return payment, nil
+}
+
+func (r *PostgresPaymentRepository) findOne(ctx context.Context, where string, arg interface{}) (*domain.Payment, error) {
+	start := time.Now()
+	var doc []byte
+	err := r.db.conn(ctx).QueryRowContext(ctx, `SELECT document FROM payments WHERE `+where, arg).Scan(&doc)
+	observePostgres("select", "payments", start, err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find payment: %w", err)
+	}
+
+	var payment domain.Payment
+	if err := json.Unmarshal(doc, &payment); err != nil {
+		return nil, fmt.Errorf("failed to decode payment: %w", err)
+	}
+	return &payment, nil
+}
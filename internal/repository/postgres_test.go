@@ -0,0 +1,244 @@
+//go:build postgres
+
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/migrations"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const postgresImage = "postgres:16-alpine"
+
+// TestPostgresRepositories runs the Postgres repositories against a
+// migrated database in a container. It needs a Docker daemon.
+func TestPostgresRepositories(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping Postgres container test in short mode")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	ctr, err := tcpostgres.Run(ctx, postgresImage,
+		tcpostgres.WithDatabase("erp_test"),
+		tcpostgres.WithUsername("erp"),
+		tcpostgres.WithPassword("erp"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	testcontainers.CleanupContainer(t, ctr)
+	require.NoError(t, err)
+	dsn, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	db, err := repository.NewPostgres(config.PostgresConfig{
+		DSN:            dsn,
+		MaxOpenConns:   10,
+		MaxIdleConns:   2,
+		ConnectTimeout: 10 * time.Second,
+	}, log)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = migrations.NewPostgres(db.DB(), log).Up(ctx, 0)
+	require.NoError(t, err)
+
+	t.Run("Invoices", func(t *testing.T) { testPostgresInvoices(t, db, log) })
+	t.Run("Payments", func(t *testing.T) { testPostgresPayments(t, db, log) })
+	t.Run("Clients", func(t *testing.T) { testPostgresClients(t, db, log) })
+	t.Run("Outbox", func(t *testing.T) { testPostgresOutbox(t, db, log) })
+}
+
+func testPostgresInvoices(t *testing.T, db *repository.Postgres, log *logger.Logger) {
+	ctx := context.Background()
+	repo := repository.NewPostgresInvoiceRepository(db, log)
+	counter := repository.NewPostgresInvoiceCounter(db, log)
+	tenantID, clientID := uuid.New(), uuid.New()
+
+	number, err := counter.GetNextInvoiceNumber(ctx, tenantID, 2026)
+	require.NoError(t, err)
+	assert.Equal(t, "INV-2026-000001", number)
+	number, err = counter.GetNextInvoiceNumber(ctx, tenantID, 2026)
+	require.NoError(t, err)
+	assert.Equal(t, "INV-2026-000002", number)
+
+	invoice, err := domain.NewInvoice(tenantID, clientID, uuid.New(), domain.InvoiceTypeStandard, "EUR",
+		domain.PaymentTermNet30, time.Now().UTC())
+	require.NoError(t, err)
+	invoice.InvoiceNumber = number
+	invoice.Total = decimal.NewFromInt(100)
+	invoice.AmountDue = decimal.NewFromInt(100)
+	require.NoError(t, repo.Create(ctx, invoice))
+
+	found, err := repo.FindByInvoiceNumber(ctx, tenantID, number)
+	require.NoError(t, err)
+	assert.Equal(t, invoice.ID, found.ID)
+	assert.True(t, invoice.Total.Equal(found.Total))
+
+	stale := *found
+	found.Status = domain.InvoiceStatusSent
+	require.NoError(t, repo.UpdateVersions(ctx, found, 2))
+	assert.Equal(t, invoice.Version+2, found.Version)
+	assert.ErrorIs(t, repo.Update(ctx, &stale), repository.ErrConcurrencyConflict,
+		"a writer holding the old version loses")
+
+	byClient, err := repo.FindByClientID(ctx, clientID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, byClient, 1)
+	assert.Equal(t, domain.InvoiceStatusSent, byClient[0].Status)
+}
+
+func testPostgresPayments(t *testing.T, db *repository.Postgres, log *logger.Logger) {
+	ctx := context.Background()
+	repo := repository.NewPostgresPaymentRepository(db, log)
+	tenantID, invoiceID, clientID := uuid.New(), uuid.New(), uuid.New()
+
+	payment := domain.NewPayment(tenantID, invoiceID, clientID, decimal.NewFromInt(40), "EUR", domain.PaymentMethodBankTransfer)
+	payment.ProviderID = "pi_" + payment.ID.String()
+	require.NoError(t, repo.Create(ctx, payment))
+
+	found, err := repo.FindByProviderID(ctx, payment.ProviderID)
+	require.NoError(t, err)
+	assert.Equal(t, payment.ID, found.ID)
+
+	stale := *found
+	found.Status = domain.PaymentStatusCompleted
+	require.NoError(t, repo.Update(ctx, found))
+	assert.ErrorIs(t, repo.Update(ctx, &stale), repository.ErrConcurrencyConflict)
+
+	byInvoice, err := repo.FindByInvoiceID(ctx, invoiceID)
+	require.NoError(t, err)
+	require.Len(t, byInvoice, 1)
+	assert.Equal(t, domain.PaymentStatusCompleted, byInvoice[0].Status)
+
+	byClient, err := repo.FindByClientID(ctx, tenantID, clientID)
+	require.NoError(t, err)
+	assert.Len(t, byClient, 1)
+}
+
+func testPostgresClients(t *testing.T, db *repository.Postgres, log *logger.Logger) {
+	ctx := context.Background()
+	clients := repository.NewPostgresClientRepository(db, log)
+	store := repository.NewPostgresEventStore(db, log).WithClients(clients)
+	tenantID, clientID := uuid.New(), uuid.New()
+
+	version := int64(0)
+	save := func(eventType string, data map[string]interface{}) error {
+		version++
+		return store.Save(ctx, []repository.StoredEvent{{
+			ID:            uuid.NewString(),
+			AggregateID:   clientID.String(),
+			AggregateType: "Client",
+			EventType:     eventType,
+			EventData:     data,
+			Version:       version,
+			Timestamp:     time.Now().UTC(),
+			Metadata:      repository.EventMetadata{TenantID: tenantID.String(), UserID: "user-1"},
+		}})
+	}
+
+	require.NoError(t, save("ClientCreated", map[string]interface{}{
+		"name":           "Acme",
+		"email":          "Billing@Acme.test",
+		"creditLimit":    "1000",
+		"billingAddress": domain.Address{City: "Sofia", Country: "BG"},
+		"tags":           []string{"vip"},
+		"ownerId":        "rep-1",
+	}))
+	require.NoError(t, save("CreditLimitAssigned", map[string]interface{}{"oldLimit": "1000", "newLimit": "2500"}))
+
+	client, err := clients.FindByEmail(ctx, tenantID, "billing@acme.test")
+	require.NoError(t, err)
+	assert.Equal(t, clientID, client.ID)
+	assert.Equal(t, "Acme", client.Name)
+	assert.True(t, decimal.NewFromInt(2500).Equal(client.CreditLimit))
+	assert.Equal(t, "Sofia", client.BillingAddress.City)
+	assert.Equal(t, []string{"vip"}, client.Tags)
+	assert.Equal(t, "rep-1", client.OwnerID)
+	assert.Equal(t, int64(2), client.Version)
+
+	version = 1
+	err = save("ClientUpdated", map[string]interface{}{"name": "Lost"})
+	assert.ErrorIs(t, err, repository.ErrConcurrencyConflict)
+	client, err = clients.FindByID(ctx, tenantID, clientID)
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", client.Name, "a rejected append leaves the row as it was")
+
+	version = 2
+	require.NoError(t, save("ClientDeleted", map[string]interface{}{"deletedBy": "user-1"}))
+	_, err = clients.FindByID(ctx, tenantID, clientID)
+	assert.Error(t, err, "clients in the trash are not found")
+	require.NoError(t, save("ClientRestored", map[string]interface{}{}))
+	_, err = clients.FindByID(ctx, tenantID, clientID)
+	require.NoError(t, err)
+
+	require.NoError(t, save("ClientPurged", map[string]interface{}{}))
+	var rows int
+	require.NoError(t, db.DB().QueryRowContext(ctx, `SELECT count(*) FROM clients WHERE id = $1`, clientID).Scan(&rows))
+	assert.Zero(t, rows, "purging removes the row")
+
+	_, err = clients.FindByID(ctx, uuid.New(), clientID)
+	assert.Error(t, err)
+}
+
+func testPostgresOutbox(t *testing.T, db *repository.Postgres, log *logger.Logger) {
+	ctx := context.Background()
+	store := repository.NewPostgresOutboxStore(db, log)
+
+	now := time.Now().UTC()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("evt-%d", i)
+		ids = append(ids, id)
+		require.NoError(t, store.Add(ctx, repository.OutboxEntry{
+			ID:          id,
+			EventType:   "ClientCreated",
+			AggregateID: "client-1",
+			TenantID:    "tenant-1",
+			Payload:     []byte(`{}`),
+			CreatedAt:   now.Add(time.Duration(i) * time.Millisecond),
+		}))
+	}
+
+	// A rolled back transaction leaves nothing behind.
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+		require.NoError(t, store.Add(ctx, repository.OutboxEntry{ID: "rolled-back", EventType: "X", Payload: []byte(`{}`), CreatedAt: now}))
+		return fmt.Errorf("abort")
+	})
+	require.Error(t, err)
+
+	first, err := store.Claim(ctx, 2, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	assert.Equal(t, ids[:2], []string{first[0].ID, first[1].ID}, "oldest entries first")
+
+	second, err := store.Claim(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, second, 1, "locked entries are not claimed twice")
+	assert.Equal(t, ids[2], second[0].ID)
+
+	for _, e := range append(first, second...) {
+		require.NoError(t, store.MarkDelivered(ctx, e.ID))
+	}
+	count, _, err := store.Backlog(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	purged, err := store.PurgeDelivered(ctx, -time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+}
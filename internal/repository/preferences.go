@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrPreferenceNotFound = errors.New("preference not found")
+	// ErrPreferenceConflict is returned by Put when the preference is not at
+	// the expected version.
+	ErrPreferenceConflict = errors.New("preference was modified concurrently")
+)
+
+// Preference is one setting a user saved, such as the filters of a list.
+// Value holds the JSON the setting was saved as.
+type Preference struct {
+	ID        string    `bson:"_id" json:"-"`
+	TenantID  string    `bson:"tenantId" json:"-"`
+	UserID    string    `bson:"userId" json:"-"`
+	Key       string    `bson:"key" json:"key"`
+	Value     string    `bson:"value" json:"-"`
+	Version   int64     `bson:"version" json:"version"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// PreferenceStore keeps the preferences of each user, one document per key.
+type PreferenceStore struct {
+	collection *mongo.Collection
+}
+
+func NewPreferenceStore(db *MongoDB) *PreferenceStore {
+	return &PreferenceStore{collection: db.Collection("user_preferences")}
+}
+
+func (s *PreferenceStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}, {Key: "key", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create preference indexes: %w", err)
+	}
+	return nil
+}
+
+func preferenceID(tenantID, userID, key string) string {
+	return tenantID + "/" + userID + "/" + key
+}
+
+// List returns every preference of userID, ordered by key.
+func (s *PreferenceStore) List(ctx context.Context, tenantID, userID string) ([]Preference, error) {
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx,
+		bson.M{"tenantId": tenantID, "userId": userID},
+		options.Find().SetSort(bson.D{{Key: "key", Value: 1}}))
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list preferences: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	prefs := []Preference{}
+	if err := cursor.All(ctx, &prefs); err != nil {
+		return nil, fmt.Errorf("failed to decode preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// Get returns the preference of userID under key.
+func (s *PreferenceStore) Get(ctx context.Context, tenantID, userID, key string) (*Preference, error) {
+	start := time.Now()
+	var pref Preference
+	err := s.collection.FindOne(ctx, bson.M{"_id": preferenceID(tenantID, userID, key)}).Decode(&pref)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPreferenceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preference: %w", err)
+	}
+	return &pref, nil
+}
+
+// Put saves value under key and returns the preference at its new version.
+// With expectedVersion above zero the preference is only replaced at that
+// version, and ErrPreferenceConflict is returned otherwise.
+func (s *PreferenceStore) Put(ctx context.Context, tenantID, userID, key, value string, expectedVersion int64) (*Preference, error) {
+	id := preferenceID(tenantID, userID, key)
+	filter := bson.M{"_id": id}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if expectedVersion > 0 {
+		filter["version"] = expectedVersion
+	} else {
+		opts.SetUpsert(true)
+	}
+	update := bson.M{
+		"$set": bson.M{"tenantId": tenantID, "userId": userID, "key": key, "value": value, "updatedAt": time.Now().UTC()},
+		"$inc": bson.M{"version": int64(1)},
+	}
+
+	start := time.Now()
+	var pref Preference
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&pref)
+	observeMongo("update", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPreferenceConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save preference: %w", err)
+	}
+	return &pref, nil
+}
+
+// Delete removes the preference of userID under key, reporting whether it
+// existed.
+func (s *PreferenceStore) Delete(ctx context.Context, tenantID, userID, key string) (bool, error) {
+	start := time.Now()
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": preferenceID(tenantID, userID, key)})
+	observeMongo("delete", s.collection, start, err)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete preference: %w", err)
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type processedEvent struct {
+	ID          string    `bson:"_id"`
+	Consumer    string    `bson:"consumer"`
+	EventID     string    `bson:"eventId"`
+	ProcessedAt time.Time `bson:"processedAt"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+// ProcessedEventStore records which events each consumer has applied, shared
+// across all replicas of a service. Records are removed by a TTL index.
+type ProcessedEventStore struct {
+	collection *mongo.Collection
+}
+
+func NewProcessedEventStore(db *MongoDB) *ProcessedEventStore {
+	return &ProcessedEventStore{collection: db.Collection("processed_events")}
+}
+
+func (s *ProcessedEventStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create processed event indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *ProcessedEventStore) IsProcessed(ctx context.Context, consumer, eventID string) (bool, error) {
+	start := time.Now()
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"_id":       consumer + "/" + eventID,
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+	}, options.Count().SetLimit(1))
+	observeMongo("count", s.collection, start, err)
+	if err != nil {
+		return false, fmt.Errorf("failed to check processed event: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *ProcessedEventStore) MarkProcessed(ctx context.Context, consumer, eventID string, ttl time.Duration) error {
+	now := time.Now().UTC()
+	doc := processedEvent{
+		ID:          consumer + "/" + eventID,
+		Consumer:    consumer,
+		EventID:     eventID,
+		ProcessedAt: now,
+		ExpiresAt:   now.Add(ttl),
+	}
+
+	start := time.Now()
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(true))
+	observeMongo("upsert", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	return nil
+}
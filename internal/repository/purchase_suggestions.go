@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PurchaseSuggestionStore reads the orders and products demand is forecast
+// from, and keeps the purchase suggestions made on them in the
+// purchase_suggestions collection.
+type PurchaseSuggestionStore struct {
+	orders      *mongo.Collection
+	products    *mongo.Collection
+	suggestions *mongo.Collection
+}
+
+func NewPurchaseSuggestionStore(db *MongoDB) *PurchaseSuggestionStore {
+	return &PurchaseSuggestionStore{
+		orders:      db.Collection("orders"),
+		products:    db.Collection("products"),
+		suggestions: db.Collection("purchase_suggestions"),
+	}
+}
+
+func (s *PurchaseSuggestionStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.orders.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create order history indexes: %w", err)
+	}
+	_, err = s.suggestions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "orderBy", Value: 1}},
+		},
+		{
+			// A product has at most one open suggestion.
+			Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "productId", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": domain.PurchaseSuggestionOpen}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create purchase suggestion indexes: %w", err)
+	}
+	return nil
+}
+
+// EachOrder calls fn with the orders placed in [from, to), of one tenant
+// unless tenantID is uuid.Nil.
+func (s *PurchaseSuggestionStore) EachOrder(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Order) error) error {
+	filter := bson.M{"createdAt": bson.M{"$gte": from, "$lt": to}}
+	if tenantID != uuid.Nil {
+		filter["tenantId"] = tenantID
+	}
+	return eachDocument(ctx, s.orders, filter, func(cursor *mongo.Cursor) error {
+		var order domain.Order
+		if err := cursor.Decode(&order); err != nil {
+			return fmt.Errorf("failed to decode order: %w", err)
+		}
+		return fn(&order)
+	})
+}
+
+// EachStockedProduct calls fn with the tenant's active products whose
+// stock is tracked.
+func (s *PurchaseSuggestionStore) EachStockedProduct(ctx context.Context, tenantID uuid.UUID, fn func(*domain.Product) error) error {
+	return eachDocument(ctx, s.products, bson.M{
+		"tenantId":                 tenantID,
+		"status":                   domain.ProductStatusActive,
+		"inventory.trackInventory": true,
+	}, func(cursor *mongo.Cursor) error {
+		var product domain.Product
+		if err := cursor.Decode(&product); err != nil {
+			return fmt.Errorf("failed to decode product: %w", err)
+		}
+		return fn(&product)
+	})
+}
+
+// Suppressed returns the tenant's products with a suggestion decided on
+// that still keeps new ones away at now.
+func (s *PurchaseSuggestionStore) Suppressed(ctx context.Context, tenantID uuid.UUID, now time.Time) (map[uuid.UUID]bool, error) {
+	suppressed := make(map[uuid.UUID]bool)
+	err := eachDocument(ctx, s.suggestions, bson.M{
+		"tenantId":        tenantID,
+		"status":          bson.M{"$ne": domain.PurchaseSuggestionOpen},
+		"suppressedUntil": bson.M{"$gt": now},
+	}, func(cursor *mongo.Cursor) error {
+		var suggestion domain.PurchaseSuggestion
+		if err := cursor.Decode(&suggestion); err != nil {
+			return fmt.Errorf("failed to decode purchase suggestion: %w", err)
+		}
+		suppressed[suggestion.ProductID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return suppressed, nil
+}
+
+// List returns the tenant's purchase suggestions, of one status unless it
+// is empty, those to order soonest first.
+func (s *PurchaseSuggestionStore) List(ctx context.Context, tenantID uuid.UUID, status domain.PurchaseSuggestionStatus) ([]domain.PurchaseSuggestion, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "orderBy", Value: 1}, {Key: "sku", Value: 1}})
+
+	start := time.Now()
+	cursor, err := s.suggestions.Find(ctx, filter, opts)
+	observeMongo("find", s.suggestions, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query purchase suggestions: %w", err)
+	}
+	suggestions := []domain.PurchaseSuggestion{}
+	if err := cursor.All(ctx, &suggestions); err != nil {
+		return nil, fmt.Errorf("failed to decode purchase suggestions: %w", err)
+	}
+	return suggestions, nil
+}
+
+// Get returns the tenant's purchase suggestion id, or nil when it has none.
+func (s *PurchaseSuggestionStore) Get(ctx context.Context, tenantID, id uuid.UUID) (*domain.PurchaseSuggestion, error) {
+	start := time.Now()
+	var suggestion domain.PurchaseSuggestion
+	err := s.suggestions.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&suggestion)
+	observeMongo("find_one", s.suggestions, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find purchase suggestion: %w", err)
+	}
+	return &suggestion, nil
+}
+
+// Update saves a suggestion decided on, unless it was changed since it was
+// read.
+func (s *PurchaseSuggestionStore) Update(ctx context.Context, suggestion *domain.PurchaseSuggestion) error {
+	next := *suggestion
+	next.Version++
+
+	start := time.Now()
+	result, err := s.suggestions.ReplaceOne(ctx, bson.M{"_id": suggestion.ID, "version": suggestion.Version}, &next)
+	observeMongo("replace", s.suggestions, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update purchase suggestion: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: purchase suggestion %s at version %d", ErrConcurrencyConflict, suggestion.ID, suggestion.Version)
+	}
+	suggestion.Version++
+	return nil
+}
+
+// SaveSuggestions replaces the tenant's open suggestions with suggestions,
+// all generated at the same time, and returns those for products that had
+// none open. An open suggestion for the same product is refreshed in place,
+// keeping its ID; open ones no longer suggested are withdrawn.
+func (s *PurchaseSuggestionStore) SaveSuggestions(ctx context.Context, tenantID uuid.UUID, suggestions []domain.PurchaseSuggestion, generatedAt time.Time) ([]domain.PurchaseSuggestion, error) {
+	open, err := s.List(ctx, tenantID, domain.PurchaseSuggestionOpen)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[uuid.UUID]domain.PurchaseSuggestion, len(open))
+	for _, suggestion := range open {
+		existing[suggestion.ProductID] = suggestion
+	}
+
+	var created []domain.PurchaseSuggestion
+	for _, suggestion := range suggestions {
+		suggestion.TenantID = tenantID
+		suggestion.Status = domain.PurchaseSuggestionOpen
+		suggestion.GeneratedAt = generatedAt
+
+		if previous, ok := existing[suggestion.ProductID]; ok {
+			suggestion.ID = previous.ID
+			suggestion.Version = previous.Version + 1
+			start := time.Now()
+			_, err := s.suggestions.ReplaceOne(ctx, bson.M{
+				"_id":    previous.ID,
+				"status": domain.PurchaseSuggestionOpen,
+			}, suggestion)
+			observeMongo("replace", s.suggestions, start, err)
+			if err != nil {
+				return nil, fmt.Errorf("failed to refresh purchase suggestion: %w", err)
+			}
+			continue
+		}
+
+		suggestion.ID = uuid.New()
+		suggestion.Version = 1
+		start := time.Now()
+		_, err := s.suggestions.InsertOne(ctx, suggestion)
+		observeMongo("insert", s.suggestions, start, err)
+		if mongo.IsDuplicateKeyError(err) {
+			// Suggested concurrently by another run.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to save purchase suggestion: %w", err)
+		}
+		created = append(created, suggestion)
+	}
+
+	start := time.Now()
+	_, err = s.suggestions.DeleteMany(ctx, bson.M{
+		"tenantId":    tenantID,
+		"status":      domain.PurchaseSuggestionOpen,
+		"generatedAt": bson.M{"$lt": generatedAt},
+	})
+	observeMongo("delete_many", s.suggestions, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to withdraw purchase suggestions: %w", err)
+	}
+	return created, nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/ims-erp/system/internal/config"
 	"github.com/ims-erp/system/pkg/logger"
+	"github.com/ims-erp/system/pkg/metrics"
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -70,6 +71,8 @@ func NewRedis(cfg config.RedisConfig, log *logger.Logger) (*Redis, error) {
 		})
 	}
 
+	client.AddHook(newRedisHook())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -97,6 +100,21 @@ func (r *Redis) Health(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
 }
 
+// observeCacheRead records a GET and counts it as a cache hit or miss.
+func observeCacheRead(operation string, start time.Time, err error) {
+	switch err {
+	case nil:
+		metrics.RecordCacheHit("redis")
+	case redis.Nil:
+		metrics.RecordCacheMiss("redis")
+		err = nil
+	}
+	metrics.ObserveRedis(operation, start, err)
+}
+
+// Cache stores values in Redis under a key prefix. A nil *Cache is always
+// empty: reads miss and writes are dropped, so handlers can run without
+// Redis in tests.
 type Cache struct {
 	redis  *Redis
 	prefix string
@@ -118,12 +136,17 @@ func (c *Cache) key(key string) string {
 }
 
 func (c *Cache) Get(ctx context.Context, key string) (string, error) {
+	if c == nil {
+		return "", nil
+	}
 	ctx, span := c.tracer.Start(ctx, "redis.get",
 		trace.WithAttributes(attribute.String("cache.key", key)),
 	)
 	defer span.End()
 
+	start := time.Now()
 	result, err := c.redis.client.Get(ctx, c.key(key)).Result()
+	observeCacheRead("get", start, err)
 	if err != nil {
 		if err == redis.Nil {
 			return "", nil
@@ -136,12 +159,17 @@ func (c *Cache) Get(ctx context.Context, key string) (string, error) {
 }
 
 func (c *Cache) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	if c == nil {
+		return nil, nil
+	}
 	ctx, span := c.tracer.Start(ctx, "redis.get_bytes",
 		trace.WithAttributes(attribute.String("cache.key", key)),
 	)
 	defer span.End()
 
+	start := time.Now()
 	result, err := c.redis.client.Get(ctx, c.key(key)).Bytes()
+	observeCacheRead("get", start, err)
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -154,6 +182,9 @@ func (c *Cache) GetBytes(ctx context.Context, key string) ([]byte, error) {
 }
 
 func (c *Cache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	if c == nil {
+		return nil
+	}
 	ctx, span := c.tracer.Start(ctx, "redis.set",
 		trace.WithAttributes(
 			attribute.String("cache.key", key),
@@ -178,7 +209,10 @@ func (c *Cache) Set(ctx context.Context, key string, value interface{}, expirati
 		}
 	}
 
-	if err := c.redis.client.Set(ctx, c.key(key), data, expiration).Err(); err != nil {
+	start := time.Now()
+	err = c.redis.client.Set(ctx, c.key(key), data, expiration).Err()
+	metrics.ObserveRedis("set", start, err)
+	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("failed to set cache: %w", err)
 	}
@@ -187,6 +221,9 @@ func (c *Cache) Set(ctx context.Context, key string, value interface{}, expirati
 }
 
 func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	if c == nil {
+		return nil
+	}
 	ctx, span := c.tracer.Start(ctx, "redis.delete",
 		trace.WithAttributes(attribute.Int("cache.keys_count", len(keys))),
 	)
@@ -201,7 +238,10 @@ func (c *Cache) Delete(ctx context.Context, keys ...string) error {
 		redisKeys[i] = c.key(key)
 	}
 
-	if err := c.redis.client.Del(ctx, redisKeys...).Err(); err != nil {
+	start := time.Now()
+	err := c.redis.client.Del(ctx, redisKeys...).Err()
+	metrics.ObserveRedis("del", start, err)
+	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("failed to delete from cache: %w", err)
 	}
@@ -210,6 +250,9 @@ func (c *Cache) Delete(ctx context.Context, keys ...string) error {
 }
 
 func (c *Cache) DeletePattern(ctx context.Context, pattern string) error {
+	if c == nil {
+		return nil
+	}
 	ctx, span := c.tracer.Start(ctx, "redis.delete_pattern",
 		trace.WithAttributes(attribute.String("cache.pattern", pattern)),
 	)
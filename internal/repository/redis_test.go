@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveCacheRead(t *testing.T) {
+	metrics.Initialize("test")
+	hits := testutil.ToFloat64(metrics.CacheHits.WithLabelValues("redis"))
+	misses := testutil.ToFloat64(metrics.CacheMisses.WithLabelValues("redis"))
+	reads := testutil.ToFloat64(metrics.RedisOperations.WithLabelValues("get", "ok"))
+
+	observeCacheRead("get", time.Now(), nil)
+	observeCacheRead("get", time.Now(), redis.Nil)
+	observeCacheRead("get", time.Now(), errors.New("connection refused"))
+
+	assert.Equal(t, hits+1, testutil.ToFloat64(metrics.CacheHits.WithLabelValues("redis")))
+	assert.Equal(t, misses+1, testutil.ToFloat64(metrics.CacheMisses.WithLabelValues("redis")), "failed reads are neither hits nor misses")
+	assert.Equal(t, reads+2, testutil.ToFloat64(metrics.RedisOperations.WithLabelValues("get", "ok")), "a miss is a successful read")
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RedisOperations.WithLabelValues("get", "error")))
+}
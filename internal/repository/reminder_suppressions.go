@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReminderSuppressionStore keeps the reminder suppressions of invoices and
+// clients in the reminder_suppressions collection, lifted ones included.
+type ReminderSuppressionStore struct {
+	suppressions *mongo.Collection
+}
+
+func NewReminderSuppressionStore(db *MongoDB) *ReminderSuppressionStore {
+	return &ReminderSuppressionStore{suppressions: db.Collection("reminder_suppressions")}
+}
+
+// EnsureIndexes creates the store's indexes.
+func (s *ReminderSuppressionStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.suppressions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "clientId", Value: 1}, {Key: "suppressedAt", Value: -1}},
+		Options: options.Index().SetName("client_suppressions"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create reminder suppression indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *ReminderSuppressionStore) Add(ctx context.Context, suppression *domain.ReminderSuppression) error {
+	start := time.Now()
+	_, err := s.suppressions.InsertOne(ctx, suppression)
+	observeMongo("insert", s.suppressions, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to add reminder suppression: %w", err)
+	}
+	return nil
+}
+
+// Get returns one of the tenant's suppressions, or nil if there is none.
+func (s *ReminderSuppressionStore) Get(ctx context.Context, tenantID, id uuid.UUID) (*domain.ReminderSuppression, error) {
+	start := time.Now()
+	var suppression domain.ReminderSuppression
+	err := s.suppressions.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&suppression)
+	observeMongo("find_one", s.suppressions, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reminder suppression: %w", err)
+	}
+	return &suppression, nil
+}
+
+// Active returns the suppression stopping the reminders of the client's
+// invoice, its own or the client's, or nil when they are not suppressed.
+// The invoice's own suppression comes first.
+func (s *ReminderSuppressionStore) Active(ctx context.Context, tenantID, clientID, invoiceID uuid.UUID) (*domain.ReminderSuppression, error) {
+	filter := bson.M{
+		"tenantId": tenantID,
+		"clientId": clientID,
+		"liftedAt": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"invoiceId": invoiceID},
+			bson.M{"invoiceId": bson.M{"$exists": false}},
+		},
+	}
+	suppressions, err := s.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "suppressedAt", Value: 1}}))
+	if err != nil || len(suppressions) == 0 {
+		return nil, err
+	}
+	for _, suppression := range suppressions {
+		if suppression.InvoiceID != nil {
+			return suppression, nil
+		}
+	}
+	return suppressions[0], nil
+}
+
+// List returns the tenant's suppressions, latest first, of the client or
+// invoice when given, and only those not lifted when active is true.
+func (s *ReminderSuppressionStore) List(ctx context.Context, tenantID uuid.UUID, clientID, invoiceID *uuid.UUID, active bool, limit int64) ([]*domain.ReminderSuppression, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if clientID != nil {
+		filter["clientId"] = *clientID
+	}
+	if invoiceID != nil {
+		filter["invoiceId"] = *invoiceID
+	}
+	if active {
+		filter["liftedAt"] = bson.M{"$exists": false}
+	}
+	return s.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "suppressedAt", Value: -1}}).SetLimit(limit))
+}
+
+// Lift records suppression lifted, unless it was lifted meanwhile, and
+// reports whether it was.
+func (s *ReminderSuppressionStore) Lift(ctx context.Context, suppression *domain.ReminderSuppression) (bool, error) {
+	start := time.Now()
+	result, err := s.suppressions.UpdateOne(ctx,
+		bson.M{"_id": suppression.ID, "tenantId": suppression.TenantID, "liftedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{
+			"liftedBy":   suppression.LiftedBy,
+			"liftedAt":   suppression.LiftedAt,
+			"liftReason": suppression.LiftReason,
+		}})
+	observeMongo("update", s.suppressions, start, err)
+	if err != nil {
+		return false, fmt.Errorf("failed to lift reminder suppression: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (s *ReminderSuppressionStore) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*domain.ReminderSuppression, error) {
+	start := time.Now()
+	cursor, err := s.suppressions.Find(ctx, filter, opts)
+	observeMongo("find", s.suppressions, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reminder suppressions: %w", err)
+	}
+	suppressions := []*domain.ReminderSuppression{}
+	if err := cursor.All(ctx, &suppressions); err != nil {
+		return nil, fmt.Errorf("failed to decode reminder suppressions: %w", err)
+	}
+	return suppressions, nil
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ReplayStatusPending   = "pending"
+	ReplayStatusRunning   = "running"
+	ReplayStatusCompleted = "completed"
+	ReplayStatusFailed    = "failed"
+	ReplayStatusCancelled = "cancelled"
+)
+
+var (
+	ErrReplayInProgress  = errors.New("a replay is already in progress for this tenant and read model")
+	ErrReplayJobNotFound = errors.New("replay job not found")
+)
+
+// ReplayJob tracks a read model rebuild for one tenant. Active is set while
+// the job is pending or running; a unique index on it allows at most one
+// active job per tenant and read model.
+type ReplayJob struct {
+	ID               string     `bson:"_id" json:"id"`
+	ReadModel        string     `bson:"readModel" json:"readModel"`
+	TenantID         string     `bson:"tenantId" json:"tenantId"`
+	From             *time.Time `bson:"from,omitempty" json:"from,omitempty"`
+	FromVersion      int64      `bson:"fromVersion,omitempty" json:"fromVersion,omitempty"`
+	Shadow           bool       `bson:"shadow" json:"shadow"`
+	ShadowCollection string     `bson:"shadowCollection,omitempty" json:"shadowCollection,omitempty"`
+	MaxFailures      int64      `bson:"maxFailures" json:"maxFailures"`
+	Status           string     `bson:"status" json:"status"`
+	Active           bool       `bson:"active" json:"-"`
+	CancelRequested  bool       `bson:"cancelRequested" json:"cancelRequested,omitempty"`
+	Owner            string     `bson:"owner,omitempty" json:"owner,omitempty"`
+	Total            int64      `bson:"total" json:"total"`
+	Processed        int64      `bson:"processed" json:"processed"`
+	Failed           int64      `bson:"failed" json:"failed"`
+	Swapped          int64      `bson:"swapped,omitempty" json:"swapped,omitempty"`
+	LastEventID      string     `bson:"lastEventId,omitempty" json:"lastEventId,omitempty"`
+	LastError        string     `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt        time.Time  `bson:"createdAt" json:"createdAt"`
+	StartedAt        *time.Time `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	HeartbeatAt      *time.Time `bson:"heartbeatAt,omitempty" json:"heartbeatAt,omitempty"`
+	FinishedAt       *time.Time `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+}
+
+type ReplayJobStore struct {
+	collection *mongo.Collection
+}
+
+func NewReplayJobStore(db *MongoDB) *ReplayJobStore {
+	return &ReplayJobStore{collection: db.Collection("replay_jobs")}
+}
+
+func (s *ReplayJobStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "readModel", Value: 1}, {Key: "tenantId", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"active": true}).
+				SetName("one_active_replay"),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create replay job indexes: %w", err)
+	}
+	return nil
+}
+
+// Create stores job as pending. It fails with ErrReplayInProgress if the
+// tenant already has an active job for the same read model.
+func (s *ReplayJobStore) Create(ctx context.Context, job *ReplayJob) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	job.Status = ReplayStatusPending
+	job.Active = true
+	job.CreatedAt = time.Now().UTC()
+
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, job)
+	observeMongo("insert", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrReplayInProgress
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create replay job: %w", err)
+	}
+	return nil
+}
+
+func (s *ReplayJobStore) Get(ctx context.Context, id string) (*ReplayJob, error) {
+	start := time.Now()
+	var job ReplayJob
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrReplayJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replay job: %w", err)
+	}
+	return &job, nil
+}
+
+// List returns the most recent jobs, optionally for a single tenant.
+func (s *ReplayJobStore) List(ctx context.Context, tenantID string, limit int64) ([]ReplayJob, error) {
+	filter := bson.M{}
+	if tenantID != "" {
+		filter["tenantId"] = tenantID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replay jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := make([]ReplayJob, 0)
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode replay jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Claim assigns the oldest pending job to owner. Running jobs whose heartbeat
+// is older than staleAfter are claimed again, since their worker is gone; if
+// one of those was cancelled meanwhile, the new worker finalizes it.
+func (s *ReplayJobStore) Claim(ctx context.Context, owner string, staleAfter time.Duration) (*ReplayJob, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"status": ReplayStatusPending},
+			bson.M{"status": ReplayStatusRunning, "heartbeatAt": bson.M{"$lt": now.Add(-staleAfter)}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":      ReplayStatusRunning,
+		"owner":       owner,
+		"startedAt":   now,
+		"heartbeatAt": now,
+		"processed":   0,
+		"failed":      0,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	start := time.Now()
+	var job ReplayJob
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	observeMongo("find_one_and_update", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim replay job: %w", err)
+	}
+	return &job, nil
+}
+
+// Progress records progress and refreshes the heartbeat. It reports whether
+// cancellation has been requested since the job was claimed, and returns
+// ErrReplayJobNotFound once another worker has taken the job over.
+func (s *ReplayJobStore) Progress(ctx context.Context, job *ReplayJob) (bool, error) {
+	now := time.Now().UTC()
+	job.HeartbeatAt = &now
+
+	start := time.Now()
+	var current ReplayJob
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": job.ID, "owner": job.Owner}, bson.M{"$set": bson.M{
+		"total":            job.Total,
+		"processed":        job.Processed,
+		"failed":           job.Failed,
+		"lastEventId":      job.LastEventID,
+		"lastError":        job.LastError,
+		"shadowCollection": job.ShadowCollection,
+		"heartbeatAt":      now,
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&current)
+	observeMongo("find_one_and_update", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return false, ErrReplayJobNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update replay job: %w", err)
+	}
+	return current.CancelRequested, nil
+}
+
+// Finish moves job to a terminal status and releases the tenant.
+func (s *ReplayJobStore) Finish(ctx context.Context, job *ReplayJob, status string) error {
+	now := time.Now().UTC()
+	job.Status = status
+	job.Active = false
+	job.FinishedAt = &now
+
+	start := time.Now()
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": job.ID, "owner": job.Owner}, bson.M{"$set": bson.M{
+		"status":      status,
+		"active":      false,
+		"total":       job.Total,
+		"processed":   job.Processed,
+		"failed":      job.Failed,
+		"swapped":     job.Swapped,
+		"lastEventId": job.LastEventID,
+		"lastError":   job.LastError,
+		"finishedAt":  now,
+	}})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to finish replay job: %w", err)
+	}
+	return nil
+}
+
+// Cancel requests cancellation. Pending jobs are cancelled immediately;
+// running jobs stop at their next progress update.
+func (s *ReplayJobStore) Cancel(ctx context.Context, id string) (*ReplayJob, error) {
+	now := time.Now().UTC()
+
+	start := time.Now()
+	var job ReplayJob
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": ReplayStatusPending},
+		bson.M{"$set": bson.M{"status": ReplayStatusCancelled, "active": false, "cancelRequested": true, "finishedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&job)
+	observeMongo("find_one_and_update", s.collection, start, err)
+	if err == nil {
+		return &job, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to cancel replay job: %w", err)
+	}
+
+	start = time.Now()
+	err = s.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": ReplayStatusRunning},
+		bson.M{"$set": bson.M{"cancelRequested": true}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&job)
+	observeMongo("find_one_and_update", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return s.Get(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel replay job: %w", err)
+	}
+	return &job, nil
+}
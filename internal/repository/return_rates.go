@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReturnRateStore reads the RMAs, shipments and product suppliers return
+// rates are derived from, and keeps the return rate alerts raised on them
+// in the return_rate_alerts collection.
+type ReturnRateStore struct {
+	returns      *mongo.Collection
+	transactions *mongo.Collection
+	products     *mongo.Collection
+	alerts       *mongo.Collection
+}
+
+func NewReturnRateStore(db *MongoDB) *ReturnRateStore {
+	return &ReturnRateStore{
+		returns:      db.Collection("return_authorizations"),
+		transactions: db.Collection("inventory_transactions"),
+		products:     db.Collection("products"),
+		alerts:       db.Collection("return_rate_alerts"),
+	}
+}
+
+func (s *ReturnRateStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.transactions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenantId", Value: 1},
+			{Key: "movementType", Value: 1},
+			{Key: "createdAt", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create shipment indexes: %w", err)
+	}
+	_, err = s.alerts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "returnRate", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create return rate alert indexes: %w", err)
+	}
+	return nil
+}
+
+// EachReturn calls fn with the RMAs opened in [from, to), of one tenant
+// unless tenantID is uuid.Nil.
+func (s *ReturnRateStore) EachReturn(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.ReturnAuthorization) error) error {
+	filter := bson.M{"createdAt": bson.M{"$gte": from, "$lt": to}}
+	if tenantID != uuid.Nil {
+		filter["tenantId"] = tenantID
+	}
+	return eachDocument(ctx, s.returns, filter, func(cursor *mongo.Cursor) error {
+		var rma domain.ReturnAuthorization
+		if err := cursor.Decode(&rma); err != nil {
+			return fmt.Errorf("failed to decode return: %w", err)
+		}
+		return fn(&rma)
+	})
+}
+
+// EachShipment calls fn with the tenant's shipment movements recorded in
+// [from, to).
+func (s *ReturnRateStore) EachShipment(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(InventoryTransactionRecord) error) error {
+	return eachDocument(ctx, s.transactions, bson.M{
+		"tenantId":     tenantID.String(),
+		"movementType": string(domain.MovementTypeShipment),
+		"createdAt":    bson.M{"$gte": from, "$lt": to},
+	}, func(cursor *mongo.Cursor) error {
+		var record InventoryTransactionRecord
+		if err := cursor.Decode(&record); err != nil {
+			return fmt.Errorf("failed to decode inventory transaction: %w", err)
+		}
+		return fn(record)
+	})
+}
+
+// FindSuppliers returns the supplier of each of the products that has one.
+func (s *ReturnRateStore) FindSuppliers(ctx context.Context, tenantID uuid.UUID, productIDs []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	suppliers := make(map[uuid.UUID]uuid.UUID)
+	err := eachDocument(ctx, s.products, bson.M{
+		"tenantId":   tenantID,
+		"_id":        bson.M{"$in": productIDs},
+		"supplierId": bson.M{"$ne": nil},
+	}, func(cursor *mongo.Cursor) error {
+		var product domain.Product
+		if err := cursor.Decode(&product); err != nil {
+			return fmt.Errorf("failed to decode product: %w", err)
+		}
+		if product.SupplierID != nil {
+			suppliers[product.ID] = *product.SupplierID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return suppliers, nil
+}
+
+// OpenAlerts returns the tenant's raised return rate alerts, highest rate
+// first.
+func (s *ReturnRateStore) OpenAlerts(ctx context.Context, tenantID uuid.UUID) ([]domain.ReturnRateAlert, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "returnRate", Value: -1}, {Key: "_id", Value: 1}})
+
+	start := time.Now()
+	cursor, err := s.alerts.Find(ctx, bson.M{"tenantId": tenantID}, opts)
+	observeMongo("find", s.alerts, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query return rate alerts: %w", err)
+	}
+	alerts := []domain.ReturnRateAlert{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, fmt.Errorf("failed to decode return rate alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// SaveAlerts raises alerts for the tenant, keeping when those already
+// raised were, and returns the alerts that are new.
+func (s *ReturnRateStore) SaveAlerts(ctx context.Context, tenantID uuid.UUID, alerts []domain.ReturnRateAlert) ([]domain.ReturnRateAlert, error) {
+	open, err := s.OpenAlerts(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	raisedAt := make(map[string]time.Time, len(open))
+	for _, alert := range open {
+		raisedAt[alert.ID] = alert.RaisedAt
+	}
+
+	var raised []domain.ReturnRateAlert
+	for _, alert := range alerts {
+		if at, ok := raisedAt[alert.ID]; ok {
+			alert.RaisedAt = at
+		} else {
+			raised = append(raised, alert)
+		}
+
+		start := time.Now()
+		_, err := s.alerts.ReplaceOne(ctx, bson.M{"_id": alert.ID}, alert, options.Replace().SetUpsert(true))
+		observeMongo("upsert", s.alerts, start, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save return rate alert: %w", err)
+		}
+	}
+	return raised, nil
+}
+
+// ClearAlerts clears the alerts of every tenant that were not raised again
+// by a check at or after before.
+func (s *ReturnRateStore) ClearAlerts(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	result, err := s.alerts.DeleteMany(ctx, bson.M{"windowEnd": bson.M{"$lt": before}})
+	observeMongo("delete_many", s.alerts, start, err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear return rate alerts: %w", err)
+	}
+	return result.DeletedCount, nil
+}
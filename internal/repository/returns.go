@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReturnAuthorizationStore keeps RMAs, with their lines, in the
+// return_authorizations collection.
+type ReturnAuthorizationStore struct {
+	collection *mongo.Collection
+}
+
+func NewReturnAuthorizationStore(db *MongoDB) *ReturnAuthorizationStore {
+	return &ReturnAuthorizationStore{collection: db.Collection("return_authorizations")}
+}
+
+func (s *ReturnAuthorizationStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "orderId", Value: 1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "rmaNumber", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create return indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *ReturnAuthorizationStore) Create(ctx context.Context, rma *domain.ReturnAuthorization) error {
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, rma)
+	observeMongo("insert", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to create return: %w", err)
+	}
+	return nil
+}
+
+func (s *ReturnAuthorizationStore) FindByID(ctx context.Context, id uuid.UUID) (*domain.ReturnAuthorization, error) {
+	start := time.Now()
+	var rma domain.ReturnAuthorization
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&rma)
+	observeMongo("find_one", s.collection, start, err)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("return not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to find return: %w", err)
+	}
+	return &rma, nil
+}
+
+// Update saves rma if it is still at the version it was read at, and
+// reports ErrConcurrencyConflict otherwise.
+func (s *ReturnAuthorizationStore) Update(ctx context.Context, rma *domain.ReturnAuthorization) error {
+	next := *rma
+	next.Version++
+
+	start := time.Now()
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": rma.ID, "version": rma.Version}, &next)
+	observeMongo("replace", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update return: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: return %s at version %d", ErrConcurrencyConflict, rma.ID, rma.Version)
+	}
+	rma.Version++
+	return nil
+}
+
+func (s *ReturnAuthorizationStore) FindByOrder(ctx context.Context, tenantID, orderID uuid.UUID) ([]*domain.ReturnAuthorization, error) {
+	var returns []*domain.ReturnAuthorization
+	err := eachDocument(ctx, s.collection, bson.M{"tenantId": tenantID, "orderId": orderID}, func(cursor *mongo.Cursor) error {
+		var rma domain.ReturnAuthorization
+		if err := cursor.Decode(&rma); err != nil {
+			return fmt.Errorf("failed to decode return: %w", err)
+		}
+		returns = append(returns, &rma)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
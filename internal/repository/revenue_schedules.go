@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RevenueScheduleStore keeps the revenue recognition schedules of invoice
+// lines in the revenue_schedules collection.
+type RevenueScheduleStore struct {
+	collection *mongo.Collection
+}
+
+func NewRevenueScheduleStore(db *MongoDB) *RevenueScheduleStore {
+	return &RevenueScheduleStore{collection: db.Collection("revenue_schedules")}
+}
+
+// EnsureIndexes creates the store's indexes. An invoice line has at most
+// one schedule, so that its revenue is never recognized twice.
+func (s *RevenueScheduleStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "invoiceLineId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("schedule_per_invoice_line"),
+		},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "invoiceId", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create revenue schedule indexes: %w", err)
+	}
+	return nil
+}
+
+// Create saves a new schedule, and reports ErrConcurrencyConflict when its
+// invoice line already has one.
+func (s *RevenueScheduleStore) Create(ctx context.Context, schedule *domain.RevenueSchedule) error {
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, schedule)
+	observeMongo("insert", s.collection, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: invoice line %s already has a revenue schedule", ErrConcurrencyConflict, schedule.InvoiceLineID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create revenue schedule: %w", err)
+	}
+	return nil
+}
+
+func (s *RevenueScheduleStore) FindByID(ctx context.Context, id uuid.UUID) (*domain.RevenueSchedule, error) {
+	start := time.Now()
+	var schedule domain.RevenueSchedule
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&schedule)
+	observeMongo("find_one", s.collection, start, err)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("revenue schedule not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to find revenue schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// FindByInvoice returns the schedules of an invoice's lines.
+func (s *RevenueScheduleStore) FindByInvoice(ctx context.Context, tenantID, invoiceID uuid.UUID) ([]*domain.RevenueSchedule, error) {
+	return s.find(ctx, bson.M{"tenantId": tenantID, "invoiceId": invoiceID})
+}
+
+// FindByTenant returns the tenant's schedules, optionally only those in
+// one status.
+func (s *RevenueScheduleStore) FindByTenant(ctx context.Context, tenantID uuid.UUID, status domain.RevenueScheduleStatus) ([]*domain.RevenueSchedule, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if status != "" {
+		filter["status"] = status
+	}
+	return s.find(ctx, filter)
+}
+
+// EachActive calls fn with every schedule, of any tenant, that still has
+// revenue to recognize.
+func (s *RevenueScheduleStore) EachActive(ctx context.Context, fn func(*domain.RevenueSchedule) error) error {
+	return eachDocument(ctx, s.collection, bson.M{"status": domain.RevenueScheduleActive}, func(cursor *mongo.Cursor) error {
+		var schedule domain.RevenueSchedule
+		if err := cursor.Decode(&schedule); err != nil {
+			return fmt.Errorf("failed to decode revenue schedule: %w", err)
+		}
+		return fn(&schedule)
+	})
+}
+
+// Update saves schedule if it is still at the version it was read at, and
+// reports ErrConcurrencyConflict otherwise.
+func (s *RevenueScheduleStore) Update(ctx context.Context, schedule *domain.RevenueSchedule) error {
+	next := *schedule
+	next.Version++
+
+	start := time.Now()
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": schedule.ID, "version": schedule.Version}, &next)
+	observeMongo("replace", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update revenue schedule: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: revenue schedule %s at version %d", ErrConcurrencyConflict, schedule.ID, schedule.Version)
+	}
+	schedule.Version++
+	return nil
+}
+
+func (s *RevenueScheduleStore) find(ctx context.Context, filter bson.M) ([]*domain.RevenueSchedule, error) {
+	schedules := []*domain.RevenueSchedule{}
+	err := eachDocument(ctx, s.collection, filter, func(cursor *mongo.Cursor) error {
+		var schedule domain.RevenueSchedule
+		if err := cursor.Decode(&schedule); err != nil {
+			return fmt.Errorf("failed to decode revenue schedule: %w", err)
+		}
+		schedules = append(schedules, &schedule)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
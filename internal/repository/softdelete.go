@@ -0,0 +1,22 @@
+package repository
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Field names written by domain.SoftDelete.
+const (
+	DeletedAtField = "deletedAt"
+	DeletedByField = "deletedBy"
+)
+
+// NotDeleted restricts filter to items that are not in the trash. Items
+// written before soft delete existed have no deletedAt and match as well.
+func NotDeleted(filter map[string]interface{}) map[string]interface{} {
+	filter[DeletedAtField] = nil
+	return filter
+}
+
+// OnlyDeleted restricts filter to items in the trash.
+func OnlyDeleted(filter map[string]interface{}) map[string]interface{} {
+	filter[DeletedAtField] = bson.M{"$ne": nil}
+	return filter
+}
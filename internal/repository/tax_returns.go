@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TaxReturnStore keeps tenants' filed VAT returns in the tax_returns
+// collection. A filed return locks its period.
+type TaxReturnStore struct {
+	returns *mongo.Collection
+}
+
+func NewTaxReturnStore(db *MongoDB) *TaxReturnStore {
+	return &TaxReturnStore{returns: db.Collection("tax_returns")}
+}
+
+// EnsureIndexes creates the store's indexes. A tenant files a period once.
+func (s *TaxReturnStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.returns.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "period", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("return_per_period"),
+		},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "from", Value: 1}, {Key: "to", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tax return indexes: %w", err)
+	}
+	return nil
+}
+
+// Create saves a filed return, and reports ErrConcurrencyConflict when its
+// period was filed before.
+func (s *TaxReturnStore) Create(ctx context.Context, taxReturn *domain.TaxReturn) error {
+	start := time.Now()
+	_, err := s.returns.InsertOne(ctx, taxReturn)
+	observeMongo("insert", s.returns, start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: VAT return for %s already filed", ErrConcurrencyConflict, taxReturn.Period)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create tax return: %w", err)
+	}
+	return nil
+}
+
+// FindByPeriod returns the tenant's return filed for period, or nil when
+// it has none.
+func (s *TaxReturnStore) FindByPeriod(ctx context.Context, tenantID uuid.UUID, period string) (*domain.TaxReturn, error) {
+	return s.findOne(ctx, bson.M{"tenantId": tenantID, "period": period})
+}
+
+// FindOverlapping returns a return of the tenant filed for a period that
+// overlaps [from, to), or nil when there is none.
+func (s *TaxReturnStore) FindOverlapping(ctx context.Context, tenantID uuid.UUID, from, to time.Time) (*domain.TaxReturn, error) {
+	return s.findOne(ctx, bson.M{
+		"tenantId": tenantID,
+		"from":     bson.M{"$lt": to},
+		"to":       bson.M{"$gt": from},
+	})
+}
+
+// FiledPeriod returns the period of the tenant's filed return that at
+// falls in, or "" when at is in no filed period.
+func (s *TaxReturnStore) FiledPeriod(ctx context.Context, tenantID uuid.UUID, at time.Time) (string, error) {
+	taxReturn, err := s.FindOverlapping(ctx, tenantID, at, at.Add(time.Nanosecond))
+	if err != nil || taxReturn == nil {
+		return "", err
+	}
+	return taxReturn.Period, nil
+}
+
+func (s *TaxReturnStore) findOne(ctx context.Context, filter bson.M) (*domain.TaxReturn, error) {
+	start := time.Now()
+	var taxReturn domain.TaxReturn
+	err := s.returns.FindOne(ctx, filter).Decode(&taxReturn)
+	observeMongo("find_one", s.returns, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tax return: %w", err)
+	}
+	return &taxReturn, nil
+}
+
+// List returns the tenant's filed returns, latest period first.
+func (s *TaxReturnStore) List(ctx context.Context, tenantID uuid.UUID, limit int64) ([]*domain.TaxReturn, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "from", Value: -1}}).SetLimit(limit)
+
+	start := time.Now()
+	cursor, err := s.returns.Find(ctx, bson.M{"tenantId": tenantID}, opts)
+	observeMongo("find", s.returns, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tax returns: %w", err)
+	}
+	returns := []*domain.TaxReturn{}
+	if err := cursor.All(ctx, &returns); err != nil {
+		return nil, fmt.Errorf("failed to decode tax returns: %w", err)
+	}
+	return returns, nil
+}
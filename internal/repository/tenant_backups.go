@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	BackupStatusRunning   = "running"
+	BackupStatusCompleted = "completed"
+	BackupStatusFailed    = "failed"
+
+	BackupTriggerManual    = "manual"
+	BackupTriggerScheduled = "scheduled"
+)
+
+var ErrTenantBackupNotFound = errors.New("tenant backup not found")
+
+// TenantBackup records one archive of a tenant's data. The archive is kept
+// in Bucket under ObjectKey once the backup completes.
+type TenantBackup struct {
+	ID            string           `bson:"_id" json:"id"`
+	TenantID      string           `bson:"tenantId" json:"tenantId"`
+	Trigger       string           `bson:"trigger" json:"trigger"`
+	RequestedBy   string           `bson:"requestedBy,omitempty" json:"requestedBy,omitempty"`
+	Status        string           `bson:"status" json:"status"`
+	FormatVersion int              `bson:"formatVersion" json:"formatVersion"`
+	Collections   map[string]int64 `bson:"collections,omitempty" json:"collections,omitempty"`
+	Documents     int64            `bson:"documents" json:"documents"`
+	Size          int64            `bson:"size,omitempty" json:"size,omitempty"`
+	Bucket        string           `bson:"bucket,omitempty" json:"-"`
+	ObjectKey     string           `bson:"objectKey,omitempty" json:"-"`
+	LastError     string           `bson:"lastError,omitempty" json:"error,omitempty"`
+	CreatedAt     time.Time        `bson:"createdAt" json:"createdAt"`
+	FinishedAt    *time.Time       `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+}
+
+// TenantBackupStore keeps the records of tenant backups in tenant_backups.
+// The collection is never itself backed up.
+type TenantBackupStore struct {
+	collection *mongo.Collection
+}
+
+func NewTenantBackupStore(db *MongoDB) *TenantBackupStore {
+	return &TenantBackupStore{collection: db.Collection("tenant_backups")}
+}
+
+func (s *TenantBackupStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tenant backup indexes: %w", err)
+	}
+	return nil
+}
+
+// Create stores backup as running.
+func (s *TenantBackupStore) Create(ctx context.Context, backup *TenantBackup) error {
+	backup.Status = BackupStatusRunning
+	backup.CreatedAt = time.Now().UTC()
+
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, backup)
+	observeMongo("insert", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant backup: %w", err)
+	}
+	return nil
+}
+
+// Finish records the outcome of a running backup.
+func (s *TenantBackupStore) Finish(ctx context.Context, backup *TenantBackup, status string) error {
+	now := time.Now().UTC()
+	backup.Status = status
+	backup.FinishedAt = &now
+
+	start := time.Now()
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": backup.ID, "status": BackupStatusRunning}, backup)
+	observeMongo("replace", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to finish tenant backup: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrTenantBackupNotFound
+	}
+	return nil
+}
+
+func (s *TenantBackupStore) Get(ctx context.Context, tenantID, id string) (*TenantBackup, error) {
+	start := time.Now()
+	var backup TenantBackup
+	err := s.collection.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&backup)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTenantBackupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant backup: %w", err)
+	}
+	return &backup, nil
+}
+
+// List returns up to limit backups of tenantID, newest first.
+func (s *TenantBackupStore) List(ctx context.Context, tenantID string, limit int64) ([]TenantBackup, error) {
+	return s.find(ctx, bson.M{"tenantId": tenantID}, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetLimit(limit))
+}
+
+// Running reports whether tenantID has a backup in progress started after
+// since.
+func (s *TenantBackupStore) Running(ctx context.Context, tenantID string, since time.Time) (bool, error) {
+	start := time.Now()
+	n, err := s.collection.CountDocuments(ctx, bson.M{
+		"tenantId":  tenantID,
+		"status":    BackupStatusRunning,
+		"createdAt": bson.M{"$gt": since},
+	})
+	observeMongo("count", s.collection, start, err)
+	if err != nil {
+		return false, fmt.Errorf("failed to count running tenant backups: %w", err)
+	}
+	return n > 0, nil
+}
+
+// CreatedBefore returns the backups, of every tenant, created before t.
+func (s *TenantBackupStore) CreatedBefore(ctx context.Context, t time.Time) ([]TenantBackup, error) {
+	return s.find(ctx, bson.M{"createdAt": bson.M{"$lt": t}}, options.Find().SetLimit(1000))
+}
+
+func (s *TenantBackupStore) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	observeMongo("delete", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant backup: %w", err)
+	}
+	return nil
+}
+
+func (s *TenantBackupStore) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]TenantBackup, error) {
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant backups: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	backups := []TenantBackup{}
+	if err := cursor.All(ctx, &backups); err != nil {
+		return nil, fmt.Errorf("failed to decode tenant backups: %w", err)
+	}
+	return backups, nil
+}
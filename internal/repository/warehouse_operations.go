@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WarehouseOperationFilter selects a tenant's operations completed in
+// [From, To). WarehouseID is optional.
+type WarehouseOperationFilter struct {
+	TenantID    uuid.UUID
+	WarehouseID uuid.UUID
+	From        time.Time
+	To          time.Time
+}
+
+// WarehouseOperationStore reads completed operations from the
+// warehouse_operations collection for reporting.
+type WarehouseOperationStore struct {
+	collection *mongo.Collection
+}
+
+func NewWarehouseOperationStore(db *MongoDB) *WarehouseOperationStore {
+	return &WarehouseOperationStore{collection: db.Collection("warehouse_operations")}
+}
+
+func (s *WarehouseOperationStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenantId", Value: 1},
+			{Key: "status", Value: 1},
+			{Key: "completedAt", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create warehouse operation indexes: %w", err)
+	}
+	return nil
+}
+
+// EachCompleted calls fn with the completed operations matching filter. It
+// stops at the first error fn returns.
+func (s *WarehouseOperationStore) EachCompleted(ctx context.Context, filter WarehouseOperationFilter, fn func(*domain.WarehouseOperation) error) error {
+	query := bson.M{
+		"tenantId":    filter.TenantID,
+		"status":      "completed",
+		"completedAt": bson.M{"$gte": filter.From, "$lt": filter.To},
+	}
+	if filter.WarehouseID != uuid.Nil {
+		query["warehouseId"] = filter.WarehouseID
+	}
+	return eachDocument(ctx, s.collection, query, func(cursor *mongo.Cursor) error {
+		var operation domain.WarehouseOperation
+		if err := cursor.Decode(&operation); err != nil {
+			return fmt.Errorf("failed to decode warehouse operation: %w", err)
+		}
+		return fn(&operation)
+	})
+}
@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound     = errors.New("webhook delivery not found")
+)
+
+type WebhookSubscriptionStore struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookSubscriptionStore(db *MongoDB) *WebhookSubscriptionStore {
+	return &WebhookSubscriptionStore{collection: db.Collection("webhook_subscriptions")}
+}
+
+func (s *WebhookSubscriptionStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "active", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook subscription indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookSubscriptionStore) Create(ctx context.Context, sub *domain.WebhookSubscription) error {
+	now := time.Now().UTC()
+	if sub.ID == "" {
+		sub.ID = uuid.New().String()
+	}
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+
+	start := time.Now()
+	_, err := s.collection.InsertOne(ctx, sub)
+	observeMongo("insert", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookSubscriptionStore) Get(ctx context.Context, tenantID, id string) (*domain.WebhookSubscription, error) {
+	start := time.Now()
+	var sub domain.WebhookSubscription
+	err := s.collection.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&sub)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// List returns the tenant's subscriptions, only active ones when activeOnly
+// is set.
+func (s *WebhookSubscriptionStore) List(ctx context.Context, tenantID string, activeOnly bool) ([]domain.WebhookSubscription, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if activeOnly {
+		filter["active"] = true
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	subs := make([]domain.WebhookSubscription, 0)
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// Update replaces the subscription's URL, event types, description and
+// active flag. The secret cannot be changed.
+func (s *WebhookSubscriptionStore) Update(ctx context.Context, sub *domain.WebhookSubscription) error {
+	sub.UpdatedAt = time.Now().UTC()
+
+	start := time.Now()
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": sub.ID, "tenantId": sub.TenantID}, bson.M{"$set": bson.M{
+		"url":         sub.URL,
+		"eventTypes":  sub.EventTypes,
+		"description": sub.Description,
+		"active":      sub.Active,
+		"updatedAt":   sub.UpdatedAt,
+	}})
+	observeMongo("update", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+	return nil
+}
+
+func (s *WebhookSubscriptionStore) Delete(ctx context.Context, tenantID, id string) error {
+	start := time.Now()
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+	observeMongo("delete", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+	return nil
+}
+
+// WebhookDeliveryFilter narrows WebhookDeliveryStore.List. Empty fields match
+// everything.
+type WebhookDeliveryFilter struct {
+	SubscriptionID string
+	EventID        string
+	Status         string
+	Limit          int64
+}
+
+type WebhookDeliveryStore struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookDeliveryStore(db *MongoDB) *WebhookDeliveryStore {
+	return &WebhookDeliveryStore{collection: db.Collection("webhook_deliveries")}
+}
+
+// EnsureIndexes creates the polling and listing indexes, a TTL index that
+// removes deliveries after retention, and a unique index that keeps an event
+// from being queued twice for the same subscription. Redeliveries are exempt
+// from the latter.
+func (s *WebhookDeliveryStore) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{
+			Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "eventId", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"redeliveryOf": ""}).
+				SetName("one_delivery_per_event"),
+		},
+		{
+			Keys:    bson.D{{Key: "createdAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery indexes: %w", err)
+	}
+	return nil
+}
+
+// Add queues deliveries. Deliveries already queued for the same event and
+// subscription are skipped, so redelivered events are not sent twice.
+func (s *WebhookDeliveryStore) Add(ctx context.Context, deliveries ...*domain.WebhookDelivery) error {
+	for _, d := range deliveries {
+		if d.ID == "" {
+			d.ID = uuid.New().String()
+		}
+		if d.CreatedAt.IsZero() {
+			d.CreatedAt = time.Now().UTC()
+		}
+
+		start := time.Now()
+		_, err := s.collection.InsertOne(ctx, d)
+		observeMongo("insert", s.collection, start, err)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to add webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// ClaimDue leases up to limit pending deliveries whose next attempt is due
+// by pushing their next attempt lockFor into the future. A worker that dies
+// mid-attempt leaves the delivery to be claimed again once the lease ends.
+func (s *WebhookDeliveryStore) ClaimDue(ctx context.Context, limit int, lockFor time.Duration) ([]domain.WebhookDelivery, error) {
+	var claimed []domain.WebhookDelivery
+	for len(claimed) < limit {
+		now := time.Now().UTC()
+		filter := bson.M{
+			"status":        domain.WebhookDeliveryPending,
+			"nextAttemptAt": bson.M{"$lte": now},
+		}
+		update := bson.M{"$set": bson.M{"nextAttemptAt": now.Add(lockFor)}}
+		opts := options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+			SetReturnDocument(options.After)
+
+		start := time.Now()
+		var d domain.WebhookDelivery
+		err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&d)
+		observeMongo("find_one_and_update", s.collection, start, err)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return claimed, fmt.Errorf("failed to claim webhook delivery: %w", err)
+		}
+		claimed = append(claimed, d)
+	}
+	return claimed, nil
+}
+
+// Save stores the delivery's status and attempt log.
+func (s *WebhookDeliveryStore) Save(ctx context.Context, d *domain.WebhookDelivery) error {
+	start := time.Now()
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": d.ID}, d)
+	observeMongo("replace", s.collection, start, err)
+	if err != nil {
+		return fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookDeliveryStore) Get(ctx context.Context, tenantID, id string) (*domain.WebhookDelivery, error) {
+	start := time.Now()
+	var d domain.WebhookDelivery
+	err := s.collection.FindOne(ctx, bson.M{"_id": id, "tenantId": tenantID}).Decode(&d)
+	observeMongo("find_one", s.collection, start, err)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	return &d, nil
+}
+
+// List returns the tenant's most recent deliveries matching filter.
+func (s *WebhookDeliveryStore) List(ctx context.Context, tenantID string, filter WebhookDeliveryFilter) ([]domain.WebhookDelivery, error) {
+	query := bson.M{"tenantId": tenantID}
+	if filter.SubscriptionID != "" {
+		query["subscriptionId"] = filter.SubscriptionID
+	}
+	if filter.EventID != "" {
+		query["eventId"] = filter.EventID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(filter.Limit)
+
+	start := time.Now()
+	cursor, err := s.collection.Find(ctx, query, opts)
+	observeMongo("find", s.collection, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := make([]domain.WebhookDelivery, 0)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
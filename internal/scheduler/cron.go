@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// Schedule computes when a job is due next.
+type Schedule interface {
+	// Next returns the first activation time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a standard five-field cron expression (minute, hour,
+// day of month, month, day of week), one of the descriptors @yearly,
+// @monthly, @weekly, @daily and @hourly, or "@every <duration>". Fields
+// accept *, lists, ranges and steps, e.g. "*/15 8-18 * * 1-5". Cron
+// expressions are evaluated in UTC.
+func ParseSchedule(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("%w: %q needs a duration of at least 1s", ErrInvalidSchedule, expr)
+		}
+		return everySchedule(every), nil
+	}
+	if spec, ok := descriptors[expr]; ok {
+		expr = spec
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q must have five fields", ErrInvalidSchedule, expr)
+	}
+	var s cronSchedule
+	var err error
+	for i, target := range []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow} {
+		if *target, err = parseField(fields[i], cronBounds[i]); err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSchedule, expr, err)
+		}
+	}
+	// Sunday may be written as 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return &s, nil
+}
+
+type everySchedule time.Duration
+
+// Next aligns activations to multiples of the interval, so replicas agree on
+// the activation times.
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(e)).Add(time.Duration(e))
+}
+
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var cronBounds = []bounds{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseField returns the field's allowed values as a bit set.
+func parseField(field string, b bounds) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q in %s", stepPart, b.name)
+			}
+			step = n
+		}
+
+		lo, hi := b.min, b.max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("bad value %q in %s", from, b.name)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("bad value %q in %s", to, b.name)
+				}
+			} else if hasStep {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("%s must be within %d-%d", b.name, b.min, b.max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// As in classic cron, when both day fields are restricted a day matches
+	// if either does.
+	domStar, dowStar bool
+}
+
+// maxSearch bounds Next for expressions that never match, like "0 0 31 2 *".
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule_Next(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2026, 3, 4, 10, 7, 30, 0, time.UTC)
+
+	for expr, want := range map[string]time.Time{
+		"* * * * *":         time.Date(2026, 3, 4, 10, 8, 0, 0, time.UTC),
+		"*/15 * * * *":      time.Date(2026, 3, 4, 10, 15, 0, 0, time.UTC),
+		"0 9 * * *":         time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC),
+		"30 8-18/2 * * 1-5": time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC),
+		"0 6 * * 0":         time.Date(2026, 3, 8, 6, 0, 0, 0, time.UTC),
+		"0 6 * * 7":         time.Date(2026, 3, 8, 6, 0, 0, 0, time.UTC),
+		"0 0 1,15 * *":      time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC),
+		"0 0 1 * 5":         time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":        time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		"@hourly":           time.Date(2026, 3, 4, 11, 0, 0, 0, time.UTC),
+		"@daily":            time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC),
+		"@monthly":          time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		"@every 10m":        time.Date(2026, 3, 4, 10, 10, 0, 0, time.UTC),
+	} {
+		schedule, err := ParseSchedule(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, schedule.Next(from), expr)
+	}
+}
+
+func TestParseSchedule_NeverMatches(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 100ms",
+		"@every soon",
+		"@fortnightly",
+	} {
+		_, err := ParseSchedule(expr)
+		assert.True(t, errors.Is(err, ErrInvalidSchedule), expr)
+	}
+}
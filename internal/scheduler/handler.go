@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// Handler serves the jobs admin API under /admin/jobs:
+//
+//	GET  /admin/jobs                   registered jobs, next and last run
+//	GET  /admin/jobs/{name}/runs?limit= run history, newest first
+//	POST /admin/jobs/{name}/run        run a job now
+//
+// Jobs are not tenant scoped, so the endpoints run behind the tenant
+// middleware and need middleware.AdminPermission; like the other /admin APIs
+// they are meant for operators and are not routed through the API gateway.
+func (s *Scheduler) Handler() http.Handler {
+	return middleware.RequirePermission(middleware.AdminPermission, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/admin/jobs"), "/")
+		parts := strings.Split(path, "/")
+
+		switch {
+		case path == "" && req.Method == http.MethodGet:
+			jobs, err := s.Jobs(req.Context())
+			if err != nil {
+				s.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": jobs})
+
+		case len(parts) == 2 && parts[1] == "runs" && req.Method == http.MethodGet:
+			limit, _ := strconv.ParseInt(req.URL.Query().Get("limit"), 10, 64)
+			if limit <= 0 || limit > 200 {
+				limit = 20
+			}
+			runs, err := s.Runs(req.Context(), parts[0], limit)
+			if err != nil {
+				s.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": runs})
+
+		case len(parts) == 2 && parts[1] == "run" && req.Method == http.MethodPost:
+			if err := s.Trigger(req.Context(), parts[0]); err != nil {
+				s.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusAccepted, map[string]string{"job": parts[0], "status": "triggered"})
+
+		case path == "" || (len(parts) == 2 && (parts[1] == "runs" || parts[1] == "run")):
+			httpresponse.ErrorStatus(w, req, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			httpresponse.ErrorStatus(w, req, http.StatusNotFound, "not found")
+		}
+	}))
+}
+
+func (s *Scheduler) writeError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		httpresponse.ErrorStatus(w, req, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrJobDisabled):
+		httpresponse.ErrorStatus(w, req, http.StatusConflict, err.Error())
+	default:
+		s.logger.Error("Jobs request failed", "error", err)
+		httpresponse.ErrorStatus(w, req, http.StatusInternalServerError, "scheduler unavailable")
+	}
+}
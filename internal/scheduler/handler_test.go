@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_RequiresAdminPermission(t *testing.T) {
+	s := newTestScheduler(t, config.SchedulerConfig{}, &memoryLocker{locks: map[string]string{}}, &memoryRuns{})
+	var calls atomic.Int32
+	require.NoError(t, s.Register(Job{Name: "trash.purge.clients", Schedule: "@daily", Run: func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}}))
+
+	request := func(method, path string, permissions ...string) *httptest.ResponseRecorder {
+		ctx := middleware.WithIdentity(context.Background(), "tenant-a", "user-1", permissions)
+		req := httptest.NewRequest(method, path, nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/admin/jobs").Code)
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/admin/jobs/trash.purge.clients/runs", "client:read").Code)
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/admin/jobs/trash.purge.clients/run", "client:write", "*:read").Code)
+	s.wg.Wait()
+	assert.Zero(t, calls.Load(), "a refused trigger does not run the job")
+
+	rec := request(http.MethodGet, "/admin/jobs", middleware.AdminPermission)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "trash.purge.clients")
+
+	assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/admin/jobs/trash.purge.clients/run", middleware.AdminPermission).Code)
+	s.wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
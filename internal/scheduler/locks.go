@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// unlockScript deletes the lock only while it still belongs to the caller,
+// so a run that outlived its TTL cannot release a lock another replica took.
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// RedisLocker holds job locks as Redis keys that expire after their TTL.
+type RedisLocker struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisLocker(r *repository.Redis) *RedisLocker {
+	return &RedisLocker{client: r.Client(), prefix: "scheduler:lock:"}
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	key := l.prefix + name
+	ok, err := l.client.SetNX(ctx, key, owner, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire job lock: %w", err)
+	}
+	if ok {
+		return true, nil
+	}
+
+	current, err := l.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read job lock: %w", err)
+	}
+	if current != owner {
+		return false, nil
+	}
+	if err := l.client.PExpire(ctx, key, ttl).Err(); err != nil {
+		return false, fmt.Errorf("failed to renew job lock: %w", err)
+	}
+	return true, nil
+}
+
+func (l *RedisLocker) Unlock(ctx context.Context, name, owner string) error {
+	if err := unlockScript.Run(ctx, l.client, []string{l.prefix + name}, owner).Err(); err != nil {
+		return fmt.Errorf("failed to release job lock: %w", err)
+	}
+	return nil
+}
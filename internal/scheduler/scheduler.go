@@ -0,0 +1,352 @@
+// Package scheduler runs background jobs such as dunning, recurring invoices
+// or cache warming on cron schedules. Every replica of a service runs the
+// scheduler; a lock and the unique run history entry per activation make
+// sure each activation runs on one replica only.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+var (
+	ErrJobNotFound   = errors.New("job not found")
+	ErrJobExists     = errors.New("job already registered")
+	ErrJobDisabled   = errors.New("job is disabled")
+	errJobIncomplete = errors.New("job needs a name, a schedule and a run function")
+)
+
+// Locker keeps a job from running on two replicas at once.
+// repository.JobLockStore and RedisLocker implement it.
+type Locker interface {
+	TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, name, owner string) error
+}
+
+// RunStore records run history; repository.JobRunStore implements it.
+type RunStore interface {
+	Start(ctx context.Context, run *repository.JobRun) error
+	Finish(ctx context.Context, run *repository.JobRun) error
+	List(ctx context.Context, job string, limit int64) ([]repository.JobRun, error)
+}
+
+// Job is a unit of scheduled work. A failed run is retried up to
+// MaxAttempts times in total, waiting RetryBackoff doubled per attempt.
+// Each attempt is cancelled after Timeout.
+type Job struct {
+	Name         string
+	Schedule     string
+	Run          func(ctx context.Context) error
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	Timeout      time.Duration
+}
+
+// lockTTL covers every attempt and the waits between them, so the lock
+// outlives a run that is still retrying.
+func (j Job) lockTTL() time.Duration {
+	ttl := time.Duration(j.MaxAttempts) * j.Timeout
+	for attempt := 1; attempt < j.MaxAttempts; attempt++ {
+		ttl += j.RetryBackoff << (attempt - 1)
+	}
+	return ttl
+}
+
+// JobInfo describes a registered job for the admin API.
+type JobInfo struct {
+	Name        string             `json:"name"`
+	Schedule    string             `json:"schedule"`
+	Disabled    bool               `json:"disabled"`
+	MaxAttempts int                `json:"maxAttempts"`
+	Timeout     string             `json:"timeout"`
+	NextRun     *time.Time         `json:"nextRun,omitempty"`
+	Running     bool               `json:"running"`
+	LastRun     *repository.JobRun `json:"lastRun,omitempty"`
+}
+
+type jobState struct {
+	job      Job
+	schedule Schedule
+	disabled bool
+	next     time.Time
+	// running guards against overlapping runs on this replica; the Locker
+	// does the same across replicas.
+	running atomic.Bool
+}
+
+type Scheduler struct {
+	config config.SchedulerConfig
+	locker Locker
+	runs   RunStore
+	owner  string
+	logger *logger.Logger
+	now    func() time.Time
+
+	mu   sync.Mutex
+	jobs map[string]*jobState
+	wg   sync.WaitGroup
+}
+
+func New(cfg config.SchedulerConfig, locker Locker, runs RunStore, log *logger.Logger) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		config: cfg,
+		locker: locker,
+		runs:   runs,
+		owner:  host + "-" + uuid.New().String()[:8],
+		logger: log,
+		now:    time.Now,
+		jobs:   make(map[string]*jobState),
+	}
+}
+
+// NewLocker returns the Locker selected by cfg.Locks. redis may be nil when
+// locks are held in MongoDB.
+func NewLocker(cfg config.SchedulerConfig, db *repository.MongoDB, redis *repository.Redis) (Locker, error) {
+	switch cfg.Locks {
+	case "mongo":
+		return repository.NewJobLockStore(db), nil
+	case "redis":
+		if redis == nil {
+			return nil, errors.New("scheduler.locks is redis but no Redis connection is configured")
+		}
+		return NewRedisLocker(redis), nil
+	}
+	return nil, fmt.Errorf("unknown scheduler.locks %q", cfg.Locks)
+}
+
+// Register adds job, applying any overrides from scheduler.jobs.
+func (s *Scheduler) Register(job Job) error {
+	if override, ok := s.config.Jobs[job.Name]; ok {
+		if override.Schedule != "" {
+			job.Schedule = override.Schedule
+		}
+		if override.MaxAttempts > 0 {
+			job.MaxAttempts = override.MaxAttempts
+		}
+		if override.Timeout > 0 {
+			job.Timeout = override.Timeout
+		}
+	}
+	if job.Name == "" || job.Schedule == "" || job.Run == nil {
+		return errJobIncomplete
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = 1
+	}
+	if job.RetryBackoff <= 0 {
+		job.RetryBackoff = 10 * time.Second
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = 10 * time.Minute
+	}
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrJobExists, job.Name)
+	}
+	s.jobs[job.Name] = &jobState{
+		job:      job,
+		schedule: schedule,
+		disabled: s.config.Jobs[job.Name].Disabled,
+		next:     schedule.Next(s.now()),
+	}
+	return nil
+}
+
+// Run starts due jobs until ctx is cancelled, then waits for running jobs to
+// return. Activations missed while no replica was running are skipped, not
+// caught up.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.TickInterval)
+	defer ticker.Stop()
+	s.logger.Info("Job scheduler started", "jobs", len(s.jobs), "locks", s.config.Locks)
+	for {
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			s.logger.Info("Job scheduler stopped")
+			return
+		case <-ticker.C:
+			s.startDue(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) startDue(ctx context.Context) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range s.jobs {
+		if st.disabled || st.next.IsZero() || now.Before(st.next) {
+			continue
+		}
+		scheduledAt := st.next
+		st.next = st.schedule.Next(now)
+		s.wg.Add(1)
+		go func(st *jobState) {
+			defer s.wg.Done()
+			s.execute(ctx, st, scheduledAt, TriggerSchedule)
+		}(st)
+	}
+}
+
+// Trigger runs the job now, in the background, regardless of its schedule.
+func (s *Scheduler) Trigger(ctx context.Context, name string) error {
+	s.mu.Lock()
+	st, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	if st.disabled {
+		return ErrJobDisabled
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(context.WithoutCancel(ctx), st, s.now(), TriggerManual)
+	}()
+	return nil
+}
+
+// execute runs one activation of the job unless it is already running here
+// or elsewhere, or another replica has already run this activation.
+func (s *Scheduler) execute(ctx context.Context, st *jobState, scheduledAt time.Time, trigger string) {
+	job := st.job
+	if !st.running.CompareAndSwap(false, true) {
+		s.logger.Warn("Skipping job run, previous run still in progress", "job", job.Name)
+		return
+	}
+	defer st.running.Store(false)
+
+	lock := "job:" + job.Name
+	locked, err := s.locker.TryLock(ctx, lock, s.owner, job.lockTTL())
+	if err != nil {
+		s.logger.Error("Failed to acquire job lock", "job", job.Name, "error", err)
+		return
+	}
+	if !locked {
+		s.logger.Debug("Job is running on another replica", "job", job.Name)
+		return
+	}
+	defer func() {
+		if err := s.locker.Unlock(context.WithoutCancel(ctx), lock, s.owner); err != nil {
+			s.logger.Warn("Failed to release job lock", "job", job.Name, "error", err)
+		}
+	}()
+
+	run := &repository.JobRun{
+		Job:         job.Name,
+		ScheduledAt: scheduledAt.UTC().Truncate(time.Millisecond),
+		Trigger:     trigger,
+		Owner:       s.owner,
+	}
+	if err := s.runs.Start(ctx, run); err != nil {
+		if !errors.Is(err, repository.ErrJobRunExists) {
+			s.logger.Error("Failed to record job run", "job", job.Name, "error", err)
+		}
+		return
+	}
+
+	for run.Attempts = 1; ; run.Attempts++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+		err = job.Run(attemptCtx)
+		cancel()
+		if err == nil || run.Attempts >= job.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		backoff := job.RetryBackoff << (run.Attempts - 1)
+		s.logger.Warn("Job attempt failed, retrying", "job", job.Name, "error", err, "attempt", run.Attempts, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+	}
+
+	run.Status = repository.JobRunSucceeded
+	if err != nil {
+		run.Status = repository.JobRunFailed
+		run.Error = err.Error()
+	}
+	if err := s.runs.Finish(context.WithoutCancel(ctx), run); err != nil {
+		s.logger.Error("Failed to record job run result", "job", job.Name, "error", err)
+	}
+	if run.Status == repository.JobRunFailed {
+		s.logger.Error("Job failed", "job", job.Name, "error", run.Error, "attempts", run.Attempts)
+		return
+	}
+	s.logger.Info("Job finished", "job", job.Name, "trigger", trigger, "attempts", run.Attempts, "duration_ms", run.DurationMs)
+}
+
+// Jobs describes the registered jobs, sorted by name, with their last run.
+func (s *Scheduler) Jobs(ctx context.Context) ([]JobInfo, error) {
+	s.mu.Lock()
+	states := make([]*jobState, 0, len(s.jobs))
+	for _, st := range s.jobs {
+		states = append(states, st)
+	}
+	nexts := make(map[string]time.Time, len(states))
+	for _, st := range states {
+		nexts[st.job.Name] = st.next
+	}
+	s.mu.Unlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].job.Name < states[j].job.Name })
+
+	infos := make([]JobInfo, 0, len(states))
+	for _, st := range states {
+		info := JobInfo{
+			Name:        st.job.Name,
+			Schedule:    st.job.Schedule,
+			Disabled:    st.disabled,
+			MaxAttempts: st.job.MaxAttempts,
+			Timeout:     st.job.Timeout.String(),
+			Running:     st.running.Load(),
+		}
+		if next := nexts[st.job.Name]; !st.disabled && !next.IsZero() {
+			info.NextRun = &next
+		}
+		runs, err := s.runs.List(ctx, st.job.Name, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			info.LastRun = &runs[0]
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Runs returns the job's most recent runs.
+func (s *Scheduler) Runs(ctx context.Context, name string, limit int64) ([]repository.JobRun, error) {
+	s.mu.Lock()
+	_, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return s.runs.List(ctx, name, limit)
+}
@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]string
+}
+
+func (l *memoryLocker) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current, ok := l.locks[name]; ok && current != owner {
+		return false, nil
+	}
+	l.locks[name] = owner
+	return true, nil
+}
+
+func (l *memoryLocker) Unlock(ctx context.Context, name, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks[name] == owner {
+		delete(l.locks, name)
+	}
+	return nil
+}
+
+type memoryRuns struct {
+	mu   sync.Mutex
+	runs []repository.JobRun
+}
+
+func (m *memoryRuns) Start(ctx context.Context, run *repository.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.runs {
+		if existing.Job == run.Job && existing.ScheduledAt.Equal(run.ScheduledAt) {
+			return repository.ErrJobRunExists
+		}
+	}
+	run.ID = run.Job + "-" + run.ScheduledAt.String()
+	run.Status = repository.JobRunRunning
+	m.runs = append(m.runs, *run)
+	return nil
+}
+
+func (m *memoryRuns) Finish(ctx context.Context, run *repository.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.runs {
+		if m.runs[i].ID == run.ID {
+			m.runs[i] = *run
+		}
+	}
+	return nil
+}
+
+func (m *memoryRuns) List(ctx context.Context, job string, limit int64) ([]repository.JobRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var runs []repository.JobRun
+	for i := len(m.runs) - 1; i >= 0 && int64(len(runs)) < limit; i-- {
+		if m.runs[i].Job == job {
+			runs = append(runs, m.runs[i])
+		}
+	}
+	return runs, nil
+}
+
+func newTestScheduler(t *testing.T, cfg config.SchedulerConfig, locker *memoryLocker, runs *memoryRuns) *Scheduler {
+	log, err := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	require.NoError(t, err)
+	return New(cfg, locker, runs, log)
+}
+
+func TestScheduler_RetriesFailedRuns(t *testing.T) {
+	runs := &memoryRuns{}
+	s := newTestScheduler(t, config.SchedulerConfig{}, &memoryLocker{locks: map[string]string{}}, runs)
+
+	calls := 0
+	require.NoError(t, s.Register(Job{
+		Name:         "dunning",
+		Schedule:     "@hourly",
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+		Run: func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("smtp down")
+			}
+			return nil
+		},
+	}))
+
+	s.execute(context.Background(), s.jobs["dunning"], time.Now(), TriggerSchedule)
+
+	assert.Equal(t, 3, calls)
+	history, _ := runs.List(context.Background(), "dunning", 10)
+	require.Len(t, history, 1)
+	assert.Equal(t, repository.JobRunSucceeded, history[0].Status)
+	assert.Equal(t, 3, history[0].Attempts)
+}
+
+func TestScheduler_RecordsFailure(t *testing.T) {
+	runs := &memoryRuns{}
+	s := newTestScheduler(t, config.SchedulerConfig{}, &memoryLocker{locks: map[string]string{}}, runs)
+	require.NoError(t, s.Register(Job{
+		Name:     "warm-cache",
+		Schedule: "@hourly",
+		Run:      func(ctx context.Context) error { return errors.New("redis down") },
+	}))
+
+	s.execute(context.Background(), s.jobs["warm-cache"], time.Now(), TriggerSchedule)
+
+	history, _ := runs.List(context.Background(), "warm-cache", 10)
+	require.Len(t, history, 1)
+	assert.Equal(t, repository.JobRunFailed, history[0].Status)
+	assert.Equal(t, "redis down", history[0].Error)
+	assert.Equal(t, 1, history[0].Attempts)
+}
+
+func TestScheduler_RunsActivationOnce(t *testing.T) {
+	locker := &memoryLocker{locks: map[string]string{}}
+	runs := &memoryRuns{}
+	a := newTestScheduler(t, config.SchedulerConfig{}, locker, runs)
+	b := newTestScheduler(t, config.SchedulerConfig{}, locker, runs)
+
+	calls := 0
+	job := Job{Name: "expire-reservations", Schedule: "*/5 * * * *", Run: func(ctx context.Context) error {
+		calls++
+		return nil
+	}}
+	require.NoError(t, a.Register(job))
+	require.NoError(t, b.Register(job))
+
+	at := time.Date(2026, 3, 4, 10, 5, 0, 0, time.UTC)
+	a.execute(context.Background(), a.jobs[job.Name], at, TriggerSchedule)
+	b.execute(context.Background(), b.jobs[job.Name], at, TriggerSchedule)
+	assert.Equal(t, 1, calls)
+
+	// While a holds the lock, b cannot run even a new activation.
+	ok, _ := locker.TryLock(context.Background(), "job:"+job.Name, a.owner, time.Minute)
+	require.True(t, ok)
+	b.execute(context.Background(), b.jobs[job.Name], at.Add(5*time.Minute), TriggerSchedule)
+	assert.Equal(t, 1, calls)
+}
+
+func TestScheduler_RegisterAppliesConfig(t *testing.T) {
+	cfg := config.SchedulerConfig{Jobs: map[string]config.JobConfig{
+		"recurring-invoices": {Schedule: "0 2 * * *", MaxAttempts: 5},
+		"cache-warming":      {Disabled: true},
+	}}
+	s := newTestScheduler(t, cfg, &memoryLocker{locks: map[string]string{}}, &memoryRuns{})
+	run := func(ctx context.Context) error { return nil }
+
+	require.NoError(t, s.Register(Job{Name: "recurring-invoices", Schedule: "@daily", Run: run}))
+	require.NoError(t, s.Register(Job{Name: "cache-warming", Schedule: "@hourly", Run: run}))
+	assert.True(t, errors.Is(s.Register(Job{Name: "cache-warming", Schedule: "@hourly", Run: run}), ErrJobExists))
+	assert.True(t, errors.Is(s.Register(Job{Name: "bad", Schedule: "daily", Run: run}), ErrInvalidSchedule))
+
+	jobs, err := s.Jobs(context.Background())
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "cache-warming", jobs[0].Name)
+	assert.True(t, jobs[0].Disabled)
+	assert.Nil(t, jobs[0].NextRun)
+	assert.Equal(t, "0 2 * * *", jobs[1].Schedule)
+	assert.Equal(t, 5, jobs[1].MaxAttempts)
+	require.NotNil(t, jobs[1].NextRun)
+	assert.Equal(t, 2, jobs[1].NextRun.Hour())
+
+	assert.True(t, errors.Is(s.Trigger(context.Background(), "cache-warming"), ErrJobDisabled))
+	assert.True(t, errors.Is(s.Trigger(context.Background(), "missing"), ErrJobNotFound))
+}
@@ -0,0 +1,265 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// errNotFound is returned for a document or index that does not exist.
+var errNotFound = errors.New("not found")
+
+// indexMapping is applied to every tenant index. Numbers are keywords
+// compared case-insensitively, so "inv-2026-0001" finds INV-2026-0001.
+const indexMapping = `{
+  "settings": {
+    "analysis": {
+      "normalizer": {
+        "lowercase": {"type": "custom", "filter": ["lowercase"]}
+      }
+    }
+  },
+  "mappings": {
+    "dynamic": false,
+    "properties": {
+      "type":      {"type": "keyword"},
+      "entityId":  {"type": "keyword"},
+      "title":     {"type": "text", "fields": {"keyword": {"type": "keyword", "normalizer": "lowercase"}}},
+      "subtitle":  {"type": "text"},
+      "number":    {"type": "keyword", "normalizer": "lowercase"},
+      "body":      {"type": "text"},
+      "keywords":  {"type": "text"},
+      "status":    {"type": "keyword"},
+      "clientId":  {"type": "keyword"},
+      "deleted":   {"type": "boolean"},
+      "createdAt": {"type": "date"},
+      "updatedAt": {"type": "date"}
+    }
+  }
+}`
+
+// Client talks to Elasticsearch over its REST API. Requests rotate through
+// the configured addresses and are retried on the configured statuses.
+type Client struct {
+	cfg     config.ElasticsearchConfig
+	http    *http.Client
+	logger  *logger.Logger
+	mu      sync.Mutex
+	next    int
+	created sync.Map // index name -> struct{}
+}
+
+func NewClient(cfg config.ElasticsearchConfig, log *logger.Logger) (*Client, error) {
+	if len(cfg.Addresses) == 0 {
+		return nil, fmt.Errorf("elasticsearch.addresses is not configured")
+	}
+	if cfg.IndexPrefix == "" {
+		cfg.IndexPrefix = "erp"
+	}
+	if len(cfg.RetryOnStatus) == 0 {
+		cfg.RetryOnStatus = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 200 * time.Millisecond
+	}
+	timeout := cfg.Transport
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Client{
+		cfg:    cfg,
+		http:   &http.Client{Timeout: timeout},
+		logger: log,
+	}, nil
+}
+
+// Index returns the tenant's index name.
+func (c *Client) Index(tenantID string) string {
+	return strings.ToLower(c.cfg.IndexPrefix + "-search-" + tenantID)
+}
+
+// Ping checks the cluster is reachable, for health checks.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/_cluster/health", nil, nil)
+	return err
+}
+
+// ensureIndex creates the tenant's index with its mapping on first use.
+func (c *Client) ensureIndex(ctx context.Context, tenantID string) (string, error) {
+	index := c.Index(tenantID)
+	if _, ok := c.created.Load(index); ok {
+		return index, nil
+	}
+	var failure struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	status, err := c.do(ctx, http.MethodPut, "/"+index, json.RawMessage(indexMapping), &failure)
+	if err != nil && !(status == http.StatusBadRequest && failure.Error.Type == "resource_already_exists_exception") {
+		return "", fmt.Errorf("create index %s: %w", index, err)
+	}
+	c.created.Store(index, struct{}{})
+	return index, nil
+}
+
+// Upsert merges fields into the entity's document, creating it if needed.
+func (c *Client) Upsert(ctx context.Context, tenantID, id string, fields map[string]interface{}) error {
+	index, err := c.ensureIndex(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{"doc": fields, "doc_as_upsert": true}
+	_, err = c.do(ctx, http.MethodPost, "/"+index+"/_update/"+url.PathEscape(id)+"?retry_on_conflict=3", body, nil)
+	return err
+}
+
+// Delete removes the entity's document; a missing document is not an error.
+func (c *Client) Delete(ctx context.Context, tenantID, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/"+c.Index(tenantID)+"/_doc/"+url.PathEscape(id), nil, nil)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Get returns the entity's document, or errNotFound.
+func (c *Client) Get(ctx context.Context, tenantID, id string) (*Document, error) {
+	var result struct {
+		Found  bool     `json:"found"`
+		Source Document `json:"_source"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/"+c.Index(tenantID)+"/_doc/"+url.PathEscape(id), nil, &result); err != nil {
+		return nil, err
+	}
+	if !result.Found {
+		return nil, errNotFound
+	}
+	return &result.Source, nil
+}
+
+// UpdateByQuery sets fields on every document of the tenant matching query.
+func (c *Client) UpdateByQuery(ctx context.Context, tenantID string, query map[string]interface{}, fields map[string]interface{}) error {
+	var script strings.Builder
+	for name := range fields {
+		fmt.Fprintf(&script, "ctx._source.%s = params.%s;", name, name)
+	}
+	body := map[string]interface{}{
+		"query": query,
+		"script": map[string]interface{}{
+			"source": script.String(),
+			"params": fields,
+		},
+	}
+	_, err := c.do(ctx, http.MethodPost, "/"+c.Index(tenantID)+"/_update_by_query?conflicts=proceed", body, nil)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Search runs body against the tenant's index; a tenant without an index
+// has no results.
+func (c *Client) Search(ctx context.Context, tenantID string, body map[string]interface{}, out interface{}) error {
+	_, err := c.do(ctx, http.MethodPost, "/"+c.Index(tenantID)+"/_search?ignore_unavailable=true", body, out)
+	return err
+}
+
+// do sends the request and decodes the response into out. Error responses
+// are decoded into out as well, so callers can inspect them.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, out interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return 0, err
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(c.cfg.RetryBackoff * time.Duration(attempt)):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.address()+path, bytes.NewReader(payload))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		switch {
+		case c.cfg.APIKey != "":
+			req.Header.Set("Authorization", "ApiKey "+c.cfg.APIKey)
+		case c.cfg.Username != "":
+			req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if c.retryable(resp.StatusCode) {
+			lastErr = fmt.Errorf("elasticsearch %s %s: status %d", method, path, resp.StatusCode)
+			continue
+		}
+		if out != nil && len(data) > 0 {
+			if err := json.Unmarshal(data, out); err != nil && resp.StatusCode < 300 {
+				return resp.StatusCode, fmt.Errorf("decode elasticsearch response: %w", err)
+			}
+		}
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return resp.StatusCode, errNotFound
+		case resp.StatusCode >= 300:
+			return resp.StatusCode, fmt.Errorf("elasticsearch %s %s: status %d: %s", method, path, resp.StatusCode, truncate(data, 512))
+		}
+		return resp.StatusCode, nil
+	}
+	return 0, lastErr
+}
+
+func (c *Client) address() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	addr := c.cfg.Addresses[c.next%len(c.cfg.Addresses)]
+	c.next++
+	return strings.TrimRight(addr, "/")
+}
+
+func (c *Client) retryable(status int) bool {
+	for _, s := range c.cfg.RetryOnStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(data []byte, n int) string {
+	if len(data) > n {
+		return string(data[:n]) + "..."
+	}
+	return string(data)
+}
@@ -0,0 +1,250 @@
+package search
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/pkg/httpresponse"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// Query is a parsed search request.
+type Query struct {
+	Text   string
+	Types  []string
+	Limit  int
+	Offset int
+}
+
+// Hit is one search result.
+type Hit struct {
+	ID         string              `json:"id"`
+	Type       string              `json:"type"`
+	Title      string              `json:"title"`
+	Subtitle   string              `json:"subtitle,omitempty"`
+	Number     string              `json:"number,omitempty"`
+	Status     string              `json:"status,omitempty"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+	UpdatedAt  time.Time           `json:"updatedAt"`
+}
+
+// Result is the response of a search. Facets count the matches of every
+// type the caller may read, regardless of the types requested, so the UI
+// can show how many results each type tab would have.
+type Result struct {
+	Query  string           `json:"query"`
+	Total  int64            `json:"total"`
+	Hits   []Hit            `json:"results"`
+	Facets map[string]int64 `json:"facets"`
+}
+
+type Handler struct {
+	client *Client
+	logger *logger.Logger
+}
+
+func NewHandler(client *Client, log *logger.Logger) *Handler {
+	return &Handler{client: client, logger: log}
+}
+
+// ServeHTTP serves the unified search endpoint:
+//
+//	GET /api/v1/search?q=&type=client,invoice&limit=&offset=
+//
+// It runs behind the tenant middleware. Results are limited to the types the
+// caller holds "<type>:read" for; asking only for types the caller may not
+// read is forbidden.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.ErrorStatus(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query, err := parseQuery(r)
+	if err != nil {
+		httpresponse.ErrorStatus(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	readable := readableTypes(middleware.GetPermissions(r.Context()), nil)
+	if len(readable) == 0 {
+		httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission to read any searchable type")
+		return
+	}
+	selected := readable
+	if len(query.Types) > 0 {
+		if selected = readableTypes(middleware.GetPermissions(r.Context()), query.Types); len(selected) == 0 {
+			httpresponse.ErrorStatus(w, r, http.StatusForbidden, "missing permission to read the requested types")
+			return
+		}
+	}
+
+	var response searchResponse
+	if err := h.client.Search(r.Context(), middleware.GetTenantID(r.Context()), buildQuery(query, readable, selected), &response); err != nil {
+		h.logger.New(r.Context()).Errorw("Search failed", "error", err)
+		httpresponse.ErrorStatus(w, r, http.StatusBadGateway, "search is unavailable")
+		return
+	}
+	httpresponse.JSON(w, http.StatusOK, response.result(query.Text, readable))
+}
+
+func parseQuery(r *http.Request) (Query, error) {
+	values := r.URL.Query()
+	query := Query{
+		Text:  strings.TrimSpace(values.Get("q")),
+		Limit: defaultLimit,
+	}
+	if query.Text == "" {
+		return query, errors.New("q is required")
+	}
+	for _, t := range strings.Split(values.Get("type"), ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t == "" {
+			continue
+		}
+		if !contains(Types, t) {
+			return query, errors.New("type must be one of " + strings.Join(Types, ", "))
+		}
+		query.Types = append(query.Types, t)
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return query, errors.New("limit must be a positive number")
+		}
+		query.Limit = min(limit, maxLimit)
+	}
+	if v := values.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return query, errors.New("offset must not be negative")
+		}
+		query.Offset = offset
+	}
+	return query, nil
+}
+
+// buildQuery ranks exact identifier matches first, then title, keyword,
+// subtitle and body matches, with a small boost for recently updated
+// entities. readable scopes the query and its facets; selected, a subset,
+// scopes the hits.
+func buildQuery(query Query, readable, selected []string) map[string]interface{} {
+	match := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"number": map[string]interface{}{"value": query.Text, "boost": 10}}},
+				map[string]interface{}{"term": map[string]interface{}{"title.keyword": map[string]interface{}{"value": query.Text, "boost": 5}}},
+				map[string]interface{}{"multi_match": map[string]interface{}{
+					"query":     query.Text,
+					"fields":    []string{"title^3", "keywords^2", "subtitle^1.5", "body"},
+					"type":      "best_fields",
+					"fuzziness": "AUTO",
+				}},
+				map[string]interface{}{"multi_match": map[string]interface{}{
+					"query":  query.Text,
+					"fields": []string{"title^2", "subtitle"},
+					"type":   "phrase_prefix",
+				}},
+			},
+			"minimum_should_match": 1,
+			"filter": []interface{}{
+				map[string]interface{}{"terms": map[string]interface{}{"type": readable}},
+			},
+			// Documents only ever touched by update events have no
+			// deleted flag, so exclude deleted ones rather than require
+			// deleted: false.
+			"must_not": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"deleted": true}},
+			},
+		},
+	}
+
+	body := map[string]interface{}{
+		"from":             query.Offset,
+		"size":             query.Limit,
+		"track_total_hits": true,
+		"query": map[string]interface{}{
+			"function_score": map[string]interface{}{
+				"query": match,
+				"functions": []interface{}{
+					map[string]interface{}{"gauss": map[string]interface{}{
+						"updatedAt": map[string]interface{}{"origin": "now", "scale": "90d", "decay": 0.5},
+					}},
+				},
+				"boost_mode": "sum",
+			},
+		},
+		"aggs": map[string]interface{}{
+			"types": map[string]interface{}{"terms": map[string]interface{}{"field": "type", "size": len(Types)}},
+		},
+		"highlight": map[string]interface{}{
+			"fields": map[string]interface{}{"title": map[string]interface{}{}, "subtitle": map[string]interface{}{}, "body": map[string]interface{}{}},
+		},
+	}
+	if len(selected) < len(readable) {
+		body["post_filter"] = map[string]interface{}{"terms": map[string]interface{}{"type": selected}}
+	}
+	return body
+}
+
+type searchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			ID        string              `json:"_id"`
+			Score     float64             `json:"_score"`
+			Source    Document            `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations struct {
+		Types struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int64  `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"types"`
+	} `json:"aggregations"`
+}
+
+func (s *searchResponse) result(text string, readable []string) *Result {
+	result := &Result{
+		Query:  text,
+		Total:  s.Hits.Total.Value,
+		Hits:   make([]Hit, 0, len(s.Hits.Hits)),
+		Facets: make(map[string]int64, len(readable)),
+	}
+	for _, t := range readable {
+		result.Facets[t] = 0
+	}
+	for _, b := range s.Aggregations.Types.Buckets {
+		if _, ok := result.Facets[b.Key]; ok {
+			result.Facets[b.Key] = b.DocCount
+		}
+	}
+	for _, h := range s.Hits.Hits {
+		result.Hits = append(result.Hits, Hit{
+			ID:         h.Source.EntityID,
+			Type:       h.Source.Type,
+			Title:      h.Source.Title,
+			Subtitle:   h.Source.Subtitle,
+			Number:     h.Source.Number,
+			Status:     h.Source.Status,
+			Score:      h.Score,
+			Highlights: h.Highlight,
+			UpdatedAt:  h.Source.UpdatedAt,
+		})
+	}
+	return result
+}
@@ -0,0 +1,318 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// change is one write to the index an event causes.
+type change struct {
+	ID string
+	// Fields are merged into the document, which is created if needed.
+	Fields map[string]interface{}
+	// Delete removes the document instead.
+	Delete bool
+	// LookupClient fills the subtitle with this client's indexed name.
+	LookupClient string
+	// RenameClient sets the subtitle of the client's invoices and orders to
+	// the client's new title.
+	RenameClient bool
+}
+
+// Indexer applies domain events to the tenant indices. Every write is a
+// merge or a delete keyed by entity, so redelivered events are harmless.
+type Indexer struct {
+	client *Client
+	logger *logger.Logger
+}
+
+func NewIndexer(client *Client, log *logger.Logger) *Indexer {
+	return &Indexer{client: client, logger: log}
+}
+
+// HandleEvent indexes event. Events of types that are not searchable are
+// ignored.
+func (i *Indexer) HandleEvent(ctx context.Context, event *events.EventEnvelope) error {
+	if event.TenantID == "" {
+		return nil
+	}
+	for _, c := range changesFor(event) {
+		if err := i.apply(ctx, event.TenantID, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Indexer) apply(ctx context.Context, tenantID string, c change) error {
+	if c.Delete {
+		return i.client.Delete(ctx, tenantID, c.ID)
+	}
+
+	if c.LookupClient != "" {
+		client, err := i.client.Get(ctx, tenantID, documentID(TypeClient, c.LookupClient))
+		switch {
+		case err == nil:
+			c.Fields["subtitle"] = client.Title
+		case !errors.Is(err, errNotFound):
+			// The client name is a nicety; index without it.
+			i.logger.New(ctx).Warn("Failed to look up client name for search", "error", err, "client_id", c.LookupClient)
+		}
+	}
+
+	if err := i.client.Upsert(ctx, tenantID, c.ID, c.Fields); err != nil {
+		return err
+	}
+
+	if name, _ := c.Fields["title"].(string); c.RenameClient && name != "" {
+		entityID, _ := c.Fields["entityId"].(string)
+		query := map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"clientId": entityID}},
+					map[string]interface{}{"terms": map[string]interface{}{"type": []string{TypeInvoice, TypeOrder}}},
+				},
+			},
+		}
+		return i.client.UpdateByQuery(ctx, tenantID, query, map[string]interface{}{"subtitle": name})
+	}
+	return nil
+}
+
+// changesFor maps an event to index writes.
+func changesFor(event *events.EventEnvelope) []change {
+	data := event.Data
+	switch {
+	case event.AggregateType == "Client":
+		return clientChanges(event, data)
+	case strings.HasPrefix(event.Type, "invoice."):
+		return invoiceChanges(event, data)
+	case strings.HasPrefix(event.Type, "document."):
+		return documentChanges(event, data)
+	case strings.HasPrefix(event.Type, "product."):
+		return productChanges(event, data)
+	case strings.HasPrefix(event.Type, "order."):
+		return orderChanges(event, data)
+	}
+	return nil
+}
+
+func clientChanges(event *events.EventEnvelope, data map[string]interface{}) []change {
+	id := documentID(TypeClient, event.AggregateID)
+	switch event.Type {
+	case "ClientCreated":
+		fields := created(event, TypeClient)
+		set(fields, "title", str(data, "name"))
+		set(fields, "subtitle", str(data, "email"))
+		set(fields, "body", str(data, "phone"))
+		fields["keywords"] = strs(data, "tags")
+		fields["status"] = "active"
+		return []change{{ID: id, Fields: fields}}
+	case "ClientUpdated":
+		fields := updated(event, TypeClient)
+		set(fields, "title", str(data, "name"))
+		set(fields, "subtitle", str(data, "email"))
+		set(fields, "body", str(data, "phone"))
+		return []change{{ID: id, Fields: fields, RenameClient: true}}
+	case "ClientDeactivated":
+		fields := updated(event, TypeClient)
+		fields["status"] = "inactive"
+		return []change{{ID: id, Fields: fields}}
+	case "ClientDeleted":
+		return []change{{ID: id, Fields: deleted(event, TypeClient, true)}}
+	case "ClientRestored":
+		return []change{{ID: id, Fields: deleted(event, TypeClient, false)}}
+	case "ClientPurged":
+		return []change{{ID: id, Delete: true}}
+	case "ClientsMerged":
+		// The source client is gone; the target keeps its own document.
+		if source := str(data, "sourceClientId"); source != "" {
+			return []change{{ID: documentID(TypeClient, source), Delete: true}}
+		}
+	}
+	return nil
+}
+
+func invoiceChanges(event *events.EventEnvelope, data map[string]interface{}) []change {
+	id := documentID(TypeInvoice, event.AggregateID)
+	var fields map[string]interface{}
+	var lookup string
+	switch event.Type {
+	case "invoice.created":
+		fields = created(event, TypeInvoice)
+		set(fields, "title", str(data, "invoiceNumber"))
+		set(fields, "number", str(data, "invoiceNumber"))
+		set(fields, "clientId", str(data, "clientId"))
+		set(fields, "status", str(data, "status"))
+		set(fields, "body", str(data, "notes"))
+		lookup = str(data, "clientId")
+	case "invoice.finalized":
+		fields = updated(event, TypeInvoice)
+		fields["status"] = "pending"
+	case "invoice.sent":
+		fields = updated(event, TypeInvoice)
+		fields["status"] = "sent"
+	case "invoice.voided":
+		fields = updated(event, TypeInvoice)
+		fields["status"] = "cancelled"
+	case "invoice.paid":
+		fields = updated(event, TypeInvoice)
+		fields["status"] = "paid"
+	case "invoice.payment_recorded", "invoice.credit_applied", "invoice.credit_allocated":
+		fields = updated(event, TypeInvoice)
+		set(fields, "status", str(data, "status"))
+	default:
+		return nil
+	}
+	return []change{{ID: id, Fields: fields, LookupClient: lookup}}
+}
+
+func documentChanges(event *events.EventEnvelope, data map[string]interface{}) []change {
+	id := documentID(TypeDocument, event.AggregateID)
+	switch event.Type {
+	case "document.uploaded":
+		fields := created(event, TypeDocument)
+		set(fields, "title", str(data, "fileName"))
+		set(fields, "subtitle", str(data, "type"))
+		fields["keywords"] = strs(data, "tags")
+		return []change{{ID: id, Fields: fields}}
+	case "document.processing.completed":
+		// Extracted metadata makes scanned invoices findable by vendor and
+		// by the vendor's invoice number.
+		fields := updated(event, TypeDocument)
+		if metadata, ok := data["metadata"].(map[string]interface{}); ok {
+			set(fields, "body", strings.TrimSpace(str(metadata, "vendorName")+" "+str(metadata, "invoiceNumber")))
+		}
+		return []change{{ID: id, Fields: fields}}
+	case "document.updated":
+		fields := updated(event, TypeDocument)
+		fields["keywords"] = strs(data, "tags")
+		return []change{{ID: id, Fields: fields}}
+	case "document.deleted":
+		return []change{{ID: id, Fields: deleted(event, TypeDocument, true)}}
+	case "document.restored":
+		return []change{{ID: id, Fields: deleted(event, TypeDocument, false)}}
+	}
+	return nil
+}
+
+func productChanges(event *events.EventEnvelope, data map[string]interface{}) []change {
+	id := documentID(TypeProduct, event.AggregateID)
+	var fields map[string]interface{}
+	switch event.Type {
+	case "product.created":
+		fields = created(event, TypeProduct)
+	case "product.updated":
+		fields = updated(event, TypeProduct)
+	case "product.deleted":
+		return []change{{ID: id, Delete: true}}
+	default:
+		return nil
+	}
+	set(fields, "title", str(data, "name"))
+	set(fields, "number", str(data, "sku"))
+	set(fields, "body", str(data, "description"))
+	set(fields, "status", str(data, "status"))
+	if keywords := nonEmpty(str(data, "category"), str(data, "brand")); len(keywords) > 0 {
+		fields["keywords"] = keywords
+	}
+	return []change{{ID: id, Fields: fields}}
+}
+
+func orderChanges(event *events.EventEnvelope, data map[string]interface{}) []change {
+	id := documentID(TypeOrder, event.AggregateID)
+	var fields map[string]interface{}
+	var lookup string
+	switch event.Type {
+	case "order.created":
+		fields = created(event, TypeOrder)
+		set(fields, "clientId", str(data, "clientId"))
+		lookup = str(data, "clientId")
+	case "order.updated":
+		fields = updated(event, TypeOrder)
+	case "order.cancelled":
+		fields = updated(event, TypeOrder)
+		fields["status"] = "cancelled"
+		return []change{{ID: id, Fields: fields}}
+	case "order.deleted":
+		return []change{{ID: id, Delete: true}}
+	default:
+		return nil
+	}
+	set(fields, "title", str(data, "orderNumber"))
+	set(fields, "number", str(data, "orderNumber"))
+	set(fields, "status", str(data, "status"))
+	set(fields, "body", str(data, "notes"))
+	return []change{{ID: id, Fields: fields, LookupClient: lookup}}
+}
+
+func updated(event *events.EventEnvelope, entityType string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      entityType,
+		"entityId":  event.AggregateID,
+		"updatedAt": timestamp(event),
+	}
+}
+
+func created(event *events.EventEnvelope, entityType string) map[string]interface{} {
+	fields := updated(event, entityType)
+	fields["createdAt"] = timestamp(event)
+	fields["deleted"] = false
+	return fields
+}
+
+func deleted(event *events.EventEnvelope, entityType string, deleted bool) map[string]interface{} {
+	fields := updated(event, entityType)
+	fields["deleted"] = deleted
+	return fields
+}
+
+func timestamp(event *events.EventEnvelope) time.Time {
+	if event.Timestamp.IsZero() {
+		return time.Now().UTC()
+	}
+	return event.Timestamp
+}
+
+// set only merges non-empty values, so partial events keep earlier values.
+func set(fields map[string]interface{}, key, value string) {
+	if value != "" {
+		fields[key] = value
+	}
+}
+
+func str(data map[string]interface{}, key string) string {
+	v, _ := data[key].(string)
+	return v
+}
+
+func strs(data map[string]interface{}, key string) []string {
+	switch v := data[key].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return []string{}
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
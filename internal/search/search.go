@@ -0,0 +1,74 @@
+// Package search keeps a per-tenant Elasticsearch index of clients,
+// products, invoices, orders and documents, fed from domain events, and
+// serves the unified search endpoint over it.
+package search
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ims-erp/system/internal/rbac"
+)
+
+// Searchable entity types. Each one is only returned to callers holding its
+// "<type>:read" permission.
+const (
+	TypeClient   = "client"
+	TypeProduct  = "product"
+	TypeInvoice  = "invoice"
+	TypeOrder    = "order"
+	TypeDocument = "document"
+)
+
+// Types lists every searchable type, in the order facets are reported.
+var Types = []string{TypeClient, TypeProduct, TypeInvoice, TypeOrder, TypeDocument}
+
+// Document is what is indexed for an entity. Title is what users search by
+// first; Number holds identifiers such as invoice numbers and SKUs, which
+// match exactly and rank highest.
+type Document struct {
+	Type      string    `json:"type"`
+	EntityID  string    `json:"entityId"`
+	Title     string    `json:"title,omitempty"`
+	Subtitle  string    `json:"subtitle,omitempty"`
+	Number    string    `json:"number,omitempty"`
+	Body      string    `json:"body,omitempty"`
+	Keywords  []string  `json:"keywords,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	ClientID  string    `json:"clientId,omitempty"`
+	Deleted   bool      `json:"deleted"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// documentID is the index ID of an entity; IDs are only unique per type.
+func documentID(entityType, entityID string) string {
+	return entityType + ":" + entityID
+}
+
+// readableTypes returns the types in requested, or all types when requested
+// is empty, that permissions allow reading.
+func readableTypes(permissions []string, requested []string) []string {
+	if len(requested) == 0 {
+		requested = Types
+	}
+	var types []string
+	for _, t := range Types {
+		if !contains(requested, t) {
+			continue
+		}
+		if rbac.Allows(permissions, t+":read") {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadableTypes(t *testing.T) {
+	assert.Equal(t, Types, readableTypes([]string{"*"}, nil))
+	assert.Equal(t, []string{TypeClient, TypeInvoice}, readableTypes([]string{"client:read", "invoice:*", "payment:read"}, nil))
+	assert.Equal(t, []string{TypeInvoice}, readableTypes([]string{"client:read", "invoice:read"}, []string{"invoice", "order"}))
+	assert.Empty(t, readableTypes([]string{"client:write"}, nil))
+}
+
+func TestChangesForClient(t *testing.T) {
+	created := events.NewEvent("client-1", "Client", "ClientCreated", "tenant-1", "user-1", map[string]interface{}{
+		"name":  "Acme Ltd",
+		"email": "billing@acme.test",
+		"tags":  []interface{}{"wholesale"},
+	})
+	changes := changesFor(created)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "client:client-1", changes[0].ID)
+	assert.Equal(t, "Acme Ltd", changes[0].Fields["title"])
+	assert.Equal(t, "billing@acme.test", changes[0].Fields["subtitle"])
+	assert.Equal(t, []string{"wholesale"}, changes[0].Fields["keywords"])
+	assert.Equal(t, false, changes[0].Fields["deleted"])
+
+	updated := events.NewEvent("client-1", "Client", "ClientUpdated", "tenant-1", "user-1", map[string]interface{}{"name": "Acme Group"})
+	changes = changesFor(updated)
+	require.Len(t, changes, 1)
+	assert.True(t, changes[0].RenameClient)
+	assert.NotContains(t, changes[0].Fields, "subtitle")
+
+	merged := events.NewEvent("client-2", "Client", "ClientsMerged", "tenant-1", "user-1", map[string]interface{}{
+		"sourceClientId": "client-1",
+		"targetClientId": "client-2",
+	})
+	assert.Equal(t, []change{{ID: "client:client-1", Delete: true}}, changesFor(merged))
+}
+
+func TestChangesForInvoice(t *testing.T) {
+	created := events.NewEvent("invoice-1", "invoice", "invoice.created", "tenant-1", "user-1", map[string]interface{}{
+		"invoiceNumber": "INV-2026-0001",
+		"clientId":      "client-1",
+		"status":        "draft",
+	})
+	changes := changesFor(created)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "invoice:invoice-1", changes[0].ID)
+	assert.Equal(t, "INV-2026-0001", changes[0].Fields["number"])
+	assert.Equal(t, "client-1", changes[0].LookupClient)
+
+	voided := events.NewEvent("invoice-1", "invoice", "invoice.voided", "tenant-1", "user-1", nil)
+	changes = changesFor(voided)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "cancelled", changes[0].Fields["status"])
+
+	assert.Empty(t, changesFor(events.NewEvent("payment-1", "payment", "payment.created", "tenant-1", "user-1", nil)))
+}
+
+func TestParseQuery(t *testing.T) {
+	query, err := parseQuery(httptest.NewRequest("GET", "/api/v1/search?q=+acme+&type=Client,invoice&limit=500&offset=20", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", query.Text)
+	assert.Equal(t, []string{"client", "invoice"}, query.Types)
+	assert.Equal(t, maxLimit, query.Limit)
+	assert.Equal(t, 20, query.Offset)
+
+	_, err = parseQuery(httptest.NewRequest("GET", "/api/v1/search?q=acme&type=payment", nil))
+	assert.Error(t, err)
+	_, err = parseQuery(httptest.NewRequest("GET", "/api/v1/search?q=", nil))
+	assert.Error(t, err)
+}
+
+func TestBuildQueryFiltersHitsNotFacets(t *testing.T) {
+	readable := []string{TypeClient, TypeInvoice}
+
+	body := buildQuery(Query{Text: "acme", Limit: 20}, readable, readable)
+	assert.NotContains(t, body, "post_filter")
+
+	body = buildQuery(Query{Text: "acme", Limit: 20}, readable, []string{TypeInvoice})
+	assert.Equal(t, map[string]interface{}{"terms": map[string]interface{}{"type": []string{TypeInvoice}}}, body["post_filter"])
+}
@@ -0,0 +1,110 @@
+// Package signing verifies the signatures signers make on documents sent
+// for signature, and seals completed envelopes into a signed PDF with an
+// audit certificate page.
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+)
+
+var (
+	// ErrInvalidCertificate is returned for certificates that cannot be
+	// read, or are not valid at the time of signing.
+	ErrInvalidCertificate = errors.New("signing: invalid certificate")
+	// ErrUntrustedCertificate is returned for certificates that do not
+	// chain to a trusted root.
+	ErrUntrustedCertificate = errors.New("signing: certificate is not issued by a trusted authority")
+	// ErrSignatureMismatch is returned for signatures that are not the
+	// certificate's signature of the document.
+	ErrSignatureMismatch = errors.New("signing: signature does not match the document and certificate")
+)
+
+// VerifyCertificate checks that signature is the SHA-256 signature of
+// document by the key of the first certificate in certPEM, as made by
+// "openssl dgst -sha256 -sign key.pem document". Further certificates in
+// certPEM are taken as intermediates. With roots, the certificate must
+// chain to one of them at the time of signing.
+func VerifyCertificate(certPEM string, signature, document []byte, roots *x509.CertPool, at time.Time) (*domain.CertificateInfo, error) {
+	var chain []*x509.Certificate
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: no PEM certificate", ErrInvalidCertificate)
+	}
+	leaf := chain[0]
+	if at.Before(leaf.NotBefore) || at.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("%w: not valid on %s", ErrInvalidCertificate, at.Format(time.RFC3339))
+	}
+
+	if roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   at,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUntrustedCertificate, err)
+		}
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch leaf.PublicKey.(type) {
+	case *rsa.PublicKey:
+		algorithm = x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		algorithm = x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		algorithm = x509.PureEd25519
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type", ErrInvalidCertificate)
+	}
+	if err := leaf.CheckSignature(algorithm, document, signature); err != nil {
+		return nil, ErrSignatureMismatch
+	}
+
+	fingerprint := sha256.Sum256(leaf.Raw)
+	return &domain.CertificateInfo{
+		Subject:      leaf.Subject.String(),
+		Issuer:       leaf.Issuer.String(),
+		SerialNumber: leaf.SerialNumber.Text(16),
+		Fingerprint:  hex.EncodeToString(fingerprint[:]),
+		NotBefore:    leaf.NotBefore,
+		NotAfter:     leaf.NotAfter,
+		Signature:    signature,
+	}, nil
+}
+
+// Checksum returns the hex SHA-256 checksum envelopes bind documents by.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
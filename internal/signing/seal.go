@@ -0,0 +1,255 @@
+package signing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/pkg/pdf"
+)
+
+// ErrDocumentChanged is returned when sealing a document whose content is
+// no longer what its envelope was signed for.
+var ErrDocumentChanged = errors.New("signing: document has changed since it was sent for signature")
+
+// Layout of the signed PDF, in points.
+const (
+	marginLeft   = 50.0
+	marginRight  = pdf.PageWidth - 50
+	marginTop    = pdf.PageHeight - 50
+	marginBottom = 60.0
+	lineHeight   = 14.0
+
+	// Signatures are drawn at their field's proportions, fitted into
+	// boxes of at most this size.
+	signatureWidth  = 220.0
+	signatureHeight = 80.0
+	columnSigned    = marginLeft + signatureWidth + 20
+
+	timeLayout = "2006-01-02 15:04:05 UTC"
+)
+
+// sealDocument lays out the signed PDF of an envelope top to bottom,
+// starting a new page when the next row does not fit.
+type sealDocument struct {
+	doc      *pdf.Document
+	page     *pdf.Page
+	y        float64
+	envelope *domain.Envelope
+}
+
+// Seal returns the signed PDF of a completed envelope: its signatures, one
+// box per signature field, followed by an audit certificate page of who
+// signed when and from where. The original document is embedded unchanged
+// as an attachment, its SHA-256 checksum printed on the certificate, so
+// the PDF is sealed to the exact file that was signed.
+func Seal(envelope *domain.Envelope, original []byte) ([]byte, error) {
+	if envelope.Status != domain.EnvelopeCompleted {
+		return nil, domain.ErrEnvelopeNotCompleted
+	}
+	if Checksum(original) != envelope.DocumentChecksum {
+		return nil, ErrDocumentChanged
+	}
+
+	d := &sealDocument{doc: pdf.New(), envelope: envelope}
+	d.newPage()
+	d.header()
+	d.signatures()
+	d.certificate()
+
+	name := envelope.DocumentName
+	if name == "" {
+		name = "document"
+	}
+	d.doc.Attach(name, "Original document, SHA-256 "+envelope.DocumentChecksum, original)
+
+	var buf bytes.Buffer
+	if _, err := d.doc.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *sealDocument) newPage() {
+	d.page = d.doc.AddPage()
+	d.y = marginTop
+}
+
+// ensure starts a new page unless height fits above the bottom margin.
+func (d *sealDocument) ensure(height float64) {
+	if d.y-height < marginBottom {
+		d.newPage()
+	}
+}
+
+func (d *sealDocument) text(x, size float64, bold bool, text string) {
+	d.page.Text(x, d.y, size, bold, pdf.Fit(text, size, marginRight-x))
+}
+
+func (d *sealDocument) header() {
+	e := d.envelope
+	d.text(marginLeft, 16, true, e.Title)
+	d.y -= 22
+	d.text(marginLeft, 10, false, "Document: "+e.DocumentName)
+	d.y -= lineHeight
+	d.text(marginLeft, 10, false, "Envelope: "+e.ID.String())
+	d.y -= lineHeight
+	if e.CompletedAt != nil {
+		d.text(marginLeft, 10, false, "Completed: "+e.CompletedAt.UTC().Format(timeLayout))
+		d.y -= lineHeight
+	}
+	d.y -= 6
+	d.page.Line(marginLeft, d.y, marginRight, d.y)
+	d.y -= 24
+}
+
+func (d *sealDocument) signatures() {
+	fields := make(map[uuid.UUID]domain.SignatureField, len(d.envelope.Fields))
+	for _, field := range d.envelope.Fields {
+		fields[field.ID] = field
+	}
+	for _, signer := range d.envelope.Signers {
+		d.ensure(lineHeight * 2)
+		d.text(marginLeft, 11, true, fmt.Sprintf("%s <%s>", signer.Name, signer.Email))
+		d.y -= lineHeight + 4
+		for _, signature := range d.envelope.Signatures {
+			if signature.SignerID == signer.ID {
+				d.signature(signer, fields[signature.FieldID], signature)
+			}
+		}
+		d.y -= 8
+	}
+}
+
+// signature draws one signature in a box at its field's proportions, with
+// who signed it and when beside it.
+func (d *sealDocument) signature(signer domain.Signer, field domain.SignatureField, signature domain.Signature) {
+	scale := math.Min(signatureWidth/field.Width, signatureHeight/field.Height)
+	width, height := field.Width*scale, field.Height*scale
+
+	d.ensure(height + lineHeight + 12)
+	label := field.Label
+	if label == "" {
+		label = "Signature"
+	}
+	d.text(marginLeft, 9, false, fmt.Sprintf("%s (page %d)", label, field.Page))
+	d.y -= 6
+
+	top := d.y
+	bottom := top - height
+	d.page.Rect(marginLeft, bottom, width, height)
+	switch signature.Method {
+	case domain.SignatureDrawn:
+		for _, stroke := range signature.Strokes {
+			points := make([][2]float64, len(stroke))
+			for i, point := range stroke {
+				points[i] = [2]float64{marginLeft + point[0]*width, top - point[1]*height}
+			}
+			d.page.Polyline(1.2, points)
+		}
+	case domain.SignatureCertificate:
+		if cert := signature.Certificate; cert != nil {
+			lines := []string{commonName(cert.Subject), "Serial " + cert.SerialNumber, "SHA-256 " + cert.Fingerprint}
+			d.page.Text(marginLeft+6, top-14, 9, true, "Digitally signed")
+			for i, line := range lines {
+				d.page.Text(marginLeft+6, top-26-float64(i)*11, 8, false, pdf.Fit(line, 8, width-12))
+			}
+		}
+	}
+
+	beside := []string{
+		"Signed by " + signer.Name,
+		signer.Email,
+		signature.SignedAt.UTC().Format(timeLayout),
+		"Method: " + string(signature.Method),
+	}
+	for i, line := range beside {
+		d.page.Text(columnSigned, top-10-float64(i)*12, 9, false, pdf.Fit(line, 9, marginRight-columnSigned))
+	}
+	d.y = math.Min(bottom, top-10-float64(len(beside))*12) - 16
+}
+
+// certificate writes the audit certificate: the document signed, each
+// signer's outcome and the envelope's audit trail.
+func (d *sealDocument) certificate() {
+	e := d.envelope
+	d.newPage()
+	d.text(marginLeft, 16, true, "Certificate of Completion")
+	d.y -= 24
+
+	rows := [][2]string{
+		{"Envelope", e.ID.String()},
+		{"Title", e.Title},
+		{"Document", e.DocumentName},
+		{"Document SHA-256", e.DocumentChecksum},
+		{"Sent by", e.CreatedBy},
+		{"Created", e.CreatedAt.UTC().Format(timeLayout)},
+	}
+	if e.CompletedAt != nil {
+		rows = append(rows, [2]string{"Completed", e.CompletedAt.UTC().Format(timeLayout)})
+	}
+	for _, row := range rows {
+		d.page.Text(marginLeft, d.y, 9, true, row[0])
+		d.page.Text(marginLeft+100, d.y, 9, false, pdf.Fit(row[1], 9, marginRight-marginLeft-100))
+		d.y -= lineHeight
+	}
+
+	d.y -= 12
+	d.section("Signers")
+	for _, signer := range e.Signers {
+		d.ensure(lineHeight * 2)
+		d.page.Text(marginLeft, d.y, 9, true, pdf.Fit(signer.Name, 9, 150))
+		d.page.Text(marginLeft+160, d.y, 9, false, pdf.Fit(signer.Email, 9, 180))
+		d.page.Text(marginLeft+350, d.y, 9, false, string(signer.Status))
+		d.y -= lineHeight - 2
+		var details []string
+		if signer.InvitedAt != nil {
+			details = append(details, "invited "+signer.InvitedAt.UTC().Format(timeLayout))
+		}
+		if signer.SignedAt != nil {
+			details = append(details, "signed "+signer.SignedAt.UTC().Format(timeLayout))
+		}
+		d.page.Text(marginLeft+160, d.y, 8, false, pdf.Fit(strings.Join(details, ", "), 8, marginRight-marginLeft-160))
+		d.y -= lineHeight
+	}
+
+	d.y -= 12
+	d.section("Audit trail")
+	for _, event := range e.Audit {
+		d.ensure(lineHeight)
+		d.page.Text(marginLeft, d.y, 8, false, event.At.UTC().Format(timeLayout))
+		d.page.Text(marginLeft+110, d.y, 8, true, event.Action)
+		d.page.Text(marginLeft+175, d.y, 8, false, pdf.Fit(event.Actor, 8, 150))
+		d.page.Text(marginLeft+330, d.y, 8, false, pdf.Fit(event.IP, 8, 70))
+		d.page.Text(marginLeft+405, d.y, 8, false, pdf.Fit(event.Detail, 8, marginRight-marginLeft-405))
+		d.y -= lineHeight - 2
+	}
+
+	d.y -= 16
+	d.ensure(lineHeight * 2)
+	d.text(marginLeft, 8, false, "The signed document is attached to this PDF unchanged. Its SHA-256 checksum above")
+	d.y -= 11
+	d.text(marginLeft, 8, false, "identifies the exact file that every signature in this envelope applies to.")
+}
+
+func (d *sealDocument) section(title string) {
+	d.ensure(lineHeight * 3)
+	d.text(marginLeft, 11, true, title)
+	d.y -= 6
+	d.page.Line(marginLeft, d.y, marginRight, d.y)
+	d.y -= lineHeight
+}
+
+// commonName returns the CN of an X.509 distinguished name, or the name.
+func commonName(dn string) string {
+	for _, part := range strings.Split(dn, ",") {
+		if strings.HasPrefix(part, "CN=") {
+			return strings.TrimPrefix(part, "CN=")
+		}
+	}
+	return dn
+}
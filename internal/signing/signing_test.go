@@ -0,0 +1,119 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var document = []byte("%PDF-1.4 master services agreement")
+
+func selfSigned(t *testing.T, key crypto.Signer, name string, notAfter time.Time) (string, *x509.Certificate) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(4711),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"Globex"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), cert
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	certPEM, cert := selfSigned(t, key, "Jane Roe", time.Now().Add(24*time.Hour))
+	digest := sha256.Sum256(document)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	info, err := VerifyCertificate(certPEM, signature, document, nil, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "CN=Jane Roe,O=Globex", info.Subject)
+	assert.Equal(t, "1267", info.SerialNumber)
+	assert.Len(t, info.Fingerprint, 64)
+	assert.Equal(t, signature, info.Signature)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	_, err = VerifyCertificate(certPEM, signature, document, roots, time.Now())
+	assert.NoError(t, err, "self-signed certificate is its own trusted root")
+
+	_, err = VerifyCertificate(certPEM, signature, []byte("another document"), nil, time.Now())
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+	_, err = VerifyCertificate(certPEM, signature, document, nil, time.Now().Add(48*time.Hour))
+	assert.ErrorIs(t, err, ErrInvalidCertificate, "expired at the time of signing")
+	_, err = VerifyCertificate(certPEM, signature, document, x509.NewCertPool(), time.Now())
+	assert.ErrorIs(t, err, ErrUntrustedCertificate)
+	_, err = VerifyCertificate("not a certificate", signature, document, nil, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidCertificate)
+}
+
+func TestVerifyCertificate_RSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	certPEM, _ := selfSigned(t, key, "John Doe", time.Now().Add(time.Hour))
+	digest := sha256.Sum256(document)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	_, err = VerifyCertificate(certPEM, signature, document, nil, time.Now())
+	assert.NoError(t, err)
+}
+
+func TestSeal(t *testing.T) {
+	envelope := domain.NewEnvelope(uuid.New(), uuid.New(), "msa.pdf", Checksum(document), "Master services agreement", "", "user-1")
+	signerID, err := envelope.AddSigner("Jane Roe", "jane@example.com")
+	require.NoError(t, err)
+	require.NoError(t, envelope.AddField(signerID, "Customer", 3, 350, 120, 180, 50))
+	tokens, err := envelope.Send("user-1", time.Hour)
+	require.NoError(t, err)
+	signer := envelope.SignerByToken(tokens[signerID])
+	require.NotNil(t, signer)
+
+	_, err = Seal(envelope, document)
+	assert.ErrorIs(t, err, domain.ErrEnvelopeNotCompleted)
+
+	require.NoError(t, envelope.Sign(signer.ID, []domain.Signature{{
+		FieldID: envelope.Fields[0].ID,
+		Method:  domain.SignatureDrawn,
+		Strokes: []domain.Stroke{{{0.1, 0.8}, {0.3, 0.2}, {0.5, 0.7}}},
+	}}, "203.0.113.9"))
+	require.Equal(t, domain.EnvelopeCompleted, envelope.Status)
+
+	_, err = Seal(envelope, []byte("%PDF-1.4 edited agreement"))
+	assert.ErrorIs(t, err, ErrDocumentChanged)
+
+	sealed, err := Seal(envelope, document)
+	require.NoError(t, err)
+	out := string(sealed)
+	assert.True(t, strings.HasPrefix(out, "%PDF-1.4\n"))
+	assert.Contains(t, out, "(Certificate of Completion) Tj")
+	assert.Contains(t, out, "("+Checksum(document)+") Tj")
+	assert.Contains(t, out, "(203.0.113.9) Tj")
+	assert.Contains(t, out, "(Customer \\(page 3\\)) Tj")
+	assert.Contains(t, out, "/EmbeddedFiles << /Names [(msa.pdf)")
+	assert.Contains(t, out, "stream\n"+string(document)+"\nendstream", "the original is embedded unchanged")
+}
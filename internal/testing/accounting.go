@@ -0,0 +1,99 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+)
+
+// RevenueSchedules implements commands.RevenueScheduleRepository. Like the
+// Mongo store it keeps one schedule per invoice line.
+type RevenueSchedules struct {
+	rows table[domain.RevenueSchedule]
+}
+
+func NewRevenueSchedules() *RevenueSchedules {
+	return &RevenueSchedules{}
+}
+
+func (r *RevenueSchedules) Create(ctx context.Context, schedule *domain.RevenueSchedule) error {
+	if _, ok := r.rows.first(func(s *domain.RevenueSchedule) bool {
+		return s.TenantID == schedule.TenantID && s.InvoiceLineID == schedule.InvoiceLineID
+	}); ok {
+		return fmt.Errorf("%w: invoice line %s already has a revenue schedule", repository.ErrConcurrencyConflict, schedule.InvoiceLineID)
+	}
+	if !r.rows.insert(schedule.ID, schedule) {
+		return fmt.Errorf("failed to create revenue schedule: %s already exists", schedule.ID)
+	}
+	return nil
+}
+
+func (r *RevenueSchedules) FindByID(ctx context.Context, id uuid.UUID) (*domain.RevenueSchedule, error) {
+	if schedule, ok := r.rows.get(id); ok {
+		return schedule, nil
+	}
+	return nil, fmt.Errorf("revenue schedule not found: %s", id)
+}
+
+func (r *RevenueSchedules) FindByInvoice(ctx context.Context, tenantID, invoiceID uuid.UUID) ([]*domain.RevenueSchedule, error) {
+	return r.rows.find(func(s *domain.RevenueSchedule) bool {
+		return s.TenantID == tenantID && s.InvoiceID == invoiceID
+	}), nil
+}
+
+// Update saves schedule if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *RevenueSchedules) Update(ctx context.Context, schedule *domain.RevenueSchedule) error {
+	next := *schedule
+	next.Entries = append([]domain.RecognitionEntry(nil), schedule.Entries...)
+	next.Version++
+	if !r.rows.replace(schedule.ID, &next, func(stored *domain.RevenueSchedule) bool { return stored.Version == schedule.Version }) {
+		return fmt.Errorf("%w: revenue schedule %s at version %d", repository.ErrConcurrencyConflict, schedule.ID, schedule.Version)
+	}
+	schedule.Version++
+	return nil
+}
+
+func (r *RevenueSchedules) EachActive(ctx context.Context, fn func(*domain.RevenueSchedule) error) error {
+	for _, schedule := range r.rows.find(func(s *domain.RevenueSchedule) bool { return s.Status == domain.RevenueScheduleActive }) {
+		if err := fn(schedule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TaxReturns implements commands.TaxReturnRepository. Like the Mongo store
+// it keeps one return per period.
+type TaxReturns struct {
+	rows table[domain.TaxReturn]
+}
+
+func NewTaxReturns() *TaxReturns {
+	return &TaxReturns{}
+}
+
+func (r *TaxReturns) Create(ctx context.Context, taxReturn *domain.TaxReturn) error {
+	if _, ok := r.rows.first(func(t *domain.TaxReturn) bool {
+		return t.TenantID == taxReturn.TenantID && t.Period == taxReturn.Period
+	}); ok {
+		return fmt.Errorf("%w: VAT return for %s already filed", repository.ErrConcurrencyConflict, taxReturn.Period)
+	}
+	if !r.rows.insert(taxReturn.ID, taxReturn) {
+		return fmt.Errorf("failed to create tax return: %s already exists", taxReturn.ID)
+	}
+	return nil
+}
+
+// FindOverlapping returns a return of the tenant filed for a period that
+// overlaps [from, to), or nil when there is none.
+func (r *TaxReturns) FindOverlapping(ctx context.Context, tenantID uuid.UUID, from, to time.Time) (*domain.TaxReturn, error) {
+	taxReturn, _ := r.rows.first(func(t *domain.TaxReturn) bool {
+		return t.TenantID == tenantID && t.From.Before(to) && t.To.After(from)
+	})
+	return taxReturn, nil
+}
@@ -0,0 +1,304 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+)
+
+// Documents implements domain.DocumentRepository and
+// commands.ProofOfDeliveryReader. List pages by Page and PageSize and
+// ignores Cursor.
+type Documents struct {
+	rows table[domain.Document]
+}
+
+func NewDocuments() *Documents {
+	return &Documents{}
+}
+
+func (r *Documents) Create(ctx context.Context, doc *domain.Document) error {
+	if !r.rows.insert(doc.ID, doc) {
+		return fmt.Errorf("failed to create document: %s already exists", doc.ID)
+	}
+	return nil
+}
+
+func (r *Documents) GetByID(ctx context.Context, tenantID, id uuid.UUID) (*domain.Document, error) {
+	if doc, ok := r.rows.get(id); ok && doc.TenantID == tenantID && !doc.IsDeleted() {
+		return doc, nil
+	}
+	return nil, notFound("document", id)
+}
+
+// Update saves doc if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *Documents) Update(ctx context.Context, doc *domain.Document) error {
+	next := *doc
+	next.Version++
+	if !r.rows.replace(doc.ID, &next, func(stored *domain.Document) bool {
+		return stored.TenantID == doc.TenantID && stored.Version == doc.Version
+	}) {
+		return repository.ErrConcurrencyConflict
+	}
+	doc.Version++
+	return nil
+}
+
+func (r *Documents) SoftDelete(ctx context.Context, tenantID, id uuid.UUID, deletedBy string) error {
+	changed := r.rows.update(func(doc *domain.Document) bool {
+		return doc.ID == id && doc.TenantID == tenantID && !doc.IsDeleted()
+	}, func(doc *domain.Document) {
+		doc.MarkDeleted(deletedBy, time.Now())
+		doc.UpdatedAt = *doc.DeletedAt
+		doc.Version++
+	})
+	if changed == 0 {
+		return domain.ErrDocumentNotFound
+	}
+	return nil
+}
+
+func (r *Documents) Restore(ctx context.Context, tenantID, id uuid.UUID) (*domain.Document, error) {
+	changed := r.rows.update(func(doc *domain.Document) bool {
+		return doc.ID == id && doc.TenantID == tenantID && doc.IsDeleted()
+	}, func(doc *domain.Document) {
+		doc.SoftDelete.Restore()
+		doc.UpdatedAt = time.Now().UTC()
+		doc.Version++
+	})
+	if changed == 0 {
+		return nil, domain.ErrDocumentNotFound
+	}
+	doc, _ := r.rows.get(id)
+	return doc, nil
+}
+
+func (r *Documents) Delete(ctx context.Context, tenantID, id uuid.UUID) error {
+	if doc, ok := r.rows.get(id); ok && doc.TenantID == tenantID {
+		r.rows.remove(id)
+	}
+	return nil
+}
+
+// List returns a page of the tenant's documents, newest first, or most
+// recently deleted first when listing the trash.
+func (r *Documents) List(ctx context.Context, filter domain.DocumentFilter) (*domain.DocumentPage, error) {
+	docs := r.rows.find(func(doc *domain.Document) bool {
+		return doc.TenantID == filter.TenantID && doc.IsDeleted() == filter.Deleted &&
+			(filter.Type == "" || doc.Type == filter.Type) &&
+			(filter.Status == "" || doc.ProcessingStatus == filter.Status) &&
+			(filter.EntityType == "" || doc.EntityType == filter.EntityType) &&
+			(filter.EntityID == "" || doc.EntityID == filter.EntityID)
+	})
+	sort.SliceStable(docs, func(i, j int) bool {
+		if filter.Deleted {
+			return docs[i].DeletedAt.After(*docs[j].DeletedAt)
+		}
+		return docs[i].CreatedAt.After(docs[j].CreatedAt)
+	})
+
+	result := &domain.DocumentPage{Documents: []domain.Document{}, Total: int64(len(docs))}
+	for _, doc := range page(docs, filter.PageSize, max(filter.Page-1, 0)*filter.PageSize) {
+		result.Documents = append(result.Documents, *doc)
+	}
+	return result, nil
+}
+
+func (r *Documents) GetByChecksum(ctx context.Context, tenantID uuid.UUID, checksum string) (*domain.Document, error) {
+	if doc, ok := r.rows.first(func(doc *domain.Document) bool {
+		return doc.TenantID == tenantID && doc.Checksum == checksum && !doc.IsDeleted()
+	}); ok {
+		return doc, nil
+	}
+	return nil, notFound("document with checksum", checksum)
+}
+
+// Storage implements domain.StorageService with objects kept in memory.
+// Presigned URLs point at storage.test.
+type Storage struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+func NewStorage() *Storage {
+	return &Storage{buckets: make(map[string]map[string][]byte)}
+}
+
+func (s *Storage) Upload(ctx context.Context, bucket, objectKey string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string][]byte)
+	}
+	s.buckets[bucket][objectKey] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *Storage) Download(ctx context.Context, bucket, objectKey string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.buckets[bucket][objectKey]
+	if !ok {
+		return nil, fmt.Errorf("object not found: %s/%s", bucket, objectKey)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// DownloadStream returns a reader of a copy of the object, which seeks.
+func (s *Storage) DownloadStream(ctx context.Context, bucket, objectKey string) (io.ReadCloser, error) {
+	data, err := s.Download(ctx, bucket, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	return objectReader{bytes.NewReader(data)}, nil
+}
+
+// objectReader closes a bytes.Reader, keeping its Seek.
+type objectReader struct {
+	*bytes.Reader
+}
+
+func (objectReader) Close() error {
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, bucket, objectKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[bucket], objectKey)
+	return nil
+}
+
+func (s *Storage) GetPresignedUploadURL(ctx context.Context, bucket, objectKey string, contentType string, size int64, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("https://storage.test/%s/%s?upload", bucket, objectKey), nil
+}
+
+func (s *Storage) GetPresignedDownloadURL(ctx context.Context, bucket, objectKey string, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("https://storage.test/%s/%s", bucket, objectKey), nil
+}
+
+func (s *Storage) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.buckets[bucket]
+	return ok, nil
+}
+
+func (s *Storage) CreateBucket(ctx context.Context, bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string][]byte)
+	}
+	return nil
+}
+
+// Object returns a stored object, or nil.
+func (s *Storage) Object(bucket, objectKey string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buckets[bucket][objectKey]
+}
+
+// Processing implements domain.ProcessingService. It reads documents as
+// plain text, marks them completed and extracts no metadata.
+type Processing struct{}
+
+func NewProcessing() *Processing {
+	return &Processing{}
+}
+
+func (p *Processing) ProcessDocument(ctx context.Context, doc *domain.Document, data []byte) (*domain.Document, error) {
+	processed := *doc
+	processed.ExtractedText = string(data)
+	processed.ProcessingStatus = domain.ProcessingStatusCompleted
+	return &processed, nil
+}
+
+func (p *Processing) ExtractText(ctx context.Context, data []byte, mimeType string) (string, error) {
+	return string(data), nil
+}
+
+func (p *Processing) ExtractMetadata(ctx context.Context, docType domain.DocumentType, text string) domain.DocumentMetadata {
+	return domain.DocumentMetadata{}
+}
+
+func (p *Processing) GenerateThumbnail(ctx context.Context, data []byte, mimeType string) ([]byte, error) {
+	return nil, nil
+}
+
+// Search implements domain.SearchService over the indexed documents'
+// file names and extracted text, matched case-insensitively.
+type Search struct {
+	mu   sync.Mutex
+	docs map[uuid.UUID]domain.Document
+}
+
+func NewSearch() *Search {
+	return &Search{docs: make(map[uuid.UUID]domain.Document)}
+}
+
+func (s *Search) IndexDocument(ctx context.Context, doc *domain.Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs[doc.ID] = *doc
+	return nil
+}
+
+func (s *Search) DeleteFromIndex(ctx context.Context, tenantID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc, ok := s.docs[id]; ok && doc.TenantID == tenantID {
+		delete(s.docs, id)
+	}
+	return nil
+}
+
+func (s *Search) Search(ctx context.Context, tenantID uuid.UUID, query string, filters map[string]interface{}) ([]domain.SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query = strings.ToLower(query)
+	results := []domain.SearchResult{}
+	for _, doc := range s.docs {
+		if doc.TenantID != tenantID {
+			continue
+		}
+		if strings.Contains(strings.ToLower(doc.FileName), query) || strings.Contains(strings.ToLower(doc.ExtractedText), query) {
+			results = append(results, domain.SearchResult{ID: doc.ID, Score: 1})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID.String() < results[j].ID.String() })
+	return results, nil
+}
+
+func (s *Search) Suggest(ctx context.Context, tenantID uuid.UUID, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix = strings.ToLower(prefix)
+	suggestions := []string{}
+	for _, doc := range s.docs {
+		if doc.TenantID == tenantID && strings.HasPrefix(strings.ToLower(doc.FileName), prefix) {
+			suggestions = append(suggestions, doc.FileName)
+		}
+	}
+	sort.Strings(suggestions)
+	return suggestions, nil
+}
+
+// Indexed reports whether a document is in the index.
+func (s *Search) Indexed(id uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.docs[id]
+	return ok
+}
@@ -0,0 +1,195 @@
+package testing
+
+import (
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// Harness holds one in-memory store of each kind and builds command and
+// query handlers on top of them. Handlers built from the same Harness share
+// its stores and publisher, so a test can seed data, run commands and
+// assert on queries and published events together.
+//
+// Handlers publish to Publisher directly; call WithOutbox(h.Outbox) on the
+// ones that support it to test the outbox path. Query handlers run without
+// a cache. The client, invoice and payment query handlers read projections
+// from MongoDB and are not built here.
+type Harness struct {
+	Warehouses   *Warehouses
+	Locations    *Locations
+	Operations   *Operations
+	Inventory    *Inventory
+	Reservations *Reservations
+	Transactions *Transactions
+
+	Orders          *Orders
+	Products        *Products
+	Returns         *Returns
+	DocumentNumbers *DocumentNumbers
+	DeliveryRoutes  *DeliveryRoutes
+
+	Invoices         *Invoices
+	InvoiceNumbers   *InvoiceNumbers
+	EventStore       *EventStore
+	Payments         *Payments
+	BankStatements   *BankStatements
+	CashSessions     *CashSessions
+	RevenueSchedules *RevenueSchedules
+	TaxReturns       *TaxReturns
+
+	Documents  *Documents
+	Storage    *Storage
+	Processing *Processing
+	Search     *Search
+
+	CommandJobs *CommandJobs
+
+	Publisher *Publisher
+	Outbox    *Outbox
+	Logger    *logger.Logger
+
+	// Processors are the payment processors payment handlers charge
+	// through; none are registered by default.
+	Processors *domain.ProcessorRegistry
+	// Tenant configures client commands.
+	Tenant commands.TenantConfig
+	// I18n and Tax give revenue recognition and VAT returns each tenant's
+	// time zone and VAT registration. Tenants are in UTC and registered in
+	// GB by default.
+	I18n config.I18nConfig
+	Tax  config.TaxConfig
+}
+
+// New returns a Harness with empty stores.
+func New() *Harness {
+	log, _ := logger.New(logger.Config{Level: "error", Format: "json", ServiceName: "test"})
+	return &Harness{
+		Warehouses:   NewWarehouses(),
+		Locations:    NewLocations(),
+		Operations:   NewOperations(),
+		Inventory:    NewInventory(),
+		Reservations: NewReservations(),
+		Transactions: NewTransactions(),
+
+		Orders:          NewOrders(),
+		Products:        NewProducts(),
+		Returns:         NewReturns(),
+		DocumentNumbers: NewDocumentNumbers(),
+		DeliveryRoutes:  NewDeliveryRoutes(),
+
+		Invoices:         NewInvoices(),
+		InvoiceNumbers:   NewInvoiceNumbers(),
+		EventStore:       NewEventStore(),
+		Payments:         NewPayments(),
+		BankStatements:   NewBankStatements(),
+		CashSessions:     NewCashSessions(),
+		RevenueSchedules: NewRevenueSchedules(),
+		TaxReturns:       NewTaxReturns(),
+
+		Documents:  NewDocuments(),
+		Storage:    NewStorage(),
+		Processing: NewProcessing(),
+		Search:     NewSearch(),
+
+		CommandJobs: NewCommandJobs(),
+
+		Publisher: NewPublisher(),
+		Outbox:    NewOutbox(),
+		Logger:    log,
+
+		Processors: domain.NewProcessorRegistry(),
+		Tenant: commands.TenantConfig{
+			AutoGenerateCode: true,
+			CodePrefix:       "CLT",
+		},
+		I18n: config.I18nConfig{TimeZone: "UTC"},
+		Tax:  config.TaxConfig{TaxJurisdiction: config.TaxJurisdiction{Country: "GB"}},
+	}
+}
+
+func (h *Harness) WarehouseCommands() *commands.WarehouseCommandHandler {
+	return commands.NewWarehouseCommandHandler(h.Warehouses, h.Locations, h.Operations, h.Publisher)
+}
+
+func (h *Harness) InventoryCommands() *commands.InventoryCommandHandler {
+	return commands.NewInventoryCommandHandler(h.Inventory, h.Warehouses, h.Locations, h.Reservations, h.Transactions, h.Publisher)
+}
+
+func (h *Harness) OrderFulfillmentSaga() *commands.OrderFulfillmentSagaHandler {
+	return commands.NewOrderFulfillmentSagaHandler(h.Inventory, h.Reservations, h.Operations, h.Warehouses, h.Publisher)
+}
+
+func (h *Harness) LandedCostCommands() *commands.LandedCostCommandHandler {
+	return commands.NewLandedCostCommandHandler(h.Operations, h.Inventory, h.Products, h.Publisher)
+}
+
+func (h *Harness) OrderCommands() *commands.OrderCommandHandler {
+	return commands.NewOrderCommandHandler(h.Orders, h.Products, h.Inventory, h.Publisher)
+}
+
+func (h *Harness) ReturnCommands() *commands.ReturnCommandHandler {
+	return commands.NewReturnCommandHandler(h.Returns, h.Orders, h.Products, h.DocumentNumbers, h.Publisher)
+}
+
+func (h *Harness) DeliveryCommands() *commands.DeliveryCommandHandler {
+	return commands.NewDeliveryCommandHandler(h.DeliveryRoutes, h.Orders, h.Documents, h.Publisher)
+}
+
+func (h *Harness) DocumentCommands() *commands.DocumentCommandHandler {
+	return commands.NewDocumentCommandHandler(h.Documents, h.Storage, h.Processing, h.Search, h.Publisher)
+}
+
+func (h *Harness) ClientCommands() *commands.ClientCommandHandler {
+	return commands.NewClientCommandHandler(h.EventStore, h.Publisher, h.Logger, h.Tenant)
+}
+
+func (h *Harness) InvoiceCommands() *commands.InvoiceCommandHandler {
+	return commands.NewInvoiceCommandHandler(h.Invoices, h.EventStore, h.Publisher, h.Logger, h.InvoiceNumbers)
+}
+
+func (h *Harness) PaymentCommands() *commands.PaymentCommandHandler {
+	return commands.NewPaymentCommandHandler(h.Payments, h.Invoices, h.EventStore, h.Publisher, h.Logger, h.Processors)
+}
+
+// PaymentWebhooks verifies Stripe events with stripeSecret and PayPal
+// events against paypalID.
+func (h *Harness) PaymentWebhooks(stripeSecret, paypalID string) *commands.WebhookHandler {
+	return commands.NewWebhookHandler(h.Payments, h.Invoices, h.Publisher, h.Logger, stripeSecret, paypalID)
+}
+
+func (h *Harness) BankReconciliationCommands() *commands.BankReconciliationCommandHandler {
+	return commands.NewBankReconciliationCommandHandler(h.BankStatements, h.Payments, h.Invoices, h.Invoices, h.Publisher, h.Logger)
+}
+
+func (h *Harness) CashSessionCommands() *commands.CashSessionCommandHandler {
+	return commands.NewCashSessionCommandHandler(h.CashSessions, h.Payments, h.Invoices, h.Publisher, h.Logger)
+}
+
+func (h *Harness) RevenueRecognitionCommands() *commands.RevenueRecognitionCommandHandler {
+	return commands.NewRevenueRecognitionCommandHandler(h.RevenueSchedules, h.Invoices, h.Publisher, h.I18n.LocationFor, h.Logger)
+}
+
+func (h *Harness) TaxReturnCommands() *commands.TaxReturnCommandHandler {
+	return commands.NewTaxReturnCommandHandler(h.TaxReturns, h.Invoices, h.Publisher, h.Tax.JurisdictionFor, h.I18n.LocationFor, h.Logger)
+}
+
+// AsyncCommands runs the commands of registry in the background, with jobs
+// kept in CommandJobs.
+func (h *Harness) AsyncCommands(registry *commands.CommandHandlerRegistry, cfg config.AsyncCommandConfig) *commands.AsyncCommands {
+	return commands.NewAsyncCommands(registry, h.CommandJobs, cfg, h.Logger)
+}
+
+func (h *Harness) WarehouseQueries() *queries.WarehouseQueryHandler {
+	return queries.NewWarehouseQueryHandler(h.Warehouses, h.Locations, h.Operations, nil, h.Logger)
+}
+
+func (h *Harness) InventoryQueries() *queries.InventoryQueryHandler {
+	return queries.NewInventoryQueryHandler(h.Inventory, h.Reservations, h.Transactions, h.Warehouses, nil, h.Logger)
+}
+
+func (h *Harness) DocumentQueries() *queries.DocumentQueryHandler {
+	return queries.NewDocumentQueryHandler(h.Documents, h.Search, nil, h.Logger)
+}
@@ -0,0 +1,206 @@
+package testing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/queries"
+	"github.com/ims-erp/system/internal/repository"
+	apptest "github.com/ims-erp/system/internal/testing"
+)
+
+func TestHarness_WarehouseCommandsSaveToStores(t *testing.T) {
+	h := apptest.New()
+	tenantID := uuid.New()
+
+	cmd := commands.NewCommand("createWarehouse", tenantID.String(), "", uuid.New().String(), map[string]interface{}{
+		"name":     "Main Warehouse",
+		"code":     "WH-001",
+		"type":     "main",
+		"capacity": 10000,
+	})
+	result, err := h.WarehouseCommands().HandleCreateWarehouse(context.Background(), cmd)
+	require.NoError(t, err)
+
+	created := result.Data.(*domain.Warehouse)
+	stored, err := h.Warehouses.FindByCode(context.Background(), tenantID, "WH-001")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, stored.ID)
+	assert.Equal(t, []string{"warehouse.created"}, h.Publisher.EventTypes())
+}
+
+func TestHarness_DocumentCommandsAndQueriesShareStores(t *testing.T) {
+	h := apptest.New()
+	ctx := context.Background()
+	tenantID := uuid.New()
+	userID := uuid.New().String()
+
+	doc := &domain.Document{
+		ID:        uuid.New(),
+		TenantID:  tenantID,
+		Type:      domain.DocTypeInvoice,
+		FileName:  "invoice.pdf",
+		MimeType:  "application/pdf",
+		Bucket:    "documents",
+		ObjectKey: "invoices/invoice.pdf",
+		CreatedAt: time.Now().UTC(),
+	}
+	require.NoError(t, h.Documents.Create(ctx, doc))
+
+	docs := h.DocumentQueries()
+	detail, err := docs.GetDocumentByID(ctx, &queries.GetDocumentByIDQuery{DocumentID: doc.ID.String(), TenantID: tenantID.String()})
+	require.NoError(t, err)
+	assert.Equal(t, "invoice.pdf", detail.FileName)
+
+	remove := commands.NewCommand("deleteDocument", tenantID.String(), doc.ID.String(), userID, map[string]interface{}{"documentId": doc.ID})
+	_, err = h.DocumentCommands().HandleDeleteDocument(ctx, remove)
+	require.NoError(t, err)
+
+	_, err = docs.GetDocumentByID(ctx, &queries.GetDocumentByIDQuery{DocumentID: doc.ID.String(), TenantID: tenantID.String()})
+	assert.Error(t, err)
+	trash, err := h.Documents.List(ctx, domain.DocumentFilter{TenantID: tenantID, Deleted: true, Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, trash.Documents, 1)
+	assert.Equal(t, userID, trash.Documents[0].DeletedBy)
+
+	restore := commands.NewCommand("restoreDocument", tenantID.String(), doc.ID.String(), userID, map[string]interface{}{"documentId": doc.ID})
+	_, err = h.DocumentCommands().HandleRestoreDocument(ctx, restore)
+	require.NoError(t, err)
+
+	_, err = docs.GetDocumentByID(ctx, &queries.GetDocumentByIDQuery{DocumentID: doc.ID.String(), TenantID: tenantID.String()})
+	assert.NoError(t, err)
+	assert.True(t, h.Search.Indexed(doc.ID))
+	assert.Equal(t, []string{"document.deleted", "document.restored"}, h.Publisher.EventTypes())
+}
+
+func TestRepositories_UpdateDetectsConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	invoices := apptest.NewInvoices()
+	invoice, err := domain.NewInvoice(uuid.New(), uuid.New(), uuid.New(), domain.InvoiceTypeStandard, "EUR", domain.PaymentTermNet30, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, invoices.Create(ctx, invoice))
+
+	first, err := invoices.FindByID(ctx, invoice.ID)
+	require.NoError(t, err)
+	second, err := invoices.FindByID(ctx, invoice.ID)
+	require.NoError(t, err)
+
+	first.Notes = "first"
+	require.NoError(t, invoices.Update(ctx, first))
+	second.Notes = "second"
+	err = invoices.Update(ctx, second)
+	assert.True(t, errors.Is(err, repository.ErrConcurrencyConflict))
+
+	stored, err := invoices.FindByID(ctx, invoice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "first", stored.Notes)
+}
+
+func TestInvoices_UpdateVersionsIsOneConditionalWrite(t *testing.T) {
+	ctx := context.Background()
+	invoices := apptest.NewInvoices()
+	invoice, err := domain.NewInvoice(uuid.New(), uuid.New(), uuid.New(), domain.InvoiceTypeStandard, "EUR", domain.PaymentTermNet30, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, invoices.Create(ctx, invoice))
+
+	loaded, err := invoices.FindByID(ctx, invoice.ID)
+	require.NoError(t, err)
+	require.NoError(t, invoices.UpdateVersions(ctx, loaded, 3))
+	assert.Equal(t, invoice.Version+3, loaded.Version)
+
+	// A concurrent write lands while a command that recorded three events
+	// is still working; none of its versions are saved.
+	stale, err := invoices.FindByID(ctx, invoice.ID)
+	require.NoError(t, err)
+	concurrent, err := invoices.FindByID(ctx, invoice.ID)
+	require.NoError(t, err)
+	concurrent.Notes = "concurrent"
+	require.NoError(t, invoices.Update(ctx, concurrent))
+
+	stale.Notes = "stale"
+	err = invoices.UpdateVersions(ctx, stale, 3)
+	assert.True(t, errors.Is(err, repository.ErrConcurrencyConflict))
+	assert.Equal(t, invoice.Version+3, stale.Version, "a failed write does not advance the caller's copy")
+
+	stored, err := invoices.FindByID(ctx, invoice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, invoice.Version+4, stored.Version)
+	assert.Equal(t, "concurrent", stored.Notes)
+}
+
+func TestRepositories_ReturnCopies(t *testing.T) {
+	ctx := context.Background()
+	warehouses := apptest.NewWarehouses()
+	warehouse := domain.NewWarehouse(uuid.New(), "Main", "WH-001", domain.WarehouseTypeMain)
+	require.NoError(t, warehouses.Create(ctx, warehouse))
+
+	warehouse.Name = "Changed"
+	found, err := warehouses.FindByID(ctx, warehouse.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Main", found.Name)
+
+	found.Name = "Changed again"
+	found, err = warehouses.FindByID(ctx, warehouse.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Main", found.Name)
+}
+
+func TestOutbox_KeepsEventsOfCommittedTransactionsOnly(t *testing.T) {
+	ctx := context.Background()
+	outbox := apptest.NewOutbox()
+	committed := &events.EventEnvelope{Type: "invoice.created"}
+	rolledBack := &events.EventEnvelope{Type: "invoice.sent"}
+
+	require.NoError(t, outbox.WithTransaction(ctx, func(ctx context.Context) error {
+		return outbox.Enqueue(ctx, committed)
+	}))
+	err := outbox.WithTransaction(ctx, func(ctx context.Context) error {
+		require.NoError(t, outbox.Enqueue(ctx, rolledBack))
+		return errors.New("aborted")
+	})
+	require.Error(t, err)
+
+	assert.Equal(t, []*events.EventEnvelope{committed}, outbox.Events())
+}
+
+func TestPublisher_Fail(t *testing.T) {
+	publisher := apptest.NewPublisher()
+	publisher.Fail(errors.New("nats down"))
+	assert.Error(t, publisher.PublishEvent(context.Background(), &events.EventEnvelope{Type: "order.created"}))
+
+	publisher.Fail(nil)
+	require.NoError(t, publisher.PublishEvent(context.Background(), &events.EventEnvelope{Type: "order.created"}))
+	assert.Equal(t, []string{"order.created"}, publisher.EventTypes())
+}
+
+func TestCommandJobs_ClaimSkipsBusyTenants(t *testing.T) {
+	ctx := context.Background()
+	jobs := apptest.NewCommandJobs()
+	require.NoError(t, jobs.Create(ctx, &repository.CommandJob{ID: "a", TenantID: "busy"}, time.Hour))
+	require.NoError(t, jobs.Create(ctx, &repository.CommandJob{ID: "b", TenantID: "idle"}, time.Hour))
+	assert.ErrorIs(t, jobs.Create(ctx, &repository.CommandJob{ID: "b", TenantID: "idle"}, time.Hour), repository.ErrDuplicateCommand)
+
+	claimed, err := jobs.Claim(ctx, "worker", []string{"busy"})
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	assert.Equal(t, "b", claimed.ID)
+
+	claimed.Status = repository.CommandStatusSucceeded
+	require.NoError(t, jobs.Finish(ctx, claimed, time.Hour))
+	stored, err := jobs.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, repository.CommandStatusSucceeded, stored.Status)
+
+	claimed, err = jobs.Claim(ctx, "worker", []string{"busy"})
+	require.NoError(t, err)
+	assert.Nil(t, claimed)
+}
@@ -0,0 +1,371 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// notFound reports a missing row the way a Mongo lookup does, wrapping
+// mongo.ErrNoDocuments.
+func notFound(entity string, id interface{}) error {
+	return fmt.Errorf("%w: %s %v", mongo.ErrNoDocuments, entity, id)
+}
+
+// Warehouses implements domain.WarehouseRepository.
+type Warehouses struct {
+	rows table[domain.Warehouse]
+}
+
+func NewWarehouses() *Warehouses {
+	return &Warehouses{}
+}
+
+func (r *Warehouses) Create(ctx context.Context, warehouse *domain.Warehouse) error {
+	if !r.rows.insert(warehouse.ID, warehouse) {
+		return fmt.Errorf("warehouse %s already exists", warehouse.ID)
+	}
+	return nil
+}
+
+func (r *Warehouses) Update(ctx context.Context, warehouse *domain.Warehouse) error {
+	if !r.rows.replace(warehouse.ID, warehouse, nil) {
+		return notFound("warehouse", warehouse.ID)
+	}
+	return nil
+}
+
+func (r *Warehouses) Delete(ctx context.Context, id uuid.UUID) error {
+	r.rows.remove(id)
+	return nil
+}
+
+func (r *Warehouses) FindByID(ctx context.Context, id uuid.UUID) (*domain.Warehouse, error) {
+	if warehouse, ok := r.rows.get(id); ok {
+		return warehouse, nil
+	}
+	return nil, notFound("warehouse", id)
+}
+
+func (r *Warehouses) FindByCode(ctx context.Context, tenantID uuid.UUID, code string) (*domain.Warehouse, error) {
+	if warehouse, ok := r.rows.first(func(w *domain.Warehouse) bool {
+		return w.TenantID == tenantID && w.Code == code
+	}); ok {
+		return warehouse, nil
+	}
+	return nil, notFound("warehouse", code)
+}
+
+func (r *Warehouses) FindByTenant(ctx context.Context, tenantID uuid.UUID) ([]*domain.Warehouse, error) {
+	return r.rows.find(func(w *domain.Warehouse) bool { return w.TenantID == tenantID }), nil
+}
+
+func (r *Warehouses) FindActive(ctx context.Context, tenantID uuid.UUID) ([]*domain.Warehouse, error) {
+	return r.rows.find(func(w *domain.Warehouse) bool { return w.TenantID == tenantID && w.IsActive }), nil
+}
+
+// Locations implements domain.LocationRepository. FindByBarcode matches a
+// location's code.
+type Locations struct {
+	rows table[domain.WarehouseLocation]
+}
+
+func NewLocations() *Locations {
+	return &Locations{}
+}
+
+func (r *Locations) Create(ctx context.Context, location *domain.WarehouseLocation) error {
+	if !r.rows.insert(location.ID, location) {
+		return fmt.Errorf("location %s already exists", location.ID)
+	}
+	return nil
+}
+
+func (r *Locations) Update(ctx context.Context, location *domain.WarehouseLocation) error {
+	if !r.rows.replace(location.ID, location, nil) {
+		return notFound("location", location.ID)
+	}
+	return nil
+}
+
+func (r *Locations) Delete(ctx context.Context, id uuid.UUID) error {
+	r.rows.remove(id)
+	return nil
+}
+
+func (r *Locations) FindByID(ctx context.Context, id uuid.UUID) (*domain.WarehouseLocation, error) {
+	if location, ok := r.rows.get(id); ok {
+		return location, nil
+	}
+	return nil, notFound("location", id)
+}
+
+func (r *Locations) FindByWarehouse(ctx context.Context, warehouseID uuid.UUID) ([]*domain.WarehouseLocation, error) {
+	return r.rows.find(func(l *domain.WarehouseLocation) bool { return l.WarehouseID == warehouseID }), nil
+}
+
+func (r *Locations) FindByPath(ctx context.Context, warehouseID uuid.UUID, zone, aisle, rack, bin string) (*domain.WarehouseLocation, error) {
+	if location, ok := r.rows.first(func(l *domain.WarehouseLocation) bool {
+		return l.WarehouseID == warehouseID && l.Zone == zone && l.Aisle == aisle && l.Rack == rack && l.Bin == bin
+	}); ok {
+		return location, nil
+	}
+	return nil, notFound("location", fmt.Sprintf("%s-%s-%s-%s", zone, aisle, rack, bin))
+}
+
+func (r *Locations) FindByBarcode(ctx context.Context, barcode string) (*domain.WarehouseLocation, error) {
+	if location, ok := r.rows.first(func(l *domain.WarehouseLocation) bool { return l.Code == barcode }); ok {
+		return location, nil
+	}
+	return nil, notFound("location", barcode)
+}
+
+// FindAvailable returns the warehouse's active locations with room for
+// quantity more units.
+func (r *Locations) FindAvailable(ctx context.Context, warehouseID uuid.UUID, quantity int) ([]*domain.WarehouseLocation, error) {
+	return r.rows.find(func(l *domain.WarehouseLocation) bool {
+		return l.WarehouseID == warehouseID && l.IsActive && l.Capacity-l.CurrentStock >= quantity
+	}), nil
+}
+
+// Operations implements domain.OperationRepository. FindPending returns
+// pending operations by descending priority.
+type Operations struct {
+	rows table[domain.WarehouseOperation]
+}
+
+func NewOperations() *Operations {
+	return &Operations{}
+}
+
+func (r *Operations) Create(ctx context.Context, operation *domain.WarehouseOperation) error {
+	if !r.rows.insert(operation.ID, operation) {
+		return fmt.Errorf("operation %s already exists", operation.ID)
+	}
+	return nil
+}
+
+func (r *Operations) Update(ctx context.Context, operation *domain.WarehouseOperation) error {
+	if !r.rows.replace(operation.ID, operation, nil) {
+		return notFound("operation", operation.ID)
+	}
+	return nil
+}
+
+func (r *Operations) Delete(ctx context.Context, id uuid.UUID) error {
+	r.rows.remove(id)
+	return nil
+}
+
+func (r *Operations) FindByID(ctx context.Context, id uuid.UUID) (*domain.WarehouseOperation, error) {
+	if operation, ok := r.rows.get(id); ok {
+		return operation, nil
+	}
+	return nil, notFound("operation", id)
+}
+
+func (r *Operations) FindByWarehouse(ctx context.Context, warehouseID uuid.UUID) ([]*domain.WarehouseOperation, error) {
+	return r.rows.find(func(o *domain.WarehouseOperation) bool { return o.WarehouseID == warehouseID }), nil
+}
+
+func (r *Operations) FindByStatus(ctx context.Context, warehouseID uuid.UUID, status string) ([]*domain.WarehouseOperation, error) {
+	return r.rows.find(func(o *domain.WarehouseOperation) bool {
+		return o.WarehouseID == warehouseID && o.Status == status
+	}), nil
+}
+
+func (r *Operations) FindPending(ctx context.Context, warehouseID uuid.UUID) ([]*domain.WarehouseOperation, error) {
+	operations, _ := r.FindByStatus(ctx, warehouseID, "pending")
+	sort.SliceStable(operations, func(i, j int) bool { return operations[i].Priority > operations[j].Priority })
+	return operations, nil
+}
+
+func (r *Operations) FindByReference(ctx context.Context, referenceType string, referenceID uuid.UUID) ([]*domain.WarehouseOperation, error) {
+	return r.rows.find(func(o *domain.WarehouseOperation) bool {
+		return o.ReferenceType == referenceType && o.ReferenceID == referenceID
+	}), nil
+}
+
+// Inventory implements domain.InventoryRepository. FindLowStock returns the
+// tenant's items with nothing available.
+type Inventory struct {
+	rows table[domain.InventoryItem]
+}
+
+func NewInventory() *Inventory {
+	return &Inventory{}
+}
+
+func (r *Inventory) Create(ctx context.Context, item *domain.InventoryItem) error {
+	if !r.rows.insert(item.ID, item) {
+		return fmt.Errorf("inventory item %s already exists", item.ID)
+	}
+	return nil
+}
+
+// Update saves item if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *Inventory) Update(ctx context.Context, item *domain.InventoryItem) error {
+	next := *item
+	next.Version++
+	if !r.rows.replace(item.ID, &next, func(stored *domain.InventoryItem) bool { return stored.Version == item.Version }) {
+		return fmt.Errorf("%w: inventory item %s at version %d", repository.ErrConcurrencyConflict, item.ID, item.Version)
+	}
+	item.Version++
+	return nil
+}
+
+func (r *Inventory) Delete(ctx context.Context, id uuid.UUID) error {
+	r.rows.remove(id)
+	return nil
+}
+
+func (r *Inventory) FindByID(ctx context.Context, id uuid.UUID) (*domain.InventoryItem, error) {
+	if item, ok := r.rows.get(id); ok {
+		return item, nil
+	}
+	return nil, notFound("inventory item", id)
+}
+
+func (r *Inventory) FindByProductAndWarehouse(ctx context.Context, productID, warehouseID uuid.UUID) (*domain.InventoryItem, error) {
+	if item, ok := r.rows.first(func(i *domain.InventoryItem) bool {
+		return i.ProductID == productID && i.WarehouseID == warehouseID
+	}); ok {
+		return item, nil
+	}
+	return nil, notFound("inventory item", productID)
+}
+
+func (r *Inventory) FindByWarehouse(ctx context.Context, warehouseID uuid.UUID) ([]*domain.InventoryItem, error) {
+	return r.rows.find(func(i *domain.InventoryItem) bool { return i.WarehouseID == warehouseID }), nil
+}
+
+func (r *Inventory) FindByProduct(ctx context.Context, productID uuid.UUID) ([]*domain.InventoryItem, error) {
+	return r.rows.find(func(i *domain.InventoryItem) bool { return i.ProductID == productID }), nil
+}
+
+func (r *Inventory) FindLowStock(ctx context.Context, tenantID uuid.UUID) ([]*domain.InventoryItem, error) {
+	return r.rows.find(func(i *domain.InventoryItem) bool { return i.TenantID == tenantID && i.AvailableQty <= 0 }), nil
+}
+
+// Reservations implements domain.ReservationRepository.
+type Reservations struct {
+	rows table[domain.StockReservation]
+}
+
+func NewReservations() *Reservations {
+	return &Reservations{}
+}
+
+func (r *Reservations) Create(ctx context.Context, reservation *domain.StockReservation) error {
+	if !r.rows.insert(reservation.ID, reservation) {
+		return fmt.Errorf("reservation %s already exists", reservation.ID)
+	}
+	return nil
+}
+
+func (r *Reservations) Update(ctx context.Context, reservation *domain.StockReservation) error {
+	if !r.rows.replace(reservation.ID, reservation, nil) {
+		return notFound("reservation", reservation.ID)
+	}
+	return nil
+}
+
+func (r *Reservations) Delete(ctx context.Context, id uuid.UUID) error {
+	r.rows.remove(id)
+	return nil
+}
+
+func (r *Reservations) FindByID(ctx context.Context, id uuid.UUID) (*domain.StockReservation, error) {
+	if reservation, ok := r.rows.get(id); ok {
+		return reservation, nil
+	}
+	return nil, notFound("reservation", id)
+}
+
+func (r *Reservations) FindByProduct(ctx context.Context, productID uuid.UUID) ([]*domain.StockReservation, error) {
+	return r.rows.find(func(s *domain.StockReservation) bool { return s.ProductID == productID }), nil
+}
+
+func (r *Reservations) FindByWarehouse(ctx context.Context, warehouseID uuid.UUID) ([]*domain.StockReservation, error) {
+	return r.rows.find(func(s *domain.StockReservation) bool { return s.WarehouseID == warehouseID }), nil
+}
+
+func (r *Reservations) FindByReference(ctx context.Context, referenceType string, referenceID uuid.UUID) ([]*domain.StockReservation, error) {
+	return r.rows.find(func(s *domain.StockReservation) bool {
+		return s.ReferenceType == referenceType && s.ReferenceID == referenceID
+	}), nil
+}
+
+func (r *Reservations) FindActiveByProduct(ctx context.Context, productID uuid.UUID) ([]*domain.StockReservation, error) {
+	return r.rows.find(func(s *domain.StockReservation) bool { return s.ProductID == productID && s.Status == "active" }), nil
+}
+
+// FindExpired returns the tenant's active reservations past their expiry.
+func (r *Reservations) FindExpired(ctx context.Context, tenantID uuid.UUID) ([]*domain.StockReservation, error) {
+	now := time.Now()
+	return r.rows.find(func(s *domain.StockReservation) bool {
+		return s.TenantID == tenantID && s.Status == "active" && s.ExpiresAt != nil && s.ExpiresAt.Before(now)
+	}), nil
+}
+
+// Transactions implements domain.TransactionRepository.
+type Transactions struct {
+	rows table[domain.InventoryTransaction]
+}
+
+func NewTransactions() *Transactions {
+	return &Transactions{}
+}
+
+func (r *Transactions) Create(ctx context.Context, transaction *domain.InventoryTransaction) error {
+	if !r.rows.insert(transaction.ID, transaction) {
+		return fmt.Errorf("inventory transaction %s already exists", transaction.ID)
+	}
+	return nil
+}
+
+func (r *Transactions) Update(ctx context.Context, transaction *domain.InventoryTransaction) error {
+	if !r.rows.replace(transaction.ID, transaction, nil) {
+		return notFound("inventory transaction", transaction.ID)
+	}
+	return nil
+}
+
+func (r *Transactions) FindByID(ctx context.Context, id uuid.UUID) (*domain.InventoryTransaction, error) {
+	if transaction, ok := r.rows.get(id); ok {
+		return transaction, nil
+	}
+	return nil, notFound("inventory transaction", id)
+}
+
+func (r *Transactions) FindByProduct(ctx context.Context, productID uuid.UUID) ([]*domain.InventoryTransaction, error) {
+	return r.rows.find(func(t *domain.InventoryTransaction) bool { return t.ProductID == productID }), nil
+}
+
+func (r *Transactions) FindByWarehouse(ctx context.Context, warehouseID uuid.UUID) ([]*domain.InventoryTransaction, error) {
+	return r.rows.find(func(t *domain.InventoryTransaction) bool { return t.WarehouseID == warehouseID }), nil
+}
+
+func (r *Transactions) FindByReference(ctx context.Context, referenceType string, referenceID uuid.UUID) ([]*domain.InventoryTransaction, error) {
+	return r.rows.find(func(t *domain.InventoryTransaction) bool {
+		return t.ReferenceType == referenceType && t.ReferenceID == referenceID
+	}), nil
+}
+
+func (r *Transactions) FindByMovementType(ctx context.Context, movementType domain.MovementType) ([]*domain.InventoryTransaction, error) {
+	return r.rows.find(func(t *domain.InventoryTransaction) bool { return t.MovementType == movementType }), nil
+}
+
+// FindByDateRange returns the transactions created in [start, end).
+func (r *Transactions) FindByDateRange(ctx context.Context, start, end time.Time) ([]*domain.InventoryTransaction, error) {
+	return r.rows.find(func(t *domain.InventoryTransaction) bool {
+		return !t.CreatedAt.Before(start) && t.CreatedAt.Before(end)
+	}), nil
+}
@@ -0,0 +1,173 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+)
+
+// Invoices implements commands.InvoiceRepository, and the
+// commands.OpenInvoiceFinder and commands.IssuedInvoiceSource views of it.
+type Invoices struct {
+	rows table[domain.Invoice]
+}
+
+func NewInvoices() *Invoices {
+	return &Invoices{}
+}
+
+func (r *Invoices) Create(ctx context.Context, invoice *domain.Invoice) error {
+	if !r.rows.insert(invoice.ID, invoice) {
+		return fmt.Errorf("failed to create invoice: %s already exists", invoice.ID)
+	}
+	return nil
+}
+
+// Update saves invoice if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *Invoices) Update(ctx context.Context, invoice *domain.Invoice) error {
+	return r.UpdateVersions(ctx, invoice, 1)
+}
+
+func (r *Invoices) UpdateVersions(ctx context.Context, invoice *domain.Invoice, versions int64) error {
+	next := *invoice
+	next.Version += versions
+	if !r.rows.replace(invoice.ID, &next, func(stored *domain.Invoice) bool { return stored.Version == invoice.Version }) {
+		return fmt.Errorf("%w: invoice %s at version %d", repository.ErrConcurrencyConflict, invoice.ID, invoice.Version)
+	}
+	invoice.Version = next.Version
+	return nil
+}
+
+func (r *Invoices) FindByID(ctx context.Context, id uuid.UUID) (*domain.Invoice, error) {
+	if invoice, ok := r.rows.get(id); ok {
+		return invoice, nil
+	}
+	return nil, fmt.Errorf("invoice not found: %s", id)
+}
+
+func (r *Invoices) FindByInvoiceNumber(ctx context.Context, tenantID uuid.UUID, invoiceNumber string) (*domain.Invoice, error) {
+	if invoice, ok := r.rows.first(func(i *domain.Invoice) bool {
+		return i.TenantID == tenantID && i.InvoiceNumber == invoiceNumber
+	}); ok {
+		return invoice, nil
+	}
+	return nil, fmt.Errorf("invoice not found: %s", invoiceNumber)
+}
+
+// FindByClientID returns a page of the client's invoices, newest first.
+func (r *Invoices) FindByClientID(ctx context.Context, clientID uuid.UUID, limit, offset int) ([]*domain.Invoice, error) {
+	invoices := r.rows.find(func(i *domain.Invoice) bool { return i.ClientID == clientID })
+	sort.SliceStable(invoices, func(i, j int) bool { return invoices[i].CreatedAt.After(invoices[j].CreatedAt) })
+	return page(invoices, limit, offset), nil
+}
+
+// FindOpen returns the tenant's pending, sent and overdue invoices in
+// currency with an amount due, earliest due first.
+func (r *Invoices) FindOpen(ctx context.Context, tenantID uuid.UUID, currency string) ([]*domain.Invoice, error) {
+	invoices := r.rows.find(func(i *domain.Invoice) bool {
+		if i.TenantID != tenantID || i.Currency != currency || !i.AmountDue.IsPositive() {
+			return false
+		}
+		switch i.Status {
+		case domain.InvoiceStatusPending, domain.InvoiceStatusSent, domain.InvoiceStatusOverdue:
+			return true
+		}
+		return false
+	})
+	sort.SliceStable(invoices, func(i, j int) bool {
+		a, b := invoices[i].DueDate, invoices[j].DueDate
+		return a != nil && (b == nil || a.Before(*b))
+	})
+	return invoices, nil
+}
+
+// EachIssued calls fn with the tenant's invoices issued in [from, to),
+// drafts and voided invoices left out, in issue order.
+func (r *Invoices) EachIssued(ctx context.Context, tenantID uuid.UUID, from, to time.Time, fn func(*domain.Invoice) error) error {
+	invoices := r.rows.find(func(i *domain.Invoice) bool {
+		return i.TenantID == tenantID && !i.IssueDate.Before(from) && i.IssueDate.Before(to) &&
+			i.Status != domain.InvoiceStatusDraft && i.Status != domain.InvoiceStatusCancelled
+	})
+	sort.SliceStable(invoices, func(i, j int) bool { return invoices[i].IssueDate.Before(invoices[j].IssueDate) })
+	for _, invoice := range invoices {
+		if err := fn(invoice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvoiceNumbers implements commands.InvoiceCounter with the numbers the
+// Mongo counter hands out: INV-<year>-<sequence>, counted per tenant and
+// year.
+type InvoiceNumbers struct {
+	mu        sync.Mutex
+	sequences map[string]int64
+}
+
+func NewInvoiceNumbers() *InvoiceNumbers {
+	return &InvoiceNumbers{sequences: make(map[string]int64)}
+}
+
+func (c *InvoiceNumbers) GetNextInvoiceNumber(ctx context.Context, tenantID uuid.UUID, year int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := fmt.Sprintf("%s-%d", tenantID, year)
+	c.sequences[key]++
+	return fmt.Sprintf("INV-%d-%06d", year, c.sequences[key]), nil
+}
+
+// EventStore implements commands.EventStore. Like the Mongo event store it
+// refuses a second event at an aggregate version.
+type EventStore struct {
+	mu     sync.Mutex
+	events []repository.StoredEvent
+}
+
+func NewEventStore() *EventStore {
+	return &EventStore{}
+}
+
+// Save appends events, or none of them if one repeats a stored aggregate
+// version.
+func (s *EventStore) Save(ctx context.Context, events []repository.StoredEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range events {
+		for _, stored := range s.events {
+			if stored.AggregateID == event.AggregateID && stored.Version == event.Version {
+				return fmt.Errorf("%w: aggregate %s version %d", repository.ErrConcurrencyConflict, event.AggregateID, event.Version)
+			}
+		}
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// Load returns the aggregate's events by version.
+func (s *EventStore) Load(ctx context.Context, aggregateID string) ([]repository.StoredEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []repository.StoredEvent
+	for _, event := range s.events {
+		if event.AggregateID == aggregateID {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Version < events[j].Version })
+	return events, nil
+}
+
+// Events returns every stored event in the order it was saved.
+func (s *EventStore) Events() []repository.StoredEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]repository.StoredEvent(nil), s.events...)
+}
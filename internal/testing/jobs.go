@@ -0,0 +1,163 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/internal/repository"
+)
+
+// CommandJobs implements commands.CommandJobStore.
+type CommandJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*repository.CommandJob
+}
+
+func NewCommandJobs() *CommandJobs {
+	return &CommandJobs{jobs: make(map[string]*repository.CommandJob)}
+}
+
+func (s *CommandJobs) Create(ctx context.Context, job *repository.CommandJob, retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; ok {
+		return fmt.Errorf("%w: %s", repository.ErrDuplicateCommand, job.ID)
+	}
+	job.Status = repository.CommandStatusPending
+	job.CreatedAt = time.Now().UTC()
+	job.ExpiresAt = job.CreatedAt.Add(retention)
+	stored := *job
+	s.jobs[job.ID] = &stored
+	return nil
+}
+
+func (s *CommandJobs) Get(ctx context.Context, id string) (*repository.CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.jobs[id]
+	if !ok {
+		return nil, repository.ErrCommandJobNotFound
+	}
+	job := *stored
+	return &job, nil
+}
+
+func (s *CommandJobs) CountPending(ctx context.Context, tenantID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for _, job := range s.jobs {
+		if job.TenantID == tenantID && job.Status == repository.CommandStatusPending {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Running returns the number of running commands per tenant whose heartbeat
+// is younger than staleAfter.
+func (s *CommandJobs) Running(ctx context.Context, staleAfter time.Duration) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since := time.Now().UTC().Add(-staleAfter)
+	running := make(map[string]int)
+	for _, job := range s.jobs {
+		if job.Status == repository.CommandStatusRunning && job.HeartbeatAt != nil && !job.HeartbeatAt.Before(since) {
+			running[job.TenantID]++
+		}
+	}
+	return running, nil
+}
+
+// Claim assigns the oldest pending command of a tenant not in busy to owner.
+func (s *CommandJobs) Claim(ctx context.Context, owner string, busy []string) (*repository.CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	skip := make(map[string]bool, len(busy))
+	for _, tenantID := range busy {
+		skip[tenantID] = true
+	}
+
+	var pending []*repository.CommandJob
+	for _, job := range s.jobs {
+		if job.Status == repository.CommandStatusPending && !skip[job.TenantID] {
+			pending = append(pending, job)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+
+	now := time.Now().UTC()
+	claimed := pending[0]
+	claimed.Status = repository.CommandStatusRunning
+	claimed.Owner = owner
+	claimed.StartedAt = &now
+	claimed.HeartbeatAt = &now
+	job := *claimed
+	return &job, nil
+}
+
+func (s *CommandJobs) Heartbeat(ctx context.Context, job *repository.CommandJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := s.owned(job); stored != nil {
+		now := time.Now().UTC()
+		stored.HeartbeatAt = &now
+	}
+	return nil
+}
+
+// Finish moves job to a terminal status and restarts its retention. A job
+// FailStale has given up on keeps its failure.
+func (s *CommandJobs) Finish(ctx context.Context, job *repository.CommandJob, retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	job.ExpiresAt = now.Add(retention)
+	if stored := s.owned(job); stored != nil {
+		stored.Status = job.Status
+		stored.Result = job.Result
+		stored.Error = job.Error
+		stored.FinishedAt = &now
+		stored.ExpiresAt = job.ExpiresAt
+	}
+	return nil
+}
+
+// FailStale fails running commands whose heartbeat is older than
+// staleAfter.
+func (s *CommandJobs) FailStale(ctx context.Context, staleAfter, retention time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	var failed int64
+	for _, job := range s.jobs {
+		if job.Status != repository.CommandStatusRunning || job.HeartbeatAt == nil || !job.HeartbeatAt.Before(now.Add(-staleAfter)) {
+			continue
+		}
+		job.Status = repository.CommandStatusFailed
+		job.Error = &repository.CommandJobError{
+			Code:    "UNKNOWN",
+			Message: "the command was interrupted; check whether it took effect before retrying",
+		}
+		job.FinishedAt = &now
+		job.ExpiresAt = now.Add(retention)
+		failed++
+	}
+	return failed, nil
+}
+
+// owned returns the stored job if job's owner is still running it.
+func (s *CommandJobs) owned(job *repository.CommandJob) *repository.CommandJob {
+	stored, ok := s.jobs[job.ID]
+	if !ok || stored.Owner != job.Owner || stored.Status != repository.CommandStatusRunning {
+		return nil
+	}
+	return stored
+}
@@ -0,0 +1,194 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+)
+
+// Orders implements commands.OrderRepository. Orders are seeded with
+// Create, since the order service is the one that creates them.
+type Orders struct {
+	rows table[domain.Order]
+}
+
+func NewOrders() *Orders {
+	return &Orders{}
+}
+
+func (r *Orders) Create(ctx context.Context, order *domain.Order) error {
+	if !r.rows.insert(order.ID, order) {
+		return fmt.Errorf("failed to create order: %s already exists", order.ID)
+	}
+	return nil
+}
+
+func (r *Orders) FindByID(ctx context.Context, id uuid.UUID) (*domain.Order, error) {
+	if order, ok := r.rows.get(id); ok {
+		return order, nil
+	}
+	return nil, notFound("order", id)
+}
+
+// Update saves order if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *Orders) Update(ctx context.Context, order *domain.Order) error {
+	next := *order
+	next.Version++
+	if !r.rows.replace(order.ID, &next, func(stored *domain.Order) bool { return stored.Version == order.Version }) {
+		return fmt.Errorf("%w: order %s at version %d", repository.ErrConcurrencyConflict, order.ID, order.Version)
+	}
+	order.Version++
+	return nil
+}
+
+// Products implements commands.ProductReader and
+// commands.ProductCostRepository. Products are seeded with Create.
+type Products struct {
+	rows table[domain.Product]
+}
+
+func NewProducts() *Products {
+	return &Products{}
+}
+
+func (r *Products) Create(ctx context.Context, product *domain.Product) error {
+	if !r.rows.insert(product.ID, product) {
+		return fmt.Errorf("failed to create product: %s already exists", product.ID)
+	}
+	return nil
+}
+
+func (r *Products) FindByID(ctx context.Context, id uuid.UUID) (*domain.Product, error) {
+	if product, ok := r.rows.get(id); ok {
+		return product, nil
+	}
+	return nil, notFound("product", id)
+}
+
+// Update saves product if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *Products) Update(ctx context.Context, product *domain.Product) error {
+	next := *product
+	next.Version++
+	if !r.rows.replace(product.ID, &next, func(stored *domain.Product) bool { return stored.Version == product.Version }) {
+		return fmt.Errorf("%w: product %s at version %d", repository.ErrConcurrencyConflict, product.ID, product.Version)
+	}
+	product.Version++
+	return nil
+}
+
+// Returns implements commands.ReturnAuthorizationRepository.
+type Returns struct {
+	rows table[domain.ReturnAuthorization]
+}
+
+func NewReturns() *Returns {
+	return &Returns{}
+}
+
+func (r *Returns) Create(ctx context.Context, rma *domain.ReturnAuthorization) error {
+	if !r.rows.insert(rma.ID, rma) {
+		return fmt.Errorf("failed to create return: %s already exists", rma.ID)
+	}
+	return nil
+}
+
+func (r *Returns) FindByID(ctx context.Context, id uuid.UUID) (*domain.ReturnAuthorization, error) {
+	if rma, ok := r.rows.get(id); ok {
+		return rma, nil
+	}
+	return nil, fmt.Errorf("return not found: %s", id)
+}
+
+// Update saves rma if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *Returns) Update(ctx context.Context, rma *domain.ReturnAuthorization) error {
+	next := *rma
+	next.Version++
+	if !r.rows.replace(rma.ID, &next, func(stored *domain.ReturnAuthorization) bool { return stored.Version == rma.Version }) {
+		return fmt.Errorf("%w: return %s at version %d", repository.ErrConcurrencyConflict, rma.ID, rma.Version)
+	}
+	rma.Version++
+	return nil
+}
+
+func (r *Returns) FindByOrder(ctx context.Context, tenantID, orderID uuid.UUID) ([]*domain.ReturnAuthorization, error) {
+	return r.rows.find(func(rma *domain.ReturnAuthorization) bool {
+		return rma.TenantID == tenantID && rma.OrderID == orderID
+	}), nil
+}
+
+// DocumentNumbers implements commands.DocumentNumberer with numbers of the
+// form <TYPE>-<sequence>, counted per tenant and document type.
+type DocumentNumbers struct {
+	mu        sync.Mutex
+	sequences map[string]int64
+}
+
+func NewDocumentNumbers() *DocumentNumbers {
+	return &DocumentNumbers{sequences: make(map[string]int64)}
+}
+
+func (n *DocumentNumbers) Next(ctx context.Context, tenantID uuid.UUID, documentType, channel string) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := tenantID.String() + "/" + documentType
+	n.sequences[key]++
+	return fmt.Sprintf("%s-%06d", documentType, n.sequences[key]), nil
+}
+
+// DeliveryRoutes implements commands.DeliveryRouteRepository.
+type DeliveryRoutes struct {
+	rows table[domain.DeliveryRoute]
+}
+
+func NewDeliveryRoutes() *DeliveryRoutes {
+	return &DeliveryRoutes{}
+}
+
+func (r *DeliveryRoutes) Create(ctx context.Context, route *domain.DeliveryRoute) error {
+	if !r.rows.insert(route.ID, route) {
+		return fmt.Errorf("failed to create delivery route: %s already exists", route.ID)
+	}
+	return nil
+}
+
+func (r *DeliveryRoutes) FindByID(ctx context.Context, id uuid.UUID) (*domain.DeliveryRoute, error) {
+	if route, ok := r.rows.get(id); ok {
+		return route, nil
+	}
+	return nil, fmt.Errorf("delivery route not found: %s", id)
+}
+
+// Update saves route if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *DeliveryRoutes) Update(ctx context.Context, route *domain.DeliveryRoute) error {
+	next := *route
+	next.Stops = append([]domain.DeliveryStop(nil), route.Stops...)
+	next.Version++
+	if !r.rows.replace(route.ID, &next, func(stored *domain.DeliveryRoute) bool { return stored.Version == route.Version }) {
+		return fmt.Errorf("%w: delivery route %s at version %d", repository.ErrConcurrencyConflict, route.ID, route.Version)
+	}
+	route.Version++
+	return nil
+}
+
+func (r *DeliveryRoutes) IsShipmentRouted(ctx context.Context, tenantID, shipmentID uuid.UUID) (bool, error) {
+	_, ok := r.rows.first(func(route *domain.DeliveryRoute) bool {
+		if route.TenantID != tenantID {
+			return false
+		}
+		for _, stop := range route.Stops {
+			if stop.ShipmentID == shipmentID && stop.Status != domain.DeliveryStopStatusFailed {
+				return true
+			}
+		}
+		return false
+	})
+	return ok, nil
+}
@@ -0,0 +1,204 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/repository"
+)
+
+// Payments implements commands.PaymentRepository.
+type Payments struct {
+	rows table[domain.Payment]
+}
+
+func NewPayments() *Payments {
+	return &Payments{}
+}
+
+func (r *Payments) Create(ctx context.Context, payment *domain.Payment) error {
+	if !r.rows.insert(payment.ID, payment) {
+		return fmt.Errorf("failed to create payment: %s already exists", payment.ID)
+	}
+	return nil
+}
+
+// Update saves payment if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *Payments) Update(ctx context.Context, payment *domain.Payment) error {
+	next := *payment
+	next.Version++
+	if !r.rows.replace(payment.ID, &next, func(stored *domain.Payment) bool { return stored.Version == payment.Version }) {
+		return fmt.Errorf("%w: payment %s at version %d", repository.ErrConcurrencyConflict, payment.ID, payment.Version)
+	}
+	payment.Version++
+	return nil
+}
+
+func (r *Payments) FindByID(ctx context.Context, id uuid.UUID) (*domain.Payment, error) {
+	if payment, ok := r.rows.get(id); ok {
+		return payment, nil
+	}
+	return nil, fmt.Errorf("payment not found: %s", id)
+}
+
+// FindByInvoiceID returns the invoice's payments, oldest first.
+func (r *Payments) FindByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*domain.Payment, error) {
+	payments := r.rows.find(func(p *domain.Payment) bool { return p.InvoiceID == invoiceID })
+	sort.SliceStable(payments, func(i, j int) bool { return payments[i].CreatedAt.Before(payments[j].CreatedAt) })
+	return payments, nil
+}
+
+// FindByClientID returns the client's payments, oldest first.
+func (r *Payments) FindByClientID(ctx context.Context, tenantID, clientID uuid.UUID) ([]*domain.Payment, error) {
+	payments := r.rows.find(func(p *domain.Payment) bool { return p.TenantID == tenantID && p.ClientID == clientID })
+	sort.SliceStable(payments, func(i, j int) bool { return payments[i].CreatedAt.Before(payments[j].CreatedAt) })
+	return payments, nil
+}
+
+func (r *Payments) FindByProviderID(ctx context.Context, providerID string) (*domain.Payment, error) {
+	if payment, ok := r.rows.first(func(p *domain.Payment) bool { return p.ProviderID == providerID }); ok {
+		return payment, nil
+	}
+	return nil, fmt.Errorf("payment not found for provider ID: %s", providerID)
+}
+
+// BankStatements implements commands.BankStatementRepository. Like the
+// Mongo store it keeps one statement per file fingerprint and one
+// transaction per account and entry reference.
+type BankStatements struct {
+	statements   table[domain.BankStatement]
+	transactions table[domain.BankTransaction]
+}
+
+func NewBankStatements() *BankStatements {
+	return &BankStatements{}
+}
+
+func (r *BankStatements) CreateStatement(ctx context.Context, statement *domain.BankStatement, transactions []*domain.BankTransaction) error {
+	if _, ok := r.statements.first(func(s *domain.BankStatement) bool {
+		return s.TenantID == statement.TenantID && s.Fingerprint == statement.Fingerprint
+	}); ok {
+		return fmt.Errorf("%w: statement already imported", repository.ErrConcurrencyConflict)
+	}
+	for _, transaction := range transactions {
+		if _, ok := r.transactions.first(func(t *domain.BankTransaction) bool {
+			return t.TenantID == transaction.TenantID && t.AccountIBAN == transaction.AccountIBAN &&
+				t.EntryReference == transaction.EntryReference
+		}); ok {
+			return fmt.Errorf("%w: transactions of the statement were imported concurrently", repository.ErrConcurrencyConflict)
+		}
+	}
+
+	r.statements.insert(statement.ID, statement)
+	for _, transaction := range transactions {
+		r.transactions.insert(transaction.ID, transaction)
+	}
+	return nil
+}
+
+func (r *BankStatements) ExistingReferences(ctx context.Context, tenantID uuid.UUID, account string, references []string) (map[string]bool, error) {
+	wanted := make(map[string]bool, len(references))
+	for _, reference := range references {
+		wanted[reference] = true
+	}
+	existing := make(map[string]bool)
+	for _, transaction := range r.transactions.find(func(t *domain.BankTransaction) bool {
+		return t.TenantID == tenantID && t.AccountIBAN == account && wanted[t.EntryReference]
+	}) {
+		existing[transaction.EntryReference] = true
+	}
+	return existing, nil
+}
+
+func (r *BankStatements) FindTransaction(ctx context.Context, id uuid.UUID) (*domain.BankTransaction, error) {
+	if transaction, ok := r.transactions.get(id); ok {
+		return transaction, nil
+	}
+	return nil, fmt.Errorf("bank transaction not found: %s", id)
+}
+
+// UpdateTransaction saves transaction if it is still at the version it was
+// read at, and reports repository.ErrConcurrencyConflict otherwise.
+func (r *BankStatements) UpdateTransaction(ctx context.Context, transaction *domain.BankTransaction) error {
+	next := *transaction
+	next.Version++
+	if !r.transactions.replace(transaction.ID, &next, func(stored *domain.BankTransaction) bool {
+		return stored.Version == transaction.Version
+	}) {
+		return fmt.Errorf("%w: bank transaction %s at version %d", repository.ErrConcurrencyConflict, transaction.ID, transaction.Version)
+	}
+	transaction.Version++
+	return nil
+}
+
+// FindPayers returns the clients whose invoices credits from iban were
+// matched to before.
+func (r *BankStatements) FindPayers(ctx context.Context, tenantID uuid.UUID, iban string) ([]uuid.UUID, error) {
+	seen := make(map[uuid.UUID]bool)
+	payers := []uuid.UUID{}
+	for _, transaction := range r.transactions.find(func(t *domain.BankTransaction) bool {
+		return t.TenantID == tenantID && t.CounterpartyIBAN == iban && t.Status == domain.BankTransactionMatched
+	}) {
+		if transaction.ClientID != nil && !seen[*transaction.ClientID] {
+			seen[*transaction.ClientID] = true
+			payers = append(payers, *transaction.ClientID)
+		}
+	}
+	return payers, nil
+}
+
+// Transactions returns the stored transactions of a statement.
+func (r *BankStatements) Transactions(statementID uuid.UUID) []*domain.BankTransaction {
+	return r.transactions.find(func(t *domain.BankTransaction) bool { return t.StatementID == statementID })
+}
+
+// CashSessions implements commands.CashSessionRepository. Like the Mongo
+// store it allows one open session per register.
+type CashSessions struct {
+	rows table[domain.CashSession]
+}
+
+func NewCashSessions() *CashSessions {
+	return &CashSessions{}
+}
+
+func (r *CashSessions) Create(ctx context.Context, session *domain.CashSession) error {
+	if open, _ := r.FindOpen(ctx, session.TenantID, session.RegisterID); open != nil && session.Status == domain.CashSessionStatusOpen {
+		return fmt.Errorf("%w: register %s already has an open session", repository.ErrConcurrencyConflict, session.RegisterID)
+	}
+	if !r.rows.insert(session.ID, session) {
+		return fmt.Errorf("failed to create cash session: %s already exists", session.ID)
+	}
+	return nil
+}
+
+func (r *CashSessions) FindByID(ctx context.Context, id uuid.UUID) (*domain.CashSession, error) {
+	if session, ok := r.rows.get(id); ok {
+		return session, nil
+	}
+	return nil, fmt.Errorf("cash session not found: %s", id)
+}
+
+// FindOpen returns the open session of a register, or nil.
+func (r *CashSessions) FindOpen(ctx context.Context, tenantID uuid.UUID, registerID string) (*domain.CashSession, error) {
+	session, _ := r.rows.first(func(s *domain.CashSession) bool {
+		return s.TenantID == tenantID && s.RegisterID == registerID && s.Status == domain.CashSessionStatusOpen
+	})
+	return session, nil
+}
+
+// Update saves session if it is still at the version it was read at, and
+// reports repository.ErrConcurrencyConflict otherwise.
+func (r *CashSessions) Update(ctx context.Context, session *domain.CashSession) error {
+	next := *session
+	next.Version++
+	if !r.rows.replace(session.ID, &next, func(stored *domain.CashSession) bool { return stored.Version == session.Version }) {
+		return fmt.Errorf("%w: cash session %s at version %d", repository.ErrConcurrencyConflict, session.ID, session.Version)
+	}
+	session.Version++
+	return nil
+}
@@ -0,0 +1,136 @@
+package testing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ims-erp/system/internal/commands"
+	"github.com/ims-erp/system/internal/events"
+)
+
+// Publisher captures what handlers publish. It implements events.Publisher,
+// commands.Publisher and messaging.EventPublisher.
+type Publisher struct {
+	mu       sync.Mutex
+	events   []*events.EventEnvelope
+	outcomes []*commands.CommandOutcome
+	err      error
+}
+
+func NewPublisher() *Publisher {
+	return &Publisher{}
+}
+
+// PublishEvent records event, or returns the error set with Fail.
+func (p *Publisher) PublishEvent(ctx context.Context, event *events.EventEnvelope) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *Publisher) PublishCommandOutcome(ctx context.Context, outcome *commands.CommandOutcome) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.outcomes = append(p.outcomes, outcome)
+	return nil
+}
+
+func (p *Publisher) Connected() bool {
+	return true
+}
+
+func (p *Publisher) Close() error {
+	return nil
+}
+
+// Fail makes every later publish return err, until it is called with nil.
+func (p *Publisher) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Events returns the published events in order.
+func (p *Publisher) Events() []*events.EventEnvelope {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*events.EventEnvelope(nil), p.events...)
+}
+
+// EventTypes returns the types of the published events in order.
+func (p *Publisher) EventTypes() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	types := make([]string, len(p.events))
+	for i, event := range p.events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+// Outcomes returns the published command outcomes in order.
+func (p *Publisher) Outcomes() []*commands.CommandOutcome {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*commands.CommandOutcome(nil), p.outcomes...)
+}
+
+// Reset forgets what was published so far.
+func (p *Publisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = nil
+	p.outcomes = nil
+}
+
+// Outbox implements commands.EventOutbox. Events enqueued in a transaction
+// are kept only if the transaction succeeds; repository writes made in it
+// are not rolled back.
+type Outbox struct {
+	mu     sync.Mutex
+	events []*events.EventEnvelope
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+type outboxTx struct{}
+
+func (o *Outbox) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	staged := &[]*events.EventEnvelope{}
+	if err := fn(context.WithValue(ctx, outboxTx{}, staged)); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, *staged...)
+	return nil
+}
+
+// Enqueue stages events in the transaction of ctx, or stores them right away
+// outside of one.
+func (o *Outbox) Enqueue(ctx context.Context, batch ...*events.EventEnvelope) error {
+	if staged, ok := ctx.Value(outboxTx{}).(*[]*events.EventEnvelope); ok {
+		*staged = append(*staged, batch...)
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, batch...)
+	return nil
+}
+
+// Events returns the committed events in order.
+func (o *Outbox) Events() []*events.EventEnvelope {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]*events.EventEnvelope(nil), o.events...)
+}
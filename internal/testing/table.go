@@ -0,0 +1,145 @@
+// Package testing provides in-memory implementations of the repositories
+// command and query handlers depend on, a publisher that captures events
+// and a Harness that wires handlers to them, so handlers can be tested
+// without MongoDB, Redis or NATS.
+//
+// Repositories keep copies of what they are given and hand out copies, so a
+// handler's changes are only visible once it saves them. Updates of
+// versioned aggregates are checked like the Mongo stores check them and
+// report repository.ErrConcurrencyConflict when the stored version has moved
+// on. Import the package under another name, such as apptest, next to the
+// standard library's testing.
+package testing
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// table holds copies of rows by ID in insertion order. The zero value is
+// empty and ready to use.
+type table[T any] struct {
+	mu    sync.Mutex
+	rows  map[uuid.UUID]*T
+	order []uuid.UUID
+}
+
+// insert stores a copy of row unless id is taken.
+func (t *table[T]) insert(id uuid.UUID, row *T) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rows == nil {
+		t.rows = make(map[uuid.UUID]*T)
+	}
+	if _, ok := t.rows[id]; ok {
+		return false
+	}
+	stored := *row
+	t.rows[id] = &stored
+	t.order = append(t.order, id)
+	return true
+}
+
+// replace stores a copy of row in place of the row with id if there is one
+// and current accepts it.
+func (t *table[T]) replace(id uuid.UUID, row *T, current func(stored *T) bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.rows[id]
+	if !ok || (current != nil && !current(stored)) {
+		return false
+	}
+	*stored = *row
+	return true
+}
+
+func (t *table[T]) get(id uuid.UUID) (*T, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.rows[id]
+	if !ok {
+		return nil, false
+	}
+	row := *stored
+	return &row, true
+}
+
+func (t *table[T]) remove(id uuid.UUID) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.rows[id]; !ok {
+		return false
+	}
+	delete(t.rows, id)
+	for i, existing := range t.order {
+		if existing == id {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// find returns copies of the rows match accepts, in insertion order. A nil
+// match accepts every row.
+func (t *table[T]) find(match func(row *T) bool) []*T {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rows := []*T{}
+	for _, id := range t.order {
+		stored := t.rows[id]
+		if match == nil || match(stored) {
+			row := *stored
+			rows = append(rows, &row)
+		}
+	}
+	return rows
+}
+
+// first returns a copy of the first row match accepts.
+func (t *table[T]) first(match func(row *T) bool) (*T, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, id := range t.order {
+		if stored := t.rows[id]; match(stored) {
+			row := *stored
+			return &row, true
+		}
+	}
+	return nil, false
+}
+
+// update applies fn to every row match accepts and returns how many it
+// changed.
+func (t *table[T]) update(match func(row *T) bool, fn func(row *T)) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, id := range t.order {
+		if stored := t.rows[id]; match(stored) {
+			fn(stored)
+			n++
+		}
+	}
+	return n
+}
+
+func (t *table[T]) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.rows)
+}
+
+// page returns the rows of a limit/offset page. A limit of zero or less
+// means no limit.
+func page[T any](rows []*T, limit, offset int) []*T {
+	if offset >= len(rows) {
+		return []*T{}
+	}
+	rows = rows[offset:]
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
@@ -0,0 +1,119 @@
+// Package trash purges soft-deleted aggregates once they have been in the
+// trash longer than their tenant's retention.
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Target is a collection with soft-deleted items.
+type Target struct {
+	Name string
+	// Purge permanently removes the items matching filter, including
+	// anything they own outside the collection, and returns how many items
+	// were removed.
+	Purge func(ctx context.Context, filter bson.M) (int, error)
+	// TenantValue converts a tenant ID from the retention settings into the
+	// value stored in the collection's tenantId field. Optional; IDs are
+	// stored as strings by default.
+	TenantValue func(tenantID string) interface{}
+}
+
+// ExpiredFilter matches trashed items whose retention ended before now.
+// Tenants with their own retention are matched separately from the rest.
+func ExpiredFilter(cfg config.TrashConfig, now time.Time, tenantValue func(string) interface{}) bson.M {
+	if tenantValue == nil {
+		tenantValue = func(tenantID string) interface{} { return tenantID }
+	}
+
+	tenantIDs := make([]string, 0, len(cfg.TenantRetention))
+	for tenantID := range cfg.TenantRetention {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+
+	var expired bson.A
+	overridden := bson.A{}
+	for _, tenantID := range tenantIDs {
+		overridden = append(overridden, tenantValue(tenantID))
+		if retention := cfg.TenantRetention[tenantID]; retention > 0 {
+			expired = append(expired, bson.M{
+				"tenantId":                tenantValue(tenantID),
+				repository.DeletedAtField: bson.M{"$lte": now.Add(-retention)},
+			})
+		}
+	}
+
+	others := bson.M{repository.DeletedAtField: bson.M{"$lte": now.Add(-cfg.Retention)}}
+	if len(overridden) > 0 {
+		others["tenantId"] = bson.M{"$nin": overridden}
+	}
+	if len(expired) == 0 {
+		return others
+	}
+	return bson.M{"$or": append(expired, others)}
+}
+
+// Purger periodically purges expired items from its targets.
+type Purger struct {
+	config  config.TrashConfig
+	targets []Target
+	logger  *logger.Logger
+	now     func() time.Time
+}
+
+func NewPurger(cfg config.TrashConfig, log *logger.Logger, targets ...Target) *Purger {
+	return &Purger{
+		config:  cfg,
+		targets: targets,
+		logger:  log,
+		now:     time.Now,
+	}
+}
+
+// Run purges until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.config.PurgeInterval)
+	defer ticker.Stop()
+
+	p.logger.Info("Trash purger started", "interval", p.config.PurgeInterval, "retention", p.config.Retention)
+
+	for {
+		p.PurgeOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			p.logger.Info("Trash purger stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce runs a single purge pass over all targets. A failing target does
+// not stop the others; the failures are returned together.
+func (p *Purger) PurgeOnce(ctx context.Context) error {
+	now := p.now().UTC()
+	var errs []error
+	for _, target := range p.targets {
+		purged, err := target.Purge(ctx, ExpiredFilter(p.config, now, target.TenantValue))
+		if err != nil {
+			p.logger.Error("Failed to purge trash", "target", target.Name, "purged", purged, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+			continue
+		}
+		if purged > 0 {
+			p.logger.Info("Purged trash", "target", target.Name, "purged", purged)
+		}
+	}
+	return errors.Join(errs...)
+}
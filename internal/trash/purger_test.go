@@ -0,0 +1,48 @@
+package trash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestExpiredFilter_DefaultRetention(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	cfg := config.TrashConfig{Retention: 30 * 24 * time.Hour}
+
+	assert.Equal(t, bson.M{
+		"deletedAt": bson.M{"$lte": now.Add(-30 * 24 * time.Hour)},
+	}, ExpiredFilter(cfg, now, nil))
+}
+
+func TestExpiredFilter_TenantRetention(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	cfg := config.TrashConfig{
+		Retention: 30 * 24 * time.Hour,
+		TenantRetention: map[string]time.Duration{
+			"tenant-b": 0,
+			"tenant-a": 7 * 24 * time.Hour,
+		},
+	}
+	prefixed := func(tenantID string) interface{} { return "T:" + tenantID }
+
+	assert.Equal(t, bson.M{"$or": bson.A{
+		bson.M{"tenantId": "T:tenant-a", "deletedAt": bson.M{"$lte": now.Add(-7 * 24 * time.Hour)}},
+		bson.M{
+			"tenantId":  bson.M{"$nin": bson.A{"T:tenant-a", "T:tenant-b"}},
+			"deletedAt": bson.M{"$lte": now.Add(-30 * 24 * time.Hour)},
+		},
+	}}, ExpiredFilter(cfg, now, prefixed))
+}
+
+func TestTrashConfig_RetentionFor(t *testing.T) {
+	cfg := config.TrashConfig{
+		Retention:       time.Hour,
+		TenantRetention: map[string]time.Duration{"tenant-a": 2 * time.Hour},
+	}
+	assert.Equal(t, 2*time.Hour, cfg.RetentionFor("tenant-a"))
+	assert.Equal(t, time.Hour, cfg.RetentionFor("tenant-b"))
+}
@@ -0,0 +1,278 @@
+// Package webhook delivers tenant events to external HTTP endpoints. Events
+// are matched against each tenant's subscriptions and queued as deliveries
+// in MongoDB; a polling worker sends them signed with the subscription
+// secret and retries failures with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ims-erp/system/internal/config"
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/logger"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload is the JSON body posted to subscribers. ID is the event ID and is
+// the same for every delivery of an event, so receivers can deduplicate.
+type Payload struct {
+	ID            string                 `json:"id"`
+	Type          string                 `json:"type"`
+	TenantID      string                 `json:"tenantId"`
+	AggregateID   string                 `json:"aggregateId"`
+	AggregateType string                 `json:"aggregateType"`
+	OccurredAt    time.Time              `json:"occurredAt"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+func NewPayload(event *events.EventEnvelope) Payload {
+	return Payload{
+		ID:            event.ID,
+		Type:          event.Type,
+		TenantID:      event.TenantID,
+		AggregateID:   event.AggregateID,
+		AggregateType: event.AggregateType,
+		OccurredAt:    event.Timestamp,
+		Data:          event.Data,
+	}
+}
+
+// Dispatcher queues deliveries for incoming events and sends them.
+type Dispatcher struct {
+	subscriptions *repository.WebhookSubscriptionStore
+	deliveries    *repository.WebhookDeliveryStore
+	client        *http.Client
+	cfg           config.WebhookConfig
+	logger        *logger.Logger
+	now           func() time.Time
+}
+
+func NewDispatcher(db *repository.MongoDB, cfg config.WebhookConfig, log *logger.Logger) *Dispatcher {
+	return &Dispatcher{
+		subscriptions: repository.NewWebhookSubscriptionStore(db),
+		deliveries:    repository.NewWebhookDeliveryStore(db),
+		client:        &http.Client{Timeout: cfg.Timeout},
+		cfg:           cfg,
+		logger:        log,
+		now:           time.Now,
+	}
+}
+
+func (d *Dispatcher) EnsureIndexes(ctx context.Context) error {
+	if err := d.subscriptions.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	return d.deliveries.EnsureIndexes(ctx, d.cfg.Retention)
+}
+
+// HandleEvent queues a delivery of event for every active subscription of
+// its tenant that matches the event type.
+func (d *Dispatcher) HandleEvent(ctx context.Context, event *events.EventEnvelope) error {
+	if event.TenantID == "" {
+		return nil
+	}
+
+	subs, err := d.subscriptions.List(ctx, event.TenantID, true)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	var deliveries []*domain.WebhookDelivery
+	for i := range subs {
+		if !subs[i].Matches(event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(NewPayload(event)); err != nil {
+				return fmt.Errorf("failed to encode webhook payload: %w", err)
+			}
+		}
+		now := d.now().UTC()
+		deliveries = append(deliveries, &domain.WebhookDelivery{
+			TenantID:       event.TenantID,
+			SubscriptionID: subs[i].ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			URL:            subs[i].URL,
+			Payload:        string(payload),
+			Status:         domain.WebhookDeliveryPending,
+			MaxAttempts:    d.cfg.MaxAttempts,
+			NextAttemptAt:  &now,
+			Log:            []domain.WebhookAttempt{},
+			CreatedAt:      now,
+		})
+	}
+	return d.deliveries.Add(ctx, deliveries...)
+}
+
+// Run sends due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	d.logger.Info("Webhook dispatcher started", "poll_interval", d.cfg.PollInterval, "max_attempts", d.cfg.MaxAttempts)
+
+	for {
+		d.DeliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			d.logger.Info("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends one batch of due deliveries concurrently.
+func (d *Dispatcher) DeliverDue(ctx context.Context) {
+	// The lease outlasts the request so a slow endpoint is not sent the
+	// same delivery twice by another replica.
+	due, err := d.deliveries.ClaimDue(ctx, d.cfg.BatchSize, 2*d.cfg.Timeout)
+	if err != nil {
+		d.logger.Error("Failed to claim webhook deliveries", "error", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range due {
+		wg.Add(1)
+		go func(delivery *domain.WebhookDelivery) {
+			defer wg.Done()
+			d.deliver(ctx, delivery)
+		}(&due[i])
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *domain.WebhookDelivery) {
+	var attempt domain.WebhookAttempt
+	sub, err := d.subscriptions.Get(ctx, delivery.TenantID, delivery.SubscriptionID)
+	switch {
+	case errors.Is(err, repository.ErrWebhookSubscriptionNotFound):
+		// Nothing to retry against; give up on the delivery right away.
+		delivery.MaxAttempts = delivery.Attempts + 1
+		attempt = domain.WebhookAttempt{At: d.now().UTC(), Error: "subscription deleted"}
+	case err != nil:
+		d.logger.Error("Failed to load webhook subscription", "delivery_id", delivery.ID, "error", err)
+		return
+	default:
+		attempt = d.send(ctx, delivery, sub.Secret)
+	}
+
+	delivery.RecordAttempt(attempt, attempt.At.Add(domain.WebhookBackoff(delivery.Attempts+1, d.cfg.BackoffBase, d.cfg.BackoffMax)))
+	if err := d.deliveries.Save(ctx, delivery); err != nil {
+		d.logger.Error("Failed to save webhook delivery", "delivery_id", delivery.ID, "error", err)
+		return
+	}
+
+	switch delivery.Status {
+	case domain.WebhookDeliveryDelivered:
+		d.logger.Debug("Webhook delivered", "delivery_id", delivery.ID, "event_type", delivery.EventType, "attempts", delivery.Attempts)
+	case domain.WebhookDeliveryFailed:
+		d.logger.Warn("Webhook delivery failed",
+			"delivery_id", delivery.ID,
+			"subscription_id", delivery.SubscriptionID,
+			"event_type", delivery.EventType,
+			"attempts", delivery.Attempts,
+			"status_code", delivery.LastStatusCode,
+			"error", delivery.LastError,
+		)
+	}
+}
+
+// send posts the delivery payload once and reports the outcome.
+func (d *Dispatcher) send(ctx context.Context, delivery *domain.WebhookDelivery, secret string) domain.WebhookAttempt {
+	start := d.now().UTC()
+	attempt := domain.WebhookAttempt{At: start}
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ims-erp-webhooks/1.0")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(start.Unix(), 10))
+	req.Header.Set(HeaderSignature, domain.SignWebhook(secret, start, body))
+
+	resp, err := d.client.Do(req)
+	attempt.DurationMs = d.now().Sub(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// Redeliver queues a new delivery of the same payload to the subscription's
+// current URL, regardless of the outcome of the original.
+func (d *Dispatcher) Redeliver(ctx context.Context, tenantID, id string) (*domain.WebhookDelivery, error) {
+	original, err := d.deliveries.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := d.subscriptions.Get(ctx, tenantID, original.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.now().UTC()
+	delivery := &domain.WebhookDelivery{
+		TenantID:       tenantID,
+		SubscriptionID: sub.ID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		URL:            sub.URL,
+		Payload:        original.Payload,
+		Status:         domain.WebhookDeliveryPending,
+		MaxAttempts:    d.cfg.MaxAttempts,
+		NextAttemptAt:  &now,
+		Log:            []domain.WebhookAttempt{},
+		RedeliveryOf:   original.ID,
+		CreatedAt:      now,
+	}
+	if err := d.deliveries.Add(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// newSecret returns a random signing secret for a new subscription.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
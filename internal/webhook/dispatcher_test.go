@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPayload(t *testing.T) {
+	event := events.NewEvent("inv-1", "invoice", "invoice.paid", "tenant-1", "user-1", map[string]interface{}{"amountPaid": "500"})
+
+	raw, err := json.Marshal(NewPayload(event))
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	assert.Equal(t, event.ID, decoded["id"])
+	assert.Equal(t, "invoice.paid", decoded["type"])
+	assert.Equal(t, "tenant-1", decoded["tenantId"])
+	assert.Equal(t, "inv-1", decoded["aggregateId"])
+	assert.Equal(t, map[string]interface{}{"amountPaid": "500"}, decoded["data"])
+	assert.NotContains(t, decoded, "userId")
+}
+
+func TestDispatcher_SendSignsPayload(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	payload := `{"id":"evt-1","type":"invoice.paid"}`
+
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{client: srv.Client(), now: func() time.Time { return now }}
+	attempt := d.send(context.Background(), &domain.WebhookDelivery{
+		ID:        "del-1",
+		EventType: "invoice.paid",
+		URL:       srv.URL,
+		Payload:   payload,
+	}, "secret")
+
+	assert.Equal(t, http.StatusNoContent, attempt.StatusCode)
+	assert.Empty(t, attempt.Error)
+	assert.Equal(t, now, attempt.At)
+	require.NotNil(t, got)
+	assert.Equal(t, payload, string(gotBody))
+	assert.Equal(t, "del-1", got.Header.Get(HeaderID))
+	assert.Equal(t, "invoice.paid", got.Header.Get(HeaderEvent))
+	assert.Equal(t, "1700000000", got.Header.Get(HeaderTimestamp))
+	assert.Equal(t, domain.SignWebhook("secret", now, []byte(payload)), got.Header.Get(HeaderSignature))
+}
+
+func TestDispatcher_SendReportsFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	d := &Dispatcher{client: srv.Client(), now: time.Now}
+	delivery := &domain.WebhookDelivery{URL: srv.URL, Payload: "{}"}
+
+	attempt := d.send(context.Background(), delivery, "secret")
+	assert.Equal(t, http.StatusServiceUnavailable, attempt.StatusCode)
+	assert.Equal(t, "unexpected status 503", attempt.Error)
+
+	srv.Close()
+	attempt = d.send(context.Background(), delivery, "secret")
+	assert.Zero(t, attempt.StatusCode)
+	assert.NotEmpty(t, attempt.Error)
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/internal/domain"
+	"github.com/ims-erp/system/internal/middleware"
+	"github.com/ims-erp/system/internal/repository"
+	"github.com/ims-erp/system/pkg/httpresponse"
+)
+
+// subscriptionRequest is the body of create and update requests. Active
+// defaults to true on create.
+type subscriptionRequest struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"eventTypes"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+// Handler serves the webhook API under /api/v1/webhooks:
+//
+//	GET    /api/v1/webhooks/subscriptions                  list subscriptions
+//	POST   /api/v1/webhooks/subscriptions                  create a subscription
+//	GET    /api/v1/webhooks/subscriptions/{id}             get a subscription
+//	PUT    /api/v1/webhooks/subscriptions/{id}             update a subscription
+//	DELETE /api/v1/webhooks/subscriptions/{id}             delete a subscription
+//	GET    /api/v1/webhooks/deliveries?subscriptionId=&eventId=&status=&limit=
+//	GET    /api/v1/webhooks/deliveries/{id}                delivery with its attempt log
+//	POST   /api/v1/webhooks/deliveries/{id}/redeliver      send the delivery again
+//
+// It runs behind the tenant middleware; everything is scoped to the caller's
+// tenant. The signing secret is only returned when a subscription is created.
+func (d *Dispatcher) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/api/v1/webhooks"), "/")
+		parts := strings.Split(path, "/")
+		tenantID := middleware.GetTenantID(req.Context())
+
+		switch {
+		case path == "subscriptions" && req.Method == http.MethodGet:
+			subs, err := d.subscriptions.List(req.Context(), tenantID, false)
+			if err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			for i := range subs {
+				subs[i].Secret = ""
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": subs})
+
+		case path == "subscriptions" && req.Method == http.MethodPost:
+			var body subscriptionRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+				httpresponse.ErrorStatus(w, req, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			secret, err := newSecret()
+			if err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			sub := &domain.WebhookSubscription{
+				TenantID:    tenantID,
+				URL:         body.URL,
+				Secret:      secret,
+				EventTypes:  body.EventTypes,
+				Description: body.Description,
+				Active:      body.Active == nil || *body.Active,
+				CreatedBy:   middleware.GetUserID(req.Context()),
+			}
+			if err := sub.Validate(); err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			if err := d.subscriptions.Create(req.Context(), sub); err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusCreated, sub)
+
+		case len(parts) == 2 && parts[0] == "subscriptions" && req.Method == http.MethodGet:
+			sub, err := d.subscriptions.Get(req.Context(), tenantID, parts[1])
+			if err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			sub.Secret = ""
+			httpresponse.JSON(w, http.StatusOK, sub)
+
+		case len(parts) == 2 && parts[0] == "subscriptions" && req.Method == http.MethodPut:
+			var body subscriptionRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&body); err != nil {
+				httpresponse.ErrorStatus(w, req, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			sub, err := d.subscriptions.Get(req.Context(), tenantID, parts[1])
+			if err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			sub.URL = body.URL
+			sub.EventTypes = body.EventTypes
+			sub.Description = body.Description
+			if body.Active != nil {
+				sub.Active = *body.Active
+			}
+			if err := sub.Validate(); err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			if err := d.subscriptions.Update(req.Context(), sub); err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			sub.Secret = ""
+			httpresponse.JSON(w, http.StatusOK, sub)
+
+		case len(parts) == 2 && parts[0] == "subscriptions" && req.Method == http.MethodDelete:
+			if err := d.subscriptions.Delete(req.Context(), tenantID, parts[1]); err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case path == "deliveries" && req.Method == http.MethodGet:
+			query := req.URL.Query()
+			limit, _ := strconv.ParseInt(query.Get("limit"), 10, 64)
+			if limit <= 0 || limit > 200 {
+				limit = 50
+			}
+			deliveries, err := d.deliveries.List(req.Context(), tenantID, repository.WebhookDeliveryFilter{
+				SubscriptionID: query.Get("subscriptionId"),
+				EventID:        query.Get("eventId"),
+				Status:         query.Get("status"),
+				Limit:          limit,
+			})
+			if err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, map[string]interface{}{"data": deliveries})
+
+		case len(parts) == 2 && parts[0] == "deliveries" && req.Method == http.MethodGet:
+			delivery, err := d.deliveries.Get(req.Context(), tenantID, parts[1])
+			if err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusOK, delivery)
+
+		case len(parts) == 3 && parts[0] == "deliveries" && parts[2] == "redeliver" && req.Method == http.MethodPost:
+			delivery, err := d.Redeliver(req.Context(), tenantID, parts[1])
+			if err != nil {
+				d.writeError(w, req, err)
+				return
+			}
+			httpresponse.JSON(w, http.StatusAccepted, delivery)
+
+		case path == "subscriptions" || path == "deliveries" ||
+			(len(parts) == 2 && (parts[0] == "subscriptions" || parts[0] == "deliveries")) ||
+			(len(parts) == 3 && parts[0] == "deliveries" && parts[2] == "redeliver"):
+			httpresponse.ErrorStatus(w, req, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			httpresponse.ErrorStatus(w, req, http.StatusNotFound, "not found")
+		}
+	})
+}
+
+func (d *Dispatcher) writeError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidWebhookSubscription):
+		httpresponse.ErrorStatus(w, req, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrWebhookSubscriptionNotFound), errors.Is(err, repository.ErrWebhookDeliveryNotFound):
+		httpresponse.ErrorStatus(w, req, http.StatusNotFound, err.Error())
+	default:
+		d.logger.Error("Webhook request failed", "error", err)
+		httpresponse.ErrorStatus(w, req, http.StatusInternalServerError, "webhook service unavailable")
+	}
+}
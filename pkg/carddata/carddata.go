@@ -0,0 +1,205 @@
+// Package carddata detects cardholder data in API requests. Card numbers
+// (PANs), security codes and track data must never reach our services: card
+// payments are taken by the provider's hosted fields, which keeps the
+// services out of PCI DSS scope. A PAN is recognised as a run of 13 to 19
+// digits, optionally grouped by spaces or dashes, that passes the Luhn
+// check; security codes and the like are recognised by their field names.
+package carddata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Reasons for a finding.
+const (
+	ReasonCardNumber     = "card_number"
+	ReasonSensitiveField = "sensitive_field"
+)
+
+// Finding says where cardholder data was found and why it was taken for
+// such. It never carries the data itself, so that it can be logged.
+type Finding struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// sensitiveNames are field names, lowercased and without separators, that
+// are only ever used for card data.
+var sensitiveNames = map[string]bool{
+	"pan":                  true,
+	"primaryaccountnumber": true,
+	"cardno":               true,
+	"ccnumber":             true,
+	"ccnum":                true,
+	"cid":                  true,
+	"cvc":                  true,
+	"cvc2":                 true,
+	"cvv":                  true,
+	"cvv2":                 true,
+	"csc":                  true,
+	"securitycode":         true,
+	"cardexpiry":           true,
+	"cardexpiration":       true,
+	"expirydate":           true,
+	"expirationdate":       true,
+	"expdate":              true,
+	"expmonth":             true,
+	"expyear":              true,
+	"pin":                  true,
+	"pinblock":             true,
+}
+
+// sensitiveParts are parts of field names, as in customerCardNumber or
+// card_cvv, that mark them as card data wherever they appear.
+var sensitiveParts = []string{
+	"cardnumber",
+	"creditcard",
+	"debitcard",
+	"cardverification",
+	"cvv",
+	"cvc",
+	"securitycode",
+	"trackdata",
+	"track1",
+	"track2",
+	"magstripe",
+	"pinblock",
+}
+
+// SensitiveField reports whether name is the name of a card data field.
+func SensitiveField(name string) bool {
+	normalized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return -1
+	}, name)
+	if sensitiveNames[normalized] {
+		return true
+	}
+	for _, part := range sensitiveParts {
+		if strings.Contains(normalized, part) {
+			return true
+		}
+	}
+	return false
+}
+
+var digitRun = regexp.MustCompile(`\d(?:[ -]?\d)+`)
+
+// ContainsPAN reports whether s contains a card number. Digits that run into
+// letters, as in the hex groups of a UUID, are not taken for one.
+func ContainsPAN(s string) bool {
+	for _, loc := range digitRun.FindAllStringIndex(s, -1) {
+		if loc[0] > 0 && isLetter(s[loc[0]-1]) || loc[1] < len(s) && isLetter(s[loc[1]]) {
+			continue
+		}
+		digits := strings.NewReplacer(" ", "", "-", "").Replace(s[loc[0]:loc[1]])
+		if len(digits) >= 13 && len(digits) <= 19 && Luhn(digits) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Luhn reports whether digits, a string of decimal digits, passes the Luhn
+// check that card numbers carry.
+func Luhn(digits string) bool {
+	if digits == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// ScanJSON returns the card data in a JSON document: fields with card data
+// names, whatever their value, and string or number values holding a card
+// number. Fields are named by their path, as in metadata.note or
+// lines[2].cardNumber, and listed in that order.
+func ScanJSON(body []byte) ([]Finding, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	scan(doc, "", &findings)
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Field < findings[j].Field })
+	return findings, nil
+}
+
+// ScanValues returns the card data in form or query values.
+func ScanValues(values map[string][]string) []Finding {
+	var findings []Finding
+	for key, list := range values {
+		if SensitiveField(key) {
+			findings = append(findings, Finding{Field: key, Reason: ReasonSensitiveField})
+			continue
+		}
+		for _, value := range list {
+			if ContainsPAN(value) {
+				findings = append(findings, Finding{Field: key, Reason: ReasonCardNumber})
+				break
+			}
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Field < findings[j].Field })
+	return findings
+}
+
+func scan(value interface{}, path string, findings *[]Finding) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			if SensitiveField(key) {
+				*findings = append(*findings, Finding{Field: field, Reason: ReasonSensitiveField})
+				continue
+			}
+			scan(child, field, findings)
+		}
+	case []interface{}:
+		for i, child := range v {
+			scan(child, fmt.Sprintf("%s[%d]", path, i), findings)
+		}
+	case string:
+		if ContainsPAN(v) {
+			*findings = append(*findings, Finding{Field: path, Reason: ReasonCardNumber})
+		}
+	case json.Number:
+		if ContainsPAN(v.String()) {
+			*findings = append(*findings, Finding{Field: path, Reason: ReasonCardNumber})
+		}
+	}
+}
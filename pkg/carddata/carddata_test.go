@@ -0,0 +1,83 @@
+package carddata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLuhn(t *testing.T) {
+	assert.True(t, Luhn("4111111111111111"))
+	assert.True(t, Luhn("378282246310005"))
+	assert.False(t, Luhn("4111111111111112"))
+	assert.False(t, Luhn("41111x1111111111"))
+	assert.False(t, Luhn(""))
+}
+
+func TestContainsPAN(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"4111111111111111", true},
+		{"4111 1111 1111 1111", true},
+		{"4111-1111-1111-1111", true},
+		{"card 5555 5555 5555 4444 exp 12/29", true},
+		{"4111111111111112", false},
+		{"411111111111", false},
+		{"550e8400-e29b-41d4-a716-446655440000", false},
+		{"Invoice INV-2026-000042", false},
+		{"500.00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.want, ContainsPAN(tt.value))
+		})
+	}
+}
+
+func TestSensitiveField(t *testing.T) {
+	for _, name := range []string{"cvv", "CVC2", "card_number", "customerCardNumber", "security-code", "expMonth", "track2", "pan"} {
+		assert.True(t, SensitiveField(name), name)
+	}
+	for _, name := range []string{"invoiceId", "amount", "description", "panel", "reference", "order_id"} {
+		assert.False(t, SensitiveField(name), name)
+	}
+}
+
+func TestScanJSON(t *testing.T) {
+	findings, err := ScanJSON([]byte(`{
+		"invoiceId": "550e8400-e29b-41d4-a716-446655440000",
+		"amount": 4111111111111111,
+		"metadata": {"note": "paid with 4111 1111 1111 1111", "order_id": "SO-1"},
+		"card": {"cvv": "123"},
+		"lines": [{"ref": "ok"}, {"ref": "5555555555554444"}]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{
+		{Field: "amount", Reason: ReasonCardNumber},
+		{Field: "card.cvv", Reason: ReasonSensitiveField},
+		{Field: "lines[1].ref", Reason: ReasonCardNumber},
+		{Field: "metadata.note", Reason: ReasonCardNumber},
+	}, findings)
+
+	findings, err = ScanJSON([]byte(`{"invoiceId": "550e8400-e29b-41d4-a716-446655440000", "amount": "500.00"}`))
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+
+	_, err = ScanJSON([]byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestScanValues(t *testing.T) {
+	findings := ScanValues(map[string][]string{
+		"cvc":    {"123"},
+		"q":      {"4111111111111111"},
+		"status": {"completed"},
+	})
+	assert.Equal(t, []Finding{
+		{Field: "cvc", Reason: ReasonSensitiveField},
+		{Field: "q", Reason: ReasonCardNumber},
+	}, findings)
+}
@@ -9,18 +9,22 @@ import (
 type Code string
 
 const (
-	CodeInternalError      Code = "INTERNAL_ERROR"
-	CodeInvalidArgument    Code = "INVALID_ARGUMENT"
-	CodeNotFound           Code = "NOT_FOUND"
-	CodeAlreadyExists      Code = "ALREADY_EXISTS"
-	CodeUnauthorized       Code = "UNAUTHORIZED"
-	CodeForbidden          Code = "FORBIDDEN"
-	CodeConflict           Code = "CONFLICT"
-	CodeUnprocessable      Code = "UNPROCESSABLE_ENTITY"
-	CodeTooManyRequests    Code = "TOO_MANY_REQUESTS"
-	CodeServiceUnavailable Code = "SERVICE_UNAVAILABLE"
-	CodeDeadlineExceeded   Code = "DEADLINE_EXCEEDED"
-	CodeUnknown            Code = "UNKNOWN"
+	CodeInternalError        Code = "INTERNAL_ERROR"
+	CodeInvalidArgument      Code = "INVALID_ARGUMENT"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeAlreadyExists        Code = "ALREADY_EXISTS"
+	CodeUnauthorized         Code = "UNAUTHORIZED"
+	CodeForbidden            Code = "FORBIDDEN"
+	CodeConflict             Code = "CONFLICT"
+	CodeUnprocessable        Code = "UNPROCESSABLE_ENTITY"
+	CodeTooManyRequests      Code = "TOO_MANY_REQUESTS"
+	CodeServiceUnavailable   Code = "SERVICE_UNAVAILABLE"
+	CodeDeadlineExceeded     Code = "DEADLINE_EXCEEDED"
+	CodeMethodNotAllowed     Code = "METHOD_NOT_ALLOWED"
+	CodePayloadTooLarge      Code = "PAYLOAD_TOO_LARGE"
+	CodePreconditionFailed   Code = "PRECONDITION_FAILED"
+	CodePreconditionRequired Code = "PRECONDITION_REQUIRED"
+	CodeUnknown              Code = "UNKNOWN"
 )
 
 type Error struct {
@@ -66,6 +70,14 @@ func (e *Error) StatusCode() int {
 		return http.StatusServiceUnavailable
 	case CodeDeadlineExceeded:
 		return http.StatusGatewayTimeout
+	case CodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case CodePayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodePreconditionFailed:
+		return http.StatusPreconditionFailed
+	case CodePreconditionRequired:
+		return http.StatusPreconditionRequired
 	default:
 		return http.StatusInternalServerError
 	}
@@ -157,6 +169,37 @@ func Conflict(format string, args ...interface{}) *Error {
 	return Newf(CodeConflict, format, args...)
 }
 
+// ConflictDetails tells clients how to recover from an optimistic
+// concurrency conflict.
+type ConflictDetails struct {
+	Resource        string `json:"resource"`
+	ExpectedVersion int64  `json:"expectedVersion,omitempty"`
+	CurrentVersion  int64  `json:"currentVersion,omitempty"`
+	Retryable       bool   `json:"retryable"`
+	Retry           string `json:"retry"`
+}
+
+// VersionConflict reports that resource changed since the client read it.
+// current is zero when the conflict was detected on write and the winning
+// version is not known.
+func VersionConflict(resource string, expected, current int64) *Error {
+	message := fmt.Sprintf("%s was modified concurrently", resource)
+	if current > 0 {
+		message = fmt.Sprintf("%s version mismatch: expected %d, current %d", resource, expected, current)
+	}
+	return &Error{
+		Code:    CodeConflict,
+		Message: message,
+		Details: ConflictDetails{
+			Resource:        resource,
+			ExpectedVersion: expected,
+			CurrentVersion:  current,
+			Retryable:       true,
+			Retry:           "reload the " + resource + ", reapply the change and resend the command with expectedVersion set to the version you read",
+		},
+	}
+}
+
 func InternalError(format string, args ...interface{}) *Error {
 	return Newf(CodeInternalError, format, args...)
 }
@@ -0,0 +1,176 @@
+// Package fieldcrypt encrypts personal data such as email addresses, phone
+// numbers and IBANs field by field before they are stored.
+//
+// Values are sealed with AES-256-GCM under one of several named keys and
+// written as
+//
+//	enc:v1:<key id>:<base64 nonce and ciphertext>
+//
+// so that a value names the key it needs. New values use the active key;
+// values sealed under an older key are still opened until Rotate re-seals
+// them. Values without the prefix are returned as they are, so data stored
+// before encryption was turned on stays readable.
+//
+// Encrypted values cannot be queried. Hash returns a keyed, deterministic
+// digest (a blind index) stored next to the ciphertext for exact lookups.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey = errors.New("unknown encryption key")
+	ErrMalformed  = errors.New("malformed encrypted value")
+)
+
+// Keyring seals and opens values. A nil Keyring leaves values unencrypted,
+// so callers need not check whether encryption is configured.
+type Keyring struct {
+	keys    map[string]cipher.AEAD
+	active  string
+	hashKey []byte
+}
+
+// NewKeyring returns a keyring sealing with keys[active]. Keys are 32 bytes
+// (AES-256). hashKey keys Hash; it must not change, or existing hashes no
+// longer match.
+func NewKeyring(keys map[string][]byte, active string, hashKey []byte) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("%w: active key %q", ErrUnknownKey, active)
+	}
+	if len(hashKey) < 32 {
+		return nil, errors.New("hash key must be at least 32 bytes")
+	}
+	k := &Keyring{keys: make(map[string]cipher.AEAD, len(keys)), active: active, hashKey: hashKey}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// ActiveKey returns the ID of the key new values are sealed with.
+func (k *Keyring) ActiveKey() string {
+	if k == nil {
+		return ""
+	}
+	return k.active
+}
+
+// Encrypt seals plaintext under the active key. Empty and already sealed
+// values are returned unchanged.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if k == nil || plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+	aead := k.keys[k.active]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.active))
+	return prefix + k.active + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt with any key of the keyring.
+// Values that are not sealed are returned unchanged.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	id, payload, ok := split(value)
+	if !ok {
+		return value, nil
+	}
+	if k == nil {
+		return "", fmt.Errorf("%w: %s (encryption is not configured)", ErrUnknownKey, id)
+	}
+	aead, found := k.keys[id]
+	if !found {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return string(plaintext), nil
+}
+
+// Rotate re-seals value under the active key if it is plaintext or sealed
+// under another key, and reports whether it changed.
+func (k *Keyring) Rotate(value string) (string, bool, error) {
+	if k == nil || value == "" {
+		return value, false, nil
+	}
+	if id, _, ok := split(value); ok && id == k.active {
+		return value, false, nil
+	}
+	plaintext, err := k.Decrypt(value)
+	if err != nil {
+		return value, false, err
+	}
+	sealed, err := k.Encrypt(plaintext)
+	if err != nil {
+		return value, false, err
+	}
+	return sealed, true, nil
+}
+
+// Hash returns the blind index of value: an HMAC-SHA256 of its trimmed,
+// lower-cased form, so that lookups ignore case as searches did before.
+// Empty values hash to "".
+func (k *Keyring) Hash(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if k == nil || value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether value was sealed by a Keyring.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the ID of the key value was sealed with, or "" if it is not
+// sealed.
+func KeyID(value string) string {
+	id, _, _ := split(value)
+	return id
+}
+
+func split(value string) (id, payload string, ok bool) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
@@ -0,0 +1,110 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func key(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func newKeyring(t *testing.T, active string) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(map[string][]byte{"k1": key(1), "k2": key(2)}, active, key(9))
+	require.NoError(t, err)
+	return k
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	k := newKeyring(t, "k1")
+
+	sealed, err := k.Encrypt("ap@northwind.example.com")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(sealed))
+	assert.Equal(t, "k1", KeyID(sealed))
+	assert.NotContains(t, sealed, "northwind")
+
+	again, err := k.Encrypt("ap@northwind.example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "nonces must differ")
+
+	opened, err := k.Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "ap@northwind.example.com", opened)
+
+	empty, err := k.Encrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	plain, err := k.Decrypt("stored before encryption")
+	require.NoError(t, err)
+	assert.Equal(t, "stored before encryption", plain)
+}
+
+func TestKeyring_RejectsTamperingAndUnknownKeys(t *testing.T) {
+	k := newKeyring(t, "k1")
+	sealed, err := k.Encrypt("+1 555 0100")
+	require.NoError(t, err)
+
+	tampered := sealed[:len(sealed)-2] + "AA"
+	_, err = k.Decrypt(tampered)
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	_, err = k.Decrypt("enc:v1:k9:AAAA")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	var none *Keyring
+	_, err = none.Decrypt(sealed)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	old := newKeyring(t, "k1")
+	sealed, err := old.Encrypt("DE89370400440532013000")
+	require.NoError(t, err)
+
+	k := newKeyring(t, "k2")
+	rotated, changed, err := k.Rotate(sealed)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "k2", KeyID(rotated))
+
+	opened, err := k.Decrypt(rotated)
+	require.NoError(t, err)
+	assert.Equal(t, "DE89370400440532013000", opened)
+
+	_, changed, err = k.Rotate(rotated)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	fromPlain, changed, err := k.Rotate("legacy@example.com")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "k2", KeyID(fromPlain))
+}
+
+func TestKeyring_Hash(t *testing.T) {
+	k := newKeyring(t, "k1")
+	assert.Equal(t, k.Hash("AP@Northwind.example.com "), k.Hash("ap@northwind.example.com"))
+	assert.NotEqual(t, k.Hash("ap@northwind.example.com"), k.Hash("ar@northwind.example.com"))
+	assert.Empty(t, k.Hash(" "))
+
+	other, err := NewKeyring(map[string][]byte{"k1": key(1)}, "k1", key(8))
+	require.NoError(t, err)
+	assert.NotEqual(t, k.Hash("ap@northwind.example.com"), other.Hash("ap@northwind.example.com"))
+}
+
+func TestNewKeyring_Validates(t *testing.T) {
+	_, err := NewKeyring(map[string][]byte{"k1": key(1)}, "k2", key(9))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = NewKeyring(map[string][]byte{"k1": key(1)[:16]}, "k1", key(9))
+	assert.Error(t, err)
+
+	_, err = NewKeyring(map[string][]byte{"k1": key(1)}, "k1", key(9)[:8])
+	assert.Error(t, err)
+}
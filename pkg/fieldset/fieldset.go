@@ -0,0 +1,208 @@
+// Package fieldset implements sparse fieldsets on read endpoints. A client
+// names the top-level fields it needs, either as ?fields=id,name or, JSON:API
+// style, as ?fields[clients]=id,name; the read model query projects only those
+// fields and the response only carries them. Without either parameter every
+// field is returned.
+package fieldset
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IDField is always selected, so that partial items can still be told apart.
+const IDField = "id"
+
+// Fields maps the JSON names of a model's fields to their BSON names.
+type Fields map[string]string
+
+// Of returns the fields of model, a struct or pointer to one, from its json
+// and bson tags. Fields of inline embedded structs are included.
+func Of(model interface{}) Fields {
+	fields := make(Fields)
+	collect(reflect.TypeOf(model), fields)
+	return fields
+}
+
+func collect(t reflect.Type, fields Fields) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		bsonName, bsonOpts, _ := strings.Cut(f.Tag.Get("bson"), ",")
+		if f.Anonymous && strings.Contains(bsonOpts, "inline") {
+			collect(f.Type, fields)
+			continue
+		}
+		if !f.IsExported() || bsonName == "-" {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = f.Name
+		}
+		if bsonName == "" {
+			bsonName = strings.ToLower(f.Name)
+		}
+		fields[jsonName] = bsonName
+	}
+}
+
+// Set is a selection of fields. The zero Set selects every field.
+type Set struct {
+	names  []string
+	fields Fields
+}
+
+// Parse reads the fieldset requested for resource from query. fields[resource]
+// takes precedence over fields. Names must be JSON field names of fields;
+// anything else is rejected, so that typos do not silently return nothing.
+func Parse(query url.Values, resource string, fields Fields) (Set, error) {
+	raw, ok := query["fields["+resource+"]"]
+	if !ok {
+		raw, ok = query["fields"]
+	}
+	if !ok {
+		return Set{}, nil
+	}
+
+	selected := map[string]bool{IDField: true}
+	for _, value := range raw {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if _, known := fields[name]; !known {
+				return Set{}, errors.InvalidArgument("unknown field %q; fields of %s are %s", name, resource, strings.Join(fields.names(), ", "))
+			}
+			selected[name] = true
+		}
+	}
+
+	set := Set{fields: fields}
+	for name := range selected {
+		if _, known := fields[name]; known {
+			set.names = append(set.names, name)
+		}
+	}
+	sort.Strings(set.names)
+	return set, nil
+}
+
+func (f Fields) names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// All reports whether s selects every field.
+func (s Set) All() bool {
+	return s.names == nil
+}
+
+// Has reports whether s selects the field name, which it does for every
+// name when it selects every field.
+func (s Set) Has(name string) bool {
+	if s.All() {
+		return true
+	}
+	i := sort.SearchStrings(s.names, name)
+	return i < len(s.names) && s.names[i] == name
+}
+
+// CacheKey returns a suffix for the cache keys of views built with s, empty
+// when s selects every field.
+func (s Set) CacheKey() string {
+	if s.All() {
+		return ""
+	}
+	return ":fields=" + strings.Join(s.names, ",")
+}
+
+// Projection returns the MongoDB projection for s, or nil to fetch whole
+// documents. always lists BSON fields the query needs regardless of s, such
+// as the sort key of a paged listing.
+func (s Set) Projection(always ...string) bson.M {
+	if s.All() {
+		return nil
+	}
+	projection := bson.M{"_id": 1}
+	for _, name := range s.names {
+		projection[s.fields[name]] = 1
+	}
+	for _, name := range always {
+		projection[name] = 1
+	}
+	return projection
+}
+
+// Trim returns v, a model or a slice of models, with only the fields in s.
+// It returns v unchanged when s selects every field.
+func (s Set) Trim(v interface{}) interface{} {
+	if s.All() {
+		return v
+	}
+	var decoded interface{}
+	if err := remarshal(v, &decoded); err != nil {
+		return v
+	}
+	return s.trim(decoded)
+}
+
+// TrimIn returns v, a struct holding a list of models under the JSON key
+// key, with that list trimmed to s, for paged results such as
+// {"clients": [...], "total": 3}.
+func (s Set) TrimIn(v interface{}, key string) interface{} {
+	if s.All() {
+		return v
+	}
+	var decoded map[string]interface{}
+	if err := remarshal(v, &decoded); err != nil {
+		return v
+	}
+	decoded[key] = s.trim(decoded[key])
+	return decoded
+}
+
+func (s Set) trim(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, item := range v {
+			v[i] = s.trim(item)
+		}
+		return v
+	case map[string]interface{}:
+		trimmed := make(map[string]interface{}, len(s.names))
+		for _, name := range s.names {
+			if value, ok := v[name]; ok {
+				trimmed[name] = value
+			}
+		}
+		return trimmed
+	}
+	return v
+}
+
+func remarshal(v, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
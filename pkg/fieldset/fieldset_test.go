@@ -0,0 +1,87 @@
+package fieldset
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type base struct {
+	TenantID string `bson:"tenantId" json:"tenantId"`
+}
+
+type client struct {
+	base    `bson:",inline"`
+	ID      string `bson:"_id" json:"id"`
+	Name    string `bson:"name" json:"name"`
+	Email   string `bson:"email" json:"email,omitempty"`
+	Secret  string `bson:"-" json:"secret"`
+	Version int64  `bson:"version" json:"version"`
+}
+
+func TestOf(t *testing.T) {
+	assert.Equal(t, Fields{
+		"tenantId": "tenantId",
+		"id":       "_id",
+		"name":     "name",
+		"email":    "email",
+		"version":  "version",
+	}, Of(&client{}))
+}
+
+func TestParse(t *testing.T) {
+	fields := Of(client{})
+
+	set, err := Parse(url.Values{}, "clients", fields)
+	require.NoError(t, err)
+	assert.True(t, set.All())
+	assert.Empty(t, set.CacheKey())
+	assert.Nil(t, set.Projection("version"))
+
+	set, err = Parse(url.Values{"fields": {"name, email"}}, "clients", fields)
+	require.NoError(t, err)
+	assert.Equal(t, ":fields=email,id,name", set.CacheKey())
+	assert.Equal(t, bson.M{"_id": 1, "name": 1, "email": 1, "version": 1}, set.Projection("version"))
+
+	set, err = Parse(url.Values{"fields": {"email"}, "fields[clients]": {"name"}}, "clients", fields)
+	require.NoError(t, err)
+	assert.Equal(t, ":fields=id,name", set.CacheKey())
+
+	_, err = Parse(url.Values{"fields": {"name,secret"}}, "clients", fields)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errors.CodeInvalidArgument))
+	assert.Contains(t, err.Error(), "email, id, name, tenantId, version")
+}
+
+func TestTrim(t *testing.T) {
+	set, err := Parse(url.Values{"fields": {"name"}}, "clients", Of(client{}))
+	require.NoError(t, err)
+
+	c := client{ID: "c-1", Name: "Acme", Email: "a@acme.test", Version: 3}
+	assert.Equal(t, map[string]interface{}{"id": "c-1", "name": "Acme"}, set.Trim(c))
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": "c-1", "name": "Acme"}}, set.Trim([]client{c}))
+
+	page := struct {
+		Clients []client `json:"clients"`
+		Total   int      `json:"total"`
+	}{Clients: []client{c}, Total: 1}
+	assert.Equal(t, map[string]interface{}{
+		"clients": []interface{}{map[string]interface{}{"id": "c-1", "name": "Acme"}},
+		"total":   float64(1),
+	}, set.TrimIn(page, "clients"))
+
+	assert.Equal(t, c, Set{}.Trim(c))
+}
+
+func TestHas(t *testing.T) {
+	set, err := Parse(url.Values{"fields": {"name,email"}}, "clients", Of(client{}))
+	require.NoError(t, err)
+	assert.True(t, set.Has("name"))
+	assert.True(t, set.Has("email"))
+	assert.False(t, set.Has("version"))
+	assert.True(t, Set{}.Has("version"), "an empty set selects every field")
+}
@@ -0,0 +1,50 @@
+package httpresponse
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/pkg/errors"
+)
+
+// ETag returns the entity tag of a resource at version.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// SetETag sets the ETag header for a resource at version. Resources stored
+// before versions were tracked have version 0 and get no ETag.
+func SetETag(w http.ResponseWriter, version int64) {
+	if version > 0 {
+		w.Header().Set("ETag", ETag(version))
+	}
+}
+
+// ParseETag reads the version from an entity tag such as "3" or W/"3".
+func ParseETag(tag string) (int64, bool) {
+	value := strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), `"`)
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// preconditionFailed reports a version conflict on a request that sent
+// If-Match as a failed precondition, with the current version as ETag so the
+// client knows what to reload.
+func preconditionFailed(w http.ResponseWriter, r *http.Request, appErr *errors.Error) *errors.Error {
+	details, ok := appErr.Details.(errors.ConflictDetails)
+	if !ok || r == nil || r.Header.Get("If-Match") == "" {
+		return appErr
+	}
+	SetETag(w, details.CurrentVersion)
+	details.Retry = "reload the " + details.Resource + " and resend the request with If-Match set to its ETag"
+	return &errors.Error{
+		Code:     errors.CodePreconditionFailed,
+		Message:  appErr.Message,
+		Details:  details,
+		Internal: appErr.Internal,
+	}
+}
@@ -0,0 +1,44 @@
+package httpresponse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseETag(t *testing.T) {
+	for tag, want := range map[string]int64{`"3"`: 3, `W/"12"`: 12, "7": 7} {
+		version, ok := ParseETag(tag)
+		assert.True(t, ok, tag)
+		assert.Equal(t, want, version, tag)
+	}
+	for _, tag := range []string{"", "*", `"abc"`, `"-1"`} {
+		_, ok := ParseETag(tag)
+		assert.False(t, ok, tag)
+	}
+	assert.Equal(t, `"5"`, ETag(5))
+}
+
+func TestError_VersionConflictWithIfMatch(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/api/v1/documents/1", nil)
+	r.Header.Set("If-Match", `"2"`)
+	rec := httptest.NewRecorder()
+
+	Error(rec, r, errors.VersionConflict("document", 2, 3))
+
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	body := decode(t, rec)
+	assert.Equal(t, errors.CodePreconditionFailed, body.Code)
+	details := body.Details.(map[string]interface{})
+	assert.Equal(t, float64(3), details["currentVersion"])
+
+	// Without If-Match the expected version came from the body.
+	rec = httptest.NewRecorder()
+	Error(rec, httptest.NewRequest(http.MethodPost, "/api/v1/commands", nil), errors.VersionConflict("client", 2, 3))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Empty(t, rec.Header().Get("ETag"))
+}
@@ -0,0 +1,150 @@
+// Package httpresponse writes JSON responses in the format shared by all
+// services. Every error response has the shape
+//
+//	{"error": {"code": "NOT_FOUND", "message": "...", "details": ..., "requestId": "...", "traceId": "..."}}
+//
+// where code is a pkg/errors code and requestId and traceId are omitted when
+// the request carries neither. The message, and the messages of validation
+// details, are translated to the language the request asks for with
+// Accept-Language; the code never is.
+package httpresponse
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/i18n"
+	"github.com/ims-erp/system/pkg/logger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ErrorBody struct {
+	Code      errors.Code `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+	TraceID   string      `json:"traceId,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+func JSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// Error writes err with the status of its code. Errors that are not
+// *errors.Error are reported as internal errors without exposing their text.
+// A version conflict on a request that sent If-Match is reported as 412
+// Precondition Failed.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *errors.Error
+	if !stderrors.As(err, &appErr) {
+		appErr = errors.New(errors.CodeInternalError, "internal server error")
+	}
+	appErr = preconditionFailed(w, r, appErr)
+	WriteError(w, r, appErr.StatusCode(), appErr)
+}
+
+// ErrorStatus writes message with the code matching status, for handlers
+// that reject a request without an *errors.Error at hand.
+func ErrorStatus(w http.ResponseWriter, r *http.Request, status int, message string) {
+	WriteError(w, r, status, errors.New(CodeForStatus(status), message))
+}
+
+// WriteError writes appErr with an explicit status, for the few cases where
+// the status is more specific than the code, such as a 502 from a proxy.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, appErr *errors.Error) {
+	locale := i18n.Default
+	if r != nil {
+		locale = i18n.FromRequest(r)
+	}
+	body := ErrorBody{
+		Code:    appErr.Code,
+		Message: i18n.Translate(locale, appErr.Message),
+		Details: translateDetails(locale, appErr.Details),
+	}
+	if r != nil {
+		body.RequestID = RequestID(r)
+		body.TraceID = TraceID(r)
+	}
+	w.Header().Set("Content-Language", locale)
+	JSON(w, status, ErrorResponse{Error: body})
+}
+
+// translateDetails translates the messages of validation errors and leaves
+// other details as they are.
+func translateDetails(locale string, details interface{}) interface{} {
+	violations, ok := details.(errors.ValidationErrors)
+	if !ok || locale == i18n.Default {
+		return details
+	}
+	translated := make(errors.ValidationErrors, len(violations))
+	for i, v := range violations {
+		v.Message = i18n.Translate(locale, v.Message)
+		translated[i] = v
+	}
+	return translated
+}
+
+// RequestID returns the request ID set by the request ID middleware, falling
+// back to the X-Request-ID header forwarded by the gateway.
+func RequestID(r *http.Request) string {
+	if id := logger.GetRequestID(r.Context()); id != "" {
+		return id
+	}
+	return r.Header.Get("X-Request-ID")
+}
+
+func TraceID(r *http.Request) string {
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return logger.GetTraceID(r.Context())
+}
+
+// StatusCode returns the HTTP status for code.
+func StatusCode(code errors.Code) int {
+	return (&errors.Error{Code: code}).StatusCode()
+}
+
+// CodeForStatus returns the error code for an HTTP status.
+func CodeForStatus(status int) errors.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return errors.CodeInvalidArgument
+	case http.StatusUnauthorized:
+		return errors.CodeUnauthorized
+	case http.StatusForbidden:
+		return errors.CodeForbidden
+	case http.StatusNotFound:
+		return errors.CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return errors.CodeMethodNotAllowed
+	case http.StatusConflict:
+		return errors.CodeConflict
+	case http.StatusPreconditionFailed:
+		return errors.CodePreconditionFailed
+	case http.StatusPreconditionRequired:
+		return errors.CodePreconditionRequired
+	case http.StatusRequestEntityTooLarge:
+		return errors.CodePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return errors.CodeUnprocessable
+	case http.StatusTooManyRequests:
+		return errors.CodeTooManyRequests
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return errors.CodeServiceUnavailable
+	case http.StatusGatewayTimeout:
+		return errors.CodeDeadlineExceeded
+	}
+	if status >= 400 && status < 500 {
+		return errors.CodeInvalidArgument
+	}
+	return errors.CodeInternalError
+}
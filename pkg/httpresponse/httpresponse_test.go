@@ -0,0 +1,125 @@
+package httpresponse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/ims-erp/system/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) ErrorBody {
+	t.Helper()
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp.Error
+}
+
+func TestError_AppError(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(logger.WithRequestID(t.Context(), "req-1"),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+	r := httptest.NewRequest(http.MethodGet, "/invoices/1", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	Error(rec, r, fmt.Errorf("lookup: %w", errors.VersionConflict("invoice", 2, 3)))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	body := decode(t, rec)
+	assert.Equal(t, errors.CodeConflict, body.Code)
+	assert.Equal(t, "invoice version mismatch: expected 2, current 3", body.Message)
+	assert.NotNil(t, body.Details)
+	assert.Equal(t, "req-1", body.RequestID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", body.TraceID)
+}
+
+func TestError_HidesInternalErrors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-ID", "gw-7")
+	rec := httptest.NewRecorder()
+
+	Error(rec, r, fmt.Errorf("mongo: connection refused"))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	body := decode(t, rec)
+	assert.Equal(t, errors.CodeInternalError, body.Code)
+	assert.Equal(t, "internal server error", body.Message)
+	assert.Equal(t, "gw-7", body.RequestID)
+	assert.Empty(t, body.TraceID)
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		code   errors.Code
+	}{
+		{http.StatusBadRequest, errors.CodeInvalidArgument},
+		{http.StatusNotFound, errors.CodeNotFound},
+		{http.StatusMethodNotAllowed, errors.CodeMethodNotAllowed},
+		{http.StatusRequestEntityTooLarge, errors.CodePayloadTooLarge},
+		{http.StatusBadGateway, errors.CodeServiceUnavailable},
+		{http.StatusTeapot, errors.CodeInvalidArgument},
+		{http.StatusNotImplemented, errors.CodeInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ErrorStatus(rec, httptest.NewRequest(http.MethodPost, "/", nil), tt.status, "nope")
+
+			assert.Equal(t, tt.status, rec.Code)
+			body := decode(t, rec)
+			assert.Equal(t, tt.code, body.Code)
+			assert.Equal(t, "nope", body.Message)
+		})
+	}
+}
+
+func TestStatusCode_RoundTrip(t *testing.T) {
+	for _, code := range []errors.Code{
+		errors.CodeInvalidArgument, errors.CodeUnauthorized, errors.CodeForbidden, errors.CodeNotFound,
+		errors.CodeMethodNotAllowed, errors.CodeConflict, errors.CodePayloadTooLarge, errors.CodeUnprocessable,
+		errors.CodeTooManyRequests, errors.CodeServiceUnavailable, errors.CodeDeadlineExceeded, errors.CodeInternalError,
+		errors.CodePreconditionFailed, errors.CodePreconditionRequired,
+	} {
+		assert.Equal(t, code, CodeForStatus(StatusCode(code)), code)
+	}
+}
+
+func TestWriteError_TranslatesToAcceptLanguage(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/clients", nil)
+	r.Header.Set("Accept-Language", "de-AT, en;q=0.5")
+	rec := httptest.NewRecorder()
+
+	appErr := errors.InvalidArgument("request body failed schema validation")
+	appErr.Details = errors.ValidationErrors{errors.NewValidationError("name", "is required", nil)}
+	WriteError(rec, r, http.StatusUnprocessableEntity, appErr)
+
+	assert.Equal(t, "de", rec.Header().Get("Content-Language"))
+	var resp struct {
+		Error struct {
+			Code    errors.Code              `json:"code"`
+			Message string                   `json:"message"`
+			Details []errors.ValidationError `json:"details"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, errors.CodeInvalidArgument, resp.Error.Code)
+	assert.Equal(t, "der Anfrageinhalt entspricht nicht dem Schema", resp.Error.Message)
+	require.Len(t, resp.Error.Details, 1)
+	assert.Equal(t, "ist erforderlich", resp.Error.Details[0].Message)
+	assert.Equal(t, "is required", appErr.Details.(errors.ValidationErrors)[0].Message, "the error itself is not changed")
+
+	rec = httptest.NewRecorder()
+	r.Header.Set("Accept-Language", "ja")
+	ErrorStatus(rec, r, http.StatusNotFound, "Invoice not found")
+	assert.Equal(t, "en", rec.Header().Get("Content-Language"))
+	assert.Equal(t, "Invoice not found", decode(t, rec).Message)
+}
@@ -0,0 +1,141 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Catalogs are JSON objects mapping English text to its translation. A key
+// may contain %s, %d or %v verbs; it then translates any message it
+// matches, with the matched arguments substituted in order, or by index
+// with %[n]s, into the translation.
+//
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+var verb = regexp.MustCompile(`%(\[\d+\])?[dsv]`)
+
+type pattern struct {
+	key         string
+	re          *regexp.Regexp
+	translation string
+}
+
+type catalog struct {
+	messages map[string]string
+	patterns []pattern
+}
+
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]*catalog {
+	files, err := catalogFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]*catalog, len(files))
+	for _, file := range files {
+		data, err := catalogFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", file.Name(), err))
+		}
+
+		c := &catalog{messages: make(map[string]string, len(messages))}
+		for key, translation := range messages {
+			if !verb.MatchString(key) {
+				c.messages[strings.ToLower(key)] = translation
+				continue
+			}
+			literals := verb.Split(key, -1)
+			for i, literal := range literals {
+				literals[i] = regexp.QuoteMeta(strings.ToLower(literal))
+			}
+			c.patterns = append(c.patterns, pattern{
+				key:         key,
+				re:          regexp.MustCompile("^" + strings.Join(literals, "(.+?)") + "$"),
+				translation: translation,
+			})
+		}
+		// Longer keys are more specific: "invalid new password: %s" must be
+		// tried before "invalid %s".
+		sort.Slice(c.patterns, func(i, j int) bool {
+			if len(c.patterns[i].key) != len(c.patterns[j].key) {
+				return len(c.patterns[i].key) > len(c.patterns[j].key)
+			}
+			return c.patterns[i].key < c.patterns[j].key
+		})
+		loaded[strings.TrimSuffix(file.Name(), ".json")] = c
+	}
+	return loaded
+}
+
+// Translate returns text in locale, or text itself when the catalog of
+// locale has no translation for it. Matching ignores case; a translation of
+// text starting with a capital letter starts with one too.
+func Translate(locale, text string) string {
+	c := catalogs[locale]
+	if c == nil || text == "" {
+		return text
+	}
+	translated, ok := c.lookup(text)
+	if !ok {
+		return text
+	}
+	if first, _ := utf8.DecodeRuneInString(text); unicode.IsUpper(first) {
+		r, size := utf8.DecodeRuneInString(translated)
+		translated = string(unicode.ToUpper(r)) + translated[size:]
+	}
+	return translated
+}
+
+func (c *catalog) lookup(text string) (string, bool) {
+	lower := strings.ToLower(text)
+	if translated, ok := c.messages[lower]; ok {
+		return translated, true
+	}
+	for _, p := range c.patterns {
+		loc := p.re.FindStringSubmatchIndex(lower)
+		if loc == nil {
+			continue
+		}
+		// Arguments are taken from text, not lower, to keep their case,
+		// unless lowering changed the length of text.
+		source := text
+		if len(lower) != len(text) {
+			source = lower
+		}
+		args := make([]string, 0, len(loc)/2-1)
+		for i := 2; i < len(loc); i += 2 {
+			args = append(args, source[loc[i]:loc[i+1]])
+		}
+		return substitute(p.translation, args), true
+	}
+	return "", false
+}
+
+func substitute(format string, args []string) string {
+	next := 0
+	return verb.ReplaceAllStringFunc(format, func(v string) string {
+		index := next
+		if m := verb.FindStringSubmatch(v); m[1] != "" {
+			fmt.Sscanf(m[1], "[%d]", &index)
+			index--
+		}
+		next = index + 1
+		if index < 0 || index >= len(args) {
+			return v
+		}
+		return args[index]
+	})
+}
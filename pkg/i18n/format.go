@@ -0,0 +1,97 @@
+package i18n
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ims-erp/system/pkg/money"
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// conventions are the number and date conventions of a locale. Separators
+// are limited to characters of Windows-1252 so that documents rendered with
+// the standard PDF fonts can show them.
+type conventions struct {
+	decimal     string
+	group       string
+	date        string
+	symbolFirst bool
+}
+
+var localeConventions = map[string]conventions{
+	"en": {decimal: ".", group: ",", date: "01/02/2006", symbolFirst: true},
+	"de": {decimal: ",", group: ".", date: "02.01.2006"},
+	"fr": {decimal: ",", group: "\u00a0", date: "02/01/2006"},
+	"es": {decimal: ",", group: ".", date: "02/01/2006"},
+}
+
+func conventionsFor(locale string) conventions {
+	if c, ok := localeConventions[locale]; ok {
+		return c
+	}
+	return localeConventions[Default]
+}
+
+// FormatNumber formats value with places decimals and the separators of
+// locale: 1234.5 is "1,234.50" in en and "1.234,50" in de.
+func FormatNumber(locale string, value decimal.Decimal, places int32) string {
+	c := conventionsFor(locale)
+	text := value.StringFixed(places)
+
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign, text = "-", text[1:]
+	}
+	integer, fraction, _ := strings.Cut(text, ".")
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteString(c.group)
+		}
+		grouped.WriteRune(digit)
+	}
+	if fraction != "" {
+		return sign + grouped.String() + c.decimal + fraction
+	}
+	return sign + grouped.String()
+}
+
+// FormatMoney formats amount in the ISO 4217 currency code with the
+// currency's usual number of decimals: 1234.5 EUR is "€1,234.50" in en and
+// "1.234,50 €" in de. Unknown codes are written as is, with two decimals.
+func FormatMoney(locale string, amount decimal.Decimal, code string) string {
+	c := conventionsFor(locale)
+	symbol := strings.ToUpper(code)
+	if unit, err := currency.ParseISO(code); err == nil {
+		symbol = message.NewPrinter(language.Make(locale)).Sprint(currency.Symbol(unit))
+	}
+
+	number := FormatNumber(locale, amount, money.Places(code))
+	if symbol == "" {
+		return number
+	}
+	if !c.symbolFirst {
+		return number + "\u00a0" + symbol
+	}
+	if last := []rune(symbol); unicode.IsLetter(last[len(last)-1]) {
+		return symbol + "\u00a0" + number
+	}
+	if strings.HasPrefix(number, "-") {
+		return "-" + symbol + number[1:]
+	}
+	return symbol + number
+}
+
+// FormatDate formats the calendar date of t in locale: 2026-03-01 is
+// "03/01/2026" in en and "01.03.2026" in de.
+func FormatDate(locale string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(conventionsFor(locale).date)
+}
@@ -0,0 +1,77 @@
+// Package i18n localizes the text the services generate: API error
+// messages, notifications and invoice documents. Messages are written in
+// English in the code and translated through per-locale catalogs keyed by
+// the English text; numbers, amounts and dates are formatted with the
+// conventions of the locale.
+//
+// Locales are BCP 47 tags. Only the language is significant: "de-AT" and
+// "de" both resolve to the supported locale "de".
+package i18n
+
+import (
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+// Default is the locale used when nothing else applies.
+const Default = "en"
+
+// Supported lists the locales with a catalog, Default first.
+var Supported = []string{"en", "de", "fr", "es"}
+
+var matcher = func() language.Matcher {
+	tags := make([]language.Tag, len(Supported))
+	for i, locale := range Supported {
+		tags[i] = language.MustParse(locale)
+	}
+	return language.NewMatcher(tags)
+}()
+
+// Normalize returns the supported locale for locale, or false when locale
+// is not a valid tag or its language is not supported.
+func Normalize(locale string) (string, bool) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", false
+	}
+	base, _ := tag.Base()
+	for _, supported := range Supported {
+		if base.String() == supported {
+			return supported, true
+		}
+	}
+	return "", false
+}
+
+// Resolve returns the first of locales that is supported, or Default. It is
+// called with the most specific preference first, such as a client's
+// locale followed by its tenant's.
+func Resolve(locales ...string) string {
+	for _, locale := range locales {
+		if supported, ok := Normalize(locale); ok {
+			return supported
+		}
+	}
+	return Default
+}
+
+// Match returns the supported locale that best fits an Accept-Language
+// header, or Default.
+func Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return Default
+	}
+	return Supported[index]
+}
+
+// FromRequest returns the locale the caller of r asked for with
+// Accept-Language.
+func FromRequest(r *http.Request) string {
+	return Match(r.Header.Get("Accept-Language"))
+}
@@ -0,0 +1,93 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	for locale, want := range map[string]string{"de": "de", "de-AT": "de", "fr_CA": "fr", "EN-us": "en"} {
+		got, ok := Normalize(locale)
+		assert.True(t, ok, locale)
+		assert.Equal(t, want, got, locale)
+	}
+	for _, locale := range []string{"", "ja", "not a locale"} {
+		_, ok := Normalize(locale)
+		assert.False(t, ok, locale)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert.Equal(t, "fr", Resolve("", "ja", "fr-BE", "de"))
+	assert.Equal(t, "en", Resolve("ja"))
+	assert.Equal(t, "en", Resolve())
+}
+
+func TestMatch(t *testing.T) {
+	assert.Equal(t, "de", Match("de-CH,de;q=0.9,en;q=0.8"))
+	assert.Equal(t, "es", Match("ja, es-MX;q=0.5"))
+	assert.Equal(t, "fr", Match("en;q=0.2, fr"))
+	assert.Equal(t, "en", Match(""))
+	assert.Equal(t, "en", Match("ja"))
+	assert.Equal(t, "en", Match(";;;"))
+}
+
+func TestTranslate(t *testing.T) {
+	assert.Equal(t, "Rechnung nicht gefunden", Translate("de", "invoice not found"))
+	assert.Equal(t, "Methode nicht erlaubt", Translate("de", "Method not allowed"))
+	assert.Equal(t, "Ungültiger Anfrageinhalt", Translate("de", "Invalid request body"))
+	assert.Equal(t, "client introuvable : 7F3A-b", Translate("fr", "client not found: 7F3A-b"))
+	assert.Equal(t, "debe contener al menos 2 elementos", Translate("es", "must contain at least 2 items"))
+	assert.Equal(t, "nuevo contraseña", Translate("xx", "nuevo contraseña"))
+	assert.Equal(t, "invoice not found", Translate("en", "invoice not found"))
+	assert.Equal(t, "something new", Translate("de", "something new"))
+}
+
+func TestPatternsPreferLongerKeys(t *testing.T) {
+	assert.Equal(t, "ungültiges neues Passwort: too short", Translate("de", "invalid new password: too short"))
+	assert.Equal(t, "ungültiges Passwort: too short", Translate("de", "invalid password: too short"))
+}
+
+func TestSubstitute(t *testing.T) {
+	assert.Equal(t, "b then a", substitute("%[2]s then %[1]s", []string{"a", "b"}))
+	assert.Equal(t, "a, b, %s", substitute("%s, %d, %s", []string{"a", "b"}))
+}
+
+func TestCatalogsCoverTheSameMessages(t *testing.T) {
+	for locale, c := range catalogs {
+		assert.Equal(t, len(catalogs["de"].messages), len(c.messages), locale)
+		assert.Equal(t, len(catalogs["de"].patterns), len(c.patterns), locale)
+	}
+	assert.Len(t, catalogs, len(Supported)-1, "every supported locale but the default has a catalog")
+}
+
+func TestFormatNumber(t *testing.T) {
+	value := decimal.RequireFromString("-1234567.891")
+	assert.Equal(t, "-1,234,567.89", FormatNumber("en", value, 2))
+	assert.Equal(t, "-1.234.567,89", FormatNumber("de", value, 2))
+	assert.Equal(t, "-1\u00a0234\u00a0567,891", FormatNumber("fr", value, 3))
+	assert.Equal(t, "12", FormatNumber("es", decimal.RequireFromString("12.4"), 0))
+	assert.Equal(t, "999.00", FormatNumber("xx", decimal.RequireFromString("999"), 2))
+}
+
+func TestFormatMoney(t *testing.T) {
+	amount := decimal.RequireFromString("1234.5")
+	assert.Equal(t, "€1,234.50", FormatMoney("en", amount, "EUR"))
+	assert.Equal(t, "-$1,234.50", FormatMoney("en", amount.Neg(), "USD"))
+	assert.Equal(t, "CHF\u00a01,234.50", FormatMoney("en", amount, "CHF"))
+	assert.Equal(t, "1.234,50\u00a0€", FormatMoney("de", amount, "EUR"))
+	assert.Equal(t, "1\u00a0234,50\u00a0$US", FormatMoney("fr", amount, "USD"))
+	assert.Equal(t, "¥1,235", FormatMoney("en", amount, "JPY"))
+	assert.Equal(t, "1.234,50\u00a0XYZ", FormatMoney("es", amount, "xyz"))
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	assert.Equal(t, "03/01/2026", FormatDate("en", date))
+	assert.Equal(t, "01.03.2026", FormatDate("de", date))
+	assert.Equal(t, "01/03/2026", FormatDate("fr", date))
+	assert.Equal(t, "", FormatDate("de", time.Time{}))
+}
@@ -0,0 +1,199 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/ims-erp/system/pkg/errors"
+)
+
+// Schema is a small subset of JSON Schema (draft 7) covering what request
+// validation needs: types, required fields, nested objects and arrays, enums,
+// string length/pattern and numeric bounds.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func LoadFile(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+	return Parse(data)
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// ValidateJSON decodes data and validates it. A decode failure is returned as
+// the error; schema violations are returned as ValidationErrors.
+func (s *Schema) ValidateJSON(data []byte) (errors.ValidationErrors, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return s.Validate(value), nil
+}
+
+func (s *Schema) Validate(value interface{}) errors.ValidationErrors {
+	var errs errors.ValidationErrors
+	s.validate("", value, &errs)
+	return errs
+}
+
+func (s *Schema) validate(path string, value interface{}, errs *errors.ValidationErrors) {
+	field := path
+	if field == "" {
+		field = "$"
+	}
+
+	if s.Type != "" && !matchesType(s.Type, value) {
+		*errs = append(*errs, errors.NewValidationError(field, "must be of type "+s.Type, nil))
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		*errs = append(*errs, errors.NewValidationError(field, "must be one of the allowed values", value))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, errors.NewValidationError(join(path, name), "is required", nil))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, errors.NewValidationError(join(path, key), "is not allowed", nil))
+				}
+				continue
+			}
+			prop.validate(join(path, key), v[key], errs)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			*errs = append(*errs, errors.NewValidationError(field, fmt.Sprintf("must contain at least %d items", *s.MinItems), nil))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			*errs = append(*errs, errors.NewValidationError(field, fmt.Sprintf("must contain at most %d items", *s.MaxItems), nil))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", field, i), item, errs)
+			}
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			*errs = append(*errs, errors.NewValidationError(field, fmt.Sprintf("must be at least %d characters", *s.MinLength), nil))
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			*errs = append(*errs, errors.NewValidationError(field, fmt.Sprintf("must be at most %d characters", *s.MaxLength), nil))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			*errs = append(*errs, errors.NewValidationError(field, "does not match pattern "+s.Pattern, nil))
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			*errs = append(*errs, errors.NewValidationError(field, fmt.Sprintf("must be >= %v", *s.Minimum), v))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			*errs = append(*errs, errors.NewValidationError(field, fmt.Sprintf("must be <= %v", *s.Maximum), v))
+		}
+	}
+}
+
+func matchesType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return true
+	}
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, candidate := range enum {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
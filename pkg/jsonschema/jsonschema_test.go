@@ -0,0 +1,67 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const paymentSchema = `{
+	"type": "object",
+	"required": ["invoiceId", "amount"],
+	"additionalProperties": false,
+	"properties": {
+		"invoiceId": {"type": "string", "minLength": 1},
+		"amount": {"type": "number", "minimum": 0.01},
+		"currency": {"type": "string", "pattern": "^[A-Z]{3}$"},
+		"method": {"type": "string", "enum": ["card", "bank_transfer", "cash"]},
+		"lines": {"type": "array", "minItems": 1, "items": {"type": "object", "required": ["sku"]}}
+	}
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := Parse([]byte(paymentSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"valid", `{"invoiceId":"inv-1","amount":10.5,"currency":"EUR","method":"card"}`, nil},
+		{"missing required", `{"amount":10}`, []string{"invoiceId"}},
+		{"below minimum", `{"invoiceId":"inv-1","amount":0}`, []string{"amount"}},
+		{"bad pattern", `{"invoiceId":"inv-1","amount":1,"currency":"eur"}`, []string{"currency"}},
+		{"not in enum", `{"invoiceId":"inv-1","amount":1,"method":"crypto"}`, []string{"method"}},
+		{"unknown field", `{"invoiceId":"inv-1","amount":1,"cvv":"123"}`, []string{"cvv"}},
+		{"nested array item", `{"invoiceId":"inv-1","amount":1,"lines":[{"qty":1}]}`, []string{"lines[0].sku"}},
+		{"wrong root type", `[1,2]`, []string{"$"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := schema.ValidateJSON([]byte(tt.body))
+			require.NoError(t, err)
+
+			fields := make([]string, 0, len(errs))
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			assert.ElementsMatch(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestSchema_ValidateJSON_InvalidJSON(t *testing.T) {
+	schema, err := Parse([]byte(`{"type":"object"}`))
+	require.NoError(t, err)
+
+	_, err = schema.ValidateJSON([]byte(`{not json`))
+	assert.Error(t, err)
+}
+
+func TestParse_InvalidPattern(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"string","pattern":"("}`))
+	assert.Error(t, err)
+}
@@ -102,7 +102,7 @@ func New(cfg Config) (*Logger, error) {
 	}
 	options = append(options, zap.AddStacktrace(zapcore.ErrorLevel))
 
-	combinedCore := zapcore.NewTee(cores...)
+	combinedCore := redactingCore{zapcore.NewTee(cores...)}
 	logger := zap.New(combinedCore, options...)
 
 	return &Logger{
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are matched against field keys lower-cased with '_' and '-'
+// removed, so "api_key", "apiKey" and "X-Api-Key" are all redacted.
+var sensitiveKeys = []string{
+	"password",
+	"secret",
+	"token",
+	"apikey",
+	"authorization",
+	"privatekey",
+	"accesskey",
+	"credential",
+}
+
+var secretValues struct {
+	sync.RWMutex
+	values []string
+}
+
+// RegisterSecret masks value wherever it appears in log messages and string
+// fields, e.g. a password embedded in a connection error. Config loading
+// registers every secret it resolves. Values shorter than six characters are
+// ignored to avoid masking ordinary words.
+func RegisterSecret(values ...string) {
+	secretValues.Lock()
+	defer secretValues.Unlock()
+	for _, v := range values {
+		if len(v) < 6 {
+			continue
+		}
+		known := false
+		for _, existing := range secretValues.values {
+			if existing == v {
+				known = true
+				break
+			}
+		}
+		if !known {
+			secretValues.values = append(secretValues.values, v)
+		}
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func maskSecrets(s string) string {
+	secretValues.RLock()
+	defer secretValues.RUnlock()
+	for _, v := range secretValues.values {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, redacted)
+		}
+	}
+	return s
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, f := range fields {
+		replacement, ok := redactField(f)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = append([]zapcore.Field(nil), fields...)
+		}
+		out[i] = replacement
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+func redactField(f zapcore.Field) (zapcore.Field, bool) {
+	if isSensitiveKey(f.Key) {
+		return zap.String(f.Key, redacted), true
+	}
+	switch f.Type {
+	case zapcore.StringType:
+		if masked := maskSecrets(f.String); masked != f.String {
+			return zap.String(f.Key, masked), true
+		}
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			if msg := err.Error(); maskSecrets(msg) != msg {
+				return zap.String(f.Key, maskSecrets(msg)), true
+			}
+		}
+	}
+	return f, false
+}
+
+// redactingCore redacts sensitive fields and registered secret values before
+// they reach the encoder.
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactingCore{c.Core.With(redactFields(fields))}
+}
+
+func (c redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = maskSecrets(ent.Message)
+	return c.Core.Write(ent, redactFields(fields))
+}
@@ -0,0 +1,167 @@
+// Package masking redacts personal data and amounts from API responses, so
+// that staging and demo environments holding copies of production data can
+// be used by people who should not see it. Fields are recognised by their
+// JSON names wherever they occur in a response; each is masked according to
+// its Kind, keeping enough of the value to tell records apart.
+package masking
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind says how a field is masked.
+type Kind int
+
+const (
+	// Name keeps the first letter: "Northwind Traders" becomes "N***".
+	Name Kind = iota + 1
+	// Email keeps the first letter of the local part: "a***@***".
+	Email
+	// Number keeps the last four characters of phone numbers, IBANs and
+	// the like: "***3000".
+	Number
+	// Amount hides the value altogether. Amounts are decimal strings;
+	// numbers are left alone, since a "total" may also be a count of items.
+	Amount
+	// Text hides every string and number, such as the lines of an address.
+	Text
+)
+
+// Redacted replaces masked values.
+const Redacted = "***"
+
+// Rules maps JSON field names to how they are masked.
+type Rules map[string]Kind
+
+// Default covers the client, invoice and payment read models.
+var Default = Rules{
+	"name":             Name,
+	"clientName":       Name,
+	"contactName":      Name,
+	"counterpartyName": Name,
+	"email":            Email,
+	"phone":            Number,
+	"counterpartyIban": Number,
+	"iban":             Number,
+	"street":           Text,
+	"city":             Text,
+	"state":            Text,
+	"postalCode":       Text,
+	"customFields":     Text,
+	"creditLimit":      Amount,
+	"currentBalance":   Amount,
+	"availableCredit":  Amount,
+	"subtotal":         Amount,
+	"taxTotal":         Amount,
+	"discountTotal":    Amount,
+	"total":            Amount,
+	"amountPaid":       Amount,
+	"amountDue":        Amount,
+	"amount":           Amount,
+	"unitPrice":        Amount,
+	"taxAmount":        Amount,
+	"gross":            Amount,
+	"fee":              Amount,
+	"net":              Amount,
+}
+
+// With returns a copy of r with fields masked as kind.
+func (r Rules) With(kind Kind, fields ...string) Rules {
+	rules := make(Rules, len(r)+len(fields))
+	for field, k := range r {
+		rules[field] = k
+	}
+	for _, field := range fields {
+		rules[field] = kind
+	}
+	return rules
+}
+
+// MaskJSON returns the JSON document data with its fields masked.
+func (r Rules) MaskJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(r.Mask(v))
+}
+
+// Mask masks the fields of v, decoded JSON, in place and returns it.
+func (r Rules) Mask(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if kind, ok := r[key]; ok {
+				v[key] = mask(kind, value)
+			} else {
+				v[key] = r.Mask(value)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.Mask(item)
+		}
+	}
+	return v
+}
+
+func mask(kind Kind, v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return String(kind, v)
+	case json.Number, float64:
+		if kind == Text {
+			return nil
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = mask(kind, value)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = mask(kind, item)
+		}
+	}
+	return v
+}
+
+// String masks a single value as kind. Empty values stay empty, so that a
+// masked response still tells missing data from present data.
+func String(kind Kind, value string) string {
+	if strings.TrimSpace(value) == "" {
+		return value
+	}
+	switch kind {
+	case Name:
+		return firstLetter(value) + Redacted
+	case Email:
+		local, _, _ := strings.Cut(value, "@")
+		return firstLetter(local) + Redacted + "@" + Redacted
+	case Number:
+		var kept []rune
+		for _, r := range value {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) <= 6 {
+			return Redacted
+		}
+		return Redacted + string(kept[len(kept)-4:])
+	}
+	return Redacted
+}
+
+func firstLetter(value string) string {
+	r, _ := utf8.DecodeRuneInString(strings.TrimSpace(value))
+	if r == utf8.RuneError {
+		return ""
+	}
+	return string(r)
+}
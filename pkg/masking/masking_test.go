@@ -0,0 +1,36 @@
+package masking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "N***", String(Name, "Northwind Traders"))
+	assert.Equal(t, "Ž***", String(Name, " Žluťoučký kůň"))
+	assert.Equal(t, "a***@***", String(Email, "ap@northwind.example.com"))
+	assert.Equal(t, "***0100", String(Number, "+1 (555) 555-0100"))
+	assert.Equal(t, "***3000", String(Number, "DE89 3704 0044 0532 0130 00"))
+	assert.Equal(t, "***", String(Number, "12-34"))
+	assert.Equal(t, "***", String(Amount, "1250.00"))
+	assert.Equal(t, "", String(Email, ""))
+}
+
+func TestRules_MaskJSON(t *testing.T) {
+	body := []byte(`{"data":{"clients":[{"id":"c1","name":"Northwind","email":"ap@northwind.example.com",` +
+		`"creditLimit":"5000.00","billingAddress":{"street":"1 Main St","city":"Springfield","country":"US"},` +
+		`"customFields":{"vat":"US123","employees":40},"tags":["vip"],"version":3,` +
+		`"accountCredit":[{"currency":"EUR","amount":"35.00","payments":1}]}],"total":1}}`)
+
+	masked, err := Default.With(Text, "tags").MaskJSON(body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"data":{"clients":[{"id":"c1","name":"N***","email":"a***@***",`+
+		`"creditLimit":"***","billingAddress":{"street":"***","city":"***","country":"US"},`+
+		`"customFields":{"vat":"***","employees":null},"tags":["***"],"version":3,`+
+		`"accountCredit":[{"currency":"EUR","amount":"***","payments":1}]}],"total":1}}`, string(masked))
+
+	_, err = Default.MaskJSON([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+	hexIDSegment   = regexp.MustCompile(`^[0-9a-fA-F]{24}$`)
+)
+
+// Handler exposes the default Prometheus registry. OpenMetrics is offered
+// so that scrapers asking for it receive the trace exemplars of the command
+// latency histograms.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
+
+// RoutePattern collapses identifier path segments (UUIDs, Mongo ObjectIDs,
+// numbers) into ":id" so the endpoint label stays low-cardinality.
+func RoutePattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if uuidSegment.MatchString(seg) || numericSegment.MatchString(seg) || hexIDSegment.MatchString(seg) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack keeps websocket upgrades working behind the middleware.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("metrics: response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// HTTPMiddleware records request count, latency and in-flight requests by
+// method, route pattern and status. The /metrics endpoint itself is skipped.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" || RequestsTotal == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		RequestsInFlight.Inc()
+		defer RequestsInFlight.Dec()
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		RecordHTTPRequest(r.Method, RoutePattern(r.URL.Path), strconv.Itoa(status), time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutePattern(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/clients", "/api/v1/clients"},
+		{"/api/v1/clients/0f8fad5b-d9cb-469f-a165-70867728950e", "/api/v1/clients/:id"},
+		{"/api/v1/invoices/42/lines/7", "/api/v1/invoices/:id/lines/:id"},
+		{"/api/v1/documents/507f1f77bcf86cd799439011/download", "/api/v1/documents/:id/download"},
+		{"/api/v1/orders/ORD-2026-000001", "/api/v1/orders/ORD-2026-000001"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, RoutePattern(tt.path), tt.path)
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	Initialize("test")
+	handler := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metrics":
+			return
+		case "/api/v1/payments/42":
+			assert.Equal(t, float64(1), testutil.ToFloat64(RequestsInFlight), "the request is in flight while it is served")
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+
+	for _, path := range []string{"/api/v1/payments/41", "/api/v1/payments/42", "/api/v1/payments/43", "/metrics"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(RequestsTotal.WithLabelValues("GET", "/api/v1/payments/:id", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(RequestsTotal.WithLabelValues("GET", "/api/v1/payments/:id", "404")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(RequestsTotal.WithLabelValues("GET", "/metrics", "200")), "scrapes are not counted")
+	assert.Equal(t, float64(0), testutil.ToFloat64(RequestsInFlight))
+}
+
+func TestStatusWriter_Hijack(t *testing.T) {
+	sw := &statusWriter{ResponseWriter: httptest.NewRecorder()}
+	_, _, err := sw.Hijack()
+	require.Error(t, err, "a writer that cannot be hijacked says so")
+
+	var _ http.Hijacker = sw
+	assert.Equal(t, sw.ResponseWriter, sw.Unwrap())
+}
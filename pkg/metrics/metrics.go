@@ -1,8 +1,14 @@
 package metrics
 
 import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -17,9 +23,41 @@ var (
 	NATSMsgDuration    *prometheus.HistogramVec
 	ServiceHealth      *prometheus.GaugeVec
 	ErrorsTotal        *prometheus.CounterVec
+	RedisOperations    *prometheus.CounterVec
+	RedisDuration      *prometheus.HistogramVec
+	OutboxPending      prometheus.Gauge
+	OutboxLag          prometheus.Gauge
+	OutboxRelayed      *prometheus.CounterVec
+	DeadLettered       *prometheus.CounterVec
+	DLQDepth           *prometheus.GaugeVec
+	ConsumerAcks       *prometheus.CounterVec
+	ConsumerRedelivery *prometheus.CounterVec
+	ConsumerPending    *prometheus.GaugeVec
+	ConsumerAckPending *prometheus.GaugeVec
+	ConsumerRetrying   *prometheus.GaugeVec
+	Throttled          *prometheus.CounterVec
+	DBCommands         *prometheus.CounterVec
+	DBCommandDuration  *prometheus.HistogramVec
+	RedisCommands      *prometheus.CounterVec
+	RedisCmdDuration   *prometheus.HistogramVec
+
+	initOnce sync.Once
 )
 
+// Initialize registers the shared collectors on the default registry. It is
+// safe to call more than once; only the first namespace is used. Service
+// names such as "invoice-service" are converted to valid metric namespaces.
 func Initialize(namespace string) {
+	initOnce.Do(func() {
+		register(sanitizeNamespace(namespace))
+	})
+}
+
+func sanitizeNamespace(namespace string) string {
+	return strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(namespace)
+}
+
+func register(namespace string) {
 	RequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
@@ -120,39 +158,345 @@ func Initialize(namespace string) {
 		},
 		[]string{"type", "component"},
 	)
+
+	RedisOperations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redis_operations_total",
+			Help:      "Total number of Redis operations",
+		},
+		[]string{"operation", "status"},
+	)
+
+	RedisDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "redis_operation_duration_seconds",
+			Help:      "Redis operation duration in seconds",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		},
+		[]string{"operation"},
+	)
+
+	OutboxPending = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "outbox_pending",
+			Help:      "Number of outbox entries waiting to be published",
+		},
+	)
+
+	OutboxLag = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "outbox_lag_seconds",
+			Help:      "Age of the oldest undelivered outbox entry in seconds",
+		},
+	)
+
+	OutboxRelayed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "outbox_relayed_total",
+			Help:      "Total number of outbox entries relayed to NATS",
+		},
+		[]string{"status"},
+	)
+
+	DeadLettered = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dead_lettered_total",
+			Help:      "Total number of messages moved to the dead-letter queue",
+		},
+		[]string{"stream", "consumer"},
+	)
+
+	DLQDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dlq_depth",
+			Help:      "Number of messages waiting in the dead-letter queue",
+		},
+		[]string{"stream"},
+	)
+
+	ConsumerAcks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "consumer_acks_total",
+			Help:      "Total number of JetStream messages acked, nak'd or terminated by a consumer",
+		},
+		[]string{"stream", "consumer", "result"},
+	)
+
+	ConsumerRedelivery = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "consumer_redeliveries_total",
+			Help:      "Total number of JetStream messages received more than once by a consumer",
+		},
+		[]string{"stream", "consumer"},
+	)
+
+	ConsumerPending = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "consumer_pending_messages",
+			Help:      "Number of stream messages not yet delivered to a JetStream consumer",
+		},
+		[]string{"stream", "consumer"},
+	)
+
+	ConsumerAckPending = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "consumer_ack_pending_messages",
+			Help:      "Number of messages delivered to a JetStream consumer and awaiting an ack",
+		},
+		[]string{"stream", "consumer"},
+	)
+
+	ConsumerRetrying = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "consumer_redelivered_messages",
+			Help:      "Number of unacked messages a JetStream consumer has delivered more than once",
+		},
+		[]string{"stream", "consumer"},
+	)
+
+	Throttled = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_throttled_total",
+			Help:      "Total number of requests to expensive endpoints rejected for exceeding a rate limit",
+		},
+		[]string{"class", "scope"},
+	)
+
+	DBCommands = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_commands_total",
+			Help:      "Total number of MongoDB commands sent by the driver",
+		},
+		[]string{"command", "collection", "status"},
+	)
+
+	DBCommandDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_command_duration_seconds",
+			Help:      "MongoDB command round trip in seconds, with trace exemplars",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+		[]string{"command", "collection"},
+	)
+
+	RedisCommands = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redis_commands_total",
+			Help:      "Total number of Redis commands sent by the client",
+		},
+		[]string{"command", "status"},
+	)
+
+	RedisCmdDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "redis_command_duration_seconds",
+			Help:      "Redis command round trip in seconds, with trace exemplars",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		},
+		[]string{"command"},
+	)
+}
+
+func statusLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
 }
 
 func RecordCacheHit(cacheType string) {
+	if CacheHits == nil {
+		return
+	}
 	CacheHits.WithLabelValues(cacheType).Inc()
 }
 
 func RecordCacheMiss(cacheType string) {
+	if CacheMisses == nil {
+		return
+	}
 	CacheMisses.WithLabelValues(cacheType).Inc()
 }
 
 func RecordDBOperation(operation, collection string, duration float64) {
+	if DatabaseOperations == nil {
+		return
+	}
 	DatabaseOperations.WithLabelValues(operation, collection).Inc()
 	DatabaseDuration.WithLabelValues(operation, collection).Observe(duration)
 }
 
 func RecordNATSMessage(subject, direction string, status string, duration float64) {
+	if NATSMessages == nil {
+		return
+	}
 	NATSMessages.WithLabelValues(subject, direction, status).Inc()
 	NATSMsgDuration.WithLabelValues(subject).Observe(duration)
 }
 
 func RecordHTTPRequest(method, endpoint, status string, duration float64) {
+	if RequestsTotal == nil {
+		return
+	}
 	RequestsTotal.WithLabelValues(method, endpoint, status).Inc()
 	RequestDuration.WithLabelValues(method, endpoint).Observe(duration)
 }
 
 func RecordError(errorType, component string) {
+	if ErrorsTotal == nil {
+		return
+	}
 	ErrorsTotal.WithLabelValues(errorType, component).Inc()
 }
 
 func SetServiceHealth(component string, healthy bool) {
+	if ServiceHealth == nil {
+		return
+	}
 	var value float64
 	if healthy {
 		value = 1
 	}
 	ServiceHealth.WithLabelValues(component).Set(value)
 }
+
+// ObserveDB records a MongoDB call started at start, counting failures as
+// errors against the collection.
+func ObserveDB(operation, collection string, start time.Time, err error) {
+	RecordDBOperation(operation, collection, time.Since(start).Seconds())
+	if err != nil {
+		RecordError("db_"+operation, collection)
+	}
+}
+
+// ObserveRedis records a Redis call started at start.
+func ObserveRedis(operation string, start time.Time, err error) {
+	if RedisOperations == nil {
+		return
+	}
+	RedisOperations.WithLabelValues(operation, statusLabel(err)).Inc()
+	RedisDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// ObserveNATS records a published or consumed message on subject.
+func ObserveNATS(subject, direction string, start time.Time, err error) {
+	RecordNATSMessage(subject, direction, statusLabel(err), time.Since(start).Seconds())
+}
+
+// SetOutboxBacklog reports the outbox depth and the age of its oldest entry.
+func SetOutboxBacklog(pending int64, lag time.Duration) {
+	if OutboxPending == nil {
+		return
+	}
+	OutboxPending.Set(float64(pending))
+	OutboxLag.Set(lag.Seconds())
+}
+
+func RecordOutboxRelay(err error) {
+	if OutboxRelayed == nil {
+		return
+	}
+	OutboxRelayed.WithLabelValues(statusLabel(err)).Inc()
+}
+
+func RecordDeadLetter(stream, consumer string) {
+	if DeadLettered == nil {
+		return
+	}
+	DeadLettered.WithLabelValues(stream, consumer).Inc()
+}
+
+func SetDLQDepth(stream string, depth uint64) {
+	if DLQDepth == nil {
+		return
+	}
+	DLQDepth.WithLabelValues(stream).Set(float64(depth))
+}
+
+// RecordConsumerAck counts how a JetStream consumer settled a message:
+// "ack", "nak" or "term".
+func RecordConsumerAck(stream, consumer, result string) {
+	if ConsumerAcks == nil {
+		return
+	}
+	ConsumerAcks.WithLabelValues(stream, consumer, result).Inc()
+}
+
+func RecordConsumerRedelivery(stream, consumer string) {
+	if ConsumerRedelivery == nil {
+		return
+	}
+	ConsumerRedelivery.WithLabelValues(stream, consumer).Inc()
+}
+
+// SetConsumerState reports a JetStream consumer's backlog as last read from
+// the server.
+func SetConsumerState(stream, consumer string, pending, ackPending, redelivered uint64) {
+	if ConsumerPending == nil {
+		return
+	}
+	ConsumerPending.WithLabelValues(stream, consumer).Set(float64(pending))
+	ConsumerAckPending.WithLabelValues(stream, consumer).Set(float64(ackPending))
+	ConsumerRetrying.WithLabelValues(stream, consumer).Set(float64(redelivered))
+}
+
+// RecordThrottle counts a request to an endpoint of class rejected by its
+// "ip" or "user" rate limit.
+func RecordThrottle(class, scope string) {
+	if Throttled == nil {
+		return
+	}
+	Throttled.WithLabelValues(class, scope).Inc()
+}
+
+// ObserveDBCommand records a MongoDB command as seen by the driver. Unlike
+// ObserveDB, which times repository operations, it counts every round trip,
+// including cursor getMores and the commands of a transaction.
+func ObserveDBCommand(ctx context.Context, command, collection string, duration time.Duration, err error) {
+	if DBCommands == nil {
+		return
+	}
+	DBCommands.WithLabelValues(command, collection, statusLabel(err)).Inc()
+	observeWithExemplar(ctx, DBCommandDuration.WithLabelValues(command, collection), duration.Seconds())
+}
+
+// ObserveRedisCommand records a Redis command as sent by the client.
+func ObserveRedisCommand(ctx context.Context, command string, duration time.Duration, err error) {
+	if RedisCommands == nil {
+		return
+	}
+	RedisCommands.WithLabelValues(command, statusLabel(err)).Inc()
+	observeWithExemplar(ctx, RedisCmdDuration.WithLabelValues(command), duration.Seconds())
+}
+
+// observeWithExemplar observes value and, when ctx carries a sampled span,
+// attaches its trace and span ID so a slow bucket links to the trace.
+func observeWithExemplar(ctx context.Context, observer prometheus.Observer, value float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	eo, ok := observer.(prometheus.ExemplarObserver)
+	if !ok || !sc.IsSampled() {
+		observer.Observe(value)
+		return
+	}
+	eo.ObserveWithExemplar(value, prometheus.Labels{
+		"trace_id": sc.TraceID().String(),
+		"span_id":  sc.SpanID().String(),
+	})
+}
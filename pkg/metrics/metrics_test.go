@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func sampledContext(t *testing.T) (context.Context, trace.SpanContext) {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+	return trace.ContextWithSpanContext(context.Background(), sc), sc
+}
+
+func scrapeOpenMetrics(t *testing.T) string {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/openmetrics-text")
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+// assertExemplar checks that the series line in body carries sc as its
+// exemplar. Exemplar labels are not written in a fixed order.
+func assertExemplar(t *testing.T, body, series string, sc trace.SpanContext) {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			assert.Contains(t, line, `trace_id="`+sc.TraceID().String()+`"`, line)
+			assert.Contains(t, line, `span_id="`+sc.SpanID().String()+`"`, line)
+			return
+		}
+	}
+	t.Errorf("no %s series in the scrape", series)
+}
+
+func TestObserveDBCommand(t *testing.T) {
+	Initialize("test")
+	ctx, sc := sampledContext(t)
+
+	ObserveDBCommand(ctx, "find", "invoice_read", 30*time.Millisecond, nil)
+	ObserveDBCommand(context.Background(), "find", "invoice_read", 2*time.Millisecond, errors.New("timeout"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(DBCommands.WithLabelValues("find", "invoice_read", "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(DBCommands.WithLabelValues("find", "invoice_read", "error")))
+
+	body := scrapeOpenMetrics(t)
+	assertExemplar(t, body, `test_db_command_duration_seconds_bucket{collection="invoice_read",command="find",le="0.05"}`, sc)
+}
+
+func TestObserveRedisCommand(t *testing.T) {
+	Initialize("test")
+	ctx, sc := sampledContext(t)
+
+	ObserveRedisCommand(ctx, "get", 3*time.Millisecond, nil)
+	ObserveRedisCommand(context.Background(), "set", time.Millisecond, nil)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(RedisCommands.WithLabelValues("get", "ok")))
+	body := scrapeOpenMetrics(t)
+	assertExemplar(t, body, `test_redis_command_duration_seconds_bucket{command="get",le="0.005"}`, sc)
+	assert.Contains(t, body, `test_redis_command_duration_seconds_count{command="set"} 1`, "unsampled commands are observed without an exemplar")
+}
+
+func TestObserveDB(t *testing.T) {
+	Initialize("test")
+
+	ObserveDB("find_one", "client_read", time.Now(), nil)
+	ObserveDB("find_one", "client_read", time.Now(), errors.New("timeout"))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(DatabaseOperations.WithLabelValues("find_one", "client_read")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ErrorsTotal.WithLabelValues("db_find_one", "client_read")), "failed calls are counted as errors")
+}
+
+func TestObserveRedis(t *testing.T) {
+	Initialize("test")
+
+	ObserveRedis("del", time.Now(), nil)
+	ObserveRedis("del", time.Now(), errors.New("connection refused"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(RedisOperations.WithLabelValues("del", "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(RedisOperations.WithLabelValues("del", "error")))
+}
+
+func TestObserveNATS(t *testing.T) {
+	Initialize("test")
+
+	ObserveNATS("evt.invoice.sent", "publish", time.Now(), nil)
+	ObserveNATS("evt.invoice.sent", "consume", time.Now(), errors.New("no responders"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(NATSMessages.WithLabelValues("evt.invoice.sent", "publish", "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(NATSMessages.WithLabelValues("evt.invoice.sent", "consume", "error")))
+}
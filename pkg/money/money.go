@@ -0,0 +1,154 @@
+// Package money handles monetary amounts. Amounts are decimal.Decimal from
+// the request body to the event store and are never converted to float64;
+// they are rounded to the minor unit of their currency, half away from zero,
+// so that JPY amounts have no decimals and KWD amounts have three.
+//
+// Requests give an amount either as a decimal string or JSON number, such as
+// "amount": "12.30", or as an integer number of minor units, such as
+// "amountMinor": 1230 for 12.30 USD.
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/currency"
+)
+
+// DefaultPlaces is the number of decimals of currencies ISO 4217 does not
+// know.
+const DefaultPlaces = 2
+
+// Places returns the number of decimals of the minor unit of currency, an
+// ISO 4217 code: 2 for USD, 0 for JPY and 3 for KWD.
+func Places(code string) int32 {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return DefaultPlaces
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	return int32(scale)
+}
+
+// Round rounds amount to the minor unit of currency, half away from zero.
+func Round(amount decimal.Decimal, code string) decimal.Decimal {
+	return amount.Round(Places(code))
+}
+
+// FromMinor returns the amount of minor units of currency: 1230 USD cents
+// is 12.30, 1230 JPY is 1230.
+func FromMinor(minor int64, code string) decimal.Decimal {
+	return decimal.New(minor, -Places(code))
+}
+
+// ToMinor returns amount in minor units of currency, rounding it first.
+func ToMinor(amount decimal.Decimal, code string) int64 {
+	return Round(amount, code).Shift(Places(code)).IntPart()
+}
+
+// Money is an amount in a currency.
+type Money struct {
+	Amount   decimal.Decimal `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// New returns amount in currency, rounded to its minor unit.
+func New(amount decimal.Decimal, code string) Money {
+	code = strings.ToUpper(code)
+	return Money{Amount: Round(amount, code), Currency: code}
+}
+
+// Zero returns no money in currency.
+func Zero(code string) Money {
+	return New(decimal.Zero, code)
+}
+
+// Add returns m plus other, which must be in the same currency.
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount.Add(other.Amount), Currency: m.Currency}
+}
+
+// Sub returns m minus other, which must be in the same currency.
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount.Sub(other.Amount), Currency: m.Currency}
+}
+
+// Minor returns m in minor units of its currency.
+func (m Money) Minor() int64 {
+	return ToMinor(m.Amount, m.Currency)
+}
+
+// String returns m with all decimals of its currency, such as "12.30 USD".
+func (m Money) String() string {
+	return m.Amount.StringFixed(Places(m.Currency)) + " " + m.Currency
+}
+
+// Parse reads the amount under key from command data or a JSON body decoded
+// into a map. The amount is a decimal string or json.Number under key, or an
+// integer number of minor units under key+"Minor". A float64 under key, as
+// decoded by encoding/json without UseNumber, is rejected because it may
+// already have lost precision. ok is false when neither key is present.
+// Amounts with more decimals than the currency has are rejected rather than
+// rounded.
+func Parse(data map[string]interface{}, key, code string) (amount decimal.Decimal, ok bool, err error) {
+	if minor, present := data[key+"Minor"]; present && minor != nil {
+		units, err := minorUnits(minor)
+		if err != nil {
+			return decimal.Zero, true, errors.InvalidArgument("%sMinor must be an integer", key)
+		}
+		return FromMinor(units, code), true, nil
+	}
+
+	var text string
+	switch v := data[key].(type) {
+	case nil:
+		return decimal.Zero, false, nil
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case decimal.Decimal:
+		return checkPlaces(key, v, code)
+	default:
+		return decimal.Zero, true, errors.InvalidArgument("%s must be a decimal string", key)
+	}
+	amount, err = decimal.NewFromString(strings.TrimSpace(text))
+	if err != nil {
+		return decimal.Zero, true, errors.InvalidArgument("%s is not a valid amount: %s", key, text)
+	}
+	return checkPlaces(key, amount, code)
+}
+
+func checkPlaces(key string, amount decimal.Decimal, code string) (decimal.Decimal, bool, error) {
+	if !Round(amount, code).Equal(amount) {
+		return decimal.Zero, true, errors.InvalidArgument("%s has more than %d decimals for %s", key, Places(code), strings.ToUpper(code))
+	}
+	return amount, true, nil
+}
+
+// minorUnits accepts the integer types a minor unit count arrives as:
+// int64 from Go callers, json.Number or a string, and float64 from
+// encoding/json when the value is a whole number small enough to be exact.
+func minorUnits(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case json.Number:
+		return n.Int64()
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return 0, fmt.Errorf("not an exact integer: %v", n)
+		}
+		return int64(n), nil
+	}
+	return 0, fmt.Errorf("unsupported type %T", v)
+}
@@ -0,0 +1,99 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/quick"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaces(t *testing.T) {
+	assert.Equal(t, int32(2), Places("USD"))
+	assert.Equal(t, int32(2), Places("eur"))
+	assert.Equal(t, int32(0), Places("JPY"))
+	assert.Equal(t, int32(3), Places("KWD"))
+	assert.Equal(t, int32(DefaultPlaces), Places("XYZ"))
+	assert.Equal(t, int32(DefaultPlaces), Places(""))
+}
+
+func TestRound(t *testing.T) {
+	assert.Equal(t, "10.01", Round(decimal.RequireFromString("10.005"), "USD").String())
+	assert.Equal(t, "-10.01", Round(decimal.RequireFromString("-10.005"), "USD").String())
+	assert.Equal(t, "1235", Round(decimal.RequireFromString("1234.5"), "JPY").String())
+	assert.Equal(t, "1.235", Round(decimal.RequireFromString("1.2345"), "KWD").String())
+}
+
+func TestMinorUnits(t *testing.T) {
+	assert.Equal(t, "12.3", FromMinor(1230, "USD").String())
+	assert.Equal(t, "1230", FromMinor(1230, "JPY").String())
+	assert.Equal(t, int64(1230), ToMinor(decimal.RequireFromString("12.30"), "USD"))
+	assert.Equal(t, int64(1235), ToMinor(decimal.RequireFromString("1234.5"), "JPY"))
+}
+
+func TestMoney(t *testing.T) {
+	price := New(decimal.RequireFromString("19.999"), "usd")
+	assert.Equal(t, "20.00 USD", price.String())
+	assert.Equal(t, int64(2000), price.Minor())
+
+	total := price.Add(New(decimal.RequireFromString("0.5"), "USD")).Sub(New(decimal.NewFromInt(1), "USD"))
+	assert.Equal(t, "19.50 USD", total.String())
+	assert.Equal(t, "0 JPY", Zero("JPY").String())
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		code string
+		want string
+		ok   bool
+		err  string
+	}{
+		{name: "string", data: map[string]interface{}{"amount": "12.30"}, code: "USD", want: "12.3", ok: true},
+		{name: "json number", data: map[string]interface{}{"amount": json.Number("0.1")}, code: "USD", want: "0.1", ok: true},
+		{name: "minor units", data: map[string]interface{}{"amountMinor": json.Number("1230")}, code: "USD", want: "12.3", ok: true},
+		{name: "minor units win", data: map[string]interface{}{"amount": "1", "amountMinor": "5"}, code: "JPY", want: "5", ok: true},
+		{name: "absent", data: map[string]interface{}{}, code: "USD", want: "0"},
+		{name: "float", data: map[string]interface{}{"amount": 0.1}, code: "USD", want: "0", ok: true, err: "amount must be a decimal string"},
+		{name: "too precise", data: map[string]interface{}{"amount": "1.005"}, code: "usd", want: "0", ok: true, err: "amount has more than 2 decimals for USD"},
+		{name: "not a number", data: map[string]interface{}{"amount": "ten"}, code: "USD", want: "0", ok: true, err: "amount is not a valid amount: ten"},
+		{name: "fractional minor units", data: map[string]interface{}{"amountMinor": 12.5}, code: "USD", want: "0", ok: true, err: "amountMinor must be an integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, ok, err := Parse(tt.data, "amount", tt.code)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, amount.String())
+		})
+	}
+}
+
+var currencies = []string{"USD", "EUR", "JPY", "KWD", "CHF"}
+
+func TestMinorUnitsRoundTrip(t *testing.T) {
+	property := func(minor int64, pick uint8) bool {
+		code := currencies[int(pick)%len(currencies)]
+		return ToMinor(FromMinor(minor, code), code) == minor
+	}
+	assert.NoError(t, quick.Check(property, nil))
+}
+
+func TestRoundIsIdempotentAndClose(t *testing.T) {
+	property := func(units int64, exp uint8, pick uint8) bool {
+		code := currencies[int(pick)%len(currencies)]
+		amount := decimal.New(units, -int32(exp%8))
+		rounded := Round(amount, code)
+		halfUnit := decimal.New(5, -Places(code)-1)
+		return Round(rounded, code).Equal(rounded) &&
+			rounded.Sub(amount).Abs().LessThanOrEqual(halfUnit)
+	}
+	assert.NoError(t, quick.Check(property, nil))
+}
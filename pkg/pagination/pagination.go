@@ -0,0 +1,110 @@
+// Package pagination implements keyset (cursor) pagination over MongoDB
+// collections. A cursor is an opaque string holding the sort key and _id of
+// the last item of a page; the next page starts strictly after that item, so
+// unlike skip/limit it stays cheap on large collections and does not repeat
+// or drop items when documents are inserted or removed between requests.
+package pagination
+
+import (
+	"encoding/base64"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IDField breaks ties between items with the same sort key.
+const IDField = "_id"
+
+// ErrInvalidCursor is returned for cursors that cannot be decoded or that
+// were issued for a different sort field.
+var ErrInvalidCursor = errors.InvalidArgument("invalid cursor")
+
+// cursor is serialized as canonical extended JSON so that dates, numbers and
+// binary IDs come back with their BSON types and compare correctly.
+type cursor struct {
+	Field string      `bson:"f"`
+	Value interface{} `bson:"v"`
+	ID    interface{} `bson:"i"`
+}
+
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// NewSort sorts by field, ascending unless order is "desc". An empty field
+// sorts by _id.
+func NewSort(field, order string) Sort {
+	if field == "" {
+		field = IDField
+	}
+	return Sort{Field: field, Descending: order == "desc"}
+}
+
+// Keys returns the sort document, with _id appended so the order is total.
+func (s Sort) Keys() bson.D {
+	dir := 1
+	if s.Descending {
+		dir = -1
+	}
+	keys := bson.D{{Key: s.Field, Value: dir}}
+	if s.Field != IDField {
+		keys = append(keys, bson.E{Key: IDField, Value: dir})
+	}
+	return keys
+}
+
+// Cursor encodes the position of an item with the given sort value and ID.
+func (s Sort) Cursor(value, id interface{}) string {
+	data, err := bson.MarshalExtJSON(cursor{Field: s.Field, Value: value, ID: id}, true, false)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// After restricts filter to the items that follow the cursor. The condition
+// is added under $and so that it composes with an existing $or.
+func (s Sort) After(filter map[string]interface{}, token string) error {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	var c cursor
+	if err := bson.UnmarshalExtJSON(data, true, &c); err != nil || c.Field != s.Field {
+		return ErrInvalidCursor
+	}
+
+	op := "$gt"
+	if s.Descending {
+		op = "$lt"
+	}
+	var cond bson.M
+	if s.Field == IDField {
+		cond = bson.M{IDField: bson.M{op: c.ID}}
+	} else {
+		cond = bson.M{"$or": bson.A{
+			bson.M{s.Field: bson.M{op: c.Value}},
+			bson.M{s.Field: c.Value, IDField: bson.M{op: c.ID}},
+		}}
+	}
+
+	and, _ := filter["$and"].([]interface{})
+	filter["$and"] = append(and, cond)
+	return nil
+}
+
+// Page trims results fetched with a limit of limit+1 to limit items and
+// returns the cursor of the next page, or "" when this is the last page.
+// Results must be documents decoded as bson.M.
+func (s Sort) Page(results []interface{}, limit int) ([]interface{}, string) {
+	if len(results) <= limit {
+		return results, ""
+	}
+	results = results[:limit]
+	last, ok := results[limit-1].(bson.M)
+	if !ok {
+		return results, ""
+	}
+	return results, s.Cursor(last[s.Field], last[IDField])
+}
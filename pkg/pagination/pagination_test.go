@@ -0,0 +1,85 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ims-erp/system/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSort_Keys(t *testing.T) {
+	assert.Equal(t, bson.D{{Key: "issueDate", Value: -1}, {Key: "_id", Value: -1}}, NewSort("issueDate", "desc").Keys())
+	assert.Equal(t, bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}, NewSort("name", "asc").Keys())
+	assert.Equal(t, bson.D{{Key: "_id", Value: 1}}, NewSort("", "").Keys())
+}
+
+func TestSort_AfterRestoresBSONTypes(t *testing.T) {
+	issued := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	sort := NewSort("issueDate", "desc")
+	token := sort.Cursor(primitive.NewDateTimeFromTime(issued), "inv-42")
+	require.NotEmpty(t, token)
+
+	filter := map[string]interface{}{
+		"tenantId": "t1",
+		"$or":      []map[string]interface{}{{"invoiceNumber": "INV-1"}},
+	}
+	require.NoError(t, sort.After(filter, token))
+
+	assert.Equal(t, "t1", filter["tenantId"])
+	assert.Contains(t, filter, "$or")
+	and := filter["$and"].([]interface{})
+	require.Len(t, and, 1)
+	assert.Equal(t, bson.M{"$or": bson.A{
+		bson.M{"issueDate": bson.M{"$lt": primitive.NewDateTimeFromTime(issued)}},
+		bson.M{"issueDate": primitive.NewDateTimeFromTime(issued), "_id": bson.M{"$lt": "inv-42"}},
+	}}, and[0])
+}
+
+func TestSort_AfterByID(t *testing.T) {
+	sort := NewSort("", "asc")
+	filter := map[string]interface{}{}
+	require.NoError(t, sort.After(filter, sort.Cursor(nil, "c-7")))
+	assert.Equal(t, []interface{}{bson.M{"_id": bson.M{"$gt": "c-7"}}}, filter["$and"])
+}
+
+func TestSort_AfterRejectsInvalidCursor(t *testing.T) {
+	sort := NewSort("createdAt", "desc")
+	for name, token := range map[string]string{
+		"not base64":    "%%%",
+		"not json":      "bm90IGpzb24",
+		"other sort by": NewSort("name", "asc").Cursor("acme", "c-1"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := sort.After(map[string]interface{}{}, token)
+			assert.True(t, errors.Is(err, errors.CodeInvalidArgument))
+		})
+	}
+}
+
+func TestSort_Page(t *testing.T) {
+	sort := NewSort("name", "asc")
+	results := []interface{}{
+		bson.M{"_id": "c-1", "name": "Acme"},
+		bson.M{"_id": "c-2", "name": "Beta"},
+		bson.M{"_id": "c-3", "name": "Gamma"},
+	}
+
+	page, next := sort.Page(results, 2)
+	assert.Len(t, page, 2)
+	require.NotEmpty(t, next)
+
+	filter := map[string]interface{}{}
+	require.NoError(t, sort.After(filter, next))
+	assert.Equal(t, bson.M{"$or": bson.A{
+		bson.M{"name": bson.M{"$gt": "Beta"}},
+		bson.M{"name": "Beta", "_id": bson.M{"$gt": "c-2"}},
+	}}, filter["$and"].([]interface{})[0])
+
+	page, next = sort.Page(results, 3)
+	assert.Len(t, page, 3)
+	assert.Empty(t, next)
+}
@@ -0,0 +1,220 @@
+// Package pdf writes simple PDF documents: A4 pages of text and lines set
+// in the standard Helvetica fonts, which every PDF reader provides, so no
+// font is embedded, and files attached to the document. Text is encoded as Windows-1252, the encoding of the
+// standard fonts; characters outside it are written as "?".
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Page size of A4 in points. Coordinates start at the bottom left corner.
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document is a PDF document under construction.
+type Document struct {
+	pages       []*Page
+	attachments []attachment
+}
+
+// attachment is a file embedded in a Document.
+type attachment struct {
+	name        string
+	description string
+	data        []byte
+}
+
+// Page is a page of a Document.
+type Page struct {
+	content bytes.Buffer
+}
+
+// New returns an empty document.
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage appends a blank page to the document and returns it.
+func (d *Document) AddPage() *Page {
+	page := &Page{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// Pages returns the number of pages in the document.
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// Text writes text with its baseline starting at x, y.
+func (p *Page) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font, number(size), number(x), number(y), escape(encode(text)))
+}
+
+// TextRight writes text so that it ends at x.
+func (p *Page) TextRight(x, y, size float64, bold bool, text string) {
+	p.Text(x-Width(text, size), y, size, bold, text)
+}
+
+// Line draws a line of width 0.5 from x1, y1 to x2, y2.
+func (p *Page) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "0.5 w %s %s m %s %s l S\n", number(x1), number(y1), number(x2), number(y2))
+}
+
+// Rect draws the outline of a rectangle of width 0.5 whose bottom left
+// corner is at x, y.
+func (p *Page) Rect(x, y, width, height float64) {
+	fmt.Fprintf(&p.content, "0.5 w %s %s %s %s re S\n", number(x), number(y), number(width), number(height))
+}
+
+// Polyline draws connected lines of width lineWidth through points, given
+// as x, y pairs. A single point draws a dot.
+func (p *Page) Polyline(lineWidth float64, points [][2]float64) {
+	if len(points) == 0 {
+		return
+	}
+	// Round caps and joins make single points and sharp turns look drawn.
+	fmt.Fprintf(&p.content, "%s w 1 J 1 j %s %s m", number(lineWidth), number(points[0][0]), number(points[0][1]))
+	if len(points) == 1 {
+		fmt.Fprintf(&p.content, " %s %s l", number(points[0][0]), number(points[0][1]))
+	}
+	for _, point := range points[1:] {
+		fmt.Fprintf(&p.content, " %s %s l", number(point[0]), number(point[1]))
+	}
+	p.content.WriteString(" S 0 J 0 j\n")
+}
+
+// Attach embeds a file in the document under name, shown by readers in
+// their attachments panel.
+func (d *Document) Attach(name, description string, data []byte) {
+	d.attachments = append(d.attachments, attachment{name: name, description: description, data: data})
+}
+
+// Width estimates the width of text set in Helvetica at size. It is exact
+// for figures and separators and close enough for letters to align
+// columns.
+func Width(text string, size float64) float64 {
+	units := 0
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			units += 556
+		case r == ' ' || r == '\u00a0' || r == '.' || r == ',' || r == ':' || r == '/' || r == 'i' || r == 'l':
+			units += 278
+		case r == '-' || r == '(' || r == ')':
+			units += 333
+		case r >= 'A' && r <= 'Z':
+			units += 667
+		case r == 'm' || r == 'w':
+			units += 833
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// Fit shortens text with "..." until it is at most width wide at size.
+func Fit(text string, size, width float64) string {
+	if Width(text, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && Width(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// WriteTo writes the document to w. A document without pages gets one
+// blank page.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	pages := d.pages
+	if len(pages) == 0 {
+		pages = []*Page{{}}
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 4 are the catalog, the page tree and the two fonts; each
+	// page is followed by its content stream, and each attachment's file
+	// specification by the embedded file.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	attachments := 5 + 2*len(pages)
+	// The name tree lists attachments in name order.
+	files := append([]attachment{}, d.attachments...)
+	sort.SliceStable(files, func(i, j int) bool { return encode(files[i].name) < encode(files[j].name) })
+	if len(files) == 0 {
+		object("<< /Type /Catalog /Pages 2 0 R >>")
+	} else {
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i] = fmt.Sprintf("(%s) %d 0 R", escape(encode(file.name)), attachments+2*i)
+		}
+		object(fmt.Sprintf("<< /Type /Catalog /Pages 2 0 R /Names << /EmbeddedFiles << /Names [%s] >> >> >>", strings.Join(names, " ")))
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			number(PageWidth), number(PageHeight), 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()))
+	}
+	for i, file := range files {
+		name := escape(encode(file.name))
+		object(fmt.Sprintf("<< /Type /Filespec /F (%s) /UF (%s) /Desc (%s) /EF << /F %d 0 R >> >>",
+			name, name, escape(encode(file.description)), attachments+2*i+1))
+		object(fmt.Sprintf("<< /Type /EmbeddedFile /Length %d /Params << /Size %d >> >>\nstream\n%s\nendstream",
+			len(file.data), len(file.data), file.data))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.WriteTo(w)
+}
+
+func encode(text string) string {
+	encoded, err := encoding.ReplaceUnsupported(charmap.Windows1252.NewEncoder()).String(text)
+	if err != nil {
+		return text
+	}
+	return strings.ReplaceAll(encoded, "\x1a", "?")
+}
+
+func escape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", `\r`, "\n", `\n`).Replace(text)
+}
+
+func number(v float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+}
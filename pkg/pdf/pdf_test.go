@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTo(t *testing.T) {
+	doc := New()
+	first := doc.AddPage()
+	first.Text(50, 800, 12, true, "Rechnung (Entwurf)")
+	first.TextRight(545, 780, 10, false, "1.234,50\u00a0€")
+	first.Line(50, 770, 545, 770)
+	doc.AddPage().Text(50, 800, 10, false, "Größe: 日本")
+
+	var buf bytes.Buffer
+	_, err := doc.WriteTo(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+
+	assert.True(t, strings.HasPrefix(out, "%PDF-1.4\n"))
+	assert.True(t, strings.HasSuffix(out, "%%EOF\n"))
+	assert.Contains(t, out, "/Count 2")
+	assert.Contains(t, out, `(Rechnung \(Entwurf\)) Tj`)
+	assert.Contains(t, out, "(1.234,50\xa0\x80) Tj", "text is Windows-1252")
+	assert.Contains(t, out, "(Gr\xf6\xdfe: ??) Tj", "characters outside Windows-1252 are replaced")
+
+	// Every cross-reference entry points at the object it numbers.
+	xref := regexp.MustCompile(`(?m)^(\d{10}) 00000 n $`).FindAllStringSubmatch(out, -1)
+	require.Len(t, xref, 8)
+	for i, entry := range xref {
+		offset, err := strconv.Atoi(entry[1])
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out[offset:], fmt.Sprintf("%d 0 obj", i+1)), "object %d", i+1)
+	}
+	startxref := regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(out)
+	require.Len(t, startxref, 2)
+	offset, _ := strconv.Atoi(startxref[1])
+	assert.True(t, strings.HasPrefix(out[offset:], "xref\n"))
+}
+
+func TestWriteTo_EmptyDocumentHasOnePage(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New().WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "/Count 1")
+}
+
+func TestWriteTo_Attachments(t *testing.T) {
+	doc := New()
+	page := doc.AddPage()
+	page.Rect(50, 700, 200, 60)
+	page.Polyline(1.2, [][2]float64{{60, 710}, {80, 740}, {100, 715}})
+	doc.Attach("z.txt", "second", []byte("zz"))
+	doc.Attach("a (1).pdf", "first", []byte("%PDF-1.4 original"))
+
+	var buf bytes.Buffer
+	_, err := doc.WriteTo(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+
+	assert.Contains(t, out, "0.5 w 50 700 200 60 re S")
+	assert.Contains(t, out, "1.2 w 1 J 1 j 60 710 m 80 740 l 100 715 l S")
+	assert.Contains(t, out, `/EmbeddedFiles << /Names [(a \(1\).pdf) 7 0 R (z.txt) 9 0 R] >>`, "names are sorted")
+	assert.Contains(t, out, "/Type /EmbeddedFile /Length 17 /Params << /Size 17 >> >>\nstream\n%PDF-1.4 original\nendstream")
+
+	xref := regexp.MustCompile(`(?m)^(\d{10}) 00000 n $`).FindAllStringSubmatch(out, -1)
+	require.Len(t, xref, 10)
+	for i, entry := range xref {
+		offset, err := strconv.Atoi(entry[1])
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out[offset:], fmt.Sprintf("%d 0 obj", i+1)), "object %d", i+1)
+	}
+}
+
+func TestWidth(t *testing.T) {
+	assert.InDelta(t, 4*5.56+2.78, Width("1,234", 10), 0.001)
+	assert.Equal(t, 0.0, Width("", 12))
+}
+
+func TestFit(t *testing.T) {
+	assert.Equal(t, "short", Fit("short", 10, 100))
+	fitted := Fit(strings.Repeat("long description ", 10), 10, 100)
+	assert.True(t, strings.HasSuffix(fitted, "..."))
+	assert.LessOrEqual(t, Width(fitted, 10), 100.0)
+}
@@ -0,0 +1,148 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AWSProvider reads secrets from AWS Secrets Manager. Requests are signed
+// with Signature Version 4 using static credentials, which default to the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables.
+type AWSProvider struct {
+	region       string
+	endpoint     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+	now          func() time.Time
+}
+
+// NewAWSProvider returns a provider for region. endpoint may be empty to use
+// the regional Secrets Manager endpoint.
+func NewAWSProvider(region, endpoint, accessKey, secretKey, sessionToken string) *AWSProvider {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+	return &AWSProvider{
+		region:       region,
+		endpoint:     strings.TrimRight(endpoint, "/"),
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		now:          time.Now,
+	}
+}
+
+func (p *AWSProvider) Get(ctx context.Context, name string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"SecretId": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.sign(req, body)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		json.Unmarshal(data, &failure)
+		if strings.HasSuffix(failure.Type, "ResourceNotFoundException") {
+			return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+		return "", fmt.Errorf("secrets manager returned %d: %s %s", resp.StatusCode, failure.Type, failure.Message)
+	}
+
+	var out struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode secrets manager response: %w", err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", name)
+	}
+	return *out.SecretString, nil
+}
+
+// sign adds a Signature Version 4 Authorization header to req.
+func (p *AWSProvider) sign(req *http.Request, body []byte) {
+	const service = "secretsmanager"
+	now := p.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.sessionToken)
+	}
+
+	u, _ := url.Parse(p.endpoint)
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         u.Host,
+		"x-amz-date":   amzDate,
+		"x-amz-target": req.Header.Get("X-Amz-Target"),
+	}
+	names := []string{"content-type", "host", "x-amz-date"}
+	if p.sessionToken != "" {
+		headers["x-amz-security-token"] = p.sessionToken
+		names = append(names, "x-amz-security-token")
+	}
+	names = append(names, "x-amz-target")
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := day + "/" + p.region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+p.secretKey), day)
+	key = hmacSHA256(key, p.region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
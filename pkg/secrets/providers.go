@@ -0,0 +1,48 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvProvider reads secrets from environment variables. Names are upper-cased
+// with '/', '-' and '.' replaced by '_', so "stripe/api-key" reads
+// STRIPE_API_KEY.
+type EnvProvider struct {
+	Prefix string
+}
+
+func (p EnvProvider) Get(ctx context.Context, name string) (string, error) {
+	key := p.Prefix + strings.ToUpper(strings.NewReplacer("/", "_", "-", "_", ".", "_").Replace(name))
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("%w: environment variable %s", ErrSecretNotFound, key)
+	}
+	return value, nil
+}
+
+// FileProvider reads each secret from a file under Dir, the layout used by
+// Docker and Kubernetes secret mounts. Files are read on every lookup, so a
+// rewritten file is picked up without a restart.
+type FileProvider struct {
+	Dir string
+}
+
+func (p FileProvider) Get(ctx context.Context, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRef, name)
+	}
+	data, err := os.ReadFile(filepath.Join(p.Dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
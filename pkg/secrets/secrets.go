@@ -0,0 +1,112 @@
+// Package secrets fetches credentials such as payment provider keys, MinIO
+// keys or NATS passwords from a secrets store instead of config files.
+//
+// A reference names a secret in the provider and optionally a key inside it:
+//
+//	stripe           the whole secret
+//	stripe#api_key   the api_key field of a JSON secret
+//
+// Vault secrets are key/value maps, so Vault references always name a key.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSecretNotFound = errors.New("secret not found")
+	ErrInvalidRef     = errors.New("invalid secret reference")
+)
+
+// Provider returns the current value of the named secret.
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Resolve looks up ref in p, extracting the key after '#' from a JSON
+// object secret.
+func Resolve(ctx context.Context, p Provider, ref string) (string, error) {
+	name, key, _ := strings.Cut(ref, "#")
+	if name == "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRef, ref)
+	}
+	value, err := p.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+	if key == "" {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", name, err)
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s: %w", name, key, ErrSecretNotFound)
+	}
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(field), nil
+}
+
+// Cache keeps secrets for ttl so a busy caller does not hit the store on
+// every lookup. A rotated secret is picked up once its entry expires.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+func NewCache(p Provider, ttl time.Duration) *Cache {
+	return &Cache{provider: p, ttl: ttl, now: time.Now, entries: make(map[string]cacheEntry)}
+}
+
+func (c *Cache) Get(ctx context.Context, name string) (string, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[name] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// Invalidate drops cached entries so the next lookup reads the store, e.g.
+// after a credential was rejected because it has been rotated.
+func (c *Cache) Invalidate(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(names) == 0 {
+		c.entries = make(map[string]cacheEntry)
+		return
+	}
+	for _, name := range names {
+		delete(c.entries, name)
+	}
+}
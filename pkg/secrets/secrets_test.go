@@ -0,0 +1,164 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingProvider struct {
+	values map[string]string
+	calls  int
+}
+
+func (p *countingProvider) Get(ctx context.Context, name string) (string, error) {
+	p.calls++
+	v, ok := p.values[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return v, nil
+}
+
+func TestResolve(t *testing.T) {
+	p := &countingProvider{values: map[string]string{
+		"nats":   "s3cret-pass",
+		"stripe": `{"api_key":"sk_live_123","retries":3}`,
+	}}
+	ctx := context.Background()
+
+	v, err := Resolve(ctx, p, "nats")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret-pass", v)
+
+	v, err = Resolve(ctx, p, "stripe#api_key")
+	require.NoError(t, err)
+	assert.Equal(t, "sk_live_123", v)
+
+	v, err = Resolve(ctx, p, "stripe#retries")
+	require.NoError(t, err)
+	assert.Equal(t, "3", v)
+
+	_, err = Resolve(ctx, p, "stripe#webhook_secret")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+	_, err = Resolve(ctx, p, "nats#password")
+	assert.Error(t, err)
+	_, err = Resolve(ctx, p, "#key")
+	assert.True(t, errors.Is(err, ErrInvalidRef))
+}
+
+func TestCache_RefreshesAfterTTL(t *testing.T) {
+	p := &countingProvider{values: map[string]string{"db": "v1"}}
+	c := NewCache(p, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		v, err := c.Get(context.Background(), "db")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", v)
+	}
+	assert.Equal(t, 1, p.calls)
+
+	p.values["db"] = "v2"
+	now = now.Add(2 * time.Minute)
+	v, _ := c.Get(context.Background(), "db")
+	assert.Equal(t, "v2", v)
+
+	p.values["db"] = "v3"
+	c.Invalidate("db")
+	v, _ = c.Get(context.Background(), "db")
+	assert.Equal(t, "v3", v)
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "minio"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "minio", "secret_key"), []byte("minio-secret\n"), 0o600))
+	p := FileProvider{Dir: dir}
+
+	v, err := p.Get(context.Background(), "minio/secret_key")
+	require.NoError(t, err)
+	assert.Equal(t, "minio-secret", v)
+
+	_, err = p.Get(context.Background(), "minio/access_key")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+	_, err = p.Get(context.Background(), "../etc/passwd")
+	assert.True(t, errors.Is(err, ErrInvalidRef))
+}
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("STRIPE_API_KEY", "sk_test_1")
+	v, err := EnvProvider{}.Get(context.Background(), "stripe/api-key")
+	require.NoError(t, err)
+	assert.Equal(t, "sk_test_1", v)
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/erp/stripe" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"api_key":"sk_vault"},"metadata":{"version":2}}}`))
+	}))
+	defer srv.Close()
+
+	p := NewVaultProvider(srv.URL, "root", "kv", "")
+	v, err := Resolve(context.Background(), p, "erp/stripe#api_key")
+	require.NoError(t, err)
+	assert.Equal(t, "sk_vault", v)
+
+	_, err = p.Get(context.Background(), "erp/paypal")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	_, err = NewVaultProvider(srv.URL, "wrong", "kv", "").Get(context.Background(), "erp/stripe")
+	assert.ErrorContains(t, err, "403")
+}
+
+func TestAWSProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260304/eu-west-1/secretsmanager/aws4_request") ||
+			!strings.Contains(auth, "SignedHeaders=content-type;host;x-amz-date;x-amz-target") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"SecretId":"erp/nats"`) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+			return
+		}
+		w.Write([]byte(`{"Name":"erp/nats","SecretString":"nats-pass"}`))
+	}))
+	defer srv.Close()
+
+	p := NewAWSProvider("eu-west-1", srv.URL, "AKID", "SECRET", "")
+	p.now = func() time.Time { return time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC) }
+
+	v, err := p.Get(context.Background(), "erp/nats")
+	require.NoError(t, err)
+	assert.Equal(t, "nats-pass", v)
+
+	_, err = p.Get(context.Background(), "erp/missing")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
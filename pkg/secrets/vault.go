@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultProvider reads secrets from a HashiCorp Vault KV version 2 engine.
+// The value of a secret is its key/value data as a JSON object.
+type VaultProvider struct {
+	address   string
+	token     string
+	mount     string
+	namespace string
+	client    *http.Client
+}
+
+func NewVaultProvider(address, token, mount, namespace string) *VaultProvider {
+	if mount == "" {
+		mount = "secret"
+	}
+	return &VaultProvider{
+		address:   strings.TrimRight(address, "/"),
+		token:     token,
+		mount:     strings.Trim(mount, "/"),
+		namespace: namespace,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *VaultProvider) Get(ctx context.Context, name string) (string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", p.address, p.mount, strings.Trim(name, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var out struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	if len(out.Data.Data) == 0 || string(out.Data.Data) == "null" {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return string(out.Data.Data), nil
+}
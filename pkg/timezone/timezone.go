@@ -0,0 +1,101 @@
+// Package timezone turns the dates of report requests into instants. A
+// report day runs from midnight to midnight in the tenant's time zone, or in
+// the zone the caller names with ?tz=, not in the server's: the 1 March
+// report of a tenant in Tokyo starts at 2026-02-28T15:00:00Z.
+//
+// Due and issue dates are calendar dates, stored as midnight UTC; they are
+// compared with the calendar date of an instant in the tenant's zone.
+package timezone
+
+import (
+	"net/http"
+	"time"
+	// Embedded so that zones load in images without /usr/share/zoneinfo.
+	_ "time/tzdata"
+
+	"github.com/ims-erp/system/pkg/errors"
+)
+
+// Param is the query parameter naming the time zone of a report.
+const Param = "tz"
+
+// DateLayout is the layout of dates in report parameters.
+const DateLayout = "2006-01-02"
+
+// Load returns the IANA time zone name, such as "Europe/Berlin". An empty
+// name is UTC.
+func Load(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// FromRequest returns the time zone named by the tz parameter of r, or
+// fallback when r has none.
+func FromRequest(r *http.Request, fallback *time.Location) (*time.Location, error) {
+	name := r.URL.Query().Get(Param)
+	if name == "" {
+		return fallback, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.InvalidArgument("unknown time zone: %s", name)
+	}
+	return loc, nil
+}
+
+// StartOfDay returns the midnight that starts the day of t in loc.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// StartOfMonth returns the midnight that starts the month of t in loc.
+func StartOfMonth(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+}
+
+// Day returns the bounds of date, YYYY-MM-DD, in loc: its midnight and the
+// next one, which is 23 or 25 hours later when daylight saving time starts
+// or ends that day. end is exclusive.
+func Day(date string, loc *time.Location) (start, end time.Time, err error) {
+	start, err = time.ParseInLocation(DateLayout, date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// ParseBound parses the start or end of a report period: an RFC 3339
+// timestamp, which carries its own offset, or a date YYYY-MM-DD. A date is
+// its midnight in loc as a start, and the next midnight as an end, so that
+// an end date includes its whole day.
+func ParseBound(value string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	start, next, err := Day(value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		return next, nil
+	}
+	return start, nil
+}
+
+// Date returns the calendar date of t in loc as midnight UTC, the form
+// calendar dates are stored in.
+func Date(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// DaysSince returns how many calendar days the stored calendar date lies
+// before the date of now in loc: 1 for yesterday, 0 for today, negative for
+// dates still to come.
+func DaysSince(date, now time.Time, loc *time.Location) int {
+	return int(Date(now, loc).Sub(Date(date, time.UTC)).Hours() / 24)
+}
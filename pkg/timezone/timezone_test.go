@@ -0,0 +1,89 @@
+package timezone
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := Load(name)
+	require.NoError(t, err)
+	return loc
+}
+
+func TestLoad(t *testing.T) {
+	assert.Equal(t, time.UTC, mustLoad(t, ""))
+	assert.Equal(t, "Asia/Tokyo", mustLoad(t, "Asia/Tokyo").String())
+	_, err := Load("Mars/Olympus")
+	assert.Error(t, err)
+}
+
+func TestFromRequest(t *testing.T) {
+	tokyo := mustLoad(t, "Asia/Tokyo")
+
+	loc, err := FromRequest(httptest.NewRequest("GET", "/report", nil), tokyo)
+	require.NoError(t, err)
+	assert.Equal(t, tokyo, loc)
+
+	loc, err = FromRequest(httptest.NewRequest("GET", "/report?tz=America/New_York", nil), tokyo)
+	require.NoError(t, err)
+	assert.Equal(t, "America/New_York", loc.String())
+
+	_, err = FromRequest(httptest.NewRequest("GET", "/report?tz=Nowhere", nil), tokyo)
+	assert.EqualError(t, err, "unknown time zone: Nowhere")
+}
+
+func TestDay(t *testing.T) {
+	start, end, err := Day("2026-03-01", mustLoad(t, "Asia/Tokyo"))
+	require.NoError(t, err)
+	assert.Equal(t, "2026-02-28T15:00:00Z", start.UTC().Format(time.RFC3339))
+	assert.Equal(t, "2026-03-01T15:00:00Z", end.UTC().Format(time.RFC3339))
+
+	// Daylight saving time starts in Berlin on 29 March 2026: the day has 23 hours.
+	start, end, err = Day("2026-03-29", mustLoad(t, "Europe/Berlin"))
+	require.NoError(t, err)
+	assert.Equal(t, 23*time.Hour, end.Sub(start))
+
+	_, _, err = Day("01.03.2026", time.UTC)
+	assert.Error(t, err)
+}
+
+func TestParseBound(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	start, err := ParseBound("2026-01-10", berlin, false)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-01-09T23:00:00Z", start.UTC().Format(time.RFC3339))
+
+	end, err := ParseBound("2026-01-10", berlin, true)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-01-10T23:00:00Z", end.UTC().Format(time.RFC3339))
+
+	instant, err := ParseBound("2026-01-10T12:00:00+05:00", berlin, true)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-01-10T07:00:00Z", instant.UTC().Format(time.RFC3339))
+}
+
+func TestStartOfDayAndMonth(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+	now := time.Date(2026, 4, 1, 2, 0, 0, 0, time.UTC) // 31 March, 22:00 in New York
+
+	assert.Equal(t, "2026-03-31T00:00:00-04:00", StartOfDay(now, newYork).Format(time.RFC3339))
+	assert.Equal(t, "2026-03-01T00:00:00-05:00", StartOfMonth(now, newYork).Format(time.RFC3339))
+	assert.Equal(t, "2026-04-01T00:00:00Z", StartOfMonth(now, time.UTC).Format(time.RFC3339))
+}
+
+func TestDaysSince(t *testing.T) {
+	due := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 0, DaysSince(due, now, time.UTC))
+	assert.Equal(t, 1, DaysSince(due, now, mustLoad(t, "Asia/Tokyo")), "already 2 March in Tokyo")
+	assert.Equal(t, 0, DaysSince(due, now, mustLoad(t, "America/Los_Angeles")))
+	assert.Equal(t, -2, DaysSince(due, now.AddDate(0, 0, -2), time.UTC))
+}